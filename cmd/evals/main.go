@@ -0,0 +1,117 @@
+// Command evals replays the golden conversations in a directory against the orchestrator and the plugins,
+// with the responses the cases script or a real model, and reports which cases pass. It exits with status 1
+// when a case fails, to be run after changing the prompts, the routing or the plugins.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+
+	"mindpalace/internal/config"
+	"mindpalace/internal/evals"
+	"mindpalace/internal/llmprocessor"
+	"mindpalace/internal/orchestration"
+	"mindpalace/internal/plugins"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+func main() {
+	os.Exit(runEvals())
+}
+
+// runEvals runs the cases and returns the exit status: 0 if all passed, 1 if a case failed, 2 if they could
+// not be run
+func runEvals() int {
+	casesDir := flag.String("cases", "evals", "Directory of the golden conversations, a .json file per case")
+	mode := flag.String("llm", "mock", "LLM to run the cases with: mock replays the responses they script, ollama calls the configured model")
+	configPath := flag.String("config", config.DefaultPath, "Path of the configuration file, for the model, the agents' models, the limits and the plugins' settings")
+	run := flag.String("run", "", "Only run the cases whose name matches this regular expression")
+	jsonPath := flag.String("json", "", "Also write the report as JSON to this file")
+	verbose := flag.Bool("v", false, "Log what the orchestrator does, besides errors")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage:\n  evals [options]\n\nRun from the repository root, the plugins are loaded from ./plugins.\n\nOptions:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	logging.SetVerbosity(logging.LogLevelError)
+	if *verbose {
+		logging.SetVerbosity(logging.LogLevelDebug)
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 2
+	}
+	cases, err := evals.LoadCases(*casesDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load cases: %v\n", err)
+		return 2
+	}
+	if *run != "" {
+		pattern, err := regexp.Compile(*run)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -run pattern: %v\n", err)
+			return 2
+		}
+		matching := cases[:0]
+		for _, c := range cases {
+			if pattern.MatchString(c.Name) {
+				matching = append(matching, c)
+			}
+		}
+		cases = matching
+	}
+
+	var llm orchestration.LLMClientInterface
+	switch *mode {
+	case "mock":
+	case "ollama":
+		client := llmprocessor.NewLLMClient()
+		client.Configure(cfg.ChatEndpoint(), cfg.Ollama.Model, cfg.Limits.ContextTokens)
+		llm = client
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown -llm %q, use mock or ollama\n", *mode)
+		return 2
+	}
+
+	// Every case gets an event store and plugins of its own, set up as configured
+	setup := func(llm orchestration.LLMClientInterface) (*evals.Environment, error) {
+		env, err := evals.NewEnvironment(llm, func(ep *eventsourcing.EventProcessor) orchestration.PluginManagerInterface {
+			pluginManager := plugins.NewPluginManager(ep)
+			pluginManager.SetDisabled(cfg.Plugins.Disabled)
+			pluginManager.Configure(cfg.Plugin)
+			pluginManager.ProvideLocations(cfg.Locations())
+			return pluginManager
+		})
+		if err != nil {
+			return nil, err
+		}
+		env.Orchestrator.SetAgentModels(cfg.AgentModels())
+		env.Orchestrator.SetToolResultLimit(cfg.Limits.ToolResultTokens, cfg.Limits.SummarizeToolResults)
+		env.Orchestrator.SetToolLimit(cfg.Limits.MaxTools)
+		return env, nil
+	}
+
+	report := evals.NewRunner(setup, llm).Run(cases)
+	report.Write(os.Stdout)
+	if *jsonPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*jsonPath, data, 0644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write the report: %v\n", err)
+			return 2
+		}
+	}
+	if report.Failed() > 0 {
+		return 1
+	}
+	return 0
+}
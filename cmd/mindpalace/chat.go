@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"mindpalace/internal/chatclient"
+)
+
+// runChat runs the mindpalace chat subcommand: a terminal REPL talking to a MindPalace started
+// with -headless, for servers without a display
+func runChat(args []string) int {
+	flags := flag.NewFlagSet("chat", flag.ExitOnError)
+	addr := flags.String("api", "localhost:8080", "Address of the HTTP API of the running MindPalace, unix:/path for a Unix socket")
+	session := flags.String("session", "", "Chat session to send the requests to (default: the active session)")
+	token := flags.String("token", os.Getenv("MINDPALACE_TOKEN"), "Token of the user to chat as, when MindPalace is shared with a household")
+	historyPath := flags.String("history", defaultHistoryPath(), "File the lines typed are kept in (empty disables)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage:\n  mindpalace chat [options]\n\nOptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	history, err := chatclient.LoadHistory(*historyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load the history: %v\n", err)
+		return 1
+	}
+	client := chatclient.NewClient(*addr)
+	client.SetToken(*token)
+	if _, err := client.Aggregates(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to reach MindPalace at %s, is it running with -headless? %v\n", *addr, err)
+		return 1
+	}
+	repl := chatclient.NewREPL(client, history, os.Stdout)
+	repl.SetSession(*session)
+
+	// Ctrl-C cancels the request in progress, and leaves when there is none
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		for range interrupts {
+			if !repl.Interrupt() {
+				fmt.Println()
+				os.Exit(0)
+			}
+		}
+	}()
+
+	if err := repl.Run(context.Background(), os.Stdin); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the input: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".mindpalace_history")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"mindpalace/internal/config"
+	"mindpalace/internal/plugins"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+	"mindpalace/pkg/pluginrpc"
+)
+
+// externalPluginStartTimeout is the time an external plugin gets to start and describe itself
+const externalPluginStartTimeout = 30 * time.Second
+
+// externalPluginWatchInterval is how often external plugins are checked for having exited or been rebuilt
+const externalPluginWatchInterval = 5 * time.Second
+
+// externalPlugins are the plugins running as processes of their own
+type externalPlugins struct {
+	hosts []*pluginrpc.Host
+}
+
+// startExternalPlugins starts the configured external plugins and installs them. It runs before the
+// events are loaded, so the store knows the plugins' event types.
+func startExternalPlugins(configured map[string]config.ExternalPluginConfig, pluginManager *plugins.PluginManager, store eventsourcing.EventStore) *externalPlugins {
+	started := &externalPlugins{}
+	for _, name := range slices.Sorted(maps.Keys(configured)) {
+		plugin := configured[name]
+		env := make([]string, 0, len(plugin.Env))
+		for key, value := range plugin.Env {
+			env = append(env, key+"="+value)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), externalPluginStartTimeout)
+		host, err := pluginrpc.Start(ctx, name, plugin.Command, plugin.Args, env)
+		cancel()
+		if err != nil {
+			logging.Error("Failed to start external plugin %s: %v", name, err)
+			continue
+		}
+		if err := pluginManager.Install(host.Plugin(), host.NewPlugin); err != nil {
+			logging.Error("Failed to install external plugin %s: %v", name, err)
+			host.Close(context.Background())
+			continue
+		}
+		host.SetEventSource(store.GetEvents)
+		host.Watch(externalPluginWatchInterval)
+		started.hosts = append(started.hosts, host)
+	}
+	return started
+}
+
+// Close stops the plugins' processes
+func (p *externalPlugins) Close(ctx context.Context) error {
+	for _, host := range p.hosts {
+		host.Close(ctx)
+	}
+	return nil
+}
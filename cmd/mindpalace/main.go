@@ -4,34 +4,96 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"sync"
+	"time"
 
 	"context"
 
+	"mindpalace/internal/archive"
 	"mindpalace/internal/audio"
+	"mindpalace/internal/audioinput"
+	"mindpalace/internal/audit"
+	"mindpalace/internal/auth"
+	"mindpalace/internal/briefing"
+	"mindpalace/internal/config"
+	"mindpalace/internal/examples"
+	"mindpalace/internal/feedback"
 	"mindpalace/internal/godot_ws"
+	"mindpalace/internal/grpcapi"
+	"mindpalace/internal/httpapi"
+	"mindpalace/internal/layout"
+	"mindpalace/internal/lifecycle"
+	"mindpalace/internal/links"
 	"mindpalace/internal/llmprocessor"
+	"mindpalace/internal/mcp"
+	"mindpalace/internal/memory"
 	"mindpalace/internal/orchestration"
+	"mindpalace/internal/pins"
 	"mindpalace/internal/plugins"
+	"mindpalace/internal/presence"
+	"mindpalace/internal/projections"
+	"mindpalace/internal/prompts"
+	"mindpalace/internal/reminders"
+	"mindpalace/internal/settings"
+	"mindpalace/internal/speakers"
+	"mindpalace/internal/tags"
+	"mindpalace/internal/themes"
+	"mindpalace/internal/tracing"
+	"mindpalace/internal/tts"
 	"mindpalace/internal/ui"
+	"mindpalace/internal/usage"
+	"mindpalace/internal/whispermodels"
 	"mindpalace/pkg/aggregate"
+	"mindpalace/pkg/cron"
 	"mindpalace/pkg/eventsourcing"
 	"mindpalace/pkg/logging"
 	"mindpalace/pkg/world"
 )
 
 func main() {
+	// mindpalace chat talks to a running instance instead of starting one
+	if len(os.Args) > 1 && os.Args[1] == "chat" {
+		os.Exit(runChat(os.Args[2:]))
+	}
+	// mindpalace mcp bridges MCP clients launching it to a running instance
+	if len(os.Args) > 1 && os.Args[1] == "mcp" {
+		os.Exit(runMCP(os.Args[2:]))
+	}
+
 	// Define command-line flags
 	var (
-		verboseFlag  bool
-		debugFlag    bool
-		traceFlag    bool
-		helpFlag     bool
-		versionFlag  bool
-		headlessFlag bool
-		storagePath  string
+		verboseFlag      bool
+		debugFlag        bool
+		traceFlag        bool
+		helpFlag         bool
+		versionFlag      bool
+		headlessFlag     bool
+		storagePath      string
+		ephemeralFlag    bool
+		dumpPath         string
+		snapshotInterval int
+		apiAddr          string
+		grpcAddr         string
+		mcpAddr          string
+		otelEndpoint     string
+		toolRetries      int
+		reminderLeads    string
+		ttsVoices        string
+		piperPath        string
+		ttsMuted         bool
+		silenceTimeout   time.Duration
+		whisperModel     string
+		modelsDir        string
+		configPath       string
+		logFormat        string
+		logLevels        string
+		logFile          string
+		shutdownTimeout  time.Duration
 	)
 
 	// Parse command-line flags
@@ -42,13 +104,37 @@ func main() {
 	flag.BoolVar(&versionFlag, "version", false, "Show version information")
 	flag.BoolVar(&headlessFlag, "headless", false, "Run in headless mode (no UI, web server only)")
 	flag.StringVar(&storagePath, "storage", "events.db", "Path to the events storage database")
+	flag.BoolVar(&ephemeralFlag, "ephemeral", false, "Keep the event log and the read models in memory, for demos and tests; -storage is ignored")
+	flag.StringVar(&dumpPath, "dump", "", "Write the event log to this file on exit, e.g. to keep what happened in an -ephemeral run and start from it with -storage")
+	flag.StringVar(&apiAddr, "api", "localhost:8080", "Address of the HTTP API in headless mode, unix:/path for a Unix socket")
+	flag.StringVar(&grpcAddr, "grpc", "", "Address of the gRPC API for integrations, e.g. localhost:9090 (empty disables)")
+	flag.StringVar(&mcpAddr, "mcp", "", "Address to serve the plugin tools to MCP clients on over SSE, e.g. localhost:8765 (empty disables)")
+	flag.StringVar(&otelEndpoint, "otel", "", "OTLP/HTTP endpoint to export the traces of requests to, e.g. localhost:4318, or stdout (default: $OTEL_EXPORTER_OTLP_ENDPOINT, empty disables)")
+	flag.IntVar(&snapshotInterval, "snapshot-interval", 100, "Snapshot aggregates every N events (0 disables)")
+	flag.IntVar(&toolRetries, "tool-retries", orchestration.DefaultRetryPolicy.MaxRetries, "Retry transiently failed tool calls up to N times with exponential backoff")
+	flag.StringVar(&reminderLeads, "reminder-leads", "24h,1h,10m", "Comma separated lead times for task and calendar reminders (empty disables)")
+	flag.StringVar(&ttsVoices, "tts-voices", "", "Comma separated piper voices to speak responses with, e.g. default=amy.onnx,taskmanager=alan.onnx (empty disables)")
+	flag.StringVar(&piperPath, "piper", "piper", "Path of the piper text-to-speech executable")
+	flag.BoolVar(&ttsMuted, "tts-muted", false, "Start with speech output muted")
+	flag.DurationVar(&silenceTimeout, "silence-timeout", 2*time.Second, "Submit spoken requests after this much silence (0 disables, requiring Submit)")
+	flag.StringVar(&whisperModel, "whisper-model", "", "Whisper model to transcribe with, e.g. small.en (default: the last model switched to, else "+whispermodels.DefaultModel+")")
+	flag.StringVar(&modelsDir, "models-dir", "models", "Directory the whisper models are downloaded to")
+	flag.StringVar(&configPath, "config", config.DefaultPath, "Path of the configuration file, reloaded when it changes or on SIGHUP")
+	flag.StringVar(&logFormat, "log-format", "text", "Format of the log lines: text or json")
+	flag.StringVar(&logLevels, "log-levels", "", "Comma separated log levels per subsystem, e.g. audio=debug,llm=trace")
+	flag.StringVar(&logFile, "log-file", "", "Also write the log to this file, rotated as configured in [logging] (empty disables)")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 15*time.Second, "Time to shut down in on SIGTERM or SIGINT, requests still in progress afterwards are cancelled")
 	flag.Parse()
+	flagsSet := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { flagsSet[f.Name] = true })
 
 	// Show help if requested
 	if helpFlag {
 		fmt.Println("MindPalace - An event-sourced AI assistant")
 		fmt.Println("\nUsage:")
 		fmt.Println("  mindpalace [options]")
+		fmt.Println("  mindpalace chat [options]   chat with a running headless MindPalace in the terminal")
+		fmt.Println("  mindpalace mcp [options]    connect an MCP client over stdio to a running MindPalace started with -mcp")
 		fmt.Println("\nOptions:")
 		flag.PrintDefaults()
 		os.Exit(0)
@@ -81,20 +167,90 @@ func main() {
 			eventType, err, recoveryData, stackTrace)
 	})
 
+	// Load the configuration, applied to the components once they are created
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		logging.Error("Failed to load configuration: %v", err)
+		os.Exit(1)
+	}
+
+	// Configure the loggers from the configuration, the logging flags take precedence
+	configureLogging := func(cfg *config.Config) error {
+		opts, err := cfg.LoggingOptions()
+		if err != nil {
+			return err
+		}
+		if flagsSet["log-format"] {
+			if opts.Format, err = logging.ParseFormat(logFormat); err != nil {
+				return err
+			}
+		}
+		if flagsSet["log-levels"] {
+			if opts.Levels, err = logging.ParseLevels(logLevels); err != nil {
+				return err
+			}
+		}
+		if flagsSet["log-file"] {
+			opts.File = logFile
+		}
+		return logging.Configure(opts)
+	}
+	if err := configureLogging(cfg); err != nil {
+		logging.Error("Failed to configure logging: %v", err)
+		os.Exit(1)
+	}
+
+	// Components register how they stop, in the reverse order of starting
+	lc := lifecycle.NewManager(shutdownTimeout)
+
+	// Traces of the requests, flushed last so the requests finishing while shutting down are in them
+	if shutdownTracing, err := tracing.Setup(context.Background(), otelEndpoint); err != nil {
+		logging.Error("Failed to set up tracing: %v", err)
+	} else {
+		lc.OnShutdown("tracing", shutdownTracing)
+	}
+
 	// Basic setup
-	store, _ := eventsourcing.NewSQLiteEventStore(storagePath)
-	defer store.Close()
+	var store *eventsourcing.SQLiteEventStore
+	readModelsPath := filepath.Join(filepath.Dir(storagePath), "readmodels.db")
+	if ephemeralFlag {
+		if store, err = eventsourcing.NewMemoryEventStore(); err != nil {
+			logging.Error("Failed to create the in-memory event store: %v", err)
+			os.Exit(1)
+		}
+		readModelsPath = ":memory:"
+		logging.Info("Running ephemeral, the events are kept in memory only")
+	} else if store, err = eventsourcing.NewSQLiteEventStore(storagePath); err != nil {
+		logging.Error("Failed to open the event store %s: %v", storagePath, err)
+		os.Exit(1)
+	}
+	lc.OnShutdown("event store", func(ctx context.Context) error {
+		if dumpPath != "" {
+			if err := store.Dump(dumpPath); err != nil {
+				logging.Error("Failed to dump the event log to %s: %v", dumpPath, err)
+			} else {
+				logging.Info("Dumped the event log to %s", dumpPath)
+			}
+		}
+		return store.Close()
+	})
 	aggStore := aggregate.NewAggregateManager()
 	ep := eventsourcing.NewEventProcessor(store, nil)
 	eb := eventsourcing.NewSimpleEventBus(store, aggStore, ep.DeltaChan())
 	ep.EventBus = eb
 	eventsourcing.SetGlobalEventBus(eb)
+	lc.OnShutdown("event bus", func(ctx context.Context) error {
+		eb.Close()
+		return nil
+	})
 	pluginManager := plugins.NewPluginManager(ep)
+	externals := startExternalPlugins(cfg.Plugins.External, pluginManager, store)
+	lc.OnShutdown("external plugins", externals.Close)
 	llmClient := llmprocessor.NewLLMClient()
 
 	// Migrate from old file store if exists
 	oldFilePath := "events.json"
-	if _, err := os.Stat(oldFilePath); err == nil {
+	if _, err := os.Stat(oldFilePath); err == nil && !ephemeralFlag {
 		oldStore := eventsourcing.NewFileEventStore(oldFilePath)
 		if err := oldStore.Load(); err == nil {
 			eventsourcing.MigrateFromFileToSQLite(oldStore, store)
@@ -112,12 +268,166 @@ func main() {
 	logging.Info("Loaded %d events", len(events))
 
 	// Register aggregates
-	for _, plug := range pluginManager.GetLLMPlugins() {
+	for _, plug := range pluginManager.GetAllLLMPlugins() {
 		aggStore.RegisterAggregate(plug.Name(), plug.Aggregate())
 	}
+	// Household members get plugins, and so tasks, notes and the like, of their own
+	startupUsers := cfg.UserNames()
+	for _, userID := range startupUsers {
+		for _, plug := range pluginManager.AddUser(userID) {
+			aggStore.RegisterUserAggregate(userID, plug.Name(), plug.Aggregate())
+		}
+	}
+	// Plugins the user has MindPalace create are installed while running
+	pluginManager.OnPluginLoaded(func(userID string, plug eventsourcing.Plugin) {
+		if userID == "" {
+			aggStore.RegisterAggregate(plug.Name(), plug.Aggregate())
+		} else {
+			aggStore.RegisterUserAggregate(userID, plug.Name(), plug.Aggregate())
+		}
+	})
 	orchAgg := orchestration.NewOrchestrationAggregate()
 	aggStore.RegisterAggregate("orchestration", orchAgg)
-	aggStore.RebuildState(events)
+	reminderAgg := reminders.NewReminderAggregate()
+	aggStore.RegisterAggregate("reminders", reminderAgg)
+	briefingAgg := briefing.NewBriefingAggregate()
+	aggStore.RegisterAggregate("briefing", briefingAgg)
+	aggStore.RegisterAggregate("layout", layout.NewLayoutAggregate())
+	aggStore.RegisterAggregate("presence", presence.NewPresenceAggregate())
+	usageAgg := usage.NewUsageAggregate()
+	aggStore.RegisterAggregate("usage", usageAgg)
+	ep.RegisterCommand("ShowUsage", eventsourcing.NewCommand(usageAgg.ShowUsageCommand))
+	// One taxonomy for the tags of all plugins, the plugins store tags in their canonical form
+	tagRegistry := tags.NewRegistry(aggStore)
+	aggStore.RegisterAggregate("tags", tagRegistry)
+	ep.RegisterCommand("AddTagAlias", eventsourcing.NewCommand(tagRegistry.AddTagAliasCommand))
+	ep.RegisterCommand("RemoveTagAlias", eventsourcing.NewCommand(tagRegistry.RemoveTagAliasCommand))
+	ep.RegisterCommand("ListByTag", eventsourcing.NewCommand(tagRegistry.ListByTagCommand))
+	pluginManager.ProvideTagNormalizers(tagRegistry.NormalizerFor)
+	// Links between the items of different plugins, the plugins show them as badges on their items
+	linkRegistry := links.NewRegistry(aggStore)
+	aggStore.RegisterAggregate("links", linkRegistry)
+	ep.RegisterCommand("LinkItems", eventsourcing.NewCommand(linkRegistry.LinkItemsCommand))
+	ep.RegisterCommand("UnlinkItems", eventsourcing.NewCommand(linkRegistry.UnlinkItemsCommand))
+	ep.RegisterCommand("RelatedItems", eventsourcing.NewCommand(linkRegistry.RelatedItemsCommand))
+	pluginManager.ProvideLinkSources(linkRegistry.SourceFor)
+	// Examples of requests and their tool calls shown to the agents, the plugins' own and those added
+	exampleRegistry := examples.NewRegistry(pluginManager)
+	aggStore.RegisterAggregate("examples", exampleRegistry)
+	ep.RegisterCommand("AddExample", eventsourcing.NewCommand(exampleRegistry.AddExampleCommand))
+	ep.RegisterCommand("RemoveExample", eventsourcing.NewCommand(exampleRegistry.RemoveExampleCommand))
+	ep.RegisterCommand("ListExamples", eventsourcing.NewCommand(exampleRegistry.ListExamplesCommand))
+	promptRegistry := prompts.NewRegistry(pluginManager)
+	aggStore.RegisterAggregate("prompts", promptRegistry)
+	ep.RegisterCommand("AddPromptVersion", eventsourcing.NewCommand(promptRegistry.AddPromptVersionCommand))
+	ep.RegisterCommand("ActivatePrompt", eventsourcing.NewCommand(promptRegistry.ActivatePromptCommand))
+	ep.RegisterCommand("StartPromptExperiment", eventsourcing.NewCommand(promptRegistry.StartPromptExperimentCommand))
+	ep.RegisterCommand("StopPromptExperiment", eventsourcing.NewCommand(promptRegistry.StopPromptExperimentCommand))
+	ep.RegisterCommand("ListPrompts", eventsourcing.NewCommand(promptRegistry.ListPromptsCommand))
+	ep.RegisterCommand("ShowPromptExperiment", eventsourcing.NewCommand(promptRegistry.ShowPromptExperimentCommand))
+	// Ratings and comments on the answers, to judge changes of prompts and models; corrections are shown to MindPalace
+	feedbackRegistry := feedback.NewRegistry()
+	aggStore.RegisterAggregate("feedback", feedbackRegistry)
+	ep.RegisterCommand("GiveFeedback", eventsourcing.NewCommand(feedbackRegistry.GiveFeedbackCommand))
+	ep.RegisterCommand("WithdrawFeedback", eventsourcing.NewCommand(feedbackRegistry.WithdrawFeedbackCommand))
+	ep.RegisterCommand("ListFeedback", eventsourcing.NewCommand(feedbackRegistry.ListFeedbackCommand))
+	// Facts the user pinned, part of every system prompt however long the conversation gets
+	pinRegistry := pins.NewRegistry()
+	aggStore.RegisterAggregate("pins", pinRegistry)
+	ep.RegisterCommand("PinFact", eventsourcing.NewCommand(pinRegistry.PinFactCommand))
+	ep.RegisterCommand("UnpinFact", eventsourcing.NewCommand(pinRegistry.UnpinFactCommand))
+	ep.RegisterCommand("ListPins", eventsourcing.NewCommand(pinRegistry.ListPinsCommand))
+	// Plugin commands that keep panicking are quarantined until re-enabled
+	quarantine := plugins.NewQuarantine(eventsourcing.GetGlobalRecoveryManager().Breaker(), eb)
+	aggStore.RegisterAggregate("quarantine", quarantine)
+	ep.RegisterCommand("ReenablePlugin", eventsourcing.NewCommand(quarantine.ReenablePluginCommand))
+	archiver := archive.NewArchiver(store, aggStore)
+	archiver.SetRedactor(orchAgg)
+	ep.RegisterCommand("ExportEvents", eventsourcing.NewCommand(archiver.ExportEventsCommand))
+	ep.RegisterCommand("ImportEvents", eventsourcing.NewCommand(archiver.ImportEventsCommand))
+	// Old events are dropped or compacted by the retention rules, the aggregates keep their state in snapshots
+	compacter := archive.NewCompacter(store, eb, eb)
+	ep.RegisterCommand("CompactEvents", eventsourcing.NewCommand(compacter.CompactEventsCommand))
+	modelsAgg := whispermodels.NewModelsAggregate()
+	aggStore.RegisterAggregate("whispermodels", modelsAgg)
+	audioSettings := audioinput.NewSettingsAggregate()
+	aggStore.RegisterAggregate("audioinput", audioSettings)
+	speakerProfiles := speakers.NewProfilesAggregate()
+	aggStore.RegisterAggregate("speakers", speakerProfiles)
+	themeSettings := themes.NewSettingsAggregate()
+	aggStore.RegisterAggregate("themes", themeSettings)
+	// Settings changed in the app, they take precedence over the configuration file
+	appSettings := settings.NewAggregate()
+	aggStore.RegisterAggregate("settings", appSettings)
+	ep.RegisterCommand("ChangeSettings", eventsourcing.NewCommand(appSettings.ChangeSettingsCommand))
+	// Record what each event changes; why is found again in the orchestration events on rebuild
+	auditTrail, err := audit.NewTrail(store)
+	if err != nil {
+		logging.Error("Failed to open the audit trail: %v", err)
+		os.Exit(1)
+	}
+	aggStore.RegisterAggregate("audit", auditTrail)
+	eb.SetChangeRecorder(auditTrail)
+
+	// Semantic memory: chat messages are indexed by the ChatManager, plugin events by the indexer
+	embedder := memory.NewOllamaEmbedder(cfg.Ollama.EmbedModel)
+	embedder.Endpoint = cfg.EmbedEndpoint()
+	memoryStore := memory.NewStore(embedder)
+	orchAgg.GetChatManager().SetMemory(memoryStore)
+	pluginManager.ProvideEmbedFunc(embedder.Embed)
+	// Imported documents are searched by their own plugin, not recalled as memories
+	eventIndexer := memory.NewEventIndexer(memoryStore, "orchestration_", "documents_")
+	for _, event := range events {
+		eventIndexer.IndexEvent(event)
+	}
+	eb.SubscribeAll(eventIndexer.IndexEvent)
+	aggStore.Snapshots = store
+	aggStore.OnRebuildProgress = func(p aggregate.RebuildProgress) {
+		logging.Info("Rebuilt %s from %d events (%d/%d aggregates)", p.Aggregate, p.Events, p.Done, p.Total)
+	}
+	if err := aggStore.RebuildState(events); err != nil {
+		logging.Error("Failed to rebuild the state: %v", err)
+	}
+	if err := aggStore.SnapshotAll(len(events)); err != nil {
+		logging.Error("Failed to snapshot aggregates: %v", err)
+	}
+	eb.SetSnapshotStore(store, snapshotInterval)
+
+	// Read models of the plugins, kept in a database next to the event log
+	projector, err := projections.NewProjector(readModelsPath, store)
+	if err != nil {
+		logging.Error("Failed to open the read models: %v", err)
+		os.Exit(1)
+	}
+	lc.OnShutdown("read models", func(ctx context.Context) error { return projector.Close() })
+	for _, projection := range pluginManager.Projections() {
+		if err := projector.Register(projection); err != nil {
+			logging.Error("Failed to build projection %s: %v", projection.Name(), err)
+		}
+	}
+	eb.SubscribeAll(projector.ProjectEvent)
+	pluginManager.ProvideReadModels(projector.DB())
+	ep.RegisterCommand("RebuildProjection", eventsourcing.NewCommand(projector.RebuildProjectionCommand))
+
+	// Remind the user of task deadlines and calendar events
+	leadTimes, err := reminders.ParseLeadTimes(reminderLeads)
+	if err != nil {
+		logging.Error("Invalid -reminder-leads: %v", err)
+		os.Exit(1)
+	}
+	if len(leadTimes) > 0 {
+		scheduler := reminders.NewScheduler(aggStore, reminderAgg, eb, leadTimes)
+		scheduler.Start()
+		lc.OnShutdown("reminders", func(ctx context.Context) error {
+			scheduler.Stop()
+			return nil
+		})
+	}
+	go func() {
+		if err := memoryStore.EmbedPending(); err != nil {
+			logging.Error("Failed to embed memory: %v", err)
+		}
+	}()
 
 	// Log registered aggregates
 	allAggs := aggStore.AllAggregates()
@@ -127,20 +437,70 @@ func main() {
 	}
 
 	// Initialize voice transcriber with Whisper model
-	modelPath, _ := filepath.Abs("models/ggml-base.en.bin")
+	if whisperModel == "" {
+		whisperModel = modelsAgg.ActiveModel()
+	}
+	if whisperModel == "" {
+		whisperModel = whispermodels.DefaultModel
+	}
+	modelPath, _ := filepath.Abs(filepath.Join(modelsDir, whispermodels.FileName(whisperModel)))
 	logging.Info("AUDIO: Initializing voice transcriber with model: %s", modelPath)
 	transcriber, err := audio.NewVoiceTranscriber(modelPath)
 	if err != nil {
 		logging.Error("Failed to initialize voice transcriber: %v", err)
 		os.Exit(1)
 	}
-	defer transcriber.Close()
+	lc.OnShutdown("voice transcriber", func(ctx context.Context) error { return transcriber.Close() })
+	modelManager := whispermodels.NewManager(transcriber, modelsAgg, eb)
+	lc.OnShutdown("whisper models", func(ctx context.Context) error {
+		modelManager.Stop()
+		return nil
+	})
+	ep.RegisterCommand("ListWhisperModels", eventsourcing.NewCommand(modelManager.ListModelsCommand))
+	ep.RegisterCommand("DownloadWhisperModel", eventsourcing.NewCommand(modelManager.DownloadModelCommand))
+	ep.RegisterCommand("SwitchWhisperModel", eventsourcing.NewCommand(modelManager.SwitchModelCommand))
+	inputManager := audioinput.NewManager(transcriber, audioSettings)
+	ep.RegisterCommand("ListAudioDevices", eventsourcing.NewCommand(inputManager.ListDevicesCommand))
+	ep.RegisterCommand("SelectAudioDevice", eventsourcing.NewCommand(inputManager.SelectDeviceCommand))
+	ep.RegisterCommand("SetAudioProcessing", eventsourcing.NewCommand(inputManager.SetProcessingCommand))
+	speakerManager := speakers.NewManager(transcriber, speakerProfiles, eb)
+	ep.RegisterCommand("EnrollSpeaker", eventsourcing.NewCommand(speakerManager.EnrollSpeakerCommand))
+	ep.RegisterCommand("ForgetSpeaker", eventsourcing.NewCommand(speakerManager.ForgetSpeakerCommand))
+	ep.RegisterCommand("ListSpeakers", eventsourcing.NewCommand(speakerManager.ListSpeakersCommand))
+	themeManager := themes.NewManager(themeSettings)
+	ep.RegisterCommand("SelectTheme", eventsourcing.NewCommand(themeManager.SelectThemeCommand))
+	submitTranscription := func(transcript audio.Transcript) {
+		request := map[string]interface{}{"requestText": transcript.Text, "language": transcript.Language, "speaker": transcript.Speaker}
+		if err := ep.ExecuteCommand("ProcessUserRequest", request); err != nil {
+			logging.Error("AUDIO: Failed to submit transcription: %v", err)
+		}
+	}
+	// An explicit -silence-timeout takes precedence over the configuration file
+	autoSubmitAfter := func(cfg *config.Config) time.Duration {
+		if flagsSet["silence-timeout"] {
+			return silenceTimeout
+		}
+		return cfg.Audio.SilenceTimeout
+	}
+	transcriber.SetInputDevices(cfg.Audio.InputDevices)
+	transcriber.SetAutoSubmit(autoSubmitAfter(cfg), submitTranscription)
+	inputManager.Restore()
+	speakerManager.Restore()
 
 	// Launch Godot WebSocket server
+	// Clients authenticate by token once users are configured, the 3D client started here as the owner
+	users := auth.NewUsers(cfg.UserTokens())
+	ownerToken := auth.NewToken()
+	users.SetOwnerToken(ownerToken)
 	server := godot_ws.NewGodotServer()
+	server.SetUsers(users)
+	server.SetRequestUser(orchAgg.RequestUser)
 	server.SetDeltaChan(ep.DeltaChan())
 	server.SetAggStore(aggStore)
 	server.SetEventBus(eb)
+	eventsourcing.SubmitStreamingEvent = server.HandleStreamingEvent
+	// The palette is applied with the configuration, the 3D clients draw the world in it
+	themeManager.OnChange(server.SendTheme)
 
 	// Start the voice transcriber (for processing)
 	err = transcriber.Start(func(text string) {
@@ -169,6 +529,90 @@ func main() {
 		}
 	})
 	server.SetTranscriber(transcriber)
+	// The settings panel of the 3D client changes the microphone and lists the devices afterwards
+	server.SetAudioSettingsCallback(func(settings map[string]interface{}) {
+		if device, ok := settings["device"]; ok {
+			if err := ep.ExecuteCommand("SelectAudioDevice", map[string]interface{}{"device": device}); err != nil {
+				logging.Error("AUDIO: Failed to select microphone: %v", err)
+			}
+		}
+		_, noise := settings["noise_suppression"]
+		_, gain := settings["gain_normalization"]
+		if noise || gain {
+			if err := ep.ExecuteCommand("SetAudioProcessing", settings); err != nil {
+				logging.Error("AUDIO: Failed to set audio processing: %v", err)
+			}
+		}
+		if err := ep.ExecuteCommand("ListAudioDevices", map[string]interface{}{}); err != nil {
+			logging.Error("AUDIO: Failed to list microphones: %v", err)
+		}
+	})
+	eb.Subscribe("audioinput_DevicesListed", server.HandleAudioDevicesListed)
+	eb.Subscribe("llmprocessor_StatusChanged", server.HandleLLMStatus)
+	eb.Subscribe("orchestration_CameraDirected", server.HandleCameraDirected)
+
+	// The orchestrator's sphere shows whether MindPalace listens, thinks, speaks or failed
+	presenceTracker := presence.NewTracker(eb.Publish)
+	for _, eventType := range []string{"orchestration_UserRequestReceived", "orchestration_AgentExecutionFailed", "orchestration_RequestCompleted", "orchestration_RequestCancelled"} {
+		eb.Subscribe(eventType, presenceTracker.HandleEvent)
+	}
+	transcriber.SetVoiceActivityCallback(presenceTracker.SetListening)
+
+	// Speak completed responses through the 3D client
+	voices, err := tts.ParseVoices(ttsVoices)
+	if err != nil {
+		logging.Error("Invalid -tts-voices: %v", err)
+		os.Exit(1)
+	}
+	var speaker *tts.Speaker
+	if !voices.Empty() || appSettings.Value(settings.TTSVoice) != "" {
+		speaker = tts.NewSpeaker(tts.NewPiperSynthesizer(piperPath), server, voices, orchAgg.AgentName)
+		speaker.SetDefaultVoice(appSettings.Value(settings.TTSVoice))
+		speaker.SetMuted(ttsMuted)
+		eb.Subscribe("orchestration_RequestCompleted", speaker.HandleRequestCompleted)
+		eb.Subscribe("briefing_BriefingDelivered", speaker.HandleBriefingDelivered)
+		server.SetSpeechMuteCallback(speaker.SetMuted)
+		speaker.SetSpeakingCallback(func(speaking bool) {
+			transcriber.SetSpeaking(speaking)
+			presenceTracker.SetSpeaking(speaking)
+		})
+		speaker.Start()
+		lc.OnShutdown("speech output", func(ctx context.Context) error {
+			speaker.Stop()
+			return nil
+		})
+	}
+	// Speaking over a response stops it and starts a new turn, see audio.TurnState
+	eb.Subscribe("orchestration_RequestCompleted", func(event eventsourcing.Event) error {
+		transcriber.ResponseCompleted()
+		return nil
+	})
+	eb.Subscribe("orchestration_RequestCancelled", func(event eventsourcing.Event) error {
+		transcriber.ResponseCompleted()
+		return nil
+	})
+	bargeIn := func(interrupted audio.TurnState) {
+		if speaker != nil {
+			speaker.Interrupt()
+		}
+		if interrupted != audio.TurnThinking {
+			return
+		}
+		if err := ep.ExecuteCommand("CancelRequest", map[string]interface{}{}); err != nil {
+			logging.Info("AUDIO: Nothing to cancel on barge-in: %v", err)
+		}
+	}
+	server.SetConfirmCallback(func(userID, toolCallID string, approved bool) {
+		err := ep.ExecuteCommand("ConfirmToolCall", map[string]interface{}{"toolCallID": toolCallID, "approved": approved, "userID": userID})
+		if err != nil {
+			logging.Error("Failed to confirm tool call %s: %v", toolCallID, err)
+		}
+	})
+	server.SetInteractionCallback(func(interaction eventsourcing.Interaction) {
+		if err := pluginManager.HandleInteraction(interaction); err != nil {
+			logging.Error("Failed to handle interaction: %v", err)
+		}
+	})
 	go server.Start()
 
 	// Launch embedded Godot binary
@@ -177,8 +621,8 @@ func main() {
 		logging.Error("Failed to extract Godot binary: %v", err)
 		os.Exit(1)
 	}
-	defer os.Remove(tmpPath)
 	cmd := exec.Command(tmpPath)
+	cmd.Env = append(os.Environ(), "MINDPALACE_TOKEN="+ownerToken)
 
 	// Capture stdout and stderr
 	stdout, err := cmd.StdoutPipe()
@@ -197,6 +641,24 @@ func main() {
 		os.Exit(1)
 	}
 	logging.Info("Godot binary launched")
+	lc.OnShutdown("3D client", func(ctx context.Context) error {
+		if err := server.Shutdown(ctx); err != nil {
+			logging.Error("Failed to stop the WebSocket server: %v", err)
+		}
+		// Godot quits when told MindPalace stops, it is killed when it does not in time
+		exited := make(chan struct{})
+		go func() {
+			cmd.Process.Wait()
+			close(exited)
+		}()
+		select {
+		case <-exited:
+		case <-ctx.Done():
+			logging.Error("Godot did not quit in time, killing it")
+			cmd.Process.Kill()
+		}
+		return os.Remove(tmpPath)
+	})
 
 	// Pipe Godot logs to our logging system
 	go func() {
@@ -221,13 +683,196 @@ func main() {
 
 	// Initialize orchestrator and Fyne app
 	orchestrator := orchestration.NewRequestOrchestrator(llmClient, pluginManager, orchAgg, ep, ep.EventBus)
+	retryPolicy := orchestration.DefaultRetryPolicy
+	retryPolicy.MaxRetries = toolRetries
+	orchestrator.SetRetryPolicy(retryPolicy)
+	orchestrator.SetStateSource(aggStore)
+	orchestrator.SetTagLister(tagRegistry)
+	orchestrator.SetItemLinker(linkRegistry)
+	orchestrator.SetExampleSource(exampleRegistry)
+	orchestrator.SetPromptSource(promptRegistry)
+	orchestrator.SetCorrectionSource(feedbackRegistry)
+	orchestrator.SetPinSource(pinRegistry)
+	// Agents are offered the tools of the external MCP servers once these are connected, changes take a restart
+	mcpClients := connectMCPServers(cfg.MCP, orchestrator)
+	// The agents find, highlight and arrange the objects of the 3D world through its tools
+	orchestrator.AttachToolServer(config.WorldToolServer, server, nil)
+	lc.OnShutdown("MCP servers", mcpClients.Close)
+	var apiServer *httpapi.Server
+	if headlessFlag {
+		apiServer = httpapi.NewServer(apiAddr, ep, eb, aggStore)
+		// Serve the browser chat next to the API, it shows the answers as they are generated
+		apiServer.SetUserChats(func(userID string) httpapi.ChatHistory { return orchAgg.ChatManagerFor(userID) })
+		apiServer.SetUsers(users)
+		apiServer.SetAudit(auditTrail)
+		apiServer.SetRedactor(orchAgg)
+		// Stopped once the requests completed, their streams end with them
+		lc.OnShutdown("HTTP API", apiServer.Shutdown)
+	}
+	if grpcAddr != "" {
+		grpcServer := grpcapi.NewServer(grpcAddr, ep, eb, aggStore)
+		grpcServer.SetUsers(users)
+		grpcServer.SetRedactor(orchAgg)
+		lc.OnShutdown("gRPC API", grpcServer.Shutdown)
+		go func() {
+			if err := grpcServer.Start(); err != nil {
+				logging.Error("gRPC API stopped: %v", err)
+			}
+		}()
+	}
+	if mcpAddr != "" {
+		mcpServer := mcp.NewServer(mcpAddr, pluginManager, ep)
+		mcpServer.SetUsers(users)
+		lc.OnShutdown("MCP server", mcpServer.Shutdown)
+		go func() {
+			if err := mcpServer.Start(); err != nil && err != http.ErrServerClosed {
+				logging.Error("MCP server stopped: %v", err)
+			}
+		}()
+	}
+	lc.OnShutdown("requests", orchestrator.Shutdown)
+
+	// Brief the users on their day at the time they configured, the LLM writes the briefings
+	briefer := briefing.NewBriefer(aggStore, briefingAgg, eb, func(userID string) eventsourcing.GenerateFunc {
+		return orchestrator.GenerateFunc(userID, "briefing")
+	})
+
+	// Apply the configuration, and again whenever it is reloaded or the settings change
+	var configMu sync.Mutex
+	loadedConfig := cfg
+	applyConfig := func(loaded *config.Config) {
+		configMu.Lock()
+		loadedConfig = loaded
+		configMu.Unlock()
+		cfg := appSettings.Override(loaded)
+		if err := configureLogging(cfg); err != nil {
+			logging.Error("Failed to configure logging: %v", err)
+		}
+		llmClient.Configure(cfg.ChatEndpoint(), cfg.Ollama.Model, cfg.Limits.ContextTokens)
+		llmClient.SetFallback(cfg.FallbackChatEndpoint(), cfg.Ollama.FallbackModel)
+		llmClient.SetHealthInterval(cfg.Ollama.HealthInterval)
+		orchAgg.SetHistoryTokens(cfg.Limits.HistoryTokens)
+		compacter.SetRules(cfg.RetentionRules())
+		if palettes, err := cfg.Palettes(); err == nil {
+			themeManager.Configure(cfg.Theme.Name, palettes)
+		}
+		// Tokens can change while running, users added take a restart to get plugins of their own
+		tokens := cfg.UserTokens()
+		for token, userID := range tokens {
+			if !slices.Contains(startupUsers, userID) {
+				logging.Info("CONFIG: User %s is added on the next start", userID)
+				delete(tokens, token)
+			}
+		}
+		users.SetTokens(tokens)
+		orchestrator.SetAgentModels(cfg.AgentModels())
+		orchestrator.SetRequestTimeout(cfg.Limits.RequestTimeout)
+		orchestrator.SetToolResultLimit(cfg.Limits.ToolResultTokens, cfg.Limits.SummarizeToolResults)
+		orchestrator.SetToolLimit(cfg.Limits.MaxTools)
+		orchestrator.SetConfirmedCapabilities(cfg.Plugins.ConfirmCapabilities)
+		server.Configure(cfg.Godot.BatchWindow, cfg.Godot.Compression, cfg.Godot.MaxPayloadSize*1024)
+		pluginManager.SetDisabled(cfg.Plugins.Disabled)
+		pluginManager.Configure(cfg.Plugin)
+		locations := cfg.Locations()
+		pluginManager.ProvideLocations(locations)
+		briefings := make(map[string]briefing.Settings)
+		for userID, b := range cfg.Briefings() {
+			schedule, err := cron.Parse(b.Schedule)
+			if err != nil || (userID != "" && !slices.Contains(startupUsers, userID)) {
+				continue
+			}
+			briefings[userID] = briefing.Settings{Schedule: schedule, Spoken: b.Spoken, Location: locations[userID]}
+		}
+		briefer.Configure(briefings)
+		transcriber.SetInputDevices(cfg.Audio.InputDevices)
+		transcriber.SetAutoSubmit(autoSubmitAfter(cfg), submitTranscription)
+		if err := transcriber.SetLanguage(cfg.Audio.Language); err != nil {
+			logging.Error("AUDIO: %v", err)
+		}
+		transcriber.SetDiarization(cfg.Audio.Diarization)
+		if cfg.Audio.BargeIn {
+			transcriber.SetBargeIn(bargeIn)
+		} else {
+			transcriber.SetBargeIn(nil)
+		}
+	}
+	applyConfig(cfg)
+	briefer.Start()
+	// The interval takes a restart to change, the rules apply on the next compaction
+	compacter.Start(cfg.Retention.Interval)
+	lc.OnShutdown("event log compaction", func(ctx context.Context) error {
+		compacter.Stop()
+		return nil
+	})
+	lc.OnShutdown("briefings", func(ctx context.Context) error {
+		briefer.Stop()
+		return nil
+	})
+	configWatcher, err := config.Watch(configPath, func(cfg *config.Config) {
+		applyConfig(cfg)
+		logging.Info("CONFIG: Applied %s", configPath)
+	})
+	eb.Subscribe("settings_SettingsChanged", func(event eventsourcing.Event) error {
+		configMu.Lock()
+		loaded := loadedConfig
+		configMu.Unlock()
+		applyConfig(loaded)
+		if speaker != nil {
+			speaker.SetDefaultVoice(appSettings.Value(settings.TTSVoice))
+		} else if appSettings.Value(settings.TTSVoice) != "" {
+			logging.Info("CONFIG: Speech output starts with the voice on the next start")
+		}
+		return nil
+	})
+	if err != nil {
+		logging.Error("Failed to watch configuration: %v", err)
+	} else {
+		lc.OnShutdown("configuration watcher", func(ctx context.Context) error {
+			configWatcher.Stop()
+			return nil
+		})
+	}
+
+	// Tell the chats and the 3D client when the LLM goes offline, calls fail over to the fallback meanwhile
+	llmClient.OnStatusChange(func(event *llmprocessor.StatusChangedEvent) { eb.Publish(event) })
+	llmClient.StartHealthChecks()
+	lc.OnShutdown("LLM health checks", func(ctx context.Context) error {
+		llmClient.StopHealthChecks()
+		return nil
+	})
 	app := ui.NewApp(ep, aggStore, orchestrator, pluginManager.GetLLMPlugins(), server)
+	app.SetSpeaker(speaker)
+	app.SetThemes(themeManager)
+	app.SetSettings(appSettings)
+
+	// Microphone input stops first, no new requests come in while shutting down
+	lc.OnShutdown("audio capture", func(ctx context.Context) error {
+		transcriber.StopCapture()
+		transcriber.Stop()
+		return nil
+	})
 
 	// Run Fyne UI unless headless
 	if !headlessFlag {
 		app.InitUI()
+		lc.OnShutdown("desktop UI", func(ctx context.Context) error {
+			app.Quit()
+			return nil
+		})
+		lc.HandleSignals()
 		app.Run()
+		lc.Shutdown("window closed")
 	} else {
-		select {}
+		eventsourcing.SubmitStreamingEvent = func(event eventsourcing.Event) {
+			server.HandleStreamingEvent(event)
+			apiServer.HandleStreamingEvent(event)
+		}
+		lc.HandleSignals()
+		if err := apiServer.Start(); err != nil && err != http.ErrServerClosed {
+			logging.Error("HTTP API error: %v", err)
+			lc.Shutdown("HTTP API failed")
+			os.Exit(1)
+		}
+		lc.Shutdown("HTTP API stopped")
 	}
 }
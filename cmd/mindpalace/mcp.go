@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"mindpalace/internal/config"
+	"mindpalace/internal/mcp"
+	"mindpalace/internal/orchestration"
+	"mindpalace/pkg/logging"
+)
+
+// runMCP runs the mindpalace mcp subcommand: it speaks MCP over stdin and stdout for clients that
+// launch their servers, such as Claude Desktop, relaying to a MindPalace started with -mcp
+func runMCP(args []string) int {
+	flags := flag.NewFlagSet("mcp", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8765", "Address the running MindPalace serves MCP on, as given with -mcp")
+	token := flags.String("token", os.Getenv("MINDPALACE_TOKEN"), "Token of the user to call the tools as, when MindPalace is shared with a household")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage:\n  mindpalace mcp [options]\n\nOptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	// Stdout carries the protocol, errors go to stderr
+	if err := mcp.Bridge(ctx, *addr, *token, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "MCP bridge to %s failed, is MindPalace running with -mcp? %v\n", *addr, err)
+		return 1
+	}
+	return 0
+}
+
+// mcpConnectTimeout is the time an external MCP server gets to start and list its tools
+const mcpConnectTimeout = 30 * time.Second
+
+// mcpServers are the external MCP servers whose tools the agents are offered
+type mcpServers struct {
+	mu      sync.Mutex
+	clients []*mcp.Client
+}
+
+// connectMCPServers connects to the configured MCP servers in the background, attaching each to the
+// orchestrator once it listed its tools
+func connectMCPServers(servers map[string]config.MCPServerConfig, orchestrator *orchestration.RequestOrchestrator) *mcpServers {
+	connected := &mcpServers{}
+	for name, server := range servers {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), mcpConnectTimeout)
+			defer cancel()
+			var client *mcp.Client
+			var err error
+			if server.URL != "" {
+				client, err = mcp.DialURL(ctx, name, server.URL, server.Token)
+			} else {
+				env := make([]string, 0, len(server.Env))
+				for key, value := range server.Env {
+					env = append(env, key+"="+value)
+				}
+				client, err = mcp.DialCommand(ctx, name, server.Command, server.Args, env)
+			}
+			if err != nil {
+				logging.Error("Failed to connect to MCP server %s: %v", name, err)
+				return
+			}
+			connected.mu.Lock()
+			connected.clients = append(connected.clients, client)
+			connected.mu.Unlock()
+			orchestrator.AttachToolServer(name, client, server.Agents)
+		}()
+	}
+	return connected
+}
+
+// Close disconnects from the servers, stopping those started as commands
+func (s *mcpServers) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, client := range s.clients {
+		client.Close()
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+// Package archive exports the event log to a portable JSONL archive and imports such archives,
+// to back up MindPalace or move it to another machine.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// maxLineSize is the largest event an archive line can hold
+const maxLineSize = 16 * 1024 * 1024
+
+// EventsExportedEvent is emitted when events were written to an archive
+type EventsExportedEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string   `json:"event_type"`
+	Path       string   `json:"path"`
+	Count      int      `json:"count"`
+	Aggregates []string `json:"aggregates,omitempty"`
+	Since      string   `json:"since,omitempty"`
+	Until      string   `json:"until,omitempty"`
+	Timestamp  string   `json:"timestamp"`
+}
+
+func (e *EventsExportedEvent) Type() string { return "archive_EventsExported" }
+func (e *EventsExportedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *EventsExportedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// EventsImportedEvent is emitted when the events of an archive were appended to the event log
+type EventsImportedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Path      string `json:"path"`
+	Imported  int    `json:"imported"`
+	Skipped   int    `json:"skipped"` // Events already in the event log
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *EventsImportedEvent) Type() string { return "archive_EventsImported" }
+func (e *EventsImportedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *EventsImportedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("archive_EventsExported", func() eventsourcing.Event { return &EventsExportedEvent{} })
+	eventsourcing.RegisterEvent("archive_EventsImported", func() eventsourcing.Event { return &EventsImportedEvent{} })
+}
+
+// Record is a line of an archive: an event, the time it was appended to the event log, the
+// household member it happened for and the trace of the request it happened in
+type Record struct {
+	Type      string          `json:"type"`
+	Timestamp time.Time       `json:"timestamp"`
+	UserID    string          `json:"user_id,omitempty"`
+	TraceID   string          `json:"trace_id,omitempty"`
+	Event     json.RawMessage `json:"event"`
+}
+
+// Filter selects the events to export, the zero Filter selects all events
+type Filter struct {
+	Aggregates []string  // Aggregates the events belong to, see AggregateOf
+	Since      time.Time // Inclusive
+	Until      time.Time // Exclusive
+}
+
+// Matches reports whether a stored event passes the filter
+func (f Filter) Matches(stored eventsourcing.StoredEvent) bool {
+	if !f.Since.IsZero() && stored.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !stored.Timestamp.Before(f.Until) {
+		return false
+	}
+	if len(f.Aggregates) == 0 {
+		return true
+	}
+	aggregate := AggregateOf(stored.Type)
+	for _, name := range f.Aggregates {
+		if name == aggregate {
+			return true
+		}
+	}
+	return false
+}
+
+// AggregateOf returns the aggregate an event type belongs to, the prefix of e.g. "taskmanager_TaskCreated"
+func AggregateOf(eventType string) string {
+	aggregate, _, found := strings.Cut(eventType, "_")
+	if !found {
+		return ""
+	}
+	return aggregate
+}
+
+// Write writes the stored events passing the filter to w, one Record per line, and returns how many it wrote
+func Write(w io.Writer, stored []eventsourcing.StoredEvent, filter Filter) (int, error) {
+	encoder := json.NewEncoder(w)
+	count := 0
+	for _, s := range stored {
+		if !filter.Matches(s) {
+			continue
+		}
+		if err := encoder.Encode(Record{Type: s.Type, Timestamp: s.Timestamp.UTC(), UserID: s.UserID, TraceID: s.TraceID, Event: s.Data}); err != nil {
+			return count, fmt.Errorf("failed to write %s event: %v", s.Type, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Read reads the records of an archive
+func Read(r io.Reader) ([]eventsourcing.StoredEvent, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	var stored []eventsourcing.StoredEvent
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("invalid record on line %d: %v", line, err)
+		}
+		if record.Type == "" || len(record.Event) == 0 {
+			return nil, fmt.Errorf("invalid record on line %d: missing type or event", line)
+		}
+		stored = append(stored, eventsourcing.StoredEvent{Type: record.Type, Data: record.Event, Timestamp: record.Timestamp, UserID: record.UserID, TraceID: record.TraceID})
+	}
+	return stored, scanner.Err()
+}
+
+// Store is the event store events are exported from and imported into
+type Store interface {
+	StoredEvents() ([]eventsourcing.StoredEvent, error)
+	AppendStored(stored ...eventsourcing.StoredEvent) ([]eventsourcing.Event, error)
+}
+
+// AggregateStore holds the aggregates imported events are applied to
+type AggregateStore interface {
+	AllAggregates() []eventsourcing.Aggregate
+}
+
+// Archiver exports and imports the event log
+type Archiver struct {
+	store      Store
+	aggregates AggregateStore
+	redactor   eventsourcing.Redactor
+}
+
+// NewArchiver creates an archiver for the event store, applying imported events to the aggregates
+func NewArchiver(store Store, aggregates AggregateStore) *Archiver {
+	return &Archiver{store: store, aggregates: aggregates}
+}
+
+// SetRedactor hides the redacted content of the events in the archives exported
+func (a *Archiver) SetRedactor(redactor eventsourcing.Redactor) {
+	a.redactor = redactor
+}
+
+// redacted returns the stored event with the redactions of its user applied
+func (a *Archiver) redacted(s eventsourcing.StoredEvent) eventsourcing.StoredEvent {
+	if a.redactor != nil {
+		s.Data = a.redactor.Redact(s.UserID, s.Data)
+	}
+	return s
+}
+
+// ExportEventsCommand writes the event log to the archive at "path", optionally only the events of
+// "aggregates" appended between "since" and "until"
+func (a *Archiver) ExportEventsCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if err := ownerOnly(data); err != nil {
+		return nil, err
+	}
+	path, _ := data["path"].(string)
+	if path == "" {
+		return nil, fmt.Errorf("path must be a non-empty string")
+	}
+	filter, err := parseFilter(data)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := a.store.StoredEvents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the event log: %v", err)
+	}
+	for i := range stored {
+		stored[i] = a.redacted(stored[i])
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive: %v", err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	count, err := Write(writer, stored, filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %v", err)
+	}
+	logging.Info("Exported %d events to %s", count, path)
+
+	event := &EventsExportedEvent{
+		EventType:  "archive_EventsExported",
+		Path:       path,
+		Count:      count,
+		Aggregates: filter.Aggregates,
+		Timestamp:  eventsourcing.ISOTimestamp(),
+	}
+	if !filter.Since.IsZero() {
+		event.Since = filter.Since.Format(time.RFC3339)
+	}
+	if !filter.Until.IsZero() {
+		event.Until = filter.Until.Format(time.RFC3339)
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+// ImportEventsCommand appends the events of the archive at "path" that are not yet in the event log
+// and applies them to the aggregates
+func (a *Archiver) ImportEventsCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if err := ownerOnly(data); err != nil {
+		return nil, err
+	}
+	path, _ := data["path"].(string)
+	if path == "" {
+		return nil, fmt.Errorf("path must be a non-empty string")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %v", err)
+	}
+	defer file.Close()
+	records, err := Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %s: %v", path, err)
+	}
+
+	// Importing an archive twice, or into the instance it came from, must not duplicate events
+	existing, err := a.store.StoredEvents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the event log: %v", err)
+	}
+	seen := make(map[string]bool, len(existing))
+	for _, s := range existing {
+		seen[key(s)] = true
+		seen[key(a.redacted(s))] = true // As exported
+	}
+	var missing []eventsourcing.StoredEvent
+	for _, record := range records {
+		if seen[key(record)] {
+			continue
+		}
+		seen[key(record)] = true
+		missing = append(missing, record)
+	}
+
+	events, err := a.store.AppendStored(missing...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import %s: %v", path, err)
+	}
+	for _, event := range events {
+		for _, agg := range a.aggregatesOf(event.Metadata().UserID) {
+			if _, err := eventsourcing.ApplyOnce(agg, event); err != nil {
+				logging.Error("Failed to apply imported event %s to %s: %v", event.Type(), agg.ID(), err)
+			}
+		}
+	}
+	logging.Info("Imported %d events from %s, skipped %d", len(events), path, len(records)-len(events))
+
+	return []eventsourcing.Event{&EventsImportedEvent{
+		EventType: "archive_EventsImported",
+		Path:      path,
+		Imported:  len(events),
+		Skipped:   len(records) - len(events),
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// ownerOnly refuses commands of household members: the event log holds everyone's events, and its
+// archives are files of the server
+func ownerOnly(data map[string]interface{}) error {
+	if eventsourcing.UserOf(data) != "" {
+		return fmt.Errorf("only the owner exports, imports and compacts the event log")
+	}
+	return nil
+}
+
+// aggregatesOf returns the aggregates an imported event of the user is applied to
+func (a *Archiver) aggregatesOf(userID string) []eventsourcing.Aggregate {
+	if users, ok := a.aggregates.(eventsourcing.UserAggregateStore); ok {
+		return users.AggregatesOf(userID)
+	}
+	return a.aggregates.AllAggregates()
+}
+
+// key identifies an event by its user, its type and its compacted JSON
+func key(s eventsourcing.StoredEvent) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, s.Data); err != nil {
+		return s.UserID + "\x00" + s.Type + "\x00" + string(s.Data)
+	}
+	return s.UserID + "\x00" + s.Type + "\x00" + compact.String()
+}
+
+// parseFilter reads the optional "aggregates", "since" and "until" fields of an export command
+func parseFilter(data map[string]interface{}) (Filter, error) {
+	var filter Filter
+	switch aggregates := data["aggregates"].(type) {
+	case nil:
+	case string:
+		for _, name := range strings.Split(aggregates, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				filter.Aggregates = append(filter.Aggregates, name)
+			}
+		}
+	case []interface{}:
+		for _, name := range aggregates {
+			s, ok := name.(string)
+			if !ok {
+				return filter, fmt.Errorf("aggregates must be a list of names")
+			}
+			filter.Aggregates = append(filter.Aggregates, s)
+		}
+	default:
+		return filter, fmt.Errorf("aggregates must be a list of names")
+	}
+
+	var err error
+	if filter.Since, err = parseTime(data["since"], false); err != nil {
+		return filter, fmt.Errorf("invalid since: %v", err)
+	}
+	if filter.Until, err = parseTime(data["until"], true); err != nil {
+		return filter, fmt.Errorf("invalid until: %v", err)
+	}
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && !filter.Since.Before(filter.Until) {
+		return filter, fmt.Errorf("since must be before until")
+	}
+	return filter, nil
+}
+
+// parseTime parses an RFC 3339 time or a local date. A date used as end of a range includes the whole day.
+func parseTime(value interface{}, endOfRange bool) (time.Time, error) {
+	s, _ := value.(string)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date like 2006-01-02 nor an RFC 3339 time", s)
+	}
+	if endOfRange {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
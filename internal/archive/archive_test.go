@@ -0,0 +1,330 @@
+package archive
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Mock implementations for testing
+
+type noteEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Text      string `json:"text"`
+}
+
+func (e *noteEvent) Type() string { return e.EventType }
+func (e *noteEvent) Marshal() ([]byte, error) {
+	return json.Marshal(e)
+}
+func (e *noteEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("notes_NoteAdded", func() eventsourcing.Event { return &noteEvent{} })
+	eventsourcing.RegisterEvent("tasks_TaskAdded", func() eventsourcing.Event { return &noteEvent{} })
+}
+
+type mockAggregate struct {
+	applied []string
+}
+
+func (m *mockAggregate) ID() string { return "mock" }
+func (m *mockAggregate) ApplyEvent(event eventsourcing.Event) error {
+	m.applied = append(m.applied, event.(*noteEvent).Text)
+	return nil
+}
+func (m *mockAggregate) GetCustomUI() fyne.CanvasObject { return nil }
+
+type mockAggregateStore struct {
+	aggregates []eventsourcing.Aggregate
+}
+
+func (m *mockAggregateStore) AllAggregates() []eventsourcing.Aggregate { return m.aggregates }
+
+// mockUserAggregateStore keeps the aggregates of household members next to the owner's
+type mockUserAggregateStore struct {
+	mockAggregateStore
+	users map[string][]eventsourcing.Aggregate
+}
+
+func (m *mockUserAggregateStore) AggregatesOf(userID string) []eventsourcing.Aggregate {
+	if userID == "" {
+		return m.aggregates
+	}
+	return m.users[userID]
+}
+func (m *mockUserAggregateStore) UserAggregates(userID string) []eventsourcing.Aggregate {
+	return m.users[userID]
+}
+func (m *mockUserAggregateStore) Users() []string { return []string{"alice"} }
+
+func newStore(t *testing.T, events ...*noteEvent) *eventsourcing.SQLiteEventStore {
+	t.Helper()
+	store, err := eventsourcing.NewSQLiteEventStore(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	for _, event := range events {
+		if err := store.Append(event); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	return store
+}
+
+func stored(eventType, text string, at time.Time) eventsourcing.StoredEvent {
+	data, _ := json.Marshal(&noteEvent{EventType: eventType, Text: text})
+	return eventsourcing.StoredEvent{Type: eventType, Data: data, Timestamp: at}
+}
+
+func TestWriteAndRead_Filter(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	events := []eventsourcing.StoredEvent{
+		stored("notes_NoteAdded", "old note", day.Add(-time.Hour)),
+		stored("tasks_TaskAdded", "task", day.Add(time.Hour)),
+		stored("notes_NoteAdded", "note", day.Add(2*time.Hour)),
+		stored("notes_NoteAdded", "late note", day.Add(30*time.Hour)),
+	}
+
+	var archive strings.Builder
+	count, err := Write(&archive, events, Filter{Aggregates: []string{"notes"}, Since: day, Until: day.AddDate(0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if count != 1 || strings.Count(archive.String(), "\n") != 1 {
+		t.Fatalf("Expected a single line for the note of the day, got %d: %s", count, archive.String())
+	}
+
+	read, err := Read(strings.NewReader(archive.String()))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(read) != 1 || read[0].Type != "notes_NoteAdded" || !read[0].Timestamp.Equal(day.Add(2*time.Hour)) {
+		t.Fatalf("Unexpected records: %+v", read)
+	}
+	if !strings.Contains(string(read[0].Data), `"text":"note"`) {
+		t.Errorf("Expected the event to be kept as is, got %s", read[0].Data)
+	}
+
+	if _, err := Read(strings.NewReader("{\"type\":\"notes_NoteAdded\"}\n")); err == nil {
+		t.Error("Expected an error for a record without event")
+	}
+}
+
+func TestExportAndImport(t *testing.T) {
+	source := newStore(t,
+		&noteEvent{EventType: "notes_NoteAdded", Text: "first"},
+		&noteEvent{EventType: "tasks_TaskAdded", Text: "task"},
+		&noteEvent{EventType: "notes_NoteAdded", Text: "second"},
+	)
+	path := filepath.Join(t.TempDir(), "backup.jsonl")
+	events, err := NewArchiver(source, &mockAggregateStore{}).ExportEventsCommand(map[string]interface{}{
+		"path":       path,
+		"aggregates": []interface{}{"notes"},
+	})
+	if err != nil {
+		t.Fatalf("ExportEvents failed: %v", err)
+	}
+	if exported := events[0].(*EventsExportedEvent); exported.Count != 2 || exported.Aggregates[0] != "notes" {
+		t.Errorf("Unexpected export: %+v", exported)
+	}
+
+	// The target already has the first note, importing adds the second one only
+	target := newStore(t, &noteEvent{EventType: "notes_NoteAdded", Text: "first"})
+	agg := &mockAggregate{}
+	archiver := NewArchiver(target, &mockAggregateStore{aggregates: []eventsourcing.Aggregate{agg}})
+	events, err = archiver.ImportEventsCommand(map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatalf("ImportEvents failed: %v", err)
+	}
+	if imported := events[0].(*EventsImportedEvent); imported.Imported != 1 || imported.Skipped != 1 {
+		t.Errorf("Expected one imported and one skipped event, got %+v", imported)
+	}
+	if len(agg.applied) != 1 || agg.applied[0] != "second" {
+		t.Errorf("Expected the imported event to be applied, got %v", agg.applied)
+	}
+	if len(target.GetEvents()) != 2 {
+		t.Errorf("Expected 2 events in the target, got %d", len(target.GetEvents()))
+	}
+
+	// Importing again changes nothing
+	events, err = archiver.ImportEventsCommand(map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatalf("ImportEvents failed: %v", err)
+	}
+	if imported := events[0].(*EventsImportedEvent); imported.Imported != 0 || imported.Skipped != 2 {
+		t.Errorf("Expected all events to be skipped, got %+v", imported)
+	}
+}
+
+// redactions applies the redactions of the event's user
+type redactions []eventsourcing.Redaction
+
+func (r redactions) Redact(userID string, data []byte) []byte {
+	for _, redaction := range r {
+		if redaction.UserID == userID {
+			data = redaction.Apply(data)
+		}
+	}
+	return data
+}
+
+func TestExport_Redacted(t *testing.T) {
+	aliceNote := &noteEvent{EventType: "notes_NoteAdded", Text: "call 555-0134"}
+	aliceNote.Metadata().UserID = "alice"
+	source := newStore(t, &noteEvent{EventType: "notes_NoteAdded", Text: "call 555-0134"}, aliceNote)
+	path := filepath.Join(t.TempDir(), "backup.jsonl")
+	archiver := NewArchiver(source, &mockAggregateStore{})
+	archiver.SetRedactor(redactions{{Text: "555-0134"}})
+	if _, err := archiver.ExportEventsCommand(map[string]interface{}{"path": path}); err != nil {
+		t.Fatalf("ExportEvents failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Reading the archive failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"text":"call [redacted]"`) || strings.Count(string(data), "555-0134") != 1 {
+		t.Errorf("Expected the owner's number scrubbed and alice's kept, got %s", data)
+	}
+
+	// Importing the redacted archive where it came from doesn't add the redacted events again
+	events, err := archiver.ImportEventsCommand(map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatalf("ImportEvents failed: %v", err)
+	}
+	if imported := events[0].(*EventsImportedEvent); imported.Imported != 0 || imported.Skipped != 2 {
+		t.Errorf("Expected all events to be skipped, got %+v", imported)
+	}
+}
+
+func TestExportAndImport_Users(t *testing.T) {
+	aliceNote := &noteEvent{EventType: "notes_NoteAdded", Text: "note"}
+	aliceNote.Metadata().UserID = "alice"
+	source := newStore(t, &noteEvent{EventType: "notes_NoteAdded", Text: "note"}, aliceNote)
+	path := filepath.Join(t.TempDir(), "backup.jsonl")
+	if _, err := NewArchiver(source, &mockAggregateStore{}).ExportEventsCommand(map[string]interface{}{"path": path}); err != nil {
+		t.Fatalf("ExportEvents failed: %v", err)
+	}
+
+	// The same note of the owner and of alice are two events, each applied to its user's aggregates
+	owner, alice := &mockAggregate{}, &mockAggregate{}
+	aggregates := &mockUserAggregateStore{
+		mockAggregateStore: mockAggregateStore{aggregates: []eventsourcing.Aggregate{owner}},
+		users:              map[string][]eventsourcing.Aggregate{"alice": {alice}},
+	}
+	events, err := NewArchiver(newStore(t), aggregates).ImportEventsCommand(map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatalf("ImportEvents failed: %v", err)
+	}
+	if imported := events[0].(*EventsImportedEvent); imported.Imported != 2 {
+		t.Errorf("Expected both notes imported, got %+v", imported)
+	}
+	if len(owner.applied) != 1 || len(alice.applied) != 1 {
+		t.Errorf("Expected a note applied for the owner and one for alice, got %v and %v", owner.applied, alice.applied)
+	}
+}
+
+func TestExportAndImport_MembersRefused(t *testing.T) {
+	source := newStore(t, &noteEvent{EventType: "notes_NoteAdded", Text: "owner's note"})
+	path := filepath.Join(t.TempDir(), "backup.jsonl")
+	archiver := NewArchiver(source, &mockAggregateStore{})
+	if _, err := archiver.ExportEventsCommand(map[string]interface{}{"path": path, "userID": "alice"}); err == nil {
+		t.Error("Expected a member's export to be refused")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected no archive written for a member, got %v", err)
+	}
+
+	if _, err := archiver.ExportEventsCommand(map[string]interface{}{"path": path}); err != nil {
+		t.Fatalf("ExportEvents failed: %v", err)
+	}
+	if _, err := archiver.ImportEventsCommand(map[string]interface{}{"path": path, "userID": "alice"}); err == nil {
+		t.Error("Expected a member's import to be refused")
+	}
+}
+
+func TestImport_UnknownEventImportsNothing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.jsonl")
+	archive := `{"type":"notes_NoteAdded","timestamp":"2024-03-01T10:00:00Z","event":{"event_type":"notes_NoteAdded","text":"a"}}
+{"type":"missing_Plugin","timestamp":"2024-03-01T11:00:00Z","event":{"event_type":"missing_Plugin"}}
+`
+	if err := os.WriteFile(path, []byte(archive), 0644); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	target := newStore(t)
+	if _, err := NewArchiver(target, &mockAggregateStore{}).ImportEventsCommand(map[string]interface{}{"path": path}); err == nil {
+		t.Fatal("Expected an error for an unregistered event")
+	}
+	if len(target.GetEvents()) != 0 {
+		t.Errorf("Expected nothing to be imported, got %d events", len(target.GetEvents()))
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	filter, err := parseFilter(map[string]interface{}{"aggregates": "notes, tasks", "since": "2024-03-01", "until": "2024-03-01"})
+	if err != nil {
+		t.Fatalf("parseFilter failed: %v", err)
+	}
+	if len(filter.Aggregates) != 2 || filter.Aggregates[1] != "tasks" {
+		t.Errorf("Unexpected aggregates: %v", filter.Aggregates)
+	}
+	if filter.Until.Sub(filter.Since) != 24*time.Hour {
+		t.Errorf("Expected the until date to include the whole day, got %v to %v", filter.Since, filter.Until)
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"since": "yesterday"},
+		{"since": "2024-03-02", "until": "2024-03-01"},
+		{"aggregates": 3},
+	} {
+		if _, err := parseFilter(data); err == nil {
+			t.Errorf("Expected an error for %v", data)
+		}
+	}
+}
+
+// rewriter counts the rewrites of the event log
+type rewriter struct{ rewrites int }
+
+func (r *rewriter) Rewrite(rewrite func() error) error {
+	r.rewrites++
+	return rewrite()
+}
+
+func TestCompacter(t *testing.T) {
+	store := newStore(t)
+	old := time.Now().AddDate(0, 0, -40)
+	if _, err := store.AppendStored(stored("notes_NoteAdded", "old", old), stored("tasks_TaskAdded", "old task", old), stored("notes_NoteAdded", "new", time.Now())); err != nil {
+		t.Fatalf("AppendStored failed: %v", err)
+	}
+	r := &rewriter{}
+	compacter := NewCompacter(store, r, nil)
+	if events, err := compacter.CompactEventsCommand(map[string]interface{}{}); err != nil || events != nil || r.rewrites != 0 {
+		t.Fatalf("Expected nothing compacted without rules, got %v, %v", events, err)
+	}
+
+	compacter.SetRules([]eventsourcing.RetentionRule{{Types: []string{"notes_*"}, After: 30 * 24 * time.Hour}})
+	if _, err := compacter.CompactEventsCommand(map[string]interface{}{"userID": "alice"}); err == nil || r.rewrites != 0 {
+		t.Fatalf("Expected a member's compaction to be refused, got %v", err)
+	}
+	events, err := compacter.CompactEventsCommand(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("CompactEvents failed: %v", err)
+	}
+	if len(events) != 1 || events[0].(*EventsCompactedEvent).Dropped != 1 {
+		t.Fatalf("Expected the old note dropped, got %+v", events)
+	}
+	remaining, _ := store.StoredEvents()
+	if len(remaining) != 2 || remaining[0].Type != "tasks_TaskAdded" {
+		t.Errorf("Expected the task and the new note kept, got %+v", remaining)
+	}
+}
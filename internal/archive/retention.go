@@ -0,0 +1,138 @@
+package archive
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// EventsCompactedEvent records a compaction of the event log by the retention rules
+type EventsCompactedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Dropped   int    `json:"dropped"`
+	Compacted int    `json:"compacted"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *EventsCompactedEvent) Type() string { return "archive_EventsCompacted" }
+func (e *EventsCompactedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *EventsCompactedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("archive_EventsCompacted", func() eventsourcing.Event { return &EventsCompactedEvent{} })
+}
+
+// CompactionStore is the event store the retention rules are applied to
+type CompactionStore interface {
+	Compact(rules []eventsourcing.RetentionRule, now time.Time) (eventsourcing.Compaction, error)
+}
+
+// Rewriter runs a rewrite of the event log while no events are stored, see eventsourcing.SimpleEventBus
+type Rewriter interface {
+	Rewrite(rewrite func() error) error
+}
+
+// Compacter drops and compacts old events by the retention rules, periodically and on the CompactEvents
+// command
+type Compacter struct {
+	store    CompactionStore
+	rewriter Rewriter
+	eventBus eventsourcing.EventBus
+	rules    []eventsourcing.RetentionRule
+	mu       sync.Mutex
+	stop     chan struct{}
+}
+
+// NewCompacter creates a compacter of the store without rules, publishing the compactions it runs by
+// itself on the event bus
+func NewCompacter(store CompactionStore, rewriter Rewriter, eventBus eventsourcing.EventBus) *Compacter {
+	return &Compacter{store: store, rewriter: rewriter, eventBus: eventBus, stop: make(chan struct{})}
+}
+
+// SetRules replaces the retention rules, none keeps all events
+func (c *Compacter) SetRules(rules []eventsourcing.RetentionRule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = slices.Clone(rules)
+}
+
+// Compact applies the retention rules to the events stored before now, returning the event recording the
+// compaction, nil if nothing changed
+func (c *Compacter) Compact(now time.Time) (*EventsCompactedEvent, error) {
+	c.mu.Lock()
+	rules := slices.Clone(c.rules)
+	c.mu.Unlock()
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	var compaction eventsourcing.Compaction
+	err := c.rewriter.Rewrite(func() error {
+		var err error
+		compaction, err = c.store.Compact(rules, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if compaction == (eventsourcing.Compaction{}) {
+		return nil, nil
+	}
+	logging.Info("Compacted the event log: dropped %d events, compacted %d", compaction.Dropped, compaction.Compacted)
+	return &EventsCompactedEvent{
+		EventType: "archive_EventsCompacted",
+		Dropped:   compaction.Dropped,
+		Compacted: compaction.Compacted,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}, nil
+}
+
+// CompactEventsCommand applies the retention rules now
+func (c *Compacter) CompactEventsCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if err := ownerOnly(data); err != nil {
+		return nil, err
+	}
+	event, err := c.Compact(time.Now())
+	if err != nil || event == nil {
+		return nil, err
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+// Start compacts the event log now and then every interval until Stop is called
+func (c *Compacter) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	run := func(now time.Time) {
+		event, err := c.Compact(now)
+		if err != nil {
+			logging.Error("Failed to compact the event log: %v", err)
+		}
+		if event != nil {
+			c.eventBus.Publish(event)
+		}
+	}
+	go func() {
+		defer ticker.Stop()
+		run(time.Now())
+		for {
+			select {
+			case <-c.stop:
+				return
+			case now := <-ticker.C:
+				run(now)
+			}
+		}
+	}()
+}
+
+// Stop ends the periodic compactions
+func (c *Compacter) Stop() {
+	close(c.stop)
+}
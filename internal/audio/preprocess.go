@@ -0,0 +1,97 @@
+package audio
+
+import "math"
+
+const (
+	preprocessFrame   = 10 // Milliseconds of audio the levels are measured over
+	highPassCutoff    = 80 // Hz below which hum and rumble are removed
+	noiseGateRatio    = 2.0
+	noiseAttenuation  = 0.1   // -20 dB for frames at the noise floor
+	noiseFloorRise    = 0.002 // How fast the noise floor follows louder noise, per frame
+	targetSpeechLevel = 0.1   // RMS level speech is normalized to
+	maxGain           = 10.0
+	minGain           = 0.5
+	gainAdaptation    = 0.1   // How fast the gain follows the speech level, per frame
+	minSpeechLevel    = 0.005 // Frames quieter than this are never amplified towards the target
+)
+
+// preprocessor cleans up captured audio before voice detection and transcription. Noise suppression
+// removes low hum and attenuates the frames at the level of the background noise; gain
+// normalization brings quiet and loud speakers to the same level.
+type preprocessor struct {
+	noiseSuppression  bool
+	gainNormalization bool
+	frameSamples      int
+	alpha             float64 // Coefficient of the high-pass filter
+	prevIn, prevOut   float64
+	noiseFloor        float64 // RMS level of the background noise, zero until measured
+	gain              float64
+}
+
+func newPreprocessor(sampleRate int) *preprocessor {
+	rc := 1 / (2 * math.Pi * highPassCutoff)
+	dt := 1 / float64(sampleRate)
+	return &preprocessor{
+		frameSamples: sampleRate * preprocessFrame / 1000,
+		alpha:        rc / (rc + dt),
+		gain:         1,
+	}
+}
+
+// Set turns the stages on or off
+func (p *preprocessor) Set(noiseSuppression, gainNormalization bool) {
+	p.noiseSuppression = noiseSuppression
+	p.gainNormalization = gainNormalization
+}
+
+// Process cleans up the samples in place with the stages that are on
+func (p *preprocessor) Process(samples []float32) {
+	if !p.noiseSuppression && !p.gainNormalization {
+		return
+	}
+	for start := 0; start < len(samples); start += p.frameSamples {
+		frame := samples[start:min(start+p.frameSamples, len(samples))]
+		if p.noiseSuppression {
+			p.suppressNoise(frame)
+		}
+		if p.gainNormalization {
+			p.normalizeGain(frame)
+		}
+	}
+}
+
+// suppressNoise filters hum out of the frame and attenuates it when it's no louder than the noise
+func (p *preprocessor) suppressNoise(frame []float32) {
+	for i, s := range frame {
+		out := p.alpha * (p.prevOut + float64(s) - p.prevIn)
+		p.prevIn, p.prevOut = float64(s), out
+		frame[i] = float32(out)
+	}
+	level := rms(frame)
+	switch {
+	case p.noiseFloor == 0 || level < p.noiseFloor:
+		p.noiseFloor = level
+	default:
+		p.noiseFloor += (level - p.noiseFloor) * noiseFloorRise
+	}
+	if level < p.noiseFloor*noiseGateRatio {
+		scale(frame, noiseAttenuation)
+	}
+}
+
+// normalizeGain moves the gain towards bringing speech to the target level and applies it
+func (p *preprocessor) normalizeGain(frame []float32) {
+	level := rms(frame)
+	if level >= minSpeechLevel && level >= p.noiseFloor*noiseGateRatio {
+		want := math.Max(minGain, math.Min(maxGain, targetSpeechLevel/level))
+		p.gain += (want - p.gain) * gainAdaptation
+	}
+	scale(frame, p.gain)
+}
+
+// scale multiplies the samples by the factor, clipping them to -1..1
+func scale(samples []float32, factor float64) {
+	for i, s := range samples {
+		samples[i] = float32(math.Max(-1, math.Min(1, float64(s)*factor)))
+	}
+}
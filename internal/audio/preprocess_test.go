@@ -0,0 +1,66 @@
+package audio
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// tone returns a second of a sine wave at 16 kHz, with the noise of the given level added
+func tone(hz, amplitude, noise float64, rng *rand.Rand) []float32 {
+	samples := make([]float32, 16000)
+	for i := range samples {
+		samples[i] = float32(amplitude*math.Sin(2*math.Pi*hz*float64(i)/16000) + noise*(rng.Float64()*2-1))
+	}
+	return samples
+}
+
+func TestPreprocessor_Off(t *testing.T) {
+	samples := []float32{0.1, -0.2, 0.3}
+	newPreprocessor(16000).Process(samples)
+	if samples[0] != 0.1 || samples[1] != -0.2 || samples[2] != 0.3 {
+		t.Errorf("Expected the samples untouched without stages, got %v", samples)
+	}
+}
+
+func TestPreprocessor_NoiseSuppression(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	p := newPreprocessor(16000)
+	p.Set(true, false)
+
+	// Mains hum with background noise is removed
+	noise := tone(50, 0.05, 0.005, rng)
+	p.Process(noise)
+	if level := rms(noise[8000:]); level > 0.002 {
+		t.Errorf("Expected hum and noise suppressed, got level %.4f", level)
+	}
+
+	// Speech over the noise is kept
+	speech := tone(300, 0.1, 0.005, rng)
+	p.Process(speech)
+	if level := rms(speech); level < 0.06 {
+		t.Errorf("Expected speech kept, got level %.4f", level)
+	}
+}
+
+func TestPreprocessor_GainNormalization(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, amplitude := range []float64{0.03, 0.25} {
+		p := newPreprocessor(16000)
+		p.Set(false, true)
+		speech := tone(300, amplitude, 0, rng)
+		p.Process(speech)
+		if level := rms(speech[8000:]); math.Abs(level-targetSpeechLevel) > 0.02 {
+			t.Errorf("Expected speech at amplitude %.2f normalized to %.2f, got %.4f", amplitude, targetSpeechLevel, level)
+		}
+	}
+
+	// Silence is not amplified to the target
+	p := newPreprocessor(16000)
+	p.Set(false, true)
+	silence := tone(300, 0.001, 0, rng)
+	p.Process(silence)
+	if level := rms(silence); level > 0.001 {
+		t.Errorf("Expected silence not amplified, got level %.4f", level)
+	}
+}
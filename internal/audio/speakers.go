@@ -0,0 +1,238 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+)
+
+const (
+	voiceprintFrame   = 512 // Samples per analysis frame, 32 ms at 16 kHz
+	voiceprintBands   = 16  // Log-spaced bands between the low and high frequency
+	voiceprintLowHz   = 100
+	voiceprintHighHz  = 5000
+	minVoicedFrames   = 10   // Frames of speech needed before a voice is recognized
+	voicedLevel       = 0.01 // RMS level below which frames are not analyzed
+	minPitchHz        = 70
+	maxPitchHz        = 400
+	voicedCorrelation = 0.5 // Normalized autocorrelation a frame needs to have a pitch
+	octaveTolerance   = 0.9 // Share of the best correlation a shorter period needs to be the pitch
+	pitchWeight       = 2.0 // Weight of an octave of pitch difference against the spectrum
+	sameSpeakerDist   = 1.0 // Voiceprints closer than this are the same speaker
+)
+
+// voiceprint describes a voice by the shape of its spectrum, the mean log energy of each band
+// relative to the others, followed by its median pitch in Hz (zero when no pitch was found)
+type voiceprint []float64
+
+// voiceprintAccumulator gathers the spectrum and pitch of the speech in an utterance
+type voiceprintAccumulator struct {
+	bands   [voiceprintBands]float64
+	frames  int
+	pitches []float64
+}
+
+// add analyzes the frames of speech in the samples
+func (v *voiceprintAccumulator) add(samples []float32) {
+	for start := 0; start+voiceprintFrame <= len(samples); start += voiceprintFrame {
+		frame := samples[start : start+voiceprintFrame]
+		if rms(frame) < voicedLevel {
+			continue
+		}
+		energies := bandEnergies(frame)
+		mean := 0.0
+		for _, e := range energies {
+			mean += e
+		}
+		mean /= voiceprintBands
+		for i, e := range energies {
+			v.bands[i] += e - mean // Relative to the frame's level, so loudness doesn't matter
+		}
+		v.frames++
+		if pitch := framePitch(frame); pitch > 0 {
+			v.pitches = append(v.pitches, pitch)
+		}
+	}
+}
+
+// voiceprint returns the voiceprint of the speech added, nil when there was too little of it
+func (v *voiceprintAccumulator) voiceprint() voiceprint {
+	if v.frames < minVoicedFrames {
+		return nil
+	}
+	vp := make(voiceprint, voiceprintBands+1)
+	for i, sum := range v.bands {
+		vp[i] = sum / float64(v.frames)
+	}
+	if len(v.pitches) > 0 {
+		pitches := append([]float64(nil), v.pitches...)
+		sort.Float64s(pitches)
+		vp[voiceprintBands] = pitches[len(pitches)/2]
+	}
+	return vp
+}
+
+// reset forgets the speech added
+func (v *voiceprintAccumulator) reset() {
+	*v = voiceprintAccumulator{}
+}
+
+// distance between two voiceprints: the RMS difference of their spectra plus the difference of
+// their pitches in octaves, weighted
+func (p voiceprint) distance(other voiceprint) float64 {
+	if len(p) != voiceprintBands+1 || len(other) != voiceprintBands+1 {
+		return math.Inf(1)
+	}
+	sum := 0.0
+	for i := 0; i < voiceprintBands; i++ {
+		d := p[i] - other[i]
+		sum += d * d
+	}
+	dist := math.Sqrt(sum / voiceprintBands)
+	if p[voiceprintBands] > 0 && other[voiceprintBands] > 0 {
+		dist += pitchWeight * math.Abs(math.Log2(p[voiceprintBands]/other[voiceprintBands]))
+	}
+	return dist
+}
+
+// bandEnergies returns the log energy of the frame in each band
+func bandEnergies(frame []float32) [voiceprintBands]float64 {
+	spectrum := make([]complex128, len(frame))
+	for i, s := range frame {
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(len(frame)-1))
+		spectrum[i] = complex(float64(s)*window, 0)
+	}
+	fft(spectrum)
+	var energies [voiceprintBands]float64
+	binHz := 16000.0 / float64(len(frame))
+	ratio := math.Pow(voiceprintHighHz/voiceprintLowHz, 1.0/voiceprintBands)
+	for band := range energies {
+		low := voiceprintLowHz * math.Pow(ratio, float64(band))
+		high := low * ratio
+		for bin := int(math.Ceil(low / binHz)); float64(bin)*binHz < high; bin++ {
+			power := cmplx.Abs(spectrum[bin])
+			energies[band] += power * power
+		}
+		energies[band] = math.Log(energies[band] + 1e-10)
+	}
+	return energies
+}
+
+// framePitch returns the pitch of the frame in Hz from its autocorrelation, zero when it isn't voiced
+func framePitch(frame []float32) float64 {
+	energy := 0.0
+	for _, s := range frame {
+		energy += float64(s) * float64(s)
+	}
+	minLag, maxLag := 16000/maxPitchHz, min(16000/minPitchHz, len(frame)-1)
+	correlations := make([]float64, maxLag+2)
+	best := 0.0
+	for lag := minLag; lag <= maxLag+1 && lag < len(frame); lag++ {
+		sum := 0.0
+		for i := lag; i < len(frame); i++ {
+			sum += float64(frame[i]) * float64(frame[i-lag])
+		}
+		// Normalized by the overlap, so longer lags aren't penalized
+		correlations[lag] = sum / energy * float64(len(frame)) / float64(len(frame)-lag)
+		best = math.Max(best, correlations[lag])
+	}
+	if best < voicedCorrelation {
+		return 0
+	}
+	// Multiples of the period correlate about as well; the first peak close to the best is the pitch
+	for lag := minLag + 1; lag <= maxLag; lag++ {
+		c := correlations[lag]
+		if c >= octaveTolerance*best && c >= correlations[lag-1] && c >= correlations[lag+1] {
+			return 16000 / float64(lag)
+		}
+	}
+	return 0
+}
+
+// fft transforms the values in place; their number must be a power of two
+func fft(values []complex128) {
+	n := len(values)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j |= bit
+		if i < j {
+			values[i], values[j] = values[j], values[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := values[start+k], values[start+k+size/2]*w
+				values[start+k], values[start+k+size/2] = even+odd, even-odd
+				w *= step
+			}
+		}
+	}
+}
+
+// speakerIdentifier tells the speakers in a room apart by their voiceprints. Enrolled speakers are
+// recognized by name; other voices are labeled "Speaker 1", "Speaker 2", ... in the order they
+// were first heard.
+type speakerIdentifier struct {
+	profiles map[string]voiceprint
+	voices   []anonymousVoice
+}
+
+// anonymousVoice is a voice heard that matched no profile, its voiceprint the mean of its utterances
+type anonymousVoice struct {
+	label      string
+	vp         voiceprint
+	utterances int
+}
+
+// setProfiles replaces the voiceprints of the enrolled speakers
+func (s *speakerIdentifier) setProfiles(profiles map[string][]float64) {
+	s.profiles = make(map[string]voiceprint, len(profiles))
+	for name, vp := range profiles {
+		s.profiles[name] = vp
+	}
+}
+
+// identify returns who spoke with the voiceprint, empty when it's nil
+func (s *speakerIdentifier) identify(vp voiceprint) string {
+	if vp == nil {
+		return ""
+	}
+	name, nearest := "", sameSpeakerDist
+	for profile, profilePrint := range s.profiles {
+		if d := vp.distance(profilePrint); d < nearest {
+			name, nearest = profile, d
+		}
+	}
+	if name != "" {
+		return name
+	}
+
+	match := -1
+	nearest = sameSpeakerDist
+	for i, voice := range s.voices {
+		if d := vp.distance(voice.vp); d < nearest {
+			match, nearest = i, d
+		}
+	}
+	if match < 0 {
+		s.voices = append(s.voices, anonymousVoice{label: fmt.Sprintf("Speaker %d", len(s.voices)+1), vp: append(voiceprint(nil), vp...), utterances: 1})
+		return s.voices[len(s.voices)-1].label
+	}
+	voice := &s.voices[match]
+	voice.utterances++
+	for i := range voice.vp {
+		if i == voiceprintBands && (vp[i] == 0 || voice.vp[i] == 0) {
+			voice.vp[i] = math.Max(voice.vp[i], vp[i]) // Keep a pitch once one was found
+			continue
+		}
+		voice.vp[i] += (vp[i] - voice.vp[i]) / float64(voice.utterances)
+	}
+	return voice.label
+}
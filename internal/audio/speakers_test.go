@@ -0,0 +1,76 @@
+package audio
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// voice returns a second of a voiced sound at 16 kHz: the harmonics of the pitch, falling off with
+// the tilt, at the given level, with a little noise
+func voice(pitch, tilt, level float64, rng *rand.Rand) []float32 {
+	samples := make([]float32, 16000)
+	for i := range samples {
+		t := float64(i) / 16000
+		s := 0.0
+		for k := 1; float64(k)*pitch < 5000; k++ {
+			s += math.Sin(2*math.Pi*float64(k)*pitch*t) / math.Pow(float64(k), tilt)
+		}
+		samples[i] = float32(level*s + 0.001*(rng.Float64()*2-1))
+	}
+	return samples
+}
+
+// voiceprintOf returns the voiceprint of the samples
+func voiceprintOf(samples []float32) voiceprint {
+	var acc voiceprintAccumulator
+	acc.add(samples)
+	return acc.voiceprint()
+}
+
+func TestVoiceprint(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	if vp := voiceprintOf(make([]float32, 16000)); vp != nil {
+		t.Errorf("Expected no voiceprint of silence, got %v", vp)
+	}
+
+	low := voiceprintOf(voice(110, 1.2, 0.1, rng))
+	if pitch := low[voiceprintBands]; math.Abs(pitch-110) > 5 {
+		t.Errorf("Expected a pitch of 110 Hz, got %.1f", pitch)
+	}
+	if d := low.distance(voiceprintOf(voice(112, 1.2, 0.02, rng))); d >= sameSpeakerDist {
+		t.Errorf("Expected the same voice spoken softer to match, got distance %.2f", d)
+	}
+	if d := low.distance(voiceprintOf(voice(210, 0.6, 0.1, rng))); d < sameSpeakerDist {
+		t.Errorf("Expected another voice not to match, got distance %.2f", d)
+	}
+}
+
+func TestSpeakerIdentifier(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	first := voiceprintOf(voice(110, 1.2, 0.1, rng))
+	second := voiceprintOf(voice(210, 0.6, 0.1, rng))
+
+	var speakers speakerIdentifier
+	for i, want := range []string{"Speaker 1", "Speaker 2", "Speaker 1", "Speaker 2"} {
+		vp := first
+		if i%2 == 1 {
+			vp = second
+		}
+		if got := speakers.identify(vp); got != want {
+			t.Errorf("Utterance %d: expected %s, got %s", i, want, got)
+		}
+	}
+	if got := speakers.identify(nil); got != "" {
+		t.Errorf("Expected no speaker without a voiceprint, got %s", got)
+	}
+
+	// Enrolled speakers are recognized by name
+	speakers.setProfiles(map[string][]float64{"Robin": second})
+	if got := speakers.identify(voiceprintOf(voice(205, 0.6, 0.05, rng))); got != "Robin" {
+		t.Errorf("Expected the enrolled speaker, got %s", got)
+	}
+	if got := speakers.identify(first); got != "Speaker 1" {
+		t.Errorf("Expected the other voice still labeled, got %s", got)
+	}
+}
@@ -0,0 +1,70 @@
+package audio
+
+// TurnState is whose turn it is in a spoken conversation
+type TurnState int
+
+const (
+	TurnListening    TurnState = iota // Waiting for the user to speak
+	TurnUserSpeaking                  // The user is speaking
+	TurnThinking                      // The user's request is being answered
+	TurnResponding                    // The response is being spoken
+)
+
+func (s TurnState) String() string {
+	switch s {
+	case TurnUserSpeaking:
+		return "user speaking"
+	case TurnThinking:
+		return "thinking"
+	case TurnResponding:
+		return "responding"
+	default:
+		return "listening"
+	}
+}
+
+// turnTaking tracks whose turn it is, so the user speaking while a response is in flight or being
+// spoken interrupts it and starts a new turn (barge-in)
+type turnTaking struct {
+	state TurnState
+}
+
+// speechStarted gives the turn to the user and returns the state it interrupts, if any: TurnThinking
+// or TurnResponding when the user barges in
+func (t *turnTaking) speechStarted() (interrupted TurnState, bargeIn bool) {
+	interrupted = t.state
+	t.state = TurnUserSpeaking
+	return interrupted, interrupted == TurnThinking || interrupted == TurnResponding
+}
+
+// speechEnded ends the user's turn, until what they said is submitted
+func (t *turnTaking) speechEnded() {
+	if t.state == TurnUserSpeaking {
+		t.state = TurnListening
+	}
+}
+
+// submitted waits for the answer to the request submitted at the end of the user's turn. When the
+// user started speaking again in the meantime it stays their turn.
+func (t *turnTaking) submitted() {
+	if t.state == TurnListening {
+		t.state = TurnThinking
+	}
+}
+
+// responseCompleted listens again once the request was answered, unless the answer is being spoken
+func (t *turnTaking) responseCompleted() {
+	if t.state == TurnThinking {
+		t.state = TurnListening
+	}
+}
+
+// speaking moves to responding while a response is spoken, and back to listening when it is done
+func (t *turnTaking) speaking(speaking bool) {
+	switch {
+	case speaking && (t.state == TurnListening || t.state == TurnThinking):
+		t.state = TurnResponding
+	case !speaking && t.state == TurnResponding:
+		t.state = TurnListening
+	}
+}
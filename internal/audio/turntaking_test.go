@@ -0,0 +1,50 @@
+package audio
+
+import "testing"
+
+func TestTurnTaking(t *testing.T) {
+	var turns turnTaking
+	if _, bargeIn := turns.speechStarted(); bargeIn {
+		t.Fatal("Expected speaking while listening not to barge in")
+	}
+	turns.speechEnded()
+	turns.submitted()
+	if turns.state != TurnThinking {
+		t.Fatalf("Expected to wait for the answer after submitting, got %s", turns.state)
+	}
+
+	// Speaking while the request is answered cancels it and starts a new turn
+	interrupted, bargeIn := turns.speechStarted()
+	if !bargeIn || interrupted != TurnThinking || turns.state != TurnUserSpeaking {
+		t.Fatalf("Expected to barge in while thinking, got %s, %v", interrupted, bargeIn)
+	}
+	// The cancelled request completing doesn't end the user's turn
+	turns.responseCompleted()
+	if turns.state != TurnUserSpeaking {
+		t.Fatalf("Expected the user to keep speaking, got %s", turns.state)
+	}
+
+	turns.speechEnded()
+	turns.submitted()
+	turns.speaking(true)
+	turns.responseCompleted()
+	if turns.state != TurnResponding {
+		t.Fatalf("Expected the spoken response to outlast the request, got %s", turns.state)
+	}
+	if interrupted, bargeIn := turns.speechStarted(); !bargeIn || interrupted != TurnResponding {
+		t.Fatalf("Expected to barge in while responding, got %s, %v", interrupted, bargeIn)
+	}
+	turns.speaking(false)
+	if turns.state != TurnUserSpeaking {
+		t.Errorf("Expected the interrupted speech ending not to end the user's turn, got %s", turns.state)
+	}
+}
+
+func TestTurnTaking_SpeakingEnds(t *testing.T) {
+	var turns turnTaking
+	turns.speaking(true)
+	turns.speaking(false)
+	if turns.state != TurnListening {
+		t.Errorf("Expected to listen once the response was spoken, got %s", turns.state)
+	}
+}
@@ -0,0 +1,91 @@
+package audio
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// defaultVoiceThreshold is the RMS level of 16-bit audio, scaled to -1..1, above which the user is speaking
+const defaultVoiceThreshold = 0.02
+
+// speechOnset is how long the user speaks before it counts as the start of an utterance, so a cough or
+// a click doesn't interrupt a response
+const speechOnset = 300 * time.Millisecond
+
+// voiceActivity is what the voice activity detector noticed in a chunk of audio
+type voiceActivity int
+
+const (
+	noVoiceActivity voiceActivity = iota
+	speechStarted                 // The user started speaking
+	speechEnded                   // The user stopped speaking long enough to end the utterance
+)
+
+// voiceActivityDetector detects from the energy of the audio when the user starts and stops speaking
+type voiceActivityDetector struct {
+	threshold      float64
+	silenceSamples int // Samples of silence after speech that end an utterance
+	onsetSamples   int // Samples of speech that start an utterance
+	silent         int // Samples of silence since the user last spoke
+	voiced         int // Samples of speech in the utterance so far
+	heardVoice     bool
+	started        bool // Whether the start of the utterance was reported
+}
+
+func newVoiceActivityDetector(sampleRate int, silence time.Duration, threshold float64) *voiceActivityDetector {
+	return &voiceActivityDetector{
+		threshold:      threshold,
+		silenceSamples: int(silence.Seconds() * float64(sampleRate)),
+		onsetSamples:   int(speechOnset.Seconds() * float64(sampleRate)),
+	}
+}
+
+// Process reports whether the samples start an utterance or complete a period of silence following speech.
+// Both are reported once per utterance; silence without speech before it is ignored.
+func (d *voiceActivityDetector) Process(samples []float32) voiceActivity {
+	if len(samples) == 0 {
+		return noVoiceActivity
+	}
+	if rms(samples) >= d.threshold {
+		d.heardVoice = true
+		d.silent = 0
+		d.voiced += len(samples)
+		if !d.started && d.voiced >= d.onsetSamples {
+			d.started = true
+			return speechStarted
+		}
+		return noVoiceActivity
+	}
+	if !d.heardVoice {
+		return noVoiceActivity
+	}
+	d.silent += len(samples)
+	if d.silent < d.silenceSamples {
+		return noVoiceActivity
+	}
+	d.heardVoice = false
+	d.started = false
+	d.silent = 0
+	d.voiced = 0
+	return speechEnded
+}
+
+// rms returns the root mean square level of the samples
+func rms(samples []float32) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+// isNonSpeech reports whether whisper transcribed a segment as a non speech marker, like [BLANK_AUDIO] or (wind)
+func isNonSpeech(text string) bool {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return true
+	}
+	return (strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]")) ||
+		(strings.HasPrefix(text, "(") && strings.HasSuffix(text, ")"))
+}
@@ -0,0 +1,76 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+func constant(level float32, n int) []float32 {
+	samples := make([]float32, n)
+	for i := range samples {
+		samples[i] = level
+	}
+	return samples
+}
+
+func TestVoiceActivityDetector(t *testing.T) {
+	// Two seconds of silence at 1000 samples per second end an utterance
+	vad := newVoiceActivityDetector(1000, 2*time.Second, defaultVoiceThreshold)
+	speech, silence := constant(0.3, 500), constant(0.001, 500)
+
+	// Silence before the user spoke does not end anything
+	for i := 0; i < 6; i++ {
+		if vad.Process(silence) != noVoiceActivity {
+			t.Fatalf("Expected no voice activity before speech")
+		}
+	}
+
+	if vad.Process(speech) != speechStarted {
+		t.Fatal("Expected half a second of speech to start an utterance")
+	}
+	for i := 0; i < 3; i++ {
+		if vad.Process(silence) != noVoiceActivity {
+			t.Fatalf("Expected the utterance to continue after %d ms of silence", (i+1)*500)
+		}
+	}
+	// Speaking again resets the silence, without starting another utterance
+	if vad.Process(speech) != noVoiceActivity {
+		t.Fatal("Expected the start of an utterance to be reported once")
+	}
+	for i := 0; i < 3; i++ {
+		vad.Process(silence)
+	}
+	if vad.Process(silence) != speechEnded {
+		t.Fatal("Expected the utterance to end after two seconds of silence")
+	}
+	if vad.Process(silence) != noVoiceActivity {
+		t.Error("Expected the end of an utterance to be reported once")
+	}
+}
+
+func TestVoiceActivityDetector_SpeechOnset(t *testing.T) {
+	vad := newVoiceActivityDetector(1000, 2*time.Second, defaultVoiceThreshold)
+
+	// A short sound doesn't start an utterance, speaking on does
+	if vad.Process(constant(0.3, 100)) != noVoiceActivity {
+		t.Fatal("Expected 100 ms of sound not to start an utterance")
+	}
+	vad.Process(constant(0.001, 100))
+	if vad.Process(constant(0.3, 200)) != speechStarted {
+		t.Error("Expected 300 ms of speech to start an utterance")
+	}
+}
+
+func TestIsNonSpeech(t *testing.T) {
+	for text, want := range map[string]bool{
+		" [BLANK_AUDIO]": true,
+		"(wind blowing)": true,
+		"  ":             true,
+		"Add a task":     false,
+		"[1] first item": false,
+	} {
+		if got := isNonSpeech(text); got != want {
+			t.Errorf("isNonSpeech(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
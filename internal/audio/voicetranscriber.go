@@ -8,20 +8,35 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	media "github.com/mutablelogic/go-media"
 	"github.com/mutablelogic/go-media/pkg/ffmpeg"
 	"github.com/mutablelogic/go-whisper"
 	"github.com/mutablelogic/go-whisper/pkg/schema"
 	"github.com/mutablelogic/go-whisper/pkg/task"
+	whispercpp "github.com/mutablelogic/go-whisper/sys/whisper"
+	"mindpalace/internal/audioinput"
 	"mindpalace/pkg/logging"
 )
 
+// logger logs voice capture and transcription
+var logger = logging.Named("audio")
+
+// Transcript is a spoken request, submitted once the user stopped speaking
+type Transcript struct {
+	Text     string
+	Language string // Language detected, empty when unknown
+	Speaker  string // Enrolled name or "Speaker N" with diarization on, empty otherwise
+}
+
 // VoiceTranscriber manages audio recording and real-time transcription using go-whisper
 type VoiceTranscriber struct {
 	whisper               *whisper.Whisper
 	model                 *schema.Model
+	modelDir              string
 	task                  *task.Context
 	mu                    sync.Mutex
 	transcriptionCallback func(string)
@@ -35,6 +50,32 @@ type VoiceTranscriber struct {
 	running               bool
 	captureCtx            context.Context
 	captureCancel         context.CancelFunc
+	vad                   *voiceActivityDetector // Nil when auto-submit is disabled
+	autoSubmitCallback    func(Transcript)
+	transcript            []string   // Text transcribed since the last auto-submit
+	pendingTranscriptions int        // Transcriptions running in the background
+	transcribed           *sync.Cond // Signalled when a transcription finished
+	inputDevices          []string   // ffmpeg input devices tried before the built-in ones
+	selectedDevice        string     // Device selected at runtime, tried before the input devices
+	preprocess            *preprocessor
+
+	turns            turnTaking
+	bargeInCallback  func(interrupted TurnState) // Nil when barge-in is disabled
+	activityCallback func(speaking bool)         // Told when the user starts and stops speaking
+
+	language           string // Language spoken, "auto" detects it
+	transcriptLanguage string // Language the transcript since the last auto-submit was detected in
+
+	diarization bool
+	speakers    speakerIdentifier
+	utterance   voiceprintAccumulator // Speech of the transcript since the last auto-submit
+	enrollment  *speakerEnrollment    // Enrollment waiting for the next utterance, if any
+}
+
+// speakerEnrollment records the voiceprint of the next utterance as the voice of a speaker
+type speakerEnrollment struct {
+	name string
+	done func(voiceprint []float64)
 }
 
 // NewVoiceTranscriber initializes a new VoiceTranscriber instance with go-whisper
@@ -46,14 +87,18 @@ func NewVoiceTranscriber(modelPath string) (*VoiceTranscriber, error) {
 		sampleRate:      16000,
 		bufferThreshold: 16000 * 1,
 		audioBuffer:     make([]float32, 0, 16000*10),
+		modelDir:        dir,
+		preprocess:      newPreprocessor(16000),
+		language:        "auto",
 	}
+	vt.transcribed = sync.NewCond(&vt.mu)
 	vt.whisper, err = whisper.New(dir)
 	if err != nil {
 		return nil, err
 	}
 	vt.model = vt.whisper.GetModelById(filename)
 	if vt.model == nil {
-		logging.Info("AUDIO: Downloading model %s", filename)
+		logger.Info("AUDIO: Downloading model %s", filename)
 		vt.model, err = vt.whisper.DownloadModel(context.Background(), filename, nil)
 		if err != nil {
 			return nil, err
@@ -63,11 +108,57 @@ func NewVoiceTranscriber(modelPath string) (*VoiceTranscriber, error) {
 	if err = vt.task.Init(dir, vt.model, 0); err != nil {
 		return nil, err
 	}
-	logging.Info("AUDIO: Whisper transcription enabled with model %s", vt.model.Id)
+	logger.Info("AUDIO: Whisper transcription enabled with model %s", vt.model.Id)
 
 	return vt, nil
 }
 
+// DownloadModel downloads a model file into the model directory, reporting the bytes downloaded so far
+func (vt *VoiceTranscriber) DownloadModel(ctx context.Context, file string, progress func(current, total uint64)) error {
+	_, err := vt.whisper.DownloadModel(ctx, file, progress)
+	return err
+}
+
+// DownloadedModels returns the file names of the models in the model directory
+func (vt *VoiceTranscriber) DownloadedModels() []string {
+	models := vt.whisper.ListModels()
+	files := make([]string, len(models))
+	for i, model := range models {
+		files[i] = filepath.Base(model.Path)
+	}
+	return files
+}
+
+// SwitchModel loads another model file and uses it for the next transcriptions,
+// once the transcriptions running on the current model finished
+func (vt *VoiceTranscriber) SwitchModel(ctx context.Context, file string) error {
+	model, err := vt.whisper.DownloadModel(ctx, file, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get model %s: %w", file, err)
+	}
+	newTask := task.New()
+	if err := newTask.Init(vt.modelDir, model, 0); err != nil {
+		return fmt.Errorf("failed to load model %s: %w", file, err)
+	}
+
+	vt.mu.Lock()
+	for vt.pendingTranscriptions > 0 {
+		vt.transcribed.Wait()
+	}
+	oldTask := vt.task
+	vt.task = newTask
+	vt.model = model
+	vt.mu.Unlock()
+
+	if oldTask != nil {
+		if err := oldTask.Close(); err != nil {
+			logger.Error("AUDIO: Failed to close previous model: %v", err)
+		}
+	}
+	logger.Info("AUDIO: Switched whisper transcription to model %s", model.Id)
+	return nil
+}
+
 // SetSessionEventCallback sets the callback for session events
 func (vt *VoiceTranscriber) SetSessionEventCallback(callback func(eventType string, data map[string]interface{})) {
 	vt.mu.Lock()
@@ -75,14 +166,173 @@ func (vt *VoiceTranscriber) SetSessionEventCallback(callback func(eventType stri
 	vt.sessionCallback = callback
 }
 
+// SetAutoSubmit calls the callback with the transcript of what was said once the user stopped speaking
+// for the given duration, so requests can be submitted without pressing a button. Zero disables auto-submit.
+func (vt *VoiceTranscriber) SetAutoSubmit(silence time.Duration, callback func(Transcript)) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	vt.transcript = nil
+	if silence <= 0 {
+		vt.vad = nil
+		vt.autoSubmitCallback = nil
+		return
+	}
+	vt.vad = newVoiceActivityDetector(vt.sampleRate, silence, defaultVoiceThreshold)
+	vt.autoSubmitCallback = callback
+	logger.Info("AUDIO: Auto-submitting transcriptions after %s of silence", silence)
+}
+
+// SetLanguage sets the language speech is transcribed in, e.g. "nl" or "dutch"; "auto" or empty
+// detects it. Models whose name ends in .en only transcribe English.
+func (vt *VoiceTranscriber) SetLanguage(language string) error {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if language == "" {
+		language = "auto"
+	}
+	if language != "auto" && whispercpp.Whisper_lang_id(language) == -1 {
+		return fmt.Errorf("unknown language %q", language)
+	}
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	if language != "auto" && language != "en" && language != "english" && !vt.task.CanTranslate() {
+		logger.Error("AUDIO: Model %s only transcribes English, switch to a multilingual model for %s", vt.model.Id, language)
+	}
+	vt.language = language
+	logger.Info("AUDIO: Transcribing speech in language %s", language)
+	return nil
+}
+
+// SetDiarization turns labeling the speaker of each submitted transcript on or off, for rooms where
+// several people talk to MindPalace
+func (vt *VoiceTranscriber) SetDiarization(on bool) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	vt.diarization = on
+}
+
+// SetSpeakerProfiles sets the voiceprints of the enrolled speakers, recognized by name
+func (vt *VoiceTranscriber) SetSpeakerProfiles(profiles map[string][]float64) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	vt.speakers.setProfiles(profiles)
+}
+
+// EnrollSpeaker records the voiceprint of the next utterance long enough to recognize as the voice of
+// the named speaker, calling done with it; the utterance is submitted as theirs
+func (vt *VoiceTranscriber) EnrollSpeaker(name string, done func(voiceprint []float64)) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	vt.enrollment = &speakerEnrollment{name: name, done: done}
+	logger.Info("AUDIO: Enrolling the voice of %s from the next utterance", name)
+}
+
+// SetBargeIn calls the callback when the user starts speaking while the answer to a request is in
+// flight or being spoken, so it can be cancelled and the user's speech starts a new turn. It takes
+// auto-submit to know when requests are submitted; nil disables barge-in.
+func (vt *VoiceTranscriber) SetBargeIn(callback func(interrupted TurnState)) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	vt.bargeInCallback = callback
+}
+
+// SetVoiceActivityCallback calls the callback with true when the user starts speaking and with false
+// when they stopped, e.g. to show MindPalace is listening. It takes auto-submit to detect speech.
+func (vt *VoiceTranscriber) SetVoiceActivityCallback(callback func(speaking bool)) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	vt.activityCallback = callback
+}
+
+// ResponseCompleted tells the turn taking the submitted request was answered, cancelled or failed
+func (vt *VoiceTranscriber) ResponseCompleted() {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	vt.turns.responseCompleted()
+}
+
+// SetSpeaking tells the turn taking whether a response is being spoken
+func (vt *VoiceTranscriber) SetSpeaking(speaking bool) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	vt.turns.speaking(speaking)
+}
+
+// SetInputDevices sets the microphones tried first when capture starts, e.g. "pulse:default"
+func (vt *VoiceTranscriber) SetInputDevices(devices []string) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	vt.inputDevices = devices
+}
+
+// SetPreprocessing turns noise suppression and gain normalization of the captured audio on or off
+func (vt *VoiceTranscriber) SetPreprocessing(noiseSuppression, gainNormalization bool) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	vt.preprocess.Set(noiseSuppression, gainNormalization)
+}
+
+// ListInputDevices lists the microphones ffmpeg finds, named the way capture opens them, e.g. "pulse:default"
+func (vt *VoiceTranscriber) ListInputDevices() []audioinput.Device {
+	manager, err := ffmpeg.NewManager()
+	if err != nil {
+		logger.Error("AUDIO: Failed to list microphones: %v", err)
+		return nil
+	}
+	var devices []audioinput.Device
+	for _, format := range manager.Formats(media.INPUT | media.AUDIO | media.DEVICE) {
+		f, ok := format.(*ffmpeg.Format)
+		if !ok {
+			continue
+		}
+		for _, device := range f.Devices {
+			devices = append(devices, audioinput.Device{
+				Name:        f.Name() + ":" + device.Name,
+				Description: device.Description,
+				Default:     device.Default,
+			})
+		}
+	}
+	return devices
+}
+
+// SelectInputDevice captures from the device from now on, restarting capture when it runs. An empty
+// device goes back to the configured devices.
+func (vt *VoiceTranscriber) SelectInputDevice(device string) error {
+	if device != "" {
+		input, err := openMicrophone(device)
+		if err != nil {
+			return err
+		}
+		input.Close()
+	}
+	vt.mu.Lock()
+	vt.selectedDevice = device
+	capturing := vt.captureCancel != nil
+	vt.mu.Unlock()
+	if !capturing {
+		return nil
+	}
+	vt.StopCapture()
+	return vt.StartCapture(context.Background())
+}
+
+// openMicrophone opens an ffmpeg input device for 16 kHz mono capture
+func openMicrophone(device string) (*ffmpeg.Reader, error) {
+	return ffmpeg.Open(device,
+		ffmpeg.OptInputOpt("sample_rate", "16000"),
+		ffmpeg.OptInputOpt("channels", "1"),
+		ffmpeg.OptInputOpt("format", "s16"),
+	)
+}
+
 // Start initializes the transcriber for receiving audio chunks
 func (vt *VoiceTranscriber) Start(transcriptionCallback func(string)) error {
-	logging.Debug("AUDIO: Starting voice transcriber")
+	logger.Debug("AUDIO: Starting voice transcriber")
 	vt.mu.Lock()
 	defer vt.mu.Unlock()
 
 	if vt.running {
-		logging.Debug("AUDIO: Transcriber already running")
+		logger.Debug("AUDIO: Transcriber already running")
 		return nil
 	}
 
@@ -93,7 +343,7 @@ func (vt *VoiceTranscriber) Start(transcriptionCallback func(string)) error {
 	vt.audioBuffer = vt.audioBuffer[:0] // Clear buffer
 	vt.running = true
 
-	logging.Info("AUDIO: Voice transcriber started with session %s", vt.sessionID)
+	logger.Info("AUDIO: Voice transcriber started with session %s", vt.sessionID)
 	return nil
 }
 
@@ -117,80 +367,181 @@ func (vt *VoiceTranscriber) Stop() {
 		})
 	}
 
-	logging.Info("AUDIO: Voice transcriber stopped, session %s, duration %.2fs, %d segments",
+	logger.Info("AUDIO: Voice transcriber stopped, session %s, duration %.2fs, %d segments",
 		vt.sessionID, duration, vt.totalSegments)
 }
 
 // ProcessAudioChunk processes incoming audio data from WebSocket
 func (vt *VoiceTranscriber) ProcessAudioChunk(pcmData []byte) error {
-	logging.Debug("AUDIO: Received audio chunk: %d bytes", len(pcmData))
+	logger.Debug("AUDIO: Received audio chunk: %d bytes", len(pcmData))
 	vt.mu.Lock()
 	if !vt.running {
 		vt.mu.Unlock()
-		logging.Debug("AUDIO: Transcriber not running, ignoring audio chunk")
+		logger.Debug("AUDIO: Transcriber not running, ignoring audio chunk")
 		return nil
 	}
 	vt.mu.Unlock()
 
 	// Convert PCM16 to float32
-	logging.Debug("AUDIO: Converting PCM data to float32")
+	logger.Debug("AUDIO: Converting PCM data to float32")
 	samples, err := convertPCM16ToFloat32(pcmData)
 	if err != nil {
-		logging.Error("AUDIO: Failed to convert PCM data: %v", err)
+		logger.Error("AUDIO: Failed to convert PCM data: %v", err)
 		return fmt.Errorf("failed to convert PCM data: %w", err)
 	}
-	logging.Debug("AUDIO: Converted to %d float32 samples", len(samples))
+	logger.Debug("AUDIO: Converted to %d float32 samples", len(samples))
 
 	vt.mu.Lock()
+	vt.preprocess.Process(samples)
 	vt.audioBuffer = append(vt.audioBuffer, samples...)
-	logging.Debug("AUDIO: Buffer now has %d samples (threshold: %d)", len(vt.audioBuffer), vt.bufferThreshold)
+	logger.Debug("AUDIO: Buffer now has %d samples (threshold: %d)", len(vt.audioBuffer), vt.bufferThreshold)
+	activity := noVoiceActivity
+	if vt.vad != nil {
+		activity = vt.vad.Process(samples)
+	}
+	silenceReached := activity == speechEnded
+	var bargeIn func(TurnState)
+	var interrupted TurnState
+	var activityChanged func(bool)
+	switch activity {
+	case speechStarted:
+		if state, interrupts := vt.turns.speechStarted(); interrupts {
+			interrupted, bargeIn = state, vt.bargeInCallback
+		}
+		activityChanged = vt.activityCallback
+	case speechEnded:
+		vt.turns.speechEnded()
+		activityChanged = vt.activityCallback
+	}
 
-	// Process when we have enough audio (1 second for faster testing)
-	if len(vt.audioBuffer) >= vt.bufferThreshold {
+	// Process when we have enough audio (1 second for faster testing), or what is left once the user stopped speaking
+	if len(vt.audioBuffer) >= vt.bufferThreshold || (silenceReached && len(vt.audioBuffer) > 0) {
 		audioToProcess := make([]float32, len(vt.audioBuffer))
 		copy(audioToProcess, vt.audioBuffer)
 		vt.audioBuffer = vt.audioBuffer[:0] // Clear buffer
+		vt.pendingTranscriptions++
 		vt.mu.Unlock()
 
-		logging.Info("AUDIO: Buffer threshold reached (%d samples), starting transcription", len(audioToProcess))
+		logger.Info("AUDIO: Buffer threshold reached (%d samples), starting transcription", len(audioToProcess))
 		// Process in background
 		go vt.transcribeAudio(audioToProcess)
 	} else {
 		vt.mu.Unlock()
-		logging.Debug("AUDIO: Buffer not full yet, continuing to accumulate")
+		logger.Debug("AUDIO: Buffer not full yet, continuing to accumulate")
 	}
 
+	if activityChanged != nil {
+		activityChanged(activity == speechStarted)
+	}
+	if bargeIn != nil {
+		logger.Info("AUDIO: User started speaking while %s, interrupting", interrupted)
+		go bargeIn(interrupted)
+	}
+	if silenceReached {
+		go vt.submitTranscript()
+	}
 	return nil
 }
 
+// submitTranscript waits for the running transcriptions and submits the text transcribed since the last submit
+func (vt *VoiceTranscriber) submitTranscript() {
+	vt.mu.Lock()
+	for vt.pendingTranscriptions > 0 {
+		vt.transcribed.Wait()
+	}
+	text := strings.TrimSpace(strings.Join(vt.transcript, " "))
+	transcript := Transcript{Text: text, Language: vt.transcriptLanguage}
+	vt.transcript = nil
+	vt.transcriptLanguage = ""
+	vp := vt.utterance.voiceprint()
+	vt.utterance.reset()
+	enrollment := vt.enrollment
+	switch {
+	case text == "":
+		enrollment = nil
+	case enrollment != nil && vp != nil:
+		vt.enrollment = nil
+		transcript.Speaker = enrollment.name
+	case enrollment != nil:
+		logger.Info("AUDIO: Utterance too short to enroll %s, waiting for the next", enrollment.name)
+		enrollment = nil
+	case vt.diarization:
+		transcript.Speaker = vt.speakers.identify(vp)
+	}
+	callback := vt.autoSubmitCallback
+	if text != "" && callback != nil {
+		vt.turns.submitted()
+	}
+	vt.mu.Unlock()
+
+	if enrollment != nil {
+		enrollment.done(vp)
+	}
+	if text == "" || callback == nil {
+		return
+	}
+	logger.Info("AUDIO: Silence detected, submitting transcription of %q: %s", transcript.Speaker, text)
+	callback(transcript)
+}
+
 // transcribeAudio performs the actual transcription using go-whisper
 func (vt *VoiceTranscriber) transcribeAudio(audio []float32) {
-	logging.Info("AUDIO: Transcribing %d audio samples (%.2fs)", len(audio), float64(len(audio))/float64(vt.sampleRate))
+	defer func() {
+		vt.mu.Lock()
+		vt.pendingTranscriptions--
+		vt.transcribed.Broadcast()
+		vt.mu.Unlock()
+	}()
+	logger.Info("AUDIO: Transcribing %d audio samples (%.2fs)", len(audio), float64(len(audio))/float64(vt.sampleRate))
 
 	// Save audio to file for debugging
 	if err := saveAudioToWav(audio, fmt.Sprintf("debug_audio_%d.wav", time.Now().UnixNano())); err != nil {
-		logging.Error("AUDIO: Failed to save debug audio: %v", err)
+		logger.Error("AUDIO: Failed to save debug audio: %v", err)
 	} else {
-		logging.Debug("AUDIO: Saved debug audio to file")
+		logger.Debug("AUDIO: Saved debug audio to file")
 	}
 
-	vt.task.CopyParams()
-	vt.task.SetLanguage("auto")
-	vt.task.SetTranslate(false)
+	vt.mu.Lock()
+	t := vt.task // SwitchModel only replaces the task once no transcription is running
+	language := vt.language
+	vt.mu.Unlock()
+	t.CopyParams()
+	if err := t.SetLanguage(language); err != nil {
+		logger.Error("AUDIO: Failed to set language %s, detecting it: %v", language, err)
+		t.SetLanguage("auto")
+	}
+	t.SetTranslate(false)
 	ts := time.Since(vt.startTime)
-	err := vt.task.Transcribe(context.Background(), ts, audio, func(seg *schema.Segment) {
+	spoken := false
+	err := t.Transcribe(context.Background(), ts, audio, func(seg *schema.Segment) {
 		vt.mu.Lock()
 		vt.totalSegments++
+		if vt.vad != nil && !isNonSpeech(seg.Text) {
+			vt.transcript = append(vt.transcript, strings.TrimSpace(seg.Text))
+			spoken = true
+		}
 		vt.mu.Unlock()
-		logging.Debug("AUDIO: New segment: %s", seg.Text)
+		logger.Debug("AUDIO: New segment: %s", seg.Text)
 		if vt.transcriptionCallback != nil {
 			vt.transcriptionCallback(seg.Text)
 		}
 	})
 	if err != nil {
-		logging.Error("AUDIO: Transcription error: %v", err)
+		logger.Error("AUDIO: Transcription error: %v", err)
 		return
 	}
+	if !spoken {
+		return
+	}
+	vt.mu.Lock()
+	if vt.diarization || vt.enrollment != nil {
+		vt.utterance.add(audio)
+	}
+	if result := t.Result(); result != nil && result.Language != "" {
+		vt.transcriptLanguage = result.Language
+		logger.Debug("AUDIO: Detected language %s", result.Language)
+	}
+	vt.mu.Unlock()
 }
 
 // convertPCM16ToFloat32 converts 16-bit PCM bytes to float32 samples
@@ -258,60 +609,78 @@ func saveAudioToWav(samples []float32, filename string) error {
 
 // Close cleans up the Whisper instance
 func (vt *VoiceTranscriber) StartCapture(ctx context.Context) error {
-	logging.Info("AUDIO: Starting microphone capture")
+	logger.Info("AUDIO: Starting microphone capture")
 	vt.mu.Lock()
 	if vt.running && vt.captureCancel != nil {
 		vt.mu.Unlock()
-		logging.Info("AUDIO: Capture already running")
+		logger.Info("AUDIO: Capture already running")
 		return nil
 	}
+	devices := vt.inputDevices
+	if vt.selectedDevice != "" {
+		devices = append([]string{vt.selectedDevice}, devices...)
+	}
 	vt.mu.Unlock()
 
+	// Open the selected and configured microphones first
+	var input *ffmpeg.Reader
+	var err error
+	for _, device := range devices {
+		input, err = openMicrophone(device)
+		if err == nil {
+			logger.Info("AUDIO: Successfully opened configured microphone %s", device)
+			break
+		}
+		logger.Error("AUDIO: Failed to open configured microphone %s: %v", device, err)
+	}
+
 	// Open microphone input - using specific Pulse source for USB mic from pactl
-	logging.Info("AUDIO: Opening Pulse USB mic source")
-	input, err := ffmpeg.Open("pulse:alsa_input.usb-K-MIC_NATRIUM_K-MIC_NATRIUM_20190805V001-00.iec958-stereo",
-		ffmpeg.OptInputOpt("sample_rate", "16000"),
-		ffmpeg.OptInputOpt("channels", "1"),
-		ffmpeg.OptInputOpt("format", "s16"),
-		ffmpeg.OptInputOpt("channel_layout", "mono"),
-	)
-	if err != nil {
-		logging.Error("AUDIO: Failed to open USB Pulse source, trying built-in analog: %v", err)
-		// Fallback to built-in analog mic
-		input, err = ffmpeg.Open("pulse:alsa_input.pci-0000_10_00.6.analog-stereo",
+	if input == nil {
+		logger.Info("AUDIO: Opening Pulse USB mic source")
+		input, err = ffmpeg.Open("pulse:alsa_input.usb-K-MIC_NATRIUM_K-MIC_NATRIUM_20190805V001-00.iec958-stereo",
 			ffmpeg.OptInputOpt("sample_rate", "16000"),
 			ffmpeg.OptInputOpt("channels", "1"),
 			ffmpeg.OptInputOpt("format", "s16"),
 			ffmpeg.OptInputOpt("channel_layout", "mono"),
 		)
 		if err != nil {
-			logging.Error("AUDIO: Failed to open analog Pulse source, trying ALSA USB: %v", err)
-			// Fallback to ALSA USB mic
-			input, err = ffmpeg.Open("hw:1,0",
+			logger.Error("AUDIO: Failed to open USB Pulse source, trying built-in analog: %v", err)
+			// Fallback to built-in analog mic
+			input, err = ffmpeg.Open("pulse:alsa_input.pci-0000_10_00.6.analog-stereo",
 				ffmpeg.OptInputOpt("sample_rate", "16000"),
 				ffmpeg.OptInputOpt("channels", "1"),
 				ffmpeg.OptInputOpt("format", "s16"),
+				ffmpeg.OptInputOpt("channel_layout", "mono"),
 			)
 			if err != nil {
-				logging.Error("AUDIO: Failed to open hw:1,0, trying ALSA default: %v", err)
-				// Final fallback to ALSA default
-				input, err = ffmpeg.Open("alsa:default",
+				logger.Error("AUDIO: Failed to open analog Pulse source, trying ALSA USB: %v", err)
+				// Fallback to ALSA USB mic
+				input, err = ffmpeg.Open("hw:1,0",
 					ffmpeg.OptInputOpt("sample_rate", "16000"),
 					ffmpeg.OptInputOpt("channels", "1"),
 					ffmpeg.OptInputOpt("format", "s16"),
 				)
 				if err != nil {
-					return fmt.Errorf("failed to open microphone (tried USB Pulse, analog Pulse, hw:1,0, default): %w", err)
+					logger.Error("AUDIO: Failed to open hw:1,0, trying ALSA default: %v", err)
+					// Final fallback to ALSA default
+					input, err = ffmpeg.Open("alsa:default",
+						ffmpeg.OptInputOpt("sample_rate", "16000"),
+						ffmpeg.OptInputOpt("channels", "1"),
+						ffmpeg.OptInputOpt("format", "s16"),
+					)
+					if err != nil {
+						return fmt.Errorf("failed to open microphone (tried USB Pulse, analog Pulse, hw:1,0, default): %w", err)
+					}
+					logger.Info("AUDIO: Successfully opened alsa:default as final fallback")
+				} else {
+					logger.Info("AUDIO: Successfully opened USB microphone (hw:1,0)")
 				}
-				logging.Info("AUDIO: Successfully opened alsa:default as final fallback")
 			} else {
-				logging.Info("AUDIO: Successfully opened USB microphone (hw:1,0)")
+				logger.Info("AUDIO: Successfully opened built-in analog microphone (Pulse)")
 			}
 		} else {
-			logging.Info("AUDIO: Successfully opened built-in analog microphone (Pulse)")
+			logger.Info("AUDIO: Successfully opened USB microphone (Pulse source)")
 		}
-	} else {
-		logging.Info("AUDIO: Successfully opened USB microphone (Pulse source)")
 	}
 
 	// Map function to use input parameters
@@ -331,11 +700,13 @@ func (vt *VoiceTranscriber) StartCapture(ctx context.Context) error {
 		defer input.Close()
 		defer func() {
 			vt.mu.Lock()
-			vt.captureCtx = nil
-			vt.captureCancel = nil
+			if vt.captureCtx == captureCtx { // Not restarted on another device meanwhile
+				vt.captureCtx = nil
+				vt.captureCancel = nil
+			}
 			vt.mu.Unlock()
 		}()
-		logging.Info("AUDIO: Started continuous microphone capture goroutine")
+		logger.Info("AUDIO: Started continuous microphone capture goroutine")
 
 		chunkCount := 0
 		for {
@@ -349,9 +720,9 @@ func (vt *VoiceTranscriber) StartCapture(ctx context.Context) error {
 					return nil
 				}
 
-				logging.Debug("AUDIO: Captured frame with %d bytes", len(data))
+				logger.Debug("AUDIO: Captured frame with %d bytes", len(data))
 				if err := vt.ProcessAudioChunk(data); err != nil {
-					logging.Error("AUDIO: Failed to process captured chunk: %v", err)
+					logger.Error("AUDIO: Failed to process captured chunk: %v", err)
 				}
 				chunkCount++
 
@@ -359,10 +730,10 @@ func (vt *VoiceTranscriber) StartCapture(ctx context.Context) error {
 			})
 			if err != nil {
 				if errors.Is(err, context.Canceled) || errors.Is(err, io.EOF) {
-					logging.Info("AUDIO: Capture stopped (context canceled or EOF)")
+					logger.Info("AUDIO: Capture stopped (context canceled or EOF)")
 					break
 				}
-				logging.Error("AUDIO: Capture decode error: %v", err)
+				logger.Error("AUDIO: Capture decode error: %v", err)
 				select {
 				case <-captureCtx.Done():
 					return
@@ -371,7 +742,7 @@ func (vt *VoiceTranscriber) StartCapture(ctx context.Context) error {
 				}
 			}
 		}
-		logging.Info("AUDIO: Microphone capture goroutine ended. Processed %d chunks", chunkCount)
+		logger.Info("AUDIO: Microphone capture goroutine ended. Processed %d chunks", chunkCount)
 	}()
 
 	return nil
@@ -384,7 +755,7 @@ func (vt *VoiceTranscriber) StopCapture() {
 		vt.captureCancel()
 		vt.captureCancel = nil
 		vt.captureCtx = nil
-		logging.Info("AUDIO: Stopped microphone capture")
+		logger.Info("AUDIO: Stopped microphone capture")
 	}
 }
 
@@ -0,0 +1,119 @@
+package audioinput
+
+import (
+	"fmt"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// Backend captures the audio and cleans it up, e.g. the VoiceTranscriber
+type Backend interface {
+	ListInputDevices() []Device
+	SelectInputDevice(device string) error // Empty goes back to the configured devices
+	SetPreprocessing(noiseSuppression, gainNormalization bool)
+}
+
+// Manager lists and selects the devices of the backend and sets how their audio is processed
+type Manager struct {
+	backend  Backend
+	settings *SettingsAggregate
+}
+
+// NewManager creates a manager for the input of the backend
+func NewManager(backend Backend, settings *SettingsAggregate) *Manager {
+	return &Manager{backend: backend, settings: settings}
+}
+
+// Restore applies the settings restored from the events to the backend, e.g. on start. A device
+// that can't be opened anymore falls back to the configured ones.
+func (m *Manager) Restore() {
+	m.backend.SetPreprocessing(m.settings.Processing())
+	device := m.settings.SelectedDevice()
+	if device == "" {
+		return
+	}
+	if err := m.backend.SelectInputDevice(device); err != nil {
+		logging.Error("Failed to select microphone %s: %v", device, err)
+	}
+}
+
+// ListDevicesCommand lists the devices that can be captured from, with the current settings
+func (m *Manager) ListDevicesCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	noiseSuppression, gainNormalization := m.settings.Processing()
+	return []eventsourcing.Event{&DevicesListedEvent{
+		EventType:         "audioinput_DevicesListed",
+		Devices:           m.backend.ListInputDevices(),
+		Selected:          m.settings.SelectedDevice(),
+		NoiseSuppression:  noiseSuppression,
+		GainNormalization: gainNormalization,
+		Timestamp:         eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// SelectDeviceCommand captures from the device in the "device" field from now on; an empty device
+// goes back to the configured ones
+func (m *Manager) SelectDeviceCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if err := ownerOnly(data); err != nil {
+		return nil, err
+	}
+	device, ok := data["device"].(string)
+	if !ok {
+		return nil, fmt.Errorf("device must be a string")
+	}
+	previous := m.settings.SelectedDevice()
+	if device == previous {
+		return nil, nil
+	}
+	if err := m.backend.SelectInputDevice(device); err != nil {
+		return nil, fmt.Errorf("failed to select microphone %s: %v", device, err)
+	}
+	logging.Info("Selected microphone %q", device)
+	return []eventsourcing.Event{&DeviceSelectedEvent{
+		EventType: "audioinput_DeviceSelected",
+		Device:    device,
+		Previous:  previous,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// SetProcessingCommand turns noise suppression and gain normalization on or off with the
+// "noise_suppression" and "gain_normalization" fields; a missing field keeps its setting
+func (m *Manager) SetProcessingCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if err := ownerOnly(data); err != nil {
+		return nil, err
+	}
+	noiseSuppression, gainNormalization := m.settings.Processing()
+	changed := false
+	for field, setting := range map[string]*bool{"noise_suppression": &noiseSuppression, "gain_normalization": &gainNormalization} {
+		value, exists := data[field]
+		if !exists {
+			continue
+		}
+		on, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s must be true or false", field)
+		}
+		changed = changed || on != *setting
+		*setting = on
+	}
+	if !changed {
+		return nil, nil
+	}
+	m.backend.SetPreprocessing(noiseSuppression, gainNormalization)
+	logging.Info("Noise suppression %s, gain normalization %s", onOff(noiseSuppression), onOff(gainNormalization))
+	return []eventsourcing.Event{&ProcessingChangedEvent{
+		EventType:         "audioinput_ProcessingChanged",
+		NoiseSuppression:  noiseSuppression,
+		GainNormalization: gainNormalization,
+		Timestamp:         eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// ownerOnly refuses commands of household members, the microphone is the owner's
+func ownerOnly(data map[string]interface{}) error {
+	if eventsourcing.UserOf(data) != "" {
+		return fmt.Errorf("only the owner configures the microphone")
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Package audioinput manages the microphone speech is captured from and how its audio is cleaned
+// up before transcription: listing and selecting input devices, noise suppression and gain
+// normalization.
+package audioinput
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Device is a microphone capture can be started on
+type Device struct {
+	Name        string `json:"name"` // ffmpeg input, e.g. "pulse:alsa_input.usb-mic"
+	Description string `json:"description"`
+	Default     bool   `json:"default,omitempty"` // The system's default device of its kind
+}
+
+// DeviceSelectedEvent is emitted when capture switched to another device; an empty device goes
+// back to the configured ones
+type DeviceSelectedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Device    string `json:"device"`
+	Previous  string `json:"previous,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *DeviceSelectedEvent) Type() string { return "audioinput_DeviceSelected" }
+func (e *DeviceSelectedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *DeviceSelectedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ProcessingChangedEvent is emitted when noise suppression or gain normalization was turned on or off
+type ProcessingChangedEvent struct {
+	eventsourcing.EventMetadata
+	EventType         string `json:"event_type"`
+	NoiseSuppression  bool   `json:"noise_suppression"`
+	GainNormalization bool   `json:"gain_normalization"`
+	Timestamp         string `json:"timestamp"`
+}
+
+func (e *ProcessingChangedEvent) Type() string { return "audioinput_ProcessingChanged" }
+func (e *ProcessingChangedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ProcessingChangedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// DevicesListedEvent answers a ListAudioDevices command with the devices and the current settings
+type DevicesListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType         string   `json:"event_type"`
+	Devices           []Device `json:"devices"`
+	Selected          string   `json:"selected"`
+	NoiseSuppression  bool     `json:"noise_suppression"`
+	GainNormalization bool     `json:"gain_normalization"`
+	Timestamp         string   `json:"timestamp"`
+}
+
+func (e *DevicesListedEvent) Type() string { return "audioinput_DevicesListed" }
+func (e *DevicesListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *DevicesListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("audioinput_DeviceSelected", func() eventsourcing.Event { return &DeviceSelectedEvent{} })
+	eventsourcing.RegisterEvent("audioinput_ProcessingChanged", func() eventsourcing.Event { return &ProcessingChangedEvent{} })
+	eventsourcing.RegisterEvent("audioinput_DevicesListed", func() eventsourcing.Event { return &DevicesListedEvent{} })
+	eventsourcing.RegisterTransientEvent("audioinput_DevicesListed")
+}
+
+// SettingsAggregate tracks the selected device, the processing of its audio and the devices last listed
+type SettingsAggregate struct {
+	Device            string
+	NoiseSuppression  bool
+	GainNormalization bool
+	Devices           []Device
+	Mu                sync.RWMutex
+}
+
+// NewSettingsAggregate creates a SettingsAggregate capturing from the configured devices without processing
+func NewSettingsAggregate() *SettingsAggregate {
+	return &SettingsAggregate{}
+}
+
+// ID returns the aggregate's identifier
+func (a *SettingsAggregate) ID() string {
+	return "audioinput"
+}
+
+// ApplyEvent updates the settings
+func (a *SettingsAggregate) ApplyEvent(event eventsourcing.Event) error {
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	switch e := event.(type) {
+	case *DeviceSelectedEvent:
+		a.Device = e.Device
+	case *ProcessingChangedEvent:
+		a.NoiseSuppression = e.NoiseSuppression
+		a.GainNormalization = e.GainNormalization
+	case *DevicesListedEvent:
+		a.Devices = e.Devices
+	}
+	return nil
+}
+
+// SelectedDevice returns the device selected last, empty when capturing from the configured devices
+func (a *SettingsAggregate) SelectedDevice() string {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return a.Device
+}
+
+// Processing returns whether noise suppression and gain normalization are on
+func (a *SettingsAggregate) Processing() (noiseSuppression, gainNormalization bool) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return a.NoiseSuppression, a.GainNormalization
+}
+
+// GetCustomUI shows the selected device, the processing and the devices last listed
+func (a *SettingsAggregate) GetCustomUI() fyne.CanvasObject {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	device := a.Device
+	if device == "" {
+		device = "configured devices"
+	}
+	items := container.NewVBox(
+		widget.NewLabel("Microphone: "+device),
+		widget.NewLabel(fmt.Sprintf("Noise suppression: %s, gain normalization: %s", onOff(a.NoiseSuppression), onOff(a.GainNormalization))),
+	)
+	for _, d := range a.Devices {
+		items.Add(widget.NewLabel(fmt.Sprintf("%s - %s", d.Name, d.Description)))
+	}
+	return container.NewVScroll(items)
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,101 @@
+package audioinput
+
+import (
+	"errors"
+	"testing"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Mock implementations for testing
+
+type mockBackend struct {
+	devices           []Device
+	selected          string
+	noiseSuppression  bool
+	gainNormalization bool
+	failWith          error
+}
+
+func (b *mockBackend) ListInputDevices() []Device { return b.devices }
+
+func (b *mockBackend) SelectInputDevice(device string) error {
+	if b.failWith != nil {
+		return b.failWith
+	}
+	b.selected = device
+	return nil
+}
+
+func (b *mockBackend) SetPreprocessing(noiseSuppression, gainNormalization bool) {
+	b.noiseSuppression, b.gainNormalization = noiseSuppression, gainNormalization
+}
+
+// execute runs the command and applies its events to the settings
+func execute(t *testing.T, settings *SettingsAggregate, command func(map[string]interface{}) ([]eventsourcing.Event, error), data map[string]interface{}) []eventsourcing.Event {
+	t.Helper()
+	events, err := command(data)
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	for _, event := range events {
+		settings.ApplyEvent(event)
+	}
+	return events
+}
+
+func TestManager_SelectDevice(t *testing.T) {
+	backend := &mockBackend{devices: []Device{{Name: "pulse:usb-mic", Description: "USB microphone"}, {Name: "pulse:default", Default: true}}}
+	settings := NewSettingsAggregate()
+	manager := NewManager(backend, settings)
+
+	events := execute(t, settings, manager.ListDevicesCommand, map[string]interface{}{})
+	if listed := events[0].(*DevicesListedEvent); len(listed.Devices) != 2 || listed.Selected != "" {
+		t.Errorf("Expected both devices listed without a selection, got %+v", listed)
+	}
+
+	execute(t, settings, manager.SelectDeviceCommand, map[string]interface{}{"device": "pulse:usb-mic"})
+	if backend.selected != "pulse:usb-mic" || settings.SelectedDevice() != "pulse:usb-mic" {
+		t.Errorf("Expected the USB microphone selected, got %q and %q", backend.selected, settings.SelectedDevice())
+	}
+	if events := execute(t, settings, manager.SelectDeviceCommand, map[string]interface{}{"device": "pulse:usb-mic"}); len(events) != 0 {
+		t.Errorf("Expected no event selecting the selected device, got %d", len(events))
+	}
+	if _, err := manager.SelectDeviceCommand(map[string]interface{}{}); err == nil {
+		t.Error("Expected an error selecting without a device")
+	}
+
+	backend.failWith = errors.New("no such device")
+	if _, err := manager.SelectDeviceCommand(map[string]interface{}{"device": "hw:9,0"}); err == nil {
+		t.Error("Expected an error selecting a device that can't be opened")
+	}
+	if settings.SelectedDevice() != "pulse:usb-mic" {
+		t.Errorf("Expected the selection kept after a failure, got %q", settings.SelectedDevice())
+	}
+}
+
+func TestManager_SetProcessing(t *testing.T) {
+	backend := &mockBackend{}
+	settings := NewSettingsAggregate()
+	manager := NewManager(backend, settings)
+
+	execute(t, settings, manager.SetProcessingCommand, map[string]interface{}{"noise_suppression": true})
+	execute(t, settings, manager.SetProcessingCommand, map[string]interface{}{"gain_normalization": true})
+	if !backend.noiseSuppression || !backend.gainNormalization {
+		t.Errorf("Expected both stages on, got %+v", backend)
+	}
+	execute(t, settings, manager.SetProcessingCommand, map[string]interface{}{"noise_suppression": false})
+	if noise, gain := settings.Processing(); noise || !gain {
+		t.Errorf("Expected only gain normalization on, got %v, %v", noise, gain)
+	}
+	if _, err := manager.SetProcessingCommand(map[string]interface{}{"gain_normalization": "yes"}); err == nil {
+		t.Error("Expected an error for a setting that is not a boolean")
+	}
+
+	// The settings restored on start reach a new backend
+	restored := &mockBackend{}
+	NewManager(restored, settings).Restore()
+	if restored.noiseSuppression || !restored.gainNormalization {
+		t.Errorf("Expected the restored settings applied, got %+v", restored)
+	}
+}
@@ -0,0 +1,343 @@
+// Package audit keeps a trail of what every event changed in the state of its aggregate, and why:
+// the request, agent and command the event came from. The changes are stored next to the event log
+// as they happen; why they happened is derived from the orchestration events again at every start.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/internal/orchestration"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// recentEvents is how many of the latest events a completed tool call is matched against to find the
+// events it produced, which are published right before it
+const recentEvents = 256
+
+// Cause is why an event happened: the request and the tool call it came from. Events of commands
+// executed directly, e.g. from the desktop app, have no request.
+type Cause struct {
+	RequestID  string `json:"request_id,omitempty"`
+	Request    string `json:"request,omitempty"` // What the user asked
+	Agent      string `json:"agent,omitempty"`
+	Command    string `json:"command,omitempty"`
+	ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// String describes the cause on a single line
+func (c Cause) String() string {
+	if c.RequestID == "" {
+		return "not part of a request"
+	}
+	text := fmt.Sprintf("request %s", c.RequestID)
+	if c.Request != "" {
+		text = fmt.Sprintf("%q (%s)", c.Request, c.RequestID)
+	}
+	if c.Agent != "" {
+		text += " by " + c.Agent
+	}
+	if c.Command != "" {
+		text += " calling " + c.Command
+	}
+	return text
+}
+
+// Entry is what an event changed in its aggregate and why
+type Entry struct {
+	Sequence  int64         `json:"sequence"`
+	Timestamp time.Time     `json:"timestamp"`
+	EventType string        `json:"event_type"`
+	Aggregate string        `json:"aggregate"` // Stream of the event, e.g. alice/taskmanager
+	UserID    string        `json:"user_id,omitempty"`
+	Changes   []FieldChange `json:"changes"`
+	Cause     Cause         `json:"cause"`
+}
+
+// Filter selects entries of the trail, the zero Filter selects the owner's latest entries
+type Filter struct {
+	Aggregate string // Aggregate the events belong to, e.g. taskmanager
+	RequestID string
+	UserID    string // User the events happened for, empty for the owner
+	AllUsers  bool   // Ignores UserID, selecting the entries of everyone
+	Before    int64  // Only entries of events before this sequence, to page back in history
+	Limit     int    // Most recent entries returned, 0 for all
+}
+
+// Matches reports whether an entry passes the filter
+func (f Filter) Matches(entry Entry) bool {
+	if f.Aggregate != "" && eventsourcing.AggregateOf(entry.EventType) != f.Aggregate {
+		return false
+	}
+	if f.RequestID != "" && entry.Cause.RequestID != f.RequestID {
+		return false
+	}
+	if !f.AllUsers && entry.UserID != f.UserID {
+		return false
+	}
+	return f.Before == 0 || entry.Sequence < f.Before
+}
+
+// recentEvent is an event that may turn out to be the result of a tool call
+type recentEvent struct {
+	sequence int64
+	key      string
+}
+
+// Trail records the changes events make and finds out what caused them. Register it as aggregate so
+// it sees the orchestration events, and as ChangeRecorder of the event bus.
+type Trail struct {
+	store   eventsourcing.ChangeStore
+	entries []Entry         // Ordered by sequence
+	causes  map[int64]Cause // By event sequence
+
+	requests     map[string]string // Request ID -> what the user asked
+	requestAgent map[string]string // Request ID -> agent the request was routed to
+	toolAgents   map[string]string // Tool call ID -> agent, when several agents work on a request
+	recent       []recentEvent
+	mu           sync.RWMutex
+}
+
+// NewTrail creates a trail storing the changes in the store, starting with those stored before
+func NewTrail(store eventsourcing.ChangeStore) (*Trail, error) {
+	t := &Trail{
+		store:        store,
+		causes:       make(map[int64]Cause),
+		requests:     make(map[string]string),
+		requestAgent: make(map[string]string),
+		toolAgents:   make(map[string]string),
+	}
+	stored, err := store.LoadChanges()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the audit trail: %v", err)
+	}
+	for _, s := range stored {
+		var changes []FieldChange
+		if err := json.Unmarshal(s.Diff, &changes); err != nil {
+			logging.Error("Skipping the unreadable change of event %d: %v", s.Sequence, err)
+			continue
+		}
+		t.entries = append(t.entries, Entry{
+			Sequence:  s.Sequence,
+			Timestamp: s.Timestamp,
+			EventType: s.EventType,
+			Aggregate: s.Stream,
+			UserID:    s.UserID,
+			Changes:   changes,
+		})
+	}
+	return t, nil
+}
+
+// ID returns the aggregate's identifier
+func (t *Trail) ID() string {
+	return "audit"
+}
+
+// RecordChange stores what an event changed in its aggregate
+func (t *Trail) RecordChange(change eventsourcing.Change) {
+	changes, err := Diff(change.Before, change.After)
+	if err != nil {
+		logging.Error("Failed to compare the state of %s: %v", change.Event.Type(), err)
+		return
+	}
+	if len(changes) == 0 {
+		return
+	}
+	meta := change.Event.Metadata()
+	entry := Entry{
+		Sequence:  meta.Sequence,
+		Timestamp: time.Now().UTC(),
+		EventType: change.Event.Type(),
+		Aggregate: meta.Aggregate,
+		UserID:    meta.UserID,
+		Changes:   changes,
+	}
+	diff, err := json.Marshal(changes)
+	if err != nil {
+		logging.Error("Failed to record the change of %s: %v", entry.EventType, err)
+		return
+	}
+	err = t.store.SaveChange(eventsourcing.StoredChange{
+		Sequence:  entry.Sequence,
+		Stream:    entry.Aggregate,
+		EventType: entry.EventType,
+		UserID:    entry.UserID,
+		Diff:      diff,
+		Timestamp: entry.Timestamp,
+	})
+	if err != nil {
+		logging.Error("Failed to store the change of %s: %v", entry.EventType, err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = append(t.entries, entry)
+}
+
+// ApplyEvent follows requests and tool calls, to tell which request the events of a tool call belong to
+func (t *Trail) ApplyEvent(event eventsourcing.Event) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch e := event.(type) {
+	case *orchestration.UserRequestReceivedEvent:
+		t.requests[e.RequestID] = e.RequestText
+	case *orchestration.AgentCallDecidedEvent:
+		if e.CallAgent {
+			t.requestAgent[e.RequestID] = e.AgentName
+		}
+	case *orchestration.ToolCallRequestPlaced:
+		if e.AgentName != "" {
+			t.toolAgents[e.ToolCallID] = e.AgentName
+		}
+	case *orchestration.ToolCallCompleted:
+		t.attribute(e)
+	default:
+		if event.Metadata().Sequence > 0 && eventsourcing.AggregateOf(event.Type()) != "orchestration" {
+			t.remember(event)
+		}
+	}
+	return nil
+}
+
+// remember keeps an event among the recent ones a tool call completed later may have produced
+func (t *Trail) remember(event eventsourcing.Event) {
+	data, err := event.Marshal()
+	if err != nil {
+		return
+	}
+	t.recent = append(t.recent, recentEvent{sequence: event.Metadata().Sequence, key: key(event.Type(), data)})
+	if len(t.recent) > recentEvents {
+		t.recent = t.recent[len(t.recent)-recentEvents:]
+	}
+}
+
+// attribute records the completed tool call as cause of the events it produced. Those are found
+// among the recent events by their content, as the tool call's results hold them without sequence.
+func (t *Trail) attribute(call *orchestration.ToolCallCompleted) {
+	agent := t.toolAgents[call.ToolCallID]
+	if agent == "" {
+		agent = t.requestAgent[call.RequestID]
+	}
+	delete(t.toolAgents, call.ToolCallID)
+	cause := Cause{
+		RequestID:  call.RequestID,
+		Request:    t.requests[call.RequestID],
+		Agent:      agent,
+		Command:    call.Function,
+		ToolCallID: call.ToolCallID,
+	}
+	for _, result := range resultKeys(call.Results["result"]) {
+		for i := len(t.recent) - 1; i >= 0; i-- {
+			if t.recent[i].key == result {
+				t.causes[t.recent[i].sequence] = cause
+				t.recent = append(t.recent[:i], t.recent[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// resultKeys returns the keys of the events a tool call produced. Results of tool calls completed
+// since starting hold the events, results restored from the event store hold them as JSON objects.
+func resultKeys(result interface{}) []string {
+	var keys []string
+	switch events := result.(type) {
+	case []eventsourcing.Event:
+		for _, event := range events {
+			if data, err := event.Marshal(); err == nil {
+				keys = append(keys, key(event.Type(), data))
+			}
+		}
+	case []interface{}:
+		for _, raw := range events {
+			data, err := json.Marshal(raw)
+			if err != nil {
+				continue
+			}
+			eventType, _ := raw.(map[string]interface{})["event_type"].(string)
+			keys = append(keys, key(eventType, data))
+		}
+	}
+	return keys
+}
+
+// key identifies an event by its type and content, the same whether the JSON came from the event or
+// from a decoded copy with its fields in another order
+func key(eventType string, data []byte) string {
+	var content interface{}
+	if err := json.Unmarshal(data, &content); err != nil {
+		return eventType + "\x00" + string(data)
+	}
+	canonical, _ := json.Marshal(content) // Objects are encoded with sorted keys
+	return eventType + "\x00" + string(canonical)
+}
+
+// Entries returns the entries passing the filter, most recent first
+func (t *Trail) Entries(filter Filter) []Entry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var entries []Entry
+	for i := len(t.entries) - 1; i >= 0; i-- {
+		entry := t.entries[i]
+		entry.Cause = t.causes[entry.Sequence]
+		if !filter.Matches(entry) {
+			continue
+		}
+		entries = append(entries, entry)
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+	}
+	return entries
+}
+
+// Entry returns the entry of the event with the sequence
+func (t *Trail) Entry(sequence int64) (Entry, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	i := sort.Search(len(t.entries), func(i int) bool { return t.entries[i].Sequence >= sequence })
+	if i == len(t.entries) || t.entries[i].Sequence != sequence {
+		return Entry{}, false
+	}
+	entry := t.entries[i]
+	entry.Cause = t.causes[sequence]
+	return entry, true
+}
+
+// Describe shows an entry as text: the event, why it happened and the values it changed
+func Describe(entry Entry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#%d %s %s (%s)\n", entry.Sequence, entry.Timestamp.Local().Format("2006-01-02 15:04:05"), entry.EventType, entry.Aggregate)
+	fmt.Fprintf(&b, "Why: %s\n", entry.Cause)
+	for _, change := range entry.Changes {
+		fmt.Fprintf(&b, "  %s\n", change)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// GetCustomUI lists the latest changes, with what changed and why
+func (t *Trail) GetCustomUI() fyne.CanvasObject {
+	items := container.NewVBox()
+	entries := t.Entries(Filter{AllUsers: true, Limit: 100})
+	if len(entries) == 0 {
+		items.Add(widget.NewLabel("Nothing changed yet"))
+	}
+	for _, entry := range entries {
+		label := widget.NewLabel(Describe(entry))
+		label.Wrapping = fyne.TextWrapWord
+		items.Add(label)
+		items.Add(widget.NewSeparator())
+	}
+	return container.NewVScroll(items)
+}
@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"fyne.io/fyne/v2"
+
+	"mindpalace/internal/orchestration"
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Mock implementations for testing
+
+type noteAddedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	NoteID    string `json:"note_id"`
+	Text      string `json:"text"`
+}
+
+func (e *noteAddedEvent) Type() string { return "notes_NoteAdded" }
+func (e *noteAddedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *noteAddedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("notes_NoteAdded", func() eventsourcing.Event { return &noteAddedEvent{} })
+}
+
+type notesAggregate struct {
+	Notes map[string]string `json:"notes"`
+}
+
+func (a *notesAggregate) ID() string { return "notes" }
+func (a *notesAggregate) ApplyEvent(event eventsourcing.Event) error {
+	if e, ok := event.(*noteAddedEvent); ok {
+		a.Notes[e.NoteID] = e.Text
+	}
+	return nil
+}
+func (a *notesAggregate) GetCustomUI() fyne.CanvasObject { return nil }
+func (a *notesAggregate) SaveSnapshot() ([]byte, error)  { return json.Marshal(a) }
+func (a *notesAggregate) LoadSnapshot(data []byte) error { return json.Unmarshal(data, a) }
+
+type aggregates []eventsourcing.Aggregate
+
+func (a aggregates) AllAggregates() []eventsourcing.Aggregate { return a }
+
+func TestDiff(t *testing.T) {
+	before := `{"tasks":{"t1":{"status":"Pending","title":"Groceries","tags":["home"]},"t2":{"title":"Old"}}}`
+	after := `{"tasks":{"t1":{"status":"Completed","title":"Groceries","tags":["home","weekly"]},"t3":{"title":"New"}}}`
+	changes, err := Diff([]byte(before), []byte(after))
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	want := []string{
+		`tasks.t1.status: "Pending" → "Completed"`,
+		`tasks.t1.tags[1]: added "weekly"`,
+		`tasks.t2: removed {"title":"Old"}`,
+		`tasks.t3: added {"title":"New"}`,
+	}
+	var got []string
+	for _, change := range changes {
+		got = append(got, change.String())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	if _, err := Diff([]byte("{"), []byte("{}")); err == nil {
+		t.Error("Expected an error for an invalid state")
+	}
+}
+
+func TestTrail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	store, err := eventsourcing.NewSQLiteEventStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	trail, err := NewTrail(store)
+	if err != nil {
+		t.Fatalf("NewTrail failed: %v", err)
+	}
+	notes := &notesAggregate{Notes: map[string]string{}}
+	eb := eventsourcing.NewSimpleEventBus(store, aggregates{notes, trail}, make(chan eventsourcing.DeltaEnvelope, 10))
+	eb.SetChangeRecorder(trail)
+
+	// A request adds a note through a tool call, then a note is added directly
+	note := &noteAddedEvent{NoteID: "n1", Text: "Buy milk"}
+	for _, event := range []eventsourcing.Event{
+		&orchestration.UserRequestReceivedEvent{RequestID: "req1", RequestText: "note to buy milk"},
+		&orchestration.AgentCallDecidedEvent{RequestID: "req1", AgentName: "notes", CallAgent: true},
+		&orchestration.ToolCallStarted{RequestID: "req1", ToolCallID: "req1-toolrequest-0", Function: "AddNote"},
+		note,
+		&orchestration.ToolCallCompleted{RequestID: "req1", ToolCallID: "req1-toolrequest-0", Function: "AddNote",
+			Results: map[string]interface{}{"success": true, "result": []eventsourcing.Event{note}}},
+		&noteAddedEvent{NoteID: "n2", Text: "Call mom"},
+	} {
+		eb.Publish(event)
+	}
+
+	check := func(trail *Trail) {
+		t.Helper()
+		entries := trail.Entries(Filter{})
+		if len(entries) != 2 {
+			t.Fatalf("Expected 2 entries, got %d", len(entries))
+		}
+		if entries[0].Cause.RequestID != "" || entries[0].Changes[0].String() != `notes.n2: added "Call mom"` {
+			t.Errorf("Expected the direct note without a request, got %s", Describe(entries[0]))
+		}
+		want := Cause{RequestID: "req1", Request: "note to buy milk", Agent: "notes", Command: "AddNote", ToolCallID: "req1-toolrequest-0"}
+		if entries[1].Cause != want || entries[1].Aggregate != "notes" {
+			t.Errorf("Expected the note of the request, got %s", Describe(entries[1]))
+		}
+		if entry, ok := trail.Entry(entries[1].Sequence); !ok || entry.Cause != want {
+			t.Errorf("Expected the entry by its sequence, got %+v", entry)
+		}
+		if filtered := trail.Entries(Filter{RequestID: "req1"}); len(filtered) != 1 {
+			t.Errorf("Expected one entry of req1, got %d", len(filtered))
+		}
+		if filtered := trail.Entries(Filter{Before: entries[1].Sequence}); len(filtered) != 0 {
+			t.Errorf("Expected no entries before the first, got %d", len(filtered))
+		}
+	}
+	check(trail)
+	store.Close()
+
+	// After a restart the changes are loaded and their causes found again in the events
+	store, err = eventsourcing.NewSQLiteEventStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	defer store.Close()
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	restarted, err := NewTrail(store)
+	if err != nil {
+		t.Fatalf("NewTrail failed: %v", err)
+	}
+	for _, event := range store.GetEvents() {
+		restarted.ApplyEvent(event)
+	}
+	check(restarted)
+}
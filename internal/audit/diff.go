@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// FieldChange is a value an event changed in the state of an aggregate. A value the event added
+// has no Before, a value it removed has no After.
+type FieldChange struct {
+	Path   string      `json:"path"` // Where the value is in the state, e.g. tasks.task_1.status
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// Kind describes the change as added, removed or changed
+func (c FieldChange) Kind() string {
+	switch {
+	case c.Before == nil:
+		return "added"
+	case c.After == nil:
+		return "removed"
+	}
+	return "changed"
+}
+
+// String describes the change on a single line
+func (c FieldChange) String() string {
+	switch c.Kind() {
+	case "added":
+		return fmt.Sprintf("%s: added %s", c.Path, format(c.After))
+	case "removed":
+		return fmt.Sprintf("%s: removed %s", c.Path, format(c.Before))
+	}
+	return fmt.Sprintf("%s: %s → %s", c.Path, format(c.Before), format(c.After))
+}
+
+// Diff compares two JSON serializations of an aggregate's state and returns the values that differ,
+// sorted by path. Objects are compared key by key and lists item by item, so changing one field of
+// a task reports that field rather than the whole task.
+func Diff(before, after []byte) ([]FieldChange, error) {
+	var was, is interface{}
+	if len(before) > 0 {
+		if err := json.Unmarshal(before, &was); err != nil {
+			return nil, fmt.Errorf("failed to read the state before: %v", err)
+		}
+	}
+	if len(after) > 0 {
+		if err := json.Unmarshal(after, &is); err != nil {
+			return nil, fmt.Errorf("failed to read the state after: %v", err)
+		}
+	}
+	var changes []FieldChange
+	diff("", was, is, &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+func diff(path string, was, is interface{}, changes *[]FieldChange) {
+	switch o := was.(type) {
+	case map[string]interface{}:
+		if n, ok := is.(map[string]interface{}); ok {
+			for key, value := range o {
+				diff(join(path, key), value, n[key], changes)
+			}
+			for key, value := range n {
+				if _, exists := o[key]; !exists {
+					diff(join(path, key), nil, value, changes)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if n, ok := is.([]interface{}); ok {
+			for i := 0; i < len(o) || i < len(n); i++ {
+				var oldItem, newItem interface{}
+				if i < len(o) {
+					oldItem = o[i]
+				}
+				if i < len(n) {
+					newItem = n[i]
+				}
+				diff(fmt.Sprintf("%s[%d]", path, i), oldItem, newItem, changes)
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(was, is) {
+		*changes = append(*changes, FieldChange{Path: path, Before: was, After: is})
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// format shows a value as JSON, shortened so a long text doesn't take over the view
+func format(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	text := string(data)
+	if len(text) > 80 {
+		text = strings.TrimSpace(text[:77]) + "..."
+	}
+	return text
+}
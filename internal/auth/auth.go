@@ -0,0 +1,146 @@
+// Package auth authenticates the clients of the HTTP API and of the 3D client WebSocket once the
+// household members sharing MindPalace are configured. Without users anyone who can reach the
+// server acts as the owner, like before there were users.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CookieName is the cookie the browser chat keeps the token in after opening it with ?token=
+const CookieName = "mindpalace_token"
+
+// Users authenticates clients by the token of a configured user
+type Users struct {
+	mu         sync.RWMutex
+	tokens     map[string]string // Token -> user
+	ownerToken string            // Token of the owner's own clients, e.g. the 3D client started with MindPalace
+}
+
+// NewUsers creates users from tokens, see SetTokens
+func NewUsers(tokens map[string]string) *Users {
+	u := &Users{}
+	u.SetTokens(tokens)
+	return u
+}
+
+// SetTokens replaces the users by their token, e.g. when the configuration is reloaded
+func (u *Users) SetTokens(tokens map[string]string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.tokens = make(map[string]string, len(tokens))
+	for token, userID := range tokens {
+		u.tokens[token] = userID
+	}
+}
+
+// SetOwnerToken lets clients authenticate as the owner with the token
+func (u *Users) SetOwnerToken(token string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.ownerToken = token
+}
+
+// Enabled reports whether users are configured, and clients must authenticate
+func (u *Users) Enabled() bool {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return len(u.tokens) > 0
+}
+
+// Authenticate returns the user of the token; the owner is the empty user. Without users
+// configured every client is the owner.
+func (u *Users) Authenticate(token string) (userID string, ok bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	if len(u.tokens) == 0 {
+		return "", true
+	}
+	if token == "" {
+		return "", false
+	}
+	// Compare against every token, so the time taken doesn't tell how close a guess was
+	for candidate, user := range u.tokens {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			userID, ok = user, true
+		}
+	}
+	if u.ownerToken != "" && subtle.ConstantTimeCompare([]byte(u.ownerToken), []byte(token)) == 1 {
+		userID, ok = "", true
+	}
+	return userID, ok
+}
+
+// AuthenticateRequest returns the user of the token the request carries: in an
+// "Authorization: Bearer" header, a token query parameter or the browser chat's cookie
+func (u *Users) AuthenticateRequest(r *http.Request) (userID string, ok bool) {
+	return u.Authenticate(RequestToken(r))
+}
+
+// RequestToken returns the token a request carries, empty if it has none
+func RequestToken(r *http.Request) string {
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return strings.TrimSpace(token)
+	}
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie(CookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// Middleware rejects requests without a valid token, and passes the user of the others on in their
+// context. A token given as query parameter is kept in a cookie, so the browser chat opened with
+// ?token= sends it along with its later requests.
+func (u *Users) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := u.AuthenticateRequest(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mindpalace"`)
+			http.Error(w, "a valid token is required", http.StatusUnauthorized)
+			return
+		}
+		if token := r.URL.Query().Get("token"); token != "" && u.Enabled() {
+			http.SetCookie(w, &http.Cookie{
+				Name:     CookieName,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+				MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+			})
+		}
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), userID)))
+	})
+}
+
+type userKey struct{}
+
+// WithUser returns a context carrying the user a request is made by
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+// UserOf returns the user of the context, the owner if it carries none
+func UserOf(ctx context.Context) string {
+	userID, _ := ctx.Value(userKey{}).(string)
+	return userID
+}
+
+// NewToken returns a random token, e.g. for the owner's own clients
+func NewToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand doesn't fail on supported platforms
+	}
+	return hex.EncodeToString(b)
+}
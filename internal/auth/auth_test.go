@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	users := NewUsers(nil)
+	if userID, ok := users.Authenticate(""); !ok || userID != "" {
+		t.Errorf("Expected everyone to be the owner without users, got %q, %v", userID, ok)
+	}
+
+	users.SetTokens(map[string]string{"alice-token": "alice"})
+	users.SetOwnerToken("owner-token")
+	for token, want := range map[string]string{"alice-token": "alice", "owner-token": ""} {
+		if userID, ok := users.Authenticate(token); !ok || userID != want {
+			t.Errorf("Authenticate(%q) = %q, %v, want %q", token, userID, ok, want)
+		}
+	}
+	for _, token := range []string{"", "alice", "bob-token"} {
+		if _, ok := users.Authenticate(token); ok {
+			t.Errorf("Expected %q to be refused", token)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	users := NewUsers(map[string]string{"alice-token": "alice"})
+	handler := users.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("user " + UserOf(r.Context())))
+	}))
+
+	tests := []struct {
+		name   string
+		modify func(r *http.Request)
+		status int
+	}{
+		{"no token", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"wrong token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer bob-token") }, http.StatusUnauthorized},
+		{"bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer alice-token") }, http.StatusOK},
+		{"cookie", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: CookieName, Value: "alice-token"}) }, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/events", nil)
+		tt.modify(r)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, w.Code)
+		}
+		if tt.status == http.StatusOK && w.Body.String() != "user alice" {
+			t.Errorf("%s: expected the request to be alice's, got %q", tt.name, w.Body.String())
+		}
+	}
+
+	// The browser chat is opened with the token in the URL, later requests send the cookie
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/?token=alice-token", nil))
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusOK || len(cookies) != 1 || cookies[0].Value != "alice-token" || !cookies[0].HttpOnly {
+		t.Errorf("Expected the token kept in a cookie, got %d with %v", w.Code, cookies)
+	}
+}
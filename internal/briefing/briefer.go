@@ -0,0 +1,195 @@
+package briefing
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mindpalace/pkg/cron"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// maxDelay is how late a briefing is still delivered, e.g. when MindPalace was down at the time. A morning
+// briefing in the afternoon is of little use.
+const maxDelay = 2 * time.Hour
+
+// AggregateSource gives the briefer the aggregates each user sees
+type AggregateSource interface {
+	AggregatesOf(userID string) []eventsourcing.Aggregate
+}
+
+// Settings configure the briefing of a user
+type Settings struct {
+	Schedule *cron.Schedule // When the briefing is delivered, on the clock of Location
+	Spoken   bool           // Whether the briefing is read aloud as well
+	Location *time.Location // The user's time zone, the local time if nil
+}
+
+// Briefer composes the briefing of each user with a schedule when it is due, from the items of the
+// BriefingProvider aggregates the user sees, and publishes it as a BriefingDeliveredEvent
+type Briefer struct {
+	aggregates AggregateSource
+	briefings  *BriefingAggregate
+	eventBus   eventsourcing.EventBus
+	generate   func(userID string) eventsourcing.GenerateFunc // Nil to list the items without the LLM
+	settings   map[string]Settings                            // User -> the user's settings
+	mu         sync.Mutex
+	interval   time.Duration
+	stop       chan struct{}
+}
+
+// NewBriefer creates a briefer having the LLM write the briefings with the generate function of the user
+func NewBriefer(aggregates AggregateSource, briefings *BriefingAggregate, eventBus eventsourcing.EventBus, generate func(userID string) eventsourcing.GenerateFunc) *Briefer {
+	return &Briefer{
+		aggregates: aggregates,
+		briefings:  briefings,
+		eventBus:   eventBus,
+		generate:   generate,
+		settings:   make(map[string]Settings),
+		interval:   time.Minute,
+		stop:       make(chan struct{}),
+	}
+}
+
+// Configure replaces the settings of all users, users left out get no briefing
+func (b *Briefer) Configure(settings map[string]Settings) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.settings = maps.Clone(settings)
+}
+
+// Start checks for due briefings every minute until Stop is called
+func (b *Briefer) Start() {
+	logging.Info("Starting the morning briefings")
+	ticker := time.NewTicker(b.interval)
+	go func() {
+		defer ticker.Stop()
+		b.Check(time.Now())
+		for {
+			select {
+			case <-b.stop:
+				return
+			case now := <-ticker.C:
+				b.Check(now)
+			}
+		}
+	}()
+}
+
+// Stop ends the periodic checks
+func (b *Briefer) Stop() {
+	close(b.stop)
+}
+
+// Check delivers the briefings due at the given time and returns how many were delivered. Of the runs of a
+// schedule within maxDelay only the last is delivered.
+func (b *Briefer) Check(now time.Time) int {
+	b.mu.Lock()
+	settings := maps.Clone(b.settings)
+	b.mu.Unlock()
+	delivered := 0
+	for userID, s := range settings {
+		if s.Schedule == nil {
+			continue
+		}
+		loc := s.Location
+		if loc == nil {
+			loc = time.Local
+		}
+		due := lastRun(s.Schedule, now.In(loc))
+		if due.IsZero() {
+			continue
+		}
+		briefingID := fmt.Sprintf("%s_%s", eventsourcing.SnapshotID(userID, "briefing"), due.UTC().Format(time.RFC3339))
+		if b.briefings.Delivered(briefingID) {
+			continue
+		}
+		b.deliver(userID, briefingID, due, s.Spoken)
+		delivered++
+	}
+	return delivered
+}
+
+// lastRun returns the last run of the schedule up to now and no longer than maxDelay ago, zero if none
+func lastRun(schedule *cron.Schedule, now time.Time) time.Time {
+	var last time.Time
+	for run := schedule.Next(now.Add(-maxDelay - time.Minute)); !run.IsZero() && !run.After(now); run = schedule.Next(run) {
+		if now.Sub(run) <= maxDelay {
+			last = run
+		}
+	}
+	return last
+}
+
+// deliver composes the user's briefing of the day of due and publishes it
+func (b *Briefer) deliver(userID, briefingID string, due time.Time, spoken bool) {
+	day := time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, due.Location())
+	items := b.items(userID, day)
+	logging.Info("Briefing %s due with %d items", briefingID, len(items))
+	event := &BriefingDeliveredEvent{
+		BriefingID: briefingID,
+		Date:       day.Format(time.DateOnly),
+		Text:       b.compose(userID, day, items),
+		Items:      len(items),
+		Spoken:     spoken,
+		Timestamp:  eventsourcing.ISOTimestamp(),
+	}
+	event.Metadata().UserID = userID
+	b.eventBus.Publish(event)
+}
+
+// items collects what the user's aggregates have to say about the day, grouped by section
+func (b *Briefer) items(userID string, day time.Time) []eventsourcing.BriefingItem {
+	var items []eventsourcing.BriefingItem
+	for _, agg := range b.aggregates.AggregatesOf(userID) {
+		if provider, ok := agg.(eventsourcing.BriefingProvider); ok {
+			items = append(items, provider.BriefingItems(day)...)
+		}
+	}
+	// Providers keep their own order within a section
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Section < items[j].Section })
+	return items
+}
+
+// compose has the LLM write the briefing from the items, listing them when it can't
+func (b *Briefer) compose(userID string, day time.Time, items []eventsourcing.BriefingItem) string {
+	if len(items) == 0 {
+		return fmt.Sprintf("Good morning! Nothing is planned for %s: no meetings, no tasks due and no unread email.", day.Format("Monday January 2"))
+	}
+	list := listItems(day, items)
+	if b.generate == nil {
+		return list
+	}
+	generate := b.generate(userID)
+	if generate == nil {
+		return list
+	}
+	prompt := "Write a short, friendly morning briefing from the overview of the user's day below. Mention every " +
+		"meeting and task, summarize the email. Use plain sentences without markdown or lists, as the briefing " +
+		"may be read aloud. Answer with the briefing only.\n\n" + list
+	text, err := generate(prompt)
+	if err != nil || strings.TrimSpace(text) == "" {
+		logging.Error("Failed to write the briefing of %s, listing its items instead: %v", day.Format(time.DateOnly), err)
+		return list
+	}
+	return strings.TrimSpace(text)
+}
+
+// listItems lists the items by section
+func listItems(day time.Time, items []eventsourcing.BriefingItem) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Good morning! Here is your day, %s.", day.Format("Monday January 2"))
+	section := ""
+	for _, item := range items {
+		if item.Section != section {
+			section = item.Section
+			fmt.Fprintf(&sb, "\n\n%s:", section)
+		}
+		fmt.Fprintf(&sb, "\n- %s", item.Text)
+	}
+	return sb.String()
+}
@@ -0,0 +1,117 @@
+// Package briefing composes a briefing of the day ahead from the calendar, tasks and unread email, and
+// delivers it in the chat every morning at the time each user configured.
+package briefing
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// BriefingDeliveredEvent is emitted when a user's briefing was composed and shown in their chat
+type BriefingDeliveredEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string `json:"event_type"`
+	BriefingID string `json:"briefing_id"`
+	Date       string `json:"date"` // Day briefed on, like 2024-05-01
+	Text       string `json:"text"`
+	Items      int    `json:"items"` // Number of items the briefing is about
+	Spoken     bool   `json:"spoken,omitempty"`
+	Timestamp  string `json:"timestamp"`
+}
+
+func (e *BriefingDeliveredEvent) Type() string { return "briefing_BriefingDelivered" }
+func (e *BriefingDeliveredEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *BriefingDeliveredEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("briefing_BriefingDelivered", func() eventsourcing.Event { return &BriefingDeliveredEvent{} })
+}
+
+// Briefing is a briefing that has been delivered
+type Briefing struct {
+	BriefingID  string
+	UserID      string
+	Date        string
+	Text        string
+	DeliveredAt string
+}
+
+// BriefingAggregate remembers which briefings were delivered so none is repeated after a restart
+type BriefingAggregate struct {
+	Briefings map[string]*Briefing
+	Mu        sync.RWMutex
+}
+
+// NewBriefingAggregate creates an empty BriefingAggregate
+func NewBriefingAggregate() *BriefingAggregate {
+	return &BriefingAggregate{Briefings: make(map[string]*Briefing)}
+}
+
+// ID returns the aggregate's identifier
+func (a *BriefingAggregate) ID() string {
+	return "briefing"
+}
+
+// ApplyEvent records delivered briefings
+func (a *BriefingAggregate) ApplyEvent(event eventsourcing.Event) error {
+	e, ok := event.(*BriefingDeliveredEvent)
+	if !ok {
+		return nil
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	a.Briefings[e.BriefingID] = &Briefing{
+		BriefingID:  e.BriefingID,
+		UserID:      e.Metadata().UserID,
+		Date:        e.Date,
+		Text:        e.Text,
+		DeliveredAt: e.Timestamp,
+	}
+	return nil
+}
+
+// Delivered reports whether a briefing was already delivered
+func (a *BriefingAggregate) Delivered(briefingID string) bool {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	_, exists := a.Briefings[briefingID]
+	return exists
+}
+
+// Latest returns the last briefing delivered to a user, nil if there was none
+func (a *BriefingAggregate) Latest(userID string) *Briefing {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	var latest *Briefing
+	for _, b := range a.Briefings {
+		if b.UserID == userID && (latest == nil || b.DeliveredAt > latest.DeliveredAt) {
+			latest = b
+		}
+	}
+	return latest
+}
+
+// GetCustomUI shows the owner's last briefing
+func (a *BriefingAggregate) GetCustomUI() fyne.CanvasObject {
+	latest := a.Latest("")
+	if latest == nil {
+		return widget.NewLabel("No briefing delivered yet")
+	}
+	title := latest.Date
+	if day, err := time.Parse(time.DateOnly, latest.Date); err == nil {
+		title = day.Format("Monday January 2")
+	}
+	text := widget.NewLabel(latest.Text)
+	text.Wrapping = fyne.TextWrapWord
+	return container.NewVScroll(container.NewVBox(widget.NewLabelWithStyle(title, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}), text))
+}
@@ -0,0 +1,150 @@
+package briefing
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"mindpalace/pkg/cron"
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Mock implementations for testing
+
+type briefingAggregate struct {
+	id    string
+	items []eventsourcing.BriefingItem
+	days  []time.Time
+}
+
+func (a *briefingAggregate) ID() string                                 { return a.id }
+func (a *briefingAggregate) ApplyEvent(event eventsourcing.Event) error { return nil }
+func (a *briefingAggregate) GetCustomUI() fyne.CanvasObject             { return nil }
+func (a *briefingAggregate) BriefingItems(day time.Time) []eventsourcing.BriefingItem {
+	a.days = append(a.days, day)
+	return a.items
+}
+
+type userAggregates map[string][]eventsourcing.Aggregate
+
+func (a userAggregates) AggregatesOf(userID string) []eventsourcing.Aggregate { return a[userID] }
+
+// mockBus applies published events to the briefing aggregate like the real bus does
+type mockBus struct {
+	briefings *BriefingAggregate
+	published []*BriefingDeliveredEvent
+}
+
+func (b *mockBus) Publish(event eventsourcing.Event) {
+	b.briefings.ApplyEvent(event)
+	b.published = append(b.published, event.(*BriefingDeliveredEvent))
+}
+func (b *mockBus) Subscribe(eventType string, handler eventsourcing.EventHandler) {}
+func (b *mockBus) SubscribeAll(handler eventsourcing.EventHandler)                {}
+
+func mustParse(t *testing.T, spec string) *cron.Schedule {
+	t.Helper()
+	s, err := cron.Parse(spec)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", spec, err)
+	}
+	return s
+}
+
+func TestBriefer_Check(t *testing.T) {
+	calendar := &briefingAggregate{id: "calendar", items: []eventsourcing.BriefingItem{
+		{Section: "Calendar", Text: "Standup from 09:00 to 09:15"},
+	}}
+	tasks := &briefingAggregate{id: "taskmanager", items: []eventsourcing.BriefingItem{
+		{Section: "Tasks", Text: "Report, today, due at 17:00"},
+	}}
+	briefings := NewBriefingAggregate()
+	bus := &mockBus{briefings: briefings}
+	var prompts []string
+	briefer := NewBriefer(userAggregates{"": {tasks, calendar}}, briefings, bus, func(userID string) eventsourcing.GenerateFunc {
+		return func(prompt string) (string, error) {
+			prompts = append(prompts, prompt)
+			return "Good morning, a standup at nine and the report is due today.", nil
+		}
+	})
+	briefer.Configure(map[string]Settings{"": {Schedule: mustParse(t, "0 7 * * *"), Spoken: true, Location: time.UTC}})
+
+	if n := briefer.Check(time.Date(2024, 5, 1, 6, 59, 0, 0, time.UTC)); n != 0 {
+		t.Fatalf("Expected no briefing before 07:00, got %d", n)
+	}
+	if n := briefer.Check(time.Date(2024, 5, 1, 7, 0, 30, 0, time.UTC)); n != 1 {
+		t.Fatalf("Expected the briefing at 07:00, got %d", n)
+	}
+	if n := briefer.Check(time.Date(2024, 5, 1, 7, 1, 0, 0, time.UTC)); n != 0 {
+		t.Errorf("Expected the briefing delivered once, got %d more", n)
+	}
+	e := bus.published[0]
+	if e.Date != "2024-05-01" || e.Items != 2 || !e.Spoken || !strings.Contains(e.Text, "standup at nine") {
+		t.Errorf("Unexpected briefing %+v", e)
+	}
+	if !calendar.days[0].Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the items of the day asked for, got %v", calendar.days[0])
+	}
+	// The calendar is listed before the tasks whichever aggregate came first
+	if len(prompts) != 1 || strings.Index(prompts[0], "Standup") > strings.Index(prompts[0], "Report") {
+		t.Errorf("Expected the items in the prompt by section, got %q", prompts)
+	}
+	if latest := briefings.Latest(""); latest == nil || latest.Text != e.Text {
+		t.Errorf("Expected the briefing remembered, got %+v", latest)
+	}
+}
+
+func TestBriefer_LateAndMissed(t *testing.T) {
+	briefings := NewBriefingAggregate()
+	bus := &mockBus{briefings: briefings}
+	briefer := NewBriefer(userAggregates{}, briefings, bus, nil)
+	briefer.Configure(map[string]Settings{"": {Schedule: mustParse(t, "0 7 * * *"), Location: time.UTC}})
+
+	// Down at 07:00 and back up after maxDelay: the briefing is of no use anymore
+	if n := briefer.Check(time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)); n != 0 {
+		t.Errorf("Expected no briefing in the afternoon, got %d", n)
+	}
+	// Back up within it: delivered late
+	if n := briefer.Check(time.Date(2024, 5, 2, 8, 30, 0, 0, time.UTC)); n != 1 {
+		t.Fatalf("Expected a late briefing, got %d", n)
+	}
+	if text := bus.published[0].Text; !strings.Contains(text, "Nothing is planned for Thursday May 2") {
+		t.Errorf("Expected an empty day said so, got %q", text)
+	}
+}
+
+func TestBriefer_PerUser(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skip("time zone data unavailable")
+	}
+	ownerTasks := &briefingAggregate{id: "taskmanager", items: []eventsourcing.BriefingItem{{Section: "Tasks", Text: "Owner's task"}}}
+	aliceTasks := &briefingAggregate{id: "taskmanager", items: []eventsourcing.BriefingItem{{Section: "Tasks", Text: "Alice's task"}}}
+	briefings := NewBriefingAggregate()
+	bus := &mockBus{briefings: briefings}
+	briefer := NewBriefer(userAggregates{"": {ownerTasks}, "alice": {aliceTasks}}, briefings, bus, func(userID string) eventsourcing.GenerateFunc {
+		return func(prompt string) (string, error) { return "", errors.New("offline") }
+	})
+	briefer.Configure(map[string]Settings{
+		"":      {Schedule: mustParse(t, "0 7 * * *"), Location: time.UTC},
+		"alice": {Schedule: mustParse(t, "0 7 * * *"), Location: amsterdam},
+	})
+
+	// 05:00 UTC is 07:00 in Amsterdam, Alice is briefed and the owner is not yet
+	if n := briefer.Check(time.Date(2024, 5, 1, 5, 0, 0, 0, time.UTC)); n != 1 {
+		t.Fatalf("Expected Alice's briefing only, got %d", n)
+	}
+	e := bus.published[0]
+	if e.Metadata().UserID != "alice" || !strings.HasPrefix(e.BriefingID, "alice/briefing_") {
+		t.Errorf("Expected the briefing to be Alice's, got %q for %q", e.BriefingID, e.Metadata().UserID)
+	}
+	// The LLM is offline, the items are listed
+	if !strings.Contains(e.Text, "Tasks:\n- Alice's task") || strings.Contains(e.Text, "Owner's task") {
+		t.Errorf("Expected Alice's tasks listed, got %q", e.Text)
+	}
+	if n := briefer.Check(time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)); n != 1 || bus.published[1].Metadata().UserID != "" {
+		t.Errorf("Expected the owner's briefing at 07:00 UTC, got %d", n)
+	}
+}
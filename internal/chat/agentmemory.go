@@ -0,0 +1,173 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"mindpalace/pkg/llmmodels"
+)
+
+// agentResultLimit caps the characters of a tool result kept in an agent's memory
+const agentResultLimit = 2000
+
+// AgentToolCallEvent records a tool call a plugin agent requested
+type AgentToolCallEvent struct {
+	RequestID  string
+	ToolCallID string
+	AgentName  string // Empty when only one agent works on the request
+	Function   string
+	Arguments  map[string]interface{}
+	Timestamp  time.Time
+}
+
+// AgentTurn is one call of a plugin agent: the query it got, the tool calls it made and its response
+type AgentTurn struct {
+	AgentName string
+	RequestID string
+	SessionID string
+	Query     string
+	ToolCalls []*AgentToolCall
+	Response  string
+	Timestamp time.Time
+}
+
+// AgentToolCall is a tool call of an agent turn with its result
+type AgentToolCall struct {
+	ID        string
+	Function  string
+	Arguments map[string]interface{}
+	Result    string // Results as JSON, or the error of a failed call
+}
+
+// startAgentTurn records that an agent was called for a request
+func (cm *ChatManager) startAgentTurn(requestID, agentName, query string, timestamp time.Time) {
+	turn := &AgentTurn{
+		AgentName: agentName,
+		RequestID: requestID,
+		SessionID: cm.sessionFor(requestID),
+		Query:     query,
+		Timestamp: timestamp,
+	}
+	cm.agentTurns[agentName] = append(cm.agentTurns[agentName], turn)
+	cm.requestTurns[requestID] = append(cm.requestTurns[requestID], turn)
+}
+
+// addAgentToolCall adds a tool call to the turn of the agent that requested it. Retries of a
+// call are placed under the same ID and are recorded once.
+func (cm *ChatManager) addAgentToolCall(e *AgentToolCallEvent) {
+	if _, exists := cm.toolCallTurns[e.ToolCallID]; exists {
+		return
+	}
+	turn := cm.requestTurn(e.RequestID, e.AgentName)
+	if turn == nil {
+		return
+	}
+	turn.ToolCalls = append(turn.ToolCalls, &AgentToolCall{
+		ID:        e.ToolCallID,
+		Function:  e.Function,
+		Arguments: e.Arguments,
+	})
+	cm.toolCallTurns[e.ToolCallID] = turn
+}
+
+// setAgentToolResult stores the result of an agent's tool call
+func (cm *ChatManager) setAgentToolResult(toolCallID, result string) {
+	turn, exists := cm.toolCallTurns[toolCallID]
+	if !exists {
+		return
+	}
+	if len(result) > agentResultLimit {
+		result = result[:agentResultLimit] + "..."
+	}
+	for _, call := range turn.ToolCalls {
+		if call.ID == toolCallID {
+			call.Result = result
+		}
+	}
+}
+
+// requestTurn returns the latest turn of the agent for the request. Without an agent name it
+// returns the request's turn when only one agent works on it.
+func (cm *ChatManager) requestTurn(requestID, agentName string) *AgentTurn {
+	turns := cm.requestTurns[requestID]
+	if agentName == "" {
+		if len(turns) == 1 {
+			return turns[0]
+		}
+		return nil
+	}
+	for i := len(turns) - 1; i >= 0; i-- {
+		if turns[i].AgentName == agentName {
+			return turns[i]
+		}
+	}
+	return nil
+}
+
+// setAgentResponse stores the response of the agent's turn for a request. Without an agent name
+// it completes the turns of the request that have no response yet.
+func (cm *ChatManager) setAgentResponse(requestID, agentName, response string) {
+	if agentName != "" {
+		if turn := cm.requestTurn(requestID, agentName); turn != nil {
+			turn.Response = response
+		}
+		return
+	}
+	for _, turn := range cm.requestTurns[requestID] {
+		if turn.Response == "" {
+			turn.Response = response
+		}
+	}
+}
+
+// AgentHistory returns the agent's earlier turns in the session of the request as LLM messages,
+// the most recent ones that fit in budget tokens. Turns of the request itself are left out.
+func (cm *ChatManager) AgentHistory(agentName, requestID string, budget int) []llmmodels.Message {
+	sessionID := cm.sessionFor(requestID)
+	var turns [][]llmmodels.Message
+	used := 0
+	agentTurns := cm.agentTurns[agentName]
+	for i := len(agentTurns) - 1; i >= 0; i-- {
+		turn := agentTurns[i]
+		if turn.RequestID == requestID || turn.SessionID != sessionID {
+			continue
+		}
+		messages := turn.messages()
+		tokens := 0
+		for _, msg := range messages {
+			tokens += cm.countTokens(msg.Content)
+		}
+		if used+tokens > budget {
+			break
+		}
+		used += tokens
+		turns = append(turns, messages)
+	}
+
+	var history []llmmodels.Message
+	for i := len(turns) - 1; i >= 0; i-- {
+		history = append(history, turns[i]...)
+	}
+	return history
+}
+
+// messages converts the turn to LLM messages. Tool calls are written out as assistant messages
+// because LLM messages don't carry tool calls.
+func (t *AgentTurn) messages() []llmmodels.Message {
+	messages := []llmmodels.Message{{Role: RoleUser.SystemRole, Content: t.Query}}
+	for _, call := range t.ToolCalls {
+		arguments, _ := json.Marshal(call.Arguments)
+		messages = append(messages, llmmodels.Message{
+			Role:    RoleAgent.SystemRole,
+			Content: fmt.Sprintf("Called %s with %s", call.Function, arguments),
+		})
+		if call.Result != "" {
+			messages = append(messages, llmmodels.Message{Role: RoleTool.SystemRole, Name: call.Function, Content: call.Result})
+		}
+	}
+	if t.Response != "" {
+		messages = append(messages, llmmodels.Message{Role: RoleAgent.SystemRole, Content: t.Response})
+	}
+	return messages
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/pkoukk/tiktoken-go"
+	"mindpalace/internal/memory"
 	"mindpalace/pkg/llmmodels"
 	"mindpalace/pkg/logging"
 )
@@ -17,39 +18,145 @@ import (
 type UserRequestReceivedEvent struct {
 	RequestID   string
 	RequestText string
+	SessionID   string // Session the request belongs to, the active session if empty
+	Language    string // Language the request was spoken in, if speech recognition detected it
+	Speaker     string // Who spoke the request in a room with several people, if known
+	Revises     string // Request the user edited and resubmitted as this one, if any
+	Timestamp   time.Time
 }
 
 type ToolCallCompleted struct {
-	RequestID string
-	Function  string
-	Results   map[string]interface{}
+	RequestID  string
+	ToolCallID string
+	Function   string
+	Results    map[string]interface{}
+	Summary    string // Condensed results shown and sent to the LLM instead of results too large for it
+	Timestamp  time.Time
 }
 
 type ToolCallFailedEvent struct {
-	RequestID string
-	ErrorMsg  string
+	RequestID  string
+	ToolCallID string
+	ErrorMsg   string
+	Timestamp  time.Time
 }
 
 type AgentCallDecidedEvent struct {
 	RequestID string
 	AgentName string
+	Query     string
+	Timestamp time.Time
+}
+
+type AgentCallCompletedEvent struct {
+	RequestID string
+	AgentName string
+	Summary   string
+	Timestamp time.Time
 }
 
 type AgentExecutionFailedEvent struct {
 	RequestID string
 	ErrorMsg  string
+	Timestamp time.Time
 }
 
 type RequestCompletedEvent struct {
 	RequestID    string
 	ResponseText string
+	Timestamp    time.Time
+}
+
+type RequestCancelledEvent struct {
+	RequestID string
+	Timestamp time.Time
+}
+
+type ToolCallConfirmationRequestedEvent struct {
+	RequestID string
+	Prompt    string
+	Timestamp time.Time
+}
+
+type ToolCallConfirmedEvent struct {
+	RequestID string
+	Function  string
+	Approved  bool
+	Timestamp time.Time
 }
 
 type ToolCallStarted struct {
 	RequestID string
 	Function  string
+	Timestamp time.Time
+}
+
+type ReminderDueEvent struct {
+	Title     string
+	Due       time.Time
+	Timestamp time.Time
+}
+
+// BriefingDeliveredEvent shows the morning briefing as a message of the assistant
+type BriefingDeliveredEvent struct {
+	BriefingID string
+	Text       string
+	Timestamp  time.Time
+}
+
+type SessionStartedEvent struct {
+	SessionID string
+	Title     string
+	Timestamp time.Time
+}
+
+type SessionSwitchedEvent struct {
+	SessionID string
+	Timestamp time.Time
+}
+
+// SessionLanguageSetEvent sets the language responses in a session are in
+type SessionLanguageSetEvent struct {
+	SessionID string
+	Language  string // Empty responds in the language of the user
+	Timestamp time.Time
+}
+
+// PluginCreationProgressEvent reports a stage of creating a plugin, like compiling it
+type PluginCreationProgressEvent struct {
+	RequestID  string
+	PluginName string
+	Message    string
+	Timestamp  time.Time
+}
+
+// LLMStatusChangedEvent reports the LLM going offline, failing over to a fallback or being back online
+type LLMStatusChangedEvent struct {
+	Status    string
+	Message   string
+	Timestamp time.Time
+}
+
+// DefaultSessionID is the session messages belong to until another session is started
+const DefaultSessionID = "default"
+
+// Session is a separate conversation thread
+type Session struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"created_at"`
+	Language  string    `json:"language,omitempty"` // Language responses are in, the user's language if empty
 }
 
+// pluginCreationAgent owns the progress messages of creating a plugin
+const pluginCreationAgent = "plugin_creation"
+
+// llmStatusAgent owns the messages about the LLM being offline or online
+const llmStatusAgent = "llm_status"
+
+// recallLimit is the number of memory search results considered when recalling history
+const recallLimit = 10
+
 // Role defines the explicit roles a message can have
 type Role struct {
 	SystemRole string
@@ -76,51 +183,200 @@ type Message struct {
 	Metadata  map[string]interface{} // Extra data
 	Visible   bool                   // UI visibility
 	Tags      []string               // Tags for categorization and retrieval
+	Sequence  int                    // Insertion order, breaks timestamp ties
+	SessionID string                 // Conversation thread the message belongs to
 }
 
 // ChatManager now tracks messages by agent
 type ChatManager struct {
-	messages      map[string][]Message // Agent name -> message history (empty key for core MindPalace)
-	totalTokens   map[string]int       // Current token count per agent
-	tokenizer     *tiktoken.Tiktoken   // Tokenizer for token counting
-	maxTokens     int                  // Max tokens in LLM context
-	systemPrompt  string               // Base system prompt
-	pluginPrompts map[string]string    // Plugin-specific prompts
+	messages      map[string][]Message            // Agent name -> message history (empty key for core MindPalace)
+	totalTokens   map[string]int                  // Current token count per agent
+	tokenizer     *tiktoken.Tiktoken              // Tokenizer for token counting
+	maxTokens     int                             // Max tokens in LLM context
+	systemPrompt  string                          // Base system prompt
+	pluginPrompts map[string]string               // Plugin-specific prompts
+	sequence      int                             // Number of messages added so far
+	memory        *memory.Store                   // Optional semantic memory for recalling trimmed history
+	userID        string                          // User the conversation is with, empty for the owner
+	summaries     map[string]*conversationSummary // Session ID -> summary of its oldest messages
+
+	sessions        map[string]*Session // Session ID -> session
+	sessionOrder    []string            // Session IDs in the order they were started
+	activeSession   string              // Session new requests and the LLM context belong to
+	requestSessions map[string]string   // RequestID -> session the request was made in
+	revisedBy       map[string]string   // RequestID -> the request the user edited it into
+
+	agentTurns    map[string][]*AgentTurn // Agent name -> the agent's calls, oldest first
+	requestTurns  map[string][]*AgentTurn // RequestID -> agent calls made for the request
+	toolCallTurns map[string]*AgentTurn   // Tool call ID -> agent call that requested it
 }
 
 // NewChatManager initializes with a map for agent histories
 func NewChatManager(maxTokens int, baseSystemPrompt string) *ChatManager {
 	t, _ := tiktoken.EncodingForModel("gpt-4")
 
-	return &ChatManager{
-		messages:      make(map[string][]Message),
-		maxTokens:     maxTokens,
-		totalTokens:   make(map[string]int),
-		tokenizer:     t,
-		systemPrompt:  baseSystemPrompt,
-		pluginPrompts: make(map[string]string),
+	cm := &ChatManager{
+		messages:        make(map[string][]Message),
+		maxTokens:       maxTokens,
+		totalTokens:     make(map[string]int),
+		tokenizer:       t,
+		systemPrompt:    baseSystemPrompt,
+		pluginPrompts:   make(map[string]string),
+		sessions:        make(map[string]*Session),
+		requestSessions: make(map[string]string),
+		revisedBy:       make(map[string]string),
+		agentTurns:      make(map[string][]*AgentTurn),
+		requestTurns:    make(map[string][]*AgentTurn),
+		toolCallTurns:   make(map[string]*AgentTurn),
+		summaries:       make(map[string]*conversationSummary),
+	}
+	cm.StartSession(DefaultSessionID, "Default", time.Time{})
+	return cm
+}
+
+// StartSession adds a conversation thread and makes it the active session
+func (cm *ChatManager) StartSession(sessionID, title string, createdAt time.Time) {
+	if _, exists := cm.sessions[sessionID]; !exists {
+		if title == "" {
+			title = sessionID
+		}
+		cm.sessions[sessionID] = &Session{ID: sessionID, Title: title, CreatedAt: createdAt}
+		cm.sessionOrder = append(cm.sessionOrder, sessionID)
+	}
+	cm.activeSession = sessionID
+}
+
+// SwitchSession makes an existing session the active session
+func (cm *ChatManager) SwitchSession(sessionID string) error {
+	if _, exists := cm.sessions[sessionID]; !exists {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+	cm.activeSession = sessionID
+	return nil
+}
+
+// SetSessionLanguage sets the language responses in a session are in, empty for the user's language
+func (cm *ChatManager) SetSessionLanguage(sessionID, language string) error {
+	session, exists := cm.sessions[sessionID]
+	if !exists {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+	session.Language = language
+	return nil
+}
+
+// responseLanguage returns the language responses in the active session should be in: the
+// session's language, or else the language the user last spoke in; empty if neither is known
+func (cm *ChatManager) responseLanguage() string {
+	if language := cm.sessions[cm.activeSession].Language; language != "" {
+		return language
+	}
+	return cm.lastRequestMetadata("language")
+}
+
+// lastRequestMetadata returns a metadata field of the last request in the active session
+func (cm *ChatManager) lastRequestMetadata(key string) string {
+	messages := cm.messages[""]
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != RoleUser || messages[i].SessionID != cm.activeSession {
+			continue
+		}
+		value, _ := messages[i].Metadata[key].(string)
+		return value
+	}
+	return ""
+}
+
+// llmContent returns the content of a message for the LLM, requests prefixed with who spoke them
+func llmContent(msg Message) string {
+	if speaker, _ := msg.Metadata["speaker"].(string); speaker != "" && msg.Role == RoleUser {
+		return speaker + ": " + msg.Content
+	}
+	return msg.Content
+}
+
+// speakersNote tells the LLM several people talk to it when the last request named who spoke it
+const speakersNote = "\n\nSeveral people in the room talk to you. Their messages start with the name of who spoke them; address them by that name and keep what each of them asked apart."
+
+// ListSessions returns all sessions in the order they were started
+func (cm *ChatManager) ListSessions() []Session {
+	sessions := make([]Session, 0, len(cm.sessionOrder))
+	for _, id := range cm.sessionOrder {
+		sessions = append(sessions, *cm.sessions[id])
+	}
+	return sessions
+}
+
+// ActiveSession returns the session new requests belong to
+func (cm *ChatManager) ActiveSession() Session {
+	return *cm.sessions[cm.activeSession]
+}
+
+// sessionFor returns the session of a request, the active session for messages outside a known request
+func (cm *ChatManager) sessionFor(requestID string) string {
+	if sessionID, exists := cm.requestSessions[requestID]; exists {
+		return sessionID
 	}
+	return cm.activeSession
+}
+
+// ForUser returns an empty chat with the same limits, system prompt and memory for a household
+// member, who converses with MindPalace apart from the owner
+func (cm *ChatManager) ForUser(userID string) *ChatManager {
+	userChat := NewChatManager(cm.maxTokens, cm.systemPrompt)
+	userChat.memory = cm.memory
+	userChat.userID = userID
+	return userChat
+}
+
+// SetMemory enables semantic recall of history that no longer fits in the LLM context
+func (cm *ChatManager) SetMemory(store *memory.Store) {
+	cm.memory = store
+}
+
+// SetMaxTokens changes the number of tokens of history kept in the LLM context
+func (cm *ChatManager) SetMaxTokens(maxTokens int) {
+	cm.maxTokens = maxTokens
 }
 
 // AddMessage now assigns messages to an agent (or core if agent is empty)
 func (cm *ChatManager) AddMessage(role Role, content string, requestID string, agent string, metadata map[string]interface{}) {
+	cm.AddMessageAt(time.Now().UTC(), role, content, requestID, agent, metadata)
+}
+
+// AddMessageAt adds a message with an explicit timestamp, used when replaying persisted events
+func (cm *ChatManager) AddMessageAt(timestamp time.Time, role Role, content string, requestID string, agent string, metadata map[string]interface{}) {
+	if timestamp.IsZero() {
+		timestamp = time.Now().UTC()
+	}
+	cm.sequence++
 	msg := Message{
 		ID:        generateMessageID(requestID),
 		Role:      role,
 		Content:   content,
-		Timestamp: time.Now().UTC(),
+		Timestamp: timestamp,
 		RequestID: requestID,
 		Agent:     agent, // e.g., "taskmanager", "dogfoodtracker", or "" for core
 		Metadata:  metadata,
 		Visible:   role != RoleSystem && role != RoleHidden,
 		Tags:      []string{},
+		Sequence:  cm.sequence,
+		SessionID: cm.sessionFor(requestID),
 	}
 	if _, exists := cm.messages[agent]; !exists {
 		cm.messages[agent] = make([]Message, 0)
 	}
 	cm.messages[agent] = append(cm.messages[agent], msg)
-	tokens := len(cm.tokenizer.Encode(msg.Content, nil, nil))
+	tokens := cm.countTokens(msg.Content)
 	cm.totalTokens[agent] += tokens
+	if cm.memory != nil && role != RoleSystem && role != RoleHidden {
+		cm.index(msg)
+	}
+}
+
+// index adds a message to the memory, to be recalled once it no longer fits in the LLM context
+func (cm *ChatManager) index(msg Message) {
+	cm.memory.Index(msg.ID, msg.Content, map[string]string{"source": "chat", "request_id": msg.RequestID, "agent": msg.Agent, "session_id": msg.SessionID, "user_id": cm.userID})
 }
 
 // GetLLMContext now includes logging for debugging
@@ -135,11 +391,24 @@ func (cm *ChatManager) GetLLMContext(activeAgents []string) []llmmodels.Message
 			systemContent.WriteString(prompt)
 		}
 	}
+	if language := cm.responseLanguage(); language != "" {
+		systemContent.WriteString("\n\nRespond in ")
+		systemContent.WriteString(strings.ToUpper(language[:1]) + language[1:])
+		systemContent.WriteString(", whatever the language of the messages above.")
+	}
+	if cm.lastRequestMetadata("speaker") != "" {
+		systemContent.WriteString(speakersNote)
+	}
 	logging.Info("System prompt built: %s", systemContent.String())
 
 	result := []llmmodels.Message{
 		{Role: string(RoleSystem.SystemRole), Content: systemContent.String()},
 	}
+	summaryTokens := 0
+	if summary, ok := cm.summaryMessage(); ok {
+		result = append(result, summary)
+		summaryTokens = cm.countTokens(summary.Content)
+	}
 
 	// Merge histories for active agents + core MindPalace
 	mergedMessages := make([]Message, 0)
@@ -147,9 +416,9 @@ func (cm *ChatManager) GetLLMContext(activeAgents []string) []llmmodels.Message
 
 	for _, agent := range agentsToMerge {
 		if agentMsgs, exists := cm.messages[agent]; exists {
-			// Filter out hidden messages for LLM
+			// Filter out hidden messages, other sessions, summarized messages and edited requests for LLM
 			for _, msg := range agentMsgs {
-				if msg.Role != RoleHidden {
+				if msg.Role != RoleHidden && msg.SessionID == cm.activeSession && !cm.isSummarized(msg) && !cm.isRevised(msg) {
 					mergedMessages = append(mergedMessages, msg)
 				}
 			}
@@ -158,31 +427,37 @@ func (cm *ChatManager) GetLLMContext(activeAgents []string) []llmmodels.Message
 
 	// Sort by timestamp to maintain chronological order
 	sort.Slice(mergedMessages, func(i, j int) bool {
-		return mergedMessages[i].Timestamp.Before(mergedMessages[j].Timestamp)
+		return messageBefore(mergedMessages[i], mergedMessages[j])
 	})
 	logging.Info("Merged %d visible messages for LLM context", len(mergedMessages))
 
 	// Trim to max tokens (most recent)
-	totalTokens := len(cm.tokenizer.Encode(systemContent.String(), nil, nil))
-	// Keep messages from the end (most recent) that fit within token limit
-	var trimmedMessages []Message
-	for i := len(mergedMessages) - 1; i >= 0; i-- {
-		msg := mergedMessages[i]
-		msgTokens := len(cm.tokenizer.Encode(msg.Content, nil, nil))
-		if totalTokens+msgTokens <= cm.maxTokens {
-			trimmedMessages = append([]Message{msg}, trimmedMessages...)
-			totalTokens += msgTokens
-		} else {
-			break
+	budget := cm.maxTokens - cm.countTokens(systemContent.String()) - summaryTokens
+	start := cm.recentStart(mergedMessages, budget)
+	if start > 0 && cm.memory != nil {
+		// History overflows: reserve part of the budget for semantically relevant older messages
+		reserve := budget / 4
+		start = cm.recentStart(mergedMessages, budget-reserve)
+		recalled, memories := cm.recallRelevant(lastUserMessage(mergedMessages), mergedMessages[:start], reserve)
+		mergedMessages = append(recalled, mergedMessages[start:]...)
+		sort.Slice(mergedMessages, func(i, j int) bool {
+			return messageBefore(mergedMessages[i], mergedMessages[j])
+		})
+		if len(memories) > 0 {
+			result = append(result, llmmodels.Message{
+				Role:    string(RoleSystem.SystemRole),
+				Content: "Relevant memories from earlier activity:\n- " + strings.Join(memories, "\n- "),
+			})
 		}
+	} else {
+		mergedMessages = mergedMessages[start:]
 	}
-	mergedMessages = trimmedMessages
 
 	// Convert to LLM format
 	for _, msg := range mergedMessages {
 		result = append(result, llmmodels.Message{
 			Role:    string(msg.Role.SystemRole),
-			Content: msg.Content,
+			Content: llmContent(msg),
 		})
 	}
 	logging.Info("LLM context prepared with %d messages", len(result))
@@ -202,11 +477,24 @@ func (cm *ChatManager) GetLLMContextWithTags(activeAgents []string, relevantTags
 			systemContent.WriteString(prompt)
 		}
 	}
+	if language := cm.responseLanguage(); language != "" {
+		systemContent.WriteString("\n\nRespond in ")
+		systemContent.WriteString(strings.ToUpper(language[:1]) + language[1:])
+		systemContent.WriteString(", whatever the language of the messages above.")
+	}
+	if cm.lastRequestMetadata("speaker") != "" {
+		systemContent.WriteString(speakersNote)
+	}
 	logging.Info("System prompt built: %s", systemContent.String())
 
 	result := []llmmodels.Message{
 		{Role: string(RoleSystem.SystemRole), Content: systemContent.String()},
 	}
+	summaryTokens := 0
+	if summary, ok := cm.summaryMessage(); ok {
+		result = append(result, summary)
+		summaryTokens = cm.countTokens(summary.Content)
+	}
 
 	// Merge histories for active agents + core MindPalace
 	mergedMessages := make([]Message, 0)
@@ -214,9 +502,9 @@ func (cm *ChatManager) GetLLMContextWithTags(activeAgents []string, relevantTags
 
 	for _, agent := range agentsToMerge {
 		if agentMsgs, exists := cm.messages[agent]; exists {
-			// Filter out hidden messages for LLM
+			// Filter out hidden messages, other sessions, summarized messages and edited requests for LLM
 			for _, msg := range agentMsgs {
-				if msg.Role != RoleHidden {
+				if msg.Role != RoleHidden && msg.SessionID == cm.activeSession && !cm.isSummarized(msg) && !cm.isRevised(msg) {
 					mergedMessages = append(mergedMessages, msg)
 				}
 			}
@@ -232,15 +520,15 @@ func (cm *ChatManager) GetLLMContextWithTags(activeAgents []string, relevantTags
 			return iHasRelevantTag // Relevant messages first
 		}
 		// If both have same relevance, sort by timestamp (most recent first)
-		return mergedMessages[i].Timestamp.After(mergedMessages[j].Timestamp)
+		return messageBefore(mergedMessages[j], mergedMessages[i])
 	})
 	logging.Info("Sorted %d visible messages for LLM context (prioritizing %d relevant tags)", len(mergedMessages), len(relevantTags))
 
 	// Trim to max tokens
-	totalTokens := len(cm.tokenizer.Encode(systemContent.String(), nil, nil))
+	totalTokens := cm.countTokens(systemContent.String()) + summaryTokens
 	var trimmedMessages []Message
 	for _, msg := range mergedMessages {
-		msgTokens := len(cm.tokenizer.Encode(msg.Content, nil, nil))
+		msgTokens := cm.countTokens(msg.Content)
 		if totalTokens+msgTokens <= cm.maxTokens {
 			trimmedMessages = append(trimmedMessages, msg)
 			totalTokens += msgTokens
@@ -253,7 +541,7 @@ func (cm *ChatManager) GetLLMContextWithTags(activeAgents []string, relevantTags
 	for _, msg := range trimmedMessages {
 		result = append(result, llmmodels.Message{
 			Role:    string(msg.Role.SystemRole),
-			Content: msg.Content,
+			Content: llmContent(msg),
 		})
 	}
 	logging.Info("LLM context prepared with %d messages", len(result))
@@ -280,18 +568,18 @@ func min(a, b int) int {
 	return b
 }
 
-// GetUIMessages returns a unified, visible history for UI
+// GetUIMessages returns a unified, visible history of the active session for UI
 func (cm *ChatManager) GetUIMessages() []Message {
 	visible := make([]Message, 0)
 	for _, agentMsgs := range cm.messages {
 		for _, msg := range agentMsgs {
-			if msg.Visible {
+			if msg.Visible && msg.SessionID == cm.activeSession {
 				visible = append(visible, msg)
 			}
 		}
 	}
 	sort.Slice(visible, func(i, j int) bool {
-		return visible[i].Timestamp.Before(visible[j].Timestamp)
+		return messageBefore(visible[i], visible[j])
 	})
 	return visible
 }
@@ -305,11 +593,107 @@ func (cm *ChatManager) GetTotalTokens() int {
 	return total
 }
 
+// SetSystemPrompt replaces the base system prompt
+func (cm *ChatManager) SetSystemPrompt(prompt string) {
+	cm.systemPrompt = prompt
+}
+
 // SetPluginPrompt adds or updates a plugin-specific system prompt
 func (cm *ChatManager) SetPluginPrompt(pluginName, prompt string) {
 	cm.pluginPrompts[pluginName] = prompt
 }
 
+// recentStart returns the index of the oldest message in the most recent run of messages fitting in budget tokens
+func (cm *ChatManager) recentStart(messages []Message, budget int) int {
+	used := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		used += cm.countTokens(messages[i].Content)
+		if used > budget {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// recallRelevant searches memory for the query and returns matching older messages
+// and non-chat memories (e.g. plugin events) that fit within budget tokens
+func (cm *ChatManager) recallRelevant(query string, older []Message, budget int) ([]Message, []string) {
+	if query == "" || len(older) == 0 {
+		return nil, nil
+	}
+	// Other users' memories are never recalled, they must not take the places of the user's own
+	results, err := cm.memory.SearchWhere(query, recallLimit, map[string]string{"user_id": cm.userID})
+	if err != nil {
+		logging.Error("Failed to search memory: %v", err)
+		return nil, nil
+	}
+
+	olderByID := make(map[string]Message, len(older))
+	for _, msg := range older {
+		olderByID[msg.ID] = msg
+	}
+
+	var recalled []Message
+	var memories []string
+	used := 0
+	for _, res := range results {
+		tokens := cm.countTokens(res.Text)
+		if used+tokens > budget {
+			continue
+		}
+		if msg, ok := olderByID[res.ID]; ok {
+			recalled = append(recalled, msg)
+			used += tokens
+		} else if res.Metadata["source"] != "chat" {
+			memories = append(memories, res.Text)
+			used += tokens
+		}
+	}
+	logging.Info("Recalled %d older messages and %d memories for LLM context", len(recalled), len(memories))
+	return recalled, memories
+}
+
+// lastUserMessage returns the content of the most recent user message
+func lastUserMessage(messages []Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == RoleUser {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
+// EstimateUsage counts the prompt and completion tokens of an LLM call locally, for models that
+// do not report them
+func (cm *ChatManager) EstimateUsage(messages []llmmodels.Message, completion string) (int, int) {
+	prompt := 0
+	for _, msg := range messages {
+		prompt += cm.countTokens(msg.Content)
+	}
+	return prompt, cm.countTokens(completion)
+}
+
+// CountTokens returns the number of tokens the text takes in the LLM context
+func (cm *ChatManager) CountTokens(text string) int {
+	return cm.countTokens(text)
+}
+
+// countTokens counts tokens with the tokenizer, estimating when it failed to load (e.g. offline)
+func (cm *ChatManager) countTokens(text string) int {
+	if cm.tokenizer == nil {
+		return len(text) / 4
+	}
+	return len(cm.tokenizer.Encode(text, nil, nil))
+}
+
+// messageBefore orders messages chronologically, falling back to insertion order
+func messageBefore(a, b Message) bool {
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.Before(b.Timestamp)
+	}
+	return a.Sequence < b.Sequence
+}
+
 // Helper to generate unique message IDs
 func generateMessageID(requestID string) string {
 	return fmt.Sprintf("%s_%d", requestID, time.Now().UnixNano())
@@ -335,32 +719,109 @@ func (cm *ChatManager) ResetPluginPrompts() {
 func (cm *ChatManager) ApplyChatEvent(event interface{}) error {
 	switch e := event.(type) {
 	case *UserRequestReceivedEvent:
-		cm.AddMessage(RoleUser, e.RequestText, e.RequestID, "", nil)
+		sessionID := e.SessionID
+		if sessionID == "" {
+			sessionID = cm.activeSession
+		} else if _, exists := cm.sessions[sessionID]; !exists {
+			// Requests may name a session that was never started explicitly, e.g. through the HTTP API
+			cm.sessions[sessionID] = &Session{ID: sessionID, Title: sessionID, CreatedAt: e.Timestamp}
+			cm.sessionOrder = append(cm.sessionOrder, sessionID)
+		}
+		cm.requestSessions[e.RequestID] = sessionID
+		metadata := make(map[string]interface{})
+		if e.Language != "" {
+			metadata["language"] = e.Language
+		}
+		if e.Speaker != "" {
+			metadata["speaker"] = e.Speaker
+		}
+		if e.Revises != "" {
+			metadata["revises"] = e.Revises
+			cm.applyRevision(e.RequestID, e.Revises)
+		}
+		if len(metadata) == 0 {
+			metadata = nil
+		}
+		cm.AddMessageAt(e.Timestamp, RoleUser, e.RequestText, e.RequestID, "", metadata)
 	case *ToolCallCompleted:
 		bytes, _ := json.Marshal(e.Results)
 		agentName := "" // Will be set by caller if needed
-		cm.AddMessage(RoleTool, string(bytes), e.RequestID, agentName, map[string]interface{}{
-			"function": e.Function,
-		})
+		content := string(bytes)
+		metadata := map[string]interface{}{"function": e.Function}
+		if e.Summary != "" {
+			// The full results stay available to the user, the LLM only sees the summary
+			content = e.Summary
+			metadata["full_result"] = string(bytes)
+		}
+		cm.AddMessageAt(e.Timestamp, RoleTool, content, e.RequestID, agentName, metadata)
+		cm.setAgentToolResult(e.ToolCallID, content)
 	case *ToolCallFailedEvent:
 		agentName := "" // Will be set by caller if needed
-		cm.AddMessage(RoleSystem, fmt.Sprintf("Tool Call failed '%s'", e.ErrorMsg), e.RequestID, agentName, nil)
+		cm.AddMessageAt(e.Timestamp, RoleSystem, fmt.Sprintf("Tool Call failed '%s'", e.ErrorMsg), e.RequestID, agentName, nil)
+		cm.setAgentToolResult(e.ToolCallID, "Failed: "+e.ErrorMsg)
 	case *AgentCallDecidedEvent:
-		cm.AddMessage(RoleSystem, fmt.Sprintf("Calling agent '%s'...", e.AgentName), e.RequestID, e.AgentName, nil)
+		cm.AddMessageAt(e.Timestamp, RoleSystem, fmt.Sprintf("Calling agent '%s'...", e.AgentName), e.RequestID, e.AgentName, nil)
+		cm.startAgentTurn(e.RequestID, e.AgentName, e.Query, e.Timestamp)
+	case *AgentToolCallEvent:
+		cm.addAgentToolCall(e)
+	case *AgentCallCompletedEvent:
+		cm.AddMessageAt(e.Timestamp, RoleAgent, e.Summary, e.RequestID, e.AgentName, nil)
+		cm.setAgentResponse(e.RequestID, e.AgentName, e.Summary)
 	case *AgentExecutionFailedEvent:
 		agentName := "" // Will be set by caller if needed
-		cm.AddMessage(RoleMindPalace, fmt.Sprintf("Error %s", e.ErrorMsg), e.RequestID, agentName, nil)
+		cm.AddMessageAt(e.Timestamp, RoleMindPalace, fmt.Sprintf("Error %s", e.ErrorMsg), e.RequestID, agentName, nil)
 	case *RequestCompletedEvent:
 		thinks, regular := ParseResponseText(e.ResponseText)
 		agentName := "" // Will be set by caller if needed
 		for _, think := range thinks {
-			cm.AddMessage(RoleHidden, think, e.RequestID, agentName, nil)
+			cm.AddMessageAt(e.Timestamp, RoleHidden, think, e.RequestID, agentName, nil)
 		}
 		if regular != "" {
-			cm.AddMessage(RoleMindPalace, regular, e.RequestID, agentName, nil)
+			cm.AddMessageAt(e.Timestamp, RoleMindPalace, regular, e.RequestID, agentName, nil)
+			cm.setAgentResponse(e.RequestID, "", regular)
+		}
+	case *RequestCancelledEvent:
+		cm.AddMessageAt(e.Timestamp, RoleSystem, "Request cancelled", e.RequestID, "", nil)
+	case *ToolCallConfirmationRequestedEvent:
+		cm.AddMessageAt(e.Timestamp, RoleMindPalace, e.Prompt, e.RequestID, "", map[string]interface{}{
+			"type": "confirmation",
+		})
+	case *ToolCallConfirmedEvent:
+		answer := "declined"
+		if e.Approved {
+			answer = "approved"
 		}
+		cm.AddMessageAt(e.Timestamp, RoleSystem, fmt.Sprintf("Tool Call %s '%s'", answer, e.Function), e.RequestID, "", nil)
 	case *ToolCallStarted:
-		cm.AddMessage(RoleSystem, fmt.Sprintf("Tool Call started'%s'", e.Function), e.RequestID, "", nil)
+		cm.AddMessageAt(e.Timestamp, RoleSystem, fmt.Sprintf("Tool Call started'%s'", e.Function), e.RequestID, "", nil)
+	case *PluginCreationProgressEvent:
+		// Shown to the user, but kept out of the LLM context: no plugin can be named pluginCreationAgent
+		cm.AddMessageAt(e.Timestamp, RoleAgent, fmt.Sprintf("Plugin %s: %s", e.PluginName, e.Message), e.RequestID, pluginCreationAgent, nil)
+	case *LLMStatusChangedEvent:
+		// Shown to the user, but kept out of the LLM context like the progress of creating a plugin
+		cm.AddMessageAt(e.Timestamp, RoleAgent, e.Message, "", llmStatusAgent, map[string]interface{}{
+			"type":   "llm_status",
+			"status": e.Status,
+		})
+	case *ReminderDueEvent:
+		cm.AddMessageAt(e.Timestamp, RoleSystem, fmt.Sprintf("Reminder: '%s' is due %s", e.Title, e.Due.Local().Format("Mon Jan 2 15:04")), "", "", map[string]interface{}{
+			"type": "reminder",
+		})
+	case *BriefingDeliveredEvent:
+		cm.AddMessageAt(e.Timestamp, RoleMindPalace, e.Text, "", "", map[string]interface{}{
+			"type":        "briefing",
+			"briefing_id": e.BriefingID,
+		})
+	case *SessionStartedEvent:
+		cm.StartSession(e.SessionID, e.Title, e.Timestamp)
+	case *SessionSwitchedEvent:
+		return cm.SwitchSession(e.SessionID)
+	case *SessionLanguageSetEvent:
+		return cm.SetSessionLanguage(e.SessionID, e.Language)
+	case *ConversationSummarizedEvent:
+		cm.applySummary(e)
+	case *MessageRedactedEvent:
+		cm.applyRedaction(e)
 	default:
 		return fmt.Errorf("unsupported event type: %T", event)
 	}
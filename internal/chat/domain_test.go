@@ -0,0 +1,405 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"mindpalace/internal/memory"
+)
+
+// keywordEmbedder embeds texts by counting a fixed set of keywords
+type keywordEmbedder struct {
+	keywords []string
+}
+
+func (e *keywordEmbedder) Embed(texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = make([]float32, len(e.keywords))
+		for j, keyword := range e.keywords {
+			vectors[i][j] = float32(strings.Count(strings.ToLower(text), keyword))
+		}
+	}
+	return vectors, nil
+}
+
+func TestGetUIMessages_OrdersByTimestampThenInsertion(t *testing.T) {
+	cm := NewChatManager(1000, "base")
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	cm.AddMessageAt(ts, RoleUser, "first", "req1", "", nil)
+	cm.AddMessageAt(ts, RoleAgent, "second", "req1", "taskmanager", nil)
+	cm.AddMessageAt(ts.Add(-time.Second), RoleUser, "earlier", "req0", "", nil)
+
+	messages := cm.GetUIMessages()
+	expected := []string{"earlier", "first", "second"}
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %d messages, got %d", len(expected), len(messages))
+	}
+	for i, content := range expected {
+		if messages[i].Content != content {
+			t.Errorf("Message %d: expected %q, got %q", i, content, messages[i].Content)
+		}
+	}
+}
+
+func TestGetLLMContext_RecallsRelevantTrimmedHistory(t *testing.T) {
+	cm := NewChatManager(400, "base")
+	store := memory.NewStore(&keywordEmbedder{keywords: []string{"dog", "weather"}})
+	cm.SetMemory(store)
+
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	cm.AddMessageAt(ts, RoleUser, "My dog is called Rex", "req1", "", nil)
+	for i := 0; i < 20; i++ {
+		cm.AddMessageAt(ts.Add(time.Duration(i+1)*time.Minute), RoleUser, "Talking about the weather "+strings.Repeat("x", 60), "req2", "", nil)
+	}
+	cm.AddMessageAt(ts.Add(time.Hour), RoleUser, "What is my dog called?", "req3", "", nil)
+
+	cm.SetMemory(nil)
+	if context := cm.GetLLMContext(nil); context[1].Content == "My dog is called Rex" {
+		t.Fatal("Expected the oldest message to be trimmed without memory")
+	}
+	cm.SetMemory(store)
+	if err := store.EmbedPending(); err != nil {
+		t.Fatalf("EmbedPending failed: %v", err)
+	}
+
+	context := cm.GetLLMContext(nil)
+	if context[0].Role != "system" {
+		t.Errorf("Expected system prompt first, got role %s", context[0].Role)
+	}
+	if context[1].Content != "My dog is called Rex" {
+		t.Errorf("Expected recalled message right after the system prompt, got %q", context[1].Content)
+	}
+	if last := context[len(context)-1].Content; last != "What is my dog called?" {
+		t.Errorf("Expected latest message last, got %q", last)
+	}
+	if len(context) >= 23 {
+		t.Errorf("Expected history to be trimmed, got %d messages", len(context))
+	}
+}
+
+func TestForUser_RecallsOwnMemoriesOnly(t *testing.T) {
+	owner := NewChatManager(400, "base")
+	store := memory.NewStore(&keywordEmbedder{keywords: []string{"dog", "weather"}})
+	owner.SetMemory(store)
+	store.Index("event_1", "dog Rex has the vet on Monday", map[string]string{"source": "event"})
+	store.Index("event_2", "dog Bella has the vet on Friday", map[string]string{"source": "event", "user_id": "alice"})
+	for i := 0; i < 2*recallLimit; i++ {
+		// The owner's memories match as well as alice's, and come first
+		store.Index(fmt.Sprintf("event_0%02d", i), "dog Rex has the vet on Monday", map[string]string{"source": "event"})
+	}
+
+	alice := owner.ForUser("alice")
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		alice.AddMessageAt(ts.Add(time.Duration(i)*time.Minute), RoleUser, "Talking about the weather "+strings.Repeat("x", 60), "req1", "", nil)
+	}
+	alice.AddMessageAt(ts.Add(time.Hour), RoleUser, "When does my dog see the vet?", "req2", "", nil)
+	if err := store.EmbedPending(); err != nil {
+		t.Fatalf("EmbedPending failed: %v", err)
+	}
+
+	var recalled string
+	for _, msg := range alice.GetLLMContext(nil) {
+		recalled += msg.Content
+	}
+	if !strings.Contains(recalled, "Bella") || strings.Contains(recalled, "Rex") {
+		t.Errorf("Expected only alice's memories recalled, got %q", recalled)
+	}
+	if len(owner.GetUIMessages()) != 0 {
+		t.Error("Expected alice's messages kept out of the owner's chat")
+	}
+}
+
+func TestSessions_ScopeContextAndUIMessages(t *testing.T) {
+	cm := NewChatManager(1000, "base")
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	cm.ApplyChatEvent(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "groceries", Timestamp: ts})
+	cm.ApplyChatEvent(&SessionStartedEvent{SessionID: "work", Title: "Work", Timestamp: ts.Add(time.Second)})
+	cm.ApplyChatEvent(&UserRequestReceivedEvent{RequestID: "req2", RequestText: "quarterly report", Timestamp: ts.Add(2 * time.Second)})
+	// A response to a request arriving after a switch stays in the request's session
+	cm.ApplyChatEvent(&SessionSwitchedEvent{SessionID: DefaultSessionID, Timestamp: ts.Add(3 * time.Second)})
+	cm.ApplyChatEvent(&RequestCompletedEvent{RequestID: "req2", ResponseText: "report drafted", Timestamp: ts.Add(4 * time.Second)})
+
+	messages := cm.GetUIMessages()
+	if len(messages) != 1 || messages[0].Content != "groceries" {
+		t.Fatalf("Expected only the default session's message, got %v", messages)
+	}
+
+	if err := cm.SwitchSession("work"); err != nil {
+		t.Fatalf("SwitchSession failed: %v", err)
+	}
+	context := cm.GetLLMContext(nil)
+	if len(context) != 3 || context[1].Content != "quarterly report" || context[2].Content != "report drafted" {
+		t.Errorf("Expected the work session in the LLM context, got %v", context)
+	}
+
+	if err := cm.SwitchSession("missing"); err == nil {
+		t.Error("Expected an error switching to an unknown session")
+	}
+	sessions := cm.ListSessions()
+	if len(sessions) != 2 || sessions[0].ID != DefaultSessionID || sessions[1].Title != "Work" {
+		t.Errorf("Unexpected sessions: %+v", sessions)
+	}
+}
+
+func TestSessions_ResponseLanguage(t *testing.T) {
+	cm := NewChatManager(1000, "base")
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	if prompt := cm.GetLLMContext(nil)[0].Content; prompt != "base" {
+		t.Errorf("Expected no language instruction without a known language, got %q", prompt)
+	}
+
+	// The language the user spoke in is answered in
+	cm.ApplyChatEvent(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "boodschappen", Language: "dutch", Timestamp: ts})
+	if prompt := cm.GetLLMContext(nil)[0].Content; !strings.Contains(prompt, "Respond in Dutch") {
+		t.Errorf("Expected responses in the spoken language, got %q", prompt)
+	}
+
+	// The language of a session takes precedence, in that session only
+	cm.ApplyChatEvent(&SessionStartedEvent{SessionID: "french", Title: "Practice", Timestamp: ts.Add(time.Second)})
+	if err := cm.ApplyChatEvent(&SessionLanguageSetEvent{SessionID: "french", Language: "French"}); err != nil {
+		t.Fatalf("Setting the session language failed: %v", err)
+	}
+	cm.ApplyChatEvent(&UserRequestReceivedEvent{RequestID: "req2", RequestText: "hello", Language: "english", Timestamp: ts.Add(2 * time.Second)})
+	if prompt := cm.GetLLMContext(nil)[0].Content; !strings.Contains(prompt, "Respond in French") {
+		t.Errorf("Expected responses in the session's language, got %q", prompt)
+	}
+	cm.SwitchSession(DefaultSessionID)
+	if prompt := cm.GetLLMContext(nil)[0].Content; !strings.Contains(prompt, "Respond in Dutch") {
+		t.Errorf("Expected the default session to keep the spoken language, got %q", prompt)
+	}
+	if err := cm.SetSessionLanguage("missing", "German"); err == nil {
+		t.Error("Expected an error setting the language of an unknown session")
+	}
+}
+
+func TestSpeakers_LabeledInLLMContext(t *testing.T) {
+	cm := NewChatManager(1000, "base")
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	cm.ApplyChatEvent(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "add milk to the list", Timestamp: ts})
+	messages := cm.GetLLMContext(nil)
+	if messages[0].Content != "base" || messages[1].Content != "add milk to the list" {
+		t.Errorf("Expected requests without a speaker unlabeled, got %+v", messages)
+	}
+
+	cm.ApplyChatEvent(&UserRequestReceivedEvent{RequestID: "req2", RequestText: "what is on my agenda?", Speaker: "Robin", Timestamp: ts.Add(time.Second)})
+	messages = cm.GetLLMContext(nil)
+	if !strings.Contains(messages[0].Content, "Several people") {
+		t.Errorf("Expected the system prompt to mention several speakers, got %q", messages[0].Content)
+	}
+	if last := messages[len(messages)-1]; last.Content != "Robin: what is on my agenda?" {
+		t.Errorf("Expected the request labeled with its speaker, got %q", last.Content)
+	}
+}
+
+func TestAgentHistory_ScopedToAgentAndSession(t *testing.T) {
+	cm := NewChatManager(1000, "base")
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	apply := func(event interface{}) {
+		t.Helper()
+		if err := cm.ApplyChatEvent(event); err != nil {
+			t.Fatalf("ApplyChatEvent failed: %v", err)
+		}
+	}
+
+	// Two agents work on req1, so their tool calls are told apart by agent name
+	apply(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "Plan lunch", Timestamp: ts})
+	apply(&AgentCallDecidedEvent{RequestID: "req1", AgentName: "taskmanager", Query: "Add a lunch task", Timestamp: ts})
+	apply(&AgentCallDecidedEvent{RequestID: "req1", AgentName: "calendar", Query: "Block lunch", Timestamp: ts})
+	apply(&AgentToolCallEvent{RequestID: "req1", ToolCallID: "t1", AgentName: "taskmanager", Function: "CreateTask", Arguments: map[string]interface{}{"Title": "Lunch"}, Timestamp: ts})
+	apply(&AgentToolCallEvent{RequestID: "req1", ToolCallID: "t2", AgentName: "calendar", Function: "CreateEvent", Timestamp: ts})
+	apply(&ToolCallFailedEvent{RequestID: "req1", ToolCallID: "t1", ErrorMsg: "timeout", Timestamp: ts})
+	apply(&AgentToolCallEvent{RequestID: "req1", ToolCallID: "t1", AgentName: "taskmanager", Function: "CreateTask", Arguments: map[string]interface{}{"Title": "Lunch"}, Timestamp: ts})
+	apply(&ToolCallCompleted{RequestID: "req1", ToolCallID: "t1", Function: "CreateTask", Results: map[string]interface{}{"TaskID": "task_1"}, Timestamp: ts})
+	apply(&AgentCallCompletedEvent{RequestID: "req1", AgentName: "taskmanager", Summary: "Added the lunch task", Timestamp: ts})
+
+	// A request in another session is not remembered
+	apply(&SessionStartedEvent{SessionID: "work", Title: "Work", Timestamp: ts})
+	apply(&UserRequestReceivedEvent{RequestID: "req2", RequestText: "Add a report task", Timestamp: ts})
+	apply(&AgentCallDecidedEvent{RequestID: "req2", AgentName: "taskmanager", Query: "Add a report task", Timestamp: ts})
+	apply(&SessionSwitchedEvent{SessionID: DefaultSessionID, Timestamp: ts})
+
+	apply(&UserRequestReceivedEvent{RequestID: "req3", RequestText: "Move it to 1pm", Timestamp: ts})
+	apply(&AgentCallDecidedEvent{RequestID: "req3", AgentName: "taskmanager", Query: "Move the lunch task", Timestamp: ts})
+
+	var got []string
+	for _, msg := range cm.AgentHistory("taskmanager", "req3", 1000) {
+		got = append(got, msg.Role+": "+msg.Content)
+	}
+	expected := []string{
+		"user: Add a lunch task",
+		`assistant: Called CreateTask with {"Title":"Lunch"}`,
+		`tool: {"TaskID":"task_1"}`,
+		"assistant: Added the lunch task",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected history\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	if history := cm.AgentHistory("taskmanager", "req3", 5); len(history) != 0 {
+		t.Errorf("Expected turns over the budget to be left out, got %v", history)
+	}
+}
+
+func TestSummary_ReplacesOldestMessagesInContext(t *testing.T) {
+	cm := NewChatManager(200, "base")
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	cm.AddMessageAt(ts, RoleUser, "My dog is called Rex", "req1", "", nil)
+	if _, ok := cm.PendingSummary(); ok {
+		t.Fatal("Expected nothing to summarize while the history fits")
+	}
+	for i := 0; i < 10; i++ {
+		cm.AddMessageAt(ts.Add(time.Duration(i+1)*time.Minute), RoleUser, "Talking about the weather "+strings.Repeat("x", 60), "req2", "", nil)
+	}
+
+	input, ok := cm.PendingSummary()
+	if !ok {
+		t.Fatal("Expected the overflowing history to be summarized")
+	}
+	if input.SessionID != DefaultSessionID || input.Messages[0].Content != "My dog is called Rex" || len(input.Messages) >= 11 {
+		t.Fatalf("Expected the oldest messages to be summarized, got %d messages starting with %q", len(input.Messages), input.Messages[0].Content)
+	}
+
+	last := input.Messages[len(input.Messages)-1]
+	if err := cm.ApplyChatEvent(&ConversationSummarizedEvent{
+		SessionID:       DefaultSessionID,
+		Summary:         "The user's dog is called Rex.",
+		ThroughTime:     last.Timestamp,
+		ThroughSequence: last.Sequence,
+		Timestamp:       ts.Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("ApplyChatEvent failed: %v", err)
+	}
+
+	context := cm.GetLLMContext(nil)
+	if !strings.Contains(context[1].Content, "The user's dog is called Rex.") {
+		t.Errorf("Expected the summary right after the system prompt, got %q", context[1].Content)
+	}
+	for _, msg := range context[2:] {
+		if msg.Content == "My dog is called Rex" {
+			t.Error("Expected the summarized message to be left out")
+		}
+	}
+	if len(context) != 2+11-len(input.Messages) {
+		t.Errorf("Expected the unsummarized messages to be kept, got %d messages", len(context))
+	}
+	if len(cm.GetUIMessages()) != 11 {
+		t.Error("Expected the chat to keep showing the summarized messages")
+	}
+}
+
+func TestPluginCreationProgress_ShownButNotInContext(t *testing.T) {
+	cm := NewChatManager(1000, "base")
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	cm.ApplyChatEvent(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "make a drinks plugin", Timestamp: ts})
+	cm.ApplyChatEvent(&PluginCreationProgressEvent{RequestID: "req1", PluginName: "drinks", Message: "compiling", Timestamp: ts.Add(time.Second)})
+
+	messages := cm.GetUIMessages()
+	if len(messages) != 2 || messages[1].Content != "Plugin drinks: compiling" {
+		t.Fatalf("Expected the progress to be shown, got %+v", messages)
+	}
+	for _, msg := range cm.GetLLMContext(nil) {
+		if strings.Contains(msg.Content, "compiling") {
+			t.Errorf("Expected the progress to stay out of the LLM context, got %+v", msg)
+		}
+	}
+}
+
+func TestLLMStatus_ShownButNotInContext(t *testing.T) {
+	cm := NewChatManager(1000, "base")
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	cm.ApplyChatEvent(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "what's on today?", Timestamp: ts})
+	cm.ApplyChatEvent(&LLMStatusChangedEvent{Status: "offline", Message: "The LLM at http://localhost:11434 is offline", Timestamp: ts.Add(time.Second)})
+
+	messages := cm.GetUIMessages()
+	if len(messages) != 2 || messages[1].Content != "The LLM at http://localhost:11434 is offline" || messages[1].Metadata["status"] != "offline" {
+		t.Fatalf("Expected the status to be shown, got %+v", messages)
+	}
+	for _, msg := range cm.GetLLMContext(nil) {
+		if strings.Contains(msg.Content, "offline") {
+			t.Errorf("Expected the status to stay out of the LLM context, got %+v", msg)
+		}
+	}
+}
+
+func TestToolCallCompleted_SummaryReplacesLargeResults(t *testing.T) {
+	cm := NewChatManager(1000, "base")
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	cm.ApplyChatEvent(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "list my tasks", Timestamp: ts})
+	results := map[string]interface{}{"tasks": strings.Repeat("task ", 500)}
+	cm.ApplyChatEvent(&ToolCallCompleted{RequestID: "req1", ToolCallID: "tool1", Function: "listTasks", Results: results, Summary: "500 tasks, all open", Timestamp: ts.Add(time.Second)})
+
+	messages := cm.GetUIMessages()
+	if len(messages) != 2 || messages[1].Content != "500 tasks, all open" {
+		t.Fatalf("Expected the summary shown, got %+v", messages)
+	}
+	if full, _ := messages[1].Metadata["full_result"].(string); !strings.Contains(full, "task task") {
+		t.Errorf("Expected the full results kept in the metadata, got %q", full)
+	}
+	for _, msg := range cm.GetLLMContext(nil) {
+		if strings.Contains(msg.Content, "task task") {
+			t.Errorf("Expected the full results to stay out of the LLM context, got %+v", msg)
+		}
+	}
+}
+
+func TestRevisions_ReplaceEditedRequestsInContext(t *testing.T) {
+	cm := NewChatManager(1000, "base")
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	cm.ApplyChatEvent(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "add mlk to the list", Timestamp: ts})
+	cm.ApplyChatEvent(&RequestCompletedEvent{RequestID: "req1", ResponseText: "Added mlk", Timestamp: ts.Add(time.Second)})
+	cm.ApplyChatEvent(&UserRequestReceivedEvent{RequestID: "req2", RequestText: "add milk to the list", Revises: "req1", Timestamp: ts.Add(2 * time.Second)})
+	cm.ApplyChatEvent(&UserRequestReceivedEvent{RequestID: "req3", RequestText: "add oat milk to the list", Revises: "req2", Timestamp: ts.Add(3 * time.Second)})
+
+	// The history keeps every revision, linked to each other
+	messages := cm.GetUIMessages()
+	if len(messages) != 4 || messages[0].Metadata["revised_by"] != "req2" || messages[2].Metadata["revises"] != "req1" {
+		t.Fatalf("Expected all revisions shown and linked, got %+v", messages)
+	}
+	for _, requestID := range []string{"req1", "req2", "req3"} {
+		if chain := cm.RevisionChain(requestID); strings.Join(chain, ",") != "req1,req2,req3" {
+			t.Errorf("Expected the chain of %s from the first request to the latest revision, got %v", requestID, chain)
+		}
+	}
+
+	// The LLM only sees the latest revision
+	context := cm.GetLLMContext(nil)
+	if len(context) != 2 || context[1].Content != "add oat milk to the list" {
+		t.Errorf("Expected only the latest revision in the context, got %+v", context)
+	}
+}
+
+func TestSearchMessages(t *testing.T) {
+	cm := NewChatManager(1000, "base")
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	cm.ApplyChatEvent(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "Book the Dentist appointment #health", Timestamp: ts})
+	cm.ApplyChatEvent(&RequestCompletedEvent{RequestID: "req1", ResponseText: "The dentist appointment is on Friday", Timestamp: ts.Add(time.Minute)})
+	cm.StartSession("work", "Work", ts.Add(time.Hour))
+	cm.ApplyChatEvent(&UserRequestReceivedEvent{RequestID: "req2", RequestText: "Move the appointment with the dentist", Timestamp: ts.Add(24 * time.Hour)})
+	cm.AddMessageAt(ts.Add(25*time.Hour), RoleAgent, "Dentist appointment moved", "req2", "calendar", nil)
+
+	for name, tc := range map[string]struct {
+		query MessageQuery
+		want  []string
+	}{
+		"words in any order": {MessageQuery{Text: "dentist APPOINTMENT"}, []string{"Book the Dentist appointment #health", "The dentist appointment is on Friday", "Move the appointment with the dentist", "Dentist appointment moved"}},
+		"role":               {MessageQuery{Text: "dentist", Role: "user"}, []string{"Book the Dentist appointment #health", "Move the appointment with the dentist"}},
+		"agent":              {MessageQuery{Text: "dentist", Agent: "calendar"}, []string{"Dentist appointment moved"}},
+		"tag":                {MessageQuery{Tag: "#Health"}, []string{"Book the Dentist appointment #health"}},
+		"session":            {MessageQuery{Text: "dentist", SessionID: "work"}, []string{"Move the appointment with the dentist", "Dentist appointment moved"}},
+		"date range":         {MessageQuery{Text: "dentist", From: ts.Add(time.Minute), To: ts.Add(24 * time.Hour)}, []string{"The dentist appointment is on Friday", "Move the appointment with the dentist"}},
+		"most recent":        {MessageQuery{Text: "dentist", Limit: 1}, []string{"Dentist appointment moved"}},
+		"no match":           {MessageQuery{Text: "dentist invoice"}, nil},
+	} {
+		var got []string
+		for _, msg := range cm.SearchMessages(tc.query) {
+			got = append(got, msg.Content)
+		}
+		if strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("%s: expected %q, got %q", name, tc.want, got)
+		}
+	}
+}
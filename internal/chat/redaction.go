@@ -0,0 +1,76 @@
+package chat
+
+import (
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// MessageRedactedEvent hides the messages of a request, or scrubs a text from the messages, optionally only
+// from those of one request
+type MessageRedactedEvent struct {
+	RequestID string
+	Text      string // Scrubbed text, the whole content of the request's messages if empty
+	Timestamp time.Time
+}
+
+// applyRedaction replaces the redacted content of the messages, the agents' turns and the summaries, and
+// takes it out of the memory
+func (cm *ChatManager) applyRedaction(e *MessageRedactedEvent) {
+	redaction := eventsourcing.Redaction{RequestID: e.RequestID, Text: e.Text}
+	if redaction.Text == "" && redaction.RequestID == "" {
+		return
+	}
+	redact := func(s string) string {
+		if redaction.Text == "" {
+			return eventsourcing.Redacted
+		}
+		return eventsourcing.Scrub(s, redaction.Text)
+	}
+	for _, messages := range cm.messages {
+		for i := range messages {
+			msg := &messages[i]
+			if !redaction.Covers(msg.RequestID) {
+				continue
+			}
+			content := redact(msg.Content)
+			if content == msg.Content {
+				continue
+			}
+			msg.Content = content
+			if msg.Metadata == nil {
+				msg.Metadata = make(map[string]interface{})
+			}
+			msg.Metadata["redacted"] = true
+			if full, ok := msg.Metadata["full_result"].(string); ok {
+				msg.Metadata["full_result"] = redact(full)
+			}
+			if cm.memory != nil {
+				cm.memory.Remove(msg.ID)
+				if redaction.Text != "" {
+					cm.index(*msg)
+				}
+			}
+		}
+	}
+	turns := cm.requestTurns[redaction.RequestID]
+	if redaction.RequestID == "" {
+		for _, agentTurns := range cm.agentTurns {
+			turns = append(turns, agentTurns...)
+		}
+	}
+	for _, turn := range turns {
+		turn.Query, turn.Response = redact(turn.Query), redact(turn.Response)
+		for _, call := range turn.ToolCalls {
+			call.Result = redact(call.Result)
+			if redaction.Text == "" {
+				call.Arguments = nil
+			}
+		}
+	}
+	if redaction.RequestID == "" {
+		for _, summary := range cm.summaries {
+			summary.content = redact(summary.content)
+		}
+	}
+}
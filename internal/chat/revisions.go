@@ -0,0 +1,54 @@
+package chat
+
+// A request the user edited and resubmitted stays in the history as it was sent. The revision is a new
+// request linked to it; the LLM only sees the latest revision and the answers to it.
+
+// applyRevision links a request to the request it edits, marking the edited request's message
+func (cm *ChatManager) applyRevision(requestID, revises string) {
+	cm.revisedBy[revises] = requestID
+	messages := cm.messages[""]
+	for i := range messages {
+		if messages[i].RequestID != revises || messages[i].Role != RoleUser {
+			continue
+		}
+		if messages[i].Metadata == nil {
+			messages[i].Metadata = make(map[string]interface{})
+		}
+		messages[i].Metadata["revised_by"] = requestID
+	}
+}
+
+// isRevised reports whether the message belongs to a request that was edited since
+func (cm *ChatManager) isRevised(msg Message) bool {
+	_, revised := cm.revisedBy[msg.RequestID]
+	return revised
+}
+
+// UserRequest returns the message the user sent a request with
+func (cm *ChatManager) UserRequest(requestID string) (Message, bool) {
+	for _, msg := range cm.messages[""] {
+		if msg.RequestID == requestID && msg.Role == RoleUser {
+			return msg, true
+		}
+	}
+	return Message{}, false
+}
+
+// RevisionChain returns the requests a request is a revision of or was revised by, from the first as
+// sent to the latest revision; just the request when it was never edited
+func (cm *ChatManager) RevisionChain(requestID string) []string {
+	first := requestID
+	for {
+		msg, ok := cm.UserRequest(first)
+		revises, _ := msg.Metadata["revises"].(string)
+		if !ok || revises == "" {
+			break
+		}
+		first = revises
+	}
+	chain := []string{first}
+	for next, ok := cm.revisedBy[first]; ok; next, ok = cm.revisedBy[next] {
+		chain = append(chain, next)
+	}
+	return chain
+}
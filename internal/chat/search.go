@@ -0,0 +1,86 @@
+package chat
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// MessageQuery selects the messages SearchMessages returns; empty fields match every message
+type MessageQuery struct {
+	Text      string    // Words the message contains, in any order and case
+	Role      string    // Role of the message, as the LLM or the UI names it, e.g. "user" or "You"
+	Agent     string    // Agent the message belongs to, "mindpalace" for the core conversation
+	Tag       string    // Tag of the message, or a #tag in its text
+	SessionID string    // Session the message belongs to, every session if empty
+	From      time.Time // Earliest time of the message
+	To        time.Time // Latest time of the message
+	Limit     int       // Number of most recent matches returned, all if 0
+}
+
+// SearchMessages returns the visible messages matching the query, oldest first
+func (cm *ChatManager) SearchMessages(query MessageQuery) []Message {
+	words := strings.Fields(strings.ToLower(query.Text))
+	tag := strings.ToLower(strings.TrimPrefix(query.Tag, "#"))
+	var matches []Message
+	for agent, agentMsgs := range cm.messages {
+		if query.Agent != "" && !strings.EqualFold(query.Agent, agentName(agent)) {
+			continue
+		}
+		for _, msg := range agentMsgs {
+			if msg.Visible && query.matches(msg, words, tag) {
+				matches = append(matches, msg)
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return messageBefore(matches[i], matches[j])
+	})
+	if query.Limit > 0 && len(matches) > query.Limit {
+		matches = matches[len(matches)-query.Limit:]
+	}
+	return matches
+}
+
+// matches reports whether the message matches the query apart from its agent, with the words and tag lowercased
+func (q MessageQuery) matches(msg Message, words []string, tag string) bool {
+	if q.Role != "" && !strings.EqualFold(q.Role, msg.Role.SystemRole) && !strings.EqualFold(q.Role, msg.Role.UIRole) {
+		return false
+	}
+	if q.SessionID != "" && msg.SessionID != q.SessionID {
+		return false
+	}
+	if (!q.From.IsZero() && msg.Timestamp.Before(q.From)) || (!q.To.IsZero() && msg.Timestamp.After(q.To)) {
+		return false
+	}
+	content := strings.ToLower(msg.Content)
+	for _, word := range words {
+		if !strings.Contains(content, word) {
+			return false
+		}
+	}
+	return tag == "" || hasTag(msg, content, tag)
+}
+
+// hasTag reports whether the message carries the tag or mentions it as a #tag in its lowercased content
+func hasTag(msg Message, content, tag string) bool {
+	for _, msgTag := range msg.Tags {
+		if strings.EqualFold(strings.TrimPrefix(msgTag, "#"), tag) {
+			return true
+		}
+	}
+	for _, field := range strings.Fields(content) {
+		if strings.TrimRight(field, ".,;:!?") == "#"+tag {
+			return true
+		}
+	}
+	return false
+}
+
+// agentName names the agent of a message history, the core conversation is "mindpalace"
+func agentName(agent string) string {
+	if agent == "" {
+		return "mindpalace"
+	}
+	return agent
+}
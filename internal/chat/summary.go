@@ -0,0 +1,102 @@
+package chat
+
+import (
+	"sort"
+	"time"
+
+	"mindpalace/pkg/llmmodels"
+)
+
+// ConversationSummarizedEvent rolls the oldest messages of a session, up to and including the
+// message it names, into a summary replacing them in the LLM context
+type ConversationSummarizedEvent struct {
+	SessionID       string
+	Summary         string
+	ThroughTime     time.Time // Timestamp of the last summarized message
+	ThroughSequence int       // Sequence of the last summarized message
+	Timestamp       time.Time
+}
+
+// conversationSummary is the summary of the oldest messages of a session
+type conversationSummary struct {
+	content         string
+	throughTime     time.Time
+	throughSequence int
+}
+
+// covers reports whether the message was rolled into the summary
+func (s *conversationSummary) covers(msg Message) bool {
+	return !messageBefore(Message{Timestamp: s.throughTime, Sequence: s.throughSequence}, msg)
+}
+
+// SummaryInput is the part of a session's history that should be rolled into its summary
+type SummaryInput struct {
+	SessionID string
+	Previous  string    // Summary of the messages before these, rolled into the new one
+	Messages  []Message // Oldest unsummarized messages, in chronological order
+}
+
+// PendingSummary returns the messages of the active session to summarize once its unsummarized history
+// no longer fits in the LLM context. The most recent half of the context is left as it is.
+func (cm *ChatManager) PendingSummary() (SummaryInput, bool) {
+	messages := cm.unsummarized(cm.activeSession)
+	total := 0
+	for _, msg := range messages {
+		total += cm.countTokens(msg.Content)
+	}
+	if total <= cm.maxTokens {
+		return SummaryInput{}, false
+	}
+	start := cm.recentStart(messages, cm.maxTokens/2)
+	if start == 0 {
+		return SummaryInput{}, false
+	}
+	input := SummaryInput{SessionID: cm.activeSession, Messages: messages[:start]}
+	if summary, exists := cm.summaries[cm.activeSession]; exists {
+		input.Previous = summary.content
+	}
+	return input, true
+}
+
+// unsummarized returns the messages of a session the LLM sees that are not in its summary, oldest first
+func (cm *ChatManager) unsummarized(sessionID string) []Message {
+	var messages []Message
+	for _, agentMsgs := range cm.messages {
+		for _, msg := range agentMsgs {
+			if msg.Role != RoleHidden && msg.SessionID == sessionID && !cm.isSummarized(msg) {
+				messages = append(messages, msg)
+			}
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messageBefore(messages[i], messages[j])
+	})
+	return messages
+}
+
+// isSummarized reports whether the message was rolled into the summary of its session
+func (cm *ChatManager) isSummarized(msg Message) bool {
+	summary, exists := cm.summaries[msg.SessionID]
+	return exists && summary.covers(msg)
+}
+
+// summaryMessage returns the summary of the active session as an LLM message
+func (cm *ChatManager) summaryMessage() (llmmodels.Message, bool) {
+	summary, exists := cm.summaries[cm.activeSession]
+	if !exists || summary.content == "" {
+		return llmmodels.Message{}, false
+	}
+	return llmmodels.Message{
+		Role:    string(RoleSystem.SystemRole),
+		Content: "Summary of the earlier conversation:\n" + summary.content,
+	}, true
+}
+
+// applySummary replaces the summarized messages of a session with the summary
+func (cm *ChatManager) applySummary(e *ConversationSummarizedEvent) {
+	cm.summaries[e.SessionID] = &conversationSummary{
+		content:         e.Summary,
+		throughTime:     e.ThroughTime,
+		throughSequence: e.ThroughSequence,
+	}
+}
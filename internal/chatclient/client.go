@@ -0,0 +1,203 @@
+// Package chatclient talks to a running MindPalace over its HTTP API, for the mindpalace chat REPL.
+package chatclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"mindpalace/internal/httpapi"
+)
+
+// Event is an event received from the API
+type Event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Client calls the HTTP API of a running MindPalace
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient creates a client for the API at addr: host:port, a URL, or unix:/path for a Unix socket
+func NewClient(addr string) *Client {
+	network, address := httpapi.ListenAddress(addr)
+	if network == "unix" {
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", address)
+			},
+		}
+		return &Client{baseURL: "http://mindpalace", http: &http.Client{Transport: transport}}
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return &Client{baseURL: strings.TrimSuffix(addr, "/"), http: &http.Client{}}
+}
+
+// SetToken authenticates the client's requests with the token of a user, for MindPalace instances
+// shared with a household
+func (c *Client) SetToken(token string) {
+	if token == "" {
+		return
+	}
+	transport := c.http.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	c.http.Transport = bearerTransport{token: token, next: transport}
+}
+
+// bearerTransport sends a token along with every request
+type bearerTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (t bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.next.RoundTrip(req)
+}
+
+// Stream reads the events of a submitted request until it completes or is cancelled
+type Stream struct {
+	RequestID string
+	body      io.ReadCloser
+	scanner   *bufio.Scanner
+}
+
+// Submit starts processing a request and streams its events. The stream ends when ctx is done.
+func (c *Client) Submit(ctx context.Context, text, sessionID string) (*Stream, error) {
+	body, _ := json.Marshal(map[string]interface{}{"text": text, "stream": true, "session_id": sessionID})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/requests", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	return &Stream{RequestID: resp.Header.Get("X-Request-ID"), body: resp.Body, scanner: scanner}, nil
+}
+
+// Next returns the next event of the request, io.EOF once the stream ended
+func (s *Stream) Next() (Event, error) {
+	var event Event
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event.Type = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.Data = append(event.Data, strings.TrimPrefix(line, "data: ")...)
+		case line == "" && event.Type != "":
+			return event, nil
+		}
+	}
+	if err := s.scanner.Err(); err != nil {
+		return Event{}, err
+	}
+	return Event{}, io.EOF
+}
+
+// Close stops reading the stream
+func (s *Stream) Close() error {
+	return s.body.Close()
+}
+
+// Cancel cancels a request in progress
+func (c *Client) Cancel(requestID string) error {
+	return c.post("/api/requests/"+url.PathEscape(requestID)+"/cancel", nil)
+}
+
+// Confirm approves or rejects a tool call waiting for confirmation
+func (c *Client) Confirm(toolCallID string, approved bool) error {
+	return c.post("/api/toolcalls/"+url.PathEscape(toolCallID)+"/confirm", map[string]bool{"approved": approved})
+}
+
+// Events lists the last limit stored events, only those of eventType unless it is empty
+func (c *Client) Events(eventType string, limit int) ([]Event, error) {
+	query := url.Values{"limit": {strconv.Itoa(maxEvents)}}
+	if eventType != "" {
+		query.Set("type", eventType)
+	}
+	var events []Event
+	if err := c.get("/api/events?"+query.Encode(), &events); err != nil {
+		return nil, err
+	}
+	if len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	return events, nil
+}
+
+// maxEvents bounds the events fetched to find the last ones, as the API pages from the oldest
+const maxEvents = 100000
+
+// Aggregates lists the IDs of the registered aggregates
+func (c *Client) Aggregates() ([]string, error) {
+	var ids []string
+	err := c.get("/api/aggregates", &ids)
+	return ids, err
+}
+
+// Aggregate decodes the state of an aggregate into v
+func (c *Client) Aggregate(name string, v interface{}) error {
+	return c.get("/api/aggregates/"+url.PathEscape(name), v)
+}
+
+func (c *Client) get(path string, v interface{}) error {
+	resp, err := c.http.Get(c.baseURL + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *Client) post(path string, v interface{}) error {
+	body, _ := json.Marshal(v)
+	resp, err := c.http.Post(c.baseURL+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// responseError reads the error the API answered with
+func responseError(resp *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == "" {
+		return fmt.Errorf("API answered %s", resp.Status)
+	}
+	return fmt.Errorf("%s", body.Error)
+}
@@ -0,0 +1,342 @@
+package chatclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"mindpalace/internal/chat"
+)
+
+// maxHistory is how many of the last lines typed are kept in the history file
+const maxHistory = 500
+
+const helpText = `Type a request to send it to MindPalace, or a command:
+  /tasks [status]        list the tasks, only those with the status if given
+  /events [type] [n]     show the last n events (default 20), only those of the type if given
+  /aggregates            list the aggregates
+  /session [id]          show or set the chat session requests are sent to
+  /history [n]           show the last n lines typed (default 20)
+  /help                  show this help
+  /quit                  leave
+Press Ctrl-C to cancel the request in progress.`
+
+// History holds the lines typed in the REPL, kept in a file across runs
+type History struct {
+	path  string
+	lines []string
+}
+
+// LoadHistory reads the history from path; without a path the history is not kept
+func LoadHistory(path string) (*History, error) {
+	h := &History{path: path}
+	if path == "" {
+		return h, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			h.lines = append(h.lines, line)
+		}
+	}
+	return h, nil
+}
+
+// Add appends a line to the history and saves it
+func (h *History) Add(line string) error {
+	if n := len(h.lines); n > 0 && h.lines[n-1] == line {
+		return nil
+	}
+	h.lines = append(h.lines, line)
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[len(h.lines)-maxHistory:]
+	}
+	if h.path == "" {
+		return nil
+	}
+	return os.WriteFile(h.path, []byte(strings.Join(h.lines, "\n")+"\n"), 0600)
+}
+
+// Last returns the last n lines
+func (h *History) Last(n int) []string {
+	return h.lines[max(0, len(h.lines)-n):]
+}
+
+// REPL reads requests and commands from the terminal and shows the answers as they stream in
+type REPL struct {
+	client    *Client
+	history   *History
+	out       io.Writer
+	sessionID string
+
+	mu      sync.Mutex
+	running string // Request in progress, empty when idle
+}
+
+// NewREPL creates a REPL writing to out
+func NewREPL(client *Client, history *History, out io.Writer) *REPL {
+	return &REPL{client: client, history: history, out: out}
+}
+
+// SetSession sends the requests to a chat session, the active one when empty
+func (r *REPL) SetSession(sessionID string) {
+	r.sessionID = sessionID
+}
+
+// Run reads lines from in until it ends or the user quits
+func (r *REPL) Run(ctx context.Context, in io.Reader) error {
+	lines := bufio.NewScanner(in)
+	fmt.Fprintln(r.out, "MindPalace chat, /help lists the commands.")
+	for r.prompt(); lines.Scan(); r.prompt() {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" {
+			continue
+		}
+		if err := r.history.Add(line); err != nil {
+			fmt.Fprintf(r.out, "Failed to save the history: %v\n", err)
+		}
+		if strings.HasPrefix(line, "/") {
+			if quit := r.command(line); quit {
+				return nil
+			}
+			continue
+		}
+		if err := r.ask(ctx, line, lines); err != nil {
+			fmt.Fprintf(r.out, "Error: %v\n", err)
+		}
+	}
+	return lines.Err()
+}
+
+// Interrupt cancels the request in progress, reporting whether there was one
+func (r *REPL) Interrupt() bool {
+	r.mu.Lock()
+	requestID := r.running
+	r.mu.Unlock()
+	if requestID == "" {
+		return false
+	}
+	if err := r.client.Cancel(requestID); err != nil {
+		fmt.Fprintf(r.out, "\nFailed to cancel: %v\n", err)
+	}
+	return true
+}
+
+func (r *REPL) prompt() {
+	fmt.Fprint(r.out, "> ")
+}
+
+// streamedEvent holds the fields of the events shown while a request is processed
+type streamedEvent struct {
+	PartialContent string `json:"partial_content"`
+	IsFinal        bool   `json:"is_final"`
+	ToolCallID     string `json:"tool_call_id"`
+	Function       string `json:"function"`
+	Prompt         string `json:"prompt"`
+	ErrorMsg       string `json:"error_msg"`
+	PluginName     string `json:"plugin_name"`
+	Message        string `json:"message"`
+	ResponseText   string `json:"response_text"`
+}
+
+// ask submits a request and prints its answer as it is generated. Confirmations the request
+// asks for are answered from lines.
+func (r *REPL) ask(ctx context.Context, text string, lines *bufio.Scanner) error {
+	stream, err := r.client.Submit(ctx, text, r.sessionID)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	r.setRunning(stream.RequestID)
+	defer r.setRunning("")
+
+	streamed, answer := "", "" // Visible text of the LLM call streaming in, and of the last finished one
+	for {
+		event, err := stream.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var e streamedEvent
+		json.Unmarshal(event.Data, &e)
+
+		switch event.Type {
+		case "llm_stream":
+			text := visibleText(e.PartialContent)
+			if strings.HasPrefix(text, streamed) {
+				fmt.Fprint(r.out, text[len(streamed):])
+			} else {
+				fmt.Fprint(r.out, "\n"+text)
+			}
+			streamed = text
+			if e.IsFinal {
+				if streamed != "" {
+					fmt.Fprintln(r.out)
+				}
+				streamed, answer = "", streamed
+			}
+		case "orchestration_ToolCallStarted":
+			r.note(&streamed, "running %s", e.Function)
+		case "orchestration_ToolCallFailed":
+			r.note(&streamed, "%s failed: %s", e.Function, e.ErrorMsg)
+		case "orchestration_PluginCreationProgress":
+			r.note(&streamed, "plugin %s: %s", e.PluginName, e.Message)
+		case "orchestration_ToolCallConfirmationRequested":
+			r.note(&streamed, "%s [y/N]", e.Prompt)
+			approved := lines.Scan() && strings.HasPrefix(strings.ToLower(strings.TrimSpace(lines.Text())), "y")
+			if err := r.client.Confirm(e.ToolCallID, approved); err != nil {
+				fmt.Fprintf(r.out, "Failed to confirm: %v\n", err)
+			}
+		case "orchestration_RequestCancelled":
+			r.note(&streamed, "cancelled")
+		case "orchestration_RequestCompleted":
+			if _, text := chat.ParseResponseText(e.ResponseText); text != "" && text != answer {
+				fmt.Fprintln(r.out, text)
+			}
+		}
+	}
+}
+
+// note prints a line about the progress of the request, after the text streamed so far
+func (r *REPL) note(streamed *string, format string, args ...interface{}) {
+	if *streamed != "" {
+		fmt.Fprintln(r.out)
+		*streamed = ""
+	}
+	fmt.Fprintf(r.out, "· "+format+"\n", args...)
+}
+
+func (r *REPL) setRunning(requestID string) {
+	r.mu.Lock()
+	r.running = requestID
+	r.mu.Unlock()
+}
+
+// visibleText leaves the thinking out of partial LLM output, also while it is still being thought
+func visibleText(content string) string {
+	if start := strings.LastIndex(content, "<think>"); start >= 0 && !strings.Contains(content[start:], "</think>") {
+		content = content[:start]
+	}
+	_, text := chat.ParseResponseText(content)
+	return text
+}
+
+// command runs a slash-command, reporting whether the user quits
+func (r *REPL) command(line string) bool {
+	fields := strings.Fields(line)
+	args := fields[1:]
+	var err error
+	switch fields[0] {
+	case "/quit", "/exit":
+		return true
+	case "/help":
+		fmt.Fprintln(r.out, helpText)
+	case "/tasks":
+		err = r.listTasks(strings.Join(args, " "))
+	case "/events":
+		err = r.listEvents(args)
+	case "/aggregates":
+		var ids []string
+		if ids, err = r.client.Aggregates(); err == nil {
+			sort.Strings(ids)
+			fmt.Fprintln(r.out, strings.Join(ids, "\n"))
+		}
+	case "/session":
+		if len(args) > 0 {
+			r.sessionID = args[0]
+		}
+		if r.sessionID == "" {
+			fmt.Fprintln(r.out, "Requests go to the active session")
+		} else {
+			fmt.Fprintf(r.out, "Requests go to session %s\n", r.sessionID)
+		}
+	case "/history":
+		n := 20
+		if len(args) > 0 {
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 0 {
+				err = fmt.Errorf("usage: /history [n]")
+				break
+			}
+		}
+		for _, line := range r.history.Last(n) {
+			fmt.Fprintln(r.out, line)
+		}
+	default:
+		err = fmt.Errorf("unknown command %s, /help lists the commands", fields[0])
+	}
+	if err != nil {
+		fmt.Fprintf(r.out, "Error: %v\n", err)
+	}
+	return false
+}
+
+// task holds the fields of a task shown by /tasks
+type task struct {
+	TaskID    string `json:"task_id"`
+	Title     string `json:"title"`
+	Status    string `json:"status"`
+	Priority  string `json:"priority"`
+	CreatedAt string `json:"created_at"`
+}
+
+func (r *REPL) listTasks(status string) error {
+	var state struct {
+		Tasks map[string]task `json:"tasks"`
+	}
+	if err := r.client.Aggregate("taskmanager", &state); err != nil {
+		return err
+	}
+	var tasks []task
+	for _, t := range state.Tasks {
+		if status == "" || strings.EqualFold(t.Status, status) {
+			tasks = append(tasks, t)
+		}
+	}
+	if len(tasks) == 0 {
+		fmt.Fprintln(r.out, "No tasks")
+		return nil
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].CreatedAt < tasks[j].CreatedAt })
+	for _, t := range tasks {
+		fmt.Fprintf(r.out, "%-12s %-8s %s (%s)\n", t.Status, t.Priority, t.Title, t.TaskID)
+	}
+	return nil
+}
+
+func (r *REPL) listEvents(args []string) error {
+	eventType, n := "", 20
+	for _, arg := range args {
+		if number, err := strconv.Atoi(arg); err == nil && number >= 0 {
+			n = number
+		} else {
+			eventType = arg
+		}
+	}
+	events, err := r.client.Events(eventType, n)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		data := string(event.Data)
+		if len(data) > 120 {
+			data = data[:117] + "..."
+		}
+		fmt.Fprintf(r.out, "%s %s\n", event.Type, data)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package chatclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAPI answers every request with a scripted stream and records the confirmations
+type fakeAPI struct {
+	mu        sync.Mutex
+	confirmed map[string]bool
+}
+
+func (f *fakeAPI) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/requests", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("X-Request-ID", "req1")
+		send := func(eventType, data string) { fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, data) }
+		send("orchestration_UserRequestReceived", `{"request_id":"req1"}`)
+		send("llm_stream", `{"request_id":"req1","partial_content":"<think>hmm"}`)
+		send("llm_stream", `{"request_id":"req1","partial_content":"<think>hmm</think>Adding"}`)
+		send("llm_stream", `{"request_id":"req1","partial_content":"<think>hmm</think>Adding it","is_final":true}`)
+		if req.Text == "delete it" {
+			send("orchestration_ToolCallConfirmationRequested", `{"request_id":"req1","tool_call_id":"call1","prompt":"Delete the task?"}`)
+			w.(http.Flusher).Flush()
+			// The stream goes on once the tool call was confirmed
+			for {
+				f.mu.Lock()
+				_, done := f.confirmed["call1"]
+				f.mu.Unlock()
+				if done {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+		send("orchestration_ToolCallStarted", `{"request_id":"req1","function":"AddTask"}`)
+		send("orchestration_RequestCompleted", `{"request_id":"req1","response_text":"<think>hmm</think>Adding it"}`)
+	})
+	mux.HandleFunc("POST /api/toolcalls/{id}/confirm", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Approved bool `json:"approved"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		f.confirmed[r.PathValue("id")] = req.Approved
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("GET /api/aggregates/taskmanager", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tasks":{
+			"t2":{"task_id":"t2","title":"Buy milk","status":"Pending","priority":"low","created_at":"2026-01-02T00:00:00Z"},
+			"t1":{"task_id":"t1","title":"Plan dinner","status":"Completed","priority":"high","created_at":"2026-01-01T00:00:00Z"}}}`)
+	})
+	mux.HandleFunc("GET /api/events", func(w http.ResponseWriter, r *http.Request) {
+		events := []string{}
+		for i := 1; i <= 3; i++ {
+			if r.URL.Query().Get("type") == "" || r.URL.Query().Get("type") == "taskmanager_TaskCreated" {
+				events = append(events, fmt.Sprintf(`{"type":"taskmanager_TaskCreated","data":{"n":%d}}`, i))
+			}
+		}
+		fmt.Fprintf(w, "[%s]", strings.Join(events, ","))
+	})
+	return mux
+}
+
+func newTestREPL(t *testing.T) (*REPL, *fakeAPI, *strings.Builder) {
+	api := &fakeAPI{confirmed: make(map[string]bool)}
+	ts := httptest.NewServer(api.handler())
+	t.Cleanup(ts.Close)
+	history, err := LoadHistory(filepath.Join(t.TempDir(), "history"))
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	out := &strings.Builder{}
+	return NewREPL(NewClient(ts.URL), history, out), api, out
+}
+
+func TestREPL_StreamsAnswer(t *testing.T) {
+	repl, _, out := newTestREPL(t)
+	if err := repl.Run(context.Background(), strings.NewReader("add a task\n")); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	got := out.String()
+	if !strings.Contains(got, "Adding it\n· running AddTask\n") {
+		t.Errorf("Expected the streamed answer and the tool call, got %q", got)
+	}
+	if strings.Contains(got, "hmm") || strings.Count(got, "Adding it") != 1 {
+		t.Errorf("Expected the answer once without the thinking, got %q", got)
+	}
+}
+
+func TestREPL_Confirms(t *testing.T) {
+	repl, api, out := newTestREPL(t)
+	if err := repl.Run(context.Background(), strings.NewReader("delete it\ny\n")); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if approved, ok := api.confirmed["call1"]; !ok || !approved {
+		t.Errorf("Expected the tool call to be approved, got %v", api.confirmed)
+	}
+	if !strings.Contains(out.String(), "· Delete the task? [y/N]") {
+		t.Errorf("Expected the confirmation question, got %q", out.String())
+	}
+}
+
+func TestREPL_Commands(t *testing.T) {
+	repl, _, out := newTestREPL(t)
+	input := "/tasks\n/tasks pending\n/events 2\n/session work\n/bogus\n/history\n/quit\nnot sent\n"
+	if err := repl.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"> Completed    high     Plan dinner (t1)\nPending      low      Buy milk (t2)\n> Pending      low      Buy milk (t2)\n> ",
+		`taskmanager_TaskCreated {"n":2}` + "\ntaskmanager_TaskCreated {\"n\":3}\n> ",
+		"Requests go to session work",
+		"unknown command /bogus",
+		"/tasks\n/tasks pending\n/events 2",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected output to contain %q, got %q", want, got)
+		}
+	}
+	if strings.Contains(got, `{"n":1}`) || strings.Contains(got, "Adding") {
+		t.Errorf("Expected only the last events and nothing sent after /quit, got %q", got)
+	}
+}
+
+func TestHistory_KeptAcrossRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	history, _ := LoadHistory(path)
+	for _, line := range []string{"first", "second", "second"} {
+		if err := history.Add(line); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	reloaded, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	if got := strings.Join(reloaded.Last(5), ","); got != "first,second" {
+		t.Errorf("Expected the history without repeats, got %q", got)
+	}
+	if got := strings.Join(reloaded.Last(1), ","); got != "second" {
+		t.Errorf("Expected the last line, got %q", got)
+	}
+}
+
+func TestClient_UnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "mindpalace.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("Unix sockets are not available: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `["taskmanager","orchestration"]`)
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	ids, err := NewClient("unix:" + socket).Aggregates()
+	if err != nil || len(ids) != 2 {
+		t.Errorf("Expected the aggregates over the socket, got %v, %v", ids, err)
+	}
+}
+
+func TestClient_Token(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer alice-token" {
+			http.Error(w, "a valid token is required", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `["taskmanager"]`)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	if _, err := client.Aggregates(); err == nil {
+		t.Error("Expected a client without a token to be refused")
+	}
+	client.SetToken("alice-token")
+	if ids, err := client.Aggregates(); err != nil || len(ids) != 1 {
+		t.Errorf("Expected the aggregates with the token, got %v, %v", ids, err)
+	}
+}
+
+func TestVisibleText(t *testing.T) {
+	tests := map[string]string{
+		"<think>still thinking":      "",
+		"<think>done</think> Answer": "Answer",
+		"Plain":                      "Plain",
+	}
+	for content, want := range tests {
+		if got := visibleText(content); got != want {
+			t.Errorf("visibleText(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
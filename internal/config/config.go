@@ -0,0 +1,558 @@
+// Package config loads the mindpalace.toml configuration file and reloads it when the file
+// changes or the process receives SIGHUP.
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	_ "time/tzdata" // Time zones also where the system has no zoneinfo, like on Windows
+
+	"github.com/BurntSushi/toml"
+	"mindpalace/pkg/cron"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+	"mindpalace/pkg/ui3d"
+)
+
+// DefaultPath is the configuration file read when no other path is given
+const DefaultPath = "mindpalace.toml"
+
+// Config holds the settings that can be changed without recompiling
+type Config struct {
+	Timezone  string                            `toml:"timezone"` // Time zone of the owner, and of users without one; empty is the system's
+	Ollama    OllamaConfig                      `toml:"ollama"`
+	Limits    LimitsConfig                      `toml:"limits"`
+	Plugins   PluginsConfig                     `toml:"plugins"`
+	Plugin    map[string]map[string]interface{} `toml:"plugin"` // Settings per plugin, passed to the plugin
+	Audio     AudioConfig                       `toml:"audio"`
+	Logging   LoggingConfig                     `toml:"logging"`
+	Theme     ThemeConfig                       `toml:"theme"`
+	Godot     GodotConfig                       `toml:"godot"`
+	Briefing  BriefingConfig                    `toml:"briefing"`  // Morning briefing of the owner
+	Users     map[string]UserConfig             `toml:"users"`     // Household members sharing the server, by name
+	MCP       map[string]MCPServerConfig        `toml:"mcp"`       // External MCP servers whose tools the agents are offered, by name
+	Retention RetentionConfig                   `toml:"retention"` // How long events are kept in the event log
+}
+
+// OllamaConfig configures the Ollama server the LLM calls go to
+type OllamaConfig struct {
+	Endpoint         string        `toml:"endpoint"`          // Base URL of the Ollama server
+	Model            string        `toml:"model"`             // Model of the router, and of agents whose plugin doesn't name one
+	EmbedModel       string        `toml:"embed_model"`       // Model computing the embeddings of the semantic memory
+	FallbackEndpoint string        `toml:"fallback_endpoint"` // Base URL of the Ollama server used while the endpoint is down, empty for none
+	FallbackModel    string        `toml:"fallback_model"`    // Model of the calls to the fallback, empty for the models they'd have used
+	HealthInterval   time.Duration `toml:"health_interval"`   // Time between the checks of whether the servers are up
+}
+
+// LimitsConfig configures the token limits of the LLM calls and how long a request may take
+type LimitsConfig struct {
+	ContextTokens        int           `toml:"context_tokens"`         // Context window requested from Ollama
+	HistoryTokens        int           `toml:"history_tokens"`         // Chat history kept in the LLM context
+	RequestTimeout       time.Duration `toml:"request_timeout"`        // Time after which a request fails, 0 waits forever
+	ToolResultTokens     int           `toml:"tool_result_tokens"`     // Size of tool results above which they are condensed in the chat
+	SummarizeToolResults bool          `toml:"summarize_tool_results"` // Condense tool results with the LLM instead of truncating them
+	MaxTools             int           `toml:"max_tools"`              // Agents, and commands of an agent, offered per call, 0 for all
+}
+
+// PluginsConfig configures which plugins the LLM can use
+type PluginsConfig struct {
+	Disabled            []string                        `toml:"disabled"`             // Plugins loaded but not offered to the LLM
+	ConfirmCapabilities []string                        `toml:"confirm_capabilities"` // Capabilities, e.g. "network", of plugins whose commands the user approves
+	External            map[string]ExternalPluginConfig `toml:"external"`             // Plugins running as processes of their own, by name
+}
+
+// ExternalPluginConfig configures a plugin running as a process of its own, talking gRPC, see pkg/pluginrpc
+type ExternalPluginConfig struct {
+	Command string            `toml:"command"` // Command serving the plugin, restarted when it is rebuilt
+	Args    []string          `toml:"args"`    // Arguments of the command
+	Env     map[string]string `toml:"env"`     // Environment variables added for the command, e.g. API keys
+}
+
+// AudioConfig configures voice input
+type AudioConfig struct {
+	InputDevices   []string      `toml:"input_devices"`   // ffmpeg input devices tried before the built-in ones
+	SilenceTimeout time.Duration `toml:"silence_timeout"` // Pause after which spoken requests are submitted
+	BargeIn        bool          `toml:"barge_in"`        // Speaking over a response cancels it and starts a new request
+	Language       string        `toml:"language"`        // Language spoken, e.g. "nl" or "dutch"; auto detects it
+	Diarization    bool          `toml:"diarization"`     // Label requests with who spoke them, for rooms with several people
+}
+
+// LoggingConfig configures the log output
+type LoggingConfig struct {
+	Format     string            `toml:"format"`      // text or json
+	Levels     map[string]string `toml:"levels"`      // Level per subsystem: audio, orchestration, godot_ws or llm
+	File       string            `toml:"file"`        // Log file written next to stdout
+	MaxSizeMB  int               `toml:"max_size_mb"` // Size in MB the log file is rotated at
+	MaxBackups int               `toml:"max_backups"` // Number of rotated log files kept
+}
+
+// ThemeConfig configures the colors of the desktop app and the 3D world
+type ThemeConfig struct {
+	Name     string                   `toml:"name"`     // Palette used until one is picked in the app: dark, light, high-contrast or one of the palettes
+	Palettes map[string]PaletteConfig `toml:"palettes"` // Palettes of the user's own, by name
+}
+
+// PaletteConfig defines a palette of the user's own. Colors are RGB or RGBA with components from 0 to 1; the
+// colors left out are those of the base palette.
+type PaletteConfig struct {
+	Base       string    `toml:"base"` // Built-in palette the palette changes, dark if empty
+	Primary    []float64 `toml:"primary"`
+	Secondary  []float64 `toml:"secondary"`
+	Accent     []float64 `toml:"accent"`
+	Background []float64 `toml:"background"`
+	Text       []float64 `toml:"text"`
+}
+
+// GodotConfig configures how the 3D world is sent to the Godot clients
+type GodotConfig struct {
+	BatchWindow    time.Duration `toml:"batch_window"`   // Deltas of events applied within it are sent in one message, 0 sends each on its own
+	Compression    bool          `toml:"compression"`    // Compress messages with permessage-deflate for clients that support it
+	MaxPayloadSize int           `toml:"max_payload_kb"` // Size in KB above which the full state is sent in several messages, 0 for no limit
+}
+
+// BriefingConfig configures the briefing of the day ahead, composed from the calendar, tasks and unread
+// email and delivered in the chat
+type BriefingConfig struct {
+	Schedule string `toml:"schedule"` // Cron expression of when it is delivered, e.g. "0 7 * * mon-fri"; empty for none
+	Spoken   bool   `toml:"spoken"`   // Read it aloud as well, on the desktop's speech output
+}
+
+// UserConfig configures a household member using MindPalace over the HTTP API or a 3D client
+type UserConfig struct {
+	Token    string         `toml:"token"`    // Secret the user's clients authenticate with
+	Timezone string         `toml:"timezone"` // Time zone dates the user says are in, e.g. Europe/Amsterdam
+	Briefing BriefingConfig `toml:"briefing"` // Morning briefing of the user, on the user's clock
+}
+
+// MCPServerConfig configures an external MCP server, started as a command or reached over SSE
+type MCPServerConfig struct {
+	Command string            `toml:"command"` // Command speaking MCP over stdin and stdout
+	Args    []string          `toml:"args"`    // Arguments of the command
+	Env     map[string]string `toml:"env"`     // Environment variables added for the command, e.g. API keys
+	URL     string            `toml:"url"`     // URL of the server's SSE stream, instead of a command
+	Token   string            `toml:"token"`   // Bearer token sent to the URL
+	Agents  []string          `toml:"agents"`  // Plugins whose agents are offered the tools, all if empty
+}
+
+// RetentionConfig configures the compaction of the event log: old events of the rules' types are dropped or
+// compacted, the others are kept
+type RetentionConfig struct {
+	Interval time.Duration         `toml:"interval"` // Time between compactions, the first runs at startup
+	Rules    []RetentionRuleConfig `toml:"rules"`    // The first rule matching an event applies
+}
+
+// RetentionRuleConfig drops or compacts events of some types once they are a number of days old
+type RetentionRuleConfig struct {
+	Events    []string `toml:"events"`     // Event types, e.g. "orchestration_ToolCallCompleted"; "llm_*" for all of an aggregate
+	AfterDays int      `toml:"after_days"` // Age in days of the events the rule applies to
+	Action    string   `toml:"action"`     // drop, or compact to keep a summary of events like tool call results
+}
+
+// minTokenLength is the length tokens must have at least, so they can't be guessed
+const minTokenLength = 16
+
+// userName matches the names users can be given, they namespace the users' events
+var userName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// mcpServerName matches the names MCP servers can be given, they namespace the servers' tools as
+// name__tool
+var mcpServerName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// WorldToolServer names the tools of the 3D world, which MCP servers can't be named
+const WorldToolServer = "world"
+
+// pluginName matches the names external plugins can be given, they prefix the plugins' events as
+// name_Event
+var pluginName = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+// Default returns the configuration used when there is no configuration file
+func Default() *Config {
+	return &Config{
+		Ollama: OllamaConfig{
+			Endpoint:       "http://localhost:11434",
+			Model:          "gpt-oss:20b",
+			EmbedModel:     "nomic-embed-text",
+			HealthInterval: 30 * time.Second,
+		},
+		Limits: LimitsConfig{
+			ContextTokens:    131072,
+			HistoryTokens:    100000,
+			RequestTimeout:   5 * time.Minute,
+			ToolResultTokens: 2000,
+			MaxTools:         12,
+		},
+		Plugin: make(map[string]map[string]interface{}),
+		Audio: AudioConfig{
+			SilenceTimeout: 2 * time.Second,
+			BargeIn:        true,
+			Language:       "auto",
+		},
+		Logging: LoggingConfig{
+			MaxSizeMB:  10,
+			MaxBackups: 5,
+		},
+		Theme: ThemeConfig{Name: ui3d.ThemeDark},
+		Godot: GodotConfig{
+			BatchWindow:    20 * time.Millisecond,
+			MaxPayloadSize: 512,
+		},
+		Retention: RetentionConfig{Interval: 24 * time.Hour},
+	}
+}
+
+// Load reads the configuration file on top of the defaults. A missing file is not an error.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return cfg, nil
+	}
+	meta, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		return nil, fmt.Errorf("unknown settings in %s: %s", path, strings.Join(keys, ", "))
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks that the settings can be applied
+func (c *Config) Validate() error {
+	endpoint, err := url.Parse(c.Ollama.Endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return fmt.Errorf("ollama.endpoint must be a URL like http://localhost:11434, got %q", c.Ollama.Endpoint)
+	}
+	if c.Ollama.Model == "" {
+		return fmt.Errorf("ollama.model must not be empty")
+	}
+	if c.Ollama.FallbackEndpoint != "" {
+		fallback, err := url.Parse(c.Ollama.FallbackEndpoint)
+		if err != nil || fallback.Scheme == "" || fallback.Host == "" {
+			return fmt.Errorf("ollama.fallback_endpoint must be a URL like http://backup:11434, got %q", c.Ollama.FallbackEndpoint)
+		}
+	}
+	if c.Ollama.HealthInterval <= 0 {
+		return fmt.Errorf("ollama.health_interval must be positive")
+	}
+	if c.Limits.ContextTokens <= 0 || c.Limits.HistoryTokens <= 0 {
+		return fmt.Errorf("limits.context_tokens and limits.history_tokens must be positive")
+	}
+	if c.Limits.ToolResultTokens <= 0 {
+		return fmt.Errorf("limits.tool_result_tokens must be positive")
+	}
+	if c.Limits.MaxTools < 0 {
+		return fmt.Errorf("limits.max_tools must not be negative")
+	}
+	if c.Limits.RequestTimeout < 0 {
+		return fmt.Errorf("limits.request_timeout must not be negative")
+	}
+	if c.Audio.SilenceTimeout < 0 {
+		return fmt.Errorf("audio.silence_timeout must not be negative")
+	}
+	if c.Godot.BatchWindow < 0 || c.Godot.MaxPayloadSize < 0 {
+		return fmt.Errorf("godot.batch_window and godot.max_payload_kb must not be negative")
+	}
+	if _, err := c.LoggingOptions(); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("timezone must be a time zone like Europe/Amsterdam: %v", err)
+	}
+	if err := c.Briefing.validate(); err != nil {
+		return fmt.Errorf("briefing.%v", err)
+	}
+	tokens := make(map[string]string, len(c.Users))
+	for name, user := range c.Users {
+		if !userName.MatchString(name) {
+			return fmt.Errorf("users.%s: names must be lowercase letters, digits, - and _", name)
+		}
+		if len(user.Token) < minTokenLength {
+			return fmt.Errorf("users.%s.token must be at least %d characters", name, minTokenLength)
+		}
+		if other, taken := tokens[user.Token]; taken {
+			return fmt.Errorf("users.%s.token is the token of %s as well", name, other)
+		}
+		tokens[user.Token] = name
+		if _, err := time.LoadLocation(user.Timezone); err != nil {
+			return fmt.Errorf("users.%s.timezone must be a time zone like Europe/Amsterdam: %v", name, err)
+		}
+		if err := user.Briefing.validate(); err != nil {
+			return fmt.Errorf("users.%s.briefing.%v", name, err)
+		}
+	}
+	for name, server := range c.MCP {
+		if !mcpServerName.MatchString(name) {
+			return fmt.Errorf("mcp.%s: names must be lowercase letters, digits and -", name)
+		}
+		if name == WorldToolServer {
+			return fmt.Errorf("mcp.%s: the name is taken by the tools of the 3D world", name)
+		}
+		if (server.Command == "") == (server.URL == "") {
+			return fmt.Errorf("mcp.%s needs either a command or a url", name)
+		}
+		if server.URL != "" {
+			if endpoint, err := url.Parse(server.URL); err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+				return fmt.Errorf("mcp.%s.url must be a URL like http://localhost:8765/sse, got %q", name, server.URL)
+			}
+		}
+	}
+	if c.Retention.Interval <= 0 {
+		return fmt.Errorf("retention.interval must be positive")
+	}
+	for i, rule := range c.Retention.Rules {
+		if len(rule.Events) == 0 || slices.Contains(rule.Events, "") || slices.Contains(rule.Events, "*") {
+			return fmt.Errorf("retention.rules[%d].events must name event types, like \"llm_*\"", i)
+		}
+		if rule.AfterDays <= 0 {
+			return fmt.Errorf("retention.rules[%d].after_days must be positive", i)
+		}
+		if rule.Action != "drop" && rule.Action != "compact" {
+			return fmt.Errorf("retention.rules[%d].action must be drop or compact, got %q", i, rule.Action)
+		}
+		if rule.Action == "drop" && slices.ContainsFunc(rule.Events, dropsOrchestration) {
+			return fmt.Errorf("retention.rules[%d] drops orchestration events, the requests are replayed from them on restart", i)
+		}
+	}
+	palettes, err := c.Palettes()
+	if err != nil {
+		return err
+	}
+	if _, ok := palettes[c.Theme.Name]; !ok {
+		return fmt.Errorf("theme.name must be dark, light, high-contrast or one of theme.palettes, got %q", c.Theme.Name)
+	}
+	for _, capability := range c.Plugins.ConfirmCapabilities {
+		if !slices.Contains(eventsourcing.Capabilities, capability) {
+			return fmt.Errorf("plugins.confirm_capabilities must name capabilities like %s, got %q", strings.Join(eventsourcing.Capabilities, ", "), capability)
+		}
+	}
+	for name, plugin := range c.Plugins.External {
+		if !pluginName.MatchString(name) {
+			return fmt.Errorf("plugins.external.%s: names must be lowercase letters and digits", name)
+		}
+		if plugin.Command == "" {
+			return fmt.Errorf("plugins.external.%s.command is required", name)
+		}
+	}
+	for name, settings := range c.Plugin {
+		if model, ok := settings["model"]; ok {
+			if _, isString := model.(string); !isString {
+				return fmt.Errorf("plugin.%s.model must be a string", name)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks the schedule of a briefing, the error names the setting
+func (b BriefingConfig) validate() error {
+	if b.Schedule == "" {
+		return nil
+	}
+	if _, err := cron.Parse(b.Schedule); err != nil {
+		return fmt.Errorf("schedule must be a cron expression like \"0 7 * * *\": %v", err)
+	}
+	return nil
+}
+
+// Briefings returns the briefing of the owner, under the empty name, and of each configured user that has
+// a schedule
+func (c *Config) Briefings() map[string]BriefingConfig {
+	briefings := make(map[string]BriefingConfig)
+	if c.Briefing.Schedule != "" {
+		briefings[""] = c.Briefing
+	}
+	for name, user := range c.Users {
+		if user.Briefing.Schedule != "" {
+			briefings[name] = user.Briefing
+		}
+	}
+	return briefings
+}
+
+// UserTokens returns the configured users by their token
+func (c *Config) UserTokens() map[string]string {
+	tokens := make(map[string]string, len(c.Users))
+	for name, user := range c.Users {
+		tokens[user.Token] = name
+	}
+	return tokens
+}
+
+// UserNames returns the names of the configured users, sorted
+func (c *Config) UserNames() []string {
+	names := make([]string, 0, len(c.Users))
+	for name := range c.Users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Locations returns the time zone of the owner, under the empty name, and of each configured user
+func (c *Config) Locations() map[string]*time.Location {
+	owner := time.Local
+	if c.Timezone != "" {
+		if loc, err := time.LoadLocation(c.Timezone); err == nil {
+			owner = loc
+		}
+	}
+	locations := map[string]*time.Location{"": owner}
+	for name, user := range c.Users {
+		locations[name] = owner
+		if user.Timezone != "" {
+			if loc, err := time.LoadLocation(user.Timezone); err == nil {
+				locations[name] = loc
+			}
+		}
+	}
+	return locations
+}
+
+// dropsOrchestration reports whether the event type pattern matches events of the orchestration, which
+// keeps no snapshot
+func dropsOrchestration(pattern string) bool {
+	const orchestration = "orchestration_"
+	if prefix, wildcard := strings.CutSuffix(pattern, "*"); wildcard {
+		return strings.HasPrefix(orchestration, prefix) || strings.HasPrefix(prefix, orchestration)
+	}
+	return strings.HasPrefix(pattern, orchestration)
+}
+
+// RetentionRules returns the rules compacting the event log
+func (c *Config) RetentionRules() []eventsourcing.RetentionRule {
+	rules := make([]eventsourcing.RetentionRule, 0, len(c.Retention.Rules))
+	for _, rule := range c.Retention.Rules {
+		rules = append(rules, eventsourcing.RetentionRule{
+			Types:   rule.Events,
+			After:   time.Duration(rule.AfterDays) * 24 * time.Hour,
+			Compact: rule.Action == "compact",
+		})
+	}
+	return rules
+}
+
+// ChatEndpoint returns the URL of the Ollama chat API
+func (c *Config) ChatEndpoint() string {
+	return strings.TrimSuffix(c.Ollama.Endpoint, "/") + "/api/chat"
+}
+
+// FallbackChatEndpoint returns the URL of the fallback's chat API, empty without a fallback
+func (c *Config) FallbackChatEndpoint() string {
+	if c.Ollama.FallbackEndpoint == "" {
+		return ""
+	}
+	return strings.TrimSuffix(c.Ollama.FallbackEndpoint, "/") + "/api/chat"
+}
+
+// EmbedEndpoint returns the URL of the Ollama embedding API
+func (c *Config) EmbedEndpoint() string {
+	return strings.TrimSuffix(c.Ollama.Endpoint, "/") + "/api/embed"
+}
+
+// AgentModels returns the models configured per plugin, overriding the plugins' own choice
+func (c *Config) AgentModels() map[string]string {
+	models := make(map[string]string)
+	for name, settings := range c.Plugin {
+		if model, _ := settings["model"].(string); model != "" {
+			models[name] = model
+		}
+	}
+	return models
+}
+
+// Palettes returns the palettes that can be picked, built-in and the user's own, by name
+func (c *Config) Palettes() (map[string]ui3d.Theme, error) {
+	palettes := make(map[string]ui3d.Theme)
+	for _, name := range []string{ui3d.ThemeDark, ui3d.ThemeLight, ui3d.ThemeHighContrast} {
+		palettes[name], _ = ui3d.BuiltinTheme(name)
+	}
+	for name, palette := range c.Theme.Palettes {
+		if _, builtin := palettes[name]; builtin {
+			return nil, fmt.Errorf("theme.palettes.%s: %s is a built-in palette", name, name)
+		}
+		base := palette.Base
+		if base == "" {
+			base = ui3d.ThemeDark
+		}
+		theme, ok := ui3d.BuiltinTheme(base)
+		if !ok {
+			return nil, fmt.Errorf("theme.palettes.%s.base must be dark, light or high-contrast, got %q", name, palette.Base)
+		}
+		for field, color := range map[string]struct {
+			value []float64
+			into  *[]float64
+		}{
+			"primary":    {palette.Primary, &theme.Primary},
+			"secondary":  {palette.Secondary, &theme.Secondary},
+			"accent":     {palette.Accent, &theme.Accent},
+			"background": {palette.Background, &theme.Background},
+			"text":       {palette.Text, &theme.Text},
+		} {
+			if color.value == nil {
+				continue
+			}
+			rgba, err := paletteColor(color.value)
+			if err != nil {
+				return nil, fmt.Errorf("theme.palettes.%s.%s: %v", name, field, err)
+			}
+			*color.into = rgba
+		}
+		palettes[name] = theme
+	}
+	return palettes, nil
+}
+
+// paletteColor checks a color of a palette, returning it as RGBA
+func paletteColor(color []float64) ([]float64, error) {
+	if len(color) != 3 && len(color) != 4 {
+		return nil, fmt.Errorf("colors are [r, g, b] or [r, g, b, a], got %d components", len(color))
+	}
+	for _, component := range color {
+		if component < 0 || component > 1 {
+			return nil, fmt.Errorf("color components are from 0 to 1, got %v", component)
+		}
+	}
+	if len(color) == 3 {
+		return append(color[:3:3], 1), nil
+	}
+	return color, nil
+}
+
+// LoggingOptions returns the logging settings to configure the loggers with
+func (c *Config) LoggingOptions() (logging.Options, error) {
+	format, err := logging.ParseFormat(c.Logging.Format)
+	if err != nil {
+		return logging.Options{}, fmt.Errorf("logging.format: %v", err)
+	}
+	if c.Logging.MaxSizeMB < 0 || c.Logging.MaxBackups < 0 {
+		return logging.Options{}, fmt.Errorf("logging.max_size_mb and logging.max_backups must not be negative")
+	}
+	levels := make(map[string]logging.LogLevel, len(c.Logging.Levels))
+	for name, levelName := range c.Logging.Levels {
+		level, err := logging.ParseLevel(levelName)
+		if err != nil {
+			return logging.Options{}, fmt.Errorf("logging.levels.%s: %v", name, err)
+		}
+		levels[name] = level
+	}
+	return logging.Options{
+		Format:     format,
+		Levels:     levels,
+		File:       c.Logging.File,
+		MaxSize:    int64(c.Logging.MaxSizeMB) << 20,
+		MaxBackups: c.Logging.MaxBackups,
+	}, nil
+}
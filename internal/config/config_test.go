@@ -0,0 +1,269 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mindpalace/pkg/logging"
+)
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+}
+
+func TestLoad_MissingFileUsesDefaults(t *testing.T) {
+	cfg, err := Load(filepath.Join(t.TempDir(), DefaultPath))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.ChatEndpoint() != "http://localhost:11434/api/chat" || cfg.Limits.HistoryTokens != 100000 || cfg.Audio.SilenceTimeout != 2*time.Second || !cfg.Audio.BargeIn || cfg.Audio.Language != "auto" {
+		t.Errorf("Expected the defaults, got %+v", cfg)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultPath)
+	writeConfig(t, path, `
+timezone = "Europe/Amsterdam"
+
+[ollama]
+endpoint = "http://gpu-box:11434/"
+model = "qwen3:8b"
+fallback_endpoint = "http://laptop:11434"
+fallback_model = "llama3.2:3b"
+health_interval = "10s"
+
+[limits]
+history_tokens = 8000
+request_timeout = "90s"
+tool_result_tokens = 500
+summarize_tool_results = true
+max_tools = 8
+
+[plugins]
+disabled = ["plugingenerator"]
+confirm_capabilities = ["network"]
+
+[plugins.external.weather]
+command = "weather-plugin"
+env = { WEATHER_KEY = "secret" }
+
+[plugin.taskmanager]
+model = "qwen3:14b"
+default_priority = "High"
+
+[audio]
+input_devices = ["pulse:default"]
+silence_timeout = "1.5s"
+barge_in = false
+language = "nl"
+diarization = true
+
+[logging]
+format = "json"
+file = "logs/mindpalace.log"
+levels = { audio = "debug", llm = "trace" }
+
+[theme]
+name = "solarized"
+
+[theme.palettes.solarized]
+base = "light"
+background = [0.99, 0.96, 0.89]
+primary = [0.15, 0.55, 0.82, 1]
+
+[godot]
+batch_window = "50ms"
+compression = true
+
+[briefing]
+schedule = "0 7 * * mon-fri"
+spoken = true
+
+[users.alice]
+token = "alice-0123456789abcdef"
+briefing = { schedule = "30 8 * * *" }
+
+[users.bob]
+token = "bob-0123456789abcdef"
+timezone = "America/New_York"
+
+[mcp.github]
+command = "github-mcp-server"
+args = ["stdio"]
+env = { GITHUB_TOKEN = "secret" }
+agents = ["taskmanager"]
+
+[mcp.search]
+url = "http://localhost:9000/sse"
+
+[retention]
+interval = "6h"
+
+[[retention.rules]]
+events = ["llm_*"]
+after_days = 30
+action = "drop"
+
+[[retention.rules]]
+events = ["orchestration_ToolCallCompleted"]
+after_days = 90
+action = "compact"
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.ChatEndpoint() != "http://gpu-box:11434/api/chat" || cfg.EmbedEndpoint() != "http://gpu-box:11434/api/embed" {
+		t.Errorf("Unexpected endpoints %s, %s", cfg.ChatEndpoint(), cfg.EmbedEndpoint())
+	}
+	if cfg.Ollama.Model != "qwen3:8b" || cfg.Ollama.EmbedModel != "nomic-embed-text" {
+		t.Errorf("Expected the configured model and the default embed model, got %+v", cfg.Ollama)
+	}
+	if cfg.FallbackChatEndpoint() != "http://laptop:11434/api/chat" || cfg.Ollama.FallbackModel != "llama3.2:3b" || cfg.Ollama.HealthInterval != 10*time.Second {
+		t.Errorf("Unexpected fallback %s, %+v", cfg.FallbackChatEndpoint(), cfg.Ollama)
+	}
+	if cfg.Limits.HistoryTokens != 8000 || cfg.Limits.ContextTokens != 131072 || cfg.Limits.RequestTimeout != 90*time.Second || cfg.Limits.ToolResultTokens != 500 || !cfg.Limits.SummarizeToolResults || cfg.Limits.MaxTools != 8 {
+		t.Errorf("Unexpected limits: %+v", cfg.Limits)
+	}
+	if len(cfg.Plugins.Disabled) != 1 || cfg.Plugins.Disabled[0] != "plugingenerator" {
+		t.Errorf("Unexpected disabled plugins: %v", cfg.Plugins.Disabled)
+	}
+	if len(cfg.Plugins.ConfirmCapabilities) != 1 || cfg.Plugins.ConfirmCapabilities[0] != "network" {
+		t.Errorf("Unexpected capabilities to confirm: %v", cfg.Plugins.ConfirmCapabilities)
+	}
+	if weather := cfg.Plugins.External["weather"]; weather.Command != "weather-plugin" || weather.Env["WEATHER_KEY"] != "secret" {
+		t.Errorf("Unexpected external plugins: %+v", cfg.Plugins.External)
+	}
+	if models := cfg.AgentModels(); len(models) != 1 || models["taskmanager"] != "qwen3:14b" {
+		t.Errorf("Unexpected agent models: %v", models)
+	}
+	if cfg.Plugin["taskmanager"]["default_priority"] != "High" {
+		t.Errorf("Expected the plugin settings to be kept, got %v", cfg.Plugin["taskmanager"])
+	}
+	if len(cfg.Audio.InputDevices) != 1 || cfg.Audio.SilenceTimeout != 1500*time.Millisecond || cfg.Audio.BargeIn || cfg.Audio.Language != "nl" || !cfg.Audio.Diarization {
+		t.Errorf("Unexpected audio config: %+v", cfg.Audio)
+	}
+	if cfg.Godot.BatchWindow != 50*time.Millisecond || !cfg.Godot.Compression || cfg.Godot.MaxPayloadSize != 512 {
+		t.Errorf("Unexpected Godot config: %+v", cfg.Godot)
+	}
+	if github := cfg.MCP["github"]; github.Command != "github-mcp-server" || len(github.Args) != 1 || github.Env["GITHUB_TOKEN"] != "secret" || len(github.Agents) != 1 || cfg.MCP["search"].URL != "http://localhost:9000/sse" {
+		t.Errorf("Unexpected MCP servers: %+v", cfg.MCP)
+	}
+	opts, err := cfg.LoggingOptions()
+	if err != nil {
+		t.Fatalf("LoggingOptions failed: %v", err)
+	}
+	if opts.Format != logging.FormatJSON || opts.File != "logs/mindpalace.log" || opts.MaxSize != 10<<20 || opts.MaxBackups != 5 {
+		t.Errorf("Unexpected logging options: %+v", opts)
+	}
+	if len(opts.Levels) != 2 || opts.Levels["audio"] != logging.LogLevelDebug || opts.Levels["llm"] != logging.LogLevelTrace {
+		t.Errorf("Unexpected subsystem levels: %v", opts.Levels)
+	}
+	if names := cfg.UserNames(); strings.Join(names, ",") != "alice,bob" || cfg.UserTokens()["bob-0123456789abcdef"] != "bob" {
+		t.Errorf("Unexpected users: %v, %v", names, cfg.UserTokens())
+	}
+	if locations := cfg.Locations(); locations[""].String() != "Europe/Amsterdam" || locations["alice"].String() != "Europe/Amsterdam" || locations["bob"].String() != "America/New_York" {
+		t.Errorf("Expected alice in the owner's time zone and bob in their own, got %v", locations)
+	}
+	if briefings := cfg.Briefings(); len(briefings) != 2 || briefings[""].Schedule != "0 7 * * mon-fri" || !briefings[""].Spoken || briefings["alice"].Schedule != "30 8 * * *" {
+		t.Errorf("Expected the briefings of the owner and alice, got %v", briefings)
+	}
+	if rules := cfg.RetentionRules(); cfg.Retention.Interval != 6*time.Hour || len(rules) != 2 || rules[0].After != 30*24*time.Hour || rules[0].Compact || !rules[1].Compact || !rules[0].Matches("llm_StreamChunk") {
+		t.Errorf("Unexpected retention rules: %+v", rules)
+	}
+	palettes, err := cfg.Palettes()
+	if err != nil {
+		t.Fatalf("Palettes failed: %v", err)
+	}
+	solarized := palettes[cfg.Theme.Name]
+	if len(palettes) != 4 || solarized.Background[3] != 1 || solarized.Primary[0] != 0.15 || solarized.Text[0] != 0 || solarized.Dark() {
+		t.Errorf("Expected the solarized palette on top of the light one, got %+v", solarized)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultPath)
+	for content, want := range map[string]string{
+		"[ollama]\nendpont = \"http://x\"":                                                                       "unknown settings",
+		"[ollama]\nendpoint = \"localhost\"":                                                                     "ollama.endpoint",
+		"[ollama]\nfallback_endpoint = \"laptop\"":                                                               "ollama.fallback_endpoint",
+		"[ollama]\nhealth_interval = \"0s\"":                                                                     "health_interval",
+		"[limits]\nhistory_tokens = 0":                                                                           "must be positive",
+		"[limits]\ntool_result_tokens = 0":                                                                       "tool_result_tokens",
+		"[limits]\nmax_tools = -1":                                                                               "max_tools",
+		"[plugin.calendar]\nmodel = 3":                                                                           "plugin.calendar.model",
+		"[plugins]\nconfirm_capabilities = [\"camera\"]":                                                         "plugins.confirm_capabilities",
+		"[audio]\nsilence_timeout = \"-1s\"":                                                                     "silence_timeout",
+		"[limits]\nrequest_timeout = \"-1s\"":                                                                    "request_timeout",
+		"[godot]\nbatch_window = \"-1ms\"":                                                                       "godot.batch_window",
+		"[logging]\nformat = \"xml\"":                                                                            "logging.format",
+		"[logging.levels]\naudio = \"loud\"":                                                                     "logging.levels.audio",
+		"[ollama\nmodel = \"qwen3:8b\"":                                                                          "failed to parse",
+		"[users.alice]\ntoken = \"short\"":                                                                       "users.alice.token",
+		"[users.Alice]\ntoken = \"0123456789abcdef\"":                                                            "users.Alice",
+		"[users.a]\ntoken = \"0123456789abcdef\"\n[users.b]\ntoken = \"0123456789abcdef\"":                       "token of",
+		"timezone = \"Mars/Olympus\"":                                                                            "timezone",
+		"[users.alice]\ntoken = \"0123456789abcdef\"\ntimezone = \"Mars\"":                                       "users.alice.timezone",
+		"[briefing]\nschedule = \"7am\"":                                                                         "briefing.schedule",
+		"[users.al]\ntoken = \"0123456789abcdef\"\nbriefing.schedule = \"0 25 * * *\"":                           "users.al.briefing.schedule",
+		"[theme]\nname = \"neon\"":                                                                               "theme.name",
+		"[theme.palettes.light]\nprimary = [0, 0, 1]":                                                            "built-in palette",
+		"[theme.palettes.neon]\nprimary = [0, 2, 1]":                                                             "theme.palettes.neon.primary",
+		"[theme.palettes.neon]\ntext = [1, 1]":                                                                   "theme.palettes.neon.text",
+		"[theme.palettes.neon]\nbase = \"sepia\"":                                                                "theme.palettes.neon.base",
+		"[mcp.GitHub]\ncommand = \"github-mcp-server\"":                                                          "mcp.GitHub",
+		"[mcp.github]\nargs = [\"stdio\"]":                                                                       "either a command or a url",
+		"[mcp.search]\nurl = \"localhost:9000\"":                                                                 "mcp.search.url",
+		"[mcp.world]\ncommand = \"world-mcp-server\"":                                                            "taken by the tools of the 3D world",
+		"[plugins.external.weather_v2]\ncommand = \"weather\"":                                                   "plugins.external.weather_v2",
+		"[plugins.external.weather]\nargs = [\"-v\"]":                                                            "plugins.external.weather.command",
+		"[retention]\ninterval = \"0s\"":                                                                         "retention.interval",
+		"[[retention.rules]]\nevents = [\"*\"]\nafter_days = 30\naction = \"drop\"":                              "retention.rules[0].events",
+		"[[retention.rules]]\nevents = [\"llm_*\"]\naction = \"drop\"":                                           "retention.rules[0].after_days",
+		"[[retention.rules]]\nevents = [\"llm_*\"]\nafter_days = 30\naction = \"shred\"":                         "retention.rules[0].action",
+		"[[retention.rules]]\nevents = [\"orchestration_RequestCompleted\"]\nafter_days = 30\naction = \"drop\"": "retention.rules[0] drops orchestration events",
+		"[[retention.rules]]\nevents = [\"orch*\"]\nafter_days = 30\naction = \"drop\"":                          "retention.rules[0] drops orchestration events",
+	} {
+		writeConfig(t, path, content)
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected an error containing %q for %q, got %v", want, content, err)
+		}
+	}
+}
+
+func TestWatch_ReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultPath)
+	writeConfig(t, path, "[ollama]\nmodel = \"qwen3:8b\"\n")
+
+	reloaded := make(chan *Config, 10)
+	w, err := Watch(path, func(cfg *Config) { reloaded <- cfg })
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	defer w.Stop()
+
+	// An invalid file keeps the current configuration
+	writeConfig(t, path, "[ollama]\nmodel = \"\"\n")
+	select {
+	case cfg := <-reloaded:
+		t.Fatalf("Expected the invalid file to be ignored, got %+v", cfg)
+	case <-time.After(3 * reloadDelay):
+	}
+
+	writeConfig(t, path, "[ollama]\nmodel = \"llama3\"\n")
+	select {
+	case cfg := <-reloaded:
+		if cfg.Ollama.Model != "llama3" {
+			t.Errorf("Expected the changed model, got %s", cfg.Ollama.Model)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the configuration to be reloaded")
+	}
+}
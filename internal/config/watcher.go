@@ -0,0 +1,99 @@
+package config
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"mindpalace/pkg/logging"
+)
+
+// reloadDelay lets editors finish writing the file before it is reloaded
+const reloadDelay = 200 * time.Millisecond
+
+// Watcher reloads the configuration file when it changes or the process receives SIGHUP
+type Watcher struct {
+	path     string
+	onChange func(cfg *Config)
+	files    *fsnotify.Watcher
+	signals  chan os.Signal
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Watch calls onChange with the reloaded configuration whenever the file changes or on SIGHUP.
+// An invalid file is logged and ignored, keeping the configuration applied last.
+func Watch(path string, onChange func(cfg *Config)) (*Watcher, error) {
+	files, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// Watch the directory, editors often replace the file instead of writing it
+	if err := files.Add(filepath.Dir(path)); err != nil {
+		files.Close()
+		return nil, err
+	}
+	w := &Watcher{
+		path:     filepath.Clean(path),
+		onChange: onChange,
+		files:    files,
+		signals:  make(chan os.Signal, 1),
+		done:     make(chan struct{}),
+	}
+	signal.Notify(w.signals, syscall.SIGHUP)
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// Stop stops watching the file and the signal
+func (w *Watcher) Stop() {
+	signal.Stop(w.signals)
+	close(w.done)
+	w.files.Close()
+	w.wg.Wait()
+}
+
+func (w *Watcher) run() {
+	defer w.wg.Done()
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.signals:
+			logging.Info("CONFIG: Received SIGHUP, reloading %s", w.path)
+			w.reload()
+		case event, ok := <-w.files.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) == w.path && event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+				pending = time.After(reloadDelay)
+			}
+		case <-pending:
+			pending = nil
+			logging.Info("CONFIG: %s changed, reloading", w.path)
+			w.reload()
+		case err, ok := <-w.files.Errors:
+			if !ok {
+				return
+			}
+			logging.Error("CONFIG: Failed to watch %s: %v", w.path, err)
+		}
+	}
+}
+
+func (w *Watcher) reload() {
+	cfg, err := Load(w.path)
+	if err != nil {
+		logging.Error("CONFIG: Keeping the current configuration: %v", err)
+		return
+	}
+	w.onChange(cfg)
+}
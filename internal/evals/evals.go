@@ -0,0 +1,230 @@
+// Package evals replays golden conversations against the orchestrator and checks the tool calls and events
+// each request leads to, so changes to the prompts, the routing or the plugins can be checked for regressions.
+// A case scripts the LLM's replies to replay them with a mock, or leaves them to a real model.
+package evals
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"mindpalace/internal/orchestration"
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Case is a golden conversation: the requests of a user in order and what each is expected to lead to
+type Case struct {
+	Name  string `json:"name"`
+	Turns []Turn `json:"turns"`
+}
+
+// Turn is a request of a conversation. Only what it sets is checked, except the tool calls: a turn expects
+// exactly the calls it lists, none if it lists none.
+type Turn struct {
+	Request   string     `json:"request"`
+	Responses []Response `json:"responses,omitempty"` // Replies of the mock LLM, in the order it is called
+	Agent     string     `json:"agent,omitempty"`     // Agent the request is routed to
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	Events    []string   `json:"events,omitempty"`   // Types of events published, in this order with others in between
+	Response  string     `json:"response,omitempty"` // Text the response contains, ignoring case
+}
+
+// Response is a reply of the mock LLM: text, tool calls or both
+type Response struct {
+	Content   string     `json:"content,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+// ToolCall is a call of a tool. An expected call matches a call with the same name having at least its
+// arguments; strings are compared ignoring case.
+type ToolCall struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// LoadCases reads the cases of the .json files in dir, in the order of their names. A case without a name is
+// named after its file.
+func LoadCases(dir string) ([]Case, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	cases := make([]Case, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var c Case
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if c.Name == "" {
+			c.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		if len(c.Turns) == 0 {
+			return nil, fmt.Errorf("case %s in %s has no turns", c.Name, path)
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+// check returns what differs between the turn and the events its request published
+func (t Turn) check(events []eventsourcing.Event) []string {
+	var failures []string
+	var agents []string
+	var calls []ToolCall
+	var types []string
+	completed := false
+	response := ""
+	for _, event := range events {
+		types = append(types, event.Type())
+		switch e := event.(type) {
+		case *orchestration.AgentCallDecidedEvent:
+			agents = append(agents, e.AgentName)
+		case *orchestration.AgentFanOutStartedEvent:
+			for _, call := range e.Calls {
+				agents = append(agents, call.AgentName)
+			}
+		case *orchestration.ToolCallRequestPlaced:
+			if e.Attempt <= 1 {
+				calls = append(calls, ToolCall{Name: e.Function, Arguments: e.Arguments})
+			}
+		case *orchestration.RequestCompletedEvent:
+			completed = true
+			response = e.ResponseText
+		}
+	}
+
+	if t.Agent != "" && !slices.Contains(agents, t.Agent) {
+		failures = append(failures, fmt.Sprintf("expected the request routed to %s, got %s", t.Agent, listOrNone(agents)))
+	}
+	if len(calls) != len(t.ToolCalls) {
+		failures = append(failures, fmt.Sprintf("expected %d tool calls, got %d: %s", len(t.ToolCalls), len(calls), callNames(calls)))
+	} else {
+		for i, expected := range t.ToolCalls {
+			if !calls[i].matches(expected) {
+				failures = append(failures, fmt.Sprintf("tool call %d: expected %s, got %s", i+1, expected, calls[i]))
+			}
+		}
+	}
+	if missing := missingEvent(types, t.Events); missing != "" {
+		failures = append(failures, fmt.Sprintf("expected event %s in order, got %s", missing, listOrNone(types)))
+	}
+	if t.Response != "" && !strings.Contains(strings.ToLower(response), strings.ToLower(t.Response)) {
+		failures = append(failures, fmt.Sprintf("expected the response to contain %q, got %q", t.Response, response))
+	}
+	if !completed && !awaitsConfirmation(types) {
+		failures = append(failures, "the request did not complete")
+	}
+	return failures
+}
+
+// awaitsConfirmation reports whether the request waits for the user to confirm a tool call, which the next
+// turn answers
+func awaitsConfirmation(types []string) bool {
+	return slices.Contains(types, "orchestration_ToolCallConfirmationRequested")
+}
+
+// missingEvent returns the first of the expected event types not found in order, empty if all are
+func missingEvent(types, expected []string) string {
+	i := 0
+	for _, eventType := range types {
+		if i < len(expected) && eventType == expected[i] {
+			i++
+		}
+	}
+	if i < len(expected) {
+		return expected[i]
+	}
+	return ""
+}
+
+// matches reports whether the call is the expected call
+func (c ToolCall) matches(expected ToolCall) bool {
+	if c.Name != expected.Name {
+		return false
+	}
+	for name, value := range expected.Arguments {
+		if !matchesValue(normalize(c.Arguments[name]), normalize(value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesValue compares values decoded from JSON: objects have at least the expected fields, strings are
+// equal ignoring case
+func matchesValue(actual, expected interface{}) bool {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for name, value := range e {
+			if !matchesValue(a[name], value) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok || len(a) != len(e) {
+			return false
+		}
+		for i := range e {
+			if !matchesValue(a[i], e[i]) {
+				return false
+			}
+		}
+		return true
+	case string:
+		a, ok := actual.(string)
+		return ok && strings.EqualFold(a, e)
+	}
+	return reflect.DeepEqual(actual, expected)
+}
+
+// normalize returns the value as decoded from JSON, so numbers and slices of any type compare alike
+func normalize(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return value
+	}
+	return normalized
+}
+
+func (c ToolCall) String() string {
+	arguments, err := json.Marshal(c.Arguments)
+	if err != nil || c.Arguments == nil {
+		arguments = []byte("{}")
+	}
+	return fmt.Sprintf("%s %s", c.Name, arguments)
+}
+
+func callNames(calls []ToolCall) string {
+	names := make([]string, len(calls))
+	for i, call := range calls {
+		names[i] = call.Name
+	}
+	return listOrNone(names)
+}
+
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
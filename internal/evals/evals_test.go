@@ -0,0 +1,183 @@
+package evals
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"fyne.io/fyne/v2"
+
+	"mindpalace/internal/orchestration"
+	"mindpalace/pkg/eventsourcing"
+)
+
+type noteAddedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Text      string `json:"text"`
+}
+
+func (e *noteAddedEvent) Type() string { return "notes_NoteAdded" }
+func (e *noteAddedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *noteAddedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type addNoteInput struct {
+	Text string `json:"Text"`
+}
+
+func (i *addNoteInput) New() any { return &addNoteInput{} }
+func (i *addNoteInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"Text": map[string]interface{}{"type": "string"}},
+		"required":   []string{"Text"},
+	}
+}
+
+type notesAggregate struct{ Notes []string }
+
+func (a *notesAggregate) ID() string                     { return "notes" }
+func (a *notesAggregate) GetCustomUI() fyne.CanvasObject { return nil }
+func (a *notesAggregate) ApplyEvent(event eventsourcing.Event) error {
+	if e, ok := event.(*noteAddedEvent); ok {
+		a.Notes = append(a.Notes, e.Text)
+	}
+	return nil
+}
+
+// notesPlugin adds notes, a plugin of its own per environment
+type notesPlugin struct{ agg *notesAggregate }
+
+func (p *notesPlugin) Name() string                                         { return "notes" }
+func (p *notesPlugin) Type() eventsourcing.PluginType                       { return eventsourcing.LLMPlugin }
+func (p *notesPlugin) EventHandlers() map[string]eventsourcing.EventHandler { return nil }
+func (p *notesPlugin) Aggregate() eventsourcing.Aggregate                   { return p.agg }
+func (p *notesPlugin) SystemPrompt() string                                 { return "You keep the user's notes." }
+func (p *notesPlugin) AgentModel() string                                   { return "" }
+func (p *notesPlugin) Schemas() map[string]eventsourcing.CommandInput {
+	return map[string]eventsourcing.CommandInput{"AddNote": &addNoteInput{}}
+}
+func (p *notesPlugin) Commands() map[string]eventsourcing.CommandHandler {
+	return map[string]eventsourcing.CommandHandler{
+		"AddNote": eventsourcing.NewCommand(func(input *addNoteInput) ([]eventsourcing.Event, error) {
+			return []eventsourcing.Event{&noteAddedEvent{Text: input.Text}}, nil
+		}),
+	}
+}
+
+type pluginManager struct{ plugin eventsourcing.Plugin }
+
+func (m *pluginManager) GetLLMPlugins() []eventsourcing.Plugin {
+	return []eventsourcing.Plugin{m.plugin}
+}
+func (m *pluginManager) GetPlugin(name string) (eventsourcing.Plugin, error) {
+	if name == m.plugin.Name() {
+		return m.plugin, nil
+	}
+	return nil, fmt.Errorf("plugin '%s' not found", name)
+}
+func (m *pluginManager) GetPluginByCommand(cmd string) (eventsourcing.Plugin, error) {
+	if _, exists := m.plugin.Commands()[cmd]; exists {
+		return m.plugin, nil
+	}
+	return nil, fmt.Errorf("no plugin has command %s", cmd)
+}
+
+func notesSetup(t *testing.T) Setup {
+	return func(llm orchestration.LLMClientInterface) (*Environment, error) {
+		return NewEnvironment(llm, func(ep *eventsourcing.EventProcessor) orchestration.PluginManagerInterface {
+			return &pluginManager{plugin: &notesPlugin{agg: &notesAggregate{}}}
+		})
+	}
+}
+
+// addNote is a turn adding a note, the LLM routing the request, calling AddNote and answering
+func addNote(text string) Turn {
+	return Turn{
+		Request: "note: " + text,
+		Responses: []Response{
+			{ToolCalls: []ToolCall{{Name: "notes", Arguments: map[string]interface{}{"query": "note: " + text}}}},
+			{ToolCalls: []ToolCall{{Name: "AddNote", Arguments: map[string]interface{}{"Text": text}}}},
+			{Content: "Noted: " + text},
+		},
+		Agent:     "notes",
+		ToolCalls: []ToolCall{{Name: "AddNote", Arguments: map[string]interface{}{"Text": strings.ToUpper(text)}}},
+		Events:    []string{"orchestration_AgentCallDecided", "notes_NoteAdded", "orchestration_RequestCompleted"},
+		Response:  "noted",
+	}
+}
+
+func TestRunner_Passes(t *testing.T) {
+	chat := Turn{Request: "hi", Responses: []Response{{Content: "Hello!"}}, Response: "hello"}
+	report := NewRunner(notesSetup(t), nil).Run([]Case{
+		{Name: "notes", Turns: []Turn{addNote("buy milk"), chat, addNote("call mom")}},
+	})
+
+	var out strings.Builder
+	report.Write(&out)
+	if report.Failed() != 0 {
+		t.Fatalf("Expected the case to pass, got:\n%s", out.String())
+	}
+	if out.String() != "PASS notes\n1 passed, 0 failed\n" {
+		t.Errorf("Unexpected report:\n%s", out.String())
+	}
+}
+
+func TestRunner_Fails(t *testing.T) {
+	wrongArgument := addNote("buy milk")
+	wrongArgument.ToolCalls[0].Arguments["Text"] = "buy bread"
+	unscripted := addNote("call mom")
+	unscripted.Responses = unscripted.Responses[:2]
+	wrongAgent := Turn{Request: "hi", Responses: []Response{{Content: "Hello!"}}, Agent: "notes", Events: []string{"notes_NoteAdded"}}
+
+	report := NewRunner(notesSetup(t), nil).Run([]Case{
+		{Name: "wrong argument", Turns: []Turn{wrongArgument}},
+		{Name: "unscripted", Turns: []Turn{unscripted}},
+		{Name: "wrong agent", Turns: []Turn{wrongAgent}},
+	})
+	if report.Failed() != 3 {
+		t.Fatalf("Expected all cases to fail, got %+v", report.Cases)
+	}
+	for i, expected := range [][]string{
+		{`tool call 1: expected AddNote {"Text":"buy bread"}, got AddNote {"Text":"buy milk"}`},
+		{"the request did not complete", "the LLM was called 3 times, the turn scripts 2 responses"},
+		{"expected the request routed to notes, got none", "expected event notes_NoteAdded in order"},
+	} {
+		failures := strings.Join(report.Cases[i].Turns[0].Failures, "\n")
+		for _, failure := range expected {
+			if !strings.Contains(failures, failure) {
+				t.Errorf("Expected case %s to fail with %q, got:\n%s", report.Cases[i].Name, failure, failures)
+			}
+		}
+	}
+}
+
+func TestLoadCases(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "b.json"), []byte(`{"name": "chat", "turns": [{"request": "hi"}]}`), 0644)
+	os.WriteFile(filepath.Join(dir, "a-note.json"), []byte(`{"turns": [{"request": "note: buy milk",
+		"tool_calls": [{"name": "AddNote", "arguments": {"Text": "buy milk"}}]}]}`), 0644)
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a case"), 0644)
+
+	cases, err := LoadCases(dir)
+	if err != nil {
+		t.Fatalf("LoadCases failed: %v", err)
+	}
+	if len(cases) != 2 || cases[0].Name != "a-note" || cases[1].Name != "chat" {
+		t.Fatalf("Expected the cases in the order of their files, named after them if unnamed, got %+v", cases)
+	}
+	if cases[0].Turns[0].ToolCalls[0].Arguments["Text"] != "buy milk" {
+		t.Errorf("Expected the tool call's arguments, got %+v", cases[0].Turns[0])
+	}
+
+	os.WriteFile(filepath.Join(dir, "c.json"), []byte(`{"name": "empty"}`), 0644)
+	if _, err := LoadCases(dir); err == nil {
+		t.Error("Expected a case without turns to fail loading")
+	}
+}
@@ -0,0 +1,248 @@
+package evals
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"mindpalace/internal/orchestration"
+	"mindpalace/pkg/aggregate"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/llmmodels"
+)
+
+// Environment is what a case runs against: the orchestrator and the plugins on an event store of their own
+type Environment struct {
+	Orchestrator *orchestration.RequestOrchestrator
+	Processor    *eventsourcing.EventProcessor
+	Bus          *eventsourcing.SimpleEventBus
+	store        *eventsourcing.SQLiteEventStore
+}
+
+// NewEnvironment sets up the orchestrator calling llm and the plugins newPlugins returns on an event store in
+// memory. The plugins register their commands with the processor given.
+func NewEnvironment(llm orchestration.LLMClientInterface, newPlugins func(ep *eventsourcing.EventProcessor) orchestration.PluginManagerInterface) (*Environment, error) {
+	store, err := eventsourcing.NewMemoryEventStore()
+	if err != nil {
+		return nil, err
+	}
+	aggStore := aggregate.NewAggregateManager()
+	ep := eventsourcing.NewEventProcessor(store, nil)
+	eb := eventsourcing.NewSimpleEventBus(store, aggStore, ep.DeltaChan())
+	ep.EventBus = eb
+	eventsourcing.SetGlobalEventBus(eb)
+
+	pluginManager := newPlugins(ep)
+	for _, plug := range pluginManager.GetLLMPlugins() {
+		if plug.Aggregate() != nil {
+			aggStore.RegisterAggregate(plug.Name(), plug.Aggregate())
+		}
+	}
+	orchAgg := orchestration.NewOrchestrationAggregate()
+	aggStore.RegisterAggregate("orchestration", orchAgg)
+	orchestrator := orchestration.NewRequestOrchestrator(llm, pluginManager, orchAgg, ep, eb)
+	orchestrator.SetStateSource(aggStore)
+	// Requests are run to completion one at a time, the run stops on a request that never completes
+	orchestrator.SetRequestTimeout(0)
+	return &Environment{Orchestrator: orchestrator, Processor: ep, Bus: eb, store: store}, nil
+}
+
+// Close stops the event bus and closes the event store
+func (e *Environment) Close() error {
+	e.Bus.Close()
+	return e.store.Close()
+}
+
+// Setup creates a fresh environment for a case, its orchestrator calling llm
+type Setup func(llm orchestration.LLMClientInterface) (*Environment, error)
+
+// ScriptedLLM is the mock LLM replying with the responses of the turn being replayed, in order
+type ScriptedLLM struct {
+	mu        sync.Mutex
+	responses []Response
+	calls     int
+}
+
+// script replaces the responses with those of the next turn
+func (l *ScriptedLLM) script(responses []Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.responses = responses
+	l.calls = 0
+}
+
+// CallLLM replies with the next response, failing when the turn scripts no more
+func (l *ScriptedLLM) CallLLM(ctx context.Context, messages []llmmodels.Message, tools []llmmodels.Tool, requestID, model string) (*llmmodels.OllamaResponse, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls++
+	if l.calls > len(l.responses) {
+		return nil, fmt.Errorf("the case scripts no response for LLM call %d", l.calls)
+	}
+	response := l.responses[l.calls-1]
+	message := llmmodels.OllamaMessage{Role: "assistant", Content: response.Content}
+	for _, call := range response.ToolCalls {
+		message.ToolCalls = append(message.ToolCalls, llmmodels.OllamaToolCall{
+			Function: llmmodels.OllamaFunction{Name: call.Name, Arguments: call.Arguments},
+		})
+	}
+	return &llmmodels.OllamaResponse{Message: message, Done: true, Model: model}, nil
+}
+
+// mismatch returns how the calls of the turn differ from the responses it scripts, empty if they match
+func (l *ScriptedLLM) mismatch() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.calls == len(l.responses) {
+		return ""
+	}
+	return fmt.Sprintf("the LLM was called %d times, the turn scripts %d responses", l.calls, len(l.responses))
+}
+
+// recorder keeps the events published during a turn
+type recorder struct {
+	mu     sync.Mutex
+	events []eventsourcing.Event
+}
+
+func (r *recorder) record(event eventsourcing.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+// take returns the events recorded and starts recording anew
+func (r *recorder) take() []eventsourcing.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+// Runner replays cases, each against a fresh environment
+type Runner struct {
+	setup Setup
+	llm   orchestration.LLMClientInterface // Nil replays the responses the cases script
+}
+
+// NewRunner creates a runner calling llm, or replaying the responses the cases script if it is nil
+func NewRunner(setup Setup, llm orchestration.LLMClientInterface) *Runner {
+	return &Runner{setup: setup, llm: llm}
+}
+
+// Run replays the cases in order and reports how each went
+func (r *Runner) Run(cases []Case) *Report {
+	report := &Report{}
+	for _, c := range cases {
+		report.Cases = append(report.Cases, r.runCase(c))
+	}
+	return report
+}
+
+// runCase makes the requests of a case in order and checks what each led to. Later turns are made after a
+// turn failed, their results tell whether the conversation recovers.
+func (r *Runner) runCase(c Case) CaseResult {
+	result := CaseResult{Name: c.Name}
+	llm := r.llm
+	var scripted *ScriptedLLM
+	if llm == nil {
+		scripted = &ScriptedLLM{}
+		llm = scripted
+	}
+	env, err := r.setup(llm)
+	if err != nil {
+		result.Error = fmt.Sprintf("setting up failed: %v", err)
+		return result
+	}
+	defer env.Close()
+	events := &recorder{}
+	env.Bus.SubscribeAll(events.record)
+
+	for i, turn := range c.Turns {
+		if scripted != nil {
+			scripted.script(turn.Responses)
+		}
+		err := env.Processor.ExecuteCommand("ProcessUserRequest", map[string]interface{}{
+			"requestText": turn.Request,
+			"requestID":   fmt.Sprintf("eval-%d", i+1),
+		})
+		var failures []string
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("the request failed: %v", err))
+		} else {
+			failures = turn.check(events.take())
+		}
+		if scripted != nil {
+			if mismatch := scripted.mismatch(); mismatch != "" {
+				failures = append(failures, mismatch)
+			}
+		}
+		result.Turns = append(result.Turns, TurnResult{Request: turn.Request, Failures: failures})
+	}
+	return result
+}
+
+// TurnResult is what differed from what a turn expects, nothing if it passed
+type TurnResult struct {
+	Request  string   `json:"request"`
+	Failures []string `json:"failures,omitempty"`
+}
+
+// CaseResult is how a case went
+type CaseResult struct {
+	Name  string       `json:"name"`
+	Error string       `json:"error,omitempty"` // Set when the case could not be run
+	Turns []TurnResult `json:"turns"`
+}
+
+// Passed reports whether the case ran and all its turns passed
+func (c CaseResult) Passed() bool {
+	if c.Error != "" {
+		return false
+	}
+	for _, turn := range c.Turns {
+		if len(turn.Failures) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Report is how the cases of a run went
+type Report struct {
+	Cases []CaseResult `json:"cases"`
+}
+
+// Failed returns the number of cases that failed
+func (r *Report) Failed() int {
+	failed := 0
+	for _, c := range r.Cases {
+		if !c.Passed() {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Write writes a line per case and the failures of the cases that failed, then the totals
+func (r *Report) Write(w io.Writer) {
+	for _, c := range r.Cases {
+		if c.Passed() {
+			fmt.Fprintf(w, "PASS %s\n", c.Name)
+			continue
+		}
+		fmt.Fprintf(w, "FAIL %s\n", c.Name)
+		if c.Error != "" {
+			fmt.Fprintf(w, "    %s\n", c.Error)
+		}
+		for i, turn := range c.Turns {
+			for _, failure := range turn.Failures {
+				fmt.Fprintf(w, "    turn %d %q: %s\n", i+1, turn.Request, failure)
+			}
+		}
+	}
+	fmt.Fprintf(w, "%d passed, %d failed\n", len(r.Cases)-r.Failed(), r.Failed())
+}
@@ -0,0 +1,254 @@
+// Package examples keeps the examples of requests and the commands they call for that are shown to the
+// agents, so small models pick the right tool and input more often. Plugins bring examples of their own,
+// the user adds more at runtime, per user, e.g. for the way they phrase things.
+package examples
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// ExampleAddedEvent records an example the user added for the agent of a plugin
+type ExampleAddedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Entry
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *ExampleAddedEvent) Type() string { return "examples_ExampleAdded" }
+func (e *ExampleAddedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ExampleAddedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ExampleRemovedEvent records that an example is no longer shown; it keeps the example so it can be undone
+type ExampleRemovedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Entry
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *ExampleRemovedEvent) Type() string { return "examples_ExampleRemoved" }
+func (e *ExampleRemovedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ExampleRemovedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ExamplesListedEvent answers a ListExamples command with the examples the agents are shown
+type ExamplesListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string  `json:"event_type"`
+	Examples  []Entry `json:"examples"`
+}
+
+func (e *ExamplesListedEvent) Type() string { return "examples_ExamplesListed" }
+func (e *ExamplesListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ExamplesListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("examples_ExampleAdded", func() eventsourcing.Event { return &ExampleAddedEvent{} })
+	eventsourcing.RegisterEvent("examples_ExampleRemoved", func() eventsourcing.Event { return &ExampleRemovedEvent{} })
+	eventsourcing.RegisterEvent("examples_ExamplesListed", func() eventsourcing.Event { return &ExamplesListedEvent{} })
+	eventsourcing.RegisterTransientEvent("examples_ExamplesListed")
+}
+
+// Entry is an example for the agent of a plugin
+type Entry struct {
+	ExampleID string `json:"example_id,omitempty"` // Empty for the plugin's own examples, which can't be removed
+	Plugin    string `json:"plugin"`
+	eventsourcing.Example
+}
+
+// PluginSource finds the plugins the examples are for
+type PluginSource interface {
+	GetPlugin(name string) (eventsourcing.Plugin, error)
+}
+
+// Registry is the aggregate of the examples each user added. The plugins' own examples are asked for when
+// they are shown.
+type Registry struct {
+	Examples map[string][]Entry // User -> examples, in the order they were added
+	plugins  PluginSource
+	Mu       sync.RWMutex
+}
+
+// NewRegistry creates a registry checking the examples added against the commands of the plugins
+func NewRegistry(plugins PluginSource) *Registry {
+	return &Registry{
+		Examples: make(map[string][]Entry),
+		plugins:  plugins,
+	}
+}
+
+// ID returns the aggregate's identifier
+func (r *Registry) ID() string {
+	return "examples"
+}
+
+// ApplyEvent adds and removes the examples of the event's user
+func (r *Registry) ApplyEvent(event eventsourcing.Event) error {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	userID := event.Metadata().UserID
+	switch e := event.(type) {
+	case *ExampleAddedEvent:
+		r.Examples[userID] = append(r.Examples[userID], e.Entry)
+	case *ExampleRemovedEvent:
+		kept := r.Examples[userID][:0]
+		for _, entry := range r.Examples[userID] {
+			if entry.ExampleID != e.ExampleID {
+				kept = append(kept, entry)
+			}
+		}
+		r.Examples[userID] = kept
+	}
+	return nil
+}
+
+// Compensate returns the event undoing an example added or removed
+func (r *Registry) Compensate(event eventsourcing.Event) ([]eventsourcing.Event, error) {
+	switch e := event.(type) {
+	case *ExampleAddedEvent:
+		return []eventsourcing.Event{&ExampleRemovedEvent{Entry: e.Entry, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+	case *ExampleRemovedEvent:
+		return []eventsourcing.Event{&ExampleAddedEvent{Entry: e.Entry, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+	}
+	return nil, nil
+}
+
+// added returns the examples the user added for the plugin, all plugins if it is empty
+func (r *Registry) added(userID, plugin string) []Entry {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	var entries []Entry
+	for _, entry := range r.Examples[userID] {
+		if plugin == "" || entry.Plugin == plugin {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// ExamplesFor returns the examples shown to the agent of a plugin: its own, then those the user added
+func (r *Registry) ExamplesFor(userID string, plugin eventsourcing.Plugin) []eventsourcing.Example {
+	var examples []eventsourcing.Example
+	if provider, ok := plugin.(eventsourcing.ExampleProvider); ok {
+		examples = append(examples, provider.Examples()...)
+	}
+	for _, entry := range r.added(userID, plugin.Name()) {
+		examples = append(examples, entry.Example)
+	}
+	return examples
+}
+
+// AddExampleCommand adds an example for the agent of a plugin, e.g. {"plugin": "taskmanager", "request":
+// "remind me to call mom", "command": "CreateTask", "arguments": {"Title": "Call mom"}}
+func (r *Registry) AddExampleCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	name, _ := data["plugin"].(string)
+	request, _ := data["request"].(string)
+	command, _ := data["command"].(string)
+	arguments, _ := data["arguments"].(map[string]interface{})
+	request = strings.TrimSpace(request)
+	if name == "" || request == "" || command == "" {
+		return nil, fmt.Errorf("plugin, request and command are required")
+	}
+	plugin, err := r.plugins.GetPlugin(name)
+	if err != nil || plugin == nil {
+		return nil, fmt.Errorf("there is no plugin %s", name)
+	}
+	if _, exists := plugin.Schemas()[command]; !exists {
+		return nil, fmt.Errorf("plugin %s has no command %s", name, command)
+	}
+	for _, example := range r.ExamplesFor(eventsourcing.UserOf(data), plugin) {
+		if strings.EqualFold(example.Request, request) {
+			return nil, fmt.Errorf("there is an example for %q already", request)
+		}
+	}
+	if arguments == nil {
+		arguments = map[string]interface{}{}
+	}
+	return []eventsourcing.Event{&ExampleAddedEvent{
+		Entry: Entry{
+			ExampleID: fmt.Sprintf("example_%d", eventsourcing.GenerateUniqueID()),
+			Plugin:    name,
+			Example:   eventsourcing.Example{Request: request, Command: command, Arguments: arguments},
+		},
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// RemoveExampleCommand removes an example the user added, e.g. {"example_id": "example_1"}
+func (r *Registry) RemoveExampleCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	id, _ := data["example_id"].(string)
+	for _, entry := range r.added(eventsourcing.UserOf(data), "") {
+		if entry.ExampleID == id {
+			return []eventsourcing.Event{&ExampleRemovedEvent{Entry: entry, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+		}
+	}
+	return nil, fmt.Errorf("there is no example %q, the plugins' own examples can't be removed", id)
+}
+
+// ListExamplesCommand lists the examples shown to the agent of a plugin, e.g. {"plugin": "taskmanager"}
+func (r *Registry) ListExamplesCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	name, _ := data["plugin"].(string)
+	plugin, err := r.plugins.GetPlugin(name)
+	if err != nil || plugin == nil {
+		return nil, fmt.Errorf("there is no plugin %s", name)
+	}
+	entries := []Entry{}
+	if provider, ok := plugin.(eventsourcing.ExampleProvider); ok {
+		for _, example := range provider.Examples() {
+			entries = append(entries, Entry{Plugin: name, Example: example})
+		}
+	}
+	entries = append(entries, r.added(eventsourcing.UserOf(data), name)...)
+	return []eventsourcing.Event{&ExamplesListedEvent{Examples: entries}}, nil
+}
+
+// GetCustomUI lists the examples the owner added
+func (r *Registry) GetCustomUI() fyne.CanvasObject {
+	entries := r.added("", "")
+	if len(entries) == 0 {
+		return widget.NewLabel("No examples added yet")
+	}
+	items := container.NewVBox()
+	for _, entry := range entries {
+		arguments, _ := json.Marshal(entry.Arguments)
+		items.Add(widget.NewLabel(fmt.Sprintf("%s: %q → %s %s", entry.Plugin, entry.Request, entry.Command, arguments)))
+	}
+	return container.NewVScroll(items)
+}
+
+// SaveSnapshot serializes the examples added
+func (r *Registry) SaveSnapshot() ([]byte, error) {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	return json.Marshal(r.Examples)
+}
+
+// LoadSnapshot replaces the examples added with the snapshot
+func (r *Registry) LoadSnapshot(data []byte) error {
+	examples := make(map[string][]Entry)
+	if err := json.Unmarshal(data, &examples); err != nil {
+		return err
+	}
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	r.Examples = examples
+	return nil
+}
@@ -0,0 +1,130 @@
+package examples
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/eventsourcing/eventsourcingtest"
+)
+
+// taskInput is the input of the plugin's commands
+type taskInput struct{}
+
+func (i *taskInput) New() any                       { return &taskInput{} }
+func (i *taskInput) Schema() map[string]interface{} { return nil }
+
+// examplePlugin has commands and examples of its own
+type examplePlugin struct {
+	name     string
+	examples []eventsourcing.Example
+}
+
+func (p *examplePlugin) Name() string                                         { return p.name }
+func (p *examplePlugin) Type() eventsourcing.PluginType                       { return eventsourcing.LLMPlugin }
+func (p *examplePlugin) EventHandlers() map[string]eventsourcing.EventHandler { return nil }
+func (p *examplePlugin) Commands() map[string]eventsourcing.CommandHandler    { return nil }
+func (p *examplePlugin) Aggregate() eventsourcing.Aggregate                   { return nil }
+func (p *examplePlugin) SystemPrompt() string                                 { return "" }
+func (p *examplePlugin) AgentModel() string                                   { return "" }
+func (p *examplePlugin) Examples() []eventsourcing.Example                    { return p.examples }
+func (p *examplePlugin) Schemas() map[string]eventsourcing.CommandInput {
+	return map[string]eventsourcing.CommandInput{"CreateTask": &taskInput{}, "ListTasks": &taskInput{}}
+}
+
+type plugins map[string]eventsourcing.Plugin
+
+func (p plugins) GetPlugin(name string) (eventsourcing.Plugin, error) {
+	if plugin, ok := p[name]; ok {
+		return plugin, nil
+	}
+	return nil, fmt.Errorf("plugin '%s' not found", name)
+}
+
+func newTestRegistry() (*Registry, *examplePlugin) {
+	tasks := &examplePlugin{name: "taskmanager", examples: []eventsourcing.Example{
+		{Request: "what's still open?", Command: "ListTasks", Arguments: map[string]interface{}{"Status": "Pending"}},
+	}}
+	return NewRegistry(plugins{"taskmanager": tasks}), tasks
+}
+
+func requests(examples []eventsourcing.Example) string {
+	var requests []string
+	for _, example := range examples {
+		requests = append(requests, example.Request)
+	}
+	return strings.Join(requests, ", ")
+}
+
+func TestRegistry_AddAndRemove(t *testing.T) {
+	r, tasks := newTestRegistry()
+	added := eventsourcingtest.Execute(t, r, "", r.AddExampleCommand, map[string]interface{}{
+		"plugin":    "taskmanager",
+		"request":   "groceries: milk",
+		"command":   "CreateTask",
+		"arguments": map[string]interface{}{"Title": "Buy milk", "Tags": []interface{}{"groceries"}},
+	})
+
+	if got := requests(r.ExamplesFor("", tasks)); got != "what's still open?, groceries: milk" {
+		t.Errorf("Expected the plugin's example and the one added, got %q", got)
+	}
+	if got := requests(r.ExamplesFor("alice", tasks)); got != "what's still open?" {
+		t.Errorf("Expected another user's examples to stay apart, got %q", got)
+	}
+
+	for name, data := range map[string]map[string]interface{}{
+		"unknown plugin":  {"plugin": "weather", "request": "will it rain?", "command": "Forecast"},
+		"unknown command": {"plugin": "taskmanager", "request": "buy milk", "command": "Shop"},
+		"no request":      {"plugin": "taskmanager", "request": " ", "command": "CreateTask"},
+		"same request":    {"plugin": "taskmanager", "request": "What's still open?", "command": "ListTasks"},
+	} {
+		data["userID"] = ""
+		if _, err := r.AddExampleCommand(data); err == nil {
+			t.Errorf("Expected adding an example with %s to fail", name)
+		}
+	}
+
+	// The plugin's own examples stay, those added can be removed and the removal undone
+	if _, err := r.RemoveExampleCommand(map[string]interface{}{"example_id": ""}); err == nil {
+		t.Error("Expected removing a plugin's example to fail")
+	}
+	id := added[0].(*ExampleAddedEvent).ExampleID
+	removed := eventsourcingtest.Execute(t, r, "", r.RemoveExampleCommand, map[string]interface{}{"example_id": id})
+	if got := requests(r.ExamplesFor("", tasks)); got != "what's still open?" {
+		t.Errorf("Expected the example removed, got %q", got)
+	}
+	undo, err := r.Compensate(removed[0])
+	if err != nil {
+		t.Fatalf("Compensate failed: %v", err)
+	}
+	if err := r.ApplyEvent(undo[0]); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+	if got := r.ExamplesFor("", tasks); len(got) != 2 || got[1].Arguments["Title"] != "Buy milk" {
+		t.Errorf("Expected the example back with its arguments, got %+v", got)
+	}
+}
+
+func TestRegistry_ListAndSnapshot(t *testing.T) {
+	r, tasks := newTestRegistry()
+	eventsourcingtest.Execute(t, r, "", r.AddExampleCommand, map[string]interface{}{"plugin": "taskmanager", "request": "todo: call Sam", "command": "CreateTask"})
+
+	events := eventsourcingtest.Execute(t, r, "", r.ListExamplesCommand, map[string]interface{}{"plugin": "taskmanager"})
+	listed := events[0].(*ExamplesListedEvent).Examples
+	if len(listed) != 2 || listed[0].ExampleID != "" || listed[1].ExampleID == "" {
+		t.Errorf("Expected the plugin's example without an ID and the one added with one, got %+v", listed)
+	}
+
+	data, err := r.SaveSnapshot()
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	restored, _ := newTestRegistry()
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if got := requests(restored.ExamplesFor("", tasks)); got != "what's still open?, todo: call Sam" {
+		t.Errorf("Expected the example added restored, got %q", got)
+	}
+}
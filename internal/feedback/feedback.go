@@ -0,0 +1,391 @@
+// Package feedback keeps the thumbs up or down and the comments the user gives on MindPalace's answers, with
+// the request, the answer and the models it was made with, so changes of prompts and models can be judged
+// later. Comments the user marks as corrections are shown to MindPalace when it answers later requests.
+package feedback
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/internal/orchestration"
+	"mindpalace/internal/usage"
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Ratings of an answer
+const (
+	Up   = "up"
+	Down = "down"
+)
+
+// maxRequests is the number of recent requests kept to be rated, older ones can't be rated anymore
+const maxRequests = 500
+
+// maxCorrections is the number of corrections shown to MindPalace, the most recent ones
+const maxCorrections = 5
+
+// FeedbackGivenEvent records the user's feedback on the answer to a request, replacing earlier feedback on it
+type FeedbackGivenEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Feedback
+	Previous  *Feedback `json:"previous,omitempty"` // Feedback it replaced, to undo it
+	Timestamp string    `json:"timestamp"`
+}
+
+func (e *FeedbackGivenEvent) Type() string { return "feedback_FeedbackGiven" }
+func (e *FeedbackGivenEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *FeedbackGivenEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// FeedbackWithdrawnEvent records that the feedback on a request was taken back; it keeps the feedback so it
+// can be undone
+type FeedbackWithdrawnEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Feedback
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *FeedbackWithdrawnEvent) Type() string { return "feedback_FeedbackWithdrawn" }
+func (e *FeedbackWithdrawnEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *FeedbackWithdrawnEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// FeedbackListedEvent answers a ListFeedback command with the feedback matching it and its counts per model
+type FeedbackListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string     `json:"event_type"`
+	Feedback  []Feedback `json:"feedback"`
+	Summary   string     `json:"summary"`
+}
+
+func (e *FeedbackListedEvent) Type() string { return "feedback_FeedbackListed" }
+func (e *FeedbackListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *FeedbackListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("feedback_FeedbackGiven", func() eventsourcing.Event { return &FeedbackGivenEvent{} })
+	eventsourcing.RegisterEvent("feedback_FeedbackWithdrawn", func() eventsourcing.Event { return &FeedbackWithdrawnEvent{} })
+	eventsourcing.RegisterEvent("feedback_FeedbackListed", func() eventsourcing.Event { return &FeedbackListedEvent{} })
+	eventsourcing.RegisterTransientEvent("feedback_FeedbackListed")
+}
+
+// Request is a request that can be rated, with its answer and the models that worked on it
+type Request struct {
+	UserID   string   `json:"user_id,omitempty"`
+	Text     string   `json:"text"`
+	Response string   `json:"response,omitempty"` // Empty until the request completed
+	Models   []string `json:"models,omitempty"`
+}
+
+// Feedback is the user's feedback on the answer to a request
+type Feedback struct {
+	RequestID  string   `json:"request_id"`
+	Rating     string   `json:"rating,omitempty"` // Up, Down or empty for a comment only
+	Comment    string   `json:"comment,omitempty"`
+	Correction bool     `json:"correction,omitempty"` // The comment is shown to MindPalace in later answers
+	Request    string   `json:"request"`
+	Response   string   `json:"response"`
+	Models     []string `json:"models,omitempty"`
+	GivenAt    string   `json:"given_at,omitempty"`
+}
+
+// Registry is the aggregate of the feedback each user gave, and of the recent requests they can rate
+type Registry struct {
+	Feedback map[string][]Feedback // User -> feedback, in the order it was given
+	Requests map[string]*Request   // RequestID -> recent request
+	Recent   []string              // RequestIDs of the recent requests, oldest first
+	Mu       sync.RWMutex
+}
+
+// NewRegistry creates a registry without feedback
+func NewRegistry() *Registry {
+	return &Registry{
+		Feedback: make(map[string][]Feedback),
+		Requests: make(map[string]*Request),
+	}
+}
+
+// ID returns the aggregate's identifier
+func (r *Registry) ID() string {
+	return "feedback"
+}
+
+// ApplyEvent keeps the feedback given and the recent requests with their answers and models
+func (r *Registry) ApplyEvent(event eventsourcing.Event) error {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	userID := event.Metadata().UserID
+	switch e := event.(type) {
+	case *orchestration.UserRequestReceivedEvent:
+		if _, exists := r.Requests[e.RequestID]; exists {
+			return nil
+		}
+		r.Requests[e.RequestID] = &Request{UserID: userID, Text: e.RequestText}
+		r.Recent = append(r.Recent, e.RequestID)
+		if len(r.Recent) > maxRequests {
+			delete(r.Requests, r.Recent[0])
+			r.Recent = r.Recent[1:]
+		}
+	case *usage.TokenUsageRecordedEvent:
+		if request, exists := r.Requests[e.RequestID]; exists && e.Model != "" && !slices.Contains(request.Models, e.Model) {
+			request.Models = append(request.Models, e.Model)
+		}
+	case *orchestration.RequestCompletedEvent:
+		if request, exists := r.Requests[e.RequestID]; exists {
+			request.Response = e.ResponseText
+		}
+	case *FeedbackGivenEvent:
+		r.remove(userID, e.RequestID)
+		r.Feedback[userID] = append(r.Feedback[userID], e.Feedback)
+	case *FeedbackWithdrawnEvent:
+		r.remove(userID, e.RequestID)
+	}
+	return nil
+}
+
+// remove removes the user's feedback on a request; r.Mu must be held
+func (r *Registry) remove(userID, requestID string) {
+	kept := r.Feedback[userID][:0]
+	for _, feedback := range r.Feedback[userID] {
+		if feedback.RequestID != requestID {
+			kept = append(kept, feedback)
+		}
+	}
+	r.Feedback[userID] = kept
+}
+
+// Compensate returns the event undoing feedback given or withdrawn
+func (r *Registry) Compensate(event eventsourcing.Event) ([]eventsourcing.Event, error) {
+	switch e := event.(type) {
+	case *FeedbackGivenEvent:
+		if e.Previous != nil {
+			return []eventsourcing.Event{&FeedbackGivenEvent{Feedback: *e.Previous, Previous: &e.Feedback, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+		}
+		return []eventsourcing.Event{&FeedbackWithdrawnEvent{Feedback: e.Feedback, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+	case *FeedbackWithdrawnEvent:
+		return []eventsourcing.Event{&FeedbackGivenEvent{Feedback: e.Feedback, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+	}
+	return nil, nil
+}
+
+// given returns the user's feedback on a request, nil if there is none; r.Mu must be held
+func (r *Registry) given(userID, requestID string) *Feedback {
+	for _, feedback := range r.Feedback[userID] {
+		if feedback.RequestID == requestID {
+			return &feedback
+		}
+	}
+	return nil
+}
+
+// GiveFeedbackCommand rates the answer to a request of the user, e.g. {"requestID": "req_1", "rating": "down",
+// "comment": "I meant next Friday", "correction": true}. Giving feedback again replaces it.
+func (r *Registry) GiveFeedbackCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	requestID, _ := data["requestID"].(string)
+	rating, _ := data["rating"].(string)
+	comment, _ := data["comment"].(string)
+	correction, _ := data["correction"].(bool)
+	comment = strings.TrimSpace(comment)
+	if rating != Up && rating != Down && rating != "" {
+		return nil, fmt.Errorf("rating must be %q or %q", Up, Down)
+	}
+	if rating == "" && comment == "" {
+		return nil, fmt.Errorf("a rating or a comment is required")
+	}
+	if correction && comment == "" {
+		return nil, fmt.Errorf("a correction needs a comment")
+	}
+	userID := eventsourcing.UserOf(data)
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	request, exists := r.Requests[requestID]
+	if !exists || request.UserID != userID {
+		return nil, fmt.Errorf("there is no recent request %q to give feedback on", requestID)
+	}
+	return []eventsourcing.Event{&FeedbackGivenEvent{
+		Feedback: Feedback{
+			RequestID:  requestID,
+			Rating:     rating,
+			Comment:    comment,
+			Correction: correction,
+			Request:    request.Text,
+			Response:   request.Response,
+			Models:     slices.Clone(request.Models),
+			GivenAt:    eventsourcing.ISOTimestamp(),
+		},
+		Previous:  r.given(userID, requestID),
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// WithdrawFeedbackCommand takes back the feedback on a request, e.g. {"requestID": "req_1"}
+func (r *Registry) WithdrawFeedbackCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	requestID, _ := data["requestID"].(string)
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	feedback := r.given(eventsourcing.UserOf(data), requestID)
+	if feedback == nil {
+		return nil, fmt.Errorf("there is no feedback on request %q", requestID)
+	}
+	return []eventsourcing.Event{&FeedbackWithdrawnEvent{Feedback: *feedback, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+}
+
+// ListFeedbackCommand lists the user's feedback, optionally only that with a rating or on answers of a model,
+// e.g. {"rating": "down", "model": "llama3.2"}
+func (r *Registry) ListFeedbackCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	rating, _ := data["rating"].(string)
+	model, _ := data["model"].(string)
+	listed := []Feedback{}
+	for _, feedback := range r.feedbackOf(eventsourcing.UserOf(data)) {
+		if (rating == "" || feedback.Rating == rating) && (model == "" || slices.Contains(feedback.Models, model)) {
+			listed = append(listed, feedback)
+		}
+	}
+	return []eventsourcing.Event{&FeedbackListedEvent{Feedback: listed, Summary: summarize(listed)}}, nil
+}
+
+// feedbackOf returns a copy of the user's feedback
+func (r *Registry) feedbackOf(userID string) []Feedback {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	return slices.Clone(r.Feedback[userID])
+}
+
+// summarize counts the ratings of the answers of each model
+func summarize(feedback []Feedback) string {
+	type counts struct{ up, down int }
+	byModel := make(map[string]*counts)
+	for _, f := range feedback {
+		models := f.Models
+		if len(models) == 0 {
+			models = []string{"unknown model"}
+		}
+		for _, model := range models {
+			if byModel[model] == nil {
+				byModel[model] = &counts{}
+			}
+			switch f.Rating {
+			case Up:
+				byModel[model].up++
+			case Down:
+				byModel[model].down++
+			}
+		}
+	}
+	if len(byModel) == 0 {
+		return "No feedback given"
+	}
+	models := make([]string, 0, len(byModel))
+	for model := range byModel {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	lines := make([]string, 0, len(models))
+	for _, model := range models {
+		lines = append(lines, fmt.Sprintf("%s: %d up, %d down", model, byModel[model].up, byModel[model].down))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CorrectionsFor returns the most recent corrections of the user, oldest first, see orchestration.CorrectionSource
+func (r *Registry) CorrectionsFor(userID string) []orchestration.Correction {
+	var corrections []orchestration.Correction
+	for _, feedback := range r.feedbackOf(userID) {
+		if feedback.Correction {
+			corrections = append(corrections, orchestration.Correction{Request: feedback.Request, Response: feedback.Response, Comment: feedback.Comment})
+		}
+	}
+	if len(corrections) > maxCorrections {
+		corrections = corrections[len(corrections)-maxCorrections:]
+	}
+	return corrections
+}
+
+// GetCustomUI lists the owner's feedback and its counts per model
+func (r *Registry) GetCustomUI() fyne.CanvasObject {
+	feedback := r.feedbackOf("")
+	if len(feedback) == 0 {
+		return widget.NewLabel("No feedback given yet")
+	}
+	items := container.NewVBox(widget.NewLabel(summarize(feedback)))
+	for i := len(feedback) - 1; i >= 0; i-- {
+		f := feedback[i]
+		line := fmt.Sprintf("%s on %q", f.Rating, f.Request)
+		if f.Rating == "" {
+			line = fmt.Sprintf("Comment on %q", f.Request)
+		}
+		if f.Comment != "" {
+			line += ": " + f.Comment
+		}
+		if f.Correction {
+			line += " (correction)"
+		}
+		label := widget.NewLabel(line)
+		label.Wrapping = fyne.TextWrapWord
+		items.Add(label)
+	}
+	return container.NewVScroll(items)
+}
+
+// SaveSnapshot serializes the feedback and the recent requests
+func (r *Registry) SaveSnapshot() ([]byte, error) {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	return json.Marshal(snapshot{Feedback: r.Feedback, Requests: r.Requests, Recent: r.Recent})
+}
+
+// SnapshotFor serializes the user's feedback and recent requests, see eventsourcing.UserSnapshotter
+func (r *Registry) SnapshotFor(userID string) ([]byte, error) {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	requests := make(map[string]*Request)
+	recent := []string{}
+	for _, requestID := range r.Recent {
+		if request, exists := r.Requests[requestID]; exists && request.UserID == userID {
+			requests[requestID] = request
+			recent = append(recent, requestID)
+		}
+	}
+	return json.Marshal(snapshot{Feedback: map[string][]Feedback{userID: r.Feedback[userID]}, Requests: requests, Recent: recent})
+}
+
+// LoadSnapshot replaces the registry's state with the snapshot
+func (r *Registry) LoadSnapshot(data []byte) error {
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s.Feedback == nil {
+		s.Feedback = make(map[string][]Feedback)
+	}
+	if s.Requests == nil {
+		s.Requests = make(map[string]*Request)
+	}
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	r.Feedback, r.Requests, r.Recent = s.Feedback, s.Requests, s.Recent
+	return nil
+}
+
+type snapshot struct {
+	Feedback map[string][]Feedback `json:"feedback"`
+	Requests map[string]*Request   `json:"requests"`
+	Recent   []string              `json:"recent"`
+}
@@ -0,0 +1,107 @@
+package feedback
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"mindpalace/internal/orchestration"
+	"mindpalace/internal/usage"
+	"mindpalace/pkg/eventsourcing/eventsourcingtest"
+)
+
+// request applies the events of a request of the user answered by the model
+func request(t *testing.T, r *Registry, userID, requestID, text, model, response string) {
+	t.Helper()
+	eventsourcingtest.Apply(t, r, userID,
+		&orchestration.UserRequestReceivedEvent{RequestID: requestID, RequestText: text},
+		&usage.TokenUsageRecordedEvent{RequestID: requestID, Model: model},
+		&orchestration.RequestCompletedEvent{RequestID: requestID, ResponseText: response},
+	)
+}
+
+func TestRegistry_GiveFeedback(t *testing.T) {
+	r := NewRegistry()
+	request(t, r, "", "req1", "what's on friday?", "llama3.2", "Nothing planned.")
+	request(t, r, "", "req2", "add milk", "qwen3", "Added milk.")
+	request(t, r, "alice", "req3", "add eggs", "qwen3", "Added eggs.")
+
+	eventsourcingtest.Execute(t, r, "", r.GiveFeedbackCommand, map[string]interface{}{"requestID": "req2", "rating": "up"})
+	given := eventsourcingtest.Execute(t, r, "", r.GiveFeedbackCommand, map[string]interface{}{"requestID": "req1", "rating": "down", "comment": "I have the dentist", "correction": true})
+	if f := given[0].(*FeedbackGivenEvent).Feedback; f.Request != "what's on friday?" || f.Response != "Nothing planned." || f.Models[0] != "llama3.2" {
+		t.Errorf("Expected the feedback linked to the request, its answer and model, got %+v", f)
+	}
+
+	for name, data := range map[string]map[string]interface{}{
+		"unknown rating":         {"requestID": "req1", "rating": "meh"},
+		"nothing to say":         {"requestID": "req1"},
+		"correction no comment":  {"requestID": "req1", "rating": "down", "correction": true},
+		"unknown request":        {"requestID": "req9", "rating": "up"},
+		"another user's request": {"requestID": "req3", "rating": "up"},
+	} {
+		data["userID"] = ""
+		if _, err := r.GiveFeedbackCommand(data); err == nil {
+			t.Errorf("Expected feedback with %s to fail", name)
+		}
+	}
+
+	events := eventsourcingtest.Execute(t, r, "", r.ListFeedbackCommand, map[string]interface{}{"rating": "down"})
+	listed := events[0].(*FeedbackListedEvent)
+	if len(listed.Feedback) != 1 || listed.Feedback[0].Comment != "I have the dentist" || listed.Summary != "llama3.2: 0 up, 1 down" {
+		t.Errorf("Expected the thumbs down listed, got %+v", listed)
+	}
+	events = eventsourcingtest.Execute(t, r, "", r.ListFeedbackCommand, map[string]interface{}{"model": "qwen3"})
+	if listed := events[0].(*FeedbackListedEvent).Feedback; len(listed) != 1 || listed[0].RequestID != "req2" {
+		t.Errorf("Expected the owner's feedback on qwen3's answers, got %+v", listed)
+	}
+
+	// Rating again replaces the feedback, undoing that restores it
+	changed := eventsourcingtest.Execute(t, r, "", r.GiveFeedbackCommand, map[string]interface{}{"requestID": "req1", "rating": "up"})
+	if len(r.Feedback[""]) != 2 || len(r.CorrectionsFor("")) != 0 {
+		t.Errorf("Expected the feedback replaced, got %+v", r.Feedback[""])
+	}
+	undo, _ := r.Compensate(changed[0])
+	eventsourcingtest.Apply(t, r, "", undo[0])
+	if corrections := r.CorrectionsFor(""); len(corrections) != 1 || corrections[0].Comment != "I have the dentist" {
+		t.Errorf("Expected the correction back after undoing, got %+v", corrections)
+	}
+	eventsourcingtest.Execute(t, r, "", r.WithdrawFeedbackCommand, map[string]interface{}{"requestID": "req1"})
+	if len(r.CorrectionsFor("")) != 0 {
+		t.Error("Expected the correction gone once withdrawn")
+	}
+}
+
+func TestRegistry_RecentRequestsAndSnapshot(t *testing.T) {
+	r := NewRegistry()
+	for i := 0; i <= maxRequests; i++ {
+		request(t, r, "", fmt.Sprintf("req%d", i), fmt.Sprintf("request %d", i), "llama3.2", "Done.")
+	}
+	if _, err := r.GiveFeedbackCommand(map[string]interface{}{"requestID": "req0", "rating": "up"}); err == nil {
+		t.Error("Expected the oldest request forgotten")
+	}
+	for i := 1; i <= maxCorrections+1; i++ {
+		eventsourcingtest.Execute(t, r, "", r.GiveFeedbackCommand, map[string]interface{}{"requestID": fmt.Sprintf("req%d", i), "comment": fmt.Sprintf("comment %d", i), "correction": true})
+	}
+	corrections := r.CorrectionsFor("")
+	if len(corrections) != maxCorrections || corrections[0].Comment != "comment 2" {
+		t.Errorf("Expected the %d most recent corrections, got %+v", maxCorrections, corrections)
+	}
+
+	data, err := r.SaveSnapshot()
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	restored := NewRegistry()
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if len(restored.Feedback[""]) != maxCorrections+1 || len(restored.Requests) != maxRequests {
+		t.Errorf("Expected the feedback and recent requests restored, got %d and %d", len(restored.Feedback[""]), len(restored.Requests))
+	}
+	if _, err := restored.GiveFeedbackCommand(map[string]interface{}{"requestID": fmt.Sprint("req", maxRequests), "rating": "up"}); err != nil {
+		t.Errorf("Expected a recent request rated after restoring, got %v", err)
+	}
+	if !strings.Contains(summarize(restored.Feedback[""]), "llama3.2: 0 up, 0 down") {
+		t.Errorf("Unexpected summary %q", summarize(restored.Feedback[""]))
+	}
+}
@@ -0,0 +1,59 @@
+package godot_ws
+
+import "mindpalace/pkg/eventsourcing"
+
+// Capabilities a client can declare in its ready message, e.g. {"capabilities": ["xr"]}. The server
+// answers with those it supports, so clients can add rendering modes without server changes.
+const (
+	CapabilityXR = "xr" // The client renders in VR or AR and gets the XR hints of the deltas
+)
+
+// supportedCapabilities are the capabilities the server accepts
+var supportedCapabilities = map[string]bool{CapabilityXR: true}
+
+// negotiateCapabilities returns the capabilities of the ready message the server supports, in the order
+// the client listed them. Clients that don't declare any get none.
+func negotiateCapabilities(msg map[string]interface{}) []string {
+	declared, _ := msg["capabilities"].([]interface{})
+	accepted := []string{}
+	seen := make(map[string]bool)
+	for _, c := range declared {
+		capability, _ := c.(string)
+		if supportedCapabilities[capability] && !seen[capability] {
+			seen[capability] = true
+			accepted = append(accepted, capability)
+		}
+	}
+	return accepted
+}
+
+// hasCapability tells whether the capability is one of the accepted ones
+func hasCapability(accepted []string, capability string) bool {
+	for _, c := range accepted {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutXR returns the envelopes with the XR hints of their actions left out, for clients that don't
+// render in XR. Envelopes without hints are kept as they are.
+func withoutXR(envs []eventsourcing.DeltaEnvelope) []eventsourcing.DeltaEnvelope {
+	stripped := make([]eventsourcing.DeltaEnvelope, len(envs))
+	for i, env := range envs {
+		stripped[i] = env
+		copied := false
+		for j, action := range env.Actions {
+			if action.XR == nil {
+				continue
+			}
+			if !copied {
+				stripped[i].Actions = append([]eventsourcing.DeltaAction(nil), env.Actions...)
+				copied = true
+			}
+			stripped[i].Actions[j].XR = nil
+		}
+	}
+	return stripped
+}
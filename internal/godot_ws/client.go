@@ -0,0 +1,131 @@
+package godot_ws
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Timing of the connection with a client, variables so tests can shorten them
+var (
+	writeWait  = 10 * time.Second  // Time a write may take before the client counts as stalled
+	pongWait   = 60 * time.Second  // Time without a pong or message after which the client counts as gone
+	pingPeriod = pongWait * 9 / 10 // Time between pings, shorter than pongWait
+)
+
+// sendBuffer is the number of messages queued for a client before it counts as too slow and is disconnected
+const sendBuffer = 256
+
+type ClientState struct {
+	conn      *websocket.Conn
+	ready     bool
+	lastReady time.Time
+	userID    string        // User the client authenticated as, empty for the owner
+	binary    bool          // Whether the client exchanges audio in binary frames
+	audioRate int           // Sample rate of the client's microphone audio
+	xr        bool          // Whether the client renders in XR and gets the XR hints of the deltas
+	send      chan outgoing // Messages waiting for the client's writer
+	done      chan struct{} // Closed once the writer stopped
+	mu        sync.Mutex
+	closed    bool
+	closeCode int    // Close code the writer sends once the queue is written
+	closeText string // Reason sent with the close code
+}
+
+// outgoing is a message queued for a client
+type outgoing struct {
+	kind int // websocket.TextMessage or websocket.BinaryMessage
+	data []byte
+}
+
+// newClient creates the state of a connected client and starts its writer
+func newClient(conn *websocket.Conn, userID string) *ClientState {
+	client := &ClientState{
+		conn:   conn,
+		userID: userID,
+		send:   make(chan outgoing, sendBuffer),
+		done:   make(chan struct{}),
+	}
+	go client.write()
+	return client
+}
+
+// queue queues a message for the client without waiting for it to be written. A client that fell
+// sendBuffer messages behind is disconnected, so it can't hold up the others; false if the message was
+// dropped.
+func (c *ClientState) queue(kind int, data []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.send <- outgoing{kind: kind, data: data}:
+		return true
+	default:
+		logger.Error("Godot client of user %q fell %d messages behind, disconnecting it", c.userID, sendBuffer)
+		c.closeLocked(websocket.CloseTryAgainLater, "too slow")
+		return false
+	}
+}
+
+// queueJSON queues a message encoded as JSON
+func (c *ClientState) queueJSON(msg interface{}) bool {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logger.Error("Error encoding message for Godot: %v", err)
+		return false
+	}
+	return c.queue(websocket.TextMessage, data)
+}
+
+// close stops the client: the writer writes the messages queued, sends the close code and closes the
+// connection
+func (c *ClientState) close(code int, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeLocked(code, text)
+}
+
+func (c *ClientState) closeLocked(code int, text string) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.closeCode = code
+	c.closeText = text
+	close(c.send)
+}
+
+// write writes the queued messages to the connection and pings the client, until the client is closed or
+// a write fails
+func (c *ClientState) write() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.close(websocket.CloseNormalClosure, "")
+		c.conn.Close()
+		close(c.done)
+	}()
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, c.closeText))
+				return
+			}
+			if err := c.conn.WriteMessage(message.kind, message.data); err != nil {
+				logger.Error("Error writing to Godot client, disconnecting it: %v", err)
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				logger.Error("Error pinging Godot client, disconnecting it: %v", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package godot_ws
+
+import (
+	"encoding/binary"
+
+	"mindpalace/internal/tts"
+)
+
+// Binary frames carry audio between the server and clients that negotiated them in their ready message,
+// instead of base64 in JSON. The first byte of a frame is its opcode; numbers are little-endian, as Godot
+// decodes them. Control messages stay JSON.
+const (
+	OpMicAudio    byte = 0x01 // Client to server: PCM16 mono microphone audio at the negotiated sample rate
+	OpSpeechAudio byte = 0x02 // Server to client: flags, seq (uint32), sample rate (uint32), request ID length (uint16), request ID, PCM16
+)
+
+// speechFinal flags the last frame of a response
+const speechFinal byte = 1
+
+// speechHeader is the size of a speech frame before its request ID
+const speechHeader = 1 + 1 + 4 + 4 + 2
+
+// TranscriptionSampleRate is the sample rate the transcriber takes audio in; audio of clients capturing
+// at another rate is resampled to it
+const TranscriptionSampleRate = 16000
+
+// negotiateAudio reads the audio a client supports from its ready message, e.g. {"audio": {"binary":
+// true, "sample_rates": [48000, 16000]}}, and returns whether it gets binary frames and the rate it sends
+// microphone audio in: the transcriber's if the client can capture at it, its first rate otherwise.
+// Clients that don't say send raw binary audio at the transcriber's rate and get speech as JSON.
+func negotiateAudio(msg map[string]interface{}) (bool, int) {
+	audio, _ := msg["audio"].(map[string]interface{})
+	if frames, _ := audio["binary"].(bool); !frames {
+		return false, TranscriptionSampleRate
+	}
+	rates, _ := audio["sample_rates"].([]interface{})
+	rate := 0
+	for _, r := range rates {
+		offered, ok := r.(float64)
+		if !ok || offered <= 0 {
+			continue
+		}
+		if int(offered) == TranscriptionSampleRate {
+			return true, TranscriptionSampleRate
+		}
+		if rate == 0 {
+			rate = int(offered)
+		}
+	}
+	if rate == 0 {
+		rate = TranscriptionSampleRate
+	}
+	return true, rate
+}
+
+// encodeSpeechFrame encodes a frame of synthesized speech as an OpSpeechAudio frame
+func encodeSpeechFrame(frame tts.Frame) []byte {
+	requestID := frame.RequestID
+	if len(requestID) > 0xFFFF {
+		requestID = requestID[:0xFFFF]
+	}
+	message := make([]byte, speechHeader, speechHeader+len(requestID)+len(frame.Data))
+	message[0] = OpSpeechAudio
+	if frame.Final {
+		message[1] = speechFinal
+	}
+	binary.LittleEndian.PutUint32(message[2:], uint32(frame.Seq))
+	binary.LittleEndian.PutUint32(message[6:], uint32(frame.SampleRate))
+	binary.LittleEndian.PutUint16(message[10:], uint16(len(requestID)))
+	message = append(message, requestID...)
+	return append(message, frame.Data...)
+}
+
+// resamplePCM16 converts PCM16 mono audio from one sample rate to another by linear interpolation
+func resamplePCM16(pcm []byte, from, to int) []byte {
+	if from == to || from <= 0 || to <= 0 || len(pcm) < 4 {
+		return pcm
+	}
+	samples := len(pcm) / 2
+	sample := func(i int) float64 { return float64(int16(binary.LittleEndian.Uint16(pcm[2*i:]))) }
+	count := int(int64(samples) * int64(to) / int64(from))
+	resampled := make([]byte, 2*count)
+	for i := 0; i < count; i++ {
+		position := float64(i) * float64(from) / float64(to)
+		left := int(position)
+		value := sample(left)
+		if left+1 < samples {
+			value += (sample(left+1) - value) * (position - float64(left))
+		}
+		binary.LittleEndian.PutUint16(resampled[2*i:], uint16(int16(value)))
+	}
+	return resampled
+}
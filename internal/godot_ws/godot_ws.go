@@ -1,6 +1,7 @@
 package godot_ws
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -11,52 +12,61 @@ import (
 
 	"github.com/gorilla/websocket"
 	"mindpalace/internal/audio"
+	"mindpalace/internal/audioinput"
+	"mindpalace/internal/auth"
+	"mindpalace/internal/layout"
+	"mindpalace/internal/llmprocessor"
 	"mindpalace/internal/orchestration"
+	"mindpalace/internal/tts"
 	"mindpalace/pkg/eventsourcing"
 	"mindpalace/pkg/logging"
+	"mindpalace/pkg/ui3d"
 )
 
+// logger logs the connection with the 3D client
+var logger = logging.Named("godot_ws")
+
 type GodotServer struct {
 	upgrader          websocket.Upgrader
 	clients           map[*websocket.Conn]*ClientState
 	clientsMu         sync.RWMutex
 	deltaChan         chan eventsourcing.DeltaEnvelope
 	aggStore          eventsourcing.AggregateStore
-	audioCallback     func([]byte) // Callback for processing audio chunks
+	audioCallback     func([]byte)                                   // Callback for processing audio chunks
+	speechMute        func(bool)                                     // Callback for muting speech output
+	audioSettings     func(settings map[string]interface{})          // Callback for changing the microphone and its processing
+	confirm           func(userID, toolCallID string, approved bool) // Callback for answering tool call confirmations
+	interact          func(eventsourcing.Interaction)                // Callback for executing interactions with 3D objects
+	users             *auth.Users                                    // Authenticates clients once users are configured
+	requestUser       func(requestID string) string                  // Returns the user who made a request
 	transcriber       *audio.VoiceTranscriber
 	settingsVisible   bool
 	selectedMicDevice string
 	eventBus          eventsourcing.EventBus
 	pendingKeypresses map[string]chan map[string]interface{}
+	pendingQueries    map[string]pendingQuery // Queries of the world waiting for a client's answer, by ID
 	pendingMu         sync.RWMutex
+	httpServer        *http.Server
+	theme             map[string]interface{} // Palette message sent to clients as they connect, nil for the client's own
+	themeMu           sync.RWMutex
+	batchWindow       time.Duration // Deltas arriving within it of the first are sent together
+	compression       bool          // Whether permessage-deflate is negotiated with new clients
+	maxPayload        int           // Size in bytes above which messages of deltas are split, 0 for no limit
+	transportMu       sync.RWMutex
 }
 
-type ClientState struct {
-	conn      *websocket.Conn
-	ready     bool
-	lastReady time.Time
-}
-
-type TaskPositionUpdatedEvent struct {
-	EventType string  `json:"event_type"`
-	TaskID    string  `json:"task_id"`
-	PositionX float64 `json:"position_x"`
-	PositionY float64 `json:"position_y"`
-	PositionZ float64 `json:"position_z"`
-}
-
-func (e *TaskPositionUpdatedEvent) Type() string {
-	return "taskmanager_TaskPositionUpdated"
-}
-
-func (e *TaskPositionUpdatedEvent) Marshal() ([]byte, error) {
-	e.EventType = e.Type()
-	return json.Marshal(e)
+// DeltaBatch carries the deltas of several events to a client in one message, in the order the events
+// were applied
+type DeltaBatch struct {
+	Type   string            `json:"type"` // "deltas"
+	Deltas []json.RawMessage `json:"deltas"`
 }
 
-func (e *TaskPositionUpdatedEvent) Unmarshal(data []byte) error {
-	return json.Unmarshal(data, e)
-}
+// Defaults of how deltas are sent, until Configure changes them
+const (
+	defaultBatchWindow = 20 * time.Millisecond
+	defaultMaxPayload  = 512 * 1024
+)
 
 func NewGodotServer() *GodotServer {
 	return &GodotServer{
@@ -66,9 +76,30 @@ func NewGodotServer() *GodotServer {
 		clients:           make(map[*websocket.Conn]*ClientState),
 		deltaChan:         make(chan eventsourcing.DeltaEnvelope, 100),
 		pendingKeypresses: make(map[string]chan map[string]interface{}),
+		pendingQueries:    make(map[string]pendingQuery),
+		httpServer:        &http.Server{Addr: ":8081"},
+		batchWindow:       defaultBatchWindow,
+		maxPayload:        defaultMaxPayload,
 	}
 }
 
+// Configure sets how deltas are sent: the window within which they are batched, whether messages are
+// compressed for clients connecting from now on, and the size in bytes above which the full state is split
+func (s *GodotServer) Configure(batchWindow time.Duration, compression bool, maxPayload int) {
+	s.transportMu.Lock()
+	defer s.transportMu.Unlock()
+	s.batchWindow = batchWindow
+	s.compression = compression
+	s.maxPayload = maxPayload
+}
+
+// transport returns the batch window and the maximum payload
+func (s *GodotServer) transport() (time.Duration, int) {
+	s.transportMu.RLock()
+	defer s.transportMu.RUnlock()
+	return s.batchWindow, s.maxPayload
+}
+
 func (s *GodotServer) SetDeltaChan(ch chan eventsourcing.DeltaEnvelope) {
 	s.deltaChan = ch
 }
@@ -81,6 +112,56 @@ func (s *GodotServer) SetAudioCallback(callback func([]byte)) {
 	s.audioCallback = callback
 }
 
+func (s *GodotServer) SetSpeechMuteCallback(callback func(bool)) {
+	s.speechMute = callback
+}
+
+// SetAudioSettingsCallback sets the callback changing the microphone and the processing of its audio,
+// called with the "device", "noise_suppression" and "gain_normalization" the client sent
+func (s *GodotServer) SetAudioSettingsCallback(callback func(settings map[string]interface{})) {
+	s.audioSettings = callback
+}
+
+// SetConfirmCallback sets the callback answering tool calls that wait for the user's confirmation
+func (s *GodotServer) SetConfirmCallback(callback func(userID, toolCallID string, approved bool)) {
+	s.confirm = callback
+}
+
+// SetUsers requires clients to authenticate as one of the users once users are configured. Each
+// client is shown the world of its user.
+func (s *GodotServer) SetUsers(users *auth.Users) {
+	s.users = users
+}
+
+// SetRequestUser sets the function returning the user who made a request, so the answers streaming
+// in reach that user's clients only
+func (s *GodotServer) SetRequestUser(requestUser func(requestID string) string) {
+	s.requestUser = requestUser
+}
+
+// userOfRequest returns the user who made a request, empty for the owner
+func (s *GodotServer) userOfRequest(requestID string) string {
+	if s.requestUser == nil {
+		return ""
+	}
+	return s.requestUser(requestID)
+}
+
+// clientUser returns the user a client authenticated as
+func (s *GodotServer) clientUser(conn *websocket.Conn) string {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	if client, exists := s.clients[conn]; exists {
+		return client.userID
+	}
+	return ""
+}
+
+// SetInteractionCallback sets the callback executing what the user did to 3D objects
+func (s *GodotServer) SetInteractionCallback(callback func(eventsourcing.Interaction)) {
+	s.interact = callback
+}
+
 func (s *GodotServer) SetTranscriber(t *audio.VoiceTranscriber) {
 	s.transcriber = t
 }
@@ -90,7 +171,7 @@ func (s *GodotServer) SetEventBus(eb eventsourcing.EventBus) {
 }
 
 func (s *GodotServer) SendTranscription(text string) {
-	logging.Debug("AUDIO: Sending transcription to Godot: %s", text)
+	logger.Debug("AUDIO: Sending transcription to Godot: %s", text)
 	env := eventsourcing.DeltaEnvelope{
 		Type:      "delta",
 		Aggregate: "transcription",
@@ -110,8 +191,66 @@ func (s *GodotServer) SendTranscription(text string) {
 	s.broadcast(env)
 }
 
+// SendLLMStream sends the text generated so far for a request, so the 3D client can show it while it streams
+func (s *GodotServer) SendLLMStream(requestID, content string, isFinal bool) {
+	logger.Trace("Sending LLM stream for request %s to Godot: %d chars, final=%v", requestID, len(content), isFinal)
+	env := eventsourcing.DeltaEnvelope{
+		Type:      "delta",
+		Aggregate: "llm_stream",
+		EventID:   fmt.Sprintf("llm_stream-%d", time.Now().UnixNano()),
+		Timestamp: eventsourcing.ISOTimestamp(),
+		UserID:    s.userOfRequest(requestID),
+		Actions: []eventsourcing.DeltaAction{
+			{
+				Type:     "update",
+				NodeID:   "llm_stream_display",
+				NodeType: "Label3D",
+				Properties: map[string]interface{}{
+					"text":       content,
+					"request_id": requestID,
+					"is_final":   isFinal,
+				},
+			},
+		},
+	}
+	s.broadcast(env)
+}
+
+// SendSpeechFrame streams a frame of synthesized speech to the 3D client for playback, as a binary frame to
+// clients that negotiated them
+func (s *GodotServer) SendSpeechFrame(frame tts.Frame) {
+	logger.Trace("Sending speech frame %d for request %s to Godot: %d bytes, final=%v", frame.Seq, frame.RequestID, len(frame.Data), frame.Final)
+	userID := s.userOfRequest(frame.RequestID)
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	for _, client := range s.clients {
+		if client.userID != userID {
+			continue
+		}
+		if client.binary {
+			client.queue(websocket.BinaryMessage, encodeSpeechFrame(frame))
+			continue
+		}
+		client.queueJSON(map[string]interface{}{
+			"type":        "tts_audio",
+			"request_id":  frame.RequestID,
+			"seq":         frame.Seq,
+			"sample_rate": frame.SampleRate,
+			"data":        base64.StdEncoding.EncodeToString(frame.Data),
+			"final":       frame.Final,
+		})
+	}
+}
+
+// HandleStreamingEvent forwards non-persisted streaming events to Godot; assign it to eventsourcing.SubmitStreamingEvent
+func (s *GodotServer) HandleStreamingEvent(event eventsourcing.Event) {
+	if chunk, ok := event.(*eventsourcing.LLMStreamChunkEvent); ok {
+		s.SendLLMStream(chunk.RequestID, chunk.PartialContent, chunk.IsFinal)
+	}
+}
+
 func (s *GodotServer) SendKeypresses(keyString string) {
-	logging.Debug("Sending keypresses to Godot: %s", keyString)
+	logger.Debug("Sending keypresses to Godot: %s", keyString)
 	msg := map[string]interface{}{
 		"type": "keypresses",
 		"keys": keyString,
@@ -120,7 +259,7 @@ func (s *GodotServer) SendKeypresses(keyString string) {
 }
 
 func (s *GodotServer) SendKeypressesWithID(keyString, correlationID string) {
-	logging.Debug("Sending keypresses to Godot: keys='%s', correlation_id='%s'", keyString, correlationID)
+	logger.Debug("Sending keypresses to Godot: keys='%s', correlation_id='%s'", keyString, correlationID)
 	msg := map[string]interface{}{
 		"type":           "keypresses",
 		"keys":           keyString,
@@ -130,20 +269,20 @@ func (s *GodotServer) SendKeypressesWithID(keyString, correlationID string) {
 }
 
 func (s *GodotServer) handleTextMessage(conn *websocket.Conn, message []byte) {
-	logging.Trace("Handling text message from Godot")
+	logger.Trace("Handling text message from Godot")
 	var msg map[string]interface{}
 	if err := json.Unmarshal(message, &msg); err != nil {
-		logging.Error("Failed to parse JSON message from Godot: %v", err)
+		logger.Error("Failed to parse JSON message from Godot: %v", err)
 		return
 	}
 
 	msgType, ok := msg["type"].(string)
 	if !ok {
-		logging.Error("Message missing 'type' field")
+		logger.Error("Message missing 'type' field")
 		return
 	}
 
-	logging.Trace("Parsed message type: %s", msgType)
+	logger.Trace("Parsed message type: %s", msgType)
 	switch msgType {
 	case "ready":
 		s.handleReadyMessage(conn, msg)
@@ -152,64 +291,204 @@ func (s *GodotServer) handleTextMessage(conn *websocket.Conn, message []byte) {
 	case "state_update":
 		s.handleStateUpdate(msg)
 	case "request":
-		s.handleRequestMessage(msg)
+		s.handleRequestMessage(s.clientUser(conn), msg)
 	case "delta":
 		s.handleDeltaMessage(msg)
 	case "keypress_ack":
 		s.handleKeypressAck(msg)
+	case "tts_mute":
+		s.handleSpeechMute(msg)
+	case "audio_settings":
+		s.handleAudioSettings(s.clientUser(conn), msg)
+	case "confirm":
+		s.handleConfirm(s.clientUser(conn), msg)
+	case "world_nodes":
+		s.handleWorldNodes(s.clientUser(conn), message)
+	case eventsourcing.ObjectClicked, eventsourcing.ObjectMoved, eventsourcing.ObjectDeleted:
+		s.handleObjectMessage(s.clientUser(conn), msgType, msg)
 		// case "start_audio_capture":
-		// 	logging.Info("Received start_audio_capture signal from Godot")
+		// 	logger.Info("Received start_audio_capture signal from Godot")
 		// 	if s.transcriber != nil {
 		// 		if err := s.transcriber.StartCapture(context.Background()); err != nil {
-		// 			logging.Error("Failed to start audio capture: %v", err)
+		// 			logger.Error("Failed to start audio capture: %v", err)
 		// 		} else {
-		// 			logging.Info("Started audio capture from backend microphone")
+		// 			logger.Info("Started audio capture from backend microphone")
 		// 		}
 		// 	} else {
-		// 		logging.Info("Transcriber not set for audio capture")
+		// 		logger.Info("Transcriber not set for audio capture")
 		// 	}
 	default:
-		logging.Info("Unknown message type from Godot: %s", msgType)
+		logger.Info("Unknown message type from Godot: %s", msgType)
 	}
 }
 
-func (s *GodotServer) handleBinaryMessage(message []byte) {
-	logging.Debug("AUDIO: Handling binary message from Godot: %d bytes", len(message))
-	// Binary messages are audio data
+// handleBinaryMessage passes microphone audio to the audio callback: OpMicAudio frames of clients that
+// negotiated binary frames, resampled to the transcriber's rate, and raw PCM16 of the others
+func (s *GodotServer) handleBinaryMessage(conn *websocket.Conn, message []byte) {
+	logger.Debug("AUDIO: Handling binary message from Godot: %d bytes", len(message))
+	s.clientsMu.RLock()
+	client := s.clients[conn]
+	s.clientsMu.RUnlock()
+	if client != nil && client.binary {
+		if len(message) == 0 || message[0] != OpMicAudio {
+			logger.Info("AUDIO: Ignoring binary frame with unknown opcode from Godot")
+			return
+		}
+		message = resamplePCM16(message[1:], client.audioRate, TranscriptionSampleRate)
+	}
 	if s.audioCallback != nil {
-		logging.Debug("AUDIO: Calling audio callback with binary data (%d bytes)", len(message))
+		logger.Debug("AUDIO: Calling audio callback with binary data (%d bytes)", len(message))
 		s.audioCallback(message)
 	} else {
-		logging.Info("AUDIO: Audio callback not set, ignoring binary message")
+		logger.Info("AUDIO: Audio callback not set, ignoring binary message")
 	}
 }
 
 func (s *GodotServer) handleAudioChunk(msg map[string]interface{}) {
-	logging.Debug("AUDIO: Handling audio chunk from Godot")
+	logger.Debug("AUDIO: Handling audio chunk from Godot")
 	dataStr, ok := msg["data"].(string)
 	if !ok {
-		logging.Error("AUDIO: Audio chunk missing 'data' field")
+		logger.Error("AUDIO: Audio chunk missing 'data' field")
 		return
 	}
 
-	logging.Debug("AUDIO: Decoding base64 audio data, length: %d", len(dataStr))
+	logger.Debug("AUDIO: Decoding base64 audio data, length: %d", len(dataStr))
 	audioData, err := base64.StdEncoding.DecodeString(dataStr)
 	if err != nil {
-		logging.Error("AUDIO: Failed to decode base64 audio data: %v", err)
+		logger.Error("AUDIO: Failed to decode base64 audio data: %v", err)
 		return
 	}
 
-	logging.Debug("AUDIO: Decoded audio data: %d bytes", len(audioData))
+	logger.Debug("AUDIO: Decoded audio data: %d bytes", len(audioData))
 	if s.audioCallback != nil {
-		logging.Debug("AUDIO: Calling audio callback with decoded data (%d bytes)", len(audioData))
+		logger.Debug("AUDIO: Calling audio callback with decoded data (%d bytes)", len(audioData))
 		s.audioCallback(audioData)
 	} else {
-		logging.Info("AUDIO: Audio callback not set, ignoring audio chunk")
+		logger.Info("AUDIO: Audio callback not set, ignoring audio chunk")
+	}
+}
+
+func (s *GodotServer) handleSpeechMute(msg map[string]interface{}) {
+	muted, ok := msg["muted"].(bool)
+	if !ok {
+		logger.Error("Speech mute message missing 'muted' field")
+		return
+	}
+	if s.speechMute != nil {
+		s.speechMute(muted)
+	} else {
+		logger.Info("Speech output not enabled, ignoring mute")
+	}
+}
+
+// handleAudioSettings passes the settings of the microphone on; only the owner captures audio and may change them.
+// A message without settings asks for the devices and the current settings.
+func (s *GodotServer) handleAudioSettings(userID string, msg map[string]interface{}) {
+	if userID != "" {
+		logger.Info("User %s may not change the microphone, ignoring audio settings", userID)
+		return
+	}
+	settings := make(map[string]interface{})
+	for _, field := range []string{"device", "noise_suppression", "gain_normalization"} {
+		if value, ok := msg[field]; ok {
+			settings[field] = value
+		}
+	}
+	if s.audioSettings != nil {
+		s.audioSettings(settings)
+	} else {
+		logger.Info("Audio settings not enabled, ignoring audio settings")
+	}
+}
+
+// HandleAudioDevicesListed sends the microphones and the audio settings to the owner's clients for the
+// settings panel; subscribe it to audioinput_DevicesListed
+func (s *GodotServer) HandleAudioDevicesListed(event eventsourcing.Event) error {
+	e, ok := event.(*audioinput.DevicesListedEvent)
+	if !ok {
+		return nil
+	}
+	s.sendJSONTo("", map[string]interface{}{
+		"type":               "audio_devices",
+		"devices":            e.Devices,
+		"selected":           e.Selected,
+		"noise_suppression":  e.NoiseSuppression,
+		"gain_normalization": e.GainNormalization,
+	})
+	return nil
+}
+
+// HandleLLMStatus tells every client the LLM went offline, failed over or is back online
+func (s *GodotServer) HandleLLMStatus(event eventsourcing.Event) error {
+	e, ok := event.(*llmprocessor.StatusChangedEvent)
+	if !ok {
+		return nil
+	}
+	s.broadcastJSON(map[string]interface{}{
+		"type":     "llm_status",
+		"status":   e.Status,
+		"endpoint": e.Endpoint,
+		"message":  e.Message,
+	})
+	return nil
+}
+
+// HandleCameraDirected moves the camera of the clients of the user who asked, see SendCamera
+func (s *GodotServer) HandleCameraDirected(event eventsourcing.Event) error {
+	e, ok := event.(*orchestration.CameraDirectedEvent)
+	if !ok {
+		return nil
+	}
+	s.SendCamera(eventsourcing.CameraEnvelope{
+		Action:    e.Action,
+		NodeID:    e.NodeID,
+		Zone:      e.Zone,
+		UserID:    e.Metadata().UserID,
+		Timestamp: e.Timestamp,
+	})
+	return nil
+}
+
+// SendCamera sends a camera directive to the clients of its user
+func (s *GodotServer) SendCamera(env eventsourcing.CameraEnvelope) {
+	env.Type = "camera"
+	if env.Timestamp == "" {
+		env.Timestamp = eventsourcing.ISOTimestamp()
+	}
+	logger.Debug("Directing the camera of %q: %s %s%s", env.UserID, env.Action, env.NodeID, env.Zone)
+	s.sendJSONTo(env.UserID, env)
+}
+
+// SendTheme tells every client to draw the world in the palette, and clients connecting later too
+func (s *GodotServer) SendTheme(name string, palette ui3d.Theme) {
+	msg := map[string]interface{}{
+		"type":    "theme",
+		"name":    name,
+		"dark":    palette.Dark(),
+		"palette": palette,
+	}
+	s.themeMu.Lock()
+	s.theme = msg
+	s.themeMu.Unlock()
+	s.broadcastJSON(msg)
+}
+
+func (s *GodotServer) handleConfirm(userID string, msg map[string]interface{}) {
+	toolCallID, _ := msg["tool_call_id"].(string)
+	approved, ok := msg["approved"].(bool)
+	if toolCallID == "" || !ok {
+		logger.Error("Confirm message missing 'tool_call_id' or 'approved' field")
+		return
+	}
+	if s.confirm != nil {
+		s.confirm(userID, toolCallID, approved)
+	} else {
+		logger.Info("Confirmations not enabled, ignoring confirm")
 	}
 }
 
 func (s *GodotServer) handleStateUpdate(msg map[string]interface{}) {
-	logging.Debug("Handling state update from Godot: %v", msg)
+	logger.Debug("Handling state update from Godot: %v", msg)
 	if visible, ok := msg["settings_visible"].(bool); ok {
 		s.settingsVisible = visible
 	}
@@ -218,11 +497,11 @@ func (s *GodotServer) handleStateUpdate(msg map[string]interface{}) {
 	}
 }
 
-func (s *GodotServer) handleRequestMessage(msg map[string]interface{}) {
-	logging.Debug("Handling request from Godot: %v", msg)
+func (s *GodotServer) handleRequestMessage(userID string, msg map[string]interface{}) {
+	logger.Debug("Handling request from Godot: %v", msg)
 	text, ok := msg["text"].(string)
 	if !ok {
-		logging.Error("Request message missing text")
+		logger.Error("Request message missing text")
 		return
 	}
 
@@ -231,19 +510,21 @@ func (s *GodotServer) handleRequestMessage(msg map[string]interface{}) {
 		RequestText: text,
 		Timestamp:   eventsourcing.ISOTimestamp(),
 	}
+	event.Metadata().UserID = userID
 
 	if s.eventBus != nil {
 		s.eventBus.Publish(event)
 	} else {
-		logging.Error("EventBus not set")
+		logger.Error("EventBus not set")
 	}
 }
 
+// handleDeltaMessage handles position updates sent by clients predating the object messages
 func (s *GodotServer) handleDeltaMessage(msg map[string]interface{}) {
-	logging.Debug("Handling delta from Godot: %v", msg)
+	logger.Debug("Handling delta from Godot: %v", msg)
 	actions, ok := msg["actions"].([]interface{})
 	if !ok {
-		logging.Error("Delta message missing actions")
+		logger.Error("Delta message missing actions")
 		return
 	}
 
@@ -254,22 +535,9 @@ func (s *GodotServer) handleDeltaMessage(msg map[string]interface{}) {
 		}
 		if action["type"] == "update" {
 			if props, ok := action["properties"].(map[string]interface{}); ok {
-				if pos, ok := props["position"].([]interface{}); ok && len(pos) >= 3 {
-					x, _ := pos[0].(float64)
-					y, _ := pos[1].(float64)
-					z, _ := pos[2].(float64)
-					if nodeID, ok := action["node_id"].(string); ok && strings.HasPrefix(nodeID, "task_") {
-						event := &TaskPositionUpdatedEvent{
-							TaskID:    nodeID,
-							PositionX: x,
-							PositionY: y,
-							PositionZ: z,
-						}
-						if s.eventBus != nil {
-							s.eventBus.Publish(event)
-						} else {
-							logging.Error("EventBus not set")
-						}
+				if position := parsePosition(props["position"]); position != nil {
+					if nodeID, ok := action["node_id"].(string); ok {
+						s.publishNodePosition(nodeID, position)
 					}
 				}
 			}
@@ -277,11 +545,62 @@ func (s *GodotServer) handleDeltaMessage(msg map[string]interface{}) {
 	}
 }
 
+// handleObjectMessage passes a click, move or delete of a 3D object on to the plugin owning it
+func (s *GodotServer) handleObjectMessage(userID, kind string, msg map[string]interface{}) {
+	logger.Debug("Handling %s from Godot: %v", kind, msg)
+	nodeID, _ := msg["node_id"].(string)
+	if nodeID == "" {
+		logger.Error("%s message missing 'node_id' field", kind)
+		return
+	}
+	interaction := eventsourcing.Interaction{
+		Kind:     kind,
+		NodeID:   strings.TrimSuffix(nodeID, "_label"),
+		Position: parsePosition(msg["position"]),
+		From:     parsePosition(msg["from"]),
+		UserID:   userID,
+	}
+	if kind == eventsourcing.ObjectMoved {
+		if interaction.Position == nil {
+			logger.Error("%s message missing 'position' field", kind)
+			return
+		}
+		s.publishNodePosition(interaction.NodeID, interaction.Position)
+	}
+	if s.interact != nil {
+		s.interact(interaction)
+	} else {
+		logger.Info("Interactions not enabled, ignoring %s", kind)
+	}
+}
+
+// publishNodePosition records where the user placed a node, so it stays there after a restart
+func (s *GodotServer) publishNodePosition(nodeID string, position []float64) {
+	if s.eventBus != nil {
+		s.eventBus.Publish(layout.NewNodeMovedEvent(nodeID, position))
+	} else {
+		logger.Error("EventBus not set")
+	}
+}
+
+// parsePosition returns the x, y and z of a JSON position, nil if it has fewer coordinates
+func parsePosition(value interface{}) []float64 {
+	coordinates, ok := value.([]interface{})
+	if !ok || len(coordinates) < 3 {
+		return nil
+	}
+	position := make([]float64, 3)
+	for i := range position {
+		position[i], _ = coordinates[i].(float64)
+	}
+	return position
+}
+
 func (s *GodotServer) handleKeypressAck(msg map[string]interface{}) {
-	logging.Debug("Handling keypress ACK from Godot: %v", msg)
+	logger.Debug("Handling keypress ACK from Godot: %v", msg)
 	correlationID, ok := msg["correlation_id"].(string)
 	if !ok || correlationID == "" {
-		logging.Error("Keypress ACK missing correlation_id")
+		logger.Error("Keypress ACK missing correlation_id")
 		return
 	}
 
@@ -290,16 +609,16 @@ func (s *GodotServer) handleKeypressAck(msg map[string]interface{}) {
 	s.pendingMu.RUnlock()
 
 	if !exists {
-		logging.Info("Received ACK for unknown correlation_id: %s", correlationID)
+		logger.Info("Received ACK for unknown correlation_id: %s", correlationID)
 		return
 	}
 
 	// Send the result back through the channel
 	select {
 	case ch <- msg:
-		logging.Debug("Sent keypress ACK result for correlation_id: %s", correlationID)
+		logger.Debug("Sent keypress ACK result for correlation_id: %s", correlationID)
 	default:
-		logging.Info("Channel full for correlation_id: %s", correlationID)
+		logger.Info("Channel full for correlation_id: %s", correlationID)
 	}
 
 	// Clean up the pending request
@@ -309,102 +628,282 @@ func (s *GodotServer) handleKeypressAck(msg map[string]interface{}) {
 }
 
 func (s *GodotServer) handleReadyMessage(conn *websocket.Conn, msg map[string]interface{}) {
-	logging.Info("Received ready signal from Godot client")
+	logger.Info("Received ready signal from Godot client")
 
+	frames, audioRate := negotiateAudio(msg)
+	capabilities := negotiateCapabilities(msg)
 	s.clientsMu.Lock()
-	if client, exists := s.clients[conn]; exists {
+	client, exists := s.clients[conn]
+	if exists {
 		client.ready = true
 		client.lastReady = time.Now()
+		client.binary = frames
+		client.audioRate = audioRate
+		client.xr = hasCapability(capabilities, CapabilityXR)
 	}
 	s.clientsMu.Unlock()
+	if !exists {
+		return
+	}
+	if frames {
+		logger.Info("Godot client exchanges audio in binary frames, its microphone at %d Hz", audioRate)
+		client.queueJSON(map[string]interface{}{"type": "audio_format", "binary": true, "sample_rate": audioRate})
+	}
+	if _, declared := msg["capabilities"]; declared {
+		logger.Info("Godot client declared capabilities %v, accepted %v", msg["capabilities"], capabilities)
+		client.queueJSON(map[string]interface{}{"type": "capabilities", "capabilities": capabilities})
+	}
 
 	// Send full state immediately now that client is ready
-	go s.sendFullState(conn)
+	go s.sendFullState(client)
 }
 
-func (s *GodotServer) sendFullState(conn *websocket.Conn) {
+func (s *GodotServer) sendFullState(client *ClientState) {
 	if s.aggStore == nil {
-		logging.Error("AggStore is nil, cannot send full state")
+		logger.Error("AggStore is nil, cannot send full state")
 		return
 	}
 
-	logging.Info("Sending full 3D state to Godot client")
+	logger.Info("Sending full 3D state to Godot client")
+	// The palette first, the objects are created in its colors
+	s.themeMu.RLock()
+	theme := s.theme
+	s.themeMu.RUnlock()
+	if theme != nil && !client.queueJSON(theme) {
+		return
+	}
+	userID := client.userID
+	aggs := s.aggStore.AllAggregates()
+	if users, ok := s.aggStore.(eventsourcing.UserAggregateStore); ok {
+		aggs = users.AggregatesOf(userID)
+	}
+	_, maxPayload := s.transport()
+	var envs []eventsourcing.DeltaEnvelope
 	totalActions := 0
-	for _, agg := range s.aggStore.AllAggregates() {
+	for _, agg := range aggs {
 		if broadcaster, ok := agg.(eventsourcing.ThreeDUIBroadcaster); ok {
-			actions := broadcaster.GetFull3DState()
-			logging.Info("Aggregate %s implements ThreeDUIBroadcaster, sending %d actions", agg.ID(), len(actions))
+			// Read before the state, so deltas of events applied meanwhile are not skipped by the client
+			sequence := eventsourcing.AppliedSequence(agg)
+			actions := s.overrideLayout(broadcaster.GetFull3DState())
+			logger.Info("Aggregate %s implements ThreeDUIBroadcaster, sending %d actions", agg.ID(), len(actions))
 			totalActions += len(actions)
 			if len(actions) > 0 {
-				env := eventsourcing.DeltaEnvelope{
+				envs = append(envs, splitEnvelope(eventsourcing.DeltaEnvelope{
 					Type:      "delta",
 					Aggregate: agg.ID(),
 					EventID:   "full_state",
+					Sequence:  sequence,
 					Timestamp: eventsourcing.ISOTimestamp(),
+					UserID:    userID,
 					Actions:   actions,
-				}
-				logging.Info("Sending JSON to Godot")
-				err := conn.WriteJSON(env)
-				if err != nil {
-					logging.Error("Error sending full state to Godot: %v", err)
-					return
-				}
+				}, maxPayload)...)
 			} else {
-				logging.Info("Aggregate %s has no actions to send", agg.ID())
+				logger.Info("Aggregate %s has no actions to send", agg.ID())
 			}
 		} else {
-			logging.Info("Aggregate %s does not implement ThreeDUIBroadcaster", agg.ID())
+			logger.Info("Aggregate %s does not implement ThreeDUIBroadcaster", agg.ID())
+		}
+	}
+	if !client.xr {
+		envs = withoutXR(envs)
+	}
+	messages, err := deltaMessages(envs, maxPayload)
+	if err != nil {
+		logger.Error("Error encoding the full state: %v", err)
+		return
+	}
+	logger.Info("Sending the full state to Godot in %d messages", len(messages))
+	for _, message := range messages {
+		if !client.queue(websocket.TextMessage, message) {
+			return
 		}
 	}
-	logging.Info("Total actions sent to Godot: %d", totalActions)
+	logger.Info("Total actions sent to Godot: %d", totalActions)
 }
 
-func (s *GodotServer) broadcast(env eventsourcing.DeltaEnvelope) {
+// overrideLayout moves the objects of the actions to where the user placed them
+func (s *GodotServer) overrideLayout(actions []eventsourcing.DeltaAction) []eventsourcing.DeltaAction {
+	if s.aggStore == nil {
+		return actions
+	}
+	for _, agg := range s.aggStore.AllAggregates() {
+		if overrider, ok := agg.(eventsourcing.LayoutOverrider); ok {
+			actions = overrider.OverrideLayout(actions)
+		}
+	}
+	return actions
+}
+
+// broadcast sends the deltas to the clients of the users they belong to, those of a user in as few
+// messages as the maximum payload allows. Clients not rendering in XR get them without the XR hints.
+func (s *GodotServer) broadcast(envs ...eventsourcing.DeltaEnvelope) {
+	_, maxPayload := s.transport()
+	byUser := make(map[string][]eventsourcing.DeltaEnvelope)
+	for _, env := range envs {
+		logger.Trace("Broadcasting delta envelope: type=%s, aggregate=%s, actions=%d", env.Type, env.Aggregate, len(env.Actions))
+		byUser[env.UserID] = append(byUser[env.UserID], env)
+	}
 	s.clientsMu.RLock()
 	defer s.clientsMu.RUnlock()
-	logging.Trace("Broadcasting delta envelope: type=%s, aggregate=%s, actions=%d", env.Type, env.Aggregate, len(env.Actions))
-	for conn := range s.clients {
-		err := conn.WriteJSON(env)
+	for userID, envs := range byUser {
+		encoded := make(map[bool][][]byte)
+		for _, client := range s.clients {
+			if client.userID != userID {
+				continue
+			}
+			messages, ok := encoded[client.xr]
+			if !ok {
+				forClient := envs
+				if !client.xr {
+					forClient = withoutXR(envs)
+				}
+				var err error
+				if messages, err = deltaMessages(forClient, maxPayload); err != nil {
+					logger.Error("Error encoding deltas: %v", err)
+				}
+				encoded[client.xr] = messages
+			}
+			for _, message := range messages {
+				if !client.queue(websocket.TextMessage, message) {
+					break
+				}
+			}
+		}
+	}
+}
+
+// deltaMessages encodes the envelopes as messages of at most the maximum payload: an envelope on its
+// own, or a batch of them. An envelope larger than the maximum is a message of its own.
+func deltaMessages(envs []eventsourcing.DeltaEnvelope, maxPayload int) ([][]byte, error) {
+	var messages [][]byte
+	var batch []json.RawMessage
+	size := 0
+	flush := func() error {
+		switch len(batch) {
+		case 0:
+			return nil
+		case 1:
+			messages = append(messages, batch[0])
+		default:
+			message, err := json.Marshal(DeltaBatch{Type: "deltas", Deltas: batch})
+			if err != nil {
+				return err
+			}
+			messages = append(messages, message)
+		}
+		batch, size = nil, 0
+		return nil
+	}
+	for _, env := range envs {
+		encoded, err := json.Marshal(env)
+		if err != nil {
+			return nil, err
+		}
+		if maxPayload > 0 && size > 0 && size+len(encoded) > maxPayload {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		batch = append(batch, encoded)
+		size += len(encoded) + 1
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// splitEnvelope splits the actions of an envelope over envelopes of at most the maximum payload. Only
+// full states are split: the client skips deltas with a sequence it has seen, so later parts of a split
+// event would be lost.
+func splitEnvelope(env eventsourcing.DeltaEnvelope, maxPayload int) []eventsourcing.DeltaEnvelope {
+	if maxPayload <= 0 || len(env.Actions) < 2 {
+		return []eventsourcing.DeltaEnvelope{env}
+	}
+	empty := env
+	empty.Actions = nil
+	overhead, err := json.Marshal(empty)
+	if err != nil {
+		return []eventsourcing.DeltaEnvelope{env}
+	}
+	var parts []eventsourcing.DeltaEnvelope
+	part := empty
+	size := len(overhead)
+	for _, action := range env.Actions {
+		encoded, err := json.Marshal(action)
 		if err != nil {
-			logging.Error("Error broadcasting to Godot client: %v", err)
-			// Optionally remove the client if error
+			return []eventsourcing.DeltaEnvelope{env}
 		}
+		if len(part.Actions) > 0 && size+len(encoded) > maxPayload {
+			parts = append(parts, part)
+			part = empty
+			size = len(overhead)
+		}
+		part.Actions = append(part.Actions, action)
+		size += len(encoded) + 1
 	}
+	return append(parts, part)
 }
 
 func (s *GodotServer) broadcastJSON(msg interface{}) {
+	logger.Trace("Broadcasting JSON message: %v", msg)
+	s.sendJSON(msg, func(*ClientState) bool { return true })
+}
+
+// sendJSONTo sends a message to the clients of a user
+func (s *GodotServer) sendJSONTo(userID string, msg interface{}) {
+	s.sendJSON(msg, func(client *ClientState) bool { return client.userID == userID })
+}
+
+// sendJSON queues a message for the clients it is for
+func (s *GodotServer) sendJSON(msg interface{}, isFor func(*ClientState) bool) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logger.Error("Error encoding JSON for Godot: %v", err)
+		return
+	}
 	s.clientsMu.RLock()
 	defer s.clientsMu.RUnlock()
-	logging.Trace("Broadcasting JSON message: %v", msg)
-	for conn := range s.clients {
-		err := conn.WriteJSON(msg)
-		if err != nil {
-			logging.Error("Error broadcasting JSON to Godot client: %v", err)
+	for _, client := range s.clients {
+		if isFor(client) {
+			client.queue(websocket.TextMessage, data)
 		}
 	}
 }
 
 func (s *GodotServer) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := s.upgrader.Upgrade(w, r, nil)
+	userID := ""
+	if s.users != nil {
+		var ok bool
+		if userID, ok = s.users.AuthenticateRequest(r); !ok {
+			logger.Info("Refused a Godot client without a valid token")
+			http.Error(w, "a valid token is required", http.StatusUnauthorized)
+			return
+		}
+	}
+	s.transportMu.RLock()
+	upgrader := s.upgrader
+	upgrader.EnableCompression = s.compression
+	s.transportMu.RUnlock()
+	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		logging.Error("WebSocket upgrade error: %v", err)
+		logger.Error("WebSocket upgrade error: %v", err)
 		return
 	}
+	conn.EnableWriteCompression(upgrader.EnableCompression)
+	client := newClient(conn, userID)
 	s.clientsMu.Lock()
-	s.clients[conn] = &ClientState{
-		conn:  conn,
-		ready: false,
-	}
+	s.clients[conn] = client
 	s.clientsMu.Unlock()
-	logging.Info("Godot client connected")
+	logger.Info("Godot client connected")
 
-	const pongWait = 60 * time.Second
+	// The client is pinged, a client that stops answering is disconnected
 	conn.SetReadDeadline(time.Now().Add(pongWait))
 	conn.SetPongHandler(func(string) error { conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
 	// Start listening for messages
 	go func() {
-		defer conn.Close()
+		defer client.close(websocket.CloseNormalClosure, "")
 		defer func() {
 			s.clientsMu.Lock()
 			delete(s.clients, conn)
@@ -413,17 +912,18 @@ func (s *GodotServer) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		for {
 			messageType, message, err := conn.ReadMessage()
 			if err != nil {
-				logging.Error("Error reading from Godot: %v", err)
+				logger.Error("Error reading from Godot: %v", err)
 				return
 			}
+			conn.SetReadDeadline(time.Now().Add(pongWait))
 
 			if messageType == websocket.TextMessage {
-				logging.Trace("Received text from Godot: %s", string(message))
+				logger.Trace("Received text from Godot: %s", string(message))
 				s.handleTextMessage(conn, message)
 			} else if messageType == websocket.BinaryMessage {
-				s.handleBinaryMessage(message)
+				s.handleBinaryMessage(conn, message)
 			} else {
-				logging.Info("Received unknown message type from Godot: %d", messageType)
+				logger.Info("Received unknown message type from Godot: %d", messageType)
 			}
 		}
 	}()
@@ -458,7 +958,7 @@ func (s *GodotServer) HandleKeypresses(w http.ResponseWriter, r *http.Request) {
 		req.CorrelationID = fmt.Sprintf("keypress_%d", time.Now().UnixNano())
 	}
 
-	logging.Info("Received keypress request: keys='%s', correlation_id='%s'", req.Keys, req.CorrelationID)
+	logger.Info("Received keypress request: keys='%s', correlation_id='%s'", req.Keys, req.CorrelationID)
 
 	// Create a channel to wait for ACK
 	ch := make(chan map[string]interface{}, 1)
@@ -493,19 +993,73 @@ func (s *GodotServer) HandleKeypresses(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// sendDeltas broadcasts the deltas until the channel is closed, batching those arriving within the batch
+// window of the first, as many do while events are replayed or a command changes many objects
+func (s *GodotServer) sendDeltas() {
+	for env := range s.deltaChan {
+		env.Actions = s.overrideLayout(env.Actions)
+		batch := []eventsourcing.DeltaEnvelope{env}
+		if window, _ := s.transport(); window > 0 {
+			timer := time.NewTimer(window)
+		collect:
+			for {
+				select {
+				case env, ok := <-s.deltaChan:
+					if !ok {
+						break collect
+					}
+					env.Actions = s.overrideLayout(env.Actions)
+					batch = append(batch, env)
+				case <-timer.C:
+					break collect
+				}
+			}
+			timer.Stop()
+		}
+		s.broadcast(batch...)
+	}
+}
+
 func (s *GodotServer) Start() {
 	// Start broadcasting deltas
-	go func() {
-		for env := range s.deltaChan {
-			s.broadcast(env)
-		}
-	}()
+	go s.sendDeltas()
 
 	http.HandleFunc("/godot", s.HandleWebSocket)
 	http.HandleFunc("/keypresses", s.HandleKeypresses)
-	logging.Info("Starting WebSocket server on :8081")
-	err := http.ListenAndServe(":8081", nil)
-	if err != nil {
-		logging.Error("Server error: %v", err)
+	logger.Info("Starting WebSocket server on :8081")
+	err := s.httpServer.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		logger.Error("Server error: %v", err)
+	}
+}
+
+// Shutdown tells the 3D clients MindPalace stops so they quit instead of reconnecting, closes their
+// connections and stops the server
+func (s *GodotServer) Shutdown(ctx context.Context) error {
+	s.clientsMu.Lock()
+	deadline := time.Now().Add(time.Second)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	clients := make([]*ClientState, 0, len(s.clients))
+	for conn, client := range s.clients {
+		client.queueJSON(map[string]interface{}{"type": "shutdown"})
+		client.close(websocket.CloseGoingAway, "shutting down")
+		clients = append(clients, client)
+		delete(s.clients, conn)
+	}
+	s.clientsMu.Unlock()
+	// The writers write the shutdown message, clients that don't take it in time are cut off
+	wait, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	for _, client := range clients {
+		select {
+		case <-client.done:
+		case <-wait.Done():
+			logger.Error("Godot client didn't take the shutdown message in time")
+			client.conn.Close()
+		}
 	}
+	logger.Info("Stopping WebSocket server")
+	return s.httpServer.Shutdown(ctx)
 }
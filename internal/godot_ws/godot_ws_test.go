@@ -1,16 +1,23 @@
 package godot_ws
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"fyne.io/fyne/v2"
 	"github.com/gorilla/websocket"
+	"mindpalace/internal/auth"
+	"mindpalace/internal/layout"
+	"mindpalace/internal/orchestration"
+	"mindpalace/internal/tts"
 	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/ui3d"
 )
 
 // MockAggregateStore for testing
@@ -136,6 +143,69 @@ func TestGodotServer_handleTextMessage_AudioChunk(t *testing.T) {
 	}
 }
 
+func TestGodotServer_handleTextMessage_Confirm(t *testing.T) {
+	server := NewGodotServer()
+	var gotID string
+	var gotApproved bool
+	server.SetConfirmCallback(func(userID, toolCallID string, approved bool) {
+		gotID, gotApproved = toolCallID, approved
+	})
+
+	data, _ := json.Marshal(map[string]interface{}{"type": "confirm", "tool_call_id": "req1-toolrequest-0", "approved": true})
+	server.handleTextMessage(nil, data)
+
+	if gotID != "req1-toolrequest-0" || !gotApproved {
+		t.Errorf("Expected approval of req1-toolrequest-0, got %q approved=%v", gotID, gotApproved)
+	}
+}
+
+// recordingEventBus keeps the events published to it
+type recordingEventBus struct {
+	published []eventsourcing.Event
+}
+
+func (b *recordingEventBus) Publish(event eventsourcing.Event) {
+	b.published = append(b.published, event)
+}
+func (b *recordingEventBus) Subscribe(string, eventsourcing.EventHandler) {}
+func (b *recordingEventBus) SubscribeAll(eventsourcing.EventHandler)      {}
+
+func TestGodotServer_handleTextMessage_ObjectInteractions(t *testing.T) {
+	server := NewGodotServer()
+	bus := &recordingEventBus{}
+	server.SetEventBus(bus)
+	var got []eventsourcing.Interaction
+	server.SetInteractionCallback(func(interaction eventsourcing.Interaction) {
+		got = append(got, interaction)
+	})
+
+	for _, msg := range []map[string]interface{}{
+		{"type": "object_clicked", "node_id": "task_1_label"},
+		{"type": "object_moved", "node_id": "task_1", "position": []float64{1, 2, 3}, "from": []float64{0, 2, 3}},
+		{"type": "object_moved", "node_id": "calendar_event_event_1"}, // Missing position
+		{"type": "object_deleted", "node_id": "calendar_event_event_1"},
+	} {
+		data, _ := json.Marshal(msg)
+		server.handleTextMessage(nil, data)
+	}
+
+	want := []eventsourcing.Interaction{
+		{Kind: eventsourcing.ObjectClicked, NodeID: "task_1"},
+		{Kind: eventsourcing.ObjectMoved, NodeID: "task_1", Position: []float64{1, 2, 3}, From: []float64{0, 2, 3}},
+		{Kind: eventsourcing.ObjectDeleted, NodeID: "calendar_event_event_1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected interactions %v, got %v", want, got)
+	}
+	if len(bus.published) != 1 {
+		t.Fatalf("Expected the task position to be published, got %d events", len(bus.published))
+	}
+	moved, ok := bus.published[0].(*layout.NodeMovedEvent)
+	if !ok || moved.NodeID != "task_1" || !reflect.DeepEqual(moved.Position, []float64{1, 2, 3}) {
+		t.Errorf("Unexpected position event: %+v", bus.published[0])
+	}
+}
+
 func TestGodotServer_handleTextMessage_UnknownType(t *testing.T) {
 	server := NewGodotServer()
 
@@ -155,7 +225,7 @@ func TestGodotServer_handleBinaryMessage(t *testing.T) {
 		called = true
 	})
 
-	server.handleBinaryMessage([]byte("test"))
+	server.handleBinaryMessage(nil, []byte("test"))
 
 	if !called {
 		t.Error("Audio callback not called for binary message")
@@ -173,10 +243,7 @@ func TestGodotServer_broadcast(t *testing.T) {
 			t.Fatalf("Upgrade failed: %v", err)
 		}
 		server.clientsMu.Lock()
-		server.clients[conn] = &ClientState{
-			conn:  conn,
-			ready: true,
-		}
+		server.clients[conn] = newClient(conn, "")
 		server.clientsMu.Unlock()
 
 		// Wait a bit for broadcast
@@ -213,6 +280,109 @@ func TestGodotServer_broadcast(t *testing.T) {
 	}
 }
 
+func TestGodotServer_sendDeltas_Batches(t *testing.T) {
+	server := NewGodotServer()
+	deltas := make(chan eventsourcing.DeltaEnvelope, 10)
+	server.SetDeltaChan(deltas)
+	server.Configure(50*time.Millisecond, false, 0)
+
+	upgrader := websocket.Upgrader{}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Upgrade failed: %v", err)
+			return
+		}
+		server.clientsMu.Lock()
+		server.clients[conn] = newClient(conn, "")
+		server.clientsMu.Unlock()
+	}))
+	defer httpServer.Close()
+
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	// Deltas of another user are not sent to the owner's client
+	for i, userID := range []string{"", "alice", "", ""} {
+		deltas <- eventsourcing.DeltaEnvelope{Type: "delta", Aggregate: "test", Sequence: int64(i + 1), UserID: userID,
+			Actions: []eventsourcing.DeltaAction{{Type: "create", NodeID: "node"}}}
+	}
+	go server.sendDeltas()
+	defer close(deltas)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var batch struct {
+		Type   string                        `json:"type"`
+		Deltas []eventsourcing.DeltaEnvelope `json:"deltas"`
+	}
+	if err := conn.ReadJSON(&batch); err != nil {
+		t.Fatalf("ReadJSON failed: %v", err)
+	}
+	if batch.Type != "deltas" || len(batch.Deltas) != 3 {
+		t.Fatalf("Expected the owner's three deltas in one message, got %+v", batch)
+	}
+	for i, sequence := range []int64{1, 3, 4} {
+		if batch.Deltas[i].Sequence != sequence {
+			t.Errorf("Expected the deltas in the order of their events, got %+v", batch.Deltas)
+		}
+	}
+}
+
+func TestDeltaMessages(t *testing.T) {
+	envs := []eventsourcing.DeltaEnvelope{
+		{Type: "delta", Aggregate: "a", Actions: []eventsourcing.DeltaAction{{Type: "create", NodeID: "one"}}},
+		{Type: "delta", Aggregate: "b", Actions: []eventsourcing.DeltaAction{{Type: "create", NodeID: "two"}}},
+		{Type: "delta", Aggregate: "c", Actions: []eventsourcing.DeltaAction{{Type: "create", NodeID: "three"}}},
+	}
+	messages, err := deltaMessages(envs, 0)
+	if err != nil || len(messages) != 1 || !strings.Contains(string(messages[0]), `"type":"deltas"`) {
+		t.Fatalf("Expected one batch without a maximum payload, got %d messages, %v", len(messages), err)
+	}
+
+	single, _ := json.Marshal(envs[0])
+	messages, _ = deltaMessages(envs, 2*len(single)+1)
+	if len(messages) != 2 {
+		t.Fatalf("Expected the batch split at the maximum payload, got %d messages", len(messages))
+	}
+	var last eventsourcing.DeltaEnvelope
+	if err := json.Unmarshal(messages[1], &last); err != nil || last.Aggregate != "c" {
+		t.Errorf("Expected the last delta sent on its own, got %s", messages[1])
+	}
+}
+
+func TestSplitEnvelope(t *testing.T) {
+	env := eventsourcing.DeltaEnvelope{Type: "delta", Aggregate: "test", EventID: "full_state", Sequence: 7}
+	for i := 0; i < 10; i++ {
+		env.Actions = append(env.Actions, eventsourcing.DeltaAction{Type: "create", NodeID: "node", Properties: map[string]interface{}{"text": strings.Repeat("x", 100)}})
+	}
+	if parts := splitEnvelope(env, 0); len(parts) != 1 {
+		t.Errorf("Expected the state left whole without a maximum payload, got %d parts", len(parts))
+	}
+
+	parts := splitEnvelope(env, 500)
+	if len(parts) < 3 {
+		t.Fatalf("Expected the state split in several parts, got %d", len(parts))
+	}
+	actions := 0
+	for _, part := range parts {
+		if part.EventID != "full_state" || part.Sequence != 7 || part.Aggregate != "test" {
+			t.Errorf("Expected every part to be part of the full state, got %+v", part)
+		}
+		if encoded, _ := json.Marshal(part); len(encoded) > 500 {
+			t.Errorf("Expected parts of at most 500 bytes, got %d", len(encoded))
+		}
+		actions += len(part.Actions)
+	}
+	if actions != 10 {
+		t.Errorf("Expected all actions sent, got %d", actions)
+	}
+}
+
 func TestGodotServer_HandleWebSocket_FullState(t *testing.T) {
 	server := NewGodotServer()
 	mockBroadcaster := &mockThreeDUIBroadcaster{
@@ -257,6 +427,113 @@ func TestGodotServer_HandleWebSocket_FullState(t *testing.T) {
 	}
 }
 
+func TestGodotServer_SendTheme(t *testing.T) {
+	server := NewGodotServer()
+	server.SetAggStore(&mockAggregateStore{})
+	server.SendTheme(ui3d.ThemeLight, ui3d.LightTheme())
+
+	httpServer := httptest.NewServer(http.HandlerFunc(server.HandleWebSocket))
+	defer httpServer.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.WriteJSON(map[string]interface{}{"type": "ready"})
+
+	// Clients connecting after the palette was picked get it before the objects
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var received struct {
+		Type    string     `json:"type"`
+		Name    string     `json:"name"`
+		Dark    bool       `json:"dark"`
+		Palette ui3d.Theme `json:"palette"`
+	}
+	if err := conn.ReadJSON(&received); err != nil {
+		t.Fatalf("ReadJSON failed: %v", err)
+	}
+	if received.Type != "theme" || received.Name != ui3d.ThemeLight || received.Dark || received.Palette.Background[0] != 0.9 {
+		t.Errorf("Expected the light palette, got %+v", received)
+	}
+}
+
+func TestGodotServer_Shutdown_NotifiesClients(t *testing.T) {
+	server := NewGodotServer()
+	httpServer := httptest.NewServer(http.HandlerFunc(server.HandleWebSocket))
+	defer httpServer.Close()
+
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		server.clientsMu.RLock()
+		connected := len(server.clients)
+		server.clientsMu.RUnlock()
+		if connected == 1 {
+			break
+		}
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var msg map[string]interface{}
+	if err := conn.ReadJSON(&msg); err != nil || msg["type"] != "shutdown" {
+		t.Errorf("Expected a shutdown message, got %v, %v", msg, err)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Expected the connection to be closed, got %v", err)
+	}
+}
+
+func TestGodotServer_Users(t *testing.T) {
+	server := NewGodotServer()
+	server.SetUsers(auth.NewUsers(map[string]string{"alice-token": "alice"}))
+	server.SetRequestUser(func(requestID string) string {
+		if requestID == "alice-req" {
+			return "alice"
+		}
+		return ""
+	})
+	httpServer := httptest.NewServer(http.HandlerFunc(server.HandleWebSocket))
+	defer httpServer.Close()
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected a client without a token to be refused, got %v", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?token=alice-token", nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		server.clientsMu.RLock()
+		connected := len(server.clients)
+		server.clientsMu.RUnlock()
+		if connected == 1 {
+			break
+		}
+	}
+
+	// The owner's answer is not shown to alice, alice's own answer is
+	server.SendLLMStream("owner-req", "For the owner", false)
+	server.SendLLMStream("alice-req", "For alice", false)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var received eventsourcing.DeltaEnvelope
+	if err := conn.ReadJSON(&received); err != nil {
+		t.Fatalf("ReadJSON failed: %v", err)
+	}
+	if text := received.Actions[0].Properties["text"]; text != "For alice" || received.UserID != "alice" {
+		t.Errorf("Expected only alice's answer, got %v for %q", text, received.UserID)
+	}
+}
+
 func TestGodotServer_HandleKeypresses_InvalidMethod(t *testing.T) {
 	server := NewGodotServer()
 
@@ -371,3 +648,457 @@ func TestGodotServer_handleKeypressAck(t *testing.T) {
 		t.Error("Pending request not cleaned up")
 	}
 }
+
+func TestGodotServer_HandleStreamingEvent(t *testing.T) {
+	server := NewGodotServer()
+
+	httpServer := httptest.NewServer(http.HandlerFunc(server.HandleWebSocket))
+	defer httpServer.Close()
+
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// Wait for the server to register the client
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		server.clientsMu.RLock()
+		n := len(server.clients)
+		server.clientsMu.RUnlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	server.HandleStreamingEvent(&eventsourcing.LLMProcessingStartedEvent{RequestID: "req1"})
+	server.HandleStreamingEvent(&eventsourcing.LLMStreamChunkEvent{RequestID: "req1", PartialContent: "Hello wor"})
+
+	conn.SetReadDeadline(time.Now().Add(1 * time.Second))
+	var received eventsourcing.DeltaEnvelope
+	if err := conn.ReadJSON(&received); err != nil {
+		t.Fatalf("ReadJSON failed: %v", err)
+	}
+	if received.Type != "delta" || received.Aggregate != "llm_stream" {
+		t.Errorf("Expected llm_stream delta, got type=%s aggregate=%s", received.Type, received.Aggregate)
+	}
+	if len(received.Actions) != 1 || received.Actions[0].NodeID != "llm_stream_display" {
+		t.Fatalf("Unexpected actions: %+v", received.Actions)
+	}
+	if text := received.Actions[0].Properties["text"]; text != "Hello wor" {
+		t.Errorf("Expected partial text 'Hello wor', got %v", text)
+	}
+}
+
+func TestGodotServer_handleTextMessage_SpeechMute(t *testing.T) {
+	server := NewGodotServer()
+	var muted []bool
+	server.SetSpeechMuteCallback(func(m bool) { muted = append(muted, m) })
+
+	server.handleTextMessage(nil, []byte(`{"type": "tts_mute", "muted": true}`))
+	server.handleTextMessage(nil, []byte(`{"type": "tts_mute"}`))
+	server.handleTextMessage(nil, []byte(`{"type": "tts_mute", "muted": false}`))
+
+	if len(muted) != 2 || !muted[0] || muted[1] {
+		t.Errorf("Expected mute then unmute, got %v", muted)
+	}
+}
+
+func TestGodotServer_handleTextMessage_AudioSettings(t *testing.T) {
+	server := NewGodotServer()
+	var settings []map[string]interface{}
+	server.SetAudioSettingsCallback(func(s map[string]interface{}) { settings = append(settings, s) })
+
+	server.handleTextMessage(nil, []byte(`{"type": "audio_settings", "device": "pulse:usb-mic", "noise_suppression": true, "timestamp": 1}`))
+	server.handleTextMessage(nil, []byte(`{"type": "audio_settings"}`))
+	server.handleAudioSettings("alice", map[string]interface{}{"device": "pulse:default"})
+
+	if len(settings) != 2 {
+		t.Fatalf("Expected the owner's two messages passed on, got %v", settings)
+	}
+	if len(settings[0]) != 2 || settings[0]["device"] != "pulse:usb-mic" || settings[0]["noise_suppression"] != true {
+		t.Errorf("Expected the device and noise suppression, got %v", settings[0])
+	}
+	if len(settings[1]) != 0 {
+		t.Errorf("Expected no settings when asking for the devices, got %v", settings[1])
+	}
+}
+
+func TestGodotServer_SendSpeechFrame(t *testing.T) {
+	server := NewGodotServer()
+
+	httpServer := httptest.NewServer(http.HandlerFunc(server.HandleWebSocket))
+	defer httpServer.Close()
+
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// Wait for the server to register the client
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		server.clientsMu.RLock()
+		n := len(server.clients)
+		server.clientsMu.RUnlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	server.SendSpeechFrame(tts.Frame{RequestID: "req1", Seq: 3, SampleRate: 22050, Data: []byte("test audio")})
+
+	conn.SetReadDeadline(time.Now().Add(1 * time.Second))
+	var received map[string]interface{}
+	if err := conn.ReadJSON(&received); err != nil {
+		t.Fatalf("ReadJSON failed: %v", err)
+	}
+	if received["type"] != "tts_audio" || received["request_id"] != "req1" || received["seq"] != float64(3) || received["final"] != false {
+		t.Errorf("Unexpected speech frame: %v", received)
+	}
+	if received["sample_rate"] != float64(22050) || received["data"] != "dGVzdCBhdWRpbw==" {
+		t.Errorf("Expected base64 audio at 22050 Hz, got %v", received)
+	}
+}
+
+func TestNegotiateAudio(t *testing.T) {
+	for name, test := range map[string]struct {
+		ready  string
+		binary bool
+		rate   int
+	}{
+		"legacy":             {`{"type": "ready"}`, false, 16000},
+		"transcriber's rate": {`{"type": "ready", "audio": {"binary": true, "sample_rates": [48000, 16000]}}`, true, 16000},
+		"other rate":         {`{"type": "ready", "audio": {"binary": true, "sample_rates": [44100, 48000]}}`, true, 44100},
+		"no rates":           {`{"type": "ready", "audio": {"binary": true}}`, true, 16000},
+	} {
+		var msg map[string]interface{}
+		json.Unmarshal([]byte(test.ready), &msg)
+		if binary, rate := negotiateAudio(msg); binary != test.binary || rate != test.rate {
+			t.Errorf("%s: expected %v at %d Hz, got %v at %d Hz", name, test.binary, test.rate, binary, rate)
+		}
+	}
+}
+
+func TestNegotiateCapabilities(t *testing.T) {
+	for name, test := range map[string]struct {
+		ready    string
+		accepted []string
+	}{
+		"legacy":    {`{"type": "ready"}`, []string{}},
+		"xr":        {`{"type": "ready", "capabilities": ["xr", "xr"]}`, []string{"xr"}},
+		"unknown":   {`{"type": "ready", "capabilities": ["holograms", "xr"]}`, []string{"xr"}},
+		"malformed": {`{"type": "ready", "capabilities": "xr"}`, []string{}},
+	} {
+		var msg map[string]interface{}
+		json.Unmarshal([]byte(test.ready), &msg)
+		if accepted := negotiateCapabilities(msg); !reflect.DeepEqual(accepted, test.accepted) {
+			t.Errorf("%s: expected %v, got %v", name, test.accepted, accepted)
+		}
+	}
+}
+
+func TestGodotServer_XRHints(t *testing.T) {
+	server := NewGodotServer()
+	httpServer := httptest.NewServer(http.HandlerFunc(server.HandleWebSocket))
+	defer httpServer.Close()
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+
+	// A VR client and a desktop client of the same user
+	dial := func(capabilities []string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		conn.WriteJSON(map[string]interface{}{"type": "ready", "capabilities": capabilities})
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		var reply map[string]interface{}
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatalf("ReadJSON failed: %v", err)
+		}
+		if reply["type"] != "capabilities" || len(reply["capabilities"].([]interface{})) != len(capabilities) {
+			t.Fatalf("Expected %v accepted, got %v", capabilities, reply)
+		}
+		return conn
+	}
+	vr := dial([]string{CapabilityXR})
+	defer vr.Close()
+	desktop := dial([]string{})
+	defer desktop.Close()
+
+	hints := &eventsourcing.XRHints{InteractionVolume: []float64{1, 2, 1}, Grabbable: true}
+	env := eventsourcing.DeltaEnvelope{Type: "delta", Aggregate: "tasks", EventID: "e1", Actions: []eventsourcing.DeltaAction{
+		{Type: "create", NodeID: "task_1", Properties: map[string]interface{}{"mesh": "capsule"}, XR: hints},
+	}}
+	server.broadcast(env)
+
+	var received eventsourcing.DeltaEnvelope
+	if err := vr.ReadJSON(&received); err != nil {
+		t.Fatalf("ReadJSON failed: %v", err)
+	}
+	if !reflect.DeepEqual(received.Actions[0].XR, hints) {
+		t.Errorf("Expected the VR client to get the XR hints, got %+v", received.Actions[0].XR)
+	}
+	received = eventsourcing.DeltaEnvelope{}
+	if err := desktop.ReadJSON(&received); err != nil {
+		t.Fatalf("ReadJSON failed: %v", err)
+	}
+	if received.Actions[0].XR != nil || received.Actions[0].NodeID != "task_1" {
+		t.Errorf("Expected the desktop client to get the action without XR hints, got %+v", received.Actions[0])
+	}
+	if env.Actions[0].XR != hints {
+		t.Error("Expected the broadcast envelope left as it was")
+	}
+}
+
+func TestGodotServer_BinaryAudioFrames(t *testing.T) {
+	server := NewGodotServer()
+	received := make(chan []byte, 1)
+	server.SetAudioCallback(func(data []byte) { received <- data })
+
+	httpServer := httptest.NewServer(http.HandlerFunc(server.HandleWebSocket))
+	defer httpServer.Close()
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{"type": "ready", "audio": map[string]interface{}{"binary": true, "sample_rates": []int{32000}}})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var format map[string]interface{}
+	if err := conn.ReadJSON(&format); err != nil {
+		t.Fatalf("ReadJSON failed: %v", err)
+	}
+	if format["type"] != "audio_format" || format["binary"] != true || format["sample_rate"] != float64(32000) {
+		t.Fatalf("Expected the client's rate accepted, got %v", format)
+	}
+
+	// Microphone audio at 32 kHz reaches the transcriber at 16 kHz
+	pcm := []byte{OpMicAudio}
+	for _, sample := range []int16{100, 200, 300, 400} {
+		pcm = append(pcm, byte(sample), byte(sample>>8))
+	}
+	conn.WriteMessage(websocket.BinaryMessage, pcm)
+	select {
+	case audio := <-received:
+		if !reflect.DeepEqual(audio, []byte{100, 0, 44, 1}) {
+			t.Errorf("Expected every other sample, got %v", audio)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the audio passed to the callback")
+	}
+
+	server.SendSpeechFrame(tts.Frame{RequestID: "req1", Seq: 3, SampleRate: 22050, Data: []byte{1, 2}, Final: true})
+	messageType, frame, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+	want := []byte{OpSpeechAudio, 1, 3, 0, 0, 0, 0x22, 0x56, 0, 0, 4, 0, 'r', 'e', 'q', '1', 1, 2}
+	if messageType != websocket.BinaryMessage || !reflect.DeepEqual(frame, want) {
+		t.Errorf("Expected the speech as a binary frame, got %d: %v", messageType, frame)
+	}
+}
+
+func TestGodotServer_PingsClients(t *testing.T) {
+	defer func(period time.Duration) { pingPeriod = period }(pingPeriod)
+	pingPeriod = 20 * time.Millisecond
+	server := NewGodotServer()
+	httpServer := httptest.NewServer(http.HandlerFunc(server.HandleWebSocket))
+	defer httpServer.Close()
+
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	pinged := make(chan struct{}, 1)
+	conn.SetPingHandler(func(string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	go conn.ReadMessage()
+
+	select {
+	case <-pinged:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the client to be pinged")
+	}
+}
+
+func TestGodotServer_DisconnectsSlowClients(t *testing.T) {
+	server := NewGodotServer()
+	// A client whose writer is stalled: nothing is taken from its queue
+	slow := &ClientState{send: make(chan outgoing, sendBuffer), done: make(chan struct{})}
+	server.clients[nil] = slow
+
+	env := eventsourcing.DeltaEnvelope{Type: "delta", Aggregate: "test", Actions: []eventsourcing.DeltaAction{{Type: "create", NodeID: "node"}}}
+	finished := make(chan struct{})
+	go func() {
+		for i := 0; i <= sendBuffer; i++ {
+			server.broadcast(env)
+		}
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("Expected broadcasting not to wait for the slow client")
+	}
+	if !slow.closed || slow.closeCode != websocket.CloseTryAgainLater {
+		t.Errorf("Expected the slow client disconnected once its queue was full, got closed=%v code=%d", slow.closed, slow.closeCode)
+	}
+	if slow.queue(websocket.TextMessage, []byte("{}")) {
+		t.Error("Expected no messages queued for a disconnected client")
+	}
+}
+
+// worldClient connects a client of alice answering the queries of the world with the nodes, and
+// passing the deltas and camera directives it receives on
+func worldClient(t *testing.T, server *GodotServer, nodes []worldNode) (<-chan eventsourcing.DeltaEnvelope, <-chan eventsourcing.CameraEnvelope) {
+	t.Helper()
+	httpServer := httptest.NewServer(http.HandlerFunc(server.HandleWebSocket))
+	t.Cleanup(httpServer.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+"?token=alice-token", nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.WriteJSON(map[string]interface{}{"type": "ready"})
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		ready := false
+		server.clientsMu.RLock()
+		for _, client := range server.clients {
+			ready = client.ready
+		}
+		server.clientsMu.RUnlock()
+		if ready {
+			break
+		}
+	}
+
+	deltas := make(chan eventsourcing.DeltaEnvelope, 10)
+	cameras := make(chan eventsourcing.CameraEnvelope, 10)
+	go func() {
+		for {
+			var msg map[string]interface{}
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			switch msg["type"] {
+			case "world_query":
+				conn.WriteJSON(map[string]interface{}{"type": "world_nodes", "query_id": msg["query_id"], "nodes": nodes})
+			case "delta":
+				data, _ := json.Marshal(msg)
+				var env eventsourcing.DeltaEnvelope
+				json.Unmarshal(data, &env)
+				deltas <- env
+			case "camera":
+				data, _ := json.Marshal(msg)
+				var env eventsourcing.CameraEnvelope
+				json.Unmarshal(data, &env)
+				cameras <- env
+			}
+		}
+	}()
+	return deltas, cameras
+}
+
+func TestGodotServer_WorldTools(t *testing.T) {
+	server := NewGodotServer()
+	server.SetUsers(auth.NewUsers(map[string]string{"alice-token": "alice"}))
+	bus := &recordingEventBus{}
+	server.SetEventBus(bus)
+	ctx := auth.WithUser(context.Background(), "alice")
+
+	if _, err := server.CallTool(ctx, "find_nodes", nil); err == nil || !strings.Contains(err.Error(), "not open") {
+		t.Errorf("Expected the query to fail without a client, got %v", err)
+	}
+
+	deltas, cameras := worldClient(t, server, []worldNode{
+		{NodeID: "calendar_hub", Position: []float64{0, 0, -10}, WorldPosition: []float64{0, 0, -10}},
+		{NodeID: "calendar_event_1", Title: "Dentist", Position: []float64{2, 0, 0}, WorldPosition: []float64{2, 0, -10}},
+		{NodeID: "task_1", Title: "Pay rent", Details: map[string]interface{}{"status": "overdue"}, Position: []float64{1, 0, 1}, WorldPosition: []float64{5, 0, -10}},
+		{NodeID: "task_2", Title: "Water plants", Position: []float64{1, 0, 30}, WorldPosition: []float64{1, 0, 30}},
+		{NodeID: "broken", Position: []float64{1}}, // Dropped, it has no position
+	})
+
+	// Around the calendar hub, nearest first
+	result, err := server.CallTool(ctx, "find_nodes", map[string]interface{}{"near": "calendar hub"})
+	if err != nil {
+		t.Fatalf("find_nodes failed: %v", err)
+	}
+	var found struct {
+		Total int `json:"total"`
+		Nodes []struct {
+			NodeID   string  `json:"node_id"`
+			Distance float64 `json:"distance"`
+		} `json:"nodes"`
+	}
+	json.Unmarshal([]byte(result), &found)
+	if found.Total != 2 || found.Nodes[0].NodeID != "calendar_event_1" || found.Nodes[0].Distance != 2 || found.Nodes[1].NodeID != "task_1" {
+		t.Errorf("Expected the event and the task near the hub, got %s", result)
+	}
+	result, _ = server.CallTool(ctx, "find_nodes", map[string]interface{}{"type": "task_", "text": "OVERDUE"})
+	if json.Unmarshal([]byte(result), &found); found.Total != 1 || found.Nodes[0].NodeID != "task_1" {
+		t.Errorf("Expected the overdue task, got %s", result)
+	}
+	if _, err := server.CallTool(ctx, "find_nodes", map[string]interface{}{"near": "the moon"}); err == nil {
+		t.Error("Expected searching around a missing node to fail")
+	}
+
+	// Highlights and focus only change how alice's world looks
+	result, err = server.CallTool(ctx, "highlight_nodes", map[string]interface{}{"node_ids": []interface{}{"task_1", "task_9"}})
+	if err != nil || result != "Highlighted 1 nodes, not in the world: task_9" {
+		t.Errorf("Unexpected result of highlight_nodes: %q, %v", result, err)
+	}
+	select {
+	case env := <-deltas:
+		if env.UserID != "alice" || len(env.Actions) != 1 || env.Actions[0].NodeID != "task_1" || env.Actions[0].Properties["highlight"] != true {
+			t.Errorf("Expected task_1 highlighted, got %+v", env)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the highlight to be sent")
+	}
+	if _, err := server.CallTool(ctx, "focus_camera", map[string]interface{}{"node": "Dentist"}); err != nil {
+		t.Fatalf("focus_camera failed: %v", err)
+	}
+	if env := <-cameras; env.Action != eventsourcing.CameraFocus || env.NodeID != "calendar_event_1" || env.UserID != "alice" {
+		t.Errorf("Expected the camera to focus the event, got %+v", env)
+	}
+
+	// As the orchestrator directs it, for the user of the request
+	camera := &orchestration.CameraDirectedEvent{Action: eventsourcing.CameraZoomZone, Zone: "calendar"}
+	camera.Metadata().UserID = "alice"
+	server.HandleCameraDirected(camera)
+	if env := <-cameras; env.Type != "camera" || env.Action != eventsourcing.CameraZoomZone || env.Zone != "calendar" {
+		t.Errorf("Expected the camera to zoom to the calendar, got %+v", env)
+	}
+
+	// Grouped nodes are placed relative to their parents and stay there
+	if _, err := server.CallTool(ctx, "group_nodes", map[string]interface{}{"node_ids": []interface{}{"task_1"}, "around": "calendar_hub"}); err != nil {
+		t.Fatalf("group_nodes failed: %v", err)
+	}
+	if len(bus.published) != 1 {
+		t.Fatalf("Expected the task's position to be published, got %d events", len(bus.published))
+	}
+	moved := bus.published[0].(*layout.NodeMovedEvent)
+	if moved.NodeID != "task_1" || moved.Metadata().UserID != "alice" || !reflect.DeepEqual(moved.Position, []float64{-2, 0, 1}) {
+		t.Errorf("Expected task_1 two to the right of the hub, got %+v", moved)
+	}
+
+	if _, err := server.CallTool(ctx, "teleport", nil); err == nil {
+		t.Error("Expected an unknown tool to fail")
+	}
+}
@@ -0,0 +1,436 @@
+package godot_ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"mindpalace/internal/auth"
+	"mindpalace/internal/layout"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/llmmodels"
+)
+
+// worldQueryTimeout is how long the clients of a user may take to list the nodes of the world, a
+// variable so tests can shorten it
+var worldQueryTimeout = 5 * time.Second
+
+// Defaults of the arguments of the world's tools
+const (
+	defaultNearRadius   = 10.0
+	defaultFindLimit    = 20
+	defaultGroupSpacing = 2.0
+)
+
+// worldQueries numbers the queries of the world, to match the answers of the clients
+var worldQueries atomic.Int64
+
+// worldNode is a node of the world as a client shows it
+type worldNode struct {
+	NodeID        string                 `json:"node_id"`
+	Title         string                 `json:"title,omitempty"`
+	Description   string                 `json:"description,omitempty"`
+	Details       map[string]interface{} `json:"details,omitempty"`
+	Position      []float64              `json:"position"`       // Relative to the node's parent, as the layout stores it
+	WorldPosition []float64              `json:"world_position"` // Where the node is in the world
+}
+
+// pendingQuery waits for the nodes of a user's world
+type pendingQuery struct {
+	userID string
+	nodes  chan []worldNode
+}
+
+// Tools returns the tools the agents find, show and arrange the objects of the 3D world with, see
+// orchestration.ToolServer. The clients place the objects, so the user's clients answer the queries.
+func (s *GodotServer) Tools() []llmmodels.Tool {
+	nodeIDs := map[string]interface{}{
+		"type":        "array",
+		"items":       map[string]interface{}{"type": "string"},
+		"description": "IDs of the nodes, as find_nodes returns them",
+	}
+	return []llmmodels.Tool{
+		worldTool("find_nodes", "Find the objects of the user's 3D world, e.g. what is near the calendar hub or which tasks are shown. Returns their IDs, titles, details and positions, nearest first when near is given.", map[string]interface{}{
+			"near":   map[string]interface{}{"type": "string", "description": "Node ID or title of the object to search around, e.g. calendar_hub"},
+			"radius": map[string]interface{}{"type": "number", "description": fmt.Sprintf("Distance from near to search within, %g by default", defaultNearRadius)},
+			"type":   map[string]interface{}{"type": "string", "description": "Start of the node IDs to keep, e.g. task_ or calendar_event_"},
+			"text":   map[string]interface{}{"type": "string", "description": "Text the title, description or details must contain"},
+			"limit":  map[string]interface{}{"type": "integer", "description": fmt.Sprintf("Most nodes to return, %d by default", defaultFindLimit)},
+		}),
+		worldTool("focus_camera", "Move the user's camera to look at an object of the 3D world", map[string]interface{}{
+			"node": map[string]interface{}{"type": "string", "description": "Node ID or title of the object"},
+		}, "node"),
+		worldTool("highlight_nodes", "Highlight objects of the 3D world, e.g. the overdue tasks found with find_nodes, or clear their highlight", map[string]interface{}{
+			"node_ids":    nodeIDs,
+			"highlighted": map[string]interface{}{"type": "boolean", "description": "False clears the highlight, true by default"},
+		}, "node_ids"),
+		worldTool("group_nodes", "Move objects of the 3D world together in a circle, around another object or where they are on average. They stay there, as if the user dragged them.", map[string]interface{}{
+			"node_ids": nodeIDs,
+			"around":   map[string]interface{}{"type": "string", "description": "Node ID or title of the object to group them around"},
+			"spacing":  map[string]interface{}{"type": "number", "description": fmt.Sprintf("Distance between the objects, %g by default", defaultGroupSpacing)},
+		}, "node_ids"),
+	}
+}
+
+// worldTool describes a tool of the world
+func worldTool(name, description string, properties map[string]interface{}, required ...string) llmmodels.Tool {
+	parameters := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		parameters["required"] = required
+	}
+	return llmmodels.Tool{
+		Type: "function",
+		Function: map[string]interface{}{
+			"name":        name,
+			"description": description,
+			"parameters":  parameters,
+		},
+	}
+}
+
+// CallTool calls a tool of the world for the user of the context, see auth.UserOf
+func (s *GodotServer) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (string, error) {
+	userID := auth.UserOf(ctx)
+	switch name {
+	case "find_nodes":
+		return s.findNodes(ctx, userID, arguments)
+	case "focus_camera":
+		return s.focusCamera(ctx, userID, arguments)
+	case "highlight_nodes":
+		return s.highlightNodes(ctx, userID, arguments)
+	case "group_nodes":
+		return s.groupNodes(ctx, userID, arguments)
+	}
+	return "", fmt.Errorf("unknown tool %s", name)
+}
+
+// queryWorld asks the clients of the user for the nodes of the world, returning the first answer
+func (s *GodotServer) queryWorld(ctx context.Context, userID string) ([]worldNode, error) {
+	queryID := fmt.Sprintf("world_%d", worldQueries.Add(1))
+	pending := pendingQuery{userID: userID, nodes: make(chan []worldNode, 1)}
+	s.pendingMu.Lock()
+	s.pendingQueries[queryID] = pending
+	s.pendingMu.Unlock()
+	defer func() {
+		s.pendingMu.Lock()
+		delete(s.pendingQueries, queryID)
+		s.pendingMu.Unlock()
+	}()
+
+	asked := 0
+	msg := map[string]interface{}{"type": "world_query", "query_id": queryID}
+	s.sendJSON(msg, func(client *ClientState) bool {
+		if client.userID != userID || !client.ready {
+			return false
+		}
+		asked++
+		return true
+	})
+	if asked == 0 {
+		return nil, fmt.Errorf("the 3D world is not open")
+	}
+	timeout := time.NewTimer(worldQueryTimeout)
+	defer timeout.Stop()
+	select {
+	case nodes := <-pending.nodes:
+		return nodes, nil
+	case <-timeout.C:
+		return nil, fmt.Errorf("the 3D world didn't answer within %s", worldQueryTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// handleWorldNodes passes the nodes a client lists to the query waiting for them
+func (s *GodotServer) handleWorldNodes(userID string, message []byte) {
+	var answer struct {
+		QueryID string      `json:"query_id"`
+		Nodes   []worldNode `json:"nodes"`
+	}
+	if err := json.Unmarshal(message, &answer); err != nil {
+		logger.Error("Invalid world_nodes message from Godot: %v", err)
+		return
+	}
+	nodes := answer.Nodes[:0]
+	for _, node := range answer.Nodes {
+		if len(node.Position) >= 3 && len(node.WorldPosition) >= 3 {
+			nodes = append(nodes, node)
+		}
+	}
+	s.pendingMu.RLock()
+	pending, exists := s.pendingQueries[answer.QueryID]
+	s.pendingMu.RUnlock()
+	if !exists || pending.userID != userID {
+		logger.Debug("Ignoring the answer to world query %s, answered or not the client's", answer.QueryID)
+		return
+	}
+	select {
+	case pending.nodes <- nodes:
+	default: // Another client of the user answered first
+	}
+}
+
+// findNodes returns the nodes matching the arguments as JSON, nearest first when searching around a node
+func (s *GodotServer) findNodes(ctx context.Context, userID string, arguments map[string]interface{}) (string, error) {
+	nodes, err := s.queryWorld(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	prefix, _ := arguments["type"].(string)
+	text, _ := arguments["text"].(string)
+	limit := defaultFindLimit
+	if value, ok := arguments["limit"].(float64); ok && value > 0 {
+		limit = int(value)
+	}
+
+	type found struct {
+		worldNode
+		Distance *float64 `json:"distance,omitempty"`
+	}
+	var matches []found
+	var center *worldNode
+	radius := defaultNearRadius
+	if near, _ := arguments["near"].(string); near != "" {
+		if center = lookupNode(nodes, near); center == nil {
+			return "", fmt.Errorf("nothing in the world is called %q", near)
+		}
+		if value, ok := arguments["radius"].(float64); ok && value > 0 {
+			radius = value
+		}
+	}
+	for _, node := range nodes {
+		if !strings.HasPrefix(node.NodeID, prefix) || (text != "" && !node.mentions(text)) {
+			continue
+		}
+		match := found{worldNode: node}
+		if center != nil {
+			if node.NodeID == center.NodeID {
+				continue
+			}
+			distance := math.Round(distanceBetween(center.WorldPosition, node.WorldPosition)*10) / 10
+			if distance > radius {
+				continue
+			}
+			match.Distance = &distance
+		}
+		matches = append(matches, match)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Distance != nil && matches[j].Distance != nil {
+			return *matches[i].Distance < *matches[j].Distance
+		}
+		return matches[i].NodeID < matches[j].NodeID
+	})
+
+	result := map[string]interface{}{"total": len(matches)}
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	if matches == nil {
+		matches = []found{}
+	}
+	result["nodes"] = matches
+	data, err := json.Marshal(result)
+	return string(data), err
+}
+
+// focusCamera moves the camera of the user's clients to the node
+func (s *GodotServer) focusCamera(ctx context.Context, userID string, arguments map[string]interface{}) (string, error) {
+	name, _ := arguments["node"].(string)
+	if name == "" {
+		return "", fmt.Errorf("node is required")
+	}
+	nodes, err := s.queryWorld(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	node := lookupNode(nodes, name)
+	if node == nil {
+		return "", fmt.Errorf("nothing in the world is called %q", name)
+	}
+	s.SendCamera(eventsourcing.CameraEnvelope{Action: eventsourcing.CameraFocus, NodeID: node.NodeID, UserID: userID})
+	return fmt.Sprintf("The camera looks at %s", node.label()), nil
+}
+
+// highlightNodes highlights the nodes on the user's clients, or clears their highlight
+func (s *GodotServer) highlightNodes(ctx context.Context, userID string, arguments map[string]interface{}) (string, error) {
+	highlighted := true
+	if value, ok := arguments["highlighted"].(bool); ok {
+		highlighted = value
+	}
+	nodes, err := s.queryWorld(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	shown, missing := nodesByID(nodes, arguments["node_ids"])
+	if len(shown) == 0 {
+		return "", fmt.Errorf("none of the nodes are in the world: %s", strings.Join(missing, ", "))
+	}
+	actions := make([]eventsourcing.DeltaAction, 0, len(shown))
+	for _, node := range shown {
+		actions = append(actions, eventsourcing.DeltaAction{
+			Type:       "update",
+			NodeID:     node.NodeID,
+			Properties: map[string]interface{}{"highlight": highlighted},
+		})
+	}
+	s.showWorld(userID, actions...)
+	verb := "Highlighted"
+	if !highlighted {
+		verb = "Cleared the highlight of"
+	}
+	return withMissing(fmt.Sprintf("%s %d nodes", verb, len(shown)), missing), nil
+}
+
+// groupNodes places the nodes in a circle around a node or their average position, recording their
+// positions as if the user dragged them there
+func (s *GodotServer) groupNodes(ctx context.Context, userID string, arguments map[string]interface{}) (string, error) {
+	if s.eventBus == nil {
+		return "", fmt.Errorf("the layout can't be changed")
+	}
+	nodes, err := s.queryWorld(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	grouped, missing := nodesByID(nodes, arguments["node_ids"])
+	if len(grouped) == 0 {
+		return "", fmt.Errorf("none of the nodes are in the world: %s", strings.Join(missing, ", "))
+	}
+	spacing := defaultGroupSpacing
+	if value, ok := arguments["spacing"].(float64); ok && value > 0 {
+		spacing = value
+	}
+
+	var center []float64
+	around, _ := arguments["around"].(string)
+	if around != "" {
+		anchor := lookupNode(nodes, around)
+		if anchor == nil {
+			return "", fmt.Errorf("nothing in the world is called %q", around)
+		}
+		center = anchor.WorldPosition
+	} else {
+		center = make([]float64, 3)
+		for _, node := range grouped {
+			for i := range center {
+				center[i] += node.WorldPosition[i] / float64(len(grouped))
+			}
+		}
+	}
+
+	// The circle keeps the nodes spacing apart, and clear of the node they are grouped around
+	radius := 0.0
+	if around != "" || len(grouped) > 1 {
+		radius = math.Max(spacing*float64(len(grouped))/(2*math.Pi), spacing)
+	}
+	for i, node := range grouped {
+		angle := 2 * math.Pi * float64(i) / float64(len(grouped))
+		target := []float64{center[0] + radius*math.Cos(angle), center[1], center[2] + radius*math.Sin(angle)}
+		// The layout keeps positions relative to the parent, which is where the node is in the world less its position
+		position := make([]float64, 3)
+		for j := range position {
+			position[j] = math.Round((target[j]-node.WorldPosition[j]+node.Position[j])*100) / 100
+		}
+		moved := layout.NewNodeMovedEvent(node.NodeID, position)
+		moved.Metadata().UserID = userID
+		s.eventBus.Publish(moved)
+	}
+	message := fmt.Sprintf("Grouped %d nodes", len(grouped))
+	if around != "" {
+		message += " around " + around
+	}
+	return withMissing(message, missing), nil
+}
+
+// showWorld sends actions changing only how the world looks to the clients of the user
+func (s *GodotServer) showWorld(userID string, actions ...eventsourcing.DeltaAction) {
+	s.broadcast(eventsourcing.DeltaEnvelope{
+		Type:      "delta",
+		Aggregate: "world",
+		EventID:   fmt.Sprintf("world_%d", worldQueries.Add(1)),
+		Timestamp: eventsourcing.ISOTimestamp(),
+		UserID:    userID,
+		Actions:   actions,
+	})
+}
+
+// lookupNode returns the node with the ID or title, spaces in an ID standing for underscores as in
+// "calendar hub", or else the first whose title contains the name
+func lookupNode(nodes []worldNode, name string) *worldNode {
+	id := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+	for i, node := range nodes {
+		if node.NodeID == id || strings.EqualFold(node.Title, name) {
+			return &nodes[i]
+		}
+	}
+	for i, node := range nodes {
+		if node.Title != "" && strings.Contains(strings.ToLower(node.Title), strings.ToLower(name)) {
+			return &nodes[i]
+		}
+	}
+	return nil
+}
+
+// nodesByID returns the nodes with the IDs of a JSON array, and the IDs not in the world
+func nodesByID(nodes []worldNode, ids interface{}) ([]worldNode, []string) {
+	byID := make(map[string]worldNode, len(nodes))
+	for _, node := range nodes {
+		byID[node.NodeID] = node
+	}
+	list, _ := ids.([]interface{})
+	var found []worldNode
+	var missing []string
+	for _, value := range list {
+		id, _ := value.(string)
+		if node, exists := byID[id]; exists {
+			found = append(found, node)
+		} else {
+			missing = append(missing, fmt.Sprint(value))
+		}
+	}
+	return found, missing
+}
+
+// withMissing adds the nodes that were not found to the result of a tool
+func withMissing(result string, missing []string) string {
+	if len(missing) == 0 {
+		return result
+	}
+	return fmt.Sprintf("%s, not in the world: %s", result, strings.Join(missing, ", "))
+}
+
+// mentions reports whether the title, description or details of the node contain the text
+func (n worldNode) mentions(text string) bool {
+	text = strings.ToLower(text)
+	fields := []string{n.Title, n.Description}
+	for key, value := range n.Details {
+		fields = append(fields, key, fmt.Sprint(value))
+	}
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// label names the node in the results of the tools
+func (n worldNode) label() string {
+	if n.Title != "" {
+		return fmt.Sprintf("%s (%s)", n.Title, n.NodeID)
+	}
+	return n.NodeID
+}
+
+// distanceBetween returns the distance between two positions
+func distanceBetween(a, b []float64) float64 {
+	if len(a) < 3 || len(b) < 3 {
+		return math.Inf(1)
+	}
+	return math.Sqrt((a[0]-b[0])*(a[0]-b[0]) + (a[1]-b[1])*(a[1]-b[1]) + (a[2]-b[2])*(a[2]-b[2]))
+}
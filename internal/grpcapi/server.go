@@ -0,0 +1,410 @@
+// Package grpcapi exposes MindPalace over gRPC, for integrations like mobile apps and scripts that want
+// typed clients. The service is defined in api/mindpalace/v1/mindpalace.proto; its Go code is generated
+// into pkg/api/mindpalacev1.
+package grpcapi
+
+//go:generate protoc -I ../../api --go_out=../.. --go_opt=module=mindpalace --go-grpc_out=../.. --go-grpc_opt=module=mindpalace mindpalace/v1/mindpalace.proto
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"mindpalace/internal/auth"
+	"mindpalace/pkg/api/mindpalacev1"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// CommandExecutor executes commands and lists the stored events
+type CommandExecutor interface {
+	ExecuteCommand(commandName string, data any) error
+	QueryEvents(q eventsourcing.EventQuery) ([]eventsourcing.Event, error)
+}
+
+// AggregateLookup gives access to the registered aggregates
+type AggregateLookup interface {
+	AllAggregates() []eventsourcing.Aggregate
+	AggregateByName(name string) (eventsourcing.Aggregate, error)
+}
+
+// UserAggregateLookup gives access to the aggregates as a household member sees them. Implement next
+// to AggregateLookup when users have aggregates of their own.
+type UserAggregateLookup interface {
+	VisibleAggregatesOf(userID string) []eventsourcing.Aggregate
+	UserAggregateByName(userID, name string) (eventsourcing.Aggregate, error)
+}
+
+// subscriptionBuffer is the number of events a subscription may fall behind before it is ended
+const subscriptionBuffer = 256
+
+// replayPage is the number of stored events a subscription reads from the log at a time
+const replayPage = 500
+
+// Server serves the MindPalace gRPC API
+type Server struct {
+	mindpalacev1.UnimplementedMindPalaceServer
+	addr       string
+	server     *grpc.Server
+	commands   CommandExecutor
+	aggregates AggregateLookup
+	users      *auth.Users
+	redactor   eventsourcing.Redactor
+	listeners  map[chan eventsourcing.Event]struct{}
+	stopping   chan struct{} // Closed on shutdown, ending the subscriptions
+	stopOnce   sync.Once
+	mu         sync.Mutex
+}
+
+// NewServer creates a gRPC API server and subscribes it to all events on the bus
+func NewServer(addr string, commands CommandExecutor, eventBus eventsourcing.EventBus, aggregates AggregateLookup) *Server {
+	s := &Server{
+		addr:       addr,
+		commands:   commands,
+		aggregates: aggregates,
+		listeners:  make(map[chan eventsourcing.Event]struct{}),
+		stopping:   make(chan struct{}),
+	}
+	s.server = grpc.NewServer(grpc.UnaryInterceptor(s.authenticateUnary), grpc.StreamInterceptor(s.authenticateStream))
+	mindpalacev1.RegisterMindPalaceServer(s.server, s)
+	eventBus.SubscribeAll(s.notify)
+	return s
+}
+
+// SetUsers requires clients to authenticate as one of the users once users are configured, with
+// "authorization: Bearer <token>" metadata
+func (s *Server) SetUsers(users *auth.Users) {
+	s.users = users
+}
+
+// SetRedactor hides the redacted content of the events listed and streamed
+func (s *Server) SetRedactor(redactor eventsourcing.Redactor) {
+	s.redactor = redactor
+}
+
+// Start listens on the configured address and blocks until the server fails or is shut down
+func (s *Server) Start() error {
+	logging.Info("Starting gRPC API on %s", s.addr)
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve serves the API on the listener until the server fails or is shut down
+func (s *Server) Serve(listener net.Listener) error {
+	return s.server.Serve(listener)
+}
+
+// Shutdown ends the subscriptions and waits for the calls in progress to finish until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stopping) })
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
+
+// authenticate returns the context of a call with the user its token belongs to
+func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
+	if s.users == nil {
+		return ctx, nil
+	}
+	token := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token = strings.TrimPrefix(values[0], "Bearer ")
+		}
+	}
+	userID, ok := s.users.Authenticate(token)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "a valid token is required")
+	}
+	return auth.WithUser(ctx, userID), nil
+}
+
+func (s *Server) authenticateUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) authenticateStream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &userStream{ServerStream: stream, ctx: ctx})
+}
+
+// userStream is a stream with the context of its user
+type userStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (u *userStream) Context() context.Context { return u.ctx }
+
+// ExecuteCommand executes the command for the user, with the user's own command if they have one
+func (s *Server) ExecuteCommand(ctx context.Context, req *mindpalacev1.ExecuteCommandRequest) (*mindpalacev1.ExecuteCommandResponse, error) {
+	if req.GetCommand() == "" {
+		return nil, status.Error(codes.InvalidArgument, "command is required")
+	}
+	input := req.GetInput().AsMap()
+	input["userID"] = auth.UserOf(ctx)
+	if err := s.commands.ExecuteCommand(req.GetCommand(), input); err != nil {
+		if eventsourcing.IsConflict(err) {
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &mindpalacev1.ExecuteCommandResponse{}, nil
+}
+
+// SubmitRequest starts processing a request, whose events carry the request ID returned
+func (s *Server) SubmitRequest(ctx context.Context, req *mindpalacev1.SubmitRequestRequest) (*mindpalacev1.SubmitRequestResponse, error) {
+	if req.GetText() == "" {
+		return nil, status.Error(codes.InvalidArgument, "text is required")
+	}
+	requestID := fmt.Sprintf("grpc_req_%d", time.Now().UnixNano())
+	userID := auth.UserOf(ctx)
+	eventsourcing.SafeGo("GRPCSubmitRequest", map[string]interface{}{"requestID": requestID}, func() {
+		err := s.commands.ExecuteCommand("ProcessUserRequest", map[string]interface{}{
+			"requestText": req.GetText(),
+			"requestID":   requestID,
+			"sessionID":   req.GetSessionId(),
+			"userID":      userID,
+		})
+		if err != nil {
+			logging.Error("gRPC API request %s failed: %v", requestID, err)
+		}
+	})
+	return &mindpalacev1.SubmitRequestResponse{RequestId: requestID}, nil
+}
+
+// visible reports whether the user may see the event: household members see their own events, the
+// owner sees all events
+func visible(userID string, event eventsourcing.Event) bool {
+	return userID == "" || event.Metadata().UserID == userID
+}
+
+// visibleUsers returns the users whose stored events the user sees, nil for all of them
+func visibleUsers(userID string) []string {
+	if userID == "" {
+		return nil
+	}
+	return []string{userID}
+}
+
+// selected reports whether the event is of one of the types, any type if there are none
+func selected(types []string, event eventsourcing.Event) bool {
+	return len(types) == 0 || slices.Contains(types, event.Type())
+}
+
+// toEvent converts an event to its wire format, with the redactions of its user applied
+func (s *Server) toEvent(event eventsourcing.Event) (*mindpalacev1.Event, error) {
+	data, err := event.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if s.redactor != nil {
+		data = s.redactor.Redact(event.Metadata().UserID, data)
+	}
+	fields := &structpb.Struct{}
+	if err := protojson.Unmarshal(data, fields); err != nil {
+		return nil, err
+	}
+	meta := event.Metadata()
+	return &mindpalacev1.Event{
+		Type:      event.Type(),
+		Sequence:  meta.Sequence,
+		Aggregate: meta.Aggregate,
+		Version:   meta.Version,
+		UserId:    meta.UserID,
+		Data:      fields,
+	}, nil
+}
+
+// ListEvents lists the stored events the user sees, of the types asked for
+func (s *Server) ListEvents(ctx context.Context, req *mindpalacev1.ListEventsRequest) (*mindpalacev1.ListEventsResponse, error) {
+	if req.GetOffset() < 0 || req.GetLimit() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "offset and limit must not be negative")
+	}
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = 100
+	}
+	events, err := s.commands.QueryEvents(eventsourcing.EventQuery{
+		Types:  req.GetTypes(),
+		Users:  visibleUsers(auth.UserOf(ctx)),
+		Offset: int(req.GetOffset()),
+		Limit:  limit,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to read events: %v", err)
+	}
+	resp := &mindpalacev1.ListEventsResponse{}
+	for _, event := range events {
+		converted, err := s.toEvent(event)
+		if err != nil {
+			logging.Error("Failed to convert event %s: %v", event.Type(), err)
+			continue
+		}
+		resp.Events = append(resp.Events, converted)
+	}
+	return resp, nil
+}
+
+// SubscribeEvents streams the events the user sees as they are published, first sending the stored
+// events after the sequence asked for. A subscriber falling too far behind is ended with
+// ResourceExhausted, and can subscribe again after the last sequence it received.
+func (s *Server) SubscribeEvents(req *mindpalacev1.SubscribeEventsRequest, stream mindpalacev1.MindPalace_SubscribeEventsServer) error {
+	userID := auth.UserOf(stream.Context())
+	// Listen before replaying so no events are missed in between
+	listener := s.addListener()
+	defer s.removeListener(listener)
+
+	send := func(event eventsourcing.Event) error {
+		if !selected(req.GetTypes(), event) || !visible(userID, event) {
+			return nil
+		}
+		converted, err := s.toEvent(event)
+		if err != nil {
+			logging.Error("Failed to convert event %s: %v", event.Type(), err)
+			return nil
+		}
+		return stream.Send(converted)
+	}
+	last := req.GetAfterSequence()
+	for replaying := last > 0; replaying; {
+		events, err := s.commands.QueryEvents(eventsourcing.EventQuery{After: last, Types: req.GetTypes(), Users: visibleUsers(userID), Limit: replayPage})
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to read events: %v", err)
+		}
+		for _, event := range events {
+			if err := send(event); err != nil {
+				return err
+			}
+			last = event.Metadata().Sequence
+		}
+		replaying = len(events) == replayPage
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.stopping:
+			return status.Error(codes.Unavailable, "the server is shutting down")
+		case event, ok := <-listener:
+			if !ok {
+				return status.Errorf(codes.ResourceExhausted, "fell %d events behind, subscribe again after the last sequence received", subscriptionBuffer)
+			}
+			// Events replayed above are published again only if they were published meanwhile
+			if sequence := event.Metadata().Sequence; sequence != 0 && sequence <= last {
+				continue
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ListAggregates lists the IDs of the aggregates the user sees
+func (s *Server) ListAggregates(ctx context.Context, req *mindpalacev1.ListAggregatesRequest) (*mindpalacev1.ListAggregatesResponse, error) {
+	aggs := s.aggregates.AllAggregates()
+	if users, ok := s.aggregates.(UserAggregateLookup); ok {
+		aggs = users.VisibleAggregatesOf(auth.UserOf(ctx))
+	}
+	resp := &mindpalacev1.ListAggregatesResponse{}
+	for _, agg := range aggs {
+		resp.Ids = append(resp.Ids, agg.ID())
+	}
+	return resp, nil
+}
+
+// GetAggregate returns the state of an aggregate as the user sees it, its snapshot when it supports one;
+// household members get their part of a shared aggregate
+func (s *Server) GetAggregate(ctx context.Context, req *mindpalacev1.GetAggregateRequest) (*mindpalacev1.Aggregate, error) {
+	var agg eventsourcing.Aggregate
+	var err error
+	if users, ok := s.aggregates.(UserAggregateLookup); ok {
+		agg, err = users.UserAggregateByName(auth.UserOf(ctx), req.GetId())
+	} else {
+		agg, err = s.aggregates.AggregateByName(req.GetId())
+	}
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	var data []byte
+	if snapshotter, ok := agg.(eventsourcing.UserSnapshotter); ok && auth.UserOf(ctx) != "" {
+		data, err = snapshotter.SnapshotFor(auth.UserOf(ctx))
+	} else if snapshotter, ok := agg.(eventsourcing.Snapshotter); ok {
+		data, err = snapshotter.SaveSnapshot()
+	} else {
+		data, err = json.Marshal(agg)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to serialize aggregate: %v", err)
+	}
+	state := &structpb.Value{}
+	if err := protojson.Unmarshal(data, state); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to convert aggregate: %v", err)
+	}
+	return &mindpalacev1.Aggregate{Id: agg.ID(), State: state}, nil
+}
+
+// notify fans out published events to the subscriptions without blocking the bus, ending those that
+// fell behind
+func (s *Server) notify(event eventsourcing.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for listener := range s.listeners {
+		select {
+		case listener <- event:
+		default:
+			logging.Error("gRPC API subscription is full, ending it")
+			close(listener)
+			delete(s.listeners, listener)
+		}
+	}
+	return nil
+}
+
+func (s *Server) addListener() chan eventsourcing.Event {
+	listener := make(chan eventsourcing.Event, subscriptionBuffer)
+	s.mu.Lock()
+	s.listeners[listener] = struct{}{}
+	s.mu.Unlock()
+	return listener
+}
+
+func (s *Server) removeListener(listener chan eventsourcing.Event) {
+	s.mu.Lock()
+	delete(s.listeners, listener)
+	s.mu.Unlock()
+}
@@ -0,0 +1,216 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"mindpalace/internal/auth"
+	"mindpalace/pkg/api/mindpalacev1"
+	"mindpalace/pkg/eventsourcing"
+)
+
+type taskEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Title     string `json:"title"`
+}
+
+func (e *taskEvent) Type() string                { return e.EventType }
+func (e *taskEvent) Marshal() ([]byte, error)    { return json.Marshal(e) }
+func (e *taskEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type mockBus struct {
+	mu       sync.Mutex
+	handlers []eventsourcing.EventHandler
+}
+
+func (b *mockBus) Publish(event eventsourcing.Event) {
+	b.mu.Lock()
+	handlers := append([]eventsourcing.EventHandler{}, b.handlers...)
+	b.mu.Unlock()
+	for _, h := range handlers {
+		h(event)
+	}
+}
+func (b *mockBus) Subscribe(eventType string, handler eventsourcing.EventHandler) {}
+func (b *mockBus) SubscribeAll(handler eventsourcing.EventHandler) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+}
+
+// mockProcessor stores a TaskCreated event for every CreateTask and publishes it
+type mockProcessor struct {
+	mu     sync.Mutex
+	bus    *mockBus
+	events []eventsourcing.Event
+}
+
+func (p *mockProcessor) ExecuteCommand(commandName string, data any) error {
+	input := data.(map[string]interface{})
+	if commandName != "CreateTask" {
+		return fmt.Errorf("command %s not found", commandName)
+	}
+	title, _ := input["title"].(string)
+	userID, _ := input["userID"].(string)
+	event := &taskEvent{EventType: "taskmanager_TaskCreated", Title: title}
+	event.UserID = userID
+	p.mu.Lock()
+	event.Sequence = int64(len(p.events) + 1)
+	p.events = append(p.events, event)
+	p.mu.Unlock()
+	p.bus.Publish(event)
+	return nil
+}
+
+func (p *mockProcessor) QueryEvents(q eventsourcing.EventQuery) ([]eventsourcing.Event, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return eventsourcing.SelectEvents(p.events, q), nil
+}
+
+type mockAggregate struct {
+	Tasks []string `json:"tasks"`
+}
+
+func (a *mockAggregate) ID() string                                 { return "taskmanager" }
+func (a *mockAggregate) ApplyEvent(event eventsourcing.Event) error { return nil }
+func (a *mockAggregate) GetCustomUI() fyne.CanvasObject             { return nil }
+
+type mockAggregates struct{}
+
+func (m *mockAggregates) AllAggregates() []eventsourcing.Aggregate {
+	return []eventsourcing.Aggregate{&mockAggregate{Tasks: []string{"Buy milk"}}}
+}
+func (m *mockAggregates) AggregateByName(name string) (eventsourcing.Aggregate, error) {
+	if name != "taskmanager" {
+		return nil, fmt.Errorf("aggregate %s not found", name)
+	}
+	return m.AllAggregates()[0], nil
+}
+
+// newTestClient serves the API in memory and returns a client of it
+func newTestClient(t *testing.T, users *auth.Users) (mindpalacev1.MindPalaceClient, *mockProcessor) {
+	t.Helper()
+	bus := &mockBus{}
+	processor := &mockProcessor{bus: bus}
+	server := NewServer("", processor, bus, &mockAggregates{})
+	if users != nil {
+		server.SetUsers(users)
+	}
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Shutdown(context.Background()) })
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return mindpalacev1.NewMindPalaceClient(conn), processor
+}
+
+func createTask(t *testing.T, ctx context.Context, client mindpalacev1.MindPalaceClient, title string) {
+	t.Helper()
+	input, _ := structpb.NewStruct(map[string]interface{}{"title": title})
+	if _, err := client.ExecuteCommand(ctx, &mindpalacev1.ExecuteCommandRequest{Command: "CreateTask", Input: input}); err != nil {
+		t.Fatalf("ExecuteCommand failed: %v", err)
+	}
+}
+
+func TestServer_ExecuteCommandAndListEvents(t *testing.T) {
+	client, _ := newTestClient(t, nil)
+	ctx := context.Background()
+	createTask(t, ctx, client, "Buy milk")
+
+	_, err := client.ExecuteCommand(ctx, &mindpalacev1.ExecuteCommandRequest{Command: "FlyToMoon"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected an unknown command to fail, got %v", err)
+	}
+
+	resp, err := client.ListEvents(ctx, &mindpalacev1.ListEventsRequest{Types: []string{"taskmanager_TaskCreated"}})
+	if err != nil {
+		t.Fatalf("ListEvents failed: %v", err)
+	}
+	if len(resp.Events) != 1 || resp.Events[0].Sequence != 1 || resp.Events[0].Data.Fields["title"].GetStringValue() != "Buy milk" {
+		t.Errorf("Expected the task's event, got %v", resp.Events)
+	}
+}
+
+func TestServer_SubscribeEvents(t *testing.T) {
+	client, _ := newTestClient(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	createTask(t, ctx, client, "Stored before")
+
+	stream, err := client.SubscribeEvents(ctx, &mindpalacev1.SubscribeEventsRequest{})
+	if err != nil {
+		t.Fatalf("SubscribeEvents failed: %v", err)
+	}
+	// Without a sequence only new events are streamed; wait for the subscription before publishing
+	time.Sleep(50 * time.Millisecond)
+	createTask(t, ctx, client, "Published after")
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+	if title := event.Data.Fields["title"].GetStringValue(); title != "Published after" || event.Sequence != 2 {
+		t.Errorf("Expected the new event, got %q at %d", title, event.Sequence)
+	}
+
+	// After a sequence the stored events are replayed first
+	replay, err := client.SubscribeEvents(ctx, &mindpalacev1.SubscribeEventsRequest{AfterSequence: 1})
+	if err != nil {
+		t.Fatalf("SubscribeEvents failed: %v", err)
+	}
+	event, err = replay.Recv()
+	if err != nil || event.Sequence != 2 {
+		t.Errorf("Expected the stored event after sequence 1, got %v, %v", event, err)
+	}
+}
+
+func TestServer_Users(t *testing.T) {
+	client, _ := newTestClient(t, auth.NewUsers(map[string]string{"alice-token": "alice"}))
+
+	_, err := client.ListAggregates(context.Background(), &mindpalacev1.ListAggregatesRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Expected a call without a token refused, got %v", err)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer alice-token")
+	createTask(t, ctx, client, "Alice's task")
+	resp, err := client.ListEvents(ctx, &mindpalacev1.ListEventsRequest{})
+	if err != nil {
+		t.Fatalf("ListEvents failed: %v", err)
+	}
+	if len(resp.Events) != 1 || resp.Events[0].UserId != "alice" {
+		t.Errorf("Expected the command executed for alice, got %v", resp.Events)
+	}
+
+	aggregate, err := client.GetAggregate(ctx, &mindpalacev1.GetAggregateRequest{Id: "taskmanager"})
+	if err != nil {
+		t.Fatalf("GetAggregate failed: %v", err)
+	}
+	if tasks := aggregate.State.GetStructValue().Fields["tasks"].GetListValue().GetValues(); len(tasks) != 1 || tasks[0].GetStringValue() != "Buy milk" {
+		t.Errorf("Expected the aggregate's state, got %v", aggregate.State)
+	}
+	if _, err := client.GetAggregate(ctx, &mindpalacev1.GetAggregateRequest{Id: "nope"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected an unknown aggregate not found, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"mindpalace/internal/audit"
+	"mindpalace/internal/auth"
+)
+
+// AuditTrail tells what events changed in the aggregates and why
+type AuditTrail interface {
+	Entries(filter audit.Filter) []audit.Entry
+	Entry(sequence int64) (audit.Entry, bool)
+}
+
+// SetAudit serves the audit trail on /api/audit
+func (s *Server) SetAudit(trail AuditTrail) {
+	s.audit = trail
+	s.mux.HandleFunc("GET /api/audit", s.handleListAudit)
+	s.mux.HandleFunc("GET /api/audit/{sequence}", s.handleGetAudit)
+}
+
+// handleListAudit lists the latest changes the user sees, optionally of one aggregate or request.
+// Pass the sequence of the oldest change listed as before to page back in history.
+func (s *Server) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := intParam(query.Get("limit"), 50)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+		return
+	}
+	before, err := intParam(query.Get("before"), 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "before must be a non-negative integer")
+		return
+	}
+	filter := audit.Filter{
+		Aggregate: query.Get("aggregate"),
+		RequestID: query.Get("request"),
+		Before:    int64(before),
+		Limit:     limit,
+	}
+	// The owner sees the changes of everyone, household members their own
+	if userID := auth.UserOf(r.Context()); userID != "" {
+		filter.UserID = userID
+	} else {
+		filter.AllUsers = true
+	}
+	entries := s.audit.Entries(filter)
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// handleGetAudit returns what the event with the sequence changed and why
+func (s *Server) handleGetAudit(w http.ResponseWriter, r *http.Request) {
+	sequence, err := strconv.ParseInt(r.PathValue("sequence"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "sequence must be an integer")
+		return
+	}
+	entry, ok := s.audit.Entry(sequence)
+	if userID := auth.UserOf(r.Context()); !ok || (userID != "" && entry.UserID != userID) {
+		writeError(w, http.StatusNotFound, "no change recorded for the event")
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
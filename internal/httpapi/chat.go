@@ -0,0 +1,243 @@
+package httpapi
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"mindpalace/internal/auth"
+	"mindpalace/internal/chat"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+	"mindpalace/pkg/nltime"
+)
+
+// ChatHistory gives the browser chat the messages shown in the desktop chat, and searches them
+type ChatHistory interface {
+	GetUIMessages() []chat.Message
+	SearchMessages(query chat.MessageQuery) []chat.Message
+}
+
+//go:embed chat.html
+var chatPage string
+
+var chatTemplates = template.Must(template.New("chat").Funcs(template.FuncMap{
+	"speaker": speaker,
+	"clock":   func(t time.Time) string { return t.Local().Format("15:04") },
+}).Parse(chatPage))
+
+// chunk is partial LLM output of a request that is still being generated
+type chunk struct {
+	RequestID string
+	Content   string
+	Final     bool
+	userID    string // User who made the request, empty for the owner
+}
+
+// SetChat serves the browser chat on / using the messages of the given history
+func (s *Server) SetChat(history ChatHistory) {
+	s.SetUserChats(func(string) ChatHistory { return history })
+}
+
+// SetUserChats serves the browser chat on / using the messages of each user's own history
+func (s *Server) SetUserChats(chatFor func(userID string) ChatHistory) {
+	s.chatFor = chatFor
+	s.mux.HandleFunc("GET /{$}", s.handleChatPage)
+	s.mux.HandleFunc("POST /chat/messages", s.handleChatMessage)
+	s.mux.HandleFunc("GET /chat/stream", s.handleChatStream)
+	s.mux.HandleFunc("GET /api/chat/search", s.handleSearchChat)
+}
+
+// foundMessage is a message found by a chat search
+type foundMessage struct {
+	ID        string    `json:"id"`
+	RequestID string    `json:"request_id,omitempty"`
+	SessionID string    `json:"session_id"`
+	Role      string    `json:"role"`
+	Agent     string    `json:"agent,omitempty"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// handleSearchChat returns the user's messages matching the query parameters text, role, agent, tag,
+// session, from and to, the most recent limit of them
+func (s *Server) handleSearchChat(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	limit, err := intParam(params.Get("limit"), 50)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+		return
+	}
+	query := chat.MessageQuery{
+		Text:      params.Get("text"),
+		Role:      params.Get("role"),
+		Agent:     params.Get("agent"),
+		Tag:       params.Get("tag"),
+		SessionID: params.Get("session"),
+		Limit:     limit,
+	}
+	for name, bound := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		if text := params.Get(name); text != "" {
+			if *bound, err = nltime.Parse(text, time.Now()); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %v", name, err))
+				return
+			}
+		}
+	}
+	found := make([]foundMessage, 0)
+	for _, msg := range s.chatFor(auth.UserOf(r.Context())).SearchMessages(query) {
+		found = append(found, foundMessage{
+			ID:        msg.ID,
+			RequestID: msg.RequestID,
+			SessionID: msg.SessionID,
+			Role:      msg.Role.SystemRole,
+			Agent:     msg.Agent,
+			Content:   msg.Content,
+			Timestamp: msg.Timestamp,
+		})
+	}
+	writeJSON(w, http.StatusOK, found)
+}
+
+// HandleStreamingEvent forwards partial LLM output to the browser chats; assign it to eventsourcing.SubmitStreamingEvent
+func (s *Server) HandleStreamingEvent(event eventsourcing.Event) {
+	e, ok := event.(*eventsourcing.LLMStreamChunkEvent)
+	if !ok {
+		return
+	}
+	c := chunk{RequestID: e.RequestID, Content: e.PartialContent, Final: e.IsFinal}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.userID = s.requestUsers[e.RequestID]
+	for listener := range s.chunkListeners {
+		select {
+		case listener <- c:
+		default: // Later chunks contain the content of dropped ones
+		}
+	}
+}
+
+// handleChatPage renders the chat with the messages of the active session
+func (s *Server) handleChatPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := chatTemplates.ExecuteTemplate(w, "page", s.chatFor(auth.UserOf(r.Context())).GetUIMessages()); err != nil {
+		logging.Error("Failed to render chat page: %v", err)
+	}
+}
+
+// handleChatMessage submits the message typed in the browser as a user request. The answer
+// reaches the browser through the chat stream.
+func (s *Server) handleChatMessage(w http.ResponseWriter, r *http.Request) {
+	text := strings.TrimSpace(r.FormValue("text"))
+	if text == "" {
+		http.Error(w, "text is required", http.StatusBadRequest)
+		return
+	}
+	requestID := fmt.Sprintf("web_req_%d", time.Now().UnixNano())
+	userID := auth.UserOf(r.Context())
+	eventsourcing.SafeGo("WebChatRequest", map[string]interface{}{"requestID": requestID}, func() {
+		err := s.commands.ExecuteCommand("ProcessUserRequest", map[string]interface{}{
+			"requestText": text,
+			"requestID":   requestID,
+			"userID":      userID,
+		})
+		if err != nil {
+			logging.Error("Web chat request %s failed: %v", requestID, err)
+		}
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleChatStream sends the rendered messages as server-sent events whenever an event of the user was
+// applied, and the answers being generated for the user as they stream in
+func (s *Server) handleChatStream(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserOf(r.Context())
+	history := s.chatFor(userID)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	events := s.addListener()
+	defer s.removeListener(events)
+	chunks := s.addChunkListener()
+	defer s.removeChunkListener(chunks)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			if event.Metadata().UserID != userID {
+				continue
+			}
+			// The event may change the history, render the messages again
+			if err := s.sendChatFragment(w, "messages", history.GetUIMessages()); err != nil {
+				return
+			}
+		case c := <-chunks:
+			if c.userID != userID {
+				continue
+			}
+			if c.Final {
+				c.Content = ""
+			}
+			_, c.Content = chat.ParseResponseText(c.Content)
+			if err := s.sendChatFragment(w, "partial", c); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// sendChatFragment writes a rendered template as a server-sent event named after the template
+func (s *Server) sendChatFragment(w http.ResponseWriter, name string, data interface{}) error {
+	var html strings.Builder
+	if err := chatTemplates.ExecuteTemplate(&html, name, data); err != nil {
+		logging.Error("Failed to render chat %s: %v", name, err)
+		return nil
+	}
+	fmt.Fprintf(w, "event: %s\n", name)
+	for _, line := range strings.Split(html.String(), "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	_, err := fmt.Fprint(w, "\n")
+	return err
+}
+
+func (s *Server) addChunkListener() chan chunk {
+	listener := make(chan chunk, 64)
+	s.mu.Lock()
+	s.chunkListeners[listener] = struct{}{}
+	s.mu.Unlock()
+	return listener
+}
+
+func (s *Server) removeChunkListener(listener chan chunk) {
+	s.mu.Lock()
+	delete(s.chunkListeners, listener)
+	s.mu.Unlock()
+}
+
+// speaker names who wrote a message, like the desktop chat does
+func speaker(msg chat.Message) string {
+	if msg.Role == chat.RoleTool {
+		return fmt.Sprintf("%v (tool)", msg.Metadata["function"])
+	}
+	if msg.Agent != "" && msg.Role == chat.RoleAgent {
+		return msg.Agent
+	}
+	if name, _ := msg.Metadata["speaker"].(string); name != "" && msg.Role == chat.RoleUser {
+		return name
+	}
+	return msg.Role.UIRole
+}
@@ -0,0 +1,486 @@
+// Package httpapi exposes MindPalace over HTTP so headless deployments can be driven programmatically.
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mindpalace/internal/auth"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// CommandExecutor executes commands such as ProcessUserRequest
+type CommandExecutor interface {
+	ExecuteCommand(commandName string, data any) error
+	QueryEvents(q eventsourcing.EventQuery) ([]eventsourcing.Event, error)
+}
+
+// AggregateLookup gives access to the registered aggregates
+type AggregateLookup interface {
+	AllAggregates() []eventsourcing.Aggregate
+	AggregateByName(name string) (eventsourcing.Aggregate, error)
+}
+
+// UserAggregateLookup gives access to the aggregates as a household member sees them. Implement next
+// to AggregateLookup when users have aggregates of their own.
+type UserAggregateLookup interface {
+	VisibleAggregatesOf(userID string) []eventsourcing.Aggregate
+	UserAggregateByName(userID, name string) (eventsourcing.Aggregate, error)
+}
+
+// Server serves the MindPalace HTTP API
+type Server struct {
+	addr           string
+	server         *http.Server
+	commands       CommandExecutor
+	aggregates     AggregateLookup
+	mux            *http.ServeMux
+	chatFor        func(userID string) ChatHistory
+	audit          AuditTrail
+	users          *auth.Users
+	redactor       eventsourcing.Redactor
+	listeners      map[chan eventsourcing.Event]struct{}
+	chunkListeners map[chan chunk]struct{}
+	requestUsers   map[string]string // Requests of household members in progress, by request ID
+	mu             sync.Mutex
+}
+
+// NewServer creates an API server and subscribes it to all events on the bus
+func NewServer(addr string, commands CommandExecutor, eventBus eventsourcing.EventBus, aggregates AggregateLookup) *Server {
+	s := &Server{
+		addr:           addr,
+		commands:       commands,
+		aggregates:     aggregates,
+		mux:            http.NewServeMux(),
+		listeners:      make(map[chan eventsourcing.Event]struct{}),
+		chunkListeners: make(map[chan chunk]struct{}),
+		requestUsers:   make(map[string]string),
+	}
+	s.mux.HandleFunc("POST /api/requests", s.handleSubmitRequest)
+	s.mux.HandleFunc("GET /api/requests/{id}/events", s.handleRequestEvents)
+	s.mux.HandleFunc("POST /api/requests/{id}/cancel", s.handleCancelRequest)
+	s.mux.HandleFunc("POST /api/toolcalls/{id}/confirm", s.handleConfirmToolCall)
+	s.mux.HandleFunc("GET /api/events", s.handleListEvents)
+	s.mux.HandleFunc("GET /api/aggregates", s.handleListAggregates)
+	s.mux.HandleFunc("GET /api/aggregates/{name}", s.handleGetAggregate)
+	s.server = &http.Server{Handler: s.mux}
+	eventBus.SubscribeAll(s.notify)
+	return s
+}
+
+// Handler returns the HTTP handler for the API
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// SetUsers requires clients to authenticate as one of the users once users are configured. Each
+// user submits requests and sees events and aggregates of their own.
+func (s *Server) SetUsers(users *auth.Users) {
+	s.users = users
+	s.server.Handler = users.Middleware(s.mux)
+}
+
+// SetRedactor hides the redacted content of the events listed and streamed
+func (s *Server) SetRedactor(redactor eventsourcing.Redactor) {
+	s.redactor = redactor
+}
+
+// marshal returns the payload of an event, with the redactions of its user applied
+func (s *Server) marshal(event eventsourcing.Event) ([]byte, error) {
+	data, err := event.Marshal()
+	if err != nil || s.redactor == nil {
+		return data, err
+	}
+	return s.redactor.Redact(event.Metadata().UserID, data), nil
+}
+
+// Start listens on the configured address and blocks until the server fails or is shut down, then
+// returning http.ErrServerClosed. An address like unix:/run/mindpalace.sock listens on a Unix socket
+// instead of TCP.
+func (s *Server) Start() error {
+	logging.Info("Starting HTTP API on %s", s.addr)
+	network, address := ListenAddress(s.addr)
+	if network == "unix" {
+		// A socket left behind by an earlier run blocks listening
+		os.Remove(address)
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	return s.server.Serve(listener)
+}
+
+// Shutdown stops taking connections and waits for the open ones to finish until ctx is done.
+// Streams end once their requests complete.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// ListenAddress splits an API address into the network and address to listen on or dial
+func ListenAddress(addr string) (network, address string) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return "unix", path
+	}
+	return "tcp", addr
+}
+
+// eventJSON is the wire format for events
+type eventJSON struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// streamChunk is the wire format of partial LLM output, holding all content generated so far
+type streamChunk struct {
+	RequestID      string `json:"request_id"`
+	PartialContent string `json:"partial_content"`
+	IsFinal        bool   `json:"is_final"`
+}
+
+type submitRequest struct {
+	Text      string `json:"text"`
+	Stream    bool   `json:"stream"`
+	SessionID string `json:"session_id"` // Chat session of the request, the active session if empty
+	Revises   string `json:"revises"`    // Request the text is an edit of, resubmitted as this request
+}
+
+// handleSubmitRequest starts processing a user request. With "stream": true the
+// events of the request are sent back as server-sent events until it completes.
+func (s *Server) handleSubmitRequest(w http.ResponseWriter, r *http.Request) {
+	var req submitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	if req.Text == "" {
+		writeError(w, http.StatusBadRequest, "text is required")
+		return
+	}
+	requestID := fmt.Sprintf("http_req_%d", time.Now().UnixNano())
+
+	// Listen before submitting so no events of the request are missed
+	var listener chan eventsourcing.Event
+	var chunks chan chunk
+	if req.Stream {
+		listener = s.addListener()
+		defer s.removeListener(listener)
+		chunks = s.addChunkListener()
+		defer s.removeChunkListener(chunks)
+	}
+
+	userID := auth.UserOf(r.Context())
+	eventsourcing.SafeGo("HTTPSubmitRequest", map[string]interface{}{"requestID": requestID}, func() {
+		err := s.commands.ExecuteCommand("ProcessUserRequest", map[string]interface{}{
+			"requestText": req.Text,
+			"requestID":   requestID,
+			"sessionID":   req.SessionID,
+			"revises":     req.Revises,
+			"userID":      userID,
+		})
+		if err != nil {
+			logging.Error("HTTP API request %s failed: %v", requestID, err)
+		}
+	})
+
+	if !req.Stream {
+		writeJSON(w, http.StatusAccepted, map[string]string{"request_id": requestID})
+		return
+	}
+	s.streamRequest(w, r, requestID, listener, chunks)
+}
+
+// visible reports whether the user may see the event: household members see their own events, the
+// owner sees all events
+func visible(userID string, event eventsourcing.Event) bool {
+	return userID == "" || event.Metadata().UserID == userID
+}
+
+// visibleUsers returns the users whose stored events the user sees, nil for all of them
+func visibleUsers(userID string) []string {
+	if userID == "" {
+		return nil
+	}
+	return []string{userID}
+}
+
+// handleCancelRequest cancels a request in progress
+func (s *Server) handleCancelRequest(w http.ResponseWriter, r *http.Request) {
+	requestID := r.PathValue("id")
+	data := map[string]interface{}{"requestID": requestID, "userID": auth.UserOf(r.Context())}
+	if err := s.commands.ExecuteCommand("CancelRequest", data); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"request_id": requestID})
+}
+
+type confirmRequest struct {
+	Approved bool `json:"approved"`
+}
+
+// handleConfirmToolCall approves or rejects a tool call waiting for confirmation
+func (s *Server) handleConfirmToolCall(w http.ResponseWriter, r *http.Request) {
+	var req confirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	toolCallID := r.PathValue("id")
+	err := s.commands.ExecuteCommand("ConfirmToolCall", map[string]interface{}{
+		"toolCallID": toolCallID,
+		"approved":   req.Approved,
+		"userID":     auth.UserOf(r.Context()),
+	})
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"tool_call_id": toolCallID})
+}
+
+// streamRequest writes events of a request as server-sent events until the request completes or is
+// cancelled. The answers being generated for it are sent as llm_stream events as they stream in.
+func (s *Server) streamRequest(w http.ResponseWriter, r *http.Request, requestID string, listener chan eventsourcing.Event, chunks chan chunk) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Request-ID", requestID)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	writeChunk := func(c chunk) {
+		if c.RequestID != requestID {
+			return
+		}
+		data, _ := json.Marshal(streamChunk{RequestID: c.RequestID, PartialContent: c.Content, IsFinal: c.Final})
+		fmt.Fprintf(w, "event: llm_stream\ndata: %s\n\n", data)
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case c := <-chunks:
+			writeChunk(c)
+			flusher.Flush()
+		case event := <-listener:
+			data, err := s.marshal(event)
+			if err != nil || eventRequestID(data) != requestID || !visible(auth.UserOf(r.Context()), event) {
+				continue
+			}
+			// The answer streams in before the events it leads to, send what is waiting first
+			for pending := true; pending; {
+				select {
+				case c := <-chunks:
+					writeChunk(c)
+				default:
+					pending = false
+				}
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type(), data)
+			flusher.Flush()
+			if event.Type() == "orchestration_RequestCompleted" || event.Type() == "orchestration_RequestCancelled" {
+				return
+			}
+		}
+	}
+}
+
+// handleRequestEvents lists the stored events belonging to a request
+func (s *Server) handleRequestEvents(w http.ResponseWriter, r *http.Request) {
+	requestID := r.PathValue("id")
+	query := eventsourcing.EventQuery{
+		Users:  visibleUsers(auth.UserOf(r.Context())),
+		Fields: map[string]string{"request_id": requestID, "RequestID": requestID}, // RequestCompletedEvent as stored before it had json tags
+	}
+	stored, err := s.commands.QueryEvents(query)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to read events: %v", err))
+		return
+	}
+	events := make([]eventJSON, 0, len(stored))
+	for _, event := range stored {
+		data, err := s.marshal(event)
+		if err != nil {
+			continue
+		}
+		events = append(events, eventJSON{Type: event.Type(), Data: data})
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+// handleListEvents lists stored events, optionally filtered by type and paginated with offset and limit
+func (s *Server) handleListEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	eventType := query.Get("type")
+	offset, err := intParam(query.Get("offset"), 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "offset must be a non-negative integer")
+		return
+	}
+	limit, err := intParam(query.Get("limit"), 100)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+		return
+	}
+
+	q := eventsourcing.EventQuery{Users: visibleUsers(auth.UserOf(r.Context())), Offset: offset, Limit: limit}
+	if eventType != "" {
+		q.Types = []string{eventType}
+	}
+	events := make([]eventJSON, 0)
+	if limit == 0 {
+		writeJSON(w, http.StatusOK, events)
+		return
+	}
+	stored, err := s.commands.QueryEvents(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to read events: %v", err))
+		return
+	}
+	for _, event := range stored {
+		data, err := s.marshal(event)
+		if err != nil {
+			logging.Error("Failed to marshal event %s: %v", event.Type(), err)
+			continue
+		}
+		events = append(events, eventJSON{Type: event.Type(), Data: data})
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+// handleListAggregates lists the IDs of all aggregates the user sees
+func (s *Server) handleListAggregates(w http.ResponseWriter, r *http.Request) {
+	aggs := s.aggregates.AllAggregates()
+	if users, ok := s.aggregates.(UserAggregateLookup); ok {
+		aggs = users.VisibleAggregatesOf(auth.UserOf(r.Context()))
+	}
+	ids := make([]string, 0)
+	for _, agg := range aggs {
+		ids = append(ids, agg.ID())
+	}
+	writeJSON(w, http.StatusOK, ids)
+}
+
+// handleGetAggregate returns the state of an aggregate as the user sees it, using its snapshot when it
+// supports one; household members get their part of a shared aggregate
+func (s *Server) handleGetAggregate(w http.ResponseWriter, r *http.Request) {
+	var agg eventsourcing.Aggregate
+	var err error
+	if users, ok := s.aggregates.(UserAggregateLookup); ok {
+		agg, err = users.UserAggregateByName(auth.UserOf(r.Context()), r.PathValue("name"))
+	} else {
+		agg, err = s.aggregates.AggregateByName(r.PathValue("name"))
+	}
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	var data []byte
+	if snapshotter, ok := agg.(eventsourcing.UserSnapshotter); ok && auth.UserOf(r.Context()) != "" {
+		data, err = snapshotter.SnapshotFor(auth.UserOf(r.Context()))
+	} else if snapshotter, ok := agg.(eventsourcing.Snapshotter); ok {
+		data, err = snapshotter.SaveSnapshot()
+	} else {
+		data, err = json.Marshal(agg)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to serialize aggregate: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// notify fans out published events to active streams without blocking the bus
+func (s *Server) notify(event eventsourcing.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The chunks streamed for a request are told apart by its user until the request ends
+	switch event.Type() {
+	case "orchestration_UserRequestReceived":
+		if userID := event.Metadata().UserID; userID != "" {
+			if data, err := event.Marshal(); err == nil {
+				s.requestUsers[eventRequestID(data)] = userID
+			}
+		}
+	case "orchestration_RequestCompleted", "orchestration_RequestCancelled":
+		if data, err := event.Marshal(); err == nil {
+			delete(s.requestUsers, eventRequestID(data))
+		}
+	}
+	for listener := range s.listeners {
+		select {
+		case listener <- event:
+		default:
+			logging.Error("HTTP API stream is full, dropping event %s", event.Type())
+		}
+	}
+	return nil
+}
+
+func (s *Server) addListener() chan eventsourcing.Event {
+	listener := make(chan eventsourcing.Event, 256)
+	s.mu.Lock()
+	s.listeners[listener] = struct{}{}
+	s.mu.Unlock()
+	return listener
+}
+
+func (s *Server) removeListener(listener chan eventsourcing.Event) {
+	s.mu.Lock()
+	delete(s.listeners, listener)
+	s.mu.Unlock()
+}
+
+// eventRequestID extracts the request ID from a marshaled event, if it has one
+func eventRequestID(data []byte) string {
+	var ids struct {
+		RequestID       string `json:"request_id"`
+		LegacyRequestID string `json:"RequestID"` // RequestCompletedEvent as stored before it had json tags
+	}
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return ""
+	}
+	if ids.RequestID != "" {
+		return ids.RequestID
+	}
+	return ids.LegacyRequestID
+}
+
+func intParam(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Error("Failed to write JSON response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,813 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"mindpalace/internal/audit"
+	"mindpalace/internal/auth"
+	"mindpalace/internal/chat"
+	"mindpalace/internal/orchestration"
+	"mindpalace/internal/pins"
+	"mindpalace/pkg/aggregate"
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Mock implementations for testing
+
+type requestEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	RequestID string `json:"request_id"`
+	Text      string `json:"text"`
+}
+
+func (e *requestEvent) Type() string                { return e.EventType }
+func (e *requestEvent) Marshal() ([]byte, error)    { return json.Marshal(e) }
+func (e *requestEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type mockBus struct {
+	mu       sync.Mutex
+	handlers []eventsourcing.EventHandler
+}
+
+func (b *mockBus) Publish(event eventsourcing.Event) {
+	b.mu.Lock()
+	handlers := append([]eventsourcing.EventHandler{}, b.handlers...)
+	b.mu.Unlock()
+	for _, h := range handlers {
+		h(event)
+	}
+}
+func (b *mockBus) Subscribe(eventType string, handler eventsourcing.EventHandler) {}
+func (b *mockBus) SubscribeAll(handler eventsourcing.EventHandler) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+}
+
+// mockProcessor answers every ProcessUserRequest with a received and a completed event
+type mockProcessor struct {
+	mu     sync.Mutex
+	bus    *mockBus
+	events []eventsourcing.Event
+	answer func(requestID string) // Streams the answer before the request completes, if set
+}
+
+func (p *mockProcessor) ExecuteCommand(commandName string, data any) error {
+	if commandName == "CancelRequest" {
+		if requestID := data.(map[string]interface{})["requestID"]; requestID != "req1" {
+			return fmt.Errorf("request %s is not in progress", requestID)
+		}
+		return nil
+	}
+	if commandName == "ConfirmToolCall" {
+		if toolCallID := data.(map[string]interface{})["toolCallID"]; toolCallID != "call1" {
+			return fmt.Errorf("tool call %s is not awaiting confirmation", toolCallID)
+		}
+		return nil
+	}
+	if commandName != "ProcessUserRequest" {
+		return fmt.Errorf("command %s not found", commandName)
+	}
+	input := data.(map[string]interface{})
+	requestID := input["requestID"].(string)
+	for _, event := range []eventsourcing.Event{
+		&requestEvent{EventType: "orchestration_UserRequestReceived", RequestID: requestID, Text: input["requestText"].(string)},
+		&requestEvent{EventType: "orchestration_UserRequestReceived", RequestID: "other", Text: "unrelated"},
+		&requestEvent{EventType: "orchestration_RequestCompleted", RequestID: requestID, Text: "done"},
+	} {
+		if userID, _ := input["userID"].(string); event.(*requestEvent).RequestID == requestID {
+			event.Metadata().UserID = userID
+		}
+		if event.Type() == "orchestration_RequestCompleted" && p.answer != nil {
+			p.answer(requestID)
+		}
+		p.mu.Lock()
+		p.events = append(p.events, event)
+		p.mu.Unlock()
+		p.bus.Publish(event)
+	}
+	return nil
+}
+
+func (p *mockProcessor) GetEvents() []eventsourcing.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]eventsourcing.Event{}, p.events...)
+}
+
+func (p *mockProcessor) QueryEvents(q eventsourcing.EventQuery) ([]eventsourcing.Event, error) {
+	return eventsourcing.SelectEvents(p.GetEvents(), q), nil
+}
+
+type mockAggregate struct {
+	Name  string
+	Count int
+}
+
+func (m *mockAggregate) ID() string                                 { return m.Name }
+func (m *mockAggregate) ApplyEvent(event eventsourcing.Event) error { return nil }
+func (m *mockAggregate) GetCustomUI() fyne.CanvasObject             { return nil }
+
+type mockAggregates struct {
+	aggs []eventsourcing.Aggregate
+}
+
+func (m *mockAggregates) AllAggregates() []eventsourcing.Aggregate { return m.aggs }
+func (m *mockAggregates) AggregateByName(name string) (eventsourcing.Aggregate, error) {
+	for _, agg := range m.aggs {
+		if agg.ID() == name {
+			return agg, nil
+		}
+	}
+	return nil, fmt.Errorf("Unable to get aggregate by name")
+}
+
+func newTestServer() (*httptest.Server, *mockProcessor) {
+	bus := &mockBus{}
+	processor := &mockProcessor{bus: bus}
+	aggs := &mockAggregates{aggs: []eventsourcing.Aggregate{&mockAggregate{Name: "tasks", Count: 3}}}
+	s := NewServer(":0", processor, bus, aggs)
+	return httptest.NewServer(s.Handler()), processor
+}
+
+func TestSubmitRequest(t *testing.T) {
+	ts, processor := newTestServer()
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/api/requests", "application/json", strings.NewReader(`{"text":"hello"}`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", resp.StatusCode)
+	}
+	var body map[string]string
+	json.NewDecoder(resp.Body).Decode(&body)
+	if !strings.HasPrefix(body["request_id"], "http_req_") {
+		t.Errorf("Unexpected request ID: %q", body["request_id"])
+	}
+
+	// The command runs asynchronously
+	deadline := time.Now().Add(time.Second)
+	for len(processor.GetEvents()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(processor.GetEvents()) == 0 {
+		t.Error("Expected request to be processed")
+	}
+}
+
+func TestSubmitRequest_MissingText(t *testing.T) {
+	ts, _ := newTestServer()
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/api/requests", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestSubmitRequest_Stream(t *testing.T) {
+	ts, _ := newTestServer()
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/api/requests", "application/json", strings.NewReader(`{"text":"hello","stream":true}`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected event stream, got %q", ct)
+	}
+
+	var eventTypes []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "event: ") {
+			eventTypes = append(eventTypes, strings.TrimPrefix(line, "event: "))
+		}
+	}
+	expected := []string{"orchestration_UserRequestReceived", "orchestration_RequestCompleted"}
+	if strings.Join(eventTypes, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected streamed events %v, got %v", expected, eventTypes)
+	}
+}
+
+func TestSubmitRequest_StreamsAnswer(t *testing.T) {
+	bus := &mockBus{}
+	processor := &mockProcessor{bus: bus}
+	s := NewServer(":0", processor, bus, &mockAggregates{})
+	processor.answer = func(requestID string) {
+		s.HandleStreamingEvent(&eventsourcing.LLMStreamChunkEvent{RequestID: "other", PartialContent: "Unrelated"})
+		s.HandleStreamingEvent(&eventsourcing.LLMStreamChunkEvent{RequestID: requestID, PartialContent: "Hi there", IsFinal: true})
+	}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/api/requests", "application/json", strings.NewReader(`{"text":"hello","stream":true}`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var chunks []streamChunk
+	scanner := bufio.NewScanner(resp.Body)
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "event: ") {
+			event = strings.TrimPrefix(line, "event: ")
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok && event == "llm_stream" {
+			var c streamChunk
+			json.Unmarshal([]byte(data), &c)
+			chunks = append(chunks, c)
+		}
+	}
+	if len(chunks) != 1 || chunks[0].PartialContent != "Hi there" || !chunks[0].IsFinal {
+		t.Errorf("Expected only the final answer of the request, got %+v", chunks)
+	}
+}
+
+func TestConfirmToolCall(t *testing.T) {
+	ts, _ := newTestServer()
+	defer ts.Close()
+
+	for path, expected := range map[string]int{
+		"/api/toolcalls/call1/confirm": http.StatusAccepted,
+		"/api/toolcalls/call2/confirm": http.StatusConflict,
+	} {
+		resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(`{"approved":true}`))
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("%s: expected %d, got %d", path, expected, resp.StatusCode)
+		}
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	if network, address := ListenAddress("localhost:8080"); network != "tcp" || address != "localhost:8080" {
+		t.Errorf("Expected a TCP address, got %s %s", network, address)
+	}
+	if network, address := ListenAddress("unix:/tmp/mindpalace.sock"); network != "unix" || address != "/tmp/mindpalace.sock" {
+		t.Errorf("Expected a Unix socket, got %s %s", network, address)
+	}
+}
+
+func TestStart_UnixSocketUntilShutdown(t *testing.T) {
+	bus := &mockBus{}
+	socket := filepath.Join(t.TempDir(), "api.sock")
+	s := NewServer("unix:"+socket, &mockProcessor{bus: bus}, bus, &mockAggregates{})
+	started := make(chan error, 1)
+	go func() { started <- s.Start() }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	var resp *http.Response
+	var err error
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if resp, err = client.Get("http://mindpalace/api/aggregates"); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("Expected the API on the socket, got %v", err)
+	}
+	resp.Body.Close()
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if err := <-started; err != http.ErrServerClosed {
+		t.Errorf("Expected Start to return after the shutdown, got %v", err)
+	}
+}
+
+func TestCancelRequest(t *testing.T) {
+	ts, _ := newTestServer()
+	defer ts.Close()
+
+	for path, expected := range map[string]int{
+		"/api/requests/req1/cancel": http.StatusAccepted,
+		"/api/requests/req2/cancel": http.StatusConflict,
+	} {
+		resp, err := http.Post(ts.URL+path, "application/json", nil)
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("%s: expected %d, got %d", path, expected, resp.StatusCode)
+		}
+	}
+}
+
+func TestListEvents(t *testing.T) {
+	ts, processor := newTestServer()
+	defer ts.Close()
+	processor.ExecuteCommand("ProcessUserRequest", map[string]interface{}{"requestText": "hi", "requestID": "req1"})
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", 3},
+		{"?type=orchestration_RequestCompleted", 1},
+		{"?offset=1&limit=1", 1},
+		{"?offset=5", 0},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(ts.URL + "/api/events" + tt.query)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		var events []eventJSON
+		json.NewDecoder(resp.Body).Decode(&events)
+		resp.Body.Close()
+		if len(events) != tt.want {
+			t.Errorf("Query %q: expected %d events, got %d", tt.query, tt.want, len(events))
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/api/events?limit=-1")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid limit, got %d", resp.StatusCode)
+	}
+}
+
+func TestRequestEvents(t *testing.T) {
+	ts, processor := newTestServer()
+	defer ts.Close()
+	processor.ExecuteCommand("ProcessUserRequest", map[string]interface{}{"requestText": "hi", "requestID": "req1"})
+
+	resp, err := http.Get(ts.URL + "/api/requests/req1/events")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var events []eventJSON
+	json.NewDecoder(resp.Body).Decode(&events)
+	if len(events) != 2 {
+		t.Errorf("Expected 2 events for req1, got %d", len(events))
+	}
+}
+
+// redaction hides the content of a request
+type redaction struct{ requestID string }
+
+func (r redaction) Redact(userID string, data []byte) []byte {
+	return eventsourcing.Redaction{RequestID: r.requestID}.Apply(data)
+}
+
+func TestRequestEvents_Redacted(t *testing.T) {
+	bus := &mockBus{}
+	processor := &mockProcessor{bus: bus}
+	s := NewServer(":0", processor, bus, &mockAggregates{})
+	s.SetRedactor(redaction{requestID: "req1"})
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	processor.ExecuteCommand("ProcessUserRequest", map[string]interface{}{"requestText": "my PIN is 1234", "requestID": "req1"})
+
+	for _, path := range []string{"/api/requests/req1/events", "/api/events"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if strings.Contains(string(body), "1234") || !strings.Contains(string(body), `"request_id":"req1","text":"[redacted]"`) {
+			t.Errorf("%s: expected the request's content redacted, got %s", path, body)
+		}
+		if path == "/api/events" && !strings.Contains(string(body), "unrelated") {
+			t.Errorf("Expected the other request's content kept, got %s", body)
+		}
+	}
+}
+
+func TestAggregates(t *testing.T) {
+	ts, _ := newTestServer()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/aggregates")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	var ids []string
+	json.NewDecoder(resp.Body).Decode(&ids)
+	resp.Body.Close()
+	if len(ids) != 1 || ids[0] != "tasks" {
+		t.Errorf("Unexpected aggregate IDs: %v", ids)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/aggregates/tasks")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	var state mockAggregate
+	json.NewDecoder(resp.Body).Decode(&state)
+	resp.Body.Close()
+	if state.Count != 3 {
+		t.Errorf("Expected aggregate state with count 3, got %+v", state)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/aggregates/missing")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestAggregates_Redacted(t *testing.T) {
+	agg := orchestration.NewOrchestrationAggregate()
+	for _, event := range []eventsourcing.Event{
+		&orchestration.UserRequestReceivedEvent{EventType: "orchestration_UserRequestReceived", RequestID: "req1", RequestText: "Call 555-0134"},
+		&orchestration.ToolCallRequestPlaced{EventType: "orchestration_ToolCallRequestPlaced", RequestID: "req1", ToolCallID: "tool1", Function: "AddContact", Arguments: map[string]interface{}{"phone": "555-0134"}},
+		&orchestration.MessageRedactedEvent{EventType: "orchestration_MessageRedacted", Text: "555-0134"},
+	} {
+		if err := agg.ApplyEvent(event); err != nil {
+			t.Fatalf("ApplyEvent failed: %v", err)
+		}
+	}
+	s := NewServer(":0", &mockProcessor{}, &mockBus{}, &mockAggregates{aggs: []eventsourcing.Aggregate{agg}})
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/aggregates/orchestration")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || strings.Contains(string(body), "555-0134") || !strings.Contains(string(body), eventsourcing.Redacted) {
+		t.Errorf("Expected the state with the text scrubbed, got %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	bus := &mockBus{}
+	processor := &mockProcessor{bus: bus}
+	s := NewServer(":0", processor, bus, &mockAggregates{})
+	s.SetUsers(auth.NewUsers(map[string]string{"alice-token": "alice"}))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	processor.ExecuteCommand("ProcessUserRequest", map[string]interface{}{"requestText": "hi", "requestID": "req1"})
+
+	do := func(method, path, token, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		return resp
+	}
+
+	resp := do("GET", "/api/events", "", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without a token, got %d", resp.StatusCode)
+	}
+
+	resp = do("POST", "/api/requests", "alice-token", `{"text": "Add milk"}`)
+	var submitted map[string]string
+	json.NewDecoder(resp.Body).Decode(&submitted)
+	resp.Body.Close()
+
+	// Alice sees the events of their own request only, not those of the owner's req1
+	var events []eventJSON
+	for i := 0; i < 50 && len(events) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		resp = do("GET", "/api/events", "alice-token", "")
+		events = nil
+		json.NewDecoder(resp.Body).Decode(&events)
+		resp.Body.Close()
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected alice to see the 2 events of their request, got %d", len(events))
+	}
+	for _, event := range events {
+		if eventRequestID(event.Data) != submitted["request_id"] {
+			t.Errorf("Expected only alice's events, got %s", event.Data)
+		}
+	}
+}
+
+func TestAggregates_Member(t *testing.T) {
+	registry := pins.NewRegistry()
+	ownerFact := &pins.FactPinnedEvent{Fact: pins.Fact{PinID: "pin1", Text: "The owner's allergy"}}
+	aliceFact := &pins.FactPinnedEvent{Fact: pins.Fact{PinID: "pin2", Text: "Alice prefers tea"}}
+	aliceFact.Metadata().UserID = "alice"
+	for _, event := range []eventsourcing.Event{ownerFact, aliceFact} {
+		if err := registry.ApplyEvent(event); err != nil {
+			t.Fatalf("ApplyEvent failed: %v", err)
+		}
+	}
+	manager := aggregate.NewAggregateManager()
+	manager.RegisterAggregate("pins", registry)
+	manager.RegisterAggregate("orchestration", orchestration.NewOrchestrationAggregate())
+	s := NewServer(":0", &mockProcessor{}, &mockBus{}, manager)
+	s.SetUsers(auth.NewUsers(map[string]string{"alice-token": "alice"}))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", ts.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer alice-token")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	if code, body := get("/api/aggregates/pins"); code != http.StatusOK || !strings.Contains(body, "Alice prefers tea") || strings.Contains(body, "allergy") {
+		t.Errorf("Expected alice to see her own facts only, got %d %s", code, body)
+	}
+	// A shared aggregate without a view of each user's part is not shown to members
+	if code, _ := get("/api/aggregates/orchestration"); code != http.StatusNotFound {
+		t.Errorf("Expected the orchestration refused, got %d", code)
+	}
+	if code, body := get("/api/aggregates"); code != http.StatusOK || body != `["pins"]`+"\n" {
+		t.Errorf("Expected alice to see the pins only, got %d %s", code, body)
+	}
+}
+
+// mockTrail holds audit entries of the owner and of alice
+type mockTrail struct {
+	entries []audit.Entry
+}
+
+func (m *mockTrail) Entries(filter audit.Filter) []audit.Entry {
+	var entries []audit.Entry
+	for _, entry := range m.entries {
+		if filter.Matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (m *mockTrail) Entry(sequence int64) (audit.Entry, bool) {
+	for _, entry := range m.entries {
+		if entry.Sequence == sequence {
+			return entry, true
+		}
+	}
+	return audit.Entry{}, false
+}
+
+func TestAudit(t *testing.T) {
+	bus := &mockBus{}
+	s := NewServer(":0", &mockProcessor{bus: bus}, bus, &mockAggregates{})
+	s.SetAudit(&mockTrail{entries: []audit.Entry{
+		{Sequence: 2, EventType: "tasks_TaskCreated", Aggregate: "alice/tasks", UserID: "alice"},
+		{Sequence: 1, EventType: "tasks_TaskCreated", Aggregate: "tasks", Cause: audit.Cause{RequestID: "req1"}},
+	}})
+	s.SetUsers(auth.NewUsers(map[string]string{"alice-token": "alice", "owner-token-12345": ""}))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	get := func(path, token string, v interface{}) int {
+		t.Helper()
+		req, _ := http.NewRequest("GET", ts.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		json.NewDecoder(resp.Body).Decode(v)
+		return resp.StatusCode
+	}
+
+	var entries []audit.Entry
+	if get("/api/audit", "owner-token-12345", &entries); len(entries) != 2 {
+		t.Errorf("Expected the owner to see all changes, got %d", len(entries))
+	}
+	if get("/api/audit?request=req1", "owner-token-12345", &entries); len(entries) != 1 || entries[0].Sequence != 1 {
+		t.Errorf("Expected the change of req1, got %+v", entries)
+	}
+	if get("/api/audit", "alice-token", &entries); len(entries) != 1 || entries[0].UserID != "alice" {
+		t.Errorf("Expected alice to see their own change only, got %+v", entries)
+	}
+
+	var entry audit.Entry
+	if status := get("/api/audit/2", "alice-token", &entry); status != http.StatusOK || entry.Sequence != 2 {
+		t.Errorf("Expected alice's change, got %d: %+v", status, entry)
+	}
+	if status := get("/api/audit/1", "alice-token", &entry); status != http.StatusNotFound {
+		t.Errorf("Expected the owner's change to be hidden from alice, got %d", status)
+	}
+}
+
+func TestNotify_ForgetsEndedRequests(t *testing.T) {
+	s := NewServer(":0", &mockProcessor{}, &mockBus{}, &mockAggregates{})
+	chunks := s.addChunkListener()
+	defer s.removeChunkListener(chunks)
+	for _, requestID := range []string{"req1", "req2"} {
+		received := &orchestration.UserRequestReceivedEvent{EventType: "orchestration_UserRequestReceived", RequestID: requestID}
+		received.Metadata().UserID = "alice"
+		s.notify(received)
+	}
+
+	s.HandleStreamingEvent(&eventsourcing.LLMStreamChunkEvent{RequestID: "req1", PartialContent: "Adding"})
+	if c := <-chunks; c.userID != "alice" {
+		t.Errorf("Expected the chunk of alice's request, got %+v", c)
+	}
+	s.notify(&orchestration.RequestCompletedEvent{EventType: "orchestration_RequestCompleted", RequestID: "req1"})
+	s.notify(&orchestration.RequestCancelledEvent{EventType: "orchestration_RequestCancelled", RequestID: "req2"})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requestUsers) != 0 {
+		t.Errorf("Expected the ended requests forgotten, got %v", s.requestUsers)
+	}
+}
+
+func TestEventRequestID(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{`{"request_id":"a"}`, "a"},
+		{`{"RequestID":"b"}`, "b"},
+		{`{"other":"c"}`, ""},
+		{`not json`, ""},
+	}
+	for _, tt := range tests {
+		if got := eventRequestID([]byte(tt.data)); got != tt.want {
+			t.Errorf("eventRequestID(%s) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+type mockChat struct {
+	messages []chat.Message
+	query    chat.MessageQuery // Last search
+}
+
+func (m *mockChat) GetUIMessages() []chat.Message { return m.messages }
+func (m *mockChat) SearchMessages(query chat.MessageQuery) []chat.Message {
+	m.query = query
+	return m.messages[:1]
+}
+
+func newChatServer() (*httptest.Server, *Server, *mockBus, *mockProcessor) {
+	bus := &mockBus{}
+	processor := &mockProcessor{bus: bus}
+	s := NewServer(":0", processor, bus, &mockAggregates{})
+	s.SetChat(&mockChat{messages: []chat.Message{
+		{Role: chat.RoleUser, Content: "Plan <dinner>", Timestamp: time.Now()},
+		{Role: chat.RoleMindPalace, Content: "Added it", Timestamp: time.Now()},
+	}})
+	return httptest.NewServer(s.Handler()), s, bus, processor
+}
+
+func TestChatPage(t *testing.T) {
+	ts, _, _, _ := newChatServer()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	page := string(body)
+	for _, want := range []string{"You", "Plan &lt;dinner&gt;", "MindPalace", "Added it", `sse-connect="/chat/stream"`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("Expected page to contain %q", want)
+		}
+	}
+}
+
+func TestSearchChat(t *testing.T) {
+	history := &mockChat{messages: []chat.Message{{ID: "m1", Role: chat.RoleUser, Content: "Book the dentist", SessionID: "default"}}}
+	s := NewServer(":0", &mockProcessor{bus: &mockBus{}}, &mockBus{}, &mockAggregates{})
+	s.SetChat(history)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/chat/search?text=dentist&role=user&tag=health&from=2024-05-01&limit=5")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var found []foundMessage
+	if err := json.NewDecoder(resp.Body).Decode(&found); err != nil || len(found) != 1 || found[0].Content != "Book the dentist" || found[0].Role != "user" {
+		t.Errorf("Expected the found message, got %+v, %v", found, err)
+	}
+	query := history.query
+	if query.Text != "dentist" || query.Role != "user" || query.Tag != "health" || query.Limit != 5 || query.From.Format("2006-01-02") != "2024-05-01" {
+		t.Errorf("Expected the parameters in the query, got %+v", query)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/chat/search?from=someday")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected an invalid date refused, got %d", resp.StatusCode)
+	}
+}
+
+func TestChatMessage(t *testing.T) {
+	ts, _, _, processor := newChatServer()
+	defer ts.Close()
+
+	resp, err := http.PostForm(ts.URL+"/chat/messages", url.Values{"text": {"  "}})
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an empty message, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.PostForm(ts.URL+"/chat/messages", url.Values{"text": {"hello"}})
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", resp.StatusCode)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(processor.GetEvents()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	events := processor.GetEvents()
+	if len(events) == 0 || events[0].(*requestEvent).Text != "hello" {
+		t.Error("Expected the message to be processed as a request")
+	}
+}
+
+func TestChatStream(t *testing.T) {
+	ts, s, bus, _ := newChatServer()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/chat/stream")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected event stream, got %q", ct)
+	}
+
+	s.HandleStreamingEvent(&eventsourcing.LLMStreamChunkEvent{RequestID: "req1", PartialContent: "<think>hmm</think>Adding"})
+	bus.Publish(&requestEvent{EventType: "orchestration_RequestCompleted", RequestID: "req1"})
+
+	var received []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && len(received) < 2 {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "event: ") {
+			received = append(received, strings.TrimPrefix(line, "event: "))
+		}
+		if strings.Contains(line, "hmm") {
+			t.Error("Expected the thinking to be left out of the partial answer")
+		}
+	}
+	if strings.Join(received, ",") != "partial,messages" {
+		t.Errorf("Expected a partial answer and the messages, got %v", received)
+	}
+}
@@ -0,0 +1,164 @@
+// Package layout remembers where the user placed 3D objects, so the palace keeps its arrangement across restarts.
+package layout
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// NodeMovedEvent records that the user dragged a 3D node to a new position
+type NodeMovedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string    `json:"event_type"`
+	NodeID    string    `json:"node_id"`
+	Position  []float64 `json:"position"` // Relative to the node's parent, like the position Godot reports
+	Timestamp string    `json:"timestamp"`
+}
+
+func (e *NodeMovedEvent) Type() string { return "layout_NodeMoved" }
+func (e *NodeMovedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *NodeMovedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("layout_NodeMoved", func() eventsourcing.Event { return &NodeMovedEvent{} })
+}
+
+// NewNodeMovedEvent creates the event placing a node at the given position
+func NewNodeMovedEvent(nodeID string, position []float64) *NodeMovedEvent {
+	return &NodeMovedEvent{
+		NodeID:    nodeID,
+		Position:  position,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}
+}
+
+// LayoutAggregate keeps the position the user last gave each node, overriding where its plugin places it
+type LayoutAggregate struct {
+	Positions map[string][]float64
+	Mu        sync.RWMutex
+}
+
+// NewLayoutAggregate creates an empty LayoutAggregate
+func NewLayoutAggregate() *LayoutAggregate {
+	return &LayoutAggregate{Positions: make(map[string][]float64)}
+}
+
+// ID returns the aggregate's identifier
+func (a *LayoutAggregate) ID() string {
+	return "layout"
+}
+
+// ApplyEvent records the position of moved nodes
+func (a *LayoutAggregate) ApplyEvent(event eventsourcing.Event) error {
+	e, ok := event.(*NodeMovedEvent)
+	if !ok {
+		return nil
+	}
+	if len(e.Position) < 3 {
+		return fmt.Errorf("invalid position %v for node %s", e.Position, e.NodeID)
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	a.Positions[e.NodeID] = e.Position[:3]
+	return nil
+}
+
+// Position returns where the user placed the node, nil if it was never moved
+func (a *LayoutAggregate) Position(nodeID string) []float64 {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return a.Positions[nodeID]
+}
+
+// OverrideLayout places the created and updated nodes the user moved where they left them
+func (a *LayoutAggregate) OverrideLayout(actions []eventsourcing.DeltaAction) []eventsourcing.DeltaAction {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	if len(a.Positions) == 0 {
+		return actions
+	}
+	overridden := make([]eventsourcing.DeltaAction, len(actions))
+	for i, action := range actions {
+		overridden[i] = action
+		position, moved := a.Positions[action.NodeID]
+		if !moved || (action.Type != "create" && action.Type != "update") {
+			continue
+		}
+		// Copy the properties, the plugin may keep the map it built the action from
+		properties := make(map[string]interface{}, len(action.Properties)+1)
+		for key, value := range action.Properties {
+			properties[key] = value
+		}
+		properties["layout_position"] = position
+		overridden[i].Properties = properties
+	}
+	return overridden
+}
+
+// GetCustomUI lists the nodes placed by the user
+func (a *LayoutAggregate) GetCustomUI() fyne.CanvasObject {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	if len(a.Positions) == 0 {
+		return widget.NewLabel("No objects moved")
+	}
+	nodeIDs := make([]string, 0, len(a.Positions))
+	for nodeID := range a.Positions {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Strings(nodeIDs)
+	items := container.NewVBox()
+	for _, nodeID := range nodeIDs {
+		p := a.Positions[nodeID]
+		items.Add(widget.NewLabel(fmt.Sprintf("%s at (%.1f, %.1f, %.1f)", nodeID, p[0], p[1], p[2])))
+	}
+	return container.NewVScroll(items)
+}
+
+// Broadcast3DDelta moves the node on the other clients as well
+func (a *LayoutAggregate) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
+	e, ok := event.(*NodeMovedEvent)
+	if !ok {
+		return nil
+	}
+	return []eventsourcing.DeltaAction{{
+		Type:       "update",
+		NodeID:     e.NodeID,
+		Properties: map[string]interface{}{"layout_position": e.Position},
+	}}
+}
+
+// GetFull3DState returns nothing, the positions are applied to the objects of the other aggregates
+func (a *LayoutAggregate) GetFull3DState() []eventsourcing.DeltaAction {
+	return nil
+}
+
+// SaveSnapshot serializes the node positions
+func (a *LayoutAggregate) SaveSnapshot() ([]byte, error) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return json.Marshal(a.Positions)
+}
+
+// LoadSnapshot replaces the node positions with the snapshot
+func (a *LayoutAggregate) LoadSnapshot(data []byte) error {
+	positions := make(map[string][]float64)
+	if err := json.Unmarshal(data, &positions); err != nil {
+		return err
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	a.Positions = positions
+	return nil
+}
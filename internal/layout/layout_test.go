@@ -0,0 +1,76 @@
+package layout
+
+import (
+	"reflect"
+	"testing"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+func TestLayoutAggregate_RebuiltFromEvents(t *testing.T) {
+	agg := NewLayoutAggregate()
+	for _, position := range [][]float64{{1, 2, 3}, {4, 2, -1}} {
+		data, err := NewNodeMovedEvent("task_1", position).Marshal()
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		restored, err := eventsourcing.UnmarshalEvent(data)
+		if err != nil {
+			t.Fatalf("UnmarshalEvent failed: %v", err)
+		}
+		if err := agg.ApplyEvent(restored); err != nil {
+			t.Fatalf("ApplyEvent failed: %v", err)
+		}
+	}
+	if got := agg.Position("task_1"); !reflect.DeepEqual(got, []float64{4, 2, -1}) {
+		t.Errorf("Expected the last position, got %v", got)
+	}
+	if err := agg.ApplyEvent(NewNodeMovedEvent("task_2", []float64{1})); err == nil {
+		t.Error("Expected an incomplete position to be rejected")
+	}
+}
+
+func TestLayoutAggregate_OverrideLayout(t *testing.T) {
+	agg := NewLayoutAggregate()
+	agg.ApplyEvent(NewNodeMovedEvent("task_1", []float64{4, 2, -1}))
+
+	properties := map[string]interface{}{"mesh": "box", "position": []float64{6, 2, 0}}
+	actions := agg.OverrideLayout([]eventsourcing.DeltaAction{
+		{Type: "create", NodeID: "task_1", Properties: properties},
+		{Type: "create", NodeID: "task_1_label", Properties: map[string]interface{}{"text": "Task"}},
+		{Type: "delete", NodeID: "task_1"},
+	})
+
+	if got := actions[0].Properties["layout_position"]; !reflect.DeepEqual(got, []float64{4, 2, -1}) {
+		t.Errorf("Expected the moved node placed where the user left it, got %v", got)
+	}
+	if actions[0].Properties["mesh"] != "box" {
+		t.Error("Expected the other properties to be kept")
+	}
+	if _, ok := properties["layout_position"]; ok {
+		t.Error("Expected the properties of the plugin to be left alone")
+	}
+	if _, ok := actions[1].Properties["layout_position"]; ok {
+		t.Error("Expected nodes that were not moved to keep their place")
+	}
+	if actions[2].Properties != nil {
+		t.Error("Expected deletes to be left alone")
+	}
+}
+
+func TestLayoutAggregate_Snapshot(t *testing.T) {
+	agg := NewLayoutAggregate()
+	agg.ApplyEvent(NewNodeMovedEvent("calendar_event_e1", []float64{1, 2, 3}))
+	data, err := agg.SaveSnapshot()
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	restored := NewLayoutAggregate()
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if got := restored.Position("calendar_event_e1"); !reflect.DeepEqual(got, []float64{1, 2, 3}) {
+		t.Errorf("Expected the position restored, got %v", got)
+	}
+}
@@ -0,0 +1,94 @@
+// Package lifecycle shuts MindPalace down in order when it is stopped, by a signal from the service
+// manager or by closing the window.
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"mindpalace/pkg/logging"
+)
+
+// logger logs the shutdown
+var logger = logging.Named("lifecycle")
+
+// Hook stops a component. It should return once ctx is done, leaving what is left undone.
+type Hook func(ctx context.Context) error
+
+type namedHook struct {
+	name string
+	stop Hook
+}
+
+// Manager runs the shutdown hooks of the components once, the last registered first, like defer
+type Manager struct {
+	timeout time.Duration
+	mu      sync.Mutex
+	hooks   []namedHook
+	once    sync.Once
+	done    chan struct{}
+}
+
+// NewManager creates a manager giving the hooks together timeout to stop
+func NewManager(timeout time.Duration) *Manager {
+	return &Manager{timeout: timeout, done: make(chan struct{})}
+}
+
+// OnShutdown registers a hook stopping a component. Hooks run in the reverse order they were
+// registered in, so a component started after another one is stopped before it.
+func (m *Manager) OnShutdown(name string, stop Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, namedHook{name: name, stop: stop})
+}
+
+// Shutdown runs the hooks, all of them even when the timeout passed or a hook failed. Calls after
+// the first wait for it to finish.
+func (m *Manager) Shutdown(reason string) {
+	m.once.Do(func() {
+		logger.Info("Shutting down: %s", reason)
+		ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+		defer cancel()
+
+		m.mu.Lock()
+		hooks := append([]namedHook{}, m.hooks...)
+		m.mu.Unlock()
+		for i := len(hooks) - 1; i >= 0; i-- {
+			start := time.Now()
+			if err := hooks[i].stop(ctx); err != nil {
+				logger.Error("Failed to stop %s: %v", hooks[i].name, err)
+				continue
+			}
+			logger.Debug("Stopped %s in %s", hooks[i].name, time.Since(start).Round(time.Millisecond))
+		}
+		logger.Info("Shutdown complete")
+		close(m.done)
+	})
+}
+
+// Done is closed once the shutdown completed
+func (m *Manager) Done() <-chan struct{} {
+	return m.done
+}
+
+// HandleSignals shuts down on SIGINT or SIGTERM. A second signal exits right away, for when a
+// component hangs.
+func (m *Manager) HandleSignals() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		go m.Shutdown("received " + sig.String())
+		select {
+		case sig = <-signals:
+			logger.Error("Received %s during shutdown, exiting", sig)
+			os.Exit(1)
+		case <-m.done:
+			signal.Stop(signals)
+		}
+	}()
+}
@@ -0,0 +1,62 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShutdown_RunsHooksInReverseOnce(t *testing.T) {
+	m := NewManager(time.Second)
+	var stopped []string
+	for _, name := range []string{"store", "audio", "api"} {
+		name := name
+		m.OnShutdown(name, func(ctx context.Context) error {
+			stopped = append(stopped, name)
+			if name == "audio" {
+				return errors.New("device busy")
+			}
+			return nil
+		})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Shutdown("test")
+		}()
+	}
+	wg.Wait()
+
+	if got := strings.Join(stopped, ","); got != "api,audio,store" {
+		t.Errorf("Expected the hooks to run once in reverse, got %s", got)
+	}
+	select {
+	case <-m.Done():
+	default:
+		t.Error("Expected Done to be closed after the shutdown")
+	}
+}
+
+func TestShutdown_RunsAllHooksAfterTimeout(t *testing.T) {
+	m := NewManager(20 * time.Millisecond)
+	storeClosed := false
+	m.OnShutdown("store", func(ctx context.Context) error {
+		storeClosed = ctx.Err() != nil
+		return nil
+	})
+	m.OnShutdown("requests", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	m.Shutdown("test")
+	if !storeClosed {
+		t.Error("Expected the store to be closed after the requests used up the timeout")
+	}
+}
@@ -0,0 +1,358 @@
+// Package links relates the items of different plugins to each other, e.g. the task "prepare slides"
+// to Friday's meeting. The items stay in their plugins, the links between them are kept here per user.
+// Plugins show the links as badges on their items, and the LLM finds the items related to one.
+package links
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/ui3d"
+)
+
+// ItemsLinkedEvent records that two items are related
+type ItemsLinkedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string             `json:"event_type"`
+	From      eventsourcing.Item `json:"from"`
+	To        eventsourcing.Item `json:"to"`
+	Timestamp string             `json:"timestamp"`
+}
+
+func (e *ItemsLinkedEvent) Type() string { return "links_ItemsLinked" }
+func (e *ItemsLinkedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ItemsLinkedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ItemsUnlinkedEvent records that two items are no longer related
+type ItemsUnlinkedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string             `json:"event_type"`
+	From      eventsourcing.Item `json:"from"`
+	To        eventsourcing.Item `json:"to"`
+	Timestamp string             `json:"timestamp"`
+}
+
+func (e *ItemsUnlinkedEvent) Type() string { return "links_ItemsUnlinked" }
+func (e *ItemsUnlinkedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ItemsUnlinkedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// RelatedItemsListedEvent answers a RelatedItems command with the items linked to an item
+type RelatedItemsListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string               `json:"event_type"`
+	Item      eventsourcing.Item   `json:"item"`
+	Related   []eventsourcing.Item `json:"related"`
+}
+
+func (e *RelatedItemsListedEvent) Type() string { return "links_RelatedItemsListed" }
+func (e *RelatedItemsListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *RelatedItemsListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("links_ItemsLinked", func() eventsourcing.Event { return &ItemsLinkedEvent{} })
+	eventsourcing.RegisterEvent("links_ItemsUnlinked", func() eventsourcing.Event { return &ItemsUnlinkedEvent{} })
+	eventsourcing.RegisterEvent("links_RelatedItemsListed", func() eventsourcing.Event { return &RelatedItemsListedEvent{} })
+	eventsourcing.RegisterTransientEvent("links_RelatedItemsListed")
+}
+
+// Link relates two items, the way round they were linked
+type Link struct {
+	From eventsourcing.Item `json:"from"`
+	To   eventsourcing.Item `json:"to"`
+}
+
+// connects reports whether the link is between the two items, either way round
+func (l Link) connects(a, b eventsourcing.Item) bool {
+	return (same(l.From, a) && same(l.To, b)) || (same(l.From, b) && same(l.To, a))
+}
+
+// other returns the item the link relates the item to, false if the link is not the item's
+func (l Link) other(item eventsourcing.Item) (eventsourcing.Item, bool) {
+	switch {
+	case same(l.From, item):
+		return l.To, true
+	case same(l.To, item):
+		return l.From, true
+	}
+	return eventsourcing.Item{}, false
+}
+
+// same reports whether two items are the same item of the same aggregate
+func same(a, b eventsourcing.Item) bool {
+	return a.Aggregate == b.Aggregate && a.ID == b.ID
+}
+
+// Registry is the aggregate of the links between the items of each user. The items themselves are those
+// of the aggregates implementing eventsourcing.ItemIndex; a link keeps the item as it was when linked.
+type Registry struct {
+	Links      map[string][]Link // User -> links, in the order they were made
+	aggregates eventsourcing.UserAggregateStore
+	Mu         sync.RWMutex
+}
+
+// NewRegistry creates a registry finding the linked items in the aggregates of the store
+func NewRegistry(aggregates eventsourcing.UserAggregateStore) *Registry {
+	return &Registry{
+		Links:      make(map[string][]Link),
+		aggregates: aggregates,
+	}
+}
+
+// ID returns the aggregate's identifier
+func (r *Registry) ID() string {
+	return "links"
+}
+
+// ApplyEvent adds and removes the links of the event's user
+func (r *Registry) ApplyEvent(event eventsourcing.Event) error {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	userID := event.Metadata().UserID
+	switch e := event.(type) {
+	case *ItemsLinkedEvent:
+		for _, link := range r.Links[userID] {
+			if link.connects(e.From, e.To) {
+				return nil
+			}
+		}
+		r.Links[userID] = append(r.Links[userID], Link{From: e.From, To: e.To})
+	case *ItemsUnlinkedEvent:
+		kept := r.Links[userID][:0]
+		for _, link := range r.Links[userID] {
+			if !link.connects(e.From, e.To) {
+				kept = append(kept, link)
+			}
+		}
+		r.Links[userID] = kept
+	}
+	return nil
+}
+
+// Compensate returns the event undoing a link or unlink
+func (r *Registry) Compensate(event eventsourcing.Event) ([]eventsourcing.Event, error) {
+	switch e := event.(type) {
+	case *ItemsLinkedEvent:
+		return []eventsourcing.Event{&ItemsUnlinkedEvent{From: e.From, To: e.To, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+	case *ItemsUnlinkedEvent:
+		return []eventsourcing.Event{&ItemsLinkedEvent{From: e.From, To: e.To, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+	}
+	return nil, nil
+}
+
+// linked returns the items linked to the item as they were when linked
+func (r *Registry) linked(userID string, item eventsourcing.Item) []eventsourcing.Item {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	var linked []eventsourcing.Item
+	for _, link := range r.Links[userID] {
+		if other, ok := link.other(item); ok {
+			linked = append(linked, other)
+		}
+	}
+	return linked
+}
+
+// find returns the item of an aggregate the user sees, as it is now. The registry's lock is not held, as
+// the aggregate takes its own.
+func (r *Registry) find(userID, aggregate, id string) (eventsourcing.Item, bool) {
+	for _, agg := range r.aggregates.AggregatesOf(userID) {
+		if agg.ID() != aggregate {
+			continue
+		}
+		if index, ok := agg.(eventsourcing.ItemIndex); ok {
+			item, exists := index.Item(id)
+			item.Aggregate = aggregate
+			return item, exists
+		}
+	}
+	return eventsourcing.Item{}, false
+}
+
+// RelatedItems returns the items linked to an item as they are now, leaving out those deleted since
+func (r *Registry) RelatedItems(userID, aggregate, id string) []eventsourcing.Item {
+	related := []eventsourcing.Item{}
+	for _, linked := range r.linked(userID, eventsourcing.Item{Aggregate: aggregate, ID: id}) {
+		if item, exists := r.find(userID, linked.Aggregate, linked.ID); exists {
+			related = append(related, item)
+		}
+	}
+	return related
+}
+
+// userLinks finds the links of one user
+type userLinks struct {
+	registry *Registry
+	userID   string
+}
+
+// SourceFor returns the links of the user, for the user's plugin instances
+func (r *Registry) SourceFor(userID string) eventsourcing.LinkSource {
+	return userLinks{registry: r, userID: userID}
+}
+
+// LinkedItems returns the items linked to the item as they were when linked. Plugins call it holding
+// their own lock, so other aggregates are not asked for the items as they are now.
+func (u userLinks) LinkedItems(aggregate, id string) []eventsourcing.Item {
+	return u.registry.linked(u.userID, eventsourcing.Item{Aggregate: aggregate, ID: id})
+}
+
+// items returns the two items a link command names, as they are now
+func (r *Registry) items(data map[string]interface{}) (eventsourcing.Item, eventsourcing.Item, error) {
+	userID := eventsourcing.UserOf(data)
+	var items [2]eventsourcing.Item
+	for i, end := range []string{"from", "to"} {
+		aggregate, _ := data[end+"_aggregate"].(string)
+		id, _ := data[end+"_id"].(string)
+		if aggregate == "" || id == "" {
+			return items[0], items[1], fmt.Errorf("%s_aggregate and %s_id are required", end, end)
+		}
+		item, exists := r.find(userID, aggregate, id)
+		if !exists {
+			return items[0], items[1], fmt.Errorf("%s has no item %s", aggregate, id)
+		}
+		items[i] = item
+	}
+	if same(items[0], items[1]) {
+		return items[0], items[1], fmt.Errorf("an item cannot be linked to itself")
+	}
+	return items[0], items[1], nil
+}
+
+// isLinked reports whether the user linked the two items
+func (r *Registry) isLinked(userID string, a, b eventsourcing.Item) bool {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	for _, link := range r.Links[userID] {
+		if link.connects(a, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// LinkItemsCommand relates two items, e.g. {"from_aggregate": "taskmanager", "from_id": "task_1",
+// "to_aggregate": "calendar", "to_id": "event_2"}
+func (r *Registry) LinkItemsCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	from, to, err := r.items(data)
+	if err != nil {
+		return nil, err
+	}
+	if r.isLinked(eventsourcing.UserOf(data), from, to) {
+		return nil, fmt.Errorf("%q and %q are linked already", from.Title, to.Title)
+	}
+	return []eventsourcing.Event{&ItemsLinkedEvent{From: from, To: to, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+}
+
+// UnlinkItemsCommand removes the link between two items, named as for LinkItems
+func (r *Registry) UnlinkItemsCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	from, to, err := r.items(data)
+	if err != nil {
+		return nil, err
+	}
+	if !r.isLinked(eventsourcing.UserOf(data), from, to) {
+		return nil, fmt.Errorf("%q and %q are not linked", from.Title, to.Title)
+	}
+	return []eventsourcing.Event{&ItemsUnlinkedEvent{From: from, To: to, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+}
+
+// RelatedItemsCommand lists the items linked to an item, e.g. {"aggregate": "calendar", "id": "event_2"}
+func (r *Registry) RelatedItemsCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	aggregate, _ := data["aggregate"].(string)
+	id, _ := data["id"].(string)
+	userID := eventsourcing.UserOf(data)
+	item, exists := r.find(userID, aggregate, id)
+	if !exists {
+		return nil, fmt.Errorf("%s has no item %s", aggregate, id)
+	}
+	return []eventsourcing.Event{&RelatedItemsListedEvent{Item: item, Related: r.RelatedItems(userID, aggregate, id)}}, nil
+}
+
+// Broadcast3DDelta updates the badges on the labels of two items linked or unlinked. The items are asked
+// for their titles, so the labels keep the titles they have now.
+func (r *Registry) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
+	var ends []eventsourcing.Item
+	switch e := event.(type) {
+	case *ItemsLinkedEvent:
+		ends = []eventsourcing.Item{e.From, e.To}
+	case *ItemsUnlinkedEvent:
+		ends = []eventsourcing.Item{e.From, e.To}
+	default:
+		return nil
+	}
+	userID := event.Metadata().UserID
+	var actions []eventsourcing.DeltaAction
+	for _, end := range ends {
+		if action, ok := r.badgeAction(userID, end); ok {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// GetFull3DState adds nothing, the plugins show the badges on the labels of their items themselves
+func (r *Registry) GetFull3DState() []eventsourcing.DeltaAction {
+	return nil
+}
+
+// badgeAction returns the update of the label of an item showing its title and the items linked to it,
+// false if the item is gone or not in the 3D world
+func (r *Registry) badgeAction(userID string, end eventsourcing.Item) (eventsourcing.DeltaAction, bool) {
+	item, exists := r.find(userID, end.Aggregate, end.ID)
+	if !exists || item.NodeID == "" {
+		return eventsourcing.DeltaAction{}, false
+	}
+	return eventsourcing.DeltaAction{
+		Type:       "update",
+		NodeID:     item.NodeID + "_label",
+		Properties: map[string]interface{}{"text": ui3d.LinkBadge(item.Title, len(r.linked(userID, item)))},
+	}, true
+}
+
+// GetCustomUI lists the owner's links
+func (r *Registry) GetCustomUI() fyne.CanvasObject {
+	r.Mu.RLock()
+	links := append([]Link(nil), r.Links[""]...)
+	r.Mu.RUnlock()
+	if len(links) == 0 {
+		return widget.NewLabel("No linked items yet")
+	}
+	items := container.NewVBox()
+	for _, link := range links {
+		items.Add(widget.NewLabel(fmt.Sprintf("%s: %s  ↔  %s: %s", link.From.Aggregate, link.From.Title, link.To.Aggregate, link.To.Title)))
+	}
+	return container.NewVScroll(items)
+}
+
+// SaveSnapshot serializes the links
+func (r *Registry) SaveSnapshot() ([]byte, error) {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	return json.Marshal(r.Links)
+}
+
+// LoadSnapshot replaces the links with the snapshot
+func (r *Registry) LoadSnapshot(data []byte) error {
+	links := make(map[string][]Link)
+	if err := json.Unmarshal(data, &links); err != nil {
+		return err
+	}
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	r.Links = links
+	return nil
+}
@@ -0,0 +1,164 @@
+package links
+
+import (
+	"strings"
+	"testing"
+
+	"fyne.io/fyne/v2"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/eventsourcing/eventsourcingtest"
+)
+
+// itemAggregate holds items by ID
+type itemAggregate struct {
+	id    string
+	items map[string]eventsourcing.Item
+}
+
+func (a *itemAggregate) ID() string                                 { return a.id }
+func (a *itemAggregate) ApplyEvent(event eventsourcing.Event) error { return nil }
+func (a *itemAggregate) GetCustomUI() fyne.CanvasObject             { return nil }
+func (a *itemAggregate) Item(id string) (eventsourcing.Item, bool) {
+	item, ok := a.items[id]
+	return item, ok
+}
+
+// userAggregates gives every user their own aggregates
+type userAggregates struct {
+	own map[string][]eventsourcing.Aggregate
+}
+
+func (u *userAggregates) AggregatesOf(userID string) []eventsourcing.Aggregate { return u.own[userID] }
+func (u *userAggregates) UserAggregates(userID string) []eventsourcing.Aggregate {
+	return u.own[userID]
+}
+func (u *userAggregates) Users() []string { return nil }
+
+func newTestRegistry() (*Registry, *itemAggregate) {
+	tasks := &itemAggregate{id: "taskmanager", items: map[string]eventsourcing.Item{
+		"t1": {ID: "t1", Title: "Prepare slides", NodeID: "t1"},
+		"t2": {ID: "t2", Title: "Book room", NodeID: "t2"},
+	}}
+	calendar := &itemAggregate{id: "calendar", items: map[string]eventsourcing.Item{
+		"e1": {ID: "e1", Title: "Friday meeting", NodeID: "calendar_event_e1"},
+	}}
+	return NewRegistry(&userAggregates{own: map[string][]eventsourcing.Aggregate{
+		"":      {tasks, calendar},
+		"alice": {&itemAggregate{id: "taskmanager", items: map[string]eventsourcing.Item{"t3": {ID: "t3", Title: "Run"}}}},
+	}}), tasks
+}
+
+func link(from, fromID, to, toID string) map[string]interface{} {
+	return map[string]interface{}{"from_aggregate": from, "from_id": fromID, "to_aggregate": to, "to_id": toID}
+}
+
+func titles(items []eventsourcing.Item) string {
+	var titles []string
+	for _, item := range items {
+		titles = append(titles, item.Title)
+	}
+	return strings.Join(titles, ", ")
+}
+
+func TestRegistry_LinkAndRelatedItems(t *testing.T) {
+	r, tasks := newTestRegistry()
+	eventsourcingtest.Execute(t, r, "", r.LinkItemsCommand, link("taskmanager", "t1", "calendar", "e1"))
+	eventsourcingtest.Execute(t, r, "", r.LinkItemsCommand, link("taskmanager", "t2", "calendar", "e1"))
+
+	if got := titles(r.RelatedItems("", "calendar", "e1")); got != "Prepare slides, Book room" {
+		t.Errorf("Expected both tasks related to the meeting, got %q", got)
+	}
+	if got := titles(r.RelatedItems("", "taskmanager", "t1")); got != "Friday meeting" {
+		t.Errorf("Expected the meeting related to the task, got %q", got)
+	}
+	if got := titles(r.SourceFor("").LinkedItems("calendar", "e1")); got != "Prepare slides, Book room" {
+		t.Errorf("Expected the link source to list both tasks, got %q", got)
+	}
+	if got := r.RelatedItems("alice", "calendar", "e1"); len(got) != 0 {
+		t.Errorf("Expected another user's links to stay apart, got %v", got)
+	}
+
+	// Linked either way round, or to itself, or to a missing item are errors
+	for name, data := range map[string]map[string]interface{}{
+		"again":   link("calendar", "e1", "taskmanager", "t1"),
+		"itself":  link("taskmanager", "t1", "taskmanager", "t1"),
+		"missing": link("taskmanager", "t1", "calendar", "e9"),
+		"partial": {"from_aggregate": "taskmanager", "from_id": "t1"},
+	} {
+		data["userID"] = ""
+		if _, err := r.LinkItemsCommand(data); err == nil {
+			t.Errorf("Expected linking %s to fail", name)
+		}
+	}
+
+	// A deleted item is left out of the related items, the link source keeps it as linked
+	delete(tasks.items, "t2")
+	if got := titles(r.RelatedItems("", "calendar", "e1")); got != "Prepare slides" {
+		t.Errorf("Expected the deleted task left out, got %q", got)
+	}
+
+	events := eventsourcingtest.Execute(t, r, "", r.RelatedItemsCommand, map[string]interface{}{"aggregate": "taskmanager", "id": "t1"})
+	listed, ok := events[0].(*RelatedItemsListedEvent)
+	if !ok || listed.Item.Title != "Prepare slides" || titles(listed.Related) != "Friday meeting" {
+		t.Errorf("Expected the meeting listed for the task, got %+v", events[0])
+	}
+}
+
+func TestRegistry_UnlinkAndCompensate(t *testing.T) {
+	r, _ := newTestRegistry()
+	linked := eventsourcingtest.Execute(t, r, "", r.LinkItemsCommand, link("taskmanager", "t1", "calendar", "e1"))
+
+	if _, err := r.UnlinkItemsCommand(map[string]interface{}{"from_aggregate": "taskmanager", "from_id": "t2", "to_aggregate": "calendar", "to_id": "e1"}); err == nil {
+		t.Error("Expected unlinking items that aren't linked to fail")
+	}
+	eventsourcingtest.Execute(t, r, "", r.UnlinkItemsCommand, link("calendar", "e1", "taskmanager", "t1"))
+	if got := r.RelatedItems("", "calendar", "e1"); len(got) != 0 {
+		t.Errorf("Expected no related items after unlinking, got %v", got)
+	}
+
+	// Undoing the link after it was removed links the items again
+	undo, err := r.Compensate(linked[0])
+	if err != nil || len(undo) != 1 {
+		t.Fatalf("Expected one compensating event, got %v, %v", undo, err)
+	}
+	redo, _ := r.Compensate(undo[0])
+	if err := r.ApplyEvent(redo[0]); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+	if got := titles(r.RelatedItems("", "taskmanager", "t1")); got != "Friday meeting" {
+		t.Errorf("Expected the items linked again, got %q", got)
+	}
+}
+
+func TestRegistry_Broadcast3DDelta(t *testing.T) {
+	r, _ := newTestRegistry()
+	events := eventsourcingtest.Execute(t, r, "", r.LinkItemsCommand, link("taskmanager", "t1", "calendar", "e1"))
+
+	actions := r.Broadcast3DDelta(events[0])
+	if len(actions) != 2 {
+		t.Fatalf("Expected the labels of both items updated, got %v", actions)
+	}
+	if actions[0].NodeID != "t1_label" || actions[0].Properties["text"] != "Prepare slides  ↔1" {
+		t.Errorf("Expected the task's label with a badge, got %+v", actions[0])
+	}
+	if actions[1].NodeID != "calendar_event_e1_label" || actions[1].Properties["text"] != "Friday meeting  ↔1" {
+		t.Errorf("Expected the event's label with a badge, got %+v", actions[1])
+	}
+}
+
+func TestRegistry_Snapshot(t *testing.T) {
+	r, _ := newTestRegistry()
+	eventsourcingtest.Execute(t, r, "", r.LinkItemsCommand, link("taskmanager", "t1", "calendar", "e1"))
+	data, err := r.SaveSnapshot()
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	restored, _ := newTestRegistry()
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if got := titles(restored.SourceFor("").LinkedItems("taskmanager", "t1")); got != "Friday meeting" {
+		t.Errorf("Expected the link restored, got %q", got)
+	}
+}
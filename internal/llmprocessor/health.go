@@ -0,0 +1,263 @@
+package llmprocessor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Statuses of the LLM reported by StatusChangedEvent
+const (
+	StatusOnline   = "online"   // The endpoint answers the calls
+	StatusFallback = "fallback" // The endpoint is down, the fallback answers the calls
+	StatusOffline  = "offline"  // No endpoint answers, the calls fail
+)
+
+const (
+	defaultHealthInterval = 30 * time.Second
+	healthTimeout         = 5 * time.Second // Time an endpoint has to answer a health check
+)
+
+// StatusChangedEvent is emitted when the LLM goes offline, fails over to the fallback or is back online
+type StatusChangedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Status    string `json:"status"`             // StatusOnline, StatusFallback or StatusOffline
+	Endpoint  string `json:"endpoint,omitempty"` // Server answering the calls, empty when offline
+	Message   string `json:"message"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *StatusChangedEvent) Type() string { return "llmprocessor_StatusChanged" }
+func (e *StatusChangedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *StatusChangedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("llmprocessor_StatusChanged", func() eventsourcing.Event { return &StatusChangedEvent{} })
+	// The status is checked again after a restart, an outage of the past says nothing about now
+	eventsourcing.RegisterTransientEvent("llmprocessor_StatusChanged")
+}
+
+// unreachableError is returned when an endpoint can't be connected to, as opposed to one that answers with an error
+type unreachableError struct {
+	endpoint string
+	err      error
+}
+
+func (e *unreachableError) Error() string {
+	return fmt.Sprintf("failed to call Ollama API at %s: %v", e.endpoint, e.err)
+}
+func (e *unreachableError) Unwrap() error { return e.err }
+
+// health tracks which endpoints are reachable; guarded by the client's mutex
+type health struct {
+	interval     time.Duration
+	primaryDown  bool
+	fallbackDown bool
+	status       string // Last status reported, StatusOnline until an endpoint is found down
+	onChange     func(*StatusChangedEvent)
+	stop         chan struct{}
+}
+
+// target is an endpoint a call can go to, with the model it is made with
+type target struct {
+	endpoint string
+	model    string
+}
+
+// SetFallback sets the chat endpoint the calls fail over to while the endpoint is unreachable, and the model
+// they are made with there; an empty endpoint disables the failover, an empty model keeps the model of the call
+func (c *LLMClient) SetFallback(endpoint, model string) {
+	c.update(func() {
+		if endpoint != c.fallbackEndpoint {
+			c.health.fallbackDown = false
+		}
+		c.fallbackEndpoint = endpoint
+		c.fallbackModel = model
+	})
+}
+
+// SetHealthInterval changes how often the health checks probe the endpoints
+func (c *LLMClient) SetHealthInterval(interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.health.interval = interval
+}
+
+// OnStatusChange calls handle whenever the LLM goes offline, fails over or is back online
+func (c *LLMClient) OnStatusChange(handle func(*StatusChangedEvent)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.health.onChange = handle
+}
+
+// Status returns the current status of the LLM, one of StatusOnline, StatusFallback and StatusOffline
+func (c *LLMClient) Status() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.currentStatus()
+}
+
+// StartHealthChecks probes the endpoints now and then every health interval until StopHealthChecks is called
+func (c *LLMClient) StartHealthChecks() {
+	stop := make(chan struct{})
+	c.mu.Lock()
+	c.health.stop = stop
+	c.mu.Unlock()
+	go func() {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+			c.CheckHealth(ctx)
+			cancel()
+			c.mu.RLock()
+			interval := c.health.interval
+			c.mu.RUnlock()
+			select {
+			case <-stop:
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// StopHealthChecks ends the periodic health checks
+func (c *LLMClient) StopHealthChecks() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.health.stop != nil {
+		close(c.health.stop)
+		c.health.stop = nil
+	}
+}
+
+// CheckHealth probes the endpoint and the fallback, updating the status
+func (c *LLMClient) CheckHealth(ctx context.Context) {
+	c.mu.RLock()
+	endpoints := []string{c.endpoint}
+	if c.fallbackEndpoint != "" {
+		endpoints = append(endpoints, c.fallbackEndpoint)
+	}
+	c.mu.RUnlock()
+	for _, endpoint := range endpoints {
+		err := probe(ctx, endpoint)
+		if err != nil {
+			logger.Debug("Health check of %s failed: %v", endpoint, err)
+		}
+		c.reachable(endpoint, err == nil)
+	}
+}
+
+// probe asks the Ollama server of the chat endpoint for its version
+func probe(ctx context.Context, endpoint string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverOf(endpoint)+"/api/version", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// serverOf returns the base URL of the Ollama server of a chat endpoint
+func serverOf(endpoint string) string {
+	return strings.TrimSuffix(endpoint, "/api/chat")
+}
+
+// targets returns where a call with the model goes, in the order to try them: the endpoint and then the
+// fallback, or the fallback first while the endpoint is down
+func (c *LLMClient) targets(model string) []target {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	primary := target{endpoint: c.endpoint, model: model}
+	if c.fallbackEndpoint == "" {
+		return []target{primary}
+	}
+	fallback := target{endpoint: c.fallbackEndpoint, model: model}
+	if c.fallbackModel != "" {
+		fallback.model = c.fallbackModel
+	}
+	if c.health.primaryDown {
+		return []target{fallback, primary}
+	}
+	return []target{primary, fallback}
+}
+
+// reachable records whether the endpoint could be reached
+func (c *LLMClient) reachable(endpoint string, up bool) {
+	c.update(func() {
+		if endpoint == c.endpoint {
+			c.health.primaryDown = !up
+		} else if endpoint == c.fallbackEndpoint {
+			c.health.fallbackDown = !up
+		}
+	})
+}
+
+// update changes the client's state and reports the status if that changed it; the handler is called
+// without holding the lock
+func (c *LLMClient) update(change func()) {
+	c.mu.Lock()
+	change()
+	status := c.currentStatus()
+	if status == c.health.status {
+		c.mu.Unlock()
+		return
+	}
+	c.health.status = status
+	event := &StatusChangedEvent{
+		EventType: "llmprocessor_StatusChanged",
+		Status:    status,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}
+	primary, fallback := serverOf(c.endpoint), serverOf(c.fallbackEndpoint)
+	switch status {
+	case StatusOnline:
+		event.Endpoint = primary
+		event.Message = fmt.Sprintf("The LLM at %s is online", primary)
+	case StatusFallback:
+		event.Endpoint = fallback
+		event.Message = fmt.Sprintf("The LLM at %s is offline, using the fallback at %s", primary, fallback)
+	default:
+		event.Message = fmt.Sprintf("The LLM at %s is offline, requests fail until it is back", primary)
+		if c.fallbackEndpoint != "" {
+			event.Message = fmt.Sprintf("The LLM at %s and the fallback at %s are offline, requests fail until one is back", primary, fallback)
+		}
+	}
+	handle := c.health.onChange
+	c.mu.Unlock()
+	if status == StatusOnline {
+		logger.Info("%s", event.Message)
+	} else {
+		logger.Error("%s", event.Message)
+	}
+	if handle != nil {
+		handle(event)
+	}
+}
+
+// currentStatus derives the status from the reachable endpoints; c.mu must be held
+func (c *LLMClient) currentStatus() string {
+	switch {
+	case !c.health.primaryDown:
+		return StatusOnline
+	case c.fallbackEndpoint != "" && !c.health.fallbackDown:
+		return StatusFallback
+	default:
+		return StatusOffline
+	}
+}
@@ -0,0 +1,110 @@
+package llmprocessor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"mindpalace/pkg/llmmodels"
+)
+
+// ollamaServer answers health checks and chat calls with the model the call was made with
+func ollamaServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/version" {
+			fmt.Fprintln(w, `{"version": "0.6.0"}`)
+			return
+		}
+		var request llmmodels.OllamaRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		fmt.Fprintf(w, `{"message": {"content": "answered by %s"}, "done": true}`+"\n", request.Model)
+	}))
+}
+
+func TestLLMClient_FailsOverToTheFallback(t *testing.T) {
+	primary, fallback := ollamaServer(), ollamaServer()
+	defer fallback.Close()
+	client := NewLLMClient()
+	client.Configure(primary.URL+"/api/chat", "qwen3:8b", 4096)
+	client.SetFallback(fallback.URL+"/api/chat", "llama3.2:3b")
+	var statuses []*StatusChangedEvent
+	client.OnStatusChange(func(e *StatusChangedEvent) { statuses = append(statuses, e) })
+
+	resp, err := client.CallLLM(context.Background(), nil, nil, "req1", "")
+	if err != nil || resp.Message.Content != "answered by qwen3:8b" || len(statuses) != 0 {
+		t.Fatalf("Expected the endpoint to answer, got %+v, %v, %v", resp, err, statuses)
+	}
+
+	// The endpoint going down fails the call over, and the next calls go to the fallback directly
+	primary.Close()
+	for _, requestID := range []string{"req2", "req3"} {
+		resp, err = client.CallLLM(context.Background(), nil, nil, requestID, "")
+		if err != nil || resp.Message.Content != "answered by llama3.2:3b" {
+			t.Fatalf("Expected the fallback to answer %s, got %+v, %v", requestID, resp, err)
+		}
+	}
+	if len(statuses) != 1 || statuses[0].Status != StatusFallback || statuses[0].Endpoint != fallback.URL {
+		t.Fatalf("Expected one failover reported, got %+v", statuses)
+	}
+
+	// Both down is offline, and the failure is the call's error
+	fallback.Close()
+	client.CheckHealth(context.Background())
+	if _, err := client.CallLLM(context.Background(), nil, nil, "req4", ""); err == nil {
+		t.Error("Expected the call to fail with both servers down")
+	}
+	if len(statuses) != 2 || statuses[1].Status != StatusOffline || client.Status() != StatusOffline {
+		t.Fatalf("Expected offline reported, got %+v", statuses)
+	}
+
+	// Another endpoint is assumed online until found down
+	restarted := ollamaServer()
+	defer restarted.Close()
+	client.Configure(restarted.URL+"/api/chat", "qwen3:8b", 4096)
+	if len(statuses) != 3 || statuses[2].Status != StatusOnline {
+		t.Fatalf("Expected a new endpoint to be assumed online, got %+v", statuses)
+	}
+}
+
+func TestLLMClient_CheckHealth(t *testing.T) {
+	starting := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if starting {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, `{"version": "0.6.0"}`)
+	}))
+	defer server.Close()
+	client := NewLLMClient()
+	client.Configure(server.URL+"/api/chat", "qwen3:8b", 4096)
+	var statuses []string
+	client.OnStatusChange(func(e *StatusChangedEvent) { statuses = append(statuses, e.Status) })
+
+	client.CheckHealth(context.Background())
+	starting = false
+	client.CheckHealth(context.Background())
+	client.CheckHealth(context.Background())
+	if len(statuses) != 2 || statuses[0] != StatusOffline || statuses[1] != StatusOnline {
+		t.Errorf("Expected offline and then online reported once each, got %v", statuses)
+	}
+}
+
+func TestLLMClient_ErrorsDontFailOver(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not found", http.StatusNotFound)
+	}))
+	defer primary.Close()
+	fallback := ollamaServer()
+	defer fallback.Close()
+	client := NewLLMClient()
+	client.Configure(primary.URL+"/api/chat", "qwen3:8b", 4096)
+	client.SetFallback(fallback.URL+"/api/chat", "")
+
+	if _, err := client.CallLLM(context.Background(), nil, nil, "req1", ""); err == nil || client.Status() != StatusOnline {
+		t.Errorf("Expected the endpoint's error without a failover, got %v and %s", err, client.Status())
+	}
+}
@@ -3,68 +3,162 @@ package llmprocessor
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mindpalace/pkg/eventsourcing"
 	"mindpalace/pkg/llmmodels"
 	"mindpalace/pkg/logging"
 	"net/http"
 	"strings"
+	"sync"
 )
 
+// logger logs the calls to Ollama
+var logger = logging.Named("llm")
+
 const (
 	ollamaModel       = "gpt-oss:20b"
 	ollamaAPIEndpoint = "http://localhost:11434/api/chat"
+	ollamaNumCtx      = 131072
 )
 
-type LLMClient struct{}
+type LLMClient struct {
+	mu               sync.RWMutex
+	endpoint         string
+	model            string // Used when a call doesn't name a model
+	numCtx           int    // Context window size in tokens
+	fallbackEndpoint string // Chat endpoint the calls go to while the endpoint is down, empty for none
+	fallbackModel    string // Model of the calls to the fallback, empty for the model of the call
+	health           health
+}
 
 func NewLLMClient() *LLMClient {
-	return &LLMClient{}
+	return &LLMClient{
+		endpoint: ollamaAPIEndpoint,
+		model:    ollamaModel,
+		numCtx:   ollamaNumCtx,
+		health:   health{interval: defaultHealthInterval, status: StatusOnline},
+	}
+}
+
+// Configure changes the chat endpoint, default model and context window of the next calls
+func (c *LLMClient) Configure(endpoint, model string, numCtx int) {
+	c.update(func() {
+		// Another server is up until found down
+		if endpoint != c.endpoint {
+			c.health.primaryDown = false
+		}
+		c.endpoint = endpoint
+		c.model = model
+		c.numCtx = numCtx
+	})
 }
 
-func (c *LLMClient) CallLLM(messages []llmmodels.Message, tools []llmmodels.Tool, requestID string, model string) (*llmmodels.OllamaResponse, error) {
-	logging.Trace("in call llm, len messages: %i", len(messages))
+// submit sends a streaming event if anyone listens to them
+func submit(event eventsourcing.Event) {
+	if eventsourcing.SubmitStreamingEvent != nil {
+		eventsourcing.SubmitStreamingEvent(event)
+	}
+}
+
+// CallLLM streams a chat completion from Ollama. Cancelling the context aborts the call, also while the answer streams in.
+// The call's progress is submitted as streaming events: started, the answer's chunks, and completed.
+func (c *LLMClient) CallLLM(ctx context.Context, messages []llmmodels.Message, tools []llmmodels.Tool, requestID string, model string) (*llmmodels.OllamaResponse, error) {
+	return c.call(ctx, messages, tools, nil, requestID, model)
+}
+
+// CallLLMWithFormat streams a chat completion whose answer Ollama constrains to the format, "json" or a
+// JSON schema, like CallLLM does
+func (c *LLMClient) CallLLMWithFormat(ctx context.Context, messages []llmmodels.Message, format json.RawMessage, requestID, model string) (*llmmodels.OllamaResponse, error) {
+	return c.call(ctx, messages, nil, format, requestID, model)
+}
+
+// call streams a chat completion, with tools to call or a format to answer in
+func (c *LLMClient) call(ctx context.Context, messages []llmmodels.Message, tools []llmmodels.Tool, format json.RawMessage, requestID string, model string) (*llmmodels.OllamaResponse, error) {
+	logger.Trace("in call llm, len messages: %d", len(messages))
 	for i, m := range messages {
 		runes := []rune(m.Content)
 		limit := len(runes)
 		if len(runes) > 30 {
 			limit = 30
 		}
-		logging.Trace("message index: %i, Role: %s, Context: %s", i, m.Role, string(runes[:limit]))
+		logger.Trace("message index: %d, Role: %s, Context: %s", i, m.Role, string(runes[:limit]))
 	}
-	logging.Info("Sending %d messages to LLM for request %s", len(messages), requestID)
+	logger.Info("Sending %d messages to LLM for request %s", len(messages), requestID)
 	for i, m := range messages {
 		contentPreview := m.Content
 		if len(m.Content) > 100 {
 			contentPreview = m.Content[:100] + "..."
 		}
-		logging.Info("Message %d: Role=%s, Content=%s", i, m.Role, contentPreview)
+		logger.Info("Message %d: Role=%s, Content=%s", i, m.Role, contentPreview)
 	}
 	if len(tools) > 0 {
-		logging.Info("Sending %d tools to LLM", len(tools))
+		logger.Info("Sending %d tools to LLM", len(tools))
 	}
-	// Use specified model or default to ollamaModel
+	c.mu.RLock()
+	numCtx := c.numCtx
+	// Use specified model or default to the configured model
 	if model == "" {
-		model = ollamaModel
+		model = c.model
 	}
+	c.mu.RUnlock()
 	req := llmmodels.OllamaRequest{
 		Model:    model,
 		Messages: messages,
 		Stream:   true,
 		Tools:    tools,
-		NumCtx:   131072, // Set context window size to 131,072 tokens
+		NumCtx:   numCtx,
+		Format:   format,
+	}
+	submit(&eventsourcing.LLMProcessingStartedEvent{RequestID: requestID, Model: model, Messages: len(messages), Tools: len(tools)})
+	var resp *llmmodels.OllamaResponse
+	var err error
+	// An unreachable endpoint fails over to the next; other errors are the answer's
+	for _, target := range c.targets(model) {
+		req.Model = target.model
+		resp, err = c.stream(ctx, target.endpoint, req, requestID)
+		var unreachable *unreachableError
+		if !errors.As(err, &unreachable) {
+			if ctx.Err() == nil {
+				c.reachable(target.endpoint, true)
+			}
+			break
+		}
+		logger.Error("LLM at %s is unreachable for request %s: %v", target.endpoint, requestID, unreachable.err)
+		c.reachable(target.endpoint, false)
 	}
+	completed := &eventsourcing.LLMProcessingCompletedEvent{RequestID: requestID, Model: req.Model}
+	if err != nil {
+		completed.Error = err.Error()
+	} else {
+		completed.HasToolCalls = len(resp.Message.ToolCalls) > 0
+	}
+	submit(completed)
+	return resp, err
+}
 
+// stream sends the request to Ollama and collects the answer as it streams in
+func (c *LLMClient) stream(ctx context.Context, endpoint string, req llmmodels.OllamaRequest, requestID string) (*llmmodels.OllamaResponse, error) {
 	reqBody, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
-	logging.Info("LLM Request JSON: %s", string(reqBody))
+	logger.Info("LLM Request JSON: %s", string(reqBody))
 
-	resp, err := http.Post(ollamaAPIEndpoint, "application/json", bytes.NewBuffer(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(reqBody))
 	if err != nil {
-		return nil, fmt.Errorf("failed to call Ollama API: %v", err)
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to call Ollama API: %w", err)
+		}
+		return nil, &unreachableError{endpoint: endpoint, err: err}
 	}
 	defer resp.Body.Close()
 
@@ -83,6 +177,14 @@ func (c *LLMClient) CallLLM(messages []llmmodels.Message, tools []llmmodels.Tool
 		}
 		fullContent.WriteString(chunk.Message.Content)
 		toolCalls = append(toolCalls, chunk.Message.ToolCalls...)
+		if chunk.Message.Content != "" || chunk.Done {
+			submit(&eventsourcing.LLMStreamChunkEvent{
+				RequestID:      requestID,
+				PartialContent: fullContent.String(),
+				IsFinal:        chunk.Done,
+				HasToolCalls:   len(toolCalls) > 0,
+			})
+		}
 		if chunk.Done {
 			return &llmmodels.OllamaResponse{
 				Message: llmmodels.OllamaMessage{
@@ -90,9 +192,21 @@ func (c *LLMClient) CallLLM(messages []llmmodels.Message, tools []llmmodels.Tool
 					Content:   fullContent.String(),
 					ToolCalls: toolCalls,
 				},
-				Done: true,
+				Done:            true,
+				Model:           req.Model,
+				PromptEvalCount: chunk.PromptEvalCount,
+				EvalCount:       chunk.EvalCount,
 			}, nil
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		// Close the partial output shown while the answer streamed in
+		submit(&eventsourcing.LLMStreamChunkEvent{
+			RequestID:      requestID,
+			PartialContent: fullContent.String(),
+			IsFinal:        true,
+		})
+		return nil, err
+	}
 	return nil, fmt.Errorf("no complete response received")
 }
@@ -0,0 +1,189 @@
+package llmprocessor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"mindpalace/pkg/llmmodels"
+)
+
+// DefaultStructuredAttempts is how often the LLM is asked for a structured answer when the caller doesn't say
+const DefaultStructuredAttempts = 3
+
+// FormatCaller calls the LLM with its answer constrained to a format: "json", or a JSON schema the
+// answer must follow. The LLMClient implements it.
+type FormatCaller interface {
+	CallLLMWithFormat(ctx context.Context, messages []llmmodels.Message, format json.RawMessage, requestID, model string) (*llmmodels.OllamaResponse, error)
+}
+
+// Validator is implemented by structured answers that check themselves once decoded
+type Validator interface {
+	Validate() error
+}
+
+// thinkPattern matches the reasoning some models write before their answer
+var thinkPattern = regexp.MustCompile(`(?s)<think>.*?</think>`)
+
+// CallLLMStructured asks the LLM for a T, its answer constrained to the JSON schema of T. An answer that
+// doesn't decode, misses required fields or is rejected, by T's Validate method or by validate, is
+// fed back to the LLM to be corrected, up to attempts times in all. The last rejection is returned when
+// no answer was accepted.
+func CallLLMStructured[T any](ctx context.Context, caller FormatCaller, messages []llmmodels.Message, requestID, model string, attempts int, validate func(*T) error) (T, error) {
+	var zero T
+	schema := SchemaOf(reflect.TypeOf(zero))
+	format, err := json.Marshal(schema)
+	if err != nil {
+		return zero, fmt.Errorf("failed to marshal the schema of %T: %v", zero, err)
+	}
+	if attempts <= 0 {
+		attempts = DefaultStructuredAttempts
+	}
+	messages = append([]llmmodels.Message(nil), messages...)
+	for attempt := 1; attempt <= attempts; attempt++ {
+		resp, callErr := caller.CallLLMWithFormat(ctx, messages, format, requestID, model)
+		if callErr != nil {
+			return zero, fmt.Errorf("LLM call failed: %w", callErr)
+		}
+		answer := strings.TrimSpace(thinkPattern.ReplaceAllString(resp.Message.Content, ""))
+		var value T
+		err = decodeStructured(answer, schema, &value)
+		if v, ok := any(&value).(Validator); ok && err == nil {
+			err = v.Validate()
+		}
+		if validate != nil && err == nil {
+			err = validate(&value)
+		}
+		if err == nil {
+			return value, nil
+		}
+		logger.Info("Structured answer %d for request %s was rejected: %v", attempt, requestID, err)
+		messages = append(messages,
+			llmmodels.Message{Role: "assistant", Content: answer},
+			llmmodels.Message{Role: "user", Content: fmt.Sprintf("That answer is invalid: %v. Answer with the corrected JSON object only.", err)},
+		)
+	}
+	return zero, err
+}
+
+// decodeStructured decodes the JSON object in the answer into value, checking the fields the schema
+// requires are there. Models called without constrained decoding may write text around the object.
+func decodeStructured(answer string, schema map[string]interface{}, value interface{}) error {
+	if !json.Valid([]byte(answer)) {
+		start, end := strings.Index(answer, "{"), strings.LastIndex(answer, "}")
+		if start < 0 || end < start {
+			return fmt.Errorf("the answer holds no JSON object")
+		}
+		answer = answer[start : end+1]
+	}
+	var generic interface{}
+	if err := json.Unmarshal([]byte(answer), &generic); err != nil {
+		return fmt.Errorf("the JSON does not parse: %v", err)
+	}
+	if err := checkRequired(schema, generic, ""); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(answer), value); err != nil {
+		return fmt.Errorf("the JSON does not match the schema: %v", err)
+	}
+	return nil
+}
+
+// checkRequired reports the first field the schema requires that the value lacks
+func checkRequired(schema map[string]interface{}, value interface{}, path string) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		required, _ := schema["required"].([]string)
+		for _, field := range required {
+			if _, ok := v[field]; !ok {
+				return fmt.Errorf("field %s%s is missing", path, field)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for field, fieldValue := range v {
+			if fieldSchema, ok := properties[field].(map[string]interface{}); ok {
+				if err := checkRequired(fieldSchema, fieldValue, path+field+"."); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range v {
+			if err := checkRequired(items, item, fmt.Sprintf("%s%d.", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SchemaOf returns the JSON schema of values of the type, following their JSON encoding. Fields
+// without omitempty are required; a `description` tag describes a field and an `enum` tag lists the
+// values it may have, separated by commas.
+func SchemaOf(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string"} // Encoded in base64
+		}
+		return map[string]interface{}{"type": "array", "items": SchemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": SchemaOf(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		required := []string{}
+		addFields(t, properties, &required)
+		return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+	}
+	return map[string]interface{}{} // Any value
+}
+
+// addFields adds the properties of the struct's fields, including those of embedded structs
+func addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addFields(field.Type, properties, required)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property := SchemaOf(field.Type)
+		if description := field.Tag.Get("description"); description != "" {
+			property["description"] = description
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			property["enum"] = strings.Split(enum, ",")
+		}
+		properties[name] = property
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package llmprocessor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mindpalace/pkg/llmmodels"
+)
+
+type decision struct {
+	Agent  string   `json:"agent" enum:"tasks,notes" description:"Agent to call"`
+	Query  string   `json:"query"`
+	Tags   []string `json:"tags,omitempty"`
+	Ignore string   `json:"-"`
+}
+
+// scriptedCaller answers the calls with its answers in turn, remembering the messages and format
+type scriptedCaller struct {
+	answers  []string
+	calls    [][]llmmodels.Message
+	format   json.RawMessage
+	failWith error
+}
+
+func (c *scriptedCaller) CallLLMWithFormat(ctx context.Context, messages []llmmodels.Message, format json.RawMessage, requestID, model string) (*llmmodels.OllamaResponse, error) {
+	if c.failWith != nil {
+		return nil, c.failWith
+	}
+	c.calls = append(c.calls, messages)
+	c.format = format
+	answer := c.answers[min(len(c.calls), len(c.answers))-1]
+	return &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{Content: answer}, Done: true}, nil
+}
+
+func TestSchemaOf(t *testing.T) {
+	schema := SchemaOf(reflect.TypeOf(decision{}))
+	properties := schema["properties"].(map[string]interface{})
+	if len(properties) != 3 || !reflect.DeepEqual(schema["required"], []string{"agent", "query"}) {
+		t.Errorf("Expected agent, query and tags with the first two required, got %v", schema)
+	}
+	agent := properties["agent"].(map[string]interface{})
+	if agent["type"] != "string" || agent["description"] != "Agent to call" || !reflect.DeepEqual(agent["enum"], []string{"tasks", "notes"}) {
+		t.Errorf("Unexpected schema of agent: %v", agent)
+	}
+	if tags := properties["tags"].(map[string]interface{}); tags["type"] != "array" {
+		t.Errorf("Expected tags to be an array, got %v", tags)
+	}
+}
+
+func TestCallLLMStructured(t *testing.T) {
+	caller := &scriptedCaller{answers: []string{`<think>The user wants a task</think>{"agent": "tasks", "query": "buy milk"}`}}
+	got, err := CallLLMStructured[decision](context.Background(), caller, []llmmodels.Message{{Role: "user", Content: "remind me to buy milk"}}, "req1", "", 0, nil)
+	if err != nil {
+		t.Fatalf("CallLLMStructured failed: %v", err)
+	}
+	if got.Agent != "tasks" || got.Query != "buy milk" {
+		t.Errorf("Unexpected decision %+v", got)
+	}
+	if !strings.Contains(string(caller.format), `"enum":["tasks","notes"]`) {
+		t.Errorf("Expected the schema to be sent as the format, got %s", caller.format)
+	}
+}
+
+func TestCallLLMStructured_RetriesMalformedAnswers(t *testing.T) {
+	caller := &scriptedCaller{answers: []string{
+		"Sure, I'll call the tasks agent.",
+		`{"agent": "tasks"}`,
+		`{"agent": "calendar", "query": "meeting"}`,
+		`Here it is: {"agent": "notes", "query": "meeting"}`,
+	}}
+	noCalendar := func(d *decision) error {
+		if d.Agent == "calendar" {
+			return fmt.Errorf("there is no calendar agent")
+		}
+		return nil
+	}
+	got, err := CallLLMStructured(context.Background(), caller, nil, "req1", "", 4, noCalendar)
+	if err != nil || got.Agent != "notes" {
+		t.Fatalf("Expected the fourth answer accepted, got %+v, %v", got, err)
+	}
+	for i, want := range []string{"no JSON object", "field query is missing", "no calendar agent"} {
+		feedback := caller.calls[i+1][len(caller.calls[i+1])-1]
+		if feedback.Role != "user" || !strings.Contains(feedback.Content, want) {
+			t.Errorf("Attempt %d: expected %q fed back, got %+v", i+1, want, feedback)
+		}
+	}
+
+	caller = &scriptedCaller{answers: []string{`{"agent": "calendar", "query": "meeting"}`}}
+	if _, err := CallLLMStructured(context.Background(), caller, nil, "req2", "", 2, noCalendar); err == nil || len(caller.calls) != 2 {
+		t.Errorf("Expected the last rejection after 2 attempts, got %v after %d calls", err, len(caller.calls))
+	}
+	caller = &scriptedCaller{failWith: fmt.Errorf("connection refused")}
+	if _, err := CallLLMStructured[decision](context.Background(), caller, nil, "req3", "", 2, nil); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("Expected the call's error, got %v", err)
+	}
+}
+
+func TestLLMClient_CallLLMWithFormat(t *testing.T) {
+	var request llmmodels.OllamaRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		fmt.Fprintln(w, `{"message": {"content": "{\"agent\": \"notes\", \"query\": \"x\"}"}, "done": true}`)
+	}))
+	defer server.Close()
+	client := NewLLMClient()
+	client.Configure(server.URL, "qwen3:8b", 4096)
+
+	got, err := CallLLMStructured[decision](context.Background(), client, nil, "req1", "", 1, nil)
+	if err != nil || got.Agent != "notes" {
+		t.Fatalf("Expected the streamed answer decoded, got %+v, %v", got, err)
+	}
+	if !strings.Contains(string(request.Format), `"required":["agent","query"]`) {
+		t.Errorf("Expected the schema in the request's format, got %s", request.Format)
+	}
+}
@@ -0,0 +1,275 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"mindpalace/pkg/llmmodels"
+	"mindpalace/pkg/logging"
+)
+
+// conn carries JSON-RPC messages to and from a server
+type conn interface {
+	send(ctx context.Context, message []byte) error
+	receive(handle func(message []byte)) error // Blocks until the connection ends
+	close() error
+}
+
+// Client calls the tools of an external MCP server, started as a command or reached over SSE
+type Client struct {
+	name    string
+	conn    conn
+	nextID  atomic.Int64
+	mu      sync.Mutex
+	pending map[string]chan incoming // Responses awaited, by request ID
+	tools   []llmmodels.Tool
+	done    chan struct{} // Closed once the connection ended
+	err     error         // Why the connection ended
+}
+
+// incoming is a message from the server: a response, or a request or notification of its own
+type incoming struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *rpcError       `json:"error,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// ErrClosed is returned by calls on a client whose connection ended
+var ErrClosed = errors.New("connection to the MCP server closed")
+
+// DialCommand starts the command of a server speaking MCP over stdin and stdout, with env added to
+// the environment, and lists its tools
+func DialCommand(ctx context.Context, name, command string, args, env []string) (*Client, error) {
+	c, err := startCommand(name, command, args, env)
+	if err != nil {
+		return nil, err
+	}
+	return connect(ctx, name, c)
+}
+
+// DialURL connects to a server over SSE, at addr ending in the stream's path like
+// http://localhost:8765/sse, and lists its tools
+func DialURL(ctx context.Context, name, addr, token string) (*Client, error) {
+	c, err := dialSSE(ctx, addr, token)
+	if err != nil {
+		return nil, err
+	}
+	return connect(ctx, name, c)
+}
+
+// connect initializes the session and lists the server's tools
+func connect(ctx context.Context, name string, conn conn) (*Client, error) {
+	client := &Client{
+		name:    name,
+		conn:    conn,
+		pending: make(map[string]chan incoming),
+		done:    make(chan struct{}),
+	}
+	go client.read()
+	_, err := client.request(ctx, "initialize", map[string]interface{}{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]interface{}{"name": "mindpalace", "version": Version},
+	})
+	if err == nil {
+		err = client.notify(ctx, "notifications/initialized")
+	}
+	if err == nil {
+		err = client.listTools(ctx)
+	}
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("MCP server %s: %w", name, err)
+	}
+	return client, nil
+}
+
+// Tools returns the server's tools as the LLM is offered them
+func (c *Client) Tools() []llmmodels.Tool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]llmmodels.Tool{}, c.tools...)
+}
+
+// CallTool calls a tool of the server, returning the text of its result. A result the server marks as
+// an error is returned as error.
+func (c *Client) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (string, error) {
+	if arguments == nil {
+		arguments = map[string]interface{}{}
+	}
+	raw, err := c.request(ctx, "tools/call", map[string]interface{}{"name": name, "arguments": arguments})
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		IsError bool `json:"isError"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return "", fmt.Errorf("invalid result of %s: %v", name, err)
+	}
+	parts := make([]string, 0, len(result.Content))
+	for _, content := range result.Content {
+		if content.Type == "text" {
+			parts = append(parts, content.Text)
+		} else {
+			parts = append(parts, fmt.Sprintf("[%s content]", content.Type))
+		}
+	}
+	text := strings.Join(parts, "\n")
+	if result.IsError {
+		return "", fmt.Errorf("%s", text)
+	}
+	return text, nil
+}
+
+// Close ends the connection, stopping the server's command
+func (c *Client) Close() error {
+	return c.conn.close()
+}
+
+// listTools lists the server's tools, following the pages of the list
+func (c *Client) listTools(ctx context.Context) error {
+	var tools []llmmodels.Tool
+	cursor := ""
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		raw, err := c.request(ctx, "tools/list", params)
+		if err != nil {
+			return err
+		}
+		var page struct {
+			Tools []struct {
+				Name        string                 `json:"name"`
+				Description string                 `json:"description"`
+				InputSchema map[string]interface{} `json:"inputSchema"`
+			} `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return fmt.Errorf("invalid tool list: %v", err)
+		}
+		for _, tool := range page.Tools {
+			parameters := tool.InputSchema
+			if parameters == nil {
+				parameters = map[string]interface{}{"type": "object"}
+			}
+			tools = append(tools, llmmodels.Tool{
+				Type: "function",
+				Function: map[string]interface{}{
+					"name":        tool.Name,
+					"description": tool.Description,
+					"parameters":  parameters,
+				},
+			})
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	c.mu.Lock()
+	c.tools = tools
+	c.mu.Unlock()
+	logging.Info("MCP server %s offers %d tools", c.name, len(tools))
+	return nil
+}
+
+// request sends a request and waits for its response
+func (c *Client) request(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	id := strconv.FormatInt(c.nextID.Add(1), 10)
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	msg, _ := json.Marshal(message{JSONRPC: "2.0", ID: json.RawMessage(id), Method: method, Params: data})
+	responses := make(chan incoming, 1)
+	c.mu.Lock()
+	c.pending[id] = responses
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+	if err := c.conn.send(ctx, msg); err != nil {
+		return nil, err
+	}
+	select {
+	case resp := <-responses:
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return resp.Result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, c.err
+	}
+}
+
+// notify sends a notification
+func (c *Client) notify(ctx context.Context, method string) error {
+	msg, _ := json.Marshal(message{JSONRPC: "2.0", Method: method})
+	return c.conn.send(ctx, msg)
+}
+
+// read hands the responses to the requests awaiting them and answers the server's own requests,
+// until the connection ends
+func (c *Client) read() {
+	err := c.conn.receive(func(data []byte) {
+		var msg incoming
+		if err := json.Unmarshal(data, &msg); err != nil {
+			logging.Error("Invalid message from MCP server %s: %v", c.name, err)
+			return
+		}
+		switch {
+		case msg.Method == "notifications/tools/list_changed":
+			go func() {
+				if err := c.listTools(context.Background()); err != nil {
+					logging.Error("Failed to list the tools of MCP server %s: %v", c.name, err)
+				}
+			}()
+		case msg.Method != "" && len(msg.ID) > 0:
+			// Pings are answered, the client offers nothing else to servers
+			reply := response{ID: msg.ID, Result: map[string]interface{}{}}
+			if msg.Method != "ping" {
+				reply = response{ID: msg.ID, Error: &rpcError{Code: methodNotFound, Message: fmt.Sprintf("method %s not found", msg.Method)}}
+			}
+			go c.conn.send(context.Background(), encode(reply))
+		case msg.Method == "":
+			c.mu.Lock()
+			responses, ok := c.pending[string(msg.ID)]
+			c.mu.Unlock()
+			if ok {
+				select {
+				case responses <- msg:
+				default: // Answered twice
+				}
+			}
+		}
+	})
+	if err == nil {
+		err = ErrClosed
+	}
+	logging.Info("MCP server %s disconnected: %v", c.name, err)
+	c.err = err
+	close(c.done)
+}
@@ -0,0 +1,88 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"mindpalace/internal/auth"
+)
+
+// TestMain serves the mock tools over stdin and stdout when the test binary is started as an MCP
+// server by TestDialCommand
+func TestMain(m *testing.M) {
+	if os.Getenv("MINDPALACE_MCP_TEST_SERVER") == "1" {
+		s := NewServer("", &mockPlugins{}, &mockRunner{})
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if reply := s.Handle("", scanner.Bytes()); reply != nil {
+				fmt.Printf("%s\n", reply)
+			}
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// checkClient checks the client lists the mock tools and calls them
+func checkClient(t *testing.T, client *Client) {
+	t.Helper()
+	tools := client.Tools()
+	if len(tools) != 1 || tools[0].Function["name"] != "CreateTask" || tools[0].Function["description"] != "Creates a new task" {
+		t.Fatalf("Expected the server's tool, got %v", tools)
+	}
+	parameters, _ := tools[0].Function["parameters"].(map[string]interface{})
+	if parameters["type"] != "object" {
+		t.Errorf("Expected the tool's input schema as parameters, got %v", tools[0].Function)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	text, err := client.CallTool(ctx, "CreateTask", map[string]interface{}{"Title": "Buy milk"})
+	if err != nil || !strings.Contains(text, "Buy milk") {
+		t.Errorf("Expected the task created, got %q, %v", text, err)
+	}
+	if _, err := client.CallTool(ctx, "CreateTask", nil); err == nil || !strings.Contains(err.Error(), "a title is required") {
+		t.Errorf("Expected the failed call as error, got %v", err)
+	}
+	if _, err := client.CallTool(ctx, "FlyToMoon", nil); err == nil {
+		t.Error("Expected an unknown tool refused")
+	}
+}
+
+func TestDialURL(t *testing.T) {
+	s := NewServer("", &mockPlugins{}, &mockRunner{})
+	s.SetUsers(auth.NewUsers(map[string]string{"alice-token": "alice"}))
+	httpServer := httptest.NewServer(s.Handler())
+	defer httpServer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := DialURL(ctx, "mindpalace", httpServer.URL+"/sse", "alice-token")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+	checkClient(t, client)
+}
+
+func TestDialCommand(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := DialCommand(ctx, "self", os.Args[0], []string{"-test.run=^$"}, []string{"MINDPALACE_MCP_TEST_SERVER=1"})
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	checkClient(t, client)
+	if err := client.Close(); err != nil {
+		t.Errorf("Expected the server to exit with its stdin closed, got %v", err)
+	}
+	if _, err := client.CallTool(ctx, "CreateTask", nil); err == nil {
+		t.Error("Expected calls on a closed client to fail")
+	}
+}
@@ -0,0 +1,280 @@
+// Package mcp exposes the commands of the plugins as tools over the Model Context Protocol, so external
+// LLM clients such as Claude Desktop can call them directly. The events of the commands are stored and
+// published like those of any other command.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"mindpalace/internal/auth"
+	"mindpalace/internal/httpapi"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// ProtocolVersion is the MCP version the server speaks when the client asks for one it doesn't know
+const ProtocolVersion = "2024-11-05"
+
+// supportedVersions are the MCP versions the server speaks, newest first
+var supportedVersions = []string{"2025-03-26", ProtocolVersion}
+
+// Version is the version of MindPalace reported to clients
+const Version = "0.2.0"
+
+// JSON-RPC error codes
+const (
+	parseError     = -32700
+	invalidRequest = -32600
+	methodNotFound = -32601
+	invalidParams  = -32602
+)
+
+// PluginSource gives access to the plugins whose commands are offered as tools
+type PluginSource interface {
+	GetUserLLMPlugins(userID string) []eventsourcing.Plugin
+}
+
+// CommandRunner executes commands for a user, returning the events they published
+type CommandRunner interface {
+	ExecuteCommandEvents(userID, commandName string, data any) ([]eventsourcing.Event, error)
+}
+
+// Server serves the commands of the plugins as MCP tools
+type Server struct {
+	addr     string
+	server   *http.Server
+	mux      *http.ServeMux
+	plugins  PluginSource
+	commands CommandRunner
+	sessions map[string]*session
+	stopping chan struct{} // Closed on shutdown, ending the open streams
+	mu       sync.Mutex
+}
+
+// NewServer creates an MCP server offering the commands of the plugins, executed by commands
+func NewServer(addr string, plugins PluginSource, commands CommandRunner) *Server {
+	s := &Server{
+		addr:     addr,
+		mux:      http.NewServeMux(),
+		plugins:  plugins,
+		commands: commands,
+		sessions: make(map[string]*session),
+		stopping: make(chan struct{}),
+	}
+	s.mux.HandleFunc("GET /sse", s.handleStream)
+	s.mux.HandleFunc("POST /messages", s.handleMessage)
+	s.server = &http.Server{Handler: s.mux}
+	s.server.RegisterOnShutdown(func() { close(s.stopping) })
+	return s
+}
+
+// Handler returns the HTTP handler of the SSE transport
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// SetUsers requires clients to authenticate as one of the users once users are configured. Each user
+// calls the tools of their own plugin instances.
+func (s *Server) SetUsers(users *auth.Users) {
+	s.server.Handler = users.Middleware(s.mux)
+}
+
+// Start listens on the configured address and blocks until the server fails or is shut down, then
+// returning http.ErrServerClosed. An address like unix:/path listens on a Unix socket.
+func (s *Server) Start() error {
+	logging.Info("Starting MCP server on %s", s.addr)
+	network, address := httpapi.ListenAddress(s.addr)
+	if network == "unix" {
+		os.Remove(address)
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	return s.server.Serve(listener)
+}
+
+// Shutdown ends the open streams and waits for the tool calls in progress until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// message is a JSON-RPC request or notification, the latter without an ID
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// response is a JSON-RPC response, carrying either a result or an error
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// tool describes a command to the client
+type tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+// content is a part of a tool's result
+type content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// toolResult is the result of a tool call. Failed commands are results with IsError set, so the
+// client's LLM sees why.
+type toolResult struct {
+	Content []content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// eventJSON is the wire format of the events a command published
+type eventJSON struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Handle handles a JSON-RPC message of the user, returning the response to send back, nil for
+// notifications
+func (s *Server) Handle(userID string, data []byte) []byte {
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return encode(response{ID: json.RawMessage("null"), Error: &rpcError{Code: parseError, Message: err.Error()}})
+	}
+	if len(msg.ID) == 0 {
+		// Notifications, such as notifications/initialized, need no answer
+		return nil
+	}
+	result, rpcErr := s.dispatch(userID, msg)
+	return encode(response{ID: msg.ID, Result: result, Error: rpcErr})
+}
+
+func (s *Server) dispatch(userID string, msg message) (interface{}, *rpcError) {
+	if msg.JSONRPC != "2.0" {
+		return nil, &rpcError{Code: invalidRequest, Message: "jsonrpc must be 2.0"}
+	}
+	switch msg.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		version := ProtocolVersion
+		if slices.Contains(supportedVersions, params.ProtocolVersion) {
+			version = params.ProtocolVersion
+		}
+		return map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]interface{}{"name": "mindpalace", "version": Version},
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": s.tools(userID)}, nil
+	case "tools/call":
+		var params struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil || params.Name == "" {
+			return nil, &rpcError{Code: invalidParams, Message: "tools/call takes the name of a tool and its arguments"}
+		}
+		return s.callTool(userID, params.Name, params.Arguments)
+	}
+	return nil, &rpcError{Code: methodNotFound, Message: fmt.Sprintf("method %s not found", msg.Method)}
+}
+
+// tools lists the commands of the user's plugins. A command offered by two plugins is the first's.
+func (s *Server) tools(userID string) []tool {
+	tools := []tool{}
+	seen := make(map[string]bool)
+	for _, plugin := range s.plugins.GetUserLLMPlugins(userID) {
+		for name, input := range plugin.Schemas() {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			schema := input.Schema()
+			description, _ := schema["description"].(string)
+			parameters, _ := schema["parameters"].(map[string]interface{})
+			if parameters == nil {
+				parameters = map[string]interface{}{"type": "object"}
+			}
+			tools = append(tools, tool{Name: name, Description: description, InputSchema: parameters})
+		}
+	}
+	slices.SortFunc(tools, func(a, b tool) int { return strings.Compare(a.Name, b.Name) })
+	return tools
+}
+
+// callTool decodes the arguments into the command's input and executes it for the user, returning
+// the events it published
+func (s *Server) callTool(userID, name string, arguments map[string]interface{}) (interface{}, *rpcError) {
+	var schema eventsourcing.CommandInput
+	for _, plugin := range s.plugins.GetUserLLMPlugins(userID) {
+		if input, ok := plugin.Schemas()[name]; ok {
+			schema = input
+			break
+		}
+	}
+	if schema == nil {
+		return nil, &rpcError{Code: invalidParams, Message: fmt.Sprintf("tool %s not found", name)}
+	}
+	input := schema.New()
+	if arguments != nil {
+		data, err := json.Marshal(arguments)
+		if err == nil {
+			err = json.Unmarshal(data, input)
+		}
+		if err != nil {
+			return failed(fmt.Sprintf("invalid arguments for %s: %v", name, err)), nil
+		}
+	}
+	events, err := s.commands.ExecuteCommandEvents(userID, name, input)
+	if err != nil {
+		return failed(fmt.Sprintf("command %s failed: %v", name, err)), nil
+	}
+	published := []eventJSON{}
+	for _, event := range events {
+		data, err := event.Marshal()
+		if err != nil {
+			return failed(fmt.Sprintf("failed to encode event %s: %v", event.Type(), err)), nil
+		}
+		published = append(published, eventJSON{Type: event.Type(), Data: data})
+	}
+	text, _ := json.Marshal(map[string]interface{}{"success": true, "events": published})
+	return toolResult{Content: []content{{Type: "text", Text: string(text)}}}, nil
+}
+
+// failed returns the result of a tool call that failed
+func failed(msg string) toolResult {
+	logging.Error("MCP tool call failed: %s", msg)
+	return toolResult{Content: []content{{Type: "text", Text: msg}}, IsError: true}
+}
+
+func encode(resp response) []byte {
+	resp.JSONRPC = "2.0"
+	data, _ := json.Marshal(resp)
+	return data
+}
@@ -0,0 +1,191 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mindpalace/internal/auth"
+	"mindpalace/pkg/eventsourcing"
+)
+
+type createTaskInput struct {
+	Title string
+}
+
+func (i *createTaskInput) New() any { return &createTaskInput{} }
+func (i *createTaskInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Creates a new task",
+		"parameters": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"Title": map[string]interface{}{"type": "string"}},
+			"required":   []string{"Title"},
+		},
+	}
+}
+
+type taskCreated struct {
+	eventsourcing.EventMetadata
+	Title string `json:"title"`
+}
+
+func (e *taskCreated) Type() string                { return "taskmanager_TaskCreated" }
+func (e *taskCreated) Marshal() ([]byte, error)    { return json.Marshal(e) }
+func (e *taskCreated) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type mockPlugin struct{}
+
+func (p *mockPlugin) Commands() map[string]eventsourcing.CommandHandler { return nil }
+func (p *mockPlugin) Schemas() map[string]eventsourcing.CommandInput {
+	return map[string]eventsourcing.CommandInput{"CreateTask": &createTaskInput{}}
+}
+func (p *mockPlugin) Type() eventsourcing.PluginType     { return eventsourcing.LLMPlugin }
+func (p *mockPlugin) Name() string                       { return "taskmanager" }
+func (p *mockPlugin) Aggregate() eventsourcing.Aggregate { return nil }
+func (p *mockPlugin) SystemPrompt() string               { return "" }
+func (p *mockPlugin) AgentModel() string                 { return "" }
+
+type mockPlugins struct{}
+
+func (m *mockPlugins) GetUserLLMPlugins(userID string) []eventsourcing.Plugin {
+	return []eventsourcing.Plugin{&mockPlugin{}}
+}
+
+// mockRunner creates a task for every CreateTask, refusing those without a title
+type mockRunner struct {
+	userIDs []string
+}
+
+func (r *mockRunner) ExecuteCommandEvents(userID, commandName string, data any) ([]eventsourcing.Event, error) {
+	r.userIDs = append(r.userIDs, userID)
+	input := data.(*createTaskInput)
+	if input.Title == "" {
+		return nil, errors.New("a title is required")
+	}
+	return []eventsourcing.Event{&taskCreated{Title: input.Title}}, nil
+}
+
+func call(t *testing.T, s *Server, userID, msg string) map[string]interface{} {
+	t.Helper()
+	reply := s.Handle(userID, []byte(msg))
+	var resp map[string]interface{}
+	if err := json.Unmarshal(reply, &resp); err != nil {
+		t.Fatalf("Invalid response %s: %v", reply, err)
+	}
+	return resp
+}
+
+// toolText returns the text of a tool call's result and whether it is an error
+func toolText(t *testing.T, resp map[string]interface{}) (string, bool) {
+	t.Helper()
+	result, ok := resp["result"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected a result, got %v", resp)
+	}
+	content := result["content"].([]interface{})[0].(map[string]interface{})
+	isError, _ := result["isError"].(bool)
+	return content["text"].(string), isError
+}
+
+func TestServer_Handle(t *testing.T) {
+	runner := &mockRunner{}
+	s := NewServer("", &mockPlugins{}, runner)
+
+	resp := call(t, s, "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`)
+	result := resp["result"].(map[string]interface{})
+	if result["protocolVersion"] != "2024-11-05" || result["capabilities"].(map[string]interface{})["tools"] == nil {
+		t.Errorf("Expected the tools capability in the client's version, got %v", result)
+	}
+	if reply := s.Handle("", []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); reply != nil {
+		t.Errorf("Expected no answer to a notification, got %s", reply)
+	}
+
+	resp = call(t, s, "", `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	tools := resp["result"].(map[string]interface{})["tools"].([]interface{})
+	if len(tools) != 1 {
+		t.Fatalf("Expected the plugin's command as tool, got %v", tools)
+	}
+	tool := tools[0].(map[string]interface{})
+	if tool["name"] != "CreateTask" || tool["description"] != "Creates a new task" || tool["inputSchema"].(map[string]interface{})["type"] != "object" {
+		t.Errorf("Expected the command's schema, got %v", tool)
+	}
+
+	resp = call(t, s, "alice", `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"CreateTask","arguments":{"Title":"Buy milk"}}}`)
+	text, isError := toolText(t, resp)
+	if isError || !strings.Contains(text, `"type":"taskmanager_TaskCreated"`) || !strings.Contains(text, "Buy milk") {
+		t.Errorf("Expected the published event, got %s", text)
+	}
+	if len(runner.userIDs) != 1 || runner.userIDs[0] != "alice" {
+		t.Errorf("Expected the command executed for alice, got %v", runner.userIDs)
+	}
+
+	resp = call(t, s, "", `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"CreateTask","arguments":{}}}`)
+	if text, isError := toolText(t, resp); !isError || !strings.Contains(text, "a title is required") {
+		t.Errorf("Expected the command's failure as error result, got %s", text)
+	}
+	resp = call(t, s, "", `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"CreateTask","arguments":{"Title":3}}}`)
+	if text, isError := toolText(t, resp); !isError || !strings.Contains(text, "invalid arguments") {
+		t.Errorf("Expected invalid arguments refused, got %s", text)
+	}
+
+	resp = call(t, s, "", `{"jsonrpc":"2.0","id":6,"method":"tools/call","params":{"name":"FlyToMoon"}}`)
+	if code := resp["error"].(map[string]interface{})["code"].(float64); code != invalidParams {
+		t.Errorf("Expected an unknown tool refused, got %v", resp)
+	}
+	resp = call(t, s, "", `{"jsonrpc":"2.0","id":7,"method":"resources/list"}`)
+	if code := resp["error"].(map[string]interface{})["code"].(float64); code != methodNotFound {
+		t.Errorf("Expected an unknown method refused, got %v", resp)
+	}
+}
+
+func TestBridge(t *testing.T) {
+	s := NewServer("", &mockPlugins{}, &mockRunner{})
+	s.SetUsers(auth.NewUsers(map[string]string{"alice-token": "alice"}))
+	httpServer := httptest.NewServer(s.Handler())
+	defer httpServer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := Bridge(ctx, httpServer.URL, "wrong", strings.NewReader(""), io.Discard); err == nil {
+		t.Fatal("Expected a wrong token refused")
+	}
+
+	in, clientOut := io.Pipe()
+	clientIn, out := io.Pipe()
+	bridged := make(chan error, 1)
+	go func() { bridged <- Bridge(ctx, httpServer.URL, "alice-token", in, out) }()
+	responses := bufio.NewScanner(clientIn)
+	send := func(msg string) map[string]interface{} {
+		t.Helper()
+		io.WriteString(clientOut, msg+"\n")
+		if !responses.Scan() {
+			t.Fatalf("Expected a response to %s", msg)
+		}
+		var resp map[string]interface{}
+		if err := json.Unmarshal(responses.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid response %s: %v", responses.Bytes(), err)
+		}
+		return resp
+	}
+
+	if resp := send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`); resp["id"].(float64) != 1 {
+		t.Errorf("Expected the response to initialize, got %v", resp)
+	}
+	io.WriteString(clientOut, `{"jsonrpc":"2.0","method":"notifications/initialized"}`+"\n")
+	resp := send(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"CreateTask","arguments":{"Title":"Buy milk"}}}`)
+	if text, isError := toolText(t, resp); isError || !strings.Contains(text, "Buy milk") {
+		t.Errorf("Expected the task created over the bridge, got %s", text)
+	}
+
+	clientOut.Close()
+	if err := <-bridged; err != nil {
+		t.Errorf("Expected the bridge to end with its input, got %v", err)
+	}
+}
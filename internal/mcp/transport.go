@@ -0,0 +1,379 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"mindpalace/internal/auth"
+	"mindpalace/internal/httpapi"
+	"mindpalace/pkg/logging"
+)
+
+// maxMessage is the size of the largest JSON-RPC message taken from a client or server
+const maxMessage = 4 << 20
+
+// stopWait is the time a server started as a command gets to exit once its stdin is closed
+const stopWait = 5 * time.Second
+
+// session is an open SSE stream, the responses to the messages posted for it are sent on it
+type session struct {
+	userID    string
+	responses chan []byte
+	done      chan struct{} // Closed once the stream ended
+}
+
+// handleStream opens a session: it sends the client the endpoint to post its messages to, then the
+// responses to them, until the client disconnects or the server shuts down
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	id := auth.NewToken()
+	sess := &session{userID: auth.UserOf(r.Context()), responses: make(chan []byte, 16), done: make(chan struct{})}
+	s.mu.Lock()
+	s.sessions[id] = sess
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, id)
+		s.mu.Unlock()
+		close(sess.done)
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Relative to the stream's URL, so the transport can be served under a prefix
+	fmt.Fprintf(w, "event: endpoint\ndata: messages?sessionId=%s\n\n", id)
+	flusher.Flush()
+	for {
+		select {
+		case data := <-sess.responses:
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.stopping:
+			return
+		}
+	}
+}
+
+// handleMessage handles a message posted for a session, sending the response on its stream
+func (s *Server) handleMessage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	sess, ok := s.sessions[r.URL.Query().Get("sessionId")]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	if sess.userID != auth.UserOf(r.Context()) {
+		http.Error(w, "the session belongs to another user", http.StatusForbidden)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxMessage))
+	if err != nil {
+		http.Error(w, "failed to read the message", http.StatusBadRequest)
+		return
+	}
+	// Accepted before the tool call runs, the client doesn't wait for it to post its next message
+	w.WriteHeader(http.StatusAccepted)
+	http.NewResponseController(w).Flush()
+	reply := s.Handle(sess.userID, data)
+	if reply == nil {
+		return
+	}
+	select {
+	case sess.responses <- reply:
+	case <-sess.done:
+	}
+}
+
+// Bridge connects an MCP client speaking over stdin and stdout, such as Claude Desktop launching
+// mindpalace mcp, to the SSE transport of a running MindPalace at addr: host:port, a URL, or unix:/path.
+// It returns once in ends or the stream is closed.
+func Bridge(ctx context.Context, addr, token string, in io.Reader, out io.Writer) error {
+	if network, _ := httpapi.ListenAddress(addr); network != "unix" {
+		if !strings.Contains(addr, "://") {
+			addr = "http://" + addr
+		}
+		addr = strings.TrimSuffix(addr, "/") + "/sse"
+	}
+	stream, err := dialSSE(ctx, addr, token)
+	if err != nil {
+		return err
+	}
+	defer stream.close()
+
+	// Responses are written from the stream, one JSON message per line
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- stream.receive(func(message []byte) {
+			fmt.Fprintf(out, "%s\n", message)
+		})
+	}()
+	lines := make(chan []byte)
+	inErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), maxMessage)
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				select {
+				case lines <- bytes.Clone(line):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+		inErr <- scanner.Err()
+	}()
+	for {
+		select {
+		case line := <-lines:
+			if err := stream.send(ctx, line); err != nil {
+				return err
+			}
+		case err := <-inErr:
+			return err
+		case err := <-streamErr:
+			if err == nil {
+				err = io.EOF
+			}
+			return fmt.Errorf("the stream ended: %w", err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// sseConn is a session over the SSE transport: messages are posted, the responses read from the stream
+type sseConn struct {
+	client      *http.Client
+	token       string
+	messagesURL string
+	body        io.ReadCloser
+	events      *eventReader
+	cancel      context.CancelFunc
+}
+
+// dialSSE opens the stream at addr, a URL or unix:/path, and waits until it names the endpoint to post
+// messages to. The stream stays open once ctx is done.
+func dialSSE(ctx context.Context, addr, token string) (*sseConn, error) {
+	client := http.DefaultClient
+	if network, address := httpapi.ListenAddress(addr); network == "unix" {
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", address)
+			},
+		}
+		client = &http.Client{Transport: transport}
+		addr = "http://mindpalace/sse"
+	}
+	streamURL, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	streamCtx, cancel := context.WithCancel(context.Background())
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, streamURL.String(), nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	authorize(req, token)
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("opening the stream failed: %s", resp.Status)
+	}
+	c := &sseConn{client: client, token: token, body: resp.Body, events: newEventReader(resp.Body), cancel: cancel}
+	for c.messagesURL == "" {
+		event, data, err := c.events.next()
+		if err != nil {
+			c.close()
+			return nil, fmt.Errorf("the stream ended before naming its endpoint: %v", err)
+		}
+		if event == "endpoint" {
+			messagesURL, err := streamURL.Parse(data)
+			if err != nil {
+				c.close()
+				return nil, err
+			}
+			c.messagesURL = messagesURL.String()
+		}
+	}
+	return c, nil
+}
+
+// send posts a message for the session
+func (c *sseConn) send(ctx context.Context, message []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.messagesURL, bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	authorize(req, c.token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("posting a message failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// receive hands the messages sent on the stream to handle until it ends
+func (c *sseConn) receive(handle func(message []byte)) error {
+	for {
+		event, data, err := c.events.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if event == "message" {
+			handle([]byte(data))
+		}
+	}
+}
+
+func (c *sseConn) close() error {
+	c.cancel()
+	return c.body.Close()
+}
+
+func authorize(req *http.Request, token string) {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// eventReader reads server-sent events
+type eventReader struct {
+	scanner *bufio.Scanner
+}
+
+func newEventReader(body io.Reader) *eventReader {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxMessage)
+	return &eventReader{scanner: scanner}
+}
+
+// next returns the event and data of the next event, io.EOF once the stream ended
+func (r *eventReader) next() (event, data string, err error) {
+	var lines []string
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		switch {
+		case line == "":
+			if len(lines) > 0 {
+				return event, strings.Join(lines, "\n"), nil
+			}
+			event = ""
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			lines = append(lines, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return "", "", err
+	}
+	return "", "", io.EOF
+}
+
+// stdioConn speaks to a server started as a command, one JSON message per line on its stdin and stdout
+type stdioConn struct {
+	name   string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.Reader
+	mu     sync.Mutex
+}
+
+// startCommand starts the server's command, logging what it writes to stderr
+func startCommand(name, command string, args, env []string) (*stdioConn, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = append(os.Environ(), env...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start MCP server %s: %w", name, err)
+	}
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logging.Debug("MCP server %s: %s", name, scanner.Text())
+		}
+	}()
+	return &stdioConn{name: name, cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+func (c *stdioConn) send(ctx context.Context, message []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.stdin.Write(append(bytes.Clone(message), '\n'))
+	return err
+}
+
+func (c *stdioConn) receive(handle func(message []byte)) error {
+	scanner := bufio.NewScanner(c.stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxMessage)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			handle(bytes.Clone(line))
+		}
+	}
+	return scanner.Err()
+}
+
+// close closes the server's stdin, asking it to exit, and kills it if it doesn't within stopWait
+func (c *stdioConn) close() error {
+	c.stdin.Close()
+	exited := make(chan error, 1)
+	go func() { exited <- c.cmd.Wait() }()
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(stopWait):
+		logging.Info("MCP server %s didn't exit, killing it", c.name)
+		c.cmd.Process.Kill()
+		return <-exited
+	}
+}
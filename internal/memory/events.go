@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// EventIndexer indexes events into a Store so they can be recalled as memories
+type EventIndexer struct {
+	mu           sync.Mutex
+	store        *Store
+	count        int
+	skipPrefixes []string
+}
+
+// NewEventIndexer creates an indexer that ignores event types starting with any of skipPrefixes
+func NewEventIndexer(store *Store, skipPrefixes ...string) *EventIndexer {
+	return &EventIndexer{store: store, skipPrefixes: skipPrefixes}
+}
+
+// IndexEvent adds an event to the store; it can be used directly as an eventsourcing.EventHandler
+func (ix *EventIndexer) IndexEvent(event eventsourcing.Event) error {
+	ix.mu.Lock()
+	ix.count++
+	id := fmt.Sprintf("event_%d", ix.count)
+	ix.mu.Unlock()
+
+	for _, prefix := range ix.skipPrefixes {
+		if strings.HasPrefix(event.Type(), prefix) {
+			return nil
+		}
+	}
+	data, err := event.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal event %s for memory: %v", event.Type(), err)
+	}
+	ix.store.Index(id, string(data), map[string]string{"source": "event", "event_type": event.Type(), "user_id": event.Metadata().UserID})
+	return nil
+}
@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	ollamaEmbedModel    = "nomic-embed-text"
+	ollamaEmbedEndpoint = "http://localhost:11434/api/embed"
+	ollamaEmbedTimeout  = time.Minute // For a batch of documents, a stalled Ollama must not hang a search
+)
+
+// OllamaEmbedder computes embeddings with a local Ollama model
+type OllamaEmbedder struct {
+	Model    string
+	Endpoint string
+	client   *http.Client
+}
+
+// NewOllamaEmbedder creates an embedder for the given model, using the default embedding model if empty
+func NewOllamaEmbedder(model string) *OllamaEmbedder {
+	if model == "" {
+		model = ollamaEmbedModel
+	}
+	return &OllamaEmbedder{Model: model, Endpoint: ollamaEmbedEndpoint, client: &http.Client{Timeout: ollamaEmbedTimeout}}
+}
+
+type ollamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// Embed sends all texts to Ollama in a single request
+func (e *OllamaEmbedder) Embed(texts []string) ([][]float32, error) {
+	reqBody, err := json.Marshal(ollamaEmbedRequest{Model: e.Model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	resp, err := e.client.Post(e.Endpoint, "application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Ollama embed API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Ollama embed API error: %d, %s", resp.StatusCode, body)
+	}
+
+	var result ollamaEmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode embed response: %v", err)
+	}
+	return result.Embeddings, nil
+}
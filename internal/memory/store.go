@@ -0,0 +1,220 @@
+// Package memory provides an embeddings-based vector store for semantic retrieval of past context.
+package memory
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"mindpalace/pkg/logging"
+)
+
+// Embedder turns texts into embedding vectors
+type Embedder interface {
+	Embed(texts []string) ([][]float32, error)
+}
+
+// Document is a piece of text indexed in the store
+type Document struct {
+	ID       string
+	Text     string
+	Metadata map[string]string
+	vector   []float32
+}
+
+// Result is a document matched by a search, with its cosine similarity to the query
+type Result struct {
+	Document
+	Score float64
+}
+
+// Store is an in-memory vector store. Documents are embedded lazily, in batches,
+// so indexing stays cheap while replaying large event logs.
+type Store struct {
+	mu        sync.RWMutex
+	embedder  Embedder
+	documents map[string]*Document
+	pending   []string // IDs of documents that still need an embedding
+	embedding bool     // The pending documents are being embedded in the background
+	batchSize int
+}
+
+// NewStore creates a vector store using the given embedder
+func NewStore(embedder Embedder) *Store {
+	return &Store{
+		embedder:  embedder,
+		documents: make(map[string]*Document),
+		batchSize: 64,
+	}
+}
+
+// Index adds or replaces a document; its embedding is computed in the background after the next search,
+// or by EmbedPending
+func (s *Store) Index(id, text string, metadata map[string]string) {
+	if text == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.documents[id]; ok && existing.Text == text {
+		return
+	}
+	s.documents[id] = &Document{ID: id, Text: text, Metadata: metadata}
+	s.pending = append(s.pending, id)
+}
+
+// Remove deletes a document; removing one that is not indexed does nothing
+func (s *Store) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.documents, id)
+}
+
+// Len returns the number of indexed documents
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.documents)
+}
+
+// EmbedPending computes embeddings for all documents that do not have one yet
+func (s *Store) EmbedPending() error {
+	for {
+		s.mu.Lock()
+		n := min(len(s.pending), s.batchSize)
+		batch := append([]string{}, s.pending[:n]...)
+		s.pending = s.pending[n:]
+		texts := make([]string, 0, n)
+		ids := make([]string, 0, n)
+		for _, id := range batch {
+			if doc, ok := s.documents[id]; ok && doc.vector == nil {
+				texts = append(texts, doc.Text)
+				ids = append(ids, id)
+			}
+		}
+		s.mu.Unlock()
+
+		if n == 0 {
+			return nil
+		}
+		if len(texts) == 0 {
+			continue
+		}
+
+		vectors, err := s.embedder.Embed(texts)
+		if err != nil {
+			s.requeue(ids)
+			return fmt.Errorf("failed to embed %d documents: %v", len(texts), err)
+		}
+		if len(vectors) != len(texts) {
+			s.requeue(ids)
+			return fmt.Errorf("embedder returned %d vectors for %d documents", len(vectors), len(texts))
+		}
+
+		s.mu.Lock()
+		for i, id := range ids {
+			if doc, ok := s.documents[id]; ok && doc.Text == texts[i] {
+				doc.vector = vectors[i]
+			}
+		}
+		s.mu.Unlock()
+		logging.Debug("Embedded %d memory documents", len(ids))
+	}
+}
+
+func (s *Store) requeue(ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(ids, s.pending...)
+}
+
+// embedInBackground embeds the pending documents in a goroutine, unless one is doing so already
+func (s *Store) embedInBackground() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.embedding || len(s.pending) == 0 {
+		return
+	}
+	s.embedding = true
+	go func() {
+		err := s.EmbedPending()
+		s.mu.Lock()
+		s.embedding = false
+		s.mu.Unlock()
+		if err != nil {
+			logging.Error("Failed to embed memory: %v", err)
+		}
+	}()
+}
+
+// Search returns the k embedded documents most similar to the query, best match first. Documents not
+// embedded yet are left out and embedded in the background, so a search only waits for its query.
+func (s *Store) Search(query string, k int) ([]Result, error) {
+	return s.SearchWhere(query, k, nil)
+}
+
+// SearchWhere returns the k embedded documents whose metadata has the values of where that are most
+// similar to the query, best match first, e.g. the memories of one user; see Search
+func (s *Store) SearchWhere(query string, k int, where map[string]string) ([]Result, error) {
+	if k <= 0 || query == "" {
+		return nil, nil
+	}
+	s.embedInBackground()
+	vectors, err := s.embedder.Embed([]string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %v", err)
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("embedder returned %d vectors for the query", len(vectors))
+	}
+	queryVector := vectors[0]
+
+	s.mu.RLock()
+	results := make([]Result, 0, len(s.documents))
+	for _, doc := range s.documents {
+		if doc.vector == nil || !matches(doc.Metadata, where) {
+			continue
+		}
+		results = append(results, Result{Document: *doc, Score: cosineSimilarity(queryVector, doc.vector)})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// matches reports whether the metadata has the values of where
+func matches(metadata, where map[string]string) bool {
+	for key, value := range where {
+		if metadata[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors, or 0 if they are incompatible
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,212 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// wordEmbedder embeds texts as bag-of-words vectors over a fixed vocabulary
+type wordEmbedder struct {
+	vocab []string
+	calls int
+	fail  bool
+}
+
+func (e *wordEmbedder) Embed(texts []string) ([][]float32, error) {
+	e.calls++
+	if e.fail {
+		return nil, fmt.Errorf("embedder offline")
+	}
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = make([]float32, len(e.vocab))
+		for j, word := range e.vocab {
+			vectors[i][j] = float32(strings.Count(strings.ToLower(text), word))
+		}
+	}
+	return vectors, nil
+}
+
+func TestStore_Search(t *testing.T) {
+	embedder := &wordEmbedder{vocab: []string{"dog", "food", "meeting", "calendar"}}
+	store := NewStore(embedder)
+	store.Index("1", "Bought dog food today", nil)
+	store.Index("2", "Team meeting moved in the calendar", nil)
+	store.Index("3", "The dog needs a walk", nil)
+	if err := store.EmbedPending(); err != nil {
+		t.Fatalf("EmbedPending failed: %v", err)
+	}
+
+	results, err := store.Search("how much dog food is left?", 2)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].ID != "1" {
+		t.Errorf("Expected best match '1', got '%s'", results[0].ID)
+	}
+	if results[1].ID != "3" {
+		t.Errorf("Expected second match '3', got '%s'", results[1].ID)
+	}
+}
+
+func TestStore_SearchWhere(t *testing.T) {
+	store := NewStore(&wordEmbedder{vocab: []string{"dog", "food"}})
+	for i := 0; i < 5; i++ {
+		store.Index(fmt.Sprintf("owner%d", i), "Bought dog food today", nil)
+	}
+	store.Index("alice", "The dog needs food", map[string]string{"user_id": "alice"})
+	if err := store.EmbedPending(); err != nil {
+		t.Fatalf("EmbedPending failed: %v", err)
+	}
+
+	results, err := store.SearchWhere("dog food", 2, map[string]string{"user_id": "alice"})
+	if err != nil {
+		t.Fatalf("SearchWhere failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "alice" {
+		t.Errorf("Expected alice's document only, got %+v", results)
+	}
+	if results, _ := store.SearchWhere("dog food", 10, map[string]string{"user_id": ""}); len(results) != 5 {
+		t.Errorf("Expected the 5 documents without a user, got %d", len(results))
+	}
+}
+
+func TestStore_EmbedsLazilyAndRetriesOnFailure(t *testing.T) {
+	embedder := &wordEmbedder{vocab: []string{"dog"}, fail: true}
+	store := NewStore(embedder)
+	store.Index("1", "dog", nil)
+	store.Index("2", "", nil) // Empty texts are ignored
+
+	if embedder.calls != 0 {
+		t.Errorf("Expected no embedding calls while indexing, got %d", embedder.calls)
+	}
+	if store.Len() != 1 {
+		t.Errorf("Expected 1 document, got %d", store.Len())
+	}
+	if err := store.EmbedPending(); err == nil {
+		t.Error("Expected error when embedder fails")
+	}
+
+	embedder.fail = false
+	if err := store.EmbedPending(); err != nil {
+		t.Fatalf("EmbedPending failed: %v", err)
+	}
+	results, err := store.Search("dog", 1)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "1" {
+		t.Errorf("Expected pending document to be embedded after retry, got %v", results)
+	}
+}
+
+// slowEmbedder embeds queries right away and batches of documents once released
+type slowEmbedder struct {
+	mu      sync.Mutex
+	words   wordEmbedder
+	release chan struct{}
+}
+
+func (e *slowEmbedder) Embed(texts []string) ([][]float32, error) {
+	if len(texts) > 1 {
+		<-e.release
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.words.Embed(texts)
+}
+
+func TestStore_SearchesEmbeddedWhileEmbeddingInBackground(t *testing.T) {
+	embedder := &slowEmbedder{words: wordEmbedder{vocab: []string{"dog", "food"}}, release: make(chan struct{})}
+	store := NewStore(embedder)
+	store.Index("1", "Bought dog food today", nil)
+	store.Index("2", "The dog needs a walk", nil)
+
+	// The search does not wait for the documents being embedded
+	results, err := store.Search("dog food", 5)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Expected no documents embedded yet, got %+v", results)
+	}
+
+	close(embedder.release)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(results) != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		if results, err = store.Search("dog food", 5); err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+	}
+	if len(results) != 2 || results[0].ID != "1" {
+		t.Errorf("Expected the documents found once embedded in the background, got %+v", results)
+	}
+}
+
+func TestStore_Remove(t *testing.T) {
+	store := NewStore(&wordEmbedder{vocab: []string{"dog", "food"}})
+	store.Index("1", "Bought dog food today", nil)
+	store.Index("2", "The dog needs a walk", nil)
+	store.Remove("1")
+	store.Remove("missing")
+	if err := store.EmbedPending(); err != nil {
+		t.Fatalf("EmbedPending failed: %v", err)
+	}
+
+	results, err := store.Search("dog food", 5)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if store.Len() != 1 || len(results) != 1 || results[0].ID != "2" {
+		t.Errorf("Expected only '2' to be left, got %d documents and %+v", store.Len(), results)
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b []float32
+		want float64
+	}{
+		{[]float32{1, 0}, []float32{1, 0}, 1},
+		{[]float32{1, 0}, []float32{0, 1}, 0},
+		{[]float32{1, 0}, []float32{1}, 0},
+		{[]float32{0, 0}, []float32{1, 0}, 0},
+	}
+	for _, tt := range tests {
+		if got := cosineSimilarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("cosineSimilarity(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestEventIndexer_SkipsPrefixes(t *testing.T) {
+	store := NewStore(&wordEmbedder{vocab: []string{"plugin"}})
+	indexer := NewEventIndexer(store, "orchestration_")
+
+	if err := indexer.IndexEvent(&eventsourcing.InitiatePluginCreationEvent{PluginName: "dogfood"}); err != nil {
+		t.Fatalf("IndexEvent failed: %v", err)
+	}
+	if err := indexer.IndexEvent(&skippedEvent{}); err != nil {
+		t.Fatalf("IndexEvent failed: %v", err)
+	}
+	if store.Len() != 1 {
+		t.Errorf("Expected 1 indexed event, got %d", store.Len())
+	}
+}
+
+type skippedEvent struct {
+	eventsourcing.EventMetadata
+}
+
+func (e *skippedEvent) Type() string                { return "orchestration_Skipped" }
+func (e *skippedEvent) Marshal() ([]byte, error)    { return []byte(`{}`), nil }
+func (e *skippedEvent) Unmarshal(data []byte) error { return nil }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"html/template"
 	"regexp"
+	"sort"
 	"strings"
 
 	"fyne.io/fyne/v2"
@@ -18,26 +19,36 @@ import (
 )
 
 type OrchestrationAggregate struct {
-	chatState        *ChatState
-	PendingToolCalls map[string]map[string]struct{}
-	ToolCallStates   map[string]*ToolCallState
-	AgentStates      map[string]*AgentState
-	RequestIDs       []string
-	DisplayInfos     map[string]*DisplayInfo
+	chatState         *ChatState
+	PendingToolCalls  map[string]map[string]struct{}
+	ToolCallStates    map[string]*ToolCallState
+	AgentStates       map[string]*AgentState
+	RequestIDs        []string
+	DisplayInfos      map[string]*DisplayInfo
+	FanOuts           map[string]*FanOutState   // Requests handled by several agents concurrently, by RequestID
+	UndoneRequests    map[string]bool           `json:"-"` // Requests skipped when undoing: undone requests and the undo requests themselves
+	CancelledRequests map[string]bool           `json:"-"` // Requests the user cancelled, their late results are dropped
+	CompletedRequests map[string]bool           `json:"-"` // Requests answered with a RequestCompleted event
+	RequestUsers      map[string]string         `json:"-"` // Requests of household members, by RequestID; the owner's are absent
+	Redactions        []eventsourcing.Redaction `json:"-"` // Content hidden from the chat, the exports and the APIs, in the order redacted
 }
 
 func NewOrchestrationAggregate() *OrchestrationAggregate {
-	// Initialize ChatManager with a base system prompt and context size
-	basePrompt := "You are MindPalace, a friendly AI assistant here to help with various queries and tasks."
-	chatManager := chat.NewChatManager(100000, basePrompt) // 100K tokens max for LLM context
+	// Initialize ChatManager with the built-in system prompt and context size
+	chatManager := chat.NewChatManager(100000, DefaultSystemPrompt) // 100K tokens max for LLM context
 	chatState := NewChatState(chatManager)
 	return &OrchestrationAggregate{
-		chatState:        chatState,
-		PendingToolCalls: make(map[string]map[string]struct{}),
-		ToolCallStates:   make(map[string]*ToolCallState),
-		AgentStates:      make(map[string]*AgentState),
-		RequestIDs:       make([]string, 0),
-		DisplayInfos:     make(map[string]*DisplayInfo),
+		chatState:         chatState,
+		PendingToolCalls:  make(map[string]map[string]struct{}),
+		ToolCallStates:    make(map[string]*ToolCallState),
+		AgentStates:       make(map[string]*AgentState),
+		RequestIDs:        make([]string, 0),
+		DisplayInfos:      make(map[string]*DisplayInfo),
+		FanOuts:           make(map[string]*FanOutState),
+		UndoneRequests:    make(map[string]bool),
+		CancelledRequests: make(map[string]bool),
+		CompletedRequests: make(map[string]bool),
+		RequestUsers:      make(map[string]string),
 	}
 }
 
@@ -49,7 +60,7 @@ func (a *OrchestrationAggregate) ID() string {
 type AgentState struct {
 	RequestID     string                 // ID of the request
 	AgentName     string                 // Name of the agent
-	Status        string                 // "deciding", "called", "executing", "summarizing", "completed"
+	Status        string                 // "deciding", "called", "executing", "summarizing", "completed", "cancelled"
 	ToolCallIDs   []string               // IDs of tool calls made by this agent
 	ExecutionData map[string]interface{} // Any data from execution
 	Summary       string                 // Final summary from agent
@@ -57,13 +68,44 @@ type AgentState struct {
 	Model         string
 }
 
+// FanOutState tracks the agents working concurrently on a single request
+type FanOutState struct {
+	RequestID   string
+	Status      string                 // "executing", "completed", "cancelled"
+	Agents      map[string]*AgentState // Agent name -> state
+	LastUpdated string
+}
+
 type ToolCallState struct {
 	RequestID   string
 	ToolCallID  string
 	Function    string
-	Status      string // "requested", "started", "completed"
+	Arguments   map[string]interface{}
+	AgentName   string
+	Status      string // "requested", "awaiting_confirmation", "approved", "declined", "started", "completed", "retrying", "failed", "cancelled"
+	Attempt     int    // Current attempt, starting at 1
+	Progress    int    // Percent done the command last reported, see ToolCallProgressEvent
+	ProgressMsg string // What the command last reported doing
+	Approved    bool   // The user approved the tool call, retries don't ask again
 	Results     map[string]interface{}
-	LastUpdated string // Timestamp for sorting or debugging
+	StartedAt   string   // When the last attempt started
+	EndedAt     string   // When the last attempt completed or failed
+	Failures    []string // Errors of the attempts that were retried
+	Events      []string // Types of the events the command emitted
+	LastUpdated string   // Timestamp for sorting or debugging
+}
+
+// isRunning reports whether the tool call may still be executing
+func (s *ToolCallState) isRunning() bool {
+	return s.Status == "requested" || s.Status == "approved" || s.Status == "started"
+}
+
+// progressText describes the progress the tool call last reported
+func (s *ToolCallState) progressText() string {
+	if s.ProgressMsg == "" {
+		return fmt.Sprintf("%d%%", s.Progress)
+	}
+	return fmt.Sprintf("%d%% %s", s.Progress, s.ProgressMsg)
 }
 
 type DisplayInfo struct {
@@ -82,8 +124,19 @@ func (a *OrchestrationAggregate) AgentName(requestID string) string {
 }
 
 func (a *OrchestrationAggregate) ApplyEvent(event eventsourcing.Event) error {
-	// Apply chat-related events first
-	if err := a.chatState.ApplyEvent(event); err != nil {
+	userID := event.Metadata().UserID
+	if e, ok := event.(*UserRequestReceivedEvent); ok && userID != "" {
+		if a.RequestUsers == nil {
+			a.RequestUsers = make(map[string]string)
+		}
+		a.RequestUsers[e.RequestID] = userID
+	}
+	if userID == "" {
+		userID = a.userOf(requestOf(event))
+	}
+
+	// Apply chat-related events first, to the chat of the user they belong to
+	if err := a.chatState.ApplyEvent(userID, event); err != nil {
 		return err
 	}
 
@@ -93,11 +146,23 @@ func (a *OrchestrationAggregate) ApplyEvent(event eventsourcing.Event) error {
 		if a.ToolCallStates == nil {
 			a.ToolCallStates = make(map[string]*ToolCallState)
 		}
+		attempt := toolCallAttempt(e)
+		approved := false
+		var failures []string
+		if previous, exists := a.ToolCallStates[e.ToolCallID]; exists {
+			approved = previous.Approved
+			failures = previous.Failures
+		}
 		a.ToolCallStates[e.ToolCallID] = &ToolCallState{
 			RequestID:   e.RequestID,
 			ToolCallID:  e.ToolCallID,
 			Function:    e.Function,
+			Arguments:   e.Arguments,
+			AgentName:   e.AgentName,
 			Status:      "requested",
+			Attempt:     attempt,
+			Approved:    approved,
+			Failures:    failures,
 			LastUpdated: e.Timestamp,
 		}
 		if _, exists := a.PendingToolCalls[e.RequestID]; !exists {
@@ -105,21 +170,44 @@ func (a *OrchestrationAggregate) ApplyEvent(event eventsourcing.Event) error {
 		}
 		a.PendingToolCalls[e.RequestID][e.ToolCallID] = struct{}{}
 
-		// Add toolcall id to agent tool calls
-		a.AgentStates[e.RequestID].ToolCallIDs = append(a.AgentStates[e.RequestID].ToolCallIDs, e.ToolCallID)
+		// Add toolcall id to agent tool calls, retries reuse the id
+		if agentState := a.agentState(e.RequestID, e.AgentName); agentState != nil && attempt == 1 {
+			agentState.ToolCallIDs = append(agentState.ToolCallIDs, e.ToolCallID)
+		}
+		description := "Tool call requested"
+		if attempt > 1 {
+			description = fmt.Sprintf("Tool call retried (attempt %d)", attempt)
+		}
 		a.DisplayInfos[fmt.Sprintf("tool_call_%s", e.ToolCallID)] = &DisplayInfo{
 			Title:       fmt.Sprintf("Tool: %s", e.Function),
-			Description: "Tool call requested",
-			Details:     map[string]interface{}{"type": "tool_call_started", "function": e.Function, "timestamp": e.Timestamp},
+			Description: description,
+			Details:     map[string]interface{}{"type": "tool_call_started", "function": e.Function, "attempt": attempt, "timestamp": e.Timestamp},
 		}
 
 	case "orchestration_ToolCallStarted":
 		e := event.(*ToolCallStarted)
 		// Chat handled by chatState.ApplyEvent
+		if state, exists := a.ToolCallStates[e.ToolCallID]; exists {
+			state.StartedAt = e.Timestamp
+		}
 		if displayInfo, exists := a.DisplayInfos[fmt.Sprintf("tool_call_%s", e.ToolCallID)]; exists {
 			displayInfo.Details["type"] = "tool_call_started"
 		}
 
+	case "orchestration_ToolCallProgress":
+		e := event.(*ToolCallProgressEvent)
+		// Progress reported after the tool call ended, or of a tool call retried since, is stale
+		if state, exists := a.ToolCallStates[e.ToolCallID]; exists && state.Attempt == e.Attempt && state.isRunning() {
+			state.Status = "started"
+			state.Progress = e.Percent
+			state.ProgressMsg = e.Message
+			state.LastUpdated = e.Timestamp
+		}
+		if displayInfo, exists := a.DisplayInfos[fmt.Sprintf("tool_call_%s", e.ToolCallID)]; exists {
+			displayInfo.Details["type"] = "tool_call_progress"
+			displayInfo.Description = fmt.Sprintf("%d%% %s", e.Percent, e.Message)
+		}
+
 	case "orchestration_ToolCallCompleted":
 		e := event.(*ToolCallCompleted)
 		if agentState, exists := a.AgentStates[e.RequestID]; exists {
@@ -130,6 +218,8 @@ func (a *OrchestrationAggregate) ApplyEvent(event eventsourcing.Event) error {
 		if state, exists := a.ToolCallStates[e.ToolCallID]; exists {
 			state.Status = "success"
 			state.Results = e.Results
+			state.Events = e.Events
+			state.EndedAt = e.Timestamp
 			state.LastUpdated = e.Timestamp
 			delete(a.PendingToolCalls[e.RequestID], e.ToolCallID)
 			if len(a.PendingToolCalls[e.RequestID]) == 0 {
@@ -137,6 +227,7 @@ func (a *OrchestrationAggregate) ApplyEvent(event eventsourcing.Event) error {
 			}
 		}
 		if displayInfo, exists := a.DisplayInfos[fmt.Sprintf("tool_call_%s", e.ToolCallID)]; exists {
+			a.inspectInDisplayInfo(displayInfo, e.ToolCallID)
 			displayInfo.Details["type"] = "tool_call_completed"
 			displayInfo.Description = "Tool call completed"
 		}
@@ -144,17 +235,29 @@ func (a *OrchestrationAggregate) ApplyEvent(event eventsourcing.Event) error {
 	case "orchestration_ToolCallFailed":
 		e := event.(*ToolCallFailedEvent)
 		if state, exists := a.ToolCallStates[e.ToolCallID]; exists {
-			state.Status = "failed"
 			state.Results = map[string]interface{}{"error": e.ErrorMsg}
+			state.EndedAt = e.Timestamp
 			state.LastUpdated = e.Timestamp
-			delete(a.PendingToolCalls[e.RequestID], e.ToolCallID)
-			if len(a.PendingToolCalls[e.RequestID]) == 0 {
-				delete(a.PendingToolCalls, e.RequestID)
+			if e.WillRetry {
+				// Keep the tool call pending so the request is not completed before the retry
+				state.Status = "retrying"
+				state.Failures = append(state.Failures, fmt.Sprintf("Attempt %d: %s", e.Attempt, e.ErrorMsg))
+			} else {
+				state.Status = "failed"
+				delete(a.PendingToolCalls[e.RequestID], e.ToolCallID)
+				if len(a.PendingToolCalls[e.RequestID]) == 0 {
+					delete(a.PendingToolCalls, e.RequestID)
+				}
 			}
 		}
 		if displayInfo, exists := a.DisplayInfos[fmt.Sprintf("tool_call_%s", e.ToolCallID)]; exists {
+			a.inspectInDisplayInfo(displayInfo, e.ToolCallID)
 			displayInfo.Details["type"] = "tool_call_failed"
 			displayInfo.Description = fmt.Sprintf("Tool call failed: %s", e.ErrorMsg)
+			if e.WillRetry {
+				displayInfo.Details["type"] = "tool_call_retrying"
+				displayInfo.Description = fmt.Sprintf("Tool call failed on attempt %d, retrying: %s", e.Attempt, e.ErrorMsg)
+			}
 		}
 
 		if agentState, exists := a.AgentStates[e.RequestID]; exists {
@@ -162,6 +265,29 @@ func (a *OrchestrationAggregate) ApplyEvent(event eventsourcing.Event) error {
 		}
 		// Chat handled by chatState.ApplyEvent
 
+	case "orchestration_ToolCallConfirmationRequested":
+		e := event.(*ToolCallConfirmationRequestedEvent)
+		if state, exists := a.ToolCallStates[e.ToolCallID]; exists {
+			state.Status = "awaiting_confirmation"
+			state.LastUpdated = e.Timestamp
+		}
+		if displayInfo, exists := a.DisplayInfos[fmt.Sprintf("tool_call_%s", e.ToolCallID)]; exists {
+			displayInfo.Details["type"] = "tool_call_awaiting_confirmation"
+			displayInfo.Description = "Tool call waiting for confirmation"
+		}
+
+	case "orchestration_ToolCallConfirmed":
+		e := event.(*ToolCallConfirmedEvent)
+		if state, exists := a.ToolCallStates[e.ToolCallID]; exists {
+			state.Approved = e.Approved
+			state.Status = "declined"
+			if e.Approved {
+				state.Status = "approved"
+			}
+			state.LastUpdated = e.Timestamp
+		}
+		// Chat handled by chatState.ApplyEvent
+
 	case "orchestration_AgentCallDecided":
 		e := event.(*AgentCallDecidedEvent)
 		a.AgentStates[e.RequestID] = &AgentState{
@@ -180,9 +306,50 @@ func (a *OrchestrationAggregate) ApplyEvent(event eventsourcing.Event) error {
 			Details:     map[string]interface{}{"type": "agent_call_decided", "agent": e.AgentName, "model": e.Model, "timestamp": e.Timestamp},
 		}
 
+	case "orchestration_AgentFanOutStarted":
+		e := event.(*AgentFanOutStartedEvent)
+		fanOut := &FanOutState{
+			RequestID:   e.RequestID,
+			Status:      "executing",
+			Agents:      make(map[string]*AgentState),
+			LastUpdated: e.Timestamp,
+		}
+		for _, call := range e.Calls {
+			fanOut.Agents[call.AgentName] = &AgentState{
+				RequestID:     e.RequestID,
+				AgentName:     call.AgentName,
+				Status:        "executing",
+				ToolCallIDs:   []string{},
+				ExecutionData: make(map[string]interface{}),
+				LastUpdated:   e.Timestamp,
+				Model:         call.Model,
+			}
+		}
+		if a.FanOuts == nil {
+			a.FanOuts = make(map[string]*FanOutState)
+		}
+		a.FanOuts[e.RequestID] = fanOut
+		a.DisplayInfos[fmt.Sprintf("agent_%s", e.RequestID)] = &DisplayInfo{
+			Title:       fmt.Sprintf("Agents: %d", len(e.Calls)),
+			Description: "Agents called concurrently for request",
+			Details:     map[string]interface{}{"type": "agent_fan_out_started", "timestamp": e.Timestamp},
+		}
+
+	case "orchestration_AgentCallCompleted":
+		e := event.(*AgentCallCompletedEvent)
+		if agentState := a.agentState(e.RequestID, e.AgentName); agentState != nil {
+			agentState.Status = "completed"
+			agentState.Summary = e.Summary
+			agentState.LastUpdated = e.Timestamp
+		}
+
 	case "orchestration_AgentExecutionFailed":
 		e := event.(*AgentExecutionFailedEvent)
-		if agentState, exists := a.AgentStates[e.RequestID]; exists {
+		if e.TimedOut {
+			a.applyTimeout(e)
+			break
+		}
+		if agentState := a.agentState(e.RequestID, e.AgentName); agentState != nil {
 			agentState.Status = "failed"
 			agentState.Summary = fmt.Sprintf("Agent execution failed: %s", e.ErrorMsg)
 			agentState.LastUpdated = e.Timestamp
@@ -193,6 +360,84 @@ func (a *OrchestrationAggregate) ApplyEvent(event eventsourcing.Event) error {
 		}
 		// Chat handled by chatState.ApplyEvent
 
+	case "orchestration_InitiatePluginCreation":
+		e := event.(*InitiatePluginCreationEvent)
+		a.DisplayInfos[fmt.Sprintf("plugin_creation_%s", e.RequestID)] = &DisplayInfo{
+			Title:       "Creating plugin",
+			Description: e.Description,
+			Details:     map[string]interface{}{"type": "plugin_creation_progress", "stage": "design", "timestamp": e.Timestamp},
+		}
+
+	case "orchestration_PluginCreationProgress":
+		e := event.(*PluginCreationProgressEvent)
+		if displayInfo, exists := a.DisplayInfos[fmt.Sprintf("plugin_creation_%s", e.RequestID)]; exists {
+			displayInfo.Title = fmt.Sprintf("Creating plugin: %s", e.PluginName)
+			displayInfo.Details["stage"] = e.Stage
+			displayInfo.Details["message"] = e.Message
+		}
+
+	case "orchestration_PluginCreated":
+		e := event.(*PluginCreatedEvent)
+		if displayInfo, exists := a.DisplayInfos[fmt.Sprintf("plugin_creation_%s", e.RequestID)]; exists {
+			displayInfo.Title = fmt.Sprintf("Plugin created: %s", e.PluginName)
+			displayInfo.Details["type"] = "plugin_created"
+			displayInfo.Details["commands"] = e.Commands
+		}
+
+	case "orchestration_PluginCreationFailed":
+		e := event.(*PluginCreationFailedEvent)
+		if displayInfo, exists := a.DisplayInfos[fmt.Sprintf("plugin_creation_%s", e.RequestID)]; exists {
+			displayInfo.Details["type"] = "plugin_creation_failed"
+			displayInfo.Description = fmt.Sprintf("Failed to %s the plugin: %s", e.Stage, e.ErrorMsg)
+		}
+
+	case "orchestration_ActionUndone":
+		e := event.(*ActionUndoneEvent)
+		if a.UndoneRequests == nil {
+			a.UndoneRequests = make(map[string]bool)
+		}
+		a.UndoneRequests[e.UndoneRequestID] = true
+		a.UndoneRequests[e.RequestID] = true
+
+	case "orchestration_MessageRedacted":
+		e := event.(*MessageRedactedEvent)
+		redaction := eventsourcing.Redaction{RequestID: e.RequestID, Text: e.Text, UserID: userID}
+		a.Redactions = append(a.Redactions, redaction)
+		a.redactStates(redaction)
+
+	case "orchestration_RequestCancelled":
+		e := event.(*RequestCancelledEvent)
+		if a.CancelledRequests == nil {
+			a.CancelledRequests = make(map[string]bool)
+		}
+		a.CancelledRequests[e.RequestID] = true
+		for _, toolCallID := range e.ToolCallIDs {
+			if state, exists := a.ToolCallStates[toolCallID]; exists {
+				state.Status = "cancelled"
+				state.LastUpdated = e.Timestamp
+			}
+		}
+		delete(a.PendingToolCalls, e.RequestID)
+		if agentState, exists := a.AgentStates[e.RequestID]; exists {
+			agentState.Status = "cancelled"
+			agentState.LastUpdated = e.Timestamp
+		}
+		if fanOut, exists := a.FanOuts[e.RequestID]; exists {
+			fanOut.Status = "cancelled"
+			fanOut.LastUpdated = e.Timestamp
+			for _, agentState := range fanOut.Agents {
+				if agentState.Status == "executing" {
+					agentState.Status = "cancelled"
+					agentState.LastUpdated = e.Timestamp
+				}
+			}
+		}
+		a.DisplayInfos[fmt.Sprintf("completed_%s", e.RequestID)] = &DisplayInfo{
+			Title:       "Request Cancelled",
+			Description: "Cancelled before it completed",
+			Details:     map[string]interface{}{"type": "request_cancelled", "timestamp": e.Timestamp},
+		}
+
 	case "orchestration_UserRequestReceived":
 		e := event.(*UserRequestReceivedEvent)
 		a.RequestIDs = append(a.RequestIDs, e.RequestID)
@@ -205,11 +450,19 @@ func (a *OrchestrationAggregate) ApplyEvent(event eventsourcing.Event) error {
 	case "orchestration_RequestCompleted":
 		e := event.(*RequestCompletedEvent)
 		_, regular := parseResponseText(e.ResponseText)
+		if a.CompletedRequests == nil {
+			a.CompletedRequests = make(map[string]bool)
+		}
+		a.CompletedRequests[e.RequestID] = true
 
-		if agentState, exists := a.AgentStates[e.RequestID]; exists {
+		if agentState, exists := a.AgentStates[e.RequestID]; exists && agentState.Status != "timed_out" {
 			agentState.Status = "completed"
 			agentState.LastUpdated = eventsourcing.ISOTimestamp()
 		}
+		if fanOut, exists := a.FanOuts[e.RequestID]; exists && fanOut.Status != "timed_out" {
+			fanOut.Status = "completed"
+			fanOut.LastUpdated = e.CompletedAt
+		}
 		a.DisplayInfos[fmt.Sprintf("completed_%s", e.RequestID)] = &DisplayInfo{
 			Title:       "Request Completed",
 			Description: regular,
@@ -219,69 +472,9 @@ func (a *OrchestrationAggregate) ApplyEvent(event eventsourcing.Event) error {
 	return nil
 }
 
+// GetCustomUI shows the owner's chat; a ChatView kept across updates renders only what changed
 func (a *OrchestrationAggregate) GetCustomUI() fyne.CanvasObject {
-	var chatUIList []fyne.CanvasObject
-	messages := a.chatState.GetChatManager().GetUIMessages()
-
-	tokenLabel := widget.NewLabel(fmt.Sprintf("Total Tokens Used: %d", a.chatState.GetChatManager().GetTotalTokens()))
-	tokenLabel.TextStyle = fyne.TextStyle{Bold: true}
-	chatUIList = append(chatUIList, tokenLabel, widget.NewSeparator())
-
-	currentRequestID := ""
-	for i, msg := range messages {
-		// Check if we've moved to a new request
-		if msg.RequestID != currentRequestID && currentRequestID != "" {
-			// Render agent state for the previous request, if it exists
-			if agentState, exists := a.AgentStates[currentRequestID]; exists {
-				chatUIList = append(chatUIList, a.renderAgentState(agentState))
-			}
-			// Render tool call states for the previous request, if any
-			for _, toolState := range a.ToolCallStates {
-				if toolState.RequestID == currentRequestID {
-					chatUIList = append(chatUIList, a.renderToolCallState(toolState))
-				}
-			}
-			// Add processing indicator if the previous request is ongoing
-			if a.isRequestPending(currentRequestID) {
-				chatUIList = append(chatUIList, container.NewHBox(
-					widget.NewProgressBarInfinite(),
-					widget.NewLabel("Processing..."),
-				), widget.NewSeparator())
-			}
-			currentRequestID = msg.RequestID
-		} else if currentRequestID == "" {
-			currentRequestID = msg.RequestID
-		}
-
-		// Render the chat message
-		chatUIList = append(chatUIList, a.renderChatMessage(msg))
-		if i < len(messages)-1 {
-			chatUIList = append(chatUIList, widget.NewSeparator())
-		}
-	}
-
-	// Handle the last request
-	if currentRequestID != "" {
-		// Render agent state for the last request, if it exists
-		if agentState, exists := a.AgentStates[currentRequestID]; exists {
-			chatUIList = append(chatUIList, a.renderAgentState(agentState))
-		}
-		// Render tool call states for the last request, if any
-		for _, toolState := range a.ToolCallStates {
-			if toolState.RequestID == currentRequestID {
-				chatUIList = append(chatUIList, a.renderToolCallState(toolState))
-			}
-		}
-		// Add processing indicator if the last request is ongoing
-		if a.isRequestPending(currentRequestID) {
-			chatUIList = append(chatUIList, container.NewHBox(
-				widget.NewProgressBarInfinite(),
-				widget.NewLabel("Processing..."),
-			))
-		}
-	}
-
-	return container.NewVBox(chatUIList...)
+	return NewChatView(a).Content()
 }
 
 func (a *OrchestrationAggregate) renderChatMessage(msg chat.Message) fyne.CanvasObject {
@@ -292,21 +485,173 @@ func (a *OrchestrationAggregate) renderChatMessage(msg chat.Message) fyne.Canvas
 	switch msg.Role {
 	case chat.RoleUser:
 		roleLabel.Text = "You"
-		content = parseMarkdownToCanvas(msg.Content)
+		if speaker, _ := msg.Metadata["speaker"].(string); speaker != "" {
+			roleLabel.Text = speaker
+		}
+		if revisedBy, _ := msg.Metadata["revised_by"].(string); revisedBy != "" {
+			roleLabel.Text += " (edited, the revision follows)"
+		} else if revises, _ := msg.Metadata["revises"].(string); revises != "" {
+			chain := a.chatState.GetChatManager().RevisionChain(msg.RequestID)
+			for i, requestID := range chain {
+				if requestID == msg.RequestID {
+					roleLabel.Text += fmt.Sprintf(" (revision %d)", i+1)
+				}
+			}
+		}
+		content = RenderMarkdown(msg.Content)
 	case chat.RoleMindPalace:
 		roleLabel.Text = "MindPalace"
-		content = parseMarkdownToCanvas(msg.Content)
+		content = RenderMarkdown(msg.Content)
 	case chat.RoleTool:
 		roleLabel.Text = fmt.Sprintf("%s (tool)", msg.Metadata["function"])
-		content = parseMarkdownToCanvas(msg.Content)
+		content = RenderMarkdown(msg.Content)
+		if full, _ := msg.Metadata["full_result"].(string); full != "" {
+			fullLabel := widget.NewLabel(full)
+			fullLabel.Wrapping = fyne.TextWrapWord
+			content = container.NewVBox(content, widget.NewAccordion(widget.NewAccordionItem("Full result", fullLabel)))
+		}
 	}
 
 	return container.NewVBox(roleLabel, content)
 }
 
+// applyTimeout ends the agents and tool calls of a request the watchdog failed
+func (a *OrchestrationAggregate) applyTimeout(e *AgentExecutionFailedEvent) {
+	summary := fmt.Sprintf("Agent execution failed: %s", e.ErrorMsg)
+	agents := a.fanOutAgentStates(e.RequestID)
+	if agentState, exists := a.AgentStates[e.RequestID]; exists {
+		agents = append(agents, agentState)
+	}
+	for _, agentState := range agents {
+		if agentState.Status != "completed" && agentState.Status != "failed" {
+			agentState.Status = "timed_out"
+			agentState.Summary = summary
+			agentState.LastUpdated = e.Timestamp
+		}
+	}
+	if fanOut, exists := a.FanOuts[e.RequestID]; exists {
+		fanOut.Status = "timed_out"
+		fanOut.LastUpdated = e.Timestamp
+	}
+	for toolCallID := range a.PendingToolCalls[e.RequestID] {
+		if state, exists := a.ToolCallStates[toolCallID]; exists {
+			state.Status = "timed_out"
+			state.LastUpdated = e.Timestamp
+		}
+	}
+	delete(a.PendingToolCalls, e.RequestID)
+	if displayInfo, exists := a.DisplayInfos[fmt.Sprintf("agent_%s", e.RequestID)]; exists {
+		displayInfo.Details["type"] = "request_timed_out"
+		displayInfo.Description = summary
+	}
+}
+
 // Helper to check if a request is still processing
 func (a *OrchestrationAggregate) isRequestPending(requestID string) bool {
-	return len(a.PendingToolCalls[requestID]) > 0 || (a.AgentStates[requestID] != nil && a.AgentStates[requestID].Status != "completed")
+	if a.CancelledRequests[requestID] || a.CompletedRequests[requestID] {
+		return false
+	}
+	return len(a.PendingToolCalls[requestID]) > 0 ||
+		(a.AgentStates[requestID] != nil && a.AgentStates[requestID].Status != "completed") ||
+		(a.FanOuts[requestID] != nil && a.FanOuts[requestID].Status != "completed")
+}
+
+// isRequestInProgress reports whether the request was received and neither completed nor cancelled
+func (a *OrchestrationAggregate) isRequestInProgress(requestID string) bool {
+	if a.CompletedRequests[requestID] || a.CancelledRequests[requestID] {
+		return false
+	}
+	for _, id := range a.RequestIDs {
+		if id == requestID {
+			return true
+		}
+	}
+	return false
+}
+
+// userOf returns the user who made a request, empty for the owner's requests
+func (a *OrchestrationAggregate) userOf(requestID string) string {
+	return a.RequestUsers[requestID]
+}
+
+// latestRequestInProgress returns the most recent request of the user in progress, or "" if there is none
+func (a *OrchestrationAggregate) latestRequestInProgress(userID string) string {
+	for i := len(a.RequestIDs) - 1; i >= 0; i-- {
+		if a.userOf(a.RequestIDs[i]) == userID && a.isRequestInProgress(a.RequestIDs[i]) {
+			return a.RequestIDs[i]
+		}
+	}
+	return ""
+}
+
+// isFanOut reports whether a request is handled by the concurrent multi-agent stage
+func (a *OrchestrationAggregate) isFanOut(requestID string) bool {
+	_, exists := a.FanOuts[requestID]
+	return exists
+}
+
+// fanOutAgentStates returns the agents of a fan-out request sorted by name
+func (a *OrchestrationAggregate) fanOutAgentStates(requestID string) []*AgentState {
+	fanOut, exists := a.FanOuts[requestID]
+	if !exists {
+		return nil
+	}
+	states := make([]*AgentState, 0, len(fanOut.Agents))
+	for _, state := range fanOut.Agents {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].AgentName < states[j].AgentName })
+	return states
+}
+
+// agentState returns the state of the named agent for a request, looking in fan-outs first
+func (a *OrchestrationAggregate) agentState(requestID, agentName string) *AgentState {
+	if fanOut, exists := a.FanOuts[requestID]; exists {
+		return fanOut.Agents[agentName]
+	}
+	return a.AgentStates[requestID]
+}
+
+// completedToolCalls returns the successful tool calls of a request in the order they were requested
+func (a *OrchestrationAggregate) completedToolCalls(requestID string) []*ToolCallState {
+	agents := a.fanOutAgentStates(requestID)
+	if agentState, exists := a.AgentStates[requestID]; exists {
+		agents = append(agents, agentState)
+	}
+	var states []*ToolCallState
+	for _, agentState := range agents {
+		for _, id := range agentState.ToolCallIDs {
+			if state, exists := a.ToolCallStates[id]; exists && state.RequestID == requestID && state.Status == "success" {
+				states = append(states, state)
+			}
+		}
+	}
+	return states
+}
+
+// pendingConfirmation returns the most recent tool call waiting for the user's confirmation, or nil
+func (a *OrchestrationAggregate) pendingConfirmation(userID string) *ToolCallState {
+	var pending *ToolCallState
+	for _, state := range a.ToolCallStates {
+		if state.Status != "awaiting_confirmation" || a.userOf(state.RequestID) != userID {
+			continue
+		}
+		if pending == nil || state.LastUpdated > pending.LastUpdated ||
+			(state.LastUpdated == pending.LastUpdated && state.ToolCallID > pending.ToolCallID) {
+			pending = state
+		}
+	}
+	return pending
+}
+
+// awaitsUser reports whether a tool call of the request waits for the user's confirmation
+func (a *OrchestrationAggregate) awaitsUser(requestID string) bool {
+	for _, state := range a.ToolCallStates {
+		if state.RequestID == requestID && state.Status == "awaiting_confirmation" {
+			return true
+		}
+	}
+	return false
 }
 
 func (a *OrchestrationAggregate) renderAgentState(state *AgentState) fyne.CanvasObject {
@@ -346,12 +691,25 @@ func (a *OrchestrationAggregate) renderAgentState(state *AgentState) fyne.Canvas
 
 		if state.Summary != "" {
 			contentElements = append(contentElements, widget.NewSeparator())
-			contentElements = append(contentElements, parseMarkdownToCanvas(state.Summary))
+			contentElements = append(contentElements, RenderMarkdown(state.Summary))
 		}
 
 		contentBox := container.NewVBox(contentElements...)
 		messageContainer.Add(container.NewVBox(roleLabel, contentBox))
 
+	case "timed_out":
+		statusLabel := widget.NewLabel(fmt.Sprintf("Agent '%s' timed out", state.AgentName))
+		statusLabel.TextStyle = fyne.TextStyle{Italic: true}
+		icon := widget.NewIcon(theme.WarningIcon())
+		contentBox := container.NewVBox(container.NewHBox(icon, statusLabel), widget.NewSeparator(), RenderMarkdown(state.Summary))
+		messageContainer.Add(container.NewVBox(roleLabel, contentBox))
+
+	case "cancelled":
+		statusLabel := widget.NewLabel(fmt.Sprintf("Agent '%s' was cancelled", state.AgentName))
+		statusLabel.TextStyle = fyne.TextStyle{Italic: true}
+		icon := widget.NewIcon(theme.CancelIcon())
+		messageContainer.Add(container.NewVBox(roleLabel, container.NewHBox(icon, statusLabel)))
+
 	case "failed":
 		statusLabel := widget.NewLabel(fmt.Sprintf("Agent '%s' failed", state.AgentName))
 		statusLabel.TextStyle = fyne.TextStyle{Italic: true}
@@ -362,7 +720,7 @@ func (a *OrchestrationAggregate) renderAgentState(state *AgentState) fyne.Canvas
 
 		if state.Summary != "" {
 			contentElements = append(contentElements, widget.NewSeparator())
-			contentElements = append(contentElements, parseMarkdownToCanvas(state.Summary))
+			contentElements = append(contentElements, RenderMarkdown(state.Summary))
 		}
 
 		contentBox := container.NewVBox(contentElements...)
@@ -386,31 +744,25 @@ func (a *OrchestrationAggregate) renderToolCallState(state *ToolCallState) fyne.
 		messageContainer.Add(container.NewVBox(roleLabel, contentBox))
 
 	case "started":
-		statusLabel := widget.NewLabel(fmt.Sprintf("Tool Call: %s - In Progress", state.Function))
+		statusLabel := widget.NewLabel(fmt.Sprintf("Tool Call: %s - %s", state.Function, state.progressText()))
 		statusLabel.TextStyle = fyne.TextStyle{Italic: true}
-		spinner := widget.NewProgressBarInfinite()
-		contentBox := container.NewHBox(spinner, statusLabel)
-		messageContainer.Add(container.NewVBox(roleLabel, contentBox))
+		progressBar := widget.NewProgressBar()
+		progressBar.SetValue(float64(state.Progress) / 100)
+		messageContainer.Add(container.NewVBox(roleLabel, container.NewBorder(nil, nil, nil, statusLabel, progressBar)))
 
-	case "completed":
+	case "success":
+		// The results are shown as the tool's message, and in the inspector
 		statusLabel := widget.NewLabel(fmt.Sprintf("Tool Call: %s - Completed", state.Function))
 		statusLabel.TextStyle = fyne.TextStyle{Italic: true}
 		icon := widget.NewIcon(theme.ConfirmIcon())
-		resultText := fmt.Sprintf("%+v", state.Results)
-		resultContent := parseMarkdownToCanvas(resultText)
-		contentBox := container.NewVBox(
-			container.NewHBox(icon, statusLabel),
-			widget.NewSeparator(),
-			resultContent,
-		)
-		messageContainer.Add(container.NewVBox(roleLabel, contentBox))
+		messageContainer.Add(container.NewVBox(roleLabel, container.NewHBox(icon, statusLabel)))
 
 	case "failed":
 		statusLabel := widget.NewLabel(fmt.Sprintf("Tool Call: %s - Failed", state.Function))
 		statusLabel.TextStyle = fyne.TextStyle{Italic: true}
 		icon := widget.NewIcon(theme.ErrorIcon())
 		errorText := fmt.Sprintf("%+v", state.Results["error"])
-		errorContent := parseMarkdownToCanvas(errorText)
+		errorContent := RenderMarkdown(errorText)
 		contentBox := container.NewVBox(
 			container.NewHBox(icon, statusLabel),
 			widget.NewSeparator(),
@@ -419,48 +771,9 @@ func (a *OrchestrationAggregate) renderToolCallState(state *ToolCallState) fyne.
 		messageContainer.Add(container.NewVBox(roleLabel, contentBox))
 	}
 
-	return container.NewPadded(messageContainer)
-}
-
-// parseMarkdownToCanvas converts Markdown text into a styled Fyne CanvasObject (unchanged)
-func parseMarkdownToCanvas(text string) fyne.CanvasObject {
-	// Create a single Entry for the entire text
-	entry := widget.NewEntry()
-	entry.MultiLine = true             // Enable multi-line support
-	entry.Wrapping = fyne.TextWrapWord // Wrap text naturally
-
-	// Count the number of lines to set a reasonable height
-	lineCount := len(strings.Split(text, "\n"))
-	if lineCount < 1 {
-		lineCount = 1 // Ensure at least one line
-	}
-	entry.SetMinRowsVisible(lineCount + 1) // Add 1 for padding
-
-	// Set the text and style
-	if strings.HasPrefix(text, "# ") {
-		entry.SetText(strings.TrimPrefix(text, "# "))
-		entry.TextStyle = fyne.TextStyle{Bold: true}
-	} else if strings.HasPrefix(text, "## ") {
-		entry.SetText(strings.TrimPrefix(text, "## "))
-		entry.TextStyle = fyne.TextStyle{Bold: true}
-	} else if strings.HasPrefix(text, "- ") || strings.HasPrefix(text, "* ") {
-		text = strings.ReplaceAll(text, "- ", "• ")
-		text = strings.ReplaceAll(text, "* ", "• ")
-		entry.SetText(text)
-	} else if strings.HasPrefix(text, "```") && strings.HasSuffix(text, "```") {
-		entry.SetText(strings.TrimPrefix(strings.TrimSuffix(text, "```"), "```"))
-		entry.TextStyle = fyne.TextStyle{Monospace: true}
-	} else {
-		entry.SetText(text)
-	}
-
-	// Make read-only without disabling to preserve text color
-	entry.OnChanged = func(string) {
-		// Revert any changes to prevent editing
-		entry.SetText(text)
-	}
-
-	return entry
+	inspect := widget.NewButtonWithIcon("Inspect", theme.SearchIcon(), func() { showToolCallInspector(state) })
+	inspect.Importance = widget.LowImportance
+	return container.NewPadded(container.NewBorder(nil, nil, nil, container.NewVBox(inspect), messageContainer))
 }
 
 // markdownToHTML converts basic Markdown to HTML for web display
@@ -505,11 +818,12 @@ func markdownToHTML(text string) template.HTML {
 }
 
 type RequestCompletedEvent struct {
+	eventsourcing.EventMetadata
 	eventsourcing.BaseEvent
 	EventType    string `json:"event_type"`
-	RequestID    string
-	ResponseText string
-	CompletedAt  string
+	RequestID    string `json:"request_id"`
+	ResponseText string `json:"response_text"`
+	CompletedAt  string `json:"completed_at"`
 }
 
 func (e *RequestCompletedEvent) Type() string { return "orchestration_RequestCompleted" }
@@ -518,6 +832,30 @@ func (e *RequestCompletedEvent) Marshal() ([]byte, error) {
 	return json.Marshal(e)
 }
 
+// UnmarshalJSON also reads the events stored before the fields had json tags, e.g. {"RequestID": "req1"}
+func (e *RequestCompletedEvent) UnmarshalJSON(data []byte) error {
+	type fields RequestCompletedEvent
+	stored := struct {
+		*fields
+		LegacyRequestID    string `json:"RequestID"`
+		LegacyResponseText string `json:"ResponseText"`
+		LegacyCompletedAt  string `json:"CompletedAt"`
+	}{fields: (*fields)(e)}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	if e.RequestID == "" {
+		e.RequestID = stored.LegacyRequestID
+	}
+	if e.ResponseText == "" {
+		e.ResponseText = stored.LegacyResponseText
+	}
+	if e.CompletedAt == "" {
+		e.CompletedAt = stored.LegacyCompletedAt
+	}
+	return nil
+}
+
 // parseResponseText extracts <think> tags and regular content from the response.
 func parseResponseText(responseText string) (thinks []string, regular string) {
 	re := regexp.MustCompile(`(?s)<think>(.*?)</think>`)
@@ -531,9 +869,14 @@ func parseResponseText(responseText string) (thinks []string, regular string) {
 
 // UserRequestReceivedEvent is a strongly typed event for when a user request is received
 type UserRequestReceivedEvent struct {
+	eventsourcing.EventMetadata
 	EventType   string `json:"event_type"`
 	RequestID   string `json:"request_id"`
 	RequestText string `json:"request_text"`
+	SessionID   string `json:"session_id,omitempty"` // Chat session the request was made in
+	Language    string `json:"language,omitempty"`   // Language the request was spoken in, if detected
+	Speaker     string `json:"speaker,omitempty"`    // Who spoke the request, with diarization on
+	Revises     string `json:"revises,omitempty"`    // Request the user edited and resubmitted as this one
 	Timestamp   string `json:"timestamp"`
 }
 
@@ -551,6 +894,7 @@ func (e *UserRequestReceivedEvent) Unmarshal(data []byte) error {
 }
 
 type RequestCompleted struct {
+	eventsourcing.EventMetadata
 	EventType   string `json:"event_type"`
 	RequestID   string `json:"request_id"`
 	RequestText string `json:"request_text"`
@@ -566,13 +910,16 @@ func (e *RequestCompleted) Marshal() ([]byte, error) {
 	return json.Marshal(e)
 }
 
+// InitiatePluginCreationEvent starts creating a plugin the user asked for
 type InitiatePluginCreationEvent struct {
+	eventsourcing.EventMetadata
 	EventType   string `json:"event_type"`
 	RequestID   string `json:"request_id"`
 	PluginName  string `json:"plugin_name"`
 	Description string `json:"description"`
-	Goal        string `json:"goal"`
+	Goal        string `json:"goal"` // The user's request, in their words
 	Result      string `json:"result"`
+	Timestamp   string `json:"timestamp"`
 }
 
 func (e *InitiatePluginCreationEvent) Type() string { return "orchestration_InitiatePluginCreation" }
@@ -582,13 +929,70 @@ func (e *InitiatePluginCreationEvent) Marshal() ([]byte, error) {
 }
 func (e *InitiatePluginCreationEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
 
+// PluginCreationProgressEvent reports that creating a plugin reached a stage: design, generate, compile,
+// test or load
+type PluginCreationProgressEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string `json:"event_type"`
+	RequestID  string `json:"request_id"`
+	PluginName string `json:"plugin_name"`
+	Stage      string `json:"stage"`
+	Message    string `json:"message"`
+	Timestamp  string `json:"timestamp"`
+}
+
+func (e *PluginCreationProgressEvent) Type() string { return "orchestration_PluginCreationProgress" }
+func (e *PluginCreationProgressEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *PluginCreationProgressEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// PluginCreatedEvent records that a generated plugin passed its tests and was loaded
+type PluginCreatedEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string   `json:"event_type"`
+	RequestID  string   `json:"request_id"`
+	PluginName string   `json:"plugin_name"`
+	Commands   []string `json:"commands"`
+	Timestamp  string   `json:"timestamp"`
+}
+
+func (e *PluginCreatedEvent) Type() string { return "orchestration_PluginCreated" }
+func (e *PluginCreatedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *PluginCreatedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// PluginCreationFailedEvent records the stage creating a plugin failed at; the generated code is discarded
+type PluginCreationFailedEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string `json:"event_type"`
+	RequestID  string `json:"request_id"`
+	PluginName string `json:"plugin_name"`
+	Stage      string `json:"stage"`
+	ErrorMsg   string `json:"error_msg"`
+	Timestamp  string `json:"timestamp"`
+}
+
+func (e *PluginCreationFailedEvent) Type() string { return "orchestration_PluginCreationFailed" }
+func (e *PluginCreationFailedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *PluginCreationFailedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
 type ToolCallRequestPlaced struct {
+	eventsourcing.EventMetadata
 	EventType  string                 `json:"event_type"`
 	RequestID  string                 `json:"request_id"`
 	ToolCallID string                 `json:"tool_call_id"`
 	Function   string                 `json:"function"`
 	Arguments  map[string]interface{} `json:"arguments"`
 	Timestamp  string                 `json:"timestamp"`
+	AgentName  string                 `json:"agent_name,omitempty"` // Set when several agents work on the request
+	Attempt    int                    `json:"attempt,omitempty"`    // Attempt number, 0 or 1 for the first
 }
 
 func (e *ToolCallRequestPlaced) Type() string { return "orchestration_ToolCallRequestPlaced" }
@@ -599,6 +1003,7 @@ func (e *ToolCallRequestPlaced) Marshal() ([]byte, error) {
 func (e *ToolCallRequestPlaced) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
 
 type ToolCallStarted struct {
+	eventsourcing.EventMetadata
 	EventType  string `json:"event_type"`
 	RequestID  string `json:"request_id"`
 	ToolCallID string `json:"tool_call_id"`
@@ -613,12 +1018,36 @@ func (e *ToolCallStarted) Marshal() ([]byte, error) {
 }
 func (e *ToolCallStarted) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
 
+// ToolCallProgressEvent reports how far a long-running tool call is while it runs. It is not stored,
+// a replayed tool call has long finished.
+type ToolCallProgressEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string `json:"event_type"`
+	RequestID  string `json:"request_id"`
+	ToolCallID string `json:"tool_call_id"`
+	Function   string `json:"function"`
+	Attempt    int    `json:"attempt"`
+	Percent    int    `json:"percent"` // 0 to 100
+	Message    string `json:"message,omitempty"`
+	Timestamp  string `json:"timestamp"`
+}
+
+func (e *ToolCallProgressEvent) Type() string { return "orchestration_ToolCallProgress" }
+func (e *ToolCallProgressEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ToolCallProgressEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
 type ToolCallCompleted struct {
+	eventsourcing.EventMetadata
 	EventType  string                 `json:"event_type"`
 	RequestID  string                 `json:"request_id"`
 	ToolCallID string                 `json:"tool_call_id"`
 	Function   string                 `json:"function"`
 	Results    map[string]interface{} `json:"results"`
+	Summary    string                 `json:"summary,omitempty"` // Condensed results for the chat, when the results are too large for it
+	Events     []string               `json:"events,omitempty"`  // Types of the events the command emitted, in order
 	Timestamp  string                 `json:"timestamp"`
 }
 
@@ -631,6 +1060,7 @@ func (e *ToolCallCompleted) Unmarshal(data []byte) error { return json.Unmarshal
 
 // Define agent-related event types
 type AgentCallDecidedEvent struct {
+	eventsourcing.EventMetadata
 	EventType string `json:"event_type"`
 	RequestID string `json:"request_id"`
 	AgentName string `json:"agent_name"`
@@ -649,12 +1079,14 @@ func (e *AgentCallDecidedEvent) Unmarshal(data []byte) error { return json.Unmar
 
 // AgentExecutionFailedEvent represents a failure in agent execution
 type AgentExecutionFailedEvent struct {
+	eventsourcing.EventMetadata
 	EventType   string `json:"event_type"`
 	RequestID   string `json:"request_id"`
 	AgentName   string `json:"agent_name"`
 	ErrorMsg    string `json:"error_msg"`
 	Timestamp   string `json:"timestamp"`
-	Recoverable bool   `json:"recoverable"` // Whether the error is recoverable
+	Recoverable bool   `json:"recoverable"`         // Whether the error is recoverable
+	TimedOut    bool   `json:"timed_out,omitempty"` // The watchdog ended the request
 }
 
 func (e *AgentExecutionFailedEvent) Type() string { return "orchestration_AgentExecutionFailed" }
@@ -664,14 +1096,58 @@ func (e *AgentExecutionFailedEvent) Marshal() ([]byte, error) {
 }
 func (e *AgentExecutionFailedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
 
+// AgentCall describes a single agent invocation decided by the orchestrator
+type AgentCall struct {
+	AgentName string `json:"agent_name"`
+	Model     string `json:"model"`
+	Query     string `json:"query"`
+}
+
+// AgentFanOutStartedEvent starts several agents concurrently for one request
+type AgentFanOutStartedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string      `json:"event_type"`
+	RequestID string      `json:"request_id"`
+	Calls     []AgentCall `json:"calls"`
+	Timestamp string      `json:"timestamp"`
+}
+
+func (e *AgentFanOutStartedEvent) Type() string { return "orchestration_AgentFanOutStarted" }
+func (e *AgentFanOutStartedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *AgentFanOutStartedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// AgentCallCompletedEvent records the contribution of one agent in a fan-out
+type AgentCallCompletedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	RequestID string `json:"request_id"`
+	AgentName string `json:"agent_name"`
+	Summary   string `json:"summary"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *AgentCallCompletedEvent) Type() string { return "orchestration_AgentCallCompleted" }
+func (e *AgentCallCompletedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *AgentCallCompletedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
 // ToolCallFailedEvent represents a failure in a tool call
 type ToolCallFailedEvent struct {
+	eventsourcing.EventMetadata
 	EventType  string `json:"event_type"`
 	RequestID  string `json:"request_id"`
 	ToolCallID string `json:"tool_call_id"`
 	Function   string `json:"function"`
 	ErrorMsg   string `json:"error_msg"`
 	Timestamp  string `json:"timestamp"`
+	Attempt    int    `json:"attempt,omitempty"`    // Attempt that failed
+	Transient  bool   `json:"transient,omitempty"`  // The failure may succeed when retried
+	WillRetry  bool   `json:"will_retry,omitempty"` // A retry is scheduled according to the retry policy
 }
 
 func (e *ToolCallFailedEvent) Type() string { return "orchestration_ToolCallFailed" }
@@ -681,27 +1157,266 @@ func (e *ToolCallFailedEvent) Marshal() ([]byte, error) {
 }
 func (e *ToolCallFailedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
 
+// ToolCallConfirmationRequestedEvent pauses a destructive tool call until the user approves it
+type ToolCallConfirmationRequestedEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string                 `json:"event_type"`
+	RequestID  string                 `json:"request_id"`
+	ToolCallID string                 `json:"tool_call_id"`
+	Function   string                 `json:"function"`
+	Arguments  map[string]interface{} `json:"arguments"`
+	Prompt     string                 `json:"prompt"` // Question shown to the user
+	Timestamp  string                 `json:"timestamp"`
+}
+
+func (e *ToolCallConfirmationRequestedEvent) Type() string {
+	return "orchestration_ToolCallConfirmationRequested"
+}
+func (e *ToolCallConfirmationRequestedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ToolCallConfirmationRequestedEvent) Unmarshal(data []byte) error {
+	return json.Unmarshal(data, e)
+}
+
+// ToolCallConfirmedEvent records the user's answer to a confirmation request
+type ToolCallConfirmedEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string `json:"event_type"`
+	RequestID  string `json:"request_id"` // The request the tool call belongs to
+	ToolCallID string `json:"tool_call_id"`
+	Function   string `json:"function"`
+	Approved   bool   `json:"approved"`
+	Timestamp  string `json:"timestamp"`
+}
+
+func (e *ToolCallConfirmedEvent) Type() string { return "orchestration_ToolCallConfirmed" }
+func (e *ToolCallConfirmedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ToolCallConfirmedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// UndoRequestedEvent is emitted when the user asks to undo the last action
+type UndoRequestedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	RequestID string `json:"request_id"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *UndoRequestedEvent) Type() string { return "orchestration_UndoRequested" }
+func (e *UndoRequestedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *UndoRequestedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ActionUndoneEvent records that the effects of an earlier request were compensated
+type ActionUndoneEvent struct {
+	eventsourcing.EventMetadata
+	EventType       string   `json:"event_type"`
+	RequestID       string   `json:"request_id"`        // The undo request
+	UndoneRequestID string   `json:"undone_request_id"` // The request whose events were compensated
+	UndoneEvents    []string `json:"undone_events"`     // Types of the compensated events
+	Timestamp       string   `json:"timestamp"`
+}
+
+func (e *ActionUndoneEvent) Type() string { return "orchestration_ActionUndone" }
+func (e *ActionUndoneEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ActionUndoneEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// CameraDirectedEvent moves the camera of the user's 3D clients, see eventsourcing.CameraEnvelope. It is
+// not stored, the camera is not part of the state.
+type CameraDirectedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	RequestID string `json:"request_id"`
+	Action    string `json:"action"`            // eventsourcing.CameraFocus, CameraOrbit or CameraZoomZone
+	NodeID    string `json:"node_id,omitempty"` // Node shown
+	Zone      string `json:"zone,omitempty"`    // Plugin whose objects are shown, instead of a node
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *CameraDirectedEvent) Type() string { return "orchestration_CameraDirected" }
+func (e *CameraDirectedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *CameraDirectedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// RequestCancelledEvent records that the user cancelled a request before it completed
+type RequestCancelledEvent struct {
+	eventsourcing.EventMetadata
+	EventType   string   `json:"event_type"`
+	RequestID   string   `json:"request_id"`
+	ToolCallIDs []string `json:"tool_call_ids,omitempty"` // Tool calls of the request that were still pending
+	Timestamp   string   `json:"timestamp"`
+}
+
+func (e *RequestCancelledEvent) Type() string { return "orchestration_RequestCancelled" }
+func (e *RequestCancelledEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *RequestCancelledEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// SessionStartedEvent starts a new conversation thread and makes it the active session
+type SessionStartedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	SessionID string `json:"session_id"`
+	Title     string `json:"title"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *SessionStartedEvent) Type() string { return "orchestration_SessionStarted" }
+func (e *SessionStartedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *SessionStartedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// SessionSwitchedEvent makes an existing conversation thread the active session
+type SessionSwitchedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	SessionID string `json:"session_id"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *SessionSwitchedEvent) Type() string { return "orchestration_SessionSwitched" }
+func (e *SessionSwitchedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *SessionSwitchedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// SessionLanguageSetEvent sets the language responses in a session are given in; an empty language
+// answers in the language the user spoke
+type SessionLanguageSetEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	SessionID string `json:"session_id"`
+	Language  string `json:"language"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *SessionLanguageSetEvent) Type() string { return "orchestration_SessionLanguageSet" }
+func (e *SessionLanguageSetEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *SessionLanguageSetEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// SessionsListedEvent lists the conversation threads
+type SessionsListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType       string         `json:"event_type"`
+	Sessions        []chat.Session `json:"sessions"`
+	ActiveSessionID string         `json:"active_session_id"`
+	Timestamp       string         `json:"timestamp"`
+}
+
+func (e *SessionsListedEvent) Type() string { return "orchestration_SessionsListed" }
+func (e *SessionsListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *SessionsListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ConversationSummarizedEvent rolls the oldest messages of a session into a summary that replaces
+// them in the LLM context
+type ConversationSummarizedEvent struct {
+	eventsourcing.EventMetadata
+	EventType       string `json:"event_type"`
+	SessionID       string `json:"session_id"`
+	Summary         string `json:"summary"`
+	ThroughTime     string `json:"through_time"`     // Timestamp of the last summarized message
+	ThroughSequence int    `json:"through_sequence"` // Sequence of the last summarized message
+	MessageCount    int    `json:"message_count"`    // Messages rolled into the summary since the previous one
+	Timestamp       string `json:"timestamp"`
+}
+
+func (e *ConversationSummarizedEvent) Type() string { return "orchestration_ConversationSummarized" }
+func (e *ConversationSummarizedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ConversationSummarizedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// MessageRedactedEvent hides the messages of a request, or scrubs a text from the messages, e.g. a phone
+// number. The events holding the content are kept; the chat, the exports and the APIs show a placeholder.
+type MessageRedactedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	RequestID string `json:"request_id,omitempty"` // Request whose messages are hidden, or the only request Text is scrubbed from
+	Text      string `json:"text,omitempty"`       // Text scrubbed from the messages, all of the request's content if empty
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *MessageRedactedEvent) Type() string { return "orchestration_MessageRedacted" }
+func (e *MessageRedactedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *MessageRedactedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
 func init() {
 	eventsourcing.RegisterEvent("orchestration_UserRequestReceived", func() eventsourcing.Event { return &UserRequestReceivedEvent{} })
 
 	// ToolCalling events
 	eventsourcing.RegisterEvent("orchestration_ToolCallRequestPlaced", func() eventsourcing.Event { return &ToolCallRequestPlaced{} })
 	eventsourcing.RegisterEvent("orchestration_ToolCallStarted", func() eventsourcing.Event { return &ToolCallStarted{} })
+	eventsourcing.RegisterEvent("orchestration_ToolCallProgress", func() eventsourcing.Event { return &ToolCallProgressEvent{} })
+	eventsourcing.RegisterTransientEvent("orchestration_ToolCallProgress")
 	eventsourcing.RegisterEvent("orchestration_ToolCallCompleted", func() eventsourcing.Event { return &ToolCallCompleted{} })
 	eventsourcing.RegisterEvent("orchestration_ToolCallFailed", func() eventsourcing.Event { return &ToolCallFailedEvent{} })
+	eventsourcing.RegisterEvent("orchestration_ToolCallConfirmationRequested", func() eventsourcing.Event { return &ToolCallConfirmationRequestedEvent{} })
+	eventsourcing.RegisterEvent("orchestration_ToolCallConfirmed", func() eventsourcing.Event { return &ToolCallConfirmedEvent{} })
 
 	// Agent-related events
 	eventsourcing.RegisterEvent("orchestration_AgentCallDecided", func() eventsourcing.Event { return &AgentCallDecidedEvent{} })
 	eventsourcing.RegisterEvent("orchestration_AgentExecutionFailed", func() eventsourcing.Event { return &AgentExecutionFailedEvent{} })
-
+	eventsourcing.RegisterEvent("orchestration_AgentFanOutStarted", func() eventsourcing.Event { return &AgentFanOutStartedEvent{} })
+	eventsourcing.RegisterEvent("orchestration_AgentCallCompleted", func() eventsourcing.Event { return &AgentCallCompletedEvent{} })
+
+	// Undo events
+	eventsourcing.RegisterEvent("orchestration_UndoRequested", func() eventsourcing.Event { return &UndoRequestedEvent{} })
+	eventsourcing.RegisterEvent("orchestration_ActionUndone", func() eventsourcing.Event { return &ActionUndoneEvent{} })
+
+	// Camera events
+	eventsourcing.RegisterEvent("orchestration_CameraDirected", func() eventsourcing.Event { return &CameraDirectedEvent{} })
+	eventsourcing.RegisterTransientEvent("orchestration_CameraDirected")
+
+	// Cancellation events
+	eventsourcing.RegisterEvent("orchestration_RequestCancelled", func() eventsourcing.Event { return &RequestCancelledEvent{} })
+
+	// Session events
+	eventsourcing.RegisterEvent("orchestration_SessionStarted", func() eventsourcing.Event { return &SessionStartedEvent{} })
+	eventsourcing.RegisterEvent("orchestration_SessionSwitched", func() eventsourcing.Event { return &SessionSwitchedEvent{} })
+	eventsourcing.RegisterEvent("orchestration_SessionLanguageSet", func() eventsourcing.Event { return &SessionLanguageSetEvent{} })
+	eventsourcing.RegisterEvent("orchestration_SessionsListed", func() eventsourcing.Event { return &SessionsListedEvent{} })
+	eventsourcing.RegisterTransientEvent("orchestration_SessionsListed")
+	eventsourcing.RegisterEvent("orchestration_ConversationSummarized", func() eventsourcing.Event { return &ConversationSummarizedEvent{} })
+	eventsourcing.RegisterEvent("orchestration_MessageRedacted", func() eventsourcing.Event { return &MessageRedactedEvent{} })
+
+	// Plugin creation events
 	eventsourcing.RegisterEvent("orchestration_InitiatePluginCreation", func() eventsourcing.Event { return &InitiatePluginCreationEvent{} })
+	eventsourcing.RegisterEvent("orchestration_PluginCreationProgress", func() eventsourcing.Event { return &PluginCreationProgressEvent{} })
+	eventsourcing.RegisterEvent("orchestration_PluginCreated", func() eventsourcing.Event { return &PluginCreatedEvent{} })
+	eventsourcing.RegisterEvent("orchestration_PluginCreationFailed", func() eventsourcing.Event { return &PluginCreationFailedEvent{} })
 
 	// Last event in chain
 	eventsourcing.RegisterEvent("orchestration_RequestCompleted", func() eventsourcing.Event { return &RequestCompletedEvent{} })
 }
 
 func (a *OrchestrationAggregate) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
-	theme := ui3d.DefaultTheme()
+	theme := ui3d.CurrentTheme()
 	switch e := event.(type) {
 	case *UserRequestReceivedEvent:
 		// Find the index of this request in RequestIDs
@@ -755,6 +1470,17 @@ func (a *OrchestrationAggregate) Broadcast3DDelta(event eventsourcing.Event) []e
 		}
 		return []eventsourcing.DeltaAction{sphere, label}
 	case *ToolCallRequestPlaced:
+		if attempt := toolCallAttempt(e); attempt > 1 {
+			// Retries update the existing tool call
+			return []eventsourcing.DeltaAction{{
+				Type:   "update",
+				NodeID: fmt.Sprintf("tool_call_%s_label", e.ToolCallID),
+				Properties: map[string]interface{}{
+					"text":       fmt.Sprintf("Tool: %s (Attempt %d)", e.Function, attempt),
+					"event_type": "tool_call_retried",
+				},
+			}}
+		}
 		pos := []float64{2, 0, 0} // Side
 		box := ui3d.CreateBox(fmt.Sprintf("tool_call_%s", e.ToolCallID), pos, theme)
 		box.Properties["event_type"] = "tool_call_started"
@@ -785,36 +1511,136 @@ func (a *OrchestrationAggregate) Broadcast3DDelta(event eventsourcing.Event) []e
 				"event_type": "tool_call_started",
 			},
 		}}
+	case *ToolCallProgressEvent:
+		// The label pulses while the tool call reports progress
+		return []eventsourcing.DeltaAction{{
+			Type:   "update",
+			NodeID: fmt.Sprintf("tool_call_%s_label", e.ToolCallID),
+			Properties: map[string]interface{}{
+				"text":       fmt.Sprintf("Tool: %s (%d%%) %s", e.Function, e.Percent, e.Message),
+				"event_type": "tool_call_progress",
+				"progress":   e.Percent,
+				"pulse":      true,
+			},
+		}}
 	case *ToolCallCompleted:
 		// Update to completed
-		return []eventsourcing.DeltaAction{{
+		return a.withInspection(e.ToolCallID, eventsourcing.DeltaAction{
 			Type:   "update",
 			NodeID: fmt.Sprintf("tool_call_%s_label", e.ToolCallID),
 			Properties: map[string]interface{}{
 				"text":       fmt.Sprintf("Tool: %s (Completed)", e.Function),
 				"event_type": "tool_call_completed",
+				"pulse":      false,
+			},
+		})
+	case *ToolCallConfirmationRequestedEvent:
+		// The client asks the user and answers with a confirm message
+		return []eventsourcing.DeltaAction{{
+			Type:   "update",
+			NodeID: fmt.Sprintf("tool_call_%s_label", e.ToolCallID),
+			Properties: map[string]interface{}{
+				"text":                 fmt.Sprintf("Tool: %s (Awaiting confirmation)", e.Function),
+				"event_type":           "tool_call_awaiting_confirmation",
+				"confirm_tool_call_id": e.ToolCallID,
+				"confirm_prompt":       e.Prompt,
+			},
+		}}
+	case *ToolCallConfirmedEvent:
+		status := "Declined"
+		if e.Approved {
+			status = "Approved"
+		}
+		return []eventsourcing.DeltaAction{{
+			Type:   "update",
+			NodeID: fmt.Sprintf("tool_call_%s_label", e.ToolCallID),
+			Properties: map[string]interface{}{
+				"text":                  fmt.Sprintf("Tool: %s (%s)", e.Function, status),
+				"event_type":            "tool_call_" + strings.ToLower(status),
+				"confirmation_answered": e.ToolCallID,
 			},
 		}}
 	case *ToolCallFailedEvent:
+		if e.WillRetry {
+			return a.withInspection(e.ToolCallID, eventsourcing.DeltaAction{
+				Type:   "update",
+				NodeID: fmt.Sprintf("tool_call_%s_label", e.ToolCallID),
+				Properties: map[string]interface{}{
+					"text":       fmt.Sprintf("Tool: %s (Retrying after attempt %d)", e.Function, e.Attempt),
+					"event_type": "tool_call_retrying",
+					"pulse":      false,
+				},
+			})
+		}
 		// Update to failed
-		return []eventsourcing.DeltaAction{{
+		return a.withInspection(e.ToolCallID, eventsourcing.DeltaAction{
 			Type:   "update",
 			NodeID: fmt.Sprintf("tool_call_%s_label", e.ToolCallID),
 			Properties: map[string]interface{}{
 				"text":       fmt.Sprintf("Tool: %s (Failed)", e.Function),
 				"event_type": "tool_call_failed",
+				"pulse":      false,
 			},
-		}}
+		})
 	case *AgentExecutionFailedEvent:
+		if e.TimedOut {
+			actions := []eventsourcing.DeltaAction{{
+				Type:   "update",
+				NodeID: fmt.Sprintf("agent_%s_label", e.RequestID),
+				Properties: map[string]interface{}{
+					"text":       fmt.Sprintf("Agent: %s (Timed out)", e.AgentName),
+					"event_type": "request_timed_out",
+				},
+			}}
+			for _, state := range a.ToolCallStates {
+				if state.RequestID == e.RequestID && state.Status == "timed_out" {
+					actions = append(actions, eventsourcing.DeltaAction{
+						Type:   "update",
+						NodeID: fmt.Sprintf("tool_call_%s_label", state.ToolCallID),
+						Properties: map[string]interface{}{
+							"text":       fmt.Sprintf("Tool: %s (Timed out)", state.Function),
+							"event_type": "request_timed_out",
+						},
+					})
+				}
+			}
+			return actions
+		}
 		// Update agent
 		return []eventsourcing.DeltaAction{{
 			Type:   "update",
 			NodeID: fmt.Sprintf("agent_%s_label", e.RequestID),
 			Properties: map[string]interface{}{
-				"text":       fmt.Sprintf("Agent: %s (Failed)", a.AgentStates[e.RequestID].AgentName),
+				"text":       fmt.Sprintf("Agent: %s (Failed)", e.AgentName),
 				"event_type": "agent_execution_failed",
 			},
 		}}
+	case *RequestCancelledEvent:
+		// Close the confirmations of the cancelled tool calls
+		actions := []eventsourcing.DeltaAction{{
+			Type:   "update",
+			NodeID: fmt.Sprintf("agent_%s_label", e.RequestID),
+			Properties: map[string]interface{}{
+				"text":       "Agent (Cancelled)",
+				"event_type": "request_cancelled",
+			},
+		}}
+		for _, toolCallID := range e.ToolCallIDs {
+			function := ""
+			if state, exists := a.ToolCallStates[toolCallID]; exists {
+				function = state.Function
+			}
+			actions = append(actions, eventsourcing.DeltaAction{
+				Type:   "update",
+				NodeID: fmt.Sprintf("tool_call_%s_label", toolCallID),
+				Properties: map[string]interface{}{
+					"text":                  fmt.Sprintf("Tool: %s (Cancelled)", function),
+					"event_type":            "request_cancelled",
+					"confirmation_answered": toolCallID,
+				},
+			})
+		}
+		return actions
 	case *RequestCompletedEvent:
 		pos := []float64{4, -1, 0} // Underground completed
 		box := ui3d.CreateBox(fmt.Sprintf("completed_%s", e.RequestID), pos, theme)
@@ -841,7 +1667,7 @@ func (a *OrchestrationAggregate) Broadcast3DDelta(event eventsourcing.Event) []e
 }
 
 func (a *OrchestrationAggregate) GetFull3DState() []eventsourcing.DeltaAction {
-	theme := ui3d.DefaultTheme()
+	theme := ui3d.CurrentTheme()
 	// Replay chat history to create user avatar + recent bubbles
 	actions := []eventsourcing.DeltaAction{{
 		Type:     "create",
@@ -883,3 +1709,18 @@ func (a *OrchestrationAggregate) GetFull3DState() []eventsourcing.DeltaAction {
 func (a *OrchestrationAggregate) GetChatManager() *chat.ChatManager {
 	return a.chatState.GetChatManager()
 }
+
+// ChatManagerFor returns the chat of a user, the owner's for an empty user
+func (a *OrchestrationAggregate) ChatManagerFor(userID string) *chat.ChatManager {
+	return a.chatState.ForUser(userID)
+}
+
+// SetHistoryTokens changes the tokens of history kept in the LLM context of every user's chat
+func (a *OrchestrationAggregate) SetHistoryTokens(maxTokens int) {
+	a.chatState.SetMaxTokens(maxTokens)
+}
+
+// RequestUser returns the user who made a request, empty for the owner
+func (a *OrchestrationAggregate) RequestUser(requestID string) string {
+	return a.userOf(requestID)
+}
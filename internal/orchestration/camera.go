@@ -0,0 +1,81 @@
+package orchestration
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/llmmodels"
+)
+
+// focusOnToolName is the tool the LLM calls to show the user something in the 3D world, e.g. "show me
+// my week" flies the camera to the calendar
+const focusOnToolName = "FocusOn"
+
+// focusOnTool describes FocusOn to the LLM
+func focusOnTool() llmmodels.Tool {
+	return llmmodels.Tool{
+		Type: "function",
+		Function: map[string]interface{}{
+			"name":        focusOnToolName,
+			"description": "Move the camera of the user's 3D world to show something, e.g. calendar for \"show me my week\" or taskmanager for \"show me my tasks\". Only when the user asks to see it.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"target": map[string]interface{}{
+						"type":        "string",
+						"description": "Name of an agent to show all its objects, or the node ID of one object, e.g. calendar_hub",
+					},
+					"orbit": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Circle around the target once instead of looking at it",
+					},
+				},
+				"required": []string{"target"},
+			},
+		},
+	}
+}
+
+// FocusOnCommand directs the camera of the user's 3D clients to the objects of a plugin, e.g.
+// {"target": "calendar"}, or to a node, e.g. {"target": "calendar_hub", "orbit": true}
+func (ro *RequestOrchestrator) FocusOnCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	target, _ := data["target"].(string)
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return nil, fmt.Errorf("target is required")
+	}
+	orbit, _ := data["orbit"].(bool)
+	requestID, _ := data["requestID"].(string)
+	event := &CameraDirectedEvent{
+		RequestID: requestID,
+		Action:    eventsourcing.CameraFocus,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}
+	if plugin, err := ro.pluginsOf(eventsourcing.UserOf(data)).GetPlugin(strings.ToLower(target)); err == nil && plugin != nil {
+		event.Zone = strings.ToLower(target)
+		event.Action = eventsourcing.CameraZoomZone
+	} else {
+		event.NodeID = target
+	}
+	if orbit {
+		event.Action = eventsourcing.CameraOrbit
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+// focusResult runs a FocusOn call and returns what the camera shows as JSON, or why it can't so the LLM
+// can correct its call
+func (ro *RequestOrchestrator) focusResult(userID, requestID string, arguments map[string]interface{}) (string, error) {
+	data := map[string]interface{}{"userID": userID, "requestID": requestID, "target": arguments["target"], "orbit": arguments["orbit"]}
+	var result interface{} = map[string]interface{}{"shown": arguments["target"]}
+	if err := ro.eventProcessor.ExecuteCommand(focusOnToolName, data); err != nil {
+		result = map[string]string{"error": err.Error()}
+	}
+	content, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s result: %v", focusOnToolName, err)
+	}
+	return string(content), nil
+}
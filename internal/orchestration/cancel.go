@@ -0,0 +1,149 @@
+package orchestration
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"mindpalace/internal/usage"
+	"mindpalace/pkg/eventsourcing"
+)
+
+// CancelRequestCommand cancels a request in progress: its LLM calls are aborted, tool calls that
+// did not run yet are dropped, and results arriving later are ignored. Without a requestID it
+// cancels the most recent request of the user in progress.
+func (ro *RequestOrchestrator) CancelRequestCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	requestID, _ := data["requestID"].(string)
+	userID := eventsourcing.UserOf(data)
+	if requestID == "" {
+		requestID = ro.agg.latestRequestInProgress(userID)
+		if requestID == "" {
+			return nil, fmt.Errorf("no request in progress")
+		}
+	} else if !ro.agg.isRequestInProgress(requestID) {
+		return nil, fmt.Errorf("request %s is not in progress", requestID)
+	}
+	if err := ro.checkRequestUser(userID, requestID); err != nil {
+		return nil, err
+	}
+
+	toolCallIDs := make([]string, 0, len(ro.agg.PendingToolCalls[requestID]))
+	for toolCallID := range ro.agg.PendingToolCalls[requestID] {
+		toolCallIDs = append(toolCallIDs, toolCallID)
+	}
+	sort.Strings(toolCallIDs)
+
+	logger.Info("Cancelling request %s with %d pending tool calls", requestID, len(toolCallIDs))
+	ro.cancelRequestContext(requestID)
+	return []eventsourcing.Event{&RequestCancelledEvent{
+		EventType:   "orchestration_RequestCancelled",
+		RequestID:   requestID,
+		ToolCallIDs: toolCallIDs,
+		Timestamp:   eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// runningRequest is the context of a request in progress with the function cancelling it
+type runningRequest struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// requestContext returns the context the LLM calls of a request run in, it is done once the request is cancelled
+func (ro *RequestOrchestrator) requestContext(requestID string) context.Context {
+	ro.requestsMu.Lock()
+	defer ro.requestsMu.Unlock()
+	if running, exists := ro.runningRequests[requestID]; exists {
+		return running.ctx
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if ro.cancelledRequests[requestID] || ro.agg.CancelledRequests[requestID] {
+		cancel()
+	}
+	ro.runningRequests[requestID] = runningRequest{ctx: ctx, cancel: cancel}
+	return ctx
+}
+
+// cancelRequestContext aborts the LLM calls of a request; later calls for the request fail right away
+func (ro *RequestOrchestrator) cancelRequestContext(requestID string) {
+	ro.requestsMu.Lock()
+	defer ro.requestsMu.Unlock()
+	ro.cancelledRequests[requestID] = true
+	if running, exists := ro.runningRequests[requestID]; exists {
+		running.cancel()
+		delete(ro.runningRequests, requestID)
+	}
+}
+
+// releaseRequest frees the context and stops the watchdog of a request that ended
+func (ro *RequestOrchestrator) releaseRequest(requestID string) {
+	ro.requestsMu.Lock()
+	defer ro.requestsMu.Unlock()
+	if watchdog, exists := ro.watchdogs[requestID]; exists {
+		watchdog.Stop()
+		delete(ro.watchdogs, requestID)
+	}
+	if running, exists := ro.runningRequests[requestID]; exists {
+		running.cancel()
+		delete(ro.runningRequests, requestID)
+	}
+}
+
+// isCancelled reports whether the user cancelled the request, also before the cancellation event was applied
+func (ro *RequestOrchestrator) isCancelled(requestID string) bool {
+	ro.requestsMu.Lock()
+	cancelled := ro.cancelledRequests[requestID]
+	ro.requestsMu.Unlock()
+	return cancelled || ro.agg.CancelledRequests[requestID]
+}
+
+// cancelledEvents keeps only the token usage of the events a command produced for a request that was
+// cancelled while it ran. ok is false when the request was not cancelled.
+func (ro *RequestOrchestrator) cancelledEvents(requestID string, events ...eventsourcing.Event) (kept []eventsourcing.Event, ok bool) {
+	if !ro.isCancelled(requestID) {
+		return nil, false
+	}
+	for _, event := range events {
+		if usageEvent, isUsage := event.(*usage.TokenUsageRecordedEvent); isUsage && usageEvent != nil {
+			kept = append(kept, usageEvent)
+		}
+	}
+	logger.Info("Dropping the results of cancelled request %s", requestID)
+	return kept, true
+}
+
+// skipCancelled wraps an event handler so events of cancelled requests no longer drive the request on
+func (ro *RequestOrchestrator) skipCancelled(handler func(eventsourcing.Event) error) func(eventsourcing.Event) error {
+	return func(event eventsourcing.Event) error {
+		if requestID := requestIDOf(event); requestID != "" && ro.isCancelled(requestID) {
+			logger.Debug("Ignoring %s of cancelled request %s", event.Type(), requestID)
+			return nil
+		}
+		return handler(event)
+	}
+}
+
+// requestIDOf returns the request an orchestration event belongs to
+func requestIDOf(event eventsourcing.Event) string {
+	switch e := event.(type) {
+	case *AgentCallDecidedEvent:
+		return e.RequestID
+	case *AgentFanOutStartedEvent:
+		return e.RequestID
+	case *UndoRequestedEvent:
+		return e.RequestID
+	case *InitiatePluginCreationEvent:
+		return e.RequestID
+	case *ToolCallRequestPlaced:
+		return e.RequestID
+	case *ToolCallConfirmedEvent:
+		return e.RequestID
+	case *ToolCallCompleted:
+		return e.RequestID
+	case *ToolCallFailedEvent:
+		return e.RequestID
+	case *AgentExecutionFailedEvent:
+		return e.RequestID
+	}
+	return ""
+}
@@ -0,0 +1,273 @@
+package orchestration
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"mindpalace/internal/briefing"
+	"mindpalace/internal/chat"
+	"mindpalace/internal/llmprocessor"
+	"mindpalace/internal/reminders"
+	"mindpalace/pkg/eventsourcing"
+)
+
+// ChatState projects persisted orchestration events onto the ChatManager.
+// Because chat messages are derived from stored events, replaying the event
+// log during RebuildState restores the full conversation after a restart.
+// Household members each converse in a ChatManager of their own.
+type ChatState struct {
+	chatManager *chat.ChatManager
+	mu          sync.Mutex
+	userChats   map[string]*chat.ChatManager // User -> the user's chat
+}
+
+// ChangesChat tells whether events of the type can change the chat or its sessions: the orchestration's own
+// events and the events of other packages shown in the chat
+func ChangesChat(eventType string) bool {
+	switch eventType {
+	case (&reminders.ReminderDueEvent{}).Type(), (&llmprocessor.StatusChangedEvent{}).Type(), (&briefing.BriefingDeliveredEvent{}).Type():
+		return true
+	}
+	return eventsourcing.AggregateOf(eventType) == "orchestration"
+}
+
+// NewChatState wraps a ChatManager so it can be rebuilt from events
+func NewChatState(chatManager *chat.ChatManager) *ChatState {
+	return &ChatState{chatManager: chatManager, userChats: make(map[string]*chat.ChatManager)}
+}
+
+// GetChatManager returns the underlying ChatManager
+func (cs *ChatState) GetChatManager() *chat.ChatManager {
+	return cs.chatManager
+}
+
+// ForUser returns the chat of a user, the owner's for an empty user. A user's chat is started
+// with their first event.
+func (cs *ChatState) ForUser(userID string) *chat.ChatManager {
+	if userID == "" {
+		return cs.chatManager
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	userChat, exists := cs.userChats[userID]
+	if !exists {
+		userChat = cs.chatManager.ForUser(userID)
+		cs.userChats[userID] = userChat
+	}
+	return userChat
+}
+
+// SetMaxTokens changes the tokens of history kept in the LLM context of every chat
+func (cs *ChatState) SetMaxTokens(maxTokens int) {
+	cs.chatManager.SetMaxTokens(maxTokens)
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, userChat := range cs.userChats {
+		userChat.SetMaxTokens(maxTokens)
+	}
+}
+
+// ApplyEvent translates orchestration events into chat events of the user's chat; other events are ignored
+func (cs *ChatState) ApplyEvent(userID string, event eventsourcing.Event) error {
+	chatManager := cs.ForUser(userID)
+	var chatEvent interface{}
+	switch e := event.(type) {
+	case *UserRequestReceivedEvent:
+		chatEvent = &chat.UserRequestReceivedEvent{
+			RequestID:   e.RequestID,
+			RequestText: e.RequestText,
+			SessionID:   e.SessionID,
+			Language:    e.Language,
+			Speaker:     e.Speaker,
+			Revises:     e.Revises,
+			Timestamp:   parseEventTime(e.Timestamp),
+		}
+	case *ToolCallStarted:
+		chatEvent = &chat.ToolCallStarted{
+			RequestID: e.RequestID,
+			Function:  e.Function,
+			Timestamp: parseEventTime(e.Timestamp),
+		}
+	case *ToolCallCompleted:
+		chatEvent = &chat.ToolCallCompleted{
+			RequestID:  e.RequestID,
+			ToolCallID: e.ToolCallID,
+			Function:   e.Function,
+			Results:    e.Results,
+			Summary:    e.Summary,
+			Timestamp:  parseEventTime(e.Timestamp),
+		}
+	case *ToolCallFailedEvent:
+		errorMsg := e.ErrorMsg
+		if e.WillRetry {
+			errorMsg = fmt.Sprintf("%s, retrying (attempt %d failed)", e.ErrorMsg, e.Attempt)
+		}
+		chatEvent = &chat.ToolCallFailedEvent{
+			RequestID:  e.RequestID,
+			ToolCallID: e.ToolCallID,
+			ErrorMsg:   errorMsg,
+			Timestamp:  parseEventTime(e.Timestamp),
+		}
+	case *ToolCallConfirmationRequestedEvent:
+		chatEvent = &chat.ToolCallConfirmationRequestedEvent{
+			RequestID: e.RequestID,
+			Prompt:    e.Prompt,
+			Timestamp: parseEventTime(e.Timestamp),
+		}
+	case *ToolCallConfirmedEvent:
+		chatEvent = &chat.ToolCallConfirmedEvent{
+			RequestID: e.RequestID,
+			Function:  e.Function,
+			Approved:  e.Approved,
+			Timestamp: parseEventTime(e.Timestamp),
+		}
+	case *ToolCallRequestPlaced:
+		chatEvent = &chat.AgentToolCallEvent{
+			RequestID:  e.RequestID,
+			ToolCallID: e.ToolCallID,
+			AgentName:  e.AgentName,
+			Function:   e.Function,
+			Arguments:  e.Arguments,
+			Timestamp:  parseEventTime(e.Timestamp),
+		}
+	case *AgentCallDecidedEvent:
+		chatEvent = &chat.AgentCallDecidedEvent{
+			RequestID: e.RequestID,
+			AgentName: e.AgentName,
+			Query:     e.Query,
+			Timestamp: parseEventTime(e.Timestamp),
+		}
+	case *AgentFanOutStartedEvent:
+		for _, call := range e.Calls {
+			err := chatManager.ApplyChatEvent(&chat.AgentCallDecidedEvent{
+				RequestID: e.RequestID,
+				AgentName: call.AgentName,
+				Query:     call.Query,
+				Timestamp: parseEventTime(e.Timestamp),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case *PluginCreationProgressEvent:
+		chatEvent = &chat.PluginCreationProgressEvent{
+			RequestID:  e.RequestID,
+			PluginName: e.PluginName,
+			Message:    e.Message,
+			Timestamp:  parseEventTime(e.Timestamp),
+		}
+	case *PluginCreationFailedEvent:
+		chatEvent = &chat.PluginCreationProgressEvent{
+			RequestID:  e.RequestID,
+			PluginName: e.PluginName,
+			Message:    fmt.Sprintf("failed to %s: %s", e.Stage, e.ErrorMsg),
+			Timestamp:  parseEventTime(e.Timestamp),
+		}
+	case *AgentCallCompletedEvent:
+		chatEvent = &chat.AgentCallCompletedEvent{
+			RequestID: e.RequestID,
+			AgentName: e.AgentName,
+			Summary:   e.Summary,
+			Timestamp: parseEventTime(e.Timestamp),
+		}
+	case *AgentExecutionFailedEvent:
+		chatEvent = &chat.AgentExecutionFailedEvent{
+			RequestID: e.RequestID,
+			ErrorMsg:  e.ErrorMsg,
+			Timestamp: parseEventTime(e.Timestamp),
+		}
+	case *RequestCompletedEvent:
+		chatEvent = &chat.RequestCompletedEvent{
+			RequestID:    e.RequestID,
+			ResponseText: e.ResponseText,
+			Timestamp:    parseEventTime(e.CompletedAt),
+		}
+	case *RequestCancelledEvent:
+		chatEvent = &chat.RequestCancelledEvent{
+			RequestID: e.RequestID,
+			Timestamp: parseEventTime(e.Timestamp),
+		}
+	case *reminders.ReminderDueEvent:
+		chatEvent = &chat.ReminderDueEvent{
+			Title:     e.Title,
+			Due:       parseEventTime(e.Due),
+			Timestamp: parseEventTime(e.Timestamp),
+		}
+	case *briefing.BriefingDeliveredEvent:
+		chatEvent = &chat.BriefingDeliveredEvent{
+			BriefingID: e.BriefingID,
+			Text:       e.Text,
+			Timestamp:  parseEventTime(e.Timestamp),
+		}
+	case *llmprocessor.StatusChangedEvent:
+		return cs.applyToAll(&chat.LLMStatusChangedEvent{
+			Status:    e.Status,
+			Message:   e.Message,
+			Timestamp: parseEventTime(e.Timestamp),
+		})
+	case *SessionStartedEvent:
+		chatEvent = &chat.SessionStartedEvent{
+			SessionID: e.SessionID,
+			Title:     e.Title,
+			Timestamp: parseEventTime(e.Timestamp),
+		}
+	case *SessionSwitchedEvent:
+		chatEvent = &chat.SessionSwitchedEvent{
+			SessionID: e.SessionID,
+			Timestamp: parseEventTime(e.Timestamp),
+		}
+	case *SessionLanguageSetEvent:
+		chatEvent = &chat.SessionLanguageSetEvent{
+			SessionID: e.SessionID,
+			Language:  e.Language,
+			Timestamp: parseEventTime(e.Timestamp),
+		}
+	case *ConversationSummarizedEvent:
+		chatEvent = &chat.ConversationSummarizedEvent{
+			SessionID:       e.SessionID,
+			Summary:         e.Summary,
+			ThroughTime:     parseEventTime(e.ThroughTime),
+			ThroughSequence: e.ThroughSequence,
+			Timestamp:       parseEventTime(e.Timestamp),
+		}
+	case *MessageRedactedEvent:
+		chatEvent = &chat.MessageRedactedEvent{
+			RequestID: e.RequestID,
+			Text:      e.Text,
+			Timestamp: parseEventTime(e.Timestamp),
+		}
+	default:
+		return nil
+	}
+	return chatManager.ApplyChatEvent(chatEvent)
+}
+
+// applyToAll applies a chat event to the chats of every user, for news that concerns them all
+func (cs *ChatState) applyToAll(chatEvent interface{}) error {
+	if err := cs.chatManager.ApplyChatEvent(chatEvent); err != nil {
+		return err
+	}
+	cs.mu.Lock()
+	userChats := make([]*chat.ChatManager, 0, len(cs.userChats))
+	for _, userChat := range cs.userChats {
+		userChats = append(userChats, userChat)
+	}
+	cs.mu.Unlock()
+	for _, userChat := range userChats {
+		if err := userChat.ApplyChatEvent(chatEvent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseEventTime parses an ISO timestamp from an event, returning the zero time if it is missing or invalid
+func parseEventTime(timestamp string) time.Time {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,301 @@
+package orchestration
+
+import (
+	"fmt"
+	"sort"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/internal/chat"
+	"mindpalace/pkg/eventsourcing"
+)
+
+// chatRow is one row of the chat view: a message, the state of an agent or tool call of a request, or the
+// indicator of a request in progress
+type chatRow struct {
+	key       string        // Identifies the row across updates
+	signature string        // Changes when the row has to be rendered again
+	separated bool          // A separator precedes the row
+	request   *chat.Message // The user's request shown in the row, nil unless it can still be edited
+	answer    *chat.Message // MindPalace's answer shown in the row, nil unless it can be rated
+	message   *chat.Message // The user's or MindPalace's message shown in the row, nil unless it can be pinned and redacted
+	render    func() fyne.CanvasObject
+}
+
+// chatRows lists the rows of the owner's chat: each message, followed at the end of its request by the
+// states of the request's agents and tool calls
+func (a *OrchestrationAggregate) chatRows() []chatRow {
+	messages := a.chatState.GetChatManager().GetUIMessages()
+	var rows []chatRow
+	for i, msg := range messages {
+		msg := msg
+		row := chatRow{
+			key:       "message_" + msg.ID,
+			signature: fmt.Sprintf("%s|%v", msg.Content, msg.Metadata),
+			separated: i > 0,
+			render:    func() fyne.CanvasObject { return a.renderChatMessage(msg) },
+		}
+		if _, revised := msg.Metadata["revised_by"]; msg.Role == chat.RoleUser && !revised {
+			row.request = &msg
+		}
+		if msg.Role == chat.RoleMindPalace && msg.RequestID != "" && msg.Metadata["type"] != "confirmation" {
+			row.answer = &msg
+		}
+		if (msg.Role == chat.RoleUser || msg.Role == chat.RoleMindPalace) && msg.Content != eventsourcing.Redacted {
+			row.message = &msg
+		}
+		rows = append(rows, row)
+		if i == len(messages)-1 || messages[i+1].RequestID != msg.RequestID {
+			rows = append(rows, a.requestRows(msg.RequestID)...)
+		}
+	}
+	return rows
+}
+
+// requestRows lists the states of a request's agents and tool calls, and whether it is in progress
+func (a *OrchestrationAggregate) requestRows(requestID string) []chatRow {
+	var rows []chatRow
+	agents := a.fanOutAgentStates(requestID)
+	if agentState, exists := a.AgentStates[requestID]; exists {
+		agents = append([]*AgentState{agentState}, agents...)
+	}
+	for _, agentState := range agents {
+		agentState := agentState
+		rows = append(rows, chatRow{
+			key:       fmt.Sprintf("agent_%s_%s", requestID, agentState.AgentName),
+			signature: fmt.Sprintf("%s|%s", agentState.Status, agentState.Summary),
+			render:    func() fyne.CanvasObject { return a.renderAgentState(agentState) },
+		})
+	}
+	var toolStates []*ToolCallState
+	for _, toolState := range a.ToolCallStates {
+		if toolState.RequestID == requestID {
+			toolStates = append(toolStates, toolState)
+		}
+	}
+	sort.Slice(toolStates, func(i, j int) bool { return toolStates[i].ToolCallID < toolStates[j].ToolCallID })
+	for _, toolState := range toolStates {
+		toolState := toolState
+		rows = append(rows, chatRow{
+			key:       "tool_" + toolState.ToolCallID,
+			signature: fmt.Sprintf("%s|%d|%s|%v", toolState.Status, toolState.Progress, toolState.ProgressMsg, toolState.Results),
+			render:    func() fyne.CanvasObject { return a.renderToolCallState(toolState) },
+		})
+	}
+	if a.isRequestPending(requestID) {
+		rows = append(rows, chatRow{
+			key: "pending_" + requestID,
+			render: func() fyne.CanvasObject {
+				return container.NewHBox(widget.NewProgressBarInfinite(), widget.NewLabel("Processing..."))
+			},
+		})
+	}
+	return rows
+}
+
+// ChatView shows the owner's chat in a list that only renders the rows in sight. Updating it renders
+// again just the rows that changed, and keeps the scroll position unless the view was at the bottom,
+// where it follows new messages.
+type ChatView struct {
+	agg       *OrchestrationAggregate
+	header    *widget.Label
+	list      *widget.List
+	rows      []chatRow
+	rendered  map[string]fyne.CanvasObject // Row key -> row rendered at its current signature
+	heights   map[widget.ListItemID]float32
+	following bool      // The view shows the last rows and follows new ones
+	offset    float32   // Scroll offset after the last update, the user scrolled when it changed
+	size      fyne.Size // Size of the list after the last update, resizing moves the offset too
+	content   fyne.CanvasObject
+
+	// OnEdit is called with the request and text of a message the user chose to edit; the requests
+	// can't be edited when it isn't set
+	OnEdit func(requestID, text string)
+	// OnFeedback is called with the request of an answer the user rated Up or Down; the answers can't be
+	// rated when it isn't set
+	OnFeedback func(requestID, rating string)
+	// OnPin is called with the request and text of a message the user chose to pin; the messages can't be
+	// pinned when it isn't set
+	OnPin func(requestID, text string)
+	// OnRedact is called with the request and text of a message the user chose to redact; the messages can't
+	// be redacted when it isn't set
+	OnRedact func(requestID, text string)
+}
+
+// NewChatView creates a view of the aggregate's chat; call Update when the chat changed
+func NewChatView(agg *OrchestrationAggregate) *ChatView {
+	v := &ChatView{
+		agg:      agg,
+		header:   widget.NewLabel(""),
+		rendered: make(map[string]fyne.CanvasObject),
+		heights:  make(map[widget.ListItemID]float32),
+	}
+	v.header.TextStyle = fyne.TextStyle{Bold: true}
+	v.list = widget.NewList(
+		func() int { return len(v.rows) },
+		// Rows not shown yet are estimated a line high
+		func() fyne.CanvasObject { return container.NewStack(widget.NewLabel("")) },
+		v.updateRow,
+	)
+	v.content = container.NewBorder(container.NewVBox(v.header, widget.NewSeparator()), nil, nil, nil,
+		container.New(followLayout{v}, v.list))
+	v.Update()
+	return v
+}
+
+// Content returns the canvas object showing the chat
+func (v *ChatView) Content() fyne.CanvasObject {
+	return v.content
+}
+
+// Update shows the changes of the chat since the last update
+func (v *ChatView) Update() {
+	cm := v.agg.chatState.GetChatManager()
+	v.header.SetText(fmt.Sprintf("Session: %s | Total Tokens Used: %d", cm.ActiveSession().Title, cm.GetTotalTokens()))
+
+	rows := v.agg.chatRows()
+	changed, reset := diffRows(v.rows, rows)
+	offset := v.list.GetScrollOffset()
+	shown := !v.list.Size().IsZero() // The list can only scroll once laid out
+	if len(v.rows) == 0 || len(rows) == 0 || v.rows[0].key != rows[0].key {
+		v.following = true
+	} else if shown && offset != v.offset && v.list.Size() == v.size {
+		// The user scrolled, the view follows again once they scrolled back to the bottom
+		v.list.ScrollToBottom()
+		v.following = offset >= v.list.GetScrollOffset()-1
+	}
+	lengthChanged := len(rows) != len(v.rows)
+	v.rows = rows
+	keys := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		keys[row.key] = true
+	}
+	for key := range v.rendered {
+		if !keys[key] {
+			delete(v.rendered, key)
+		}
+	}
+	for _, id := range changed {
+		delete(v.rendered, rows[id].key)
+		delete(v.heights, id)
+	}
+
+	switch {
+	case reset:
+		// Rows moved, their heights are measured again as they are shown
+		v.heights = make(map[widget.ListItemID]float32)
+		v.list.Refresh()
+	case lengthChanged:
+		v.list.Refresh() // Rows that didn't change are shown as rendered before
+	default:
+		for _, id := range changed {
+			v.list.RefreshItem(id)
+		}
+	}
+	if !shown {
+		return // The layout scrolls to the bottom when the list is shown
+	}
+	if v.following {
+		v.list.ScrollToBottom()
+	} else {
+		v.list.ScrollToOffset(offset)
+	}
+	v.offset, v.size = v.list.GetScrollOffset(), v.list.Size()
+}
+
+// followLayout gives the list all the space, keeping it at the bottom while the view follows new rows
+type followLayout struct {
+	v *ChatView
+}
+
+func (l followLayout) Layout(objects []fyne.CanvasObject, size fyne.Size) {
+	for _, object := range objects {
+		object.Move(fyne.NewPos(0, 0))
+		object.Resize(size)
+	}
+	if l.v.following && !size.IsZero() {
+		l.v.list.ScrollToBottom()
+		l.v.offset, l.v.size = l.v.list.GetScrollOffset(), l.v.list.Size()
+	}
+}
+
+func (l followLayout) MinSize(objects []fyne.CanvasObject) fyne.Size {
+	return l.v.list.MinSize()
+}
+
+// updateRow shows a row in a list item, rendering it when it changed since it was last rendered
+func (v *ChatView) updateRow(id widget.ListItemID, item fyne.CanvasObject) {
+	if id < 0 || id >= len(v.rows) {
+		return
+	}
+	row := v.rows[id]
+	rendered, ok := v.rendered[row.key]
+	if !ok {
+		rendered = row.render()
+		buttons := container.NewVBox()
+		if row.request != nil && v.OnEdit != nil {
+			request := row.request
+			buttons.Add(widget.NewButtonWithIcon("", theme.DocumentCreateIcon(), func() { v.OnEdit(request.RequestID, request.Content) }))
+		}
+		if row.answer != nil && v.OnFeedback != nil {
+			requestID := row.answer.RequestID
+			up := widget.NewButton("👍", func() { v.OnFeedback(requestID, "up") })
+			down := widget.NewButton("👎", func() { v.OnFeedback(requestID, "down") })
+			up.Importance, down.Importance = widget.LowImportance, widget.LowImportance
+			buttons.Add(up)
+			buttons.Add(down)
+		}
+		if row.message != nil && v.OnPin != nil {
+			message := row.message
+			pin := widget.NewButton("📌", func() { v.OnPin(message.RequestID, message.Content) })
+			pin.Importance = widget.LowImportance
+			buttons.Add(pin)
+		}
+		if row.message != nil && row.message.RequestID != "" && v.OnRedact != nil {
+			message := row.message
+			redact := widget.NewButtonWithIcon("", theme.VisibilityOffIcon(), func() { v.OnRedact(message.RequestID, message.Content) })
+			redact.Importance = widget.LowImportance
+			buttons.Add(redact)
+		}
+		if len(buttons.Objects) > 0 {
+			rendered = container.NewBorder(nil, nil, nil, buttons, rendered)
+		}
+		if row.separated {
+			rendered = container.NewVBox(rendered, widget.NewSeparator())
+		}
+		v.rendered[row.key] = rendered
+	}
+	stack := item.(*fyne.Container)
+	stack.Objects = []fyne.CanvasObject{rendered}
+	stack.Refresh()
+	// Rows are as high as their content at the list's width, wrapped text grows them
+	rendered.Resize(fyne.NewSize(v.list.Size().Width, rendered.MinSize().Height))
+	if height := rendered.MinSize().Height; v.heights[id] != height {
+		v.heights[id] = height
+		v.list.SetItemHeight(id, height)
+	}
+}
+
+// diffRows returns the rows of the next list that changed since the previous one, or reset when rows were added
+// or removed other than at the end, which moves the rows after them.
+func diffRows(prev, next []chatRow) (changed []widget.ListItemID, reset bool) {
+	if len(next) < len(prev) {
+		return nil, true
+	}
+	for i := range next {
+		if i >= len(prev) {
+			changed = append(changed, i)
+			continue
+		}
+		if prev[i].key != next[i].key {
+			return nil, true
+		}
+		if prev[i].signature != next[i].signature || prev[i].separated != next[i].separated {
+			changed = append(changed, i)
+		}
+	}
+	return changed, false
+}
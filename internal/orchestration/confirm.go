@@ -0,0 +1,177 @@
+package orchestration
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Answers accepted in the chat for a tool call waiting for confirmation
+var (
+	approvals = []string{"yes", "y", "yeah", "yep", "sure", "ok", "okay", "confirm", "approve", "do it", "go ahead"}
+	refusals  = []string{"no", "n", "nope", "cancel", "decline", "don't", "dont", "stop", "abort"}
+)
+
+// SetConfirmedCapabilities makes the user approve the commands of plugins whose manifests declare one of the
+// capabilities, e.g. "network", as they approve destructive commands; none only asks for those
+func (ro *RequestOrchestrator) SetConfirmedCapabilities(capabilities []string) {
+	ro.modelsMu.Lock()
+	defer ro.modelsMu.Unlock()
+	ro.confirmed = slices.Clone(capabilities)
+}
+
+// awaitsConfirmation reports whether the tool call needs the user's approval and doesn't have it yet
+func (ro *RequestOrchestrator) awaitsConfirmation(event *ToolCallRequestPlaced) bool {
+	plugin, err := ro.requestPlugins(event.RequestID).GetPluginByCommand(event.Function)
+	if err != nil || plugin == nil || !ro.requiresConfirmation(plugin, event.Function) {
+		return false
+	}
+	state, exists := ro.agg.ToolCallStates[event.ToolCallID]
+	return !exists || !state.Approved
+}
+
+// requiresConfirmation reports whether the command of the plugin is destructive, or the plugin uses a
+// capability the user approves
+func (ro *RequestOrchestrator) requiresConfirmation(plugin eventsourcing.Plugin, command string) bool {
+	if confirmer, ok := plugin.(eventsourcing.Confirmer); ok && confirmer.RequiresConfirmation(command) {
+		return true
+	}
+	manifester, ok := plugin.(eventsourcing.Manifester)
+	if !ok {
+		return false
+	}
+	ro.modelsMu.RLock()
+	defer ro.modelsMu.RUnlock()
+	for _, capability := range manifester.Manifest().Capabilities {
+		if slices.Contains(ro.confirmed, capability) {
+			return true
+		}
+	}
+	return false
+}
+
+// confirmationRequested pauses the tool call until the user answers
+func confirmationRequested(event *ToolCallRequestPlaced) *ToolCallConfirmationRequestedEvent {
+	arguments, _ := json.Marshal(event.Arguments)
+	return &ToolCallConfirmationRequestedEvent{
+		EventType:  "orchestration_ToolCallConfirmationRequested",
+		RequestID:  event.RequestID,
+		ToolCallID: event.ToolCallID,
+		Function:   event.Function,
+		Arguments:  event.Arguments,
+		Prompt:     fmt.Sprintf("Should I run %s with %s? Reply yes or no.", event.Function, arguments),
+		Timestamp:  eventsourcing.ISOTimestamp(),
+	}
+}
+
+// ConfirmToolCallCommand answers a confirmation request. Without a toolCallID it answers the most
+// recent tool call of the user waiting for confirmation.
+func (ro *RequestOrchestrator) ConfirmToolCallCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	approved, ok := data["approved"].(bool)
+	if !ok {
+		return nil, fmt.Errorf("approved must be a boolean")
+	}
+	toolCallID, _ := data["toolCallID"].(string)
+	userID := eventsourcing.UserOf(data)
+
+	state := ro.agg.pendingConfirmation(userID)
+	if toolCallID != "" {
+		state = ro.agg.ToolCallStates[toolCallID]
+	}
+	if state == nil || state.Status != "awaiting_confirmation" {
+		return nil, fmt.Errorf("no tool call waiting for confirmation")
+	}
+	if err := ro.checkRequestUser(userID, state.RequestID); err != nil {
+		return nil, err
+	}
+	return []eventsourcing.Event{toolCallConfirmed(state, approved)}, nil
+}
+
+func toolCallConfirmed(state *ToolCallState, approved bool) *ToolCallConfirmedEvent {
+	return &ToolCallConfirmedEvent{
+		EventType:  "orchestration_ToolCallConfirmed",
+		RequestID:  state.RequestID,
+		ToolCallID: state.ToolCallID,
+		Function:   state.Function,
+		Approved:   approved,
+		Timestamp:  eventsourcing.ISOTimestamp(),
+	}
+}
+
+// ExecuteConfirmedToolCallCommand executes an approved tool call. A declined tool call completes
+// without running, so the request can finish with a response telling the user.
+func (ro *RequestOrchestrator) ExecuteConfirmedToolCallCommand(event *ToolCallConfirmedEvent) ([]eventsourcing.Event, error) {
+	state, exists := ro.agg.ToolCallStates[event.ToolCallID]
+	if !exists {
+		return nil, fmt.Errorf("no state for tool call %s", event.ToolCallID)
+	}
+	if !event.Approved {
+		logger.Info("User declined tool call %s (%s)", event.ToolCallID, event.Function)
+		return []eventsourcing.Event{&ToolCallCompleted{
+			RequestID:  event.RequestID,
+			ToolCallID: event.ToolCallID,
+			Function:   event.Function,
+			Results:    map[string]interface{}{"success": false, "declined": true, "reason": "The user declined to run " + event.Function},
+			Timestamp:  eventsourcing.ISOTimestamp(),
+		}}, nil
+	}
+	return ro.ExecuteToolCallCommand(state.placed())
+}
+
+// placed returns the request placing the tool call again at its current attempt
+func (s *ToolCallState) placed() *ToolCallRequestPlaced {
+	return &ToolCallRequestPlaced{
+		RequestID:  s.RequestID,
+		ToolCallID: s.ToolCallID,
+		Function:   s.Function,
+		Arguments:  s.Arguments,
+		Timestamp:  eventsourcing.ISOTimestamp(),
+		AgentName:  s.AgentName,
+		Attempt:    s.Attempt,
+	}
+}
+
+// confirmationAnswer answers the pending confirmation when the user replied yes or no in the chat,
+// completing the reply itself without asking the LLM. It returns nil for any other request.
+func (ro *RequestOrchestrator) confirmationAnswer(event *UserRequestReceivedEvent) []eventsourcing.Event {
+	state := ro.agg.pendingConfirmation(ro.agg.userOf(event.RequestID))
+	if state == nil {
+		return nil
+	}
+	approved, ok := parseConfirmation(event.RequestText)
+	if !ok {
+		return nil
+	}
+	responseText := fmt.Sprintf("Okay, running %s.", state.Function)
+	if !approved {
+		responseText = fmt.Sprintf("Okay, I won't run %s.", state.Function)
+	}
+	return []eventsourcing.Event{
+		toolCallConfirmed(state, approved),
+		&RequestCompletedEvent{
+			EventType:    "orchestration_RequestCompleted",
+			RequestID:    event.RequestID,
+			ResponseText: responseText,
+			CompletedAt:  eventsourcing.ISOTimestamp(),
+		},
+	}
+}
+
+// parseConfirmation reports whether the text approves or refuses, ok is false for anything else
+func parseConfirmation(text string) (approved bool, ok bool) {
+	answer := strings.Trim(strings.ToLower(strings.TrimSpace(text)), ".!? ")
+	for _, approval := range approvals {
+		if answer == approval {
+			return true, true
+		}
+	}
+	for _, refusal := range refusals {
+		if answer == refusal {
+			return false, true
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,83 @@
+package orchestration
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/llmmodels"
+)
+
+// maxExamples is the number of examples shown to an agent per call, those closest to the request
+const maxExamples = 6
+
+// ExampleSource gives the examples shown to the agent of a plugin for a user
+type ExampleSource interface {
+	ExamplesFor(userID string, plugin eventsourcing.Plugin) []eventsourcing.Example
+}
+
+// SetExampleSource shows the agents the examples of the source, rather than only those of their plugin
+func (ro *RequestOrchestrator) SetExampleSource(source ExampleSource) {
+	ro.exampleSource = source
+}
+
+// examplesOf returns the examples for the agent of a plugin
+func (ro *RequestOrchestrator) examplesOf(userID string, plugin eventsourcing.Plugin) []eventsourcing.Example {
+	if ro.exampleSource != nil {
+		return ro.exampleSource.ExamplesFor(userID, plugin)
+	}
+	if provider, ok := plugin.(eventsourcing.ExampleProvider); ok {
+		return provider.Examples()
+	}
+	return nil
+}
+
+// examplesPrompt returns the part of an agent's prompt showing the examples closest to the request, of the
+// commands it is offered; empty if there are none
+func examplesPrompt(examples []eventsourcing.Example, request string, tools []llmmodels.Tool) string {
+	offered := make(map[string]bool, len(tools))
+	for _, tool := range tools {
+		if name, ok := tool.Function["name"].(string); ok {
+			offered[name] = true
+		}
+	}
+	var shown []eventsourcing.Example
+	for _, example := range examples {
+		if offered[example.Command] {
+			shown = append(shown, example)
+		}
+	}
+	if len(shown) == 0 {
+		return ""
+	}
+	if len(shown) > maxExamples {
+		words := keywords(request)
+		scores := make([]int, len(shown))
+		order := make([]int, len(shown))
+		for i, example := range shown {
+			order[i] = i
+			scores[i] = matchScore(words, keywords(example.Request))
+		}
+		sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+		order = order[:maxExamples]
+		sort.Ints(order)
+		closest := make([]eventsourcing.Example, 0, maxExamples)
+		for _, i := range order {
+			closest = append(closest, shown[i])
+		}
+		shown = closest
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Examples of requests and the tool calls they call for:")
+	for _, example := range shown {
+		arguments, err := json.Marshal(example.Arguments)
+		if err != nil || example.Arguments == nil {
+			arguments = []byte("{}")
+		}
+		fmt.Fprintf(&sb, "\nRequest: %s\nCall: %s %s\n", example.Request, example.Command, arguments)
+	}
+	return sb.String()
+}
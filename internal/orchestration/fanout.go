@@ -0,0 +1,189 @@
+package orchestration
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/llmmodels"
+)
+
+// defaultAgentWorkers bounds how many agents run at the same time in a fan-out
+const defaultAgentWorkers = 4
+
+const mergePromptTemplate = `Several specialized agents worked on the user's latest request. Their contributions are below.
+
+%s
+Combine these contributions into a single, concise answer for the user. Mention failures only if they affect the answer.`
+
+// agentResult is the outcome of one agent run in a fan-out
+type agentResult struct {
+	call    AgentCall
+	events  []eventsourcing.Event
+	summary string
+	err     error
+}
+
+// SetAgentWorkers sets the maximum number of agents executed concurrently for one request
+func (ro *RequestOrchestrator) SetAgentWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	ro.agentWorkers = n
+}
+
+// ExecuteAgentFanOutCommand runs all agents of a fan-out concurrently and merges their results
+// into a single RequestCompletedEvent. Agents only compute events; the returned events are
+// published in order once every agent is done, so aggregates are never updated concurrently.
+func (ro *RequestOrchestrator) ExecuteAgentFanOutCommand(event *AgentFanOutStartedEvent) ([]eventsourcing.Event, error) {
+	results := make([]agentResult, len(event.Calls))
+	sem := make(chan struct{}, ro.agentWorkers)
+	var wg sync.WaitGroup
+	for i, call := range event.Calls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, call AgentCall) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer func() {
+				if r := recover(); r != nil {
+					results[i] = agentResult{call: call, err: fmt.Errorf("agent panicked: %v", r)}
+				}
+			}()
+			results[i] = ro.runAgent(event.RequestID, call)
+		}(i, call)
+	}
+	wg.Wait()
+
+	var events []eventsourcing.Event
+	var contributions strings.Builder
+	succeeded := 0
+	for _, result := range results {
+		events = append(events, result.events...)
+		if result.err != nil {
+			logger.Error("Agent %s failed for request %s: %v", result.call.AgentName, event.RequestID, result.err)
+			events = append(events, &AgentExecutionFailedEvent{
+				EventType:   "orchestration_AgentExecutionFailed",
+				RequestID:   event.RequestID,
+				AgentName:   result.call.AgentName,
+				ErrorMsg:    result.err.Error(),
+				Timestamp:   eventsourcing.ISOTimestamp(),
+				Recoverable: false,
+			})
+			fmt.Fprintf(&contributions, "### %s\nFailed: %v\n\n", result.call.AgentName, result.err)
+			continue
+		}
+		succeeded++
+		events = append(events, &AgentCallCompletedEvent{
+			RequestID: event.RequestID,
+			AgentName: result.call.AgentName,
+			Summary:   result.summary,
+			Timestamp: eventsourcing.ISOTimestamp(),
+		})
+		fmt.Fprintf(&contributions, "### %s\n%s\n\n", result.call.AgentName, result.summary)
+	}
+	if kept, cancelled := ro.cancelledEvents(event.RequestID, events...); cancelled {
+		return kept, nil
+	}
+
+	responseText, usageEvent, err := ro.mergeAgentResults(event.RequestID, contributions.String(), succeeded)
+	if kept, cancelled := ro.cancelledEvents(event.RequestID, append(events, usageEvent)...); cancelled {
+		return kept, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if usageEvent != nil {
+		events = append(events, usageEvent)
+	}
+	events = append(events, &RequestCompletedEvent{
+		EventType:    "orchestration_RequestCompleted",
+		RequestID:    event.RequestID,
+		ResponseText: responseText,
+		CompletedAt:  eventsourcing.ISOTimestamp(),
+	})
+	return events, nil
+}
+
+// runAgent calls one agent and executes the tool calls it requests
+func (ro *RequestOrchestrator) runAgent(requestID string, call AgentCall) agentResult {
+	result := agentResult{call: call}
+	plugin, err := ro.requestPlugins(requestID).GetPlugin(call.AgentName)
+	if err != nil || plugin == nil {
+		result.err = fmt.Errorf("agent %s not found: %v", call.AgentName, err)
+		return result
+	}
+
+	resp, usageEvent, err := ro.CallPluginAgent(plugin, call.Query, requestID)
+	if err != nil {
+		result.err = fmt.Errorf("plugin call failed: %v", err)
+		return result
+	}
+	result.events = append(result.events, usageEvent)
+
+	var summary strings.Builder
+	if content := strings.TrimSpace(resp.Message.Content); content != "" {
+		summary.WriteString(content)
+		summary.WriteString("\n")
+	}
+	for i, toolCall := range resp.Message.ToolCalls {
+		placed := &ToolCallRequestPlaced{
+			RequestID:  requestID,
+			Function:   toolCall.Function.Name,
+			Arguments:  toolCall.Function.Arguments,
+			Timestamp:  eventsourcing.ISOTimestamp(),
+			ToolCallID: fmt.Sprintf("%s-%s-toolrequest-%d", requestID, call.AgentName, i),
+			AgentName:  call.AgentName,
+		}
+		toolEvents, err := ro.executeToolCallWithRetry(placed)
+		if err != nil {
+			result.err = fmt.Errorf("tool call %s failed: %v", toolCall.Function.Name, err)
+			return result
+		}
+		result.events = append(result.events, placed)
+		result.events = append(result.events, toolEvents...)
+		summary.WriteString(describeToolOutcome(toolCall.Function.Name, toolEvents))
+	}
+	result.summary = strings.TrimSpace(summary.String())
+	if result.summary == "" {
+		result.summary = "No response."
+	}
+	return result
+}
+
+// describeToolOutcome summarizes a tool call from the events of its last attempt
+func describeToolOutcome(function string, events []eventsourcing.Event) string {
+	for i := len(events) - 1; i >= 0; i-- {
+		switch e := events[i].(type) {
+		case *ToolCallFailedEvent:
+			return fmt.Sprintf("- %s failed: %s\n", function, e.ErrorMsg)
+		case *ToolCallConfirmationRequestedEvent:
+			return fmt.Sprintf("- %s is waiting for the user's confirmation\n", function)
+		case *ToolCallCompleted:
+			results, _ := e.Results["result"].([]eventsourcing.Event)
+			return fmt.Sprintf("- %s succeeded with %d event(s)\n", function, len(results))
+		}
+	}
+	return fmt.Sprintf("- %s returned no result\n", function)
+}
+
+// mergeAgentResults asks the LLM to combine the agents' contributions into one answer. The usage
+// event is nil when no LLM call was needed.
+func (ro *RequestOrchestrator) mergeAgentResults(requestID, contributions string, succeeded int) (string, eventsourcing.Event, error) {
+	if succeeded == 0 {
+		return fmt.Sprintf("I encountered errors while processing your request:\n\n%s", strings.TrimSpace(contributions)), nil, nil
+	}
+	chatManager := ro.requestChat(requestID)
+	chatManager.SetSystemPrompt(ro.systemPrompt(requestID))
+	messages := chatManager.GetLLMContextWithTags(nil, []string{"task", "completion", "response"})
+	messages = append(messages, llmmodels.Message{
+		Role:    "system",
+		Content: fmt.Sprintf(mergePromptTemplate, contributions),
+	})
+	resp, usageEvent, err := ro.callLLM(messages, nil, requestID, "", "merge")
+	if err != nil {
+		return "", nil, fmt.Errorf("error merging agent results: %w", err)
+	}
+	return resp.Message.Content, usageEvent, nil
+}
@@ -0,0 +1,54 @@
+package orchestration
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/llmmodels"
+)
+
+// provideGenerators lets the plugins implementing eventsourcing.Generator have the LLM write text,
+// including the users' own instances of them
+func (ro *RequestOrchestrator) provideGenerators() {
+	userIDs := []string{""}
+	if users, ok := ro.pluginManager.(UserPluginManager); ok {
+		userIDs = append(userIDs, users.Users()...)
+	}
+	for _, userID := range userIDs {
+		for _, plugin := range ro.pluginsOf(userID).GetLLMPlugins() {
+			if generator, ok := plugin.(eventsourcing.Generator); ok {
+				generator.SetGenerateFunc(ro.generateFor(userID, plugin))
+			}
+		}
+	}
+}
+
+// generateFor returns the function answering prompts for a user's plugin with its agent model. The
+// tokens the answers use are recorded under the plugin's name, like those of its agent.
+func (ro *RequestOrchestrator) generateFor(userID string, plugin eventsourcing.Plugin) eventsourcing.GenerateFunc {
+	return ro.generate(userID, plugin.Name(), ro.agentModel(plugin))
+}
+
+// GenerateFunc returns the function answering prompts for a user outside of a request with the router's
+// model, e.g. to write a briefing. The tokens the answers use are recorded under purpose.
+func (ro *RequestOrchestrator) GenerateFunc(userID, purpose string) eventsourcing.GenerateFunc {
+	return ro.generate(userID, purpose, "")
+}
+
+func (ro *RequestOrchestrator) generate(userID, purpose, model string) eventsourcing.GenerateFunc {
+	return func(prompt string) (string, error) {
+		requestID := fmt.Sprintf("%s_generate_%d", purpose, time.Now().UnixNano())
+		defer ro.releaseRequest(requestID)
+		messages := []llmmodels.Message{{Role: "user", Content: prompt}}
+		resp, usageEvent, err := ro.callLLM(messages, nil, requestID, model, purpose)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate text for %s: %w", purpose, err)
+		}
+		usageEvent.Metadata().UserID = userID
+		ro.eventBus.Publish(usageEvent)
+		_, text := parseResponseText(resp.Message.Content)
+		return strings.TrimSpace(text), nil
+	}
+}
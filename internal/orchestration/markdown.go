@@ -0,0 +1,368 @@
+package orchestration
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// markdown parses Markdown as GitHub writes it, with tables and bare links
+var markdown = goldmark.New(goldmark.WithExtensions(extension.Table, extension.Linkify))
+
+// RenderMarkdown shows Markdown in the desktop app: headings, paragraphs with emphasis, code and links, lists,
+// block quotes, tables and fenced code blocks highlighted by their language
+func RenderMarkdown(markdownText string) fyne.CanvasObject {
+	source := []byte(markdownText)
+	blocks := renderBlocks(source, markdown.Parser().Parse(text.NewReader(source)))
+	if len(blocks) == 1 {
+		return blocks[0]
+	}
+	return container.NewVBox(blocks...)
+}
+
+// renderBlocks renders the blocks a node contains, one canvas object each
+func renderBlocks(source []byte, parent ast.Node) []fyne.CanvasObject {
+	var blocks []fyne.CanvasObject
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		if block := renderBlock(source, n); block != nil {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+func renderBlock(source []byte, n ast.Node) fyne.CanvasObject {
+	switch node := n.(type) {
+	case *ast.Paragraph, *ast.TextBlock:
+		return newRichText(inlineSegments(source, n, widget.RichTextStyleInline)...)
+	case *ast.Heading:
+		style := widget.RichTextStyleParagraph
+		switch node.Level {
+		case 1:
+			style = widget.RichTextStyleHeading
+		case 2:
+			style = widget.RichTextStyleSubHeading
+		default:
+			style.TextStyle.Bold = true
+		}
+		return newRichText(&widget.TextSegment{Style: style, Text: plainText(source, n)})
+	case *ast.List:
+		return newRichText(listSegment(source, node))
+	case *ast.Blockquote:
+		bar := canvas.NewRectangle(theme.Color(theme.ColorNamePrimary))
+		bar.SetMinSize(fyne.NewSize(theme.Padding(), 0))
+		return container.NewBorder(nil, nil, bar, nil, container.NewVBox(renderBlocks(source, n)...))
+	case *ast.FencedCodeBlock:
+		return renderCode(codeText(source, n), string(node.Language(source)))
+	case *ast.CodeBlock:
+		return renderCode(codeText(source, n), "")
+	case *extast.Table:
+		return renderTable(source, node)
+	case *ast.ThematicBreak:
+		return widget.NewSeparator()
+	case *ast.HTMLBlock:
+		return newRichText(&widget.TextSegment{Style: widget.RichTextStyleParagraph, Text: codeText(source, n)})
+	}
+	return nil
+}
+
+// newRichText creates rich text wrapping at word boundaries
+func newRichText(segments ...widget.RichTextSegment) *widget.RichText {
+	richText := widget.NewRichText(segments...)
+	richText.Wrapping = fyne.TextWrapWord
+	return richText
+}
+
+// listSegment lists the items of a list, nesting the lists within them
+func listSegment(source []byte, list *ast.List) *widget.ListSegment {
+	segment := &widget.ListSegment{Ordered: list.IsOrdered()}
+	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+		for child := item.FirstChild(); child != nil; child = child.NextSibling() {
+			switch node := child.(type) {
+			case *ast.List:
+				segment.Items = append(segment.Items, listSegment(source, node))
+			case *ast.FencedCodeBlock, *ast.CodeBlock:
+				segment.Items = append(segment.Items, &widget.TextSegment{Style: widget.RichTextStyleCodeBlock, Text: codeText(source, child)})
+			default:
+				segment.Items = append(segment.Items, &widget.ParagraphSegment{Texts: inlineSegments(source, child, widget.RichTextStyleInline)})
+			}
+		}
+	}
+	return segment
+}
+
+// inlineSegments renders the inline content of a node in the given style, emphasis adding to it
+func inlineSegments(source []byte, parent ast.Node, style widget.RichTextStyle) []widget.RichTextSegment {
+	var segments []widget.RichTextSegment
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		switch node := n.(type) {
+		case *ast.Text:
+			value := string(node.Segment.Value(source))
+			if node.HardLineBreak() {
+				value += "\n"
+			} else if node.SoftLineBreak() {
+				value += " "
+			}
+			segments = append(segments, &widget.TextSegment{Style: style, Text: value})
+		case *ast.String:
+			segments = append(segments, &widget.TextSegment{Style: style, Text: string(node.Value)})
+		case *ast.Emphasis:
+			emphasized := style
+			if node.Level == 2 {
+				emphasized.TextStyle.Bold = true
+			} else {
+				emphasized.TextStyle.Italic = true
+			}
+			segments = append(segments, inlineSegments(source, n, emphasized)...)
+		case *ast.CodeSpan:
+			segments = append(segments, &widget.TextSegment{Style: widget.RichTextStyleCodeInline, Text: plainText(source, n)})
+		case *ast.Link:
+			segments = append(segments, linkSegment(plainText(source, n), string(node.Destination), style))
+		case *ast.AutoLink:
+			segments = append(segments, linkSegment(string(node.Label(source)), string(node.URL(source)), style))
+		case *ast.Image:
+			segments = append(segments, linkSegment(plainText(source, n), string(node.Destination), style))
+		case *ast.RawHTML:
+			segments = append(segments, &widget.TextSegment{Style: style, Text: codeText(source, n)})
+		default:
+			segments = append(segments, inlineSegments(source, n, style)...)
+		}
+	}
+	return segments
+}
+
+// linkSegment links text to an address, or shows just the text when the address is not a URL
+func linkSegment(label, address string, style widget.RichTextStyle) widget.RichTextSegment {
+	link, err := url.Parse(address)
+	if err != nil || address == "" {
+		return &widget.TextSegment{Style: style, Text: label}
+	}
+	return &widget.HyperlinkSegment{Alignment: fyne.TextAlignLeading, Text: label, URL: link}
+}
+
+// renderTable lays out a table in a grid, its header in bold and the cells aligned as the table says
+func renderTable(source []byte, table *extast.Table) fyne.CanvasObject {
+	grid := container.NewGridWithColumns(len(table.Alignments))
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		_, header := row.(*extast.TableHeader)
+		column := 0
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			style := widget.RichTextStyleInline
+			style.TextStyle.Bold = header
+			if column < len(table.Alignments) {
+				switch table.Alignments[column] {
+				case extast.AlignCenter:
+					style.Alignment = fyne.TextAlignCenter
+				case extast.AlignRight:
+					style.Alignment = fyne.TextAlignTrailing
+				}
+			}
+			grid.Add(newRichText(inlineSegments(source, cell, style)...))
+			column++
+		}
+		// Rows with fewer cells than the table has columns are padded
+		for ; column < len(table.Alignments); column++ {
+			grid.Add(widget.NewLabel(""))
+		}
+	}
+	return container.NewVBox(grid, widget.NewSeparator())
+}
+
+// renderCode shows code unwrapped and highlighted on a background, scrolling sideways when it is wide
+func renderCode(code, language string) fyne.CanvasObject {
+	background := canvas.NewRectangle(theme.Color(theme.ColorNameInputBackground))
+	background.CornerRadius = theme.InputRadiusSize()
+	code = strings.TrimSuffix(code, "\n")
+	return container.NewStack(background, container.NewPadded(container.NewHScroll(widget.NewRichText(highlightCode(code, language)...))))
+}
+
+// plainText returns the text of a node without its formatting
+func plainText(source []byte, n ast.Node) string {
+	var text strings.Builder
+	ast.Walk(n, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := child.(type) {
+		case *ast.Text:
+			text.Write(node.Segment.Value(source))
+			if node.SoftLineBreak() || node.HardLineBreak() {
+				text.WriteString(" ")
+			}
+		case *ast.String:
+			text.Write(node.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return text.String()
+}
+
+// codeText returns the lines of a code block or raw HTML as written
+func codeText(source []byte, n ast.Node) string {
+	var code strings.Builder
+	var lines *text.Segments
+	if raw, ok := n.(*ast.RawHTML); ok {
+		lines = raw.Segments
+	} else {
+		lines = n.Lines()
+	}
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		code.Write(segment.Value(source))
+	}
+	return code.String()
+}
+
+// codeSyntax is what the highlighter colors in a language
+type codeSyntax struct {
+	keywords      map[string]bool
+	lineComment   string
+	blockComments bool // /* */ comments
+	backquotes    bool // `raw strings`
+}
+
+// codeSyntaxes are the languages fenced code blocks name most, by the names they are given
+var codeSyntaxes = func() map[string]codeSyntax {
+	words := func(list string) map[string]bool {
+		set := make(map[string]bool)
+		for _, word := range strings.Fields(list) {
+			set[word] = true
+		}
+		return set
+	}
+	golang := codeSyntax{keywords: words("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false"), lineComment: "//", blockComments: true, backquotes: true}
+	python := codeSyntax{keywords: words("and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield None True False"), lineComment: "#"}
+	javascript := codeSyntax{keywords: words("async await break case catch class const continue default delete do else export extends finally for function if import in instanceof interface let new null of return switch this throw try type typeof undefined var void while yield true false"), lineComment: "//", blockComments: true, backquotes: true}
+	shell := codeSyntax{keywords: words("if then else elif fi for in do done while until case esac function return export local echo"), lineComment: "#"}
+	sql := codeSyntax{keywords: words("select from where and or not insert into values update set delete create table drop alter join left right inner outer on group by order having limit as distinct null is in like primary key SELECT FROM WHERE AND OR NOT INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER JOIN LEFT RIGHT INNER OUTER ON GROUP BY ORDER HAVING LIMIT AS DISTINCT NULL IS IN LIKE PRIMARY KEY"), lineComment: "--"}
+	json := codeSyntax{keywords: words("true false null")}
+	return map[string]codeSyntax{
+		"go": golang, "golang": golang,
+		"python": python, "py": python,
+		"javascript": javascript, "js": javascript, "typescript": javascript, "ts": javascript,
+		"sh": shell, "bash": shell, "shell": shell, "zsh": shell,
+		"sql":  sql,
+		"json": json,
+	}
+}()
+
+// highlightCode colors the keywords, strings, comments and numbers of code in the language, or shows it plain
+// when the language is unknown
+func highlightCode(code, language string) []widget.RichTextSegment {
+	syntax, known := codeSyntaxes[strings.ToLower(strings.TrimSpace(language))]
+	if !known {
+		return []widget.RichTextSegment{codeSegment(code, "")}
+	}
+	var segments []widget.RichTextSegment
+	var plain strings.Builder
+	add := func(token string, color fyne.ThemeColorName) {
+		if plain.Len() > 0 {
+			segments = append(segments, codeSegment(plain.String(), ""))
+			plain.Reset()
+		}
+		segments = append(segments, codeSegment(token, color))
+	}
+	runes := []rune(code)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		end := i + 1
+		switch {
+		case syntax.lineComment != "" && hasPrefixAt(runes, i, syntax.lineComment):
+			end = indexFrom(runes, i, "\n", false)
+			add(string(runes[i:end]), theme.ColorNamePlaceHolder)
+		case syntax.blockComments && hasPrefixAt(runes, i, "/*"):
+			end = indexFrom(runes, i+2, "*/", true)
+			add(string(runes[i:end]), theme.ColorNamePlaceHolder)
+		case r == '"' || r == '\'' || (r == '`' && syntax.backquotes):
+			end = stringEnd(runes, i)
+			add(string(runes[i:end]), theme.ColorNameSuccess)
+		case unicode.IsDigit(r) && (i == 0 || !isIdentRune(runes[i-1])):
+			for end < len(runes) && (isIdentRune(runes[end]) || runes[end] == '.') {
+				end++
+			}
+			add(string(runes[i:end]), theme.ColorNameWarning)
+		case isIdentRune(r):
+			for end < len(runes) && isIdentRune(runes[end]) {
+				end++
+			}
+			if word := string(runes[i:end]); syntax.keywords[word] {
+				add(word, theme.ColorNamePrimary)
+			} else {
+				plain.WriteString(word)
+			}
+		default:
+			plain.WriteRune(r)
+		}
+		i = end
+	}
+	if plain.Len() > 0 {
+		segments = append(segments, codeSegment(plain.String(), ""))
+	}
+	return segments
+}
+
+// codeSegment shows code in monospace, in a color of the theme or the foreground color
+func codeSegment(code string, color fyne.ThemeColorName) *widget.TextSegment {
+	return &widget.TextSegment{Style: widget.RichTextStyle{
+		ColorName: color,
+		Inline:    true,
+		SizeName:  theme.SizeNameText,
+		TextStyle: fyne.TextStyle{Monospace: true},
+	}, Text: code}
+}
+
+// indexFrom returns where the marker is found from a position on, past it if included, or the end of the runes
+func indexFrom(runes []rune, from int, marker string, included bool) int {
+	for i := from; i < len(runes); i++ {
+		if hasPrefixAt(runes, i, marker) {
+			if included {
+				return i + len([]rune(marker))
+			}
+			return i
+		}
+	}
+	return len(runes)
+}
+
+// hasPrefixAt reports whether the runes continue with the prefix at a position
+func hasPrefixAt(runes []rune, at int, prefix string) bool {
+	for _, r := range prefix {
+		if at >= len(runes) || runes[at] != r {
+			return false
+		}
+		at++
+	}
+	return true
+}
+
+// stringEnd returns where the string starting at a quote ends, past its closing quote; strings other than raw
+// strings end at the end of the line when they are not closed
+func stringEnd(runes []rune, start int) int {
+	quote := runes[start]
+	for i := start + 1; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\' && quote != '`':
+			i++
+		case runes[i] == quote:
+			return i + 1
+		case runes[i] == '\n' && quote != '`':
+			return i
+		}
+	}
+	return len(runes)
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -1,9 +1,31 @@
 package orchestration
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
-
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/test"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"mindpalace/internal/auth"
+	"mindpalace/internal/briefing"
+	"mindpalace/internal/chat"
+	"mindpalace/internal/llmprocessor"
+	"mindpalace/internal/plugingenerator"
+	"mindpalace/internal/usage"
 	"mindpalace/pkg/eventsourcing"
 	"mindpalace/pkg/llmmodels"
 )
@@ -14,7 +36,7 @@ type mockLLMClient struct {
 	responses map[string]*llmmodels.OllamaResponse
 }
 
-func (m *mockLLMClient) CallLLM(messages []llmmodels.Message, tools []llmmodels.Tool, requestID, model string) (*llmmodels.OllamaResponse, error) {
+func (m *mockLLMClient) CallLLM(ctx context.Context, messages []llmmodels.Message, tools []llmmodels.Tool, requestID, model string) (*llmmodels.OllamaResponse, error) {
 	if resp, ok := m.responses[requestID]; ok {
 		return resp, nil
 	}
@@ -27,6 +49,18 @@ func (m *mockLLMClient) CallLLM(messages []llmmodels.Message, tools []llmmodels.
 	}, nil
 }
 
+// withoutUsage checks that a command recorded the tokens of its LLM call first and returns the other events
+func withoutUsage(t *testing.T, events []eventsourcing.Event) []eventsourcing.Event {
+	t.Helper()
+	if len(events) == 0 {
+		t.Fatalf("Expected a TokenUsageRecordedEvent, got no events")
+	}
+	if _, ok := events[0].(*usage.TokenUsageRecordedEvent); !ok {
+		t.Fatalf("Expected TokenUsageRecordedEvent first, got %T", events[0])
+	}
+	return events[1:]
+}
+
 type mockPluginManager struct {
 	plugins map[string]eventsourcing.Plugin
 }
@@ -323,16 +357,207 @@ func TestBroadcast3DDelta(t *testing.T) {
 
 // RequestOrchestrator tests require full interface implementations, skipped for now
 
+// mockPluginBuilder is a plugin manager creating plugins, failing at the given stage
+type mockPluginBuilder struct {
+	mockPluginManager
+	failAt    string
+	stages    []string
+	discarded []string
+}
+
+func (m *mockPluginBuilder) stage(stage, dir string) error {
+	m.stages = append(m.stages, stage)
+	if stage == m.failAt {
+		return fmt.Errorf("%s of %s broke", stage, dir)
+	}
+	return nil
+}
+
+func (m *mockPluginBuilder) GeneratePlugin(req *plugingenerator.PluginRequirements) (string, error) {
+	return "plugins/" + req.Name, m.stage("generate", req.Name)
+}
+func (m *mockPluginBuilder) BuildPlugin(dir string) error { return m.stage("compile", dir) }
+func (m *mockPluginBuilder) TestPlugin(dir string) error  { return m.stage("test", dir) }
+func (m *mockPluginBuilder) InstallPlugin(dir string) (eventsourcing.Plugin, error) {
+	if err := m.stage("load", dir); err != nil {
+		return nil, err
+	}
+	plugin := &mockPlugin{name: "drinks", commands: map[string]eventsourcing.CommandHandler{"LogDrink": nil, "ListDrinks": nil}}
+	m.plugins[plugin.name] = plugin
+	return plugin, nil
+}
+func (m *mockPluginBuilder) DiscardPlugin(dir string) error {
+	m.discarded = append(m.discarded, dir)
+	return nil
+}
+
+// sequenceLLMClient answers the calls with its responses in turn
+type sequenceLLMClient struct {
+	responses []string
+	calls     [][]llmmodels.Message
+}
+
+func (m *sequenceLLMClient) CallLLM(ctx context.Context, messages []llmmodels.Message, tools []llmmodels.Tool, requestID, model string) (*llmmodels.OllamaResponse, error) {
+	m.calls = append(m.calls, messages)
+	content := m.responses[min(len(m.calls), len(m.responses))-1]
+	return &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{Content: content}, Done: true}, nil
+}
+
+const drinksDesign = `<think>A drinks tracker</think>{"name": "drinks", "description": "Tracks drinks.",
+	"entities": [{"name": "Drink", "fields": [{"name": "Name", "type": "string"}, {"name": "Volume", "type": "int"}]}],
+	"commands": [{"name": "LogDrink", "action": "create"}, {"name": "ListDrinks", "action": "list"}]}`
+
+func newPluginCreationOrchestrator(llmClient LLMClientInterface, failAt string) (*RequestOrchestrator, *mockPluginBuilder, *[]*PluginCreationProgressEvent) {
+	builder := &mockPluginBuilder{
+		mockPluginManager: mockPluginManager{plugins: map[string]eventsourcing.Plugin{
+			"tasks": &mockPlugin{name: "tasks", commands: map[string]eventsourcing.CommandHandler{"CreateTask": nil}},
+		}},
+		failAt: failAt,
+	}
+	ep := &mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}
+	eb := &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)}
+	progress := &[]*PluginCreationProgressEvent{}
+	eb.Subscribe("orchestration_PluginCreationProgress", func(event eventsourcing.Event) error {
+		*progress = append(*progress, event.(*PluginCreationProgressEvent))
+		return nil
+	})
+	return NewRequestOrchestrator(llmClient, builder, NewOrchestrationAggregate(), ep, eb), builder, progress
+}
+
+func TestDecideAgentCallCommand_CreatePlugin(t *testing.T) {
+	llmClient := &mockLLMClient{
+		responses: map[string]*llmmodels.OllamaResponse{
+			"req1": {Message: llmmodels.OllamaMessage{ToolCalls: []llmmodels.OllamaToolCall{{Function: llmmodels.OllamaFunction{
+				Name:      createPluginToolName,
+				Arguments: map[string]interface{}{"name": "drinks", "description": "Track drinks"},
+			}}}}},
+		},
+	}
+	ro, _, _ := newPluginCreationOrchestrator(llmClient, "")
+	tools := ro.gatherAgentTools("", "")
+	if tools[1].Function["name"] != createPluginToolName {
+		t.Errorf("Expected the CreatePlugin tool to be offered, got %v", tools[1].Function["name"])
+	}
+
+	events, err := ro.DecideAgentCallCommand(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "make a plugin for my drinks"})
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	events = withoutUsage(t, events)
+	creation, ok := events[0].(*InitiatePluginCreationEvent)
+	if len(events) != 1 || !ok {
+		t.Fatalf("Expected InitiatePluginCreationEvent, got %v", events)
+	}
+	if creation.PluginName != "drinks" || creation.Description != "Track drinks" || creation.Goal != "make a plugin for my drinks" {
+		t.Errorf("Unexpected creation event %+v", creation)
+	}
+
+	// Without a builder the tool is not offered
+	if tools := newFanOutOrchestrator(&mockLLMClient{}, nil).gatherAgentTools("", ""); len(tools) != 1 {
+		t.Errorf("Expected only the undo tool, got %d tools", len(tools))
+	}
+}
+
 func TestInitiatePluginCreationCommand(t *testing.T) {
-	// Test the saga command
-	data := map[string]interface{}{"test": "data"}
-	events, err := InitiatePluginCreationCommand(data)
+	llmClient := &sequenceLLMClient{responses: []string{drinksDesign}}
+	ro, builder, progress := newPluginCreationOrchestrator(llmClient, "")
+
+	events, err := ro.InitiatePluginCreationCommand(&InitiatePluginCreationEvent{RequestID: "req1", Goal: "make a plugin for my drinks"})
 	if err != nil {
 		t.Fatalf("InitiatePluginCreationCommand failed: %v", err)
 	}
-	// It returns nil, nil
-	if events != nil {
-		t.Errorf("Expected nil events, got %v", events)
+	events = withoutUsage(t, events)
+	if len(events) != 2 {
+		t.Fatalf("Expected PluginCreated and RequestCompleted, got %v", events)
+	}
+	created, ok := events[0].(*PluginCreatedEvent)
+	if !ok || created.PluginName != "drinks" || strings.Join(created.Commands, ",") != "ListDrinks,LogDrink" {
+		t.Errorf("Unexpected %+v", events[0])
+	}
+	if completed, ok := events[1].(*RequestCompletedEvent); !ok || !strings.Contains(completed.ResponseText, "created the drinks plugin") {
+		t.Errorf("Unexpected %+v", events[1])
+	}
+	if got := strings.Join(builder.stages, ","); got != "generate,compile,test,load" {
+		t.Errorf("Expected every stage to run, got %s", got)
+	}
+	var stages []string
+	for _, event := range *progress {
+		stages = append(stages, event.Stage)
+	}
+	if got := strings.Join(stages, ","); got != "design,generate,compile,test,load" {
+		t.Errorf("Expected progress of every stage, got %s", got)
+	}
+	if (*progress)[0].PluginName != "new plugin" || (*progress)[1].PluginName != "drinks" {
+		t.Errorf("Unexpected plugin names in progress %+v", *progress)
+	}
+
+	// Progress is shown in the chat
+	ro.agg.ApplyEvent(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "make a plugin for my drinks", Timestamp: "2023-01-01T00:00:00Z"})
+	ro.agg.ApplyEvent((*progress)[2])
+	messages := ro.agg.GetChatManager().GetUIMessages()
+	if len(messages) == 0 || messages[len(messages)-1].Content != "Plugin drinks: compiling" {
+		t.Errorf("Expected the progress in the chat, got %+v", messages)
+	}
+}
+
+func TestInitiatePluginCreationCommand_RedesignsRejectedDesign(t *testing.T) {
+	clashing := strings.Replace(drinksDesign, `"LogDrink"`, `"CreateTask"`, 1)
+	llmClient := &sequenceLLMClient{responses: []string{"I would suggest a drinks plugin.", clashing, drinksDesign}}
+	ro, _, _ := newPluginCreationOrchestrator(llmClient, "")
+
+	events, _ := ro.InitiatePluginCreationCommand(&InitiatePluginCreationEvent{RequestID: "req1", Goal: "track drinks"})
+	if failed, ok := events[len(events)-2].(*PluginCreationFailedEvent); !ok || failed.Stage != "design" || !strings.Contains(failed.ErrorMsg, "tasks plugin") {
+		t.Fatalf("Expected the design to fail after %d attempts, got %+v", designAttempts, events)
+	}
+	feedback := llmClient.calls[1][len(llmClient.calls[1])-1].Content
+	if !strings.Contains(feedback, "no JSON object") {
+		t.Errorf("Expected the rejection to be fed back, got %q", feedback)
+	}
+
+	llmClient = &sequenceLLMClient{responses: []string{"{not json", drinksDesign}}
+	ro, _, _ = newPluginCreationOrchestrator(llmClient, "")
+	events, _ = ro.InitiatePluginCreationCommand(&InitiatePluginCreationEvent{RequestID: "req2", Goal: "track drinks"})
+	if _, ok := events[len(events)-2].(*PluginCreatedEvent); !ok || len(llmClient.calls) != 2 {
+		t.Errorf("Expected the second design to be created, got %+v", events)
+	}
+}
+
+func TestInitiatePluginCreationCommand_FailedStageDiscardsPlugin(t *testing.T) {
+	ro, builder, _ := newPluginCreationOrchestrator(&sequenceLLMClient{responses: []string{drinksDesign}}, "test")
+
+	events, err := ro.InitiatePluginCreationCommand(&InitiatePluginCreationEvent{RequestID: "req1", Goal: "track drinks"})
+	if err != nil {
+		t.Fatalf("InitiatePluginCreationCommand failed: %v", err)
+	}
+	events = withoutUsage(t, events)
+	failed, ok := events[0].(*PluginCreationFailedEvent)
+	if !ok || failed.Stage != "test" || failed.PluginName != "drinks" {
+		t.Fatalf("Expected the test stage to fail, got %v", events)
+	}
+	if _, ok := events[1].(*RequestCompletedEvent); !ok {
+		t.Errorf("Expected the request to complete, got %T", events[1])
+	}
+	if len(builder.discarded) != 1 || builder.discarded[0] != "plugins/drinks" {
+		t.Errorf("Expected the generated plugin to be discarded, got %v", builder.discarded)
+	}
+	if _, exists := builder.plugins["drinks"]; exists {
+		t.Error("Expected the failed plugin not to be installed")
+	}
+
+	ro.agg.ApplyEvent(failed)
+	if info := ro.agg.DisplayInfos["plugin_creation_req1"]; info != nil {
+		t.Errorf("Expected no display info without the initiating event, got %+v", info)
+	}
+}
+
+func TestInitiatePluginCreationCommand_WithoutBuilder(t *testing.T) {
+	ro := newFanOutOrchestrator(&mockLLMClient{}, nil)
+	events, err := ro.InitiatePluginCreationCommand(&InitiatePluginCreationEvent{RequestID: "req1"})
+	if err != nil || len(events) != 1 {
+		t.Fatalf("Expected the request to complete, got %v, %v", events, err)
+	}
+	if _, ok := events[0].(*RequestCompletedEvent); !ok {
+		t.Errorf("Expected RequestCompletedEvent, got %T", events[0])
 	}
 }
 
@@ -372,6 +597,7 @@ func TestOrchestrationFlow_UserRequestToCompletion(t *testing.T) {
 	if err != nil {
 		t.Fatalf("DecideAgentCallCommand failed: %v", err)
 	}
+	decideEvents = withoutUsage(t, decideEvents)
 	if len(decideEvents) != 1 {
 		t.Fatalf("Expected 1 event, got %d", len(decideEvents))
 	}
@@ -455,6 +681,7 @@ func TestOrchestrationFlow_WithToolCalls(t *testing.T) {
 	if err != nil {
 		t.Fatalf("DecideAgentCallCommand failed: %v", err)
 	}
+	decideEvents = withoutUsage(t, decideEvents)
 	if len(decideEvents) != 1 {
 		t.Fatalf("Expected 1 event, got %d", len(decideEvents))
 	}
@@ -478,6 +705,7 @@ func TestOrchestrationFlow_WithToolCalls(t *testing.T) {
 	if err != nil {
 		t.Fatalf("ExecuteAgentCall failed: %v", err)
 	}
+	executeEvents = withoutUsage(t, executeEvents)
 	if len(executeEvents) != 1 {
 		t.Fatalf("Expected 1 event, got %d", len(executeEvents))
 	}
@@ -860,6 +1088,32 @@ func TestProcessUserRequestCommand(t *testing.T) {
 	}
 }
 
+func TestProcessUserRequestCommand_EditsARequest(t *testing.T) {
+	agg := NewOrchestrationAggregate()
+	ep := &mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}
+	eb := &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)}
+	ro := NewRequestOrchestrator(&mockLLMClient{}, &mockPluginManager{}, agg, ep, eb)
+	agg.ApplyEvent(&SessionStartedEvent{SessionID: "shopping", Title: "Shopping", Timestamp: "2023-01-01T00:00:00Z"})
+	agg.ApplyEvent(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "add mlk to the list", SessionID: "shopping", Timestamp: "2023-01-01T00:00:01Z"})
+	agg.ApplyEvent(&SessionStartedEvent{SessionID: "work", Title: "Work", Timestamp: "2023-01-01T00:00:02Z"})
+
+	events, err := ro.ProcessUserRequestCommand(map[string]interface{}{"requestText": "add milk to the list", "requestID": "req2", "revises": "req1"})
+	if err != nil {
+		t.Fatalf("Failed to edit the request: %v", err)
+	}
+	revision := events[0].(*UserRequestReceivedEvent)
+	if revision.Revises != "req1" || revision.SessionID != "shopping" {
+		t.Errorf("Expected a revision of req1 in its session, got %+v", revision)
+	}
+	agg.ApplyEvent(revision)
+
+	for name, revises := range map[string]string{"unknown request": "req9", "edited before": "req1"} {
+		if _, err := ro.ProcessUserRequestCommand(map[string]interface{}{"requestText": "add milk", "revises": revises}); err == nil {
+			t.Errorf("%s: expected the edit to be refused", name)
+		}
+	}
+}
+
 func TestDecideAgentCallCommand_NoAgents(t *testing.T) {
 	llmClient := &mockLLMClient{}
 	pm := &mockPluginManager{}
@@ -878,6 +1132,7 @@ func TestDecideAgentCallCommand_NoAgents(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed: %v", err)
 	}
+	events = withoutUsage(t, events)
 	if len(events) != 1 {
 		t.Fatalf("Expected 1 event, got %d", len(events))
 	}
@@ -913,6 +1168,76 @@ func TestExecuteToolCallCommand_NoPlugin(t *testing.T) {
 	}
 }
 
+// mockToolServer offers a search tool, answering with the query it was called with
+type mockToolServer struct {
+	calls []string
+	users []string // Users of the calls
+	err   error
+}
+
+func (m *mockToolServer) Tools() []llmmodels.Tool {
+	return []llmmodels.Tool{{Type: "function", Function: map[string]interface{}{"name": "search", "description": "Searches the web"}}}
+}
+
+func (m *mockToolServer) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (string, error) {
+	m.calls = append(m.calls, name)
+	m.users = append(m.users, auth.UserOf(ctx))
+	if m.err != nil {
+		return "", m.err
+	}
+	return fmt.Sprintf("results for %v", arguments["query"]), nil
+}
+
+func TestExecuteToolCallCommand_ToolServer(t *testing.T) {
+	pm := &mockPluginManager{}
+	ep := &mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}
+	eb := &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)}
+	ro := NewRequestOrchestrator(&mockLLMClient{}, pm, NewOrchestrationAggregate(), ep, eb)
+	server := &mockToolServer{}
+	ro.AttachToolServer("web", server, []string{"taskmanager"})
+
+	tools := ro.gatherPluginTools(&mockPlugin{name: "taskmanager"}, "search the web")
+	if len(tools) != 1 || tools[0].Function["name"] != "web__search" || tools[0].Function["description"] != "Searches the web" {
+		t.Fatalf("Expected the server's tool named after the server, got %v", tools)
+	}
+	if tools := ro.gatherPluginTools(&mockPlugin{name: "calendar"}, "search the web"); len(tools) != 0 {
+		t.Errorf("Expected the tool offered to the named agents only, got %v", tools)
+	}
+
+	placed := &ToolCallRequestPlaced{
+		RequestID:  "req1",
+		ToolCallID: "tool1",
+		Function:   "web__search",
+		Arguments:  map[string]interface{}{"query": "dentists"},
+	}
+	placed.Metadata().UserID = "alice"
+	events, err := ro.ExecuteToolCallCommand(placed)
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected Started + Completed, got %d events", len(events))
+	}
+	completed, ok := events[1].(*ToolCallCompleted)
+	if !ok || completed.Results["result"] != "results for dentists" {
+		t.Errorf("Expected the server's result recorded, got %#v", events[1])
+	}
+	if len(server.calls) != 1 || server.calls[0] != "search" || server.users[0] != "alice" {
+		t.Errorf("Expected the tool called by its own name for alice, got %v for %v", server.calls, server.users)
+	}
+
+	server.err = eventsourcing.MarkRetriable(fmt.Errorf("rate limited"))
+	events, _ = ro.ExecuteToolCallCommand(placed)
+	if failed, ok := events[len(events)-1].(*ToolCallFailedEvent); !ok || !failed.Transient || !strings.Contains(failed.ErrorMsg, "rate limited") {
+		t.Errorf("Expected a transient failure, got %#v", events[len(events)-1])
+	}
+	server.err = fmt.Errorf("unknown argument page")
+	events, _ = ro.ExecuteToolCallCommand(placed)
+	if failed, ok := events[len(events)-1].(*ToolCallFailedEvent); !ok || failed.Transient || failed.WillRetry {
+		t.Errorf("Expected a permanent failure, got %#v", events[len(events)-1])
+	}
+}
+
 func TestCompleteRequestCommand_Pending(t *testing.T) {
 	llmClient := &mockLLMClient{}
 	pm := &mockPluginManager{}
@@ -963,3 +1288,2142 @@ func TestCompleteRequestWithErrorCommand(t *testing.T) {
 		t.Errorf("Expected RequestCompletedEvent")
 	}
 }
+
+func TestChatHistory_RebuiltFromPersistedEvents(t *testing.T) {
+	store, err := eventsourcing.NewSQLiteEventStore(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	defer store.Close()
+
+	err = store.Append(
+		&UserRequestReceivedEvent{RequestID: "req1", RequestText: "Hello", Timestamp: "2023-01-01T00:00:00Z"},
+		&RequestCompletedEvent{RequestID: "req1", ResponseText: "<think>hmm</think>Hi there", CompletedAt: "2023-01-01T00:00:05Z"},
+		&UserRequestReceivedEvent{RequestID: "req2", RequestText: "Again", Timestamp: "2023-01-01T00:00:05Z"},
+	)
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	// Simulate a restart: reload the log and replay it into a fresh aggregate
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	agg := NewOrchestrationAggregate()
+	for _, event := range store.GetEvents() {
+		if err := agg.ApplyEvent(event); err != nil {
+			t.Fatalf("ApplyEvent failed: %v", err)
+		}
+	}
+
+	messages := agg.GetChatManager().GetUIMessages()
+	expected := []string{"Hello", "Hi there", "Again"}
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %d messages, got %d: %v", len(expected), len(messages), messages)
+	}
+	for i, content := range expected {
+		if messages[i].Content != content {
+			t.Errorf("Message %d: expected %q, got %q", i, content, messages[i].Content)
+		}
+	}
+	if want := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC); !messages[0].Timestamp.Equal(want) {
+		t.Errorf("Expected original timestamp %v, got %v", want, messages[0].Timestamp)
+	}
+}
+
+// concurrentLLMClient answers agent calls by model and records how many calls run at once
+type concurrentLLMClient struct {
+	mu            sync.Mutex
+	active        int
+	maxActive     int
+	mergeMessages []llmmodels.Message
+}
+
+func (m *concurrentLLMClient) CallLLM(ctx context.Context, messages []llmmodels.Message, tools []llmmodels.Tool, requestID, model string) (*llmmodels.OllamaResponse, error) {
+	if model == "" {
+		m.mu.Lock()
+		m.mergeMessages = messages
+		m.mu.Unlock()
+		return &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{Content: "Merged response"}, Done: true}, nil
+	}
+
+	m.mu.Lock()
+	m.active++
+	if m.active > m.maxActive {
+		m.maxActive = m.active
+	}
+	m.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	m.mu.Lock()
+	m.active--
+	m.mu.Unlock()
+
+	if model == "failing-model" {
+		return nil, fmt.Errorf("model unavailable")
+	}
+	return &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{Content: "Answer from " + model}, Done: true}, nil
+}
+
+func newFanOutOrchestrator(llmClient LLMClientInterface, agentModels map[string]string) *RequestOrchestrator {
+	plugins := make(map[string]eventsourcing.Plugin)
+	for name, model := range agentModels {
+		plugins[name] = &mockPlugin{name: name, systemPrompt: name + " prompt", model: model}
+	}
+	pm := &mockPluginManager{plugins: plugins}
+	ep := &mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}
+	eb := &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)}
+	return NewRequestOrchestrator(llmClient, pm, NewOrchestrationAggregate(), ep, eb)
+}
+
+func TestDecideAgentCallCommand_MultipleAgentsFanOut(t *testing.T) {
+	toolCall := func(name string) llmmodels.OllamaToolCall {
+		return llmmodels.OllamaToolCall{Function: llmmodels.OllamaFunction{Name: name, Arguments: map[string]interface{}{"query": "test"}}}
+	}
+	llmClient := &mockLLMClient{
+		responses: map[string]*llmmodels.OllamaResponse{
+			"req1": {Message: llmmodels.OllamaMessage{ToolCalls: []llmmodels.OllamaToolCall{toolCall("tasks"), toolCall("calendar")}}},
+		},
+	}
+	ro := newFanOutOrchestrator(llmClient, map[string]string{"tasks": "model-a", "calendar": "model-b"})
+
+	events, err := ro.DecideAgentCallCommand(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "test"})
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	events = withoutUsage(t, events)
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	fanOut, ok := events[0].(*AgentFanOutStartedEvent)
+	if !ok {
+		t.Fatalf("Expected AgentFanOutStartedEvent, got %T", events[0])
+	}
+	if len(fanOut.Calls) != 2 || fanOut.Calls[0].AgentName != "tasks" || fanOut.Calls[1].Model != "model-b" {
+		t.Errorf("Unexpected calls: %+v", fanOut.Calls)
+	}
+}
+
+func TestDecideAgentCallCommand_ConfiguredAgentModel(t *testing.T) {
+	toolCall := func(name string) llmmodels.OllamaToolCall {
+		return llmmodels.OllamaToolCall{Function: llmmodels.OllamaFunction{Name: name, Arguments: map[string]interface{}{"query": "test"}}}
+	}
+	llmClient := &mockLLMClient{
+		responses: map[string]*llmmodels.OllamaResponse{
+			"req1": {Message: llmmodels.OllamaMessage{ToolCalls: []llmmodels.OllamaToolCall{toolCall("tasks"), toolCall("calendar")}}},
+		},
+	}
+	ro := newFanOutOrchestrator(llmClient, map[string]string{"tasks": "model-a", "calendar": "model-b"})
+	ro.SetAgentModels(map[string]string{"tasks": "configured-model"})
+
+	events, err := ro.DecideAgentCallCommand(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "test"})
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	fanOut := withoutUsage(t, events)[0].(*AgentFanOutStartedEvent)
+	if fanOut.Calls[0].Model != "configured-model" || fanOut.Calls[1].Model != "model-b" {
+		t.Errorf("Expected the configured model to override the plugin's, got %+v", fanOut.Calls)
+	}
+}
+
+func TestExecuteAgentFanOutCommand(t *testing.T) {
+	llmClient := &concurrentLLMClient{}
+	agents := map[string]string{"a": "model-a", "b": "model-b", "c": "model-c", "d": "failing-model"}
+	ro := newFanOutOrchestrator(llmClient, agents)
+	ro.SetAgentWorkers(2)
+
+	event := &AgentFanOutStartedEvent{RequestID: "req1", Timestamp: "2023-01-01T00:00:00Z"}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		event.Calls = append(event.Calls, AgentCall{AgentName: name, Model: agents[name], Query: "test"})
+	}
+	if err := ro.agg.ApplyEvent(event); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+
+	events, err := ro.ExecuteAgentFanOutCommand(event)
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	if llmClient.maxActive > 2 {
+		t.Errorf("Expected at most 2 concurrent agents, got %d", llmClient.maxActive)
+	}
+
+	var completed []string
+	var failed []string
+	var responses []string
+	for _, e := range events {
+		switch e := e.(type) {
+		case *AgentCallCompletedEvent:
+			completed = append(completed, e.AgentName)
+		case *AgentExecutionFailedEvent:
+			failed = append(failed, e.AgentName)
+		case *RequestCompletedEvent:
+			responses = append(responses, e.ResponseText)
+		}
+	}
+	if fmt.Sprint(completed) != "[a b c]" {
+		t.Errorf("Expected agents a, b and c to complete in call order, got %v", completed)
+	}
+	if fmt.Sprint(failed) != "[d]" {
+		t.Errorf("Expected agent d to fail, got %v", failed)
+	}
+	if len(responses) != 1 || responses[0] != "Merged response" {
+		t.Errorf("Expected a single merged response, got %v", responses)
+	}
+	if _, ok := events[len(events)-1].(*RequestCompletedEvent); !ok {
+		t.Errorf("Expected RequestCompletedEvent last, got %T", events[len(events)-1])
+	}
+	mergePrompt := llmClient.mergeMessages[len(llmClient.mergeMessages)-1].Content
+	if !strings.Contains(mergePrompt, "Answer from model-b") || !strings.Contains(mergePrompt, "model unavailable") {
+		t.Errorf("Merge prompt misses agent contributions: %s", mergePrompt)
+	}
+
+	for _, e := range events {
+		if err := ro.agg.ApplyEvent(e); err != nil {
+			t.Fatalf("ApplyEvent failed: %v", err)
+		}
+	}
+	fanOut := ro.agg.FanOuts["req1"]
+	if fanOut.Status != "completed" || fanOut.Agents["a"].Status != "completed" || fanOut.Agents["d"].Status != "failed" {
+		t.Errorf("Unexpected fan-out state: %+v", fanOut)
+	}
+	if ro.agg.isRequestPending("req1") {
+		t.Error("Expected fan-out request to be finished")
+	}
+}
+
+func TestExecuteAgentFanOutCommand_AllFailed(t *testing.T) {
+	llmClient := &concurrentLLMClient{}
+	ro := newFanOutOrchestrator(llmClient, map[string]string{"a": "failing-model"})
+
+	events, err := ro.ExecuteAgentFanOutCommand(&AgentFanOutStartedEvent{
+		RequestID: "req1",
+		Calls:     []AgentCall{{AgentName: "a", Query: "test"}, {AgentName: "missing", Query: "test"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	completed, ok := events[len(events)-1].(*RequestCompletedEvent)
+	if !ok {
+		t.Fatalf("Expected RequestCompletedEvent last, got %T", events[len(events)-1])
+	}
+	if !strings.Contains(completed.ResponseText, "encountered errors") {
+		t.Errorf("Expected error response, got %q", completed.ResponseText)
+	}
+	if llmClient.mergeMessages != nil {
+		t.Error("Expected no merge call when every agent failed")
+	}
+}
+
+type mockCommandInput struct{}
+
+func (mockCommandInput) New() any                       { return &map[string]interface{}{} }
+func (mockCommandInput) Schema() map[string]interface{} { return map[string]interface{}{} }
+
+// schemaPlugin is a mockPlugin whose commands can be executed as tool calls
+type schemaPlugin struct {
+	mockPlugin
+}
+
+func (p *schemaPlugin) Schemas() map[string]eventsourcing.CommandInput {
+	schemas := make(map[string]eventsourcing.CommandInput)
+	for name := range p.commands {
+		schemas[name] = mockCommandInput{}
+	}
+	return schemas
+}
+
+func TestToolCallConflictIsRetried(t *testing.T) {
+	agg := NewOrchestrationAggregate()
+	ep := &mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}
+	eb := &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)}
+	ro := NewRequestOrchestrator(&mockLLMClient{}, &mockPluginManager{plugins: map[string]eventsourcing.Plugin{}}, agg, ep, eb)
+	ro.sleep = func(time.Duration) {}
+	ep.commands["ExecuteToolCall"] = eventsourcing.NewCommand(func(event *ToolCallRequestPlaced) ([]eventsourcing.Event, error) {
+		return nil, &eventsourcing.ConflictError{Aggregate: "taskmanager", Expected: 4, Actual: 5}
+	})
+	var failures []*ToolCallFailedEvent
+	eb.Subscribe("orchestration_ToolCallFailed", func(event eventsourcing.Event) error {
+		failures = append(failures, event.(*ToolCallFailedEvent))
+		return nil
+	})
+
+	placed := &ToolCallRequestPlaced{RequestID: "req1", ToolCallID: "tool1", Function: "UpdateTask"}
+	agg.ApplyEvent(placed)
+	eb.Publish(placed)
+
+	if len(failures) != 1 || !failures[0].Transient || !failures[0].WillRetry || failures[0].Attempt != 1 {
+		t.Fatalf("Expected a transient failure to be retried, got %+v", failures)
+	}
+	if commands := ep.GetExecutedCommands(); commands[len(commands)-1] != "RetryToolCall" {
+		t.Errorf("Expected the tool call to be retried, executed %v", commands)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 3, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{10, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+	if !policy.ShouldRetry(3) || policy.ShouldRetry(4) {
+		t.Error("Expected retries for the first three attempts only")
+	}
+}
+
+func TestToolCallRetry(t *testing.T) {
+	calls := 0
+	plugin := &schemaPlugin{mockPlugin{
+		name: "flaky",
+		commands: map[string]eventsourcing.CommandHandler{
+			"flakyCommand": eventsourcing.NewCommand(func(input *map[string]interface{}) ([]eventsourcing.Event, error) {
+				calls++
+				if calls < 3 {
+					return nil, eventsourcing.MarkRetriable(fmt.Errorf("temporarily unavailable"))
+				}
+				return nil, nil
+			}),
+		},
+	}}
+	pm := &mockPluginManager{plugins: map[string]eventsourcing.Plugin{"flaky": plugin}}
+	agg := NewOrchestrationAggregate()
+	ep := &mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}
+	eb := &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)}
+	ro := NewRequestOrchestrator(&mockLLMClient{}, pm, agg, ep, eb)
+	var delays []time.Duration
+	ro.sleep = func(d time.Duration) { delays = append(delays, d) }
+
+	placed := &ToolCallRequestPlaced{
+		RequestID:  "req1",
+		ToolCallID: "tool1",
+		Function:   "flakyCommand",
+		Arguments:  map[string]interface{}{"key": "value"},
+	}
+	agg.ApplyEvent(placed)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		events, err := ro.ExecuteToolCallCommand(placed)
+		if err != nil {
+			t.Fatalf("Failed: %v", err)
+		}
+		failed, ok := events[len(events)-1].(*ToolCallFailedEvent)
+		if !ok {
+			t.Fatalf("Attempt %d: expected ToolCallFailedEvent, got %T", attempt, events[len(events)-1])
+		}
+		if failed.Attempt != attempt || !failed.Transient || !failed.WillRetry {
+			t.Errorf("Attempt %d: unexpected failure %+v", attempt, failed)
+		}
+		agg.ApplyEvent(failed)
+		if agg.ToolCallStates["tool1"].Status != "retrying" || !agg.isRequestPending("req1") {
+			t.Errorf("Attempt %d: expected pending retry, got status %s", attempt, agg.ToolCallStates["tool1"].Status)
+		}
+
+		retryEvents, err := ro.RetryToolCallCommand(failed)
+		if err != nil {
+			t.Fatalf("Retry failed: %v", err)
+		}
+		placed = retryEvents[0].(*ToolCallRequestPlaced)
+		if placed.Attempt != attempt+1 || placed.Arguments["key"] != "value" {
+			t.Errorf("Unexpected retry request: %+v", placed)
+		}
+		agg.ApplyEvent(placed)
+		if agg.ToolCallStates["tool1"].Attempt != attempt+1 {
+			t.Errorf("Expected attempt %d in state, got %d", attempt+1, agg.ToolCallStates["tool1"].Attempt)
+		}
+	}
+
+	events, err := ro.ExecuteToolCallCommand(placed)
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	if _, ok := events[len(events)-1].(*ToolCallCompleted); !ok {
+		t.Errorf("Expected ToolCallCompleted on third attempt, got %T", events[len(events)-1])
+	}
+	if fmt.Sprint(delays) != "[1s 2s]" {
+		t.Errorf("Expected exponential backoff delays, got %v", delays)
+	}
+
+	// Exhausted retries fail permanently
+	ro.SetRetryPolicy(RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond})
+	calls = 0
+	events, err = ro.executeToolCallWithRetry(&ToolCallRequestPlaced{RequestID: "req2", ToolCallID: "tool2", Function: "flakyCommand"})
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	failed, ok := events[len(events)-1].(*ToolCallFailedEvent)
+	if !ok || failed.WillRetry || failed.Attempt != 2 {
+		t.Errorf("Expected permanent failure after one retry, got %+v", events[len(events)-1])
+	}
+}
+
+func TestToolCallValidationErrorIsNotRetried(t *testing.T) {
+	calls := 0
+	plugin := &schemaPlugin{mockPlugin{
+		name: "strict",
+		commands: map[string]eventsourcing.CommandHandler{
+			"strictCommand": eventsourcing.NewCommand(func(input *map[string]interface{}) ([]eventsourcing.Event, error) {
+				calls++
+				return nil, fmt.Errorf("task 42 not found")
+			}),
+		},
+	}}
+	pm := &mockPluginManager{plugins: map[string]eventsourcing.Plugin{"strict": plugin}}
+	ep := &mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}
+	eb := &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)}
+	ro := NewRequestOrchestrator(&mockLLMClient{}, pm, NewOrchestrationAggregate(), ep, eb)
+	var delays []time.Duration
+	ro.sleep = func(d time.Duration) { delays = append(delays, d) }
+
+	events, err := ro.executeToolCallWithRetry(&ToolCallRequestPlaced{RequestID: "req1", ToolCallID: "tool1", Function: "strictCommand"})
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	failed, ok := events[len(events)-1].(*ToolCallFailedEvent)
+	if !ok || failed.Transient || failed.WillRetry || failed.Attempt != 1 {
+		t.Errorf("Expected a permanent failure on the first attempt, got %+v", events[len(events)-1])
+	}
+	if calls != 1 || len(delays) != 0 {
+		t.Errorf("Expected one call without waiting, got %d calls waiting %v", calls, delays)
+	}
+}
+
+// noteRemovedEvent and noteAddedEvent are plugin events used to test undo
+type noteRemovedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Note      string `json:"note"`
+}
+
+func (e *noteRemovedEvent) Type() string { return "notes_NoteRemoved" }
+func (e *noteRemovedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *noteRemovedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type noteAddedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Note      string `json:"note"`
+}
+
+func (e *noteAddedEvent) Type() string { return "notes_NoteAdded" }
+func (e *noteAddedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *noteAddedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// notesAggregate undoes removed notes by adding them again
+type notesAggregate struct{}
+
+func (a *notesAggregate) ID() string                                 { return "notes" }
+func (a *notesAggregate) ApplyEvent(event eventsourcing.Event) error { return nil }
+func (a *notesAggregate) GetCustomUI() fyne.CanvasObject             { return nil }
+func (a *notesAggregate) Compensate(event eventsourcing.Event) ([]eventsourcing.Event, error) {
+	if e, ok := event.(*noteRemovedEvent); ok {
+		return []eventsourcing.Event{&noteAddedEvent{Note: e.Note}}, nil
+	}
+	return nil, nil
+}
+
+// notesPlugin is a mockPlugin whose aggregate supports undo
+type notesPlugin struct {
+	mockPlugin
+}
+
+func (p *notesPlugin) Aggregate() eventsourcing.Aggregate { return &notesAggregate{} }
+
+func TestDecideAgentCallCommand_Undo(t *testing.T) {
+	llmClient := &mockLLMClient{
+		responses: map[string]*llmmodels.OllamaResponse{
+			"req1": {Message: llmmodels.OllamaMessage{ToolCalls: []llmmodels.OllamaToolCall{{Function: llmmodels.OllamaFunction{Name: undoToolName}}}}},
+		},
+	}
+	ro := newFanOutOrchestrator(llmClient, map[string]string{"tasks": "model-a"})
+
+	events, err := ro.DecideAgentCallCommand(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "undo that"})
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	events = withoutUsage(t, events)
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	if _, ok := events[0].(*UndoRequestedEvent); !ok {
+		t.Errorf("Expected UndoRequestedEvent, got %T", events[0])
+	}
+}
+
+func TestUndoLastActionCommand(t *testing.T) {
+	eventsourcing.RegisterEvent("notes_NoteRemoved", func() eventsourcing.Event { return &noteRemovedEvent{} })
+	plugin := &notesPlugin{mockPlugin{
+		name:     "notes",
+		commands: map[string]eventsourcing.CommandHandler{"RemoveNote": nil, "ListNotes": nil},
+	}}
+	pm := &mockPluginManager{plugins: map[string]eventsourcing.Plugin{"notes": plugin}}
+	agg := NewOrchestrationAggregate()
+	ep := &mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}
+	eb := &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)}
+	ro := NewRequestOrchestrator(&mockLLMClient{}, pm, agg, ep, eb)
+
+	runToolCall := func(requestID, function string, result interface{}) {
+		toolCallID := requestID + "-toolrequest-0"
+		agg.ApplyEvent(&UserRequestReceivedEvent{RequestID: requestID, RequestText: function})
+		agg.ApplyEvent(&AgentCallDecidedEvent{RequestID: requestID, AgentName: "notes"})
+		agg.ApplyEvent(&ToolCallRequestPlaced{RequestID: requestID, ToolCallID: toolCallID, Function: function})
+		agg.ApplyEvent(&ToolCallCompleted{RequestID: requestID, ToolCallID: toolCallID, Function: function, Results: map[string]interface{}{"success": true, "result": result}})
+	}
+	// Results as restored from the event store, followed by a request that only reads
+	runToolCall("req1", "RemoveNote", []interface{}{map[string]interface{}{"event_type": "notes_NoteRemoved", "note": "milk"}})
+	runToolCall("req2", "ListNotes", []eventsourcing.Event{&noteAddedEvent{Note: "listed"}})
+	agg.ApplyEvent(&UserRequestReceivedEvent{RequestID: "req3", RequestText: "undo that"})
+
+	events, err := ro.UndoLastActionCommand(&UndoRequestedEvent{RequestID: "req3"})
+	if err != nil {
+		t.Fatalf("UndoLastActionCommand failed: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected compensation, undone and completed events, got %d: %v", len(events), events)
+	}
+	if added, ok := events[0].(*noteAddedEvent); !ok || added.Note != "milk" {
+		t.Errorf("Expected the removed note to be added again, got %+v", events[0])
+	}
+	undone, ok := events[1].(*ActionUndoneEvent)
+	if !ok || undone.UndoneRequestID != "req1" {
+		t.Fatalf("Expected req1 to be undone, got %+v", events[1])
+	}
+	for _, event := range events {
+		agg.ApplyEvent(event)
+	}
+
+	// The undone request and the undo itself are skipped the next time
+	agg.ApplyEvent(&UserRequestReceivedEvent{RequestID: "req4", RequestText: "undo that"})
+	events, err = ro.UndoLastActionCommand(&UndoRequestedEvent{RequestID: "req4"})
+	if err != nil {
+		t.Fatalf("UndoLastActionCommand failed: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected only a completed event, got %d", len(events))
+	}
+	if completed := events[0].(*RequestCompletedEvent); !strings.Contains(completed.ResponseText, "nothing to undo") {
+		t.Errorf("Unexpected response: %s", completed.ResponseText)
+	}
+}
+
+func TestSessionCommands(t *testing.T) {
+	agg := NewOrchestrationAggregate()
+	ep := &mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}
+	eb := &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)}
+	ro := NewRequestOrchestrator(&mockLLMClient{}, &mockPluginManager{}, agg, ep, eb)
+
+	events, err := ro.StartSessionCommand(map[string]interface{}{"title": "Trip planning"})
+	if err != nil {
+		t.Fatalf("StartSessionCommand failed: %v", err)
+	}
+	started := events[0].(*SessionStartedEvent)
+	agg.ApplyEvent(started)
+	if active := agg.GetChatManager().ActiveSession(); active.ID != started.SessionID || active.Title != "Trip planning" {
+		t.Errorf("Expected the new session to be active, got %+v", active)
+	}
+
+	// Requests are recorded in the active session
+	events, _ = ro.ProcessUserRequestCommand(map[string]interface{}{"requestText": "book a hotel", "requestID": "req1", "speaker": "Speaker 2"})
+	if request := events[0].(*UserRequestReceivedEvent); request.SessionID != started.SessionID || request.Speaker != "Speaker 2" {
+		t.Errorf("Expected request of Speaker 2 in session %s, got %+v", started.SessionID, request)
+	}
+
+	if _, err := ro.SwitchSessionCommand(map[string]interface{}{"sessionID": "missing"}); err == nil {
+		t.Error("Expected an error switching to an unknown session")
+	}
+	events, err = ro.SwitchSessionCommand(map[string]interface{}{"sessionID": "default"})
+	if err != nil {
+		t.Fatalf("SwitchSessionCommand failed: %v", err)
+	}
+	agg.ApplyEvent(events[0])
+
+	events, _ = ro.ListSessionsCommand(map[string]interface{}{})
+	listed := events[0].(*SessionsListedEvent)
+	if len(listed.Sessions) != 2 || listed.ActiveSessionID != "default" {
+		t.Errorf("Unexpected sessions listed: %+v", listed)
+	}
+
+	// The language is set on the active session unless another is named
+	events, err = ro.SetSessionLanguageCommand(map[string]interface{}{"language": "Dutch", "sessionID": started.SessionID})
+	if err != nil {
+		t.Fatalf("SetSessionLanguageCommand failed: %v", err)
+	}
+	agg.ApplyEvent(events[0])
+	events, _ = ro.SetSessionLanguageCommand(map[string]interface{}{"language": "auto"})
+	if set := events[0].(*SessionLanguageSetEvent); set.SessionID != "default" || set.Language != "" {
+		t.Errorf("Expected auto to clear the language of the active session, got %+v", set)
+	}
+	for _, session := range agg.GetChatManager().ListSessions() {
+		if session.ID == started.SessionID && session.Language != "Dutch" {
+			t.Errorf("Expected the session to respond in Dutch, got %q", session.Language)
+		}
+	}
+	if _, err := ro.SetSessionLanguageCommand(map[string]interface{}{"language": "Dutch", "sessionID": "missing"}); err == nil {
+		t.Error("Expected an error setting the language of an unknown session")
+	}
+}
+
+func TestCallLLM_RecordsTokenUsage(t *testing.T) {
+	llmClient := &mockLLMClient{
+		responses: map[string]*llmmodels.OllamaResponse{
+			"reported": {Message: llmmodels.OllamaMessage{Content: "hi"}, Done: true, Model: "llama3", PromptEvalCount: 120, EvalCount: 30},
+		},
+	}
+	ro := NewRequestOrchestrator(llmClient, &mockPluginManager{}, NewOrchestrationAggregate(),
+		&mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)},
+		&mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)})
+	messages := []llmmodels.Message{{Role: "user", Content: "How many tokens is this prompt?"}}
+
+	_, event, err := ro.callLLM(messages, nil, "reported", "gpt-4", "router")
+	if err != nil {
+		t.Fatalf("callLLM failed: %v", err)
+	}
+	reported := event.(*usage.TokenUsageRecordedEvent)
+	if reported.Model != "llama3" || reported.PromptTokens != 120 || reported.CompletionTokens != 30 || reported.Estimated {
+		t.Errorf("Expected the reported counts of llama3, got %+v", reported)
+	}
+	if reported.RequestID != "reported" || reported.Purpose != "router" {
+		t.Errorf("Expected request and purpose to be recorded, got %+v", reported)
+	}
+
+	_, event, err = ro.callLLM(messages, nil, "estimated", "gpt-4", "completion")
+	if err != nil {
+		t.Fatalf("callLLM failed: %v", err)
+	}
+	estimated := event.(*usage.TokenUsageRecordedEvent)
+	if estimated.Model != "gpt-4" || !estimated.Estimated || estimated.PromptTokens == 0 || estimated.CompletionTokens == 0 {
+		t.Errorf("Expected estimated counts for gpt-4, got %+v", estimated)
+	}
+}
+
+// recordingLLMClient records the messages of the last LLM call
+type recordingLLMClient struct {
+	messages []llmmodels.Message
+}
+
+func (m *recordingLLMClient) CallLLM(ctx context.Context, messages []llmmodels.Message, tools []llmmodels.Tool, requestID, model string) (*llmmodels.OllamaResponse, error) {
+	m.messages = messages
+	return &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{Content: "Done"}, Done: true}, nil
+}
+
+func TestExecuteAgentCall_IncludesAgentHistoryOfSession(t *testing.T) {
+	llmClient := &recordingLLMClient{}
+	ro := newFanOutOrchestrator(llmClient, map[string]string{"taskmanager": "model-a"})
+
+	history := []eventsourcing.Event{
+		&UserRequestReceivedEvent{RequestID: "req1", RequestText: "Add a task to buy milk", Timestamp: "2023-01-01T00:00:00Z"},
+		&AgentCallDecidedEvent{RequestID: "req1", AgentName: "taskmanager", CallAgent: true, Query: "Create a task to buy milk", Timestamp: "2023-01-01T00:00:01Z"},
+		&ToolCallRequestPlaced{RequestID: "req1", ToolCallID: "req1-toolrequest-0", Function: "CreateTask", Arguments: map[string]interface{}{"Title": "Buy milk"}, Timestamp: "2023-01-01T00:00:02Z"},
+		&ToolCallCompleted{RequestID: "req1", ToolCallID: "req1-toolrequest-0", Function: "CreateTask", Results: map[string]interface{}{"TaskID": "task_1"}, Timestamp: "2023-01-01T00:00:03Z"},
+		&RequestCompletedEvent{RequestID: "req1", ResponseText: "Created the task", CompletedAt: "2023-01-01T00:00:04Z"},
+		&UserRequestReceivedEvent{RequestID: "req2", RequestText: "Mark it done", Timestamp: "2023-01-01T00:01:00Z"},
+	}
+	for _, event := range history {
+		if err := ro.agg.ApplyEvent(event); err != nil {
+			t.Fatalf("ApplyEvent failed: %v", err)
+		}
+	}
+	decided := &AgentCallDecidedEvent{RequestID: "req2", AgentName: "taskmanager", CallAgent: true, Query: "Complete the milk task", Timestamp: "2023-01-01T00:01:01Z"}
+	if err := ro.agg.ApplyEvent(decided); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+
+	if _, err := ro.ExecuteAgentCall(decided); err != nil {
+		t.Fatalf("ExecuteAgentCall failed: %v", err)
+	}
+
+	var got []string
+	for _, msg := range llmClient.messages[1:] {
+		got = append(got, msg.Role+": "+msg.Content)
+	}
+	expected := []string{
+		"user: Create a task to buy milk",
+		`assistant: Called CreateTask with {"Title":"Buy milk"}`,
+		`tool: {"TaskID":"task_1"}`,
+		"assistant: Created the task",
+		"user: Complete the milk task",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected agent messages\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+// confirmingPlugin is a schemaPlugin whose remove command must be confirmed by the user
+type confirmingPlugin struct {
+	schemaPlugin
+}
+
+func (p *confirmingPlugin) RequiresConfirmation(command string) bool {
+	return command == "removeNote"
+}
+
+func newConfirmingOrchestrator(removed *int) (*RequestOrchestrator, *OrchestrationAggregate) {
+	plugin := &confirmingPlugin{schemaPlugin{mockPlugin{
+		name: "notes",
+		commands: map[string]eventsourcing.CommandHandler{
+			"removeNote": eventsourcing.NewCommand(func(input *map[string]interface{}) ([]eventsourcing.Event, error) {
+				*removed++
+				return nil, nil
+			}),
+		},
+	}}}
+	pm := &mockPluginManager{plugins: map[string]eventsourcing.Plugin{"notes": plugin}}
+	agg := NewOrchestrationAggregate()
+	ep := &mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}
+	eb := &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)}
+	return NewRequestOrchestrator(&mockLLMClient{}, pm, agg, ep, eb), agg
+}
+
+func TestToolCallConfirmation_ApprovedInChat(t *testing.T) {
+	removed := 0
+	ro, agg := newConfirmingOrchestrator(&removed)
+	placed := &ToolCallRequestPlaced{RequestID: "req1", ToolCallID: "tool1", Function: "removeNote", Arguments: map[string]interface{}{"note": "milk"}, Timestamp: "2023-01-01T00:00:00Z"}
+	agg.ApplyEvent(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "Remove the milk note"})
+	agg.ApplyEvent(placed)
+
+	events, err := ro.ExecuteToolCallCommand(placed)
+	if err != nil {
+		t.Fatalf("ExecuteToolCallCommand failed: %v", err)
+	}
+	requested, ok := events[0].(*ToolCallConfirmationRequestedEvent)
+	if len(events) != 1 || !ok {
+		t.Fatalf("Expected only a confirmation request, got %v", events)
+	}
+	if removed != 0 {
+		t.Fatal("Expected the command not to run before it is confirmed")
+	}
+	agg.ApplyEvent(requested)
+	if !agg.isRequestPending("req1") || agg.pendingConfirmation("") == nil {
+		t.Fatal("Expected the request to wait for the confirmation")
+	}
+
+	// Anything other than yes or no is a new request
+	reply := &UserRequestReceivedEvent{RequestID: "req2", RequestText: "What time is it?"}
+	if answer := ro.confirmationAnswer(reply); answer != nil {
+		t.Errorf("Expected no answer, got %v", answer)
+	}
+
+	reply = &UserRequestReceivedEvent{RequestID: "req2", RequestText: "Yes!"}
+	agg.ApplyEvent(reply)
+	events, err = ro.DecideAgentCallCommand(reply)
+	if err != nil {
+		t.Fatalf("DecideAgentCallCommand failed: %v", err)
+	}
+	confirmed, ok := events[0].(*ToolCallConfirmedEvent)
+	if len(events) != 2 || !ok || !confirmed.Approved || confirmed.RequestID != "req1" {
+		t.Fatalf("Expected the tool call of req1 to be approved, got %v", events)
+	}
+	if completed, ok := events[1].(*RequestCompletedEvent); !ok || completed.RequestID != "req2" {
+		t.Errorf("Expected the reply to be completed, got %v", events[1])
+	}
+	for _, event := range events {
+		agg.ApplyEvent(event)
+	}
+
+	events, err = ro.ExecuteConfirmedToolCallCommand(confirmed)
+	if err != nil {
+		t.Fatalf("ExecuteConfirmedToolCallCommand failed: %v", err)
+	}
+	if _, ok := events[len(events)-1].(*ToolCallCompleted); !ok || removed != 1 {
+		t.Fatalf("Expected the approved command to run, got %v", events)
+	}
+
+	// Retries of an approved tool call don't ask again
+	agg.ApplyEvent(&ToolCallRequestPlaced{RequestID: "req1", ToolCallID: "tool1", Function: "removeNote", Attempt: 2})
+	if ro.awaitsConfirmation(placed) {
+		t.Error("Expected a retry of an approved tool call to run without confirmation")
+	}
+}
+
+func TestToolCallConfirmation_Declined(t *testing.T) {
+	removed := 0
+	ro, agg := newConfirmingOrchestrator(&removed)
+	placed := &ToolCallRequestPlaced{RequestID: "req1", ToolCallID: "tool1", Function: "removeNote"}
+	agg.ApplyEvent(placed)
+	events, _ := ro.ExecuteToolCallCommand(placed)
+	agg.ApplyEvent(events[0])
+
+	if _, err := ro.ConfirmToolCallCommand(map[string]interface{}{"toolCallID": "tool1"}); err == nil {
+		t.Error("Expected an error without an answer")
+	}
+	events, err := ro.ConfirmToolCallCommand(map[string]interface{}{"toolCallID": "tool1", "approved": false})
+	if err != nil {
+		t.Fatalf("ConfirmToolCallCommand failed: %v", err)
+	}
+	agg.ApplyEvent(events[0])
+	if _, err := ro.ConfirmToolCallCommand(map[string]interface{}{"toolCallID": "tool1", "approved": true}); err == nil {
+		t.Error("Expected an error answering a tool call twice")
+	}
+
+	events, err = ro.ExecuteConfirmedToolCallCommand(events[0].(*ToolCallConfirmedEvent))
+	if err != nil {
+		t.Fatalf("ExecuteConfirmedToolCallCommand failed: %v", err)
+	}
+	completed, ok := events[0].(*ToolCallCompleted)
+	if !ok || completed.Results["declined"] != true || removed != 0 {
+		t.Fatalf("Expected the declined tool call to complete without running, got %v", events)
+	}
+	agg.ApplyEvent(completed)
+	if agg.isRequestPending("req1") {
+		t.Error("Expected the request to continue after the tool call was declined")
+	}
+}
+
+// syncingPlugin is a schemaPlugin whose manifest declares it uses the network
+type syncingPlugin struct {
+	schemaPlugin
+}
+
+func (p *syncingPlugin) Manifest() eventsourcing.Manifest {
+	return eventsourcing.Manifest{Version: "1.0.0", Capabilities: []string{eventsourcing.CapabilityNetwork}}
+}
+
+func TestToolCallConfirmation_Capabilities(t *testing.T) {
+	plugin := &syncingPlugin{schemaPlugin{mockPlugin{
+		name: "calendar",
+		commands: map[string]eventsourcing.CommandHandler{
+			"SyncCalendar": eventsourcing.NewCommand(func(input *map[string]interface{}) ([]eventsourcing.Event, error) {
+				return nil, nil
+			}),
+		},
+	}}}
+	pm := &mockPluginManager{plugins: map[string]eventsourcing.Plugin{"calendar": plugin}}
+	agg := NewOrchestrationAggregate()
+	ep := &mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}
+	eb := &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)}
+	ro := NewRequestOrchestrator(&mockLLMClient{}, pm, agg, ep, eb)
+	placed := &ToolCallRequestPlaced{RequestID: "req1", ToolCallID: "tool1", Function: "SyncCalendar"}
+	agg.ApplyEvent(placed)
+
+	if ro.awaitsConfirmation(placed) {
+		t.Error("Expected commands of plugins using the network to run without confirmation by default")
+	}
+	ro.SetConfirmedCapabilities([]string{eventsourcing.CapabilityAudio})
+	if ro.awaitsConfirmation(placed) {
+		t.Error("Expected no confirmation for capabilities the plugin doesn't declare")
+	}
+	ro.SetConfirmedCapabilities([]string{eventsourcing.CapabilityNetwork})
+	events, err := ro.ExecuteToolCallCommand(placed)
+	if err != nil {
+		t.Fatalf("ExecuteToolCallCommand failed: %v", err)
+	}
+	if _, ok := events[0].(*ToolCallConfirmationRequestedEvent); len(events) != 1 || !ok {
+		t.Errorf("Expected the network command to wait for confirmation, got %v", events)
+	}
+}
+
+func TestCancelRequest_DropsPendingToolCalls(t *testing.T) {
+	removed := 0
+	ro, agg := newConfirmingOrchestrator(&removed)
+	placed := &ToolCallRequestPlaced{RequestID: "req1", ToolCallID: "tool1", Function: "removeNote", Timestamp: "2023-01-01T00:00:02Z"}
+	for _, event := range []eventsourcing.Event{
+		&UserRequestReceivedEvent{RequestID: "req1", RequestText: "Remove the milk note", Timestamp: "2023-01-01T00:00:00Z"},
+		&AgentCallDecidedEvent{RequestID: "req1", AgentName: "notes", CallAgent: true, Timestamp: "2023-01-01T00:00:01Z"},
+		placed,
+	} {
+		agg.ApplyEvent(event)
+	}
+
+	events, err := ro.CancelRequestCommand(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("CancelRequestCommand failed: %v", err)
+	}
+	cancelled, ok := events[0].(*RequestCancelledEvent)
+	if len(events) != 1 || !ok || cancelled.RequestID != "req1" || len(cancelled.ToolCallIDs) != 1 || cancelled.ToolCallIDs[0] != "tool1" {
+		t.Fatalf("Expected req1 cancelled with its pending tool call, got %v", events)
+	}
+
+	// Results of work started before the cancellation was applied are dropped
+	if events, err := ro.ExecuteToolCallCommand(placed); err != nil || events != nil || removed != 0 {
+		t.Errorf("Expected the tool call of the cancelled request to be skipped, got %v, %v", events, err)
+	}
+
+	agg.ApplyEvent(cancelled)
+	if _, exists := agg.PendingToolCalls["req1"]; exists {
+		t.Error("Expected the pending tool calls to be cleaned up")
+	}
+	if agg.AgentStates["req1"].Status != "cancelled" || agg.ToolCallStates["tool1"].Status != "cancelled" {
+		t.Errorf("Expected the agent and tool call cancelled, got %s and %s", agg.AgentStates["req1"].Status, agg.ToolCallStates["tool1"].Status)
+	}
+	if agg.isRequestPending("req1") {
+		t.Error("Expected the cancelled request not to be pending")
+	}
+	if _, err := ro.CancelRequestCommand(map[string]interface{}{"requestID": "req1"}); err == nil {
+		t.Error("Expected an error cancelling a request twice")
+	}
+}
+
+// blockingLLMClient answers once its context is done
+type blockingLLMClient struct {
+	called chan struct{}
+}
+
+func (m *blockingLLMClient) CallLLM(ctx context.Context, messages []llmmodels.Message, tools []llmmodels.Tool, requestID, model string) (*llmmodels.OllamaResponse, error) {
+	close(m.called)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCancelRequest_AbortsLLMCall(t *testing.T) {
+	llmClient := &blockingLLMClient{called: make(chan struct{})}
+	ro := newFanOutOrchestrator(llmClient, map[string]string{"taskmanager": "model-a"})
+	received := &UserRequestReceivedEvent{RequestID: "req1", RequestText: "Add a task", Timestamp: "2023-01-01T00:00:00Z"}
+	ro.agg.ApplyEvent(received)
+
+	type result struct {
+		events []eventsourcing.Event
+		err    error
+	}
+	done := make(chan result)
+	go func() {
+		events, err := ro.DecideAgentCallCommand(received)
+		done <- result{events, err}
+	}()
+	<-llmClient.called
+
+	if _, err := ro.CancelRequestCommand(map[string]interface{}{"requestID": "req1"}); err != nil {
+		t.Fatalf("CancelRequestCommand failed: %v", err)
+	}
+	select {
+	case r := <-done:
+		if r.err != nil || len(r.events) != 0 {
+			t.Errorf("Expected the aborted call to produce no events, got %v, %v", r.events, r.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the LLM call to be aborted")
+	}
+}
+
+func TestShutdown_CancelsRequestsLeftInProgress(t *testing.T) {
+	llmClient := &blockingLLMClient{called: make(chan struct{})}
+	ro := newFanOutOrchestrator(llmClient, map[string]string{"taskmanager": "model-a"})
+	received := &UserRequestReceivedEvent{RequestID: "req1", RequestText: "Add a task", Timestamp: "2023-01-01T00:00:00Z"}
+	ro.agg.ApplyEvent(received)
+	done := make(chan struct{})
+	go func() {
+		ro.DecideAgentCallCommand(received)
+		close(done)
+	}()
+	<-llmClient.called
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := ro.Shutdown(ctx); err == nil || !strings.Contains(err.Error(), "cancelled 1 requests") {
+		t.Errorf("Expected the request in progress to be cancelled, got %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the LLM call to be aborted")
+	}
+	if !ro.isCancelled("req1") {
+		t.Error("Expected req1 to be cancelled")
+	}
+	if _, err := ro.ProcessUserRequestCommand(map[string]interface{}{"requestText": "Another one"}); err == nil {
+		t.Error("Expected requests to be refused while shutting down")
+	}
+
+	// Nothing in progress, nothing to wait for
+	idle := newFanOutOrchestrator(&mockLLMClient{}, nil)
+	if err := idle.Shutdown(context.Background()); err != nil {
+		t.Errorf("Expected an idle orchestrator to shut down right away, got %v", err)
+	}
+}
+
+func TestTimeoutRequest_FailsRequestInProgress(t *testing.T) {
+	ro := newFanOutOrchestrator(&mockLLMClient{}, map[string]string{"taskmanager": "model-a"})
+	for _, event := range []eventsourcing.Event{
+		&UserRequestReceivedEvent{RequestID: "req1", RequestText: "Add a task", Timestamp: "2023-01-01T00:00:00Z"},
+		&AgentCallDecidedEvent{RequestID: "req1", AgentName: "taskmanager", CallAgent: true, Timestamp: "2023-01-01T00:00:01Z"},
+		&ToolCallRequestPlaced{RequestID: "req1", ToolCallID: "tool1", Function: "createTask", Timestamp: "2023-01-01T00:00:02Z"},
+	} {
+		ro.agg.ApplyEvent(event)
+	}
+
+	events, err := ro.TimeoutRequestCommand(map[string]interface{}{"requestID": "req1", "timeout": time.Minute})
+	if err != nil {
+		t.Fatalf("TimeoutRequestCommand failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected a failure and a completion, got %v", events)
+	}
+	failed, ok := events[0].(*AgentExecutionFailedEvent)
+	if !ok || !failed.TimedOut || failed.AgentName != "taskmanager" || !strings.Contains(failed.ErrorMsg, "timed out after 1m0s") {
+		t.Errorf("Expected the agent to time out, got %+v", events[0])
+	}
+	if completed, ok := events[1].(*RequestCompletedEvent); !ok || !strings.Contains(completed.ResponseText, "timed out") {
+		t.Errorf("Expected the request completed with the error, got %+v", events[1])
+	}
+	for _, event := range events {
+		ro.agg.ApplyEvent(event)
+	}
+	if ro.agg.AgentStates["req1"].Status != "timed_out" || ro.agg.ToolCallStates["tool1"].Status != "timed_out" {
+		t.Errorf("Expected the agent and tool call timed out, got %s and %s", ro.agg.AgentStates["req1"].Status, ro.agg.ToolCallStates["tool1"].Status)
+	}
+	if ro.agg.isRequestPending("req1") || len(ro.agg.PendingToolCalls["req1"]) != 0 {
+		t.Error("Expected the timed out request to be done")
+	}
+	if events, _ := ro.TimeoutRequestCommand(map[string]interface{}{"requestID": "req1", "timeout": time.Minute}); events != nil {
+		t.Errorf("Expected a completed request not to time out, got %v", events)
+	}
+}
+
+func TestTimeoutRequest_WaitsForConfirmation(t *testing.T) {
+	removed := 0
+	ro, agg := newConfirmingOrchestrator(&removed)
+	placed := &ToolCallRequestPlaced{RequestID: "req1", ToolCallID: "tool1", Function: "removeNote"}
+	agg.ApplyEvent(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "Remove the milk note"})
+	agg.ApplyEvent(placed)
+	events, _ := ro.ExecuteToolCallCommand(placed)
+	agg.ApplyEvent(events[0])
+
+	ro.SetRequestTimeout(0)
+	if events, _ := ro.TimeoutRequestCommand(map[string]interface{}{"requestID": "req1", "timeout": time.Minute}); events != nil {
+		t.Errorf("Expected a request waiting for the user not to time out, got %v", events)
+	}
+}
+
+func TestWatchdog_AbortsHungLLMCall(t *testing.T) {
+	llmClient := &blockingLLMClient{called: make(chan struct{})}
+	ro := newFanOutOrchestrator(llmClient, map[string]string{"taskmanager": "model-a"})
+	ro.SetRequestTimeout(10 * time.Millisecond)
+	received := &UserRequestReceivedEvent{RequestID: "req1", RequestText: "Add a task", Timestamp: "2023-01-01T00:00:00Z"}
+	ro.agg.ApplyEvent(received)
+
+	ro.watchRequest("req1")
+	done := make(chan []eventsourcing.Event)
+	go func() {
+		events, _ := ro.DecideAgentCallCommand(received)
+		done <- events
+	}()
+	select {
+	case events := <-done:
+		if len(events) != 0 {
+			t.Errorf("Expected the results of the timed out call to be dropped, got %v", events)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the watchdog to abort the LLM call")
+	}
+}
+
+func TestSummarizeConversation(t *testing.T) {
+	llmClient := &recordingLLMClient{}
+	ro := newFanOutOrchestrator(llmClient, nil)
+	if events, err := ro.SummarizeConversationCommand(map[string]interface{}{}); err != nil || events != nil {
+		t.Fatalf("Expected nothing to summarize, got %v, %v", events, err)
+	}
+
+	ro.agg.GetChatManager().SetMaxTokens(200)
+	ro.agg.ApplyEvent(&UserRequestReceivedEvent{RequestID: "req0", RequestText: "My dog is called Rex", Timestamp: "2023-01-01T00:00:00Z"})
+	for i := 1; i <= 10; i++ {
+		ro.agg.ApplyEvent(&UserRequestReceivedEvent{
+			RequestID:   fmt.Sprintf("req%d", i),
+			RequestText: "Talking about the weather " + strings.Repeat("x", 60),
+			Timestamp:   fmt.Sprintf("2023-01-01T00:%02d:00Z", i),
+		})
+	}
+
+	events, err := ro.SummarizeConversationCommand(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("SummarizeConversationCommand failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected token usage and a summary, got %v", events)
+	}
+	if !strings.Contains(llmClient.messages[0].Content, "User: My dog is called Rex") {
+		t.Errorf("Expected the oldest messages in the prompt, got %q", llmClient.messages[0].Content)
+	}
+	summarized, ok := events[1].(*ConversationSummarizedEvent)
+	if !ok || summarized.Summary != "Done" || summarized.SessionID != "default" || summarized.MessageCount == 0 {
+		t.Fatalf("Expected the session summarized, got %+v", events[1])
+	}
+
+	// The summary survives being stored and replayed
+	data, err := summarized.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	restored, err := eventsourcing.UnmarshalEvent(data)
+	if err != nil {
+		t.Fatalf("UnmarshalEvent failed: %v", err)
+	}
+	ro.agg.ApplyEvent(restored)
+	context := ro.agg.GetChatManager().GetLLMContext(nil)
+	if !strings.Contains(context[1].Content, "Done") {
+		t.Errorf("Expected the summary in the LLM context, got %q", context[1].Content)
+	}
+	for _, msg := range context {
+		if msg.Content == "My dog is called Rex" {
+			t.Error("Expected the summarized message to be replaced by the summary")
+		}
+	}
+}
+
+func TestRedactMessageCommand(t *testing.T) {
+	ro := newFanOutOrchestrator(&recordingLLMClient{}, nil)
+	for _, event := range []eventsourcing.Event{
+		&UserRequestReceivedEvent{RequestID: "req1", RequestText: "Call me on 555-0134", Timestamp: "2023-01-01T00:00:00Z"},
+		&RequestCompletedEvent{RequestID: "req1", ResponseText: "I'll call 555-0134", CompletedAt: "2023-01-01T00:00:05Z"},
+		&UserRequestReceivedEvent{RequestID: "req2", RequestText: "I live at 12 Elm Street", Timestamp: "2023-01-01T00:01:00Z"},
+	} {
+		ro.agg.ApplyEvent(event)
+	}
+	for _, data := range []map[string]interface{}{{}, {"requestID": "req9"}} {
+		if _, err := ro.RedactMessageCommand(data); err == nil {
+			t.Errorf("Expected redacting %v to fail", data)
+		}
+	}
+
+	var redactions []eventsourcing.Event
+	for _, data := range []map[string]interface{}{{"text": "555-0134"}, {"requestID": "req2"}} {
+		events, err := ro.RedactMessageCommand(data)
+		if err != nil {
+			t.Fatalf("RedactMessageCommand failed: %v", err)
+		}
+		ro.agg.ApplyEvent(events[0])
+		redactions = append(redactions, events[0])
+	}
+	for _, msg := range ro.agg.GetChatManager().GetUIMessages() {
+		if strings.Contains(msg.Content, "555-0134") || strings.Contains(msg.Content, "Elm") {
+			t.Errorf("Expected the redacted content hidden from the chat, got %q", msg.Content)
+		}
+	}
+
+	// The events keep the content, what is shown of them is redacted
+	data, _ := (&UserRequestReceivedEvent{RequestID: "req1", RequestText: "Call me on 555-0134"}).Marshal()
+	if redacted := string(ro.agg.Redact("", data)); !strings.Contains(redacted, "Call me on [redacted]") {
+		t.Errorf("Expected the number scrubbed, got %s", redacted)
+	}
+	if redacted := string(ro.agg.Redact("alice", data)); !strings.Contains(redacted, "555-0134") {
+		t.Errorf("Expected another user's events left alone, got %s", redacted)
+	}
+	data, _ = (&UserRequestReceivedEvent{RequestID: "req2", RequestText: "I live at 12 Elm Street"}).Marshal()
+	if redacted := string(ro.agg.Redact("", data)); strings.Contains(redacted, "Elm") || !strings.Contains(redacted, `"request_id":"req2"`) {
+		t.Errorf("Expected the request's text hidden and its ID kept, got %s", redacted)
+	}
+
+	// The answers to redacted requests are redacted too, also as stored before their fields had json tags
+	data, _ = (&RequestCompletedEvent{RequestID: "req1", ResponseText: "I'll call 555-0134"}).Marshal()
+	if redacted := string(ro.agg.Redact("", data)); strings.Contains(redacted, "555-0134") {
+		t.Errorf("Expected the number scrubbed from the answer, got %s", redacted)
+	}
+	data, _ = (&RequestCompletedEvent{RequestID: "req2", ResponseText: "Noted, Elm Street", CompletedAt: "2023-01-01T00:01:05Z"}).Marshal()
+	if redacted := string(ro.agg.Redact("", data)); strings.Contains(redacted, "Elm") || !strings.Contains(redacted, `"request_id":"req2"`) {
+		t.Errorf("Expected the answer hidden and its ID kept, got %s", redacted)
+	}
+	legacy := []byte(`{"event_type":"orchestration_RequestCompleted","RequestID":"req2","ResponseText":"Noted, Elm Street","CompletedAt":"2023-01-01T00:01:05Z"}`)
+	if redacted := string(ro.agg.Redact("", legacy)); strings.Contains(redacted, "Elm") || !strings.Contains(redacted, `"RequestID":"req2"`) {
+		t.Errorf("Expected the stored answer hidden and its ID kept, got %s", redacted)
+	}
+	restored, err := eventsourcing.UnmarshalEvent(legacy)
+	if completed, ok := restored.(*RequestCompletedEvent); err != nil || !ok || completed.RequestID != "req2" || completed.ResponseText != "Noted, Elm Street" || completed.CompletedAt == "" {
+		t.Errorf("Expected the stored event read, got %+v (%v)", restored, err)
+	}
+
+	// The redactions survive being stored and replayed
+	replayed := NewOrchestrationAggregate()
+	replayed.ApplyEvent(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "Call me on 555-0134", Timestamp: "2023-01-01T00:00:00Z"})
+	for _, event := range redactions {
+		data, _ := event.Marshal()
+		restored, err := eventsourcing.UnmarshalEvent(data)
+		if err != nil {
+			t.Fatalf("UnmarshalEvent failed: %v", err)
+		}
+		replayed.ApplyEvent(restored)
+	}
+	if messages := replayed.GetChatManager().GetUIMessages(); messages[len(messages)-1].Content != "Call me on [redacted]" {
+		t.Errorf("Expected the number scrubbed after replaying, got %q", messages[len(messages)-1].Content)
+	}
+}
+
+// generatingPlugin is a plugin implementing eventsourcing.Generator
+type generatingPlugin struct {
+	mockPlugin
+	generate eventsourcing.GenerateFunc
+}
+
+func (p *generatingPlugin) SetGenerateFunc(generate eventsourcing.GenerateFunc) {
+	p.generate = generate
+}
+
+func TestProvideGenerators(t *testing.T) {
+	llmClient := &recordingLLMClient{}
+	plugin := &generatingPlugin{mockPlugin: mockPlugin{name: "journal", model: "model-j"}}
+	pm := &mockPluginManager{plugins: map[string]eventsourcing.Plugin{"journal": plugin}}
+	ep := &mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}
+	eb := &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)}
+	var recorded []*usage.TokenUsageRecordedEvent
+	eb.Subscribe("usage_TokenUsageRecorded", func(event eventsourcing.Event) error {
+		recorded = append(recorded, event.(*usage.TokenUsageRecordedEvent))
+		return nil
+	})
+	NewRequestOrchestrator(llmClient, pm, NewOrchestrationAggregate(), ep, eb)
+
+	if plugin.generate == nil {
+		t.Fatal("Expected the plugin to be given a generate function")
+	}
+	text, err := plugin.generate("Reflect on my week")
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if text != "Done" || llmClient.messages[0].Content != "Reflect on my week" {
+		t.Errorf("Expected the prompt answered, got %q for %v", text, llmClient.messages)
+	}
+	if len(recorded) != 1 || recorded[0].Purpose != "journal" || recorded[0].Model != "model-j" {
+		t.Errorf("Expected the token usage recorded for the plugin, got %+v", recorded)
+	}
+}
+
+// mockUserPluginManager gives each user plugin instances of their own
+type mockUserPluginManager struct {
+	mockPluginManager
+	users map[string]*mockPluginManager
+}
+
+func (m *mockUserPluginManager) GetUserLLMPlugins(userID string) []eventsourcing.Plugin {
+	return m.users[userID].GetLLMPlugins()
+}
+
+func (m *mockUserPluginManager) GetUserPlugin(userID, name string) (eventsourcing.Plugin, error) {
+	return m.users[userID].GetPlugin(name)
+}
+
+func (m *mockUserPluginManager) GetUserPluginByCommand(userID, cmd string) (eventsourcing.Plugin, error) {
+	return m.users[userID].GetPluginByCommand(cmd)
+}
+
+func (m *mockUserPluginManager) Users() []string {
+	var users []string
+	for userID := range m.users {
+		users = append(users, userID)
+	}
+	return users
+}
+
+func TestUserRequests_UseTheUsersPluginsAndChat(t *testing.T) {
+	added := make(map[string]int)
+	notesOf := func(userID string) *mockPluginManager {
+		return &mockPluginManager{plugins: map[string]eventsourcing.Plugin{"notes": &schemaPlugin{mockPlugin{
+			name: "notes",
+			commands: map[string]eventsourcing.CommandHandler{
+				"addNote": eventsourcing.NewCommand(func(input *map[string]interface{}) ([]eventsourcing.Event, error) {
+					added[userID]++
+					return nil, nil
+				}),
+			},
+		}}}}
+	}
+	pm := &mockUserPluginManager{mockPluginManager: *notesOf(""), users: map[string]*mockPluginManager{"alice": notesOf("alice")}}
+	agg := NewOrchestrationAggregate()
+	ep := &mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}
+	eb := &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)}
+	ro := NewRequestOrchestrator(&mockLLMClient{}, pm, agg, ep, eb)
+
+	received := &UserRequestReceivedEvent{RequestID: "req1", RequestText: "Note to buy milk", Timestamp: "2023-01-01T00:00:00Z"}
+	received.Metadata().UserID = "alice"
+	placed := &ToolCallRequestPlaced{RequestID: "req1", ToolCallID: "tool1", Function: "addNote", Timestamp: "2023-01-01T00:00:01Z"}
+	agg.ApplyEvent(received)
+	agg.ApplyEvent(placed)
+
+	// Events of the request are alice's, even those reacting to events without a user
+	events, err := userCommand{ro: ro, handler: eventsourcing.NewCommand(ro.ExecuteToolCallCommand)}.Execute(placed)
+	if err != nil {
+		t.Fatalf("ExecuteToolCall failed: %v", err)
+	}
+	if added["alice"] != 1 || added[""] != 0 {
+		t.Errorf("Expected alice's notes plugin to run, got %v", added)
+	}
+	for _, event := range events {
+		if event.Metadata().UserID != "alice" {
+			t.Errorf("Expected %s to be alice's", event.Type())
+		}
+	}
+
+	if messages := agg.ChatManagerFor("alice").GetUIMessages(); len(messages) != 1 || messages[0].Content != "Note to buy milk" {
+		t.Errorf("Expected the request in alice's chat, got %v", messages)
+	}
+	if messages := agg.GetChatManager().GetUIMessages(); len(messages) != 0 {
+		t.Errorf("Expected alice's request kept out of the owner's chat, got %v", messages)
+	}
+
+	if _, err := ro.CancelRequestCommand(map[string]interface{}{"requestID": "req1", "userID": "bob"}); err == nil {
+		t.Error("Expected bob not to cancel alice's request")
+	}
+	if _, err := ro.CancelRequestCommand(map[string]interface{}{}); err == nil {
+		t.Error("Expected the owner to have no request of their own in progress")
+	}
+	if _, err := ro.CancelRequestCommand(map[string]interface{}{"userID": "alice"}); err != nil {
+		t.Errorf("Expected alice to cancel their request: %v", err)
+	}
+}
+
+// scriptedLLMClient answers the calls with its responses in turn and records what each call was given
+type scriptedLLMClient struct {
+	responses []*llmmodels.OllamaResponse
+	messages  [][]llmmodels.Message
+	tools     [][]llmmodels.Tool
+}
+
+func (m *scriptedLLMClient) CallLLM(ctx context.Context, messages []llmmodels.Message, tools []llmmodels.Tool, requestID, model string) (*llmmodels.OllamaResponse, error) {
+	m.messages = append(m.messages, messages)
+	m.tools = append(m.tools, tools)
+	return m.responses[min(len(m.messages), len(m.responses))-1], nil
+}
+
+// mockStateSource shares fixed state per aggregate and records the queries
+type mockStateSource struct {
+	state   map[string]any
+	queries [][]string
+}
+
+func (m *mockStateSource) QueryableAggregates(userID string) []string {
+	return []string{"calendar", "tasks"}
+}
+
+func (m *mockStateSource) QueryState(userID string, names []string) map[string]any {
+	m.queries = append(m.queries, names)
+	state := make(map[string]any)
+	for _, name := range names {
+		state[name] = m.state[name]
+	}
+	return state
+}
+
+func TestDecideAgentCallCommand_QueryState(t *testing.T) {
+	query := &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{ToolCalls: []llmmodels.OllamaToolCall{{Function: llmmodels.OllamaFunction{
+		Name:      queryStateToolName,
+		Arguments: map[string]interface{}{"aggregates": []interface{}{"tasks", "calendar"}},
+	}}}}}
+	answer := &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{Content: "Finish the report before your 10:00 meeting."}}
+	llmClient := &scriptedLLMClient{responses: []*llmmodels.OllamaResponse{query, answer}}
+	ro := newFanOutOrchestrator(llmClient, map[string]string{"tasks": "model-a", "calendar": "model-b"})
+	source := &mockStateSource{state: map[string]any{
+		"tasks":    []string{"report"},
+		"calendar": []string{"meeting at 10:00"},
+	}}
+	ro.SetStateSource(source)
+
+	events, err := ro.DecideAgentCallCommand(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "what is due before my next meeting?"})
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected the usage of both calls and the answer, got %v", events)
+	}
+	if completed, ok := events[2].(*RequestCompletedEvent); !ok || completed.ResponseText != answer.Message.Content {
+		t.Errorf("Expected the request completed with the answer, got %v", events[2])
+	}
+	if len(source.queries) != 1 || len(source.queries[0]) != 2 {
+		t.Errorf("Expected the tasks and calendar queried once, got %v", source.queries)
+	}
+	second := llmClient.messages[1]
+	result := second[len(second)-1]
+	if result.Role != "tool" || result.Name != queryStateToolName || !strings.Contains(result.Content, "meeting at 10:00") || !strings.Contains(result.Content, "report") {
+		t.Errorf("Expected the queried state passed to the second call, got %+v", result)
+	}
+}
+
+func TestDecideAgentCallCommand_QueryStateLimited(t *testing.T) {
+	query := &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{
+		Content:   "I can't tell.",
+		ToolCalls: []llmmodels.OllamaToolCall{{Function: llmmodels.OllamaFunction{Name: queryStateToolName}}},
+	}}
+	llmClient := &scriptedLLMClient{responses: []*llmmodels.OllamaResponse{query}}
+	ro := newFanOutOrchestrator(llmClient, map[string]string{"tasks": "model-a"})
+	source := &mockStateSource{}
+	ro.SetStateSource(source)
+
+	events, err := ro.DecideAgentCallCommand(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "what is due?"})
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	if len(source.queries) != maxStateQueries || len(llmClient.messages) != maxStateQueries+1 {
+		t.Errorf("Expected %d queries in %d calls, got %d in %d", maxStateQueries, maxStateQueries+1, len(source.queries), len(llmClient.messages))
+	}
+	for _, tool := range llmClient.tools[maxStateQueries] {
+		if tool.Function["name"] == queryStateToolName {
+			t.Error("Expected QueryState no longer offered after the last query")
+		}
+	}
+	if completed, ok := events[len(events)-1].(*RequestCompletedEvent); !ok || completed.ResponseText != "I can't tell." {
+		t.Errorf("Expected the request completed with the router's text, got %v", events[len(events)-1])
+	}
+}
+
+// mockTagLister lists fixed items for every tag and records the tags listed
+type mockTagLister struct {
+	items []eventsourcing.TaggedItem
+	tags  []string
+}
+
+func (m *mockTagLister) ItemsTagged(userID, tag string) []eventsourcing.TaggedItem {
+	m.tags = append(m.tags, tag)
+	return m.items
+}
+
+func TestDecideAgentCallCommand_ListByTag(t *testing.T) {
+	list := &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{ToolCalls: []llmmodels.OllamaToolCall{{Function: llmmodels.OllamaFunction{
+		Name:      listByTagToolName,
+		Arguments: map[string]interface{}{"tag": "#health"},
+	}}}}}
+	answer := &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{Content: "You have a dentist appointment tagged #health."}}
+	llmClient := &scriptedLLMClient{responses: []*llmmodels.OllamaResponse{list, answer}}
+	ro := newFanOutOrchestrator(llmClient, map[string]string{"tasks": "model-a"})
+	lister := &mockTagLister{items: []eventsourcing.TaggedItem{{Aggregate: "calendar", ID: "e1", Title: "Dentist", Tags: []string{"health"}}}}
+	ro.SetTagLister(lister)
+
+	events, err := ro.DecideAgentCallCommand(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "show me everything tagged #health"})
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	if completed, ok := events[len(events)-1].(*RequestCompletedEvent); !ok || completed.ResponseText != answer.Message.Content {
+		t.Errorf("Expected the request completed with the answer, got %v", events[len(events)-1])
+	}
+	if len(lister.tags) != 1 || lister.tags[0] != "#health" {
+		t.Errorf("Expected #health listed once, got %v", lister.tags)
+	}
+	second := llmClient.messages[1]
+	result := second[len(second)-1]
+	if result.Role != "tool" || result.Name != listByTagToolName || !strings.Contains(result.Content, "Dentist") {
+		t.Errorf("Expected the tagged items passed to the second call, got %+v", result)
+	}
+}
+
+// mockItemLinker relates fixed items to every item
+type mockItemLinker struct {
+	items []eventsourcing.Item
+}
+
+func (m *mockItemLinker) RelatedItems(userID, aggregate, id string) []eventsourcing.Item {
+	return m.items
+}
+
+func TestDecideAgentCallCommand_LinkItems(t *testing.T) {
+	call := func(name string, arguments map[string]interface{}) *llmmodels.OllamaResponse {
+		return &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{ToolCalls: []llmmodels.OllamaToolCall{{Function: llmmodels.OllamaFunction{
+			Name: name, Arguments: arguments,
+		}}}}}
+	}
+	link := call(linkItemsToolName, map[string]interface{}{"from_aggregate": "taskmanager", "from_id": "t1", "to_aggregate": "calendar", "to_id": "e1"})
+	related := call(relatedItemsToolName, map[string]interface{}{"aggregate": "calendar", "id": "e1"})
+	answer := &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{Content: "Linked the slides to Friday's meeting."}}
+	llmClient := &scriptedLLMClient{responses: []*llmmodels.OllamaResponse{link, related, answer}}
+	ro := newFanOutOrchestrator(llmClient, map[string]string{"tasks": "model-a"})
+	ro.SetItemLinker(&mockItemLinker{items: []eventsourcing.Item{{Aggregate: "taskmanager", ID: "t1", Title: "Prepare slides"}}})
+	var linked map[string]interface{}
+	ro.eventProcessor.RegisterCommand(linkItemsToolName, eventsourcing.NewCommand(func(data map[string]interface{}) ([]eventsourcing.Event, error) {
+		linked = data
+		return nil, nil
+	}))
+
+	events, err := ro.DecideAgentCallCommand(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "link prepare slides to friday's meeting"})
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	if completed, ok := events[len(events)-1].(*RequestCompletedEvent); !ok || completed.ResponseText != answer.Message.Content {
+		t.Errorf("Expected the request completed with the answer, got %v", events[len(events)-1])
+	}
+	if linked["from_id"] != "t1" || linked["to_aggregate"] != "calendar" {
+		t.Errorf("Expected the items linked with LinkItems, got %v", linked)
+	}
+	second := llmClient.messages[1]
+	if result := second[len(second)-1]; result.Name != linkItemsToolName || !strings.Contains(result.Content, "done") {
+		t.Errorf("Expected the link confirmed to the second call, got %+v", result)
+	}
+	third := llmClient.messages[2]
+	if result := third[len(third)-1]; result.Name != relatedItemsToolName || !strings.Contains(result.Content, "Prepare slides") {
+		t.Errorf("Expected the related items passed to the third call, got %+v", result)
+	}
+}
+
+// pinnedFacts are the facts each user pinned
+type pinnedFacts map[string][]string
+
+func (p pinnedFacts) PinnedFor(userID string) []string { return p[userID] }
+
+func TestDecideAgentCallCommand_PinFact(t *testing.T) {
+	pin := &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{ToolCalls: []llmmodels.OllamaToolCall{{Function: llmmodels.OllamaFunction{
+		Name: pinFactToolName, Arguments: map[string]interface{}{"text": "The user's wife is Ana"},
+	}}}}}
+	answer := &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{Content: "I'll remember that."}}
+	llmClient := &scriptedLLMClient{responses: []*llmmodels.OllamaResponse{pin, answer}}
+	ro := newFanOutOrchestrator(llmClient, map[string]string{"tasks": "model-a"})
+	pins := pinnedFacts{}
+	ro.SetPinSource(pins)
+	ro.eventProcessor.RegisterCommand(pinFactToolName, eventsourcing.NewCommand(func(data map[string]interface{}) ([]eventsourcing.Event, error) {
+		pins[eventsourcing.UserOf(data)] = append(pins[eventsourcing.UserOf(data)], data["text"].(string))
+		return nil, nil
+	}))
+
+	if _, err := ro.DecideAgentCallCommand(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "remember my wife is called Ana"}); err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	if result := llmClient.messages[1][len(llmClient.messages[1])-1]; result.Name != pinFactToolName || !strings.Contains(result.Content, "pinned") {
+		t.Errorf("Expected the pin confirmed to the second call, got %+v", result)
+	}
+	if prompt := ro.systemPrompt("req2"); !strings.Contains(prompt, "Facts the user pinned, they always hold:\n- The user's wife is Ana") {
+		t.Errorf("Expected the pinned fact in the system prompt of the next request, got %q", prompt)
+	}
+}
+
+func TestDecideAgentCallCommand_FocusOn(t *testing.T) {
+	focus := &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{ToolCalls: []llmmodels.OllamaToolCall{{Function: llmmodels.OllamaFunction{
+		Name: focusOnToolName, Arguments: map[string]interface{}{"target": "tasks"},
+	}}}}}
+	answer := &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{Content: "Here are your tasks."}}
+	llmClient := &scriptedLLMClient{responses: []*llmmodels.OllamaResponse{focus, answer}}
+	ro := newFanOutOrchestrator(llmClient, map[string]string{"tasks": "model-a"})
+	var directed []eventsourcing.Event
+	ro.eventProcessor.RegisterCommand(focusOnToolName, eventsourcing.NewCommand(func(data map[string]interface{}) ([]eventsourcing.Event, error) {
+		events, err := ro.FocusOnCommand(data)
+		directed = append(directed, events...)
+		return events, err
+	}))
+
+	if _, err := ro.DecideAgentCallCommand(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "show me my tasks"}); err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	if len(directed) != 1 {
+		t.Fatalf("Expected the camera directed once, got %v", directed)
+	}
+	if camera := directed[0].(*CameraDirectedEvent); camera.Action != eventsourcing.CameraZoomZone || camera.Zone != "tasks" || camera.RequestID != "req1" {
+		t.Errorf("Expected the camera to zoom to the zone of the tasks, got %+v", camera)
+	}
+	if result := llmClient.messages[1][len(llmClient.messages[1])-1]; result.Name != focusOnToolName || !strings.Contains(result.Content, "shown") {
+		t.Errorf("Expected the camera move confirmed to the second call, got %+v", result)
+	}
+
+	// Anything else is a node, orbited when asked
+	events, err := ro.FocusOnCommand(map[string]interface{}{"target": "calendar_hub", "orbit": true})
+	if camera := events[0].(*CameraDirectedEvent); err != nil || camera.Action != eventsourcing.CameraOrbit || camera.NodeID != "calendar_hub" || camera.Zone != "" {
+		t.Errorf("Expected the camera to orbit the hub, got %+v, %v", camera, err)
+	}
+	if _, err := ro.FocusOnCommand(map[string]interface{}{"target": " "}); err == nil {
+		t.Error("Expected a missing target to fail")
+	}
+	if !eventsourcing.IsTransient(&CameraDirectedEvent{}) {
+		t.Error("Expected camera directions not to be stored")
+	}
+}
+
+func TestDecideAgentCallCommand_SearchChat(t *testing.T) {
+	search := &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{ToolCalls: []llmmodels.OllamaToolCall{{Function: llmmodels.OllamaFunction{
+		Name:      searchChatToolName,
+		Arguments: map[string]interface{}{"text": "dentist", "role": "user"},
+	}}}}}
+	answer := &llmmodels.OllamaResponse{Message: llmmodels.OllamaMessage{Content: "You asked to book the dentist on January 1st."}}
+	llmClient := &scriptedLLMClient{responses: []*llmmodels.OllamaResponse{search, answer}}
+	ro := newFanOutOrchestrator(llmClient, map[string]string{"tasks": "model-a"})
+	ro.agg.ApplyEvent(&UserRequestReceivedEvent{RequestID: "req1", RequestText: "Book the dentist appointment", Timestamp: "2023-01-01T00:00:00Z"})
+	ro.agg.ApplyEvent(&RequestCompletedEvent{RequestID: "req1", ResponseText: "Booked the dentist", CompletedAt: "2023-01-01T00:00:01Z"})
+
+	events, err := ro.DecideAgentCallCommand(&UserRequestReceivedEvent{RequestID: "req2", RequestText: "where did we discuss the dentist?"})
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	if completed, ok := events[len(events)-1].(*RequestCompletedEvent); !ok || completed.ResponseText != answer.Message.Content {
+		t.Errorf("Expected the request completed with the answer, got %v", events[len(events)-1])
+	}
+	second := llmClient.messages[1]
+	result := second[len(second)-1]
+	if result.Role != "tool" || result.Name != searchChatToolName || !strings.Contains(result.Content, "Book the dentist appointment") || strings.Contains(result.Content, "Booked") {
+		t.Errorf("Expected the user's message about the dentist passed to the second call, got %+v", result)
+	}
+}
+
+// progressInput is the input of a command reporting its progress
+type progressInput struct {
+	eventsourcing.Progress
+	Steps int `json:"steps"`
+}
+
+func (progressInput) New() any                       { return &progressInput{} }
+func (progressInput) Schema() map[string]interface{} { return map[string]interface{}{} }
+
+// progressPlugin has a command importing in steps
+type progressPlugin struct {
+	mockPlugin
+}
+
+func (p *progressPlugin) Schemas() map[string]eventsourcing.CommandInput {
+	return map[string]eventsourcing.CommandInput{"Import": progressInput{}}
+}
+
+func TestExecuteToolCallCommand_ReportsProgress(t *testing.T) {
+	plugin := &progressPlugin{mockPlugin{
+		name: "importer",
+		commands: map[string]eventsourcing.CommandHandler{
+			"Import": eventsourcing.NewCommand(func(input *progressInput) ([]eventsourcing.Event, error) {
+				for step := 1; step <= input.Steps; step++ {
+					input.Report(step*100/input.Steps, fmt.Sprintf("step %d", step))
+					input.Report(step*100/input.Steps, fmt.Sprintf("step %d", step)) // Unchanged, not published again
+				}
+				return nil, nil
+			}),
+		},
+	}}
+	pm := &mockPluginManager{plugins: map[string]eventsourcing.Plugin{"importer": plugin}}
+	agg := NewOrchestrationAggregate()
+	ep := &mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}
+	eb := &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)}
+	ro := NewRequestOrchestrator(&mockLLMClient{}, pm, agg, ep, eb)
+	var progress []*ToolCallProgressEvent
+	eb.Subscribe("orchestration_ToolCallProgress", func(event eventsourcing.Event) error {
+		progress = append(progress, event.(*ToolCallProgressEvent))
+		return agg.ApplyEvent(event)
+	})
+
+	placed := &ToolCallRequestPlaced{RequestID: "req1", ToolCallID: "tool1", Function: "Import", Arguments: map[string]interface{}{"steps": 4}}
+	agg.ApplyEvent(placed)
+	events, err := ro.ExecuteToolCallCommand(placed)
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	if len(progress) != 4 || progress[1].Percent != 50 || progress[3].Message != "step 4" || progress[0].Attempt != 1 {
+		t.Fatalf("Expected the progress of each step published while running, got %+v", progress)
+	}
+	if state := agg.ToolCallStates["tool1"]; state.Status != "started" || state.Progress != 100 || state.progressText() != "100% step 4" {
+		t.Errorf("Expected the tool call in progress at 100%%, got %+v", state)
+	}
+	if actions := agg.Broadcast3DDelta(progress[1]); len(actions) != 1 || actions[0].Properties["pulse"] != true || actions[0].Properties["progress"] != 50 {
+		t.Errorf("Expected the tool call's label to pulse, got %+v", actions)
+	}
+
+	completed := events[len(events)-1].(*ToolCallCompleted)
+	agg.ApplyEvent(completed)
+	agg.ApplyEvent(&ToolCallProgressEvent{RequestID: "req1", ToolCallID: "tool1", Attempt: 1, Percent: 10})
+	if state := agg.ToolCallStates["tool1"]; state.Status != "success" || state.Progress != 100 {
+		t.Errorf("Expected progress reported after completion ignored, got %+v", state)
+	}
+	if actions := agg.Broadcast3DDelta(completed); actions[0].Properties["pulse"] != false {
+		t.Errorf("Expected the label to stop pulsing on completion, got %+v", actions)
+	}
+}
+
+func TestLLMStatus_ShownInEveryChat(t *testing.T) {
+	agg := NewOrchestrationAggregate()
+	received := &UserRequestReceivedEvent{RequestID: "req1", RequestText: "Note to buy milk", Timestamp: "2023-01-01T00:00:00Z"}
+	received.Metadata().UserID = "alice"
+	agg.ApplyEvent(received)
+
+	agg.ApplyEvent(&llmprocessor.StatusChangedEvent{Status: llmprocessor.StatusOffline, Message: "The LLM at http://localhost:11434 is offline", Timestamp: "2023-01-01T00:00:01Z"})
+	for _, userID := range []string{"", "alice"} {
+		messages := agg.ChatManagerFor(userID).GetUIMessages()
+		if len(messages) == 0 || messages[len(messages)-1].Content != "The LLM at http://localhost:11434 is offline" {
+			t.Errorf("Expected the LLM offline in the chat of %q, got %v", userID, messages)
+		}
+	}
+}
+
+func TestBriefing_ShownInUserChat(t *testing.T) {
+	agg := NewOrchestrationAggregate()
+	delivered := &briefing.BriefingDeliveredEvent{BriefingID: "alice/briefing_2023-01-01T07:00:00Z", Text: "Good morning Alice", Timestamp: "2023-01-01T07:00:00Z"}
+	delivered.Metadata().UserID = "alice"
+	agg.ApplyEvent(delivered)
+
+	messages := agg.ChatManagerFor("alice").GetUIMessages()
+	if len(messages) != 1 || messages[0].Role != chat.RoleMindPalace || messages[0].Content != "Good morning Alice" {
+		t.Errorf("Expected the briefing from MindPalace in Alice's chat, got %+v", messages)
+	}
+	if messages := agg.ChatManagerFor("").GetUIMessages(); len(messages) != 0 {
+		t.Errorf("Expected nothing in the owner's chat, got %+v", messages)
+	}
+}
+
+func TestChangesChat(t *testing.T) {
+	for eventType, want := range map[string]bool{
+		"orchestration_RequestCompleted": true,
+		"orchestration_SessionSwitched":  true,
+		"reminders_ReminderDue":          true,
+		"llmprocessor_StatusChanged":     true,
+		"briefing_BriefingDelivered":     true,
+		"taskmanager_TaskCreated":        false,
+		"usage_TokenUsageRecorded":       false,
+	} {
+		if got := ChangesChat(eventType); got != want {
+			t.Errorf("ChangesChat(%s) = %v, want %v", eventType, got, want)
+		}
+	}
+}
+
+func TestExecuteToolCallCommand_CondensesLargeResults(t *testing.T) {
+	listed := &SessionsListedEvent{EventType: "orchestration_SessionsListed"}
+	for i := 0; i < 200; i++ {
+		listed.Sessions = append(listed.Sessions, chat.Session{ID: fmt.Sprintf("session%d", i), Title: "Buying milk"})
+	}
+	plugin := &progressPlugin{mockPlugin{
+		name: "importer",
+		commands: map[string]eventsourcing.CommandHandler{
+			"Import": eventsourcing.NewCommand(func(input *progressInput) ([]eventsourcing.Event, error) {
+				return []eventsourcing.Event{listed}, nil
+			}),
+		},
+	}}
+	pm := &mockPluginManager{plugins: map[string]eventsourcing.Plugin{"importer": plugin}}
+	llm := &mockLLMClient{responses: map[string]*llmmodels.OllamaResponse{"req2": {Message: llmmodels.OllamaMessage{Content: "200 sessions about buying milk"}, Done: true}}}
+	agg := NewOrchestrationAggregate()
+	ep := &mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}
+	eb := &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)}
+	ro := NewRequestOrchestrator(llm, pm, agg, ep, eb)
+	ro.SetToolResultLimit(500, false)
+
+	completedOf := func(requestID string) ([]eventsourcing.Event, *ToolCallCompleted) {
+		placed := &ToolCallRequestPlaced{RequestID: requestID, ToolCallID: "tool_" + requestID, Function: "Import", Arguments: map[string]interface{}{}}
+		agg.ApplyEvent(placed)
+		events, err := ro.ExecuteToolCallCommand(placed)
+		if err != nil {
+			t.Fatalf("ExecuteToolCall failed: %v", err)
+		}
+		return events, events[len(events)-1].(*ToolCallCompleted)
+	}
+	_, completed := completedOf("req1")
+	if !strings.Contains(completed.Summary, "[Truncated: the first 2000 of") || len(completed.Summary) > 2100 {
+		t.Errorf("Expected the results truncated to about 500 tokens, got %d bytes: %s", len(completed.Summary), completed.Summary[len(completed.Summary)-60:])
+	}
+	if results, _ := completed.Results["result"].([]eventsourcing.Event); len(results) != 1 {
+		t.Errorf("Expected the full results kept in the event, got %v", completed.Results)
+	}
+
+	ro.SetToolResultLimit(500, true)
+	events, completed := completedOf("req2")
+	if _, ok := events[len(events)-2].(*usage.TokenUsageRecordedEvent); !ok || !strings.HasSuffix(completed.Summary, "200 sessions about buying milk") {
+		t.Errorf("Expected the results summarized by the LLM, got %q after %T", completed.Summary, events[len(events)-2])
+	}
+
+	ro.SetToolResultLimit(100000, true)
+	if _, completed := completedOf("req3"); completed.Summary != "" {
+		t.Errorf("Expected results that fit to be kept whole, got %q", completed.Summary)
+	}
+}
+
+func TestToolCallCompleted_Compact(t *testing.T) {
+	summarized := &ToolCallCompleted{Results: map[string]interface{}{"tasks": strings.Repeat("x", 100)}, Summary: "100 tasks"}
+	large := &ToolCallCompleted{Results: map[string]interface{}{"tasks": strings.Repeat("x", 5000)}}
+	small := &ToolCallCompleted{Results: map[string]interface{}{"success": true}}
+	if !summarized.Compact() || summarized.Results["summary"] != "100 tasks" {
+		t.Errorf("Expected the results replaced by their summary, got %v", summarized.Results)
+	}
+	if !large.Compact() || !strings.Contains(large.Results["summary"].(string), "[Truncated") {
+		t.Errorf("Expected the results without summary truncated, got %v", large.Results)
+	}
+	if small.Compact() || summarized.Compact() {
+		t.Error("Expected small and compacted results kept as they are")
+	}
+}
+
+func TestChatView_RendersOnlyChangedRowsInSight(t *testing.T) {
+	test.NewTempApp(t)
+	agg := NewOrchestrationAggregate()
+	for i := 0; i < 300; i++ {
+		agg.ApplyEvent(&UserRequestReceivedEvent{RequestID: fmt.Sprintf("req%d", i), RequestText: fmt.Sprintf("Request %d", i), Timestamp: "2023-01-01T00:00:00Z"})
+		agg.ApplyEvent(&RequestCompletedEvent{RequestID: fmt.Sprintf("req%d", i), ResponseText: fmt.Sprintf("Response %d", i), CompletedAt: "2023-01-01T00:00:01Z"})
+	}
+	view := NewChatView(agg)
+	window := test.NewTempWindow(t, view.Content())
+	window.Resize(fyne.NewSize(600, 400))
+	if len(view.rows) != 600 {
+		t.Fatalf("Expected a row per message, got %d", len(view.rows))
+	}
+	if len(view.rendered) == 0 || len(view.rendered) > 100 {
+		t.Fatalf("Expected only the rows in sight rendered, got %d of %d", len(view.rendered), len(view.rows))
+	}
+	if _, ok := view.rendered[view.rows[599].key]; !ok {
+		t.Error("Expected the view to start at the latest message")
+	}
+
+	// A new request appends rows, the rows rendered before are kept
+	last := view.rendered[view.rows[599].key]
+	agg.ApplyEvent(&UserRequestReceivedEvent{RequestID: "req300", RequestText: "One more", Timestamp: "2023-01-01T00:00:02Z"})
+	agg.ApplyEvent(&AgentCallDecidedEvent{RequestID: "req300", AgentName: "taskmanager", Timestamp: "2023-01-01T00:00:03Z"})
+	view.Update()
+	if len(view.rows) != 603 || view.rows[602].key != "pending_req300" {
+		t.Fatalf("Expected the request, its agent and the progress indicator appended, got %d rows ending in %s", len(view.rows), view.rows[len(view.rows)-1].key)
+	}
+	if view.rendered[view.rows[599].key] != last {
+		t.Error("Expected the unchanged rows not to be rendered again")
+	}
+	if _, ok := view.rendered["pending_req300"]; !ok {
+		t.Error("Expected the view to follow the new rows")
+	}
+
+	// Scrolled up to read back, the view stays where it is
+	view.list.ScrollToTop()
+	agg.ApplyEvent(&RequestCompletedEvent{RequestID: "req300", ResponseText: "Done", CompletedAt: "2023-01-01T00:00:04Z"})
+	view.Update()
+	if offset := view.list.GetScrollOffset(); offset != 0 {
+		t.Errorf("Expected the scroll position kept, got %v", offset)
+	}
+	if _, ok := view.rendered[view.rows[0].key]; !ok {
+		t.Error("Expected the first rows shown")
+	}
+}
+
+func TestDiffRows(t *testing.T) {
+	rows := func(keys ...string) []chatRow {
+		var result []chatRow
+		for _, key := range keys {
+			result = append(result, chatRow{key: key, signature: key})
+		}
+		return result
+	}
+	changedRow := rows("a", "b")
+	changedRow[1].signature = "b2"
+	for name, tc := range map[string]struct {
+		prev, next []chatRow
+		changed    []widget.ListItemID
+		reset      bool
+	}{
+		"unchanged": {prev: rows("a", "b"), next: rows("a", "b")},
+		"appended":  {prev: rows("a"), next: rows("a", "b", "c"), changed: []widget.ListItemID{1, 2}},
+		"changed":   {prev: rows("a", "b"), next: changedRow, changed: []widget.ListItemID{1}},
+		"removed":   {prev: rows("a", "b"), next: rows("a"), reset: true},
+		"replaced":  {prev: rows("a", "b"), next: rows("a", "c", "b"), reset: true},
+	} {
+		changed, reset := diffRows(tc.prev, tc.next)
+		if reset != tc.reset || !reflect.DeepEqual(changed, tc.changed) {
+			t.Errorf("%s: expected %v and reset %v, got %v and %v", name, tc.changed, tc.reset, changed, reset)
+		}
+	}
+}
+
+func TestToolCallInspection(t *testing.T) {
+	agg := NewOrchestrationAggregate()
+	placed := &ToolCallRequestPlaced{RequestID: "req1", ToolCallID: "tool1", Function: "CreateTask", Arguments: map[string]interface{}{"title": "Groceries"}, Timestamp: "2024-03-05T10:00:00Z"}
+	events := []eventsourcing.Event{
+		placed,
+		&ToolCallStarted{RequestID: "req1", ToolCallID: "tool1", Function: "CreateTask", Timestamp: "2024-03-05T10:00:00Z"},
+		&ToolCallFailedEvent{RequestID: "req1", ToolCallID: "tool1", Function: "CreateTask", ErrorMsg: "conflict", Timestamp: "2024-03-05T10:00:01Z", Attempt: 1, WillRetry: true},
+		&ToolCallRequestPlaced{RequestID: "req1", ToolCallID: "tool1", Function: "CreateTask", Arguments: placed.Arguments, Timestamp: "2024-03-05T10:00:02Z", Attempt: 2},
+		&ToolCallStarted{RequestID: "req1", ToolCallID: "tool1", Function: "CreateTask", Timestamp: "2024-03-05T10:00:02Z"},
+	}
+	for _, event := range events {
+		if err := agg.ApplyEvent(event); err != nil {
+			t.Fatalf("ApplyEvent(%s): %v", event.Type(), err)
+		}
+	}
+	completed := &ToolCallCompleted{
+		RequestID:  "req1",
+		ToolCallID: "tool1",
+		Function:   "CreateTask",
+		Results:    map[string]interface{}{"result": []interface{}{map[string]interface{}{"task_id": "t1", "title": "Groceries"}}},
+		Events:     []string{"taskmanager_TaskCreated"},
+		Timestamp:  "2024-03-05T10:00:05Z",
+	}
+	if err := agg.ApplyEvent(completed); err != nil {
+		t.Fatalf("ApplyEvent(completed): %v", err)
+	}
+
+	inspection := agg.ToolCallStates["tool1"].inspect()
+	if inspection.Attempts != 2 || len(inspection.Failures) != 1 || !strings.Contains(inspection.Failures[0], "conflict") {
+		t.Errorf("Expected the failed first attempt to be inspected, got %d attempts and failures %v", inspection.Attempts, inspection.Failures)
+	}
+	if inspection.Duration != "3s" {
+		t.Errorf("Expected the last attempt to have taken 3s, got %q", inspection.Duration)
+	}
+	if len(inspection.Events) != 1 || !strings.HasPrefix(inspection.Events[0], "taskmanager_TaskCreated\n") || !strings.Contains(inspection.Events[0], `"task_id": "t1"`) {
+		t.Errorf("Expected the emitted event with its type, got %v", inspection.Events)
+	}
+	if !strings.Contains(inspection.Arguments, `"title": "Groceries"`) {
+		t.Errorf("Expected pretty-printed arguments, got %s", inspection.Arguments)
+	}
+
+	details := agg.DisplayInfos["tool_call_tool1"].Details
+	if details["duration"] != "3s" || details["attempts"] != 2 || details["events"] == nil {
+		t.Errorf("Expected the inspection in the display info, got %v", details)
+	}
+	actions := agg.Broadcast3DDelta(completed)
+	last := actions[len(actions)-1]
+	if last.NodeID != "tool_call_tool1" || last.Properties["display_info"] == nil {
+		t.Errorf("Expected the delta to hand Godot the display info, got %+v", last)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	rendered := RenderMarkdown("# Plan\n\nSee [the docs](https://example.com) and **do** it.\n\n- one\n  - nested\n- two\n\n> quoted\n\n| Task | Due |\n|------|----:|\n| Groceries | today |\n\n```go\nfunc main() {}\n```\n")
+
+	var richTexts []*widget.RichText
+	scrolls := 0
+	var walk func(object fyne.CanvasObject)
+	walk = func(object fyne.CanvasObject) {
+		switch o := object.(type) {
+		case *widget.RichText:
+			richTexts = append(richTexts, o)
+		case *container.Scroll:
+			scrolls++
+			walk(o.Content)
+		case *fyne.Container:
+			for _, child := range o.Objects {
+				walk(child)
+			}
+		}
+	}
+	walk(rendered)
+
+	var heading, link, list, header bool
+	for _, richText := range richTexts {
+		for _, segment := range richText.Segments {
+			switch s := segment.(type) {
+			case *widget.TextSegment:
+				heading = heading || (s.Text == "Plan" && s.Style == widget.RichTextStyleHeading)
+				header = header || (s.Text == "Task" && s.Style.TextStyle.Bold)
+			case *widget.HyperlinkSegment:
+				link = link || (s.Text == "the docs" && s.URL.String() == "https://example.com")
+			case *widget.ListSegment:
+				_, nested := s.Items[1].(*widget.ListSegment)
+				list = list || (len(s.Items) == 3 && nested)
+			}
+		}
+	}
+	if !heading || !link || !list || !header {
+		t.Errorf("Expected a heading, link, nested list and table header, got %v %v %v %v", heading, link, list, header)
+	}
+	if scrolls != 1 {
+		t.Errorf("Expected the code block to scroll sideways, got %d scrolls", scrolls)
+	}
+}
+
+func TestHighlightCode(t *testing.T) {
+	colors := make(map[string]fyne.ThemeColorName)
+	for _, segment := range highlightCode("func main() { // start\n\tfmt.Println(\"hi\", 42)\n}", "go") {
+		s := segment.(*widget.TextSegment)
+		colors[s.Text] = s.Style.ColorName
+	}
+	expected := map[string]fyne.ThemeColorName{
+		"func":             theme.ColorNamePrimary,
+		"// start":         theme.ColorNamePlaceHolder,
+		"\"hi\"":           theme.ColorNameSuccess,
+		"42":               theme.ColorNameWarning,
+		"\n\tfmt.Println(": "",
+	}
+	for text, color := range expected {
+		if colors[text] != color {
+			t.Errorf("Expected %q colored %q, got %q", text, color, colors[text])
+		}
+	}
+	if segments := highlightCode("some text", "klingon"); len(segments) != 1 {
+		t.Errorf("Expected code of unknown languages plain, got %d segments", len(segments))
+	}
+}
+
+func TestRelevantTools(t *testing.T) {
+	tool := func(name, description string) llmmodels.Tool {
+		return llmmodels.Tool{Type: "function", Function: map[string]interface{}{"name": name, "description": description}}
+	}
+	tools := []llmmodels.Tool{
+		tool("CreateTask", "Creates a new task"),
+		tool("ListTasks", "Lists the tasks"),
+		tool("SetReminder", "Reminds the user at a time"),
+		tool("DeleteTask", "Deletes a task"),
+	}
+	texts := make([]string, len(tools))
+	for i, tool := range tools {
+		texts[i] = toolText(tool)
+	}
+	names := func(tools []llmmodels.Tool) string {
+		var names []string
+		for _, tool := range tools {
+			names = append(names, tool.Function["name"].(string))
+		}
+		return strings.Join(names, ",")
+	}
+
+	if got := names(relevantTools("remind me to delete the old one", tools, texts, 2)); got != "SetReminder,DeleteTask" {
+		t.Errorf("Expected the best matches in their order, got %s", got)
+	}
+	// Too few matches are filled up with the tools given first
+	if got := names(relevantTools("reminders please", tools, texts, 2)); got != "CreateTask,SetReminder" {
+		t.Errorf("Expected the reminder and the first tool, got %s", got)
+	}
+	if got := relevantTools("anything", tools, texts, 0); len(got) != len(tools) {
+		t.Errorf("Expected all tools without a limit, got %d", len(got))
+	}
+}
+
+func TestGatherAgentTools_Relevant(t *testing.T) {
+	agents := make(map[string]string)
+	for _, name := range []string{"calendar", "contacts", "email", "finances", "journal", "taskmanager"} {
+		agents[name] = ""
+	}
+	ro := newFanOutOrchestrator(&mockLLMClient{}, agents)
+	ro.SetToolLimit(2)
+
+	tools := ro.gatherAgentTools("", "Any email from Alice in my calendar?")
+	if len(tools) != 3 || tools[0].Function["name"] != undoToolName {
+		t.Fatalf("Expected the undo tool and two agents, got %d tools", len(tools))
+	}
+	for _, tool := range tools[1:] {
+		if name := tool.Function["name"]; name != "email" && name != "calendar" {
+			t.Errorf("Expected the email and calendar agents, got %v", name)
+		}
+	}
+	ro.SetToolLimit(0)
+	if tools := ro.gatherAgentTools("", "Any email from Alice?"); len(tools) != 7 {
+		t.Errorf("Expected every agent without a limit, got %d tools", len(tools))
+	}
+}
+
+// examplePlugin is a schemaPlugin with examples of its own
+type examplePlugin struct {
+	schemaPlugin
+	examples []eventsourcing.Example
+}
+
+func (p *examplePlugin) Examples() []eventsourcing.Example { return p.examples }
+
+// addedExamples are examples the user added, by plugin
+type addedExamples map[string][]eventsourcing.Example
+
+func (a addedExamples) ExamplesFor(userID string, plugin eventsourcing.Plugin) []eventsourcing.Example {
+	return append(plugin.(eventsourcing.ExampleProvider).Examples(), a[plugin.Name()]...)
+}
+
+func TestCallPluginAgent_Examples(t *testing.T) {
+	noop := eventsourcing.NewCommand(func(input *map[string]interface{}) ([]eventsourcing.Event, error) { return nil, nil })
+	plugin := &examplePlugin{
+		schemaPlugin: schemaPlugin{mockPlugin{name: "taskmanager", commands: map[string]eventsourcing.CommandHandler{"CreateTask": noop, "ListTasks": noop}}},
+		examples: []eventsourcing.Example{
+			{Request: "remind me to call mom", Command: "CreateTask", Arguments: map[string]interface{}{"Title": "Call mom"}},
+			{Request: "archive the old tasks", Command: "ArchiveTasks"},
+		},
+	}
+	llmClient := &recordingLLMClient{}
+	ro := NewRequestOrchestrator(llmClient, &mockPluginManager{plugins: map[string]eventsourcing.Plugin{"taskmanager": plugin}}, NewOrchestrationAggregate(),
+		&mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}, &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)})
+
+	if _, _, err := ro.CallPluginAgent(plugin, "remind me to water the plants", "req1"); err != nil {
+		t.Fatalf("CallPluginAgent failed: %v", err)
+	}
+	prompt := llmClient.messages[0].Content
+	if !strings.Contains(prompt, "Request: remind me to call mom\nCall: CreateTask {\"Title\":\"Call mom\"}") {
+		t.Errorf("Expected the plugin's example in the prompt, got %q", prompt)
+	}
+	if strings.Contains(prompt, "ArchiveTasks") {
+		t.Errorf("Expected no example of a command the agent isn't offered, got %q", prompt)
+	}
+
+	// Of many examples, those closest to the request are shown
+	added := addedExamples{}
+	for i := 0; i < maxExamples; i++ {
+		added["taskmanager"] = append(added["taskmanager"], eventsourcing.Example{Request: fmt.Sprintf("show my list %d", i), Command: "ListTasks"})
+	}
+	added["taskmanager"] = append(added["taskmanager"], eventsourcing.Example{Request: "groceries: milk", Command: "CreateTask", Arguments: map[string]interface{}{"Tags": []string{"groceries"}}})
+	ro.SetExampleSource(added)
+	if _, _, err := ro.CallPluginAgent(plugin, "groceries: bread", "req2"); err != nil {
+		t.Fatalf("CallPluginAgent failed: %v", err)
+	}
+	prompt = llmClient.messages[0].Content
+	if !strings.Contains(prompt, "Request: groceries: milk") || strings.Count(prompt, "Request: ") != maxExamples {
+		t.Errorf("Expected the %d closest examples, the groceries one among them, got %q", maxExamples, prompt)
+	}
+}
+
+// corrections are the corrections of each user
+type corrections map[string][]Correction
+
+func (c corrections) CorrectionsFor(userID string) []Correction { return c[userID] }
+
+func TestSystemPrompt_Corrections(t *testing.T) {
+	agg := NewOrchestrationAggregate()
+	ro := NewRequestOrchestrator(&mockLLMClient{}, &mockPluginManager{}, agg,
+		&mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}, &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)})
+	if got := ro.systemPrompt("req1"); got != DefaultSystemPrompt {
+		t.Errorf("Expected the system prompt alone without corrections, got %q", got)
+	}
+
+	ro.SetCorrectionSource(corrections{"": {{Request: "what's on friday?", Response: "Nothing planned.", Comment: "I have the dentist"}}})
+	prompt := ro.systemPrompt("req1")
+	if !strings.HasPrefix(prompt, DefaultSystemPrompt) || !strings.Contains(prompt, "Request: what's on friday?\nAnswer: Nothing planned.\nComment: I have the dentist") {
+		t.Errorf("Expected the owner's correction in the system prompt, got %q", prompt)
+	}
+}
+
+func TestRequestTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	pm := &mockPluginManager{plugins: map[string]eventsourcing.Plugin{"notes": &schemaPlugin{mockPlugin{
+		name: "notes",
+		commands: map[string]eventsourcing.CommandHandler{
+			"addNote": eventsourcing.NewCommand(func(input *map[string]interface{}) ([]eventsourcing.Event, error) {
+				return []eventsourcing.Event{&usage.TokenUsageRecordedEvent{Model: "plugin"}}, nil
+			}),
+		},
+	}}}}
+	agg := NewOrchestrationAggregate()
+	ep := &mockEventProcessor{commands: make(map[string]eventsourcing.CommandHandler)}
+	eb := &mockEventBus{subscriptions: make(map[string][]eventsourcing.EventHandler)}
+	ro := NewRequestOrchestrator(&mockLLMClient{}, pm, agg, ep, eb)
+
+	received, err := ep.commands["ProcessUserRequest"].Execute(map[string]interface{}{"requestText": "Note to buy milk", "requestID": "req1"})
+	if err != nil {
+		t.Fatalf("ProcessUserRequest failed: %v", err)
+	}
+	traceID := received[0].Metadata().TraceID
+	if traceID == "" || traceID != ro.traceID("req1") {
+		t.Fatalf("Expected the request's event to carry its trace, got %q", traceID)
+	}
+	agg.ApplyEvent(received[0])
+
+	placed := &ToolCallRequestPlaced{RequestID: "req1", ToolCallID: "tool1", Function: "addNote", Timestamp: "2023-01-01T00:00:01Z"}
+	agg.ApplyEvent(placed)
+	events, err := ep.commands["ExecuteToolCall"].Execute(placed)
+	if err != nil {
+		t.Fatalf("ExecuteToolCall failed: %v", err)
+	}
+	for _, event := range events {
+		if event.Metadata().TraceID != traceID {
+			t.Errorf("Expected %s, emitted by the tool call, in the request's trace, got %q", event.Type(), event.Metadata().TraceID)
+		}
+	}
+	if _, _, err := ro.callLLM([]llmmodels.Message{{Role: "user", Content: "Note to buy milk"}}, nil, "req1", "", "completion"); err != nil {
+		t.Fatalf("callLLM failed: %v", err)
+	}
+	for _, handler := range eb.subscriptions["orchestration_RequestCompleted"] {
+		handler(&RequestCompletedEvent{RequestID: "req1"})
+	}
+	if ro.traceID("req1") != "" {
+		t.Error("Expected the trace to end with the request")
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+		if span.SpanContext().TraceID().String() != traceID {
+			t.Errorf("Expected span %s in the request's trace", span.Name())
+		}
+	}
+	request := spans["request"]
+	if request == nil {
+		t.Fatalf("Expected the request's span ended, got %v", spans)
+	}
+	for _, name := range []string{"tool addNote", "llm completion"} {
+		if span := spans[name]; span == nil || span.Parent().SpanID() != request.SpanContext().SpanID() {
+			t.Errorf("Expected a span %s within the request's, got %v", name, spans)
+		}
+	}
+
+	// Requests not traced, e.g. made before a restart, have no trace IDs
+	untraced := &ToolCallRequestPlaced{RequestID: "req0", ToolCallID: "tool0", Function: "addNote"}
+	events, _ = ep.commands["ExecuteToolCall"].Execute(untraced)
+	for _, event := range events {
+		if event.Metadata().TraceID != "" {
+			t.Errorf("Expected %s of an untraced request without a trace, got %q", event.Type(), event.Metadata().TraceID)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package orchestration
+
+import (
+	"sync"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// progressOf returns the function a long-running command of the tool call reports its progress
+// with. Each report that changes something is published as a ToolCallProgressEvent right away,
+// while the command still runs; reports of a cancelled request are dropped.
+func (ro *RequestOrchestrator) progressOf(placed *ToolCallRequestPlaced) eventsourcing.ProgressFunc {
+	var mu sync.Mutex
+	lastPercent, lastMessage := -1, ""
+	return func(percent int, message string) {
+		percent = max(0, min(100, percent))
+		mu.Lock()
+		unchanged := percent == lastPercent && message == lastMessage
+		lastPercent, lastMessage = percent, message
+		mu.Unlock()
+		if unchanged || ro.isCancelled(placed.RequestID) {
+			return
+		}
+		ro.publish(&ToolCallProgressEvent{
+			EventType:  "orchestration_ToolCallProgress",
+			RequestID:  placed.RequestID,
+			ToolCallID: placed.ToolCallID,
+			Function:   placed.Function,
+			Attempt:    toolCallAttempt(placed),
+			Percent:    percent,
+			Message:    message,
+			Timestamp:  eventsourcing.ISOTimestamp(),
+		})
+	}
+}
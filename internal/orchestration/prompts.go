@@ -0,0 +1,93 @@
+package orchestration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SystemPromptName names the base system prompt among the prompts with versions; the agents' prompts are
+// named after their plugins
+const SystemPromptName = "system"
+
+// DefaultSystemPrompt is the built-in base system prompt of the conversation with MindPalace
+const DefaultSystemPrompt = "You are MindPalace, a friendly AI assistant here to help with various queries and tasks."
+
+// PromptSource gives the version of a prompt a request is made with, see prompts.Registry
+type PromptSource interface {
+	PromptFor(requestID, name, builtin string) string
+}
+
+// SetPromptSource makes the requests with the versions of the prompts the source gives, rather than the
+// built-in prompts
+func (ro *RequestOrchestrator) SetPromptSource(source PromptSource) {
+	ro.promptSource = source
+}
+
+// prompt returns the text of the named prompt the request is made with, builtin without a prompt source
+func (ro *RequestOrchestrator) prompt(requestID, name, builtin string) string {
+	if ro.promptSource == nil {
+		return builtin
+	}
+	return ro.promptSource.PromptFor(requestID, name, builtin)
+}
+
+// Correction is a comment of the user on an earlier answer, shown to MindPalace so it answers better
+type Correction struct {
+	Request  string
+	Response string
+	Comment  string
+}
+
+// CorrectionSource gives the corrections of a user shown to MindPalace, see feedback.Registry
+type CorrectionSource interface {
+	CorrectionsFor(userID string) []Correction
+}
+
+// SetCorrectionSource shows MindPalace the corrections of the source in its system prompt
+func (ro *RequestOrchestrator) SetCorrectionSource(source CorrectionSource) {
+	ro.correctionSource = source
+}
+
+// PinSource gives the facts a user pinned, see pins.Registry. Facts are pinned with the PinFact command.
+type PinSource interface {
+	PinnedFor(userID string) []string
+}
+
+// SetPinSource shows MindPalace and the agents the facts of the source in every system prompt, and lets the
+// router pin facts with the PinFact tool
+func (ro *RequestOrchestrator) SetPinSource(source PinSource) {
+	ro.pinSource = source
+}
+
+// pinnedPrompt returns the part of a system prompt listing the facts the user pinned, empty if there are none
+func (ro *RequestOrchestrator) pinnedPrompt(userID string) string {
+	if ro.pinSource == nil {
+		return ""
+	}
+	facts := ro.pinSource.PinnedFor(userID)
+	if len(facts) == 0 {
+		return ""
+	}
+	return "\n\nFacts the user pinned, they always hold:\n- " + strings.Join(facts, "\n- ")
+}
+
+// systemPrompt returns the system prompt the request is made with, followed by the facts its user pinned and
+// their corrections
+func (ro *RequestOrchestrator) systemPrompt(requestID string) string {
+	userID := ro.agg.userOf(requestID)
+	prompt := ro.prompt(requestID, SystemPromptName, DefaultSystemPrompt) + ro.pinnedPrompt(userID)
+	if ro.correctionSource == nil {
+		return prompt
+	}
+	corrections := ro.correctionSource.CorrectionsFor(userID)
+	if len(corrections) == 0 {
+		return prompt
+	}
+	var sb strings.Builder
+	sb.WriteString(prompt)
+	sb.WriteString("\n\nThe user corrected these earlier answers, keep their comments in mind:")
+	for _, correction := range corrections {
+		fmt.Fprintf(&sb, "\nRequest: %s\nAnswer: %s\nComment: %s\n", correction.Request, correction.Response, correction.Comment)
+	}
+	return sb.String()
+}
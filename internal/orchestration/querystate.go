@@ -0,0 +1,441 @@
+package orchestration
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"mindpalace/internal/chat"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/llmmodels"
+	"mindpalace/pkg/nltime"
+)
+
+// queryStateToolName is the tool the LLM calls to read the state of plugins before it answers or
+// delegates, e.g. to compare tasks with calendar events
+const queryStateToolName = "QueryState"
+
+// listByTagToolName is the tool the LLM calls to find the items of all plugins with a tag, e.g. to
+// show everything tagged #health
+const listByTagToolName = "ListByTag"
+
+// Tools the LLM calls to link the items of different plugins, e.g. a task to the meeting it prepares,
+// and to find the items linked to one
+const (
+	linkItemsToolName    = "LinkItems"
+	unlinkItemsToolName  = "UnlinkItems"
+	relatedItemsToolName = "RelatedItems"
+)
+
+// searchChatToolName is the tool the LLM calls to find earlier messages of the conversation, e.g. to
+// find where the dentist appointment was discussed
+const searchChatToolName = "SearchChat"
+
+// pinFactToolName is the tool the LLM calls to pin a fact the user tells it to remember, e.g. "my wife's
+// name is Ana", so it is part of every system prompt
+const pinFactToolName = "PinFact"
+
+// searchChatLimit is the number of most recent messages SearchChat returns
+const searchChatLimit = 20
+
+// maxStateQueries is the number of times the router may query state, list tags or link items for one request
+const maxStateQueries = 3
+
+// StateSource reads the state aggregates share with the orchestrator, see
+// aggregate.AggregateManager.QueryState
+type StateSource interface {
+	QueryableAggregates(userID string) []string
+	QueryState(userID string, names []string) map[string]any
+}
+
+// SetStateSource lets the router read the state of the plugins' aggregates with the QueryState tool
+func (ro *RequestOrchestrator) SetStateSource(source StateSource) {
+	ro.stateSource = source
+}
+
+// TagLister finds the items of all plugins with a tag, see tags.Registry.ItemsTagged
+type TagLister interface {
+	ItemsTagged(userID, tag string) []eventsourcing.TaggedItem
+}
+
+// SetTagLister lets the router list the items with a tag with the ListByTag tool
+func (ro *RequestOrchestrator) SetTagLister(lister TagLister) {
+	ro.tagLister = lister
+}
+
+// ItemLinker finds the items linked to an item, see links.Registry.RelatedItems. Items are linked and
+// unlinked with the LinkItems and UnlinkItems commands.
+type ItemLinker interface {
+	RelatedItems(userID, aggregate, id string) []eventsourcing.Item
+}
+
+// SetItemLinker lets the router link items with the LinkItems and UnlinkItems tools and find the items
+// linked to one with the RelatedItems tool
+func (ro *RequestOrchestrator) SetItemLinker(linker ItemLinker) {
+	ro.itemLinker = linker
+}
+
+// isRouterTool reports whether the router runs the tool itself, to read state or link items, rather than
+// delegating it to an agent
+func isRouterTool(name string) bool {
+	switch name {
+	case queryStateToolName, listByTagToolName, searchChatToolName, linkItemsToolName, unlinkItemsToolName, relatedItemsToolName, pinFactToolName, focusOnToolName:
+		return true
+	}
+	return false
+}
+
+// queryStateTool describes QueryState to the LLM, listing the aggregates it can read; nil if there are none
+func (ro *RequestOrchestrator) queryStateTool(userID string) *llmmodels.Tool {
+	if ro.stateSource == nil {
+		return nil
+	}
+	names := ro.stateSource.QueryableAggregates(userID)
+	if len(names) == 0 {
+		return nil
+	}
+	return &llmmodels.Tool{
+		Type: "function",
+		Function: map[string]interface{}{
+			"name":        queryStateToolName,
+			"description": "Read the current state of plugins as JSON, to answer questions that need data of several plugins, e.g. tasks due before the next meeting. Nothing is changed.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"aggregates": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string", "enum": names},
+						"description": "Plugins to read the state of, all if not given",
+					},
+				},
+			},
+		},
+	}
+}
+
+// listByTagTool describes ListByTag to the LLM; nil if tags can't be listed
+func (ro *RequestOrchestrator) listByTagTool() *llmmodels.Tool {
+	if ro.tagLister == nil {
+		return nil
+	}
+	return &llmmodels.Tool{
+		Type: "function",
+		Function: map[string]interface{}{
+			"name":        listByTagToolName,
+			"description": "List the tasks, calendar events and other items of all plugins with a tag as JSON, e.g. to show everything tagged #health. Aliases of the tag count too. Nothing is changed.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"tag": map[string]interface{}{
+						"type":        "string",
+						"description": "The tag, with or without #",
+					},
+				},
+				"required": []string{"tag"},
+			},
+		},
+	}
+}
+
+// linkTools describe LinkItems, UnlinkItems and RelatedItems to the LLM; none if items can't be linked
+func (ro *RequestOrchestrator) linkTools() []llmmodels.Tool {
+	if ro.itemLinker == nil {
+		return nil
+	}
+	property := func(description string) map[string]interface{} {
+		return map[string]interface{}{"type": "string", "description": description}
+	}
+	pair := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"from_aggregate": property("Plugin of the first item, e.g. taskmanager"),
+			"from_id":        property("ID of the first item, as QueryState or ListByTag show it"),
+			"to_aggregate":   property("Plugin of the second item, e.g. calendar"),
+			"to_id":          property("ID of the second item"),
+		},
+		"required": []string{"from_aggregate", "from_id", "to_aggregate", "to_id"},
+	}
+	tool := func(name, description string, parameters map[string]interface{}) llmmodels.Tool {
+		return llmmodels.Tool{
+			Type:     "function",
+			Function: map[string]interface{}{"name": name, "description": description, "parameters": parameters},
+		}
+	}
+	return []llmmodels.Tool{
+		tool(linkItemsToolName, "Link two items of different plugins that belong together, e.g. the task \"prepare slides\" to Friday's meeting. Both show a badge for the link.", pair),
+		tool(unlinkItemsToolName, "Remove the link between two items.", pair),
+		tool(relatedItemsToolName, "List the items linked to an item as JSON, e.g. the tasks for a meeting. Nothing is changed.", map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"aggregate": property("Plugin of the item, e.g. calendar"),
+				"id":        property("ID of the item"),
+			},
+			"required": []string{"aggregate", "id"},
+		}),
+	}
+}
+
+// linkResult runs a LinkItems, UnlinkItems or RelatedItems call and returns its result as JSON, or why it
+// failed so the LLM can correct its call
+func (ro *RequestOrchestrator) linkResult(userID, name string, arguments map[string]interface{}) (string, error) {
+	var result interface{}
+	if name == relatedItemsToolName {
+		aggregate, _ := arguments["aggregate"].(string)
+		id, _ := arguments["id"].(string)
+		result = ro.itemLinker.RelatedItems(userID, aggregate, id)
+	} else {
+		data := map[string]interface{}{"userID": userID}
+		for _, key := range []string{"from_aggregate", "from_id", "to_aggregate", "to_id"} {
+			data[key], _ = arguments[key].(string)
+		}
+		if err := ro.eventProcessor.ExecuteCommand(name, data); err != nil {
+			result = map[string]string{"error": err.Error()}
+		} else {
+			result = map[string]bool{"done": true}
+		}
+	}
+	content, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s result: %v", name, err)
+	}
+	return string(content), nil
+}
+
+// pinFactTool describes PinFact to the LLM; nil if facts can't be pinned
+func (ro *RequestOrchestrator) pinFactTool() *llmmodels.Tool {
+	if ro.pinSource == nil {
+		return nil
+	}
+	return &llmmodels.Tool{
+		Type: "function",
+		Function: map[string]interface{}{
+			"name":        pinFactToolName,
+			"description": "Pin a lasting fact about the user that should always be remembered, e.g. \"My wife's name is Ana\". Only when the user asks to remember it.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"text": map[string]interface{}{
+						"type":        "string",
+						"description": "The fact as one short sentence",
+					},
+				},
+				"required": []string{"text"},
+			},
+		},
+	}
+}
+
+// pinResult runs a PinFact call and returns its result as JSON, or why it failed so the LLM can correct its call
+func (ro *RequestOrchestrator) pinResult(userID, requestID string, arguments map[string]interface{}) (string, error) {
+	text, _ := arguments["text"].(string)
+	var result interface{} = map[string]bool{"pinned": true}
+	if err := ro.eventProcessor.ExecuteCommand(pinFactToolName, map[string]interface{}{"userID": userID, "text": text, "requestID": requestID}); err != nil {
+		result = map[string]string{"error": err.Error()}
+	}
+	content, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s result: %v", pinFactToolName, err)
+	}
+	return string(content), nil
+}
+
+// searchChatTool describes SearchChat to the LLM
+func searchChatTool() llmmodels.Tool {
+	property := func(description string) map[string]interface{} {
+		return map[string]interface{}{"type": "string", "description": description}
+	}
+	return llmmodels.Tool{
+		Type: "function",
+		Function: map[string]interface{}{
+			"name":        searchChatToolName,
+			"description": "Search the messages of all conversations with the user, including older sessions, e.g. to find where an appointment was discussed. Returns the most recent matches as JSON. Nothing is changed.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"text":  property("Words the messages contain"),
+					"role":  property("Only messages of this role: user, assistant or tool"),
+					"agent": property("Only messages of this agent, e.g. calendar"),
+					"tag":   property("Only messages with this tag, e.g. #health"),
+					"from":  property("Only messages since this date, e.g. 2024-05-01 or 2 weeks ago"),
+					"to":    property("Only messages until this date"),
+				},
+			},
+		},
+	}
+}
+
+// searchChat runs a SearchChat call on the user's chat
+func (ro *RequestOrchestrator) searchChat(userID string, arguments map[string]interface{}) ([]chat.Message, error) {
+	query := chat.MessageQuery{Limit: searchChatLimit}
+	query.Text, _ = arguments["text"].(string)
+	query.Role, _ = arguments["role"].(string)
+	query.Agent, _ = arguments["agent"].(string)
+	query.Tag, _ = arguments["tag"].(string)
+	for name, bound := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		text, _ := arguments[name].(string)
+		if text == "" {
+			continue
+		}
+		t, err := nltime.Parse(text, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s date: %v", name, err)
+		}
+		*bound = t
+	}
+	return ro.agg.ChatManagerFor(userID).SearchMessages(query), nil
+}
+
+// foundMessage is a message found by SearchChat, as the LLM reads it
+type foundMessage struct {
+	Time    string `json:"time"`
+	Role    string `json:"role"`
+	Agent   string `json:"agent,omitempty"`
+	Session string `json:"session"`
+	Content string `json:"content"`
+}
+
+// route has the router LLM decide on the request. When it queries state, lists tagged items, searches
+// the chat, links items, pins a fact or moves the camera, the result is added to the messages as a tool result and the LLM is asked
+// again, until it answers or calls other tools. The returned events record the tokens of every call.
+func (ro *RequestOrchestrator) route(messages []llmmodels.Message, userID, requestID, request string) (*llmmodels.OllamaResponse, []eventsourcing.Event, error) {
+	var usageEvents []eventsourcing.Event
+	for round := 0; ; round++ {
+		tools := ro.gatherAgentTools(userID, request)
+		if round < maxStateQueries {
+			if tool := ro.queryStateTool(userID); tool != nil {
+				tools = append(tools, *tool)
+			}
+			if tool := ro.listByTagTool(); tool != nil {
+				tools = append(tools, *tool)
+			}
+			tools = append(tools, searchChatTool())
+			tools = append(tools, ro.linkTools()...)
+			if tool := ro.pinFactTool(); tool != nil {
+				tools = append(tools, *tool)
+			}
+			tools = append(tools, focusOnTool())
+		}
+		resp, usageEvent, err := ro.callLLM(messages, tools, requestID, "", "router")
+		if usageEvent != nil {
+			usageEvents = append(usageEvents, usageEvent)
+		}
+		if err != nil || round == maxStateQueries {
+			return resp, usageEvents, err
+		}
+		results, err := ro.readResults(resp, userID, requestID)
+		if err != nil || len(results) == 0 {
+			return resp, usageEvents, err
+		}
+		messages = append(messages, results...)
+	}
+}
+
+// readResults runs the response's calls of the tools the router runs itself and returns their results
+// as tool messages, none if the response calls no such tool
+func (ro *RequestOrchestrator) readResults(resp *llmmodels.OllamaResponse, userID, requestID string) ([]llmmodels.Message, error) {
+	var results []llmmodels.Message
+	if names, queried := stateQuery(resp); queried && ro.stateSource != nil {
+		state, err := json.Marshal(ro.stateSource.QueryState(userID, names))
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal queried state: %v", err)
+		}
+		logger.Debug("Router of request %s queried the state of %v", requestID, names)
+		results = append(results, llmmodels.Message{Role: "tool", Name: queryStateToolName, Content: string(state)})
+	}
+	for _, call := range resp.Message.ToolCalls {
+		if call.Function.Name == searchChatToolName {
+			content, err := ro.foundMessages(userID, call.Function.Arguments)
+			if err != nil {
+				return nil, err
+			}
+			logger.Debug("Router of request %s searched the chat for %v", requestID, call.Function.Arguments)
+			results = append(results, llmmodels.Message{Role: "tool", Name: searchChatToolName, Content: content})
+			continue
+		}
+		if (call.Function.Name == linkItemsToolName || call.Function.Name == unlinkItemsToolName ||
+			call.Function.Name == relatedItemsToolName) && ro.itemLinker != nil {
+			content, err := ro.linkResult(userID, call.Function.Name, call.Function.Arguments)
+			if err != nil {
+				return nil, err
+			}
+			logger.Debug("Router of request %s called %s with %v", requestID, call.Function.Name, call.Function.Arguments)
+			results = append(results, llmmodels.Message{Role: "tool", Name: call.Function.Name, Content: content})
+			continue
+		}
+		if call.Function.Name == pinFactToolName && ro.pinSource != nil {
+			content, err := ro.pinResult(userID, requestID, call.Function.Arguments)
+			if err != nil {
+				return nil, err
+			}
+			logger.Debug("Router of request %s pinned %v", requestID, call.Function.Arguments)
+			results = append(results, llmmodels.Message{Role: "tool", Name: pinFactToolName, Content: content})
+			continue
+		}
+		if call.Function.Name == focusOnToolName {
+			content, err := ro.focusResult(userID, requestID, call.Function.Arguments)
+			if err != nil {
+				return nil, err
+			}
+			logger.Debug("Router of request %s focused the camera on %v", requestID, call.Function.Arguments)
+			results = append(results, llmmodels.Message{Role: "tool", Name: focusOnToolName, Content: content})
+			continue
+		}
+		if call.Function.Name != listByTagToolName || ro.tagLister == nil {
+			continue
+		}
+		tag, _ := call.Function.Arguments["tag"].(string)
+		items, err := json.Marshal(ro.tagLister.ItemsTagged(userID, tag))
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal tagged items: %v", err)
+		}
+		logger.Debug("Router of request %s listed the items tagged %s", requestID, tag)
+		results = append(results, llmmodels.Message{Role: "tool", Name: listByTagToolName, Content: string(items)})
+	}
+	return results, nil
+}
+
+// foundMessages returns the messages found by a SearchChat call as JSON, or why the search failed so the
+// LLM can correct its call
+func (ro *RequestOrchestrator) foundMessages(userID string, arguments map[string]interface{}) (string, error) {
+	var result interface{}
+	if messages, err := ro.searchChat(userID, arguments); err != nil {
+		result = map[string]string{"error": err.Error()}
+	} else {
+		found := make([]foundMessage, 0, len(messages))
+		for _, msg := range messages {
+			found = append(found, foundMessage{
+				Time:    msg.Timestamp.Format(time.RFC3339),
+				Role:    msg.Role.SystemRole,
+				Agent:   msg.Agent,
+				Session: msg.SessionID,
+				Content: msg.Content,
+			})
+		}
+		result = found
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal found messages: %v", err)
+	}
+	return string(data), nil
+}
+
+// stateQuery returns the aggregates the response's QueryState calls ask for, and whether there are any
+func stateQuery(resp *llmmodels.OllamaResponse) (names []string, queried bool) {
+	for _, call := range resp.Message.ToolCalls {
+		if call.Function.Name != queryStateToolName {
+			continue
+		}
+		queried = true
+		requested, _ := call.Function.Arguments["aggregates"].([]interface{})
+		if len(requested) == 0 {
+			return nil, true // All of them
+		}
+		for _, name := range requested {
+			if name, ok := name.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, queried
+}
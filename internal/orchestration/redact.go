@@ -0,0 +1,87 @@
+package orchestration
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// RedactMessageCommand hides the messages of a request of the user, e.g. {"requestID": "req_1"}, or scrubs a
+// text from their messages, e.g. {"text": "555-0134"}, optionally only from those of one request
+func (ro *RequestOrchestrator) RedactMessageCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	requestID, _ := data["requestID"].(string)
+	text, _ := data["text"].(string)
+	text = strings.TrimSpace(text)
+	if requestID == "" && text == "" {
+		return nil, fmt.Errorf("a requestID or a text to redact is required")
+	}
+	if requestID != "" {
+		if _, exists := ro.agg.ChatManagerFor(eventsourcing.UserOf(data)).UserRequest(requestID); !exists {
+			return nil, fmt.Errorf("there is no request %s to redact", requestID)
+		}
+	}
+	logger.Info("Redacting messages of request %q", requestID)
+	return []eventsourcing.Event{&MessageRedactedEvent{
+		EventType: "orchestration_MessageRedacted",
+		RequestID: requestID,
+		Text:      text,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// Redact applies the user's redactions to the payload of one of their events, see eventsourcing.Redactor
+func (a *OrchestrationAggregate) Redact(userID string, data []byte) []byte {
+	for _, redaction := range a.Redactions {
+		if redaction.UserID == userID {
+			data = redaction.Apply(data)
+		}
+	}
+	return data
+}
+
+// MarshalJSON returns the state the APIs show, with the redacted texts scrubbed from it. The redactions
+// themselves and the bookkeeping of the requests are left out.
+func (a *OrchestrationAggregate) MarshalJSON() ([]byte, error) {
+	type state OrchestrationAggregate // Without the methods, not to marshal recursively
+	data, err := json.Marshal((*state)(a))
+	if err != nil {
+		return nil, err
+	}
+	for _, redaction := range a.Redactions {
+		if redaction.Text != "" {
+			// Texts are scrubbed from the state of every request, which doesn't tell whose each text is
+			data = eventsourcing.Redaction{Text: redaction.Text}.Apply(data)
+		}
+	}
+	return data, nil
+}
+
+// redactStates hides the redacted content of the requests' agent and tool call states shown in the chat
+func (a *OrchestrationAggregate) redactStates(redaction eventsourcing.Redaction) {
+	agents := make([]*AgentState, 0, len(a.AgentStates))
+	for _, agentState := range a.AgentStates {
+		agents = append(agents, agentState)
+	}
+	for _, fanOut := range a.FanOuts {
+		for _, agentState := range fanOut.Agents {
+			agents = append(agents, agentState)
+		}
+	}
+	for _, agentState := range agents {
+		if !redaction.Covers(agentState.RequestID) || a.userOf(agentState.RequestID) != redaction.UserID {
+			continue
+		}
+		if redaction.Text == "" && agentState.Summary != "" {
+			agentState.Summary = eventsourcing.Redacted
+		} else {
+			agentState.Summary = eventsourcing.Scrub(agentState.Summary, redaction.Text)
+		}
+	}
+	for _, toolState := range a.ToolCallStates {
+		if redaction.Text == "" && redaction.RequestID == toolState.RequestID && a.userOf(toolState.RequestID) == redaction.UserID {
+			toolState.Arguments, toolState.Results = nil, nil
+		}
+	}
+}
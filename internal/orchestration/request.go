@@ -1,19 +1,26 @@
 package orchestration
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"text/template"
+	"sort"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	"mindpalace/pkg/eventsourcing"
 	"mindpalace/pkg/llmmodels"
 	"mindpalace/pkg/logging"
 )
 
+// logger logs request handling, from routing to tool calls
+var logger = logging.Named("orchestration")
+
 // Interfaces for testability
 type LLMClientInterface interface {
-	CallLLM(messages []llmmodels.Message, tools []llmmodels.Tool, requestID, model string) (*llmmodels.OllamaResponse, error)
+	CallLLM(ctx context.Context, messages []llmmodels.Message, tools []llmmodels.Tool, requestID, model string) (*llmmodels.OllamaResponse, error)
 }
 
 type PluginManagerInterface interface {
@@ -33,83 +40,124 @@ type EventBusInterface interface {
 	SubscribeAll(handler eventsourcing.EventHandler)
 }
 
-const systemPromptTemplate = `You are MindPalace, a friendly AI assistant here to help with various queries and tasks. Provide helpful, accurate, and concise responses, using tools only when they enhance your ability to assist.
-
-{{if .Agents}}
-
-Based on the user's request, decide if a specialized agent is needed to handle their query efficiently. You can call specialized agents for specific domains by using the CallAgent tool.
-
-Available agents:
-{{range .Agents}}- {{.}}
-{{end}}
-When to call agents:
-- When a request clearly maps to a specific agent's domain
-- When specialized context or tools would benefit the user
-- When the request mentions a specific plugin by name
-
-When NOT to call agents:
-- For general knowledge questions
-- For simple requests that don't need specialized tools
-- When you can handle the request directly
-{{else}}
-Since there are no specialized agents available, respond directly to the user's query.
-{{end}}
-
-Your goal is to provide the most helpful and efficient experience.`
-
 type RequestOrchestrator struct {
-	llmClient        LLMClientInterface
-	pluginManager    PluginManagerInterface
-	agg              *OrchestrationAggregate
-	eventProcessor   EventProcessorInterface
-	eventBus         EventBusInterface
-	systemPromptTmpl *template.Template // Base template, no plugin specifics here
+	llmClient         LLMClientInterface
+	pluginManager     PluginManagerInterface
+	agg               *OrchestrationAggregate
+	eventProcessor    EventProcessorInterface
+	eventBus          EventBusInterface
+	agentWorkers      int         // Maximum number of agents run concurrently in a fan-out
+	retryPolicy       RetryPolicy // Retries of transiently failed tool calls
+	sleep             func(time.Duration)
+	modelsMu          sync.RWMutex
+	agentModels       map[string]string // Plugin name -> model overriding the plugin's AgentModel
+	requestsMu        sync.Mutex
+	runningRequests   map[string]runningRequest // Request ID -> context its LLM calls run in
+	cancelledRequests map[string]bool           // Requests cancelled, also before the cancellation event was applied
+	requestTimeout    time.Duration             // Time a request may take before the watchdog fails it, 0 disables it
+	watchdogs         map[string]*time.Timer    // Request ID -> watchdog timing it out
+	traces            map[string]requestTrace   // Request ID -> its trace while it runs
+	summarizing       sync.Mutex                // Held while the conversation is summarized
+	stateSource       StateSource               // Read by the QueryState tool, nil if state can't be queried
+	tagLister         TagLister                 // Read by the ListByTag tool, nil if tags can't be listed
+	itemLinker        ItemLinker                // Read by the RelatedItems tool, nil if items can't be linked
+	exampleSource     ExampleSource             // Examples shown to the agents, nil for those of their plugins only
+	promptSource      PromptSource              // Versions of the prompts requests are made with, nil for the built-in prompts
+	correctionSource  CorrectionSource          // Corrections of the users shown in the system prompt, nil for none
+	pinSource         PinSource                 // Facts the users pinned, shown in every system prompt, nil for none
+	toolResultTokens  int                       // Tokens a tool result may take in the chat before it is condensed
+	summarizeResults  bool                      // Tool results too large are summarized by the LLM instead of truncated
+	maxTools          int                       // Agents, and commands of an agent, offered per call, 0 for all
+	confirmed         []string                  // Capabilities of plugins whose commands the user approves, see eventsourcing.Manifest
+	toolServersMu     sync.RWMutex
+	toolServers       map[string]attachedServer // External servers whose tools the agents are offered, by name
+	shuttingDown      bool                      // Set by Shutdown, new requests are refused
 }
 
 func NewRequestOrchestrator(llmClient LLMClientInterface, pm PluginManagerInterface, agg *OrchestrationAggregate, ep EventProcessorInterface, eb EventBusInterface) *RequestOrchestrator {
-	tmpl, err := template.New("systemPrompt").Parse(systemPromptTemplate)
-	if err != nil {
-		logging.Error("Failed to parse system prompt template: %v", err)
-		panic(err.Error())
-	}
 	ro := &RequestOrchestrator{
-		llmClient:        llmClient,
-		pluginManager:    pm,
-		agg:              agg,
-		eventProcessor:   ep,
-		eventBus:         eb,
-		systemPromptTmpl: tmpl,
+		llmClient:         llmClient,
+		pluginManager:     pm,
+		agg:               agg,
+		eventProcessor:    ep,
+		eventBus:          eb,
+		agentWorkers:      defaultAgentWorkers,
+		retryPolicy:       DefaultRetryPolicy,
+		toolResultTokens:  DefaultToolResultTokens,
+		maxTools:          DefaultMaxTools,
+		sleep:             time.Sleep,
+		runningRequests:   make(map[string]runningRequest),
+		cancelledRequests: make(map[string]bool),
+		requestTimeout:    DefaultRequestTimeout,
+		watchdogs:         make(map[string]*time.Timer),
+		traces:            make(map[string]requestTrace),
 	}
 	ro.initializeCommandsAndSubscriptions()
+	ro.provideGenerators()
 	return ro
 }
 
 // DecideAgentCallCommand now dynamically fetches plugin prompts per call
 func (ro *RequestOrchestrator) DecideAgentCallCommand(event *UserRequestReceivedEvent) ([]eventsourcing.Event, error) {
-	// Get all LLM plugins at this moment
-	plugins := ro.pluginManager.GetLLMPlugins()
+	// A yes or no answers a tool call waiting for confirmation instead of starting a new request
+	if answer := ro.confirmationAnswer(event); answer != nil {
+		return answer, nil
+	}
+
+	// Get all LLM plugins of the user at this moment
+	userID := ro.agg.userOf(event.RequestID)
+	pluginManager := ro.pluginsOf(userID)
+	plugins := pluginManager.GetLLMPlugins()
 	pluginNames := make([]string, len(plugins))
 	for i, p := range plugins {
 		pluginNames[i] = p.Name()
 	}
 
-	// Reset and populate plugin prompts in ChatManager for this call
-	ro.agg.chatState.GetChatManager().ResetPluginPrompts() // Add this method to ChatManager
+	// Reset and populate the prompts in ChatManager for this call, in the versions the request is made with
+	chatManager := ro.agg.ChatManagerFor(userID)
+	chatManager.SetSystemPrompt(ro.systemPrompt(event.RequestID))
+	chatManager.ResetPluginPrompts() // Add this method to ChatManager
 	for _, plugin := range plugins {
-		ro.agg.chatState.GetChatManager().SetPluginPrompt(plugin.Name(), plugin.SystemPrompt())
+		chatManager.SetPluginPrompt(plugin.Name(), ro.prompt(event.RequestID, plugin.Name(), plugin.SystemPrompt()))
 	}
 
 	// Get LLM context with fresh plugin data
-	messages := ro.agg.chatState.GetChatManager().GetLLMContext(pluginNames)
-	resp, err := ro.llmClient.CallLLM(messages, ro.gatherAgentTools(), event.RequestID, "")
+	messages := chatManager.GetLLMContext(pluginNames)
+	resp, usageEvents, err := ro.route(messages, userID, event.RequestID, event.RequestText)
+	if events, cancelled := ro.cancelledEvents(event.RequestID, usageEvents...); cancelled {
+		return events, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("LLM call failed: %v", err)
 	}
 
-	var events []eventsourcing.Event
+	events := usageEvents
 	if len(resp.Message.ToolCalls) > 0 {
+		calls := make([]AgentCall, 0, len(resp.Message.ToolCalls))
+		undo := false
+		var creation *InitiatePluginCreationEvent
 		for _, call := range resp.Message.ToolCalls {
-			plug, err := ro.pluginManager.GetPlugin(call.Function.Name)
+			if call.Function.Name == undoToolName {
+				undo = true
+				continue
+			}
+			if isRouterTool(call.Function.Name) {
+				continue // Called once too often, the state was read as many times as allowed
+			}
+			if call.Function.Name == createPluginToolName {
+				name, _ := call.Function.Arguments["name"].(string)
+				description, _ := call.Function.Arguments["description"].(string)
+				creation = &InitiatePluginCreationEvent{
+					EventType:   "orchestration_InitiatePluginCreation",
+					RequestID:   event.RequestID,
+					PluginName:  name,
+					Description: description,
+					Goal:        event.RequestText,
+					Timestamp:   eventsourcing.ISOTimestamp(),
+				}
+				continue
+			}
+			plug, err := pluginManager.GetPlugin(call.Function.Name)
 			if err != nil {
 				return nil, fmt.Errorf("requested plugin does not exist: %w", err)
 			}
@@ -117,19 +165,55 @@ func (ro *RequestOrchestrator) DecideAgentCallCommand(event *UserRequestReceived
 			if err != nil {
 				return nil, fmt.Errorf("failed to marshal tool call arguments: %v", err)
 			}
-			query := string(queryBytes)
+			calls = append(calls, AgentCall{
+				AgentName: plug.Name(),
+				Model:     ro.agentModel(plug),
+				Query:     string(queryBytes),
+			})
+		}
+
+		// Undoing takes precedence, acting on top of it could leave the user with a half undone state
+		if undo {
+			if len(calls) > 0 {
+				logger.Info("Ignoring %d agent calls of request %s in favour of undo", len(calls), event.RequestID)
+			}
+			return append(events, &UndoRequestedEvent{
+				EventType: "orchestration_UndoRequested",
+				RequestID: event.RequestID,
+				Timestamp: eventsourcing.ISOTimestamp(),
+			}), nil
+		}
+
+		// Creating a plugin takes the whole request, the new plugin can be used by the next one
+		if creation != nil {
+			if len(calls) > 0 {
+				logger.Info("Ignoring %d agent calls of request %s in favour of creating a plugin", len(calls), event.RequestID)
+			}
+			return append(events, creation), nil
+		}
+
+		// Several agents are run concurrently and their results merged into one response
+		if len(calls) > 1 {
+			logger.Info("Fanning out request %s to %d agents", event.RequestID, len(calls))
+			return append(events, &AgentFanOutStartedEvent{
+				RequestID: event.RequestID,
+				Calls:     calls,
+				Timestamp: eventsourcing.ISOTimestamp(),
+			}), nil
+		}
+
+		if len(calls) == 1 {
 			agentCallEvent := &AgentCallDecidedEvent{
 				RequestID: event.RequestID,
-				AgentName: plug.Name(),
+				AgentName: calls[0].AgentName,
 				Timestamp: eventsourcing.ISOTimestamp(),
-				Model:     plug.AgentModel(),
-				Query:     query,
+				Model:     calls[0].Model,
+				Query:     calls[0].Query,
 			}
 			fmt.Println(agentCallEvent)
 			events = append(events, agentCallEvent)
+			return events, nil
 		}
-		fmt.Println("In DecideAgentCallCommand", len(events), "were generated")
-		return events, nil
 	}
 
 	events = append(events, &RequestCompletedEvent{
@@ -140,11 +224,19 @@ func (ro *RequestOrchestrator) DecideAgentCallCommand(event *UserRequestReceived
 	return events, nil
 }
 
-// gatherAgentTools remains unchanged but included for context
-func (ro *RequestOrchestrator) gatherAgentTools() []llmmodels.Tool {
-	var tools []llmmodels.Tool
-	for _, plugin := range ro.pluginManager.GetLLMPlugins() {
-		tools = append(tools, llmmodels.Tool{
+// gatherAgentTools returns a tool per agent of the user relevant to the request, plus the UndoLastAction tool
+// and, when plugins can be built, the CreatePlugin tool. Only the owner creates plugins, they are installed for
+// everyone.
+func (ro *RequestOrchestrator) gatherAgentTools(userID, request string) []llmmodels.Tool {
+	tools := []llmmodels.Tool{undoTool()}
+	if ro.pluginBuilder() != nil && userID == "" {
+		tools = append(tools, createPluginTool())
+	}
+	var agents []llmmodels.Tool
+	var texts []string
+	for _, plugin := range ro.pluginsOf(userID).GetLLMPlugins() {
+		texts = append(texts, agentText(plugin))
+		agents = append(agents, llmmodels.Tool{
 			Type: "function",
 			Function: map[string]interface{}{
 				"name":        plugin.Name(),
@@ -162,7 +254,11 @@ func (ro *RequestOrchestrator) gatherAgentTools() []llmmodels.Tool {
 			},
 		})
 	}
-	return tools
+	relevant := relevantTools(request, agents, texts, ro.toolLimit())
+	if len(relevant) < len(agents) {
+		logger.Debug("Offering %d of %d agents for %q", len(relevant), len(agents), request)
+	}
+	return append(tools, relevant...)
 }
 
 // commandHandler defines the structure for command registration
@@ -192,10 +288,54 @@ func (ro *RequestOrchestrator) initializeCommandsAndSubscriptions() {
 			name:    "ExecuteAgentCall",
 			handler: eventsourcing.NewCommand(ro.ExecuteAgentCall),
 		},
+		{
+			name:    "ExecuteAgentFanOut",
+			handler: eventsourcing.NewCommand(ro.ExecuteAgentFanOutCommand),
+		},
 		{
 			name:    "ExecuteToolCall",
 			handler: eventsourcing.NewCommand(ro.ExecuteToolCallCommand),
 		},
+		{
+			name:    "RetryToolCall",
+			handler: eventsourcing.NewCommand(ro.RetryToolCallCommand),
+		},
+		{
+			name:    "ConfirmToolCall",
+			handler: eventsourcing.NewCommand(ro.ConfirmToolCallCommand),
+		},
+		{
+			name:    "ExecuteConfirmedToolCall",
+			handler: eventsourcing.NewCommand(ro.ExecuteConfirmedToolCallCommand),
+		},
+		{
+			name:    "UndoLastAction",
+			handler: eventsourcing.NewCommand(ro.UndoLastActionCommand),
+		},
+		{
+			name:    focusOnToolName,
+			handler: eventsourcing.NewCommand(ro.FocusOnCommand),
+		},
+		{
+			name:    "InitiatePluginCreation",
+			handler: eventsourcing.NewCommand(ro.InitiatePluginCreationCommand),
+		},
+		{
+			name:    "StartSession",
+			handler: eventsourcing.NewCommand(ro.StartSessionCommand),
+		},
+		{
+			name:    "SwitchSession",
+			handler: eventsourcing.NewCommand(ro.SwitchSessionCommand),
+		},
+		{
+			name:    "SetSessionLanguage",
+			handler: eventsourcing.NewCommand(ro.SetSessionLanguageCommand),
+		},
+		{
+			name:    "ListSessions",
+			handler: eventsourcing.NewCommand(ro.ListSessionsCommand),
+		},
 		{
 			name:    "CompleteRequest",
 			handler: eventsourcing.NewCommand(ro.CompleteRequestCommand),
@@ -204,6 +344,22 @@ func (ro *RequestOrchestrator) initializeCommandsAndSubscriptions() {
 			name:    "CompleteRequestWithError",
 			handler: eventsourcing.NewCommand(ro.CompleteRequestWithErrorCommand),
 		},
+		{
+			name:    "CancelRequest",
+			handler: eventsourcing.NewCommand(ro.CancelRequestCommand),
+		},
+		{
+			name:    "TimeoutRequest",
+			handler: eventsourcing.NewCommand(ro.TimeoutRequestCommand),
+		},
+		{
+			name:    "SummarizeConversation",
+			handler: eventsourcing.NewCommand(ro.SummarizeConversationCommand),
+		},
+		{
+			name:    "RedactMessage",
+			handler: eventsourcing.NewCommand(ro.RedactMessageCommand),
+		},
 	}
 
 	// Define all event subscriptions
@@ -211,6 +367,9 @@ func (ro *RequestOrchestrator) initializeCommandsAndSubscriptions() {
 		{
 			eventType: "orchestration_UserRequestReceived",
 			handler: func(event eventsourcing.Event) error {
+				if e, ok := event.(*UserRequestReceivedEvent); ok {
+					ro.watchRequest(e.RequestID)
+				}
 				return ro.eventProcessor.ExecuteCommand("DecideAgentCall", event)
 			},
 		},
@@ -223,11 +382,63 @@ func (ro *RequestOrchestrator) initializeCommandsAndSubscriptions() {
 				return nil
 			},
 		},
+		{
+			eventType: "orchestration_AgentFanOutStarted",
+			handler: func(event eventsourcing.Event) error {
+				if e, ok := event.(*AgentFanOutStartedEvent); ok {
+					err := ro.eventProcessor.ExecuteCommand("ExecuteAgentFanOut", e)
+					if eventsourcing.IsConflict(err) {
+						// The agents' results are lost, let the user ask again
+						return ro.eventProcessor.ExecuteCommand("CompleteRequestWithError", &AgentExecutionFailedEvent{
+							EventType:   "orchestration_AgentExecutionFailed",
+							RequestID:   e.RequestID,
+							ErrorMsg:    err.Error(),
+							Timestamp:   eventsourcing.ISOTimestamp(),
+							Recoverable: true,
+						})
+					}
+					return err
+				}
+				return nil
+			},
+		},
+		{
+			eventType: "orchestration_UndoRequested",
+			handler: func(event eventsourcing.Event) error {
+				if e, ok := event.(*UndoRequestedEvent); ok {
+					return ro.eventProcessor.ExecuteCommand("UndoLastAction", e)
+				}
+				return nil
+			},
+		},
+		{
+			eventType: "orchestration_InitiatePluginCreation",
+			handler: func(event eventsourcing.Event) error {
+				if e, ok := event.(*InitiatePluginCreationEvent); ok {
+					return ro.eventProcessor.ExecuteCommand("InitiatePluginCreation", e)
+				}
+				return nil
+			},
+		},
+		// Fan-out requests execute and complete their tool calls within ExecuteAgentFanOut
 		{
 			eventType: "orchestration_ToolCallRequestPlaced",
 			handler: func(event eventsourcing.Event) error {
-				if e, ok := event.(*ToolCallRequestPlaced); ok {
-					return ro.eventProcessor.ExecuteCommand("ExecuteToolCall", e)
+				if e, ok := event.(*ToolCallRequestPlaced); ok && !ro.agg.isFanOut(e.RequestID) {
+					return ro.failOnConflict(e, ro.eventProcessor.ExecuteCommand("ExecuteToolCall", e))
+				}
+				return nil
+			},
+		},
+		{
+			eventType: "orchestration_ToolCallConfirmed",
+			handler: func(event eventsourcing.Event) error {
+				if e, ok := event.(*ToolCallConfirmedEvent); ok {
+					err := ro.eventProcessor.ExecuteCommand("ExecuteConfirmedToolCall", e)
+					if state, exists := ro.agg.ToolCallStates[e.ToolCallID]; exists {
+						return ro.failOnConflict(state.placed(), err)
+					}
+					return err
 				}
 				return nil
 			},
@@ -235,7 +446,7 @@ func (ro *RequestOrchestrator) initializeCommandsAndSubscriptions() {
 		{
 			eventType: "orchestration_ToolCallCompleted",
 			handler: func(event eventsourcing.Event) error {
-				if e, ok := event.(*ToolCallCompleted); ok {
+				if e, ok := event.(*ToolCallCompleted); ok && !ro.agg.isFanOut(e.RequestID) {
 					return ro.eventProcessor.ExecuteCommand("CompleteRequest", e)
 				}
 				return nil
@@ -244,7 +455,7 @@ func (ro *RequestOrchestrator) initializeCommandsAndSubscriptions() {
 		{
 			eventType: "orchestration_AgentExecutionFailed",
 			handler: func(event eventsourcing.Event) error {
-				if e, ok := event.(*AgentExecutionFailedEvent); ok {
+				if e, ok := event.(*AgentExecutionFailedEvent); ok && !ro.agg.isFanOut(e.RequestID) {
 					return ro.eventProcessor.ExecuteCommand("CompleteRequestWithError", e)
 				}
 				return nil
@@ -253,23 +464,47 @@ func (ro *RequestOrchestrator) initializeCommandsAndSubscriptions() {
 		{
 			eventType: "orchestration_ToolCallFailed",
 			handler: func(event eventsourcing.Event) error {
-				if e, ok := event.(*ToolCallFailedEvent); ok {
+				if e, ok := event.(*ToolCallFailedEvent); ok && !ro.agg.isFanOut(e.RequestID) {
+					if e.WillRetry {
+						return ro.eventProcessor.ExecuteCommand("RetryToolCall", e)
+					}
 					return ro.eventProcessor.ExecuteCommand("CompleteRequestWithError", e)
 				}
 				return nil
 			},
 		},
+		{
+			eventType: "orchestration_RequestCompleted",
+			handler: func(event eventsourcing.Event) error {
+				if e, ok := event.(*RequestCompletedEvent); ok {
+					ro.releaseRequest(e.RequestID)
+					ro.endTrace(e.RequestID)
+					ro.summarizeInBackground(ro.agg.userOf(e.RequestID))
+				}
+				return nil
+			},
+		},
+		{
+			eventType: "orchestration_RequestCancelled",
+			handler: func(event eventsourcing.Event) error {
+				if e, ok := event.(*RequestCancelledEvent); ok {
+					ro.releaseRequest(e.RequestID)
+					ro.endTrace(e.RequestID, attribute.Bool("request.cancelled", true))
+				}
+				return nil
+			},
+		},
 	}
 
 	// Register all commands
 	for _, cmd := range commands {
-		ro.eventProcessor.RegisterCommand(cmd.name, cmd.handler)
+		ro.eventProcessor.RegisterCommand(cmd.name, userCommand{ro: ro, name: cmd.name, handler: cmd.handler})
 	}
 
 	// Register all subscriptions
 	for _, sub := range subscriptions {
-		ro.eventBus.Subscribe(sub.eventType, sub.handler)
-		logging.Debug("Subscribed to event: %s", sub.eventType)
+		ro.eventBus.Subscribe(sub.eventType, ro.skipCancelled(sub.handler))
+		logger.Debug("Subscribed to event: %s", sub.eventType)
 	}
 }
 
@@ -278,25 +513,77 @@ func (ro *RequestOrchestrator) ProcessUserRequestCommand(data map[string]interfa
 	if !ok {
 		return nil, fmt.Errorf("requestText must be a string")
 	}
+	if ro.isShuttingDown() {
+		return nil, fmt.Errorf("MindPalace is shutting down")
+	}
 	requestID, _ := data["requestID"].(string)
 	if requestID == "" {
 		requestID = fmt.Sprintf("req-%d", time.Now().UnixNano())
 	}
 
-	logging.Info("Processing user request. Request ID: %s", requestID)
+	sessionID, _ := data["sessionID"].(string)
+	chatManager := ro.agg.ChatManagerFor(eventsourcing.UserOf(data))
+
+	// An edited request is a new request in the session of the request it revises, which stays as it was
+	revises, _ := data["revises"].(string)
+	if revises != "" {
+		original, exists := chatManager.UserRequest(revises)
+		if !exists {
+			return nil, fmt.Errorf("request %s to edit not found", revises)
+		}
+		if chain := chatManager.RevisionChain(revises); chain[len(chain)-1] != revises {
+			return nil, fmt.Errorf("request %s was edited already, edit its latest revision %s", revises, chain[len(chain)-1])
+		}
+		if sessionID == "" {
+			sessionID = original.SessionID
+		}
+	}
+	if sessionID == "" {
+		sessionID = chatManager.ActiveSession().ID
+	}
+
+	language, _ := data["language"].(string)
+	speaker, _ := data["speaker"].(string)
+
+	logger.Info("Processing user request. Request ID: %s, session: %s", requestID, sessionID)
+	ro.startTrace(requestID, attribute.String("session.id", sessionID), attribute.String("user.id", eventsourcing.UserOf(data)),
+		attribute.String("request.revises", revises))
 
 	return []eventsourcing.Event{
 		&UserRequestReceivedEvent{
 			EventType:   "orchestration_UserRequestReceived",
 			RequestID:   requestID,
 			RequestText: requestText,
+			SessionID:   sessionID,
+			Language:    language,
+			Speaker:     speaker,
+			Revises:     revises,
 			Timestamp:   eventsourcing.ISOTimestamp(),
 		},
 	}, nil
 }
 
+// ExecuteToolCallCommand executes a tool call of a request, traced as a span of the request
 func (ro *RequestOrchestrator) ExecuteToolCallCommand(event *ToolCallRequestPlaced) ([]eventsourcing.Event, error) {
+	span := ro.startSpan(event.RequestID, "tool "+event.Function, time.Now(),
+		attribute.String("tool_call.id", event.ToolCallID), attribute.Int("tool_call.attempt", toolCallAttempt(event)))
+	events, err := ro.executeToolCall(event)
+	endSpan(span, err, events...)
+	return events, err
+}
+
+func (ro *RequestOrchestrator) executeToolCall(event *ToolCallRequestPlaced) ([]eventsourcing.Event, error) {
 	var events []eventsourcing.Event
+	if ro.isCancelled(event.RequestID) {
+		logger.Info("Skipping tool call %s of cancelled request %s", event.ToolCallID, event.RequestID)
+		return nil, nil
+	}
+
+	// Destructive commands wait for the user's approval
+	if ro.awaitsConfirmation(event) {
+		logger.Info("Tool call %s (%s) waits for confirmation", event.ToolCallID, event.Function)
+		return []eventsourcing.Event{confirmationRequested(event)}, nil
+	}
 
 	// Record the start of the tool call
 	events = append(events, &ToolCallStarted{
@@ -306,11 +593,16 @@ func (ro *RequestOrchestrator) ExecuteToolCallCommand(event *ToolCallRequestPlac
 		Timestamp:  eventsourcing.ISOTimestamp(),
 	})
 
+	// Tools of external servers are called on the server
+	if server, tool, ok := ro.toolServerOf(event.Function); ok {
+		return append(events, ro.callServerTool(event, server, tool)...), nil
+	}
+
 	// Step 1: Identify the plugin responsible for the command
-	plugin, err := ro.pluginManager.GetPluginByCommand(event.Function)
+	plugin, err := ro.requestPlugins(event.RequestID).GetPluginByCommand(event.Function)
 	if err != nil {
 		errorMsg := fmt.Sprintf("no plugin found for command %s", event.Function)
-		logging.Error(errorMsg)
+		logger.Error(errorMsg)
 		events = append(events, &ToolCallFailedEvent{
 			EventType:  "orchestration_ToolCallFailed",
 			RequestID:  event.RequestID,
@@ -327,7 +619,7 @@ func (ro *RequestOrchestrator) ExecuteToolCallCommand(event *ToolCallRequestPlac
 	inputSchema, exists := schemas[event.Function]
 	if !exists {
 		errorMsg := fmt.Sprintf("no schema found for command %s", event.Function)
-		logging.Error(errorMsg)
+		logger.Error(errorMsg)
 		events = append(events, &ToolCallFailedEvent{
 			EventType:  "orchestration_ToolCallFailed",
 			RequestID:  event.RequestID,
@@ -346,7 +638,7 @@ func (ro *RequestOrchestrator) ExecuteToolCallCommand(event *ToolCallRequestPlac
 	inputJSON, err := json.Marshal(event.Arguments)
 	if err != nil {
 		errorMsg := fmt.Sprintf("failed to marshal arguments: %v", err)
-		logging.Error(errorMsg)
+		logger.Error(errorMsg)
 		events = append(events, &ToolCallFailedEvent{
 			EventType:  "orchestration_ToolCallFailed",
 			RequestID:  event.RequestID,
@@ -360,7 +652,7 @@ func (ro *RequestOrchestrator) ExecuteToolCallCommand(event *ToolCallRequestPlac
 
 	if err := json.Unmarshal(inputJSON, input); err != nil {
 		errorMsg := fmt.Sprintf("failed to unmarshal arguments into %T: %v", input, err)
-		logging.Error(errorMsg)
+		logger.Error(errorMsg)
 		events = append(events, &ToolCallFailedEvent{
 			EventType:  "orchestration_ToolCallFailed",
 			RequestID:  event.RequestID,
@@ -376,7 +668,7 @@ func (ro *RequestOrchestrator) ExecuteToolCallCommand(event *ToolCallRequestPlac
 	handler, exists := plugin.Commands()[event.Function]
 	if !exists {
 		errorMsg := fmt.Sprintf("no handler for command %s", event.Function)
-		logging.Error(errorMsg)
+		logger.Error(errorMsg)
 		events = append(events, &ToolCallFailedEvent{
 			EventType:  "orchestration_ToolCallFailed",
 			RequestID:  event.RequestID,
@@ -388,10 +680,20 @@ func (ro *RequestOrchestrator) ExecuteToolCallCommand(event *ToolCallRequestPlac
 		return events, nil
 	}
 
+	if reporter, ok := input.(eventsourcing.ProgressReporter); ok {
+		reporter.SetProgressFunc(ro.progressOf(event))
+	}
+
+	// Commands that keep panicking are quarantined, see eventsourcing.ErrorRecoveryManager.GuardCommand
+	handler = eventsourcing.GetGlobalRecoveryManager().GuardCommand(plugin.Name(), event.Function, handler)
 	toolEvents, err := handler.Execute(input)
 	if err != nil {
+		// Failures of the command itself may be transient, unlike the lookup and decoding errors above,
+		// if the error says so or timed out. Invalid arguments fail again, a quarantined command stays refused.
+		attempt := toolCallAttempt(event)
+		transient := eventsourcing.IsRetriable(err)
 		errorMsg := fmt.Sprintf("command %s failed: %v", event.Function, err)
-		logging.Error(errorMsg)
+		logger.Error(errorMsg)
 		events = append(events, &ToolCallFailedEvent{
 			EventType:  "orchestration_ToolCallFailed",
 			RequestID:  event.RequestID,
@@ -399,19 +701,31 @@ func (ro *RequestOrchestrator) ExecuteToolCallCommand(event *ToolCallRequestPlac
 			Function:   event.Function,
 			ErrorMsg:   errorMsg,
 			Timestamp:  eventsourcing.ISOTimestamp(),
+			Attempt:    attempt,
+			Transient:  transient,
+			WillRetry:  transient && ro.retryPolicy.ShouldRetry(attempt),
 		})
 		return events, nil
 	}
+	var eventTypes []string
 	for _, toolEvent := range toolEvents {
 		fmt.Println("tool call returned event:", toolEvent)
+		eventTypes = append(eventTypes, toolEvent.Type())
 	}
-	// Step 6: Append results and complete the tool call
+	// Step 6: Append results and complete the tool call, condensing results too large for the chat
 	events = append(events, toolEvents...)
+	results := map[string]interface{}{"success": true, "result": toolEvents}
+	summary, usageEvent := ro.condenseResults(event, results)
+	if usageEvent != nil {
+		events = append(events, usageEvent)
+	}
 	events = append(events, &ToolCallCompleted{
 		RequestID:  event.RequestID,
 		ToolCallID: event.ToolCallID,
 		Function:   event.Function,
-		Results:    map[string]interface{}{"success": true, "result": toolEvents},
+		Results:    results,
+		Summary:    summary,
+		Events:     eventTypes,
 		Timestamp:  eventsourcing.ISOTimestamp(),
 	})
 	fmt.Println("added tool call completed event")
@@ -419,10 +733,22 @@ func (ro *RequestOrchestrator) ExecuteToolCallCommand(event *ToolCallRequestPlac
 	return events, nil
 }
 
-// gatherPluginTools gathers tools specific to a given plugin
-func (ro *RequestOrchestrator) gatherPluginTools(plugin eventsourcing.Plugin) []llmmodels.Tool {
+// gatherPluginTools gathers the tools of a given plugin, and those of the tool servers attached for its agent,
+// relevant to the request
+func (ro *RequestOrchestrator) gatherPluginTools(plugin eventsourcing.Plugin, request string) []llmmodels.Tool {
 	var tools []llmmodels.Tool
-	for name, schema := range plugin.Schemas() {
+	names := make([]string, 0, len(plugin.Schemas()))
+	breaker := eventsourcing.GetGlobalRecoveryManager().Breaker()
+	for name := range plugin.Schemas() {
+		// Quarantined commands are not offered until re-enabled
+		if !breaker.IsOpen(eventsourcing.HandlerName(plugin.Name(), name)) {
+			names = append(names, name)
+		}
+	}
+	// Sorted, so the same tools are offered in the same order every call
+	sort.Strings(names)
+	for _, name := range names {
+		schema := plugin.Schemas()[name]
 		tools = append(tools, llmmodels.Tool{
 			Type: "function",
 			Function: map[string]interface{}{
@@ -432,12 +758,21 @@ func (ro *RequestOrchestrator) gatherPluginTools(plugin eventsourcing.Plugin) []
 			},
 		})
 	}
-	return tools
+	tools = append(tools, ro.serverTools(plugin.Name())...)
+	texts := make([]string, len(tools))
+	for i, tool := range tools {
+		texts[i] = toolText(tool)
+	}
+	relevant := relevantTools(request, tools, texts, ro.toolLimit())
+	if len(relevant) < len(tools) {
+		logger.Debug("Offering %d of %d tools of the %s agent for %q", len(relevant), len(tools), plugin.Name(), request)
+	}
+	return relevant
 }
 
 func (ro *RequestOrchestrator) ExecuteAgentCall(event *AgentCallDecidedEvent) ([]eventsourcing.Event, error) {
 	var events []eventsourcing.Event
-	plugin, err := ro.pluginManager.GetPlugin(event.AgentName)
+	plugin, err := ro.requestPlugins(event.RequestID).GetPlugin(event.AgentName)
 	if err != nil {
 		errorMsg := fmt.Sprintf("agent call failed: %v", err)
 		return []eventsourcing.Event{&AgentExecutionFailedEvent{
@@ -450,7 +785,10 @@ func (ro *RequestOrchestrator) ExecuteAgentCall(event *AgentCallDecidedEvent) ([
 		}}, nil
 	}
 
-	resp, err := ro.CallPluginAgent(plugin, event.Query, event.RequestID)
+	resp, usageEvent, err := ro.CallPluginAgent(plugin, event.Query, event.RequestID)
+	if events, cancelled := ro.cancelledEvents(event.RequestID, usageEvent); cancelled {
+		return events, nil
+	}
 	if err != nil {
 		errorMsg := fmt.Sprintf("plugin call failed: %v", err)
 		return []eventsourcing.Event{&AgentExecutionFailedEvent{
@@ -463,16 +801,17 @@ func (ro *RequestOrchestrator) ExecuteAgentCall(event *AgentCallDecidedEvent) ([
 		}}, nil
 	}
 
+	events = append(events, usageEvent)
 	for i, toolCall := range resp.Message.ToolCalls {
 		events = append(events, &ToolCallRequestPlaced{
 			RequestID:  event.RequestID,
 			Function:   toolCall.Function.Name,
 			Arguments:  toolCall.Function.Arguments,
 			Timestamp:  eventsourcing.ISOTimestamp(),
-			ToolCallID: fmt.Sprintf("toolrequest-%d", i),
+			ToolCallID: fmt.Sprintf("%s-toolrequest-%d", event.RequestID, i),
 		})
 	}
-	if len(events) == 0 {
+	if len(resp.Message.ToolCalls) == 0 {
 		events = append(events, &RequestCompletedEvent{
 			EventType:    "orchestration_RequestCompleted",
 			RequestID:    event.RequestID,
@@ -484,27 +823,52 @@ func (ro *RequestOrchestrator) ExecuteAgentCall(event *AgentCallDecidedEvent) ([
 	return events, nil
 }
 
-// CallPluginAgent calls a plugin-specific agent with appropriate context and prompt
-func (ro *RequestOrchestrator) CallPluginAgent(plugin eventsourcing.Plugin, requestText string, requestID string) (*llmmodels.OllamaResponse, error) {
+// agentHistoryTokens is the token budget for an agent's earlier calls in the session
+const agentHistoryTokens = 4000
+
+// CallPluginAgent calls a plugin-specific agent with appropriate context and prompt, returning the
+// response and the event recording the tokens used
+func (ro *RequestOrchestrator) CallPluginAgent(plugin eventsourcing.Plugin, requestText string, requestID string) (*llmmodels.OllamaResponse, eventsourcing.Event, error) {
 	// Get plugin state from its aggregate
 	agg := plugin.Aggregate()
 	stateJSON, err := json.Marshal(agg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal plugin state: %v", err)
+		return nil, nil, fmt.Errorf("failed to marshal plugin state: %v", err)
 	}
 
-	logging.Debug("current state in agent call %s", stateJSON)
-	// Build dynamic prompt with plugin state
-	prompt := fmt.Sprintf("%s\n\nCurrent State:\n%s", plugin.SystemPrompt(), string(stateJSON))
-
-	messages := []llmmodels.Message{
-		{Role: "system", Content: prompt},
-		{Role: "user", Content: requestText},
+	logger.Debug("current state in agent call %s", stateJSON)
+	// Build dynamic prompt with plugin state, and examples of the tools offered
+	tools := ro.gatherPluginTools(plugin, requestText)
+	userID := ro.agg.userOf(requestID)
+	prompt := fmt.Sprintf("%s%s\n\nCurrent State:\n%s", ro.prompt(requestID, plugin.Name(), plugin.SystemPrompt()), ro.pinnedPrompt(userID), string(stateJSON))
+	if examples := examplesPrompt(ro.examplesOf(userID, plugin), requestText, tools); examples != "" {
+		prompt += "\n\n" + examples
 	}
 
+	// Earlier calls of the agent in the session let it follow up on what it did before
+	messages := []llmmodels.Message{{Role: "system", Content: prompt}}
+	messages = append(messages, ro.requestChat(requestID).AgentHistory(plugin.Name(), requestID, agentHistoryTokens)...)
+	messages = append(messages, llmmodels.Message{Role: "user", Content: requestText})
+
 	// Use plugin-specific model and tools
-	tools := ro.gatherPluginTools(plugin)
-	return ro.llmClient.CallLLM(messages, tools, requestID, plugin.AgentModel())
+	return ro.callLLM(messages, tools, requestID, ro.agentModel(plugin), plugin.Name())
+}
+
+// SetAgentModels overrides the models the agents of the named plugins run on
+func (ro *RequestOrchestrator) SetAgentModels(models map[string]string) {
+	ro.modelsMu.Lock()
+	defer ro.modelsMu.Unlock()
+	ro.agentModels = models
+}
+
+// agentModel returns the model a plugin's agent runs on
+func (ro *RequestOrchestrator) agentModel(plugin eventsourcing.Plugin) string {
+	ro.modelsMu.RLock()
+	defer ro.modelsMu.RUnlock()
+	if model, ok := ro.agentModels[plugin.Name()]; ok {
+		return model
+	}
+	return plugin.AgentModel()
 }
 
 // CompleteRequestCommand checks if all tool calls are done and finalizes the request
@@ -512,19 +876,24 @@ func (ro *RequestOrchestrator) CompleteRequestCommand(event *ToolCallCompleted)
 	requestID := event.RequestID
 	// Check if all tool calls for this RequestID are complete
 	if pending, exists := ro.agg.PendingToolCalls[requestID]; exists && len(pending) > 0 {
-		logging.Debug("pending toolcalls: %d", len(pending))
+		logger.Debug("pending toolcalls: %d", len(pending))
 		// Not all tool calls are done yet; no events to emit
 		return nil, nil
 	}
 
-	model := "gpt-oss:20b"
+	model := "" // The LLM client's default model
 	if agentState, exists := ro.agg.AgentStates[requestID]; exists {
 		model = agentState.Model
 	}
 	// Use tag-based context selection for better relevance
 	relevantTags := []string{"task", "completion", "response"} // Basic tags for completion context
-	messages := ro.agg.chatState.GetChatManager().GetLLMContextWithTags(nil, relevantTags)
-	resp, err := ro.llmClient.CallLLM(messages, nil, requestID, model)
+	chatManager := ro.requestChat(requestID)
+	chatManager.SetSystemPrompt(ro.systemPrompt(requestID))
+	messages := chatManager.GetLLMContextWithTags(nil, relevantTags)
+	resp, usageEvent, err := ro.callLLM(messages, nil, requestID, model, "completion")
+	if events, cancelled := ro.cancelledEvents(requestID, usageEvent); cancelled {
+		return events, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error calling llm client: %w", err)
 	}
@@ -537,8 +906,8 @@ func (ro *RequestOrchestrator) CompleteRequestCommand(event *ToolCallCompleted)
 		CompletedAt:  eventsourcing.ISOTimestamp(),
 	}
 	marsh, _ := completedEvent.Marshal()
-	logging.Debug("calling marshall in complete request %s", marsh)
-	return []eventsourcing.Event{completedEvent}, nil
+	logger.Debug("calling marshall in complete request %s", marsh)
+	return []eventsourcing.Event{usageEvent, completedEvent}, nil
 }
 
 // CompleteRequestWithErrorCommand handles completing a request that had an error
@@ -558,6 +927,11 @@ func (ro *RequestOrchestrator) CompleteRequestWithErrorCommand(event eventsourci
 		return nil, fmt.Errorf("unsupported error event type: %T", event)
 	}
 
+	// The cancellation already told the user the request ended
+	if ro.isCancelled(requestID) {
+		return nil, nil
+	}
+
 	// Check if we need to finalize the request
 	if pending, exists := ro.agg.PendingToolCalls[requestID]; exists && len(pending) > 0 {
 		// Not all tool calls are done yet; no events to emit
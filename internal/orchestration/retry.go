@@ -0,0 +1,129 @@
+package orchestration
+
+import (
+	"fmt"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// RetryPolicy configures how failed tool calls are retried
+type RetryPolicy struct {
+	MaxRetries int           // Retries after the first attempt; 0 disables retries
+	BaseDelay  time.Duration // Delay before the first retry, doubled for every further retry
+	MaxDelay   time.Duration // Upper bound for the delay between attempts
+}
+
+// DefaultRetryPolicy retries a tool call up to three times, waiting 1s, 2s and 4s
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  time.Second,
+	MaxDelay:   30 * time.Second,
+}
+
+// ShouldRetry reports whether a tool call that failed on the given attempt is tried again
+func (p RetryPolicy) ShouldRetry(attempt int) bool {
+	return attempt <= p.MaxRetries
+}
+
+// Backoff returns the delay before retrying a tool call that failed on the given attempt
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+// SetRetryPolicy sets the policy used to retry tool calls that failed transiently
+func (ro *RequestOrchestrator) SetRetryPolicy(policy RetryPolicy) {
+	ro.retryPolicy = policy
+}
+
+// RetryToolCallCommand waits for the backoff of a failed tool call and places it again
+func (ro *RequestOrchestrator) RetryToolCallCommand(event *ToolCallFailedEvent) ([]eventsourcing.Event, error) {
+	state, exists := ro.agg.ToolCallStates[event.ToolCallID]
+	if !exists {
+		return nil, fmt.Errorf("no state for tool call %s", event.ToolCallID)
+	}
+
+	delay := ro.retryPolicy.Backoff(event.Attempt)
+	logger.Info("Retrying tool call %s (%s) in %s, attempt %d", event.ToolCallID, event.Function, delay, event.Attempt+1)
+	ro.sleep(delay)
+	if ro.isCancelled(event.RequestID) {
+		return nil, nil
+	}
+
+	return []eventsourcing.Event{&ToolCallRequestPlaced{
+		RequestID:  event.RequestID,
+		ToolCallID: event.ToolCallID,
+		Function:   state.Function,
+		Arguments:  state.Arguments,
+		Timestamp:  eventsourcing.ISOTimestamp(),
+		AgentName:  state.AgentName,
+		Attempt:    event.Attempt + 1,
+	}}, nil
+}
+
+// executeToolCallWithRetry executes a tool call and retries it in place until it succeeds,
+// fails permanently or runs out of retries. It is used where events are only published
+// after execution, such as agent fan-outs.
+func (ro *RequestOrchestrator) executeToolCallWithRetry(placed *ToolCallRequestPlaced) ([]eventsourcing.Event, error) {
+	var events []eventsourcing.Event
+	for {
+		toolEvents, err := ro.ExecuteToolCallCommand(placed)
+		if err != nil {
+			return nil, err
+		}
+		if len(toolEvents) == 0 { // The request was cancelled
+			return events, nil
+		}
+		events = append(events, toolEvents...)
+		failed, ok := toolEvents[len(toolEvents)-1].(*ToolCallFailedEvent)
+		if !ok || !failed.WillRetry {
+			return events, nil
+		}
+		ro.sleep(ro.retryPolicy.Backoff(failed.Attempt))
+		retry := *placed
+		retry.Attempt = failed.Attempt + 1
+		retry.Timestamp = eventsourcing.ISOTimestamp()
+		events = append(events, &retry)
+		placed = &retry
+	}
+}
+
+// toolCallAttempt returns the attempt number of a tool call request, starting at 1
+func toolCallAttempt(event *ToolCallRequestPlaced) int {
+	if event.Attempt < 1 {
+		return 1
+	}
+	return event.Attempt
+}
+
+// failOnConflict publishes a transient failure of the tool call when executing it conflicted with a
+// concurrent change, so it is retried on the changed state. Other errors are returned as is.
+func (ro *RequestOrchestrator) failOnConflict(placed *ToolCallRequestPlaced, err error) error {
+	if !eventsourcing.IsConflict(err) {
+		return err
+	}
+	attempt := toolCallAttempt(placed)
+	logger.Info("Tool call %s (%s) conflicted with a concurrent change: %v", placed.ToolCallID, placed.Function, err)
+	ro.publish(&ToolCallFailedEvent{
+		EventType:  "orchestration_ToolCallFailed",
+		RequestID:  placed.RequestID,
+		ToolCallID: placed.ToolCallID,
+		Function:   placed.Function,
+		ErrorMsg:   err.Error(),
+		Timestamp:  eventsourcing.ISOTimestamp(),
+		Attempt:    attempt,
+		Transient:  true,
+		WillRetry:  ro.retryPolicy.ShouldRetry(attempt),
+	})
+	return nil
+}
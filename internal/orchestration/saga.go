@@ -1,90 +1,276 @@
 package orchestration
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"mindpalace/internal/llmprocessor"
+	"mindpalace/internal/plugingenerator"
 	"mindpalace/pkg/eventsourcing"
-	"mindpalace/pkg/logging"
+	"mindpalace/pkg/llmmodels"
 )
 
-func InitiatePluginCreationCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
-	logging.Trace("called InitiatePluginCreationCommand %+v, %+v", data)
-	return nil, nil
-}
+// createPluginToolName is the tool the LLM calls when the user asks MindPalace to create a plugin
+const createPluginToolName = "CreatePlugin"
+
+// designAttempts is how often the LLM may design the plugin again after its design was rejected
+const designAttempts = 2
 
-/*func NewPluginCreationSaga(o *RequestOrchestrator, requestID, pluginName string) *PluginCreationSaga {
-	return &PluginCreationSaga{orchestrator: o, requestID: requestID, pluginName: pluginName, stage: "clarify"}
+// PluginBuilder creates plugins while MindPalace runs. The plugin manager implements it; plugins are
+// only offered to be created when it does.
+type PluginBuilder interface {
+	// GeneratePlugin writes the code and tests of a plugin and returns its directory
+	GeneratePlugin(req *plugingenerator.PluginRequirements) (string, error)
+	// BuildPlugin compiles the plugin in the directory
+	BuildPlugin(dir string) error
+	// TestPlugin runs the tests of the plugin in the directory
+	TestPlugin(dir string) error
+	// InstallPlugin loads the compiled plugin and registers its commands
+	InstallPlugin(dir string) (eventsourcing.Plugin, error)
+	// DiscardPlugin removes a plugin that was generated but not installed
+	DiscardPlugin(dir string) error
 }
 
-type PluginCreationSaga struct {
-	orchestrator *RequestOrchestrator
-	requestID    string
-	pluginName   string
-	stage        string
+const pluginDesignPrompt = `You design plugins for MindPalace, a personal assistant. A plugin tracks one kind of entity and has commands to create, update, delete and list them. The user asked:
+
+%s
+
+Answer with a JSON object only, no explanation, like:
+
+{
+  "name": "drinks",
+  "description": "Tracks the drinks the user has, to keep an eye on how much they drink.",
+  "entities": [{"name": "Drink", "fields": [
+    {"name": "Name", "type": "string", "description": "What was drunk, like coffee"},
+    {"name": "Volume", "type": "int", "description": "Volume in ml"},
+    {"name": "Date", "type": "string", "description": "Day it was drunk, YYYY-MM-DD"}
+  ]}],
+  "commands": [
+    {"name": "LogDrink", "action": "create", "description": "Log a drink"},
+    {"name": "UpdateDrink", "action": "update", "description": "Correct a logged drink"},
+    {"name": "DeleteDrink", "action": "delete", "description": "Delete a logged drink"},
+    {"name": "ListDrinks", "action": "list", "description": "List the logged drinks"}
+  ]
 }
 
-func (s *PluginCreationSaga) emitProgress(message string) {
-	s.orchestrator.eventBus.Publish(&eventsourcing.GenericEvent{
-		EventType: "PluginCreationProgress",
-		Data:      map[string]interface{}{"RequestID": s.requestID, "Message": message},
-	})
+Rules:
+- name is 3 to 30 lowercase letters or digits%s
+- exactly one entity, with a capitalized Go name and capitalized field names; an ID field is added for you
+- field types are string, int, float64 or bool; dates and times are strings
+- command names are capitalized Go names, unique across MindPalace; actions are create, update, delete or list
+- there is at least one create command; create and update commands take all fields unless they list "input" fields by name`
+
+// createPluginTool describes CreatePlugin to the LLM next to the agents
+func createPluginTool() llmmodels.Tool {
+	return llmmodels.Tool{
+		Type: "function",
+		Function: map[string]interface{}{
+			"name":        createPluginToolName,
+			"description": "Create a new agent for something none of the agents can do, only when the user asks for it, e.g. \"make a plugin to track my drinks\"",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{
+						"type":        "string",
+						"description": "Short lowercase name of the plugin, like drinks",
+					},
+					"description": map[string]interface{}{
+						"type":        "string",
+						"description": "What the plugin should track and do",
+					},
+				},
+				"required": []string{"description"},
+			},
+		},
+	}
 }
 
-func (s *PluginCreationSaga) generateCode(data map[string]interface{}) (string, error) {
-	// Simplified: Ask Ollama to generate code based on a template
-	template := `package main
-import "mindpalace/pkg/eventsourcing"
-type %sPlugin struct{}
-func (p *%sPlugin) Name() string { return "%s" }
-func (p *%sPlugin) Type() eventsourcing.PluginType { return eventsourcing.LLMPlugin }
-func (p *%sPlugin) EventHandlers() map[string]eventsourcing.EventHandler { return nil }
-func (p *%sPlugin) Commands() map[string]eventsourcing.CommandHandler {
-    return map[string]eventsourcing.CommandHandler{
-        "Create%s": func(data map[string]interface{}, state map[string]interface{}) ([]eventsourcing.Event, error) {
-            return []eventsourcing.Event{&eventsourcing.GenericEvent{
-                EventType: "%sCreated",
-                Data:      data,
-            }}, nil
-        },
-    }
+// pluginBuilder returns the plugin manager as a PluginBuilder, nil if it cannot create plugins
+func (ro *RequestOrchestrator) pluginBuilder() PluginBuilder {
+	builder, _ := ro.pluginManager.(PluginBuilder)
+	return builder
 }
-func (p *%sPlugin) Schemas() map[string]map[string]interface{} {
-    return map[string]map[string]interface{}{
-        "Create%s": {
-            "description": "%s",
-            "parameters": map[string]interface{}{
-                "type": "object",
-                "properties": map[string]interface{}{
-                    "Value": {"type": "string", "description": "%s"},
-                },
-                "required": []string{"Value"},
-            },
-        },
-    }
+
+// pluginCreationSaga tracks a plugin being created for a request
+type pluginCreationSaga struct {
+	ro        *RequestOrchestrator
+	builder   PluginBuilder
+	requestID string
+	name      string
+	dir       string                // Directory the plugin was generated into, empty before
+	events    []eventsourcing.Event // Token usage of the design calls
 }
-func NewPlugin() eventsourcing.Plugin { return &%sPlugin{} }`
-	name := s.pluginName
-	desc := data["Description"].(string)
-	result := data["Result"].(string)
-	return fmt.Sprintf(template, name, name, name, name, name, name, name, name, name, name, desc, result, name), nil
+
+// InitiatePluginCreationCommand creates the plugin the user asked for in stages: the LLM designs its
+// commands and events, the code and its tests are generated into plugins/<name>, compiled, tested and
+// loaded sandboxed in WASM. Each stage is reported in the chat; a failing stage discards the generated code.
+func (ro *RequestOrchestrator) InitiatePluginCreationCommand(event *InitiatePluginCreationEvent) ([]eventsourcing.Event, error) {
+	builder := ro.pluginBuilder()
+	if builder == nil {
+		return []eventsourcing.Event{ro.pluginCreationCompleted(event.RequestID, "I can't create plugins in this setup.")}, nil
+	}
+	s := &pluginCreationSaga{ro: ro, builder: builder, requestID: event.RequestID, name: event.PluginName}
+
+	s.progress("design", "designing the commands and events")
+	req, err := s.design(event)
+	if events, cancelled := s.cancelled(); cancelled {
+		return events, nil
+	}
+	if err != nil {
+		return s.fail("design", err), nil
+	}
+	s.name = req.Name
+
+	s.progress("generate", fmt.Sprintf("generating %d commands for %s", len(req.Commands), req.Entity().Name))
+	if s.dir, err = builder.GeneratePlugin(req); err != nil {
+		return s.fail("generate", err), nil
+	}
+	stages := []struct {
+		stage, message string
+		run            func(dir string) error
+	}{
+		{"compile", "compiling", builder.BuildPlugin},
+		{"test", "running its tests", builder.TestPlugin},
+	}
+	for _, stage := range stages {
+		if events, cancelled := s.cancelled(); cancelled {
+			return events, nil
+		}
+		s.progress(stage.stage, stage.message)
+		if err := stage.run(s.dir); err != nil {
+			return s.fail(stage.stage, err), nil
+		}
+	}
+
+	if events, cancelled := s.cancelled(); cancelled {
+		return events, nil
+	}
+	s.progress("load", "loading")
+	plugin, err := builder.InstallPlugin(s.dir)
+	if err != nil {
+		return s.fail("load", err), nil
+	}
+	commands := make([]string, 0, len(plugin.Commands()))
+	for name := range plugin.Commands() {
+		commands = append(commands, name)
+	}
+	sort.Strings(commands)
+
+	logger.Info("Created plugin %s for request %s", plugin.Name(), event.RequestID)
+	return append(s.events,
+		&PluginCreatedEvent{
+			EventType:  "orchestration_PluginCreated",
+			RequestID:  event.RequestID,
+			PluginName: plugin.Name(),
+			Commands:   commands,
+			Timestamp:  eventsourcing.ISOTimestamp(),
+		},
+		ro.pluginCreationCompleted(event.RequestID, fmt.Sprintf("I created the %s plugin. %s\nIt can: %s. It runs sandboxed, so it has no tab in the app; its cards are in the 3D world.",
+			plugin.Name(), req.Description, strings.Join(commands, ", "))),
+	), nil
 }
 
-func (s *PluginCreationSaga) buildPlugin(code string) (string, error) {
-	dir := filepath.Join("plugins", s.pluginName)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", err
+// design asks the LLM for the requirements of the plugin, feeding rejected designs back to it
+func (s *pluginCreationSaga) design(event *InitiatePluginCreationEvent) (*plugingenerator.PluginRequirements, error) {
+	goal := event.Goal
+	if event.Description != "" && event.Description != goal {
+		goal = fmt.Sprintf("%s\n\nThe plugin should: %s", goal, event.Description)
 	}
-	goFile := filepath.Join(dir, "plugin.go")
-	if err := os.WriteFile(goFile, []byte(code), 0644); err != nil {
-		return "", err
+	nameRule := ""
+	if event.PluginName != "" {
+		nameRule = fmt.Sprintf(", preferably %q", strings.ToLower(event.PluginName))
 	}
-	soFile := filepath.Join(dir, s.pluginName+".so")
-	cmd := exec.Command("go", "build", "-buildmode=plugin", "-o", soFile, goFile)
-	if err := cmd.Run(); err != nil {
-		return "", err
+	messages := []llmmodels.Message{{Role: "user", Content: fmt.Sprintf(pluginDesignPrompt, goal, nameRule)}}
+
+	recorder := &usageRecorder{ro: s.ro, purpose: "plugin_design"}
+	req, err := llmprocessor.CallLLMStructured(s.ro.requestContext(s.requestID), recorder, messages, s.requestID, "", designAttempts, s.checkDesign)
+	s.events = append(s.events, recorder.events...)
+	if err != nil {
+		return nil, err
 	}
-	return soFile, nil
+	return &req, nil
 }
 
-func (s *PluginCreationSaga) testPlugin() error {
-	// Placeholder: Add unit test execution logic later
+// checkDesign normalizes the requirements the LLM designed and checks they fit next to the loaded plugins
+func (s *pluginCreationSaga) checkDesign(req *plugingenerator.PluginRequirements) error {
+	if err := req.Normalize(); err != nil {
+		return err
+	}
+	if plugin, err := s.ro.pluginManager.GetPlugin(req.Name); err == nil && plugin != nil {
+		return fmt.Errorf("a plugin named %s already exists", req.Name)
+	}
+	for _, command := range req.Commands {
+		if plugin, err := s.ro.pluginManager.GetPluginByCommand(command.Name); err == nil && plugin != nil {
+			return fmt.Errorf("command %s already belongs to the %s plugin", command.Name, plugin.Name())
+		}
+	}
 	return nil
-}*/
+}
+
+// progress reports the stage the creation reached and gives the request more time, since compiling
+// and testing take a while
+func (s *pluginCreationSaga) progress(stage, message string) {
+	s.ro.watchRequest(s.requestID)
+	s.ro.publish(&PluginCreationProgressEvent{
+		EventType:  "orchestration_PluginCreationProgress",
+		RequestID:  s.requestID,
+		PluginName: s.displayName(),
+		Stage:      stage,
+		Message:    message,
+		Timestamp:  eventsourcing.ISOTimestamp(),
+	})
+}
+
+// cancelled discards the generated plugin when the request was cancelled, keeping the token usage
+func (s *pluginCreationSaga) cancelled() ([]eventsourcing.Event, bool) {
+	events, cancelled := s.ro.cancelledEvents(s.requestID, s.events...)
+	if cancelled {
+		s.discard()
+	}
+	return events, cancelled
+}
+
+// fail discards the generated plugin and tells the user which stage failed
+func (s *pluginCreationSaga) fail(stage string, err error) []eventsourcing.Event {
+	logger.Error("Failed to %s plugin %s for request %s: %v", stage, s.displayName(), s.requestID, err)
+	s.discard()
+	return append(s.events,
+		&PluginCreationFailedEvent{
+			EventType:  "orchestration_PluginCreationFailed",
+			RequestID:  s.requestID,
+			PluginName: s.displayName(),
+			Stage:      stage,
+			ErrorMsg:   err.Error(),
+			Timestamp:  eventsourcing.ISOTimestamp(),
+		},
+		s.ro.pluginCreationCompleted(s.requestID, fmt.Sprintf("I couldn't create the plugin, it failed to %s: %v", stage, err)),
+	)
+}
+
+func (s *pluginCreationSaga) discard() {
+	if s.dir == "" {
+		return
+	}
+	if err := s.builder.DiscardPlugin(s.dir); err != nil {
+		logger.Error("Failed to discard plugin %s: %v", s.dir, err)
+	}
+	s.dir = ""
+}
+
+// displayName names the plugin in progress messages, before it has a name too
+func (s *pluginCreationSaga) displayName() string {
+	if s.name == "" {
+		return "new plugin"
+	}
+	return s.name
+}
+
+func (ro *RequestOrchestrator) pluginCreationCompleted(requestID, responseText string) eventsourcing.Event {
+	return &RequestCompletedEvent{
+		EventType:    "orchestration_RequestCompleted",
+		RequestID:    requestID,
+		ResponseText: responseText,
+		CompletedAt:  eventsourcing.ISOTimestamp(),
+	}
+}
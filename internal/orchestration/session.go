@@ -0,0 +1,99 @@
+package orchestration
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// StartSessionCommand starts a new conversation thread, optionally titled, and switches to it
+func (ro *RequestOrchestrator) StartSessionCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	title, _ := data["title"].(string)
+	sessionID := fmt.Sprintf("session-%d", time.Now().UnixNano())
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = fmt.Sprintf("Session %d", len(ro.agg.ChatManagerFor(eventsourcing.UserOf(data)).ListSessions())+1)
+	}
+
+	logger.Info("Starting chat session %s (%s)", sessionID, title)
+	return []eventsourcing.Event{&SessionStartedEvent{
+		EventType: "orchestration_SessionStarted",
+		SessionID: sessionID,
+		Title:     title,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// SwitchSessionCommand makes an existing conversation thread the active session
+func (ro *RequestOrchestrator) SwitchSessionCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	sessionID, _ := data["sessionID"].(string)
+	if sessionID == "" {
+		return nil, fmt.Errorf("sessionID must be a non-empty string")
+	}
+	found := false
+	for _, session := range ro.agg.ChatManagerFor(eventsourcing.UserOf(data)).ListSessions() {
+		if session.ID == sessionID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("session %s not found", sessionID)
+	}
+
+	return []eventsourcing.Event{&SessionSwitchedEvent{
+		EventType: "orchestration_SessionSwitched",
+		SessionID: sessionID,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// SetSessionLanguageCommand sets the language responses in a session are given in, from the
+// "language" field; empty or "auto" answers in the language the user spoke. The session defaults
+// to the active one.
+func (ro *RequestOrchestrator) SetSessionLanguageCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	language, ok := data["language"].(string)
+	if !ok {
+		return nil, fmt.Errorf("language must be a string")
+	}
+	language = strings.TrimSpace(language)
+	if strings.EqualFold(language, "auto") {
+		language = ""
+	}
+	chatManager := ro.agg.ChatManagerFor(eventsourcing.UserOf(data))
+	sessionID, _ := data["sessionID"].(string)
+	if sessionID == "" {
+		sessionID = chatManager.ActiveSession().ID
+	}
+	found := false
+	for _, session := range chatManager.ListSessions() {
+		if session.ID == sessionID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("session %s not found", sessionID)
+	}
+
+	logger.Info("Responding in %q in session %s", language, sessionID)
+	return []eventsourcing.Event{&SessionLanguageSetEvent{
+		EventType: "orchestration_SessionLanguageSet",
+		SessionID: sessionID,
+		Language:  language,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// ListSessionsCommand lists the conversation threads and the active one
+func (ro *RequestOrchestrator) ListSessionsCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	chatManager := ro.agg.ChatManagerFor(eventsourcing.UserOf(data))
+	return []eventsourcing.Event{&SessionsListedEvent{
+		EventType:       "orchestration_SessionsListed",
+		Sessions:        chatManager.ListSessions(),
+		ActiveSessionID: chatManager.ActiveSession().ID,
+		Timestamp:       eventsourcing.ISOTimestamp(),
+	}}, nil
+}
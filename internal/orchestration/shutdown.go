@@ -0,0 +1,78 @@
+package orchestration
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// shutdownPollInterval is how often Shutdown checks whether the requests in progress completed
+const shutdownPollInterval = 100 * time.Millisecond
+
+// Shutdown stops taking requests and waits for those in progress to complete. Requests waiting for
+// the user to confirm a tool call, and those still in progress when ctx is done, are cancelled so
+// their events record how they ended.
+func (ro *RequestOrchestrator) Shutdown(ctx context.Context) error {
+	ro.requestsMu.Lock()
+	ro.shuttingDown = true
+	ro.requestsMu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		var waiting []string
+		for _, requestID := range ro.requestsInProgress() {
+			if ro.agg.awaitsUser(requestID) {
+				ro.cancelOnShutdown(requestID)
+			} else {
+				waiting = append(waiting, requestID)
+			}
+		}
+		if len(waiting) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			for _, requestID := range waiting {
+				ro.cancelOnShutdown(requestID)
+			}
+			return fmt.Errorf("cancelled %d requests still in progress", len(waiting))
+		case <-ticker.C:
+			logger.Debug("Waiting for %d requests to complete before shutting down", len(waiting))
+		}
+	}
+}
+
+// isShuttingDown reports whether Shutdown was called, after which requests are refused
+func (ro *RequestOrchestrator) isShuttingDown() bool {
+	ro.requestsMu.Lock()
+	defer ro.requestsMu.Unlock()
+	return ro.shuttingDown
+}
+
+// requestsInProgress returns the requests received since starting that did not end yet
+func (ro *RequestOrchestrator) requestsInProgress() []string {
+	ro.requestsMu.Lock()
+	requestIDs := make([]string, 0, len(ro.runningRequests))
+	for requestID := range ro.runningRequests {
+		requestIDs = append(requestIDs, requestID)
+	}
+	ro.requestsMu.Unlock()
+
+	inProgress := requestIDs[:0]
+	for _, requestID := range requestIDs {
+		if ro.agg.isRequestInProgress(requestID) && !ro.isCancelled(requestID) {
+			inProgress = append(inProgress, requestID)
+		}
+	}
+	sort.Strings(inProgress)
+	return inProgress
+}
+
+func (ro *RequestOrchestrator) cancelOnShutdown(requestID string) {
+	logger.Info("Cancelling request %s to shut down", requestID)
+	if err := ro.eventProcessor.ExecuteCommand("CancelRequest", map[string]interface{}{"requestID": requestID}); err != nil {
+		logger.Error("Failed to cancel request %s: %v", requestID, err)
+	}
+}
@@ -0,0 +1,34 @@
+package orchestration
+
+import (
+	"context"
+	"encoding/json"
+
+	"mindpalace/internal/llmprocessor"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/llmmodels"
+)
+
+// usageRecorder calls the LLM for structured answers, keeping an event with the tokens of each call.
+// Clients without constrained decoding are called without the format; the prompt has to ask for JSON then.
+type usageRecorder struct {
+	ro      *RequestOrchestrator
+	purpose string
+	events  []eventsourcing.Event
+}
+
+// CallLLMWithFormat calls the LLM and records the tokens the call used
+func (u *usageRecorder) CallLLMWithFormat(ctx context.Context, messages []llmmodels.Message, format json.RawMessage, requestID, model string) (*llmmodels.OllamaResponse, error) {
+	var resp *llmmodels.OllamaResponse
+	var err error
+	if client, ok := u.ro.llmClient.(llmprocessor.FormatCaller); ok {
+		resp, err = client.CallLLMWithFormat(ctx, messages, format, requestID, model)
+	} else {
+		resp, err = u.ro.llmClient.CallLLM(ctx, messages, nil, requestID, model)
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.events = append(u.events, u.ro.usageEvent(messages, resp, requestID, model, u.purpose))
+	return resp, nil
+}
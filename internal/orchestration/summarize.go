@@ -0,0 +1,90 @@
+package orchestration
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"mindpalace/internal/chat"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/llmmodels"
+)
+
+const summaryPromptTemplate = `You keep a running summary of a long conversation between a user and MindPalace, their personal assistant.
+%s
+Roll the messages below into the summary. Keep the facts that may matter later: names, dates, decisions, preferences, open questions and what was created or changed. Leave out small talk. Answer with the summary only, in short paragraphs or bullet points.
+
+%s`
+
+// SummarizeConversationCommand rolls the oldest messages of the user's active session into its summary
+// once its history no longer fits in the LLM context, so long sessions keep their salient facts. Only
+// one summary is made at a time; the command emits nothing when there is nothing to summarize.
+func (ro *RequestOrchestrator) SummarizeConversationCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if !ro.summarizing.TryLock() {
+		return nil, nil
+	}
+	defer ro.summarizing.Unlock()
+
+	input, ok := ro.agg.ChatManagerFor(eventsourcing.UserOf(data)).PendingSummary()
+	if !ok {
+		return nil, nil
+	}
+	previous := ""
+	if input.Previous != "" {
+		previous = "\nThe summary so far:\n" + input.Previous + "\n"
+	}
+	messages := []llmmodels.Message{{
+		Role:    "user",
+		Content: fmt.Sprintf(summaryPromptTemplate, previous, transcript(input.Messages)),
+	}}
+
+	requestID := fmt.Sprintf("summary_%d", time.Now().UnixNano())
+	defer ro.releaseRequest(requestID)
+	resp, usageEvent, err := ro.callLLM(messages, nil, requestID, "", "summary")
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize session %s: %w", input.SessionID, err)
+	}
+	_, summary := parseResponseText(resp.Message.Content)
+	if summary = strings.TrimSpace(summary); summary == "" {
+		return []eventsourcing.Event{usageEvent}, nil
+	}
+
+	last := input.Messages[len(input.Messages)-1]
+	logger.Info("Summarized %d messages of session %s", len(input.Messages), input.SessionID)
+	return []eventsourcing.Event{usageEvent, &ConversationSummarizedEvent{
+		EventType:       "orchestration_ConversationSummarized",
+		SessionID:       input.SessionID,
+		Summary:         summary,
+		ThroughTime:     last.Timestamp.UTC().Format(time.RFC3339Nano),
+		ThroughSequence: last.Sequence,
+		MessageCount:    len(input.Messages),
+		Timestamp:       eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// summarizeInBackground starts summarizing the user's active session when its history outgrew the LLM context
+func (ro *RequestOrchestrator) summarizeInBackground(userID string) {
+	if _, ok := ro.agg.ChatManagerFor(userID).PendingSummary(); !ok {
+		return
+	}
+	eventsourcing.SafeGo("SummarizeConversation", nil, func() {
+		if err := ro.eventProcessor.ExecuteCommand("SummarizeConversation", map[string]interface{}{"userID": userID}); err != nil {
+			logger.Error("Failed to summarize the conversation: %v", err)
+		}
+	})
+}
+
+// transcript renders messages as lines naming who wrote them
+func transcript(messages []chat.Message) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		speaker := msg.Role.UIRole
+		if msg.Role == chat.RoleUser {
+			speaker = "User"
+		} else if msg.Agent != "" {
+			speaker = msg.Agent
+		}
+		fmt.Fprintf(&b, "%s: %s\n", speaker, msg.Content)
+	}
+	return b.String()
+}
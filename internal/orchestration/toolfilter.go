@@ -0,0 +1,134 @@
+package orchestration
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/llmmodels"
+)
+
+// DefaultMaxTools is the number of agents, and of commands of an agent, offered to the LLM per call. The ones
+// matching the request best are kept, the schemas of the others would only fill the context.
+const DefaultMaxTools = 12
+
+// stopWords are left out when matching a request against the tools, they match nearly every description
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "from": true, "that": true, "this": true, "what": true,
+	"are": true, "was": true, "you": true, "your": true, "can": true, "all": true, "any": true, "has": true,
+	"have": true, "into": true, "its": true, "not": true, "but": true, "about": true, "please": true,
+	"query": true, "user": true, "agent": true, "delegate": true,
+}
+
+// SetToolLimit sets how many agents, and commands of an agent, are offered to the LLM per call; 0 offers all
+func (ro *RequestOrchestrator) SetToolLimit(n int) {
+	ro.modelsMu.Lock()
+	defer ro.modelsMu.Unlock()
+	ro.maxTools = n
+}
+
+// toolLimit returns how many tools are offered per call, 0 for all
+func (ro *RequestOrchestrator) toolLimit() int {
+	ro.modelsMu.RLock()
+	defer ro.modelsMu.RUnlock()
+	return ro.maxTools
+}
+
+// relevantTools returns the limit tools whose texts best match the query, in the order they were given. Ties
+// go to the tool given first, and while fewer tools match than the limit the others fill up the rest, as a
+// request can be about a tool without naming anything in its description.
+func relevantTools(query string, tools []llmmodels.Tool, texts []string, limit int) []llmmodels.Tool {
+	if limit <= 0 || len(tools) <= limit {
+		return tools
+	}
+	words := keywords(query)
+	scores := make([]int, len(tools))
+	for i := range tools {
+		scores[i] = matchScore(words, keywords(texts[i]))
+	}
+	order := make([]int, len(tools))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	kept := order[:limit]
+	sort.Ints(kept)
+	relevant := make([]llmmodels.Tool, 0, limit)
+	for _, i := range kept {
+		relevant = append(relevant, tools[i])
+	}
+	return relevant
+}
+
+// matchScore counts the query's words found among a tool's words
+func matchScore(query, tool []string) int {
+	score := 0
+	for _, q := range query {
+		for _, w := range tool {
+			if sameWord(q, w) {
+				score++
+				break
+			}
+		}
+	}
+	return score
+}
+
+// sameWord reports whether two words are the same or one extends the other, like "remind" and "reminders"
+func sameWord(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return len(a) >= 4 && strings.HasPrefix(b, a)
+}
+
+// keywords splits a text into its lower case words, splitting names like CreateTask too, without stop words
+// and words of less than three letters
+func keywords(text string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if w := string(word); len(word) >= 3 && !stopWords[w] {
+			words = append(words, w)
+		}
+		word = word[:0]
+	}
+	runes := []rune(text)
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r) && i > 0 && unicode.IsLower(runes[i-1]):
+			flush()
+			word = append(word, unicode.ToLower(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word = append(word, unicode.ToLower(r))
+		default:
+			flush()
+		}
+	}
+	flush()
+	return words
+}
+
+// agentText is what a request is matched against to offer a plugin's agent: its name and its commands
+func agentText(plugin eventsourcing.Plugin) string {
+	var sb strings.Builder
+	sb.WriteString(plugin.Name())
+	for name, schema := range plugin.Schemas() {
+		sb.WriteString(" " + name)
+		if description, ok := schema.Schema()["description"].(string); ok {
+			sb.WriteString(" " + description)
+		}
+	}
+	return sb.String()
+}
+
+// toolText is what a request is matched against to offer a tool: its name and description
+func toolText(tool llmmodels.Tool) string {
+	name, _ := tool.Function["name"].(string)
+	description, _ := tool.Function["description"].(string)
+	return name + " " + description
+}
@@ -0,0 +1,166 @@
+package orchestration
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// toolCallInspection describes a tool call for the inspector: what it was called with, what came of it,
+// how long it took, the attempts that failed and the events its command emitted
+type toolCallInspection struct {
+	Arguments string   // Pretty-printed JSON
+	Results   string   // Pretty-printed JSON
+	Duration  string   // Of the last attempt, empty while it runs
+	Attempts  int      // Attempts made, more than one when the tool call was retried
+	Failures  []string // Errors of the attempts that were retried
+	Events    []string // Type and pretty-printed JSON of each event emitted
+}
+
+// inspect describes the tool call as it is now
+func (s *ToolCallState) inspect() toolCallInspection {
+	inspection := toolCallInspection{
+		Arguments: prettyJSON(s.Arguments),
+		Results:   prettyJSON(s.Results),
+		Attempts:  s.Attempt,
+		Failures:  s.Failures,
+	}
+	if started, ended := parseEventTime(s.StartedAt), parseEventTime(s.EndedAt); !started.IsZero() && !ended.IsZero() {
+		inspection.Duration = formatDuration(ended.Sub(started))
+	}
+
+	// The results hold the events as they were emitted, or as they were stored when replayed
+	var emitted []json.RawMessage
+	if data, err := json.Marshal(s.Results["result"]); err == nil {
+		json.Unmarshal(data, &emitted)
+	}
+	for i, event := range emitted {
+		eventType := ""
+		if i < len(s.Events) {
+			eventType = s.Events[i]
+		} else {
+			var typed struct {
+				EventType string `json:"event_type"`
+			}
+			json.Unmarshal(event, &typed)
+			eventType = typed.EventType
+		}
+		inspection.Events = append(inspection.Events, eventType+"\n"+prettyJSON(event))
+	}
+	return inspection
+}
+
+// details returns the inspection as display info details, shown by the Godot client
+func (i toolCallInspection) details() map[string]interface{} {
+	details := map[string]interface{}{
+		"arguments": i.Arguments,
+		"results":   i.Results,
+		"attempts":  i.Attempts,
+	}
+	if i.Duration != "" {
+		details["duration"] = i.Duration
+	}
+	if len(i.Failures) > 0 {
+		details["failed_attempts"] = strings.Join(i.Failures, "\n")
+	}
+	if len(i.Events) > 0 {
+		details["events"] = strings.Join(i.Events, "\n\n")
+	}
+	return details
+}
+
+// inspectInDisplayInfo adds the inspection of a tool call to its display info, for the Godot client
+func (a *OrchestrationAggregate) inspectInDisplayInfo(displayInfo *DisplayInfo, toolCallID string) {
+	state, exists := a.ToolCallStates[toolCallID]
+	if !exists {
+		return
+	}
+	for key, value := range state.inspect().details() {
+		displayInfo.Details[key] = value
+	}
+}
+
+// withInspection returns the updates of a tool call's node after it ended, followed by an update handing the
+// Godot client the display info with its inspection
+func (a *OrchestrationAggregate) withInspection(toolCallID string, actions ...eventsourcing.DeltaAction) []eventsourcing.DeltaAction {
+	displayInfo, exists := a.DisplayInfos["tool_call_"+toolCallID]
+	if !exists {
+		return actions
+	}
+	return append(actions, eventsourcing.DeltaAction{
+		Type:   "update",
+		NodeID: "tool_call_" + toolCallID,
+		Properties: map[string]interface{}{
+			"display_info": map[string]interface{}{
+				"title":       displayInfo.Title,
+				"description": displayInfo.Description,
+				"details":     displayInfo.Details,
+			},
+		},
+	})
+}
+
+// renderToolCallInspector shows the inspection of a tool call in sections
+func renderToolCallInspector(state *ToolCallState) fyne.CanvasObject {
+	inspection := state.inspect()
+	summary := fmt.Sprintf("Status: %s\nAgent: %s\nAttempts: %d", state.Status, state.AgentName, inspection.Attempts)
+	if inspection.Duration != "" {
+		summary += "\nDuration: " + inspection.Duration
+	}
+	monospace := func(text string) fyne.CanvasObject {
+		label := widget.NewLabel(text)
+		label.TextStyle = fyne.TextStyle{Monospace: true}
+		label.Wrapping = fyne.TextWrapWord
+		return label
+	}
+	sections := widget.NewAccordion(
+		widget.NewAccordionItem("Arguments", monospace(inspection.Arguments)),
+		widget.NewAccordionItem("Results", monospace(inspection.Results)),
+	)
+	if len(inspection.Failures) > 0 {
+		sections.Append(widget.NewAccordionItem("Failed attempts", monospace(strings.Join(inspection.Failures, "\n"))))
+	}
+	for i, event := range inspection.Events {
+		eventType, data, _ := strings.Cut(event, "\n")
+		sections.Append(widget.NewAccordionItem(fmt.Sprintf("Event %d: %s", i+1, eventType), monospace(data)))
+	}
+	sections.MultiOpen = true
+	sections.Open(0)
+	return container.NewVScroll(container.NewVBox(widget.NewLabel(summary), sections))
+}
+
+// showToolCallInspector opens the inspector of a tool call in a dialog
+func showToolCallInspector(state *ToolCallState) {
+	windows := fyne.CurrentApp().Driver().AllWindows()
+	if len(windows) == 0 {
+		return
+	}
+	inspector := dialog.NewCustom("Tool call "+state.Function, "Close", renderToolCallInspector(state), windows[0])
+	inspector.Resize(fyne.NewSize(700, 500))
+	inspector.Show()
+}
+
+// prettyJSON indents a value as JSON, or formats it as Go does when it can't be marshaled
+func prettyJSON(v interface{}) string {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+	return string(data)
+}
+
+// formatDuration rounds a duration for people, the timestamps have whole seconds
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return "under a second"
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,92 @@
+package orchestration
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/llmmodels"
+)
+
+// DefaultToolResultTokens is the size of tool results above which they are condensed before they enter the chat
+const DefaultToolResultTokens = 2000
+
+// resultSummaryPrompt asks the LLM to condense a tool result that is too large for the chat
+const resultSummaryPrompt = `The tool %s was called with %s. Its result below is too large to keep in the conversation. Summarize it in at most %d tokens.
+Keep the identifiers, names, dates and counts an answer may need, and say what was left out. Answer with the summary only.`
+
+// SetToolResultLimit sets the tokens a tool result may take in the chat. Larger results are summarized by the
+// LLM when summarize is set and truncated otherwise; the full results are kept in the event either way.
+func (ro *RequestOrchestrator) SetToolResultLimit(tokens int, summarize bool) {
+	ro.modelsMu.Lock()
+	defer ro.modelsMu.Unlock()
+	ro.toolResultTokens = tokens
+	ro.summarizeResults = summarize
+}
+
+// condenseResults returns the condensed form of tool results too large for the chat, empty when they fit, and
+// the usage of the LLM call summarizing them if one was made
+func (ro *RequestOrchestrator) condenseResults(event *ToolCallRequestPlaced, results map[string]interface{}) (string, eventsourcing.Event) {
+	ro.modelsMu.RLock()
+	limit, summarize := ro.toolResultTokens, ro.summarizeResults
+	ro.modelsMu.RUnlock()
+	full, err := json.Marshal(results)
+	if err != nil || limit <= 0 {
+		return "", nil
+	}
+	tokens := ro.requestChat(event.RequestID).CountTokens(string(full))
+	if tokens <= limit {
+		return "", nil
+	}
+	logger.Info("Result of tool call %s (%s) takes %d tokens, condensing it to %d", event.ToolCallID, event.Function, tokens, limit)
+	if summarize {
+		arguments, _ := json.Marshal(event.Arguments)
+		messages := []llmmodels.Message{
+			{Role: "system", Content: fmt.Sprintf(resultSummaryPrompt, event.Function, arguments, limit)},
+			{Role: "user", Content: string(full)},
+		}
+		resp, usageEvent, err := ro.callLLM(messages, nil, event.RequestID, "", "tool_result_summary")
+		if err == nil && strings.TrimSpace(resp.Message.Content) != "" {
+			_, summary := parseResponseText(resp.Message.Content)
+			return fmt.Sprintf("Summary of a result of %d tokens:\n%s", tokens, strings.TrimSpace(summary)), usageEvent
+		}
+		logger.Error("Failed to summarize the result of tool call %s, truncating it: %v", event.ToolCallID, err)
+		return truncateResult(string(full), limit), usageEvent
+	}
+	return truncateResult(string(full), limit), nil
+}
+
+// truncateResult keeps the start of a result, about the given number of tokens, saying how much was cut
+func truncateResult(result string, tokens int) string {
+	keep := tokens * 4 // Tokens are about four bytes of JSON
+	if keep >= len(result) {
+		return result
+	}
+	for keep > 0 && !utf8.RuneStart(result[keep]) {
+		keep--
+	}
+	return fmt.Sprintf("%s\n[Truncated: the first %d of %d bytes are shown]", result[:keep], keep, len(result))
+}
+
+// compactedResultTokens is about the size of old tool results once the event log is compacted, when they have no summary
+const compactedResultTokens = 200
+
+// Compact replaces the results by their summary, or by their start when they have none, see eventsourcing.Compactor.
+// Results smaller than that are kept.
+func (e *ToolCallCompleted) Compact() bool {
+	if _, compacted := e.Results["compacted"]; compacted || len(e.Results) == 0 {
+		return false
+	}
+	summary := e.Summary
+	if summary == "" {
+		full, err := json.Marshal(e.Results)
+		if err != nil || len(full) <= compactedResultTokens*4 {
+			return false
+		}
+		summary = truncateResult(string(full), compactedResultTokens)
+	}
+	e.Results = map[string]interface{}{"compacted": true, "summary": summary}
+	return true
+}
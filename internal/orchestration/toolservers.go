@@ -0,0 +1,109 @@
+package orchestration
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"mindpalace/internal/auth"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/llmmodels"
+)
+
+// toolServerSeparator separates the name of a tool server from the names of its tools, e.g.
+// github__create_issue, so tools of different servers and plugins can't clash
+const toolServerSeparator = "__"
+
+// ToolServer offers the tools of an external server to the agents, see mcp.Client
+type ToolServer interface {
+	Tools() []llmmodels.Tool
+	CallTool(ctx context.Context, name string, arguments map[string]interface{}) (string, error)
+}
+
+// attachedServer is a tool server and the agents offered its tools
+type attachedServer struct {
+	server ToolServer
+	agents []string // Plugins whose agents get the tools, all if empty
+}
+
+// AttachToolServer offers the tools of the server to the agents of the named plugins, or to all agents
+// if none are named. Its tools are named after the server, like name__tool.
+func (ro *RequestOrchestrator) AttachToolServer(name string, server ToolServer, agents []string) {
+	ro.toolServersMu.Lock()
+	defer ro.toolServersMu.Unlock()
+	if ro.toolServers == nil {
+		ro.toolServers = make(map[string]attachedServer)
+	}
+	ro.toolServers[name] = attachedServer{server: server, agents: agents}
+}
+
+// serverTools returns the tools of the servers attached for the agent of the plugin
+func (ro *RequestOrchestrator) serverTools(agent string) []llmmodels.Tool {
+	ro.toolServersMu.RLock()
+	defer ro.toolServersMu.RUnlock()
+	var tools []llmmodels.Tool
+	for _, name := range slices.Sorted(maps.Keys(ro.toolServers)) {
+		attached := ro.toolServers[name]
+		if len(attached.agents) > 0 && !slices.Contains(attached.agents, agent) {
+			continue
+		}
+		for _, tool := range attached.server.Tools() {
+			function := maps.Clone(tool.Function)
+			function["name"] = fmt.Sprintf("%s%s%v", name, toolServerSeparator, tool.Function["name"])
+			tools = append(tools, llmmodels.Tool{Type: tool.Type, Function: function})
+		}
+	}
+	return tools
+}
+
+// toolServerOf returns the attached server a tool call is for and the name of the tool on the server
+func (ro *RequestOrchestrator) toolServerOf(function string) (ToolServer, string, bool) {
+	name, tool, found := strings.Cut(function, toolServerSeparator)
+	if !found {
+		return nil, "", false
+	}
+	ro.toolServersMu.RLock()
+	defer ro.toolServersMu.RUnlock()
+	attached, ok := ro.toolServers[name]
+	return attached.server, tool, ok
+}
+
+// callServerTool calls the tool of the server for the user of the request, see auth.UserOf, recording
+// its text result like that of a command. Failures are transient, retried as the retry policy allows.
+func (ro *RequestOrchestrator) callServerTool(event *ToolCallRequestPlaced, server ToolServer, tool string) []eventsourcing.Event {
+	ctx := auth.WithUser(ro.requestContext(event.RequestID), event.Metadata().UserID)
+	text, err := server.CallTool(ctx, tool, event.Arguments)
+	if err != nil {
+		attempt := toolCallAttempt(event)
+		transient := eventsourcing.IsRetriable(err)
+		errorMsg := fmt.Sprintf("tool %s failed: %v", event.Function, err)
+		logger.Error(errorMsg)
+		return []eventsourcing.Event{&ToolCallFailedEvent{
+			EventType:  "orchestration_ToolCallFailed",
+			RequestID:  event.RequestID,
+			ToolCallID: event.ToolCallID,
+			Function:   event.Function,
+			ErrorMsg:   errorMsg,
+			Timestamp:  eventsourcing.ISOTimestamp(),
+			Attempt:    attempt,
+			Transient:  transient,
+			WillRetry:  transient && ro.retryPolicy.ShouldRetry(attempt),
+		}}
+	}
+	var events []eventsourcing.Event
+	results := map[string]interface{}{"success": true, "result": text}
+	summary, usageEvent := ro.condenseResults(event, results)
+	if usageEvent != nil {
+		events = append(events, usageEvent)
+	}
+	return append(events, &ToolCallCompleted{
+		RequestID:  event.RequestID,
+		ToolCallID: event.ToolCallID,
+		Function:   event.Function,
+		Results:    results,
+		Summary:    summary,
+		Timestamp:  eventsourcing.ISOTimestamp(),
+	})
+}
@@ -0,0 +1,128 @@
+package orchestration
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// tracer creates the spans of the requests. They are exported by the tracer provider main sets up, and
+// dropped without one.
+var tracer = otel.Tracer("mindpalace/orchestration")
+
+// tracedCommands are the commands of a request traced as a span of their own, the tool calls and LLM
+// calls they make have spans too
+var tracedCommands = map[string]bool{
+	"DecideAgentCall":          true,
+	"ExecuteAgentCall":         true,
+	"ExecuteAgentFanOut":       true,
+	"CompleteRequest":          true,
+	"CompleteRequestWithError": true,
+}
+
+// requestTrace is the span of a request, from ProcessUserRequest until it completes or is cancelled
+type requestTrace struct {
+	ctx  context.Context
+	span trace.Span
+}
+
+// startTrace starts the span of a new request; the spans of its agents, tool calls and LLM calls are its children
+func (ro *RequestOrchestrator) startTrace(requestID string, attributes ...attribute.KeyValue) {
+	ctx, span := tracer.Start(context.Background(), "request",
+		trace.WithAttributes(append(attributes, attribute.String("request.id", requestID))...))
+	ro.requestsMu.Lock()
+	defer ro.requestsMu.Unlock()
+	if previous, exists := ro.traces[requestID]; exists {
+		previous.span.End()
+	}
+	ro.traces[requestID] = requestTrace{ctx: ctx, span: span}
+}
+
+// traceOf returns the trace of a running request, false if it isn't traced, e.g. it was made before a restart
+func (ro *RequestOrchestrator) traceOf(requestID string) (requestTrace, bool) {
+	ro.requestsMu.Lock()
+	defer ro.requestsMu.Unlock()
+	t, exists := ro.traces[requestID]
+	return t, exists
+}
+
+// traceID returns the ID of the trace of a running request, empty if it isn't traced
+func (ro *RequestOrchestrator) traceID(requestID string) string {
+	t, exists := ro.traceOf(requestID)
+	if !exists || !t.span.SpanContext().HasTraceID() {
+		return ""
+	}
+	return t.span.SpanContext().TraceID().String()
+}
+
+// startSpan starts a span of a request at the time, a span that records nothing if the request isn't traced
+func (ro *RequestOrchestrator) startSpan(requestID, name string, start time.Time, attributes ...attribute.KeyValue) trace.Span {
+	t, exists := ro.traceOf(requestID)
+	if !exists {
+		return trace.SpanFromContext(context.Background())
+	}
+	_, span := tracer.Start(t.ctx, name, trace.WithTimestamp(start), trace.WithAttributes(attributes...))
+	return span
+}
+
+// endSpan ends a span, marking it failed with the error or the message of a failure event
+func endSpan(span trace.Span, err error, events ...eventsourcing.Event) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	for _, event := range events {
+		switch e := event.(type) {
+		case *ToolCallFailedEvent:
+			span.SetStatus(codes.Error, e.ErrorMsg)
+		case *AgentExecutionFailedEvent:
+			span.SetStatus(codes.Error, e.ErrorMsg)
+		}
+	}
+	span.End()
+}
+
+// endTrace ends the span of a request that completed or was cancelled
+func (ro *RequestOrchestrator) endTrace(requestID string, attributes ...attribute.KeyValue) {
+	ro.requestsMu.Lock()
+	t, exists := ro.traces[requestID]
+	delete(ro.traces, requestID)
+	ro.requestsMu.Unlock()
+	if exists {
+		t.span.SetAttributes(attributes...)
+		t.span.End()
+	}
+}
+
+// traceEvents stores the trace of the request the events happened in with them, that of the request the
+// command ran for if the event doesn't name one, like the events a tool call emits
+func (ro *RequestOrchestrator) traceEvents(requestID string, events []eventsourcing.Event) {
+	for _, event := range events {
+		if event == nil || event.Metadata().Sequence > 0 || event.Metadata().TraceID != "" {
+			continue
+		}
+		id := requestOf(event)
+		if id == "" {
+			id = requestID
+		}
+		event.Metadata().TraceID = ro.traceID(id)
+	}
+}
+
+// requestOfInput returns the request a command's input names, an event of the request or a map with a requestID
+func requestOfInput(data any) string {
+	switch d := data.(type) {
+	case eventsourcing.Event:
+		return requestOf(d)
+	case map[string]interface{}:
+		requestID, _ := d["requestID"].(string)
+		return requestID
+	}
+	return ""
+}
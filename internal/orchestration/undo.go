@@ -0,0 +1,142 @@
+package orchestration
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/llmmodels"
+)
+
+// undoToolName is the tool the LLM calls when the user asks to undo the last action
+const undoToolName = "UndoLastAction"
+
+// undoTool describes UndoLastAction to the LLM next to the agents
+func undoTool() llmmodels.Tool {
+	return llmmodels.Tool{
+		Type: "function",
+		Function: map[string]interface{}{
+			"name":        undoToolName,
+			"description": "Undo the most recent action that changed something, e.g. when the user says \"undo that\"",
+			"parameters": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
+	}
+}
+
+// UndoLastActionCommand emits events compensating the most recent request that changed something.
+// Requests are undone as a whole and in reverse order; asking again undoes the request before it.
+func (ro *RequestOrchestrator) UndoLastActionCommand(event *UndoRequestedEvent) ([]eventsourcing.Event, error) {
+	undoneRequestID, compensations, undoneTypes, err := ro.lastActionCompensations(event.RequestID)
+	var responseText string
+	switch {
+	case err != nil:
+		logger.Error("Failed to undo last action for request %s: %v", event.RequestID, err)
+		responseText = fmt.Sprintf("I couldn't undo the last action: %v", err)
+	case undoneRequestID == "":
+		responseText = "There is nothing to undo."
+	default:
+		logger.Info("Undoing request %s with %d compensating events", undoneRequestID, len(compensations))
+		responseText = fmt.Sprintf("Undid the last action (%s).", strings.Join(undoneTypes, ", "))
+	}
+
+	events := compensations
+	if undoneRequestID != "" && err == nil {
+		events = append(events, &ActionUndoneEvent{
+			EventType:       "orchestration_ActionUndone",
+			RequestID:       event.RequestID,
+			UndoneRequestID: undoneRequestID,
+			UndoneEvents:    undoneTypes,
+			Timestamp:       eventsourcing.ISOTimestamp(),
+		})
+	}
+	return append(events, &RequestCompletedEvent{
+		EventType:    "orchestration_RequestCompleted",
+		RequestID:    event.RequestID,
+		ResponseText: responseText,
+		CompletedAt:  eventsourcing.ISOTimestamp(),
+	}), nil
+}
+
+// lastActionCompensations finds the most recent request, other than the current one, whose events can be
+// compensated. Requests that only read state, like listing tasks, are skipped.
+func (ro *RequestOrchestrator) lastActionCompensations(currentRequestID string) (string, []eventsourcing.Event, []string, error) {
+	for i := len(ro.agg.RequestIDs) - 1; i >= 0; i-- {
+		requestID := ro.agg.RequestIDs[i]
+		if requestID == currentRequestID || ro.agg.UndoneRequests[requestID] || ro.agg.userOf(requestID) != ro.agg.userOf(currentRequestID) {
+			continue
+		}
+		compensations, undoneTypes, err := ro.requestCompensations(requestID)
+		if err != nil {
+			return requestID, nil, nil, err
+		}
+		if len(compensations) > 0 {
+			return requestID, compensations, undoneTypes, nil
+		}
+	}
+	return "", nil, nil, nil
+}
+
+// requestCompensations asks the aggregates owning the events of a request's tool calls for the events
+// reversing them, last event first
+func (ro *RequestOrchestrator) requestCompensations(requestID string) ([]eventsourcing.Event, []string, error) {
+	var compensations []eventsourcing.Event
+	var undoneTypes []string
+	calls := ro.agg.completedToolCalls(requestID)
+	for i := len(calls) - 1; i >= 0; i-- {
+		call := calls[i]
+		resultEvents, err := toolResultEvents(call.Results)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read the events of %s: %v", call.Function, err)
+		}
+		if len(resultEvents) == 0 {
+			continue
+		}
+		plugin, err := ro.requestPlugins(requestID).GetPluginByCommand(call.Function)
+		if err != nil || plugin == nil {
+			return nil, nil, fmt.Errorf("no plugin found for command %s", call.Function)
+		}
+		compensator, ok := plugin.Aggregate().(eventsourcing.Compensator)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s does not support undo", plugin.Name())
+		}
+		for j := len(resultEvents) - 1; j >= 0; j-- {
+			events, err := compensator.Compensate(resultEvents[j])
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(events) > 0 {
+				compensations = append(compensations, events...)
+				undoneTypes = append(undoneTypes, resultEvents[j].Type())
+			}
+		}
+	}
+	return compensations, undoneTypes, nil
+}
+
+// toolResultEvents returns the events a tool call produced. Results restored from the event store hold
+// the events as JSON objects, which are decoded through the event registry.
+func toolResultEvents(results map[string]interface{}) ([]eventsourcing.Event, error) {
+	switch result := results["result"].(type) {
+	case []eventsourcing.Event:
+		return result, nil
+	case []interface{}:
+		events := make([]eventsourcing.Event, 0, len(result))
+		for _, raw := range result {
+			data, err := json.Marshal(raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal tool result: %v", err)
+			}
+			event, err := eventsourcing.UnmarshalEvent(data)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, event)
+		}
+		return events, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,53 @@
+package orchestration
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"mindpalace/internal/usage"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/llmmodels"
+)
+
+// callLLM calls the LLM and returns its response with an event recording the tokens the call used.
+// The event is returned rather than published so commands can emit it together with their other events.
+// The call is aborted when the request is cancelled, and traced as a span of the request.
+func (ro *RequestOrchestrator) callLLM(messages []llmmodels.Message, tools []llmmodels.Tool, requestID, model, purpose string) (*llmmodels.OllamaResponse, eventsourcing.Event, error) {
+	span := ro.startSpan(requestID, "llm "+purpose, time.Now(), attribute.String("llm.purpose", purpose),
+		attribute.Int("llm.messages", len(messages)), attribute.Int("llm.tools", len(tools)))
+	resp, err := ro.llmClient.CallLLM(ro.requestContext(requestID), messages, tools, requestID, model)
+	if err != nil {
+		endSpan(span, err)
+		return nil, nil, err
+	}
+	usageEvent := ro.usageEvent(messages, resp, requestID, model, purpose)
+	span.SetAttributes(attribute.String("llm.model", usageEvent.Model), attribute.Int("llm.prompt_tokens", usageEvent.PromptTokens),
+		attribute.Int("llm.completion_tokens", usageEvent.CompletionTokens), attribute.Int("llm.tool_calls", len(resp.Message.ToolCalls)))
+	endSpan(span, nil)
+	return resp, usageEvent, nil
+}
+
+// usageEvent records the token counts reported by the model, or estimates them when none were reported
+func (ro *RequestOrchestrator) usageEvent(messages []llmmodels.Message, resp *llmmodels.OllamaResponse, requestID, model, purpose string) *usage.TokenUsageRecordedEvent {
+	if resp.Model != "" {
+		model = resp.Model
+	}
+	if model == "" {
+		model = "default"
+	}
+	event := &usage.TokenUsageRecordedEvent{
+		EventType:        "usage_TokenUsageRecorded",
+		RequestID:        requestID,
+		Model:            model,
+		Purpose:          purpose,
+		PromptTokens:     resp.PromptEvalCount,
+		CompletionTokens: resp.EvalCount,
+		Timestamp:        eventsourcing.ISOTimestamp(),
+	}
+	if event.PromptTokens == 0 && event.CompletionTokens == 0 {
+		event.PromptTokens, event.CompletionTokens = ro.agg.chatState.GetChatManager().EstimateUsage(messages, resp.Message.Content)
+		event.Estimated = true
+	}
+	return event
+}
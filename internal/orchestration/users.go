@@ -0,0 +1,161 @@
+package orchestration
+
+import (
+	"fmt"
+	"time"
+
+	"mindpalace/internal/chat"
+	"mindpalace/internal/usage"
+	"mindpalace/pkg/eventsourcing"
+)
+
+// UserPluginManager gives the household members sharing MindPalace plugin instances of their own.
+// Implement next to PluginManagerInterface to serve each user's requests with their own plugins.
+type UserPluginManager interface {
+	GetUserLLMPlugins(userID string) []eventsourcing.Plugin
+	GetUserPlugin(userID, name string) (eventsourcing.Plugin, error)
+	GetUserPluginByCommand(userID, cmd string) (eventsourcing.Plugin, error)
+	Users() []string // Returns the users with plugin instances of their own
+}
+
+// userPlugins is the plugin manager as a user sees it
+type userPlugins struct {
+	manager UserPluginManager
+	userID  string
+}
+
+func (p userPlugins) GetLLMPlugins() []eventsourcing.Plugin {
+	return p.manager.GetUserLLMPlugins(p.userID)
+}
+
+func (p userPlugins) GetPlugin(name string) (eventsourcing.Plugin, error) {
+	return p.manager.GetUserPlugin(p.userID, name)
+}
+
+func (p userPlugins) GetPluginByCommand(cmd string) (eventsourcing.Plugin, error) {
+	return p.manager.GetUserPluginByCommand(p.userID, cmd)
+}
+
+// pluginsOf returns the plugins serving the user's requests
+func (ro *RequestOrchestrator) pluginsOf(userID string) PluginManagerInterface {
+	if users, ok := ro.pluginManager.(UserPluginManager); ok && userID != "" {
+		return userPlugins{manager: users, userID: userID}
+	}
+	return ro.pluginManager
+}
+
+// requestPlugins returns the plugins serving a request
+func (ro *RequestOrchestrator) requestPlugins(requestID string) PluginManagerInterface {
+	return ro.pluginsOf(ro.agg.userOf(requestID))
+}
+
+// requestChat returns the chat of the user who made a request
+func (ro *RequestOrchestrator) requestChat(requestID string) *chat.ChatManager {
+	return ro.agg.ChatManagerFor(ro.agg.userOf(requestID))
+}
+
+// actingUser returns the user a command acts for: the user of its input, or else the user who made
+// the request the input belongs to
+func (ro *RequestOrchestrator) actingUser(data any) string {
+	if userID := eventsourcing.UserOf(data); userID != "" {
+		return userID
+	}
+	switch d := data.(type) {
+	case eventsourcing.Event:
+		return ro.agg.userOf(requestOf(d))
+	case map[string]interface{}:
+		requestID, _ := d["requestID"].(string)
+		return ro.agg.userOf(requestID)
+	}
+	return ""
+}
+
+// checkRequestUser refuses a household member acting on someone else's request. The owner may act
+// on any request.
+func (ro *RequestOrchestrator) checkRequestUser(userID, requestID string) error {
+	if userID != "" && ro.agg.userOf(requestID) != userID {
+		return fmt.Errorf("request %s is not %s's", requestID, userID)
+	}
+	return nil
+}
+
+// userCommand stamps the events of an orchestration command with the user it acts for, so the events
+// driving a request on stay in the streams and the chat of the user who made it
+type userCommand struct {
+	ro      *RequestOrchestrator
+	name    string
+	handler eventsourcing.CommandHandler
+}
+
+func (c userCommand) Execute(data any) ([]eventsourcing.Event, error) {
+	requestID := requestOfInput(data)
+	start := time.Now()
+	events, err := c.handler.Execute(data)
+	if requestID == "" {
+		// A new request is named by the events of the command
+		for _, event := range events {
+			if event != nil && requestID == "" {
+				requestID = requestOf(event)
+			}
+		}
+	}
+	if tracedCommands[c.name] {
+		endSpan(c.ro.startSpan(requestID, c.name, start), err, events...)
+	}
+	c.ro.traceEvents(requestID, events)
+	if userID := c.ro.actingUser(data); userID != "" {
+		for _, event := range events {
+			if event == nil {
+				continue
+			}
+			if meta := event.Metadata(); meta.Sequence == 0 && meta.UserID == "" {
+				meta.UserID = userID
+			}
+		}
+	}
+	return events, err
+}
+
+// publish publishes an event of a request outside of a command, as the user who made the request
+func (ro *RequestOrchestrator) publish(event eventsourcing.Event) {
+	if meta := event.Metadata(); meta.UserID == "" {
+		meta.UserID = ro.agg.userOf(requestOf(event))
+	}
+	ro.traceEvents(requestOf(event), []eventsourcing.Event{event})
+	ro.eventBus.Publish(event)
+}
+
+// requestOf returns the request an event belongs to, including the events recording how requests
+// progress and end which requestIDOf leaves out
+func requestOf(event eventsourcing.Event) string {
+	if requestID := requestIDOf(event); requestID != "" {
+		return requestID
+	}
+	switch e := event.(type) {
+	case *UserRequestReceivedEvent:
+		return e.RequestID
+	case *ToolCallStarted:
+		return e.RequestID
+	case *ToolCallProgressEvent:
+		return e.RequestID
+	case *ToolCallConfirmationRequestedEvent:
+		return e.RequestID
+	case *AgentCallCompletedEvent:
+		return e.RequestID
+	case *RequestCompletedEvent:
+		return e.RequestID
+	case *RequestCancelledEvent:
+		return e.RequestID
+	case *ActionUndoneEvent:
+		return e.RequestID
+	case *PluginCreationProgressEvent:
+		return e.RequestID
+	case *PluginCreatedEvent:
+		return e.RequestID
+	case *PluginCreationFailedEvent:
+		return e.RequestID
+	case *usage.TokenUsageRecordedEvent:
+		return e.RequestID
+	}
+	return ""
+}
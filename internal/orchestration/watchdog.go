@@ -0,0 +1,81 @@
+package orchestration
+
+import (
+	"fmt"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// DefaultRequestTimeout is how long a request may take before the watchdog ends it
+const DefaultRequestTimeout = 5 * time.Minute
+
+// SetRequestTimeout sets how long a request may take before the watchdog fails it; 0 disables the watchdog.
+// It applies to requests received afterwards.
+func (ro *RequestOrchestrator) SetRequestTimeout(timeout time.Duration) {
+	ro.requestsMu.Lock()
+	defer ro.requestsMu.Unlock()
+	ro.requestTimeout = timeout
+}
+
+// watchRequest starts the watchdog of a request, timing it out if it is still in progress when the timeout passed
+func (ro *RequestOrchestrator) watchRequest(requestID string) {
+	ro.requestsMu.Lock()
+	defer ro.requestsMu.Unlock()
+	if ro.requestTimeout <= 0 {
+		return
+	}
+	if watchdog, exists := ro.watchdogs[requestID]; exists {
+		watchdog.Stop()
+	}
+	timeout := ro.requestTimeout
+	ro.watchdogs[requestID] = time.AfterFunc(timeout, func() {
+		data := map[string]interface{}{"requestID": requestID, "timeout": timeout}
+		eventsourcing.SafeGo("TimeoutRequest", data, func() {
+			if err := ro.eventProcessor.ExecuteCommand("TimeoutRequest", data); err != nil {
+				logger.Error("Failed to time out request %s: %v", requestID, err)
+			}
+		})
+	})
+}
+
+// TimeoutRequestCommand fails a request that is still in progress after its timeout. Its LLM calls are
+// aborted and results arriving later are ignored, like those of a cancelled request. Requests waiting
+// for the user to confirm a tool call are given another timeout instead.
+func (ro *RequestOrchestrator) TimeoutRequestCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	requestID, _ := data["requestID"].(string)
+	timeout, _ := data["timeout"].(time.Duration)
+	if !ro.agg.isRequestInProgress(requestID) || ro.isCancelled(requestID) {
+		return nil, nil
+	}
+	if ro.agg.awaitsUser(requestID) {
+		logger.Debug("Request %s waits for a confirmation, restarting its watchdog", requestID)
+		ro.watchRequest(requestID)
+		return nil, nil
+	}
+
+	agentName := ""
+	if agentState, exists := ro.agg.AgentStates[requestID]; exists {
+		agentName = agentState.AgentName
+	}
+	errorMsg := fmt.Sprintf("request timed out after %s", timeout)
+	logger.Info("Request %s timed out after %s", requestID, timeout)
+	ro.cancelRequestContext(requestID)
+	return []eventsourcing.Event{
+		&AgentExecutionFailedEvent{
+			EventType:   "orchestration_AgentExecutionFailed",
+			RequestID:   requestID,
+			AgentName:   agentName,
+			ErrorMsg:    errorMsg,
+			Timestamp:   eventsourcing.ISOTimestamp(),
+			Recoverable: true,
+			TimedOut:    true,
+		},
+		&RequestCompletedEvent{
+			EventType:    "orchestration_RequestCompleted",
+			RequestID:    requestID,
+			ResponseText: fmt.Sprintf("I encountered an error while processing your request: %s", errorMsg),
+			CompletedAt:  eventsourcing.ISOTimestamp(),
+		},
+	}, nil
+}
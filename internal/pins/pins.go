@@ -0,0 +1,223 @@
+// Package pins keeps the facts the user pinned, like "my wife's name is Ana", or messages they pinned. They are
+// part of every system prompt, so they stay known however long the conversation gets.
+package pins
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// maxPins is the number of facts a user can pin, they take tokens of every call
+const maxPins = 50
+
+// FactPinnedEvent records a fact the user pinned
+type FactPinnedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Fact
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *FactPinnedEvent) Type() string { return "pins_FactPinned" }
+func (e *FactPinnedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *FactPinnedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// FactUnpinnedEvent records that a fact is no longer pinned; it keeps the fact so it can be undone
+type FactUnpinnedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Fact
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *FactUnpinnedEvent) Type() string { return "pins_FactUnpinned" }
+func (e *FactUnpinnedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *FactUnpinnedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// PinsListedEvent answers a ListPins command with the facts the user pinned
+type PinsListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Facts     []Fact `json:"facts"`
+}
+
+func (e *PinsListedEvent) Type() string { return "pins_PinsListed" }
+func (e *PinsListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *PinsListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("pins_FactPinned", func() eventsourcing.Event { return &FactPinnedEvent{} })
+	eventsourcing.RegisterEvent("pins_FactUnpinned", func() eventsourcing.Event { return &FactUnpinnedEvent{} })
+	eventsourcing.RegisterEvent("pins_PinsListed", func() eventsourcing.Event { return &PinsListedEvent{} })
+	eventsourcing.RegisterTransientEvent("pins_PinsListed")
+}
+
+// Fact is a fact the user pinned
+type Fact struct {
+	PinID     string `json:"pin_id"`
+	Text      string `json:"text"`
+	RequestID string `json:"request_id,omitempty"` // Request of the message the fact was pinned from, if any
+}
+
+// Registry is the aggregate of the facts each user pinned
+type Registry struct {
+	Facts map[string][]Fact // User -> pinned facts, in the order they were pinned
+	Mu    sync.RWMutex
+}
+
+// NewRegistry creates a registry without pinned facts
+func NewRegistry() *Registry {
+	return &Registry{Facts: make(map[string][]Fact)}
+}
+
+// ID returns the aggregate's identifier
+func (r *Registry) ID() string {
+	return "pins"
+}
+
+// ApplyEvent pins and unpins the facts of the event's user
+func (r *Registry) ApplyEvent(event eventsourcing.Event) error {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	userID := event.Metadata().UserID
+	switch e := event.(type) {
+	case *FactPinnedEvent:
+		r.Facts[userID] = append(r.Facts[userID], e.Fact)
+	case *FactUnpinnedEvent:
+		r.Facts[userID] = slices.DeleteFunc(r.Facts[userID], func(fact Fact) bool { return fact.PinID == e.PinID })
+	}
+	return nil
+}
+
+// Compensate returns the event undoing a fact pinned or unpinned
+func (r *Registry) Compensate(event eventsourcing.Event) ([]eventsourcing.Event, error) {
+	switch e := event.(type) {
+	case *FactPinnedEvent:
+		return []eventsourcing.Event{&FactUnpinnedEvent{Fact: e.Fact, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+	case *FactUnpinnedEvent:
+		return []eventsourcing.Event{&FactPinnedEvent{Fact: e.Fact, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+	}
+	return nil, nil
+}
+
+// factsOf returns a copy of the facts the user pinned
+func (r *Registry) factsOf(userID string) []Fact {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	return slices.Clone(r.Facts[userID])
+}
+
+// PinnedFor returns the texts of the facts the user pinned, see orchestration.PinSource
+func (r *Registry) PinnedFor(userID string) []string {
+	var texts []string
+	for _, fact := range r.factsOf(userID) {
+		texts = append(texts, fact.Text)
+	}
+	return texts
+}
+
+// PinFactCommand pins a fact, e.g. {"text": "My wife's name is Ana"}, or a message with the request it was
+// made in, e.g. {"text": "Call the plumber on Monday", "requestID": "req_1"}
+func (r *Registry) PinFactCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	text, _ := data["text"].(string)
+	requestID, _ := data["requestID"].(string)
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("text is required")
+	}
+	facts := r.factsOf(eventsourcing.UserOf(data))
+	for _, fact := range facts {
+		if strings.EqualFold(fact.Text, text) {
+			return nil, fmt.Errorf("%q is pinned already", text)
+		}
+	}
+	if len(facts) >= maxPins {
+		return nil, fmt.Errorf("%d facts are pinned, unpin one first", maxPins)
+	}
+	return []eventsourcing.Event{&FactPinnedEvent{
+		Fact:      Fact{PinID: fmt.Sprintf("pin_%d", eventsourcing.GenerateUniqueID()), Text: text, RequestID: requestID},
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// UnpinFactCommand unpins a fact, e.g. {"pin_id": "pin_1"}, or the fact with the text, e.g. {"text": "My
+// wife's name is Ana"}
+func (r *Registry) UnpinFactCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	id, _ := data["pin_id"].(string)
+	text, _ := data["text"].(string)
+	text = strings.TrimSpace(text)
+	for _, fact := range r.factsOf(eventsourcing.UserOf(data)) {
+		if (id != "" && fact.PinID == id) || (text != "" && strings.EqualFold(fact.Text, text)) {
+			return []eventsourcing.Event{&FactUnpinnedEvent{Fact: fact, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+		}
+	}
+	return nil, fmt.Errorf("there is no pinned fact %q", id+text)
+}
+
+// ListPinsCommand lists the facts the user pinned
+func (r *Registry) ListPinsCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	facts := r.factsOf(eventsourcing.UserOf(data))
+	if facts == nil {
+		facts = []Fact{}
+	}
+	return []eventsourcing.Event{&PinsListedEvent{Facts: facts}}, nil
+}
+
+// GetCustomUI lists the facts the owner pinned
+func (r *Registry) GetCustomUI() fyne.CanvasObject {
+	facts := r.factsOf("")
+	if len(facts) == 0 {
+		return widget.NewLabel("No facts pinned yet")
+	}
+	items := container.NewVBox()
+	for _, fact := range facts {
+		label := widget.NewLabel("📌 " + fact.Text)
+		label.Wrapping = fyne.TextWrapWord
+		items.Add(label)
+	}
+	return container.NewVScroll(items)
+}
+
+// SaveSnapshot serializes the pinned facts
+func (r *Registry) SaveSnapshot() ([]byte, error) {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	return json.Marshal(r.Facts)
+}
+
+// SnapshotFor serializes the facts the user pinned, see eventsourcing.UserSnapshotter
+func (r *Registry) SnapshotFor(userID string) ([]byte, error) {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	return json.Marshal(map[string][]Fact{userID: r.Facts[userID]})
+}
+
+// LoadSnapshot replaces the pinned facts with the snapshot
+func (r *Registry) LoadSnapshot(data []byte) error {
+	facts := make(map[string][]Fact)
+	if err := json.Unmarshal(data, &facts); err != nil {
+		return err
+	}
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	r.Facts = facts
+	return nil
+}
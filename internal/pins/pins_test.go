@@ -0,0 +1,66 @@
+package pins
+
+import (
+	"testing"
+
+	"mindpalace/pkg/eventsourcing/eventsourcingtest"
+)
+
+func TestRegistry_PinAndUnpin(t *testing.T) {
+	r := NewRegistry()
+	eventsourcingtest.Execute(t, r, "", r.PinFactCommand, map[string]interface{}{"text": " My wife's name is Ana "})
+	eventsourcingtest.Execute(t, r, "", r.PinFactCommand, map[string]interface{}{"text": "Call the plumber on Monday", "requestID": "req1"})
+	eventsourcingtest.Execute(t, r, "alice", r.PinFactCommand, map[string]interface{}{"text": "I am vegetarian"})
+
+	if got := r.PinnedFor(""); len(got) != 2 || got[0] != "My wife's name is Ana" {
+		t.Errorf("Expected the owner's facts in the order pinned, got %v", got)
+	}
+	if got := r.PinnedFor("alice"); len(got) != 1 {
+		t.Errorf("Expected another user's facts to stay apart, got %v", got)
+	}
+	for name, data := range map[string]map[string]interface{}{
+		"no text":      {"text": " "},
+		"pinned again": {"text": "my wife's name is ana"},
+	} {
+		data["userID"] = ""
+		if _, err := r.PinFactCommand(data); err == nil {
+			t.Errorf("Expected pinning with %s to fail", name)
+		}
+	}
+
+	unpinned := eventsourcingtest.Execute(t, r, "", r.UnpinFactCommand, map[string]interface{}{"text": "my wife's name is ana"})
+	if got := r.PinnedFor(""); len(got) != 1 || got[0] != "Call the plumber on Monday" {
+		t.Errorf("Expected the fact unpinned, got %v", got)
+	}
+	undo, _ := r.Compensate(unpinned[0])
+	eventsourcingtest.Apply(t, r, "", undo[0])
+	events := eventsourcingtest.Execute(t, r, "", r.ListPinsCommand, map[string]interface{}{})
+	if facts := events[0].(*PinsListedEvent).Facts; len(facts) != 2 || facts[0].RequestID != "req1" {
+		t.Errorf("Expected the fact pinned again after undoing, got %+v", facts)
+	}
+	if _, err := r.UnpinFactCommand(map[string]interface{}{"pin_id": "pin_0"}); err == nil {
+		t.Error("Expected unpinning a fact that isn't pinned to fail")
+	}
+}
+
+func TestRegistry_SnapshotAndLimit(t *testing.T) {
+	r := NewRegistry()
+	for i := 0; i < maxPins; i++ {
+		eventsourcingtest.Execute(t, r, "", r.PinFactCommand, map[string]interface{}{"text": string(rune('A'+i%26)) + string(rune('a'+i/26))})
+	}
+	if _, err := r.PinFactCommand(map[string]interface{}{"text": "One too many"}); err == nil {
+		t.Errorf("Expected no more than %d facts pinned", maxPins)
+	}
+
+	data, err := r.SaveSnapshot()
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	restored := NewRegistry()
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if got := restored.PinnedFor(""); len(got) != maxPins || got[0] != "Aa" {
+		t.Errorf("Expected the facts restored, got %v", got)
+	}
+}
@@ -1,129 +1,451 @@
 package plugingenerator
 
 import (
+	"bytes"
+	_ "embed"
 	"fmt"
+	"go/format"
+	"hash/fnv"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
-	"time"
+	"unicode"
 
 	"mindpalace/pkg/logging"
 )
 
+//go:embed plugin_template.go.tmpl
+var pluginTemplate string
+
+//go:embed plugin_test_template.go.tmpl
+var testTemplate string
+
+//go:embed ui_template.go.tmpl
+var uiTemplate string
+
+//go:embed sandbox_template.go.tmpl
+var sandboxTemplate string
+
+// SandboxFile is the file of a generated plugin that runs it sandboxed in WASM, see pluginwasm
+const SandboxFile = "sandbox.go"
+
 // PluginRequirements holds the gathered requirements for generating a plugin
 type PluginRequirements struct {
-	Name        string
-	Description string
-	Entities    []EntitySpec
-	Commands    []CommandSpec
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Entities    []EntitySpec  `json:"entities"`
+	Commands    []CommandSpec `json:"commands"`
 }
 
 // EntitySpec defines an entity (e.g., Drink)
 type EntitySpec struct {
-	Name   string
-	Fields []FieldSpec
+	Name   string      `json:"name"`
+	Fields []FieldSpec `json:"fields"`
 }
 
 // FieldSpec defines a field in an entity
 type FieldSpec struct {
-	Name string
-	Type string // e.g., string, int, time.Time
-	JSON string // json tag
+	Name        string `json:"name"`
+	Type        string `json:"type" enum:"string,int,float64,bool"`
+	JSON        string `json:"json,omitempty"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"-"` // Set on command inputs by Normalize
 }
 
 // CommandSpec defines a command (e.g., CreateDrink)
 type CommandSpec struct {
-	Name   string
-	Input  []FieldSpec
-	Action string // create, update, delete, list
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Input       []FieldSpec `json:"input,omitempty"`
+	Action      string      `json:"action" enum:"create,update,delete,list"`
+}
+
+// Types fields of generated plugins can have, and actions their commands can take
+var (
+	fieldTypes     = map[string]bool{"string": true, "int": true, "float64": true, "bool": true}
+	commandActions = map[string]bool{"create": true, "update": true, "delete": true, "list": true}
+)
+
+// reservedNames are aggregates of MindPalace itself, which a plugin cannot be named after
+var reservedNames = map[string]bool{"orchestration": true, "reminders": true, "layout": true, "usage": true, "whispermodels": true}
+
+var (
+	pluginNamePattern = regexp.MustCompile(`^[a-z][a-z0-9]{2,29}$`)
+	identifierPattern = regexp.MustCompile(`^[A-Z][A-Za-z0-9]{0,39}$`)
+	jsonNamePattern   = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+)
+
+// Entity returns the entity the plugin tracks; generated plugins track a single one
+func (req *PluginRequirements) Entity() *EntitySpec {
+	return &req.Entities[0]
+}
+
+// IDField returns the name of the field identifying the entity, like DrinkID
+func (req *PluginRequirements) IDField() string {
+	return req.Entity().Name + "ID"
+}
+
+// Normalize checks that the requirements can be generated into a plugin that compiles, and fills in
+// what was left out: JSON names, descriptions, the ID field and the inputs of commands. Its errors are
+// meant to be shown to whoever wrote the requirements, so they can be corrected.
+func (req *PluginRequirements) Normalize() error {
+	req.Name = strings.ToLower(strings.TrimSpace(req.Name))
+	if !pluginNamePattern.MatchString(req.Name) {
+		return fmt.Errorf("plugin name %q must be 3 to 30 lowercase letters or digits, starting with a letter", req.Name)
+	}
+	if reservedNames[req.Name] {
+		return fmt.Errorf("plugin name %q is reserved", req.Name)
+	}
+	if strings.TrimSpace(req.Description) == "" {
+		return fmt.Errorf("the plugin needs a description")
+	}
+	if len(req.Entities) != 1 {
+		return fmt.Errorf("a plugin tracks exactly one entity, got %d", len(req.Entities))
+	}
+
+	entity := req.Entity()
+	if !identifierPattern.MatchString(entity.Name) {
+		return fmt.Errorf("entity name %q must be a capitalized Go identifier, like Drink", entity.Name)
+	}
+	idField := req.IDField()
+	fields := make(map[string]FieldSpec)
+	jsonNames := map[string]bool{"created_at": true}
+	hasID := false
+	for i := range entity.Fields {
+		field := &entity.Fields[i]
+		if !identifierPattern.MatchString(field.Name) {
+			return fmt.Errorf("field name %q must be a capitalized Go identifier, like Amount", field.Name)
+		}
+		if field.Name == "CreatedAt" {
+			return fmt.Errorf("field CreatedAt is added to every entity, leave it out")
+		}
+		if _, exists := fields[field.Name]; exists {
+			return fmt.Errorf("field %s is defined twice", field.Name)
+		}
+		if field.Name == idField {
+			hasID = true
+			field.Type = "string"
+		}
+		if !fieldTypes[field.Type] {
+			return fmt.Errorf("field %s has type %q, use string, int, float64 or bool; dates are strings", field.Name, field.Type)
+		}
+		if field.JSON == "" {
+			field.JSON = snakeCase(field.Name)
+		}
+		if !jsonNamePattern.MatchString(field.JSON) || jsonNames[field.JSON] {
+			return fmt.Errorf("field %s has JSON name %q, which is taken or not lowercase snake case", field.Name, field.JSON)
+		}
+		jsonNames[field.JSON] = true
+		if field.Description == "" {
+			field.Description = field.Name
+		}
+		fields[field.Name] = *field
+	}
+	if !hasID {
+		id := FieldSpec{Name: idField, Type: "string", JSON: snakeCase(idField), Description: "ID of the " + strings.ToLower(entity.Name)}
+		if jsonNames[id.JSON] {
+			return fmt.Errorf("JSON name %s is reserved for the ID of %s", id.JSON, entity.Name)
+		}
+		entity.Fields = append([]FieldSpec{id}, entity.Fields...)
+		fields[idField] = id
+	}
+	// The templates rely on the ID being the first field
+	for i, field := range entity.Fields {
+		if field.Name == idField && i > 0 {
+			copy(entity.Fields[1:i+1], entity.Fields[:i])
+			entity.Fields[0] = field
+		}
+	}
+	if len(entity.Fields) < 2 {
+		return fmt.Errorf("entity %s needs at least one field besides its ID", entity.Name)
+	}
+
+	commands := make(map[string]bool)
+	creates := false
+	for i := range req.Commands {
+		command := &req.Commands[i]
+		if !identifierPattern.MatchString(command.Name) {
+			return fmt.Errorf("command name %q must be a capitalized Go identifier, like LogDrink", command.Name)
+		}
+		if commands[command.Name] {
+			return fmt.Errorf("command %s is defined twice", command.Name)
+		}
+		commands[command.Name] = true
+		command.Action = strings.ToLower(command.Action)
+		if !commandActions[command.Action] {
+			return fmt.Errorf("command %s has action %q, use create, update, delete or list", command.Name, command.Action)
+		}
+		creates = creates || command.Action == "create"
+		if command.Description == "" && command.Action == "list" {
+			command.Description = fmt.Sprintf("List all %ss", strings.ToLower(entity.Name))
+		} else if command.Description == "" {
+			command.Description = fmt.Sprintf("%s a %s", strings.ToUpper(command.Action[:1])+command.Action[1:], strings.ToLower(entity.Name))
+		}
+		inputs, err := commandInputs(command, entity, fields, idField)
+		if err != nil {
+			return err
+		}
+		command.Input = inputs
+	}
+	if !creates {
+		return fmt.Errorf("the plugin needs a command with the create action")
+	}
+	return nil
+}
+
+// commandInputs returns the inputs of a command, typed like the entity's fields. Creating takes the
+// given fields, all but the ID if none are given; updating takes the ID and the fields it changes;
+// deleting takes the ID and listing nothing.
+func commandInputs(command *CommandSpec, entity *EntitySpec, fields map[string]FieldSpec, idField string) ([]FieldSpec, error) {
+	id := fields[idField]
+	id.Required = true
+	switch command.Action {
+	case "delete":
+		return []FieldSpec{id}, nil
+	case "list":
+		return nil, nil
+	}
+
+	var inputs []FieldSpec
+	for _, input := range command.Input {
+		if input.Name == idField {
+			continue
+		}
+		field, exists := fields[input.Name]
+		if !exists {
+			return nil, fmt.Errorf("input %s of command %s is not a field of %s", input.Name, command.Name, entity.Name)
+		}
+		if input.Description != "" {
+			field.Description = input.Description
+		}
+		inputs = append(inputs, field)
+	}
+	if len(inputs) == 0 {
+		for _, field := range entity.Fields {
+			if field.Name != idField {
+				inputs = append(inputs, field)
+			}
+		}
+	}
+	if command.Action == "create" {
+		for i := range inputs {
+			inputs[i].Required = true
+		}
+		return inputs, nil
+	}
+	// Updates leave omitted fields as they are, which a bool cannot tell from false
+	for i := range inputs {
+		if inputs[i].Type == "bool" {
+			inputs[i].Type = "*bool"
+		}
+	}
+	return append([]FieldSpec{id}, inputs...), nil
+}
+
+// snakeCase turns a field name like DrinkID into a JSON name like drink_id
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			previousLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if previousLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
 }
 
 // PluginGenerator handles the generation of plugins
 type PluginGenerator struct {
-	templatePath string
+	pluginsDir string
 }
 
-// NewPluginGenerator creates a new generator
+// NewPluginGenerator creates a generator writing plugins into the plugins directory
 func NewPluginGenerator() *PluginGenerator {
-	return &PluginGenerator{
-		templatePath: "internal/plugingenerator/plugin_template.go.tmpl",
+	return &PluginGenerator{pluginsDir: "plugins"}
+}
+
+// NewPluginGeneratorIn creates a generator writing plugins into the given directory
+func NewPluginGeneratorIn(pluginsDir string) *PluginGenerator {
+	return &PluginGenerator{pluginsDir: pluginsDir}
+}
+
+// PluginDir returns the directory a plugin is generated into
+func (pg *PluginGenerator) PluginDir(name string) string {
+	return filepath.Join(pg.pluginsDir, name)
+}
+
+// templateData is what the templates are executed with
+type templateData struct {
+	Requirements *PluginRequirements
+	Entity       *EntitySpec
+	IDField      string
+	Label        string       // Field whose value labels an entity's card
+	Create       *CommandSpec // Command the tests create entities with
+	CommandList  string
+	Center       []float64
+}
+
+var templateFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"quote": strconv.Quote,
+	"handler": func(command string) string {
+		return strings.ToLower(command[:1]) + command[1:] + "Handler"
+	},
+	"jsonType": func(goType string) string {
+		switch goType {
+		case "int":
+			return "integer"
+		case "float64":
+			return "number"
+		case "bool", "*bool":
+			return "boolean"
+		}
+		return "string"
+	},
+	"zero": func(goType string) string {
+		if goType == "string" {
+			return `""`
+		}
+		return "0"
+	},
+	"sample":  sampleValue,
+	"changed": changedValue,
+}
+
+// sampleValue returns a Go literal of a field's type, used as input by the generated tests
+func sampleValue(goType string) string {
+	switch goType {
+	case "int":
+		return "3"
+	case "float64":
+		return "1.5"
+	case "bool", "*bool":
+		return "true"
 	}
+	return `"example"`
 }
 
-// GeneratePlugin generates the plugin code and writes it to the plugins directory
-func (pg *PluginGenerator) GeneratePlugin(req *PluginRequirements) error {
-	logging.Info("Generating plugin: %s", req.Name)
+// changedValue returns a Go literal of a field's type that differs from sampleValue
+func changedValue(goType string) string {
+	switch goType {
+	case "int":
+		return "7"
+	case "float64":
+		return "2.5"
+	case "bool":
+		return "false"
+	case "*bool":
+		return "&no"
+	}
+	return `"changed"`
+}
 
-	// Prepare template data
-	data := struct {
-		Requirements *PluginRequirements
-		Timestamp    string
-	}{
+// Render returns the formatted source files of a plugin by name: the plugin, its tab in the app, its
+// WASM entry point and its tests
+func (pg *PluginGenerator) Render(req *PluginRequirements) (map[string][]byte, error) {
+	if err := req.Normalize(); err != nil {
+		return nil, err
+	}
+	data := templateData{
 		Requirements: req,
-		Timestamp:    time.Now().Format(time.RFC3339),
+		Entity:       req.Entity(),
+		IDField:      req.IDField(),
+		Label:        req.IDField(),
+		Center:       zoneCenter(req.Name),
 	}
-
-	// Load template
-	tmpl, err := template.New("plugin").Funcs(template.FuncMap{
-		"lower": strings.ToLower,
-	}).ParseFiles(pg.templatePath)
-	if err != nil {
-		return fmt.Errorf("failed to parse template: %v", err)
+	for i := range req.Commands {
+		if req.Commands[i].Action == "create" {
+			data.Create = &req.Commands[i]
+			break
+		}
+	}
+	for _, field := range req.Entity().Fields {
+		if field.Type == "string" && field.Name != data.IDField {
+			data.Label = field.Name
+			break
+		}
+	}
+	var commandList strings.Builder
+	for _, command := range req.Commands {
+		commandList.WriteString(fmt.Sprintf("- %s: %s\n", command.Name, command.Description))
 	}
+	data.CommandList = commandList.String()
 
-	// Create plugin directory
-	pluginDir := filepath.Join("plugins", strings.ToLower(req.Name))
-	if err := os.MkdirAll(pluginDir, 0755); err != nil {
-		return fmt.Errorf("failed to create plugin directory: %v", err)
+	files := make(map[string][]byte)
+	for name, text := range map[string]string{
+		"plugin.go":      pluginTemplate,
+		"ui.go":          uiTemplate,
+		SandboxFile:      sandboxTemplate,
+		"plugin_test.go": testTemplate,
+	} {
+		source, err := execute(strings.TrimSuffix(name, ".go"), text, data)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = source
 	}
+	return files, nil
+}
 
-	// Generate plugin.go
-	pluginFile := filepath.Join(pluginDir, "plugin.go")
-	f, err := os.Create(pluginFile)
+// execute runs a template and formats the Go source it produces
+func execute(name, text string, data templateData) ([]byte, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
 	if err != nil {
-		return fmt.Errorf("failed to create plugin file: %v", err)
+		return nil, fmt.Errorf("failed to parse template: %v", err)
 	}
-	defer f.Close()
-
-	if err := tmpl.Execute(f, data); err != nil {
-		return fmt.Errorf("failed to execute template: %v", err)
+	var source bytes.Buffer
+	if err := tmpl.Execute(&source, data); err != nil {
+		return nil, fmt.Errorf("failed to execute template: %v", err)
 	}
-
-	logging.Info("Plugin generated at: %s", pluginFile)
-	return nil
+	formatted, err := format.Source(source.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated %s does not parse: %v", name, err)
+	}
+	return formatted, nil
 }
 
-// InterviewStep represents a step in the multi-turn interview
-type InterviewStep struct {
-	Question string
-	Field    string
-	Validate func(string) bool
+// zoneCenter picks where a plugin's cards stand in the 3D world: on a ring around the origin, at an
+// angle derived from the plugin's name so it stays put across restarts
+func zoneCenter(name string) []float64 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	angle := 2 * math.Pi * float64(h.Sum32()%360) / 360
+	x := math.Round(24*math.Cos(angle)*10) / 10
+	z := math.Round(24*math.Sin(angle)*10) / 10
+	return []float64{x, 0, z}
 }
 
-// ConductInterview gathers requirements via multi-turn conversation
-func (pg *PluginGenerator) ConductInterview() (*PluginRequirements, error) {
-	req := &PluginRequirements{}
+// GeneratePlugin generates the plugin code and its tests and writes them to the plugin's directory,
+// which must not exist yet
+func (pg *PluginGenerator) GeneratePlugin(req *PluginRequirements) error {
+	logging.Info("Generating plugin: %s", req.Name)
+	files, err := pg.Render(req)
+	if err != nil {
+		return err
+	}
 
-	// For now, simulate or use simple prompts
-	// In real implementation, this would interact with user via chat
-	req.Name = "drinkingtracker"
-	req.Description = "Track daily drinking habits"
-	req.Entities = []EntitySpec{
-		{
-			Name: "Drink",
-			Fields: []FieldSpec{
-				{"DrinkID", "string", "drink_id"},
-				{"Date", "time.Time", "date"},
-				{"Amount", "int", "amount"},
-				{"Type", "string", "type"},
-			},
-		},
+	pluginDir := pg.PluginDir(req.Name)
+	if _, err := os.Stat(pluginDir); err == nil {
+		return fmt.Errorf("plugin directory %s already exists", pluginDir)
 	}
-	req.Commands = []CommandSpec{
-		{"LogDrink", []FieldSpec{{"Date", "string", "date"}, {"Amount", "int", "amount"}, {"Type", "string", "type"}}, "create"},
-		{"ListDrinks", []FieldSpec{}, "list"},
+	if err := os.MkdirAll(pluginDir, 0755); err != nil {
+		return fmt.Errorf("failed to create plugin directory: %v", err)
+	}
+	for name, source := range files {
+		if err := os.WriteFile(filepath.Join(pluginDir, name), source, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", name, err)
+		}
 	}
 
-	return req, nil
+	logging.Info("Plugin generated at: %s", pluginDir)
+	return nil
 }
@@ -0,0 +1,156 @@
+package plugingenerator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func drinkRequirements() *PluginRequirements {
+	return &PluginRequirements{
+		Name:        "drinks",
+		Description: "Tracks the drinks the user has.",
+		Entities: []EntitySpec{{
+			Name: "Drink",
+			Fields: []FieldSpec{
+				{Name: "Name", Type: "string"},
+				{Name: "Volume", Type: "int", Description: "Volume in ml"},
+				{Name: "Alcoholic", Type: "bool"},
+			},
+		}},
+		Commands: []CommandSpec{
+			{Name: "LogDrink", Action: "create"},
+			{Name: "UpdateDrink", Action: "update", Input: []FieldSpec{{Name: "Volume"}, {Name: "Alcoholic"}}},
+			{Name: "DeleteDrink", Action: "delete"},
+			{Name: "ListDrinks", Action: "list"},
+		},
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	req := drinkRequirements()
+	if err := req.Normalize(); err != nil {
+		t.Fatalf("Normalize failed: %v", err)
+	}
+	fields := req.Entity().Fields
+	if len(fields) != 4 || fields[0].Name != "DrinkID" || fields[0].JSON != "drink_id" || fields[2].Description != "Volume in ml" {
+		t.Errorf("fields = %+v", fields)
+	}
+	create, update, remove := req.Commands[0], req.Commands[1], req.Commands[2]
+	if len(create.Input) != 3 || !create.Input[0].Required || create.Description != "Create a drink" {
+		t.Errorf("create command = %+v", create)
+	}
+	if len(update.Input) != 3 || update.Input[0].Name != "DrinkID" || update.Input[2].Type != "*bool" {
+		t.Errorf("update command = %+v", update)
+	}
+	if len(remove.Input) != 1 || remove.Input[0].Name != "DrinkID" || len(req.Commands[3].Input) != 0 {
+		t.Errorf("delete and list commands = %+v", req.Commands[2:])
+	}
+
+	// Normalizing twice changes nothing
+	again := *req
+	if err := again.Normalize(); err != nil || len(again.Entity().Fields) != 4 || len(again.Commands[1].Input) != 3 {
+		t.Errorf("second Normalize = %v, %+v", err, again)
+	}
+}
+
+func TestNormalize_MovesIDFirst(t *testing.T) {
+	req := drinkRequirements()
+	req.Entities[0].Fields = append(req.Entities[0].Fields, FieldSpec{Name: "DrinkID", Type: "int"})
+	if err := req.Normalize(); err != nil {
+		t.Fatalf("Normalize failed: %v", err)
+	}
+	fields := req.Entity().Fields
+	if fields[0].Name != "DrinkID" || fields[0].Type != "string" || fields[1].Name != "Name" || fields[3].Name != "Alcoholic" {
+		t.Errorf("fields = %+v", fields)
+	}
+}
+
+func TestNormalize_Rejects(t *testing.T) {
+	tests := map[string]func(req *PluginRequirements){
+		"plugin name":     func(req *PluginRequirements) { req.Name = "My Drinks" },
+		"reserved":        func(req *PluginRequirements) { req.Name = "orchestration" },
+		"description":     func(req *PluginRequirements) { req.Description = " " },
+		"two entities":    func(req *PluginRequirements) { req.Entities = append(req.Entities, req.Entities[0]) },
+		"entity name":     func(req *PluginRequirements) { req.Entities[0].Name = "drink" },
+		"field type":      func(req *PluginRequirements) { req.Entities[0].Fields[1].Type = "time.Time" },
+		"duplicate field": func(req *PluginRequirements) { req.Entities[0].Fields[1].Name = "Name" },
+		"json name":       func(req *PluginRequirements) { req.Entities[0].Fields[1].JSON = "name" },
+		"created at":      func(req *PluginRequirements) { req.Entities[0].Fields[1].Name = "CreatedAt" },
+		"action":          func(req *PluginRequirements) { req.Commands[1].Action = "archive" },
+		"unknown input":   func(req *PluginRequirements) { req.Commands[1].Input = []FieldSpec{{Name: "Price"}} },
+		"no create":       func(req *PluginRequirements) { req.Commands = req.Commands[1:] },
+		"no fields":       func(req *PluginRequirements) { req.Entities[0].Fields = nil },
+	}
+	for name, change := range tests {
+		req := drinkRequirements()
+		change(req)
+		if err := req.Normalize(); err == nil {
+			t.Errorf("%s: Normalize accepted %+v", name, req)
+		}
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{"DrinkID": "drink_id", "Volume": "volume", "HTTPServer": "http_server", "Top3Items": "top3_items"}
+	for name, want := range tests {
+		if got := snakeCase(name); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	files, err := NewPluginGenerator().Render(drinkRequirements())
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	code, tests := files["plugin.go"], files["plugin_test.go"]
+	for _, want := range []string{
+		"type Drink struct",
+		`"LogDrink": eventsourcing.NewCommand(func(input *LogDrinkInput)`,
+		`eventsourcing.RegisterEvent("drinks_DrinkCreated"`,
+		"if input.Alcoholic != nil",
+		`"DeleteDrink": true`,
+		`if strings.TrimSpace(input.Name) == ""`,
+		`eventsourcing.Manifest{Version: "1.0.0"}`,
+	} {
+		if !strings.Contains(string(code), want) {
+			t.Errorf("generated plugin lacks %q", want)
+		}
+	}
+	for _, want := range []string{"func TestContract", "func TestLogDrink", "func TestUpdateDrink", "no := false", "func TestDeleteDrink", "func TestListDrinks"} {
+		if !strings.Contains(string(tests), want) {
+			t.Errorf("generated tests lack %q", want)
+		}
+	}
+	if !strings.Contains(string(files["ui.go"]), "//go:build !wasip1") || !strings.Contains(string(files[SandboxFile]), "guest.Serve(NewPlugin)") {
+		t.Errorf("Expected the tab for the app and the WASM entry point, got %s\n%s", files["ui.go"], files[SandboxFile])
+	}
+}
+
+func TestGeneratePlugin(t *testing.T) {
+	pg := NewPluginGeneratorIn(t.TempDir())
+	if err := pg.GeneratePlugin(drinkRequirements()); err != nil {
+		t.Fatalf("GeneratePlugin failed: %v", err)
+	}
+	for _, file := range []string{"plugin.go", "ui.go", SandboxFile, "plugin_test.go"} {
+		if _, err := os.Stat(filepath.Join(pg.PluginDir("drinks"), file)); err != nil {
+			t.Errorf("%s was not written: %v", file, err)
+		}
+	}
+	if err := pg.GeneratePlugin(drinkRequirements()); err == nil {
+		t.Error("GeneratePlugin overwrote an existing plugin")
+	}
+}
+
+func TestZoneCenter(t *testing.T) {
+	a, b := zoneCenter("drinks"), zoneCenter("drinks")
+	if a[0] != b[0] || a[2] != b[2] || a[1] != 0 {
+		t.Errorf("zoneCenter is not stable: %v %v", a, b)
+	}
+	if radius := a[0]*a[0] + a[2]*a[2]; radius < 23*23 || radius > 25*25 {
+		t.Errorf("zoneCenter(drinks) = %v, not on the ring", a)
+	}
+}
@@ -0,0 +1,133 @@
+package plugins
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Conflict is a plugin left unloaded because its manifest can't be met
+type Conflict struct {
+	Plugin string
+	Reason string
+}
+
+func (c Conflict) Error() string {
+	return fmt.Sprintf("plugin %s: %s", c.Plugin, c.Reason)
+}
+
+// Conflicts returns the plugins left unloaded because of their manifests, see eventsourcing.Manifester
+func (pm *PluginManager) Conflicts() []Conflict {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return slices.Clone(pm.conflicts)
+}
+
+// Manifest returns the manifest of the named plugin, false if it is not loaded or has none
+func (pm *PluginManager) Manifest(name string) (eventsourcing.Manifest, bool) {
+	plugin, err := pm.GetPlugin(name)
+	if err != nil {
+		return eventsourcing.Manifest{}, false
+	}
+	manifester, ok := plugin.(eventsourcing.Manifester)
+	if !ok {
+		return eventsourcing.Manifest{}, false
+	}
+	return manifester.Manifest(), true
+}
+
+// checkManifests returns the plugins whose manifests the others meet, and a conflict for each plugin left
+// out. Plugins depending on one left out are left out too.
+func checkManifests(plugins []eventsourcing.Plugin) ([]eventsourcing.Plugin, []Conflict) {
+	kept := slices.Clone(plugins)
+	var conflicts []Conflict
+	for changed := true; changed; {
+		changed = false
+		for i, plugin := range kept {
+			if err := checkManifest(plugin, kept); err != nil {
+				conflicts = append(conflicts, Conflict{Plugin: plugin.Name(), Reason: err.Error()})
+				kept = slices.Delete(kept, i, i+1)
+				changed = true
+				break
+			}
+		}
+	}
+	return kept, conflicts
+}
+
+// checkManifest reports why the manifest of the plugin can't be met by the loaded plugins, nil if it can
+// or the plugin has none
+func checkManifest(plugin eventsourcing.Plugin, loaded []eventsourcing.Plugin) error {
+	manifester, ok := plugin.(eventsourcing.Manifester)
+	if !ok {
+		return nil
+	}
+	manifest := manifester.Manifest()
+	if _, err := parseVersion(manifest.Version); err != nil {
+		return err
+	}
+	for _, capability := range manifest.Capabilities {
+		if !slices.Contains(eventsourcing.Capabilities, capability) {
+			return fmt.Errorf("unknown capability %q, expected one of %s", capability, strings.Join(eventsourcing.Capabilities, ", "))
+		}
+	}
+	for _, dependency := range manifest.Requires {
+		i := slices.IndexFunc(loaded, func(p eventsourcing.Plugin) bool { return p.Name() == dependency.Plugin })
+		if i < 0 {
+			return fmt.Errorf("requires plugin %s, which is not loaded", dependency.Plugin)
+		}
+		if dependency.MinVersion == "" {
+			continue
+		}
+		version := ""
+		if manifester, ok := loaded[i].(eventsourcing.Manifester); ok {
+			version = manifester.Manifest().Version
+		}
+		older, err := olderVersion(version, dependency.MinVersion)
+		if err != nil {
+			return fmt.Errorf("requires plugin %s %s or later: %v", dependency.Plugin, dependency.MinVersion, err)
+		}
+		if older {
+			return fmt.Errorf("requires plugin %s %s or later, %s is loaded", dependency.Plugin, dependency.MinVersion, version)
+		}
+	}
+	return nil
+}
+
+// parseVersion returns the numbers of a version like "1.2.0" or "v1.2"
+func parseVersion(version string) ([]int, error) {
+	if version == "" {
+		return nil, fmt.Errorf("no version")
+	}
+	var numbers []int
+	for _, part := range strings.Split(strings.TrimPrefix(version, "v"), ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q, expected one like 1.2.0", version)
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, nil
+}
+
+// olderVersion reports whether version comes before min, missing numbers count as 0 so 1.2 is 1.2.0
+func olderVersion(version, min string) (bool, error) {
+	v, err := parseVersion(version)
+	if err != nil {
+		return false, err
+	}
+	m, err := parseVersion(min)
+	if err != nil {
+		return false, err
+	}
+	for len(v) < len(m) {
+		v = append(v, 0)
+	}
+	for len(m) < len(v) {
+		m = append(m, 0)
+	}
+	return slices.Compare(v, m) < 0, nil
+}
@@ -0,0 +1,85 @@
+package plugins
+
+import (
+	"strings"
+	"testing"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// manifestPlugin is a plugin declaring its manifest
+type manifestPlugin struct {
+	name     string
+	manifest eventsourcing.Manifest
+}
+
+func (p *manifestPlugin) Commands() map[string]eventsourcing.CommandHandler { return nil }
+func (p *manifestPlugin) Schemas() map[string]eventsourcing.CommandInput    { return nil }
+func (p *manifestPlugin) Type() eventsourcing.PluginType                    { return eventsourcing.LLMPlugin }
+func (p *manifestPlugin) Name() string                                      { return p.name }
+func (p *manifestPlugin) Aggregate() eventsourcing.Aggregate                { return nil }
+func (p *manifestPlugin) SystemPrompt() string                              { return "" }
+func (p *manifestPlugin) AgentModel() string                                { return "" }
+func (p *manifestPlugin) Manifest() eventsourcing.Manifest                  { return p.manifest }
+
+func TestCheckManifests(t *testing.T) {
+	taskmanager := &manifestPlugin{name: "taskmanager", manifest: eventsourcing.Manifest{Version: "1.2.0", Capabilities: []string{eventsourcing.CapabilityNetwork}}}
+	goals := &manifestPlugin{name: "goals", manifest: eventsourcing.Manifest{Version: "1.0.0", Requires: []eventsourcing.Dependency{{Plugin: "taskmanager", MinVersion: "1.2"}}}}
+	review := &manifestPlugin{name: "review", manifest: eventsourcing.Manifest{Version: "0.1.0", Requires: []eventsourcing.Dependency{{Plugin: "goals"}}}}
+	future := &manifestPlugin{name: "future", manifest: eventsourcing.Manifest{Version: "1.0.0", Requires: []eventsourcing.Dependency{{Plugin: "taskmanager", MinVersion: "1.10.0"}}}}
+	missing := &manifestPlugin{name: "missing", manifest: eventsourcing.Manifest{Version: "1.0.0", Requires: []eventsourcing.Dependency{{Plugin: "calendar"}}}}
+	camera := &manifestPlugin{name: "camera", manifest: eventsourcing.Manifest{Version: "1.0.0", Capabilities: []string{"camera"}}}
+	unversioned := &manifestPlugin{name: "unversioned"}
+
+	kept, conflicts := checkManifests([]eventsourcing.Plugin{review, goals, taskmanager, future, missing, camera, unversioned})
+	var names []string
+	for _, plugin := range kept {
+		names = append(names, plugin.Name())
+	}
+	if strings.Join(names, ",") != "review,goals,taskmanager" {
+		t.Errorf("Expected review, goals and taskmanager kept, got %v", names)
+	}
+	reasons := make(map[string]string)
+	for _, conflict := range conflicts {
+		reasons[conflict.Plugin] = conflict.Reason
+	}
+	expected := map[string]string{
+		"future":      "requires plugin taskmanager 1.10.0 or later, 1.2.0 is loaded",
+		"missing":     "requires plugin calendar, which is not loaded",
+		"camera":      "unknown capability",
+		"unversioned": "no version",
+	}
+	if len(reasons) != len(expected) {
+		t.Errorf("Expected %d conflicts, got %v", len(expected), conflicts)
+	}
+	for name, reason := range expected {
+		if !strings.Contains(reasons[name], reason) {
+			t.Errorf("Expected %s to conflict with %q, got %q", name, reason, reasons[name])
+		}
+	}
+
+	// Dependents of a plugin left out are left out too
+	kept, conflicts = checkManifests([]eventsourcing.Plugin{review, goals})
+	if len(kept) != 0 || len(conflicts) != 2 {
+		t.Errorf("Expected goals and review left out without taskmanager, got %v kept and %v", kept, conflicts)
+	}
+}
+
+func TestOlderVersion(t *testing.T) {
+	for _, test := range []struct {
+		version, min string
+		older        bool
+	}{
+		{"1.2.0", "1.2", false},
+		{"1.9.0", "1.10.0", true},
+		{"v2.0", "1.99.3", false},
+		{"0.9", "1", true},
+	} {
+		if older, err := olderVersion(test.version, test.min); err != nil || older != test.older {
+			t.Errorf("Expected %s older than %s to be %v, got %v (%v)", test.version, test.min, test.older, older, err)
+		}
+	}
+	if _, err := olderVersion("", "1.0"); err == nil {
+		t.Error("Expected an error comparing an unknown version")
+	}
+}
@@ -1,33 +1,69 @@
 package plugins
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"plugin"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"mindpalace/internal/plugingenerator"
 	"mindpalace/pkg/eventsourcing"
 	"mindpalace/pkg/logging"
+	"mindpalace/pkg/pluginwasm"
 )
 
 // PluginManager handles loading and managing plugins
 type PluginManager struct {
 	plugins        []eventsourcing.Plugin
 	eventProcessor *eventsourcing.EventProcessor
+	mu             sync.RWMutex
+	disabled       map[string]bool                                    // Plugins not offered to the LLM
+	dir            string                                             // Directory plugins are loaded from and generated into
+	loaded         []func(userID string, plugin eventsourcing.Plugin) // Called with plugins installed while running
+	constructors   map[string]func() eventsourcing.Plugin             // Plugin name -> NewPlugin of the plugin, creating the users' instances
+	userPlugins    map[string][]eventsourcing.Plugin                  // User -> the user's own instances of the plugins
+	settings       map[string]map[string]interface{}                  // Settings last configured, for instances created later
+	embed          eventsourcing.EmbedFunc                            // Embedding function last provided, for instances created later
+	readModels     *sql.DB                                            // Read model database last provided, for instances created later
+	locations      map[string]*time.Location                          // User -> time zone last provided, for instances created later
+	tagNormalizers func(userID string) eventsourcing.TagNormalizer    // Tag normalizers last provided, for instances created later
+	linkSources    func(userID string) eventsourcing.LinkSource       // Link sources last provided, for instances created later
+	conflicts      []Conflict                                         // Plugins left unloaded because of their manifests
 }
 
 func NewPluginManager(ep *eventsourcing.EventProcessor) *PluginManager {
 	pm := &PluginManager{
 		eventProcessor: ep,
+		dir:            "plugins",
+		constructors:   make(map[string]func() eventsourcing.Plugin),
+		userPlugins:    make(map[string][]eventsourcing.Plugin),
 	}
-	pm.LoadPlugins("plugins")
+	pm.LoadPlugins(pm.dir)
 	return pm
 }
 
-// In PluginManager
+// GetLLMPlugins returns the enabled plugins usable by the LLM
 func (pm *PluginManager) GetLLMPlugins() []eventsourcing.Plugin {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	var llmPlugins []eventsourcing.Plugin
+	for _, plugin := range pm.GetAllLLMPlugins() {
+		if !pm.disabled[plugin.Name()] {
+			llmPlugins = append(llmPlugins, plugin)
+		}
+	}
+	return llmPlugins
+}
+
+// GetAllLLMPlugins returns the plugins usable by the LLM including disabled ones, whose aggregates are still kept up to date
+func (pm *PluginManager) GetAllLLMPlugins() []eventsourcing.Plugin {
 	var llmPlugins []eventsourcing.Plugin
 	for _, plugin := range pm.plugins {
 		if plugin.Type() == eventsourcing.LLMPlugin {
@@ -37,7 +73,337 @@ func (pm *PluginManager) GetLLMPlugins() []eventsourcing.Plugin {
 	return llmPlugins
 }
 
+// SetDisabled stops offering the named plugins to the LLM, enabling all others
+func (pm *PluginManager) SetDisabled(names []string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.disabled = make(map[string]bool)
+	for _, name := range names {
+		pm.disabled[name] = true
+	}
+}
+
+// Configure passes each plugin implementing Configurable its settings, an empty map if there are none
+func (pm *PluginManager) Configure(settings map[string]map[string]interface{}) {
+	pm.mu.Lock()
+	pm.settings = settings
+	pm.mu.Unlock()
+	for _, plugin := range pm.allInstances() {
+		pm.configure(plugin)
+	}
+}
+
+func (pm *PluginManager) configure(plugin eventsourcing.Plugin) {
+	configurable, ok := plugin.(eventsourcing.Configurable)
+	if !ok {
+		return
+	}
+	pm.mu.RLock()
+	pluginSettings := pm.settings[plugin.Name()]
+	pm.mu.RUnlock()
+	if pluginSettings == nil {
+		pluginSettings = make(map[string]interface{})
+	}
+	if err := configurable.Configure(pluginSettings); err != nil {
+		logging.Error("Failed to configure plugin %s: %v", plugin.Name(), err)
+	}
+}
+
+// ProvideEmbedFunc lets the plugins implementing eventsourcing.Embedder compute embeddings
+func (pm *PluginManager) ProvideEmbedFunc(embed eventsourcing.EmbedFunc) {
+	pm.mu.Lock()
+	pm.embed = embed
+	pm.mu.Unlock()
+	for _, plugin := range pm.allInstances() {
+		if embedder, ok := plugin.(eventsourcing.Embedder); ok {
+			embedder.SetEmbedFunc(embed)
+		}
+	}
+}
+
+// ProvideReadModels lets the plugins implementing eventsourcing.ReadModelProvider query their read models
+func (pm *PluginManager) ProvideReadModels(db *sql.DB) {
+	pm.mu.Lock()
+	pm.readModels = db
+	instances := map[string][]eventsourcing.Plugin{"": append([]eventsourcing.Plugin{}, pm.plugins...)}
+	for userID, plugins := range pm.userPlugins {
+		instances[userID] = append([]eventsourcing.Plugin{}, plugins...)
+	}
+	pm.mu.Unlock()
+	for userID, plugins := range instances {
+		for _, plugin := range plugins {
+			if provider, ok := plugin.(eventsourcing.ReadModelProvider); ok {
+				provider.SetReadModels(db, userID)
+			}
+		}
+	}
+}
+
+// ProvideLocations passes the plugins implementing eventsourcing.TimeZoneAware the time zone of
+// their user. Users without one get the owner's, the empty user's.
+func (pm *PluginManager) ProvideLocations(locations map[string]*time.Location) {
+	pm.mu.Lock()
+	pm.locations = locations
+	instances := map[string][]eventsourcing.Plugin{"": append([]eventsourcing.Plugin{}, pm.plugins...)}
+	for userID, plugins := range pm.userPlugins {
+		instances[userID] = append([]eventsourcing.Plugin{}, plugins...)
+	}
+	pm.mu.Unlock()
+	for userID, plugins := range instances {
+		for _, plugin := range plugins {
+			if aware, ok := plugin.(eventsourcing.TimeZoneAware); ok {
+				aware.SetLocation(locationOf(locations, userID))
+			}
+		}
+	}
+}
+
+// ProvideTagNormalizers passes the plugins implementing eventsourcing.TagAware the normalizer of
+// their user's tags
+func (pm *PluginManager) ProvideTagNormalizers(normalizerFor func(userID string) eventsourcing.TagNormalizer) {
+	pm.mu.Lock()
+	pm.tagNormalizers = normalizerFor
+	instances := map[string][]eventsourcing.Plugin{"": append([]eventsourcing.Plugin{}, pm.plugins...)}
+	for userID, plugins := range pm.userPlugins {
+		instances[userID] = append([]eventsourcing.Plugin{}, plugins...)
+	}
+	pm.mu.Unlock()
+	for userID, plugins := range instances {
+		for _, plugin := range plugins {
+			if aware, ok := plugin.(eventsourcing.TagAware); ok {
+				aware.SetTagNormalizer(normalizerFor(userID))
+			}
+		}
+	}
+}
+
+// ProvideLinkSources passes the plugins implementing eventsourcing.LinkAware the links of their user
+func (pm *PluginManager) ProvideLinkSources(sourceFor func(userID string) eventsourcing.LinkSource) {
+	pm.mu.Lock()
+	pm.linkSources = sourceFor
+	instances := map[string][]eventsourcing.Plugin{"": append([]eventsourcing.Plugin{}, pm.plugins...)}
+	for userID, plugins := range pm.userPlugins {
+		instances[userID] = append([]eventsourcing.Plugin{}, plugins...)
+	}
+	pm.mu.Unlock()
+	for userID, plugins := range instances {
+		for _, plugin := range plugins {
+			if aware, ok := plugin.(eventsourcing.LinkAware); ok {
+				aware.SetLinkSource(sourceFor(userID))
+			}
+		}
+	}
+}
+
+// issueCommands lets the custom UI of a plugin implementing eventsourcing.CommandIssuer execute
+// commands as the user of the instance. Inputs given as maps carry the user too, for the commands
+// such as ProcessUserRequest that take the user from their input.
+func (pm *PluginManager) issueCommands(plugin eventsourcing.Plugin, userID string) {
+	if issuer, ok := plugin.(eventsourcing.CommandIssuer); ok {
+		issuer.SetCommandFunc(func(command string, input any) error {
+			if data, ok := input.(map[string]interface{}); ok && userID != "" {
+				data["userID"] = userID
+			}
+			return pm.eventProcessor.ExecuteCommandAs(userID, command, input)
+		})
+	}
+}
+
+// locationOf returns the user's time zone, that of the owner if the user has none
+func locationOf(locations map[string]*time.Location, userID string) *time.Location {
+	if loc, ok := locations[userID]; ok {
+		return loc
+	}
+	if loc, ok := locations[""]; ok {
+		return loc
+	}
+	return time.Local
+}
+
+// Projections returns the projections of the plugins implementing eventsourcing.ReadModelProvider
+func (pm *PluginManager) Projections() []eventsourcing.Projection {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	var projections []eventsourcing.Projection
+	for _, plugin := range pm.plugins {
+		if provider, ok := plugin.(eventsourcing.ReadModelProvider); ok {
+			projections = append(projections, provider.Projections()...)
+		}
+	}
+	return projections
+}
+
+// allInstances returns the plugins and the users' own instances of them
+func (pm *PluginManager) allInstances() []eventsourcing.Plugin {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	instances := append([]eventsourcing.Plugin{}, pm.plugins...)
+	for _, plugins := range pm.userPlugins {
+		instances = append(instances, plugins...)
+	}
+	return instances
+}
+
+// AddUser gives the user an instance of every LLM plugin of their own, so their tasks, notes and
+// the like are kept apart from everyone else's. It returns the instances created.
+func (pm *PluginManager) AddUser(userID string) []eventsourcing.Plugin {
+	var created []eventsourcing.Plugin
+	for _, plugin := range pm.GetAllLLMPlugins() {
+		if instance := pm.addUserInstance(userID, plugin.Name()); instance != nil {
+			created = append(created, instance)
+		}
+	}
+	return created
+}
+
+// addUserInstance creates the user's instance of the named plugin and registers its commands for
+// the user, nil if the user has one already or it can't be created
+func (pm *PluginManager) addUserInstance(userID, name string) eventsourcing.Plugin {
+	pm.mu.Lock()
+	newPlugin := pm.constructors[name]
+	for _, existing := range pm.userPlugins[userID] {
+		if existing.Name() == name {
+			newPlugin = nil
+		}
+	}
+	if newPlugin == nil {
+		pm.mu.Unlock()
+		return nil
+	}
+	instance := newPlugin()
+	pm.userPlugins[userID] = append(pm.userPlugins[userID], instance)
+	embed, readModels, locations, tagNormalizers, linkSources := pm.embed, pm.readModels, pm.locations, pm.tagNormalizers, pm.linkSources
+	pm.mu.Unlock()
+
+	if aware, ok := instance.(eventsourcing.UserAware); ok {
+		aware.SetUser(userID)
+	}
+	pm.configure(instance)
+	pm.issueCommands(instance, userID)
+	if embedder, ok := instance.(eventsourcing.Embedder); ok && embed != nil {
+		embedder.SetEmbedFunc(embed)
+	}
+	if provider, ok := instance.(eventsourcing.ReadModelProvider); ok && readModels != nil {
+		provider.SetReadModels(readModels, userID)
+	}
+	if aware, ok := instance.(eventsourcing.TimeZoneAware); ok && locations != nil {
+		aware.SetLocation(locationOf(locations, userID))
+	}
+	if aware, ok := instance.(eventsourcing.TagAware); ok && tagNormalizers != nil {
+		aware.SetTagNormalizer(tagNormalizers(userID))
+	}
+	if aware, ok := instance.(eventsourcing.LinkAware); ok && linkSources != nil {
+		aware.SetLinkSource(linkSources(userID))
+	}
+	for command, handler := range instance.Commands() {
+		pm.eventProcessor.RegisterUserCommand(userID, command, guard(instance, command, handler))
+	}
+	logging.Debug("Created plugin %s for user %s", name, userID)
+	return instance
+}
+
+// Users returns the users with plugin instances of their own, sorted
+func (pm *PluginManager) Users() []string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	users := make([]string, 0, len(pm.userPlugins))
+	for userID := range pm.userPlugins {
+		users = append(users, userID)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// GetUserLLMPlugins returns the enabled plugins the LLM uses for the user, see GetLLMPlugins
+func (pm *PluginManager) GetUserLLMPlugins(userID string) []eventsourcing.Plugin {
+	if userID == "" {
+		return pm.GetLLMPlugins()
+	}
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	var llmPlugins []eventsourcing.Plugin
+	for _, plugin := range pm.userPlugins[userID] {
+		if !pm.disabled[plugin.Name()] {
+			llmPlugins = append(llmPlugins, plugin)
+		}
+	}
+	return llmPlugins
+}
+
+// GetUserPlugin returns the user's instance of the named plugin, see GetPlugin
+func (pm *PluginManager) GetUserPlugin(userID, name string) (eventsourcing.Plugin, error) {
+	if userID == "" {
+		return pm.GetPlugin(name)
+	}
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	for _, plugin := range pm.userPlugins[userID] {
+		if plugin.Name() == name {
+			return plugin, nil
+		}
+	}
+	return nil, fmt.Errorf("plugin '%s' not found for user %s", name, userID)
+}
+
+// GetUserPluginByCommand returns the user's instance of the plugin providing the command, see GetPluginByCommand
+func (pm *PluginManager) GetUserPluginByCommand(userID, commandName string) (eventsourcing.Plugin, error) {
+	if userID == "" {
+		return pm.GetPluginByCommand(commandName)
+	}
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	for _, plugin := range pm.userPlugins[userID] {
+		if _, exists := plugin.Commands()[commandName]; exists {
+			return plugin, nil
+		}
+	}
+	return nil, fmt.Errorf("plugin '%s' not found for user %s", commandName, userID)
+}
+
+// interactionAttempts is how often an interaction is mapped and executed again when its command
+// conflicts with a concurrent change
+const interactionAttempts = 3
+
+// HandleInteraction executes the command the plugin owning the 3D object maps the interaction to.
+// Interactions no plugin maps to a command are ignored.
+func (pm *PluginManager) HandleInteraction(interaction eventsourcing.Interaction) error {
+	plugins := pm.plugins
+	if interaction.UserID != "" {
+		pm.mu.RLock()
+		plugins = pm.userPlugins[interaction.UserID]
+		pm.mu.RUnlock()
+	}
+	for _, plugin := range plugins {
+		handler, ok := plugin.(eventsourcing.InteractionHandler)
+		if !ok {
+			continue
+		}
+		command, input := handler.HandleInteraction(interaction)
+		if command == "" {
+			continue
+		}
+		err := pm.eventProcessor.ExecuteCommandAs(interaction.UserID, command, input)
+		for attempt := 1; attempt < interactionAttempts && eventsourcing.IsConflict(err); attempt++ {
+			// The object changed meanwhile, map the interaction again on its new state
+			command, input = handler.HandleInteraction(interaction)
+			if command == "" {
+				return nil
+			}
+			err = pm.eventProcessor.ExecuteCommandAs(interaction.UserID, command, input)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to handle %s of %s: %w", interaction.Kind, interaction.NodeID, err)
+		}
+		logging.Debug("Handled %s of %s with %s", interaction.Kind, interaction.NodeID, command)
+		return nil
+	}
+	logging.Debug("No plugin handles %s of %s", interaction.Kind, interaction.NodeID)
+	return nil
+}
+
 func (pm *PluginManager) GetPlugin(name string) (eventsourcing.Plugin, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 	for _, plugin := range pm.plugins {
 		if plugin.Name() == name {
 			return plugin, nil
@@ -47,6 +413,8 @@ func (pm *PluginManager) GetPlugin(name string) (eventsourcing.Plugin, error) {
 }
 
 func (pm *PluginManager) GetPluginByCommand(commandName string) (eventsourcing.Plugin, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 	for _, plugin := range pm.plugins {
 		for name := range plugin.Commands() {
 			if name == commandName {
@@ -68,6 +436,18 @@ func (pm *PluginManager) LoadPlugins(pluginDir string) {
 	}
 
 	for _, dir := range pluginDirs {
+		if sandboxed(dir) {
+			plugin, newPlugin, err := pm.loadSandboxedPlugin(dir)
+			if err != nil {
+				logging.Error("Failed to load sandboxed plugin %s: %v", dir, err)
+				continue
+			}
+			pm.plugins = append(pm.plugins, plugin)
+			pm.constructors[plugin.Name()] = newPlugin
+			logging.Info("Successfully loaded plugin: %s", plugin.Name())
+			continue
+		}
+
 		pluginName := filepath.Base(dir)
 		soFile := filepath.Join(dir, pluginName+".so")
 
@@ -85,7 +465,7 @@ func (pm *PluginManager) LoadPlugins(pluginDir string) {
 		}
 
 		// Attempt to load the plugin
-		plugin, err := pm.loadPlugin(soFile)
+		plugin, newPlugin, err := pm.loadPlugin(soFile)
 		if err != nil {
 			logging.Error("Failed to load plugin %s: %v", soFile, err)
 			// Attempt to rebuild the plugin if loading failed
@@ -94,7 +474,7 @@ func (pm *PluginManager) LoadPlugins(pluginDir string) {
 				continue
 			}
 			// Try loading again after rebuilding
-			plugin, err = pm.loadPlugin(soFile)
+			plugin, newPlugin, err = pm.loadPlugin(soFile)
 			if err != nil {
 				logging.Error("Failed to load plugin after rebuild %s: %v", soFile, err)
 				continue
@@ -103,10 +483,22 @@ func (pm *PluginManager) LoadPlugins(pluginDir string) {
 
 		if plugin != nil {
 			pm.plugins = append(pm.plugins, plugin)
+			pm.constructors[plugin.Name()] = newPlugin
 			logging.Info("Successfully loaded plugin: %s", plugin.Name())
 		}
 	}
 
+	// Plugins whose dependencies aren't loaded are left out, with those depending on them
+	var conflicts []Conflict
+	pm.plugins, conflicts = checkManifests(pm.plugins)
+	for _, conflict := range conflicts {
+		logging.Error("Not loading plugin %s: %s", conflict.Plugin, conflict.Reason)
+		delete(pm.constructors, conflict.Plugin)
+	}
+	pm.mu.Lock()
+	pm.conflicts = append(pm.conflicts, conflicts...)
+	pm.mu.Unlock()
+
 	logging.Info("Finished loading plugins, total loaded: %d", len(pm.plugins))
 	commands := pm.RegisterCommands()
 	for name, handler := range commands {
@@ -205,11 +597,8 @@ func (pm *PluginManager) buildPlugin(dir, soFile string) error {
 	args = append(args, goFiles...)
 
 	cmd := exec.Command("go", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("build command failed: %w", err)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("build command failed: %w\n%s", err, output)
 	}
 
 	// Verify the file was actually created
@@ -221,31 +610,74 @@ func (pm *PluginManager) buildPlugin(dir, soFile string) error {
 	return nil
 }
 
-// loadPlugin loads a plugin from the given SO file
-func (pm *PluginManager) loadPlugin(soFile string) (eventsourcing.Plugin, error) {
+// loadPlugin loads a plugin from the given SO file, returning it with the NewPlugin creating more instances
+func (pm *PluginManager) loadPlugin(soFile string) (eventsourcing.Plugin, func() eventsourcing.Plugin, error) {
 	logging.Debug("Loading plugin from: %s", soFile)
 
 	plug, err := plugin.Open(soFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open plugin: %w", err)
+		return nil, nil, fmt.Errorf("failed to open plugin: %w", err)
 	}
 
 	sym, err := plug.Lookup("NewPlugin")
 	if err != nil {
-		return nil, fmt.Errorf("plugin does not export NewPlugin: %w", err)
+		return nil, nil, fmt.Errorf("plugin does not export NewPlugin: %w", err)
 	}
 
 	newPlugin, ok := sym.(func() eventsourcing.Plugin)
 	if !ok {
-		return nil, fmt.Errorf("NewPlugin is not of the correct type")
+		return nil, nil, fmt.Errorf("NewPlugin is not of the correct type")
 	}
 
 	pluginInstance := newPlugin()
 	if pluginInstance == nil {
-		return nil, fmt.Errorf("NewPlugin returned nil")
+		return nil, nil, fmt.Errorf("NewPlugin returned nil")
 	}
+	pm.issueCommands(pluginInstance, "")
+
+	return pluginInstance, newPlugin, nil
+}
 
-	return pluginInstance, nil
+// sandboxed reports whether the plugin in the directory runs sandboxed in WASM, like generated plugins
+func sandboxed(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, plugingenerator.SandboxFile))
+	return err == nil
+}
+
+// buildSandboxedPlugin compiles the plugin in the directory to a WASM module
+func (pm *PluginManager) buildSandboxedPlugin(dir, wasmFile string) error {
+	logging.Debug("Building sandboxed plugin from %s to %s", dir, wasmFile)
+	out, err := filepath.Abs(wasmFile)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", out, ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("build command failed: %w\n%s", err, output)
+	}
+	return nil
+}
+
+// loadSandboxedPlugin compiles the plugin in the directory if needed and loads it in the WASM sandbox,
+// returning it with the NewPlugin creating more instances
+func (pm *PluginManager) loadSandboxedPlugin(dir string) (eventsourcing.Plugin, func() eventsourcing.Plugin, error) {
+	wasmFile := pluginWASMFile(dir)
+	shouldBuild, err := pm.shouldBuildPlugin(dir, wasmFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if shouldBuild {
+		if err := pm.buildSandboxedPlugin(dir, wasmFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	sandbox, err := pluginwasm.Load(context.Background(), wasmFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sandbox.Plugin(), sandbox.NewPlugin, nil
 }
 
 func (pm *PluginManager) RegisterCommands() map[string]eventsourcing.CommandHandler {
@@ -256,15 +688,21 @@ func (pm *PluginManager) RegisterCommands() map[string]eventsourcing.CommandHand
 				logging.Debug("Command %s already registered", name)
 				continue
 			}
-			commands[name] = handler
+			commands[name] = guard(p, name, handler)
 		}
 	}
 	return commands
 }
 
+// guard wraps a command of the plugin so it is quarantined once it keeps panicking, see
+// eventsourcing.ErrorRecoveryManager.GuardCommand
+func guard(plugin eventsourcing.Plugin, name string, handler eventsourcing.CommandHandler) eventsourcing.CommandHandler {
+	return eventsourcing.GetGlobalRecoveryManager().GuardCommand(plugin.Name(), name, handler)
+}
+
 // LoadNewPlugin loads and registers a new plugin from the given path
 func (pm *PluginManager) LoadNewPlugin(pluginPath string) error {
-	plugin, err := pm.loadPlugin(pluginPath)
+	plugin, newPlugin, err := pm.loadPlugin(pluginPath)
 	if err != nil {
 		// If loading fails, attempt to rebuild from source if we can find it
 		dir := filepath.Dir(pluginPath)
@@ -274,7 +712,7 @@ func (pm *PluginManager) LoadNewPlugin(pluginPath string) error {
 				return fmt.Errorf("failed to rebuild plugin: %w", buildErr)
 			}
 			// Try loading again after rebuild
-			plugin, err = pm.loadPlugin(pluginPath)
+			plugin, newPlugin, err = pm.loadPlugin(pluginPath)
 			if err != nil {
 				return fmt.Errorf("failed to load plugin after rebuild: %w", err)
 			}
@@ -283,7 +721,11 @@ func (pm *PluginManager) LoadNewPlugin(pluginPath string) error {
 		}
 	}
 
+	if err := checkManifest(plugin, pm.plugins); err != nil {
+		return Conflict{Plugin: plugin.Name(), Reason: err.Error()}
+	}
 	pm.plugins = append(pm.plugins, plugin)
+	pm.constructors[plugin.Name()] = newPlugin
 	commands := pm.RegisterCommands()
 	for name, handler := range commands {
 		pm.eventProcessor.RegisterCommand(name, handler)
@@ -291,24 +733,131 @@ func (pm *PluginManager) LoadNewPlugin(pluginPath string) error {
 	return nil
 }
 
-// GenerateAndLoadPlugin generates a new plugin based on requirements and loads it
-func (pm *PluginManager) GenerateAndLoadPlugin() error {
-	pg := plugingenerator.NewPluginGenerator()
-	req, err := pg.ConductInterview()
+// OnPluginLoaded registers a function called with each plugin installed while running, after its
+// commands were registered, and with the instance of each user; the owner's has an empty user
+func (pm *PluginManager) OnPluginLoaded(loaded func(userID string, plugin eventsourcing.Plugin)) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.loaded = append(pm.loaded, loaded)
+}
+
+// GeneratePlugin writes the code and tests of a plugin meeting the requirements and returns its directory
+func (pm *PluginManager) GeneratePlugin(req *plugingenerator.PluginRequirements) (string, error) {
+	pg := plugingenerator.NewPluginGeneratorIn(pm.dir)
+	if err := pg.GeneratePlugin(req); err != nil {
+		return "", err
+	}
+	return pg.PluginDir(req.Name), nil
+}
+
+// BuildPlugin compiles the plugin in the directory; the error holds the compiler output
+func (pm *PluginManager) BuildPlugin(dir string) error {
+	if sandboxed(dir) {
+		return pm.buildSandboxedPlugin(dir, pluginWASMFile(dir))
+	}
+	return pm.buildPlugin(dir, pluginSOFile(dir))
+}
+
+// TestPlugin runs the tests of the plugin in the directory; the error holds their output
+func (pm *PluginManager) TestPlugin(dir string) error {
+	cmd := exec.Command("go", "test", "-count=1", ".")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("tests failed: %w\n%s", err, output)
+	}
+	return nil
+}
+
+// InstallPlugin loads the compiled plugin in the directory while running and registers its commands,
+// see Install
+func (pm *PluginManager) InstallPlugin(dir string) (eventsourcing.Plugin, error) {
+	var plugin eventsourcing.Plugin
+	var newPlugin func() eventsourcing.Plugin
+	var err error
+	if sandboxed(dir) {
+		plugin, newPlugin, err = pm.loadSandboxedPlugin(dir)
+	} else {
+		plugin, newPlugin, err = pm.loadPlugin(pluginSOFile(dir))
+	}
 	if err != nil {
-		return fmt.Errorf("failed to conduct interview: %v", err)
+		return nil, err
 	}
+	if err := pm.Install(plugin, newPlugin); err != nil {
+		return nil, err
+	}
+	return plugin, nil
+}
 
-	if err := pg.GeneratePlugin(req); err != nil {
-		return fmt.Errorf("failed to generate plugin: %v", err)
+// Install adds a plugin loaded by other means than LoadPlugins, like one running as a process of its own,
+// with the NewPlugin creating the users' instances, and registers its commands. Plugins clashing with a
+// loaded plugin's name or commands, or whose manifest the loaded plugins don't meet, are refused.
+func (pm *PluginManager) Install(plugin eventsourcing.Plugin, newPlugin func() eventsourcing.Plugin) error {
+	pm.mu.Lock()
+	for _, existing := range pm.plugins {
+		if existing.Name() == plugin.Name() {
+			pm.mu.Unlock()
+			return fmt.Errorf("plugin %s is already loaded", plugin.Name())
+		}
+		for name := range plugin.Commands() {
+			if _, exists := existing.Commands()[name]; exists {
+				pm.mu.Unlock()
+				return fmt.Errorf("command %s is already provided by plugin %s", name, existing.Name())
+			}
+		}
+	}
+	if err := checkManifest(plugin, pm.plugins); err != nil {
+		pm.mu.Unlock()
+		return Conflict{Plugin: plugin.Name(), Reason: err.Error()}
+	}
+	pm.plugins = append(pm.plugins, plugin)
+	pm.constructors[plugin.Name()] = newPlugin
+	loaded := append([]func(string, eventsourcing.Plugin){}, pm.loaded...)
+	users := make([]string, 0, len(pm.userPlugins))
+	for userID := range pm.userPlugins {
+		users = append(users, userID)
 	}
+	pm.mu.Unlock()
 
-	// Build and load the plugin
-	pluginDir := filepath.Join("plugins", req.Name)
-	soFile := filepath.Join(pluginDir, req.Name+".so")
-	if err := pm.buildPlugin(pluginDir, soFile); err != nil {
-		return fmt.Errorf("failed to build generated plugin: %v", err)
+	if configurable, ok := plugin.(eventsourcing.Configurable); ok {
+		if err := configurable.Configure(make(map[string]interface{})); err != nil {
+			logging.Error("Failed to configure plugin %s: %v", plugin.Name(), err)
+		}
+	}
+	for name, handler := range plugin.Commands() {
+		pm.eventProcessor.RegisterCommand(name, guard(plugin, name, handler))
 	}
+	for _, callback := range loaded {
+		callback("", plugin)
+	}
+	if plugin.Type() == eventsourcing.LLMPlugin {
+		sort.Strings(users)
+		for _, userID := range users {
+			if instance := pm.addUserInstance(userID, plugin.Name()); instance != nil {
+				for _, callback := range loaded {
+					callback(userID, instance)
+				}
+			}
+		}
+	}
+	logging.Info("Installed plugin: %s", plugin.Name())
+	return nil
+}
+
+// DiscardPlugin removes the directory of a plugin that was generated but not installed
+func (pm *PluginManager) DiscardPlugin(dir string) error {
+	rel, err := filepath.Rel(pm.dir, dir)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("refusing to remove %s, it is not a plugin directory", dir)
+	}
+	return os.RemoveAll(dir)
+}
+
+// pluginSOFile returns the shared object a plugin directory is compiled to
+func pluginSOFile(dir string) string {
+	return filepath.Join(dir, filepath.Base(dir)+".so")
+}
 
-	return pm.LoadNewPlugin(soFile)
+// pluginWASMFile returns the WASM module a sandboxed plugin directory is compiled to
+func pluginWASMFile(dir string) string {
+	return filepath.Join(dir, filepath.Base(dir)+".wasm")
 }
@@ -0,0 +1,200 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// PluginQuarantinedEvent records that a command of a plugin kept panicking and is refused until re-enabled
+type PluginQuarantinedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Plugin    string `json:"plugin"`
+	Command   string `json:"command"`
+	Failures  int    `json:"failures"`
+	Error     string `json:"error"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *PluginQuarantinedEvent) Type() string { return "plugins_PluginQuarantined" }
+func (e *PluginQuarantinedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *PluginQuarantinedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// PluginReenabledEvent records that a quarantined command of a plugin runs again
+type PluginReenabledEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Plugin    string `json:"plugin"`
+	Command   string `json:"command"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *PluginReenabledEvent) Type() string { return "plugins_PluginReenabled" }
+func (e *PluginReenabledEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *PluginReenabledEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("plugins_PluginQuarantined", func() eventsourcing.Event { return &PluginQuarantinedEvent{} })
+	eventsourcing.RegisterEvent("plugins_PluginReenabled", func() eventsourcing.Event { return &PluginReenabledEvent{} })
+}
+
+// Quarantined is a plugin command refused after it kept panicking
+type Quarantined struct {
+	Plugin    string `json:"plugin"`
+	Command   string `json:"command"`
+	Failures  int    `json:"failures"`
+	Error     string `json:"error"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Quarantine is the aggregate of the quarantined plugin commands. The circuit breaker of the recovery manager
+// decides when a command is quarantined, the events record it so the command stays refused after a restart.
+type Quarantine struct {
+	Commands map[string]Quarantined // Handler name -> the quarantined command
+	breaker  *eventsourcing.CircuitBreaker
+	Mu       sync.RWMutex
+}
+
+// NewQuarantine creates the quarantine of the breaker's guarded commands, recording each command whose
+// circuit opens with the event bus
+func NewQuarantine(breaker *eventsourcing.CircuitBreaker, eventBus eventsourcing.EventBus) *Quarantine {
+	q := &Quarantine{
+		Commands: make(map[string]Quarantined),
+		breaker:  breaker,
+	}
+	breaker.OnOpen(func(plugin, command string, failures int, err error) {
+		eventBus.Publish(&PluginQuarantinedEvent{
+			Plugin:    plugin,
+			Command:   command,
+			Failures:  failures,
+			Error:     err.Error(),
+			Timestamp: eventsourcing.ISOTimestamp(),
+		})
+	})
+	return q
+}
+
+// ID returns the aggregate's identifier
+func (q *Quarantine) ID() string {
+	return "quarantine"
+}
+
+// ApplyEvent quarantines and re-enables commands, opening and closing their circuits
+func (q *Quarantine) ApplyEvent(event eventsourcing.Event) error {
+	q.Mu.Lock()
+	defer q.Mu.Unlock()
+	switch e := event.(type) {
+	case *PluginQuarantinedEvent:
+		name := eventsourcing.HandlerName(e.Plugin, e.Command)
+		q.Commands[name] = Quarantined{Plugin: e.Plugin, Command: e.Command, Failures: e.Failures, Error: e.Error, Timestamp: e.Timestamp}
+		q.breaker.Open(name)
+	case *PluginReenabledEvent:
+		name := eventsourcing.HandlerName(e.Plugin, e.Command)
+		delete(q.Commands, name)
+		q.breaker.Close(name)
+	}
+	return nil
+}
+
+// Compensate returns the event undoing a quarantine or re-enabling
+func (q *Quarantine) Compensate(event eventsourcing.Event) ([]eventsourcing.Event, error) {
+	switch e := event.(type) {
+	case *PluginQuarantinedEvent:
+		return []eventsourcing.Event{&PluginReenabledEvent{Plugin: e.Plugin, Command: e.Command, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+	case *PluginReenabledEvent:
+		return []eventsourcing.Event{&PluginQuarantinedEvent{Plugin: e.Plugin, Command: e.Command, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+	}
+	return nil, nil
+}
+
+// quarantined returns the quarantined commands, sorted by plugin and command
+func (q *Quarantine) quarantined() []Quarantined {
+	q.Mu.RLock()
+	defer q.Mu.RUnlock()
+	commands := make([]Quarantined, 0, len(q.Commands))
+	for _, command := range q.Commands {
+		commands = append(commands, command)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		return eventsourcing.HandlerName(commands[i].Plugin, commands[i].Command) < eventsourcing.HandlerName(commands[j].Plugin, commands[j].Command)
+	})
+	return commands
+}
+
+// ReenablePluginCommand re-enables the quarantined commands of a plugin, e.g. {"plugin": "taskmanager"},
+// or one of them with {"plugin": "taskmanager", "command": "AddTask"}. Plugins are shared by the
+// household, only the owner re-enables them.
+func (q *Quarantine) ReenablePluginCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if eventsourcing.UserOf(data) != "" {
+		return nil, fmt.Errorf("only the owner re-enables plugins")
+	}
+	plugin, _ := data["plugin"].(string)
+	command, _ := data["command"].(string)
+	if plugin == "" {
+		return nil, fmt.Errorf("plugin is required")
+	}
+	var events []eventsourcing.Event
+	for _, quarantined := range q.quarantined() {
+		if quarantined.Plugin == plugin && (command == "" || quarantined.Command == command) {
+			events = append(events, &PluginReenabledEvent{Plugin: plugin, Command: quarantined.Command, Timestamp: eventsourcing.ISOTimestamp()})
+		}
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("plugin %s has no quarantined commands", plugin)
+	}
+	return events, nil
+}
+
+// GetCustomUI lists the quarantined commands, the owner re-enables them with ReenablePlugin
+func (q *Quarantine) GetCustomUI() fyne.CanvasObject {
+	commands := q.quarantined()
+	if len(commands) == 0 {
+		return widget.NewLabel("No quarantined plugins")
+	}
+	items := container.NewVBox()
+	for _, quarantined := range commands {
+		items.Add(widget.NewLabel(fmt.Sprintf("%s: %s panicked %d times (%s), quarantined since %s",
+			quarantined.Plugin, quarantined.Command, quarantined.Failures, quarantined.Error, quarantined.Timestamp)))
+	}
+	items.Add(widget.NewLabel("Ask to re-enable a plugin once it is fixed, the ReenablePlugin command runs its commands again"))
+	return container.NewVScroll(items)
+}
+
+// SaveSnapshot serializes the quarantined commands
+func (q *Quarantine) SaveSnapshot() ([]byte, error) {
+	q.Mu.RLock()
+	defer q.Mu.RUnlock()
+	return json.Marshal(q.Commands)
+}
+
+// LoadSnapshot replaces the quarantined commands with the snapshot, opening their circuits
+func (q *Quarantine) LoadSnapshot(data []byte) error {
+	commands := make(map[string]Quarantined)
+	if err := json.Unmarshal(data, &commands); err != nil {
+		return err
+	}
+	q.Mu.Lock()
+	defer q.Mu.Unlock()
+	for name := range q.Commands {
+		q.breaker.Close(name)
+	}
+	q.Commands = commands
+	for name := range commands {
+		q.breaker.Open(name)
+	}
+	return nil
+}
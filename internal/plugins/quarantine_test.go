@@ -0,0 +1,73 @@
+package plugins
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// applyingBus applies the events published to the quarantine
+type applyingBus struct {
+	quarantine *Quarantine
+	published  []eventsourcing.Event
+}
+
+func (b *applyingBus) Publish(event eventsourcing.Event) {
+	b.published = append(b.published, event)
+	b.quarantine.ApplyEvent(event)
+}
+func (b *applyingBus) Subscribe(string, eventsourcing.EventHandler) {}
+func (b *applyingBus) SubscribeAll(eventsourcing.EventHandler)      {}
+
+type crashInput struct{}
+
+func TestQuarantine(t *testing.T) {
+	rm := eventsourcing.NewErrorRecoveryManager(time.Minute, 2)
+	rm.RegisterErrorHandler(func(error, string, string, map[string]interface{}) {})
+	bus := &applyingBus{}
+	q := NewQuarantine(rm.Breaker(), bus)
+	bus.quarantine = q
+
+	command := rm.GuardCommand("taskmanager", "AddTask", eventsourcing.NewCommand(func(input *crashInput) ([]eventsourcing.Event, error) {
+		panic("nil map")
+	}))
+	command.Execute(&crashInput{})
+	command.Execute(&crashInput{})
+	if len(bus.published) != 1 || q.Commands["taskmanager.AddTask"].Failures != 2 {
+		t.Fatalf("Expected AddTask quarantined after panicking twice, got %v", q.Commands)
+	}
+	if _, err := command.Execute(&crashInput{}); !errors.Is(err, eventsourcing.ErrCircuitOpen) {
+		t.Errorf("Expected the quarantined command refused, got %v", err)
+	}
+
+	// A restart replays the quarantine into a new breaker
+	data, err := q.SaveSnapshot()
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	restarted := eventsourcing.NewErrorRecoveryManager(time.Minute, 2)
+	restored := NewQuarantine(restarted.Breaker(), bus)
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if !restarted.Breaker().IsOpen("taskmanager.AddTask") {
+		t.Error("Expected the command quarantined after restoring the snapshot")
+	}
+
+	if _, err := q.ReenablePluginCommand(map[string]interface{}{"plugin": "taskmanager", "userID": "household_bob"}); err == nil {
+		t.Error("Expected a household member not to re-enable plugins")
+	}
+	if _, err := q.ReenablePluginCommand(map[string]interface{}{"plugin": "calendar"}); err == nil {
+		t.Error("Expected re-enabling a plugin without quarantined commands to fail")
+	}
+	events, err := q.ReenablePluginCommand(map[string]interface{}{"plugin": "taskmanager"})
+	if err != nil || len(events) != 1 {
+		t.Fatalf("Expected AddTask re-enabled, got %v, %v", events, err)
+	}
+	q.ApplyEvent(events[0])
+	if len(q.Commands) != 0 || rm.Breaker().IsOpen("taskmanager.AddTask") {
+		t.Errorf("Expected AddTask to run again, got %v", q.Commands)
+	}
+}
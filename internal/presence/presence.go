@@ -0,0 +1,244 @@
+// Package presence animates the orchestrator_ai sphere with what MindPalace is doing: idle, listening to
+// the user, thinking about a request, speaking the response or failing at it.
+package presence
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/internal/orchestration"
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Statuses of the orchestrator, from the least to the most urgent to show
+const (
+	StatusIdle      = "idle"      // Waiting for a request
+	StatusError     = "error"     // The last request failed, until the next one is made
+	StatusThinking  = "thinking"  // A request is being answered
+	StatusSpeaking  = "speaking"  // The response is being spoken
+	StatusListening = "listening" // The user is speaking
+)
+
+// AvatarNodeID is the node of the orchestrator in the 3D world, created by the orchestration aggregate
+const AvatarNodeID = "orchestrator_ai"
+
+// StatusChangedEvent records that the orchestrator does something else for a user. It changes no state
+// worth keeping and is never stored.
+type StatusChangedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Status    string `json:"status"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *StatusChangedEvent) Type() string { return "presence_StatusChanged" }
+func (e *StatusChangedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *StatusChangedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("presence_StatusChanged", func() eventsourcing.Event { return &StatusChangedEvent{} })
+	eventsourcing.RegisterTransientEvent("presence_StatusChanged")
+}
+
+// activity is what the orchestrator does for a user
+type activity struct {
+	requests  map[string]bool // Requests being answered
+	listening bool            // The user is speaking
+	speaking  bool            // The response is being spoken
+	failed    bool            // The last request failed
+	status    string          // Status last published
+}
+
+// current returns what to show: the user speaking first, as it interrupts the rest
+func (a *activity) current() string {
+	switch {
+	case a.listening:
+		return StatusListening
+	case a.speaking:
+		return StatusSpeaking
+	case len(a.requests) > 0:
+		return StatusThinking
+	case a.failed:
+		return StatusError
+	default:
+		return StatusIdle
+	}
+}
+
+// Tracker follows the orchestration and audio of each user and publishes a StatusChangedEvent when what
+// the orchestrator does for them changes. It only sees live events, requests replayed at startup are
+// never shown as in progress.
+type Tracker struct {
+	publish    func(eventsourcing.Event)
+	mu         sync.Mutex
+	activities map[string]*activity // By user, empty for the owner
+	users      map[string]string    // User of each request being answered
+}
+
+// NewTracker creates a Tracker publishing the status changes with publish, e.g. the event bus's Publish
+func NewTracker(publish func(eventsourcing.Event)) *Tracker {
+	return &Tracker{
+		publish:    publish,
+		activities: make(map[string]*activity),
+		users:      make(map[string]string),
+	}
+}
+
+// HandleEvent follows the requests of the users; subscribe it to orchestration_UserRequestReceived,
+// orchestration_AgentExecutionFailed, orchestration_RequestCompleted and orchestration_RequestCancelled
+func (t *Tracker) HandleEvent(event eventsourcing.Event) error {
+	switch e := event.(type) {
+	case *orchestration.UserRequestReceivedEvent:
+		userID := event.Metadata().UserID
+		t.update(userID, func(a *activity) {
+			t.users[e.RequestID] = userID
+			a.requests[e.RequestID] = true
+			a.failed = false
+		})
+	case *orchestration.AgentExecutionFailedEvent:
+		t.updateRequest(e.RequestID, func(a *activity) { a.failed = true })
+	case *orchestration.RequestCompletedEvent:
+		t.endRequest(e.RequestID)
+	case *orchestration.RequestCancelledEvent:
+		t.endRequest(e.RequestID)
+	}
+	return nil
+}
+
+// SetListening tells whether the user is speaking into the microphone. The microphone is the owner's.
+func (t *Tracker) SetListening(listening bool) {
+	t.update("", func(a *activity) { a.listening = listening })
+}
+
+// SetSpeaking tells whether a response is being spoken. The speakers are the owner's.
+func (t *Tracker) SetSpeaking(speaking bool) {
+	t.update("", func(a *activity) { a.speaking = speaking })
+}
+
+// Status returns what the orchestrator does for the user
+func (t *Tracker) Status(userID string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if a, exists := t.activities[userID]; exists {
+		return a.current()
+	}
+	return StatusIdle
+}
+
+// endRequest stops showing the request as being answered
+func (t *Tracker) endRequest(requestID string) {
+	t.updateRequest(requestID, func(a *activity) {
+		delete(a.requests, requestID)
+		delete(t.users, requestID)
+	})
+}
+
+// updateRequest changes the activity of the user who made the request, if it is being answered
+func (t *Tracker) updateRequest(requestID string, change func(a *activity)) {
+	t.mu.Lock()
+	userID, exists := t.users[requestID]
+	t.mu.Unlock()
+	if exists {
+		t.update(userID, change)
+	}
+}
+
+// update changes the activity of the user and publishes its status if that changed
+func (t *Tracker) update(userID string, change func(a *activity)) {
+	t.mu.Lock()
+	a, exists := t.activities[userID]
+	if !exists {
+		a = &activity{requests: make(map[string]bool), status: StatusIdle}
+		t.activities[userID] = a
+	}
+	change(a)
+	status := a.current()
+	changed := status != a.status
+	a.status = status
+	t.mu.Unlock()
+	if !changed {
+		return
+	}
+	event := &StatusChangedEvent{Status: status, Timestamp: eventsourcing.ISOTimestamp()}
+	event.Metadata().UserID = userID
+	t.publish(event)
+}
+
+// PresenceAggregate turns the status changes into updates of the orchestrator's sphere
+type PresenceAggregate struct {
+	Statuses map[string]string // By user, empty for the owner
+	Mu       sync.RWMutex
+}
+
+// NewPresenceAggregate creates a PresenceAggregate with every user idle
+func NewPresenceAggregate() *PresenceAggregate {
+	return &PresenceAggregate{Statuses: make(map[string]string)}
+}
+
+// ID returns the aggregate's identifier
+func (a *PresenceAggregate) ID() string {
+	return "presence"
+}
+
+// ApplyEvent records the status of the user
+func (a *PresenceAggregate) ApplyEvent(event eventsourcing.Event) error {
+	e, ok := event.(*StatusChangedEvent)
+	if !ok {
+		return nil
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	a.Statuses[event.Metadata().UserID] = e.Status
+	return nil
+}
+
+// GetCustomUI lists what the orchestrator does for each user
+func (a *PresenceAggregate) GetCustomUI() fyne.CanvasObject {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	users := make([]string, 0, len(a.Statuses))
+	for userID := range a.Statuses {
+		users = append(users, userID)
+	}
+	sort.Strings(users)
+	items := container.NewVBox()
+	for _, userID := range users {
+		name := userID
+		if name == "" {
+			name = "owner"
+		}
+		items.Add(widget.NewLabel(fmt.Sprintf("%s: %s", name, a.Statuses[userID])))
+	}
+	if len(users) == 0 {
+		items.Add(widget.NewLabel("idle"))
+	}
+	return items
+}
+
+// Broadcast3DDelta animates the sphere of the user's clients
+func (a *PresenceAggregate) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
+	e, ok := event.(*StatusChangedEvent)
+	if !ok {
+		return nil
+	}
+	return []eventsourcing.DeltaAction{{
+		Type:       "update",
+		NodeID:     AvatarNodeID,
+		Properties: map[string]interface{}{"presence": e.Status},
+	}}
+}
+
+// GetFull3DState returns nothing: the full state is the same for all users, and a sphere created
+// without a status is idle until the next change
+func (a *PresenceAggregate) GetFull3DState() []eventsourcing.DeltaAction {
+	return nil
+}
@@ -0,0 +1,79 @@
+package presence
+
+import (
+	"reflect"
+	"testing"
+
+	"mindpalace/internal/orchestration"
+	"mindpalace/pkg/eventsourcing"
+)
+
+// statuses returns a tracker and the statuses it published, by user
+func statuses() (*Tracker, map[string][]string) {
+	published := make(map[string][]string)
+	tracker := NewTracker(func(event eventsourcing.Event) {
+		e := event.(*StatusChangedEvent)
+		published[e.Metadata().UserID] = append(published[e.Metadata().UserID], e.Status)
+	})
+	return tracker, published
+}
+
+func TestTracker_Request(t *testing.T) {
+	tracker, published := statuses()
+	tracker.HandleEvent(&orchestration.UserRequestReceivedEvent{RequestID: "req1"})
+	tracker.SetSpeaking(true)
+	tracker.SetListening(true) // The user barges in
+	tracker.SetListening(false)
+	tracker.HandleEvent(&orchestration.RequestCompletedEvent{RequestID: "req1"})
+	tracker.SetSpeaking(false)
+
+	want := []string{StatusThinking, StatusSpeaking, StatusListening, StatusSpeaking, StatusIdle}
+	if !reflect.DeepEqual(published[""], want) {
+		t.Errorf("Expected %v, got %v", want, published[""])
+	}
+}
+
+func TestTracker_FailedRequest(t *testing.T) {
+	tracker, published := statuses()
+	received := &orchestration.UserRequestReceivedEvent{RequestID: "req1"}
+	received.Metadata().UserID = "alice"
+	tracker.HandleEvent(received)
+	tracker.HandleEvent(&orchestration.AgentExecutionFailedEvent{RequestID: "req1"})
+	tracker.HandleEvent(&orchestration.RequestCompletedEvent{RequestID: "req1"})
+	if got := tracker.Status("alice"); got != StatusError {
+		t.Errorf("Expected the failure shown after the request ended, got %s", got)
+	}
+	if len(published[""]) != 0 {
+		t.Errorf("Expected nothing shown to the owner, got %v", published[""])
+	}
+
+	// The next request clears the failure, a request nobody is waiting for changes nothing
+	next := &orchestration.UserRequestReceivedEvent{RequestID: "req2"}
+	next.Metadata().UserID = "alice"
+	tracker.HandleEvent(next)
+	tracker.HandleEvent(&orchestration.RequestCancelledEvent{RequestID: "req2"})
+	tracker.HandleEvent(&orchestration.RequestCompletedEvent{RequestID: "replayed"})
+	want := []string{StatusThinking, StatusError, StatusThinking, StatusIdle}
+	if !reflect.DeepEqual(published["alice"], want) {
+		t.Errorf("Expected %v, got %v", want, published["alice"])
+	}
+}
+
+func TestPresenceAggregate_Broadcast3DDelta(t *testing.T) {
+	agg := NewPresenceAggregate()
+	event := &StatusChangedEvent{Status: StatusThinking}
+	event.Metadata().UserID = "alice"
+	if err := agg.ApplyEvent(event); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+	if agg.Statuses["alice"] != StatusThinking {
+		t.Errorf("Expected alice thinking, got %v", agg.Statuses)
+	}
+	actions := agg.Broadcast3DDelta(event)
+	if len(actions) != 1 || actions[0].NodeID != AvatarNodeID || actions[0].Properties["presence"] != StatusThinking {
+		t.Errorf("Expected the sphere updated to thinking, got %+v", actions)
+	}
+	if !eventsourcing.IsTransient(event) {
+		t.Error("Expected status changes never stored")
+	}
+}
@@ -0,0 +1,280 @@
+// Package projections keeps the read models of plugins up to date. Each projection derives tables
+// from the stored events, in a database of their own next to the event log. The projector remembers
+// the last event each projection saw, catches up on the events stored since at startup and rebuilds
+// a projection from the whole log when its version changes or when asked to.
+package projections
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// EventStore holds the events projections are built from, read a page at a time
+type EventStore interface {
+	GetEventsSince(sequence int64, limit int) ([]eventsourcing.Event, error)
+}
+
+// pageSize is the number of events read from the store at a time when catching up
+const pageSize = 500
+
+// state is how far a projection got
+type state struct {
+	projection eventsourcing.Projection
+	position   int64 // Sequence of the last event projected
+}
+
+// Projector feeds the stored events to the registered projections. Subscribe ProjectEvent to the
+// event bus to keep them current.
+type Projector struct {
+	db          *sql.DB
+	store       EventStore
+	projections map[string]*state
+	mu          sync.Mutex
+}
+
+// NewProjector opens the read model database at path, ":memory:" to keep it in memory, building the
+// projections from the store
+func NewProjector(path string, store EventStore) (*Projector, error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if path == ":memory:" {
+		// Every connection would open a database of its own
+		db.SetMaxOpenConns(1)
+		db.SetConnMaxLifetime(0)
+		db.SetConnMaxIdleTime(0)
+	}
+	createTableSQL := `CREATE TABLE IF NOT EXISTS projections (
+		name TEXT PRIMARY KEY,
+		version INTEGER NOT NULL,
+		position INTEGER NOT NULL
+	);`
+	if _, err := db.Exec(createTableSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create projection table: %v", err)
+	}
+	return &Projector{
+		db:          db,
+		store:       store,
+		projections: make(map[string]*state),
+	}, nil
+}
+
+// DB returns the database of the read models, for the plugins to query
+func (p *Projector) DB() *sql.DB {
+	return p.db
+}
+
+// Register adds a projection. A projection seen before catches up on the events stored since; a new
+// one, or one whose version changed, is built from all events.
+func (p *Projector) Register(projection eventsourcing.Projection) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	name := projection.Name()
+	if _, exists := p.projections[name]; exists {
+		return fmt.Errorf("projection %s registered twice", name)
+	}
+
+	var version int
+	var position int64
+	err := p.db.QueryRow("SELECT version, position FROM projections WHERE name = ?", name).Scan(&version, &position)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to read projection %s: %v", name, err)
+	}
+	s := &state{projection: projection, position: position}
+	if err == sql.ErrNoRows || version != projection.Version() {
+		logging.Info("Building projection %s from the event log", name)
+		if err := p.rebuild(s); err != nil {
+			return err
+		}
+	} else if err := p.catchUp(s); err != nil {
+		return err
+	}
+	p.projections[name] = s
+	return nil
+}
+
+// Rebuild empties the tables of the named projection and projects all events into them again
+func (p *Projector) Rebuild(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, exists := p.projections[name]
+	if !exists {
+		return fmt.Errorf("projection %s not found", name)
+	}
+	return p.rebuild(s)
+}
+
+// Names returns the names of the registered projections, sorted
+func (p *Projector) Names() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make([]string, 0, len(p.projections))
+	for name := range p.projections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProjectEvent updates the projections with an event just stored; subscribe it to the event bus
+func (p *Projector) ProjectEvent(event eventsourcing.Event) error {
+	if event.Metadata().Sequence == 0 {
+		return nil // Transient, nothing changed
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, s := range p.projections {
+		if err := p.project(s, []eventsourcing.Event{event}); err != nil {
+			// Projected again from scratch at the next start
+			logging.Error("Projection %s is out of date: %v", s.projection.Name(), err)
+			if _, err := p.db.Exec("UPDATE projections SET version = -1 WHERE name = ?", s.projection.Name()); err != nil {
+				logging.Error("Failed to mark projection %s out of date: %v", s.projection.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the read model database
+func (p *Projector) Close() error {
+	return p.db.Close()
+}
+
+// rebuild sets up the projection's tables empty and projects all events; p.mu must be held
+func (p *Projector) rebuild(s *state) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := s.projection.Setup(tx); err != nil {
+		return fmt.Errorf("failed to set up projection %s: %v", s.projection.Name(), err)
+	}
+	var position int64
+	for {
+		events, err := p.store.GetEventsSince(position, pageSize)
+		if err != nil {
+			return fmt.Errorf("failed to read the events for projection %s: %v", s.projection.Name(), err)
+		}
+		if len(events) == 0 {
+			break
+		}
+		if position, err = projectAll(tx, s.projection, position, events); err != nil {
+			return err
+		}
+	}
+	if err := savePosition(tx, s.projection, position); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.position = position
+	return nil
+}
+
+// catchUp projects the events stored since the projection's position, a page at a time; p.mu must be held
+func (p *Projector) catchUp(s *state) error {
+	for {
+		events, err := p.store.GetEventsSince(s.position, pageSize)
+		if err != nil {
+			return fmt.Errorf("failed to read the events for projection %s: %v", s.projection.Name(), err)
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		if err := p.project(s, events); err != nil {
+			return err
+		}
+	}
+}
+
+// project applies the events the projection didn't see yet; p.mu must be held
+func (p *Projector) project(s *state, events []eventsourcing.Event) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	position, err := projectAll(tx, s.projection, s.position, events)
+	if err != nil {
+		return err
+	}
+	if position == s.position {
+		return nil
+	}
+	if err := savePosition(tx, s.projection, position); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.position = position
+	return nil
+}
+
+// projectAll projects the events after the position and returns the position of the last one
+func projectAll(tx *sql.Tx, projection eventsourcing.Projection, position int64, events []eventsourcing.Event) (int64, error) {
+	for _, event := range events {
+		sequence := event.Metadata().Sequence
+		if sequence <= position {
+			continue
+		}
+		if err := projection.Project(tx, event); err != nil {
+			return position, fmt.Errorf("projection %s failed on %s (sequence %d): %v", projection.Name(), event.Type(), sequence, err)
+		}
+		position = sequence
+	}
+	return position, nil
+}
+
+func savePosition(tx *sql.Tx, projection eventsourcing.Projection, position int64) error {
+	_, err := tx.Exec("INSERT OR REPLACE INTO projections (name, version, position) VALUES (?, ?, ?)",
+		projection.Name(), projection.Version(), position)
+	return err
+}
+
+// ProjectionRebuiltEvent reports a projection built again from the event log
+type ProjectionRebuiltEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Name      string `json:"name"`
+}
+
+func (e *ProjectionRebuiltEvent) Type() string { return "projections_ProjectionRebuilt" }
+func (e *ProjectionRebuiltEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ProjectionRebuiltEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("projections_ProjectionRebuilt", func() eventsourcing.Event { return &ProjectionRebuiltEvent{} })
+	eventsourcing.RegisterTransientEvent("projections_ProjectionRebuilt")
+}
+
+// RebuildProjectionCommand rebuilds the projection named "name" from the event log. The read models are
+// shared by the household, only the owner rebuilds them.
+func (p *Projector) RebuildProjectionCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if eventsourcing.UserOf(data) != "" {
+		return nil, fmt.Errorf("only the owner rebuilds projections")
+	}
+	name, _ := data["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("name of the projection is required, one of %v", p.Names())
+	}
+	if err := p.Rebuild(name); err != nil {
+		return nil, err
+	}
+	return []eventsourcing.Event{&ProjectionRebuiltEvent{Name: name}}, nil
+}
@@ -0,0 +1,156 @@
+package projections
+
+import (
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"fyne.io/fyne/v2"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Mock implementations for testing
+
+type noteAddedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Text      string `json:"text"`
+}
+
+func (e *noteAddedEvent) Type() string { return "notes_NoteAdded" }
+func (e *noteAddedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *noteAddedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("notes_NoteAdded", func() eventsourcing.Event { return &noteAddedEvent{} })
+}
+
+// noteProjection keeps the notes of each user in a table
+type noteProjection struct {
+	version int
+	setups  int
+}
+
+func (p *noteProjection) Name() string { return "notes" }
+func (p *noteProjection) Version() int { return p.version }
+func (p *noteProjection) Setup(tx *sql.Tx) error {
+	p.setups++
+	if _, err := tx.Exec("DROP TABLE IF EXISTS notes"); err != nil {
+		return err
+	}
+	_, err := tx.Exec("CREATE TABLE notes (user_id TEXT, text TEXT)")
+	return err
+}
+func (p *noteProjection) Project(tx *sql.Tx, event eventsourcing.Event) error {
+	if e, ok := event.(*noteAddedEvent); ok {
+		_, err := tx.Exec("INSERT INTO notes (user_id, text) VALUES (?, ?)", e.UserID, e.Text)
+		return err
+	}
+	return nil
+}
+
+type aggregates []eventsourcing.Aggregate
+
+func (a aggregates) AllAggregates() []eventsourcing.Aggregate { return a }
+
+type noAggregate struct{}
+
+func (noAggregate) ID() string                                 { return "notes" }
+func (noAggregate) ApplyEvent(event eventsourcing.Event) error { return nil }
+func (noAggregate) GetCustomUI() fyne.CanvasObject             { return nil }
+
+func countNotes(t *testing.T, p *Projector, userID string) int {
+	t.Helper()
+	var n int
+	if err := p.DB().QueryRow("SELECT COUNT(*) FROM notes WHERE user_id = ?", userID).Scan(&n); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	return n
+}
+
+func TestProjector(t *testing.T) {
+	dir := t.TempDir()
+	store, err := eventsourcing.NewSQLiteEventStore(filepath.Join(dir, "events.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	defer store.Close()
+	eb := eventsourcing.NewSimpleEventBus(store, aggregates{noAggregate{}}, make(chan eventsourcing.DeltaEnvelope, 10))
+	eb.Publish(&noteAddedEvent{Text: "before the projection"})
+
+	// A new projection is built from the events stored so far, then follows the bus
+	projector, err := NewProjector(filepath.Join(dir, "readmodels.db"), store)
+	if err != nil {
+		t.Fatalf("NewProjector failed: %v", err)
+	}
+	notes := &noteProjection{version: 1}
+	if err := projector.Register(notes); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	eb.SubscribeAll(projector.ProjectEvent)
+	alicesNote := &noteAddedEvent{Text: "alice's note"}
+	alicesNote.Metadata().UserID = "alice"
+	eb.Publish(alicesNote)
+	eb.Publish(&noteAddedEvent{Text: "after"})
+	eb.Publish(alicesNote) // Delivered again
+	if n := countNotes(t, projector, ""); n != 2 {
+		t.Errorf("Expected 2 notes of the owner, got %d", n)
+	}
+	if n := countNotes(t, projector, "alice"); n != 1 {
+		t.Errorf("Expected 1 note of alice, got %d", n)
+	}
+	if err := projector.Register(notes); err == nil {
+		t.Error("Expected an error registering a projection twice")
+	}
+	projector.Close()
+
+	// After a restart the projection catches up on the events it missed
+	eb = eventsourcing.NewSimpleEventBus(store, aggregates{noAggregate{}}, make(chan eventsourcing.DeltaEnvelope, 10))
+	eb.Publish(&noteAddedEvent{Text: "while stopped"})
+	projector, err = NewProjector(filepath.Join(dir, "readmodels.db"), store)
+	if err != nil {
+		t.Fatalf("NewProjector failed: %v", err)
+	}
+	notes = &noteProjection{version: 1}
+	if err := projector.Register(notes); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if n := countNotes(t, projector, ""); n != 3 || notes.setups != 0 {
+		t.Errorf("Expected 3 notes of the owner without a rebuild, got %d after %d setups", n, notes.setups)
+	}
+
+	// A rebuild starts over from the event log
+	events, err := projector.RebuildProjectionCommand(map[string]interface{}{"name": "notes"})
+	if err != nil {
+		t.Fatalf("RebuildProjection failed: %v", err)
+	}
+	if rebuilt := events[0].(*ProjectionRebuiltEvent); rebuilt.Name != "notes" || notes.setups != 1 {
+		t.Errorf("Expected notes rebuilt once, got %s after %d setups", rebuilt.Name, notes.setups)
+	}
+	if n := countNotes(t, projector, ""); n != 3 {
+		t.Errorf("Expected 3 notes of the owner after the rebuild, got %d", n)
+	}
+	if _, err := projector.RebuildProjectionCommand(map[string]interface{}{"name": "unknown"}); err == nil {
+		t.Error("Expected an error rebuilding an unknown projection")
+	}
+	projector.Close()
+
+	// A new version of the projection is built again
+	projector, err = NewProjector(filepath.Join(dir, "readmodels.db"), store)
+	if err != nil {
+		t.Fatalf("NewProjector failed: %v", err)
+	}
+	defer projector.Close()
+	notes = &noteProjection{version: 2}
+	if err := projector.Register(notes); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if n := countNotes(t, projector, ""); n != 3 || notes.setups != 1 {
+		t.Errorf("Expected 3 notes of the owner after one setup, got %d after %d setups", n, notes.setups)
+	}
+}
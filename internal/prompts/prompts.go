@@ -0,0 +1,695 @@
+// Package prompts keeps versions of the system prompt and of the agents' prompts in the event log. The
+// version requests are made with is switched at runtime, and experiments compare versions by assigning each
+// request one of them and measuring how often requests succeed and how often the user corrects them.
+package prompts
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/internal/feedback"
+	"mindpalace/internal/orchestration"
+	"mindpalace/pkg/eventsourcing"
+)
+
+// PromptVersionAddedEvent records a new version of a prompt
+type PromptVersionAddedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Name      string `json:"name"`
+	Version   int    `json:"version"`
+	Text      string `json:"text"`
+	Note      string `json:"note,omitempty"` // What changed, e.g. "shorter answers"
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *PromptVersionAddedEvent) Type() string { return "prompts_PromptVersionAdded" }
+func (e *PromptVersionAddedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *PromptVersionAddedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// PromptActivatedEvent records the version of a prompt requests are made with from now on
+type PromptActivatedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Name      string `json:"name"`
+	Version   int    `json:"version"`  // 0 for the built-in prompt
+	Previous  int    `json:"previous"` // Version active before, to undo the switch
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *PromptActivatedEvent) Type() string { return "prompts_PromptActivated" }
+func (e *PromptActivatedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *PromptActivatedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ExperimentStartedEvent records that requests are assigned one of the versions of a prompt
+type ExperimentStartedEvent struct {
+	eventsourcing.EventMetadata
+	EventType    string `json:"event_type"`
+	ExperimentID string `json:"experiment_id"`
+	Name         string `json:"name"`
+	Versions     []int  `json:"versions"`
+	Timestamp    string `json:"timestamp"`
+}
+
+func (e *ExperimentStartedEvent) Type() string { return "prompts_ExperimentStarted" }
+func (e *ExperimentStartedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ExperimentStartedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ExperimentStoppedEvent records that requests are made with the active version of the prompt again; the
+// experiment's results are kept
+type ExperimentStoppedEvent struct {
+	eventsourcing.EventMetadata
+	EventType    string `json:"event_type"`
+	ExperimentID string `json:"experiment_id"`
+	Name         string `json:"name"`
+	Versions     []int  `json:"versions"`
+	Timestamp    string `json:"timestamp"`
+}
+
+func (e *ExperimentStoppedEvent) Type() string { return "prompts_ExperimentStopped" }
+func (e *ExperimentStoppedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ExperimentStoppedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// PromptsListedEvent answers a ListPrompts command with the prompts and their versions
+type PromptsListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string   `json:"event_type"`
+	Prompts   []Prompt `json:"prompts"`
+}
+
+func (e *PromptsListedEvent) Type() string { return "prompts_PromptsListed" }
+func (e *PromptsListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *PromptsListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ExperimentReportedEvent answers a ShowPromptExperiment command with the outcomes of each version
+type ExperimentReportedEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string     `json:"event_type"`
+	Experiment Experiment `json:"experiment"`
+	Summary    string     `json:"summary"`
+}
+
+func (e *ExperimentReportedEvent) Type() string { return "prompts_ExperimentReported" }
+func (e *ExperimentReportedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ExperimentReportedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("prompts_PromptVersionAdded", func() eventsourcing.Event { return &PromptVersionAddedEvent{} })
+	eventsourcing.RegisterEvent("prompts_PromptActivated", func() eventsourcing.Event { return &PromptActivatedEvent{} })
+	eventsourcing.RegisterEvent("prompts_ExperimentStarted", func() eventsourcing.Event { return &ExperimentStartedEvent{} })
+	eventsourcing.RegisterEvent("prompts_ExperimentStopped", func() eventsourcing.Event { return &ExperimentStoppedEvent{} })
+	eventsourcing.RegisterEvent("prompts_PromptsListed", func() eventsourcing.Event { return &PromptsListedEvent{} })
+	eventsourcing.RegisterEvent("prompts_ExperimentReported", func() eventsourcing.Event { return &ExperimentReportedEvent{} })
+	eventsourcing.RegisterTransientEvent("prompts_PromptsListed")
+	eventsourcing.RegisterTransientEvent("prompts_ExperimentReported")
+}
+
+// Version is a version of a prompt; version 0 is the built-in prompt
+type Version struct {
+	Version int    `json:"version"`
+	Text    string `json:"text"`
+	Note    string `json:"note,omitempty"`
+	AddedAt string `json:"added_at,omitempty"`
+}
+
+// Prompt is a prompt with the versions added, the system prompt or the prompt of a plugin's agent
+type Prompt struct {
+	Name     string    `json:"name"`
+	Versions []Version `json:"versions"` // Versions 1 and up, in order
+	Active   int       `json:"active"`   // Version requests are made with outside experiments
+}
+
+// Outcomes counts what became of the requests made with a version of a prompt. A request succeeded when it
+// completed without an agent or tool call failing; the user corrected it by editing it, undoing it,
+// declining a tool call it made or rating its answer down.
+type Outcomes struct {
+	Requests  int `json:"requests"` // Requests completed
+	Succeeded int `json:"succeeded"`
+	Corrected int `json:"corrected"`
+}
+
+// SuccessRate returns the share of the requests that succeeded
+func (o Outcomes) SuccessRate() float64 {
+	if o.Requests == 0 {
+		return 0
+	}
+	return float64(o.Succeeded) / float64(o.Requests)
+}
+
+// CorrectionRate returns the share of the requests the user corrected
+func (o Outcomes) CorrectionRate() float64 {
+	if o.Requests == 0 {
+		return 0
+	}
+	return float64(o.Corrected) / float64(o.Requests)
+}
+
+// Experiment compares versions of a prompt
+type Experiment struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Versions  []int             `json:"versions"`
+	Running   bool              `json:"running"`
+	StartedAt string            `json:"started_at"`
+	Results   map[int]*Outcomes `json:"results"` // Version -> outcomes of the requests made with it
+}
+
+// Trial is a request made while experiments ran, with the version of each prompt it was assigned
+type Trial struct {
+	Versions  map[string]int    `json:"versions"`    // Prompt name -> version
+	Arms      map[string]string `json:"experiments"` // Prompt name -> experiment the version counts for
+	Failed    bool              `json:"failed,omitempty"`
+	Completed bool              `json:"completed,omitempty"`
+	Corrected bool              `json:"corrected,omitempty"`
+}
+
+// PluginSource finds the plugins whose agents' prompts have versions
+type PluginSource interface {
+	GetPlugin(name string) (eventsourcing.Plugin, error)
+}
+
+// Registry is the aggregate of the prompts' versions and the experiments comparing them. Prompts are the same
+// for everyone in a household, only the owner changes them.
+type Registry struct {
+	Prompts     map[string]*Prompt
+	Experiments []*Experiment     // In the order they were started
+	Trials      map[string]*Trial // RequestID -> request made while experiments ran, until they stopped
+	plugins     PluginSource
+	Mu          sync.RWMutex
+}
+
+// NewRegistry creates a registry for the system prompt and the prompts of the plugins' agents
+func NewRegistry(plugins PluginSource) *Registry {
+	return &Registry{
+		Prompts: make(map[string]*Prompt),
+		Trials:  make(map[string]*Trial),
+		plugins: plugins,
+	}
+}
+
+// ID returns the aggregate's identifier
+func (r *Registry) ID() string {
+	return "prompts"
+}
+
+// ApplyEvent applies the registry's events, assigns the requests made while experiments run and counts
+// their outcomes
+func (r *Registry) ApplyEvent(event eventsourcing.Event) error {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	switch e := event.(type) {
+	case *PromptVersionAddedEvent:
+		prompt := r.prompt(e.Name)
+		prompt.Versions = append(prompt.Versions, Version{Version: e.Version, Text: e.Text, Note: e.Note, AddedAt: e.Timestamp})
+	case *PromptActivatedEvent:
+		r.prompt(e.Name).Active = e.Version
+	case *ExperimentStartedEvent:
+		if experiment := r.experiment(e.ExperimentID); experiment != nil {
+			experiment.Running = true // Its stop was undone
+			return nil
+		}
+		experiment := &Experiment{ID: e.ExperimentID, Name: e.Name, Versions: e.Versions, Running: true, StartedAt: e.Timestamp, Results: make(map[int]*Outcomes)}
+		for _, version := range e.Versions {
+			experiment.Results[version] = &Outcomes{}
+		}
+		r.Experiments = append(r.Experiments, experiment)
+	case *ExperimentStoppedEvent:
+		if experiment := r.experiment(e.ExperimentID); experiment != nil {
+			experiment.Running = false
+		}
+		for requestID, trial := range r.Trials {
+			if trial.Arms[e.Name] == e.ExperimentID {
+				delete(trial.Versions, e.Name)
+				delete(trial.Arms, e.Name)
+			}
+			if len(trial.Arms) == 0 {
+				delete(r.Trials, requestID)
+			}
+		}
+
+	case *orchestration.UserRequestReceivedEvent:
+		r.assign(e.RequestID)
+		if e.Revises != "" {
+			r.correct(e.Revises)
+		}
+	case *orchestration.AgentExecutionFailedEvent:
+		if trial, exists := r.Trials[e.RequestID]; exists {
+			trial.Failed = true
+		}
+	case *orchestration.ToolCallFailedEvent:
+		if trial, exists := r.Trials[e.RequestID]; exists && !e.WillRetry {
+			trial.Failed = true
+		}
+	case *orchestration.ToolCallConfirmedEvent:
+		if !e.Approved {
+			r.correct(e.RequestID)
+		}
+	case *orchestration.ActionUndoneEvent:
+		r.correct(e.UndoneRequestID)
+	case *feedback.FeedbackGivenEvent:
+		if e.Rating == feedback.Down {
+			r.correct(e.RequestID)
+		}
+	case *orchestration.RequestCompletedEvent:
+		trial, exists := r.Trials[e.RequestID]
+		if !exists || trial.Completed {
+			return nil
+		}
+		trial.Completed = true
+		for _, outcomes := range r.outcomesOf(trial) {
+			outcomes.Requests++
+			if !trial.Failed {
+				outcomes.Succeeded++
+			}
+			if trial.Corrected {
+				outcomes.Corrected++
+			}
+		}
+	}
+	return nil
+}
+
+// prompt returns the named prompt, added if it has no versions yet; r.Mu must be held
+func (r *Registry) prompt(name string) *Prompt {
+	prompt, exists := r.Prompts[name]
+	if !exists {
+		prompt = &Prompt{Name: name}
+		r.Prompts[name] = prompt
+	}
+	return prompt
+}
+
+// experiment returns the experiment with the ID, nil if there is none; r.Mu must be held
+func (r *Registry) experiment(id string) *Experiment {
+	for _, experiment := range r.Experiments {
+		if experiment.ID == id {
+			return experiment
+		}
+	}
+	return nil
+}
+
+// running returns the experiment running on the named prompt, nil if there is none; r.Mu must be held
+func (r *Registry) running(name string) *Experiment {
+	for _, experiment := range r.Experiments {
+		if experiment.Running && experiment.Name == name {
+			return experiment
+		}
+	}
+	return nil
+}
+
+// assign assigns a request a version of each prompt experiments run on. The version follows from the
+// request ID, so replaying the log assigns the same versions. r.Mu must be held.
+func (r *Registry) assign(requestID string) {
+	for _, experiment := range r.Experiments {
+		if !experiment.Running {
+			continue
+		}
+		trial, exists := r.Trials[requestID]
+		if !exists {
+			trial = &Trial{Versions: make(map[string]int), Arms: make(map[string]string)}
+			r.Trials[requestID] = trial
+		}
+		hash := fnv.New32a()
+		hash.Write([]byte(requestID + "/" + experiment.Name))
+		trial.Versions[experiment.Name] = experiment.Versions[hash.Sum32()%uint32(len(experiment.Versions))]
+		trial.Arms[experiment.Name] = experiment.ID
+	}
+}
+
+// correct counts that the user corrected a request, once; r.Mu must be held
+func (r *Registry) correct(requestID string) {
+	trial, exists := r.Trials[requestID]
+	if !exists || trial.Corrected {
+		return
+	}
+	trial.Corrected = true
+	if trial.Completed {
+		for _, outcomes := range r.outcomesOf(trial) {
+			outcomes.Corrected++
+		}
+	}
+}
+
+// outcomesOf returns the outcomes the request counts for, one per experiment it is in; r.Mu must be held
+func (r *Registry) outcomesOf(trial *Trial) []*Outcomes {
+	var outcomes []*Outcomes
+	for name, id := range trial.Arms {
+		if experiment := r.experiment(id); experiment != nil {
+			if o, exists := experiment.Results[trial.Versions[name]]; exists {
+				outcomes = append(outcomes, o)
+			}
+		}
+	}
+	return outcomes
+}
+
+// Compensate returns the event undoing a switch of version or the start or stop of an experiment
+func (r *Registry) Compensate(event eventsourcing.Event) ([]eventsourcing.Event, error) {
+	switch e := event.(type) {
+	case *PromptActivatedEvent:
+		return []eventsourcing.Event{&PromptActivatedEvent{Name: e.Name, Version: e.Previous, Previous: e.Version, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+	case *ExperimentStartedEvent:
+		return []eventsourcing.Event{&ExperimentStoppedEvent{ExperimentID: e.ExperimentID, Name: e.Name, Versions: e.Versions, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+	case *ExperimentStoppedEvent:
+		return []eventsourcing.Event{&ExperimentStartedEvent{ExperimentID: e.ExperimentID, Name: e.Name, Versions: e.Versions, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+	}
+	return nil, nil
+}
+
+// PromptFor returns the text of the named prompt a request is made with: the version it was assigned in an
+// experiment, else the active version; builtin for version 0
+func (r *Registry) PromptFor(requestID, name, builtin string) string {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	prompt, exists := r.Prompts[name]
+	if !exists {
+		return builtin
+	}
+	version := prompt.Active
+	if trial, exists := r.Trials[requestID]; exists {
+		if assigned, exists := trial.Versions[name]; exists {
+			version = assigned
+		}
+	}
+	if version < 1 || version > len(prompt.Versions) {
+		return builtin
+	}
+	return prompt.Versions[version-1].Text
+}
+
+// builtin returns the built-in text of the named prompt, an error if there is no such prompt
+func (r *Registry) builtin(name string) (string, error) {
+	if name == orchestration.SystemPromptName {
+		return orchestration.DefaultSystemPrompt, nil
+	}
+	plugin, err := r.plugins.GetPlugin(name)
+	if err != nil || plugin == nil {
+		return "", fmt.Errorf("there is no prompt %s, name the system prompt %q or a plugin", name, orchestration.SystemPromptName)
+	}
+	return plugin.SystemPrompt(), nil
+}
+
+// ownerOnly refuses commands of household members, the prompts are the same for everyone
+func ownerOnly(data map[string]interface{}) error {
+	if eventsourcing.UserOf(data) != "" {
+		return fmt.Errorf("only the owner changes the prompts")
+	}
+	return nil
+}
+
+// versionOf returns the version in the input, decoded from JSON as a number
+func versionOf(value interface{}) (int, bool) {
+	number, ok := value.(float64)
+	if !ok || number != float64(int(number)) {
+		return 0, false
+	}
+	return int(number), true
+}
+
+// AddPromptVersionCommand adds a version of a prompt, e.g. {"name": "system", "text": "You are MindPalace...",
+// "note": "shorter answers"}. It is used once activated or compared in an experiment.
+func (r *Registry) AddPromptVersionCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if err := ownerOnly(data); err != nil {
+		return nil, err
+	}
+	name, _ := data["name"].(string)
+	text, _ := data["text"].(string)
+	note, _ := data["note"].(string)
+	text = strings.TrimSpace(text)
+	if name == "" || text == "" {
+		return nil, fmt.Errorf("name and text are required")
+	}
+	builtin, err := r.builtin(name)
+	if err != nil {
+		return nil, err
+	}
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	versions := []Version{{Text: builtin}}
+	if prompt, exists := r.Prompts[name]; exists {
+		versions = append(versions, prompt.Versions...)
+	}
+	for _, version := range versions {
+		if strings.TrimSpace(version.Text) == text {
+			return nil, fmt.Errorf("version %d of %s has this text already", version.Version, name)
+		}
+	}
+	return []eventsourcing.Event{&PromptVersionAddedEvent{
+		Name:      name,
+		Version:   len(versions),
+		Text:      text,
+		Note:      strings.TrimSpace(note),
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// ActivatePromptCommand makes the requests with a version of a prompt, e.g. {"name": "taskmanager",
+// "version": 2}; version 0 is the built-in prompt
+func (r *Registry) ActivatePromptCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if err := ownerOnly(data); err != nil {
+		return nil, err
+	}
+	name, _ := data["name"].(string)
+	version, ok := versionOf(data["version"])
+	if !ok {
+		return nil, fmt.Errorf("version must be a number")
+	}
+	if _, err := r.builtin(name); err != nil {
+		return nil, err
+	}
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	active, count := 0, 0
+	if prompt, exists := r.Prompts[name]; exists {
+		active, count = prompt.Active, len(prompt.Versions)
+	}
+	if version < 0 || version > count {
+		return nil, fmt.Errorf("%s has no version %d", name, version)
+	}
+	if version == active {
+		return nil, fmt.Errorf("version %d of %s is active already", version, name)
+	}
+	return []eventsourcing.Event{&PromptActivatedEvent{Name: name, Version: version, Previous: active, Timestamp: eventsourcing.ISOTimestamp()}}, nil
+}
+
+// StartPromptExperimentCommand compares versions of a prompt, each request being assigned one of them, e.g.
+// {"name": "system", "versions": [0, 2]}
+func (r *Registry) StartPromptExperimentCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if err := ownerOnly(data); err != nil {
+		return nil, err
+	}
+	name, _ := data["name"].(string)
+	values, _ := data["versions"].([]interface{})
+	if _, err := r.builtin(name); err != nil {
+		return nil, err
+	}
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	count := 0
+	if prompt, exists := r.Prompts[name]; exists {
+		count = len(prompt.Versions)
+	}
+	var versions []int
+	for _, value := range values {
+		version, ok := versionOf(value)
+		if !ok || version < 0 || version > count {
+			return nil, fmt.Errorf("%s has no version %v", name, value)
+		}
+		if !slices.Contains(versions, version) {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) < 2 {
+		return nil, fmt.Errorf("an experiment compares at least two versions of %s", name)
+	}
+	if experiment := r.running(name); experiment != nil {
+		return nil, fmt.Errorf("an experiment on %s is running already, stop it first", name)
+	}
+	return []eventsourcing.Event{&ExperimentStartedEvent{
+		ExperimentID: fmt.Sprintf("experiment_%d", eventsourcing.GenerateUniqueID()),
+		Name:         name,
+		Versions:     versions,
+		Timestamp:    eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// StopPromptExperimentCommand stops the experiment on a prompt, e.g. {"name": "system"}; its results are kept
+func (r *Registry) StopPromptExperimentCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if err := ownerOnly(data); err != nil {
+		return nil, err
+	}
+	name, _ := data["name"].(string)
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	experiment := r.running(name)
+	if experiment == nil {
+		return nil, fmt.Errorf("no experiment on %s is running", name)
+	}
+	return []eventsourcing.Event{&ExperimentStoppedEvent{
+		ExperimentID: experiment.ID,
+		Name:         name,
+		Versions:     experiment.Versions,
+		Timestamp:    eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// ListPromptsCommand lists the prompts with versions added, with the built-in prompt as version 0
+func (r *Registry) ListPromptsCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	prompts := []Prompt{}
+	for _, prompt := range r.prompts() {
+		builtin, _ := r.builtin(prompt.Name)
+		prompt.Versions = append([]Version{{Text: builtin}}, prompt.Versions...)
+		prompts = append(prompts, prompt)
+	}
+	return []eventsourcing.Event{&PromptsListedEvent{Prompts: prompts}}, nil
+}
+
+// ShowPromptExperimentCommand reports the outcomes of the last experiment on a prompt, e.g. {"name": "system"}
+func (r *Registry) ShowPromptExperimentCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	name, _ := data["name"].(string)
+	experiment, exists := r.lastExperiment(name)
+	if !exists {
+		return nil, fmt.Errorf("there has been no experiment on %s", name)
+	}
+	return []eventsourcing.Event{&ExperimentReportedEvent{Experiment: experiment, Summary: describe(experiment)}}, nil
+}
+
+// prompts returns copies of the prompts with versions, in the order of their names
+func (r *Registry) prompts() []Prompt {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	prompts := make([]Prompt, 0, len(r.Prompts))
+	for _, prompt := range r.Prompts {
+		copied := *prompt
+		copied.Versions = slices.Clone(prompt.Versions)
+		prompts = append(prompts, copied)
+	}
+	sort.Slice(prompts, func(i, j int) bool { return prompts[i].Name < prompts[j].Name })
+	return prompts
+}
+
+// lastExperiment returns a copy of the last experiment on the named prompt, all prompts if name is empty
+func (r *Registry) lastExperiment(name string) (Experiment, bool) {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	for i := len(r.Experiments) - 1; i >= 0; i-- {
+		experiment := r.Experiments[i]
+		if name != "" && experiment.Name != name {
+			continue
+		}
+		copied := *experiment
+		copied.Results = make(map[int]*Outcomes, len(experiment.Results))
+		for version, outcomes := range experiment.Results {
+			o := *outcomes
+			copied.Results[version] = &o
+		}
+		return copied, true
+	}
+	return Experiment{}, false
+}
+
+// describe summarizes the outcomes of each version of an experiment
+func describe(experiment Experiment) string {
+	state := "stopped"
+	if experiment.Running {
+		state = "running"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Experiment on %s, %s since %s:", experiment.Name, state, experiment.StartedAt)
+	for _, version := range experiment.Versions {
+		o := experiment.Results[version]
+		if o == nil {
+			o = &Outcomes{}
+		}
+		fmt.Fprintf(&sb, "\nVersion %d: %d requests, %.0f%% succeeded, %.0f%% corrected", version, o.Requests, 100*o.SuccessRate(), 100*o.CorrectionRate())
+	}
+	return sb.String()
+}
+
+// GetCustomUI lists the prompts' versions and the outcomes of the last experiment
+func (r *Registry) GetCustomUI() fyne.CanvasObject {
+	items := container.NewVBox()
+	prompts := r.prompts()
+	if len(prompts) == 0 {
+		items.Add(widget.NewLabel("All prompts are built in"))
+	}
+	for _, prompt := range prompts {
+		label := widget.NewLabel(prompt.Name)
+		label.TextStyle = fyne.TextStyle{Bold: true}
+		items.Add(label)
+		for _, version := range append([]Version{{Note: "built in"}}, prompt.Versions...) {
+			line := fmt.Sprintf("Version %d", version.Version)
+			if version.Note != "" {
+				line += ": " + version.Note
+			}
+			if version.Version == prompt.Active {
+				line += " (active)"
+			}
+			items.Add(widget.NewLabel(line))
+		}
+	}
+	if experiment, exists := r.lastExperiment(""); exists {
+		items.Add(widget.NewLabel(describe(experiment)))
+	}
+	return container.NewVScroll(items)
+}
+
+// SaveSnapshot serializes the prompts, the experiments and the requests in experiments
+func (r *Registry) SaveSnapshot() ([]byte, error) {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	return json.Marshal(snapshot{Prompts: r.Prompts, Experiments: r.Experiments, Trials: r.Trials})
+}
+
+// LoadSnapshot replaces the registry's state with the snapshot
+func (r *Registry) LoadSnapshot(data []byte) error {
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s.Prompts == nil {
+		s.Prompts = make(map[string]*Prompt)
+	}
+	if s.Trials == nil {
+		s.Trials = make(map[string]*Trial)
+	}
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	r.Prompts, r.Experiments, r.Trials = s.Prompts, s.Experiments, s.Trials
+	return nil
+}
+
+type snapshot struct {
+	Prompts     map[string]*Prompt `json:"prompts"`
+	Experiments []*Experiment      `json:"experiments"`
+	Trials      map[string]*Trial  `json:"trials"`
+}
@@ -0,0 +1,187 @@
+package prompts
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"mindpalace/internal/feedback"
+	"mindpalace/internal/orchestration"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/eventsourcing/eventsourcingtest"
+)
+
+// agentPlugin is a plugin with a built-in prompt for its agent
+type agentPlugin struct{ name string }
+
+func (p *agentPlugin) Name() string                                         { return p.name }
+func (p *agentPlugin) Type() eventsourcing.PluginType                       { return eventsourcing.LLMPlugin }
+func (p *agentPlugin) EventHandlers() map[string]eventsourcing.EventHandler { return nil }
+func (p *agentPlugin) Commands() map[string]eventsourcing.CommandHandler    { return nil }
+func (p *agentPlugin) Schemas() map[string]eventsourcing.CommandInput       { return nil }
+func (p *agentPlugin) Aggregate() eventsourcing.Aggregate                   { return nil }
+func (p *agentPlugin) SystemPrompt() string                                 { return "You manage tasks." }
+func (p *agentPlugin) AgentModel() string                                   { return "" }
+
+type plugins map[string]eventsourcing.Plugin
+
+func (p plugins) GetPlugin(name string) (eventsourcing.Plugin, error) {
+	if plugin, ok := p[name]; ok {
+		return plugin, nil
+	}
+	return nil, fmt.Errorf("plugin '%s' not found", name)
+}
+
+func newTestRegistry() *Registry {
+	return NewRegistry(plugins{"taskmanager": &agentPlugin{name: "taskmanager"}})
+}
+
+// request applies the events of a request made through the orchestrator, revising another if revises is set
+func request(t *testing.T, r *Registry, requestID, revises string, failed bool) {
+	t.Helper()
+	eventsourcingtest.Apply(t, r, "", &orchestration.UserRequestReceivedEvent{RequestID: requestID, Revises: revises})
+	if failed {
+		eventsourcingtest.Apply(t, r, "",
+			&orchestration.ToolCallFailedEvent{RequestID: requestID, WillRetry: true},
+			&orchestration.ToolCallFailedEvent{RequestID: requestID},
+		)
+	}
+	eventsourcingtest.Apply(t, r, "", &orchestration.RequestCompletedEvent{RequestID: requestID})
+}
+
+func TestRegistry_ActivatesVersions(t *testing.T) {
+	r := newTestRegistry()
+	if got := r.PromptFor("r1", "taskmanager", "You manage tasks."); got != "You manage tasks." {
+		t.Fatalf("Expected the built-in prompt without versions, got %q", got)
+	}
+
+	eventsourcingtest.Execute(t, r, "", r.AddPromptVersionCommand, map[string]interface{}{"name": "taskmanager", "text": "You manage tasks, briefly.", "note": "shorter"})
+	if got := r.PromptFor("r1", "taskmanager", "You manage tasks."); got != "You manage tasks." {
+		t.Errorf("Expected a version to be used once activated, got %q", got)
+	}
+	activated := eventsourcingtest.Execute(t, r, "", r.ActivatePromptCommand, map[string]interface{}{"name": "taskmanager", "version": float64(1)})
+	if got := r.PromptFor("r1", "taskmanager", "You manage tasks."); got != "You manage tasks, briefly." {
+		t.Errorf("Expected the active version, got %q", got)
+	}
+
+	undo, _ := r.Compensate(activated[0])
+	r.ApplyEvent(undo[0])
+	if got := r.PromptFor("r1", "taskmanager", "You manage tasks."); got != "You manage tasks." {
+		t.Errorf("Expected undoing the switch to restore the built-in prompt, got %q", got)
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"name": "taskmanager", "text": "You manage tasks."},                    // Same as the built-in prompt
+		{"name": "calendar", "text": "You manage the calendar."},                // No such plugin
+		{"name": "system", "text": "You are terse.", "userID": "household_bob"}, // Not the owner
+	} {
+		if _, err := r.AddPromptVersionCommand(data); err == nil {
+			t.Errorf("Expected adding %v to fail", data)
+		}
+	}
+	if _, err := r.ActivatePromptCommand(map[string]interface{}{"name": "taskmanager", "version": float64(2)}); err == nil {
+		t.Error("Expected activating a version that does not exist to fail")
+	}
+}
+
+func TestRegistry_Experiment(t *testing.T) {
+	r := newTestRegistry()
+	eventsourcingtest.Execute(t, r, "", r.AddPromptVersionCommand, map[string]interface{}{"name": orchestration.SystemPromptName, "text": "You are MindPalace. Answer in one sentence."})
+	if _, err := r.StartPromptExperimentCommand(map[string]interface{}{"name": "system", "versions": []interface{}{float64(1), float64(1)}}); err == nil {
+		t.Error("Expected an experiment on a single version to fail")
+	}
+	eventsourcingtest.Execute(t, r, "", r.StartPromptExperimentCommand, map[string]interface{}{"name": "system", "versions": []interface{}{float64(0), float64(1)}})
+	if _, err := r.StartPromptExperimentCommand(map[string]interface{}{"name": "system", "versions": []interface{}{float64(0), float64(1)}}); err == nil {
+		t.Error("Expected a second experiment on the prompt to fail while one runs")
+	}
+
+	for i := 0; i < 20; i++ {
+		request(t, r, fmt.Sprintf("r%d", i), "", i%5 == 0)
+	}
+	request(t, r, "r20", "r1", false) // Corrects r1
+	eventsourcingtest.Apply(t, r, "",
+		&orchestration.ActionUndoneEvent{UndoneRequestID: "r2"},
+		&orchestration.ActionUndoneEvent{UndoneRequestID: "r2"},
+		&feedback.FeedbackGivenEvent{Feedback: feedback.Feedback{RequestID: "r3", Rating: feedback.Down}},
+		&feedback.FeedbackGivenEvent{Feedback: feedback.Feedback{RequestID: "r4", Rating: feedback.Up}},
+	)
+
+	assigned := map[int]int{}
+	for i := 0; i <= 20; i++ {
+		text := r.PromptFor(fmt.Sprintf("r%d", i), "system", orchestration.DefaultSystemPrompt)
+		version := r.Trials[fmt.Sprintf("r%d", i)].Versions["system"]
+		if (version == 0) != (text == orchestration.DefaultSystemPrompt) {
+			t.Errorf("Expected request r%d to be made with version %d, got %q", i, version, text)
+		}
+		assigned[version]++
+	}
+	if assigned[0] == 0 || assigned[1] == 0 {
+		t.Errorf("Expected requests assigned both versions, got %v", assigned)
+	}
+
+	// Replaying the requests assigns the same versions
+	replayed := newTestRegistry()
+	eventsourcingtest.Apply(t, replayed, "",
+		&PromptVersionAddedEvent{Name: "system", Version: 1, Text: "You are MindPalace. Answer in one sentence."},
+		&ExperimentStartedEvent{ExperimentID: r.Experiments[0].ID, Name: "system", Versions: []int{0, 1}},
+	)
+	for i := 0; i <= 20; i++ {
+		eventsourcingtest.Apply(t, replayed, "", &orchestration.UserRequestReceivedEvent{RequestID: fmt.Sprintf("r%d", i)})
+		if a, b := r.Trials[fmt.Sprintf("r%d", i)].Versions["system"], replayed.Trials[fmt.Sprintf("r%d", i)].Versions["system"]; a != b {
+			t.Errorf("Expected r%d to be assigned version %d on replay, got %d", i, a, b)
+		}
+	}
+
+	total := Outcomes{}
+	for _, o := range r.Experiments[0].Results {
+		total.Requests += o.Requests
+		total.Succeeded += o.Succeeded
+		total.Corrected += o.Corrected
+	}
+	if total != (Outcomes{Requests: 21, Succeeded: 17, Corrected: 3}) {
+		t.Errorf("Unexpected outcomes %+v", total)
+	}
+
+	events, err := r.ShowPromptExperimentCommand(map[string]interface{}{"name": "system"})
+	if err != nil {
+		t.Fatalf("ShowPromptExperiment failed: %v", err)
+	}
+	summary := events[0].(*ExperimentReportedEvent).Summary
+	if !strings.Contains(summary, "Version 0: ") || !strings.Contains(summary, "Version 1: ") || !strings.Contains(summary, "running") {
+		t.Errorf("Unexpected summary %q", summary)
+	}
+
+	eventsourcingtest.Execute(t, r, "", r.StopPromptExperimentCommand, map[string]interface{}{"name": "system"})
+	if len(r.Trials) != 0 {
+		t.Errorf("Expected the requests forgotten once the experiment stopped, got %d", len(r.Trials))
+	}
+	request(t, r, "r21", "", false)
+	if got := r.PromptFor("r21", "system", orchestration.DefaultSystemPrompt); got != orchestration.DefaultSystemPrompt {
+		t.Errorf("Expected the active version after the experiment, got %q", got)
+	}
+	if r.Experiments[0].Results[0].Requests+r.Experiments[0].Results[1].Requests != 21 {
+		t.Error("Expected the experiment's results kept after it stopped")
+	}
+}
+
+func TestRegistry_Snapshot(t *testing.T) {
+	r := newTestRegistry()
+	eventsourcingtest.Execute(t, r, "", r.AddPromptVersionCommand, map[string]interface{}{"name": "taskmanager", "text": "You manage tasks, briefly."})
+	eventsourcingtest.Execute(t, r, "", r.StartPromptExperimentCommand, map[string]interface{}{"name": "taskmanager", "versions": []interface{}{float64(0), float64(1)}})
+	request(t, r, "r1", "", false)
+
+	data, err := r.SaveSnapshot()
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	restored := newTestRegistry()
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if got, want := restored.PromptFor("r1", "taskmanager", "You manage tasks."), r.PromptFor("r1", "taskmanager", "You manage tasks."); got != want {
+		t.Errorf("Expected r1's prompt %q after restoring, got %q", want, got)
+	}
+	if restored.Experiments[0].Results[restored.Trials["r1"].Versions["taskmanager"]].Requests != 1 {
+		t.Errorf("Expected the outcomes restored, got %+v", restored.Experiments[0].Results)
+	}
+}
@@ -0,0 +1,192 @@
+// Package reminders watches deadlines exposed by aggregates and emits ReminderDue events ahead of them.
+package reminders
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/ui3d"
+)
+
+// DefaultLeadTimes remind a day, an hour and ten minutes before a deadline
+var DefaultLeadTimes = []time.Duration{24 * time.Hour, time.Hour, 10 * time.Minute}
+
+// ReminderDueEvent is emitted when a deadline is within one of the configured lead times
+type ReminderDueEvent struct {
+	eventsourcing.EventMetadata
+	EventType   string `json:"event_type"`
+	ReminderID  string `json:"reminder_id"`
+	AggregateID string `json:"aggregate_id"`
+	ItemID      string `json:"item_id"`
+	NodeID      string `json:"node_id,omitempty"`
+	Title       string `json:"title"`
+	Due         string `json:"due"`
+	Lead        string `json:"lead"`
+	Timestamp   string `json:"timestamp"`
+}
+
+func (e *ReminderDueEvent) Type() string { return "reminders_ReminderDue" }
+func (e *ReminderDueEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ReminderDueEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("reminders_ReminderDue", func() eventsourcing.Event { return &ReminderDueEvent{} })
+}
+
+// Reminder is a reminder that has been sent
+type Reminder struct {
+	ReminderID  string
+	AggregateID string
+	ItemID      string
+	NodeID      string
+	Title       string
+	Due         time.Time
+	Lead        string
+	SentAt      string
+}
+
+// ReminderAggregate remembers which reminders were sent so they are not repeated after a restart
+type ReminderAggregate struct {
+	Reminders map[string]*Reminder
+	Mu        sync.RWMutex
+}
+
+// NewReminderAggregate creates an empty ReminderAggregate
+func NewReminderAggregate() *ReminderAggregate {
+	return &ReminderAggregate{Reminders: make(map[string]*Reminder)}
+}
+
+// ID returns the aggregate's identifier
+func (a *ReminderAggregate) ID() string {
+	return "reminders"
+}
+
+// ApplyEvent records sent reminders
+func (a *ReminderAggregate) ApplyEvent(event eventsourcing.Event) error {
+	e, ok := event.(*ReminderDueEvent)
+	if !ok {
+		return nil
+	}
+	due, err := time.Parse(time.RFC3339, e.Due)
+	if err != nil {
+		return fmt.Errorf("invalid due time %q: %v", e.Due, err)
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	a.Reminders[e.ReminderID] = &Reminder{
+		ReminderID:  e.ReminderID,
+		AggregateID: e.AggregateID,
+		ItemID:      e.ItemID,
+		NodeID:      e.NodeID,
+		Title:       e.Title,
+		Due:         due,
+		Lead:        e.Lead,
+		SentAt:      e.Timestamp,
+	}
+	return nil
+}
+
+// Sent reports whether a reminder was already emitted
+func (a *ReminderAggregate) Sent(reminderID string) bool {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	_, exists := a.Reminders[reminderID]
+	return exists
+}
+
+// upcoming returns the sent reminders whose deadline has not passed yet, soonest first
+func (a *ReminderAggregate) upcoming(now time.Time) []*Reminder {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	var reminders []*Reminder
+	for _, r := range a.Reminders {
+		if r.Due.After(now) {
+			reminders = append(reminders, r)
+		}
+	}
+	sort.Slice(reminders, func(i, j int) bool { return reminders[i].Due.Before(reminders[j].Due) })
+	return reminders
+}
+
+// GetCustomUI lists the upcoming deadlines the user was reminded of
+func (a *ReminderAggregate) GetCustomUI() fyne.CanvasObject {
+	reminders := a.upcoming(time.Now())
+	if len(reminders) == 0 {
+		return widget.NewLabel("No upcoming reminders")
+	}
+	items := container.NewVBox()
+	for _, r := range reminders {
+		items.Add(widget.NewLabel(fmt.Sprintf("%s - due %s", r.Title, r.Due.Local().Format("Mon Jan 2 15:04"))))
+	}
+	return container.NewVScroll(items)
+}
+
+// Broadcast3DDelta highlights the reminded item and shows a reminder label above the zone of its aggregate
+func (a *ReminderAggregate) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
+	e, ok := event.(*ReminderDueEvent)
+	if !ok {
+		return nil
+	}
+	due, err := time.Parse(time.RFC3339, e.Due)
+	if err != nil {
+		return nil
+	}
+	return a.reminderActions(&Reminder{
+		ReminderID:  e.ReminderID,
+		AggregateID: e.AggregateID,
+		ItemID:      e.ItemID,
+		NodeID:      e.NodeID,
+		Title:       e.Title,
+		Due:         due,
+		Lead:        e.Lead,
+	}, 0)
+}
+
+// GetFull3DState shows all reminders of deadlines that have not passed yet
+func (a *ReminderAggregate) GetFull3DState() []eventsourcing.DeltaAction {
+	var actions []eventsourcing.DeltaAction
+	for i, r := range a.upcoming(time.Now()) {
+		actions = append(actions, a.reminderActions(r, i)...)
+	}
+	return actions
+}
+
+func (a *ReminderAggregate) reminderActions(r *Reminder, index int) []eventsourcing.DeltaAction {
+	theme := ui3d.CurrentTheme()
+	theme.Text = []float64{1.0, 0.2, 0.2, 1.0} // Red
+	label := ui3d.CreateLabel(
+		fmt.Sprintf("reminder_%s_%s_label", r.AggregateID, r.ItemID),
+		fmt.Sprintf("Reminder: %s due %s", r.Title, r.Due.Local().Format("Mon 15:04")),
+		[]float64{0, 6 + float64(index)*0.6, 0},
+		theme,
+	)
+	label.Properties["event_type"] = "reminder_due"
+	label.Properties["display_info"] = map[string]interface{}{
+		"title":       "Reminder",
+		"description": r.Title,
+		"details":     map[string]interface{}{"due": r.Due.Format(time.RFC3339), "lead": r.Lead},
+	}
+	actions := []eventsourcing.DeltaAction{label}
+	if r.NodeID != "" {
+		actions = append(actions, eventsourcing.DeltaAction{
+			Type:   "update",
+			NodeID: r.NodeID,
+			Properties: map[string]interface{}{
+				"color": theme.Text,
+				"scale": []float64{1.3, 1.3, 1.3},
+			},
+		})
+	}
+	return actions
+}
@@ -0,0 +1,154 @@
+package reminders
+
+import (
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Mock implementations for testing
+
+type deadlineAggregate struct {
+	deadlines []eventsourcing.Deadline
+}
+
+func (a *deadlineAggregate) ID() string                                 { return "tasks" }
+func (a *deadlineAggregate) ApplyEvent(event eventsourcing.Event) error { return nil }
+func (a *deadlineAggregate) GetCustomUI() fyne.CanvasObject             { return nil }
+func (a *deadlineAggregate) Deadlines() []eventsourcing.Deadline        { return a.deadlines }
+
+type aggregates []eventsourcing.Aggregate
+
+func (a aggregates) AllAggregates() []eventsourcing.Aggregate { return a }
+
+// userAggregates adds the aggregates of household members to the owner's
+type userAggregates struct {
+	aggregates
+	users map[string][]eventsourcing.Aggregate
+}
+
+func (a userAggregates) AggregatesOf(userID string) []eventsourcing.Aggregate {
+	return append(a.users[userID], a.aggregates...)
+}
+func (a userAggregates) UserAggregates(userID string) []eventsourcing.Aggregate {
+	return a.users[userID]
+}
+func (a userAggregates) Users() []string {
+	var users []string
+	for userID := range a.users {
+		users = append(users, userID)
+	}
+	return users
+}
+
+// mockBus applies published events to the reminder aggregate like the real bus does
+type mockBus struct {
+	reminders *ReminderAggregate
+	published []*ReminderDueEvent
+}
+
+func (b *mockBus) Publish(event eventsourcing.Event) {
+	b.reminders.ApplyEvent(event)
+	b.published = append(b.published, event.(*ReminderDueEvent))
+}
+func (b *mockBus) Subscribe(eventType string, handler eventsourcing.EventHandler) {}
+func (b *mockBus) SubscribeAll(handler eventsourcing.EventHandler)                {}
+
+func TestScheduler_Check(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	source := &deadlineAggregate{deadlines: []eventsourcing.Deadline{
+		{ID: "soon", Title: "Soon", Due: now.Add(30 * time.Minute), NodeID: "soon"},
+		{ID: "later", Title: "Later", Due: now.Add(48 * time.Hour)},
+		{ID: "past", Title: "Past", Due: now.Add(-time.Hour)},
+	}}
+	reminderAgg := NewReminderAggregate()
+	bus := &mockBus{reminders: reminderAgg}
+	scheduler := NewScheduler(aggregates{source, reminderAgg}, reminderAgg, bus, []time.Duration{10 * time.Minute, 24 * time.Hour, time.Hour})
+
+	if sent := scheduler.Check(now); sent != 1 {
+		t.Fatalf("Expected 1 reminder, got %d", sent)
+	}
+	if e := bus.published[0]; e.ItemID != "soon" || e.Lead != "1h0m0s" || e.NodeID != "soon" {
+		t.Errorf("Unexpected reminder: %+v", e)
+	}
+
+	// Reminders are not repeated within the same lead time
+	if sent := scheduler.Check(now.Add(5 * time.Minute)); sent != 0 {
+		t.Errorf("Expected no repeated reminder, got %d", sent)
+	}
+
+	// The next lead time reminds again
+	if sent := scheduler.Check(now.Add(25 * time.Minute)); sent != 1 || bus.published[1].Lead != "10m0s" {
+		t.Errorf("Expected a 10m reminder, got %d: %+v", sent, bus.published)
+	}
+
+	// A moved deadline is a new deadline
+	source.deadlines[0].Due = now.Add(50 * time.Minute)
+	if sent := scheduler.Check(now.Add(25 * time.Minute)); sent != 1 {
+		t.Errorf("Expected a reminder for the moved deadline, got %d", sent)
+	}
+}
+
+func TestScheduler_CheckUsers(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	due := []eventsourcing.Deadline{{ID: "task1", Title: "Soon", Due: now.Add(30 * time.Minute)}}
+	reminderAgg := NewReminderAggregate()
+	bus := &mockBus{reminders: reminderAgg}
+	source := userAggregates{
+		aggregates: aggregates{&deadlineAggregate{deadlines: due}, reminderAgg},
+		users:      map[string][]eventsourcing.Aggregate{"alice": {&deadlineAggregate{deadlines: due}}},
+	}
+	scheduler := NewScheduler(source, reminderAgg, bus, []time.Duration{time.Hour})
+
+	// The owner's and alice's tasks with the same ID are reminded of apart, each to its user
+	if sent := scheduler.Check(now); sent != 2 {
+		t.Fatalf("Expected 2 reminders, got %d", sent)
+	}
+	if bus.published[0].UserID != "" || bus.published[1].UserID != "alice" || bus.published[0].ReminderID == bus.published[1].ReminderID {
+		t.Errorf("Expected a reminder for the owner and one for alice, got %+v", bus.published)
+	}
+}
+
+func TestReminderAggregate_RebuiltFromEvents(t *testing.T) {
+	event := &ReminderDueEvent{ReminderID: "r1", ItemID: "task1", Title: "Task", Due: "2024-05-01T12:00:00Z", Lead: "1h0m0s"}
+	data, err := event.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	restored, err := eventsourcing.UnmarshalEvent(data)
+	if err != nil {
+		t.Fatalf("UnmarshalEvent failed: %v", err)
+	}
+
+	agg := NewReminderAggregate()
+	if err := agg.ApplyEvent(restored); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+	if !agg.Sent("r1") {
+		t.Error("Expected reminder to be recorded as sent")
+	}
+	if len(agg.upcoming(time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC))) != 1 {
+		t.Error("Expected reminder to be upcoming before its due time")
+	}
+	if len(agg.upcoming(time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC))) != 0 {
+		t.Error("Expected no upcoming reminder after its due time")
+	}
+}
+
+func TestParseLeadTimes(t *testing.T) {
+	leads, err := ParseLeadTimes("24h, 1h,10m")
+	if err != nil {
+		t.Fatalf("ParseLeadTimes failed: %v", err)
+	}
+	if len(leads) != 3 || leads[1] != time.Hour {
+		t.Errorf("Unexpected lead times: %v", leads)
+	}
+	if leads, _ := ParseLeadTimes(""); len(leads) != 0 {
+		t.Errorf("Expected no lead times, got %v", leads)
+	}
+	if _, err := ParseLeadTimes("soon"); err == nil {
+		t.Error("Expected error for invalid lead time")
+	}
+}
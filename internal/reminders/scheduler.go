@@ -0,0 +1,144 @@
+package reminders
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// AggregateSource gives the scheduler access to the aggregates it watches
+type AggregateSource interface {
+	AllAggregates() []eventsourcing.Aggregate
+}
+
+// Scheduler periodically checks the deadlines of all DeadlineProvider aggregates and
+// publishes a ReminderDueEvent when a deadline comes within one of the lead times. The deadlines
+// of household members are reminded of to the member they belong to.
+type Scheduler struct {
+	aggregates AggregateSource
+	reminders  *ReminderAggregate
+	eventBus   eventsourcing.EventBus
+	leadTimes  []time.Duration // Sorted from longest to shortest
+	interval   time.Duration
+	stop       chan struct{}
+}
+
+// NewScheduler creates a scheduler reminding at the given lead times before each deadline
+func NewScheduler(aggregates AggregateSource, reminders *ReminderAggregate, eventBus eventsourcing.EventBus, leadTimes []time.Duration) *Scheduler {
+	leads := append([]time.Duration{}, leadTimes...)
+	sort.Slice(leads, func(i, j int) bool { return leads[i] > leads[j] })
+	return &Scheduler{
+		aggregates: aggregates,
+		reminders:  reminders,
+		eventBus:   eventBus,
+		leadTimes:  leads,
+		interval:   time.Minute,
+		stop:       make(chan struct{}),
+	}
+}
+
+// Start checks deadlines every minute until Stop is called
+func (s *Scheduler) Start() {
+	logging.Info("Starting reminder scheduler with lead times %v", s.leadTimes)
+	ticker := time.NewTicker(s.interval)
+	go func() {
+		defer ticker.Stop()
+		s.Check(time.Now())
+		for {
+			select {
+			case <-s.stop:
+				return
+			case now := <-ticker.C:
+				s.Check(now)
+			}
+		}
+	}()
+}
+
+// Stop ends the periodic checks
+func (s *Scheduler) Stop() {
+	close(s.stop)
+}
+
+// Check publishes the reminders that are due at the given time and returns how many were sent.
+// Only the shortest lead time that has been reached is reminded of, so after a long downtime a
+// deadline results in one reminder instead of one per lead time.
+func (s *Scheduler) Check(now time.Time) int {
+	sent := s.check(now, "", s.aggregates.AllAggregates())
+	if users, ok := s.aggregates.(eventsourcing.UserAggregateStore); ok {
+		for _, userID := range users.Users() {
+			sent += s.check(now, userID, users.UserAggregates(userID))
+		}
+	}
+	return sent
+}
+
+// check publishes the reminders due for the deadlines of a user's aggregates
+func (s *Scheduler) check(now time.Time, userID string, aggregates []eventsourcing.Aggregate) int {
+	sent := 0
+	for _, agg := range aggregates {
+		provider, ok := agg.(eventsourcing.DeadlineProvider)
+		if !ok {
+			continue
+		}
+		for _, deadline := range provider.Deadlines() {
+			lead, ok := s.currentLead(deadline.Due, now)
+			if !ok {
+				continue
+			}
+			reminderID := fmt.Sprintf("%s_%s_%d_%s", eventsourcing.SnapshotID(userID, agg.ID()), deadline.ID, deadline.Due.Unix(), lead)
+			if s.reminders.Sent(reminderID) {
+				continue
+			}
+			logging.Info("Reminder due for %s %s: %s", eventsourcing.SnapshotID(userID, agg.ID()), deadline.ID, deadline.Title)
+			event := &ReminderDueEvent{
+				ReminderID:  reminderID,
+				AggregateID: agg.ID(),
+				ItemID:      deadline.ID,
+				NodeID:      deadline.NodeID,
+				Title:       deadline.Title,
+				Due:         deadline.Due.UTC().Format(time.RFC3339),
+				Lead:        lead.String(),
+				Timestamp:   eventsourcing.ISOTimestamp(),
+			}
+			event.Metadata().UserID = userID
+			s.eventBus.Publish(event)
+			sent++
+		}
+	}
+	return sent
+}
+
+// currentLead returns the shortest lead time reached for a deadline that has not passed yet
+func (s *Scheduler) currentLead(due, now time.Time) (time.Duration, bool) {
+	if due.IsZero() || !now.Before(due) {
+		return 0, false
+	}
+	for i := len(s.leadTimes) - 1; i >= 0; i-- {
+		if !now.Before(due.Add(-s.leadTimes[i])) {
+			return s.leadTimes[i], true
+		}
+	}
+	return 0, false
+}
+
+// ParseLeadTimes parses a comma separated list of durations such as "24h,1h,10m"
+func ParseLeadTimes(value string) ([]time.Duration, error) {
+	var leads []time.Duration
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lead, err := time.ParseDuration(part)
+		if err != nil || lead <= 0 {
+			return nil, fmt.Errorf("invalid lead time %q", part)
+		}
+		leads = append(leads, lead)
+	}
+	return leads, nil
+}
@@ -0,0 +1,352 @@
+// Package settings keeps the settings the user changes in the app: the microphone, the Whisper and LLM
+// models, the token limits, the theme and the voice responses are spoken with. They take precedence over
+// the configuration file. The microphone, the Whisper model and the theme are kept by the aggregates that
+// apply them and mirrored here, so both UIs show all settings in one place.
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/internal/audioinput"
+	"mindpalace/internal/config"
+	"mindpalace/internal/themes"
+	"mindpalace/internal/whispermodels"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/ui3d"
+)
+
+// Names of the settings
+const (
+	Microphone       = "microphone"
+	WhisperModel     = "whisper_model"
+	LLMModel         = "llm_model"
+	ContextTokens    = "context_tokens"
+	HistoryTokens    = "history_tokens"
+	ToolResultTokens = "tool_result_tokens"
+	Theme            = "theme"
+	TTSVoice         = "tts_voice"
+)
+
+// Names lists the settings in the order they are shown
+var Names = []string{Microphone, WhisperModel, LLMModel, ContextTokens, HistoryTokens, ToolResultTokens, Theme, TTSVoice}
+
+// labels are the names of the settings as the user reads them
+var labels = map[string]string{
+	Microphone:       "Microphone",
+	WhisperModel:     "Whisper model",
+	LLMModel:         "LLM model",
+	ContextTokens:    "Context tokens",
+	HistoryTokens:    "History tokens",
+	ToolResultTokens: "Tool result tokens",
+	Theme:            "Theme",
+	TTSVoice:         "Voice",
+}
+
+// Label returns the name of a setting as the user reads it
+func Label(name string) string {
+	return labels[name]
+}
+
+// commands are the commands changing the settings kept by other aggregates, with the field they take
+var commands = map[string][2]string{
+	Microphone:   {"SelectAudioDevice", "device"},
+	WhisperModel: {"SwitchWhisperModel", "model"},
+	Theme:        {"SelectTheme", "theme"},
+}
+
+// tokenLimits are the settings holding a number of tokens
+var tokenLimits = map[string]bool{ContextTokens: true, HistoryTokens: true, ToolResultTokens: true}
+
+// SettingsChangedEvent records settings the user changed, an empty value going back to the configured one
+type SettingsChangedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string            `json:"event_type"`
+	Changes   map[string]string `json:"changes"`
+	Previous  map[string]string `json:"previous"`
+	Timestamp string            `json:"timestamp"`
+}
+
+func (e *SettingsChangedEvent) Type() string { return "settings_SettingsChanged" }
+func (e *SettingsChangedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *SettingsChangedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("settings_SettingsChanged", func() eventsourcing.Event { return &SettingsChangedEvent{} })
+}
+
+// Aggregate holds the settings the user changed, by name; settings not in it are the configured ones
+type Aggregate struct {
+	Values map[string]string
+	Mu     sync.RWMutex
+}
+
+// NewAggregate creates an aggregate without settings changed
+func NewAggregate() *Aggregate {
+	return &Aggregate{Values: make(map[string]string)}
+}
+
+// ID returns the aggregate's identifier
+func (a *Aggregate) ID() string {
+	return "settings"
+}
+
+// mirrored returns the settings an event of another aggregate changed
+func mirrored(event eventsourcing.Event) map[string]string {
+	switch e := event.(type) {
+	case *audioinput.DeviceSelectedEvent:
+		return map[string]string{Microphone: e.Device}
+	case *whispermodels.ModelSwitchedEvent:
+		return map[string]string{WhisperModel: e.Model}
+	case *themes.ThemeSelectedEvent:
+		return map[string]string{Theme: e.Name}
+	}
+	return nil
+}
+
+// changes returns the settings an event changed, nil if it changed none
+func changes(event eventsourcing.Event) map[string]string {
+	if e, ok := event.(*SettingsChangedEvent); ok {
+		return e.Changes
+	}
+	return mirrored(event)
+}
+
+// ApplyEvent records changed settings, also those changed with the commands of other aggregates
+func (a *Aggregate) ApplyEvent(event eventsourcing.Event) error {
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	for name, value := range changes(event) {
+		if value == "" {
+			delete(a.Values, name)
+		} else {
+			a.Values[name] = value
+		}
+	}
+	return nil
+}
+
+// Compensate returns the event changing the settings back
+func (a *Aggregate) Compensate(event eventsourcing.Event) ([]eventsourcing.Event, error) {
+	e, ok := event.(*SettingsChangedEvent)
+	if !ok {
+		return nil, nil
+	}
+	return []eventsourcing.Event{&SettingsChangedEvent{
+		EventType: "settings_SettingsChanged",
+		Changes:   e.Previous,
+		Previous:  e.Changes,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// Value returns a setting the user changed, empty if they didn't
+func (a *Aggregate) Value(name string) string {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return a.Values[name]
+}
+
+// tokens returns a token limit the user changed, 0 if they didn't
+func (a *Aggregate) tokens(name string) int {
+	tokens, _ := strconv.Atoi(a.Values[name])
+	return tokens
+}
+
+// Override returns a copy of the configuration with the settings the user changed in place of the
+// configured ones
+func (a *Aggregate) Override(cfg *config.Config) *config.Config {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	overridden := *cfg
+	if model := a.Values[LLMModel]; model != "" {
+		overridden.Ollama.Model = model
+	}
+	if tokens := a.tokens(ContextTokens); tokens > 0 {
+		overridden.Limits.ContextTokens = tokens
+	}
+	if tokens := a.tokens(HistoryTokens); tokens > 0 {
+		overridden.Limits.HistoryTokens = tokens
+	}
+	if tokens := a.tokens(ToolResultTokens); tokens > 0 {
+		overridden.Limits.ToolResultTokens = tokens
+	}
+	return &overridden
+}
+
+// settingValue returns the value of a ChangeSettings field as stored, checking token limits are numbers
+func settingValue(name string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case float64:
+		value = strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		value = strconv.Itoa(v)
+	}
+	text, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string", name)
+	}
+	if tokenLimits[name] && text != "" {
+		tokens, err := strconv.Atoi(text)
+		if err != nil || tokens < 0 {
+			return "", fmt.Errorf("%s must be a number of tokens, got %q", name, text)
+		}
+		if tokens == 0 {
+			text = ""
+		}
+	}
+	return text, nil
+}
+
+// ChangeSettingsCommand changes the settings kept by the aggregate, e.g. {"llm_model": "llama3.1:8b",
+// "context_tokens": 16384}. An empty value goes back to the configured one; settings unchanged are left out.
+// The settings are the same for everyone in a household, only the owner changes them.
+func (a *Aggregate) ChangeSettingsCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if eventsourcing.UserOf(data) != "" {
+		return nil, fmt.Errorf("only the owner changes the settings")
+	}
+	event := &SettingsChangedEvent{
+		EventType: "settings_SettingsChanged",
+		Changes:   make(map[string]string),
+		Previous:  make(map[string]string),
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}
+	for name, value := range data {
+		if name == "userID" {
+			continue
+		}
+		if command, ok := commands[name]; ok {
+			return nil, fmt.Errorf("%s is changed with %s", name, command[0])
+		}
+		if _, ok := labels[name]; !ok {
+			return nil, fmt.Errorf("unknown setting %q", name)
+		}
+		text, err := settingValue(name, value)
+		if err != nil {
+			return nil, err
+		}
+		if previous := a.Value(name); text != previous {
+			event.Changes[name] = text
+			event.Previous[name] = previous
+		}
+	}
+	if len(event.Changes) == 0 {
+		return nil, nil
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+// Change changes settings with the commands of the aggregates keeping them: the microphone, the Whisper
+// model and the theme with their own, the others with ChangeSettings
+func Change(execute eventsourcing.CommandFunc, changes map[string]string) error {
+	own := make(map[string]interface{})
+	names := make([]string, 0, len(changes))
+	for name := range changes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		command, ok := commands[name]
+		if !ok {
+			own[name] = changes[name]
+			continue
+		}
+		if err := execute(command[0], map[string]interface{}{command[1]: changes[name]}); err != nil {
+			return fmt.Errorf("failed to change %s: %w", Label(name), err)
+		}
+	}
+	if len(own) == 0 {
+		return nil
+	}
+	return execute("ChangeSettings", own)
+}
+
+// Layout of the settings panel in the 3D world: a column of labels, one per setting below the title
+var (
+	panelPosition = []float64{-10, 5, -6}
+	rowHeight     = 0.5
+)
+
+// panelNodeID is the node of the label of a setting on the panel
+func panelNodeID(name string) string {
+	return "settings_" + name
+}
+
+// rowText shows a setting on the panel, the configured one if the user didn't change it
+func rowText(name, value string) string {
+	if value == "" {
+		value = "as configured"
+	}
+	return fmt.Sprintf("%s: %s", Label(name), value)
+}
+
+// Broadcast3DDelta updates the rows of the settings changed on the panel
+func (a *Aggregate) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
+	changed := changes(event)
+	var actions []eventsourcing.DeltaAction
+	for _, name := range Names {
+		if value, ok := changed[name]; ok {
+			actions = append(actions, eventsourcing.DeltaAction{
+				Type:       "update",
+				NodeID:     panelNodeID(name),
+				Properties: map[string]interface{}{"text": rowText(name, value)},
+			})
+		}
+	}
+	return actions
+}
+
+// GetFull3DState shows the panel with all settings
+func (a *Aggregate) GetFull3DState() []eventsourcing.DeltaAction {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	theme := ui3d.CurrentTheme()
+	actions := []eventsourcing.DeltaAction{ui3d.CreateLabel("settings_panel", "⚙ Settings", panelPosition, theme)}
+	for i, name := range Names {
+		position := []float64{panelPosition[0], panelPosition[1] - float64(i+1)*rowHeight, panelPosition[2]}
+		actions = append(actions, ui3d.CreateLabel(panelNodeID(name), rowText(name, a.Values[name]), position, theme))
+	}
+	return actions
+}
+
+// GetCustomUI lists the settings
+func (a *Aggregate) GetCustomUI() fyne.CanvasObject {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	rows := container.NewVBox()
+	for _, name := range Names {
+		rows.Add(widget.NewLabel(rowText(name, a.Values[name])))
+	}
+	return container.NewVScroll(rows)
+}
+
+// SaveSnapshot serializes the settings
+func (a *Aggregate) SaveSnapshot() ([]byte, error) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return json.Marshal(a.Values)
+}
+
+// LoadSnapshot replaces the settings with the snapshot
+func (a *Aggregate) LoadSnapshot(data []byte) error {
+	values := make(map[string]string)
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	a.Values = values
+	return nil
+}
@@ -0,0 +1,107 @@
+package settings
+
+import (
+	"reflect"
+	"testing"
+
+	"mindpalace/internal/audioinput"
+	"mindpalace/internal/config"
+	"mindpalace/internal/themes"
+	"mindpalace/pkg/eventsourcing"
+)
+
+// change runs ChangeSettings and applies its events
+func change(t *testing.T, a *Aggregate, data map[string]interface{}) []eventsourcing.Event {
+	t.Helper()
+	events, err := a.ChangeSettingsCommand(data)
+	if err != nil {
+		t.Fatalf("ChangeSettingsCommand failed: %v", err)
+	}
+	for _, event := range events {
+		if err := a.ApplyEvent(event); err != nil {
+			t.Fatalf("ApplyEvent failed: %v", err)
+		}
+	}
+	return events
+}
+
+func TestAggregate_ChangeSettings(t *testing.T) {
+	a := NewAggregate()
+	events := change(t, a, map[string]interface{}{LLMModel: "llama3.1:8b", ContextTokens: float64(16384), "userID": ""})
+	if len(events) != 1 {
+		t.Fatalf("Expected one event, got %d", len(events))
+	}
+
+	cfg := &config.Config{}
+	cfg.Ollama.Model = "qwen3:4b"
+	cfg.Limits.ContextTokens = 8192
+	cfg.Limits.HistoryTokens = 4000
+	overridden := a.Override(cfg)
+	if overridden.Ollama.Model != "llama3.1:8b" || overridden.Limits.ContextTokens != 16384 || overridden.Limits.HistoryTokens != 4000 {
+		t.Errorf("Expected the changed settings in place of the configured ones, got %+v", overridden)
+	}
+	if cfg.Ollama.Model != "qwen3:4b" {
+		t.Error("Expected the configuration itself left alone")
+	}
+
+	if events := change(t, a, map[string]interface{}{LLMModel: "llama3.1:8b"}); len(events) != 0 {
+		t.Errorf("Expected no event for a setting left as it is, got %v", events)
+	}
+	for name, data := range map[string]map[string]interface{}{
+		"token limit not a number": {HistoryTokens: "many"},
+		"unknown setting":          {"volume": "11"},
+		"theme":                    {Theme: "light"},
+	} {
+		if _, err := a.ChangeSettingsCommand(data); err == nil {
+			t.Errorf("Expected %s refused", name)
+		}
+	}
+
+	// Undoing goes back to the configured model
+	undo, _ := a.Compensate(events[0])
+	if err := a.ApplyEvent(undo[0]); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+	if model := a.Value(LLMModel); model != "" {
+		t.Errorf("Expected the model back as configured, got %q", model)
+	}
+}
+
+func TestAggregate_MirrorsOtherSettings(t *testing.T) {
+	a := NewAggregate()
+	a.ApplyEvent(&audioinput.DeviceSelectedEvent{Device: "pulse:usb-mic"})
+	a.ApplyEvent(&themes.ThemeSelectedEvent{Name: "light"})
+	if a.Value(Microphone) != "pulse:usb-mic" || a.Value(Theme) != "light" {
+		t.Errorf("Expected the microphone and theme mirrored, got %v", a.Values)
+	}
+
+	actions := a.Broadcast3DDelta(&themes.ThemeSelectedEvent{Name: "dark"})
+	if len(actions) != 1 || actions[0].NodeID != "settings_theme" || actions[0].Properties["text"] != "Theme: dark" {
+		t.Errorf("Expected the theme's row on the panel updated, got %+v", actions)
+	}
+	if len(a.GetFull3DState()) != len(Names)+1 {
+		t.Errorf("Expected the panel with a row per setting")
+	}
+}
+
+func TestChange(t *testing.T) {
+	var executed []string
+	var own interface{}
+	execute := func(command string, input any) error {
+		executed = append(executed, command)
+		if command == "ChangeSettings" {
+			own = input
+		}
+		return nil
+	}
+	err := Change(execute, map[string]string{Theme: "light", TTSVoice: "amy.onnx", WhisperModel: "small.en"})
+	if err != nil {
+		t.Fatalf("Change failed: %v", err)
+	}
+	if !reflect.DeepEqual(executed, []string{"SelectTheme", "SwitchWhisperModel", "ChangeSettings"}) {
+		t.Errorf("Expected the theme and model changed with their own commands, got %v", executed)
+	}
+	if !reflect.DeepEqual(own, map[string]interface{}{TTSVoice: "amy.onnx"}) {
+		t.Errorf("Expected the voice changed with ChangeSettings, got %v", own)
+	}
+}
@@ -0,0 +1,111 @@
+package speakers
+
+import (
+	"fmt"
+	"strings"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// Backend tells speakers apart by their voices, e.g. the VoiceTranscriber
+type Backend interface {
+	// EnrollSpeaker records the voiceprint of the next utterance as the named speaker's, calling done with it
+	EnrollSpeaker(name string, done func(voiceprint []float64))
+	SetSpeakerProfiles(profiles map[string][]float64)
+}
+
+// Manager enrolls and forgets the voices of speakers
+type Manager struct {
+	backend  Backend
+	profiles *ProfilesAggregate
+	eventBus eventsourcing.EventBus
+}
+
+// NewManager creates a manager for the speakers recognized by the backend
+func NewManager(backend Backend, profiles *ProfilesAggregate, eventBus eventsourcing.EventBus) *Manager {
+	return &Manager{backend: backend, profiles: profiles, eventBus: eventBus}
+}
+
+// Restore gives the backend the voiceprints restored from the events, e.g. on start
+func (m *Manager) Restore() {
+	m.backend.SetSpeakerProfiles(m.profiles.Profiles())
+}
+
+// EnrollSpeakerCommand enrolls the voice of the speaker in the "name" field from the next thing
+// they say; the enrollment completes in the background with a SpeakerEnrolled event
+func (m *Manager) EnrollSpeakerCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if err := ownerOnly(data); err != nil {
+		return nil, err
+	}
+	name, err := nameArg(data)
+	if err != nil {
+		return nil, err
+	}
+	m.backend.EnrollSpeaker(name, func(voiceprint []float64) {
+		logging.Info("Enrolled the voice of %s", name)
+		m.eventBus.Publish(&SpeakerEnrolledEvent{
+			EventType:  "speakers_SpeakerEnrolled",
+			Name:       name,
+			Voiceprint: voiceprint,
+			Timestamp:  eventsourcing.ISOTimestamp(),
+		})
+		m.backend.SetSpeakerProfiles(m.profiles.Profiles())
+	})
+	return []eventsourcing.Event{&EnrollmentStartedEvent{
+		EventType: "speakers_EnrollmentStarted",
+		Name:      name,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// ForgetSpeakerCommand removes the voice of the speaker in the "name" field
+func (m *Manager) ForgetSpeakerCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if err := ownerOnly(data); err != nil {
+		return nil, err
+	}
+	name, err := nameArg(data)
+	if err != nil {
+		return nil, err
+	}
+	profiles := m.profiles.Profiles()
+	if _, ok := profiles[name]; !ok {
+		return nil, fmt.Errorf("no speaker %s is enrolled", name)
+	}
+	delete(profiles, name)
+	m.backend.SetSpeakerProfiles(profiles)
+	logging.Info("Forgot the voice of %s", name)
+	return []eventsourcing.Event{&SpeakerForgottenEvent{
+		EventType: "speakers_SpeakerForgotten",
+		Name:      name,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// ListSpeakersCommand lists the enrolled speakers and the enrollment in progress
+func (m *Manager) ListSpeakersCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	return []eventsourcing.Event{&SpeakersListedEvent{
+		EventType: "speakers_SpeakersListed",
+		Speakers:  m.profiles.Names(),
+		Enrolling: m.profiles.Enrollment(),
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// ownerOnly refuses commands of household members, speaker profiles are kept on the owner's machine
+func ownerOnly(data map[string]interface{}) error {
+	if eventsourcing.UserOf(data) != "" {
+		return fmt.Errorf("only the owner enrolls and forgets speakers")
+	}
+	return nil
+}
+
+// nameArg returns the speaker named in the "name" field
+func nameArg(data map[string]interface{}) (string, error) {
+	name, _ := data["name"].(string)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("name must be a non-empty string")
+	}
+	return name, nil
+}
@@ -0,0 +1,166 @@
+// Package speakers manages the voices MindPalace recognizes in rooms where several people talk to
+// it: enrolling a speaker's voice from what they say next, forgetting it, and listing the enrolled
+// speakers.
+package speakers
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// EnrollmentStartedEvent is emitted when the next utterance will be enrolled as a speaker's voice
+type EnrollmentStartedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Name      string `json:"name"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *EnrollmentStartedEvent) Type() string { return "speakers_EnrollmentStarted" }
+func (e *EnrollmentStartedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *EnrollmentStartedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// SpeakerEnrolledEvent is emitted when a speaker's voiceprint was recorded; enrolling a name again
+// replaces its voiceprint
+type SpeakerEnrolledEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string    `json:"event_type"`
+	Name       string    `json:"name"`
+	Voiceprint []float64 `json:"voiceprint"`
+	Timestamp  string    `json:"timestamp"`
+}
+
+func (e *SpeakerEnrolledEvent) Type() string { return "speakers_SpeakerEnrolled" }
+func (e *SpeakerEnrolledEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *SpeakerEnrolledEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// SpeakerForgottenEvent is emitted when a speaker's voiceprint was removed
+type SpeakerForgottenEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Name      string `json:"name"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *SpeakerForgottenEvent) Type() string { return "speakers_SpeakerForgotten" }
+func (e *SpeakerForgottenEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *SpeakerForgottenEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// SpeakersListedEvent answers a ListSpeakers command with the enrolled speakers
+type SpeakersListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string   `json:"event_type"`
+	Speakers  []string `json:"speakers"`
+	Enrolling string   `json:"enrolling,omitempty"`
+	Timestamp string   `json:"timestamp"`
+}
+
+func (e *SpeakersListedEvent) Type() string { return "speakers_SpeakersListed" }
+func (e *SpeakersListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *SpeakersListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("speakers_EnrollmentStarted", func() eventsourcing.Event { return &EnrollmentStartedEvent{} })
+	eventsourcing.RegisterEvent("speakers_SpeakerEnrolled", func() eventsourcing.Event { return &SpeakerEnrolledEvent{} })
+	eventsourcing.RegisterEvent("speakers_SpeakerForgotten", func() eventsourcing.Event { return &SpeakerForgottenEvent{} })
+	eventsourcing.RegisterEvent("speakers_SpeakersListed", func() eventsourcing.Event { return &SpeakersListedEvent{} })
+	// An enrollment doesn't survive a restart, the utterance it waited for is gone
+	eventsourcing.RegisterTransientEvent("speakers_EnrollmentStarted")
+	eventsourcing.RegisterTransientEvent("speakers_SpeakersListed")
+}
+
+// ProfilesAggregate tracks the voiceprints of the enrolled speakers and the enrollment in progress
+type ProfilesAggregate struct {
+	Voiceprints map[string][]float64
+	Enrolling   string
+	Mu          sync.RWMutex
+}
+
+// NewProfilesAggregate creates a ProfilesAggregate without speakers
+func NewProfilesAggregate() *ProfilesAggregate {
+	return &ProfilesAggregate{Voiceprints: make(map[string][]float64)}
+}
+
+// ID returns the aggregate's identifier
+func (a *ProfilesAggregate) ID() string {
+	return "speakers"
+}
+
+// ApplyEvent updates the profiles
+func (a *ProfilesAggregate) ApplyEvent(event eventsourcing.Event) error {
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	switch e := event.(type) {
+	case *EnrollmentStartedEvent:
+		a.Enrolling = e.Name
+	case *SpeakerEnrolledEvent:
+		a.Voiceprints[e.Name] = e.Voiceprint
+		if a.Enrolling == e.Name {
+			a.Enrolling = ""
+		}
+	case *SpeakerForgottenEvent:
+		delete(a.Voiceprints, e.Name)
+	}
+	return nil
+}
+
+// Profiles returns the voiceprints of the enrolled speakers by name
+func (a *ProfilesAggregate) Profiles() map[string][]float64 {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	profiles := make(map[string][]float64, len(a.Voiceprints))
+	for name, voiceprint := range a.Voiceprints {
+		profiles[name] = voiceprint
+	}
+	return profiles
+}
+
+// Names returns the enrolled speakers in alphabetical order
+func (a *ProfilesAggregate) Names() []string {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	names := make([]string, 0, len(a.Voiceprints))
+	for name := range a.Voiceprints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Enrollment returns the speaker whose voice is being enrolled, empty when none is
+func (a *ProfilesAggregate) Enrollment() string {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return a.Enrolling
+}
+
+// GetCustomUI lists the enrolled speakers
+func (a *ProfilesAggregate) GetCustomUI() fyne.CanvasObject {
+	items := container.NewVBox()
+	if enrolling := a.Enrollment(); enrolling != "" {
+		items.Add(widget.NewLabel("Listening for the voice of " + enrolling))
+	}
+	for _, name := range a.Names() {
+		items.Add(widget.NewLabel(name))
+	}
+	return container.NewVScroll(items)
+}
@@ -0,0 +1,87 @@
+package speakers
+
+import (
+	"testing"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Mock implementations for testing
+
+type mockBackend struct {
+	enrolling string
+	done      func(voiceprint []float64)
+	profiles  map[string][]float64
+}
+
+func (b *mockBackend) EnrollSpeaker(name string, done func(voiceprint []float64)) {
+	b.enrolling, b.done = name, done
+}
+
+func (b *mockBackend) SetSpeakerProfiles(profiles map[string][]float64) { b.profiles = profiles }
+
+// mockBus applies published events to the profiles like the real bus does
+type mockBus struct {
+	profiles  *ProfilesAggregate
+	published []eventsourcing.Event
+}
+
+func (b *mockBus) Publish(event eventsourcing.Event) {
+	b.profiles.ApplyEvent(event)
+	b.published = append(b.published, event)
+}
+func (b *mockBus) Subscribe(eventType string, handler eventsourcing.EventHandler) {}
+func (b *mockBus) SubscribeAll(handler eventsourcing.EventHandler)                {}
+
+func TestManager_EnrollAndForget(t *testing.T) {
+	backend := &mockBackend{}
+	profiles := NewProfilesAggregate()
+	bus := &mockBus{profiles: profiles}
+	manager := NewManager(backend, profiles, bus)
+
+	if _, err := manager.EnrollSpeakerCommand(map[string]interface{}{"name": " "}); err == nil {
+		t.Error("Expected an error enrolling without a name")
+	}
+	events, err := manager.EnrollSpeakerCommand(map[string]interface{}{"name": "Robin"})
+	if err != nil {
+		t.Fatalf("EnrollSpeakerCommand failed: %v", err)
+	}
+	profiles.ApplyEvent(events[0])
+	if backend.enrolling != "Robin" || profiles.Enrollment() != "Robin" {
+		t.Errorf("Expected Robin's enrollment to be waiting, got %q and %q", backend.enrolling, profiles.Enrollment())
+	}
+
+	// The backend completes the enrollment with the voiceprint of the next utterance
+	backend.done([]float64{0.5, -0.5, 120})
+	if len(bus.published) != 1 || profiles.Enrollment() != "" {
+		t.Fatalf("Expected the enrollment completed, got %v", bus.published)
+	}
+	if voiceprint := backend.profiles["Robin"]; len(voiceprint) != 3 {
+		t.Errorf("Expected the backend to recognize Robin, got %v", backend.profiles)
+	}
+
+	events, _ = manager.ListSpeakersCommand(map[string]interface{}{})
+	if listed := events[0].(*SpeakersListedEvent); len(listed.Speakers) != 1 || listed.Speakers[0] != "Robin" {
+		t.Errorf("Expected Robin listed, got %+v", listed)
+	}
+
+	if _, err := manager.ForgetSpeakerCommand(map[string]interface{}{"name": "Sam"}); err == nil {
+		t.Error("Expected an error forgetting a speaker that isn't enrolled")
+	}
+	events, err = manager.ForgetSpeakerCommand(map[string]interface{}{"name": "Robin"})
+	if err != nil {
+		t.Fatalf("ForgetSpeakerCommand failed: %v", err)
+	}
+	profiles.ApplyEvent(events[0])
+	if len(backend.profiles) != 0 || len(profiles.Names()) != 0 {
+		t.Errorf("Expected Robin forgotten, got %v and %v", backend.profiles, profiles.Names())
+	}
+
+	// The profiles restored on start reach a new backend
+	profiles.ApplyEvent(&SpeakerEnrolledEvent{Name: "Sam", Voiceprint: []float64{1, 2, 3}})
+	restored := &mockBackend{}
+	NewManager(restored, profiles, bus).Restore()
+	if _, ok := restored.profiles["Sam"]; !ok {
+		t.Errorf("Expected the restored profiles applied, got %v", restored.profiles)
+	}
+}
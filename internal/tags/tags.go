@@ -0,0 +1,366 @@
+// Package tags keeps one taxonomy for the tags on tasks, calendar events and the items of other
+// plugins. Tags are compared case folded and without a leading #, aliases make several names mean
+// the same tag, and the items of all plugins can be listed by tag.
+package tags
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// TagAliasAddedEvent records that a name is to be read as another tag
+type TagAliasAddedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Alias     string `json:"alias"`
+	Tag       string `json:"tag"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *TagAliasAddedEvent) Type() string { return "tags_TagAliasAdded" }
+func (e *TagAliasAddedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *TagAliasAddedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// TagAliasRemovedEvent records that a name is a tag of its own again
+type TagAliasRemovedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Alias     string `json:"alias"`
+	Tag       string `json:"tag"` // The tag the alias stood for
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *TagAliasRemovedEvent) Type() string { return "tags_TagAliasRemoved" }
+func (e *TagAliasRemovedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *TagAliasRemovedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// TaggedItemsListedEvent answers a ListByTag command with the items of all plugins carrying the tag
+type TaggedItemsListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string                     `json:"event_type"`
+	Tag       string                     `json:"tag"`
+	Items     []eventsourcing.TaggedItem `json:"items"`
+}
+
+func (e *TaggedItemsListedEvent) Type() string { return "tags_TaggedItemsListed" }
+func (e *TaggedItemsListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *TaggedItemsListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("tags_TagAliasAdded", func() eventsourcing.Event { return &TagAliasAddedEvent{} })
+	eventsourcing.RegisterEvent("tags_TagAliasRemoved", func() eventsourcing.Event { return &TagAliasRemovedEvent{} })
+	eventsourcing.RegisterEvent("tags_TaggedItemsListed", func() eventsourcing.Event { return &TaggedItemsListedEvent{} })
+	eventsourcing.RegisterTransientEvent("tags_TaggedItemsListed")
+}
+
+// Fold returns the tag as it is compared: without a leading #, in lower case and with dashes for spaces
+func Fold(tag string) string {
+	return strings.Join(strings.Fields(strings.ToLower(strings.TrimLeft(strings.TrimSpace(tag), "#"))), "-")
+}
+
+// Registry is the aggregate of the tag aliases of each user. The tags themselves are those on the
+// items of the aggregates implementing eventsourcing.TagIndex.
+type Registry struct {
+	Aliases    map[string]map[string]string // User -> folded alias -> tag
+	aggregates eventsourcing.UserAggregateStore
+	Mu         sync.RWMutex
+}
+
+// NewRegistry creates a registry finding the tagged items in the aggregates of the store
+func NewRegistry(aggregates eventsourcing.UserAggregateStore) *Registry {
+	return &Registry{
+		Aliases:    make(map[string]map[string]string),
+		aggregates: aggregates,
+	}
+}
+
+// ID returns the aggregate's identifier
+func (r *Registry) ID() string {
+	return "tags"
+}
+
+// ApplyEvent adds and removes the aliases of the event's user
+func (r *Registry) ApplyEvent(event eventsourcing.Event) error {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	userID := event.Metadata().UserID
+	switch e := event.(type) {
+	case *TagAliasAddedEvent:
+		if r.Aliases[userID] == nil {
+			r.Aliases[userID] = make(map[string]string)
+		}
+		r.Aliases[userID][Fold(e.Alias)] = Fold(e.Tag)
+	case *TagAliasRemovedEvent:
+		delete(r.Aliases[userID], Fold(e.Alias))
+	}
+	return nil
+}
+
+// Canonical returns the tag a name means to the user: the name folded, or the tag it is an alias of
+func (r *Registry) Canonical(userID, tag string) string {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	return r.canonical(userID, tag)
+}
+
+// canonical is Canonical with r.Mu held
+func (r *Registry) canonical(userID, tag string) string {
+	folded := Fold(tag)
+	if canonical, ok := r.Aliases[userID][folded]; ok {
+		return canonical
+	}
+	return folded
+}
+
+// taggedItems returns the tagged items of the aggregates the user sees
+func (r *Registry) taggedItems(userID string) []eventsourcing.TaggedItem {
+	var items []eventsourcing.TaggedItem
+	for _, agg := range r.aggregates.AggregatesOf(userID) {
+		if index, ok := agg.(eventsourcing.TagIndex); ok {
+			items = append(items, index.TaggedItems()...)
+		}
+	}
+	return items
+}
+
+// Known returns the canonical tags on the items the user sees, with the number of items carrying each
+func (r *Registry) Known(userID string) map[string]int {
+	items := r.taggedItems(userID)
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	known := make(map[string]int)
+	for _, item := range items {
+		seen := make(map[string]bool)
+		for _, tag := range item.Tags {
+			if canonical := r.canonical(userID, tag); !seen[canonical] {
+				seen[canonical] = true
+				known[canonical]++
+			}
+		}
+	}
+	return known
+}
+
+// ItemsTagged returns the items the user sees carrying the tag or one of its aliases, soonest due
+// first and items without a due date last
+func (r *Registry) ItemsTagged(userID, tag string) []eventsourcing.TaggedItem {
+	items := r.taggedItems(userID)
+	r.Mu.RLock()
+	canonical := r.canonical(userID, tag)
+	tagged := []eventsourcing.TaggedItem{}
+	for _, item := range items {
+		for _, itemTag := range item.Tags {
+			if r.canonical(userID, itemTag) == canonical {
+				tagged = append(tagged, item)
+				break
+			}
+		}
+	}
+	r.Mu.RUnlock()
+	sort.SliceStable(tagged, func(i, j int) bool {
+		a, b := tagged[i], tagged[j]
+		if a.Due.IsZero() != b.Due.IsZero() {
+			return b.Due.IsZero()
+		}
+		if !a.Due.Equal(b.Due) {
+			return a.Due.Before(b.Due)
+		}
+		return a.Aggregate+a.ID < b.Aggregate+b.ID
+	})
+	return tagged
+}
+
+// Suggest returns the known tag the user probably meant by a tag nobody uses yet, empty if the tag
+// is known or doesn't look like a misspelling of one
+func (r *Registry) Suggest(userID, tag string) string {
+	known := r.Known(userID)
+	canonical := r.Canonical(userID, tag)
+	if _, ok := known[canonical]; ok || len(canonical) < 4 {
+		return ""
+	}
+	suggestion, best := "", 3 // Tags differing in more than two letters are different tags
+	for candidate := range known {
+		if d := distance(canonical, candidate); d < best || (d == best && candidate < suggestion) {
+			suggestion, best = candidate, d
+		}
+	}
+	return suggestion
+}
+
+// distance is the Levenshtein distance between two tags
+func distance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	previous := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		current := make([]int, len(br)+1)
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(br)]
+}
+
+// userTags normalizes the tags of one user
+type userTags struct {
+	registry *Registry
+	userID   string
+}
+
+// NormalizerFor returns the normalizer of the user's tags, for the user's plugin instances
+func (r *Registry) NormalizerFor(userID string) eventsourcing.TagNormalizer {
+	return userTags{registry: r, userID: userID}
+}
+
+// NormalizeTags returns the canonical tags without duplicates, or an error suggesting the known tag
+// for one that looks misspelled
+func (u userTags) NormalizeTags(tags []string) ([]string, error) {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		canonical := u.registry.Canonical(u.userID, tag)
+		if canonical == "" || seen[canonical] {
+			continue
+		}
+		if suggestion := u.registry.Suggest(u.userID, tag); suggestion != "" {
+			return nil, fmt.Errorf("unknown tag %q, did you mean %q? Add an alias with AddTagAlias to keep both names", tag, suggestion)
+		}
+		seen[canonical] = true
+		normalized = append(normalized, canonical)
+	}
+	return normalized, nil
+}
+
+// AddTagAliasCommand makes "alias" mean "tag" for the user, e.g. {"alias": "fitness", "tag": "health"}
+func (r *Registry) AddTagAliasCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	alias, _ := data["alias"].(string)
+	tag, _ := data["tag"].(string)
+	if Fold(alias) == "" || Fold(tag) == "" {
+		return nil, fmt.Errorf("alias and tag are required")
+	}
+	userID := eventsourcing.UserOf(data)
+	canonical := r.Canonical(userID, tag) // An alias of an alias stands for the tag itself
+	if Fold(alias) == canonical {
+		return nil, fmt.Errorf("%s already means %s", alias, canonical)
+	}
+	r.Mu.RLock()
+	for existing, target := range r.Aliases[userID] {
+		if target == Fold(alias) {
+			r.Mu.RUnlock()
+			return nil, fmt.Errorf("%s is the tag of alias %s, remove that alias first", alias, existing)
+		}
+	}
+	r.Mu.RUnlock()
+	return []eventsourcing.Event{&TagAliasAddedEvent{
+		Alias:     Fold(alias),
+		Tag:       canonical,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// RemoveTagAliasCommand makes "alias" a tag of its own again
+func (r *Registry) RemoveTagAliasCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	alias, _ := data["alias"].(string)
+	userID := eventsourcing.UserOf(data)
+	r.Mu.RLock()
+	tag, exists := r.Aliases[userID][Fold(alias)]
+	r.Mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%q is not an alias", alias)
+	}
+	return []eventsourcing.Event{&TagAliasRemovedEvent{
+		Alias:     Fold(alias),
+		Tag:       tag,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// ListByTagCommand lists the items of all plugins carrying "tag", e.g. {"tag": "#health"}
+func (r *Registry) ListByTagCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	tag, _ := data["tag"].(string)
+	if Fold(tag) == "" {
+		return nil, fmt.Errorf("tag is required")
+	}
+	userID := eventsourcing.UserOf(data)
+	return []eventsourcing.Event{&TaggedItemsListedEvent{
+		Tag:   r.Canonical(userID, tag),
+		Items: r.ItemsTagged(userID, tag),
+	}}, nil
+}
+
+// GetCustomUI lists the owner's tags with the number of items carrying them, and their aliases
+func (r *Registry) GetCustomUI() fyne.CanvasObject {
+	known := r.Known("")
+	r.Mu.RLock()
+	aliases := make(map[string][]string)
+	for alias, tag := range r.Aliases[""] {
+		aliases[tag] = append(aliases[tag], alias)
+		if _, ok := known[tag]; !ok {
+			known[tag] = 0
+		}
+	}
+	r.Mu.RUnlock()
+	if len(known) == 0 {
+		return widget.NewLabel("No tags yet")
+	}
+	tags := make([]string, 0, len(known))
+	for tag := range known {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	items := container.NewVBox()
+	for _, tag := range tags {
+		text := fmt.Sprintf("#%s: %d items", tag, known[tag])
+		if len(aliases[tag]) > 0 {
+			sort.Strings(aliases[tag])
+			text += fmt.Sprintf(" (also %s)", strings.Join(aliases[tag], ", "))
+		}
+		items.Add(widget.NewLabel(text))
+	}
+	return container.NewVScroll(items)
+}
+
+// SaveSnapshot serializes the aliases
+func (r *Registry) SaveSnapshot() ([]byte, error) {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	return json.Marshal(r.Aliases)
+}
+
+// LoadSnapshot replaces the aliases with the snapshot
+func (r *Registry) LoadSnapshot(data []byte) error {
+	aliases := make(map[string]map[string]string)
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return err
+	}
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	r.Aliases = aliases
+	return nil
+}
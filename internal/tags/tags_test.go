@@ -0,0 +1,161 @@
+package tags
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/eventsourcing/eventsourcingtest"
+)
+
+// taggedAggregate holds fixed tagged items
+type taggedAggregate struct {
+	id    string
+	items []eventsourcing.TaggedItem
+}
+
+func (a *taggedAggregate) ID() string                                 { return a.id }
+func (a *taggedAggregate) ApplyEvent(event eventsourcing.Event) error { return nil }
+func (a *taggedAggregate) GetCustomUI() fyne.CanvasObject             { return nil }
+func (a *taggedAggregate) TaggedItems() []eventsourcing.TaggedItem    { return a.items }
+
+// userAggregates gives every user the same shared aggregates and their own
+type userAggregates struct {
+	shared []eventsourcing.Aggregate
+	own    map[string][]eventsourcing.Aggregate
+}
+
+func (u *userAggregates) AggregatesOf(userID string) []eventsourcing.Aggregate {
+	return append(append([]eventsourcing.Aggregate{}, u.shared...), u.own[userID]...)
+}
+
+func (u *userAggregates) UserAggregates(userID string) []eventsourcing.Aggregate {
+	return u.own[userID]
+}
+func (u *userAggregates) Users() []string { return nil }
+
+func newTestRegistry() *Registry {
+	friday := time.Date(2024, 5, 3, 9, 0, 0, 0, time.UTC)
+	return NewRegistry(&userAggregates{own: map[string][]eventsourcing.Aggregate{
+		"": {
+			&taggedAggregate{id: "taskmanager", items: []eventsourcing.TaggedItem{
+				{Aggregate: "taskmanager", ID: "t1", Title: "Book physio", Tags: []string{"Health"}},
+				{Aggregate: "taskmanager", ID: "t2", Title: "File taxes", Tags: []string{"finance"}},
+			}},
+			&taggedAggregate{id: "calendar", items: []eventsourcing.TaggedItem{
+				{Aggregate: "calendar", ID: "e1", Title: "Dentist", Due: friday, Tags: []string{"#health", "appointments"}},
+				{Aggregate: "calendar", ID: "e2", Title: "Gym", Due: friday.Add(time.Hour), Tags: []string{"Fitness"}},
+			}},
+		},
+		"alice": {
+			&taggedAggregate{id: "taskmanager", items: []eventsourcing.TaggedItem{
+				{Aggregate: "taskmanager", ID: "t3", Title: "Run", Tags: []string{"health"}},
+			}},
+		},
+	}})
+}
+
+func titles(items []eventsourcing.TaggedItem) string {
+	var titles []string
+	for _, item := range items {
+		titles = append(titles, item.Title)
+	}
+	return strings.Join(titles, ",")
+}
+
+func TestFold(t *testing.T) {
+	for tag, want := range map[string]string{"#Health": "health", "  deep Work ": "deep-work", "##": ""} {
+		if got := Fold(tag); got != want {
+			t.Errorf("Fold(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
+
+func TestRegistry_ListByTag(t *testing.T) {
+	r := newTestRegistry()
+	if got := titles(r.ItemsTagged("", "#HEALTH")); got != "Dentist,Book physio" {
+		t.Errorf("Expected the dentist before the undated physio, got %s", got)
+	}
+
+	eventsourcingtest.Execute(t, r, "", r.AddTagAliasCommand, map[string]interface{}{"alias": "#Fitness", "tag": "health"})
+	events, err := r.ListByTagCommand(map[string]interface{}{"tag": "health"})
+	if err != nil {
+		t.Fatalf("ListByTag failed: %v", err)
+	}
+	listed := events[0].(*TaggedItemsListedEvent)
+	if listed.Tag != "health" || titles(listed.Items) != "Dentist,Gym,Book physio" {
+		t.Errorf("Expected the items tagged with the alias listed too, got %s: %s", listed.Tag, titles(listed.Items))
+	}
+	if got := titles(r.ItemsTagged("", "fitness")); got != "Dentist,Gym,Book physio" {
+		t.Errorf("Expected the alias to list its tag's items, got %s", got)
+	}
+
+	events, err = r.ListByTagCommand(map[string]interface{}{"tag": "fitness", "userID": "alice"})
+	if err != nil {
+		t.Fatalf("ListByTag failed: %v", err)
+	}
+	if listed := events[0].(*TaggedItemsListedEvent); listed.Tag != "fitness" || len(listed.Items) != 0 {
+		t.Errorf("Expected the owner's alias and items kept from alice, got %s: %s", listed.Tag, titles(listed.Items))
+	}
+	if _, err := r.ListByTagCommand(map[string]interface{}{"tag": "#"}); err == nil {
+		t.Error("Expected an error listing without a tag")
+	}
+}
+
+func TestRegistry_Aliases(t *testing.T) {
+	r := newTestRegistry()
+	eventsourcingtest.Execute(t, r, "", r.AddTagAliasCommand, map[string]interface{}{"alias": "wellbeing", "tag": "Health"})
+	eventsourcingtest.Execute(t, r, "", r.AddTagAliasCommand, map[string]interface{}{"alias": "self care", "tag": "wellbeing"})
+	if got := r.Canonical("", "#Self Care"); got != "health" {
+		t.Errorf("Expected an alias of an alias to mean the tag, got %s", got)
+	}
+	if _, err := r.AddTagAliasCommand(map[string]interface{}{"alias": "health", "tag": "wellbeing"}); err == nil {
+		t.Error("Expected an error making a tag an alias of its own alias")
+	}
+	if _, err := r.AddTagAliasCommand(map[string]interface{}{"alias": "health", "tag": "fitness"}); err == nil {
+		t.Error("Expected an error aliasing a tag that has aliases")
+	}
+
+	snapshot, err := r.SaveSnapshot()
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	eventsourcingtest.Execute(t, r, "", r.RemoveTagAliasCommand, map[string]interface{}{"alias": "Wellbeing"})
+	if got := r.Canonical("", "wellbeing"); got != "wellbeing" {
+		t.Errorf("Expected a removed alias to be a tag of its own, got %s", got)
+	}
+	if _, err := r.RemoveTagAliasCommand(map[string]interface{}{"alias": "wellbeing"}); err == nil {
+		t.Error("Expected an error removing an alias that doesn't exist")
+	}
+	if err := r.LoadSnapshot(snapshot); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if got := r.Canonical("", "wellbeing"); got != "health" {
+		t.Errorf("Expected the alias restored from the snapshot, got %s", got)
+	}
+}
+
+func TestRegistry_NormalizeTags(t *testing.T) {
+	r := newTestRegistry()
+	eventsourcingtest.Execute(t, r, "", r.AddTagAliasCommand, map[string]interface{}{"alias": "money", "tag": "finance"})
+	normalizer := r.NormalizerFor("")
+
+	got, err := normalizer.NormalizeTags([]string{"#Health", "money", "health", "New Project", "tax"})
+	if err != nil {
+		t.Fatalf("NormalizeTags failed: %v", err)
+	}
+	if strings.Join(got, ",") != "health,finance,new-project,tax" {
+		t.Errorf("Expected canonical tags without duplicates, got %v", got)
+	}
+
+	_, err = normalizer.NormalizeTags([]string{"helth"})
+	if err == nil || !strings.Contains(err.Error(), `did you mean "health"`) {
+		t.Errorf("Expected a misspelled tag to suggest the known one, got %v", err)
+	}
+	if _, err := r.NormalizerFor("bob").NormalizeTags([]string{"helth"}); err != nil {
+		t.Errorf("Expected bob, without tags of their own, to use any tag: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package themes
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+	"mindpalace/pkg/ui3d"
+)
+
+// Manager knows the palettes that can be picked and applies the one in use, telling the listeners, like the
+// desktop app and the 3D clients, when it changes
+type Manager struct {
+	settings   *SettingsAggregate
+	mu         sync.RWMutex
+	palettes   map[string]ui3d.Theme
+	configured string // Palette used until the user picked one
+	listeners  []func(name string, palette ui3d.Theme)
+}
+
+// NewManager creates a manager of the built-in palettes, using the dark one until configured otherwise
+func NewManager(settings *SettingsAggregate) *Manager {
+	palettes := make(map[string]ui3d.Theme)
+	for _, name := range []string{ui3d.ThemeDark, ui3d.ThemeLight, ui3d.ThemeHighContrast} {
+		palettes[name], _ = ui3d.BuiltinTheme(name)
+	}
+	return &Manager{settings: settings, palettes: palettes, configured: ui3d.ThemeDark}
+}
+
+// Configure sets the palettes that can be picked and the one used until the user picked one, and applies
+// the palette in use, whose colors may have changed
+func (m *Manager) Configure(configured string, palettes map[string]ui3d.Theme) {
+	m.mu.Lock()
+	m.palettes = palettes
+	m.configured = configured
+	m.mu.Unlock()
+	m.Restore()
+}
+
+// OnChange calls the listener with the palette in use whenever it changes
+func (m *Manager) OnChange(listener func(name string, palette ui3d.Theme)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, listener)
+}
+
+// Names returns the palettes that can be picked, the built-in ones first
+func (m *Manager) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := []string{ui3d.ThemeDark, ui3d.ThemeLight, ui3d.ThemeHighContrast}
+	var own []string
+	for name := range m.palettes {
+		if _, builtin := ui3d.BuiltinTheme(name); !builtin {
+			own = append(own, name)
+		}
+	}
+	sort.Strings(own)
+	return append(names, own...)
+}
+
+// Current returns the palette in use: the one the user picked, or the configured one when they didn't or
+// their pick was removed from the configuration
+func (m *Manager) Current() (string, ui3d.Theme) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if selected := m.settings.SelectedTheme(); selected != "" {
+		if palette, ok := m.palettes[selected]; ok {
+			return selected, palette
+		}
+	}
+	if palette, ok := m.palettes[m.configured]; ok {
+		return m.configured, palette
+	}
+	return ui3d.ThemeDark, ui3d.DefaultTheme()
+}
+
+// Restore applies the palette in use, e.g. on start once the user's pick was restored from the events
+func (m *Manager) Restore() {
+	m.apply(m.Current())
+}
+
+// SelectThemeCommand draws the app and the 3D world in the palette named in the "theme" field from now on;
+// picking the palette in use changes nothing
+func (m *Manager) SelectThemeCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	name, ok := data["theme"].(string)
+	if !ok {
+		return nil, fmt.Errorf("theme must be a string")
+	}
+	m.mu.RLock()
+	palette, exists := m.palettes[name]
+	m.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("unknown theme %q, pick one of %v", name, m.Names())
+	}
+	previous, _ := m.Current()
+	if name == previous {
+		return nil, nil
+	}
+	m.apply(name, palette)
+	logging.Info("Selected theme %q", name)
+	return []eventsourcing.Event{&ThemeSelectedEvent{
+		EventType: "themes_ThemeSelected",
+		Name:      name,
+		Palette:   palette,
+		Previous:  previous,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// apply makes the palette the one objects are created in and tells the listeners
+func (m *Manager) apply(name string, palette ui3d.Theme) {
+	ui3d.SetCurrentTheme(palette)
+	m.mu.RLock()
+	listeners := append([]func(string, ui3d.Theme){}, m.listeners...)
+	m.mu.RUnlock()
+	for _, listener := range listeners {
+		listener(name, palette)
+	}
+}
@@ -0,0 +1,52 @@
+package themes
+
+import (
+	"reflect"
+	"testing"
+
+	"mindpalace/pkg/ui3d"
+)
+
+func TestManager_SelectTheme(t *testing.T) {
+	settings := NewSettingsAggregate()
+	manager := NewManager(settings)
+	var applied []string
+	manager.OnChange(func(name string, palette ui3d.Theme) { applied = append(applied, name) })
+	sepia := ui3d.LightTheme()
+	sepia.Background = []float64{0.9, 0.8, 0.6, 1}
+	manager.Configure(ui3d.ThemeLight, map[string]ui3d.Theme{ui3d.ThemeDark: ui3d.DefaultTheme(), ui3d.ThemeLight: ui3d.LightTheme(), "sepia": sepia})
+	defer ui3d.SetCurrentTheme(ui3d.DefaultTheme())
+
+	if name, _ := manager.Current(); name != ui3d.ThemeLight || !reflect.DeepEqual(ui3d.CurrentTheme(), ui3d.LightTheme()) {
+		t.Errorf("Expected the configured light palette in use, got %q", name)
+	}
+	if names := manager.Names(); !reflect.DeepEqual(names, []string{"dark", "light", "high-contrast", "sepia"}) {
+		t.Errorf("Expected the built-in palettes followed by the user's, got %v", names)
+	}
+
+	events, err := manager.SelectThemeCommand(map[string]interface{}{"theme": "sepia"})
+	if err != nil {
+		t.Fatalf("SelectTheme failed: %v", err)
+	}
+	selected := events[0].(*ThemeSelectedEvent)
+	if selected.Name != "sepia" || selected.Previous != ui3d.ThemeLight || !reflect.DeepEqual(selected.Palette, sepia) {
+		t.Errorf("Unexpected event %+v", selected)
+	}
+	settings.ApplyEvent(selected)
+	if !reflect.DeepEqual(ui3d.CurrentTheme(), sepia) || applied[len(applied)-1] != "sepia" {
+		t.Errorf("Expected the sepia palette applied and the listeners told, got %v", applied)
+	}
+
+	if events, err := manager.SelectThemeCommand(map[string]interface{}{"theme": "sepia"}); err != nil || len(events) != 0 {
+		t.Errorf("Expected picking the palette in use to change nothing, got %v, %v", events, err)
+	}
+	if _, err := manager.SelectThemeCommand(map[string]interface{}{"theme": "neon"}); err == nil {
+		t.Error("Expected an unknown palette to be refused")
+	}
+
+	// The pick falls back to the configured palette once it is no longer configured
+	manager.Configure(ui3d.ThemeDark, map[string]ui3d.Theme{ui3d.ThemeDark: ui3d.DefaultTheme()})
+	if name, palette := manager.Current(); name != ui3d.ThemeDark || !reflect.DeepEqual(palette, ui3d.DefaultTheme()) {
+		t.Errorf("Expected the dark palette once sepia was removed, got %q", name)
+	}
+}
@@ -0,0 +1,92 @@
+// Package themes keeps the palette the desktop app and the 3D world are drawn in: the built-in dark, light
+// and high-contrast palettes and those the user defined in the configuration.
+package themes
+
+import (
+	"encoding/json"
+	"image/color"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/ui3d"
+)
+
+// ThemeSelectedEvent is emitted when the user picked another palette
+type ThemeSelectedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string     `json:"event_type"`
+	Name      string     `json:"name"`
+	Palette   ui3d.Theme `json:"palette"` // Colors of the palette when it was picked
+	Previous  string     `json:"previous,omitempty"`
+	Timestamp string     `json:"timestamp"`
+}
+
+func (e *ThemeSelectedEvent) Type() string { return "themes_ThemeSelected" }
+func (e *ThemeSelectedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ThemeSelectedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("themes_ThemeSelected", func() eventsourcing.Event { return &ThemeSelectedEvent{} })
+}
+
+// SettingsAggregate tracks the palette the user picked
+type SettingsAggregate struct {
+	Selected string     // Empty until the user picked one, the configured palette is used meanwhile
+	Palette  ui3d.Theme // Colors of the palette when it was picked
+	Mu       sync.RWMutex
+}
+
+// NewSettingsAggregate creates a SettingsAggregate without a palette picked
+func NewSettingsAggregate() *SettingsAggregate {
+	return &SettingsAggregate{}
+}
+
+// ID returns the aggregate's identifier
+func (a *SettingsAggregate) ID() string {
+	return "themes"
+}
+
+// ApplyEvent updates the settings
+func (a *SettingsAggregate) ApplyEvent(event eventsourcing.Event) error {
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	if e, ok := event.(*ThemeSelectedEvent); ok {
+		a.Selected = e.Name
+		a.Palette = e.Palette
+	}
+	return nil
+}
+
+// SelectedTheme returns the palette the user picked last, empty if they never did
+func (a *SettingsAggregate) SelectedTheme() string {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return a.Selected
+}
+
+// GetCustomUI shows the palette the user picked with its colors
+func (a *SettingsAggregate) GetCustomUI() fyne.CanvasObject {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	if a.Selected == "" {
+		return widget.NewLabel("Theme: the configured palette")
+	}
+	swatches := container.NewHBox(widget.NewLabel("Theme: " + a.Selected))
+	for _, rgba := range [][]float64{a.Palette.Primary, a.Palette.Secondary, a.Palette.Accent, a.Palette.Background, a.Palette.Text} {
+		if len(rgba) < 3 {
+			continue
+		}
+		swatch := canvas.NewRectangle(color.NRGBA{R: uint8(rgba[0] * 0xff), G: uint8(rgba[1] * 0xff), B: uint8(rgba[2] * 0xff), A: 0xff})
+		swatch.SetMinSize(fyne.NewSize(24, 24))
+		swatches.Add(swatch)
+	}
+	return swatches
+}
@@ -0,0 +1,59 @@
+// Package tracing exports the traces of requests with OpenTelemetry. A request is a trace from
+// ProcessUserRequest to its completion, with spans for deciding the agents, their LLM calls and each tool
+// call; its events carry the trace ID in the event log, so a slow request found there can be looked up.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// ServiceName is the name MindPalace's spans are exported under
+const ServiceName = "mindpalace"
+
+// Stdout is the endpoint writing the spans to standard output instead of exporting them
+const Stdout = "stdout"
+
+// Setup exports the spans to the OTLP/HTTP collector at the endpoint, e.g. localhost:4318 or
+// https://collector:4318, or writes them to standard output for Stdout. Without an endpoint the one in
+// OTEL_EXPORTER_OTLP_ENDPOINT is used, and without that spans are dropped. The returned function
+// flushes the spans not exported yet and stops exporting.
+func Setup(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := newExporter(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the trace exporter for %s: %w", endpoint, err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// newExporter creates the exporter of the endpoint
+func newExporter(ctx context.Context, endpoint string) (sdktrace.SpanExporter, error) {
+	if endpoint == Stdout {
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	}
+	if strings.Contains(endpoint, "://") {
+		return otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	}
+	return otlptracehttp.New(ctx, otlptracehttp.WithEndpoint(endpoint), otlptracehttp.WithInsecure())
+}
@@ -0,0 +1,222 @@
+package tts
+
+import (
+	"errors"
+	"sync"
+
+	"mindpalace/internal/briefing"
+	"mindpalace/internal/orchestration"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// errMuted stops a response that is being spoken when the speaker is muted
+var errMuted = errors.New("speech muted")
+
+// errInterrupted stops a response that is being spoken when the user interrupts it
+var errInterrupted = errors.New("speech interrupted")
+
+// FrameSink receives the synthesized speech, e.g. the Godot client connection
+type FrameSink interface {
+	SendSpeechFrame(frame Frame)
+}
+
+// utterance is a response waiting to be spoken
+type utterance struct {
+	requestID  string
+	text       string
+	voice      string
+	generation int // Interrupting the speaker drops utterances of earlier generations
+}
+
+// Speaker speaks completed responses one at a time, with the voice of the plugin that handled the request
+type Speaker struct {
+	synth      Synthesizer
+	sink       FrameSink
+	voices     Voices
+	configured string                        // Default voice the speaker was created with
+	agentOf    func(requestID string) string // Returns the plugin that handled a request, if any
+	queue      chan utterance
+	muted      bool
+	mu         sync.RWMutex
+	stop       chan struct{}
+
+	generation int                 // Incremented by Interrupt
+	pending    int                 // Utterances queued or being spoken
+	onSpeaking func(speaking bool) // Called when speaking starts and when the queue is spoken
+}
+
+// NewSpeaker creates a speaker; agentOf may be nil, in which case all responses use the default voice
+func NewSpeaker(synth Synthesizer, sink FrameSink, voices Voices, agentOf func(requestID string) string) *Speaker {
+	return &Speaker{
+		synth:      synth,
+		sink:       sink,
+		voices:     voices,
+		configured: voices.Default,
+		agentOf:    agentOf,
+		queue:      make(chan utterance, 16),
+		stop:       make(chan struct{}),
+	}
+}
+
+// Start speaks queued responses until Stop is called
+func (s *Speaker) Start() {
+	logging.Info("Starting speech synthesis")
+	go func() {
+		for {
+			select {
+			case <-s.stop:
+				return
+			case u := <-s.queue:
+				s.speak(u)
+				s.finished()
+			}
+		}
+	}()
+}
+
+// Stop ends speaking queued responses
+func (s *Speaker) Stop() {
+	close(s.stop)
+}
+
+// SetMuted mutes or unmutes the speaker; muting also cuts off the response being spoken
+func (s *Speaker) SetMuted(muted bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.muted = muted
+	logging.Info("Speech muted: %v", muted)
+}
+
+// SetDefaultVoice changes the voice of responses not made by a plugin with a voice of its own, the
+// configured one if empty
+func (s *Speaker) SetDefaultVoice(voice string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if voice == "" {
+		voice = s.configured
+	}
+	s.voices.Default = voice
+	logging.Info("Speaking with voice %q", voice)
+}
+
+// SetSpeakingCallback calls the callback with true when the speaker starts speaking responses, and
+// with false once it spoke them all or was interrupted, e.g. for the turn taking of voice input
+func (s *Speaker) SetSpeakingCallback(callback func(speaking bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onSpeaking = callback
+}
+
+// Interrupt cuts off the response being spoken and drops the queued ones, e.g. when the user starts
+// speaking over them
+func (s *Speaker) Interrupt() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	logging.Info("Speech interrupted")
+}
+
+// Muted reports whether the speaker is muted
+func (s *Speaker) Muted() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.muted
+}
+
+// HandleRequestCompleted queues the response of a completed request to be spoken; subscribe it to
+// orchestration_RequestCompleted
+func (s *Speaker) HandleRequestCompleted(event eventsourcing.Event) error {
+	e, ok := event.(*orchestration.RequestCompletedEvent)
+	if !ok || s.Muted() {
+		return nil
+	}
+	agent := ""
+	if s.agentOf != nil {
+		agent = s.agentOf(e.RequestID)
+	}
+	s.enqueue(e.RequestID, e.ResponseText, agent)
+	return nil
+}
+
+// HandleBriefingDelivered speaks the owner's morning briefing with the default voice when it is to be
+// spoken. The briefings of household members are not spoken on the desktop.
+func (s *Speaker) HandleBriefingDelivered(event eventsourcing.Event) error {
+	e, ok := event.(*briefing.BriefingDeliveredEvent)
+	if !ok || !e.Spoken || e.Metadata().UserID != "" || s.Muted() {
+		return nil
+	}
+	s.enqueue(e.BriefingID, e.Text, "")
+	return nil
+}
+
+// enqueue queues a text to be spoken with the voice of the agent, dropping it when the queue is full
+func (s *Speaker) enqueue(requestID, text, agent string) {
+	text = speakableText(text)
+	if text == "" {
+		return
+	}
+	s.mu.RLock()
+	voice := s.voices.For(agent)
+	u := utterance{requestID: requestID, text: text, voice: voice, generation: s.generation}
+	s.mu.RUnlock()
+	if voice == "" {
+		return
+	}
+	s.addPending(1)
+	select {
+	case s.queue <- u:
+	default:
+		s.addPending(-1)
+		logging.Info("Speech queue full, not speaking %s", requestID)
+	}
+}
+
+// finished counts an utterance taken from the queue as spoken
+func (s *Speaker) finished() {
+	s.addPending(-1)
+}
+
+// addPending counts utterances queued or spoken, calling the speaking callback when there are some
+// after none or none after some
+func (s *Speaker) addPending(delta int) {
+	s.mu.Lock()
+	before := s.pending
+	s.pending += delta
+	after, callback := s.pending, s.onSpeaking
+	s.mu.Unlock()
+	if callback != nil && (before == 0) != (after == 0) {
+		callback(after > 0)
+	}
+}
+
+// interrupted reports whether the utterance was interrupted since it was queued
+func (s *Speaker) interrupted(u utterance) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return u.generation != s.generation
+}
+
+// speak synthesizes an utterance and streams it to the sink frame by frame
+func (s *Speaker) speak(u utterance) {
+	if s.interrupted(u) {
+		return
+	}
+	seq := 0
+	err := s.synth.Synthesize(u.text, u.voice, func(pcm []byte) error {
+		if s.Muted() {
+			return errMuted
+		}
+		if s.interrupted(u) {
+			return errInterrupted
+		}
+		s.sink.SendSpeechFrame(Frame{RequestID: u.requestID, Seq: seq, SampleRate: s.synth.SampleRate(), Data: pcm})
+		seq++
+		return nil
+	})
+	if err != nil && !errors.Is(err, errMuted) && !errors.Is(err, errInterrupted) {
+		logging.Error("Failed to speak the response to request %s: %v", u.requestID, err)
+	}
+	// The final frame lets the client stop playback, also when speaking was cut off
+	s.sink.SendSpeechFrame(Frame{RequestID: u.requestID, Seq: seq, SampleRate: s.synth.SampleRate(), Final: true})
+}
@@ -0,0 +1,149 @@
+// Package tts speaks completed responses with a local text-to-speech engine and streams the audio to clients.
+package tts
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// DefaultSampleRate is the sample rate of medium quality piper voices
+const DefaultSampleRate = 22050
+
+// frameSize is the number of bytes of PCM audio sent per frame, about 0.1s at the default sample rate
+const frameSize = 4410
+
+// Frame is a chunk of synthesized speech in 16-bit signed little endian mono PCM
+type Frame struct {
+	RequestID  string
+	Seq        int
+	SampleRate int
+	Data       []byte
+	Final      bool // The last frame of a response, it may be empty
+}
+
+// Synthesizer turns text into speech, passing the audio to emit as it is produced
+type Synthesizer interface {
+	Synthesize(text, voice string, emit func(pcm []byte) error) error
+	SampleRate() int
+}
+
+// PiperSynthesizer synthesizes speech with the piper command line tool, voice being the path of a piper model
+type PiperSynthesizer struct {
+	Binary string
+	Rate   int
+}
+
+// NewPiperSynthesizer creates a synthesizer running the given piper executable
+func NewPiperSynthesizer(binary string) *PiperSynthesizer {
+	return &PiperSynthesizer{Binary: binary, Rate: DefaultSampleRate}
+}
+
+// SampleRate returns the sample rate of the produced audio
+func (p *PiperSynthesizer) SampleRate() int {
+	return p.Rate
+}
+
+// Synthesize runs piper with raw output and streams its audio in frames while it is still speaking
+func (p *PiperSynthesizer) Synthesize(text, voice string, emit func(pcm []byte) error) error {
+	cmd := exec.Command(p.Binary, "--model", voice, "--output_raw")
+	cmd.Stdin = strings.NewReader(text)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get piper output: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start piper: %v", err)
+	}
+	if err := streamFrames(stdout, emit); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("piper failed: %v", err)
+	}
+	return nil
+}
+
+// streamFrames reads audio from r and emits it in frames of frameSize bytes
+func streamFrames(r io.Reader, emit func(pcm []byte) error) error {
+	buf := make([]byte, frameSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			frame := make([]byte, n)
+			copy(frame, buf[:n])
+			if err := emit(frame); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read synthesized audio: %v", err)
+		}
+	}
+}
+
+// Voices maps plugins to the voice their responses are spoken with
+type Voices struct {
+	Default string
+	Plugins map[string]string
+}
+
+// For returns the voice of a plugin, or the default voice for responses not made by a plugin
+func (v Voices) For(plugin string) string {
+	if voice, ok := v.Plugins[plugin]; ok {
+		return voice
+	}
+	return v.Default
+}
+
+// Empty reports whether no voice is configured at all
+func (v Voices) Empty() bool {
+	return v.Default == "" && len(v.Plugins) == 0
+}
+
+// ParseVoices parses a comma separated list of plugin=voice pairs such as
+// "default=en_US-amy-medium.onnx,taskmanager=en_GB-alan-medium.onnx". A voice without plugin is the default.
+func ParseVoices(value string) (Voices, error) {
+	voices := Voices{Plugins: make(map[string]string)}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		plugin, voice, found := strings.Cut(part, "=")
+		if !found {
+			plugin, voice = "default", plugin
+		}
+		plugin, voice = strings.TrimSpace(plugin), strings.TrimSpace(voice)
+		if plugin == "" || voice == "" {
+			return Voices{}, fmt.Errorf("invalid voice %q", part)
+		}
+		if plugin == "default" {
+			voices.Default = voice
+		} else {
+			voices.Plugins[plugin] = voice
+		}
+	}
+	return voices, nil
+}
+
+var (
+	codeBlockPattern = regexp.MustCompile("(?s)```.*?```")
+	markupPattern    = regexp.MustCompile("[*_#`>|]+")
+	linkPattern      = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+)
+
+// speakableText strips the markdown of a response so its markup is not read out loud
+func speakableText(text string) string {
+	text = codeBlockPattern.ReplaceAllString(text, " ")
+	text = linkPattern.ReplaceAllString(text, "$1")
+	text = markupPattern.ReplaceAllString(text, "")
+	return strings.Join(strings.Fields(text), " ")
+}
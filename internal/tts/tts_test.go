@@ -0,0 +1,223 @@
+package tts
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"mindpalace/internal/briefing"
+	"mindpalace/internal/orchestration"
+)
+
+// Mock implementations for testing
+
+type mockSynthesizer struct {
+	frames [][]byte
+	texts  []string
+	voices []string
+	// onFrame is called after each emitted frame, e.g. to mute halfway
+	onFrame func(i int)
+}
+
+func (m *mockSynthesizer) SampleRate() int { return 16000 }
+
+func (m *mockSynthesizer) Synthesize(text, voice string, emit func(pcm []byte) error) error {
+	m.texts = append(m.texts, text)
+	m.voices = append(m.voices, voice)
+	for i, frame := range m.frames {
+		if err := emit(frame); err != nil {
+			return err
+		}
+		if m.onFrame != nil {
+			m.onFrame(i)
+		}
+	}
+	return nil
+}
+
+type mockSink struct {
+	mu     sync.Mutex
+	frames []Frame
+}
+
+func (m *mockSink) SendSpeechFrame(frame Frame) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.frames = append(m.frames, frame)
+}
+
+func TestParseVoices(t *testing.T) {
+	voices, err := ParseVoices("amy.onnx, taskmanager=alan.onnx,calendar = joe.onnx")
+	if err != nil {
+		t.Fatalf("ParseVoices failed: %v", err)
+	}
+	if voices.For("") != "amy.onnx" || voices.For("notes") != "amy.onnx" {
+		t.Errorf("Expected amy.onnx as default voice, got %+v", voices)
+	}
+	if voices.For("taskmanager") != "alan.onnx" || voices.For("calendar") != "joe.onnx" {
+		t.Errorf("Unexpected plugin voices: %+v", voices.Plugins)
+	}
+
+	if voices, err := ParseVoices(""); err != nil || !voices.Empty() {
+		t.Errorf("Expected no voices, got %+v, %v", voices, err)
+	}
+	if _, err := ParseVoices("taskmanager="); err == nil {
+		t.Error("Expected an error for a plugin without voice")
+	}
+}
+
+func TestSpeakableText(t *testing.T) {
+	text := "## Tasks\n\n**Buy milk** is _due_ today, see [the list](http://x).\n```go\nfmt.Println()\n```\nDone."
+	if got := speakableText(text); got != "Tasks Buy milk is due today, see the list. Done." {
+		t.Errorf("Unexpected speakable text: %q", got)
+	}
+}
+
+func TestStreamFrames(t *testing.T) {
+	audio := bytes.Repeat([]byte{1, 2}, frameSize) // Two full frames
+	audio = append(audio, 3, 4)
+	var frames [][]byte
+	err := streamFrames(bytes.NewReader(audio), func(pcm []byte) error {
+		frames = append(frames, pcm)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("streamFrames failed: %v", err)
+	}
+	if len(frames) != 3 || len(frames[0]) != frameSize || !bytes.Equal(frames[2], []byte{3, 4}) {
+		t.Errorf("Expected two full frames and a partial one, got %d frames", len(frames))
+	}
+}
+
+func TestSpeaker_SpeaksWithPluginVoice(t *testing.T) {
+	synth := &mockSynthesizer{frames: [][]byte{{1, 2}, {3, 4}}}
+	sink := &mockSink{}
+	agents := map[string]string{"req1": "taskmanager"}
+	voices := Voices{Default: "amy.onnx", Plugins: map[string]string{"taskmanager": "alan.onnx"}}
+	speaker := NewSpeaker(synth, sink, voices, func(requestID string) string { return agents[requestID] })
+
+	speaker.HandleRequestCompleted(&orchestration.RequestCompletedEvent{RequestID: "req1", ResponseText: "**Done**"})
+	speaker.HandleRequestCompleted(&orchestration.RequestCompletedEvent{RequestID: "req2", ResponseText: "Hello"})
+	speaker.HandleRequestCompleted(&orchestration.RequestCompletedEvent{RequestID: "req3", ResponseText: "```\ncode\n```"})
+	close(speaker.queue)
+	for u := range speaker.queue {
+		speaker.speak(u)
+	}
+
+	if len(synth.texts) != 2 || synth.texts[0] != "Done" || synth.texts[1] != "Hello" {
+		t.Fatalf("Expected two spoken responses, got %v", synth.texts)
+	}
+	if synth.voices[0] != "alan.onnx" || synth.voices[1] != "amy.onnx" {
+		t.Errorf("Expected the taskmanager voice and the default voice, got %v", synth.voices)
+	}
+	if len(sink.frames) != 6 {
+		t.Fatalf("Expected two audio frames and a final frame per response, got %d", len(sink.frames))
+	}
+	first, final := sink.frames[0], sink.frames[2]
+	if first.RequestID != "req1" || first.Seq != 0 || first.SampleRate != 16000 || first.Final {
+		t.Errorf("Unexpected first frame: %+v", first)
+	}
+	if !final.Final || final.Seq != 2 || len(final.Data) != 0 {
+		t.Errorf("Unexpected final frame: %+v", final)
+	}
+}
+
+func TestSpeaker_SpeaksOwnersBriefing(t *testing.T) {
+	synth := &mockSynthesizer{}
+	voices := Voices{Default: "amy.onnx", Plugins: map[string]string{"taskmanager": "alan.onnx"}}
+	speaker := NewSpeaker(synth, &mockSink{}, voices, nil)
+
+	speaker.HandleBriefingDelivered(&briefing.BriefingDeliveredEvent{BriefingID: "briefing_1", Text: "Good morning", Spoken: true})
+	speaker.HandleBriefingDelivered(&briefing.BriefingDeliveredEvent{BriefingID: "briefing_2", Text: "Not spoken"})
+	alices := &briefing.BriefingDeliveredEvent{BriefingID: "alice/briefing_1", Text: "Alice's", Spoken: true}
+	alices.Metadata().UserID = "alice"
+	speaker.HandleBriefingDelivered(alices)
+	close(speaker.queue)
+	for u := range speaker.queue {
+		speaker.speak(u)
+	}
+
+	if len(synth.texts) != 1 || synth.texts[0] != "Good morning" || synth.voices[0] != "amy.onnx" {
+		t.Errorf("Expected the owner's spoken briefing with the default voice, got %v in %v", synth.texts, synth.voices)
+	}
+}
+
+func TestSpeaker_Mute(t *testing.T) {
+	synth := &mockSynthesizer{frames: [][]byte{{1}, {2}, {3}}}
+	sink := &mockSink{}
+	speaker := NewSpeaker(synth, sink, Voices{Default: "amy.onnx"}, nil)
+
+	// Muting cuts off the response being spoken
+	synth.onFrame = func(i int) {
+		if i == 0 {
+			speaker.SetMuted(true)
+		}
+	}
+	speaker.speak(utterance{requestID: "req1", text: "Hello", voice: "amy.onnx"})
+	if len(sink.frames) != 2 || !sink.frames[1].Final {
+		t.Errorf("Expected one audio frame and a final frame, got %+v", sink.frames)
+	}
+
+	// Responses completed while muted are not queued
+	speaker.HandleRequestCompleted(&orchestration.RequestCompletedEvent{RequestID: "req2", ResponseText: "Hello"})
+	if len(speaker.queue) != 0 {
+		t.Errorf("Expected no queued responses while muted, got %d", len(speaker.queue))
+	}
+	speaker.SetMuted(false)
+	speaker.HandleRequestCompleted(&orchestration.RequestCompletedEvent{RequestID: "req3", ResponseText: "Hello"})
+	if len(speaker.queue) != 1 {
+		t.Errorf("Expected the response to be queued after unmuting, got %d", len(speaker.queue))
+	}
+}
+
+func TestSpeaker_Interrupt(t *testing.T) {
+	synth := &mockSynthesizer{frames: [][]byte{{1}, {2}, {3}}}
+	sink := &mockSink{}
+	speaker := NewSpeaker(synth, sink, Voices{Default: "amy.onnx"}, nil)
+	var speaking []bool
+	speaker.SetSpeakingCallback(func(s bool) { speaking = append(speaking, s) })
+
+	speaker.HandleRequestCompleted(&orchestration.RequestCompletedEvent{RequestID: "req1", ResponseText: "Hello"})
+	speaker.HandleRequestCompleted(&orchestration.RequestCompletedEvent{RequestID: "req2", ResponseText: "Bye"})
+	// The user interrupts halfway the first response, the second is dropped
+	synth.onFrame = func(i int) {
+		if i == 0 {
+			speaker.Interrupt()
+		}
+	}
+	for i := 0; i < 2; i++ {
+		speaker.speak(<-speaker.queue)
+		speaker.finished()
+	}
+	if len(synth.texts) != 1 || len(sink.frames) != 2 || !sink.frames[1].Final {
+		t.Errorf("Expected one audio frame and a final frame of the first response, got %v: %+v", synth.texts, sink.frames)
+	}
+	if len(speaking) != 2 || !speaking[0] || speaking[1] {
+		t.Errorf("Expected speaking to start and end once, got %v", speaking)
+	}
+
+	// Responses completed after the interruption are spoken
+	synth.onFrame = nil
+	speaker.HandleRequestCompleted(&orchestration.RequestCompletedEvent{RequestID: "req3", ResponseText: "Hi"})
+	speaker.speak(<-speaker.queue)
+	if len(synth.texts) != 2 || synth.texts[1] != "Hi" {
+		t.Errorf("Expected the next response spoken, got %v", synth.texts)
+	}
+}
+
+func TestSpeaker_SetDefaultVoice(t *testing.T) {
+	synth := &mockSynthesizer{}
+	speaker := NewSpeaker(synth, &mockSink{}, Voices{Default: "amy.onnx"}, nil)
+
+	speaker.SetDefaultVoice("alan.onnx")
+	speaker.HandleRequestCompleted(&orchestration.RequestCompletedEvent{RequestID: "req1", ResponseText: "Hello"})
+	speaker.SetDefaultVoice("")
+	speaker.HandleRequestCompleted(&orchestration.RequestCompletedEvent{RequestID: "req2", ResponseText: "Hello"})
+	close(speaker.queue)
+	for u := range speaker.queue {
+		speaker.speak(u)
+	}
+	if len(synth.voices) != 2 || synth.voices[0] != "alan.onnx" || synth.voices[1] != "amy.onnx" {
+		t.Errorf("Expected the voice set and then the configured one, got %v", synth.voices)
+	}
+}
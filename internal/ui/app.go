@@ -3,44 +3,72 @@ package ui
 import (
 	"encoding/json"
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
 	"mindpalace/internal/audio"
+	"mindpalace/internal/chat"
 	"mindpalace/internal/godot_ws"
 	"mindpalace/internal/orchestration"
+	"mindpalace/internal/settings"
+	"mindpalace/internal/themes"
+	"mindpalace/internal/tts"
+	"mindpalace/internal/whispermodels"
 	"mindpalace/pkg/aggregate"
 	"mindpalace/pkg/eventsourcing"
 	"mindpalace/pkg/logging"
+	"mindpalace/pkg/ui3d"
 )
 
 // App represents the UI application
 type App struct {
-	eventProcessor *eventsourcing.EventProcessor
-	aggManager     *aggregate.AggregateManager
-	eventChan      chan eventsourcing.Event
-	ui             fyne.App
-	eventLog       *widget.List
-	eventDetail    *widget.Entry
-	transcriber    *audio.VoiceTranscriber
-	transcribing   bool
-	transcriptBox  *widget.Entry
-	ChatHistory    *fyne.Container
-	chatScroll     *container.Scroll
-	pluginTabs     *container.AppTabs
-	orchestrator   *orchestration.RequestOrchestrator
-	plugins        []eventsourcing.Plugin
-	godotServer    *godot_ws.GodotServer
+	eventProcessor   *eventsourcing.EventProcessor
+	aggManager       *aggregate.AggregateManager
+	eventChan        chan eventsourcing.Event
+	ui               fyne.App
+	eventLog         *widget.List
+	events           []eventsourcing.Event // Events shown in the event log
+	eventDetail      *widget.Entry
+	transcriber      *audio.VoiceTranscriber
+	transcribing     bool
+	audioUnavailable bool // Starting the transcriber failed, requests are typed instead
+	listenButton     *widget.Button
+	tray             *tray       // Nil without a system tray
+	quickCapture     fyne.Window // Nil unless the quick capture window is open
+	transcriptBox    *widget.Entry
+	chatArea         *fyne.Container         // Holds the chat view once the orchestration aggregate is there
+	chatView         *orchestration.ChatView // Kept across refreshes, which render only what changed
+	pluginTabs       *container.AppTabs
+	usageTab         *fyne.Container
+	auditTab         *fyne.Container
+	sessionSelect    *widget.Select
+	sessionIDs       map[string]string // Session select option -> session ID
+	orchestrator     *orchestration.RequestOrchestrator
+	speaker          *tts.Speaker    // Nil when speech output is disabled
+	themes           *themes.Manager // Nil when the palette can't be picked
+	themeSelect      *widget.Select
+	settings         *settings.Aggregate // Nil when the settings can't be changed in the app
+	plugins          []eventsourcing.Plugin
+	godotServer      *godot_ws.GodotServer
+	confirmDialogs   map[string]dialog.Dialog // Tool call ID -> open confirmation dialog
+	regions          []uiRegion               // Parts of the UI refreshed by the events they show
+}
+
+// uiRegion is a part of the UI that is refreshed only by the events that can change it
+type uiRegion struct {
+	shows   func(event eventsourcing.Event) bool
+	refresh func(event eventsourcing.Event)
 }
 
 // NewApp creates a new UI application
 func NewApp(ep *eventsourcing.EventProcessor, agg *aggregate.AggregateManager, orch *orchestration.RequestOrchestrator, plugins []eventsourcing.Plugin, godotServer *godot_ws.GodotServer) *App {
-	ChatHistory := container.NewVBox()
 	fyneApp := app.NewWithID("com.mindpalace.app")
 
 	a := &App{
@@ -49,36 +77,59 @@ func NewApp(ep *eventsourcing.EventProcessor, agg *aggregate.AggregateManager, o
 		orchestrator:   orch,
 		ui:             fyneApp,
 		transcriber: func() *audio.VoiceTranscriber {
-			vt, _ := audio.NewVoiceTranscriber("models/ggml-base.en.bin")
+			vt, _ := audio.NewVoiceTranscriber(filepath.Join("models", whispermodels.FileName(whispermodels.DefaultModel)))
 			return vt
 		}(),
 		transcribing:  false,
 		transcriptBox: widget.NewMultiLineEntry(),
-		ChatHistory:   ChatHistory,
-		chatScroll:    container.NewScroll(ChatHistory),
+		chatArea:      container.NewStack(),
+		// InitUI shows the events loaded in a.events
 		eventLog: widget.NewList(
-			func() int { return len(ep.GetEvents()) },
+			func() int { return 0 },
 			func() fyne.CanvasObject { return widget.NewLabel("Event") },
-			func(id widget.ListItemID, obj fyne.CanvasObject) {
-				events := ep.GetEvents()
-				if id >= 0 && id < len(events) {
-					obj.(*widget.Label).SetText(events[id].Type())
-				}
-			},
+			func(widget.ListItemID, fyne.CanvasObject) {},
 		),
-		eventDetail: widget.NewMultiLineEntry(),
-		eventChan:   make(chan eventsourcing.Event, 10),
-		pluginTabs:  container.NewAppTabs(),
-		plugins:     plugins,
-		godotServer: godotServer,
+		eventDetail:    widget.NewMultiLineEntry(),
+		eventChan:      make(chan eventsourcing.Event, 10),
+		pluginTabs:     container.NewAppTabs(),
+		usageTab:       container.NewStack(),
+		auditTab:       container.NewStack(),
+		plugins:        plugins,
+		godotServer:    godotServer,
+		confirmDialogs: make(map[string]dialog.Dialog),
+	}
+	a.ui.Settings().SetTheme(NewCustomTheme(ui3d.CurrentTheme()))
+	a.regions = []uiRegion{
+		{
+			shows:   func(event eventsourcing.Event) bool { return orchestration.ChangesChat(event.Type()) },
+			refresh: func(eventsourcing.Event) { a.refreshChatArea() },
+		},
+		{
+			shows:   func(event eventsourcing.Event) bool { return a.pluginTab(event) != nil },
+			refresh: a.refreshPluginTab,
+		},
+		{
+			shows:   func(event eventsourcing.Event) bool { return eventsourcing.AggregateOf(event.Type()) == "usage" },
+			refresh: func(eventsourcing.Event) { a.refreshUsage() },
+		},
+		{
+			// The audit trail and the event log show the stored events
+			shows:   func(event eventsourcing.Event) bool { return !eventsourcing.IsTransient(event) },
+			refresh: func(eventsourcing.Event) { a.refreshAudit() },
+		},
+		{
+			shows:   func(event eventsourcing.Event) bool { return !eventsourcing.IsTransient(event) },
+			refresh: a.appendToEventLog,
+		},
 	}
-	a.ui.Settings().SetTheme(NewCustomTheme())
 
 	// Event handling
 	go func() {
-		for range a.eventChan {
+		for event := range a.eventChan {
 			fyne.CurrentApp().Driver().DoFromGoroutine(func() {
-				a.refreshUI()
+				a.refreshFor(event)
+				a.handleConfirmation(event)
+				a.refreshTray(event)
 			}, false)
 		}
 	}()
@@ -88,7 +139,6 @@ func NewApp(ep *eventsourcing.EventProcessor, agg *aggregate.AggregateManager, o
 		return nil
 	})
 
-	a.chatScroll.Direction = container.ScrollVerticalOnly
 	a.eventDetail.SetText("Select an event to view details")
 
 	a.transcriber.SetSessionEventCallback(func(eventType string, data map[string]interface{}) {
@@ -111,20 +161,40 @@ func NewApp(ep *eventsourcing.EventProcessor, agg *aggregate.AggregateManager, o
 	return a
 }
 
+// SetSpeaker lets the user mute the speech output; call it before InitUI
+func (a *App) SetSpeaker(speaker *tts.Speaker) {
+	a.speaker = speaker
+}
+
+// SetThemes lets the user pick the palette of the app and the 3D world; call it before InitUI
+func (a *App) SetThemes(manager *themes.Manager) {
+	a.themes = manager
+	manager.OnChange(func(name string, palette ui3d.Theme) {
+		fyne.CurrentApp().Driver().DoFromGoroutine(func() {
+			a.ui.Settings().SetTheme(NewCustomTheme(palette))
+			if a.themeSelect != nil {
+				a.themeSelect.SetOptions(a.themes.Names()) // The configured palettes may have changed
+				a.themeSelect.SetSelected(name)
+			}
+		}, false)
+	})
+	_, palette := manager.Current()
+	a.ui.Settings().SetTheme(NewCustomTheme(palette))
+}
+
 // InitUI initializes the UI components
 func (a *App) InitUI() {
-	events := a.eventProcessor.GetEvents()
 	a.eventLog.Length = func() int {
-		return len(events)
+		return len(a.events)
 	}
 	a.eventLog.UpdateItem = func(id widget.ListItemID, obj fyne.CanvasObject) {
-		obj.(*widget.Label).SetText(events[id].Type())
+		obj.(*widget.Label).SetText(a.events[id].Type())
 	}
 	a.eventLog.OnSelected = func(id widget.ListItemID) {
-		if id < 0 || id >= len(events) {
+		if id < 0 || id >= len(a.events) {
 			return
 		}
-		event := events[id]
+		event := a.events[id]
 		dataJSON, err := json.MarshalIndent(event, "", "  ") // Pretty-print JSON with 2-space indentation
 		if err != nil {
 			a.eventDetail.SetText(fmt.Sprintf("Error marshaling event data: %v", err))
@@ -141,6 +211,11 @@ func (a *App) InitUI() {
 	a.refreshUI()
 }
 
+// Quit closes the UI, making Run return
+func (a *App) Quit() {
+	a.ui.Quit()
+}
+
 // Run starts the UI application
 func (a *App) Run() {
 	window := a.ui.NewWindow("MindPalace")
@@ -149,6 +224,58 @@ func (a *App) Run() {
 	appHeader := widget.NewLabel("MindPalace")
 	appHeader.TextStyle = fyne.TextStyle{Bold: true}
 	appHeader.Alignment = fyne.TextAlignCenter
+	var header fyne.CanvasObject = appHeader
+	headerControls := container.NewHBox()
+	if a.themes != nil {
+		a.themeSelect = widget.NewSelect(a.themes.Names(), nil)
+		current, _ := a.themes.Current()
+		a.themeSelect.SetSelected(current)
+		a.themeSelect.OnChanged = func(name string) {
+			eventsourcing.SafeGo("SelectTheme", map[string]interface{}{"theme": name}, func() {
+				if err := a.eventProcessor.ExecuteCommand("SelectTheme", map[string]interface{}{"theme": name}); err != nil {
+					logging.Error("Failed to select theme: %v", err)
+				}
+			})
+		}
+		headerControls.Add(widget.NewLabel("Theme:"))
+		headerControls.Add(a.themeSelect)
+	}
+	if a.settings != nil {
+		headerControls.Add(widget.NewButtonWithIcon("", theme.SettingsIcon(), func() { a.showSettings(window) }))
+	}
+	if len(headerControls.Objects) > 0 {
+		header = container.NewBorder(nil, nil, nil, headerControls, appHeader)
+	}
+
+	// Session controls, the options are filled by refreshUI
+	a.sessionSelect = widget.NewSelect(nil, func(option string) {
+		sessionID, ok := a.sessionIDs[option]
+		if !ok || sessionID == a.activeSessionID() {
+			return
+		}
+		eventsourcing.SafeGo("SwitchSession", map[string]interface{}{"sessionID": sessionID}, func() {
+			if err := a.eventProcessor.ExecuteCommand("SwitchSession", map[string]interface{}{"sessionID": sessionID}); err != nil {
+				logging.Error("Failed to switch session: %v", err)
+			}
+		})
+	})
+	newSessionButton := widget.NewButton("New Session", func() {
+		eventsourcing.SafeGo("StartSession", nil, func() {
+			if err := a.eventProcessor.ExecuteCommand("StartSession", map[string]interface{}{}); err != nil {
+				logging.Error("Failed to start session: %v", err)
+			}
+		})
+	})
+	sessionBar := container.NewBorder(nil, nil, widget.NewLabel("Session:"), newSessionButton, a.sessionSelect)
+
+	// Search of the messages of all sessions
+	searchEntry := widget.NewEntry()
+	searchEntry.SetPlaceHolder("Search messages, e.g. dentist or #health...")
+	searchRole := widget.NewSelect([]string{"All", chat.RoleUser.UIRole, chat.RoleMindPalace.UIRole, chat.RoleAgent.UIRole, chat.RoleTool.UIRole}, nil)
+	searchRole.SetSelected("All")
+	search := func(string) { a.searchChat(searchEntry.Text, searchRole.Selected) }
+	searchEntry.OnSubmitted = search
+	searchBar := container.NewBorder(nil, nil, searchRole, widget.NewButton("Search", func() { search("") }), searchEntry)
 
 	startStopButton := widget.NewButton("Start Audio", nil)
 	startStopButton.Importance = widget.MediumImportance
@@ -159,68 +286,23 @@ func (a *App) Run() {
 	submitButton := widget.NewButton("Submit", nil)
 	submitButton.Importance = widget.HighImportance
 
+	cancelButton := widget.NewButton("Cancel", func() {
+		eventsourcing.SafeGo("CancelRequest", nil, func() {
+			if err := a.eventProcessor.ExecuteCommand("CancelRequest", map[string]interface{}{}); err != nil {
+				logging.Error("Failed to cancel request: %v", err)
+			}
+		})
+	})
+	cancelButton.Disable()
+
 	// Configure transcript box
 	a.transcriptBox.SetPlaceHolder("Type your request or speak using the 'Start Audio' button...")
 	a.transcriptBox.SetMinRowsVisible(5)
 	a.transcriptBox.Wrapping = fyne.TextWrapWord
 
 	// Define button behaviors
-	startStopButton.OnTapped = func() {
-		if !a.transcribing {
-			fyne.CurrentApp().Driver().DoFromGoroutine(func() {
-				a.transcriptBox.SetText("")
-			}, false)
-
-			err := a.transcriber.Start(func(text string) {
-				if strings.TrimSpace(text) != "" {
-					logging.Debug("AUDIO: Transcription: %s", text)
-					if a.godotServer != nil {
-						a.godotServer.SendTranscription(text)
-					}
-					// Still update Fyne UI for now (can be removed later)
-					eventsourcing.SafeGo("TranscriptionCallback", map[string]interface{}{
-						"text": text,
-					}, func() {
-						fyne.CurrentApp().Driver().DoFromGoroutine(func() {
-							current := a.transcriptBox.Text
-							if current == "" {
-								a.transcriptBox.SetText(text)
-							} else {
-								a.transcriptBox.SetText(current + " " + text)
-							}
-						}, false)
-					})
-				}
-			})
-			if err != nil {
-				logging.Error("Failed to start audio: %v", err)
-				fyne.CurrentApp().Driver().DoFromGoroutine(func() {
-					message := fmt.Sprintf("Audio error: %v\n\nPlease type your request instead.", err)
-					dialog.NewInformation("Audio Unavailable", message, fyne.CurrentApp().Driver().AllWindows()[0]).Show()
-					startStopButton.Importance = widget.WarningImportance
-					startStopButton.SetText("Audio Unavailable")
-					startStopButton.Disable()
-					submitButton.Enable() // Ensure submit remains available
-				}, false)
-				return
-			}
-
-			fyne.CurrentApp().Driver().DoFromGoroutine(func() {
-				startStopButton.SetText("Stop Audio")
-				startStopButton.Importance = widget.DangerImportance
-			}, false)
-			a.transcribing = true
-		} else {
-			eventsourcing.SafeGo("StopTranscription", nil, func() {
-				a.transcriber.Stop()
-			})
-			fyne.CurrentApp().Driver().DoFromGoroutine(func() {
-				startStopButton.SetText("Start Audio")
-				startStopButton.Importance = widget.MediumImportance
-			}, false)
-			a.transcribing = false
-		}
-	}
+	a.listenButton = startStopButton
+	startStopButton.OnTapped = a.toggleListening
 
 	submitButton.OnTapped = func() {
 		eventsourcing.SafeGo("SubmitTranscription", nil, func() {
@@ -233,6 +315,7 @@ func (a *App) Run() {
 				a.transcriptBox.SetText("Processing request...")
 				a.transcriptBox.Disable()
 				submitButton.Disable()
+				cancelButton.Enable()
 				processingSpinner.Show()
 			}, false)
 
@@ -247,6 +330,7 @@ func (a *App) Run() {
 				a.transcriptBox.SetText("")
 				a.transcriptBox.Enable()
 				submitButton.Enable()
+				cancelButton.Disable()
 				processingSpinner.Hide()
 			}, false)
 		})
@@ -257,13 +341,19 @@ func (a *App) Run() {
 	transcriptScroll.SetMinSize(fyne.NewSize(0, 100))
 
 	inputWithProgress := container.NewBorder(nil, processingSpinner, nil, nil, transcriptScroll)
-	inputArea := container.NewBorder(nil, nil, startStopButton, submitButton, inputWithProgress)
+	audioControls := container.NewVBox(startStopButton)
+	if a.speaker != nil {
+		muteCheck := widget.NewCheck("Mute voice", a.speaker.SetMuted)
+		muteCheck.SetChecked(a.speaker.Muted())
+		audioControls.Add(muteCheck)
+	}
+	inputArea := container.NewBorder(nil, nil, audioControls, container.NewVBox(submitButton, cancelButton), inputWithProgress)
 
 	chatInterface := container.NewBorder(
-		container.NewVBox(appHeader, widget.NewSeparator()),
+		container.NewVBox(header, sessionBar, searchBar, widget.NewSeparator()),
 		container.NewVBox(widget.NewSeparator(), inputArea),
 		nil, nil,
-		a.chatScroll,
+		a.chatArea,
 	)
 
 	// Plugin tabs
@@ -282,6 +372,8 @@ func (a *App) Run() {
 		}
 		a.pluginTabs.Append(container.NewTabItem(plugin.Name(), ui))
 	}
+	a.refreshUsage()
+	a.refreshAudit()
 
 	// Event log
 	split := container.NewHSplit(a.eventLog, a.eventDetail)
@@ -298,6 +390,8 @@ func (a *App) Run() {
 		window.SetContent(container.NewAppTabs(
 			container.NewTabItem("MindPalace", chatInterface),
 			container.NewTabItem("Plugins", a.pluginTabs),
+			container.NewTabItem("Usage", a.usageTab),
+			container.NewTabItem("Audit", a.auditTab),
 		))
 	})
 	getStartedBtn.Importance = widget.HighImportance
@@ -313,20 +407,110 @@ func (a *App) Run() {
 	window.SetContent(welcomeScreen)
 
 	window.Resize(fyne.NewSize(1000, 700))
+	a.setupTray(window)
 	window.ShowAndRun()
 }
 
-// refreshUI updates the UI components
-func (a *App) refreshUI() {
-	orchAgg, err := a.aggManager.AggregateByName("orchestration")
-	if err == nil {
-		chatContent := orchAgg.GetCustomUI().(*fyne.Container)
-		a.ChatHistory.Objects = chatContent.Objects // Update content directly
-		a.ChatHistory.Refresh()
-		a.chatScroll.ScrollToBottom() // Scroll to the latest message
-	} else {
-		logging.Error("Failed to get orchestration aggregate: %v", err)
+// toggleListening starts transcribing speech into the request box, or stops when it is transcribing
+func (a *App) toggleListening() {
+	if a.transcribing {
+		eventsourcing.SafeGo("StopTranscription", nil, func() {
+			a.transcriber.Stop()
+		})
+		a.transcribing = false
+		fyne.CurrentApp().Driver().DoFromGoroutine(a.showListening, false)
+		return
 	}
+	fyne.CurrentApp().Driver().DoFromGoroutine(func() {
+		a.transcriptBox.SetText("")
+	}, false)
+
+	err := a.transcriber.Start(func(text string) {
+		if strings.TrimSpace(text) != "" {
+			logging.Debug("AUDIO: Transcription: %s", text)
+			if a.godotServer != nil {
+				a.godotServer.SendTranscription(text)
+			}
+			// Still update Fyne UI for now (can be removed later)
+			eventsourcing.SafeGo("TranscriptionCallback", map[string]interface{}{
+				"text": text,
+			}, func() {
+				fyne.CurrentApp().Driver().DoFromGoroutine(func() {
+					current := a.transcriptBox.Text
+					if current == "" {
+						a.transcriptBox.SetText(text)
+					} else {
+						a.transcriptBox.SetText(current + " " + text)
+					}
+				}, false)
+			})
+		}
+	})
+	if err != nil {
+		logging.Error("Failed to start audio: %v", err)
+		fyne.CurrentApp().Driver().DoFromGoroutine(func() {
+			message := fmt.Sprintf("Audio error: %v\n\nPlease type your request instead.", err)
+			dialog.NewInformation("Audio Unavailable", message, fyne.CurrentApp().Driver().AllWindows()[0]).Show()
+			a.audioUnavailable = true
+			a.showListening()
+		}, false)
+		return
+	}
+	a.transcribing = true
+	fyne.CurrentApp().Driver().DoFromGoroutine(a.showListening, false)
+}
+
+// showListening shows whether speech is transcribed on the audio button and in the tray
+func (a *App) showListening() {
+	switch {
+	case a.audioUnavailable:
+		a.listenButton.Importance = widget.WarningImportance
+		a.listenButton.SetText("Audio Unavailable")
+		a.listenButton.Disable()
+	case a.transcribing:
+		a.listenButton.Importance = widget.DangerImportance
+		a.listenButton.SetText("Stop Audio")
+	default:
+		a.listenButton.Importance = widget.MediumImportance
+		a.listenButton.SetText("Start Audio")
+	}
+	a.refreshTray(nil)
+}
+
+// handleConfirmation asks the user to approve a destructive tool call in a dialog, and closes
+// the dialog when the tool call was answered elsewhere, e.g. in the chat
+func (a *App) handleConfirmation(event eventsourcing.Event) {
+	switch e := event.(type) {
+	case *orchestration.ToolCallConfirmationRequestedEvent:
+		windows := fyne.CurrentApp().Driver().AllWindows()
+		if len(windows) == 0 {
+			return
+		}
+		confirm := dialog.NewConfirm("Confirm "+e.Function, e.Prompt, func(approved bool) {
+			if _, open := a.confirmDialogs[e.ToolCallID]; !open {
+				return // Closed because the tool call was answered elsewhere
+			}
+			delete(a.confirmDialogs, e.ToolCallID)
+			data := map[string]interface{}{"toolCallID": e.ToolCallID, "approved": approved}
+			eventsourcing.SafeGo("ConfirmToolCall", data, func() {
+				if err := a.eventProcessor.ExecuteCommand("ConfirmToolCall", data); err != nil {
+					logging.Error("Failed to confirm tool call %s: %v", e.ToolCallID, err)
+				}
+			})
+		}, windows[0])
+		a.confirmDialogs[e.ToolCallID] = confirm
+		confirm.Show()
+	case *orchestration.ToolCallConfirmedEvent:
+		if confirm, open := a.confirmDialogs[e.ToolCallID]; open {
+			delete(a.confirmDialogs, e.ToolCallID)
+			confirm.Hide()
+		}
+	}
+}
+
+// refreshUI updates all the UI components
+func (a *App) refreshUI() {
+	a.refreshChatArea()
 
 	// Refresh plugin tabs if needed
 	if a.pluginTabs != nil && len(a.pluginTabs.Items) > 0 {
@@ -346,117 +530,328 @@ func (a *App) refreshUI() {
 		a.pluginTabs.Refresh()
 	}
 
-	// Refresh event log
-	events := a.eventProcessor.GetEvents()
-	a.eventLog.Length = func() int { return len(events) }
-	a.eventLog.UpdateItem = func(id widget.ListItemID, obj fyne.CanvasObject) {
-		obj.(*widget.Label).SetText(events[id].Type())
-	}
+	a.refreshUsage()
+	a.refreshAudit()
+
+	a.loadEvents()
 	a.eventLog.Refresh()
 }
 
-// parseMarkdownToCanvas converts Markdown text into a styled Fyne CanvasObject (unchanged)
-func parseMarkdownToCanvas(text string) fyne.CanvasObject {
-	lines := strings.Split(text, "\n")
-	content := container.NewVBox()
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+// refreshFor updates just the parts of the UI the event can change
+func (a *App) refreshFor(event eventsourcing.Event) {
+	for _, region := range a.regions {
+		if region.shows(event) {
+			region.refresh(event)
 		}
+	}
+}
 
-		switch {
-		case strings.HasPrefix(line, "# "):
-			label := widget.NewLabel(strings.TrimPrefix(line, "# "))
-			label.TextStyle = fyne.TextStyle{Bold: true}
-			content.Add(label)
-		case strings.HasPrefix(line, "## "):
-			label := widget.NewLabel(strings.TrimPrefix(line, "## "))
-			label.TextStyle = fyne.TextStyle{Bold: true}
-			content.Add(label)
-		case strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* "):
-			label := widget.NewLabel("• " + strings.TrimPrefix(strings.TrimPrefix(line, "- "), "* "))
-			content.Add(label)
-		case strings.HasPrefix(line, "```") && strings.HasSuffix(line, "```"):
-			codeText := strings.TrimPrefix(strings.TrimSuffix(line, "```"), "```")
-			codeLabel := widget.NewLabel(codeText)
-			codeLabel.TextStyle = fyne.TextStyle{Monospace: true}
-			codeLabel.Wrapping = fyne.TextWrapWord
-			content.Add(container.NewPadded(codeLabel))
-		default:
-			richText := widget.NewRichText()
-			richText.Segments = parseInlineMarkdown(line)
-			richText.Wrapping = fyne.TextWrapWord
-			content.Add(richText)
+// refreshChatArea shows the changes of the chat and its sessions
+func (a *App) refreshChatArea() {
+	orchAgg, err := a.aggManager.AggregateByName("orchestration")
+	if err != nil {
+		logging.Error("Failed to get orchestration aggregate: %v", err)
+		return
+	}
+	a.refreshChat(orchAgg)
+	a.refreshSessions()
+}
+
+// pluginTab returns the tab of the plugin the event belongs to, nil when it has none
+func (a *App) pluginTab(event eventsourcing.Event) *container.TabItem {
+	if a.pluginTabs == nil {
+		return nil
+	}
+	name := eventsourcing.AggregateOf(event.Type())
+	for _, tab := range a.pluginTabs.Items {
+		if tab.Text == name {
+			return tab
 		}
 	}
+	return nil
+}
+
+// refreshPluginTab shows the latest UI of the plugin the event belongs to
+func (a *App) refreshPluginTab(event eventsourcing.Event) {
+	tab := a.pluginTab(event)
+	agg, exists := a.aggManager.PluginAggregates[tab.Text]
+	if !exists {
+		return
+	}
+	if ui := agg.GetCustomUI(); ui != nil {
+		tab.Content = ui
+		a.pluginTabs.Refresh()
+	}
+}
 
-	return content
+// loadEvents adds the events stored after the last one in the event log, reading only those from the log
+func (a *App) loadEvents() {
+	var last int64
+	if len(a.events) > 0 {
+		last = a.events[len(a.events)-1].Metadata().Sequence
+	}
+	events, err := a.eventProcessor.QueryEvents(eventsourcing.EventQuery{After: last})
+	if err != nil {
+		logging.Error("Failed to load events: %v", err)
+		return
+	}
+	a.events = append(a.events, events...)
+}
+
+// appendToEventLog adds the event to the event log, refreshing only the rows in sight
+func (a *App) appendToEventLog(event eventsourcing.Event) {
+	if n := len(a.events); n > 0 && event.Metadata().Sequence <= a.events[n-1].Metadata().Sequence {
+		return // Loaded from the log already
+	}
+	a.events = append(a.events, event)
+	a.eventLog.Refresh()
 }
 
-// parseInlineMarkdown handles inline bold (**text**) and italic (*text*) formatting (unchanged)
-func parseInlineMarkdown(text string) []widget.RichTextSegment {
-	segments := []widget.RichTextSegment{}
-	remaining := text
-
-	for len(remaining) > 0 {
-		if boldStart := strings.Index(remaining, "**"); boldStart >= 0 {
-			if boldStart > 0 {
-				segments = append(segments, &widget.TextSegment{
-					Text:  remaining[:boldStart],
-					Style: widget.RichTextStyle{TextStyle: fyne.TextStyle{}},
-				})
+// refreshUsage shows the latest token usage summary in the usage tab
+func (a *App) refreshUsage() {
+	usageAgg, err := a.aggManager.AggregateByName("usage")
+	if err != nil {
+		return
+	}
+	a.usageTab.Objects = []fyne.CanvasObject{usageAgg.GetCustomUI()}
+	a.usageTab.Refresh()
+}
+
+// refreshAudit shows the latest changes and their causes in the audit tab
+func (a *App) refreshAudit() {
+	auditAgg, err := a.aggManager.AggregateByName("audit")
+	if err != nil {
+		return
+	}
+	a.auditTab.Objects = []fyne.CanvasObject{auditAgg.GetCustomUI()}
+	a.auditTab.Refresh()
+}
+
+// refreshChat shows the changes of the chat, creating its view on the first refresh
+func (a *App) refreshChat(orchAgg eventsourcing.Aggregate) {
+	if a.chatView != nil {
+		a.chatView.Update()
+		return
+	}
+	orch, ok := orchAgg.(*orchestration.OrchestrationAggregate)
+	if !ok {
+		return
+	}
+	a.chatView = orchestration.NewChatView(orch)
+	a.chatView.OnEdit = a.editRequest
+	a.chatView.OnFeedback = a.giveFeedback
+	a.chatView.OnPin = a.pinMessage
+	a.chatView.OnRedact = a.redactMessage
+	a.chatArea.Objects = []fyne.CanvasObject{a.chatView.Content()}
+	a.chatArea.Refresh()
+}
+
+// editRequest lets the user change the text of a request they sent and resubmit it as a revision,
+// the request as it was sent stays in the chat
+func (a *App) editRequest(requestID, text string) {
+	windows := fyne.CurrentApp().Driver().AllWindows()
+	if len(windows) == 0 {
+		return
+	}
+	entry := widget.NewMultiLineEntry()
+	entry.SetText(text)
+	entry.Wrapping = fyne.TextWrapWord
+	edit := dialog.NewForm("Edit request", "Resubmit", "Cancel", []*widget.FormItem{widget.NewFormItem("", entry)}, func(resubmit bool) {
+		if !resubmit || strings.TrimSpace(entry.Text) == "" || entry.Text == text {
+			return
+		}
+		data := map[string]interface{}{"requestText": entry.Text, "revises": requestID}
+		eventsourcing.SafeGo("EditRequest", data, func() {
+			if err := a.eventProcessor.ExecuteCommand("ProcessUserRequest", data); err != nil {
+				logging.Error("Failed to resubmit request %s: %v", requestID, err)
 			}
-			boldEnd := strings.Index(remaining[boldStart+2:], "**")
-			if boldEnd >= 0 {
-				boldText := remaining[boldStart+2 : boldStart+2+boldEnd]
-				if boldText != "" {
-					segments = append(segments, &widget.TextSegment{
-						Text:  boldText,
-						Style: widget.RichTextStyle{TextStyle: fyne.TextStyle{Bold: true}},
-					})
-				}
-				remaining = remaining[boldStart+2+boldEnd+2:]
-			} else {
-				segments = append(segments, &widget.TextSegment{
-					Text:  remaining,
-					Style: widget.RichTextStyle{TextStyle: fyne.TextStyle{}},
-				})
-				remaining = ""
+		})
+	}, windows[0])
+	edit.Resize(fyne.NewSize(500, 250))
+	edit.Show()
+}
+
+// giveFeedback asks for an optional comment on the rating of an answer and records the feedback
+func (a *App) giveFeedback(requestID, rating string) {
+	windows := fyne.CurrentApp().Driver().AllWindows()
+	if len(windows) == 0 {
+		return
+	}
+	entry := widget.NewMultiLineEntry()
+	entry.SetPlaceHolder("What was good or wrong about it? (optional)")
+	entry.Wrapping = fyne.TextWrapWord
+	correction := widget.NewCheck("Keep this in mind in later answers", nil)
+	title := "Good answer"
+	if rating == "down" {
+		title = "Bad answer"
+	}
+	form := dialog.NewForm(title, "Send", "Cancel", []*widget.FormItem{widget.NewFormItem("", entry), widget.NewFormItem("", correction)}, func(send bool) {
+		if !send {
+			return
+		}
+		data := map[string]interface{}{"requestID": requestID, "rating": rating, "comment": entry.Text, "correction": correction.Checked && strings.TrimSpace(entry.Text) != ""}
+		eventsourcing.SafeGo("GiveFeedback", data, func() {
+			if err := a.eventProcessor.ExecuteCommand("GiveFeedback", data); err != nil {
+				logging.Error("Failed to give feedback on request %s: %v", requestID, err)
 			}
-		} else if italicStart := strings.Index(remaining, "*"); italicStart >= 0 {
-			if italicStart > 0 {
-				segments = append(segments, &widget.TextSegment{
-					Text:  remaining[:italicStart],
-					Style: widget.RichTextStyle{TextStyle: fyne.TextStyle{}},
-				})
+		})
+	}, windows[0])
+	form.Resize(fyne.NewSize(500, 250))
+	form.Show()
+}
+
+// pinMessage lets the user shorten a message to the fact to pin, and pins it so it is part of every system prompt
+func (a *App) pinMessage(requestID, text string) {
+	windows := fyne.CurrentApp().Driver().AllWindows()
+	if len(windows) == 0 {
+		return
+	}
+	entry := widget.NewMultiLineEntry()
+	entry.SetText(text)
+	entry.Wrapping = fyne.TextWrapWord
+	pin := dialog.NewForm("Pin to memory", "Pin", "Cancel", []*widget.FormItem{widget.NewFormItem("", entry)}, func(pin bool) {
+		if !pin || strings.TrimSpace(entry.Text) == "" {
+			return
+		}
+		data := map[string]interface{}{"text": entry.Text, "requestID": requestID}
+		eventsourcing.SafeGo("PinFact", data, func() {
+			if err := a.eventProcessor.ExecuteCommand("PinFact", data); err != nil {
+				logging.Error("Failed to pin a message of request %s: %v", requestID, err)
 			}
-			italicEnd := strings.Index(remaining[italicStart+1:], "*")
-			if italicEnd >= 0 {
-				italicText := remaining[italicStart+1 : italicStart+1+italicEnd]
-				if italicText != "" {
-					segments = append(segments, &widget.TextSegment{
-						Text:  italicText,
-						Style: widget.RichTextStyle{TextStyle: fyne.TextStyle{Italic: true}},
-					})
-				}
-				remaining = remaining[italicStart+1+italicEnd+1:]
-			} else {
-				segments = append(segments, &widget.TextSegment{
-					Text:  remaining,
-					Style: widget.RichTextStyle{TextStyle: fyne.TextStyle{}},
-				})
-				remaining = ""
+		})
+	}, windows[0])
+	pin.Resize(fyne.NewSize(500, 250))
+	pin.Show()
+}
+
+// redactMessage asks for the text to scrub from a message, e.g. a phone number, and redacts it; without a
+// text the whole request is hidden
+func (a *App) redactMessage(requestID, text string) {
+	windows := fyne.CurrentApp().Driver().AllWindows()
+	if len(windows) == 0 {
+		return
+	}
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("Text to scrub, leave empty to hide the whole request")
+	everywhere := widget.NewCheck("Scrub it from all messages", nil)
+	quoted := widget.NewLabel(text)
+	quoted.Wrapping = fyne.TextWrapWord
+	redact := dialog.NewForm("Redact message", "Redact", "Cancel", []*widget.FormItem{widget.NewFormItem("", quoted), widget.NewFormItem("", entry), widget.NewFormItem("", everywhere)}, func(redact bool) {
+		if !redact {
+			return
+		}
+		data := map[string]interface{}{"requestID": requestID, "text": strings.TrimSpace(entry.Text)}
+		if everywhere.Checked && data["text"] != "" {
+			delete(data, "requestID")
+		}
+		eventsourcing.SafeGo("RedactMessage", data, func() {
+			if err := a.eventProcessor.ExecuteCommand("RedactMessage", data); err != nil {
+				logging.Error("Failed to redact a message of request %s: %v", requestID, err)
 			}
+		})
+	}, windows[0])
+	redact.Resize(fyne.NewSize(500, 300))
+	redact.Show()
+}
+
+// searchChat shows the messages of all sessions with the words or #tags of the text in a dialog; choosing
+// one switches to its session
+func (a *App) searchChat(text, role string) {
+	cm := a.chatManager()
+	windows := fyne.CurrentApp().Driver().AllWindows()
+	if cm == nil || len(windows) == 0 || strings.TrimSpace(text) == "" {
+		return
+	}
+	query := chat.MessageQuery{Limit: 100}
+	if role != "All" {
+		query.Role = role
+	}
+	for _, word := range strings.Fields(text) {
+		if strings.HasPrefix(word, "#") {
+			query.Tag = word
 		} else {
-			segments = append(segments, &widget.TextSegment{
-				Text:  remaining,
-				Style: widget.RichTextStyle{TextStyle: fyne.TextStyle{}},
-			})
-			remaining = ""
+			query.Text += word + " "
+		}
+	}
+	found := cm.SearchMessages(query)
+	if len(found) == 0 {
+		dialog.ShowInformation("Search", fmt.Sprintf("No messages found for %q", text), windows[0])
+		return
+	}
+	sessions := make(map[string]string)
+	for _, session := range cm.ListSessions() {
+		sessions[session.ID] = session.Title
+	}
+	var results dialog.Dialog
+	list := widget.NewList(
+		func() int { return len(found) },
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.Truncation = fyne.TextTruncateEllipsis
+			return label
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			msg := found[len(found)-1-id] // Most recent first
+			obj.(*widget.Label).SetText(fmt.Sprintf("%s  %s (%s): %s", msg.Timestamp.Local().Format("2006-01-02 15:04"), msg.Role.UIRole, sessions[msg.SessionID], strings.ReplaceAll(msg.Content, "\n", " ")))
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) {
+		sessionID := found[len(found)-1-id].SessionID
+		results.Hide()
+		if sessionID == cm.ActiveSession().ID {
+			return
 		}
+		eventsourcing.SafeGo("SwitchSession", map[string]interface{}{"sessionID": sessionID}, func() {
+			if err := a.eventProcessor.ExecuteCommand("SwitchSession", map[string]interface{}{"sessionID": sessionID}); err != nil {
+				logging.Error("Failed to switch session: %v", err)
+			}
+		})
 	}
+	results = dialog.NewCustom(fmt.Sprintf("%d messages found", len(found)), "Close", list, windows[0])
+	results.Resize(fyne.NewSize(700, 450))
+	results.Show()
+}
 
-	return segments
+// chatManager returns the chat manager of the orchestration aggregate
+func (a *App) chatManager() *chat.ChatManager {
+	orchAgg, err := a.aggManager.AggregateByName("orchestration")
+	if err != nil {
+		return nil
+	}
+	if orch, ok := orchAgg.(*orchestration.OrchestrationAggregate); ok {
+		return orch.GetChatManager()
+	}
+	return nil
+}
+
+// activeSessionID returns the ID of the active chat session
+func (a *App) activeSessionID() string {
+	if cm := a.chatManager(); cm != nil {
+		return cm.ActiveSession().ID
+	}
+	return ""
+}
+
+// refreshSessions updates the session select with the current sessions
+func (a *App) refreshSessions() {
+	cm := a.chatManager()
+	if a.sessionSelect == nil || cm == nil {
+		return
+	}
+	a.sessionIDs = make(map[string]string)
+	var options []string
+	selected := ""
+	for _, session := range cm.ListSessions() {
+		option := session.Title
+		if _, exists := a.sessionIDs[option]; exists {
+			option = fmt.Sprintf("%s (%s)", session.Title, session.ID)
+		}
+		a.sessionIDs[option] = session.ID
+		options = append(options, option)
+		if session.ID == cm.ActiveSession().ID {
+			selected = option
+		}
+	}
+	a.sessionSelect.SetOptions(options)
+	a.sessionSelect.SetSelected(selected)
 }
@@ -0,0 +1,79 @@
+package ui
+
+import (
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/internal/settings"
+	"mindpalace/internal/whispermodels"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// SetSettings lets the user change the settings in a dialog; call it before InitUI
+func (a *App) SetSettings(aggregate *settings.Aggregate) {
+	a.settings = aggregate
+}
+
+// showSettings shows the settings in a form, saving changes those the user edited. Settings left empty
+// are the configured ones.
+func (a *App) showSettings(window fyne.Window) {
+	if a.settings == nil {
+		return
+	}
+	fields := make(map[string]func() string)
+	var items []*widget.FormItem
+	for _, name := range settings.Names {
+		var field fyne.CanvasObject
+		value := a.settings.Value(name)
+		switch name {
+		case settings.WhisperModel, settings.Theme:
+			var options []string
+			if name == settings.WhisperModel {
+				for _, model := range whispermodels.Catalog {
+					options = append(options, model.Name)
+				}
+			} else if a.themes != nil {
+				options = a.themes.Names()
+			}
+			selection := widget.NewSelect(options, nil)
+			selection.PlaceHolder = "As configured"
+			selection.SetSelected(value)
+			fields[name] = func() string { return selection.Selected }
+			field = selection
+		default:
+			entry := widget.NewEntry()
+			entry.SetPlaceHolder("As configured")
+			entry.SetText(value)
+			fields[name] = func() string { return strings.TrimSpace(entry.Text) }
+			field = entry
+		}
+		items = append(items, widget.NewFormItem(settings.Label(name), field))
+	}
+
+	form := dialog.NewForm("Settings", "Save", "Cancel", items, func(save bool) {
+		if !save {
+			return
+		}
+		changes := make(map[string]string)
+		for _, name := range settings.Names {
+			if value := fields[name](); value != a.settings.Value(name) {
+				changes[name] = value
+			}
+		}
+		if len(changes) == 0 {
+			return
+		}
+		eventsourcing.SafeGo("ChangeSettings", nil, func() {
+			if err := settings.Change(a.eventProcessor.ExecuteCommand, changes); err != nil {
+				logging.Error("Failed to change settings: %v", err)
+				fyne.CurrentApp().Driver().DoFromGoroutine(func() { dialog.ShowError(err, window) }, false)
+			}
+		})
+	}, window)
+	form.Resize(fyne.NewSize(500, 450))
+	form.Show()
+}
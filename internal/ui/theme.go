@@ -1,54 +1,55 @@
 package ui
 
 import (
+	"image/color"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/theme"
+
+	"mindpalace/pkg/ui3d"
 )
 
-// CustomTheme overrides the default theme for a modern look and feel
+// CustomTheme draws the app in the palette the user picked, the one the 3D world is drawn in as well. The
+// colors the palette doesn't name come from the default theme, dark or light like the palette's background.
 type CustomTheme struct {
 	fyne.Theme
+	palette ui3d.Theme
+	variant fyne.ThemeVariant
 }
 
-//// Color overrides the default theme color for certain elements
-//func (t *CustomTheme) Color(name fyne.ThemeColorName, variant fyne.ThemeVariant) color.Color {
-//	switch name {
-//	case theme.ColorNameBackground:
-//		return color.NRGBA{R: 30, G: 30, B: 38, A: 255} // Dark navy background
-//	case theme.ColorNameForeground:
-//		return color.NRGBA{R: 240, G: 240, B: 250, A: 255} // Light text
-//	case theme.ColorNamePrimary:
-//		return color.NRGBA{R: 65, G: 105, B: 225, A: 255} // Royal blue for primary elements
-//	case theme.ColorNameButton:
-//		return color.NRGBA{R: 70, G: 130, B: 180, A: 255} // Steel blue for buttons
-//	case theme.ColorNameShadow:
-//		return color.NRGBA{R: 10, G: 10, B: 15, A: 100} // Subtle shadow
-//	case theme.ColorNameInputBackground:
-//		return color.NRGBA{R: 40, G: 40, B: 50, A: 255} // Slightly lighter than background
-//	default:
-//		return t.Theme.Color(name, variant)
-//	}
-//}
-//
-//// Size overrides the default sizes for better spacing and readability
-//func (t *CustomTheme) Size(name fyne.ThemeSizeName) float32 {
-//	switch name {
-//	case theme.SizeNameText:
-//		return 14 // Slightly larger text
-//	case theme.SizeNamePadding:
-//		return 8 // More padding for better spacing
-//	case theme.SizeNameInlineIcon:
-//		return 20 // Larger icons
-//	case theme.SizeNameScrollBar:
-//		return 10 // Wider scrollbars
-//	case theme.SizeNameSeparatorThickness:
-//		return 1.5 // Thicker separators
-//	default:
-//		return t.Theme.Size(name)
-//	}
-//}
+// NewCustomTheme creates a theme of the palette based on the default theme
+func NewCustomTheme(palette ui3d.Theme) *CustomTheme {
+	variant := theme.VariantDark
+	if !palette.Dark() {
+		variant = theme.VariantLight
+	}
+	return &CustomTheme{Theme: theme.DefaultTheme(), palette: palette, variant: variant}
+}
+
+// Color returns the palette's colors for the background, text and highlights
+func (t *CustomTheme) Color(name fyne.ThemeColorName, _ fyne.ThemeVariant) color.Color {
+	switch name {
+	case theme.ColorNameBackground:
+		return paletteColor(t.palette.Background)
+	case theme.ColorNameForeground:
+		return paletteColor(t.palette.Text)
+	case theme.ColorNamePrimary, theme.ColorNameHyperlink:
+		return paletteColor(t.palette.Primary)
+	case theme.ColorNameFocus, theme.ColorNameSelection:
+		accent := paletteColor(t.palette.Accent)
+		accent.A = 0x7f
+		return accent
+	}
+	return t.Theme.Color(name, t.variant)
+}
 
-// NewCustomTheme creates a new theme based on the default theme
-func NewCustomTheme() *CustomTheme {
-	return &CustomTheme{Theme: theme.DefaultTheme()}
+// paletteColor converts a color of a palette, RGB or RGBA from 0 to 1
+func paletteColor(rgba []float64) color.NRGBA {
+	component := func(i int) uint8 {
+		if i >= len(rgba) {
+			return 0xff
+		}
+		return uint8(rgba[i]*0xff + 0.5)
+	}
+	return color.NRGBA{R: component(0), G: component(1), B: component(2), A: component(3)}
 }
@@ -0,0 +1,151 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/internal/llmprocessor"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// tray is the MindPalace icon in the system tray. Its menu captures requests, starts and stops listening and
+// shows the state of the LLM and the tool calls waiting for approval, without the main window open.
+type tray struct {
+	app       desktop.App
+	menu      *fyne.Menu
+	listen    *fyne.MenuItem
+	llm       *fyne.MenuItem
+	approvals *fyne.MenuItem
+	llmStatus string // Message of the last status change of the LLM
+	listening bool   // Listening as the icon shows it
+}
+
+// setupTray adds the tray icon where the platform has a system tray. Closing the main window hides it to the
+// tray then, MindPalace quits from the tray's menu.
+func (a *App) setupTray(window fyne.Window) {
+	desk, ok := a.ui.(desktop.App)
+	if !ok {
+		return
+	}
+	showWindow := func() {
+		window.Show()
+		window.RequestFocus()
+	}
+	a.tray = &tray{
+		app:       desk,
+		listen:    fyne.NewMenuItem("Start listening", a.toggleListening),
+		llm:       fyne.NewMenuItem("LLM: online", nil),
+		approvals: fyne.NewMenuItem("No tool calls waiting for approval", showWindow),
+		llmStatus: "LLM: online",
+	}
+	a.tray.llm.Disabled = true
+	a.tray.approvals.Disabled = true
+	a.tray.menu = fyne.NewMenu("MindPalace",
+		fyne.NewMenuItem("Quick capture", a.showQuickCapture),
+		a.tray.listen,
+		fyne.NewMenuItemSeparator(),
+		a.tray.llm,
+		a.tray.approvals,
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Show MindPalace", showWindow),
+	)
+	desk.SetSystemTrayMenu(a.tray.menu)
+	desk.SetSystemTrayIcon(trayIcon(false))
+	window.SetCloseIntercept(window.Hide)
+}
+
+// refreshTray shows the state of listening, of the LLM and of the tool calls waiting for approval in the
+// tray, after an event or when the event is nil; the menu is only redrawn when it changed
+func (a *App) refreshTray(event eventsourcing.Event) {
+	t := a.tray
+	if t == nil {
+		return
+	}
+	if e, ok := event.(*llmprocessor.StatusChangedEvent); ok {
+		t.llmStatus = "LLM: " + e.Status
+		if e.Message != "" {
+			t.llmStatus = "LLM: " + e.Message
+		}
+	}
+	listen := "Start listening"
+	if a.transcribing {
+		listen = "Stop listening"
+	}
+	approvals := "No tool calls waiting for approval"
+	switch waiting := len(a.confirmDialogs); waiting {
+	case 0:
+	case 1:
+		approvals = "1 tool call waiting for approval"
+	default:
+		approvals = fmt.Sprintf("%d tool calls waiting for approval", waiting)
+	}
+	if t.listen.Label == listen && t.listen.Disabled == a.audioUnavailable && t.llm.Label == t.llmStatus && t.approvals.Label == approvals {
+		return
+	}
+	t.listen.Label = listen
+	t.listen.Disabled = a.audioUnavailable
+	t.llm.Label = t.llmStatus
+	t.approvals.Label = approvals
+	t.approvals.Disabled = len(a.confirmDialogs) == 0
+	t.menu.Refresh()
+	if t.listening != a.transcribing {
+		t.listening = a.transcribing
+		t.app.SetSystemTrayIcon(trayIcon(t.listening))
+	}
+}
+
+// trayIcon is the app's icon, or a record icon while listening
+func trayIcon(listening bool) fyne.Resource {
+	if listening {
+		return theme.MediaRecordIcon()
+	}
+	if icon := fyne.CurrentApp().Icon(); icon != nil {
+		return icon
+	}
+	return theme.ComputerIcon()
+}
+
+// showQuickCapture opens a small window in front of the others taking a request, it closes once the request
+// was sent with Enter or the Send button
+func (a *App) showQuickCapture() {
+	if a.quickCapture != nil {
+		a.quickCapture.Show()
+		a.quickCapture.RequestFocus()
+		return
+	}
+	window := a.ui.NewWindow("Quick capture")
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("Ask MindPalace...")
+	submit := func(string) {
+		text := strings.TrimSpace(entry.Text)
+		if text == "" {
+			return
+		}
+		data := map[string]interface{}{"requestText": text}
+		eventsourcing.SafeGo("ProcessUserRequest", data, func() {
+			if err := a.eventProcessor.ExecuteCommand("ProcessUserRequest", data); err != nil {
+				logging.Error("Failed to process the captured request: %v", err)
+			}
+		})
+		window.Close()
+	}
+	entry.OnSubmitted = submit
+	send := widget.NewButtonWithIcon("Send", theme.MailSendIcon(), func() { submit("") })
+	send.Importance = widget.HighImportance
+	window.SetContent(container.NewBorder(nil, nil, nil, send, entry))
+	window.Resize(fyne.NewSize(480, entry.MinSize().Height))
+	window.SetFixedSize(true)
+	window.CenterOnScreen()
+	window.SetOnClosed(func() { a.quickCapture = nil })
+	a.quickCapture = window
+	window.Show()
+	window.RequestFocus()
+	window.Canvas().Focus(entry)
+}
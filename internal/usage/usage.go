@@ -0,0 +1,249 @@
+// Package usage keeps track of the tokens consumed by LLM calls per request, per model and over time.
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// TokenUsageRecordedEvent records the tokens used by a single LLM call
+type TokenUsageRecordedEvent struct {
+	eventsourcing.EventMetadata
+	EventType        string `json:"event_type"`
+	RequestID        string `json:"request_id"`
+	Model            string `json:"model"`
+	Purpose          string `json:"purpose"` // What the call was for, e.g. "route" or an agent name
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	Estimated        bool   `json:"estimated,omitempty"` // Counted locally because the model reported none
+	Timestamp        string `json:"timestamp"`
+}
+
+func (e *TokenUsageRecordedEvent) Type() string { return "usage_TokenUsageRecorded" }
+func (e *TokenUsageRecordedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *TokenUsageRecordedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// UsageReportedEvent answers a ShowUsage command with a summary of the token consumption
+type UsageReportedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string            `json:"event_type"`
+	Today     Totals            `json:"today"`
+	ThisWeek  Totals            `json:"this_week"`
+	ByModel   map[string]Totals `json:"by_model"`
+	Summary   string            `json:"summary"`
+	Timestamp string            `json:"timestamp"`
+}
+
+func (e *UsageReportedEvent) Type() string { return "usage_UsageReported" }
+func (e *UsageReportedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *UsageReportedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("usage_TokenUsageRecorded", func() eventsourcing.Event { return &TokenUsageRecordedEvent{} })
+	eventsourcing.RegisterEvent("usage_UsageReported", func() eventsourcing.Event { return &UsageReportedEvent{} })
+	eventsourcing.RegisterTransientEvent("usage_UsageReported")
+}
+
+// Totals sums the tokens of a number of LLM calls
+type Totals struct {
+	Calls            int `json:"calls"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// Total returns the prompt and completion tokens together
+func (t Totals) Total() int {
+	return t.PromptTokens + t.CompletionTokens
+}
+
+func (t *Totals) add(e *TokenUsageRecordedEvent) {
+	t.Calls++
+	t.PromptTokens += e.PromptTokens
+	t.CompletionTokens += e.CompletionTokens
+}
+
+// UsageAggregate sums the recorded token usage per request, per model, per day and per week
+type UsageAggregate struct {
+	ByRequest map[string]*Totals
+	ByModel   map[string]*Totals
+	ByDay     map[string]*Totals // Keyed by local date, e.g. 2025-03-14
+	ByWeek    map[string]*Totals // Keyed by ISO week, e.g. 2025-W11
+	Mu        sync.RWMutex
+}
+
+// NewUsageAggregate creates an empty UsageAggregate
+func NewUsageAggregate() *UsageAggregate {
+	return &UsageAggregate{
+		ByRequest: make(map[string]*Totals),
+		ByModel:   make(map[string]*Totals),
+		ByDay:     make(map[string]*Totals),
+		ByWeek:    make(map[string]*Totals),
+	}
+}
+
+// ID returns the aggregate's identifier
+func (a *UsageAggregate) ID() string {
+	return "usage"
+}
+
+// ApplyEvent adds recorded token usage to the totals
+func (a *UsageAggregate) ApplyEvent(event eventsourcing.Event) error {
+	e, ok := event.(*TokenUsageRecordedEvent)
+	if !ok {
+		return nil
+	}
+	at, err := time.Parse(time.RFC3339, e.Timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid usage timestamp %q: %v", e.Timestamp, err)
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	addTo(a.ByRequest, e.RequestID, e)
+	addTo(a.ByModel, e.Model, e)
+	addTo(a.ByDay, dayKey(at), e)
+	addTo(a.ByWeek, weekKey(at), e)
+	return nil
+}
+
+func addTo(totals map[string]*Totals, key string, e *TokenUsageRecordedEvent) {
+	if totals[key] == nil {
+		totals[key] = &Totals{}
+	}
+	totals[key].add(e)
+}
+
+// dayKey returns the local date of a time
+func dayKey(t time.Time) string {
+	return t.Local().Format("2006-01-02")
+}
+
+// weekKey returns the local ISO week of a time
+func weekKey(t time.Time) string {
+	year, week := t.Local().ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// Request returns the tokens used by a request
+func (a *UsageAggregate) Request(requestID string) Totals {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return totalsOf(a.ByRequest, requestID)
+}
+
+// Day returns the tokens used on the day of the given time
+func (a *UsageAggregate) Day(t time.Time) Totals {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return totalsOf(a.ByDay, dayKey(t))
+}
+
+// Week returns the tokens used in the ISO week of the given time
+func (a *UsageAggregate) Week(t time.Time) Totals {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return totalsOf(a.ByWeek, weekKey(t))
+}
+
+// Models returns the tokens used per model
+func (a *UsageAggregate) Models() map[string]Totals {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	models := make(map[string]Totals, len(a.ByModel))
+	for model, totals := range a.ByModel {
+		models[model] = *totals
+	}
+	return models
+}
+
+func totalsOf(totals map[string]*Totals, key string) Totals {
+	if t, ok := totals[key]; ok {
+		return *t
+	}
+	return Totals{}
+}
+
+// Summary describes the token usage of the day and week of the given time and per model
+func (a *UsageAggregate) Summary(now time.Time) string {
+	today, week := a.Day(now), a.Week(now)
+	summary := fmt.Sprintf("Today: %s\nThis week: %s", describe(today), describe(week))
+	models := a.Models()
+	for _, model := range sortedModels(models) {
+		summary += fmt.Sprintf("\n%s: %s", model, describe(models[model]))
+	}
+	return summary
+}
+
+// sortedModels returns the model names in alphabetical order
+func sortedModels(models map[string]Totals) []string {
+	names := make([]string, 0, len(models))
+	for model := range models {
+		names = append(names, model)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func describe(t Totals) string {
+	return fmt.Sprintf("%d tokens (%d prompt, %d completion) in %d calls", t.Total(), t.PromptTokens, t.CompletionTokens, t.Calls)
+}
+
+// ShowUsageCommand reports the token consumption of today, this week and per model
+func (a *UsageAggregate) ShowUsageCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	now := time.Now()
+	return []eventsourcing.Event{&UsageReportedEvent{
+		EventType: "usage_UsageReported",
+		Today:     a.Day(now),
+		ThisWeek:  a.Week(now),
+		ByModel:   a.Models(),
+		Summary:   a.Summary(now),
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// GetCustomUI summarizes the daily and weekly token consumption and the usage per model
+func (a *UsageAggregate) GetCustomUI() fyne.CanvasObject {
+	now := time.Now()
+	items := container.NewVBox()
+	heading := func(text string) {
+		label := widget.NewLabel(text)
+		label.TextStyle = fyne.TextStyle{Bold: true}
+		items.Add(label)
+	}
+
+	heading("Last 7 days")
+	for i := 6; i >= 0; i-- {
+		day := now.AddDate(0, 0, -i)
+		items.Add(widget.NewLabel(fmt.Sprintf("%s: %s", day.Format("Mon Jan 2"), describe(a.Day(day)))))
+	}
+
+	heading("Last 4 weeks")
+	for i := 3; i >= 0; i-- {
+		week := now.AddDate(0, 0, -7*i)
+		items.Add(widget.NewLabel(fmt.Sprintf("%s: %s", weekKey(week), describe(a.Week(week)))))
+	}
+
+	heading("Per model")
+	models := a.Models()
+	if len(models) == 0 {
+		items.Add(widget.NewLabel("No tokens used yet"))
+	}
+	for _, model := range sortedModels(models) {
+		items.Add(widget.NewLabel(fmt.Sprintf("%s: %s", model, describe(models[model]))))
+	}
+	return container.NewVScroll(items)
+}
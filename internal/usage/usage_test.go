@@ -0,0 +1,100 @@
+package usage
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+func recorded(requestID, model string, prompt, completion int, at time.Time) *TokenUsageRecordedEvent {
+	return &TokenUsageRecordedEvent{
+		RequestID:        requestID,
+		Model:            model,
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		Timestamp:        at.UTC().Format(time.RFC3339),
+	}
+}
+
+func TestUsageAggregate_Totals(t *testing.T) {
+	wednesday := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	agg := NewUsageAggregate()
+	for _, e := range []*TokenUsageRecordedEvent{
+		recorded("req1", "llama3", 100, 20, wednesday),
+		recorded("req1", "gpt-oss:20b", 50, 10, wednesday),
+		recorded("req2", "llama3", 200, 40, wednesday.AddDate(0, 0, -1)),
+		recorded("req3", "llama3", 1000, 100, wednesday.AddDate(0, 0, -7)),
+	} {
+		if err := agg.ApplyEvent(e); err != nil {
+			t.Fatalf("ApplyEvent failed: %v", err)
+		}
+	}
+
+	if req1 := agg.Request("req1"); req1.Calls != 2 || req1.PromptTokens != 150 || req1.CompletionTokens != 30 {
+		t.Errorf("Unexpected totals for req1: %+v", req1)
+	}
+	if today := agg.Day(wednesday); today.Total() != 180 {
+		t.Errorf("Expected 180 tokens today, got %d", today.Total())
+	}
+	if week := agg.Week(wednesday); week.Calls != 3 || week.Total() != 420 {
+		t.Errorf("Expected 3 calls and 420 tokens this week, got %+v", week)
+	}
+	if llama := agg.Models()["llama3"]; llama.Calls != 3 || llama.Total() != 1460 {
+		t.Errorf("Unexpected totals for llama3: %+v", llama)
+	}
+	if unknown := agg.Request("missing"); unknown != (Totals{}) {
+		t.Errorf("Expected no usage for an unknown request, got %+v", unknown)
+	}
+
+	summary := agg.Summary(wednesday)
+	if !strings.Contains(summary, "Today: 180 tokens") || !strings.Contains(summary, "This week: 420 tokens") {
+		t.Errorf("Unexpected summary: %s", summary)
+	}
+	if strings.Index(summary, "gpt-oss:20b") > strings.Index(summary, "llama3") {
+		t.Errorf("Expected models in alphabetical order: %s", summary)
+	}
+}
+
+func TestUsageAggregate_IgnoresOtherEvents(t *testing.T) {
+	agg := NewUsageAggregate()
+	if err := agg.ApplyEvent(&UsageReportedEvent{}); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+	if err := agg.ApplyEvent(&TokenUsageRecordedEvent{Timestamp: "yesterday"}); err == nil {
+		t.Error("Expected an invalid timestamp to be rejected")
+	}
+	if len(agg.ByRequest) != 0 {
+		t.Errorf("Expected no usage, got %v", agg.ByRequest)
+	}
+}
+
+func TestShowUsageCommand(t *testing.T) {
+	agg := NewUsageAggregate()
+	agg.ApplyEvent(recorded("req1", "llama3", 100, 20, time.Now()))
+
+	events, err := eventsourcing.NewCommand(agg.ShowUsageCommand).Execute(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("ShowUsage failed: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	report := events[0].(*UsageReportedEvent)
+	if report.Today.Total() != 120 || report.ThisWeek.Total() != 120 || report.ByModel["llama3"].Calls != 1 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	data, err := report.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	decoded, err := eventsourcing.UnmarshalEvent(data)
+	if err != nil {
+		t.Fatalf("UnmarshalEvent failed: %v", err)
+	}
+	if decoded.(*UsageReportedEvent).Summary != report.Summary {
+		t.Errorf("Expected the summary to survive a round trip")
+	}
+}
@@ -0,0 +1,205 @@
+package whispermodels
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// progressStep is the percentage between two progress events of a download
+const progressStep = 10
+
+// Backend downloads model files and loads them for transcription, e.g. the VoiceTranscriber
+type Backend interface {
+	DownloadModel(ctx context.Context, file string, progress func(current, total uint64)) error
+	SwitchModel(ctx context.Context, file string) error
+	DownloadedModels() []string // File names of the downloaded models
+}
+
+// Manager downloads models in the background, publishing their progress, and switches between them
+type Manager struct {
+	backend  Backend
+	models   *ModelsAggregate
+	eventBus eventsourcing.EventBus
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewManager creates a manager for the models of the backend
+func NewManager(backend Backend, models *ModelsAggregate, eventBus eventsourcing.EventBus) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		backend:  backend,
+		models:   models,
+		eventBus: eventBus,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Stop cancels the downloads in progress and waits for them to end
+func (m *Manager) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// ListModelsCommand lists the catalog, which models are downloaded and the active model
+func (m *Manager) ListModelsCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	downloaded := make(map[string]bool)
+	for _, file := range m.backend.DownloadedModels() {
+		downloaded[ModelName(file)] = true
+	}
+	models := make([]ModelStatus, len(Catalog))
+	for i, info := range Catalog {
+		models[i] = ModelStatus{ModelInfo: info, Downloaded: downloaded[info.Name]}
+	}
+	return []eventsourcing.Event{&ModelsListedEvent{
+		EventType:   "whispermodels_ModelsListed",
+		Models:      models,
+		ActiveModel: m.models.ActiveModel(),
+		Timestamp:   eventsourcing.ISOTimestamp(),
+	}}, nil
+}
+
+// DownloadModelCommand starts downloading a model in the background
+func (m *Manager) DownloadModelCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if err := ownerOnly(data); err != nil {
+		return nil, err
+	}
+	model, err := m.modelArg(data)
+	if err != nil {
+		return nil, err
+	}
+	return m.startDownload(model, false), nil
+}
+
+// SwitchModelCommand switches transcription to a model, downloading it first when needed
+func (m *Manager) SwitchModelCommand(data map[string]interface{}) ([]eventsourcing.Event, error) {
+	if err := ownerOnly(data); err != nil {
+		return nil, err
+	}
+	model, err := m.modelArg(data)
+	if err != nil {
+		return nil, err
+	}
+	if !m.isDownloaded(model) {
+		return m.startDownload(model, true), nil
+	}
+	event, err := m.switchTo(model)
+	if err != nil {
+		return nil, err
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+// ownerOnly refuses commands of household members, the models are files of the owner's machine
+func ownerOnly(data map[string]interface{}) error {
+	if eventsourcing.UserOf(data) != "" {
+		return fmt.Errorf("only the owner downloads and switches transcription models")
+	}
+	return nil
+}
+
+// modelArg returns the catalog model named in the "model" field of a command
+func (m *Manager) modelArg(data map[string]interface{}) (string, error) {
+	model, _ := data["model"].(string)
+	if model == "" {
+		return "", fmt.Errorf("model must be a non-empty string")
+	}
+	if !known(model) {
+		return "", fmt.Errorf("unknown whisper model %s", model)
+	}
+	if m.models.Downloading(model) {
+		return "", fmt.Errorf("whisper model %s is already downloading", model)
+	}
+	return model, nil
+}
+
+func (m *Manager) isDownloaded(model string) bool {
+	for _, file := range m.backend.DownloadedModels() {
+		if ModelName(file) == model {
+			return true
+		}
+	}
+	return false
+}
+
+// startDownload returns the event starting a download and downloads the model in the background,
+// switching to it afterwards when requested
+func (m *Manager) startDownload(model string, switchAfter bool) []eventsourcing.Event {
+	logging.Info("Downloading whisper model %s", model)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.download(model, switchAfter)
+	}()
+	return []eventsourcing.Event{&ModelDownloadStartedEvent{
+		EventType: "whispermodels_ModelDownloadStarted",
+		Model:     model,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}
+}
+
+// download downloads a model, publishing its progress every progressStep percent
+func (m *Manager) download(model string, switchAfter bool) {
+	reported := 0
+	err := m.backend.DownloadModel(m.ctx, FileName(model), func(current, total uint64) {
+		if total == 0 {
+			return
+		}
+		percent := int(current * 100 / total)
+		if percent < reported+progressStep || percent >= 100 {
+			return
+		}
+		reported = percent - percent%progressStep
+		m.eventBus.Publish(&ModelDownloadProgressEvent{
+			EventType: "whispermodels_ModelDownloadProgress",
+			Model:     model,
+			Percent:   reported,
+			Timestamp: eventsourcing.ISOTimestamp(),
+		})
+	})
+	if err != nil {
+		logging.Error("Failed to download whisper model %s: %v", model, err)
+		m.eventBus.Publish(&ModelDownloadFailedEvent{
+			EventType: "whispermodels_ModelDownloadFailed",
+			Model:     model,
+			ErrorMsg:  err.Error(),
+			Timestamp: eventsourcing.ISOTimestamp(),
+		})
+		return
+	}
+	logging.Info("Downloaded whisper model %s", model)
+	m.eventBus.Publish(&ModelDownloadedEvent{
+		EventType: "whispermodels_ModelDownloaded",
+		Model:     model,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	})
+	if !switchAfter {
+		return
+	}
+	event, err := m.switchTo(model)
+	if err != nil {
+		logging.Error("Failed to switch to whisper model %s: %v", model, err)
+		return
+	}
+	m.eventBus.Publish(event)
+}
+
+// switchTo loads a downloaded model for transcription
+func (m *Manager) switchTo(model string) (eventsourcing.Event, error) {
+	if err := m.backend.SwitchModel(m.ctx, FileName(model)); err != nil {
+		return nil, fmt.Errorf("failed to switch to whisper model %s: %v", model, err)
+	}
+	logging.Info("Switched to whisper model %s", model)
+	return &ModelSwitchedEvent{
+		EventType: "whispermodels_ModelSwitched",
+		Model:     model,
+		Previous:  m.models.ActiveModel(),
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}, nil
+}
@@ -0,0 +1,257 @@
+// Package whispermodels manages the Whisper speech recognition models: which ones are available,
+// downloading them with progress events, and switching the model used for transcription.
+package whispermodels
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// DefaultModel is used until the user switches to another model
+const DefaultModel = "base.en"
+
+// ModelInfo describes a Whisper model that can be downloaded
+type ModelInfo struct {
+	Name   string `json:"name"`
+	SizeMB int    `json:"size_mb"`
+}
+
+// Catalog lists the Whisper models that can be downloaded, smallest first. The ".en" models only
+// understand English but are more accurate at the same size.
+var Catalog = []ModelInfo{
+	{Name: "tiny.en", SizeMB: 75},
+	{Name: "tiny", SizeMB: 75},
+	{Name: "base.en", SizeMB: 142},
+	{Name: "base", SizeMB: 142},
+	{Name: "small.en", SizeMB: 466},
+	{Name: "small", SizeMB: 466},
+	{Name: "medium.en", SizeMB: 1500},
+	{Name: "medium", SizeMB: 1500},
+	{Name: "large-v3", SizeMB: 2900},
+}
+
+// FileName returns the name of the file a model is stored in
+func FileName(model string) string {
+	return "ggml-" + model + ".bin"
+}
+
+// ModelName returns the model stored in a file, the reverse of FileName
+func ModelName(file string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(file, "ggml-"), ".bin")
+}
+
+// known reports whether a model is in the catalog
+func known(model string) bool {
+	for _, info := range Catalog {
+		if info.Name == model {
+			return true
+		}
+	}
+	return false
+}
+
+// ModelDownloadStartedEvent is emitted when a model starts downloading
+type ModelDownloadStartedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Model     string `json:"model"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *ModelDownloadStartedEvent) Type() string { return "whispermodels_ModelDownloadStarted" }
+func (e *ModelDownloadStartedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ModelDownloadStartedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ModelDownloadProgressEvent reports how far a download is, in steps of progressStep percent
+type ModelDownloadProgressEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Model     string `json:"model"`
+	Percent   int    `json:"percent"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *ModelDownloadProgressEvent) Type() string { return "whispermodels_ModelDownloadProgress" }
+func (e *ModelDownloadProgressEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ModelDownloadProgressEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ModelDownloadedEvent is emitted when a model finished downloading
+type ModelDownloadedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Model     string `json:"model"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *ModelDownloadedEvent) Type() string { return "whispermodels_ModelDownloaded" }
+func (e *ModelDownloadedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ModelDownloadedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ModelDownloadFailedEvent is emitted when a model could not be downloaded
+type ModelDownloadFailedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Model     string `json:"model"`
+	ErrorMsg  string `json:"error_msg"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *ModelDownloadFailedEvent) Type() string { return "whispermodels_ModelDownloadFailed" }
+func (e *ModelDownloadFailedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ModelDownloadFailedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ModelSwitchedEvent is emitted when transcription switched to another model
+type ModelSwitchedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Model     string `json:"model"`
+	Previous  string `json:"previous,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *ModelSwitchedEvent) Type() string { return "whispermodels_ModelSwitched" }
+func (e *ModelSwitchedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ModelSwitchedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ModelStatus is a catalog model and whether it is downloaded
+type ModelStatus struct {
+	ModelInfo
+	Downloaded bool `json:"downloaded"`
+}
+
+// ModelsListedEvent answers a ListWhisperModels command
+type ModelsListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType   string        `json:"event_type"`
+	Models      []ModelStatus `json:"models"`
+	ActiveModel string        `json:"active_model"`
+	Timestamp   string        `json:"timestamp"`
+}
+
+func (e *ModelsListedEvent) Type() string { return "whispermodels_ModelsListed" }
+func (e *ModelsListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ModelsListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("whispermodels_ModelDownloadStarted", func() eventsourcing.Event { return &ModelDownloadStartedEvent{} })
+	eventsourcing.RegisterEvent("whispermodels_ModelDownloadProgress", func() eventsourcing.Event { return &ModelDownloadProgressEvent{} })
+	eventsourcing.RegisterEvent("whispermodels_ModelDownloaded", func() eventsourcing.Event { return &ModelDownloadedEvent{} })
+	eventsourcing.RegisterEvent("whispermodels_ModelDownloadFailed", func() eventsourcing.Event { return &ModelDownloadFailedEvent{} })
+	eventsourcing.RegisterEvent("whispermodels_ModelSwitched", func() eventsourcing.Event { return &ModelSwitchedEvent{} })
+	eventsourcing.RegisterEvent("whispermodels_ModelsListed", func() eventsourcing.Event { return &ModelsListedEvent{} })
+}
+
+// ModelsAggregate tracks the downloaded models, the downloads in progress and the active model
+type ModelsAggregate struct {
+	Downloaded map[string]bool
+	Downloads  map[string]int    // Percentage of the downloads in progress
+	Failed     map[string]string // Error of the last failed download per model
+	Active     string
+	Mu         sync.RWMutex
+}
+
+// NewModelsAggregate creates an empty ModelsAggregate
+func NewModelsAggregate() *ModelsAggregate {
+	return &ModelsAggregate{
+		Downloaded: make(map[string]bool),
+		Downloads:  make(map[string]int),
+		Failed:     make(map[string]string),
+	}
+}
+
+// ID returns the aggregate's identifier
+func (a *ModelsAggregate) ID() string {
+	return "whispermodels"
+}
+
+// ApplyEvent updates the model state
+func (a *ModelsAggregate) ApplyEvent(event eventsourcing.Event) error {
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	switch e := event.(type) {
+	case *ModelDownloadStartedEvent:
+		a.Downloads[e.Model] = 0
+		delete(a.Failed, e.Model)
+	case *ModelDownloadProgressEvent:
+		a.Downloads[e.Model] = e.Percent
+	case *ModelDownloadedEvent:
+		delete(a.Downloads, e.Model)
+		a.Downloaded[e.Model] = true
+	case *ModelDownloadFailedEvent:
+		delete(a.Downloads, e.Model)
+		a.Failed[e.Model] = e.ErrorMsg
+	case *ModelSwitchedEvent:
+		a.Active = e.Model
+		a.Downloaded[e.Model] = true
+	case *ModelsListedEvent:
+		for _, model := range e.Models {
+			a.Downloaded[model.Name] = model.Downloaded
+		}
+		a.Active = e.ActiveModel
+	}
+	return nil
+}
+
+// ActiveModel returns the model transcription last switched to
+func (a *ModelsAggregate) ActiveModel() string {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return a.Active
+}
+
+// Downloading reports whether a model is being downloaded
+func (a *ModelsAggregate) Downloading(model string) bool {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	_, ok := a.Downloads[model]
+	return ok
+}
+
+// GetCustomUI lists the catalog with the status of each model
+func (a *ModelsAggregate) GetCustomUI() fyne.CanvasObject {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	items := container.NewVBox()
+	for _, info := range Catalog {
+		status := "not downloaded"
+		switch {
+		case info.Name == a.Active:
+			status = "active"
+		case a.Downloaded[info.Name]:
+			status = "downloaded"
+		}
+		if percent, ok := a.Downloads[info.Name]; ok {
+			status = fmt.Sprintf("downloading %d%%", percent)
+		} else if msg, ok := a.Failed[info.Name]; ok {
+			status = "download failed: " + msg
+		}
+		items.Add(widget.NewLabel(fmt.Sprintf("%s (%d MB) - %s", info.Name, info.SizeMB, status)))
+	}
+	return container.NewVScroll(items)
+}
@@ -0,0 +1,163 @@
+package whispermodels
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Mock implementations for testing
+
+type mockBackend struct {
+	files    []string
+	active   string
+	failWith error
+}
+
+func (b *mockBackend) DownloadModel(ctx context.Context, file string, progress func(current, total uint64)) error {
+	if b.failWith != nil {
+		return b.failWith
+	}
+	for current := uint64(0); current <= 100; current += 5 {
+		progress(current, 100)
+	}
+	b.files = append(b.files, file)
+	return nil
+}
+
+func (b *mockBackend) SwitchModel(ctx context.Context, file string) error {
+	b.active = file
+	return nil
+}
+
+func (b *mockBackend) DownloadedModels() []string { return b.files }
+
+// mockBus applies published events to the models aggregate like the real bus does
+type mockBus struct {
+	mu        sync.Mutex
+	models    *ModelsAggregate
+	published []eventsourcing.Event
+}
+
+func (b *mockBus) Publish(event eventsourcing.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.models.ApplyEvent(event)
+	b.published = append(b.published, event)
+}
+func (b *mockBus) Subscribe(eventType string, handler eventsourcing.EventHandler) {}
+func (b *mockBus) SubscribeAll(handler eventsourcing.EventHandler)                {}
+
+func newTestManager(backend *mockBackend) (*Manager, *ModelsAggregate, *mockBus) {
+	models := NewModelsAggregate()
+	bus := &mockBus{models: models}
+	return NewManager(backend, models, bus), models, bus
+}
+
+func TestFileName(t *testing.T) {
+	if file := FileName("base.en"); file != "ggml-base.en.bin" {
+		t.Errorf("Unexpected file name %s", file)
+	}
+	if model := ModelName("ggml-large-v3.bin"); model != "large-v3" {
+		t.Errorf("Unexpected model name %s", model)
+	}
+}
+
+func TestListModelsCommand(t *testing.T) {
+	manager, models, _ := newTestManager(&mockBackend{files: []string{"ggml-base.en.bin"}})
+	models.ApplyEvent(&ModelSwitchedEvent{Model: "base.en"})
+
+	events, err := manager.ListModelsCommand(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	listed := events[0].(*ModelsListedEvent)
+	if len(listed.Models) != len(Catalog) || listed.ActiveModel != "base.en" {
+		t.Fatalf("Expected the whole catalog with base.en active, got %+v", listed)
+	}
+	for _, model := range listed.Models {
+		if model.Downloaded != (model.Name == "base.en") {
+			t.Errorf("Unexpected download status for %s: %v", model.Name, model.Downloaded)
+		}
+	}
+}
+
+func TestSwitchModelCommand_DownloadsFirst(t *testing.T) {
+	backend := &mockBackend{files: []string{"ggml-base.en.bin"}}
+	manager, models, bus := newTestManager(backend)
+
+	events, err := manager.SwitchModelCommand(map[string]interface{}{"model": "small.en"})
+	if err != nil {
+		t.Fatalf("SwitchModel failed: %v", err)
+	}
+	if _, ok := events[0].(*ModelDownloadStartedEvent); !ok {
+		t.Fatalf("Expected the download to start, got %T", events[0])
+	}
+	models.ApplyEvent(events[0])
+	manager.Stop()
+
+	progress := 0
+	for _, event := range bus.published {
+		if e, ok := event.(*ModelDownloadProgressEvent); ok {
+			progress++
+			if e.Percent%progressStep != 0 {
+				t.Errorf("Expected progress in steps of %d%%, got %d%%", progressStep, e.Percent)
+			}
+		}
+	}
+	if progress != 9 {
+		t.Errorf("Expected progress events at 10%% to 90%%, got %d", progress)
+	}
+	if backend.active != "ggml-small.en.bin" || models.ActiveModel() != "small.en" {
+		t.Errorf("Expected to switch to small.en, got backend %s, aggregate %s", backend.active, models.ActiveModel())
+	}
+	if !models.Downloaded["small.en"] || models.Downloading("small.en") {
+		t.Errorf("Expected small.en to be downloaded, got %+v", models)
+	}
+
+	// A downloaded model is switched to right away
+	events, err = manager.SwitchModelCommand(map[string]interface{}{"model": "base.en"})
+	if err != nil {
+		t.Fatalf("SwitchModel failed: %v", err)
+	}
+	switched, ok := events[0].(*ModelSwitchedEvent)
+	if !ok || switched.Model != "base.en" || switched.Previous != "small.en" {
+		t.Errorf("Expected a switch from small.en to base.en, got %+v", events[0])
+	}
+}
+
+func TestDownloadModelCommand_Failure(t *testing.T) {
+	manager, models, bus := newTestManager(&mockBackend{failWith: errors.New("offline")})
+
+	events, err := manager.DownloadModelCommand(map[string]interface{}{"model": "tiny"})
+	if err != nil {
+		t.Fatalf("DownloadModel failed: %v", err)
+	}
+	models.ApplyEvent(events[0])
+	manager.Stop()
+
+	failed, ok := bus.published[len(bus.published)-1].(*ModelDownloadFailedEvent)
+	if !ok || failed.ErrorMsg != "offline" {
+		t.Fatalf("Expected a failed download, got %+v", bus.published)
+	}
+	if models.Failed["tiny"] != "offline" || models.Downloading("tiny") {
+		t.Errorf("Expected the failure to be recorded, got %+v", models)
+	}
+}
+
+func TestModelCommands_InvalidModel(t *testing.T) {
+	manager, models, _ := newTestManager(&mockBackend{})
+	if _, err := manager.DownloadModelCommand(map[string]interface{}{}); err == nil {
+		t.Error("Expected an error for a missing model")
+	}
+	if _, err := manager.SwitchModelCommand(map[string]interface{}{"model": "huge"}); err == nil {
+		t.Error("Expected an error for an unknown model")
+	}
+	models.ApplyEvent(&ModelDownloadStartedEvent{Model: "tiny"})
+	if _, err := manager.DownloadModelCommand(map[string]interface{}{"model": "tiny"}); err == nil {
+		t.Error("Expected an error for a model that is already downloading")
+	}
+}
@@ -1,15 +1,26 @@
 package aggregate
 
 import (
+	"errors"
 	"fmt"
 	"mindpalace/pkg/eventsourcing"
 	"mindpalace/pkg/logging"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
 )
 
 // AggregateManager acts as a facade to manage multiple plugin aggregates.
 type AggregateManager struct {
 	PluginAggregates map[string]eventsourcing.Aggregate // Map of plugin name to its aggregate
 	SystemAggregate  map[string]eventsourcing.Aggregate
+	Snapshots        eventsourcing.SnapshotStore // Optional, lets RebuildState skip already snapshotted events
+	// Optional, called as RebuildState finishes each aggregate, one call at a time
+	OnRebuildProgress func(RebuildProgress)
+
+	users   map[string]map[string]eventsourcing.Aggregate // User -> plugin name -> the user's own aggregate
+	perUser map[string]bool                               // Plugins whose aggregate users have their own instance of
 }
 
 // NewAggregateManager creates a new AggregateManager.
@@ -17,6 +28,8 @@ func NewAggregateManager() *AggregateManager {
 	return &AggregateManager{
 		PluginAggregates: make(map[string]eventsourcing.Aggregate),
 		SystemAggregate:  make(map[string]eventsourcing.Aggregate),
+		users:            make(map[string]map[string]eventsourcing.Aggregate),
+		perUser:          make(map[string]bool),
 	}
 }
 
@@ -27,6 +40,104 @@ func (m *AggregateManager) RegisterAggregate(name string, agg eventsourcing.Aggr
 	logging.Info("Registered aggregate for plugin: %s", name)
 }
 
+// RegisterUserAggregate adds a user's own instance of a plugin's aggregate. From then on the plugin's
+// aggregate registered with RegisterAggregate belongs to the owner and applies the owner's events only.
+func (m *AggregateManager) RegisterUserAggregate(userID, name string, agg eventsourcing.Aggregate) {
+	if m.users[userID] == nil {
+		m.users[userID] = make(map[string]eventsourcing.Aggregate)
+	}
+	m.users[userID][name] = agg
+	m.perUser[name] = true
+	logging.Info("Registered aggregate for plugin %s of user %s", name, userID)
+}
+
+// Users returns the users with aggregates of their own
+func (m *AggregateManager) Users() []string {
+	users := make([]string, 0, len(m.users))
+	for userID := range m.users {
+		users = append(users, userID)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// UserAggregates returns the user's own aggregates
+func (m *AggregateManager) UserAggregates(userID string) (aggs []eventsourcing.Aggregate) {
+	for _, agg := range m.users[userID] {
+		aggs = append(aggs, agg)
+	}
+	return aggs
+}
+
+// AggregatesOf returns the aggregates the user's events are applied to: the user's own instances in
+// place of the owner's, and the aggregates shared by everyone. The owner, the empty user, has
+// AllAggregates. What the user may read of them is VisibleAggregatesOf.
+func (m *AggregateManager) AggregatesOf(userID string) (aggs []eventsourcing.Aggregate) {
+	if userID == "" {
+		return m.AllAggregates()
+	}
+	for name, agg := range m.PluginAggregates {
+		if m.perUser[name] {
+			agg = m.users[userID][name]
+		}
+		if agg != nil {
+			aggs = append(aggs, agg)
+		}
+	}
+	for _, agg := range m.SystemAggregate {
+		aggs = append(aggs, agg)
+	}
+	return aggs
+}
+
+// VisibleAggregatesOf returns the aggregates the user may read: the user's own instances, and the
+// shared aggregates that show a user their own part, see eventsourcing.UserSnapshotter. The owner,
+// the empty user, sees AllAggregates.
+func (m *AggregateManager) VisibleAggregatesOf(userID string) (aggs []eventsourcing.Aggregate) {
+	if userID == "" {
+		return m.AllAggregates()
+	}
+	for _, agg := range m.AggregatesOf(userID) {
+		if m.visibleTo(userID, agg) {
+			aggs = append(aggs, agg)
+		}
+	}
+	return aggs
+}
+
+// UserAggregateByName returns the aggregate with the name as the user sees it, see VisibleAggregatesOf
+func (m *AggregateManager) UserAggregateByName(userID, name string) (eventsourcing.Aggregate, error) {
+	if userID == "" {
+		return m.AggregateByName(name)
+	}
+	if m.perUser[name] {
+		if agg, exists := m.users[userID][name]; exists {
+			return agg, nil
+		}
+		return nil, fmt.Errorf("Unable to get aggregate by name")
+	}
+	agg, err := m.AggregateByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if !m.visibleTo(userID, agg) {
+		return nil, fmt.Errorf("Unable to get aggregate by name")
+	}
+	return agg, nil
+}
+
+// visibleTo reports whether a household member may read the aggregate: their own, or a shared one
+// showing them their part only
+func (m *AggregateManager) visibleTo(userID string, agg eventsourcing.Aggregate) bool {
+	for _, own := range m.users[userID] {
+		if own == agg {
+			return true
+		}
+	}
+	_, ok := agg.(eventsourcing.UserSnapshotter)
+	return ok
+}
+
 func (m *AggregateManager) AggregateByName(requestedName string) (eventsourcing.Aggregate, error) {
 	for pluginAggName, agg := range m.PluginAggregates {
 		if requestedName == pluginAggName {
@@ -51,22 +162,218 @@ func (m *AggregateManager) AllAggregates() (aggs []eventsourcing.Aggregate) {
 	return aggs
 }
 
+// QueryableAggregates returns the names of the aggregates the user sees that share their state by
+// implementing eventsourcing.StateQuerier, sorted
+func (m *AggregateManager) QueryableAggregates(userID string) []string {
+	names := []string{}
+	for name, agg := range m.namedAggregatesOf(userID) {
+		if _, ok := agg.(eventsourcing.StateQuerier); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// QueryState returns the state the named aggregates of the user share, by name, or that of all
+// queryable aggregates when no names are given. Aggregates that don't share their state are left out.
+func (m *AggregateManager) QueryState(userID string, names []string) map[string]any {
+	aggs := m.namedAggregatesOf(userID)
+	if len(names) == 0 {
+		names = m.QueryableAggregates(userID)
+	}
+	state := make(map[string]any)
+	for _, name := range names {
+		if querier, ok := aggs[name].(eventsourcing.StateQuerier); ok {
+			state[name] = querier.QueryState()
+		}
+	}
+	return state
+}
+
+// namedAggregatesOf returns the aggregates the user sees by name, see AggregatesOf
+func (m *AggregateManager) namedAggregatesOf(userID string) map[string]eventsourcing.Aggregate {
+	aggs := make(map[string]eventsourcing.Aggregate)
+	for name, agg := range m.PluginAggregates {
+		if userID != "" && m.perUser[name] {
+			agg = m.users[userID][name]
+		}
+		if agg != nil {
+			aggs[name] = agg
+		}
+	}
+	for name, agg := range m.SystemAggregate {
+		aggs[name] = agg
+	}
+	return aggs
+}
+
 // ID returns a generic identifier for the manager (not tied to a single aggregate).
 func (m *AggregateManager) ID() string {
 	return "system"
 }
 
-// ApplyEvent routes the event to the appropriate plugin aggregate or handles core events.
+// RebuildProgress is how far RebuildState got, reported after each aggregate rebuilt
+type RebuildProgress struct {
+	Aggregate string // Snapshot ID of the aggregate just rebuilt, see eventsourcing.SnapshotID
+	Done      int    // Aggregates rebuilt so far
+	Total     int
+	Events    int // Events replayed into the aggregate
+}
+
+// rebuildJob is an aggregate to rebuild from the events at the positions given
+type rebuildJob struct {
+	agg        eventsourcing.Aggregate
+	snapshotID string
+	positions  []int // Positions in the log of the events the aggregate applies, nil for all
+}
+
+// RebuildState replays events into all aggregates, starting from the latest snapshot when available.
+// Events an aggregate already applied are skipped, so replaying them again leaves the state as is.
+// Aggregates of a single user only apply that user's events. The aggregates are rebuilt concurrently,
+// each applying its events in order, and OnRebuildProgress is called as each one is done.
 func (m *AggregateManager) RebuildState(events []eventsourcing.Event) error {
-	logging.Info("Rebuilding state for %d events across %d aggregates", len(events), len(m.AllAggregates()))
-	for _, event := range events {
+	jobs := m.rebuildJobs(events)
+	logging.Info("Rebuilding state for %d events across %d aggregates", len(events), len(jobs))
+	started := time.Now()
+
+	workers := min(runtime.GOMAXPROCS(0), len(jobs))
+	queue := make(chan rebuildJob)
+	var mu sync.Mutex
+	var errs []error
+	done := 0
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				applied, err := m.rebuild(job, events)
+				mu.Lock()
+				done++
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %v", job.snapshotID, err))
+				}
+				progress := RebuildProgress{Aggregate: job.snapshotID, Done: done, Total: len(jobs), Events: applied}
+				if m.OnRebuildProgress != nil {
+					m.OnRebuildProgress(progress)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+	logging.Info("Rebuilt %d aggregates in %v", len(jobs), time.Since(started).Round(time.Millisecond))
+	return errors.Join(errs...)
+}
+
+// rebuildJobs partitions the events among the aggregates: the aggregates of a single user, and the
+// owner's instance of such a plugin, get the positions of that user's events, the others all events
+func (m *AggregateManager) rebuildJobs(events []eventsourcing.Event) []rebuildJob {
+	byUser := make(map[string][]int)
+	for i, event := range events {
+		userID := event.Metadata().UserID
+		byUser[userID] = append(byUser[userID], i)
+	}
+	own := func(userID string) []int {
+		if positions := byUser[userID]; positions != nil {
+			return positions
+		}
+		return []int{}
+	}
+	var jobs []rebuildJob
+	for name, agg := range m.PluginAggregates {
+		job := rebuildJob{agg: agg, snapshotID: agg.ID()}
+		if m.perUser[name] {
+			job.positions = own("")
+		}
+		jobs = append(jobs, job)
+	}
+	for _, agg := range m.SystemAggregate {
+		jobs = append(jobs, rebuildJob{agg: agg, snapshotID: agg.ID()})
+	}
+	for _, userID := range m.Users() {
+		for _, agg := range m.UserAggregates(userID) {
+			jobs = append(jobs, rebuildJob{agg: agg, snapshotID: eventsourcing.SnapshotID(userID, agg.ID()), positions: own(userID)})
+		}
+	}
+	return jobs
+}
+
+// rebuild replays the job's events into its aggregate from its snapshot on and returns the number applied
+func (m *AggregateManager) rebuild(job rebuildJob, events []eventsourcing.Event) (int, error) {
+	start := m.restoreSnapshot(job.agg, job.snapshotID, len(events))
+	if start > 0 {
+		eventsourcing.MarkApplied(job.agg, events[start-1].Metadata().Sequence)
+	}
+	apply := func(event eventsourcing.Event) error {
 		logging.Debug("Applying event %s", event.Type())
-		for _, agg := range m.AllAggregates() {
-			err := agg.ApplyEvent(event)
-			if err != nil {
-				return fmt.Errorf("Failed to apply event %s: %v", event.Type(), err)
+		if _, err := eventsourcing.ApplyOnce(job.agg, event); err != nil {
+			return fmt.Errorf("Failed to apply event %s: %v", event.Type(), err)
+		}
+		return nil
+	}
+	if job.positions == nil {
+		for _, event := range events[start:] {
+			if err := apply(event); err != nil {
+				return 0, err
 			}
 		}
+		return len(events) - start, nil
+	}
+	applied := 0
+	for _, position := range job.positions[sort.SearchInts(job.positions, start):] {
+		if err := apply(events[position]); err != nil {
+			return applied, err
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// restoreSnapshot loads the latest snapshot into agg and returns the index of the first event still to apply.
+func (m *AggregateManager) restoreSnapshot(agg eventsourcing.Aggregate, snapshotID string, eventCount int) int {
+	snapshotter, ok := agg.(eventsourcing.Snapshotter)
+	if !ok || m.Snapshots == nil {
+		return 0
+	}
+	version, data, err := m.Snapshots.LoadSnapshot(snapshotID)
+	if err != nil {
+		logging.Error("Failed to load snapshot for %s: %v", snapshotID, err)
+		return 0
+	}
+	if data == nil || version > eventCount {
+		return 0
+	}
+	if err := snapshotter.LoadSnapshot(data); err != nil {
+		logging.Error("Failed to restore snapshot for %s, replaying all events: %v", snapshotID, err)
+		return 0
+	}
+	logging.Info("Restored %s from snapshot at event %d", snapshotID, version)
+	return version
+}
+
+// SnapshotAll stores a snapshot of every aggregate that supports it at the given event version.
+func (m *AggregateManager) SnapshotAll(version int) error {
+	if m.Snapshots == nil {
+		return fmt.Errorf("no snapshot store configured")
+	}
+	for id, agg := range eventsourcing.SnapshotIDs(m) {
+		snapshotter, ok := agg.(eventsourcing.Snapshotter)
+		if !ok {
+			continue
+		}
+		data, err := snapshotter.SaveSnapshot()
+		if err != nil {
+			return fmt.Errorf("failed to snapshot %s: %v", id, err)
+		}
+		if err := m.Snapshots.SaveSnapshot(id, version, data); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -1,6 +1,9 @@
 package aggregate
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"testing"
 
 	"fyne.io/fyne/v2"
@@ -134,3 +137,232 @@ func TestRebuildState(t *testing.T) {
 		t.Errorf("RebuildState failed: %v", err)
 	}
 }
+
+// snapshotAggregate records applied events and supports snapshots
+type snapshotAggregate struct {
+	MockAggregate
+	applied  int
+	restored string
+}
+
+func (m *snapshotAggregate) ApplyEvent(event eventsourcing.Event) error {
+	m.applied++
+	return nil
+}
+
+func (m *snapshotAggregate) SaveSnapshot() ([]byte, error) { return []byte("state"), nil }
+func (m *snapshotAggregate) LoadSnapshot(data []byte) error {
+	m.restored = string(data)
+	return nil
+}
+
+type memorySnapshotStore struct {
+	versions map[string]int
+	data     map[string][]byte
+}
+
+func (s *memorySnapshotStore) SaveSnapshot(aggregateID string, version int, data []byte) error {
+	s.versions[aggregateID] = version
+	s.data[aggregateID] = data
+	return nil
+}
+
+func (s *memorySnapshotStore) LoadSnapshot(aggregateID string) (int, []byte, error) {
+	return s.versions[aggregateID], s.data[aggregateID], nil
+}
+
+func TestRebuildState_FromSnapshot(t *testing.T) {
+	store := &memorySnapshotStore{versions: map[string]int{}, data: map[string][]byte{}}
+	store.SaveSnapshot("snap", 3, []byte("saved"))
+
+	manager := NewAggregateManager()
+	manager.Snapshots = store
+	snapAgg := &snapshotAggregate{MockAggregate: MockAggregate{id: "snap"}}
+	plainAgg := &snapshotAggregate{MockAggregate: MockAggregate{id: "fresh"}}
+	manager.RegisterAggregate("snap", snapAgg)
+	manager.RegisterAggregate("fresh", plainAgg)
+
+	events := make([]eventsourcing.Event, 5)
+	for i := range events {
+		events[i] = &eventsourcing.InitiatePluginCreationEvent{}
+	}
+
+	if err := manager.RebuildState(events); err != nil {
+		t.Fatalf("RebuildState failed: %v", err)
+	}
+	if snapAgg.restored != "saved" {
+		t.Errorf("Expected snapshot to be restored, got %q", snapAgg.restored)
+	}
+	if snapAgg.applied != 2 {
+		t.Errorf("Expected 2 tail events applied, got %d", snapAgg.applied)
+	}
+	if plainAgg.applied != 5 {
+		t.Errorf("Expected 5 events applied without snapshot, got %d", plainAgg.applied)
+	}
+
+	if err := manager.SnapshotAll(len(events)); err != nil {
+		t.Fatalf("SnapshotAll failed: %v", err)
+	}
+	if store.versions["fresh"] != 5 || store.versions["snap"] != 5 {
+		t.Errorf("Expected snapshots at version 5, got %v", store.versions)
+	}
+}
+
+func TestRebuildState_UserAggregates(t *testing.T) {
+	store := &memorySnapshotStore{versions: map[string]int{}, data: map[string][]byte{}}
+	manager := NewAggregateManager()
+	manager.Snapshots = store
+	owner := &snapshotAggregate{MockAggregate: MockAggregate{id: "tasks"}}
+	alice := &snapshotAggregate{MockAggregate: MockAggregate{id: "tasks"}}
+	shared := &snapshotAggregate{MockAggregate: MockAggregate{id: "orchestration"}}
+	manager.RegisterAggregate("tasks", owner)
+	manager.RegisterAggregate("orchestration", shared)
+	manager.RegisterUserAggregate("alice", "tasks", alice)
+
+	events := make([]eventsourcing.Event, 3)
+	for i := range events {
+		events[i] = &eventsourcing.InitiatePluginCreationEvent{}
+	}
+	events[1].Metadata().UserID = "alice"
+
+	if err := manager.RebuildState(events); err != nil {
+		t.Fatalf("RebuildState failed: %v", err)
+	}
+	if owner.applied != 2 || alice.applied != 1 || shared.applied != 3 {
+		t.Errorf("Expected each user's events in their aggregate, got owner %d, alice %d, shared %d", owner.applied, alice.applied, shared.applied)
+	}
+	if got := manager.AggregatesOf("alice"); len(got) != 2 {
+		t.Errorf("Expected alice to see her tasks and the shared aggregate, got %d aggregates", len(got))
+	}
+	if agg, err := manager.UserAggregateByName("alice", "tasks"); err != nil || agg != alice {
+		t.Errorf("Expected alice's own tasks aggregate, got %v, %v", agg, err)
+	}
+
+	if err := manager.SnapshotAll(len(events)); err != nil {
+		t.Fatalf("SnapshotAll failed: %v", err)
+	}
+	if store.versions["tasks"] != 3 || store.versions["alice/tasks"] != 3 {
+		t.Errorf("Expected snapshots of both tasks aggregates, got %v", store.versions)
+	}
+}
+
+// userViewAggregate shows each user their own part
+type userViewAggregate struct {
+	MockAggregate
+}
+
+func (u *userViewAggregate) SnapshotFor(userID string) ([]byte, error) { return []byte(userID), nil }
+
+func TestVisibleAggregatesOf(t *testing.T) {
+	manager := NewAggregateManager()
+	alice := &MockAggregate{id: "tasks"}
+	manager.RegisterAggregate("tasks", &MockAggregate{id: "tasks"})
+	manager.RegisterAggregate("audit", &MockAggregate{id: "audit"})
+	manager.RegisterAggregate("pins", &userViewAggregate{MockAggregate{id: "pins"}})
+	manager.RegisterUserAggregate("alice", "tasks", alice)
+
+	if got := manager.VisibleAggregatesOf(""); len(got) != 3 {
+		t.Errorf("Expected the owner to see every aggregate, got %d", len(got))
+	}
+	ids := []string{}
+	for _, agg := range manager.VisibleAggregatesOf("alice") {
+		ids = append(ids, agg.ID())
+	}
+	sort.Strings(ids)
+	if strings.Join(ids, ",") != "pins,tasks" {
+		t.Errorf("Expected alice to see her tasks and the pins, got %v", ids)
+	}
+	if _, err := manager.UserAggregateByName("alice", "audit"); err == nil {
+		t.Error("Expected the shared audit refused to alice")
+	}
+	if agg, err := manager.UserAggregateByName("alice", "pins"); err != nil || agg.ID() != "pins" {
+		t.Errorf("Expected the pins shown to alice, got %v, %v", agg, err)
+	}
+	if got := manager.AggregatesOf("alice"); len(got) != 3 {
+		t.Errorf("Expected alice's events applied to her tasks and the shared aggregates, got %d", len(got))
+	}
+}
+
+// queryableAggregate shares its ID as its state
+type queryableAggregate struct {
+	MockAggregate
+}
+
+func (q *queryableAggregate) QueryState() any { return "state of " + q.id }
+
+func TestQueryState(t *testing.T) {
+	manager := NewAggregateManager()
+	manager.RegisterAggregate("tasks", &queryableAggregate{MockAggregate{id: "owner's tasks"}})
+	manager.RegisterAggregate("calendar", &queryableAggregate{MockAggregate{id: "calendar"}})
+	manager.RegisterAggregate("orchestration", &MockAggregate{id: "orchestration"})
+	manager.RegisterUserAggregate("alice", "tasks", &queryableAggregate{MockAggregate{id: "alice's tasks"}})
+
+	if names := manager.QueryableAggregates("alice"); len(names) != 2 || names[0] != "calendar" || names[1] != "tasks" {
+		t.Errorf("Expected calendar and tasks to be queryable, got %v", names)
+	}
+	state := manager.QueryState("alice", nil)
+	if len(state) != 2 || state["tasks"] != "state of alice's tasks" || state["calendar"] != "state of calendar" {
+		t.Errorf("Expected the state of alice's tasks and the calendar, got %v", state)
+	}
+	state = manager.QueryState("", []string{"tasks", "orchestration", "unknown"})
+	if len(state) != 1 || state["tasks"] != "state of owner's tasks" {
+		t.Errorf("Expected only the owner's tasks, got %v", state)
+	}
+}
+
+// orderedAggregate records the sequences of the events it applies
+type orderedAggregate struct {
+	MockAggregate
+	sequences []int64
+}
+
+func (m *orderedAggregate) ApplyEvent(event eventsourcing.Event) error {
+	m.sequences = append(m.sequences, event.Metadata().Sequence)
+	return nil
+}
+
+func TestRebuildState_Concurrently(t *testing.T) {
+	manager := NewAggregateManager()
+	var aggs []*orderedAggregate
+	for i := 0; i < 20; i++ {
+		agg := &orderedAggregate{MockAggregate: MockAggregate{id: fmt.Sprintf("agg%d", i)}}
+		manager.RegisterAggregate(agg.id, agg)
+		aggs = append(aggs, agg)
+	}
+	bob := &orderedAggregate{MockAggregate: MockAggregate{id: "agg0"}}
+	manager.RegisterUserAggregate("bob", "agg0", bob)
+
+	events := make([]eventsourcing.Event, 1000)
+	for i := range events {
+		events[i] = &eventsourcing.InitiatePluginCreationEvent{}
+		events[i].Metadata().Sequence = int64(i + 1)
+		if i%10 == 0 {
+			events[i].Metadata().UserID = "bob"
+		}
+	}
+	var progress []RebuildProgress
+	manager.OnRebuildProgress = func(p RebuildProgress) { progress = append(progress, p) }
+	if err := manager.RebuildState(events); err != nil {
+		t.Fatalf("RebuildState failed: %v", err)
+	}
+
+	inOrder := func(sequences []int64) bool {
+		for i := 1; i < len(sequences); i++ {
+			if sequences[i] <= sequences[i-1] {
+				return false
+			}
+		}
+		return true
+	}
+	for _, agg := range aggs[1:] {
+		if len(agg.sequences) != 1000 || !inOrder(agg.sequences) {
+			t.Errorf("Expected %s to apply all events in order, got %d", agg.id, len(agg.sequences))
+		}
+	}
+	if len(aggs[0].sequences) != 900 || len(bob.sequences) != 100 || !inOrder(aggs[0].sequences) || !inOrder(bob.sequences) {
+		t.Errorf("Expected the owner's and bob's events in their own aggregates in order, got %d and %d", len(aggs[0].sequences), len(bob.sequences))
+	}
+	if len(progress) != 21 || progress[20].Done != 21 || progress[20].Total != 21 {
+		t.Errorf("Expected progress after each of the 21 aggregates, got %+v", progress)
+	}
+}
@@ -0,0 +1,754 @@
+// The MindPalace API for integrations like mobile apps and scripts. Clients authenticate like those of
+// the HTTP API once users are configured: with "authorization: Bearer <token>" metadata. Household
+// members execute commands, see events and query aggregates of their own; the owner sees all events.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: mindpalace/v1/mindpalace.proto
+
+package mindpalacev1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ExecuteCommandRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Command       string                 `protobuf:"bytes,1,opt,name=command,proto3" json:"command,omitempty"` // Name of the command, e.g. CreateTask
+	Input         *structpb.Struct       `protobuf:"bytes,2,opt,name=input,proto3" json:"input,omitempty"`     // Input of the command, e.g. {"Title": "Buy milk"}
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecuteCommandRequest) Reset() {
+	*x = ExecuteCommandRequest{}
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecuteCommandRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecuteCommandRequest) ProtoMessage() {}
+
+func (x *ExecuteCommandRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecuteCommandRequest.ProtoReflect.Descriptor instead.
+func (*ExecuteCommandRequest) Descriptor() ([]byte, []int) {
+	return file_mindpalace_v1_mindpalace_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ExecuteCommandRequest) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *ExecuteCommandRequest) GetInput() *structpb.Struct {
+	if x != nil {
+		return x.Input
+	}
+	return nil
+}
+
+type ExecuteCommandResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecuteCommandResponse) Reset() {
+	*x = ExecuteCommandResponse{}
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecuteCommandResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecuteCommandResponse) ProtoMessage() {}
+
+func (x *ExecuteCommandResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecuteCommandResponse.ProtoReflect.Descriptor instead.
+func (*ExecuteCommandResponse) Descriptor() ([]byte, []int) {
+	return file_mindpalace_v1_mindpalace_proto_rawDescGZIP(), []int{1}
+}
+
+type SubmitRequestRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Text          string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	SessionId     string                 `protobuf:"bytes,2,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"` // Chat session of the request, the active session if empty
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitRequestRequest) Reset() {
+	*x = SubmitRequestRequest{}
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitRequestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitRequestRequest) ProtoMessage() {}
+
+func (x *SubmitRequestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitRequestRequest.ProtoReflect.Descriptor instead.
+func (*SubmitRequestRequest) Descriptor() ([]byte, []int) {
+	return file_mindpalace_v1_mindpalace_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SubmitRequestRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *SubmitRequestRequest) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+type SubmitRequestResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"` // Events of the request carry it in their request_id
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitRequestResponse) Reset() {
+	*x = SubmitRequestResponse{}
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitRequestResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitRequestResponse) ProtoMessage() {}
+
+func (x *SubmitRequestResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitRequestResponse.ProtoReflect.Descriptor instead.
+func (*SubmitRequestResponse) Descriptor() ([]byte, []int) {
+	return file_mindpalace_v1_mindpalace_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SubmitRequestResponse) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+type Event struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`                   // e.g. taskmanager_TaskCreated
+	Sequence      int64                  `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"`          // Position in the event log, 0 for events that are not stored
+	Aggregate     string                 `protobuf:"bytes,3,opt,name=aggregate,proto3" json:"aggregate,omitempty"`         // Stream the event belongs to
+	Version       int64                  `protobuf:"varint,4,opt,name=version,proto3" json:"version,omitempty"`            // Position among the events of the stream
+	UserId        string                 `protobuf:"bytes,5,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"` // User the event happened for, empty for the owner
+	Data          *structpb.Struct       `protobuf:"bytes,6,opt,name=data,proto3" json:"data,omitempty"`                   // The event as stored
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_mindpalace_v1_mindpalace_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetSequence() int64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *Event) GetAggregate() string {
+	if x != nil {
+		return x.Aggregate
+	}
+	return ""
+}
+
+func (x *Event) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Event) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *Event) GetData() *structpb.Struct {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type ListEventsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Types         []string               `protobuf:"bytes,1,rep,name=types,proto3" json:"types,omitempty"`    // Event types to list, all if empty
+	Offset        int32                  `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"` // Events skipped
+	Limit         int32                  `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`   // Events listed at most, 100 if 0
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListEventsRequest) Reset() {
+	*x = ListEventsRequest{}
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListEventsRequest) ProtoMessage() {}
+
+func (x *ListEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListEventsRequest.ProtoReflect.Descriptor instead.
+func (*ListEventsRequest) Descriptor() ([]byte, []int) {
+	return file_mindpalace_v1_mindpalace_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListEventsRequest) GetTypes() []string {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+func (x *ListEventsRequest) GetOffset() int32 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *ListEventsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type ListEventsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Events        []*Event               `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListEventsResponse) Reset() {
+	*x = ListEventsResponse{}
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListEventsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListEventsResponse) ProtoMessage() {}
+
+func (x *ListEventsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListEventsResponse.ProtoReflect.Descriptor instead.
+func (*ListEventsResponse) Descriptor() ([]byte, []int) {
+	return file_mindpalace_v1_mindpalace_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListEventsResponse) GetEvents() []*Event {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+type SubscribeEventsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Types         []string               `protobuf:"bytes,1,rep,name=types,proto3" json:"types,omitempty"`                                       // Event types to stream, all if empty
+	AfterSequence int64                  `protobuf:"varint,2,opt,name=after_sequence,json=afterSequence,proto3" json:"after_sequence,omitempty"` // Stored events after it are sent first; 0 streams new events only
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeEventsRequest) Reset() {
+	*x = SubscribeEventsRequest{}
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeEventsRequest) ProtoMessage() {}
+
+func (x *SubscribeEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeEventsRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeEventsRequest) Descriptor() ([]byte, []int) {
+	return file_mindpalace_v1_mindpalace_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SubscribeEventsRequest) GetTypes() []string {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+func (x *SubscribeEventsRequest) GetAfterSequence() int64 {
+	if x != nil {
+		return x.AfterSequence
+	}
+	return 0
+}
+
+type ListAggregatesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListAggregatesRequest) Reset() {
+	*x = ListAggregatesRequest{}
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListAggregatesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListAggregatesRequest) ProtoMessage() {}
+
+func (x *ListAggregatesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListAggregatesRequest.ProtoReflect.Descriptor instead.
+func (*ListAggregatesRequest) Descriptor() ([]byte, []int) {
+	return file_mindpalace_v1_mindpalace_proto_rawDescGZIP(), []int{8}
+}
+
+type ListAggregatesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ids           []string               `protobuf:"bytes,1,rep,name=ids,proto3" json:"ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListAggregatesResponse) Reset() {
+	*x = ListAggregatesResponse{}
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListAggregatesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListAggregatesResponse) ProtoMessage() {}
+
+func (x *ListAggregatesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListAggregatesResponse.ProtoReflect.Descriptor instead.
+func (*ListAggregatesResponse) Descriptor() ([]byte, []int) {
+	return file_mindpalace_v1_mindpalace_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListAggregatesResponse) GetIds() []string {
+	if x != nil {
+		return x.Ids
+	}
+	return nil
+}
+
+type GetAggregateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"` // e.g. taskmanager
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetAggregateRequest) Reset() {
+	*x = GetAggregateRequest{}
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetAggregateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetAggregateRequest) ProtoMessage() {}
+
+func (x *GetAggregateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetAggregateRequest.ProtoReflect.Descriptor instead.
+func (*GetAggregateRequest) Descriptor() ([]byte, []int) {
+	return file_mindpalace_v1_mindpalace_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GetAggregateRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type Aggregate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	State         *structpb.Value        `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"` // The aggregate's snapshot, or its fields
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Aggregate) Reset() {
+	*x = Aggregate{}
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Aggregate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Aggregate) ProtoMessage() {}
+
+func (x *Aggregate) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_v1_mindpalace_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Aggregate.ProtoReflect.Descriptor instead.
+func (*Aggregate) Descriptor() ([]byte, []int) {
+	return file_mindpalace_v1_mindpalace_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Aggregate) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Aggregate) GetState() *structpb.Value {
+	if x != nil {
+		return x.State
+	}
+	return nil
+}
+
+var File_mindpalace_v1_mindpalace_proto protoreflect.FileDescriptor
+
+const file_mindpalace_v1_mindpalace_proto_rawDesc = "" +
+	"\n" +
+	"\x1emindpalace/v1/mindpalace.proto\x12\rmindpalace.v1\x1a\x1cgoogle/protobuf/struct.proto\"`\n" +
+	"\x15ExecuteCommandRequest\x12\x18\n" +
+	"\acommand\x18\x01 \x01(\tR\acommand\x12-\n" +
+	"\x05input\x18\x02 \x01(\v2\x17.google.protobuf.StructR\x05input\"\x18\n" +
+	"\x16ExecuteCommandResponse\"I\n" +
+	"\x14SubmitRequestRequest\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x02 \x01(\tR\tsessionId\"6\n" +
+	"\x15SubmitRequestResponse\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\"\xb5\x01\n" +
+	"\x05Event\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x1a\n" +
+	"\bsequence\x18\x02 \x01(\x03R\bsequence\x12\x1c\n" +
+	"\taggregate\x18\x03 \x01(\tR\taggregate\x12\x18\n" +
+	"\aversion\x18\x04 \x01(\x03R\aversion\x12\x17\n" +
+	"\auser_id\x18\x05 \x01(\tR\x06userId\x12+\n" +
+	"\x04data\x18\x06 \x01(\v2\x17.google.protobuf.StructR\x04data\"W\n" +
+	"\x11ListEventsRequest\x12\x14\n" +
+	"\x05types\x18\x01 \x03(\tR\x05types\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x05R\x06offset\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limit\"B\n" +
+	"\x12ListEventsResponse\x12,\n" +
+	"\x06events\x18\x01 \x03(\v2\x14.mindpalace.v1.EventR\x06events\"U\n" +
+	"\x16SubscribeEventsRequest\x12\x14\n" +
+	"\x05types\x18\x01 \x03(\tR\x05types\x12%\n" +
+	"\x0eafter_sequence\x18\x02 \x01(\x03R\rafterSequence\"\x17\n" +
+	"\x15ListAggregatesRequest\"*\n" +
+	"\x16ListAggregatesResponse\x12\x10\n" +
+	"\x03ids\x18\x01 \x03(\tR\x03ids\"%\n" +
+	"\x13GetAggregateRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"I\n" +
+	"\tAggregate\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12,\n" +
+	"\x05state\x18\x02 \x01(\v2\x16.google.protobuf.ValueR\x05state2\x99\x04\n" +
+	"\n" +
+	"MindPalace\x12]\n" +
+	"\x0eExecuteCommand\x12$.mindpalace.v1.ExecuteCommandRequest\x1a%.mindpalace.v1.ExecuteCommandResponse\x12Z\n" +
+	"\rSubmitRequest\x12#.mindpalace.v1.SubmitRequestRequest\x1a$.mindpalace.v1.SubmitRequestResponse\x12Q\n" +
+	"\n" +
+	"ListEvents\x12 .mindpalace.v1.ListEventsRequest\x1a!.mindpalace.v1.ListEventsResponse\x12P\n" +
+	"\x0fSubscribeEvents\x12%.mindpalace.v1.SubscribeEventsRequest\x1a\x14.mindpalace.v1.Event0\x01\x12]\n" +
+	"\x0eListAggregates\x12$.mindpalace.v1.ListAggregatesRequest\x1a%.mindpalace.v1.ListAggregatesResponse\x12L\n" +
+	"\fGetAggregate\x12\".mindpalace.v1.GetAggregateRequest\x1a\x18.mindpalace.v1.AggregateB.Z,mindpalace/pkg/api/mindpalacev1;mindpalacev1b\x06proto3"
+
+var (
+	file_mindpalace_v1_mindpalace_proto_rawDescOnce sync.Once
+	file_mindpalace_v1_mindpalace_proto_rawDescData []byte
+)
+
+func file_mindpalace_v1_mindpalace_proto_rawDescGZIP() []byte {
+	file_mindpalace_v1_mindpalace_proto_rawDescOnce.Do(func() {
+		file_mindpalace_v1_mindpalace_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_mindpalace_v1_mindpalace_proto_rawDesc), len(file_mindpalace_v1_mindpalace_proto_rawDesc)))
+	})
+	return file_mindpalace_v1_mindpalace_proto_rawDescData
+}
+
+var file_mindpalace_v1_mindpalace_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_mindpalace_v1_mindpalace_proto_goTypes = []any{
+	(*ExecuteCommandRequest)(nil),  // 0: mindpalace.v1.ExecuteCommandRequest
+	(*ExecuteCommandResponse)(nil), // 1: mindpalace.v1.ExecuteCommandResponse
+	(*SubmitRequestRequest)(nil),   // 2: mindpalace.v1.SubmitRequestRequest
+	(*SubmitRequestResponse)(nil),  // 3: mindpalace.v1.SubmitRequestResponse
+	(*Event)(nil),                  // 4: mindpalace.v1.Event
+	(*ListEventsRequest)(nil),      // 5: mindpalace.v1.ListEventsRequest
+	(*ListEventsResponse)(nil),     // 6: mindpalace.v1.ListEventsResponse
+	(*SubscribeEventsRequest)(nil), // 7: mindpalace.v1.SubscribeEventsRequest
+	(*ListAggregatesRequest)(nil),  // 8: mindpalace.v1.ListAggregatesRequest
+	(*ListAggregatesResponse)(nil), // 9: mindpalace.v1.ListAggregatesResponse
+	(*GetAggregateRequest)(nil),    // 10: mindpalace.v1.GetAggregateRequest
+	(*Aggregate)(nil),              // 11: mindpalace.v1.Aggregate
+	(*structpb.Struct)(nil),        // 12: google.protobuf.Struct
+	(*structpb.Value)(nil),         // 13: google.protobuf.Value
+}
+var file_mindpalace_v1_mindpalace_proto_depIdxs = []int32{
+	12, // 0: mindpalace.v1.ExecuteCommandRequest.input:type_name -> google.protobuf.Struct
+	12, // 1: mindpalace.v1.Event.data:type_name -> google.protobuf.Struct
+	4,  // 2: mindpalace.v1.ListEventsResponse.events:type_name -> mindpalace.v1.Event
+	13, // 3: mindpalace.v1.Aggregate.state:type_name -> google.protobuf.Value
+	0,  // 4: mindpalace.v1.MindPalace.ExecuteCommand:input_type -> mindpalace.v1.ExecuteCommandRequest
+	2,  // 5: mindpalace.v1.MindPalace.SubmitRequest:input_type -> mindpalace.v1.SubmitRequestRequest
+	5,  // 6: mindpalace.v1.MindPalace.ListEvents:input_type -> mindpalace.v1.ListEventsRequest
+	7,  // 7: mindpalace.v1.MindPalace.SubscribeEvents:input_type -> mindpalace.v1.SubscribeEventsRequest
+	8,  // 8: mindpalace.v1.MindPalace.ListAggregates:input_type -> mindpalace.v1.ListAggregatesRequest
+	10, // 9: mindpalace.v1.MindPalace.GetAggregate:input_type -> mindpalace.v1.GetAggregateRequest
+	1,  // 10: mindpalace.v1.MindPalace.ExecuteCommand:output_type -> mindpalace.v1.ExecuteCommandResponse
+	3,  // 11: mindpalace.v1.MindPalace.SubmitRequest:output_type -> mindpalace.v1.SubmitRequestResponse
+	6,  // 12: mindpalace.v1.MindPalace.ListEvents:output_type -> mindpalace.v1.ListEventsResponse
+	4,  // 13: mindpalace.v1.MindPalace.SubscribeEvents:output_type -> mindpalace.v1.Event
+	9,  // 14: mindpalace.v1.MindPalace.ListAggregates:output_type -> mindpalace.v1.ListAggregatesResponse
+	11, // 15: mindpalace.v1.MindPalace.GetAggregate:output_type -> mindpalace.v1.Aggregate
+	10, // [10:16] is the sub-list for method output_type
+	4,  // [4:10] is the sub-list for method input_type
+	4,  // [4:4] is the sub-list for extension type_name
+	4,  // [4:4] is the sub-list for extension extendee
+	0,  // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_mindpalace_v1_mindpalace_proto_init() }
+func file_mindpalace_v1_mindpalace_proto_init() {
+	if File_mindpalace_v1_mindpalace_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_mindpalace_v1_mindpalace_proto_rawDesc), len(file_mindpalace_v1_mindpalace_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_mindpalace_v1_mindpalace_proto_goTypes,
+		DependencyIndexes: file_mindpalace_v1_mindpalace_proto_depIdxs,
+		MessageInfos:      file_mindpalace_v1_mindpalace_proto_msgTypes,
+	}.Build()
+	File_mindpalace_v1_mindpalace_proto = out.File
+	file_mindpalace_v1_mindpalace_proto_goTypes = nil
+	file_mindpalace_v1_mindpalace_proto_depIdxs = nil
+}
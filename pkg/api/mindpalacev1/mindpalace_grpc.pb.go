@@ -0,0 +1,333 @@
+// The MindPalace API for integrations like mobile apps and scripts. Clients authenticate like those of
+// the HTTP API once users are configured: with "authorization: Bearer <token>" metadata. Household
+// members execute commands, see events and query aggregates of their own; the owner sees all events.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: mindpalace/v1/mindpalace.proto
+
+package mindpalacev1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	MindPalace_ExecuteCommand_FullMethodName  = "/mindpalace.v1.MindPalace/ExecuteCommand"
+	MindPalace_SubmitRequest_FullMethodName   = "/mindpalace.v1.MindPalace/SubmitRequest"
+	MindPalace_ListEvents_FullMethodName      = "/mindpalace.v1.MindPalace/ListEvents"
+	MindPalace_SubscribeEvents_FullMethodName = "/mindpalace.v1.MindPalace/SubscribeEvents"
+	MindPalace_ListAggregates_FullMethodName  = "/mindpalace.v1.MindPalace/ListAggregates"
+	MindPalace_GetAggregate_FullMethodName    = "/mindpalace.v1.MindPalace/GetAggregate"
+)
+
+// MindPalaceClient is the client API for MindPalace service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MindPalaceClient interface {
+	// ExecuteCommand executes a command of a plugin or aggregate, e.g. CreateTask with its input
+	ExecuteCommand(ctx context.Context, in *ExecuteCommandRequest, opts ...grpc.CallOption) (*ExecuteCommandResponse, error)
+	// SubmitRequest has the assistant process a request in natural language, like the chat
+	SubmitRequest(ctx context.Context, in *SubmitRequestRequest, opts ...grpc.CallOption) (*SubmitRequestResponse, error)
+	// ListEvents lists stored events, oldest first
+	ListEvents(ctx context.Context, in *ListEventsRequest, opts ...grpc.CallOption) (*ListEventsResponse, error)
+	// SubscribeEvents streams events as they are published, after replaying the stored events since a
+	// sequence
+	SubscribeEvents(ctx context.Context, in *SubscribeEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+	// ListAggregates lists the aggregates
+	ListAggregates(ctx context.Context, in *ListAggregatesRequest, opts ...grpc.CallOption) (*ListAggregatesResponse, error)
+	// GetAggregate returns the state of an aggregate
+	GetAggregate(ctx context.Context, in *GetAggregateRequest, opts ...grpc.CallOption) (*Aggregate, error)
+}
+
+type mindPalaceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMindPalaceClient(cc grpc.ClientConnInterface) MindPalaceClient {
+	return &mindPalaceClient{cc}
+}
+
+func (c *mindPalaceClient) ExecuteCommand(ctx context.Context, in *ExecuteCommandRequest, opts ...grpc.CallOption) (*ExecuteCommandResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExecuteCommandResponse)
+	err := c.cc.Invoke(ctx, MindPalace_ExecuteCommand_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mindPalaceClient) SubmitRequest(ctx context.Context, in *SubmitRequestRequest, opts ...grpc.CallOption) (*SubmitRequestResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SubmitRequestResponse)
+	err := c.cc.Invoke(ctx, MindPalace_SubmitRequest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mindPalaceClient) ListEvents(ctx context.Context, in *ListEventsRequest, opts ...grpc.CallOption) (*ListEventsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListEventsResponse)
+	err := c.cc.Invoke(ctx, MindPalace_ListEvents_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mindPalaceClient) SubscribeEvents(ctx context.Context, in *SubscribeEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MindPalace_ServiceDesc.Streams[0], MindPalace_SubscribeEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeEventsRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MindPalace_SubscribeEventsClient = grpc.ServerStreamingClient[Event]
+
+func (c *mindPalaceClient) ListAggregates(ctx context.Context, in *ListAggregatesRequest, opts ...grpc.CallOption) (*ListAggregatesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListAggregatesResponse)
+	err := c.cc.Invoke(ctx, MindPalace_ListAggregates_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mindPalaceClient) GetAggregate(ctx context.Context, in *GetAggregateRequest, opts ...grpc.CallOption) (*Aggregate, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Aggregate)
+	err := c.cc.Invoke(ctx, MindPalace_GetAggregate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MindPalaceServer is the server API for MindPalace service.
+// All implementations must embed UnimplementedMindPalaceServer
+// for forward compatibility.
+type MindPalaceServer interface {
+	// ExecuteCommand executes a command of a plugin or aggregate, e.g. CreateTask with its input
+	ExecuteCommand(context.Context, *ExecuteCommandRequest) (*ExecuteCommandResponse, error)
+	// SubmitRequest has the assistant process a request in natural language, like the chat
+	SubmitRequest(context.Context, *SubmitRequestRequest) (*SubmitRequestResponse, error)
+	// ListEvents lists stored events, oldest first
+	ListEvents(context.Context, *ListEventsRequest) (*ListEventsResponse, error)
+	// SubscribeEvents streams events as they are published, after replaying the stored events since a
+	// sequence
+	SubscribeEvents(*SubscribeEventsRequest, grpc.ServerStreamingServer[Event]) error
+	// ListAggregates lists the aggregates
+	ListAggregates(context.Context, *ListAggregatesRequest) (*ListAggregatesResponse, error)
+	// GetAggregate returns the state of an aggregate
+	GetAggregate(context.Context, *GetAggregateRequest) (*Aggregate, error)
+	mustEmbedUnimplementedMindPalaceServer()
+}
+
+// UnimplementedMindPalaceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMindPalaceServer struct{}
+
+func (UnimplementedMindPalaceServer) ExecuteCommand(context.Context, *ExecuteCommandRequest) (*ExecuteCommandResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExecuteCommand not implemented")
+}
+func (UnimplementedMindPalaceServer) SubmitRequest(context.Context, *SubmitRequestRequest) (*SubmitRequestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitRequest not implemented")
+}
+func (UnimplementedMindPalaceServer) ListEvents(context.Context, *ListEventsRequest) (*ListEventsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListEvents not implemented")
+}
+func (UnimplementedMindPalaceServer) SubscribeEvents(*SubscribeEventsRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeEvents not implemented")
+}
+func (UnimplementedMindPalaceServer) ListAggregates(context.Context, *ListAggregatesRequest) (*ListAggregatesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAggregates not implemented")
+}
+func (UnimplementedMindPalaceServer) GetAggregate(context.Context, *GetAggregateRequest) (*Aggregate, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAggregate not implemented")
+}
+func (UnimplementedMindPalaceServer) mustEmbedUnimplementedMindPalaceServer() {}
+func (UnimplementedMindPalaceServer) testEmbeddedByValue()                    {}
+
+// UnsafeMindPalaceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MindPalaceServer will
+// result in compilation errors.
+type UnsafeMindPalaceServer interface {
+	mustEmbedUnimplementedMindPalaceServer()
+}
+
+func RegisterMindPalaceServer(s grpc.ServiceRegistrar, srv MindPalaceServer) {
+	// If the following call pancis, it indicates UnimplementedMindPalaceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&MindPalace_ServiceDesc, srv)
+}
+
+func _MindPalace_ExecuteCommand_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExecuteCommandRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MindPalaceServer).ExecuteCommand(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MindPalace_ExecuteCommand_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MindPalaceServer).ExecuteCommand(ctx, req.(*ExecuteCommandRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MindPalace_SubmitRequest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitRequestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MindPalaceServer).SubmitRequest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MindPalace_SubmitRequest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MindPalaceServer).SubmitRequest(ctx, req.(*SubmitRequestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MindPalace_ListEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListEventsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MindPalaceServer).ListEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MindPalace_ListEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MindPalaceServer).ListEvents(ctx, req.(*ListEventsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MindPalace_SubscribeEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MindPalaceServer).SubscribeEvents(m, &grpc.GenericServerStream[SubscribeEventsRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MindPalace_SubscribeEventsServer = grpc.ServerStreamingServer[Event]
+
+func _MindPalace_ListAggregates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAggregatesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MindPalaceServer).ListAggregates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MindPalace_ListAggregates_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MindPalaceServer).ListAggregates(ctx, req.(*ListAggregatesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MindPalace_GetAggregate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAggregateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MindPalaceServer).GetAggregate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MindPalace_GetAggregate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MindPalaceServer).GetAggregate(ctx, req.(*GetAggregateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// MindPalace_ServiceDesc is the grpc.ServiceDesc for MindPalace service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MindPalace_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mindpalace.v1.MindPalace",
+	HandlerType: (*MindPalaceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ExecuteCommand",
+			Handler:    _MindPalace_ExecuteCommand_Handler,
+		},
+		{
+			MethodName: "SubmitRequest",
+			Handler:    _MindPalace_SubmitRequest_Handler,
+		},
+		{
+			MethodName: "ListEvents",
+			Handler:    _MindPalace_ListEvents_Handler,
+		},
+		{
+			MethodName: "ListAggregates",
+			Handler:    _MindPalace_ListAggregates_Handler,
+		},
+		{
+			MethodName: "GetAggregate",
+			Handler:    _MindPalace_GetAggregate_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubscribeEvents",
+			Handler:       _MindPalace_SubscribeEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "mindpalace/v1/mindpalace.proto",
+}
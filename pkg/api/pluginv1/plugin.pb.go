@@ -0,0 +1,765 @@
+// The protocol of plugins running as processes of their own, in any language. MindPalace starts the
+// plugin's command with the path of a Unix socket in MINDPALACE_PLUGIN_SOCKET, and the plugin serves
+// the Plugin service on it. Events and 3D actions are the JSON objects in-process plugins use.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: mindpalace/plugin/v1/plugin.proto
+
+package pluginv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type DescribeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DescribeRequest) Reset() {
+	*x = DescribeRequest{}
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DescribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DescribeRequest) ProtoMessage() {}
+
+func (x *DescribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DescribeRequest.ProtoReflect.Descriptor instead.
+func (*DescribeRequest) Descriptor() ([]byte, []int) {
+	return file_mindpalace_plugin_v1_plugin_proto_rawDescGZIP(), []int{0}
+}
+
+type Description struct {
+	state         protoimpl.MessageState      `protogen:"open.v1"`
+	Name          string                      `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`                                                                                 // e.g. weather
+	Type          string                      `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`                                                                                 // llm or system
+	SystemPrompt  string                      `protobuf:"bytes,3,opt,name=system_prompt,json=systemPrompt,proto3" json:"system_prompt,omitempty"`                                             // Prompt of the plugin's agent
+	AgentModel    string                      `protobuf:"bytes,4,opt,name=agent_model,json=agentModel,proto3" json:"agent_model,omitempty"`                                                   // Preferred model of the agent, the default if empty
+	Schemas       map[string]*structpb.Struct `protobuf:"bytes,5,rep,name=schemas,proto3" json:"schemas,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // Command -> JSON schema of its input
+	EventTypes    []string                    `protobuf:"bytes,6,rep,name=event_types,json=eventTypes,proto3" json:"event_types,omitempty"`                                                   // Types of the events the plugin emits, e.g. weather_ForecastFetched
+	Subscriptions []string                    `protobuf:"bytes,7,rep,name=subscriptions,proto3" json:"subscriptions,omitempty"`                                                               // Event types applied, "taskmanager_*" for all of a plugin; the plugin's own if empty
+	Manifest      *Manifest                   `protobuf:"bytes,8,opt,name=manifest,proto3" json:"manifest,omitempty"`                                                                         // Optional, see eventsourcing.Manifest
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Description) Reset() {
+	*x = Description{}
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Description) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Description) ProtoMessage() {}
+
+func (x *Description) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Description.ProtoReflect.Descriptor instead.
+func (*Description) Descriptor() ([]byte, []int) {
+	return file_mindpalace_plugin_v1_plugin_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Description) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Description) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Description) GetSystemPrompt() string {
+	if x != nil {
+		return x.SystemPrompt
+	}
+	return ""
+}
+
+func (x *Description) GetAgentModel() string {
+	if x != nil {
+		return x.AgentModel
+	}
+	return ""
+}
+
+func (x *Description) GetSchemas() map[string]*structpb.Struct {
+	if x != nil {
+		return x.Schemas
+	}
+	return nil
+}
+
+func (x *Description) GetEventTypes() []string {
+	if x != nil {
+		return x.EventTypes
+	}
+	return nil
+}
+
+func (x *Description) GetSubscriptions() []string {
+	if x != nil {
+		return x.Subscriptions
+	}
+	return nil
+}
+
+func (x *Description) GetManifest() *Manifest {
+	if x != nil {
+		return x.Manifest
+	}
+	return nil
+}
+
+type Manifest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Version       string                 `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	Capabilities  []string               `protobuf:"bytes,2,rep,name=capabilities,proto3" json:"capabilities,omitempty"` // network, audio or files
+	Requires      []*Dependency          `protobuf:"bytes,3,rep,name=requires,proto3" json:"requires,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Manifest) Reset() {
+	*x = Manifest{}
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Manifest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Manifest) ProtoMessage() {}
+
+func (x *Manifest) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Manifest.ProtoReflect.Descriptor instead.
+func (*Manifest) Descriptor() ([]byte, []int) {
+	return file_mindpalace_plugin_v1_plugin_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Manifest) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *Manifest) GetCapabilities() []string {
+	if x != nil {
+		return x.Capabilities
+	}
+	return nil
+}
+
+func (x *Manifest) GetRequires() []*Dependency {
+	if x != nil {
+		return x.Requires
+	}
+	return nil
+}
+
+type Dependency struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Plugin        string                 `protobuf:"bytes,1,opt,name=plugin,proto3" json:"plugin,omitempty"`
+	MinVersion    string                 `protobuf:"bytes,2,opt,name=min_version,json=minVersion,proto3" json:"min_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Dependency) Reset() {
+	*x = Dependency{}
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Dependency) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Dependency) ProtoMessage() {}
+
+func (x *Dependency) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Dependency.ProtoReflect.Descriptor instead.
+func (*Dependency) Descriptor() ([]byte, []int) {
+	return file_mindpalace_plugin_v1_plugin_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Dependency) GetPlugin() string {
+	if x != nil {
+		return x.Plugin
+	}
+	return ""
+}
+
+func (x *Dependency) GetMinVersion() string {
+	if x != nil {
+		return x.MinVersion
+	}
+	return ""
+}
+
+type Event struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`                   // e.g. weather_ForecastFetched
+	Sequence      int64                  `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"`          // Position in the event log, 0 for events that are not stored
+	Version       int64                  `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`            // Position among the events of the stream
+	UserId        string                 `protobuf:"bytes,4,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"` // User the event happened for, empty for the owner
+	Data          *structpb.Struct       `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`                   // The event's fields
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_mindpalace_plugin_v1_plugin_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetSequence() int64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *Event) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Event) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *Event) GetData() *structpb.Struct {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type ExecuteCommandRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Command       string                 `protobuf:"bytes,1,opt,name=command,proto3" json:"command,omitempty"`
+	Input         *structpb.Struct       `protobuf:"bytes,2,opt,name=input,proto3" json:"input,omitempty"`                 // Input following the command's schema
+	UserId        string                 `protobuf:"bytes,3,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"` // User the command runs for, empty for the owner
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecuteCommandRequest) Reset() {
+	*x = ExecuteCommandRequest{}
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecuteCommandRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecuteCommandRequest) ProtoMessage() {}
+
+func (x *ExecuteCommandRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecuteCommandRequest.ProtoReflect.Descriptor instead.
+func (*ExecuteCommandRequest) Descriptor() ([]byte, []int) {
+	return file_mindpalace_plugin_v1_plugin_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ExecuteCommandRequest) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *ExecuteCommandRequest) GetInput() *structpb.Struct {
+	if x != nil {
+		return x.Input
+	}
+	return nil
+}
+
+func (x *ExecuteCommandRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type ExecuteCommandResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Events        []*Event               `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecuteCommandResponse) Reset() {
+	*x = ExecuteCommandResponse{}
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecuteCommandResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecuteCommandResponse) ProtoMessage() {}
+
+func (x *ExecuteCommandResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecuteCommandResponse.ProtoReflect.Descriptor instead.
+func (*ExecuteCommandResponse) Descriptor() ([]byte, []int) {
+	return file_mindpalace_plugin_v1_plugin_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ExecuteCommandResponse) GetEvents() []*Event {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+type ApplyEventRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Event         *Event                 `protobuf:"bytes,1,opt,name=event,proto3" json:"event,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ApplyEventRequest) Reset() {
+	*x = ApplyEventRequest{}
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ApplyEventRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ApplyEventRequest) ProtoMessage() {}
+
+func (x *ApplyEventRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ApplyEventRequest.ProtoReflect.Descriptor instead.
+func (*ApplyEventRequest) Descriptor() ([]byte, []int) {
+	return file_mindpalace_plugin_v1_plugin_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ApplyEventRequest) GetEvent() *Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+type ApplyEventResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Actions       []*structpb.Struct     `protobuf:"bytes,1,rep,name=actions,proto3" json:"actions,omitempty"` // 3D actions like {"type": "create", "node_id": "forecast"}
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ApplyEventResponse) Reset() {
+	*x = ApplyEventResponse{}
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ApplyEventResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ApplyEventResponse) ProtoMessage() {}
+
+func (x *ApplyEventResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ApplyEventResponse.ProtoReflect.Descriptor instead.
+func (*ApplyEventResponse) Descriptor() ([]byte, []int) {
+	return file_mindpalace_plugin_v1_plugin_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ApplyEventResponse) GetActions() []*structpb.Struct {
+	if x != nil {
+		return x.Actions
+	}
+	return nil
+}
+
+type GetFullStateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetFullStateRequest) Reset() {
+	*x = GetFullStateRequest{}
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetFullStateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetFullStateRequest) ProtoMessage() {}
+
+func (x *GetFullStateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetFullStateRequest.ProtoReflect.Descriptor instead.
+func (*GetFullStateRequest) Descriptor() ([]byte, []int) {
+	return file_mindpalace_plugin_v1_plugin_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GetFullStateRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type GetFullStateResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Actions       []*structpb.Struct     `protobuf:"bytes,1,rep,name=actions,proto3" json:"actions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetFullStateResponse) Reset() {
+	*x = GetFullStateResponse{}
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetFullStateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetFullStateResponse) ProtoMessage() {}
+
+func (x *GetFullStateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_mindpalace_plugin_v1_plugin_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetFullStateResponse.ProtoReflect.Descriptor instead.
+func (*GetFullStateResponse) Descriptor() ([]byte, []int) {
+	return file_mindpalace_plugin_v1_plugin_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GetFullStateResponse) GetActions() []*structpb.Struct {
+	if x != nil {
+		return x.Actions
+	}
+	return nil
+}
+
+var File_mindpalace_plugin_v1_plugin_proto protoreflect.FileDescriptor
+
+const file_mindpalace_plugin_v1_plugin_proto_rawDesc = "" +
+	"\n" +
+	"!mindpalace/plugin/v1/plugin.proto\x12\x14mindpalace.plugin.v1\x1a\x1cgoogle/protobuf/struct.proto\"\x11\n" +
+	"\x0fDescribeRequest\"\x9d\x03\n" +
+	"\vDescription\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12#\n" +
+	"\rsystem_prompt\x18\x03 \x01(\tR\fsystemPrompt\x12\x1f\n" +
+	"\vagent_model\x18\x04 \x01(\tR\n" +
+	"agentModel\x12H\n" +
+	"\aschemas\x18\x05 \x03(\v2..mindpalace.plugin.v1.Description.SchemasEntryR\aschemas\x12\x1f\n" +
+	"\vevent_types\x18\x06 \x03(\tR\n" +
+	"eventTypes\x12$\n" +
+	"\rsubscriptions\x18\a \x03(\tR\rsubscriptions\x12:\n" +
+	"\bmanifest\x18\b \x01(\v2\x1e.mindpalace.plugin.v1.ManifestR\bmanifest\x1aS\n" +
+	"\fSchemasEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12-\n" +
+	"\x05value\x18\x02 \x01(\v2\x17.google.protobuf.StructR\x05value:\x028\x01\"\x86\x01\n" +
+	"\bManifest\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\x12\"\n" +
+	"\fcapabilities\x18\x02 \x03(\tR\fcapabilities\x12<\n" +
+	"\brequires\x18\x03 \x03(\v2 .mindpalace.plugin.v1.DependencyR\brequires\"E\n" +
+	"\n" +
+	"Dependency\x12\x16\n" +
+	"\x06plugin\x18\x01 \x01(\tR\x06plugin\x12\x1f\n" +
+	"\vmin_version\x18\x02 \x01(\tR\n" +
+	"minVersion\"\x97\x01\n" +
+	"\x05Event\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x1a\n" +
+	"\bsequence\x18\x02 \x01(\x03R\bsequence\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\x03R\aversion\x12\x17\n" +
+	"\auser_id\x18\x04 \x01(\tR\x06userId\x12+\n" +
+	"\x04data\x18\x05 \x01(\v2\x17.google.protobuf.StructR\x04data\"y\n" +
+	"\x15ExecuteCommandRequest\x12\x18\n" +
+	"\acommand\x18\x01 \x01(\tR\acommand\x12-\n" +
+	"\x05input\x18\x02 \x01(\v2\x17.google.protobuf.StructR\x05input\x12\x17\n" +
+	"\auser_id\x18\x03 \x01(\tR\x06userId\"M\n" +
+	"\x16ExecuteCommandResponse\x123\n" +
+	"\x06events\x18\x01 \x03(\v2\x1b.mindpalace.plugin.v1.EventR\x06events\"F\n" +
+	"\x11ApplyEventRequest\x121\n" +
+	"\x05event\x18\x01 \x01(\v2\x1b.mindpalace.plugin.v1.EventR\x05event\"G\n" +
+	"\x12ApplyEventResponse\x121\n" +
+	"\aactions\x18\x01 \x03(\v2\x17.google.protobuf.StructR\aactions\".\n" +
+	"\x13GetFullStateRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\"I\n" +
+	"\x14GetFullStateResponse\x121\n" +
+	"\aactions\x18\x01 \x03(\v2\x17.google.protobuf.StructR\aactions2\x93\x03\n" +
+	"\x06Plugin\x12T\n" +
+	"\bDescribe\x12%.mindpalace.plugin.v1.DescribeRequest\x1a!.mindpalace.plugin.v1.Description\x12k\n" +
+	"\x0eExecuteCommand\x12+.mindpalace.plugin.v1.ExecuteCommandRequest\x1a,.mindpalace.plugin.v1.ExecuteCommandResponse\x12_\n" +
+	"\n" +
+	"ApplyEvent\x12'.mindpalace.plugin.v1.ApplyEventRequest\x1a(.mindpalace.plugin.v1.ApplyEventResponse\x12e\n" +
+	"\fGetFullState\x12).mindpalace.plugin.v1.GetFullStateRequest\x1a*.mindpalace.plugin.v1.GetFullStateResponseB&Z$mindpalace/pkg/api/pluginv1;pluginv1b\x06proto3"
+
+var (
+	file_mindpalace_plugin_v1_plugin_proto_rawDescOnce sync.Once
+	file_mindpalace_plugin_v1_plugin_proto_rawDescData []byte
+)
+
+func file_mindpalace_plugin_v1_plugin_proto_rawDescGZIP() []byte {
+	file_mindpalace_plugin_v1_plugin_proto_rawDescOnce.Do(func() {
+		file_mindpalace_plugin_v1_plugin_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_mindpalace_plugin_v1_plugin_proto_rawDesc), len(file_mindpalace_plugin_v1_plugin_proto_rawDesc)))
+	})
+	return file_mindpalace_plugin_v1_plugin_proto_rawDescData
+}
+
+var file_mindpalace_plugin_v1_plugin_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_mindpalace_plugin_v1_plugin_proto_goTypes = []any{
+	(*DescribeRequest)(nil),        // 0: mindpalace.plugin.v1.DescribeRequest
+	(*Description)(nil),            // 1: mindpalace.plugin.v1.Description
+	(*Manifest)(nil),               // 2: mindpalace.plugin.v1.Manifest
+	(*Dependency)(nil),             // 3: mindpalace.plugin.v1.Dependency
+	(*Event)(nil),                  // 4: mindpalace.plugin.v1.Event
+	(*ExecuteCommandRequest)(nil),  // 5: mindpalace.plugin.v1.ExecuteCommandRequest
+	(*ExecuteCommandResponse)(nil), // 6: mindpalace.plugin.v1.ExecuteCommandResponse
+	(*ApplyEventRequest)(nil),      // 7: mindpalace.plugin.v1.ApplyEventRequest
+	(*ApplyEventResponse)(nil),     // 8: mindpalace.plugin.v1.ApplyEventResponse
+	(*GetFullStateRequest)(nil),    // 9: mindpalace.plugin.v1.GetFullStateRequest
+	(*GetFullStateResponse)(nil),   // 10: mindpalace.plugin.v1.GetFullStateResponse
+	nil,                            // 11: mindpalace.plugin.v1.Description.SchemasEntry
+	(*structpb.Struct)(nil),        // 12: google.protobuf.Struct
+}
+var file_mindpalace_plugin_v1_plugin_proto_depIdxs = []int32{
+	11, // 0: mindpalace.plugin.v1.Description.schemas:type_name -> mindpalace.plugin.v1.Description.SchemasEntry
+	2,  // 1: mindpalace.plugin.v1.Description.manifest:type_name -> mindpalace.plugin.v1.Manifest
+	3,  // 2: mindpalace.plugin.v1.Manifest.requires:type_name -> mindpalace.plugin.v1.Dependency
+	12, // 3: mindpalace.plugin.v1.Event.data:type_name -> google.protobuf.Struct
+	12, // 4: mindpalace.plugin.v1.ExecuteCommandRequest.input:type_name -> google.protobuf.Struct
+	4,  // 5: mindpalace.plugin.v1.ExecuteCommandResponse.events:type_name -> mindpalace.plugin.v1.Event
+	4,  // 6: mindpalace.plugin.v1.ApplyEventRequest.event:type_name -> mindpalace.plugin.v1.Event
+	12, // 7: mindpalace.plugin.v1.ApplyEventResponse.actions:type_name -> google.protobuf.Struct
+	12, // 8: mindpalace.plugin.v1.GetFullStateResponse.actions:type_name -> google.protobuf.Struct
+	12, // 9: mindpalace.plugin.v1.Description.SchemasEntry.value:type_name -> google.protobuf.Struct
+	0,  // 10: mindpalace.plugin.v1.Plugin.Describe:input_type -> mindpalace.plugin.v1.DescribeRequest
+	5,  // 11: mindpalace.plugin.v1.Plugin.ExecuteCommand:input_type -> mindpalace.plugin.v1.ExecuteCommandRequest
+	7,  // 12: mindpalace.plugin.v1.Plugin.ApplyEvent:input_type -> mindpalace.plugin.v1.ApplyEventRequest
+	9,  // 13: mindpalace.plugin.v1.Plugin.GetFullState:input_type -> mindpalace.plugin.v1.GetFullStateRequest
+	1,  // 14: mindpalace.plugin.v1.Plugin.Describe:output_type -> mindpalace.plugin.v1.Description
+	6,  // 15: mindpalace.plugin.v1.Plugin.ExecuteCommand:output_type -> mindpalace.plugin.v1.ExecuteCommandResponse
+	8,  // 16: mindpalace.plugin.v1.Plugin.ApplyEvent:output_type -> mindpalace.plugin.v1.ApplyEventResponse
+	10, // 17: mindpalace.plugin.v1.Plugin.GetFullState:output_type -> mindpalace.plugin.v1.GetFullStateResponse
+	14, // [14:18] is the sub-list for method output_type
+	10, // [10:14] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_mindpalace_plugin_v1_plugin_proto_init() }
+func file_mindpalace_plugin_v1_plugin_proto_init() {
+	if File_mindpalace_plugin_v1_plugin_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_mindpalace_plugin_v1_plugin_proto_rawDesc), len(file_mindpalace_plugin_v1_plugin_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_mindpalace_plugin_v1_plugin_proto_goTypes,
+		DependencyIndexes: file_mindpalace_plugin_v1_plugin_proto_depIdxs,
+		MessageInfos:      file_mindpalace_plugin_v1_plugin_proto_msgTypes,
+	}.Build()
+	File_mindpalace_plugin_v1_plugin_proto = out.File
+	file_mindpalace_plugin_v1_plugin_proto_goTypes = nil
+	file_mindpalace_plugin_v1_plugin_proto_depIdxs = nil
+}
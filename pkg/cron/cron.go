@@ -0,0 +1,188 @@
+// Package cron parses cron expressions, like "0 18 * * *" for every evening at 18:00, and finds the
+// times they run at. Times are matched in the location of the time they are relative to, so each
+// user's schedules run on their own clock.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	spec    string
+	minutes uint64 // Bit i set when the schedule runs at minute i
+	hours   uint64
+	days    uint64 // Days of the month, from 1
+	months  uint64 // From 1
+	weekday uint64 // From 0, Sunday
+	anyDay  bool   // Day of the month is *, only the weekday restricts the days
+	anyWeek bool   // Weekday is *, only the day of the month restricts the days
+}
+
+// field is one of the five fields of an expression
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}},
+	{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}},
+}
+
+// shorthands are the expressions understood in place of the five fields
+var shorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses an expression of five fields: minute, hour, day of month, month and day of week. Fields
+// take *, numbers, ranges like 1-5, lists like 1,15 and steps like */15; months and days of the week
+// may be named, as in "mon-fri". Sunday is 0 or 7. Like in cron, a day matches if either the day of
+// the month or the day of the week does when both are restricted. The shorthands @hourly, @daily,
+// @weekly, @monthly and @yearly are understood too.
+func Parse(spec string) (*Schedule, error) {
+	expression := strings.ToLower(strings.TrimSpace(spec))
+	if shorthand, ok := shorthands[expression]; ok {
+		expression = shorthand
+	}
+	parts := strings.Fields(expression)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("%q must have 5 fields: minute hour day-of-month month day-of-week, like \"0 18 * * *\"", spec)
+	}
+	s := &Schedule{spec: strings.TrimSpace(spec)}
+	bits := make([]uint64, len(fields))
+	for i, part := range parts {
+		set, err := fields[i].parse(part)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", spec, err)
+		}
+		bits[i] = set
+	}
+	s.minutes, s.hours, s.days, s.months, s.weekday = bits[0], bits[1], bits[2], bits[3], bits[4]
+	if s.weekday&(1<<7) != 0 {
+		s.weekday |= 1 // Sunday is 7 as well as 0
+	}
+	s.anyDay = parts[2] == "*"
+	s.anyWeek = parts[4] == "*"
+	return s, nil
+}
+
+// parse returns the values a field matches as bits
+func (f field) parse(text string) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(text, ",") {
+		rangeText, stepText, stepped := strings.Cut(item, "/")
+		step := 1
+		if stepped {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q in the %s", stepText, f.name)
+			}
+			step = n
+		}
+		low, high := f.min, f.max
+		if rangeText != "*" {
+			lowText, highText, isRange := strings.Cut(rangeText, "-")
+			var err error
+			if low, err = f.value(lowText); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = f.value(highText); err != nil {
+					return 0, err
+				}
+			} else if stepped {
+				high = f.max // 5/15 runs from 5 on
+			}
+			if high < low {
+				return 0, fmt.Errorf("range %s of the %s ends before it starts", rangeText, f.name)
+			}
+		}
+		for v := low; v <= high; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// value parses a number or name of the field
+func (f field) value(text string) (int, error) {
+	if v, ok := f.names[text]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(text)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%q is not a %s from %d to %d", text, f.name, f.min, f.max)
+	}
+	return v, nil
+}
+
+// String returns the expression as given
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+// maxYears is how far ahead Next looks, so a schedule like February 30 never matching ends the search
+const maxYears = 5
+
+// Next returns the first time after t the schedule runs at, in t's location, or the zero time if it
+// never does. Times the clocks skip when they go forward are not run at.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxYears, 0, 0)
+	for t.Before(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// matchesDay reports whether the schedule runs on the day of t
+func (s *Schedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekday&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDay && s.anyWeek:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeek:
+		return day
+	}
+	return day || weekday
+}
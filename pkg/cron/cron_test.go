@@ -0,0 +1,84 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSchedule_Next(t *testing.T) {
+	// Wednesday
+	now := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"0 18 * * *", time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2024, 5, 2, 10, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 5, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2024, 5, 5, 9, 0, 0, 0, time.UTC)},
+		{"0 8 1,15 * *", time.Date(2024, 5, 15, 8, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC)},
+		// Both days restricted: the 10th or any Friday, whichever comes first
+		{"0 12 10 * fri", time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(now); !got.Equal(tt.want) {
+			t.Errorf("Next of %q = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestSchedule_NextInLocation(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skip("time zone data unavailable")
+	}
+	s, _ := Parse("0 18 * * *")
+	// 17:00 UTC is 19:00 in Amsterdam, past 18:00 on its clock
+	if got := s.Next(time.Date(2024, 5, 1, 17, 0, 0, 0, time.UTC).In(amsterdam)); !got.Equal(time.Date(2024, 5, 2, 18, 0, 0, 0, amsterdam)) {
+		t.Errorf("Expected the next 18:00 in Amsterdam, got %v", got)
+	}
+	// The night the clocks go forward 02:30 doesn't exist, the run is skipped
+	s, _ = Parse("30 2 * * *")
+	if got := s.Next(time.Date(2024, 3, 31, 0, 0, 0, 0, amsterdam)); !got.Equal(time.Date(2024, 4, 1, 2, 30, 0, 0, amsterdam)) {
+		t.Errorf("Expected the run the next night, got %v", got)
+	}
+}
+
+func TestSchedule_NeverRuns(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if next := s.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Expected February 30 never to come, got %v", next)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for spec, reason := range map[string]string{
+		"":               "5 fields",
+		"0 18 * *":       "5 fields",
+		"60 * * * *":     "minute from 0 to 59",
+		"0 24 * * *":     "hour from 0 to 23",
+		"0 0 0 * *":      "day of month from 1 to 31",
+		"0 0 * 13 *":     "month from 1 to 12",
+		"0 0 * * funday": "day of week",
+		"*/0 * * * *":    "invalid step",
+		"0 0 * * 5-1":    "ends before it starts",
+	} {
+		if _, err := Parse(spec); err == nil || !strings.Contains(err.Error(), reason) {
+			t.Errorf("Parse(%q) = %v, want an error about %s", spec, err, reason)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package eventsourcing
+
+import (
+	"bytes"
+	"time"
+
+	"mindpalace/pkg/logging"
+)
+
+// Change is how a published event changed the aggregate it belongs to: the aggregate's state before
+// and after applying the event, as serialized by its Snapshotter.
+type Change struct {
+	Event  Event
+	Before []byte
+	After  []byte
+}
+
+// ChangeRecorder is told how every event published changes its aggregate, e.g. to keep an audit trail.
+// Events of aggregates that don't implement Snapshotter, and events changing nothing, are left out.
+type ChangeRecorder interface {
+	RecordChange(change Change) // Called while the event is applied, so keep it short.
+}
+
+// StoredChange is a change as persisted next to the event log, with the difference the recorder
+// computed from the states before and after the event
+type StoredChange struct {
+	Sequence  int64 // Of the event
+	Stream    string
+	EventType string
+	UserID    string
+	Diff      []byte
+	Timestamp time.Time
+}
+
+// ChangeStore persists the changes recorded for the audit trail next to the event log
+type ChangeStore interface {
+	SaveChange(change StoredChange) error
+	LoadChanges() ([]StoredChange, error) // Returns the changes in the order of their events.
+}
+
+// SetChangeRecorder makes the bus report how each newly published event changes its aggregate
+func (eb *SimpleEventBus) SetChangeRecorder(recorder ChangeRecorder) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	eb.recorder = recorder
+}
+
+// applyStored applies a newly stored event, reporting the change to its aggregate to the recorder;
+// eb.mu must be held
+func (eb *SimpleEventBus) applyStored(event Event) {
+	if eb.recorder == nil {
+		eb.apply(event)
+		return
+	}
+	snapshotter := eb.snapshotterOf(event)
+	if snapshotter == nil {
+		eb.apply(event)
+		return
+	}
+	before, err := snapshotter.SaveSnapshot()
+	eb.apply(event)
+	if err != nil {
+		logging.Error("Failed to record the change of %s: %v", event.Type(), err)
+		return
+	}
+	after, err := snapshotter.SaveSnapshot()
+	if err != nil {
+		logging.Error("Failed to record the change of %s: %v", event.Type(), err)
+		return
+	}
+	if !bytes.Equal(before, after) {
+		eb.recorder.RecordChange(Change{Event: event, Before: before, After: after})
+	}
+}
+
+// snapshotterOf returns the aggregate of the event's user the event belongs to, nil if it can't be
+// serialized
+func (eb *SimpleEventBus) snapshotterOf(event Event) Snapshotter {
+	aggregateID := AggregateOf(event.Type())
+	for _, agg := range aggregatesOf(eb.aggStore, event.Metadata().UserID) {
+		if agg.ID() == aggregateID {
+			snapshotter, _ := agg.(Snapshotter)
+			return snapshotter
+		}
+	}
+	return nil
+}
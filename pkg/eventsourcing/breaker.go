@@ -0,0 +1,161 @@
+package eventsourcing
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by guarded handlers while their circuit is open, retrying them is pointless
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitBreaker stops handlers that keep failing: once a handler fails maxFailures times within the
+// window its circuit opens, and a guarded handler is refused until its circuit is closed again by hand.
+// The handlers are named, for plugin commands by HandlerName.
+type CircuitBreaker struct {
+	mu          sync.Mutex
+	window      time.Duration
+	maxFailures int
+	failures    map[string][]time.Time // Handler -> times of its failures within the window
+	open        map[string]bool        // Handlers whose circuit is open
+	guarded     map[string][2]string   // Handler -> the plugin and command it guards
+	onOpen      []func(plugin, command string, failures int, err error)
+	now         func() time.Time
+}
+
+// NewCircuitBreaker creates a breaker opening the circuit of a handler failing maxFailures times within the window
+func NewCircuitBreaker(window time.Duration, maxFailures int) *CircuitBreaker {
+	return &CircuitBreaker{
+		window:      window,
+		maxFailures: maxFailures,
+		failures:    make(map[string][]time.Time),
+		open:        make(map[string]bool),
+		guarded:     make(map[string][2]string),
+		now:         time.Now,
+	}
+}
+
+// HandlerName names the handler of a plugin's command in the breaker
+func HandlerName(plugin, command string) string {
+	return plugin + "." + command
+}
+
+// OnOpen registers a function called when the circuit of a guarded plugin command opens, e.g. to record
+// that the plugin is quarantined. It is not called for circuits opened by Open.
+func (cb *CircuitBreaker) OnOpen(fn func(plugin, command string, failures int, err error)) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.onOpen = append(cb.onOpen, fn)
+}
+
+// Failed records a failure of the handler, opening its circuit when it failed too often within the window.
+// It reports whether this failure opened the circuit.
+func (cb *CircuitBreaker) Failed(handler string, err error) bool {
+	cb.mu.Lock()
+	now := cb.now()
+	recent := []time.Time{now}
+	for _, at := range cb.failures[handler] {
+		if now.Sub(at) < cb.window {
+			recent = append(recent, at)
+		}
+	}
+	cb.failures[handler] = recent
+	if cb.open[handler] || len(recent) < cb.maxFailures {
+		cb.mu.Unlock()
+		return false
+	}
+	cb.open[handler] = true
+	guarded, isGuarded := cb.guarded[handler]
+	callbacks := append([]func(string, string, int, error){}, cb.onOpen...)
+	cb.mu.Unlock()
+
+	// Called without the lock, the callbacks publish events applied by aggregates calling Open
+	if isGuarded {
+		for _, callback := range callbacks {
+			callback(guarded[0], guarded[1], len(recent), err)
+		}
+	}
+	return true
+}
+
+// Failures returns how often the handler failed within the window
+func (cb *CircuitBreaker) Failures(handler string) int {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	count := 0
+	for _, at := range cb.failures[handler] {
+		if cb.now().Sub(at) < cb.window {
+			count++
+		}
+	}
+	return count
+}
+
+// IsOpen reports whether the handler's circuit is open
+func (cb *CircuitBreaker) IsOpen(handler string) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.open[handler]
+}
+
+// Open opens the handler's circuit, e.g. when replaying that it was opened before a restart
+func (cb *CircuitBreaker) Open(handler string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.open[handler] = true
+}
+
+// Close closes the handler's circuit and forgets its failures, the handler runs again
+func (cb *CircuitBreaker) Close(handler string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	delete(cb.open, handler)
+	delete(cb.failures, handler)
+}
+
+// OpenHandlers returns the handlers whose circuit is open, sorted
+func (cb *CircuitBreaker) OpenHandlers() []string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	handlers := make([]string, 0, len(cb.open))
+	for handler := range cb.open {
+		handlers = append(handlers, handler)
+	}
+	sort.Strings(handlers)
+	return handlers
+}
+
+// guardedCommand runs a plugin's command unless its circuit is open, turning a panic into an error
+type guardedCommand struct {
+	rm      *ErrorRecoveryManager
+	plugin  string
+	command string
+	handler CommandHandler
+}
+
+// GuardCommand wraps the command of a plugin: it is refused with ErrCircuitOpen while its circuit is open,
+// and a panic is reported to the error handlers, counted as a failure and returned as an error. Errors the
+// command returns are not counted, commands return them for input they refuse.
+func (rm *ErrorRecoveryManager) GuardCommand(plugin, command string, handler CommandHandler) CommandHandler {
+	rm.breaker.mu.Lock()
+	rm.breaker.guarded[HandlerName(plugin, command)] = [2]string{plugin, command}
+	rm.breaker.mu.Unlock()
+	return guardedCommand{rm: rm, plugin: plugin, command: command, handler: handler}
+}
+
+func (g guardedCommand) Execute(data any) (events []Event, err error) {
+	name := HandlerName(g.plugin, g.command)
+	if g.rm.breaker.IsOpen(name) {
+		return nil, fmt.Errorf("command %s of plugin %s is quarantined after failing repeatedly, re-enable it with ReenablePlugin: %w", g.command, g.plugin, ErrCircuitOpen)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = g.rm.recovered(r, string(debug.Stack()), name, map[string]interface{}{"plugin": g.plugin, "command": g.command})
+			events, err = nil, fmt.Errorf("command %s panicked: %w", g.command, err)
+		}
+	}()
+	return g.handler.Execute(data)
+}
@@ -0,0 +1,70 @@
+package eventsourcing
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type panicInput struct{ Panic bool }
+
+func TestGuardCommand_Quarantines(t *testing.T) {
+	rm := NewErrorRecoveryManager(time.Minute, 3)
+	var reported []string
+	rm.RegisterErrorHandler(func(err error, stackTrace string, eventType string, recoveryData map[string]interface{}) {
+		reported = append(reported, eventType)
+	})
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	rm.breaker.now = func() time.Time { return now }
+	var opened []string
+	rm.Breaker().OnOpen(func(plugin, command string, failures int, err error) {
+		opened = append(opened, fmt.Sprintf("%s %s %d %v", plugin, command, failures, err))
+	})
+
+	command := rm.GuardCommand("notes", "AddNote", NewCommand(func(input *panicInput) ([]Event, error) {
+		if input.Panic {
+			panic("index out of range")
+		}
+		return []Event{&sequencedEvent{EventType: "tasks_Created"}}, nil
+	}))
+	run := func(panics bool) error {
+		_, err := command.Execute(&panicInput{Panic: panics})
+		return err
+	}
+
+	if err := run(true); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected a panic returned as an error, got %v", err)
+	}
+	now = now.Add(2 * time.Minute) // The first panic leaves the window
+	run(true)
+	if err := run(false); err != nil {
+		t.Fatalf("Expected the command to run after a panic within the window, got %v", err)
+	}
+	run(true)
+	run(true)
+	if len(opened) != 1 || opened[0] != "notes AddNote 3 index out of range" {
+		t.Fatalf("Expected the circuit opened by the third panic within the window, got %v", opened)
+	}
+	if err := run(false); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected the command refused while quarantined, got %v", err)
+	}
+	if len(reported) != 4 || reported[0] != HandlerName("notes", "AddNote") {
+		t.Errorf("Expected each panic reported to the error handlers, got %v", reported)
+	}
+
+	rm.Breaker().Close(HandlerName("notes", "AddNote"))
+	if err := run(false); err != nil {
+		t.Errorf("Expected the command to run once re-enabled, got %v", err)
+	}
+	run(true)
+	if rm.Breaker().IsOpen(HandlerName("notes", "AddNote")) {
+		t.Error("Expected the failures before re-enabling forgotten")
+	}
+
+	// Opening a circuit by hand, as on replay, doesn't report it again
+	rm.Breaker().Open(HandlerName("notes", "EditNote"))
+	if got := rm.Breaker().OpenHandlers(); len(got) != 1 || got[0] != "notes.EditNote" || len(opened) != 1 {
+		t.Errorf("Expected only notes.EditNote open without a report, got %v and %v", got, opened)
+	}
+}
@@ -0,0 +1,132 @@
+package eventsourcing
+
+import (
+	"errors"
+	"fmt"
+
+	"mindpalace/pkg/logging"
+)
+
+// ConflictError reports that an aggregate changed while a command was executing, in a way the
+// command's events can't be merged with. Executing the command again on the new state may succeed.
+type ConflictError struct {
+	Aggregate string
+	Expected  int64 // Version the command read the aggregate at
+	Actual    int64 // Version the aggregate was at when the events were published
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s changed while the command ran (version %d, expected %d), try again", e.Aggregate, e.Actual, e.Expected)
+}
+
+// Retriable reports that the command can be executed again
+func (e *ConflictError) Retriable() bool { return true }
+
+// IsConflict reports whether the error is a ConflictError
+func IsConflict(err error) bool {
+	var conflict *ConflictError
+	return errors.As(err, &conflict)
+}
+
+// VersionedStore is an event store that numbers the events of each aggregate, per user (see
+// StreamOf), which lets the event bus detect commands changing the same aggregate concurrently.
+type VersionedStore interface {
+	Versions() map[string]int64                       // Version of the last event stored per stream.
+	EventsSince(stream string, version int64) []Event // Events of the stream stored after the version.
+}
+
+// ConflictResolver lets aggregates merge concurrent changes instead of failing the later command.
+// Implement if the aggregate can tell whether changes interfere (e.g., updates of different tasks).
+// Aggregates that don't implement it merge all concurrent changes.
+type ConflictResolver interface {
+	Conflicts(events, concurrent []Event) bool // Reports whether the events can't be applied after the concurrent events.
+}
+
+// VersionedBus is an event bus that publishes the events of a command only when they don't conflict
+// with changes published since the command read the aggregates.
+type VersionedBus interface {
+	Versions() map[string]int64
+	PublishExpected(expected map[string]int64, events ...Event) error
+}
+
+// Versions returns the version of every aggregate, nil if the store doesn't number events
+func (eb *SimpleEventBus) Versions() map[string]int64 {
+	store, ok := eb.store.(VersionedStore)
+	if !ok {
+		return nil
+	}
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	return store.Versions()
+}
+
+// PublishExpected publishes the events a command emitted after reading the aggregates at the expected
+// versions. Changes published meanwhile are merged unless the aggregate's ConflictResolver finds they
+// conflict, in which case nothing is published and a *ConflictError is returned.
+func (eb *SimpleEventBus) PublishExpected(expected map[string]int64, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	store, ok := eb.store.(VersionedStore)
+	if !ok || expected == nil {
+		for _, event := range events {
+			eb.Publish(event)
+		}
+		return nil
+	}
+
+	// Checking and storing the first event happen under one lock, so no other event slips in between
+	eb.mu.Lock()
+	if err := eb.checkVersions(store, expected, events); err != nil {
+		eb.mu.Unlock()
+		return err
+	}
+	eb.storeAndApply(events[0])
+	eb.mu.Unlock()
+	eb.dispatch(events[0])
+
+	// Later events are caused by the first, events published meanwhile don't conflict with them
+	for _, event := range events[1:] {
+		eb.Publish(event)
+	}
+	return nil
+}
+
+// checkVersions returns a *ConflictError if an aggregate of the events changed since the expected
+// version in a way its ConflictResolver doesn't merge; eb.mu must be held
+func (eb *SimpleEventBus) checkVersions(store VersionedStore, expected map[string]int64, events []Event) error {
+	versions := store.Versions()
+	byStream := make(map[string][]Event)
+	for _, event := range events {
+		if event.Metadata().Sequence == 0 && !IsTransient(event) {
+			stream := StreamOf(event.Metadata().UserID, event.Type())
+			byStream[stream] = append(byStream[stream], event)
+		}
+	}
+	for stream, streamEvents := range byStream {
+		if versions[stream] == expected[stream] {
+			continue
+		}
+		resolver := eb.resolver(streamEvents[0].Metadata().UserID, AggregateOf(streamEvents[0].Type()))
+		if resolver == nil {
+			continue
+		}
+		concurrent := store.EventsSince(stream, expected[stream])
+		if resolver.Conflicts(streamEvents, concurrent) {
+			return &ConflictError{Aggregate: stream, Expected: expected[stream], Actual: versions[stream]}
+		}
+		logging.Debug("Merged %d event(s) with %d concurrent change(s) of %s", len(streamEvents), len(concurrent), stream)
+	}
+	return nil
+}
+
+// resolver returns the ConflictResolver of the user's aggregate, nil if it has none
+func (eb *SimpleEventBus) resolver(userID, aggregateID string) ConflictResolver {
+	for _, agg := range aggregatesOf(eb.aggStore, userID) {
+		if agg.ID() == aggregateID {
+			resolver, _ := agg.(ConflictResolver)
+			return resolver
+		}
+	}
+	return nil
+}
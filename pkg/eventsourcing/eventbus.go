@@ -3,6 +3,7 @@ package eventsourcing
 import (
 	"log"
 	"mindpalace/pkg/logging"
+	"sync"
 )
 
 type EventBus interface {
@@ -17,6 +18,12 @@ type SimpleEventBus struct {
 	allUpdatesSubscribers []EventHandler
 	aggStore              AggregateStore
 	deltaChan             chan DeltaEnvelope
+	snapshots             SnapshotStore
+	snapshotInterval      int
+	published             int
+	recorder              ChangeRecorder
+	closed                bool       // Set by Close, events published afterwards are dropped
+	mu                    sync.Mutex // Guards storing and applying events, so they happen one event at a time
 }
 
 type AggregateStore interface {
@@ -40,22 +47,82 @@ func (eb *SimpleEventBus) SubscribeAll(handler EventHandler) {
 	eb.allUpdatesSubscribers = append(eb.allUpdatesSubscribers, handler)
 }
 
+// SetSnapshotStore enables periodic snapshots of all Snapshotter aggregates every interval events.
+func (eb *SimpleEventBus) SetSnapshotStore(store SnapshotStore, interval int) {
+	eb.snapshots = store
+	eb.snapshotInterval = interval
+}
+
 type EventHandler func(event Event) error
 
 func (eb *SimpleEventBus) Publish(event Event) {
-	// Persist event first
+	// An event with a sequence was stored and published before: only aggregates that missed it apply it
+	if event.Metadata().Sequence > 0 {
+		logging.Debug("Event %s (sequence %d) delivered again", event.Type(), event.Metadata().Sequence)
+		eb.mu.Lock()
+		eb.apply(event)
+		eb.mu.Unlock()
+		return
+	}
+
+	// Persist event first, then apply it to aggregates; the versions read by commands match their state
+	eb.mu.Lock()
+	if eb.closed {
+		eb.mu.Unlock()
+		logging.Error("Dropping event %s published after the event bus was closed", event.Type())
+		return
+	}
+	eb.storeAndApply(event)
+	eb.mu.Unlock()
+
+	eb.dispatch(event)
+}
+
+// storeAndApply appends a new event to the store and applies it, transient events are only applied.
+// Every snapshotInterval stored events the aggregates are snapshotted, before another event can be
+// stored, so a snapshot holds exactly the events up to its version; eb.mu must be held
+func (eb *SimpleEventBus) storeAndApply(event Event) {
+	if IsTransient(event) {
+		eb.apply(event)
+		return
+	}
 	eb.store.Append(event)
+	eb.applyStored(event)
+	eb.published++
+	if eb.snapshots != nil && eb.snapshotInterval > 0 && eb.published%eb.snapshotInterval == 0 {
+		eb.snapshotAggregates()
+	}
+}
 
-	// Apply to aggregates
-	for _, agg := range eb.aggStore.AllAggregates() {
-		err := agg.ApplyEvent(event)
-		if err != nil {
-			logging.Error("Apply failed for event %s, on agg %s: %v", event.Type(), agg.ID(), err)
-		}
+// Close waits for the event being stored and applied, then snapshots the aggregates so a restart
+// starts from the current state. Events published afterwards are dropped, the store is about to close.
+func (eb *SimpleEventBus) Close() {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	eb.closed = true
+	if eb.snapshots != nil {
+		eb.snapshotAggregates()
 	}
+}
+
+// Rewrite runs rewrite, e.g. a compaction of the event log, while no events are stored or applied, then
+// snapshots the aggregates: a restart replays the events after the snapshots counted in the rewritten log
+func (eb *SimpleEventBus) Rewrite(rewrite func() error) error {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	err := rewrite()
+	// Snapshot even after an error, the log may have been rewritten before it occurred
+	if eb.snapshots != nil {
+		eb.snapshotAggregates()
+	}
+	return err
+}
 
+// dispatch emits the 3D deltas of an applied event and notifies the subscribers
+func (eb *SimpleEventBus) dispatch(event Event) {
 	// Emit 3D deltas
-	for _, agg := range eb.aggStore.AllAggregates() {
+	userID := event.Metadata().UserID
+	for _, agg := range aggregatesOf(eb.aggStore, userID) {
 		if broadcaster, ok := agg.(ThreeDUIBroadcaster); ok {
 			actions := broadcaster.Broadcast3DDelta(event)
 			if len(actions) > 0 {
@@ -63,8 +130,11 @@ func (eb *SimpleEventBus) Publish(event Event) {
 				case eb.deltaChan <- DeltaEnvelope{
 					Type:      "delta",
 					Aggregate: agg.ID(),
-					EventID:   ISOTimestamp(),
+					EventID:   eventID(event),
+					Sequence:  event.Metadata().Sequence,
+					Version:   event.Metadata().Version,
 					Timestamp: ISOTimestamp(),
+					UserID:    userID,
 					Actions:   actions,
 				}:
 				default: // Drop silently to avoid blocking
@@ -88,3 +158,44 @@ func (eb *SimpleEventBus) Publish(event Event) {
 		}
 	}
 }
+
+// apply applies the event to the aggregates of its user that did not apply it yet
+func (eb *SimpleEventBus) apply(event Event) {
+	for _, agg := range aggregatesOf(eb.aggStore, event.Metadata().UserID) {
+		applied, err := ApplyOnce(agg, event)
+		if err != nil {
+			logging.Error("Apply failed for event %s, on agg %s: %v", event.Type(), agg.ID(), err)
+		}
+		if !applied {
+			logging.Debug("Skipped event %s, already applied to agg %s", event.Type(), agg.ID())
+		}
+	}
+}
+
+// snapshotAggregates saves the state of the Snapshotter aggregates at the current end of the log; eb.mu
+// must be held, so no event is stored or applied between reading the version and the states
+func (eb *SimpleEventBus) snapshotAggregates() {
+	version := eventCount(eb.store)
+	for id, agg := range SnapshotIDs(eb.aggStore) {
+		snapshotter, ok := agg.(Snapshotter)
+		if !ok {
+			continue
+		}
+		data, err := snapshotter.SaveSnapshot()
+		if err != nil {
+			logging.Error("Snapshot failed for agg %s: %v", agg.ID(), err)
+			continue
+		}
+		if err := eb.snapshots.SaveSnapshot(id, version, data); err != nil {
+			logging.Error("Storing snapshot failed for agg %s: %v", agg.ID(), err)
+		}
+	}
+}
+
+// eventCount returns the number of events in the store, counted by the store when it keeps count
+func eventCount(store EventStore) int {
+	if counter, ok := store.(interface{ Len() int }); ok {
+		return counter.Len()
+	}
+	return len(store.GetEvents())
+}
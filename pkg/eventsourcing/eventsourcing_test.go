@@ -1,7 +1,13 @@
 package eventsourcing
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -117,6 +123,33 @@ func TestUnmarshalEvent_InvalidJSON(t *testing.T) {
 	}
 }
 
+func TestUnmarshalEvent_LLMEvents(t *testing.T) {
+	chunk := &LLMStreamChunkEvent{RequestID: "req1", PartialContent: "Hello", IsFinal: true}
+	data, err := chunk.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	event, err := UnmarshalEvent(data)
+	if err != nil {
+		t.Fatalf("UnmarshalEvent failed: %v", err)
+	}
+	if e, ok := event.(*LLMStreamChunkEvent); !ok || e.PartialContent != "Hello" || !e.IsFinal {
+		t.Errorf("Expected the chunk back, got %#v", event)
+	}
+
+	// Chunks from before the events were typed are upgraded
+	event, err = UnmarshalEvent([]byte(`{"event_type": "llm_stream", "request_id": "req1", "partial_content": "Hi", "has_tool_calls": true}`))
+	if err != nil {
+		t.Fatalf("UnmarshalEvent of an old chunk failed: %v", err)
+	}
+	if e, ok := event.(*LLMStreamChunkEvent); !ok || e.RequestID != "req1" || e.PartialContent != "Hi" || !e.HasToolCalls {
+		t.Errorf("Expected the old chunk upgraded, got %#v", event)
+	}
+	if event.Type() != "llm_StreamChunk" {
+		t.Errorf("Expected the current type, got %s", event.Type())
+	}
+}
+
 // Test utility functions
 
 func TestGenerateUniqueID(t *testing.T) {
@@ -308,3 +341,817 @@ func TestDeltaEnvelope_JSON(t *testing.T) {
 		t.Errorf("Aggregate mismatch")
 	}
 }
+
+func TestSQLiteEventStore_Snapshots(t *testing.T) {
+	store, err := NewSQLiteEventStore(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	defer store.Close()
+
+	version, data, err := store.LoadSnapshot("tasks")
+	if err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if version != 0 || data != nil {
+		t.Errorf("Expected no snapshot, got version %d and data %q", version, data)
+	}
+
+	if err := store.SaveSnapshot("tasks", 3, []byte(`{"a":1}`)); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	if err := store.SaveSnapshot("tasks", 7, []byte(`{"a":2}`)); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	version, data, err = store.LoadSnapshot("tasks")
+	if err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if version != 7 {
+		t.Errorf("Expected version 7, got %d", version)
+	}
+	if string(data) != `{"a":2}` {
+		t.Errorf("Expected latest snapshot data, got %q", data)
+	}
+}
+
+type mockSnapshotAggregate struct {
+	mockAggregate
+	state string
+}
+
+func (m *mockSnapshotAggregate) SaveSnapshot() ([]byte, error)  { return []byte(m.state), nil }
+func (m *mockSnapshotAggregate) LoadSnapshot(data []byte) error { m.state = string(data); return nil }
+
+type mockSnapshotStore struct {
+	saved map[string]int
+}
+
+func (m *mockSnapshotStore) SaveSnapshot(aggregateID string, version int, data []byte) error {
+	m.saved[aggregateID] = version
+	return nil
+}
+
+func (m *mockSnapshotStore) LoadSnapshot(aggregateID string) (int, []byte, error) {
+	return 0, nil, nil
+}
+
+func TestSimpleEventBus_PeriodicSnapshots(t *testing.T) {
+	store := &mockEventStore{}
+	agg := &mockSnapshotAggregate{mockAggregate: mockAggregate{id: "snap"}, state: "s"}
+	snapshots := &mockSnapshotStore{saved: make(map[string]int)}
+	eb := NewSimpleEventBus(store, &mockAggregateStore{aggregates: []Aggregate{agg}}, make(chan DeltaEnvelope, 1))
+	eb.SetSnapshotStore(snapshots, 2)
+
+	eb.Publish(&InitiatePluginCreationEvent{})
+	if _, ok := snapshots.saved["snap"]; ok {
+		t.Error("Expected no snapshot after the first event")
+	}
+
+	eb.Publish(&InitiatePluginCreationEvent{})
+	if snapshots.saved["snap"] != 2 {
+		t.Errorf("Expected snapshot at version 2, got %d", snapshots.saved["snap"])
+	}
+}
+
+func TestSimpleEventBus_Close(t *testing.T) {
+	store := &mockEventStore{}
+	agg := &mockSnapshotAggregate{mockAggregate: mockAggregate{id: "snap"}, state: "s"}
+	snapshots := &mockSnapshotStore{saved: make(map[string]int)}
+	eb := NewSimpleEventBus(store, &mockAggregateStore{aggregates: []Aggregate{agg}}, make(chan DeltaEnvelope, 1))
+	eb.SetSnapshotStore(snapshots, 100)
+
+	eb.Publish(&InitiatePluginCreationEvent{})
+	eb.Close()
+	if snapshots.saved["snap"] != 1 {
+		t.Errorf("Expected a snapshot at version 1 on close, got %d", snapshots.saved["snap"])
+	}
+
+	eb.Publish(&InitiatePluginCreationEvent{})
+	if len(store.GetEvents()) != 1 {
+		t.Errorf("Expected events published after closing to be dropped, got %d events", len(store.GetEvents()))
+	}
+}
+
+func TestSQLiteEventStore_AppendStored(t *testing.T) {
+	RegisterEvent("InitiatePluginCreation", func() Event { return &InitiatePluginCreationEvent{} })
+	store, err := NewSQLiteEventStore(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.Append(&InitiatePluginCreationEvent{PluginName: "new"}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	appendedAt := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	events, err := store.AppendStored(StoredEvent{
+		Type:      "InitiatePluginCreation",
+		Data:      []byte(`{"event_type":"InitiatePluginCreation","plugin_name":"imported"}`),
+		Timestamp: appendedAt,
+	})
+	if err != nil {
+		t.Fatalf("AppendStored failed: %v", err)
+	}
+	if len(events) != 1 || events[0].(*InitiatePluginCreationEvent).PluginName != "imported" || len(store.GetEvents()) != 2 {
+		t.Fatalf("Expected the imported event to be appended, got %+v", events)
+	}
+
+	stored, err := store.StoredEvents()
+	if err != nil {
+		t.Fatalf("StoredEvents failed: %v", err)
+	}
+	if len(stored) != 2 || stored[0].Type != "InitiatePluginCreation" || time.Since(stored[0].Timestamp) > time.Hour {
+		t.Fatalf("Unexpected stored events: %+v", stored)
+	}
+	if !stored[1].Timestamp.Equal(appendedAt) {
+		t.Errorf("Expected the original timestamp %v, got %v", appendedAt, stored[1].Timestamp)
+	}
+
+	if _, err := store.AppendStored(StoredEvent{Data: []byte(`{"event_type":"Unknown"}`)}); err == nil {
+		t.Error("Expected an error for an unregistered event")
+	}
+}
+
+// sequencedEvent is an event of the aggregate its type is prefixed with
+type sequencedEvent struct {
+	EventMetadata
+	EventType string `json:"event_type"`
+}
+
+func (e *sequencedEvent) Type() string                { return e.EventType }
+func (e *sequencedEvent) Marshal() ([]byte, error)    { return json.Marshal(e) }
+func (e *sequencedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func registerSequencedEvents() {
+	for _, eventType := range []string{"tasks_Created", "calendar_Created"} {
+		RegisterEvent(eventType, func() Event { return &sequencedEvent{} })
+	}
+}
+
+func TestSQLiteEventStore_SequencesAndVersions(t *testing.T) {
+	registerSequencedEvents()
+	path := filepath.Join(t.TempDir(), "events.db")
+	store, err := NewSQLiteEventStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	events := []Event{
+		&sequencedEvent{EventType: "tasks_Created"},
+		&sequencedEvent{EventType: "calendar_Created"},
+		&sequencedEvent{EventType: "tasks_Created"},
+	}
+	events[1].Metadata().TraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	if err := store.Append(events...); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	want := []EventMetadata{{1, "tasks", 1, "", ""}, {2, "calendar", 1, "", "4bf92f3577b34da6a3ce929d0e0e4736"}, {3, "tasks", 2, "", ""}}
+	for i, event := range events {
+		if *event.Metadata() != want[i] {
+			t.Errorf("Event %d: expected %+v, got %+v", i, want[i], *event.Metadata())
+		}
+	}
+
+	// Appending a stored event again does not store it twice
+	if err := store.Append(events[0]); err != nil || len(store.GetEvents()) != 3 {
+		t.Errorf("Expected the stored event to be skipped, got %d events (%v)", len(store.GetEvents()), err)
+	}
+	store.Close()
+
+	store, err = NewSQLiteEventStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	defer store.Close()
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for i, event := range store.GetEvents() {
+		if *event.Metadata() != want[i] {
+			t.Errorf("Loaded event %d: expected %+v, got %+v", i, want[i], *event.Metadata())
+		}
+	}
+	next := &sequencedEvent{EventType: "tasks_Created"}
+	if err := store.Append(next); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if *next.Metadata() != (EventMetadata{4, "tasks", 3, "", ""}) {
+		t.Errorf("Expected the versions to continue after reopening, got %+v", *next.Metadata())
+	}
+}
+
+func TestSQLiteEventStore_Queries(t *testing.T) {
+	registerSequencedEvents()
+	path := filepath.Join(t.TempDir(), "events.db")
+	store, err := NewSQLiteEventStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	defer store.Close()
+	var mode string
+	if err := store.db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Errorf("Expected the log in WAL mode, got %q (%v)", mode, err)
+	}
+
+	yesterday := time.Now().Add(-24 * time.Hour)
+	if _, err := store.AppendStored(StoredEvent{Type: "tasks_Created", Data: []byte(`{"event_type": "tasks_Created"}`), Timestamp: yesterday}); err != nil {
+		t.Fatalf("AppendStored failed: %v", err)
+	}
+	for _, eventType := range []string{"calendar_Created", "tasks_Created", "tasks_Created", "calendar_Created"} {
+		if err := store.Append(&sequencedEvent{EventType: eventType}); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	sequences := func(events []Event, err error) []int64 {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		var seqs []int64
+		for _, event := range events {
+			seqs = append(seqs, event.Metadata().Sequence)
+		}
+		return seqs
+	}
+	for _, tc := range []struct {
+		name string
+		got  []int64
+		want []int64
+	}{
+		{"first page", sequences(store.GetEventsSince(0, 2)), []int64{1, 2}},
+		{"next page", sequences(store.GetEventsSince(2, 2)), []int64{3, 4}},
+		{"last page", sequences(store.GetEventsSince(4, 2)), []int64{5}},
+		{"unlimited", sequences(store.GetEventsSince(1, 0)), []int64{2, 3, 4, 5}},
+		{"aggregate", sequences(store.GetEventsByAggregate("tasks", 0, 0)), []int64{1, 3, 4}},
+		{"aggregate page", sequences(store.GetEventsByAggregate("tasks", 1, 1)), []int64{3}},
+	} {
+		if fmt.Sprint(tc.got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: expected events %v, got %v", tc.name, tc.want, tc.got)
+		}
+	}
+
+	if _, err := store.AppendStored(StoredEvent{Type: "tasks_Created", Data: []byte(`{"event_type": "tasks_Created", "request_id": "r1"}`), Timestamp: time.Now(), UserID: "alice"}); err != nil {
+		t.Fatalf("AppendStored failed: %v", err)
+	}
+	for _, tc := range []struct {
+		name  string
+		query EventQuery
+		want  []int64
+	}{
+		{"types", EventQuery{Types: []string{"calendar_Created"}}, []int64{2, 5}},
+		{"types page", EventQuery{Types: []string{"calendar_Created"}, After: 2, Limit: 1}, []int64{5}},
+		{"offset", EventQuery{Offset: 1, Limit: 2}, []int64{2, 3}},
+		{"user", EventQuery{Users: []string{"alice"}}, []int64{6}},
+		{"owner", EventQuery{Users: []string{""}, Types: []string{"tasks_Created"}}, []int64{1, 3, 4}},
+		{"field", EventQuery{Fields: map[string]string{"request_id": "r1", "RequestID": "r1"}}, []int64{6}},
+		{"other field value", EventQuery{Fields: map[string]string{"request_id": "r2"}}, nil},
+	} {
+		if got := sequences(store.QueryEvents(tc.query)); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: expected events %v, got %v", tc.name, tc.want, got)
+		}
+		// The events loaded in memory don't keep fields they don't know
+		if len(tc.query.Fields) == 0 {
+			if got := sequences(SelectEvents(store.GetEvents(), tc.query), nil); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("%s: expected the loaded events %v, got %v", tc.name, tc.want, got)
+			}
+		}
+	}
+	if store.Len() != 6 {
+		t.Errorf("Expected 6 events, got %d", store.Len())
+	}
+
+	if sequence, err := store.SequenceAt(time.Now().Add(-time.Hour)); err != nil || sequence != 1 {
+		t.Errorf("Expected the events of the last hour to follow event 1, got %d (%v)", sequence, err)
+	}
+	if sequence, err := store.SequenceAt(yesterday.Add(-time.Hour)); err != nil || sequence != 0 {
+		t.Errorf("Expected no event before the first, got %d (%v)", sequence, err)
+	}
+	counts, err := store.CountByType()
+	if err != nil || counts["tasks_Created"] != 4 || counts["calendar_Created"] != 2 {
+		t.Errorf("Expected 4 tasks_Created and 2 calendar_Created, got %v (%v)", counts, err)
+	}
+}
+
+func TestMemoryEventStore_Dump(t *testing.T) {
+	registerSequencedEvents()
+	store, err := NewMemoryEventStore()
+	if err != nil {
+		t.Fatalf("NewMemoryEventStore failed: %v", err)
+	}
+	defer store.Close()
+	for _, eventType := range []string{"tasks_Created", "calendar_Created", "tasks_Created"} {
+		if err := store.Append(&sequencedEvent{EventType: eventType}); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	if err := store.SaveSnapshot("tasks", 3, []byte("state")); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	// Queries run on the same database as the appends
+	if events, err := store.GetEventsByAggregate("tasks", 0, 0); err != nil || len(events) != 2 {
+		t.Fatalf("Expected 2 tasks events in memory, got %d (%v)", len(events), err)
+	}
+
+	path := filepath.Join(t.TempDir(), "events.db")
+	os.WriteFile(path, []byte("an older dump"), 0644)
+	if err := store.Dump(path); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	dumped, err := NewSQLiteEventStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed on the dump: %v", err)
+	}
+	defer dumped.Close()
+	if err := dumped.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if events := dumped.GetEvents(); len(events) != 3 || *events[2].Metadata() != (EventMetadata{3, "tasks", 2, "", ""}) {
+		t.Errorf("Expected the 3 events dumped with their metadata, got %d", len(events))
+	}
+	if version, data, err := dumped.LoadSnapshot("tasks"); err != nil || version != 3 || string(data) != "state" {
+		t.Errorf("Expected the snapshot dumped, got %d %q (%v)", version, data, err)
+	}
+}
+
+func TestSQLiteEventStore_NumbersEventsOfOlderLogs(t *testing.T) {
+	registerSequencedEvents()
+	path := filepath.Join(t.TempDir(), "events.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	_, err = db.Exec(`CREATE TABLE events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_type TEXT NOT NULL,
+		data TEXT NOT NULL,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO events (event_type, data) VALUES
+		('tasks_Created', '{"event_type":"tasks_Created"}'),
+		('tasks_Created', '{"event_type":"tasks_Created"}'),
+		('calendar_Created', '{"event_type":"calendar_Created"}');`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Creating the old event log failed: %v", err)
+	}
+
+	store, err := NewSQLiteEventStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	defer store.Close()
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	want := []EventMetadata{{1, "tasks", 1, "", ""}, {2, "tasks", 2, "", ""}, {3, "calendar", 1, "", ""}}
+	for i, event := range store.GetEvents() {
+		if *event.Metadata() != want[i] {
+			t.Errorf("Event %d: expected %+v, got %+v", i, want[i], *event.Metadata())
+		}
+	}
+}
+
+type countingAggregate struct {
+	mockThreeDUIBroadcaster
+	applied int
+}
+
+func (m *countingAggregate) ApplyEvent(event Event) error { m.applied++; return nil }
+
+func TestSimpleEventBus_RedeliveredEventsAppliedOnce(t *testing.T) {
+	registerSequencedEvents()
+	store, err := NewSQLiteEventStore(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	defer store.Close()
+	agg := &countingAggregate{mockThreeDUIBroadcaster: mockThreeDUIBroadcaster{id: "tasks", deltas: []DeltaAction{{Type: "update", NodeID: "task_1"}}}}
+	deltas := make(chan DeltaEnvelope, 2)
+	eb := NewSimpleEventBus(store, &mockAggregateStore{aggregates: []Aggregate{agg}}, deltas)
+	handled := 0
+	eb.Subscribe("tasks_Created", func(event Event) error { handled++; return nil })
+
+	event := &sequencedEvent{EventType: "tasks_Created"}
+	eb.Publish(event)
+	eb.Publish(event)
+
+	if agg.applied != 1 || handled != 1 || len(store.GetEvents()) != 1 {
+		t.Errorf("Expected the event stored, applied and handled once, got %d stored, %d applied, %d handled",
+			len(store.GetEvents()), agg.applied, handled)
+	}
+	if AppliedSequence(agg) != 1 {
+		t.Errorf("Expected the aggregate at sequence 1, got %d", AppliedSequence(agg))
+	}
+	if len(deltas) != 1 {
+		t.Fatalf("Expected one delta, got %d", len(deltas))
+	}
+	if env := <-deltas; env.Sequence != 1 || env.Version != 1 || env.EventID != "1" {
+		t.Errorf("Expected the delta to carry the event's sequence and version, got %+v", env)
+	}
+}
+
+// resolvingAggregate conflicts with concurrent events of the same type
+type resolvingAggregate struct {
+	mockAggregate
+}
+
+func (m *resolvingAggregate) Conflicts(events, concurrent []Event) bool {
+	for _, event := range events {
+		for _, other := range concurrent {
+			if event.Type() == other.Type() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestEventProcessor_ConcurrentChanges(t *testing.T) {
+	for _, eventType := range []string{"tasks_Created", "tasks_Updated"} {
+		RegisterEvent(eventType, func() Event { return &sequencedEvent{} })
+	}
+	store, err := NewSQLiteEventStore(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	defer store.Close()
+	eb := NewSimpleEventBus(store, &mockAggregateStore{aggregates: []Aggregate{&resolvingAggregate{mockAggregate{id: "tasks"}}}}, make(chan DeltaEnvelope, 10))
+	ep := NewEventProcessor(store, eb)
+
+	// The handler publishes a change of its own aggregate while it runs, like a concurrent command would
+	concurrently := func(concurrentType, eventType string) error {
+		ep.RegisterCommand("Change", NewCommand(func(data map[string]interface{}) ([]Event, error) {
+			eb.Publish(&sequencedEvent{EventType: concurrentType})
+			return []Event{&sequencedEvent{EventType: eventType}}, nil
+		}))
+		return ep.ExecuteCommand("Change", map[string]interface{}{})
+	}
+
+	if err := concurrently("tasks_Created", "tasks_Updated"); err != nil {
+		t.Errorf("Expected changes the aggregate doesn't object to to be merged, got %v", err)
+	}
+	if len(store.GetEvents()) != 2 {
+		t.Fatalf("Expected both events stored, got %d", len(store.GetEvents()))
+	}
+
+	err = concurrently("tasks_Updated", "tasks_Updated")
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || !conflict.Retriable() {
+		t.Fatalf("Expected a retriable conflict, got %v", err)
+	}
+	if conflict.Aggregate != "tasks" || conflict.Expected != 2 || conflict.Actual != 3 {
+		t.Errorf("Unexpected conflict: %+v", conflict)
+	}
+	if len(store.GetEvents()) != 3 {
+		t.Errorf("Expected the conflicting event not to be stored, got %d events", len(store.GetEvents()))
+	}
+
+	// Without concurrent changes the command's events are published
+	ep.RegisterCommand("Update", NewCommand(func(data map[string]interface{}) ([]Event, error) {
+		return []Event{&sequencedEvent{EventType: "tasks_Updated"}}, nil
+	}))
+	if err := ep.ExecuteCommand("Update", map[string]interface{}{}); err != nil || len(store.GetEvents()) != 4 {
+		t.Errorf("Expected the event published, got %d events (%v)", len(store.GetEvents()), err)
+	}
+}
+
+// userAggregateStore keeps a tasks aggregate per user next to a shared one
+type userAggregateStore struct {
+	shared Aggregate
+	own    map[string]Aggregate
+}
+
+func (m *userAggregateStore) AllAggregates() []Aggregate { return m.AggregatesOf("") }
+func (m *userAggregateStore) AggregatesOf(userID string) []Aggregate {
+	return append(m.UserAggregates(userID), m.shared)
+}
+func (m *userAggregateStore) UserAggregates(userID string) []Aggregate {
+	return []Aggregate{m.own[userID]}
+}
+func (m *userAggregateStore) Users() []string { return []string{"alice"} }
+
+func TestEventProcessor_UserEvents(t *testing.T) {
+	registerSequencedEvents()
+	path := filepath.Join(t.TempDir(), "events.db")
+	store, err := NewSQLiteEventStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	owner, alice, shared := &countingAggregate{}, &countingAggregate{}, &countingAggregate{}
+	aggs := &userAggregateStore{shared: shared, own: map[string]Aggregate{"": owner, "alice": alice}}
+	eb := NewSimpleEventBus(store, aggs, make(chan DeltaEnvelope, 10))
+	ep := NewEventProcessor(store, eb)
+	ep.RegisterCommand("Create", NewCommand(func(data map[string]interface{}) ([]Event, error) {
+		return []Event{&sequencedEvent{EventType: "tasks_Created"}}, nil
+	}))
+
+	for _, userID := range []string{"alice", "", "alice"} {
+		if err := ep.ExecuteCommand("Create", map[string]interface{}{"userID": userID}); err != nil {
+			t.Fatalf("ExecuteCommand failed: %v", err)
+		}
+	}
+	if owner.applied != 1 || alice.applied != 2 || shared.applied != 3 {
+		t.Errorf("Expected the events applied to their user's aggregate and the shared one, got owner %d, alice %d, shared %d",
+			owner.applied, alice.applied, shared.applied)
+	}
+	store.Close()
+
+	reopened, err := NewSQLiteEventStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	defer reopened.Close()
+	if err := reopened.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	want := []EventMetadata{{1, "alice/tasks", 1, "alice", ""}, {2, "tasks", 1, "", ""}, {3, "alice/tasks", 2, "alice", ""}}
+	for i, event := range reopened.GetEvents() {
+		if *event.Metadata() != want[i] {
+			t.Errorf("Event %d: expected %+v, got %+v", i, want[i], *event.Metadata())
+		}
+	}
+}
+
+// countingSnapshotAggregate counts the events applied in its snapshot
+type countingSnapshotAggregate struct {
+	mockAggregate
+	applied int
+}
+
+func (m *countingSnapshotAggregate) ApplyEvent(event Event) error { m.applied++; return nil }
+func (m *countingSnapshotAggregate) SaveSnapshot() ([]byte, error) {
+	return json.Marshal(map[string]int{"applied": m.applied})
+}
+func (m *countingSnapshotAggregate) LoadSnapshot(data []byte) error { return nil }
+
+// versionedSnapshots keeps every snapshot saved, by version
+type versionedSnapshots struct {
+	saved map[int][]byte
+}
+
+func (m *versionedSnapshots) SaveSnapshot(aggregateID string, version int, data []byte) error {
+	m.saved[version] = data
+	return nil
+}
+
+func (m *versionedSnapshots) LoadSnapshot(aggregateID string) (int, []byte, error) {
+	return 0, nil, nil
+}
+
+func TestSimpleEventBus_SnapshotsWhilePublishingConcurrently(t *testing.T) {
+	store := &mockEventStore{}
+	agg := &countingSnapshotAggregate{mockAggregate: mockAggregate{id: "snap"}}
+	snapshots := &versionedSnapshots{saved: make(map[int][]byte)}
+	eb := NewSimpleEventBus(store, &mockAggregateStore{aggregates: []Aggregate{agg}}, make(chan DeltaEnvelope, 1))
+	eb.SetSnapshotStore(snapshots, 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				eb.Publish(&InitiatePluginCreationEvent{})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(snapshots.saved) != 200 {
+		t.Fatalf("Expected a snapshot at every version, got %d", len(snapshots.saved))
+	}
+	for version, data := range snapshots.saved {
+		var state map[string]int
+		json.Unmarshal(data, &state)
+		if state["applied"] != version {
+			t.Errorf("Snapshot at version %d holds %d events", version, state["applied"])
+		}
+	}
+}
+
+func TestSimpleEventBus_RewriteSnapshotsAfterError(t *testing.T) {
+	store := &mockEventStore{}
+	agg := &countingSnapshotAggregate{mockAggregate: mockAggregate{id: "snap"}}
+	snapshots := &versionedSnapshots{saved: make(map[int][]byte)}
+	eb := NewSimpleEventBus(store, &mockAggregateStore{aggregates: []Aggregate{agg}}, make(chan DeltaEnvelope, 1))
+	eb.SetSnapshotStore(snapshots, 100)
+	for i := 0; i < 3; i++ {
+		eb.Publish(&InitiatePluginCreationEvent{})
+	}
+
+	// The log was rewritten before the rewrite failed
+	err := eb.Rewrite(func() error {
+		store.events = store.events[1:]
+		return fmt.Errorf("failed after dropping an event")
+	})
+	if err == nil {
+		t.Fatal("Expected the error of the rewrite")
+	}
+	if _, exists := snapshots.saved[2]; !exists || len(snapshots.saved) != 1 {
+		t.Errorf("Expected a snapshot at the version of the rewritten log, got %v", snapshots.saved)
+	}
+}
+
+// recordingChanges keeps the changes the bus reports
+type recordingChanges struct {
+	changes []Change
+}
+
+func (r *recordingChanges) RecordChange(change Change) { r.changes = append(r.changes, change) }
+
+func TestSimpleEventBus_RecordsChanges(t *testing.T) {
+	registerSequencedEvents()
+	store, err := NewSQLiteEventStore(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	defer store.Close()
+	tasks := &countingSnapshotAggregate{mockAggregate: mockAggregate{id: "tasks"}}
+	calendar := &countingAggregate{mockThreeDUIBroadcaster: mockThreeDUIBroadcaster{id: "calendar"}}
+	eb := NewSimpleEventBus(store, &mockAggregateStore{aggregates: []Aggregate{tasks, calendar}}, make(chan DeltaEnvelope, 10))
+	recorder := &recordingChanges{}
+	eb.SetChangeRecorder(recorder)
+
+	event := &sequencedEvent{EventType: "tasks_Created"}
+	eb.Publish(event)
+	eb.Publish(event)                                          // Delivered again, changes nothing
+	eb.Publish(&sequencedEvent{EventType: "calendar_Created"}) // Its aggregate can't be serialized
+
+	if len(recorder.changes) != 1 {
+		t.Fatalf("Expected one change, got %d", len(recorder.changes))
+	}
+	change := recorder.changes[0]
+	if change.Event != event || string(change.Before) != `{"applied":0}` || string(change.After) != `{"applied":1}` {
+		t.Errorf("Unexpected change: %s, %s -> %s", change.Event.Type(), change.Before, change.After)
+	}
+
+	stored := StoredChange{Sequence: 1, Stream: "tasks", EventType: "tasks_Created", Diff: []byte(`[]`), Timestamp: time.Now()}
+	if err := store.SaveChange(stored); err != nil {
+		t.Fatalf("SaveChange failed: %v", err)
+	}
+	loaded, err := store.LoadChanges()
+	if err != nil || len(loaded) != 1 || loaded[0].Sequence != 1 || loaded[0].Stream != "tasks" || string(loaded[0].Diff) != "[]" {
+		t.Errorf("Expected the stored change back, got %+v, %v", loaded, err)
+	}
+}
+
+func TestSimpleEventBus_TransientEvents(t *testing.T) {
+	registerSequencedEvents()
+	RegisterTransientEvent("tasks_Listed")
+	store, err := NewSQLiteEventStore(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	defer store.Close()
+	tasks := &countingAggregate{mockThreeDUIBroadcaster: mockThreeDUIBroadcaster{id: "tasks"}}
+	eb := NewSimpleEventBus(store, &mockAggregateStore{aggregates: []Aggregate{tasks}}, make(chan DeltaEnvelope, 10))
+	var received []string
+	eb.SubscribeAll(func(event Event) error {
+		received = append(received, event.Type())
+		return nil
+	})
+
+	eb.Publish(&sequencedEvent{EventType: "tasks_Created"})
+	eb.Publish(&sequencedEvent{EventType: "tasks_Listed"})
+	// A query command's result doesn't conflict with changes made meanwhile
+	expected := eb.Versions()
+	eb.Publish(&sequencedEvent{EventType: "tasks_Created"})
+	if err := eb.PublishExpected(expected, &sequencedEvent{EventType: "tasks_Listed"}); err != nil {
+		t.Fatalf("PublishExpected failed: %v", err)
+	}
+
+	if len(store.GetEvents()) != 2 {
+		t.Errorf("Expected only the 2 created events stored, got %d", len(store.GetEvents()))
+	}
+	if tasks.applied != 4 || len(received) != 4 {
+		t.Errorf("Expected all 4 events applied and received, got %d applied, %v", tasks.applied, received)
+	}
+	if versions := eb.Versions(); versions["tasks"] != 2 {
+		t.Errorf("Expected transient events to leave the version alone, got %d", versions["tasks"])
+	}
+}
+
+func TestRedaction_Apply(t *testing.T) {
+	data := []byte(`{"event_type":"tasks_TaskCreated","request_id":"req1","timestamp":"2024-03-01T10:00:00Z","title":"Call Bob on 555-0134","estimate":1.50,"notes":["555-0134 after 5"]}`)
+
+	scrubbed := string(Redaction{Text: "555-0134"}.Apply(data))
+	if scrubbed != `{"estimate":1.50,"event_type":"tasks_TaskCreated","notes":["[redacted] after 5"],"request_id":"req1","timestamp":"2024-03-01T10:00:00Z","title":"Call Bob on [redacted]"}` {
+		t.Errorf("Expected the number scrubbed everywhere and the rest kept as is, got %s", scrubbed)
+	}
+	if hidden := string(Redaction{RequestID: "req1"}.Apply(data)); hidden != `{"estimate":1.50,"event_type":"tasks_TaskCreated","notes":["[redacted]"],"request_id":"req1","timestamp":"2024-03-01T10:00:00Z","title":"[redacted]"}` {
+		t.Errorf("Expected the request's texts hidden, got %s", hidden)
+	}
+	for _, redaction := range []Redaction{{RequestID: "req2"}, {RequestID: "req2", Text: "555-0134"}, {Text: "Alice"}} {
+		if unchanged := redaction.Apply(data); string(unchanged) != string(data) {
+			t.Errorf("Expected %+v to leave the event alone, got %s", redaction, unchanged)
+		}
+	}
+	if scrubbed := Scrub("BOB and bob", "Bob"); scrubbed != "[redacted] and [redacted]" {
+		t.Errorf("Expected the text scrubbed regardless of case, got %q", scrubbed)
+	}
+}
+
+// resultEvent is an event whose result is cut short when it is compacted
+type resultEvent struct {
+	EventMetadata
+	EventType string `json:"event_type"`
+	Result    string `json:"result"`
+}
+
+func (e *resultEvent) Type() string                { return e.EventType }
+func (e *resultEvent) Marshal() ([]byte, error)    { return json.Marshal(e) }
+func (e *resultEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+func (e *resultEvent) Compact() bool {
+	if len(e.Result) <= 3 {
+		return false
+	}
+	e.Result = e.Result[:3]
+	return true
+}
+
+func TestSQLiteEventStore_Compact(t *testing.T) {
+	registerSequencedEvents()
+	RegisterEvent("results_Computed", func() Event { return &resultEvent{} })
+	store, err := NewSQLiteEventStore(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteEventStore failed: %v", err)
+	}
+	defer store.Close()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	old, recent := now.AddDate(0, 0, -100), now.AddDate(0, 0, -1)
+	stored := func(at time.Time, data string) StoredEvent {
+		var raw struct {
+			EventType string `json:"event_type"`
+		}
+		json.Unmarshal([]byte(data), &raw)
+		return StoredEvent{Type: raw.EventType, Data: []byte(data), Timestamp: at}
+	}
+	if _, err := store.AppendStored(
+		stored(old, `{"event_type":"llm_StreamChunk","partial_content":"Hel"}`),
+		stored(old, `{"event_type":"tasks_Created"}`),
+		stored(old, `{"event_type":"results_Computed","result":"a long result"}`),
+		stored(old, `{"event_type":"calendar_Created"}`),
+		stored(old, `{"event_type":"llm_StreamChunk","partial_content":"lo"}`),
+		stored(recent, `{"event_type":"llm_StreamChunk","partial_content":"Hi"}`),
+		stored(recent, `{"event_type":"results_Computed","result":"another long result"}`),
+	); err != nil {
+		t.Fatalf("AppendStored failed: %v", err)
+	}
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	rules := []RetentionRule{
+		{Types: []string{"llm_*", "calendar_Created"}, After: 30 * 24 * time.Hour},
+		{Types: []string{"results_Computed"}, After: 90 * 24 * time.Hour, Compact: true},
+	}
+	compaction, err := store.Compact(rules, now)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	// The calendar's only event is the last of its stream and stays
+	if compaction.Dropped != 2 || compaction.Compacted != 1 {
+		t.Errorf("Expected 2 old chunks dropped and 1 result compacted, got %+v", compaction)
+	}
+	var types []string
+	for _, event := range store.GetEvents() {
+		types = append(types, event.Type())
+		if result, ok := event.(*resultEvent); ok && result.Metadata().Sequence == 3 && result.Result != "a l" {
+			t.Errorf("Expected the old result compacted, got %q", result.Result)
+		}
+	}
+	if fmt.Sprint(types) != "[tasks_Created results_Computed calendar_Created llm_StreamChunk results_Computed]" {
+		t.Errorf("Unexpected events after compacting: %v", types)
+	}
+	if err := store.Append(&sequencedEvent{EventType: "llm_StreamChunk"}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if versions := store.Versions(); versions["llm"] != 4 {
+		t.Errorf("Expected the stream's versions to continue, got %d", versions["llm"])
+	}
+
+	if compaction, err := store.Compact(rules, now); err != nil || compaction != (Compaction{}) {
+		t.Errorf("Expected nothing left to compact, got %+v, %v", compaction, err)
+	}
+}
+
+func TestRawEvent_RoundTrip(t *testing.T) {
+	RegisterRawEvents([]string{"weather_ForecastFetched"})
+	event, err := UnmarshalEvent([]byte(`{"event_type": "weather_ForecastFetched", "request_id": "req_1", "high": 21.5}`))
+	if err != nil {
+		t.Fatalf("UnmarshalEvent failed: %v", err)
+	}
+	raw, ok := event.(*RawEvent)
+	if !ok || raw.Type() != "weather_ForecastFetched" || raw.Data["high"] != 21.5 || raw.Data["event_type"] != nil {
+		t.Fatalf("Expected the raw event with its fields, got %#v", event)
+	}
+	data, err := event.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `{"event_type":"weather_ForecastFetched","high":21.5,"request_id":"req_1"}` {
+		t.Errorf("Unexpected JSON: %s", data)
+	}
+}
@@ -0,0 +1,33 @@
+// Package eventsourcingtest provides helpers for testing aggregates and their commands.
+package eventsourcingtest
+
+import (
+	"testing"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Apply applies the events to the aggregate as the event bus stores them for the user, failing the test
+// if the aggregate refuses one
+func Apply(t testing.TB, agg eventsourcing.Aggregate, userID string, events ...eventsourcing.Event) {
+	t.Helper()
+	for _, event := range events {
+		event.Metadata().UserID = userID
+		if err := agg.ApplyEvent(event); err != nil {
+			t.Fatalf("ApplyEvent failed: %v", err)
+		}
+	}
+}
+
+// Execute runs the command for the user and applies its events to the aggregate, failing the test if the
+// command fails. It returns the events.
+func Execute(t testing.TB, agg eventsourcing.Aggregate, userID string, command func(map[string]interface{}) ([]eventsourcing.Event, error), data map[string]interface{}) []eventsourcing.Event {
+	t.Helper()
+	data["userID"] = userID
+	events, err := command(data)
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	Apply(t, agg, userID, events...)
+	return events
+}
@@ -0,0 +1,274 @@
+package eventsourcing
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// CommandFuzzer runs the commands of a plugin with arguments generated from their schemas, both valid ones
+// and ones breaking the schema the way a confused LLM does. A command must not panic, and either fails with
+// a message saying why or emits events that marshal, unmarshal as their registered type and apply to the
+// plugin's aggregate. The events are applied, and the IDs in them reused as arguments, so later commands
+// find the items earlier ones created.
+type CommandFuzzer struct {
+	Plugin Plugin
+	Skip   []string // Commands not run, e.g. those reaching files or remote services
+	rng    *rand.Rand
+	ids    []string // IDs found in the events emitted so far
+}
+
+// NewCommandFuzzer creates a fuzzer for the plugin's commands, generating the same arguments for the same seed
+func NewCommandFuzzer(plugin Plugin, seed int64) *CommandFuzzer {
+	return &CommandFuzzer{Plugin: plugin, rng: rand.New(rand.NewSource(seed))}
+}
+
+// fuzzStrings are the strings arguments are made of besides the IDs seen: empty, blank, dates in the forms
+// the LLM passes them, and text that trips up parsers
+var fuzzStrings = []string{
+	"", " ", "Buy milk", "tomorrow", "friday at 5pm", "in 2 hours", "2024-05-01", "2024-05-01T09:30:00Z",
+	"2024-13-45T25:61:00Z", "not a date", "-1", "0", "Ünïcødé ✓ 日本語", "line\nbreak", "\"quoted\"", "<b>markup</b>",
+	"%s %d", "../../etc/passwd", strings.Repeat("long ", 500),
+}
+
+// Run runs each command, in the order of their names, runs times with generated arguments, half of them
+// valid, and returns what went wrong
+func (f *CommandFuzzer) Run(runs int) []error {
+	schemas := f.Plugin.Schemas()
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		if !slices.Contains(f.Skip, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for i := 0; i < runs; i++ {
+		for _, name := range names {
+			arguments := f.Arguments(schemas[name], i%2 == 0)
+			if err := f.Check(name, arguments); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+// Arguments generates arguments for the command's schema: valid ones have the required properties and the
+// types and values the schema allows, invalid ones break it in one way
+func (f *CommandFuzzer) Arguments(input CommandInput, valid bool) map[string]interface{} {
+	parameters := schemaParameters(input.Schema())
+	properties, _ := parameters["properties"].(map[string]interface{})
+	required := schemaStrings(parameters["required"])
+
+	arguments := make(map[string]interface{})
+	for _, name := range sortedKeys(properties) {
+		if slices.Contains(required, name) || f.rng.Intn(2) == 0 {
+			property, _ := properties[name].(map[string]interface{})
+			arguments[name] = f.value(property, 0)
+		}
+	}
+	if valid {
+		return arguments
+	}
+
+	names := sortedKeys(properties)
+	switch f.rng.Intn(4) {
+	case 0: // A required property left out
+		if len(required) > 0 {
+			delete(arguments, required[f.rng.Intn(len(required))])
+			break
+		}
+		fallthrough
+	case 1: // A property of the wrong type
+		if len(names) > 0 {
+			arguments[names[f.rng.Intn(len(names))]] = f.wrongValue()
+			break
+		}
+		fallthrough
+	case 2: // A property set to null
+		if len(names) > 0 {
+			arguments[names[f.rng.Intn(len(names))]] = nil
+			break
+		}
+		fallthrough
+	default: // A property the schema doesn't have
+		arguments["Unexpected"] = f.pick()
+	}
+	return arguments
+}
+
+// value generates a value of the property's type
+func (f *CommandFuzzer) value(property map[string]interface{}, depth int) interface{} {
+	if enum := schemaStrings(property["enum"]); len(enum) > 0 {
+		return enum[f.rng.Intn(len(enum))]
+	}
+	switch property["type"] {
+	case "integer":
+		return []int{0, 1, -1, 7, 1 << 31}[f.rng.Intn(5)]
+	case "number":
+		return []float64{0, 1.5, -2, 1e9}[f.rng.Intn(4)]
+	case "boolean":
+		return f.rng.Intn(2) == 0
+	case "array":
+		items, _ := property["items"].(map[string]interface{})
+		values := []interface{}{}
+		if depth < 3 {
+			for n := f.rng.Intn(4); n > 0; n-- {
+				values = append(values, f.value(items, depth+1))
+			}
+		}
+		return values
+	case "object":
+		properties, _ := property["properties"].(map[string]interface{})
+		object := make(map[string]interface{})
+		if depth < 3 {
+			for _, name := range sortedKeys(properties) {
+				nested, _ := properties[name].(map[string]interface{})
+				object[name] = f.value(nested, depth+1)
+			}
+		}
+		return object
+	}
+	return f.pick()
+}
+
+// wrongValue generates a value of a type a property rarely has
+func (f *CommandFuzzer) wrongValue() interface{} {
+	return []interface{}{42, -3.5, true, []interface{}{"a", 1}, map[string]interface{}{"nested": "object"}}[f.rng.Intn(5)]
+}
+
+// pick returns a string to pass, an ID seen in the events half of the time once there are some
+func (f *CommandFuzzer) pick() string {
+	if len(f.ids) > 0 && f.rng.Intn(2) == 0 {
+		return f.ids[f.rng.Intn(len(f.ids))]
+	}
+	return fuzzStrings[f.rng.Intn(len(fuzzStrings))]
+}
+
+// Check decodes the arguments into the command's input like a tool call, runs the command and checks what
+// it did. Arguments that don't decode are rejected before the command runs, that's not an error.
+func (f *CommandFuzzer) Check(command string, arguments map[string]interface{}) error {
+	data, _ := json.Marshal(arguments)
+	input := f.Plugin.Schemas()[command].New()
+	if err := json.Unmarshal(data, input); err != nil {
+		return nil
+	}
+	handler, exists := f.Plugin.Commands()[command]
+	if !exists {
+		return fmt.Errorf("%s has a schema but no handler", command)
+	}
+
+	events, err := f.execute(handler, input)
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", command, data, err)
+	}
+	for _, event := range events {
+		if err := f.apply(event); err != nil {
+			return fmt.Errorf("%s %s: %v", command, data, err)
+		}
+	}
+	return nil
+}
+
+// execute runs the command, reporting a panic or a failure without a message
+func (f *CommandFuzzer) execute(handler CommandHandler, input any) (events []Event, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			events, err = nil, fmt.Errorf("panicked: %v\n%s", r, debug.Stack())
+		}
+	}()
+	events, err = handler.Execute(input)
+	if err != nil && strings.TrimSpace(err.Error()) == "" {
+		return nil, fmt.Errorf("failed without saying why")
+	}
+	if err != nil {
+		return nil, nil // Failed saying why, e.g. the task doesn't exist
+	}
+	return events, nil
+}
+
+// apply checks that the event survives the event log and applies it to the plugin's aggregate
+func (f *CommandFuzzer) apply(event Event) (err error) {
+	if event == nil {
+		return fmt.Errorf("emitted a nil event")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("emitted %T, which panics the event log or the aggregate: %v\n%s", event, r, debug.Stack())
+		}
+	}()
+	data, err := event.Marshal()
+	if err != nil {
+		return fmt.Errorf("emitted %s, which doesn't marshal: %v", event.Type(), err)
+	}
+	stored, err := UnmarshalEvent(data)
+	if err != nil {
+		return fmt.Errorf("emitted %s, which doesn't unmarshal: %v", event.Type(), err)
+	}
+	if stored.Type() != event.Type() {
+		return fmt.Errorf("emitted %s, which unmarshals as %s", event.Type(), stored.Type())
+	}
+	f.collectIDs(data)
+
+	agg := f.Plugin.Aggregate()
+	if agg == nil || IsTransient(event) {
+		return nil
+	}
+	if err := agg.ApplyEvent(stored); err != nil {
+		return fmt.Errorf("emitted %s, which the aggregate doesn't apply: %v", event.Type(), err)
+	}
+	return nil
+}
+
+// collectIDs remembers the values of the event's fields named like IDs
+func (f *CommandFuzzer) collectIDs(data []byte) {
+	var fields map[string]interface{}
+	json.Unmarshal(data, &fields)
+	for _, name := range sortedKeys(fields) { // In order, the same seed generates the same arguments
+		id, ok := fields[name].(string)
+		if ok && id != "" && strings.HasSuffix(strings.ToLower(name), "id") && !slices.Contains(f.ids, id) {
+			f.ids = append(f.ids, id)
+		}
+	}
+}
+
+// schemaParameters returns the parameters of a command's schema, which is either the parameters
+// themselves or wraps them with a description
+func schemaParameters(schema map[string]interface{}) map[string]interface{} {
+	if parameters, ok := schema["parameters"].(map[string]interface{}); ok {
+		return parameters
+	}
+	return schema
+}
+
+// schemaStrings returns a list of strings in a schema, e.g. the required properties or an enum
+func schemaStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,117 @@
+package eventsourcing
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"fyne.io/fyne/v2"
+)
+
+// noteInput is the input of the fuzzed plugin's commands
+type noteInput struct {
+	NoteID string   `json:"NoteID"`
+	Text   string   `json:"Text"`
+	Tags   []string `json:"Tags,omitempty"`
+}
+
+func (i *noteInput) New() any { return &noteInput{} }
+func (i *noteInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Changes a note",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"NoteID": map[string]interface{}{"type": "string"},
+				"Text":   map[string]interface{}{"type": "string"},
+				"Tags":   map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			},
+			"required": []string{"Text"},
+		},
+	}
+}
+
+type notesAggregate struct{ notes map[string]string }
+
+func (a *notesAggregate) ID() string                     { return "notes" }
+func (a *notesAggregate) GetCustomUI() fyne.CanvasObject { return nil }
+func (a *notesAggregate) ApplyEvent(event Event) error {
+	e := event.(*sequencedEvent)
+	if e.EventType == "calendar_Created" {
+		return fmt.Errorf("not a notes event")
+	}
+	return nil
+}
+
+// notesPlugin has commands behaving well and badly
+type notesPlugin struct{ agg *notesAggregate }
+
+func (p *notesPlugin) Name() string                           { return "notes" }
+func (p *notesPlugin) Type() PluginType                       { return LLMPlugin }
+func (p *notesPlugin) EventHandlers() map[string]EventHandler { return nil }
+func (p *notesPlugin) Aggregate() Aggregate                   { return p.agg }
+func (p *notesPlugin) SystemPrompt() string                   { return "" }
+func (p *notesPlugin) AgentModel() string                     { return "" }
+func (p *notesPlugin) Schemas() map[string]CommandInput {
+	return map[string]CommandInput{"AddNote": &noteInput{}, "EditNote": &noteInput{}, "TagNote": &noteInput{}, "Silent": &noteInput{}, "Misfiled": &noteInput{}}
+}
+func (p *notesPlugin) Commands() map[string]CommandHandler {
+	return map[string]CommandHandler{
+		"AddNote": NewCommand(func(input *noteInput) ([]Event, error) {
+			if input.Text == "" {
+				return nil, fmt.Errorf("text is required")
+			}
+			return []Event{&sequencedEvent{EventType: "tasks_Created"}}, nil
+		}),
+		"EditNote": NewCommand(func(input *noteInput) ([]Event, error) {
+			if _, exists := p.agg.notes[input.NoteID]; !exists {
+				return nil, fmt.Errorf("note %s not found", input.NoteID)
+			}
+			return nil, nil
+		}),
+		"TagNote": NewCommand(func(input *noteInput) ([]Event, error) {
+			_ = input.Tags[0] // Panics without tags
+			return nil, nil
+		}),
+		"Silent": NewCommand(func(input *noteInput) ([]Event, error) {
+			return nil, fmt.Errorf("")
+		}),
+		"Misfiled": NewCommand(func(input *noteInput) ([]Event, error) {
+			return []Event{&sequencedEvent{EventType: "calendar_Created"}}, nil
+		}),
+	}
+}
+
+func TestCommandFuzzer(t *testing.T) {
+	registerSequencedEvents()
+	plugin := &notesPlugin{agg: &notesAggregate{notes: map[string]string{}}}
+	fuzzer := NewCommandFuzzer(plugin, 1)
+	fuzzer.Skip = []string{"Misfiled"}
+
+	failures := map[string]bool{}
+	for _, err := range fuzzer.Run(20) {
+		failures[strings.Fields(err.Error())[0]] = true
+		if strings.HasPrefix(err.Error(), "TagNote") && !strings.Contains(err.Error(), "panicked") {
+			t.Errorf("Expected TagNote to panic, got %v", err)
+		}
+	}
+	if !failures["TagNote"] || !failures["Silent"] {
+		t.Errorf("Expected the panicking and the silent command to fail, got %v", failures)
+	}
+	if failures["AddNote"] || failures["EditNote"] || failures["Misfiled"] {
+		t.Errorf("Expected the commands behaving well and those skipped to pass, got %v", failures)
+	}
+
+	if err := fuzzer.Check("Misfiled", map[string]interface{}{"Text": "x"}); err == nil || !strings.Contains(err.Error(), "doesn't apply") {
+		t.Errorf("Expected an event the aggregate refuses to fail, got %v", err)
+	}
+
+	// The same seed generates the same arguments
+	a, b := NewCommandFuzzer(plugin, 7), NewCommandFuzzer(plugin, 7)
+	for i := 0; i < 10; i++ {
+		x, y := a.Arguments(&noteInput{}, i%2 == 0), b.Arguments(&noteInput{}, i%2 == 0)
+		if fmt.Sprint(x) != fmt.Sprint(y) {
+			t.Fatalf("Expected the same arguments for the same seed, got %v and %v", x, y)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package eventsourcing
+
+import "encoding/json"
+
+// LLMProcessingStartedEvent is submitted as streaming event when a call to the LLM is sent
+type LLMProcessingStartedEvent struct {
+	EventMetadata
+	EventType string `json:"event_type"`
+	RequestID string `json:"request_id"`
+	Model     string `json:"model"`
+	Messages  int    `json:"messages"` // Messages sent, including the system prompt
+	Tools     int    `json:"tools"`
+}
+
+func (e *LLMProcessingStartedEvent) Type() string { return "llm_ProcessingStarted" }
+func (e *LLMProcessingStartedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *LLMProcessingStartedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// LLMStreamChunkEvent is submitted as streaming event while the LLM's answer streams in. Each chunk
+// holds all content generated so far, so a dropped chunk is made up for by the next.
+type LLMStreamChunkEvent struct {
+	EventMetadata
+	EventType      string `json:"event_type"`
+	RequestID      string `json:"request_id"`
+	PartialContent string `json:"partial_content"`
+	IsFinal        bool   `json:"is_final"` // Set on the last chunk, also when the call was cancelled
+	HasToolCalls   bool   `json:"has_tool_calls"`
+}
+
+func (e *LLMStreamChunkEvent) Type() string { return "llm_StreamChunk" }
+func (e *LLMStreamChunkEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *LLMStreamChunkEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// LLMProcessingCompletedEvent is submitted as streaming event when a call to the LLM ended
+type LLMProcessingCompletedEvent struct {
+	EventMetadata
+	EventType    string `json:"event_type"`
+	RequestID    string `json:"request_id"`
+	Model        string `json:"model"`
+	HasToolCalls bool   `json:"has_tool_calls"`
+	Error        string `json:"error,omitempty"` // Why the call failed, empty if it succeeded
+}
+
+func (e *LLMProcessingCompletedEvent) Type() string { return "llm_ProcessingCompleted" }
+func (e *LLMProcessingCompletedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *LLMProcessingCompletedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// renamedEvents maps the types of events from before they were typed to their current types, so
+// their JSON still unmarshals
+var renamedEvents = map[string]string{
+	"llm_stream": "llm_StreamChunk",
+}
+
+func init() {
+	RegisterEvent("llm_ProcessingStarted", func() Event { return &LLMProcessingStartedEvent{} })
+	RegisterEvent("llm_StreamChunk", func() Event { return &LLMStreamChunkEvent{} })
+	RegisterEvent("llm_ProcessingCompleted", func() Event { return &LLMProcessingCompletedEvent{} })
+}
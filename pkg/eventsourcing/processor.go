@@ -33,18 +33,20 @@ func (c Command[T]) Execute(data any) ([]Event, error) {
 }
 
 type EventProcessor struct {
-	store    EventStore
-	commands map[string]CommandHandler
-	EventBus EventBus // Changed from unexported to exported
-	deltaChan chan DeltaEnvelope
+	store        EventStore
+	commands     map[string]CommandHandler
+	userCommands map[string]map[string]CommandHandler // User -> commands of the user's own plugin instances
+	EventBus     EventBus                             // Changed from unexported to exported
+	deltaChan    chan DeltaEnvelope
 }
 
 func NewEventProcessor(store EventStore, eventBus EventBus) *EventProcessor {
 	ep := &EventProcessor{
-		store:    store,
-		commands: make(map[string]CommandHandler),
-		EventBus: eventBus,
-		deltaChan: make(chan DeltaEnvelope, 100),
+		store:        store,
+		commands:     make(map[string]CommandHandler),
+		userCommands: make(map[string]map[string]CommandHandler),
+		EventBus:     eventBus,
+		deltaChan:    make(chan DeltaEnvelope, 100),
 	}
 	SetGlobalEventBus(eventBus)
 	logging.Trace("Event processor created with event bus")
@@ -57,30 +59,85 @@ func (ep *EventProcessor) GetEvents() []Event {
 	return events
 }
 
+// QueryEvents reads the page of stored events the query selects, from the log when the store queries it
+func (ep *EventProcessor) QueryEvents(q EventQuery) ([]Event, error) {
+	if store, ok := ep.store.(QueryableStore); ok {
+		return store.QueryEvents(q)
+	}
+	return SelectEvents(ep.store.GetEvents(), q), nil
+}
+
 func (ep *EventProcessor) RegisterCommand(name string, handler CommandHandler) {
 	ep.commands[name] = handler
 	logging.Debug("Registered command: %s", name)
 }
 
+// RegisterUserCommand registers a command of the user's own plugin instance, executed instead of the
+// command with the same name for the user
+func (ep *EventProcessor) RegisterUserCommand(userID, name string, handler CommandHandler) {
+	if ep.userCommands[userID] == nil {
+		ep.userCommands[userID] = make(map[string]CommandHandler)
+	}
+	ep.userCommands[userID][name] = handler
+	logging.Debug("Registered command %s of user %s", name, userID)
+}
+
+// ExecuteCommand executes the command for the user it acts for, see UserOf
 func (ep *EventProcessor) ExecuteCommand(commandName string, data any) error {
+	return ep.ExecuteCommandAs(UserOf(data), commandName, data)
+}
+
+// ExecuteCommandAs executes the command for the user: the user's own command is preferred, and the
+// events it emits belong to the user unless the command assigned them to someone
+func (ep *EventProcessor) ExecuteCommandAs(userID, commandName string, data any) error {
+	_, err := ep.ExecuteCommandEvents(userID, commandName, data)
+	return err
+}
+
+// ExecuteCommandEvents executes the command for the user like ExecuteCommandAs, returning the events
+// it published
+func (ep *EventProcessor) ExecuteCommandEvents(userID, commandName string, data any) ([]Event, error) {
 	logging.Command(commandName, data)
-	handler, exists := ep.commands[commandName]
+	handler, exists := ep.userCommands[userID][commandName]
+	if !exists {
+		handler, exists = ep.commands[commandName]
+	}
 	if !exists {
 		logging.Error("Command %s not found", commandName)
-		return fmt.Errorf("command %s not found", commandName)
+		return nil, fmt.Errorf("command %s not found", commandName)
+	}
+	// Remember the versions the command reads the aggregates at, to detect concurrent changes
+	versionedBus, versioned := ep.EventBus.(VersionedBus)
+	var expected map[string]int64
+	if versioned {
+		expected = versionedBus.Versions()
 	}
 	events, err := handler.Execute(data)
 	if err != nil {
 		logging.Error("Error executing command %s: %v", commandName, err)
-		return err
+		return nil, err
 	}
 	logging.Debug("Command %s generated %d events", commandName, len(events))
+	for _, event := range events {
+		if meta := event.Metadata(); meta.Sequence == 0 && meta.UserID == "" {
+			meta.UserID = userID
+		}
+	}
 	for _, event := range events {
 		marsh, _ := event.Marshal()
 		logging.Debug("Pugblishing event %s, %s", event.Type(), marsh)
+	}
+	if versioned {
+		if err := versionedBus.PublishExpected(expected, events...); err != nil {
+			logging.Error("Command %s conflicts with a concurrent change: %v", commandName, err)
+			return nil, fmt.Errorf("command %s: %w", commandName, err)
+		}
+		return events, nil
+	}
+	for _, event := range events {
 		ep.EventBus.Publish(event)
 	}
-	return nil
+	return events, nil
 }
 
 func (ep *EventProcessor) DeltaChan() chan DeltaEnvelope { return ep.deltaChan }
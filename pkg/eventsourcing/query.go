@@ -0,0 +1,67 @@
+package eventsourcing
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// EventQuery selects a page of the stored events, see QueryableStore.QueryEvents
+type EventQuery struct {
+	After  int64             // Sequence the events are stored after, 0 for the start of the log
+	Types  []string          // Types of the events, any type if empty
+	Users  []string          // Users the events happened for, "" for the owner; any user if empty
+	Fields map[string]string // String fields of the event data and their value, an event has one of them; any event if empty
+	Offset int               // Number of selected events skipped
+	Limit  int               // Maximum number of events, 0 for all of them
+}
+
+// Selects reports whether the query selects the event, apart from the page it is on
+func (q EventQuery) Selects(event Event) bool {
+	meta := event.Metadata()
+	if meta.Sequence <= q.After && q.After > 0 {
+		return false
+	}
+	if len(q.Types) > 0 && !slices.Contains(q.Types, event.Type()) {
+		return false
+	}
+	if len(q.Users) > 0 && !slices.Contains(q.Users, meta.UserID) {
+		return false
+	}
+	if len(q.Fields) == 0 {
+		return true
+	}
+	data, err := event.Marshal()
+	if err != nil {
+		return false
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return false
+	}
+	for field, value := range q.Fields {
+		if fields[field] == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectEvents returns the page of the events the query selects, for stores that only keep events in memory
+func SelectEvents(events []Event, q EventQuery) []Event {
+	selected := []Event{}
+	skipped := 0
+	for _, event := range events {
+		if !q.Selects(event) {
+			continue
+		}
+		if skipped < q.Offset {
+			skipped++
+			continue
+		}
+		if q.Limit > 0 && len(selected) >= q.Limit {
+			break
+		}
+		selected = append(selected, event)
+	}
+	return selected
+}
@@ -0,0 +1,50 @@
+package eventsourcing
+
+import (
+	"encoding/json"
+	"maps"
+)
+
+// RawEvent is an event of a plugin MindPalace has no Go type for, like one running as a process of
+// its own or sandboxed in WASM. It keeps the fields as they were sent.
+type RawEvent struct {
+	EventMetadata
+	EventType string
+	Data      map[string]interface{} // The fields of the event but event_type
+}
+
+func (e *RawEvent) Type() string                { return e.EventType }
+func (e *RawEvent) Marshal() ([]byte, error)    { return json.Marshal(e) }
+func (e *RawEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// MarshalJSON writes the fields of the event and its event_type as one object, like other events
+func (e *RawEvent) MarshalJSON() ([]byte, error) {
+	fields := maps.Clone(e.Data)
+	if fields == nil {
+		fields = make(map[string]interface{})
+	}
+	fields["event_type"] = e.EventType
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON reads the object written by MarshalJSON
+func (e *RawEvent) UnmarshalJSON(data []byte) error {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	e.EventType, _ = fields["event_type"].(string)
+	delete(fields, "event_type")
+	e.Data = fields
+	return nil
+}
+
+// RegisterRawEvents lets the event store load events of the types as RawEvent, unless they were
+// registered with a Go type already
+func RegisterRawEvents(eventTypes []string) {
+	for _, eventType := range eventTypes {
+		if !IsRegistered(eventType) {
+			RegisterEvent(eventType, func() Event { return &RawEvent{} })
+		}
+	}
+}
@@ -11,25 +11,23 @@ import (
 // AsyncErrorHandler defines a function that can handle errors from goroutines
 type AsyncErrorHandler func(err error, stackTrace string, eventType string, recoveryData map[string]interface{})
 
-// ErrorRecoveryManager provides global error recovery functions for goroutines
+// ErrorRecoveryManager provides global error recovery functions for goroutines, and a circuit breaker
+// stopping the handlers that keep panicking
 type ErrorRecoveryManager struct {
-	mu             sync.RWMutex
-	errorHandlers  []AsyncErrorHandler
-	recoveryCount  map[string]int
-	recoveryWindow time.Duration
-	maxRecoveries  int
+	mu            sync.RWMutex
+	errorHandlers []AsyncErrorHandler
+	breaker       *CircuitBreaker
 }
 
 // Global instance of the recovery manager
-var globalRecoveryManager = NewErrorRecoveryManager(5*time.Minute, 10)
+var globalRecoveryManager = NewErrorRecoveryManager(5*time.Minute, 5)
 
-// NewErrorRecoveryManager creates a new recovery manager with the given parameters
+// NewErrorRecoveryManager creates a new recovery manager opening the circuit of a handler that panics
+// maxRecoveries times within the window
 func NewErrorRecoveryManager(window time.Duration, maxRecoveries int) *ErrorRecoveryManager {
 	return &ErrorRecoveryManager{
-		errorHandlers:  make([]AsyncErrorHandler, 0),
-		recoveryCount:  make(map[string]int),
-		recoveryWindow: window,
-		maxRecoveries:  maxRecoveries,
+		errorHandlers: make([]AsyncErrorHandler, 0),
+		breaker:       NewCircuitBreaker(window, maxRecoveries),
 	}
 }
 
@@ -40,6 +38,11 @@ func (rm *ErrorRecoveryManager) RegisterErrorHandler(handler AsyncErrorHandler)
 	rm.errorHandlers = append(rm.errorHandlers, handler)
 }
 
+// Breaker returns the circuit breaker counting the panics of the handlers
+func (rm *ErrorRecoveryManager) Breaker() *CircuitBreaker {
+	return rm.breaker
+}
+
 // GetGlobalRecoveryManager returns the global recovery manager instance
 func GetGlobalRecoveryManager() *ErrorRecoveryManager {
 	return globalRecoveryManager
@@ -62,61 +65,41 @@ func SafeGo(eventType string, recoveryData map[string]interface{}, fn func()) {
 // RecoverFromPanic is a helper function to recover from panics in goroutines
 func RecoverFromPanic(eventType string, recoveryData map[string]interface{}) {
 	if r := recover(); r != nil {
-		stackTrace := string(debug.Stack())
-		var err error
-		switch x := r.(type) {
-		case string:
-			err = fmt.Errorf("%s", x)
-		case error:
-			err = x
-		default:
-			err = fmt.Errorf("%v", x)
-		}
-
-		// Handle the error through registered handlers
-		rm := GetGlobalRecoveryManager()
-		rm.mu.RLock()
-		handlers := rm.errorHandlers
-		rm.mu.RUnlock()
-
-		// If no handlers are registered, use the default
-		if len(handlers) == 0 {
-			defaultErrorHandler(err, stackTrace, eventType, recoveryData)
-		} else {
-			// Call all registered handlers
-			for _, handler := range handlers {
-				handler(err, stackTrace, eventType, recoveryData)
-			}
-		}
-
-		// Track recovery count for this event type
-		rm.trackRecovery(eventType)
+		GetGlobalRecoveryManager().recovered(r, string(debug.Stack()), eventType, recoveryData)
 	}
 }
 
-// trackRecovery counts recoveries to detect recurring problems
-func (rm *ErrorRecoveryManager) trackRecovery(eventType string) {
-	rm.mu.Lock()
-	defer rm.mu.Unlock()
-
-	key := fmt.Sprintf("%s:%d", eventType, time.Now().Unix()/int64(rm.recoveryWindow.Seconds()))
-	rm.recoveryCount[key]++
-
-	// Check if we've exceeded the recovery limit
-	if rm.recoveryCount[key] > rm.maxRecoveries {
-		log.Printf("WARNING: Event type %s has panicked %d times in the last %v. This indicates a systemic issue.",
-			eventType, rm.recoveryCount[key], rm.recoveryWindow)
+// recovered passes a recovered panic of the handler to the error handlers and counts it as a failure of
+// the handler, returning the panic as an error
+func (rm *ErrorRecoveryManager) recovered(r interface{}, stackTrace string, eventType string, recoveryData map[string]interface{}) error {
+	var err error
+	switch x := r.(type) {
+	case string:
+		err = fmt.Errorf("%s", x)
+	case error:
+		err = x
+	default:
+		err = fmt.Errorf("%v", x)
 	}
 
-	// Cleanup old entries (simple approach)
-	if len(rm.recoveryCount) > 1000 {
-		now := time.Now().Unix() / int64(rm.recoveryWindow.Seconds())
-		for k := range rm.recoveryCount {
-			var keyTime int64
-			fmt.Sscanf(k, "%s:%d", nil, &keyTime)
-			if keyTime < now-1 {
-				delete(rm.recoveryCount, k)
-			}
+	// Handle the error through registered handlers
+	rm.mu.RLock()
+	handlers := rm.errorHandlers
+	rm.mu.RUnlock()
+
+	// If no handlers are registered, use the default
+	if len(handlers) == 0 {
+		defaultErrorHandler(err, stackTrace, eventType, recoveryData)
+	} else {
+		// Call all registered handlers
+		for _, handler := range handlers {
+			handler(err, stackTrace, eventType, recoveryData)
 		}
 	}
+
+	if rm.breaker.Failed(eventType, err) {
+		log.Printf("WARNING: %s has panicked %d times in the last %v. This indicates a systemic issue.",
+			eventType, rm.breaker.Failures(eventType), rm.breaker.window)
+	}
+	return err
 }
@@ -0,0 +1,112 @@
+package eventsourcing
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Redacted is shown instead of redacted content
+const Redacted = "[redacted]"
+
+// Redaction hides content of the event log. Events can't be changed, so the chat, the exports and the
+// APIs apply the redactions to the events they show.
+type Redaction struct {
+	RequestID string `json:"request_id,omitempty"` // Request whose content is hidden, or the only request Text is scrubbed from
+	Text      string `json:"text,omitempty"`       // Text scrubbed wherever it appears, the whole content of the request if empty
+	UserID    string `json:"user_id,omitempty"`    // User whose events are redacted
+}
+
+// Redactor applies the redactions of a user's events to the payload of one of them
+type Redactor interface {
+	Redact(userID string, data []byte) []byte
+}
+
+// Scrub replaces the text in s, regardless of case, with Redacted
+func Scrub(s, text string) string {
+	if text == "" || !strings.Contains(strings.ToLower(s), strings.ToLower(text)) {
+		return s
+	}
+	return regexp.MustCompile("(?i)"+regexp.QuoteMeta(text)).ReplaceAllLiteralString(s, Redacted)
+}
+
+// Covers reports whether the redaction applies to the content of a request
+func (r Redaction) Covers(requestID string) bool {
+	return r.RequestID == "" || r.RequestID == requestID
+}
+
+// Apply returns the JSON payload of an event with the redaction applied. Redacting a whole request
+// replaces every text of its events but their type, IDs and times.
+func (r Redaction) Apply(data []byte) []byte {
+	var payload map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // Numbers are written back as they were
+	if err := decoder.Decode(&payload); err != nil {
+		return data
+	}
+	requestID, _ := payload["request_id"].(string)
+	if requestID == "" {
+		// Events stored before their fields had json tags
+		requestID, _ = payload["RequestID"].(string)
+	}
+	if !r.Covers(requestID) || (r.Text == "" && requestID == "") {
+		return data
+	}
+	changed := false
+	for key, value := range payload {
+		if r.Text == "" && keptKey(key) {
+			continue
+		}
+		if redacted, ok := r.redact(value); ok {
+			payload[key] = redacted
+			changed = true
+		}
+	}
+	if !changed {
+		return data
+	}
+	redacted, err := json.Marshal(payload)
+	if err != nil {
+		return data
+	}
+	return redacted
+}
+
+// redact returns the value with the redaction applied, and whether it changed
+func (r Redaction) redact(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		if r.Text == "" {
+			return Redacted, v != Redacted
+		}
+		scrubbed := Scrub(v, r.Text)
+		return scrubbed, scrubbed != v
+	case map[string]interface{}:
+		changed := false
+		for key, item := range v {
+			if redacted, ok := r.redact(item); ok {
+				v[key] = redacted
+				changed = true
+			}
+		}
+		return v, changed
+	case []interface{}:
+		changed := false
+		for i, item := range v {
+			if redacted, ok := r.redact(item); ok {
+				v[i] = redacted
+				changed = true
+			}
+		}
+		return v, changed
+	}
+	return value, false
+}
+
+// keptKey reports whether redacting a whole request keeps the field, which identifies the event rather
+// than holding content. Fields of events stored without json tags are named as in Go, e.g. RequestID.
+func keptKey(key string) bool {
+	return key == "event_type" || key == "timestamp" || strings.HasSuffix(key, "_id") || strings.HasSuffix(key, "_at") ||
+		strings.HasSuffix(key, "ID") || strings.HasSuffix(key, "At")
+}
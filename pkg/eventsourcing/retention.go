@@ -0,0 +1,159 @@
+package eventsourcing
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"mindpalace/pkg/logging"
+)
+
+// RetentionRule drops or compacts the stored events of some types once they are older than After
+type RetentionRule struct {
+	Types   []string      // Event types, "llm_*" matches all events of an aggregate
+	After   time.Duration // Age of the events the rule applies to
+	Compact bool          // Compact the events, see Compactor, instead of dropping them
+}
+
+// Matches reports whether the rule applies to events of the type
+func (r RetentionRule) Matches(eventType string) bool {
+	for _, pattern := range r.Types {
+		if prefix, wildcard := strings.CutSuffix(pattern, "*"); wildcard && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+		if pattern == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Compactor is implemented by events that can be made smaller once they are old, e.g. tool call results
+// replaced by their summary
+type Compactor interface {
+	Compact() bool // Compacts the event, reporting whether it changed
+}
+
+// Compaction counts the events a compaction of the event log dropped and compacted
+type Compaction struct {
+	Dropped   int
+	Compacted int
+}
+
+// Compact applies the retention rules to the events stored before now, the first rule matching an event
+// applies. The last event of each stream is kept, so the versions continue where they were, and with the
+// dropped events go their changes in the audit trail. Snapshot the aggregates afterwards: the events they
+// replay are counted in the compacted log, see SimpleEventBus.Rewrite. An error means the log is left as
+// it was.
+func (es *SQLiteEventStore) Compact(rules []RetentionRule, now time.Time) (Compaction, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	var compaction Compaction
+	if len(rules) == 0 {
+		return compaction, nil
+	}
+	tx, err := es.db.Begin()
+	if err != nil {
+		return compaction, err
+	}
+	defer tx.Rollback()
+
+	type storedRow struct {
+		id        int64
+		eventType string
+		aggregate string
+		version   int64
+		data      string
+		timestamp time.Time
+	}
+	rows, err := tx.Query("SELECT id, event_type, aggregate, version, data, timestamp FROM events WHERE timestamp < ? ORDER BY id",
+		now.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return compaction, err
+	}
+	var stored []storedRow
+	for rows.Next() {
+		var row storedRow
+		if err := rows.Scan(&row.id, &row.eventType, &row.aggregate, &row.version, &row.data, &row.timestamp); err != nil {
+			rows.Close()
+			return compaction, err
+		}
+		stored = append(stored, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return compaction, err
+	}
+
+	for _, row := range stored {
+		rule, ok := firstRule(rules, row.eventType)
+		if !ok || !row.timestamp.Before(now.Add(-rule.After)) {
+			continue
+		}
+		if !rule.Compact {
+			if es.versions[row.aggregate] == row.version {
+				continue
+			}
+			if _, err := tx.Exec("DELETE FROM events WHERE id = ?", row.id); err != nil {
+				return compaction, fmt.Errorf("failed to drop event %d: %v", row.id, err)
+			}
+			if _, err := tx.Exec("DELETE FROM changes WHERE sequence = ?", row.id); err != nil {
+				return compaction, fmt.Errorf("failed to drop the change of event %d: %v", row.id, err)
+			}
+			compaction.Dropped++
+			continue
+		}
+		event, err := UnmarshalEvent([]byte(row.data))
+		if err != nil {
+			continue // Events of plugins no longer installed are left as they are
+		}
+		compactor, ok := event.(Compactor)
+		if !ok || !compactor.Compact() {
+			continue
+		}
+		data, err := event.Marshal()
+		if err != nil {
+			return compaction, fmt.Errorf("failed to compact event %d: %v", row.id, err)
+		}
+		if _, err := tx.Exec("UPDATE events SET data = ? WHERE id = ?", string(data), row.id); err != nil {
+			return compaction, fmt.Errorf("failed to compact event %d: %v", row.id, err)
+		}
+		compaction.Compacted++
+	}
+	if compaction == (Compaction{}) {
+		return compaction, nil
+	}
+
+	// The loaded events become those of the compacted log as it is committed, the snapshots taken
+	// afterwards count them
+	var events []Event
+	if es.events != nil {
+		events, err = queryEvents(tx, "SELECT id, aggregate, version, user_id, trace_id, data FROM events ORDER BY id")
+		if err != nil {
+			return compaction, fmt.Errorf("failed to reload the compacted events: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return compaction, err
+	}
+	if es.events != nil {
+		es.events = events
+	}
+
+	// The file shrinks with the log, or on a later compaction
+	if _, err := es.db.Exec("VACUUM"); err != nil {
+		logging.Error("Failed to vacuum the compacted event log: %v", err)
+	}
+	return compaction, nil
+}
+
+// firstRule returns the first of the rules matching the event type
+func firstRule(rules []RetentionRule, eventType string) (RetentionRule, bool) {
+	for _, rule := range rules {
+		if rule.Matches(eventType) {
+			return rule, true
+		}
+	}
+	return RetentionRule{}, false
+}
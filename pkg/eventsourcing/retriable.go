@@ -0,0 +1,44 @@
+package eventsourcing
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// Retriable is implemented by errors that tell whether executing the command again may succeed
+type Retriable interface {
+	Retriable() bool
+}
+
+// IsRetriable reports whether executing a command again after the error may succeed: errors that say
+// so through Retriable, such as a *ConflictError, and timeouts. Other errors, such as invalid
+// arguments or unknown IDs, fail the same way when retried.
+func IsRetriable(err error) bool {
+	var retriable Retriable
+	if errors.As(err, &retriable) {
+		return retriable.Retriable()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retriableError marks an error as retriable
+type retriableError struct {
+	error
+}
+
+func (e retriableError) Retriable() bool { return true }
+func (e retriableError) Unwrap() error   { return e.error }
+
+// MarkRetriable returns the error marked as retriable, for failures that may pass when the command is
+// executed again, e.g. a service that is temporarily unavailable
+func MarkRetriable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return retriableError{err}
+}
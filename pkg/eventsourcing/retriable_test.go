@@ -0,0 +1,31 @@
+package eventsourcing
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestIsRetriable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"validation", fmt.Errorf("task 42 not found"), false},
+		{"conflict", fmt.Errorf("executing: %w", &ConflictError{}), true},
+		{"marked", MarkRetriable(fmt.Errorf("service unavailable")), true},
+		{"deadline", fmt.Errorf("calling: %w", context.DeadlineExceeded), true},
+		{"network timeout", &net.OpError{Op: "dial", Err: &net.DNSError{IsTimeout: true}}, true},
+		{"network refused", &net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")}, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetriable(tt.err); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+	if MarkRetriable(nil) != nil {
+		t.Error("Expected no error marked from nil")
+	}
+}
@@ -0,0 +1,66 @@
+package eventsourcing
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AggregateOf returns the aggregate an event type belongs to, the prefix before the first
+// underscore (e.g., "taskmanager" for "taskmanager_TaskCreated"), or "system" without one.
+func AggregateOf(eventType string) string {
+	if aggregate, _, found := strings.Cut(eventType, "_"); found && aggregate != "" {
+		return aggregate
+	}
+	return "system"
+}
+
+var (
+	appliedMu sync.Mutex
+	applied   = make(map[Aggregate]int64) // Sequence of the last event each aggregate applied
+)
+
+// ApplyOnce applies the event to the aggregate unless the aggregate already applied it, so an event
+// delivered more than once changes the state once. Events without a sequence are always applied.
+// It reports whether the event was applied.
+func ApplyOnce(agg Aggregate, event Event) (bool, error) {
+	sequence := event.Metadata().Sequence
+	if sequence > 0 {
+		appliedMu.Lock()
+		last := applied[agg]
+		appliedMu.Unlock()
+		if sequence <= last {
+			return false, nil
+		}
+	}
+	err := agg.ApplyEvent(event)
+	if sequence > 0 {
+		MarkApplied(agg, sequence) // Applying it again would fail the same way
+	}
+	return true, err
+}
+
+// MarkApplied records that the aggregate's state includes the events up to the sequence, e.g.
+// after restoring a snapshot
+func MarkApplied(agg Aggregate, sequence int64) {
+	appliedMu.Lock()
+	defer appliedMu.Unlock()
+	if sequence > applied[agg] {
+		applied[agg] = sequence
+	}
+}
+
+// AppliedSequence returns the sequence of the last event the aggregate applied, 0 if none
+func AppliedSequence(agg Aggregate) int64 {
+	appliedMu.Lock()
+	defer appliedMu.Unlock()
+	return applied[agg]
+}
+
+// eventID identifies the event in a delta envelope: its sequence once stored, else the time
+func eventID(event Event) string {
+	if sequence := event.Metadata().Sequence; sequence > 0 {
+		return strconv.FormatInt(sequence, 10)
+	}
+	return ISOTimestamp()
+}
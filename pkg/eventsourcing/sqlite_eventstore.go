@@ -2,8 +2,12 @@ package eventsourcing
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"sync"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -14,54 +18,258 @@ type SQLiteEventStore struct {
 	events   []Event
 	db       *sql.DB
 	dbPath   string
+	versions map[string]int64 // Version of the last event stored per stream
 }
 
+// NewSQLiteEventStore opens the event log at dbPath in WAL mode, so the log is read while events are
+// appended, creating and migrating its tables as needed
 func NewSQLiteEventStore(dbPath string) (*SQLiteEventStore, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
 	if err != nil {
 		return nil, err
 	}
+	return openSQLiteEventStore(db, dbPath)
+}
 
-	// Create table if not exists
+// NewMemoryEventStore opens an event log kept in memory, for tests and demos that shouldn't touch the
+// disk. The events are gone once it is closed, unless dumped to a file first, see Dump.
+func NewMemoryEventStore() (*SQLiteEventStore, error) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// Every connection would open a database of its own, and the last one closing discards it
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	return openSQLiteEventStore(db, "")
+}
+
+// openSQLiteEventStore sets up the event log's tables in db
+func openSQLiteEventStore(db *sql.DB, dbPath string) (*SQLiteEventStore, error) {
+	// Create table if not exists, the id is the sequence of the event
 	createTableSQL := `CREATE TABLE IF NOT EXISTS events (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		event_type TEXT NOT NULL,
 		data TEXT NOT NULL,
-		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		aggregate TEXT NOT NULL DEFAULT '',
+		version INTEGER NOT NULL DEFAULT 0,
+		user_id TEXT NOT NULL DEFAULT '',
+		trace_id TEXT NOT NULL DEFAULT ''
 	);`
 	if _, err := db.Exec(createTableSQL); err != nil {
 		return nil, fmt.Errorf("failed to create table: %v", err)
 	}
+	if err := migrateVersions(db); err != nil {
+		return nil, fmt.Errorf("failed to add event versions: %v", err)
+	}
+	if err := migrateUsers(db); err != nil {
+		return nil, fmt.Errorf("failed to add event users: %v", err)
+	}
+	if err := migrateTraces(db); err != nil {
+		return nil, fmt.Errorf("failed to add event traces: %v", err)
+	}
+	if _, err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS events_aggregate_version ON events (aggregate, version)"); err != nil {
+		return nil, fmt.Errorf("failed to create version index: %v", err)
+	}
+	// The version index also serves the queries by aggregate
+	for _, stmt := range []string{
+		"CREATE INDEX IF NOT EXISTS events_event_type ON events (event_type)",
+		"CREATE INDEX IF NOT EXISTS events_timestamp ON events (timestamp)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("failed to create index: %v", err)
+		}
+	}
+
+	createSnapshotTableSQL := `CREATE TABLE IF NOT EXISTS snapshots (
+		aggregate_id TEXT PRIMARY KEY,
+		version INTEGER NOT NULL,
+		data BLOB NOT NULL,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+	if _, err := db.Exec(createSnapshotTableSQL); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot table: %v", err)
+	}
+
+	// How each event changed its aggregate, for the audit trail
+	createChangeTableSQL := `CREATE TABLE IF NOT EXISTS changes (
+		sequence INTEGER PRIMARY KEY,
+		stream TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		user_id TEXT NOT NULL DEFAULT '',
+		diff BLOB NOT NULL,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+	if _, err := db.Exec(createChangeTableSQL); err != nil {
+		return nil, fmt.Errorf("failed to create change table: %v", err)
+	}
+
+	versions := make(map[string]int64)
+	rows, err := db.Query("SELECT aggregate, MAX(version) FROM events GROUP BY aggregate")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event versions: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var aggregate string
+		var version int64
+		if err := rows.Scan(&aggregate, &version); err != nil {
+			return nil, err
+		}
+		versions[aggregate] = version
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return &SQLiteEventStore{
-		db:     db,
-		dbPath: dbPath,
+		db:       db,
+		dbPath:   dbPath,
+		versions: versions,
 	}, nil
 }
 
+// migrateVersions adds the aggregate and version columns to event logs created without them,
+// numbering the events already stored
+func migrateVersions(db *sql.DB) error {
+	columns, err := eventColumns(db)
+	if err != nil {
+		return err
+	}
+	if columns["aggregate"] && columns["version"] {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		"ALTER TABLE events ADD COLUMN aggregate TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE events ADD COLUMN version INTEGER NOT NULL DEFAULT 0",
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	type row struct {
+		id        int64
+		eventType string
+	}
+	var stored []row
+	eventRows, err := tx.Query("SELECT id, event_type FROM events ORDER BY id")
+	if err != nil {
+		return err
+	}
+	for eventRows.Next() {
+		var r row
+		if err := eventRows.Scan(&r.id, &r.eventType); err != nil {
+			eventRows.Close()
+			return err
+		}
+		stored = append(stored, r)
+	}
+	eventRows.Close()
+	versions := make(map[string]int64)
+	for _, r := range stored {
+		aggregate := AggregateOf(r.eventType)
+		versions[aggregate]++
+		if _, err := tx.Exec("UPDATE events SET aggregate = ?, version = ? WHERE id = ?", aggregate, versions[aggregate], r.id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateUsers adds the user column to event logs created without it; the events stored belong to the owner
+func migrateUsers(db *sql.DB) error {
+	columns, err := eventColumns(db)
+	if err != nil || columns["user_id"] {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE events ADD COLUMN user_id TEXT NOT NULL DEFAULT ''")
+	return err
+}
+
+// migrateTraces adds the trace column to event logs created without it; the events stored weren't traced
+func migrateTraces(db *sql.DB) error {
+	columns, err := eventColumns(db)
+	if err != nil || columns["trace_id"] {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE events ADD COLUMN trace_id TEXT NOT NULL DEFAULT ''")
+	return err
+}
+
+// eventColumns returns the names of the columns of the events table
+func eventColumns(db *sql.DB) (map[string]bool, error) {
+	rows, err := db.Query("PRAGMA table_info(events)")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// Load reads all stored events into memory, for GetEvents
 func (es *SQLiteEventStore) Load() error {
 	es.mu.Lock()
 	defer es.mu.Unlock()
 
-	rows, err := es.db.Query("SELECT data FROM events ORDER BY id")
+	events, err := es.query("SELECT id, aggregate, version, user_id, trace_id, data FROM events ORDER BY id")
 	if err != nil {
 		return err
 	}
+	es.events = events
+	return nil
+}
+
+// query returns the events the query selects, as id, aggregate, version, user_id, trace_id and data, with their metadata
+func (es *SQLiteEventStore) query(query string, args ...any) ([]Event, error) {
+	return queryEvents(es.db, query, args...)
+}
+
+// querier runs queries on the database, or in a transaction
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// queryEvents returns the events the query selects, see query
+func queryEvents(q querier, query string, args ...any) ([]Event, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
-	es.events = []Event{} // Reset
+	events := []Event{}
 	for rows.Next() {
+		var meta EventMetadata
 		var data []byte
-		if err := rows.Scan(&data); err != nil {
-			return err
+		if err := rows.Scan(&meta.Sequence, &meta.Aggregate, &meta.Version, &meta.UserID, &meta.TraceID, &data); err != nil {
+			return nil, err
 		}
 		event, err := UnmarshalEvent(data)
 		if err != nil {
-			return fmt.Errorf("failed to load event: %v", err)
+			return nil, fmt.Errorf("failed to load event: %v", err)
 		}
-		es.events = append(es.events, event)
+		*event.Metadata() = meta
+		events = append(events, event)
 	}
-	return rows.Err()
+	return events, rows.Err()
 }
 
 func (es *SQLiteEventStore) Append(events ...Event) error {
@@ -74,18 +282,69 @@ func (es *SQLiteEventStore) Append(events ...Event) error {
 	}
 	defer tx.Rollback()
 
+	versions := make(map[string]int64)
+	metas := make([]EventMetadata, 0, len(events))
+	var appended []Event
 	for _, event := range events {
+		if event.Metadata().Sequence > 0 {
+			continue // Stored before
+		}
 		data, err := event.Marshal()
 		if err != nil {
 			return err
 		}
-		_, err = tx.Exec("INSERT INTO events (event_type, data) VALUES (?, ?)", event.Type(), string(data))
+		meta, err := es.insert(tx, versions, event.Metadata().UserID, event.Metadata().TraceID, event.Type(), string(data), nil)
 		if err != nil {
 			return err
 		}
-		es.events = append(es.events, event)
+		metas = append(metas, meta)
+		appended = append(appended, event)
 	}
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	es.appended(appended, metas, versions)
+	return nil
+}
+
+// insert stores an event of the user, traced in the trace, in the transaction, numbering it in its stream after the versions
+// stored and the versions already used in the transaction. A nil timestamp stores the current time.
+func (es *SQLiteEventStore) insert(tx *sql.Tx, versions map[string]int64, userID, traceID, eventType, data string, timestamp *time.Time) (EventMetadata, error) {
+	aggregate := StreamOf(userID, eventType)
+	version, used := versions[aggregate]
+	if !used {
+		version = es.versions[aggregate]
+	}
+	version++
+	var result sql.Result
+	var err error
+	if timestamp == nil {
+		result, err = tx.Exec("INSERT INTO events (event_type, data, aggregate, version, user_id, trace_id) VALUES (?, ?, ?, ?, ?, ?)",
+			eventType, data, aggregate, version, userID, traceID)
+	} else {
+		result, err = tx.Exec("INSERT INTO events (event_type, data, timestamp, aggregate, version, user_id, trace_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			eventType, data, timestamp.UTC().Format("2006-01-02 15:04:05"), aggregate, version, userID, traceID)
+	}
+	if err != nil {
+		return EventMetadata{}, err
+	}
+	sequence, err := result.LastInsertId()
+	if err != nil {
+		return EventMetadata{}, err
+	}
+	versions[aggregate] = version
+	return EventMetadata{Sequence: sequence, Aggregate: aggregate, Version: version, UserID: userID, TraceID: traceID}, nil
+}
+
+// appended records committed events with their metadata; es.mu must be held
+func (es *SQLiteEventStore) appended(events []Event, metas []EventMetadata, versions map[string]int64) {
+	for i, event := range events {
+		*event.Metadata() = metas[i]
+	}
+	for aggregate, version := range versions {
+		es.versions[aggregate] = version
+	}
+	es.events = append(es.events, events...)
 }
 
 func (es *SQLiteEventStore) GetEvents() []Event {
@@ -94,6 +353,271 @@ func (es *SQLiteEventStore) GetEvents() []Event {
 	return append([]Event{}, es.events...)
 }
 
+// Len returns the number of events loaded, without copying them like GetEvents
+func (es *SQLiteEventStore) Len() int {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return len(es.events)
+}
+
+// Versions returns the version of the last event stored per stream
+func (es *SQLiteEventStore) Versions() map[string]int64 {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	versions := make(map[string]int64, len(es.versions))
+	for aggregate, version := range es.versions {
+		versions[aggregate] = version
+	}
+	return versions
+}
+
+// EventsSince returns the loaded events of the stream stored after the version
+func (es *SQLiteEventStore) EventsSince(aggregate string, version int64) []Event {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	var events []Event
+	for i := len(es.events) - 1; i >= 0; i-- {
+		meta := es.events[i].Metadata()
+		if meta.Aggregate != aggregate {
+			continue
+		}
+		if meta.Version <= version {
+			break
+		}
+		events = append([]Event{es.events[i]}, events...)
+	}
+	return events
+}
+
+// GetEventsByAggregate reads up to limit events of the stream stored after the version from the log, in
+// order; a limit of 0 reads all of them. Pass the version of the last event read for the next page.
+func (es *SQLiteEventStore) GetEventsByAggregate(aggregate string, version int64, limit int) ([]Event, error) {
+	return es.query("SELECT id, aggregate, version, user_id, trace_id, data FROM events WHERE aggregate = ? AND version > ? ORDER BY version LIMIT ?",
+		aggregate, version, pageLimit(limit))
+}
+
+// GetEventsSince reads up to limit events stored after the sequence from the log, in order; a limit of 0
+// reads all of them. Pass the sequence of the last event read for the next page.
+func (es *SQLiteEventStore) GetEventsSince(sequence int64, limit int) ([]Event, error) {
+	return es.query("SELECT id, aggregate, version, user_id, trace_id, data FROM events WHERE id > ? ORDER BY id LIMIT ?",
+		sequence, pageLimit(limit))
+}
+
+// QueryEvents reads the page of events the query selects from the log, in order. Pass the sequence of the
+// last event read as After for the next page.
+func (es *SQLiteEventStore) QueryEvents(q EventQuery) ([]Event, error) {
+	where := []string{"id > ?"}
+	args := []any{q.After}
+	if len(q.Types) > 0 {
+		where = append(where, "event_type IN ("+placeholders(len(q.Types))+")")
+		for _, eventType := range q.Types {
+			args = append(args, eventType)
+		}
+	}
+	if len(q.Users) > 0 {
+		where = append(where, "user_id IN ("+placeholders(len(q.Users))+")")
+		for _, userID := range q.Users {
+			args = append(args, userID)
+		}
+	}
+	if len(q.Fields) > 0 {
+		var fields []string
+		for field, value := range q.Fields {
+			fields = append(fields, "json_extract(data, ?) = ?")
+			args = append(args, `$."`+field+`"`, value)
+		}
+		where = append(where, "("+strings.Join(fields, " OR ")+")")
+	}
+	args = append(args, pageLimit(q.Limit), q.Offset)
+	return es.query("SELECT id, aggregate, version, user_id, trace_id, data FROM events WHERE "+strings.Join(where, " AND ")+" ORDER BY id LIMIT ? OFFSET ?", args...)
+}
+
+// placeholders returns the placeholders of n values in a query
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// SequenceAt returns the sequence of the last event stored before the time, 0 if there is none; the events
+// stored since follow it, see GetEventsSince
+func (es *SQLiteEventStore) SequenceAt(t time.Time) (int64, error) {
+	var sequence sql.NullInt64
+	err := es.db.QueryRow("SELECT MAX(id) FROM events WHERE timestamp < ?", t.UTC().Format("2006-01-02 15:04:05")).Scan(&sequence)
+	return sequence.Int64, err
+}
+
+// CountByType returns the number of stored events of each type
+func (es *SQLiteEventStore) CountByType() (map[string]int, error) {
+	rows, err := es.db.Query("SELECT event_type, COUNT(*) FROM events GROUP BY event_type")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var eventType string
+		var count int
+		if err := rows.Scan(&eventType, &count); err != nil {
+			return nil, err
+		}
+		counts[eventType] = count
+	}
+	return counts, rows.Err()
+}
+
+// pageLimit returns the SQL limit of a page, -1 for no limit
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return -1
+	}
+	return limit
+}
+
+// StoredEvent is an event as persisted in the event store, with the time it was appended
+type StoredEvent struct {
+	Type      string
+	Data      []byte
+	Timestamp time.Time
+	UserID    string // User the event happened for, empty for the owner
+	TraceID   string // Trace of the request the event happened in, empty if it wasn't traced
+}
+
+// StoredEvents returns all persisted events in the order they were appended
+func (es *SQLiteEventStore) StoredEvents() ([]StoredEvent, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	rows, err := es.db.Query("SELECT event_type, data, timestamp, user_id, trace_id FROM events ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stored []StoredEvent
+	for rows.Next() {
+		var s StoredEvent
+		var data string
+		if err := rows.Scan(&s.Type, &data, &s.Timestamp, &s.UserID, &s.TraceID); err != nil {
+			return nil, err
+		}
+		s.Data = []byte(data)
+		stored = append(stored, s)
+	}
+	return stored, rows.Err()
+}
+
+// AppendStored appends events keeping the time they were originally appended, e.g. when importing
+// them from another store. It returns the appended events.
+func (es *SQLiteEventStore) AppendStored(stored ...StoredEvent) ([]Event, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	tx, err := es.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	versions := make(map[string]int64)
+	metas := make([]EventMetadata, 0, len(stored))
+	events := make([]Event, 0, len(stored))
+	for _, s := range stored {
+		event, err := UnmarshalEvent(s.Data)
+		if err != nil {
+			return nil, err
+		}
+		meta, err := es.insert(tx, versions, s.UserID, s.TraceID, event.Type(), string(s.Data), &s.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		metas = append(metas, meta)
+		events = append(events, event)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	es.appended(events, metas, versions)
+	return events, nil
+}
+
+// SaveSnapshot stores the latest snapshot for an aggregate, replacing any older one
+func (es *SQLiteEventStore) SaveSnapshot(aggregateID string, version int, data []byte) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	_, err := es.db.Exec(`INSERT INTO snapshots (aggregate_id, version, data) VALUES (?, ?, ?)
+		ON CONFLICT(aggregate_id) DO UPDATE SET version = excluded.version, data = excluded.data, timestamp = CURRENT_TIMESTAMP`,
+		aggregateID, version, data)
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot for %s: %v", aggregateID, err)
+	}
+	return nil
+}
+
+// LoadSnapshot returns the latest snapshot for an aggregate, or nil data if there is none
+func (es *SQLiteEventStore) LoadSnapshot(aggregateID string) (int, []byte, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	var version int
+	var data []byte
+	err := es.db.QueryRow("SELECT version, data FROM snapshots WHERE aggregate_id = ?", aggregateID).Scan(&version, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to load snapshot for %s: %v", aggregateID, err)
+	}
+	return version, data, nil
+}
+
+// SaveChange stores how an event changed its aggregate
+func (es *SQLiteEventStore) SaveChange(change StoredChange) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	_, err := es.db.Exec(`INSERT OR REPLACE INTO changes (sequence, stream, event_type, user_id, diff, timestamp) VALUES (?, ?, ?, ?, ?, ?)`,
+		change.Sequence, change.Stream, change.EventType, change.UserID, change.Diff, change.Timestamp.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return fmt.Errorf("failed to save the change of event %d: %v", change.Sequence, err)
+	}
+	return nil
+}
+
+// LoadChanges returns the stored changes in the order of their events
+func (es *SQLiteEventStore) LoadChanges() ([]StoredChange, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	rows, err := es.db.Query("SELECT sequence, stream, event_type, user_id, diff, timestamp FROM changes ORDER BY sequence")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var changes []StoredChange
+	for rows.Next() {
+		var c StoredChange
+		if err := rows.Scan(&c.Sequence, &c.Stream, &c.EventType, &c.UserID, &c.Diff, &c.Timestamp); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// Dump writes a copy of the event log, with the snapshots and the changes, to a new database at path that
+// NewSQLiteEventStore opens, e.g. to keep what happened in memory. A file at path is replaced.
+func (es *SQLiteEventStore) Dump(path string) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if _, err := es.db.Exec("VACUUM INTO ?", tmp); err != nil {
+		return fmt.Errorf("failed to dump the event log: %v", err)
+	}
+	return os.Rename(tmp, path)
+}
+
 func (es *SQLiteEventStore) Close() error {
 	return es.db.Close()
 }
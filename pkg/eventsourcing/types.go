@@ -2,9 +2,12 @@
 package eventsourcing
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"mindpalace/pkg/logging"
+	"slices"
 	"sync/atomic"
 	"time"
 
@@ -13,11 +16,37 @@ import (
 
 var eventRegistry = make(map[string]func() Event)
 
+// transientEvents are the types of events published without being stored
+var transientEvents = make(map[string]bool)
+
 // RegisterEvent adds an event type and its creator function to the registry.
 func RegisterEvent(eventType string, creator func() Event) {
 	eventRegistry[eventType] = creator
 }
 
+// IsRegistered reports whether an event type was registered with RegisterEvent
+func IsRegistered(eventType string) bool {
+	_, exists := eventRegistry[eventType]
+	return exists
+}
+
+// RegisteredEventTypes returns the event types registered with RegisterEvent, sorted
+func RegisteredEventTypes() []string {
+	return slices.Sorted(maps.Keys(eventRegistry))
+}
+
+// RegisterTransientEvent marks events of the type as transient: they are applied and reach the
+// subscribers and the UI like any event, but are never written to the store. Use it for query
+// results, such as the tasks listed for the LLM, that change no state and would bloat the log.
+func RegisterTransientEvent(eventType string) {
+	transientEvents[eventType] = true
+}
+
+// IsTransient reports whether the event is of a type registered with RegisterTransientEvent
+func IsTransient(event Event) bool {
+	return transientEvents[event.Type()]
+}
+
 // UnmarshalEvent unmarshals JSON data into the correct event type.
 func UnmarshalEvent(data []byte) (Event, error) {
 	// logging.Debug("Starting UnmarshalEvent with data length: %d", len(data))
@@ -32,6 +61,10 @@ func UnmarshalEvent(data []byte) (Event, error) {
 	}
 	// logging.Debug("Extracted event type: %s", raw.EventType)
 
+	if renamed, ok := renamedEvents[raw.EventType]; ok {
+		raw.EventType = renamed
+	}
+
 	// Look up the creator function in the registry
 	creator, exists := eventRegistry[raw.EventType]
 	if !exists {
@@ -53,27 +86,56 @@ func UnmarshalEvent(data []byte) (Event, error) {
 // Global event bus instance
 var globalEventBus EventBus
 
-// SubmitStreamingEvent is a function for sending streaming events that won't be persisted
-var SubmitStreamingEvent func(eventType string, data map[string]interface{})
+// SubmitStreamingEvent is a function for sending streaming events that won't be persisted, such as
+// the LLM's answer while it streams in
+var SubmitStreamingEvent func(event Event)
 
 // SetGlobalEventBus sets the global event bus instance
 func SetGlobalEventBus(eb EventBus) {
 	globalEventBus = eb
 }
 
+// GetGlobalEventBus returns the global event bus, for plugins publishing events from the background
+func GetGlobalEventBus() EventBus {
+	return globalEventBus
+}
+
 type EventStore interface {
 	Append(events ...Event) error
 	GetEvents() []Event
 	Load() error
 }
 
+// QueryableStore is an event store that reads events from the log a page at a time, rather than copying
+// all events loaded into memory
+type QueryableStore interface {
+	GetEventsByAggregate(aggregate string, version int64, limit int) ([]Event, error) // Events of the stream stored after the version.
+	GetEventsSince(sequence int64, limit int) ([]Event, error)                        // Events stored after the sequence.
+	QueryEvents(q EventQuery) ([]Event, error)                                        // Events the query selects.
+	CountByType() (map[string]int, error)                                             // Number of stored events per type.
+}
+
 // Event defines the interface for all events in the system
 type Event interface {
 	Type() string
 	Unmarshal(data []byte) error
 	Marshal() ([]byte, error)
+	Metadata() *EventMetadata // Embed EventMetadata to implement
+}
+
+// EventMetadata is the position of an event in the event log, assigned by the event store when the
+// event is appended. Events that were never stored have a zero sequence.
+type EventMetadata struct {
+	Sequence  int64  `json:"-"` // Global position, increasing with every stored event
+	Aggregate string `json:"-"` // Stream the event belongs to, the prefix of its type namespaced by the user
+	Version   int64  `json:"-"` // Position among the events of the stream, starting at 1
+	UserID    string `json:"-"` // User the event happened for, empty for the owner and shared events
+	TraceID   string `json:"-"` // Trace of the request the event happened in, empty if it wasn't traced
 }
 
+// Metadata returns the metadata for the event store to fill in
+func (m *EventMetadata) Metadata() *EventMetadata { return m }
+
 const (
 	SystemPlugin PluginType = "system" // Plugins for internal system operations
 	LLMPlugin    PluginType = "llm"    // Plugins usable by the LLM
@@ -122,6 +184,7 @@ func (e *BaseEvent) Marshal() ([]byte, error) {
 func (e *BaseEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
 
 type InitiatePluginCreationEvent struct {
+	EventMetadata
 	EventType   string `json:"event_type"`
 	RequestID   string `json:"request_id"`
 	PluginName  string `json:"plugin_name"`
@@ -145,6 +208,15 @@ type DeltaAction struct {
 	Properties map[string]interface{} `json:"properties,omitempty"` // Key-value props (e.g., {"position": [0,1,0]})
 	Animation  *AnimationSpec         `json:"animation,omitempty"`  // For "animate" type
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`   // Aggregate-specific (e.g., {"task_id": "123"})
+	XR         *XRHints               `json:"xr,omitempty"`         // How to show and handle the node in VR or AR
+}
+
+// XRHints tell clients rendering in VR or AR how to show and handle a node. They are only sent to
+// clients that declared XR in their handshake; others lay out and pick nodes as before.
+type XRHints struct {
+	InteractionVolume []float64 `json:"interaction_volume,omitempty"` // Size of the box hands and controllers touch the node in, in its own units; its mesh if empty
+	Grabbable         bool      `json:"grabbable,omitempty"`          // Whether the node can be picked up and moved, as dragging does on a screen
+	TextScale         float64   `json:"text_scale,omitempty"`         // Scale of billboard text, to read it at arm's length; 1 if 0
 }
 
 // AnimationSpec for tween-like effects.
@@ -157,10 +229,13 @@ type AnimationSpec struct {
 
 // DeltaEnvelope wraps actions for broadcast (includes context for Godot parsing).
 type DeltaEnvelope struct {
-	Type      string        `json:"type"`      // Always "delta"
-	Aggregate string        `json:"aggregate"` // e.g., "taskmanager"
-	EventID   string        `json:"event_id"`  // For ordering/resync
-	Timestamp string        `json:"timestamp"` // ISO for sorting
+	Type      string        `json:"type"`               // Always "delta"
+	Aggregate string        `json:"aggregate"`          // e.g., "taskmanager"
+	EventID   string        `json:"event_id"`           // For ordering/resync
+	Sequence  int64         `json:"sequence,omitempty"` // Sequence of the event, or of the last event applied for a full state
+	Version   int64         `json:"version,omitempty"`  // Version of the event within its own aggregate
+	Timestamp string        `json:"timestamp"`          // ISO for sorting
+	UserID    string        `json:"user_id,omitempty"`  // User whose aggregate emitted the actions, empty for the owner
 	Actions   []DeltaAction `json:"actions"`
 }
 
@@ -171,9 +246,297 @@ type FullStateEnvelope struct {
 	Actions   []DeltaAction `json:"actions"`
 }
 
+// Actions of a CameraEnvelope
+const (
+	CameraFocus    = "focus"     // Fly to the node and look at it
+	CameraOrbit    = "orbit"     // Circle once around the node or zone
+	CameraZoomZone = "zoom_zone" // Fly back until all objects of the zone are in view
+)
+
+// CameraEnvelope directs the camera of a user's 3D clients. It is sent apart from the deltas, the
+// scene stays as it is.
+type CameraEnvelope struct {
+	Type      string  `json:"type"`               // Always "camera"
+	Action    string  `json:"action"`             // CameraFocus, CameraOrbit or CameraZoomZone
+	NodeID    string  `json:"node_id,omitempty"`  // Node looked at
+	Zone      string  `json:"zone,omitempty"`     // Aggregate whose objects are looked at, e.g. "calendar", instead of a node
+	Distance  float64 `json:"distance,omitempty"` // From the target, the client picks one if 0
+	Duration  float64 `json:"duration,omitempty"` // Seconds the flight takes, the client picks one if 0
+	UserID    string  `json:"user_id,omitempty"`  // User whose clients move, empty for the owner
+	Timestamp string  `json:"timestamp"`
+}
+
 // ThreeDUIBroadcaster allows aggregates to emit 3D deltas on events.
 // Implement if the aggregate wants 3D UI (e.g., tasks as cubes).
 type ThreeDUIBroadcaster interface {
 	Broadcast3DDelta(event Event) []DeltaAction // Returns actions for this event (empty if irrelevant).
 	GetFull3DState() []DeltaAction              // Replays events to build initial/full state.
 }
+
+// Snapshotter allows aggregates to persist and restore their state without a full replay.
+// Implement if the aggregate's state can be serialized (e.g., a map of tasks).
+type Snapshotter interface {
+	SaveSnapshot() ([]byte, error)  // Serializes the current state.
+	LoadSnapshot(data []byte) error // Replaces the current state with the snapshot.
+}
+
+// SnapshotStore persists aggregate snapshots next to the event log.
+// The version is the number of events that were applied when the snapshot was taken.
+type SnapshotStore interface {
+	SaveSnapshot(aggregateID string, version int, data []byte) error
+	LoadSnapshot(aggregateID string) (version int, data []byte, err error) // Returns nil data if no snapshot exists.
+}
+
+// Deadline is a point in time an aggregate wants the user to be reminded of.
+type Deadline struct {
+	ID     string    // Unique within the aggregate (e.g., the task ID)
+	Title  string    // Human readable description
+	Due    time.Time // When the deadline or event starts
+	NodeID string    // 3D node representing the item, highlighted when a reminder is due (optional)
+}
+
+// DeadlineProvider allows aggregates to expose deadlines to the reminder scheduler.
+// Implement if the aggregate tracks dates the user should not miss (e.g., task deadlines).
+type DeadlineProvider interface {
+	Deadlines() []Deadline // Returns upcoming deadlines; finished items should be left out.
+}
+
+// BriefingItem is something the user should hear about at the start of their day.
+type BriefingItem struct {
+	Section string    // What the item is, e.g. "Calendar", "Tasks" or "Email"
+	Text    string    // Human readable description, e.g. "Dentist from 14:00 to 15:00 at the clinic"
+	Time    time.Time // When it happens or is due, zero if it has no time
+}
+
+// BriefingProvider allows aggregates to contribute to the briefing composed for the user every morning.
+// Implement if the aggregate holds what the user should know about the day ahead (e.g., today's meetings).
+type BriefingProvider interface {
+	BriefingItems(day time.Time) []BriefingItem // day is midnight of the day briefed on, in the user's time zone.
+}
+
+// Configurable allows plugins to take settings from the configuration file.
+// Implement if the plugin has behavior users may want to tune (e.g., a default priority).
+type Configurable interface {
+	Configure(settings map[string]interface{}) error // Applies the settings; called again when the configuration is reloaded.
+}
+
+// Confirmer makes the orchestrator ask the user before executing destructive commands.
+// Implement if the plugin has commands that are hard to take back (e.g., deleting a task).
+type Confirmer interface {
+	RequiresConfirmation(command string) bool // Reports whether the user must approve the command before it runs.
+}
+
+// Capabilities a plugin can need beyond its own aggregate, declared in its Manifest.
+const (
+	CapabilityNetwork = "network" // Reaches other machines, e.g. to sync a calendar
+	CapabilityAudio   = "audio"   // Records or plays sound
+	CapabilityFiles   = "files"   // Reads or writes files, e.g. to import a CSV
+)
+
+// Capabilities lists the capabilities plugins can declare.
+var Capabilities = []string{CapabilityNetwork, CapabilityAudio, CapabilityFiles}
+
+// Dependency is another plugin a plugin needs, at MinVersion or later.
+type Dependency struct {
+	Plugin     string `json:"plugin"`      // Name of the plugin, e.g. "taskmanager"
+	MinVersion string `json:"min_version"` // Oldest version that works, like "1.2.0"; empty for any
+}
+
+// Manifest declares the version of a plugin and what it needs to work.
+type Manifest struct {
+	Version      string       `json:"version"`      // Version of the plugin, like "1.2.0"
+	Capabilities []string     `json:"capabilities"` // Capabilities the plugin uses, see Capabilities
+	Requires     []Dependency `json:"requires"`     // Plugins the plugin needs loaded, e.g. to follow their events
+}
+
+// Manifester lets the plugin manager check what a plugin needs when loading it, and the user approve what it does.
+// Implement if the plugin reaches outside MindPalace or builds on another plugin (e.g., tracking the progress of tasks).
+type Manifester interface {
+	Manifest() Manifest // Returns the same manifest for every instance.
+}
+
+// UserAware tells a household member's instance of a plugin which user it belongs to.
+// Implement if the instance keeps its state outside itself, shared with other instances (e.g., a plugin running as a process of its own).
+type UserAware interface {
+	SetUser(userID string) // Called once, before the instance's commands are registered; never for the owner's instance.
+}
+
+// Compensator allows aggregates to undo events they applied.
+// Implement if the aggregate's events carry enough data to be reversed (e.g., a deleted task).
+type Compensator interface {
+	Compensate(event Event) ([]Event, error) // Returns the events reversing the given event; nil if there is nothing to undo.
+}
+
+// Kinds of interactions the user can have with 3D objects
+const (
+	ObjectClicked = "object_clicked"
+	ObjectMoved   = "object_moved"
+	ObjectDeleted = "object_deleted"
+)
+
+// Interaction is something the user did to a 3D object in the Godot client.
+type Interaction struct {
+	Kind     string    // ObjectClicked, ObjectMoved or ObjectDeleted
+	NodeID   string    // Node of the object (e.g., "task_123"), labels are reported as their object
+	Position []float64 // Where a moved object was dropped
+	From     []float64 // Where a moved object was picked up, nil if the client didn't send it
+	UserID   string    // User of the client, whose objects the interaction is with
+}
+
+// InteractionHandler maps interactions with the plugin's 3D objects to its commands.
+// Implement if the objects can be acted on directly (e.g., clicking a task completes it).
+type InteractionHandler interface {
+	HandleInteraction(interaction Interaction) (command string, input any) // Returns an empty command for objects of other plugins.
+}
+
+// LayoutOverrider places 3D objects where the user moved them instead of where their aggregate puts them.
+// Implement if the aggregate remembers a layout (e.g., positions of dragged nodes).
+type LayoutOverrider interface {
+	OverrideLayout(actions []DeltaAction) []DeltaAction // Returns the actions with the remembered positions applied.
+}
+
+// CommandFunc executes one of the plugin's commands for the user of the plugin instance, as if the user issued it.
+// Other commands can be executed too, e.g. ProcessUserRequest with a map holding the "requestText" to ask the assistant.
+type CommandFunc func(command string, input any) error
+
+// CommandIssuer lets the plugin's custom UI change its aggregate through the plugin's commands, so every change is an event.
+// Implement if the custom UI edits what it shows (e.g., dragging a task to another column).
+type CommandIssuer interface {
+	SetCommandFunc(execute CommandFunc) // Called once for every instance, with the function executing commands as its user.
+}
+
+// GenerateFunc has the LLM answer a prompt outside of a user request.
+type GenerateFunc func(prompt string) (string, error)
+
+// Generator lets plugins have the LLM write text on their own.
+// Implement if the plugin produces text nobody asked for right then (e.g., a weekly reflection on journal entries).
+type Generator interface {
+	SetGenerateFunc(generate GenerateFunc) // Called once when the orchestrator starts.
+}
+
+// EmbedFunc computes an embedding vector for each of the texts, in order.
+type EmbedFunc func(texts []string) ([][]float32, error)
+
+// Embedder lets plugins compute embeddings with the configured embedding model.
+// Implement if the plugin searches text by meaning (e.g., retrieving passages of imported documents).
+type Embedder interface {
+	SetEmbedFunc(embed EmbedFunc) // Called once when the plugins are loaded.
+}
+
+// Projection is a read model: tables derived from the stored events, kept up to date as events are
+// published and rebuilt from the event log when its version changes.
+type Projection interface {
+	Name() string                          // Unique, e.g. "taskmanager_due"; prefix the tables with it.
+	Version() int                          // Increase it when Setup or Project change, to rebuild the tables.
+	Setup(tx *sql.Tx) error                // Drops the projection's tables if they exist and creates them empty.
+	Project(tx *sql.Tx, event Event) error // Updates the tables with a stored event, of any user or aggregate.
+}
+
+// ReadModelProvider lets plugins keep projections, tables of their state that are cheap to query.
+// Implement if the plugin answers queries its aggregate would compute on every call (e.g., tasks due this week).
+type ReadModelProvider interface {
+	Projections() []Projection               // Called on the owner's instance; the projections see the events of all users.
+	SetReadModels(db *sql.DB, userID string) // Called on every instance, with the user whose rows the instance reads.
+}
+
+// StateQuerier lets the orchestrator read the aggregate's state to answer questions spanning plugins.
+// Implement if the state helps answer questions together with that of other plugins (e.g., tasks due before the next meeting).
+type StateQuerier interface {
+	QueryState() any // Returns a copy of the state to share, marshalled to JSON for the LLM; leave out what is private.
+}
+
+// TimeZoneAware lets plugins read the dates users say in the user's time zone.
+// Implement if the plugin takes dates or times from the user (e.g., a task's deadline).
+type TimeZoneAware interface {
+	SetLocation(loc *time.Location) // Called for every instance with its user's time zone, and again when the configuration is reloaded.
+}
+
+// TaggedItem is an item of a plugin carrying tags, e.g. a task or a calendar event.
+type TaggedItem struct {
+	Aggregate string    `json:"aggregate"` // ID of the aggregate holding the item, e.g. "taskmanager"
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Due       time.Time `json:"due,omitempty"` // Deadline or start, zero if the item has none
+	Tags      []string  `json:"tags"`
+}
+
+// TagIndex lets items of all plugins be listed by tag.
+// Implement if the aggregate's items carry tags (e.g., tasks).
+type TagIndex interface {
+	TaggedItems() []TaggedItem // Returns the items with at least one tag, with their tags as stored.
+}
+
+// TagNormalizer puts the tags users give in their canonical form.
+type TagNormalizer interface {
+	NormalizeTags(tags []string) ([]string, error) // Fails on a tag that looks like a misspelling of a known one, suggesting it.
+}
+
+// TagAware lets plugins store tags in their canonical form, so the same tag is spelled the same everywhere.
+// Implement if the plugin's commands take tags (e.g., creating a task).
+type TagAware interface {
+	SetTagNormalizer(normalizer TagNormalizer) // Called for every instance with the normalizer of its user.
+}
+
+// Item is an item of a plugin that items of other plugins can be linked to, e.g. a task or a calendar event.
+type Item struct {
+	Aggregate string `json:"aggregate"` // ID of the aggregate holding the item, e.g. "taskmanager"
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	NodeID    string `json:"node_id,omitempty"` // Node of the item in the 3D world, its label is NodeID + "_label"; empty if it has none
+}
+
+// ItemIndex lets items of all plugins be linked to each other.
+// Implement if the aggregate's items relate to those of other plugins (e.g., a task preparing a meeting).
+type ItemIndex interface {
+	Item(id string) (Item, bool) // Returns the item with the ID, false if there is none.
+}
+
+// LinkSource finds the items linked to an item.
+type LinkSource interface {
+	LinkedItems(aggregate, id string) []Item // Returns the items linked to the item, in the order they were linked.
+}
+
+// LinkAware lets plugins show which items of other plugins their items are linked to.
+// Implement if the plugin shows items it has an ItemIndex for (e.g., a badge on a task's card).
+type LinkAware interface {
+	SetLinkSource(source LinkSource) // Called for every instance with the links of its user.
+}
+
+// Example shows the agent of a plugin which command a request calls for, and with which input.
+type Example struct {
+	Request   string                 `json:"request"`   // What the user says, e.g. "remind me to call mom tomorrow"
+	Command   string                 `json:"command"`   // Command the agent should call, e.g. "CreateTask"
+	Arguments map[string]interface{} `json:"arguments"` // Input of the command, as the agent should give it
+}
+
+// ExampleProvider gives the agent of a plugin examples of requests and the commands they call for.
+// Implement if the agent picks the wrong command or input for common requests (e.g., on small models).
+type ExampleProvider interface {
+	Examples() []Example // Returns the plugin's own examples; the user can add more at runtime.
+}
+
+// ProgressFunc reports how far a command is, in percent from 0 to 100, with what it is doing.
+type ProgressFunc func(percent int, message string)
+
+// ProgressReporter lets the orchestrator show how far a long-running command is while it runs.
+// Implement by embedding Progress in the command's input (e.g., syncing with an issue tracker).
+type ProgressReporter interface {
+	SetProgressFunc(report ProgressFunc) // Called before the command runs, with the function publishing its progress.
+}
+
+// Progress implements ProgressReporter for the command input it is embedded in.
+type Progress struct {
+	report ProgressFunc
+}
+
+// SetProgressFunc sets the function Report calls.
+func (p *Progress) SetProgressFunc(report ProgressFunc) {
+	p.report = report
+}
+
+// Report reports the progress of the command, if anyone follows it.
+func (p *Progress) Report(percent int, message string) {
+	if p != nil && p.report != nil {
+		p.report(percent, message)
+	}
+}
@@ -0,0 +1,73 @@
+package eventsourcing
+
+// Events of a household member are kept apart from those of the owner: they carry the user in their
+// metadata, are numbered in streams of their own and are applied to that user's aggregates only.
+// Events without a user belong to the owner, the person at the desktop, or to no one in particular.
+
+// UserAggregateStore keeps aggregates per user next to the aggregates shared by all users.
+// Implement if plugins get an instance per user (e.g., everyone has their own tasks).
+type UserAggregateStore interface {
+	AggregatesOf(userID string) []Aggregate   // Returns the shared aggregates and the user's own.
+	UserAggregates(userID string) []Aggregate // Returns the user's own aggregates only.
+	Users() []string                          // Returns the users with aggregates of their own.
+}
+
+// UserSnapshotter is implemented by aggregates shared by all users that can show a user their own part
+// of the state, e.g. the facts they pinned. Household members see shared aggregates only through it.
+type UserSnapshotter interface {
+	SnapshotFor(userID string) ([]byte, error) // Serializes the user's part of the state.
+}
+
+// StreamOf returns the stream an event of the user is numbered in: its aggregate, namespaced by the
+// user (e.g., "alice/taskmanager") unless the event belongs to the owner.
+func StreamOf(userID, eventType string) string {
+	if userID == "" {
+		return AggregateOf(eventType)
+	}
+	return userID + "/" + AggregateOf(eventType)
+}
+
+// SnapshotID returns the ID a snapshot of a user's aggregate is stored under
+func SnapshotID(userID, aggregateID string) string {
+	if userID == "" {
+		return aggregateID
+	}
+	return userID + "/" + aggregateID
+}
+
+// UserOf returns the user a command acts for: the user of the event it reacts to, or the "userID"
+// of its input. Commands of the owner return an empty user.
+func UserOf(data any) string {
+	switch d := data.(type) {
+	case Event:
+		return d.Metadata().UserID
+	case map[string]interface{}:
+		userID, _ := d["userID"].(string)
+		return userID
+	}
+	return ""
+}
+
+// aggregatesOf returns the aggregates an event of the user is applied to
+func aggregatesOf(store AggregateStore, userID string) []Aggregate {
+	if users, ok := store.(UserAggregateStore); ok {
+		return users.AggregatesOf(userID)
+	}
+	return store.AllAggregates()
+}
+
+// SnapshotIDs returns every aggregate of the store by the ID it is snapshotted under
+func SnapshotIDs(store AggregateStore) map[string]Aggregate {
+	aggs := make(map[string]Aggregate)
+	for _, agg := range store.AllAggregates() {
+		aggs[agg.ID()] = agg
+	}
+	if users, ok := store.(UserAggregateStore); ok {
+		for _, userID := range users.Users() {
+			for _, agg := range users.UserAggregates(userID) {
+				aggs[SnapshotID(userID, agg.ID())] = agg
+			}
+		}
+	}
+	return aggs
+}
@@ -1,5 +1,7 @@
 package llmmodels
 
+import "encoding/json"
+
 // Message defines the structure for Ollama API chat messages
 type Message struct {
 	Role    string `json:"role"`
@@ -9,11 +11,12 @@ type Message struct {
 
 // OllamaRequest represents the request structure for the Ollama API.
 type OllamaRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-	Stream   bool      `json:"stream"`
-	Tools    []Tool    `json:"tools,omitempty"`
-	NumCtx   int       `json:"num_ctx,omitempty"` // Added context window size
+	Model    string          `json:"model"`
+	Messages []Message       `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Tools    []Tool          `json:"tools,omitempty"`
+	NumCtx   int             `json:"num_ctx,omitempty"` // Added context window size
+	Format   json.RawMessage `json:"format,omitempty"`  // "json" or a JSON schema constraining the answer
 }
 
 // Tool represents a function tool available to the LLM.
@@ -42,8 +45,11 @@ type OllamaMessage struct {
 
 // OllamaResponse represents the full response structure
 type OllamaResponse struct {
-	Message OllamaMessage `json:"message"`
-	Done    bool          `json:"done"`
+	Message         OllamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	Model           string        `json:"model,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count,omitempty"` // Prompt tokens, reported in the final chunk
+	EvalCount       int           `json:"eval_count,omitempty"`        // Completion tokens, reported in the final chunk
 }
 
 // StreamHandler defines a callback function for handling streaming responses
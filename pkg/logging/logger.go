@@ -1,11 +1,15 @@
 package logging
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 // LogLevel defines the logging level
@@ -22,108 +26,251 @@ const (
 	LogLevelTrace LogLevel = iota
 )
 
-// Logger provides a simple logging interface with verbosity controls
+// levelNames are the names of the levels in configuration and JSON output
+var levelNames = map[LogLevel]string{
+	LogLevelError: "error",
+	LogLevelInfo:  "info",
+	LogLevelDebug: "debug",
+	LogLevelTrace: "trace",
+}
+
+// String returns the name of the level
+func (l LogLevel) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel parses a level name: error, info, debug or trace
+func ParseLevel(name string) (LogLevel, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(strings.TrimSpace(name), levelName) {
+			return level, nil
+		}
+	}
+	return LogLevelInfo, fmt.Errorf("unknown log level %q, use error, info, debug or trace", name)
+}
+
+// Format selects how log lines are written
+type Format int
+
+const (
+	// FormatText writes lines like "2024/01/02 15:04:05 [INFO] [audio] message"
+	FormatText Format = iota
+	// FormatJSON writes one JSON object per line with the time, level, logger and message
+	FormatJSON
+)
+
+// ParseFormat parses a format name: text or json
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	}
+	return FormatText, fmt.Errorf("unknown log format %q, use text or json", name)
+}
+
+// Logger provides a simple logging interface with verbosity controls. The global logger has no name;
+// named loggers belong to a subsystem and log at the global level unless given a level of their own.
 type Logger struct {
-	mu      sync.Mutex
-	level   LogLevel
-	logger  *log.Logger
-	handler io.Writer
+	name     string
+	level    LogLevel
+	hasLevel bool
 }
 
 var (
 	// Global instance of the logger
-	globalLogger *Logger
-	once         sync.Once
+	globalLogger = &Logger{level: LogLevelInfo, hasLevel: true}
+
+	mu         sync.Mutex // Guards the loggers and the output they share
+	loggers               = make(map[string]*Logger)
+	handler    io.Writer  = os.Stdout
+	textLogger            = log.New(os.Stdout, "", log.LstdFlags)
+	format     Format
+	now        = time.Now
 )
 
 // GetLogger returns the global logger instance
 func GetLogger() *Logger {
-	once.Do(func() {
-		globalLogger = &Logger{
-			level:   LogLevelInfo, // Default level
-			handler: os.Stdout,
-			logger:  log.New(os.Stdout, "", log.LstdFlags),
-		}
-	})
 	return globalLogger
 }
 
+// Named returns the logger of a subsystem, e.g. "audio" or "orchestration"
+func Named(name string) *Logger {
+	mu.Lock()
+	defer mu.Unlock()
+	logger, exists := loggers[name]
+	if !exists {
+		logger = &Logger{name: name}
+		loggers[name] = logger
+	}
+	return logger
+}
+
 // SetVerbosity sets the global log level
 func SetVerbosity(level LogLevel) {
 	GetLogger().SetLevel(level)
 }
 
-// SetOutput sets the log output destination
+// SetOutput sets the log output destination of all loggers
 func SetOutput(w io.Writer) {
-	GetLogger().SetOutput(w)
+	mu.Lock()
+	defer mu.Unlock()
+	handler = w
+	textLogger = log.New(w, "", log.LstdFlags)
+}
+
+// SetFormat sets the format of all loggers
+func SetFormat(f Format) {
+	mu.Lock()
+	defer mu.Unlock()
+	format = f
+}
+
+// SetLevels gives subsystems levels of their own; subsystems left out log at the global level again
+func SetLevels(levels map[string]LogLevel) {
+	mu.Lock()
+	defer mu.Unlock()
+	for name := range loggers {
+		if _, exists := levels[name]; !exists {
+			loggers[name].hasLevel = false
+		}
+	}
+	for name, level := range levels {
+		logger, exists := loggers[name]
+		if !exists {
+			logger = &Logger{name: name}
+			loggers[name] = logger
+		}
+		logger.level = level
+		logger.hasLevel = true
+	}
+}
+
+// ParseLevels parses subsystem levels like "audio=debug,llm=trace"
+func ParseLevels(spec string) (map[string]LogLevel, error) {
+	levels := make(map[string]LogLevel)
+	for _, part := range strings.Split(spec, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		name, levelName, found := strings.Cut(part, "=")
+		if !found || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid log level %q, use subsystem=level", part)
+		}
+		level, err := ParseLevel(levelName)
+		if err != nil {
+			return nil, err
+		}
+		levels[strings.TrimSpace(name)] = level
+	}
+	return levels, nil
+}
+
+// Subsystems returns the names of the named loggers
+func Subsystems() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	names := make([]string, 0, len(loggers))
+	for name := range loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // SetLevel sets the log level for this logger
 func (l *Logger) SetLevel(level LogLevel) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	mu.Lock()
+	defer mu.Unlock()
 	l.level = level
+	l.hasLevel = true
 }
 
-// SetOutput sets the output destination for this logger
+// SetOutput sets the output destination, which all loggers share
 func (l *Logger) SetOutput(w io.Writer) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.handler = w
-	l.logger = log.New(w, "", log.LstdFlags)
+	SetOutput(w)
+}
+
+// Enabled reports whether messages of the level are logged
+func (l *Logger) Enabled(level LogLevel) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return level <= l.effectiveLevel()
+}
+
+// effectiveLevel returns the level of the logger, the global level if it has none; mu must be held
+func (l *Logger) effectiveLevel() LogLevel {
+	if l.hasLevel {
+		return l.level
+	}
+	return globalLogger.level
+}
+
+// write logs the message if the level is enabled
+func (l *Logger) write(level LogLevel, tag, msg string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if level > l.effectiveLevel() {
+		return
+	}
+	if format == FormatJSON {
+		line := struct {
+			Time   string `json:"time"`
+			Level  string `json:"level"`
+			Logger string `json:"logger,omitempty"`
+			Msg    string `json:"msg"`
+		}{now().Format(time.RFC3339Nano), strings.ToLower(tag), l.name, msg}
+		data, err := json.Marshal(line)
+		if err != nil {
+			return
+		}
+		handler.Write(append(data, '\n'))
+		return
+	}
+	if l.name != "" {
+		textLogger.Printf("[%s] [%s] %s", tag, l.name, msg)
+		return
+	}
+	textLogger.Printf("[%s] %s", tag, msg)
 }
 
 // Error logs an error message regardless of verbosity level
 func (l *Logger) Error(format string, args ...interface{}) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	msg := fmt.Sprintf("[ERROR] "+format, args...)
-	l.logger.Println(msg)
+	l.write(LogLevelError, "ERROR", fmt.Sprintf(format, args...))
 }
 
 // Info logs information that should always be shown unless errors only
 func (l *Logger) Info(format string, args ...interface{}) {
-	if l.level >= LogLevelInfo {
-		l.mu.Lock()
-		defer l.mu.Unlock()
-		msg := fmt.Sprintf("[INFO] "+format, args...)
-		l.logger.Println(msg)
+	if l.Enabled(LogLevelInfo) {
+		l.write(LogLevelInfo, "INFO", fmt.Sprintf(format, args...))
 	}
 }
 
 // Debug logs detailed information for debugging purposes
 func (l *Logger) Debug(format string, args ...interface{}) {
-	if l.level >= LogLevelDebug {
-		l.mu.Lock()
-		defer l.mu.Unlock()
-		msg := fmt.Sprintf("[DEBUG] "+format, args...)
-		l.logger.Println(msg)
+	if l.Enabled(LogLevelDebug) {
+		l.write(LogLevelDebug, "DEBUG", fmt.Sprintf(format, args...))
 	}
 }
 
 // Trace logs extremely detailed information
 func (l *Logger) Trace(format string, args ...interface{}) {
-	if l.level >= LogLevelTrace {
-		l.mu.Lock()
-		defer l.mu.Unlock()
-		msg := fmt.Sprintf("[TRACE] "+format, args...)
-		l.logger.Println(msg)
+	if l.Enabled(LogLevelTrace) {
+		l.write(LogLevelTrace, "TRACE", fmt.Sprintf(format, args...))
 	}
 }
 
 // Command logs information about commands being executed
 func (l *Logger) Command(commandName string, data any) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	msg := fmt.Sprintf("[COMMAND] %s", commandName)
-	l.logger.Println(msg)
+	l.write(LogLevelError, "COMMAND", commandName)
 
 	// Log command details at debug level
-	if l.level >= LogLevelDebug {
-		if data != nil {
-			dataMsg := fmt.Sprintf("[DEBUG] Command data: %v", data)
-			l.logger.Println(dataMsg)
-		}
+	if data != nil && l.Enabled(LogLevelDebug) {
+		l.write(LogLevelDebug, "DEBUG", fmt.Sprintf("Command data: %v", data))
 	}
 }
 
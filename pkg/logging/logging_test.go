@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// capture sends the log to a buffer for the duration of the test
+func capture(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	t.Cleanup(func() {
+		SetOutput(os.Stdout)
+		SetFormat(FormatText)
+		SetLevels(nil)
+		SetVerbosity(LogLevelInfo)
+	})
+	return &buf
+}
+
+func TestNamedLoggers_IndependentLevels(t *testing.T) {
+	buf := capture(t)
+	SetVerbosity(LogLevelInfo)
+	SetLevels(map[string]LogLevel{"audio": LogLevelDebug})
+
+	Named("audio").Debug("audio debug")
+	Named("llm").Debug("llm debug")
+	Named("llm").Info("llm info")
+
+	out := buf.String()
+	if !strings.Contains(out, "[DEBUG] [audio] audio debug") {
+		t.Errorf("Expected the audio debug line, got %q", out)
+	}
+	if strings.Contains(out, "llm debug") {
+		t.Errorf("Expected llm to log at the global level, got %q", out)
+	}
+	if !strings.Contains(out, "[INFO] [llm] llm info") {
+		t.Errorf("Expected the llm info line, got %q", out)
+	}
+
+	SetLevels(nil)
+	buf.Reset()
+	Named("audio").Debug("audio debug")
+	if buf.Len() != 0 {
+		t.Errorf("Expected audio back at the global level, got %q", buf.String())
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	buf := capture(t)
+	SetFormat(FormatJSON)
+
+	Named("godot_ws").Error("lost %d clients", 2)
+
+	var line map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("Expected a JSON line, got %q: %v", buf.String(), err)
+	}
+	if line["level"] != "error" || line["logger"] != "godot_ws" || line["msg"] != "lost 2 clients" || line["time"] == "" {
+		t.Errorf("Unexpected JSON line: %v", line)
+	}
+}
+
+func TestParseLevels(t *testing.T) {
+	levels, err := ParseLevels("audio=debug, llm=TRACE")
+	if err != nil {
+		t.Fatalf("ParseLevels failed: %v", err)
+	}
+	if len(levels) != 2 || levels["audio"] != LogLevelDebug || levels["llm"] != LogLevelTrace {
+		t.Errorf("Unexpected levels: %v", levels)
+	}
+	for _, spec := range []string{"audio", "=debug", "audio=loud"} {
+		if _, err := ParseLevels(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "mindpalace.log")
+	file, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile failed: %v", err)
+	}
+	defer file.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	for name, want := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		data, err := os.ReadFile(name)
+		if err != nil || string(data) != want {
+			t.Errorf("Expected %s to hold %q, got %q (%v)", filepath.Base(name), want, data, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only 2 backups to be kept")
+	}
+}
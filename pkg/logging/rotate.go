@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RotatingFile is a log file that is rotated once it reaches MaxSize bytes: the file is renamed
+// to path.1, path.1 to path.2 and so on, keeping MaxBackups old files.
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64 // Size in bytes a file is rotated at, 0 disables rotation
+	MaxBackups int   // Number of rotated files kept
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenRotatingFile opens the log file for appending, creating its directory if needed
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{Path: path, MaxSize: maxSize, MaxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write appends to the file, rotating it first when the write would exceed MaxSize
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return 0, fmt.Errorf("log file %s is closed", r.Path)
+	}
+	if r.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.MaxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close closes the file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func (r *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.Path), 0o755); err != nil {
+		return fmt.Errorf("failed to create log directory: %v", err)
+	}
+	file, err := os.OpenFile(r.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %v", err)
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+// rotate shifts the backups, dropping the oldest, and starts a new file; r.mu must be held
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %v", err)
+	}
+	r.file = nil
+	if r.MaxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", r.Path, r.MaxBackups))
+		for i := r.MaxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.Path, i), fmt.Sprintf("%s.%d", r.Path, i+1))
+		}
+		if err := os.Rename(r.Path, r.Path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate log file: %v", err)
+		}
+	} else if err := os.Remove(r.Path); err != nil {
+		return fmt.Errorf("failed to rotate log file: %v", err)
+	}
+	return r.open()
+}
+
+// Options configure the loggers as a whole, e.g. from the configuration file
+type Options struct {
+	Format     Format
+	Levels     map[string]LogLevel // Subsystem levels, other subsystems log at the global level
+	File       string              // Log file written next to stdout, empty logs to stdout only
+	MaxSize    int64               // Size in bytes the log file is rotated at, 0 disables rotation
+	MaxBackups int                 // Number of rotated log files kept
+}
+
+var (
+	fileMu  sync.Mutex
+	logFile *RotatingFile // Open log file, replaced when Configure names another file
+)
+
+// Configure applies the options; it can be called again, e.g. when the configuration is reloaded
+func Configure(opts Options) error {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	var output io.Writer = os.Stdout
+	switch {
+	case opts.File == "":
+		if logFile != nil {
+			defer logFile.Close()
+			logFile = nil
+		}
+	case logFile != nil && logFile.Path == opts.File:
+		logFile.mu.Lock()
+		logFile.MaxSize, logFile.MaxBackups = opts.MaxSize, opts.MaxBackups
+		logFile.mu.Unlock()
+		output = io.MultiWriter(os.Stdout, logFile)
+	default:
+		file, err := OpenRotatingFile(opts.File, opts.MaxSize, opts.MaxBackups)
+		if err != nil {
+			return err
+		}
+		if logFile != nil {
+			defer logFile.Close()
+		}
+		logFile = file
+		output = io.MultiWriter(os.Stdout, file)
+	}
+	SetOutput(output)
+	SetFormat(opts.Format)
+	SetLevels(opts.Levels)
+	return nil
+}
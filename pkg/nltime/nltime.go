@@ -0,0 +1,340 @@
+// Package nltime parses the dates and times users say, like "next Tuesday at 3pm" or "in 2 hours",
+// next to ISO dates. Phrases are read in the location of the time they are relative to, so each
+// user's dates are in their own time zone. Input that could mean several times is refused with
+// the alternatives, rather than guessed.
+package nltime
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error explains why a date or time could not be parsed, with what to say instead
+type Error struct {
+	Text        string   // The text as given
+	Reason      string   // Why it was refused, e.g. that it could mean 3am or 3pm
+	Suggestions []string // Unambiguous alternatives, or examples of what is understood
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%q %s", e.Text, e.Reason)
+	if len(e.Suggestions) > 0 {
+		quoted := make([]string, len(e.Suggestions))
+		for i, suggestion := range e.Suggestions {
+			quoted[i] = strconv.Quote(suggestion)
+		}
+		msg += ", try " + strings.Join(quoted, " or ")
+	}
+	return msg
+}
+
+// examples are suggested for text that isn't understood at all
+var examples = []string{"2024-05-01T15:00:00Z", "tomorrow at 9am", "next friday", "in 2 hours", "may 3 at 14:30"}
+
+// layouts are the ISO forms accepted; all but RFC 3339 are read in the location of now
+var layouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// Parse returns the time the text means, relative to now and in now's location. Besides ISO dates it
+// understands days like "today", "tomorrow", "friday", "next tuesday" and "march 5", durations like
+// "in 3 days" or "2 hours ago", and times like "3pm", "15:30", "noon" or "evening", combined as in
+// "tomorrow at 3pm". Days without a time start at midnight; a time without a day is the next time
+// the clock shows it. "Midnight" is the end of the day.
+func Parse(text string, now time.Time) (time.Time, error) {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return time.Time{}, &Error{Text: text, Reason: "is empty", Suggestions: examples}
+	}
+	for _, layout := range layouts {
+		if layout == time.RFC3339 {
+			if t, err := time.Parse(layout, trimmed); err == nil {
+				return t, nil
+			}
+		} else if t, err := time.ParseInLocation(layout, trimmed, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	phrase := strings.Join(strings.Fields(strings.NewReplacer(",", " ", ".", " ").Replace(strings.ToLower(trimmed))), " ")
+	phrase, at, err := extractClock(text, phrase)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var words []string
+	for _, word := range strings.Fields(phrase) {
+		if !fillers[word] {
+			words = append(words, word)
+		}
+	}
+	day, exact, err := parseDay(text, strings.Join(words, " "), now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !exact.IsZero() {
+		return exact, nil
+	}
+	if at == nil {
+		return day, nil
+	}
+	t := time.Date(day.Year(), day.Month(), day.Day(), at.hour, at.minute, 0, 0, now.Location())
+	if len(words) == 0 && t.Before(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// fillers are words left out of the day, as in "on the 5th of may" or "due by friday"
+var fillers = map[string]bool{"at": true, "on": true, "by": true, "the": true, "of": true, "due": true, "before": true}
+
+// clock is a time of day
+type clock struct {
+	hour, minute int
+}
+
+var (
+	periodClock    = regexp.MustCompile(`\b(morning|afternoon|evening|tonight|noon|midday|midnight)\b`)
+	twelveHourTime = regexp.MustCompile(`\b(\d{1,2})(?::(\d{2}))? ?(am|pm|a m|p m)\b`)
+	twentyFourTime = regexp.MustCompile(`\b(\d{1,2}):(\d{2})\b`)
+	bareHour       = regexp.MustCompile(`\bat (\d{1,2})(?: o'clock)?$|\bat (\d{1,2})(?: o'clock)? `)
+)
+
+// periods are the times of the parts of the day, and whether hours said in them are after noon
+var periods = map[string]struct {
+	at        clock
+	afternoon bool
+}{
+	"morning":   {clock{9, 0}, false},
+	"afternoon": {clock{15, 0}, true},
+	"evening":   {clock{19, 0}, true},
+	"tonight":   {clock{20, 0}, true},
+	"noon":      {clock{12, 0}, true},
+	"midday":    {clock{12, 0}, true},
+	"midnight":  {clock{23, 59}, false},
+}
+
+// extractClock takes the time of day out of the phrase, returning the rest and the time, nil if the
+// phrase names none
+func extractClock(text, phrase string) (string, *clock, error) {
+	var at *clock
+	afternoon, inPeriod := false, false
+	if m := periodClock.FindStringSubmatchIndex(phrase); m != nil {
+		period := periods[phrase[m[2]:m[3]]]
+		at, afternoon, inPeriod = &period.at, period.afternoon, true
+		replacement := ""
+		if phrase[m[2]:m[3]] == "tonight" {
+			replacement = "today"
+		}
+		phrase = phrase[:m[0]] + replacement + phrase[m[1]:]
+	}
+
+	if m := twelveHourTime.FindStringSubmatch(phrase); m != nil {
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		if hour < 1 || hour > 12 || minute > 59 {
+			return "", nil, &Error{Text: text, Reason: fmt.Sprintf("has %q, which is not a time", m[0]), Suggestions: []string{"3pm", "15:00"}}
+		}
+		if strings.HasPrefix(m[3], "p") != (hour == 12) {
+			hour = (hour + 12) % 24 // 3pm is 15:00, 12am is 00:00
+		}
+		return strings.Replace(phrase, m[0], "", 1), &clock{hour, minute}, nil
+	}
+	if m := twentyFourTime.FindStringSubmatch(phrase); m != nil {
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		if hour > 23 || minute > 59 {
+			return "", nil, &Error{Text: text, Reason: fmt.Sprintf("has %q, which is not a time", m[0]), Suggestions: []string{"15:00", "3pm"}}
+		}
+		if hour < 12 && afternoon {
+			hour += 12
+		}
+		return strings.Replace(phrase, m[0], "", 1), &clock{hour, minute}, nil
+	}
+	if m := bareHour.FindStringSubmatch(phrase); m != nil {
+		hour, _ := strconv.Atoi(m[1] + m[2])
+		switch {
+		case hour > 23:
+			return "", nil, &Error{Text: text, Reason: fmt.Sprintf("has %d, which is not an hour", hour), Suggestions: []string{"3pm", "15:00"}}
+		case hour >= 1 && hour <= 12 && !inPeriod:
+			return "", nil, &Error{
+				Text:        text,
+				Reason:      fmt.Sprintf("could mean %dam or %dpm", hour, hour),
+				Suggestions: []string{fmt.Sprintf("%dam", hour), fmt.Sprintf("%dpm", hour)},
+			}
+		case hour < 12 && afternoon:
+			hour += 12
+		}
+		return strings.Replace(phrase, strings.TrimSpace(m[0]), "", 1), &clock{hour, 0}, nil
+	}
+	return phrase, at, nil
+}
+
+var (
+	weekdayPhrase  = regexp.MustCompile(`^(?:(this|next|last|coming) )?([a-z]+)$`)
+	relativePhrase = regexp.MustCompile(`^(?:in )?([a-z0-9]+) (minute|hour|day|week|month|year)s?(?: (from now|later|ago))?$`)
+	monthDayPhrase = regexp.MustCompile(`^([a-z]+) (\d{1,2})(?:st|nd|rd|th)?(?: (\d{4}))?$`)
+	dayMonthPhrase = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th)? ([a-z]+)(?: (\d{4}))?$`)
+	numericDate    = regexp.MustCompile(`^(\d{1,2})[/-](\d{1,2})(?:[/-](\d{2}|\d{4}))?$`)
+)
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+var months = map[string]time.Month{
+	"january": time.January, "jan": time.January,
+	"february": time.February, "feb": time.February,
+	"march": time.March, "mar": time.March,
+	"april": time.April, "apr": time.April,
+	"may":  time.May,
+	"june": time.June, "jun": time.June,
+	"july": time.July, "jul": time.July,
+	"august": time.August, "aug": time.August,
+	"september": time.September, "sep": time.September, "sept": time.September,
+	"october": time.October, "oct": time.October,
+	"november": time.November, "nov": time.November,
+	"december": time.December, "dec": time.December,
+}
+
+var numbers = map[string]int{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+}
+
+// parseDay returns the midnight of the day the phrase names, or the exact time for phrases like
+// "now" and "in 2 hours"
+func parseDay(text, phrase string, now time.Time) (day, exact time.Time, err error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch phrase {
+	case "", "today", "this":
+		return today, time.Time{}, nil
+	case "now", "right now":
+		return today, now, nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), time.Time{}, nil
+	case "day after tomorrow":
+		return today.AddDate(0, 0, 2), time.Time{}, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), time.Time{}, nil
+	case "next week":
+		return today.AddDate(0, 0, 7-(int(now.Weekday())+6)%7), time.Time{}, nil
+	case "next month":
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location()), time.Time{}, nil
+	case "weekend", "this weekend":
+		return today.AddDate(0, 0, (int(time.Saturday)-int(now.Weekday())+7)%7), time.Time{}, nil
+	}
+
+	if m := weekdayPhrase.FindStringSubmatch(phrase); m != nil {
+		if weekday, ok := weekdays[m[2]]; ok {
+			days := (int(weekday) - int(now.Weekday()) + 7) % 7
+			switch m[1] {
+			case "":
+				if days == 0 {
+					return time.Time{}, time.Time{}, &Error{
+						Text:        text,
+						Reason:      fmt.Sprintf("could mean today or %s next week", m[2]),
+						Suggestions: []string{"today", "next " + m[2]},
+					}
+				}
+			case "next":
+				if days == 0 {
+					days = 7
+				}
+			case "last":
+				days -= 7
+				if days == 0 {
+					days = -7
+				}
+			}
+			return today.AddDate(0, 0, days), time.Time{}, nil
+		}
+	}
+
+	if m := relativePhrase.FindStringSubmatch(phrase); m != nil && (strings.HasPrefix(phrase, "in ") || m[3] != "") {
+		n, known := numbers[m[1]]
+		if !known {
+			if n, err = strconv.Atoi(m[1]); err != nil {
+				return time.Time{}, time.Time{}, &Error{Text: text, Reason: fmt.Sprintf("has %q, which is not a number", m[1]), Suggestions: []string{"in 2 " + m[2] + "s"}}
+			}
+		}
+		if m[3] == "ago" {
+			n = -n
+		}
+		switch m[2] {
+		case "minute":
+			return today, now.Add(time.Duration(n) * time.Minute), nil
+		case "hour":
+			return today, now.Add(time.Duration(n) * time.Hour), nil
+		case "day":
+			return today.AddDate(0, 0, n), time.Time{}, nil
+		case "week":
+			return today.AddDate(0, 0, 7*n), time.Time{}, nil
+		case "month":
+			return today.AddDate(0, n, 0), time.Time{}, nil
+		default:
+			return today.AddDate(n, 0, 0), time.Time{}, nil
+		}
+	}
+
+	monthName, dayNumber, year := "", "", ""
+	if m := monthDayPhrase.FindStringSubmatch(phrase); m != nil {
+		monthName, dayNumber, year = m[1], m[2], m[3]
+	} else if m := dayMonthPhrase.FindStringSubmatch(phrase); m != nil {
+		monthName, dayNumber, year = m[2], m[1], m[3]
+	}
+	if month, ok := months[monthName]; ok {
+		d, _ := strconv.Atoi(dayNumber)
+		y, _ := strconv.Atoi(year)
+		return calendarDay(text, y, month, d, today)
+	}
+
+	if m := numericDate.FindStringSubmatch(phrase); m != nil {
+		first, _ := strconv.Atoi(m[1])
+		second, _ := strconv.Atoi(m[2])
+		y, _ := strconv.Atoi(m[3])
+		if y > 0 && y < 100 {
+			y += 2000
+		}
+		if first <= 12 && second <= 12 && first != second {
+			monthFirst, _, _ := calendarDay(text, y, time.Month(first), second, today)
+			dayFirst, _, _ := calendarDay(text, y, time.Month(second), first, today)
+			return time.Time{}, time.Time{}, &Error{
+				Text:        text,
+				Reason:      fmt.Sprintf("could mean %s or %s", monthFirst.Format("January 2"), dayFirst.Format("January 2")),
+				Suggestions: []string{monthFirst.Format("2006-01-02"), dayFirst.Format("2006-01-02")},
+			}
+		}
+		if first > 12 {
+			first, second = second, first // Day first
+		}
+		return calendarDay(text, y, time.Month(first), second, today)
+	}
+
+	return time.Time{}, time.Time{}, &Error{Text: text, Reason: "is not a date or time I understand", Suggestions: examples}
+}
+
+// calendarDay returns the midnight of the day of the month; without a year the next one to come
+func calendarDay(text string, year int, month time.Month, day int, today time.Time) (time.Time, time.Time, error) {
+	nextYear := year == 0
+	if nextYear {
+		year = today.Year()
+	}
+	if month < time.January || month > time.December {
+		return time.Time{}, time.Time{}, &Error{Text: text, Reason: fmt.Sprintf("has month %d, which doesn't exist", month), Suggestions: examples}
+	}
+	date := time.Date(year, month, day, 0, 0, 0, 0, today.Location())
+	if date.Day() != day {
+		return time.Time{}, time.Time{}, &Error{Text: text, Reason: fmt.Sprintf("has day %d, which %s doesn't have", day, month), Suggestions: examples}
+	}
+	if nextYear && date.Before(today) {
+		date = date.AddDate(1, 0, 0)
+	}
+	return date, time.Time{}, nil
+}
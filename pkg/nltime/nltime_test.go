@@ -0,0 +1,103 @@
+package nltime
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// amsterdam is summer time in Amsterdam, the zone of the user in the tests
+var amsterdam = time.FixedZone("CEST", 2*60*60)
+
+// now is Wednesday 1 May 2024, 10:00 in Amsterdam
+var now = time.Date(2024, 5, 1, 10, 0, 0, 0, amsterdam)
+
+func at(month time.Month, day, hour, minute int) time.Time {
+	return time.Date(2024, month, day, hour, minute, 0, 0, amsterdam)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		want time.Time
+	}{
+		{"2024-05-03T15:00:00Z", time.Date(2024, 5, 3, 15, 0, 0, 0, time.UTC)},
+		{"2024-05-03", at(time.May, 3, 0, 0)},
+		{"2024-05-03 14:30", at(time.May, 3, 14, 30)},
+		{"now", now},
+		{"today", at(time.May, 1, 0, 0)},
+		{"Tomorrow at 3pm", at(time.May, 2, 15, 0)},
+		{"tomorrow morning", at(time.May, 2, 9, 0)},
+		{"tomorrow evening at 8", at(time.May, 2, 20, 0)},
+		{"tonight", at(time.May, 1, 20, 0)},
+		{"at 9am", at(time.May, 2, 9, 0)}, // 9am today has passed
+		{"at 11:15", at(time.May, 1, 11, 15)},
+		{"noon", at(time.May, 1, 12, 0)},
+		{"friday", at(time.May, 3, 0, 0)},
+		{"next Tuesday at 3pm", at(time.May, 7, 15, 0)},
+		{"next wednesday", at(time.May, 8, 0, 0)},
+		{"this wednesday", at(time.May, 1, 0, 0)},
+		{"last monday", at(time.April, 29, 0, 0)},
+		{"due by Fri at 17:00", at(time.May, 3, 17, 0)},
+		{"friday at midnight", at(time.May, 3, 23, 59)},
+		{"next week", at(time.May, 6, 0, 0)},
+		{"next month", at(time.June, 1, 0, 0)},
+		{"in 2 hours", now.Add(2 * time.Hour)},
+		{"in a week", at(time.May, 8, 0, 0)},
+		{"3 days from now", at(time.May, 4, 0, 0)},
+		{"2 days ago", at(time.April, 29, 0, 0)},
+		{"May 3rd at 2:30 p.m.", at(time.May, 3, 14, 30)},
+		{"on the 5th of June", at(time.June, 5, 0, 0)},
+		{"march 5", time.Date(2025, 3, 5, 0, 0, 0, 0, amsterdam)}, // Passed this year
+		{"12/25", at(time.December, 25, 0, 0)},
+		{"25/12/2024", at(time.December, 25, 0, 0)},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.text, now)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.text, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParse_InLocationOfNow(t *testing.T) {
+	got, err := Parse("tomorrow at 3pm", now.In(time.UTC))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !got.Equal(time.Date(2024, 5, 2, 15, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected 3pm UTC, got %v", got)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		text        string
+		reason      string
+		suggestions []string
+	}{
+		{"tomorrow at 3", "could mean 3am or 3pm", []string{"3am", "3pm"}},
+		{"wednesday", "could mean today or wednesday next week", []string{"today", "next wednesday"}},
+		{"03/04", "could mean March 4 or April 3", []string{"2025-03-04", "2025-04-03"}},
+		{"february 30", "which February doesn't have", examples},
+		{"at 25:00", "is not a time", []string{"15:00", "3pm"}},
+		{"whenever", "not a date or time I understand", examples},
+		{"", "is empty", examples},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.text, now)
+		var parseErr *Error
+		if !errors.As(err, &parseErr) {
+			t.Errorf("Parse(%q): expected an *Error, got %v", tt.text, err)
+			continue
+		}
+		if !strings.Contains(parseErr.Reason, tt.reason) || strings.Join(parseErr.Suggestions, ",") != strings.Join(tt.suggestions, ",") {
+			t.Errorf("Parse(%q): unexpected error %v", tt.text, err)
+		}
+	}
+}
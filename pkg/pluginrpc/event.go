@@ -0,0 +1,98 @@
+package pluginrpc
+
+import (
+	"encoding/json"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"mindpalace/pkg/api/pluginv1"
+	"mindpalace/pkg/eventsourcing"
+)
+
+// toProto converts an event for the protocol
+func toProto(event eventsourcing.Event) (*pluginv1.Event, error) {
+	data, err := event.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := toStruct(json.RawMessage(data))
+	if err != nil {
+		return nil, err
+	}
+	delete(payload.Fields, "event_type")
+	metadata := event.Metadata()
+	return &pluginv1.Event{
+		Type:     event.Type(),
+		Sequence: metadata.Sequence,
+		Version:  metadata.Version,
+		UserId:   metadata.UserID,
+		Data:     payload,
+	}, nil
+}
+
+// fromProto converts an event of the protocol, to the Go type registered for its type if there is one
+func fromProto(event *pluginv1.Event) (eventsourcing.Event, error) {
+	converted := &eventsourcing.RawEvent{EventType: event.GetType(), Data: event.GetData().AsMap()}
+	data, err := converted.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if typed, err := eventsourcing.UnmarshalEvent(data); err == nil {
+		if _, raw := typed.(*eventsourcing.RawEvent); !raw {
+			setMetadata(typed, event)
+			return typed, nil
+		}
+	}
+	setMetadata(converted, event)
+	return converted, nil
+}
+
+func setMetadata(event eventsourcing.Event, from *pluginv1.Event) {
+	metadata := event.Metadata()
+	metadata.Sequence = from.GetSequence()
+	metadata.Version = from.GetVersion()
+	metadata.UserID = from.GetUserId()
+}
+
+// actionsToProto converts 3D actions for the protocol
+func actionsToProto(actions []eventsourcing.DeltaAction) ([]*structpb.Struct, error) {
+	converted := make([]*structpb.Struct, 0, len(actions))
+	for _, action := range actions {
+		payload, err := toStruct(action)
+		if err != nil {
+			return nil, err
+		}
+		converted = append(converted, payload)
+	}
+	return converted, nil
+}
+
+// actionsFromProto converts 3D actions of the protocol, skipping those that aren't valid
+func actionsFromProto(actions []*structpb.Struct) []eventsourcing.DeltaAction {
+	converted := make([]eventsourcing.DeltaAction, 0, len(actions))
+	for _, action := range actions {
+		data, err := action.MarshalJSON()
+		if err != nil {
+			continue
+		}
+		var delta eventsourcing.DeltaAction
+		if err := json.Unmarshal(data, &delta); err != nil || delta.Type == "" {
+			continue
+		}
+		converted = append(converted, delta)
+	}
+	return converted
+}
+
+// toStruct converts a value encoding to a JSON object, like a schema holding []string, for the protocol
+func toStruct(value any) (*structpb.Struct, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	payload := &structpb.Struct{}
+	if err := payload.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
@@ -0,0 +1,359 @@
+// Package pluginrpc runs plugins as processes of their own, talking to MindPalace over gRPC, so plugins
+// can be written in any language and upgraded without a restart. The protocol is defined in
+// api/mindpalace/plugin/v1/plugin.proto; its Go code is generated into pkg/api/pluginv1. Host runs a
+// plugin process for MindPalace, and Serve runs a Go plugin as one.
+package pluginrpc
+
+//go:generate protoc -I ../../api --go_out=../.. --go_opt=module=mindpalace --go-grpc_out=../.. --go-grpc_opt=module=mindpalace mindpalace/plugin/v1/plugin.proto
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"mindpalace/pkg/api/pluginv1"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// SocketEnv is the environment variable holding the path of the Unix socket a plugin process serves on
+const SocketEnv = "MINDPALACE_PLUGIN_SOCKET"
+
+// stopTimeout is how long a plugin process may take to exit once asked to
+const stopTimeout = 5 * time.Second
+
+// Host runs a plugin as a process of its own. It restarts the process when it exits or its command is
+// rebuilt, replaying the stored events into the new process.
+type Host struct {
+	name    string
+	command string
+	args    []string
+	env     []string
+
+	mu          sync.RWMutex
+	process     *process
+	conn        *grpc.ClientConn
+	plugin      pluginv1.PluginClient
+	described   *pluginv1.Description
+	owner       *Plugin
+	events      func() []eventsourcing.Event // Stored events, replayed into a restarted process
+	stopWatch   chan struct{}
+	stopWatched sync.Once
+}
+
+// process is a running plugin process
+type process struct {
+	cmd      *exec.Cmd
+	dir      string        // Directory of its socket
+	built    time.Time     // Modification time of the command it was started from
+	exited   chan struct{} // Closed once it exited
+	stopping bool          // Set when it is stopped on purpose
+}
+
+// Start starts the plugin's command, with env added to the environment, and describes the plugin.
+// The plugin must have the name it is started as.
+func Start(ctx context.Context, name, command string, args, env []string) (*Host, error) {
+	h := &Host{name: name, command: command, args: args, env: env, stopWatch: make(chan struct{})}
+	proc, conn, described, err := h.launch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	h.process, h.conn, h.plugin, h.described = proc, conn, pluginv1.NewPluginClient(conn), described
+	eventsourcing.RegisterRawEvents(described.GetEventTypes())
+	logging.Info("Started plugin %s: %s", name, command)
+	return h, nil
+}
+
+// Connect connects to a plugin served on a connection MindPalace did not start it on, such as a
+// plugin running on another machine, and describes the plugin. Such plugins aren't restarted.
+func Connect(ctx context.Context, name string, conn *grpc.ClientConn) (*Host, error) {
+	h := &Host{name: name, stopWatch: make(chan struct{})}
+	described, err := describe(ctx, name, pluginv1.NewPluginClient(conn))
+	if err != nil {
+		return nil, err
+	}
+	h.conn, h.plugin, h.described = conn, pluginv1.NewPluginClient(conn), described
+	eventsourcing.RegisterRawEvents(described.GetEventTypes())
+	return h, nil
+}
+
+// launch starts a process of the command and connects to it
+func (h *Host) launch(ctx context.Context) (*process, *grpc.ClientConn, *pluginv1.Description, error) {
+	path, err := exec.LookPath(h.command)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("plugin %s: %v", h.name, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("plugin %s: %v", h.name, err)
+	}
+	dir, err := os.MkdirTemp("", "mindpalace-plugin-")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	socket := filepath.Join(dir, "plugin.sock")
+	cmd := exec.Command(path, h.args...)
+	cmd.Env = append(append(os.Environ(), h.env...), SocketEnv+"="+socket)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, nil, fmt.Errorf("failed to start plugin %s: %v", h.name, err)
+	}
+	proc := &process{cmd: cmd, dir: dir, built: info.ModTime(), exited: make(chan struct{})}
+	go func() {
+		err := cmd.Wait()
+		h.mu.RLock()
+		stopping := proc.stopping
+		h.mu.RUnlock()
+		if !stopping {
+			logging.Error("Plugin %s exited: %v", h.name, err)
+		}
+		close(proc.exited)
+	}()
+
+	conn, err := grpc.NewClient("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		h.stopProcess(proc)
+		return nil, nil, nil, err
+	}
+	// Wait for the process to serve, unless it exits first
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-proc.exited:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	described, err := describe(ctx, h.name, pluginv1.NewPluginClient(conn))
+	if err != nil {
+		conn.Close()
+		h.stopProcess(proc)
+		return nil, nil, nil, err
+	}
+	return proc, conn, described, nil
+}
+
+// describe asks the plugin what it offers once it serves
+func describe(ctx context.Context, name string, client pluginv1.PluginClient) (*pluginv1.Description, error) {
+	described, err := client.Describe(ctx, &pluginv1.DescribeRequest{}, grpc.WaitForReady(true))
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s did not describe itself: %s", name, status.Convert(err).Message())
+	}
+	if described.GetName() != name {
+		return nil, fmt.Errorf("plugin %s describes itself as %q", name, described.GetName())
+	}
+	for _, eventType := range described.GetEventTypes() {
+		if !strings.HasPrefix(eventType, name+"_") {
+			return nil, fmt.Errorf("plugin %s emits %s, events of plugins start with their name", name, eventType)
+		}
+	}
+	return described, nil
+}
+
+// Plugin returns the owner's instance of the plugin
+func (h *Host) Plugin() *Plugin {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.owner == nil {
+		h.owner = h.newInstance()
+	}
+	return h.owner
+}
+
+// NewPlugin creates an instance of the plugin for a household member, see eventsourcing.UserAware
+func (h *Host) NewPlugin() eventsourcing.Plugin {
+	return h.newInstance()
+}
+
+func (h *Host) newInstance() *Plugin {
+	p := &Plugin{host: h}
+	p.aggregate = &aggregate{plugin: p}
+	return p
+}
+
+// SetEventSource gives the host the stored events, which are replayed into restarted processes
+func (h *Host) SetEventSource(events func() []eventsourcing.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = events
+}
+
+func (h *Host) description() *pluginv1.Description {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.described
+}
+
+func (h *Host) client() pluginv1.PluginClient {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.plugin
+}
+
+// subscribes reports whether the plugin applies events of the type
+func (h *Host) subscribes(eventType string) bool {
+	return subscribes(h.description(), eventType)
+}
+
+// subscribes reports whether the plugin described applies events of the type
+func subscribes(described *pluginv1.Description, eventType string) bool {
+	subscriptions := described.GetSubscriptions()
+	if len(subscriptions) == 0 {
+		return strings.HasPrefix(eventType, described.GetName()+"_")
+	}
+	for _, pattern := range subscriptions {
+		if prefix, wildcard := strings.CutSuffix(pattern, "*"); wildcard && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+		if pattern == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Restart replaces the process with a new one of the command, rebuilt or not, which applies the
+// stored events before it takes over
+func (h *Host) Restart(ctx context.Context) error {
+	if h.command == "" {
+		return fmt.Errorf("plugin %s was not started by MindPalace and can't be restarted", h.name)
+	}
+	proc, conn, described, err := h.launch(ctx)
+	if err != nil {
+		return err
+	}
+	client := pluginv1.NewPluginClient(conn)
+	eventsourcing.RegisterRawEvents(described.GetEventTypes())
+
+	// Events are applied under the lock, so none is applied to the old process meanwhile
+	h.mu.Lock()
+	events := h.events
+	old, oldConn := h.process, h.conn
+	previous := h.described
+	replayed := 0
+	if events != nil {
+		for _, event := range events() {
+			if !subscribes(described, event.Type()) {
+				continue
+			}
+			converted, err := toProto(event)
+			if err == nil {
+				_, err = client.ApplyEvent(ctx, &pluginv1.ApplyEventRequest{Event: converted})
+			}
+			if err != nil {
+				h.mu.Unlock()
+				conn.Close()
+				h.stopProcess(proc)
+				return fmt.Errorf("plugin %s failed to replay %s: %s", h.name, event.Type(), status.Convert(err).Message())
+			}
+			replayed++
+		}
+	}
+	h.process, h.conn, h.plugin, h.described = proc, conn, client, described
+	h.mu.Unlock()
+
+	for command := range described.GetSchemas() {
+		if _, existed := previous.GetSchemas()[command]; !existed {
+			logging.Info("Plugin %s offers the new command %s to its agent, and to the APIs from the next start", h.name, command)
+		}
+	}
+	if oldConn != nil {
+		oldConn.Close()
+	}
+	if old != nil {
+		h.stopProcess(old)
+	}
+	logging.Info("Restarted plugin %s, replaying %d events", h.name, replayed)
+	return nil
+}
+
+// Watch restarts the process every interval it exited or its command was rebuilt, until Close
+func (h *Host) Watch(interval time.Duration) {
+	if h.command == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-h.stopWatch:
+				return
+			case <-ticker.C:
+				if reason := h.restartReason(); reason != "" {
+					logging.Info("Restarting plugin %s: %s", h.name, reason)
+					ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+					if err := h.Restart(ctx); err != nil {
+						logging.Error("Failed to restart plugin %s: %v", h.name, err)
+					}
+					cancel()
+				}
+			}
+		}
+	}()
+}
+
+// restartReason returns why the process must be restarted, empty if it mustn't
+func (h *Host) restartReason() string {
+	h.mu.RLock()
+	proc := h.process
+	h.mu.RUnlock()
+	if proc == nil {
+		return ""
+	}
+	select {
+	case <-proc.exited:
+		return "it exited"
+	default:
+	}
+	path, err := exec.LookPath(h.command)
+	if err != nil {
+		return ""
+	}
+	if info, err := os.Stat(path); err == nil && info.ModTime().After(proc.built) {
+		return "its command was rebuilt"
+	}
+	return ""
+}
+
+// stopProcess asks the process to exit, killing it if it doesn't in time
+func (h *Host) stopProcess(proc *process) {
+	h.mu.Lock()
+	proc.stopping = true
+	h.mu.Unlock()
+	proc.cmd.Process.Signal(os.Interrupt)
+	select {
+	case <-proc.exited:
+	case <-time.After(stopTimeout):
+		proc.cmd.Process.Kill()
+		<-proc.exited
+	}
+	os.RemoveAll(proc.dir)
+}
+
+// Close stops watching and the process
+func (h *Host) Close(ctx context.Context) error {
+	h.stopWatched.Do(func() { close(h.stopWatch) })
+	h.mu.Lock()
+	proc, conn := h.process, h.conn
+	h.process = nil
+	h.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+	if proc != nil {
+		h.stopProcess(proc)
+	}
+	return nil
+}
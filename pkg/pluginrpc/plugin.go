@@ -0,0 +1,197 @@
+package pluginrpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"mindpalace/pkg/api/pluginv1"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// callTimeout is how long a call to a plugin process may take
+const callTimeout = 30 * time.Second
+
+// Plugin is an instance of a plugin running as a process of its own, see Host. The process keeps the
+// state of all instances, each of the owner or a household member.
+type Plugin struct {
+	host      *Host
+	userID    string
+	aggregate *aggregate
+}
+
+// SetUser makes the instance that of a household member, see eventsourcing.UserAware
+func (p *Plugin) SetUser(userID string) {
+	p.userID = userID
+}
+
+func (p *Plugin) Name() string {
+	return p.host.name
+}
+
+func (p *Plugin) Type() eventsourcing.PluginType {
+	if p.host.description().GetType() == string(eventsourcing.SystemPlugin) {
+		return eventsourcing.SystemPlugin
+	}
+	return eventsourcing.LLMPlugin
+}
+
+func (p *Plugin) SystemPrompt() string {
+	return p.host.description().GetSystemPrompt()
+}
+
+func (p *Plugin) AgentModel() string {
+	return p.host.description().GetAgentModel()
+}
+
+// Schemas returns the input schemas of the commands, as the running process describes them
+func (p *Plugin) Schemas() map[string]eventsourcing.CommandInput {
+	schemas := make(map[string]eventsourcing.CommandInput)
+	for command, schema := range p.host.description().GetSchemas() {
+		schemas[command] = input{schema: schema.AsMap()}
+	}
+	return schemas
+}
+
+// Commands returns the commands the process executes
+func (p *Plugin) Commands() map[string]eventsourcing.CommandHandler {
+	commands := make(map[string]eventsourcing.CommandHandler)
+	for command := range p.host.description().GetSchemas() {
+		commands[command] = remoteCommand{plugin: p, name: command}
+	}
+	return commands
+}
+
+// Manifest returns the manifest the process describes, see eventsourcing.Manifester
+func (p *Plugin) Manifest() eventsourcing.Manifest {
+	described := p.host.description().GetManifest()
+	manifest := eventsourcing.Manifest{Version: described.GetVersion(), Capabilities: described.GetCapabilities()}
+	for _, dependency := range described.GetRequires() {
+		manifest.Requires = append(manifest.Requires, eventsourcing.Dependency{Plugin: dependency.GetPlugin(), MinVersion: dependency.GetMinVersion()})
+	}
+	return manifest
+}
+
+func (p *Plugin) Aggregate() eventsourcing.Aggregate {
+	return p.aggregate
+}
+
+// input is the input of a command, decoded as a map and checked by the process
+type input struct {
+	schema map[string]interface{}
+}
+
+func (i input) New() any                       { return &map[string]interface{}{} }
+func (i input) Schema() map[string]interface{} { return i.schema }
+
+// remoteCommand executes a command in the process
+type remoteCommand struct {
+	plugin *Plugin
+	name   string
+}
+
+func (c remoteCommand) Execute(data any) ([]eventsourcing.Event, error) {
+	payload, err := toStruct(data)
+	if err != nil {
+		return nil, fmt.Errorf("the input of %s must be an object: %v", c.name, err)
+	}
+	delete(payload.Fields, "userID") // The process is told the user of the instance
+
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	response, err := c.plugin.host.client().ExecuteCommand(ctx, &pluginv1.ExecuteCommandRequest{
+		Command: c.name,
+		Input:   payload,
+		UserId:  c.plugin.userID,
+	})
+	if err != nil {
+		// The command may pass when executed again if the process or the command was unavailable
+		if code := status.Code(err); code == codes.Unavailable || code == codes.DeadlineExceeded {
+			return nil, eventsourcing.MarkRetriable(fmt.Errorf("%s", status.Convert(err).Message()))
+		}
+		return nil, fmt.Errorf("%s", status.Convert(err).Message())
+	}
+	events := make([]eventsourcing.Event, 0, len(response.GetEvents()))
+	for _, event := range response.GetEvents() {
+		if !strings.HasPrefix(event.GetType(), c.plugin.Name()+"_") {
+			return nil, fmt.Errorf("plugin %s emitted %s, events of plugins start with their name", c.plugin.Name(), event.GetType())
+		}
+		converted, err := fromProto(event)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event %s: %v", event.GetType(), err)
+		}
+		events = append(events, converted)
+	}
+	return events, nil
+}
+
+// aggregate forwards the events an instance applies to the process, which keeps its state
+type aggregate struct {
+	plugin *Plugin
+	mu     sync.Mutex
+	last   eventsourcing.Event         // Event applied last, whose 3D actions are broadcast next
+	deltas []eventsourcing.DeltaAction // 3D actions the last event caused
+}
+
+func (a *aggregate) ID() string {
+	return a.plugin.Name()
+}
+
+func (a *aggregate) GetCustomUI() fyne.CanvasObject {
+	return nil
+}
+
+// ApplyEvent has the process apply the events it subscribes to
+func (a *aggregate) ApplyEvent(event eventsourcing.Event) error {
+	if !a.plugin.host.subscribes(event.Type()) {
+		return nil
+	}
+	converted, err := toProto(event)
+	if err != nil {
+		return err
+	}
+	if converted.UserId == "" {
+		converted.UserId = a.plugin.userID
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	response, err := a.plugin.host.client().ApplyEvent(ctx, &pluginv1.ApplyEventRequest{Event: converted})
+	if err != nil {
+		return fmt.Errorf("plugin %s failed to apply %s: %s", a.plugin.Name(), event.Type(), status.Convert(err).Message())
+	}
+	a.mu.Lock()
+	a.last, a.deltas = event, actionsFromProto(response.GetActions())
+	a.mu.Unlock()
+	return nil
+}
+
+// Broadcast3DDelta returns the 3D actions the process returned applying the event
+func (a *aggregate) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.last != event {
+		return nil
+	}
+	deltas := a.deltas
+	a.last, a.deltas = nil, nil
+	return deltas
+}
+
+// GetFull3DState asks the process for the whole scene of the instance's user
+func (a *aggregate) GetFull3DState() []eventsourcing.DeltaAction {
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	response, err := a.plugin.host.client().GetFullState(ctx, &pluginv1.GetFullStateRequest{UserId: a.plugin.userID})
+	if err != nil {
+		logging.Error("Plugin %s failed to return its 3D state: %s", a.plugin.Name(), status.Convert(err).Message())
+		return nil
+	}
+	return actionsFromProto(response.GetActions())
+}
@@ -0,0 +1,260 @@
+package pluginrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"mindpalace/pkg/api/pluginv1"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/eventsourcing/eventsourcingtest"
+)
+
+// The test binary is the process of the counter plugin when started by a Host
+func TestMain(m *testing.M) {
+	if os.Getenv(SocketEnv) != "" {
+		if err := Serve(newCounter); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+type IncrementedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	By        int    `json:"by"`
+}
+
+func (e *IncrementedEvent) Type() string { return "counter_Incremented" }
+func (e *IncrementedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *IncrementedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func init() {
+	eventsourcing.RegisterEvent("counter_Incremented", func() eventsourcing.Event { return &IncrementedEvent{} })
+}
+
+type IncrementInput struct {
+	By int `json:"By"`
+}
+
+func (i *IncrementInput) New() any { return &IncrementInput{} }
+func (i *IncrementInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"By": map[string]interface{}{"type": "integer"}},
+		"required":   []string{"By"},
+	}
+}
+
+// counter is a plugin counting the increments of its user
+type counter struct {
+	mu     sync.Mutex
+	userID string
+	count  int
+}
+
+func newCounter() eventsourcing.Plugin { return &counter{} }
+
+func (c *counter) Name() string                   { return "counter" }
+func (c *counter) Type() eventsourcing.PluginType { return eventsourcing.LLMPlugin }
+func (c *counter) SystemPrompt() string           { return "You count." }
+func (c *counter) AgentModel() string             { return "" }
+func (c *counter) Aggregate() eventsourcing.Aggregate {
+	return c
+}
+func (c *counter) SetUser(userID string) { c.userID = userID }
+func (c *counter) Manifest() eventsourcing.Manifest {
+	return eventsourcing.Manifest{Version: "1.1.0", Capabilities: []string{eventsourcing.CapabilityNetwork}}
+}
+func (c *counter) Schemas() map[string]eventsourcing.CommandInput {
+	return map[string]eventsourcing.CommandInput{"Increment": &IncrementInput{}}
+}
+func (c *counter) Commands() map[string]eventsourcing.CommandHandler {
+	return map[string]eventsourcing.CommandHandler{
+		"Increment": eventsourcing.NewCommand(func(input *IncrementInput) ([]eventsourcing.Event, error) {
+			if input.By <= 0 {
+				return nil, fmt.Errorf("By must be positive")
+			}
+			if input.By > 100 {
+				return nil, eventsourcing.MarkRetriable(fmt.Errorf("counter is busy"))
+			}
+			return []eventsourcing.Event{&IncrementedEvent{By: input.By}}, nil
+		}),
+	}
+}
+
+func (c *counter) ID() string                     { return "counter" }
+func (c *counter) GetCustomUI() fyne.CanvasObject { return nil }
+func (c *counter) ApplyEvent(event eventsourcing.Event) error {
+	if e, ok := event.(*IncrementedEvent); ok {
+		c.mu.Lock()
+		c.count += e.By
+		c.mu.Unlock()
+	}
+	return nil
+}
+func (c *counter) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
+	return c.GetFull3DState()
+}
+func (c *counter) GetFull3DState() []eventsourcing.DeltaAction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return []eventsourcing.DeltaAction{{Type: "update", NodeID: "counter_" + c.userID, Properties: map[string]interface{}{"count": c.count}}}
+}
+
+// countOf returns the count of the instance's user the process shows in 3D
+func countOf(t *testing.T, plugin eventsourcing.Plugin) float64 {
+	t.Helper()
+	actions := plugin.Aggregate().(eventsourcing.ThreeDUIBroadcaster).GetFull3DState()
+	if len(actions) != 1 {
+		t.Fatalf("Expected one action, got %v", actions)
+	}
+	count, _ := actions[0].Properties["count"].(float64)
+	return count
+}
+
+func TestHost_Connect(t *testing.T) {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pluginv1.RegisterPluginServer(server, NewServer(newCounter))
+	go server.Serve(listener)
+	defer server.Stop()
+	conn, err := grpc.NewClient("passthrough:///counter",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := Connect(ctx, "calendar", conn); err == nil {
+		t.Error("Expected a plugin describing itself by another name to be refused")
+	}
+	host, err := Connect(ctx, "counter", conn)
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer host.Close(ctx)
+
+	owner := host.Plugin()
+	if owner.SystemPrompt() != "You count." || owner.Manifest().Version != "1.1.0" || owner.Manifest().Capabilities[0] != eventsourcing.CapabilityNetwork {
+		t.Errorf("Unexpected description: %q, %+v", owner.SystemPrompt(), owner.Manifest())
+	}
+	schema := owner.Schemas()["Increment"].Schema()
+	if required, _ := schema["required"].([]interface{}); len(required) != 1 || required[0] != "By" {
+		t.Errorf("Expected the schema of Increment, got %v", schema)
+	}
+
+	// Commands given the map the orchestrator decodes arguments into
+	input := owner.Schemas()["Increment"].New().(*map[string]interface{})
+	(*input)["By"] = 2
+	events, err := owner.Commands()["Increment"].Execute(input)
+	if err != nil {
+		t.Fatalf("Increment failed: %v", err)
+	}
+	if incremented, ok := events[0].(*IncrementedEvent); len(events) != 1 || !ok || incremented.By != 2 {
+		t.Fatalf("Expected counter_Incremented by 2, got %v", events)
+	}
+	if _, err := owner.Commands()["Increment"].Execute(map[string]interface{}{"By": -1}); err == nil || err.Error() != "By must be positive" {
+		t.Errorf("Expected the error of the command, got %v", err)
+	} else if eventsourcing.IsRetriable(err) {
+		t.Errorf("Expected an invalid input not retriable")
+	}
+	if _, err := owner.Commands()["Increment"].Execute(map[string]interface{}{"By": 101}); err == nil || !eventsourcing.IsRetriable(err) {
+		t.Errorf("Expected the retriable error of the command, got %v", err)
+	}
+	eventsourcingtest.Apply(t, owner.Aggregate(), "", events...)
+	if deltas := owner.Aggregate().(eventsourcing.ThreeDUIBroadcaster).Broadcast3DDelta(events[0]); len(deltas) != 1 || deltas[0].NodeID != "counter_" {
+		t.Errorf("Expected the 3D action of the increment, got %v", deltas)
+	}
+
+	// A household member's instance counts apart
+	bob := host.NewPlugin()
+	bob.(eventsourcing.UserAware).SetUser("bob")
+	events, err = bob.Commands()["Increment"].Execute(map[string]interface{}{"By": 5, "userID": "bob"})
+	if err != nil {
+		t.Fatalf("Increment failed: %v", err)
+	}
+	eventsourcingtest.Apply(t, bob.Aggregate(), "bob", events...)
+	if countOf(t, owner) != 2 || countOf(t, bob) != 5 {
+		t.Errorf("Expected counts 2 and 5, got %v and %v", countOf(t, owner), countOf(t, bob))
+	}
+	if err := host.Restart(ctx); err == nil {
+		t.Error("Expected a connected plugin not to be restarted")
+	}
+}
+
+func TestHost_Restart(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts processes")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Executable failed: %v", err)
+	}
+	host, err := Start(ctx, "counter", executable, []string{"-test.run=^$"}, nil)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer host.Close(ctx)
+
+	owner := host.Plugin()
+	var stored []eventsourcing.Event
+	for _, by := range []int{1, 2, 3} {
+		events, err := owner.Commands()["Increment"].Execute(map[string]interface{}{"By": by})
+		if err != nil {
+			t.Fatalf("Increment failed: %v", err)
+		}
+		eventsourcingtest.Apply(t, owner.Aggregate(), "", events...)
+		stored = append(stored, events...)
+	}
+	host.SetEventSource(func() []eventsourcing.Event { return stored })
+	if reason := host.restartReason(); reason != "" {
+		t.Errorf("Expected no reason to restart, got %q", reason)
+	}
+
+	// A rebuilt command is restarted, and the new process replays the stored events
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(executable, later, later); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	if reason := host.restartReason(); reason != "its command was rebuilt" {
+		t.Errorf("Expected a restart for the rebuilt command, got %q", reason)
+	}
+	host.mu.RLock()
+	old := host.process
+	host.mu.RUnlock()
+	if err := host.Restart(ctx); err != nil {
+		t.Fatalf("Restart failed: %v", err)
+	}
+	select {
+	case <-old.exited:
+	default:
+		t.Error("Expected the old process to be stopped")
+	}
+	if count := countOf(t, owner); count != 6 {
+		t.Errorf("Expected the count replayed to 6, got %v", count)
+	}
+	if reason := host.restartReason(); reason != "" {
+		t.Errorf("Expected no reason to restart the new process, got %q", reason)
+	}
+}
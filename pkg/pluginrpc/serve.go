@@ -0,0 +1,181 @@
+package pluginrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"mindpalace/pkg/api/pluginv1"
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Server serves a Go plugin over the protocol, with an instance of the plugin per user like
+// MindPalace keeps in-process plugins. Commands without a schema are not served.
+type Server struct {
+	pluginv1.UnimplementedPluginServer
+	newPlugin     func() eventsourcing.Plugin
+	subscriptions []string
+	mu            sync.Mutex
+	instances     map[string]eventsourcing.Plugin // User -> the user's instance, the owner's under ""
+}
+
+// NewServer creates a server of the plugins NewPlugin creates, applying the events of the
+// subscriptions, like "taskmanager_*", besides the plugin's own
+func NewServer(newPlugin func() eventsourcing.Plugin, subscriptions ...string) *Server {
+	return &Server{newPlugin: newPlugin, subscriptions: subscriptions, instances: make(map[string]eventsourcing.Plugin)}
+}
+
+// Serve serves the plugins NewPlugin creates on the socket MindPalace started the process with, until
+// the process is interrupted. Call it from the main function of the plugin's command.
+func Serve(newPlugin func() eventsourcing.Plugin, subscriptions ...string) error {
+	socket := os.Getenv(SocketEnv)
+	if socket == "" {
+		return fmt.Errorf("%s is not set, plugins are started by MindPalace", SocketEnv)
+	}
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer()
+	pluginv1.RegisterPluginServer(server, NewServer(newPlugin, subscriptions...))
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		server.GracefulStop()
+	}()
+	return server.Serve(listener)
+}
+
+// instance returns the user's instance of the plugin, creating it the first time
+func (s *Server) instance(userID string) eventsourcing.Plugin {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if plugin, exists := s.instances[userID]; exists {
+		return plugin
+	}
+	plugin := s.newPlugin()
+	if aware, ok := plugin.(eventsourcing.UserAware); ok && userID != "" {
+		aware.SetUser(userID)
+	}
+	s.instances[userID] = plugin
+	return plugin
+}
+
+func (s *Server) Describe(ctx context.Context, req *pluginv1.DescribeRequest) (*pluginv1.Description, error) {
+	plugin := s.instance("")
+	described := &pluginv1.Description{
+		Name:         plugin.Name(),
+		Type:         string(plugin.Type()),
+		SystemPrompt: plugin.SystemPrompt(),
+		AgentModel:   plugin.AgentModel(),
+	}
+	for command, input := range plugin.Schemas() {
+		if _, exists := plugin.Commands()[command]; !exists || input.Schema() == nil {
+			continue
+		}
+		schema, err := toStruct(input.Schema())
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "invalid schema of %s: %v", command, err)
+		}
+		if described.Schemas == nil {
+			described.Schemas = make(map[string]*structpb.Struct)
+		}
+		described.Schemas[command] = schema
+	}
+	for _, eventType := range eventsourcing.RegisteredEventTypes() {
+		if strings.HasPrefix(eventType, plugin.Name()+"_") {
+			described.EventTypes = append(described.EventTypes, eventType)
+		}
+	}
+	if len(s.subscriptions) > 0 {
+		described.Subscriptions = append([]string{plugin.Name() + "_*"}, s.subscriptions...)
+	}
+	if manifester, ok := plugin.(eventsourcing.Manifester); ok {
+		manifest := manifester.Manifest()
+		described.Manifest = &pluginv1.Manifest{Version: manifest.Version, Capabilities: manifest.Capabilities}
+		for _, dependency := range manifest.Requires {
+			described.Manifest.Requires = append(described.Manifest.Requires, &pluginv1.Dependency{Plugin: dependency.Plugin, MinVersion: dependency.MinVersion})
+		}
+	}
+	return described, nil
+}
+
+func (s *Server) ExecuteCommand(ctx context.Context, req *pluginv1.ExecuteCommandRequest) (*pluginv1.ExecuteCommandResponse, error) {
+	plugin := s.instance(req.GetUserId())
+	handler, exists := plugin.Commands()[req.GetCommand()]
+	schema, hasSchema := plugin.Schemas()[req.GetCommand()]
+	if !exists || !hasSchema {
+		return nil, status.Errorf(codes.NotFound, "plugin %s has no command %s", plugin.Name(), req.GetCommand())
+	}
+	data := []byte("{}")
+	if req.GetInput() != nil {
+		var err error
+		if data, err = req.GetInput().MarshalJSON(); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid input: %v", err)
+		}
+	}
+	input := schema.New()
+	if err := json.Unmarshal(data, input); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid input of %s: %v", req.GetCommand(), err)
+	}
+	events, err := handler.Execute(input)
+	if err != nil {
+		if eventsourcing.IsRetriable(err) {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	response := &pluginv1.ExecuteCommandResponse{}
+	for _, event := range events {
+		converted, err := toProto(event)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to encode %s: %v", event.Type(), err)
+		}
+		response.Events = append(response.Events, converted)
+	}
+	return response, nil
+}
+
+func (s *Server) ApplyEvent(ctx context.Context, req *pluginv1.ApplyEventRequest) (*pluginv1.ApplyEventResponse, error) {
+	event, err := fromProto(req.GetEvent())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid event: %v", err)
+	}
+	aggregate := s.instance(req.GetEvent().GetUserId()).Aggregate()
+	if err := aggregate.ApplyEvent(event); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "failed to apply %s: %v", event.Type(), err)
+	}
+	response := &pluginv1.ApplyEventResponse{}
+	if broadcaster, ok := aggregate.(eventsourcing.ThreeDUIBroadcaster); ok {
+		if response.Actions, err = actionsToProto(broadcaster.Broadcast3DDelta(event)); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to encode the 3D actions of %s: %v", event.Type(), err)
+		}
+	}
+	return response, nil
+}
+
+func (s *Server) GetFullState(ctx context.Context, req *pluginv1.GetFullStateRequest) (*pluginv1.GetFullStateResponse, error) {
+	response := &pluginv1.GetFullStateResponse{}
+	broadcaster, ok := s.instance(req.GetUserId()).Aggregate().(eventsourcing.ThreeDUIBroadcaster)
+	if !ok {
+		return response, nil
+	}
+	actions, err := actionsToProto(broadcaster.GetFull3DState())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode the 3D state: %v", err)
+	}
+	response.Actions = actions
+	return response, nil
+}
@@ -0,0 +1,42 @@
+// Package guest runs a Go plugin inside the WASM sandbox of package pluginwasm. Call Serve from an init
+// function of the plugin's main package, compiled with GOOS=wasip1 GOARCH=wasm -buildmode=c-shared.
+//
+// The sandbox calls the exports mindpalace_describe, mindpalace_execute and mindpalace_render, which
+// return 0 on success. They talk to MindPalace only through the functions it exports to the module
+// "mindpalace":
+//
+//	request(ptr, cap uint32) uint32                  copies the Call being handled, returns its length
+//	read_state(index, ptr, cap uint32) int32         copies the index-th event of the user, -1 past the last
+//	emit_event(ptr, len uint32)                      emits an event of the command being executed
+//	respond(ptr, len uint32)                         returns the JSON result of the call
+//	fail(ptr, len uint32)                            fails the call with a message
+//	log(ptr, len uint32)                             logs a debug message
+//
+// Both copying functions copy nothing when cap is too small, so they are called with 0 first.
+package guest
+
+import (
+	"encoding/json"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// Description is what a plugin offers, returned by mindpalace_describe
+type Description struct {
+	Name         string                            `json:"name"`
+	Type         string                            `json:"type"`
+	SystemPrompt string                            `json:"system_prompt"`
+	AgentModel   string                            `json:"agent_model"`
+	Schemas      map[string]map[string]interface{} `json:"schemas"`     // JSON schema of the input of each command
+	EventTypes   []string                          `json:"event_types"` // Types of the events the plugin emits, starting with its name
+	Transient    []string                          `json:"transient"`   // Those of the event types never stored, see eventsourcing.RegisterTransientEvent
+	Manifest     eventsourcing.Manifest            `json:"manifest"`
+}
+
+// Call is what mindpalace_execute and mindpalace_render are called with, read with request
+type Call struct {
+	UserID  string          `json:"user_id"`           // User whose instance of the plugin handles the call
+	Command string          `json:"command,omitempty"` // Command mindpalace_execute executes
+	Input   json.RawMessage `json:"input,omitempty"`   // Input of the command
+	Event   json.RawMessage `json:"event,omitempty"`   // Event mindpalace_render returns the 3D actions of, the whole scene if empty
+}
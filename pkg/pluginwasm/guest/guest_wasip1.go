@@ -0,0 +1,195 @@
+package guest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+//go:wasmimport mindpalace request
+func request(ptr unsafe.Pointer, capacity uint32) uint32
+
+//go:wasmimport mindpalace read_state
+func readState(index uint32, ptr unsafe.Pointer, capacity uint32) int32
+
+//go:wasmimport mindpalace emit_event
+func emitEvent(ptr unsafe.Pointer, size uint32)
+
+//go:wasmimport mindpalace respond
+func respond(ptr unsafe.Pointer, size uint32)
+
+//go:wasmimport mindpalace fail
+func fail(ptr unsafe.Pointer, size uint32)
+
+//go:wasmimport mindpalace log
+func log(ptr unsafe.Pointer, size uint32)
+
+// newPlugin creates the instances of the plugin served, nil before Serve
+var newPlugin func() eventsourcing.Plugin
+
+// Serve serves the plugins NewPlugin creates to the sandbox. Every call gets a new instance of the
+// plugin, which applies the events of the call's user before handling it.
+func Serve(np func() eventsourcing.Plugin) {
+	newPlugin = np
+}
+
+// Logf logs a debug message through MindPalace, the sandbox has no other output
+func Logf(format string, args ...any) {
+	message := []byte(fmt.Sprintf(format, args...))
+	log(pointer(message), uint32(len(message)))
+}
+
+func pointer(data []byte) unsafe.Pointer {
+	return unsafe.Pointer(unsafe.SliceData(data))
+}
+
+//go:wasmexport mindpalace_describe
+func describe() int32 {
+	return handle(func() error {
+		plugin := newPlugin()
+		described := Description{
+			Name:         plugin.Name(),
+			Type:         string(plugin.Type()),
+			SystemPrompt: plugin.SystemPrompt(),
+			AgentModel:   plugin.AgentModel(),
+			Schemas:      make(map[string]map[string]interface{}),
+		}
+		for command, input := range plugin.Schemas() {
+			if _, exists := plugin.Commands()[command]; exists && input.Schema() != nil {
+				described.Schemas[command] = input.Schema()
+			}
+		}
+		for _, eventType := range eventsourcing.RegisteredEventTypes() {
+			if !strings.HasPrefix(eventType, plugin.Name()+"_") {
+				continue
+			}
+			described.EventTypes = append(described.EventTypes, eventType)
+			if eventsourcing.IsTransient(&eventsourcing.RawEvent{EventType: eventType}) {
+				described.Transient = append(described.Transient, eventType)
+			}
+		}
+		if manifester, ok := plugin.(eventsourcing.Manifester); ok {
+			described.Manifest = manifester.Manifest()
+		}
+		return respondJSON(described)
+	})
+}
+
+//go:wasmexport mindpalace_execute
+func execute() int32 {
+	return handle(func() error {
+		call, plugin, err := begin()
+		if err != nil {
+			return err
+		}
+		handler, exists := plugin.Commands()[call.Command]
+		schema, hasSchema := plugin.Schemas()[call.Command]
+		if !exists || !hasSchema {
+			return fmt.Errorf("plugin %s has no command %s", plugin.Name(), call.Command)
+		}
+		input := schema.New()
+		if len(call.Input) > 0 {
+			if err := json.Unmarshal(call.Input, input); err != nil {
+				return fmt.Errorf("invalid input of %s: %v", call.Command, err)
+			}
+		}
+		events, err := handler.Execute(input)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			data, err := event.Marshal()
+			if err != nil {
+				return fmt.Errorf("failed to encode %s: %v", event.Type(), err)
+			}
+			emitEvent(pointer(data), uint32(len(data)))
+		}
+		return nil
+	})
+}
+
+//go:wasmexport mindpalace_render
+func render() int32 {
+	return handle(func() error {
+		call, plugin, err := begin()
+		if err != nil {
+			return err
+		}
+		broadcaster, ok := plugin.Aggregate().(eventsourcing.ThreeDUIBroadcaster)
+		if !ok {
+			return respondJSON([]eventsourcing.DeltaAction{})
+		}
+		if len(call.Event) == 0 {
+			return respondJSON(broadcaster.GetFull3DState())
+		}
+		event, err := eventsourcing.UnmarshalEvent(call.Event)
+		if err != nil {
+			return err
+		}
+		event.Metadata().UserID = call.UserID
+		return respondJSON(broadcaster.Broadcast3DDelta(event))
+	})
+}
+
+// handle runs an export, failing the call with the error or panic of the plugin
+func handle(run func() error) (status int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			message := []byte(fmt.Sprintf("panic: %v", r))
+			fail(pointer(message), uint32(len(message)))
+			status = 1
+		}
+	}()
+	if newPlugin == nil {
+		run = func() error { return fmt.Errorf("the module does not serve a plugin, call guest.Serve") }
+	}
+	if err := run(); err != nil {
+		message := []byte(err.Error())
+		fail(pointer(message), uint32(len(message)))
+		return 1
+	}
+	return 0
+}
+
+// begin reads the call and creates the instance of its user, which applies the user's events
+func begin() (Call, eventsourcing.Plugin, error) {
+	var call Call
+	data := make([]byte, request(nil, 0))
+	request(pointer(data), uint32(len(data)))
+	if err := json.Unmarshal(data, &call); err != nil {
+		return call, nil, fmt.Errorf("invalid call: %v", err)
+	}
+	plugin := newPlugin()
+	if aware, ok := plugin.(eventsourcing.UserAware); ok && call.UserID != "" {
+		aware.SetUser(call.UserID)
+	}
+	for index := uint32(0); ; index++ {
+		size := readState(index, nil, 0)
+		if size < 0 {
+			break
+		}
+		data := make([]byte, size)
+		readState(index, pointer(data), uint32(size))
+		event, err := eventsourcing.UnmarshalEvent(data)
+		if err != nil {
+			return call, nil, fmt.Errorf("invalid stored event: %v", err)
+		}
+		event.Metadata().UserID = call.UserID
+		if err := plugin.Aggregate().ApplyEvent(event); err != nil {
+			return call, nil, fmt.Errorf("failed to apply %s: %v", event.Type(), err)
+		}
+	}
+	return call, plugin, nil
+}
+
+func respondJSON(value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	respond(pointer(data), uint32(len(data)))
+	return nil
+}
@@ -0,0 +1,202 @@
+package pluginwasm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+	"mindpalace/pkg/pluginwasm/guest"
+)
+
+// Plugin is an instance of a sandboxed plugin, see Sandbox. It keeps the events of its user, which
+// the module reads to rebuild the state of every call.
+type Plugin struct {
+	sandbox   *Sandbox
+	userID    string
+	aggregate *aggregate
+}
+
+// SetUser makes the instance that of a household member, see eventsourcing.UserAware
+func (p *Plugin) SetUser(userID string) {
+	p.userID = userID
+}
+
+func (p *Plugin) Name() string {
+	return p.sandbox.described.Name
+}
+
+func (p *Plugin) Type() eventsourcing.PluginType {
+	if p.sandbox.described.Type == string(eventsourcing.SystemPlugin) {
+		return eventsourcing.SystemPlugin
+	}
+	return eventsourcing.LLMPlugin
+}
+
+func (p *Plugin) SystemPrompt() string {
+	return p.sandbox.described.SystemPrompt
+}
+
+func (p *Plugin) AgentModel() string {
+	return p.sandbox.described.AgentModel
+}
+
+func (p *Plugin) Schemas() map[string]eventsourcing.CommandInput {
+	schemas := make(map[string]eventsourcing.CommandInput)
+	for command, schema := range p.sandbox.described.Schemas {
+		schemas[command] = input{schema: schema}
+	}
+	return schemas
+}
+
+// Commands returns the commands the module executes
+func (p *Plugin) Commands() map[string]eventsourcing.CommandHandler {
+	commands := make(map[string]eventsourcing.CommandHandler)
+	for command := range p.sandbox.described.Schemas {
+		commands[command] = sandboxedCommand{plugin: p, name: command}
+	}
+	return commands
+}
+
+// Manifest returns the manifest the module describes, see eventsourcing.Manifester
+func (p *Plugin) Manifest() eventsourcing.Manifest {
+	return p.sandbox.described.Manifest
+}
+
+func (p *Plugin) Aggregate() eventsourcing.Aggregate {
+	return p.aggregate
+}
+
+// input is the input of a command, decoded as a map and checked by the module
+type input struct {
+	schema map[string]interface{}
+}
+
+func (i input) New() any                       { return &map[string]interface{}{} }
+func (i input) Schema() map[string]interface{} { return i.schema }
+
+// sandboxedCommand executes a command in the module
+type sandboxedCommand struct {
+	plugin *Plugin
+	name   string
+}
+
+func (c sandboxedCommand) Execute(data any) ([]eventsourcing.Event, error) {
+	var fields map[string]interface{}
+	raw, err := json.Marshal(data)
+	if err == nil {
+		err = json.Unmarshal(raw, &fields)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("the input of %s must be an object: %v", c.name, err)
+	}
+	delete(fields, "userID") // The module is told the user of the instance
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.plugin.aggregate.run("mindpalace_execute", guest.Call{UserID: c.plugin.userID, Command: c.name, Input: payload})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]eventsourcing.Event, 0, len(result.events))
+	for _, data := range result.events {
+		event := &eventsourcing.RawEvent{}
+		if err := event.UnmarshalJSON(data); err != nil {
+			return nil, fmt.Errorf("plugin %s emitted an invalid event: %v", c.plugin.Name(), err)
+		}
+		if !strings.HasPrefix(event.Type(), c.plugin.Name()+"_") {
+			return nil, fmt.Errorf("plugin %s emitted %s, events of plugins start with their name", c.plugin.Name(), event.Type())
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// aggregate keeps the events of a sandboxed plugin's user, and has the module render them in 3D
+type aggregate struct {
+	plugin *Plugin
+	mu     sync.RWMutex
+	events [][]byte // Events of the plugin applied, as stored
+}
+
+func (a *aggregate) ID() string {
+	return a.plugin.Name()
+}
+
+// GetCustomUI returns no UI, sandboxed plugins have no tab in the app
+func (a *aggregate) GetCustomUI() fyne.CanvasObject {
+	return nil
+}
+
+// ApplyEvent keeps the events of the plugin, the module's state
+func (a *aggregate) ApplyEvent(event eventsourcing.Event) error {
+	if !a.owns(event) {
+		return nil
+	}
+	data, err := event.Marshal()
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.events = append(a.events, data)
+	a.mu.Unlock()
+	return nil
+}
+
+// owns reports whether the event is one of the plugin's
+func (a *aggregate) owns(event eventsourcing.Event) bool {
+	return strings.HasPrefix(event.Type(), a.plugin.Name()+"_")
+}
+
+// Broadcast3DDelta has the module return the 3D actions of one of the plugin's events
+func (a *aggregate) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
+	if !a.owns(event) {
+		return nil
+	}
+	data, err := event.Marshal()
+	if err != nil {
+		return nil
+	}
+	return a.render(data)
+}
+
+// GetFull3DState has the module return the whole scene of the instance's user
+func (a *aggregate) GetFull3DState() []eventsourcing.DeltaAction {
+	return a.render(nil)
+}
+
+func (a *aggregate) render(event json.RawMessage) []eventsourcing.DeltaAction {
+	result, err := a.run("mindpalace_render", guest.Call{UserID: a.plugin.userID, Event: event})
+	if err != nil {
+		logging.Error("Plugin %s failed to return its 3D actions: %v", a.plugin.Name(), err)
+		return nil
+	}
+	var actions []eventsourcing.DeltaAction
+	if err := json.Unmarshal(result.response, &actions); err != nil {
+		logging.Error("Plugin %s returned invalid 3D actions: %v", a.plugin.Name(), err)
+		return nil
+	}
+	return actions
+}
+
+// run calls the export with the events of the instance's user as state
+func (a *aggregate) run(export string, request guest.Call) (*call, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.RLock()
+	c := &call{request: data, state: a.events[:len(a.events):len(a.events)]}
+	a.mu.RUnlock()
+	if _, err := a.plugin.sandbox.run(context.Background(), export, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
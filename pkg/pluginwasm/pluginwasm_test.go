@@ -0,0 +1,102 @@
+package pluginwasm
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/eventsourcing/eventsourcingtest"
+)
+
+// buildCounter compiles the counter plugin of testdata to WASM
+func buildCounter(t *testing.T, flags ...string) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("compiles a WASM module")
+	}
+	out := filepath.Join(t.TempDir(), "counter.wasm")
+	args := append([]string{"build", "-buildmode=c-shared", "-o", out}, flags...)
+	cmd := exec.Command("go", append(args, "./testdata/counter")...)
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Building the counter failed: %v\n%s", err, output)
+	}
+	return out
+}
+
+// countOf returns the count of the instance's user the module shows in 3D
+func countOf(t *testing.T, plugin eventsourcing.Plugin) float64 {
+	t.Helper()
+	actions := plugin.Aggregate().(eventsourcing.ThreeDUIBroadcaster).GetFull3DState()
+	if len(actions) != 1 {
+		t.Fatalf("Expected one action, got %v", actions)
+	}
+	count, _ := actions[0].Properties["count"].(float64)
+	return count
+}
+
+func TestSandbox(t *testing.T) {
+	ctx := context.Background()
+	sandbox, err := Load(ctx, buildCounter(t))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	defer sandbox.Close(ctx)
+
+	owner := sandbox.Plugin()
+	if owner.Name() != "counter" || owner.SystemPrompt() != "You count." || owner.Manifest().Version != "1.0.0" {
+		t.Errorf("Unexpected description: %+v", sandbox.described)
+	}
+	if !eventsourcing.IsRegistered("counter_Incremented") {
+		t.Error("Expected the plugin's events to be registered")
+	}
+
+	// Commands given the map the orchestrator decodes arguments into
+	input := owner.Schemas()["Increment"].New().(*map[string]interface{})
+	(*input)["By"] = 2
+	events, err := owner.Commands()["Increment"].Execute(input)
+	if err != nil {
+		t.Fatalf("Increment failed: %v", err)
+	}
+	if raw, ok := events[0].(*eventsourcing.RawEvent); len(events) != 1 || !ok || raw.Type() != "counter_Incremented" || raw.Data["by"] != 2.0 {
+		t.Fatalf("Expected counter_Incremented by 2, got %v", events)
+	}
+	eventsourcingtest.Apply(t, owner.Aggregate(), "", events...)
+	if deltas := owner.Aggregate().(eventsourcing.ThreeDUIBroadcaster).Broadcast3DDelta(events[0]); len(deltas) != 1 || deltas[0].Properties["count"] != 2.0 {
+		t.Errorf("Expected the 3D action of the increment, got %v", deltas)
+	}
+
+	// The module reads the state of each call from the events
+	if _, err := owner.Commands()["Increment"].Execute(map[string]interface{}{"By": -1}); err == nil || err.Error() != "By must be positive, the count is 2" {
+		t.Errorf("Expected the error of the command, got %v", err)
+	}
+	if _, err := owner.Commands()["Increment"].Execute(map[string]interface{}{"By": 5000}); err == nil || !strings.Contains(err.Error(), "panic: too much") {
+		t.Errorf("Expected the panic to fail the command, got %v", err)
+	}
+
+	// A household member's instance counts apart
+	bob := sandbox.NewPlugin()
+	bob.(eventsourcing.UserAware).SetUser("bob")
+	events, err = bob.Commands()["Increment"].Execute(map[string]interface{}{"By": 5, "userID": "bob"})
+	if err != nil {
+		t.Fatalf("Increment failed: %v", err)
+	}
+	eventsourcingtest.Apply(t, bob.Aggregate(), "bob", events...)
+	if countOf(t, owner) != 2 || countOf(t, bob) != 5 {
+		t.Errorf("Expected counts 2 and 5, got %v and %v", countOf(t, owner), countOf(t, bob))
+	}
+}
+
+func TestLoad_RefusesCapabilities(t *testing.T) {
+	ctx := context.Background()
+	if _, err := Load(ctx, buildCounter(t, "-ldflags=-X=main.capabilities=network")); err == nil || !strings.Contains(err.Error(), "uses network") {
+		t.Errorf("Expected a plugin using the network to be refused, got %v", err)
+	}
+	if _, err := Load(ctx, filepath.Join(t.TempDir(), "missing.wasm")); err == nil {
+		t.Error("Expected a missing module to fail")
+	}
+}
@@ -0,0 +1,212 @@
+// Package pluginwasm runs plugins compiled to WASM in a sandbox, for plugins MindPalace can't trust, like
+// those the LLM generates. A sandboxed plugin has no files, network or environment: it reads the events
+// of its user and emits events only through the host functions described in package guest. Each call
+// gets a new instance of the module, with limited memory and time, so a plugin can't keep state
+// between calls or users, nor take MindPalace down.
+package pluginwasm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+	"mindpalace/pkg/pluginwasm/guest"
+)
+
+// callTimeout is how long a call of a sandboxed plugin may take
+const callTimeout = 10 * time.Second
+
+// memoryLimitPages limits the memory of a sandboxed plugin to 256 MiB, in pages of 64 KiB
+const memoryLimitPages = 4096
+
+// exports are the functions a sandboxed plugin must export, see package guest
+var exports = []string{"mindpalace_describe", "mindpalace_execute", "mindpalace_render"}
+
+// Sandbox runs a plugin compiled to WASM
+type Sandbox struct {
+	runtime   wazero.Runtime
+	module    wazero.CompiledModule
+	described guest.Description
+}
+
+// Load compiles the WASM module at the path and describes its plugin. Plugins declaring capabilities
+// are refused, the sandbox grants none.
+func Load(ctx context.Context, path string) (*Sandbox, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := wazero.NewRuntimeConfig().WithMemoryLimitPages(memoryLimitPages).WithCloseOnContextDone(true)
+	if dir, err := os.UserCacheDir(); err == nil {
+		if cache, err := wazero.NewCompilationCacheWithDir(filepath.Join(dir, "mindpalace", "wasm")); err == nil {
+			config = config.WithCompilationCache(cache)
+		}
+	}
+	runtime := wazero.NewRuntimeWithConfig(ctx, config)
+	s := &Sandbox{runtime: runtime}
+	if err := s.load(ctx, code); err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("sandboxed plugin %s: %v", filepath.Base(path), err)
+	}
+	eventsourcing.RegisterRawEvents(s.described.EventTypes)
+	for _, eventType := range s.described.Transient {
+		eventsourcing.RegisterTransientEvent(eventType)
+	}
+	logging.Info("Loaded sandboxed plugin %s", s.described.Name)
+	return s, nil
+}
+
+func (s *Sandbox) load(ctx context.Context, code []byte) error {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, s.runtime); err != nil {
+		return err
+	}
+	if err := instantiateHost(ctx, s.runtime); err != nil {
+		return err
+	}
+	module, err := s.runtime.CompileModule(ctx, code)
+	if err != nil {
+		return err
+	}
+	s.module = module
+	for _, export := range exports {
+		if _, exists := module.ExportedFunctions()[export]; !exists {
+			return fmt.Errorf("the module does not export %s, is it built with pluginwasm/guest?", export)
+		}
+	}
+
+	response, err := s.run(ctx, "mindpalace_describe", &call{})
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(response, &s.described); err != nil {
+		return fmt.Errorf("invalid description: %v", err)
+	}
+	name := s.described.Name
+	if name == "" {
+		return fmt.Errorf("the plugin has no name")
+	}
+	for _, eventType := range s.described.EventTypes {
+		if !strings.HasPrefix(eventType, name+"_") {
+			return fmt.Errorf("plugin %s emits %s, events of plugins start with their name", name, eventType)
+		}
+	}
+	if capabilities := s.described.Manifest.Capabilities; len(capabilities) > 0 {
+		return fmt.Errorf("plugin %s uses %s, which sandboxed plugins can't", name, strings.Join(capabilities, ", "))
+	}
+	return nil
+}
+
+// Plugin returns a new instance of the plugin, the owner's
+func (s *Sandbox) Plugin() *Plugin {
+	p := &Plugin{sandbox: s}
+	p.aggregate = &aggregate{plugin: p}
+	return p
+}
+
+// NewPlugin creates an instance of the plugin for a household member, see eventsourcing.UserAware
+func (s *Sandbox) NewPlugin() eventsourcing.Plugin {
+	return s.Plugin()
+}
+
+// Close frees the compiled module
+func (s *Sandbox) Close(ctx context.Context) error {
+	return s.runtime.Close(ctx)
+}
+
+// call is the state of a call of an export, which the host functions read and write
+type call struct {
+	request  []byte
+	state    [][]byte // Events of the user, read with read_state
+	events   [][]byte // Events emitted
+	response []byte
+	failure  string
+}
+
+type callKey struct{}
+
+// run calls the export in a new instance of the module, returning its response
+func (s *Sandbox) run(ctx context.Context, export string, c *call) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, callKey{}, c), callTimeout)
+	defer cancel()
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize").
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader)
+	module, err := s.runtime.InstantiateModule(ctx, s.module, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start: %v", err)
+	}
+	defer module.Close(context.Background())
+	results, err := module.ExportedFunction(export).Call(ctx)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%s took longer than %s", export, callTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s crashed: %v", export, err)
+	}
+	if results[0] != 0 {
+		if c.failure == "" {
+			c.failure = export + " failed"
+		}
+		return nil, errors.New(c.failure)
+	}
+	return c.response, nil
+}
+
+// instantiateHost exports the host functions to the module "mindpalace", see package guest
+func instantiateHost(ctx context.Context, runtime wazero.Runtime) error {
+	_, err := runtime.NewHostModuleBuilder("mindpalace").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, capacity uint32) uint32 {
+		c := ctx.Value(callKey{}).(*call)
+		if uint32(len(c.request)) <= capacity {
+			m.Memory().Write(ptr, c.request)
+		}
+		return uint32(len(c.request))
+	}).Export("request").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, index, ptr, capacity uint32) int32 {
+		c := ctx.Value(callKey{}).(*call)
+		if int(index) >= len(c.state) {
+			return -1
+		}
+		event := c.state[index]
+		if uint32(len(event)) <= capacity {
+			m.Memory().Write(ptr, event)
+		}
+		return int32(len(event))
+	}).Export("read_state").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+		c := ctx.Value(callKey{}).(*call)
+		c.events = append(c.events, read(m, ptr, size))
+	}).Export("emit_event").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+		ctx.Value(callKey{}).(*call).response = read(m, ptr, size)
+	}).Export("respond").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+		ctx.Value(callKey{}).(*call).failure = string(read(m, ptr, size))
+	}).Export("fail").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+		logging.Debug("Sandboxed plugin: %s", read(m, ptr, size))
+	}).Export("log").
+		Instantiate(ctx)
+	return err
+}
+
+// read copies memory of the module, which is reused once the call returns
+func read(m api.Module, ptr, size uint32) []byte {
+	data, _ := m.Memory().Read(ptr, size)
+	return append([]byte(nil), data...)
+}
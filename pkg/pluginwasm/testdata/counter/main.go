@@ -0,0 +1,98 @@
+// Command counter is a plugin counting the increments of its user, built to WASM by the tests
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"fyne.io/fyne/v2"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/pluginwasm/guest"
+)
+
+// capabilities are those the plugin declares, set with -ldflags=-X=main.capabilities=network
+var capabilities string
+
+type IncrementedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	By        int    `json:"by"`
+}
+
+func (e *IncrementedEvent) Type() string { return "counter_Incremented" }
+func (e *IncrementedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *IncrementedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type IncrementInput struct {
+	By int `json:"By"`
+}
+
+func (i *IncrementInput) New() any { return &IncrementInput{} }
+func (i *IncrementInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"By": map[string]interface{}{"type": "integer"}},
+		"required":   []string{"By"},
+	}
+}
+
+type counter struct {
+	userID string
+	count  int
+}
+
+func (c *counter) Name() string                       { return "counter" }
+func (c *counter) Type() eventsourcing.PluginType     { return eventsourcing.LLMPlugin }
+func (c *counter) SystemPrompt() string               { return "You count." }
+func (c *counter) AgentModel() string                 { return "" }
+func (c *counter) Aggregate() eventsourcing.Aggregate { return c }
+func (c *counter) SetUser(userID string)              { c.userID = userID }
+func (c *counter) Manifest() eventsourcing.Manifest {
+	manifest := eventsourcing.Manifest{Version: "1.0.0"}
+	if capabilities != "" {
+		manifest.Capabilities = []string{capabilities}
+	}
+	return manifest
+}
+func (c *counter) Schemas() map[string]eventsourcing.CommandInput {
+	return map[string]eventsourcing.CommandInput{"Increment": &IncrementInput{}}
+}
+func (c *counter) Commands() map[string]eventsourcing.CommandHandler {
+	return map[string]eventsourcing.CommandHandler{
+		"Increment": eventsourcing.NewCommand(func(input *IncrementInput) ([]eventsourcing.Event, error) {
+			if input.By <= 0 {
+				return nil, fmt.Errorf("By must be positive, the count is %d", c.count)
+			}
+			if input.By > 1000 {
+				panic("too much")
+			}
+			return []eventsourcing.Event{&IncrementedEvent{By: input.By}}, nil
+		}),
+	}
+}
+
+func (c *counter) ID() string                     { return "counter" }
+func (c *counter) GetCustomUI() fyne.CanvasObject { return nil }
+func (c *counter) ApplyEvent(event eventsourcing.Event) error {
+	if e, ok := event.(*IncrementedEvent); ok {
+		c.count += e.By
+	}
+	return nil
+}
+func (c *counter) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
+	return c.GetFull3DState()
+}
+func (c *counter) GetFull3DState() []eventsourcing.DeltaAction {
+	return []eventsourcing.DeltaAction{{Type: "update", NodeID: "counter_" + c.userID, Properties: map[string]interface{}{"count": c.count}}}
+}
+
+func init() {
+	eventsourcing.RegisterEvent("counter_Incremented", func() eventsourcing.Event { return &IncrementedEvent{} })
+	guest.Serve(func() eventsourcing.Plugin { return &counter{} })
+}
+
+func main() {}
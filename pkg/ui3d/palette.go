@@ -0,0 +1,62 @@
+package ui3d
+
+import "sync"
+
+// Names of the built-in palettes
+const (
+	ThemeDark         = "dark"
+	ThemeLight        = "light"
+	ThemeHighContrast = "high-contrast"
+)
+
+var (
+	currentMu sync.RWMutex
+	current   = DefaultTheme()
+)
+
+// HighContrastTheme returns a theme of pure colors on black, for users who need strong contrast
+func HighContrastTheme() Theme {
+	return Theme{
+		Primary:    []float64{0.0, 1.0, 1.0, 1.0}, // Cyan
+		Secondary:  []float64{1.0, 1.0, 1.0, 1.0}, // White
+		Accent:     []float64{1.0, 1.0, 0.0, 1.0}, // Yellow
+		Background: []float64{0.0, 0.0, 0.0, 1.0}, // Black
+		Text:       []float64{1.0, 1.0, 1.0, 1.0}, // White
+	}
+}
+
+// BuiltinTheme returns the built-in palette with the name, if there is one
+func BuiltinTheme(name string) (Theme, bool) {
+	switch name {
+	case ThemeDark:
+		return DefaultTheme(), true
+	case ThemeLight:
+		return LightTheme(), true
+	case ThemeHighContrast:
+		return HighContrastTheme(), true
+	}
+	return Theme{}, false
+}
+
+// CurrentTheme returns the palette the user picked, objects are created in its colors
+func CurrentTheme() Theme {
+	currentMu.RLock()
+	defer currentMu.RUnlock()
+	return current
+}
+
+// SetCurrentTheme makes the palette the one objects are created in
+func SetCurrentTheme(theme Theme) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	current = theme
+}
+
+// Dark reports whether the background is dark, with light text on it
+func (t Theme) Dark() bool {
+	if len(t.Background) < 3 {
+		return true
+	}
+	// Relative luminance of the background
+	return 0.2126*t.Background[0]+0.7152*t.Background[1]+0.0722*t.Background[2] < 0.5
+}
@@ -1,6 +1,7 @@
 package ui3d
 
 import (
+	"fmt"
 	"math"
 
 	"mindpalace/pkg/eventsourcing"
@@ -28,6 +29,26 @@ type StandardObject struct {
 	Theme       Theme
 	Extra       map[string]interface{} // scale, rotation, etc.
 	DisplayInfo *DisplayInfo           // nil if no display info
+	XR          *eventsourcing.XRHints // nil for the hints of the mesh type
+}
+
+// XRLabelTextScale is the billboard text scale of labels in VR or AR, larger than on a screen to read
+// them at arm's length
+const XRLabelTextScale = 1.5
+
+// xrVolumes are the interaction volumes of the mesh types, the size of their meshes in Godot
+var xrVolumes = map[string][]float64{
+	"box":      {1, 1, 1},
+	"sphere":   {1, 1, 1},
+	"cylinder": {1, 2, 1},
+	"capsule":  {1, 2, 1},
+	"plane":    {2, 0.1, 2},
+}
+
+// meshXRHints returns the XR hints of an object of the mesh type: grabbable, as all objects can be
+// dragged, and touched in the volume of its mesh
+func meshXRHints(meshType string) *eventsourcing.XRHints {
+	return &eventsourcing.XRHints{InteractionVolume: xrVolumes[meshType], Grabbable: true}
 }
 
 // LayoutManager handles positioning for groups of objects
@@ -41,11 +62,11 @@ type LayoutManager struct {
 
 // Theme defines a color scheme for UI elements
 type Theme struct {
-	Primary    []float64 // RGBA
-	Secondary  []float64
-	Accent     []float64
-	Background []float64
-	Text       []float64
+	Primary    []float64 `json:"primary"` // RGBA
+	Secondary  []float64 `json:"secondary"`
+	Accent     []float64 `json:"accent"`
+	Background []float64 `json:"background"`
+	Text       []float64 `json:"text"`
 }
 
 // DefaultTheme returns a standard dark theme
@@ -75,6 +96,10 @@ func CreateStandardObject(obj StandardObject) []eventsourcing.DeltaAction {
 	actions := []eventsourcing.DeltaAction{}
 	// Create mesh action
 	meshAction := createMeshAction(obj.ID, obj.MeshType, obj.Position, obj.Theme, obj.Extra)
+	meshAction.XR = obj.XR
+	if meshAction.XR == nil {
+		meshAction.XR = meshXRHints(obj.MeshType)
+	}
 	if obj.DisplayInfo != nil {
 		if meshAction.Properties == nil {
 			meshAction.Properties = make(map[string]interface{})
@@ -97,6 +122,7 @@ func CreateStandardObject(obj StandardObject) []eventsourcing.DeltaAction {
 		// Set parent_id for proper parenting in Godot
 		labelAction.Properties["parent_id"] = obj.ID
 		labelAction.Properties["mesh_type"] = obj.MeshType
+		labelAction.XR = &eventsourcing.XRHints{TextScale: XRLabelTextScale}
 		if obj.DisplayInfo != nil {
 			labelAction.Properties["display_info"] = map[string]interface{}{
 				"title":       obj.DisplayInfo.Title,
@@ -343,3 +369,12 @@ func PositionRandom(seed int64, radius, height float64) []float64 {
 func CreateInteractiveText(nodeID string, text string, position []float64, theme Theme) eventsourcing.DeltaAction {
 	return CreateLabel(nodeID, text, position, theme)
 }
+
+// LinkBadge returns the text of an item's label with a badge counting the items it is linked to, the
+// text itself if it has none
+func LinkBadge(text string, links int) string {
+	if links == 0 {
+		return text
+	}
+	return fmt.Sprintf("%s  ↔%d", text, links)
+}
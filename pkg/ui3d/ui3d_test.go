@@ -134,6 +134,20 @@ func TestCreateCard(t *testing.T) {
 	if !reflect.DeepEqual(label.Properties["position"], expectedLabelPos) {
 		t.Errorf("CreateCard() label position = %v, want %v", label.Properties["position"], expectedLabelPos)
 	}
+	if box.XR == nil || !box.XR.Grabbable || !reflect.DeepEqual(box.XR.InteractionVolume, []float64{1, 1, 1}) {
+		t.Errorf("CreateCard() box XR hints = %+v, want a grabbable unit box", box.XR)
+	}
+	if label.XR == nil || label.XR.TextScale != XRLabelTextScale {
+		t.Errorf("CreateCard() label XR hints = %+v, want text scale %v", label.XR, XRLabelTextScale)
+	}
+}
+
+func TestCreateStandardObject_XRHints(t *testing.T) {
+	hints := &eventsourcing.XRHints{InteractionVolume: []float64{3, 1, 3}}
+	actions := CreateStandardObject(StandardObject{ID: "pond", MeshType: "plane", Position: []float64{0, 0, 0}, XR: hints})
+	if actions[0].XR != hints {
+		t.Errorf("CreateStandardObject() XR hints = %+v, want %+v", actions[0].XR, hints)
+	}
 }
 
 func TestPositionInGrid(t *testing.T) {
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// errPreconditionFailed is returned when the remote event changed since it was last synced
+var errPreconditionFailed = errors.New("remote event changed since the last sync")
+
+// RemoteCalendar is a calendar the calendar plugin syncs with
+type RemoteCalendar interface {
+	// List returns all events of the calendar
+	List(ctx context.Context) ([]RemoteEvent, error)
+	// Put creates or, when it has an ETag, replaces the event and returns its new Href and ETag
+	Put(ctx context.Context, event RemoteEvent) (RemoteEvent, error)
+	// Delete removes the event at href
+	Delete(ctx context.Context, href, etag string) error
+}
+
+// CalDAVClient syncs with a CalDAV calendar collection, like Nextcloud, iCloud or Google Calendar
+// (https://apidata.googleusercontent.com/caldav/v2/<calendar id>/events/ with an OAuth token)
+type CalDAVClient struct {
+	URL      string // URL of the calendar collection
+	Username string
+	Password string
+	Token    string // Bearer token, used instead of the username and password
+	HTTP     *http.Client
+}
+
+const calendarQuery = `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop>
+    <d:getetag/>
+    <c:calendar-data/>
+  </d:prop>
+  <c:filter>
+    <c:comp-filter name="VCALENDAR">
+      <c:comp-filter name="VEVENT"/>
+    </c:comp-filter>
+  </c:filter>
+</c:calendar-query>`
+
+// multistatus is the WebDAV response to a calendar query
+type multistatus struct {
+	Responses []struct {
+		Href      string `xml:"href"`
+		Propstats []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ETag         string `xml:"getetag"`
+				CalendarData string `xml:"calendar-data"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// List fetches all events of the calendar with a single calendar query
+func (c *CalDAVClient) List(ctx context.Context) ([]RemoteEvent, error) {
+	req, err := c.newRequest(ctx, "REPORT", c.URL, strings.NewReader(calendarQuery))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", "1")
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %v", c.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to query %s: %s", c.URL, resp.Status)
+	}
+
+	var result multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse calendar query response: %v", err)
+	}
+	var events []RemoteEvent
+	for _, response := range result.Responses {
+		for _, propstat := range response.Propstats {
+			if propstat.Prop.CalendarData == "" || (propstat.Status != "" && !strings.Contains(propstat.Status, " 200 ")) {
+				continue
+			}
+			parsed, err := parseICalendar(propstat.Prop.CalendarData)
+			if err != nil {
+				return nil, fmt.Errorf("invalid event %s: %v", response.Href, err)
+			}
+			href, err := c.resolve(response.Href)
+			if err != nil {
+				return nil, err
+			}
+			for _, event := range parsed {
+				event.Href = href
+				event.ETag = propstat.Prop.ETag
+				events = append(events, event)
+			}
+		}
+	}
+	return events, nil
+}
+
+// Put uploads the event, refusing to overwrite remote changes made since its ETag
+func (c *CalDAVClient) Put(ctx context.Context, event RemoteEvent) (RemoteEvent, error) {
+	if event.Href == "" {
+		href, err := c.resolve(url.PathEscape(event.UID) + ".ics")
+		if err != nil {
+			return event, err
+		}
+		event.Href = href
+	}
+	req, err := c.newRequest(ctx, http.MethodPut, event.Href, strings.NewReader(formatICalendar(event)))
+	if err != nil {
+		return event, err
+	}
+	req.Header.Set("Content-Type", "text/calendar; charset=utf-8")
+	if event.ETag != "" {
+		req.Header.Set("If-Match", event.ETag)
+	} else {
+		req.Header.Set("If-None-Match", "*")
+	}
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return event, fmt.Errorf("failed to upload %s: %v", event.Href, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return event, errPreconditionFailed
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return event, fmt.Errorf("failed to upload %s: %s", event.Href, resp.Status)
+	}
+	// Servers that don't return the new ETag make the next sync fetch the event again
+	event.ETag = resp.Header.Get("ETag")
+	return event, nil
+}
+
+// Delete removes the event, an event that is already gone is not an error
+func (c *CalDAVClient) Delete(ctx context.Context, href, etag string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, href, nil)
+	if err != nil {
+		return err
+	}
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %v", href, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		return errPreconditionFailed
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("failed to delete %s: %s", href, resp.Status)
+	}
+	return nil
+}
+
+func (c *CalDAVClient) newRequest(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request to %s: %v", target, err)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	return req, nil
+}
+
+// resolve makes an href of a response, usually just a path, an absolute URL
+func (c *CalDAVClient) resolve(href string) (string, error) {
+	base, err := url.Parse(c.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid caldav_url %s: %v", c.URL, err)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return "", fmt.Errorf("invalid href %s: %v", href, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+func (c *CalDAVClient) client() *http.Client {
+	if c.HTTP != nil {
+		return c.HTTP
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
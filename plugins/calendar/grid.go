@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"mindpalace/pkg/ui3d"
+)
+
+// Views of the calendar tab
+const (
+	viewMonth = "Month"
+	viewWeek  = "Week"
+)
+
+// monthCellEvents is how many events a day of the month view lists before the rest are behind "+N more"
+const monthCellEvents = 3
+
+// calendarView is what the calendar tab shows: the view and a day of the month or week shown
+type calendarView struct {
+	Mode string    // viewMonth or viewWeek, the month view if empty
+	Day  time.Time // Midnight of a day shown, today if zero
+}
+
+// shown returns the view with its defaults filled in
+func (v calendarView) shown(today time.Time) calendarView {
+	if v.Mode != viewWeek {
+		v.Mode = viewMonth
+	}
+	if v.Day.IsZero() {
+		v.Day = today
+	}
+	return v
+}
+
+// move returns the view of the month or week a number of months or weeks away
+func (v calendarView) move(steps int) calendarView {
+	if v.Mode == viewWeek {
+		v.Day = v.Day.AddDate(0, 0, 7*steps)
+	} else {
+		// From the first of the month, the 31st would skip short months
+		v.Day = time.Date(v.Day.Year(), v.Day.Month()+time.Month(steps), 1, 0, 0, 0, 0, v.Day.Location())
+	}
+	return v
+}
+
+// days returns the days the view shows, whole weeks from Monday: the weeks of the month, or the week
+func (v calendarView) days() []time.Time {
+	first, last := v.Day, v.Day
+	if v.Mode == viewMonth {
+		first = time.Date(v.Day.Year(), v.Day.Month(), 1, 0, 0, 0, 0, v.Day.Location())
+		last = first.AddDate(0, 1, -1)
+	}
+	first = first.AddDate(0, 0, -((int(first.Weekday()) + 6) % 7))
+	last = last.AddDate(0, 0, (7-int(last.Weekday()))%7)
+	var days []time.Time
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days
+}
+
+// title names the month or week shown
+func (v calendarView) title() string {
+	if v.Mode == viewWeek {
+		days := v.days()
+		return fmt.Sprintf("Week of %s", days[0].Format("2 January 2006"))
+	}
+	return v.Day.Format("January 2006")
+}
+
+// renderCalendar shows the events in the view, with buttons to change the view, to page through months
+// or weeks and to jump to today. setView remembers the view picked, so the tab shows it when rendered again.
+func renderCalendar(events []*CalendarEvent, view calendarView, loc *time.Location, setView func(calendarView)) fyne.CanvasObject {
+	today := startOfDay(time.Now(), loc)
+	view = view.shown(today)
+	title := widget.NewLabel("")
+	title.TextStyle = fyne.TextStyle{Bold: true}
+	grid := container.NewStack()
+	show := func(next calendarView) {
+		view = next
+		setView(view)
+		title.SetText(view.title())
+		if view.Mode == viewWeek {
+			grid.Objects = []fyne.CanvasObject{weekGrid(events, view, today, loc)}
+		} else {
+			grid.Objects = []fyne.CanvasObject{monthGrid(events, view, today, loc)}
+		}
+		grid.Refresh()
+	}
+
+	mode := widget.NewRadioGroup([]string{viewMonth, viewWeek}, nil)
+	mode.Horizontal = true
+	mode.SetSelected(view.Mode)
+	mode.OnChanged = func(selected string) {
+		if selected != "" && selected != view.Mode {
+			show(calendarView{Mode: selected, Day: view.Day})
+		}
+	}
+	toolbar := container.NewHBox(
+		widget.NewButtonWithIcon("", theme.NavigateBackIcon(), func() { show(view.move(-1)) }),
+		widget.NewButton("Today", func() { show(calendarView{Mode: view.Mode, Day: today}) }),
+		widget.NewButtonWithIcon("", theme.NavigateNextIcon(), func() { show(view.move(1)) }),
+		title,
+	)
+	show(view)
+	return container.NewBorder(container.NewBorder(nil, nil, nil, mode, toolbar), nil, nil, nil, grid)
+}
+
+// monthGrid shows the weeks of the month in rows of days, each day listing its first events
+func monthGrid(events []*CalendarEvent, view calendarView, today time.Time, loc *time.Location) fyne.CanvasObject {
+	cells := weekdayHeaders()
+	for _, day := range view.days() {
+		number := widget.NewLabel(fmt.Sprint(day.Day()))
+		number.TextStyle = fyne.TextStyle{Bold: day.Equal(today)}
+		if day.Month() != view.Day.Month() {
+			number.Importance = widget.LowImportance
+		}
+		cell := container.NewVBox(number)
+		onDay := eventsOn(events, day, loc)
+		listed := 0
+		for _, group := range layoutDay(onDay) {
+			for _, placed := range group {
+				if listed < monthCellEvents {
+					cell.Add(eventButton(placed.event, loc, false))
+				}
+				listed++
+			}
+		}
+		if listed > monthCellEvents {
+			day, more := day, widget.NewButton(fmt.Sprintf("+%d more", listed-monthCellEvents), nil)
+			more.Importance = widget.LowImportance
+			more.OnTapped = func() { showDay(onDay, day, loc, more) }
+			cell.Add(more)
+		}
+		cells = append(cells, dayCell(cell, day.Equal(today)))
+	}
+	return container.NewVScroll(container.NewGridWithColumns(7, cells...))
+}
+
+// weekGrid shows the days of the week in columns, overlapping events side by side
+func weekGrid(events []*CalendarEvent, view calendarView, today time.Time, loc *time.Location) fyne.CanvasObject {
+	var columns []fyne.CanvasObject
+	for _, day := range view.days() {
+		header := widget.NewLabel(day.Format("Mon 2"))
+		header.TextStyle = fyne.TextStyle{Bold: true}
+		header.Alignment = fyne.TextAlignCenter
+		column := container.NewVBox(header, widget.NewSeparator())
+		for _, group := range layoutDay(eventsOn(events, day, loc)) {
+			column.Add(overlapRow(group, loc))
+		}
+		columns = append(columns, dayCell(column, day.Equal(today)))
+	}
+	return container.NewVScroll(container.NewGridWithColumns(7, columns...))
+}
+
+// overlapRow shows a group of overlapping events in columns, as layoutDay placed them
+func overlapRow(group []placedEvent, loc *time.Location) fyne.CanvasObject {
+	if len(group) == 1 {
+		return eventButton(group[0].event, loc, true)
+	}
+	columns := make([]*fyne.Container, groupColumns(group))
+	objects := make([]fyne.CanvasObject, len(columns))
+	for i := range columns {
+		columns[i] = container.NewVBox()
+		objects[i] = columns[i]
+	}
+	for _, placed := range group {
+		columns[placed.column].Add(eventButton(placed.event, loc, true))
+	}
+	return container.NewGridWithColumns(len(columns), objects...)
+}
+
+// eventButton shows an event by its start and title, with a badge counting the items linked to it, and
+// tapping it shows its details. The week view shows when it ends too.
+func eventButton(event *CalendarEvent, loc *time.Location, withEnd bool) *widget.Button {
+	title := ui3d.LinkBadge(event.Title, len(event.Linked))
+	text := fmt.Sprintf("%s %s", event.StartTime.In(loc).Format("15:04"), title)
+	if withEnd {
+		text = fmt.Sprintf("%s-%s\n%s", event.StartTime.In(loc).Format("15:04"), eventEnd(event).In(loc).Format("15:04"), title)
+	}
+	button := widget.NewButtonWithIcon(text, importanceIcon(event.Importance), nil)
+	button.Alignment = widget.ButtonAlignLeading
+	button.Importance = widget.LowImportance
+	button.OnTapped = func() { showEventDetails(event, button) }
+	return button
+}
+
+// weekdayHeaders names the days of the week, from Monday
+func weekdayHeaders() []fyne.CanvasObject {
+	var headers []fyne.CanvasObject
+	for i := 1; i <= 7; i++ {
+		header := widget.NewLabel(time.Weekday(i % 7).String()[:3])
+		header.TextStyle = fyne.TextStyle{Bold: true}
+		header.Alignment = fyne.TextAlignCenter
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+// dayCell puts the content of a day on a background, highlighted for today
+func dayCell(content fyne.CanvasObject, today bool) fyne.CanvasObject {
+	var fill color.Color = theme.Color(theme.ColorNameInputBackground)
+	if today {
+		fill = theme.Color(theme.ColorNameSelection)
+	}
+	background := canvas.NewRectangle(fill)
+	background.CornerRadius = theme.InputRadiusSize()
+	return container.NewPadded(container.NewStack(background, container.NewPadded(content)))
+}
+
+// showEventDetails shows the card of an event over the canvas of the object tapped
+func showEventDetails(event *CalendarEvent, from fyne.CanvasObject) {
+	showPopUp(createEventCard(event), from)
+}
+
+// showDay shows all events of a day over the canvas of the object tapped
+func showDay(events []*CalendarEvent, day time.Time, loc *time.Location, from fyne.CanvasObject) {
+	title := widget.NewLabel(day.Format("Monday 2 January"))
+	title.TextStyle = fyne.TextStyle{Bold: true}
+	list := container.NewVBox(title)
+	for _, group := range layoutDay(events) {
+		list.Add(overlapRow(group, loc))
+	}
+	showPopUp(list, from)
+}
+
+// showPopUp shows content in a modal pop-up with a Close button
+func showPopUp(content fyne.CanvasObject, from fyne.CanvasObject) {
+	shown := fyne.CurrentApp().Driver().CanvasForObject(from)
+	if shown == nil {
+		return
+	}
+	var popUp *widget.PopUp
+	closeButton := widget.NewButton("Close", func() { popUp.Hide() })
+	popUp = widget.NewModalPopUp(container.NewBorder(nil, container.NewCenter(closeButton), nil, nil,
+		container.NewVScroll(content)), shown)
+	popUp.Resize(fyne.NewSize(400, fyne.Min(500, content.MinSize().Height+closeButton.MinSize().Height+4*theme.Padding())))
+	popUp.Show()
+}
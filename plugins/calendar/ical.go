@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RemoteEvent is a calendar event as stored on a CalDAV server
+type RemoteEvent struct {
+	UID          string
+	Href         string // URL of the event's iCalendar resource
+	ETag         string // Changes whenever the resource changes
+	Title        string
+	Description  string
+	Location     string
+	Status       string
+	Start        time.Time
+	End          time.Time
+	LastModified time.Time
+}
+
+// parseICalendar returns the events of an iCalendar (RFC 5545) document. Overrides of single
+// occurrences of recurring events are left out.
+func parseICalendar(data string) ([]RemoteEvent, error) {
+	var events []RemoteEvent
+	var current *RemoteEvent
+	override := false
+	for _, line := range unfoldLines(data) {
+		name, params, value := splitProperty(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			current = &RemoteEvent{Status: StatusConfirmed}
+			override = false
+		case name == "END" && value == "VEVENT":
+			if current == nil {
+				return nil, fmt.Errorf("END:VEVENT without BEGIN:VEVENT")
+			}
+			if current.UID == "" {
+				return nil, fmt.Errorf("event without UID")
+			}
+			if !override {
+				events = append(events, *current)
+			}
+			current = nil
+		case current == nil:
+			continue
+		case name == "UID":
+			current.UID = value
+		case name == "SUMMARY":
+			current.Title = unescapeText(value)
+		case name == "DESCRIPTION":
+			current.Description = unescapeText(value)
+		case name == "LOCATION":
+			current.Location = unescapeText(value)
+		case name == "STATUS":
+			current.Status = statusFromICal(value)
+		case name == "RECURRENCE-ID":
+			override = true
+		case name == "DTSTART", name == "DTEND", name == "LAST-MODIFIED", name == "DTSTAMP":
+			t, err := parseICalTime(value, params)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", name, err)
+			}
+			switch name {
+			case "DTSTART":
+				current.Start = t
+			case "DTEND":
+				current.End = t
+			case "LAST-MODIFIED":
+				current.LastModified = t
+			case "DTSTAMP":
+				if current.LastModified.IsZero() {
+					current.LastModified = t
+				}
+			}
+		}
+	}
+	return events, nil
+}
+
+// formatICalendar returns an iCalendar document holding the events
+func formatICalendar(events ...RemoteEvent) string {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//MindPalace//Calendar//EN",
+	}
+	now := formatICalTime(time.Now())
+	for _, e := range events {
+		lines = append(lines, "BEGIN:VEVENT", "UID:"+e.UID, "DTSTAMP:"+now)
+		if !e.LastModified.IsZero() {
+			lines = append(lines, "LAST-MODIFIED:"+formatICalTime(e.LastModified))
+		}
+		lines = append(lines, "DTSTART:"+formatICalTime(e.Start))
+		if !e.End.IsZero() {
+			lines = append(lines, "DTEND:"+formatICalTime(e.End))
+		}
+		lines = append(lines, "SUMMARY:"+escapeText(e.Title))
+		if e.Description != "" {
+			lines = append(lines, "DESCRIPTION:"+escapeText(e.Description))
+		}
+		if e.Location != "" {
+			lines = append(lines, "LOCATION:"+escapeText(e.Location))
+		}
+		lines = append(lines, "STATUS:"+strings.ToUpper(e.Status), "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	var doc strings.Builder
+	for _, line := range lines {
+		doc.WriteString(foldLine(line))
+		doc.WriteString("\r\n")
+	}
+	return doc.String()
+}
+
+// unfoldLines splits a document in content lines, joining lines continued on the next line
+func unfoldLines(data string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// foldLine splits lines longer than 75 octets as RFC 5545 requires, without splitting characters
+func foldLine(line string) string {
+	var folded strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > 75 {
+			folded.WriteString("\r\n ")
+			width = 1
+		}
+		folded.WriteRune(r)
+		width += size
+	}
+	return folded.String()
+}
+
+// splitProperty splits a content line like "DTSTART;TZID=Europe/Amsterdam:20240301T100000" in its
+// name, parameters and value
+func splitProperty(line string) (string, map[string]string, string) {
+	quoted := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return strings.ToUpper(line), nil, ""
+	}
+	parts := strings.Split(line[:colon], ";")
+	params := make(map[string]string)
+	for _, param := range parts[1:] {
+		if key, value, found := strings.Cut(param, "="); found {
+			params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:]
+}
+
+// parseICalTime parses a UTC, local, time zone or all day date-time
+func parseICalTime(value string, params map[string]string) (time.Time, error) {
+	if params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		return time.ParseInLocation("20060102", value, time.Local)
+	}
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse("20060102T150405Z", value)
+	}
+	location := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		if loc, err := time.LoadLocation(tzid); err == nil {
+			location = loc
+		}
+	}
+	return time.ParseInLocation("20060102T150405", value, location)
+}
+
+func formatICalTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+var (
+	textEscaper   = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+	textUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+)
+
+func escapeText(text string) string   { return textEscaper.Replace(text) }
+func unescapeText(text string) string { return textUnescaper.Replace(text) }
+
+// statusFromICal maps an iCalendar STATUS to a calendar event status
+func statusFromICal(status string) string {
+	switch strings.ToUpper(status) {
+	case "TENTATIVE":
+		return StatusTentative
+	case "CANCELLED":
+		return StatusCancelled
+	default:
+		return StatusConfirmed
+	}
+}
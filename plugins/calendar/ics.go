@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// ICSImportedEvent reports what importing an iCalendar file did, the events themselves are created
+// and updated by the events before it
+type ICSImportedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	File      string `json:"file"`
+	Created   int    `json:"created"`
+	Updated   int    `json:"updated"`
+	Unchanged int    `json:"unchanged"` // Imported before and not changed since
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+func (e *ICSImportedEvent) Type() string { return "calendar_ICSImported" }
+func (e *ICSImportedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ICSImportedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ICSExportedEvent reports the iCalendar file the events were exported to
+type ICSExportedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Path      string `json:"path"`
+	Events    int    `json:"events"`
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+func (e *ICSExportedEvent) Type() string { return "calendar_ICSExported" }
+func (e *ICSExportedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ICSExportedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func (i *ImportICSInput) New() any {
+	return &ImportICSInput{}
+}
+
+// ImportICSInput defines the input for importing an iCalendar file
+type ImportICSInput struct {
+	Path string `json:"Path"`
+}
+
+func (s *ImportICSInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Imports the events of an iCalendar (.ics) file exported from another calendar app; events imported before are updated instead of added again",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Path": map[string]interface{}{
+					"type":        "string",
+					"description": "Path of the .ics file",
+				},
+			},
+			"required": []string{"Path"},
+		},
+	}
+}
+
+func (i *ExportICSInput) New() any {
+	return &ExportICSInput{}
+}
+
+// ExportICSInput defines the input for exporting the calendar to an iCalendar file
+type ExportICSInput struct {
+	Path string `json:"Path"`
+	From string `json:"From,omitempty"`
+	To   string `json:"To,omitempty"`
+}
+
+func (s *ExportICSInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Exports the calendar events to an iCalendar (.ics) file other calendar apps can import",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Path": map[string]interface{}{
+					"type":        "string",
+					"description": "Path of the .ics file to write",
+				},
+				"From": map[string]interface{}{
+					"type":        "string",
+					"description": "Only export events starting from then, ISO 8601 or as the user said it, e.g. \"today\"",
+				},
+				"To": map[string]interface{}{
+					"type":        "string",
+					"description": "Only export events starting until then, ISO 8601 or as the user said it",
+				},
+			},
+			"required": []string{"Path"},
+		},
+	}
+}
+
+// icsPath returns the path of an iCalendar file, with ~ expanded to the home directory
+func icsPath(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path is required and must be a non-empty string")
+	}
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	if !strings.EqualFold(filepath.Ext(path), ".ics") {
+		return "", fmt.Errorf("%s is not an iCalendar (.ics) file", path)
+	}
+	return path, nil
+}
+
+// eventUID returns the iCalendar UID of a local event: the one it was imported or synced with, or
+// one derived from its ID so exporting it again gives the same UID
+func eventUID(event CalendarEvent, link *SyncLink) string {
+	switch {
+	case event.UID != "":
+		return event.UID
+	case link != nil && link.UID != "":
+		return link.UID
+	default:
+		return event.EventID + "@mindpalace"
+	}
+}
+
+func (p *CalendarPlugin) importICSHandler(input *ImportICSInput) ([]eventsourcing.Event, error) {
+	path, err := icsPath(input.Path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", input.Path, err)
+	}
+	imported, err := parseICalendar(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", input.Path, err)
+	}
+
+	// Events already in the calendar by UID, so importing a file again updates them
+	p.aggregate.Mu.RLock()
+	existing := make(map[string]CalendarEvent, len(p.aggregate.Events))
+	for _, event := range p.aggregate.Events {
+		existing[eventUID(*event, p.aggregate.Links[event.EventID])] = *event
+	}
+	p.aggregate.Mu.RUnlock()
+
+	summary := &ICSImportedEvent{EventType: "calendar_ICSImported", File: filepath.Base(path), Timestamp: eventsourcing.ISOTimestamp()}
+	var events []eventsourcing.Event
+	seen := make(map[string]bool, len(imported))
+	for _, r := range imported {
+		if seen[r.UID] {
+			continue // A file listing an event twice adds it once
+		}
+		seen[r.UID] = true
+		local, exists := existing[r.UID]
+		switch {
+		case !exists:
+			created := &EventCreatedEvent{
+				EventType:   "calendar_EventCreated",
+				EventID:     generateEventID(),
+				UID:         r.UID,
+				Title:       r.Title,
+				Description: r.Description,
+				Status:      r.Status,
+				Importance:  ImportanceMedium,
+				StartTime:   r.Start.Format(time.RFC3339),
+				Location:    r.Location,
+				Timestamp:   modifiedAt(r),
+			}
+			if !r.End.IsZero() {
+				created.EndTime = r.End.Format(time.RFC3339)
+			}
+			events = append(events, created)
+			summary.Created++
+		case local.Title == r.Title && local.Description == r.Description && local.Location == r.Location &&
+			local.Status == r.Status && local.StartTime.Equal(r.Start) && local.EndTime.Equal(r.End):
+			summary.Unchanged++
+		default:
+			updated := &EventUpdatedEvent{
+				EventType:   "calendar_EventUpdated",
+				EventID:     local.EventID,
+				Title:       r.Title,
+				Description: r.Description,
+				Status:      r.Status,
+				StartTime:   r.Start.Format(time.RFC3339),
+				Location:    r.Location,
+				Timestamp:   modifiedAt(r),
+			}
+			if !r.End.IsZero() {
+				updated.EndTime = r.End.Format(time.RFC3339)
+			}
+			events = append(events, updated)
+			summary.Updated++
+		}
+	}
+	return append(events, summary), nil
+}
+
+func (p *CalendarPlugin) exportICSHandler(input *ExportICSInput) ([]eventsourcing.Event, error) {
+	path, err := icsPath(input.Path)
+	if err != nil {
+		return nil, err
+	}
+	var from, to time.Time
+	if input.From != "" {
+		parsed, err := p.parseTimeInput("From", input.From)
+		if err != nil {
+			return nil, err
+		}
+		from = parseTime(parsed)
+	}
+	if input.To != "" {
+		parsed, err := p.parseTimeInput("To", input.To)
+		if err != nil {
+			return nil, err
+		}
+		to = parseTime(parsed)
+	}
+
+	p.aggregate.Mu.RLock()
+	var exported []RemoteEvent
+	for _, id := range p.aggregate.getSortedEventIDs() {
+		event := p.aggregate.Events[id]
+		if (!from.IsZero() && event.StartTime.Before(from)) || (!to.IsZero() && event.StartTime.After(to)) {
+			continue
+		}
+		exported = append(exported, RemoteEvent{
+			UID:          eventUID(*event, p.aggregate.Links[id]),
+			Title:        event.Title,
+			Description:  event.Description,
+			Location:     event.Location,
+			Status:       event.Status,
+			Start:        event.StartTime,
+			End:          event.EndTime,
+			LastModified: event.UpdatedAt,
+		})
+	}
+	p.aggregate.Mu.RUnlock()
+
+	if err := os.WriteFile(path, []byte(formatICalendar(exported...)), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", input.Path, err)
+	}
+	return []eventsourcing.Event{&ICSExportedEvent{
+		EventType: "calendar_ICSExported",
+		Path:      path,
+		Events:    len(exported),
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}}, nil
+}
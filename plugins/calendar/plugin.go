@@ -3,12 +3,14 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/nltime"
 	"mindpalace/pkg/ui3d"
 
 	"fyne.io/fyne/v2"
@@ -43,20 +45,32 @@ type CalendarEvent struct {
 	Attendees   []string  `json:"attendees,omitempty"`
 	Tags        []string  `json:"tags,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at,omitempty"`
+	UID         string    `json:"uid,omitempty"` // iCalendar UID of an imported event, identifying it when imported again
+
+	Linked []eventsourcing.Item `json:"-"` // Items of other plugins linked to the event, on the copies the views show
 }
 
 // CalendarAggregate manages the state of calendar events with thread safety
 type CalendarAggregate struct {
-	Events   map[string]*CalendarEvent
-	commands map[string]eventsourcing.CommandHandler
-	Mu       sync.RWMutex
+	Events         map[string]*CalendarEvent
+	Links          map[string]*SyncLink // Remote copies of events, by event ID
+	PendingDeletes map[string]*SyncLink // Linked events deleted locally but not yet remotely
+	LastSync       *CalendarSyncedEvent
+	commands       map[string]eventsourcing.CommandHandler
+	location       *time.Location           // Time zone of the user the days are shown in, nil until provided
+	view           calendarView             // What the calendar tab shows, kept as it is rendered again
+	links          eventsourcing.LinkSource // Items of other plugins linked to events, nil until provided
+	Mu             sync.RWMutex
 }
 
 // NewCalendarAggregate creates a new thread-safe CalendarAggregate
 func NewCalendarAggregate() *CalendarAggregate {
 	return &CalendarAggregate{
-		Events:   make(map[string]*CalendarEvent),
-		commands: make(map[string]eventsourcing.CommandHandler),
+		Events:         make(map[string]*CalendarEvent),
+		Links:          make(map[string]*SyncLink),
+		PendingDeletes: make(map[string]*SyncLink),
+		commands:       make(map[string]eventsourcing.CommandHandler),
 	}
 }
 
@@ -65,6 +79,182 @@ func (a *CalendarAggregate) ID() string {
 	return "calendar"
 }
 
+// calendarSnapshot is the state saved in a snapshot
+type calendarSnapshot struct {
+	Events         map[string]*CalendarEvent `json:"events"`
+	Links          map[string]*SyncLink      `json:"links,omitempty"`
+	PendingDeletes map[string]*SyncLink      `json:"pending_deletes,omitempty"`
+	LastSync       *CalendarSyncedEvent      `json:"last_sync,omitempty"`
+}
+
+// SaveSnapshot serializes the current events so they can be restored without a full replay
+func (a *CalendarAggregate) SaveSnapshot() ([]byte, error) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return json.Marshal(calendarSnapshot{Events: a.Events, Links: a.Links, PendingDeletes: a.PendingDeletes, LastSync: a.LastSync})
+}
+
+// LoadSnapshot replaces the current events with those from a snapshot
+func (a *CalendarAggregate) LoadSnapshot(data []byte) error {
+	var snapshot calendarSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to unmarshal snapshot: %v", err)
+	}
+	if snapshot.Events == nil {
+		// Snapshots taken before sync support hold just the events
+		if err := json.Unmarshal(data, &snapshot.Events); err != nil {
+			return fmt.Errorf("failed to unmarshal snapshot: %v", err)
+		}
+	}
+	if snapshot.Links == nil {
+		snapshot.Links = make(map[string]*SyncLink)
+	}
+	if snapshot.PendingDeletes == nil {
+		snapshot.PendingDeletes = make(map[string]*SyncLink)
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	a.Events = snapshot.Events
+	a.Links = snapshot.Links
+	a.PendingDeletes = snapshot.PendingDeletes
+	a.LastSync = snapshot.LastSync
+	return nil
+}
+
+// Deadlines returns the start times of all events that are not cancelled
+func (a *CalendarAggregate) Deadlines() []eventsourcing.Deadline {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	var deadlines []eventsourcing.Deadline
+	for _, event := range a.Events {
+		if event.StartTime.IsZero() || event.Status == StatusCancelled {
+			continue
+		}
+		deadlines = append(deadlines, eventsourcing.Deadline{
+			ID:     event.EventID,
+			Title:  event.Title,
+			Due:    event.StartTime,
+			NodeID: fmt.Sprintf("calendar_event_%s", event.EventID),
+		})
+	}
+	return deadlines
+}
+
+// BriefingItems returns the events of the day that are not cancelled, by start time
+func (a *CalendarAggregate) BriefingItems(day time.Time) []eventsourcing.BriefingItem {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	end := day.AddDate(0, 0, 1)
+	var items []eventsourcing.BriefingItem
+	for _, id := range a.getSortedEventIDs() {
+		event := a.Events[id]
+		if event.StartTime.IsZero() || event.Status == StatusCancelled {
+			continue
+		}
+		finish := event.EndTime
+		if finish.IsZero() {
+			finish = event.StartTime
+		}
+		if !event.StartTime.Before(end) || finish.Before(day) {
+			continue
+		}
+		text := fmt.Sprintf("%s at %s", event.Title, event.StartTime.In(day.Location()).Format("15:04"))
+		if !event.EndTime.IsZero() {
+			text = fmt.Sprintf("%s from %s to %s", event.Title, event.StartTime.In(day.Location()).Format("15:04"), event.EndTime.In(day.Location()).Format("15:04"))
+		}
+		if event.Location != "" {
+			text += " at " + event.Location
+		}
+		items = append(items, eventsourcing.BriefingItem{Section: "Calendar", Text: text, Time: event.StartTime})
+	}
+	return items
+}
+
+// QueryState returns copies of all events by start time, for questions about the calendar together
+// with other plugins' state
+func (a *CalendarAggregate) QueryState() any {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	events := []CalendarEvent{}
+	for _, id := range a.getSortedEventIDs() {
+		events = append(events, *a.Events[id])
+	}
+	return events
+}
+
+// TaggedItems returns the events with tags by start time, for listing everything with a tag
+func (a *CalendarAggregate) TaggedItems() []eventsourcing.TaggedItem {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	var items []eventsourcing.TaggedItem
+	for _, id := range a.getSortedEventIDs() {
+		event := a.Events[id]
+		if len(event.Tags) == 0 {
+			continue
+		}
+		items = append(items, eventsourcing.TaggedItem{
+			Aggregate: a.ID(),
+			ID:        event.EventID,
+			Title:     event.Title,
+			Due:       event.StartTime,
+			Tags:      append([]string(nil), event.Tags...),
+		})
+	}
+	return items
+}
+
+// Item returns an event, for linking it to the items of other plugins
+func (a *CalendarAggregate) Item(id string) (eventsourcing.Item, bool) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	event, exists := a.Events[id]
+	if !exists {
+		return eventsourcing.Item{}, false
+	}
+	return eventsourcing.Item{Aggregate: a.ID(), ID: event.EventID, Title: event.Title, NodeID: fmt.Sprintf("calendar_event_%s", event.EventID)}, true
+}
+
+// linkedItems returns the items of other plugins linked to an event (caller holds the lock)
+func (a *CalendarAggregate) linkedItems(eventID string) []eventsourcing.Item {
+	if a.links == nil {
+		return nil
+	}
+	return a.links.LinkedItems(a.ID(), eventID)
+}
+
+// Conflicts reports whether the events change a calendar event that was changed concurrently
+func (a *CalendarAggregate) Conflicts(events, concurrent []eventsourcing.Event) bool {
+	changed := make(map[string]bool)
+	for _, event := range concurrent {
+		if eventID := changedEvent(event); eventID != "" {
+			changed[eventID] = true
+		}
+	}
+	for _, event := range events {
+		if changed[changedEvent(event)] {
+			return true
+		}
+	}
+	return false
+}
+
+// changedEvent returns the ID of the calendar event an event changes, empty for other events
+func changedEvent(event eventsourcing.Event) string {
+	switch e := event.(type) {
+	case *EventCreatedEvent:
+		return e.EventID
+	case *EventUpdatedEvent:
+		return e.EventID
+	case *EventDeletedEvent:
+		return e.EventID
+	case *EventLinkedEvent:
+		return e.EventID
+	case *EventUnlinkedEvent:
+		return e.EventID
+	}
+	return ""
+}
+
 // ApplyEvent updates the aggregate state based on event-related events
 func (a *CalendarAggregate) ApplyEvent(event eventsourcing.Event) error {
 	a.Mu.Lock()
@@ -93,6 +283,8 @@ func (a *CalendarAggregate) ApplyEvent(event eventsourcing.Event) error {
 			Attendees:   e.Attendees,
 			Tags:        e.Tags,
 			CreatedAt:   time.Now().UTC(),
+			UpdatedAt:   parseTime(e.Timestamp),
+			UID:         e.UID,
 		}
 
 	case "calendar_EventUpdated":
@@ -128,6 +320,12 @@ func (a *CalendarAggregate) ApplyEvent(event eventsourcing.Event) error {
 			if e.Tags != nil {
 				event.Tags = e.Tags
 			}
+			if e.Timestamp != "" {
+				event.UpdatedAt = parseTime(e.Timestamp)
+			}
+			if link, linked := a.Links[e.EventID]; linked {
+				link.Dirty = true
+			}
 		}
 
 	case "calendar_EventDeleted":
@@ -136,6 +334,13 @@ func (a *CalendarAggregate) ApplyEvent(event eventsourcing.Event) error {
 			return fmt.Errorf("failed to unmarshal EventDeleted: %v", err)
 		}
 		delete(a.Events, e.EventID)
+		if link, linked := a.Links[e.EventID]; linked {
+			a.PendingDeletes[e.EventID] = link
+			delete(a.Links, e.EventID)
+		}
+
+	case "calendar_EventLinked", "calendar_EventUnlinked", "calendar_CalendarSynced":
+		return a.applySyncEvent(event.Type(), data)
 
 	default:
 		return nil
@@ -146,6 +351,15 @@ func (a *CalendarAggregate) ApplyEvent(event eventsourcing.Event) error {
 // CalendarPlugin implements the plugin interface
 type CalendarPlugin struct {
 	aggregate *CalendarAggregate
+
+	syncMu        sync.Mutex // Held during a sync
+	syncConfigMu  sync.Mutex // Guards the fields below
+	remote        RemoteCalendar
+	remoteURL     string
+	syncInterval  time.Duration
+	stopSync      chan struct{}
+	location      *time.Location              // Time zone of the user, times without one are in it
+	tagNormalizer eventsourcing.TagNormalizer // Canonicalizes the user's tags, nil until provided
 }
 
 func NewPlugin() eventsourcing.Plugin {
@@ -164,11 +378,32 @@ func NewPlugin() eventsourcing.Plugin {
 		"ListEvents": eventsourcing.NewCommand(func(input *ListEventsInput) ([]eventsourcing.Event, error) {
 			return p.listEventsHandler(input)
 		}),
+		"SyncCalendar": eventsourcing.NewCommand(func(input *SyncCalendarInput) ([]eventsourcing.Event, error) {
+			return p.syncCalendarHandler(input)
+		}),
+		"CalendarSyncStatus": eventsourcing.NewCommand(func(input *CalendarSyncStatusInput) ([]eventsourcing.Event, error) {
+			return p.syncStatusHandler(input)
+		}),
+		"ImportICS": eventsourcing.NewCommand(func(input *ImportICSInput) ([]eventsourcing.Event, error) {
+			return p.importICSHandler(input)
+		}),
+		"ExportICS": eventsourcing.NewCommand(func(input *ExportICSInput) ([]eventsourcing.Event, error) {
+			return p.exportICSHandler(input)
+		}),
 	}
 	eventsourcing.RegisterEvent("calendar_EventCreated", func() eventsourcing.Event { return &EventCreatedEvent{} })
 	eventsourcing.RegisterEvent("calendar_EventUpdated", func() eventsourcing.Event { return &EventUpdatedEvent{} })
 	eventsourcing.RegisterEvent("calendar_EventsListed", func() eventsourcing.Event { return &EventsListedEvent{} })
+	eventsourcing.RegisterTransientEvent("calendar_EventsListed")
 	eventsourcing.RegisterEvent("calendar_EventDeleted", func() eventsourcing.Event { return &EventDeletedEvent{} })
+	eventsourcing.RegisterEvent("calendar_EventLinked", func() eventsourcing.Event { return &EventLinkedEvent{} })
+	eventsourcing.RegisterEvent("calendar_EventUnlinked", func() eventsourcing.Event { return &EventUnlinkedEvent{} })
+	eventsourcing.RegisterEvent("calendar_CalendarSynced", func() eventsourcing.Event { return &CalendarSyncedEvent{} })
+	eventsourcing.RegisterEvent("calendar_SyncStatusReported", func() eventsourcing.Event { return &SyncStatusReportedEvent{} })
+	eventsourcing.RegisterTransientEvent("calendar_SyncStatusReported")
+	eventsourcing.RegisterEvent("calendar_ICSImported", func() eventsourcing.Event { return &ICSImportedEvent{} })
+	eventsourcing.RegisterEvent("calendar_ICSExported", func() eventsourcing.Event { return &ICSExportedEvent{} })
+	eventsourcing.RegisterTransientEvent("calendar_ICSExported")
 	return p
 }
 
@@ -182,13 +417,25 @@ func (p *CalendarPlugin) Name() string {
 	return "calendar"
 }
 
+// Manifest declares that the plugin syncs CalDAV calendars and imports ICS files
+func (p *CalendarPlugin) Manifest() eventsourcing.Manifest {
+	return eventsourcing.Manifest{
+		Version:      "1.0.0",
+		Capabilities: []string{eventsourcing.CapabilityNetwork, eventsourcing.CapabilityFiles},
+	}
+}
+
 // Schemas defines the command schemas
 func (p *CalendarPlugin) Schemas() map[string]eventsourcing.CommandInput {
 	return map[string]eventsourcing.CommandInput{
-		"CreateEvent": &CreateEventInput{},
-		"UpdateEvent": &UpdateEventInput{},
-		"DeleteEvent": &DeleteEventInput{},
-		"ListEvents":  &ListEventsInput{},
+		"CreateEvent":        &CreateEventInput{},
+		"UpdateEvent":        &UpdateEventInput{},
+		"DeleteEvent":        &DeleteEventInput{},
+		"ListEvents":         &ListEventsInput{},
+		"SyncCalendar":       &SyncCalendarInput{},
+		"CalendarSyncStatus": &CalendarSyncStatusInput{},
+		"ImportICS":          &ImportICSInput{},
+		"ExportICS":          &ExportICSInput{},
 	}
 }
 
@@ -237,11 +484,11 @@ func (c *CreateEventInput) Schema() map[string]interface{} {
 				},
 				"StartTime": map[string]interface{}{
 					"type":        "string",
-					"description": "Start time of the event (ISO 8601)",
+					"description": "Start time of the event, ISO 8601 or as the user said it, e.g. \"tuesday at 3pm\"",
 				},
 				"EndTime": map[string]interface{}{
 					"type":        "string",
-					"description": "End time of the event (ISO 8601)",
+					"description": "End time of the event, ISO 8601 or as the user said it",
 				},
 				"Location": map[string]interface{}{
 					"type":        "string",
@@ -311,11 +558,11 @@ func (u *UpdateEventInput) Schema() map[string]interface{} {
 				},
 				"StartTime": map[string]interface{}{
 					"type":        "string",
-					"description": "Start time of the event (ISO 8601)",
+					"description": "Start time of the event, ISO 8601 or as the user said it, e.g. \"tuesday at 3pm\"",
 				},
 				"EndTime": map[string]interface{}{
 					"type":        "string",
-					"description": "End time of the event (ISO 8601)",
+					"description": "End time of the event, ISO 8601 or as the user said it",
 				},
 				"Location": map[string]interface{}{
 					"type":        "string",
@@ -397,11 +644,11 @@ func (l *ListEventsInput) Schema() map[string]interface{} {
 				},
 				"From": map[string]interface{}{
 					"type":        "string",
-					"description": "Filter events from this date (ISO 8601)",
+					"description": "Filter events from this date, ISO 8601 or e.g. \"today\"",
 				},
 				"To": map[string]interface{}{
 					"type":        "string",
-					"description": "Filter events to this date (ISO 8601)",
+					"description": "Filter events to this date, ISO 8601 or e.g. \"next week\"",
 				},
 			},
 		},
@@ -410,6 +657,7 @@ func (l *ListEventsInput) Schema() map[string]interface{} {
 
 // Event Types
 type EventsListedEvent struct {
+	eventsourcing.EventMetadata
 	EventType string           `json:"event_type"`
 	Events    []*CalendarEvent `json:"listed_events"`
 }
@@ -422,8 +670,10 @@ func (e *EventsListedEvent) Marshal() ([]byte, error) {
 func (e *EventsListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
 
 type EventCreatedEvent struct {
+	eventsourcing.EventMetadata
 	EventType   string   `json:"event_type"`
 	EventID     string   `json:"event_id"`
+	UID         string   `json:"uid,omitempty"` // Set when imported from an iCalendar file
 	Title       string   `json:"title"`
 	Description string   `json:"description,omitempty"`
 	Status      string   `json:"status"`
@@ -433,6 +683,7 @@ type EventCreatedEvent struct {
 	Location    string   `json:"location,omitempty"`
 	Attendees   []string `json:"attendees,omitempty"`
 	Tags        []string `json:"tags,omitempty"`
+	Timestamp   string   `json:"timestamp,omitempty"`
 }
 
 func (e *EventCreatedEvent) Type() string { return "calendar_EventCreated" }
@@ -443,6 +694,7 @@ func (e *EventCreatedEvent) Marshal() ([]byte, error) {
 func (e *EventCreatedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
 
 type EventUpdatedEvent struct {
+	eventsourcing.EventMetadata
 	EventType   string   `json:"event_type"`
 	EventID     string   `json:"event_id"`
 	Title       string   `json:"title,omitempty"`
@@ -454,6 +706,7 @@ type EventUpdatedEvent struct {
 	Location    string   `json:"location,omitempty"`
 	Attendees   []string `json:"attendees,omitempty"`
 	Tags        []string `json:"tags,omitempty"`
+	Timestamp   string   `json:"timestamp,omitempty"`
 }
 
 func (e *EventUpdatedEvent) Type() string { return "calendar_EventUpdated" }
@@ -464,6 +717,7 @@ func (e *EventUpdatedEvent) Marshal() ([]byte, error) {
 func (e *EventUpdatedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
 
 type EventDeletedEvent struct {
+	eventsourcing.EventMetadata
 	EventType string `json:"event_type"`
 	EventID   string `json:"event_id"`
 }
@@ -490,6 +744,68 @@ func parseTime(timeStr string) time.Time {
 	return t
 }
 
+// parseTimeInput reads a time as the user said it, e.g. "tomorrow at 3pm", in the user's time zone.
+// Empty input stays empty.
+func (p *CalendarPlugin) parseTimeInput(name, text string) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	p.syncConfigMu.Lock()
+	loc := p.location
+	p.syncConfigMu.Unlock()
+	if loc == nil {
+		loc = time.Local
+	}
+	t, err := nltime.Parse(text, time.Now().In(loc))
+	if err != nil {
+		return "", fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return t.Format(time.RFC3339), nil
+}
+
+// SetLocation sets the time zone event times are read in
+func (p *CalendarPlugin) SetLocation(loc *time.Location) {
+	p.syncConfigMu.Lock()
+	p.location = loc
+	p.syncConfigMu.Unlock()
+	p.aggregate.Mu.Lock()
+	p.aggregate.location = loc
+	p.aggregate.Mu.Unlock()
+}
+
+// SetTagNormalizer sets how the tags of new and updated events are canonicalized
+func (p *CalendarPlugin) SetTagNormalizer(normalizer eventsourcing.TagNormalizer) {
+	p.syncConfigMu.Lock()
+	defer p.syncConfigMu.Unlock()
+	p.tagNormalizer = normalizer
+}
+
+// SetLinkSource sets where the items of other plugins linked to events are found
+func (p *CalendarPlugin) SetLinkSource(source eventsourcing.LinkSource) {
+	p.aggregate.Mu.Lock()
+	p.aggregate.links = source
+	p.aggregate.Mu.Unlock()
+}
+
+// normalizeTags puts tags in their canonical form, once the plugin has been given a normalizer.
+// Nil tags stay nil, as they leave an event's tags unchanged.
+func (p *CalendarPlugin) normalizeTags(tags []string) ([]string, error) {
+	p.syncConfigMu.Lock()
+	normalizer := p.tagNormalizer
+	p.syncConfigMu.Unlock()
+	if normalizer == nil || tags == nil {
+		return tags, nil
+	}
+	normalized, err := normalizer.NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	if normalized == nil {
+		normalized = []string{}
+	}
+	return normalized, nil
+}
+
 func validateStatus(status string) bool {
 	return status == StatusConfirmed || status == StatusTentative || status == StatusCancelled
 }
@@ -519,6 +835,7 @@ func (p *CalendarPlugin) createEventHandler(input *CreateEventInput) ([]eventsou
 		Location:    input.Location,
 		Attendees:   input.Attendees,
 		Tags:        input.Tags,
+		Timestamp:   eventsourcing.ISOTimestamp(),
 	}
 
 	if input.Status != "" && validateStatus(input.Status) {
@@ -527,30 +844,15 @@ func (p *CalendarPlugin) createEventHandler(input *CreateEventInput) ([]eventsou
 	if input.Importance != "" && validateImportance(input.Importance) {
 		event.Importance = input.Importance
 	}
-	// Validate times
-	if input.StartTime != "" {
-		formats := []string{
-			time.RFC3339,
-			"2006-01-02",
-			"2006-01-02 15:04:05",
-			"2006-01-02T15:04:05Z",
-		}
-		var _ time.Time
-		var err error
-		for _, format := range formats {
-			_, err = time.Parse(format, input.StartTime)
-			if err == nil {
-				break
-			}
-		}
-		if err != nil {
-			return nil, fmt.Errorf("invalid startTime format: '%s' doesn't match supported formats", input.StartTime)
-		}
+	var err error
+	if event.StartTime, err = p.parseTimeInput("startTime", input.StartTime); err != nil {
+		return nil, err
 	}
-	if input.EndTime != "" {
-		if _, err := time.Parse(time.RFC3339, input.EndTime); err != nil {
-			return nil, fmt.Errorf("invalid endTime format: %v", err)
-		}
+	if event.EndTime, err = p.parseTimeInput("endTime", input.EndTime); err != nil {
+		return nil, err
+	}
+	if event.Tags, err = p.normalizeTags(input.Tags); err != nil {
+		return nil, err
 	}
 	return []eventsourcing.Event{event}, nil
 }
@@ -579,6 +881,7 @@ func (p *CalendarPlugin) updateEventHandler(input *UpdateEventInput) ([]eventsou
 		Location:    input.Location,
 		Attendees:   input.Attendees,
 		Tags:        input.Tags,
+		Timestamp:   eventsourcing.ISOTimestamp(),
 	}
 
 	if input.Status != "" && !validateStatus(input.Status) {
@@ -587,15 +890,15 @@ func (p *CalendarPlugin) updateEventHandler(input *UpdateEventInput) ([]eventsou
 	if input.Importance != "" && !validateImportance(input.Importance) {
 		return nil, fmt.Errorf("invalid importance: %s", input.Importance)
 	}
-	if input.StartTime != "" {
-		if _, err := time.Parse(time.RFC3339, input.StartTime); err != nil {
-			return nil, fmt.Errorf("invalid startTime format: %v", err)
-		}
+	var err error
+	if event.StartTime, err = p.parseTimeInput("startTime", input.StartTime); err != nil {
+		return nil, err
 	}
-	if input.EndTime != "" {
-		if _, err := time.Parse(time.RFC3339, input.EndTime); err != nil {
-			return nil, fmt.Errorf("invalid endTime format: %v", err)
-		}
+	if event.EndTime, err = p.parseTimeInput("endTime", input.EndTime); err != nil {
+		return nil, err
+	}
+	if event.Tags, err = p.normalizeTags(input.Tags); err != nil {
+		return nil, err
 	}
 
 	return []eventsourcing.Event{event}, nil
@@ -639,10 +942,18 @@ func (p *CalendarPlugin) listEventsHandler(input *ListEventsInput) ([]eventsourc
 		tagFilter = input.Tag
 	}
 	if input.From != "" {
-		fromTime = parseTime(input.From)
+		from, err := p.parseTimeInput("from", input.From)
+		if err != nil {
+			return nil, err
+		}
+		fromTime = parseTime(from)
 	}
 	if input.To != "" {
-		toTime = parseTime(input.To)
+		to, err := p.parseTimeInput("to", input.To)
+		if err != nil {
+			return nil, err
+		}
+		toTime = parseTime(to)
 	}
 
 	filteredEvents := events[:0]
@@ -666,32 +977,34 @@ func (p *CalendarPlugin) listEventsHandler(input *ListEventsInput) ([]eventsourc
 	return []eventsourcing.Event{event}, nil
 }
 
-// GetCustomUI returns a list view for the calendar events
+// GetCustomUI returns month and week views of the calendar events
 func (ca *CalendarAggregate) GetCustomUI() fyne.CanvasObject {
 	ca.Mu.RLock()
 	events := make([]*CalendarEvent, 0, len(ca.Events))
 	for _, event := range ca.Events {
-		events = append(events, event)
+		copied := *event // The views outlive the lock
+		copied.Linked = ca.linkedItems(event.EventID)
+		events = append(events, &copied)
 	}
+	lastSync := ca.LastSync
+	view := ca.view
+	loc := ca.timeZone()
 	ca.Mu.RUnlock()
 
-	if len(events) == 0 {
-		return container.NewCenter(widget.NewLabel("No events available. Create one to get started!"))
-	}
-
-	// Sort events by start time
-	sort.Slice(events, func(i, j int) bool {
-		return events[i].StartTime.Before(events[j].StartTime)
+	calendar := renderCalendar(events, view, loc, func(view calendarView) {
+		ca.Mu.Lock()
+		ca.view = view
+		ca.Mu.Unlock()
 	})
-
-	content := container.NewVBox()
-	for _, event := range events {
-		card := createEventCard(event)
-		content.Add(card)
-		content.Add(widget.NewSeparator())
+	if lastSync == nil {
+		return calendar
 	}
-
-	return container.NewVScroll(content)
+	status := fmt.Sprintf("Synced %s: %d pulled, %d pushed, %d deleted", parseTime(lastSync.Timestamp).Local().Format("2006-01-02 15:04"),
+		lastSync.Pulled, lastSync.Pushed, lastSync.Deleted)
+	if lastSync.Error != "" {
+		status = fmt.Sprintf("Sync failed %s: %s", parseTime(lastSync.Timestamp).Local().Format("2006-01-02 15:04"), lastSync.Error)
+	}
+	return container.NewBorder(container.NewVBox(widget.NewLabel(status), widget.NewSeparator()), nil, nil, nil, calendar)
 }
 
 // createEventCard creates a compact card UI for a single event
@@ -727,6 +1040,13 @@ func createEventCard(event *CalendarEvent) fyne.CanvasObject {
 	if len(event.Tags) > 0 {
 		detailLines = append(detailLines, fmt.Sprintf("Tags: %s", strings.Join(event.Tags, ", ")))
 	}
+	if len(event.Linked) > 0 {
+		titles := make([]string, len(event.Linked))
+		for i, item := range event.Linked {
+			titles[i] = item.Title
+		}
+		detailLines = append(detailLines, fmt.Sprintf("↔ Linked: %s", strings.Join(titles, ", ")))
+	}
 	details := widget.NewLabel(strings.Join(detailLines, "\n"))
 	details.Wrapping = fyne.TextWrapWord
 
@@ -802,7 +1122,7 @@ func (p *CalendarPlugin) SystemPrompt() string {
 
 The user input will be a JSON object containing the arguments for the command to execute. Parse the JSON and call the appropriate command with the parsed values.
 
-Your job is to interpret user requests about calendar events and execute the right commands (CreateEvent, UpdateEvent, DeleteEvent, ListEvents) based on the current event state.
+Your job is to interpret user requests about calendar events and execute the right commands (CreateEvent, UpdateEvent, DeleteEvent, ListEvents, SyncCalendar, CalendarSyncStatus, ImportICS, ExportICS) based on the current event state.
 
 ` + eventList.String() + `
 
@@ -818,12 +1138,16 @@ When interpreting user requests, pay close attention to the intent:
 - If the user asks to "create" or "add" an event, use the CreateEvent command.
 - If the user asks to "update" or "modify" an event, use the UpdateEvent command.
 - If the user asks to "list" or "show" events, use the ListEvents command.
+- If the user asks to "sync" the calendar with Google Calendar or CalDAV, use the SyncCalendar command.
+- If the user asks whether or when the calendar synced, use the CalendarSyncStatus command.
+- If the user asks to import an .ics file or to move their events over from another calendar app, use the ImportICS command.
+- If the user asks to export the calendar or save it as an .ics file, use the ExportICS command.
 
 When creating or updating events, extract key information from user requests including:
 - Event title and description
 - Importance level (Low, Medium, High, Critical)
 - Status (Confirmed, Tentative, Cancelled)
-- Start and end times (in ISO format)
+- Start and end times (in ISO format, or as the user said them, like "next tuesday at 3pm")
 - Location
 - Attendees
 - Tags for organization
@@ -833,6 +1157,60 @@ Format your responses in a structured way and confirm actions performed.`
 	return prompt
 }
 
+// RequiresConfirmation asks the user before events are deleted
+func (p *CalendarPlugin) RequiresConfirmation(command string) bool {
+	return command == "DeleteEvent"
+}
+
+// Examples shows the agent how common requests map to commands, the times left as the user said them
+func (p *CalendarPlugin) Examples() []eventsourcing.Example {
+	return []eventsourcing.Example{
+		{Request: "lunch with Sam on tuesday at noon", Command: "CreateEvent", Arguments: map[string]interface{}{"Title": "Lunch with Sam", "StartTime": "tuesday at noon"}},
+		{Request: "put the dentist in my calendar, thursday from 3 to 4pm", Command: "CreateEvent", Arguments: map[string]interface{}{"Title": "Dentist", "StartTime": "thursday at 3pm", "EndTime": "thursday at 4pm"}},
+		{Request: "what's on my calendar this week?", Command: "ListEvents", Arguments: map[string]interface{}{"From": "today", "To": "sunday"}},
+	}
+}
+
+// dayWidth is how far a card is dragged along the x axis to move its event by a day, the spacing of the lanes
+const dayWidth = 2.0
+
+// HandleInteraction deletes an event deleted in the 3D world and reschedules an event whose card
+// was dragged sideways, a day per card width
+func (p *CalendarPlugin) HandleInteraction(interaction eventsourcing.Interaction) (string, any) {
+	eventID, ok := strings.CutPrefix(interaction.NodeID, "calendar_event_")
+	if !ok {
+		return "", nil
+	}
+	p.aggregate.Mu.RLock()
+	event, exists := p.aggregate.Events[eventID]
+	var start, end time.Time
+	if exists {
+		start, end = event.StartTime, event.EndTime
+	}
+	p.aggregate.Mu.RUnlock()
+	if !exists {
+		return "", nil
+	}
+	switch interaction.Kind {
+	case eventsourcing.ObjectDeleted:
+		return "DeleteEvent", &DeleteEventInput{EventID: eventID}
+	case eventsourcing.ObjectMoved:
+		if interaction.From == nil || interaction.Position == nil {
+			return "", nil
+		}
+		days := int(math.Round((interaction.Position[0] - interaction.From[0]) / dayWidth))
+		if days == 0 {
+			return "", nil
+		}
+		input := &UpdateEventInput{EventID: eventID, StartTime: start.AddDate(0, 0, days).Format(time.RFC3339)}
+		if !end.IsZero() {
+			input.EndTime = end.AddDate(0, 0, days).Format(time.RFC3339)
+		}
+		return "UpdateEvent", input
+	}
+	return "", nil
+}
+
 // AgentModel specifies the LLM model to use for this plugin's agent
 func (p *CalendarPlugin) AgentModel() string {
 	return "gpt-oss:20b" // Using the general-purpose model for calendar management
@@ -845,57 +1223,11 @@ func (p *CalendarPlugin) EventHandlers() map[string]eventsourcing.EventHandler {
 func (a *CalendarAggregate) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
 	a.Mu.RLock()
 	defer a.Mu.RUnlock()
-	theme := ui3d.DefaultTheme()
 	switch e := event.(type) {
 	case *EventCreatedEvent:
-		// Get sorted event IDs to determine position
-		sortedIDs := a.getSortedEventIDs()
-		i := 0
-		for _, id := range sortedIDs {
-			if id == e.EventID {
-				break
-			}
-			i++
-		}
-		pos := ui3d.PositionInGrid(float64(i), 0, 2.0)
-		pos[0] = pos[2] // Move Z spacing to X axis
-		pos[1] = 2.0
-		pos[2] = -8.0
-		actions := ui3d.CreateCard(fmt.Sprintf("calendar_event_%s", e.EventID), e.Title, pos, theme)
-		for j := range actions {
-			if actions[j].Properties == nil {
-				actions[j].Properties = make(map[string]interface{})
-			}
-			actions[j].Properties["event_type"] = "calendar_event_created"
-		}
-		return actions
+		return a.eventLaneActions(e.EventID, "calendar_event_created")
 	case *EventUpdatedEvent:
-		// Get sorted event IDs to determine position
-		sortedIDs := a.getSortedEventIDs()
-		i := 0
-		for _, id := range sortedIDs {
-			if id == e.EventID {
-				break
-			}
-			i++
-		}
-		pos := ui3d.PositionInGrid(float64(i), 0, 2.0)
-		pos[0] = pos[2] // Move Z spacing to X axis
-		pos[1] = 2.0
-		pos[2] = -8.0
-		// Delete old and create new
-		oldActions := []eventsourcing.DeltaAction{
-			{Type: "delete", NodeID: fmt.Sprintf("calendar_event_%s", e.EventID)},
-			{Type: "delete", NodeID: fmt.Sprintf("calendar_event_%s_label", e.EventID)},
-		}
-		newActions := ui3d.CreateCard(fmt.Sprintf("calendar_event_%s", e.EventID), a.Events[e.EventID].Title, pos, theme)
-		for j := range newActions {
-			if newActions[j].Properties == nil {
-				newActions[j].Properties = make(map[string]interface{})
-			}
-			newActions[j].Properties["event_type"] = "calendar_event_updated"
-		}
-		return append(oldActions, newActions...)
+		return a.eventLaneActions(e.EventID, "calendar_event_updated")
 	case *EventDeletedEvent:
 		return []eventsourcing.DeltaAction{
 			{Type: "delete", NodeID: fmt.Sprintf("calendar_event_%s", e.EventID)},
@@ -905,32 +1237,29 @@ func (a *CalendarAggregate) Broadcast3DDelta(event eventsourcing.Event) []events
 	return nil
 }
 
+// eventLaneActions lays out the lane of the day of an event again, the other events of the day may
+// have moved to make room for it
+func (a *CalendarAggregate) eventLaneActions(eventID, eventType string) []eventsourcing.DeltaAction {
+	event, exists := a.Events[eventID]
+	if !exists {
+		return nil
+	}
+	return a.laneActions(startOfDay(event.StartTime, a.timeZone()), eventID, eventType)
+}
+
 func (a *CalendarAggregate) GetFull3DState() []eventsourcing.DeltaAction {
 	a.Mu.RLock()
 	defer a.Mu.RUnlock()
-	theme := ui3d.DefaultTheme()
+	theme := ui3d.CurrentTheme()
 	actions := []eventsourcing.DeltaAction{ui3d.CreateSphere("calendar_hub", []float64{0.0, 0.0, -10.0}, theme)}
-	// Add cards for events in sorted order
-	sortedIDs := a.getSortedEventIDs()
-	for i, id := range sortedIDs {
-		event := a.Events[id]
-		pos := ui3d.PositionInGrid(float64(i), 0, 2.0)
-		pos[0] = pos[2] // Move Z spacing to X axis
-		pos[1] = 2.0
-		pos[2] = -8.0
-		cards := ui3d.CreateCard(fmt.Sprintf("calendar_event_%s", id), event.Title, pos, theme)
-		for j := range cards {
-			if cards[j].Properties == nil {
-				cards[j].Properties = make(map[string]interface{})
-			}
-			cards[j].Properties["event_type"] = "calendar_event"
-		}
-		actions = append(actions, cards...)
+	// Add the lanes of the days with events, in order
+	for _, day := range a.laneDays() {
+		actions = append(actions, a.laneActions(day, "", "calendar_event")...)
 	}
 	return actions
 }
 
-// getSortedEventIDs returns event IDs sorted by start time for consistent positioning
+// getSortedEventIDs returns event IDs sorted by start time for a consistent order
 func (a *CalendarAggregate) getSortedEventIDs() []string {
 	ids := make([]string, 0, len(a.Events))
 	for id := range a.Events {
@@ -1,7 +1,19 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
 )
 
 func TestCalendarAggregate_ApplyEvent_EventCreated(t *testing.T) {
@@ -44,6 +56,19 @@ func TestCalendarAggregate_ApplyEvent_EventCreated(t *testing.T) {
 	}
 }
 
+func TestCalendarAggregate_BriefingItems(t *testing.T) {
+	agg := NewCalendarAggregate()
+	agg.ApplyEvent(&EventCreatedEvent{EventType: "calendar_EventCreated", EventID: "event1", Title: "Standup", Status: StatusConfirmed, StartTime: "2024-05-01T09:00:00Z", EndTime: "2024-05-01T09:15:00Z", Location: "Office"})
+	agg.ApplyEvent(&EventCreatedEvent{EventType: "calendar_EventCreated", EventID: "event2", Title: "Dentist", Status: StatusConfirmed, StartTime: "2024-05-01T14:00:00Z"})
+	agg.ApplyEvent(&EventCreatedEvent{EventType: "calendar_EventCreated", EventID: "event3", Title: "Tomorrow", Status: StatusConfirmed, StartTime: "2024-05-02T09:00:00Z"})
+	agg.ApplyEvent(&EventCreatedEvent{EventType: "calendar_EventCreated", EventID: "event4", Title: "Cancelled", Status: StatusCancelled, StartTime: "2024-05-01T10:00:00Z"})
+
+	items := agg.BriefingItems(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	if len(items) != 2 || items[0].Text != "Standup from 09:00 to 09:15 at Office" || items[1].Text != "Dentist at 14:00" {
+		t.Errorf("Expected today's events by start time, got %+v", items)
+	}
+}
+
 func TestCalendarAggregate_ApplyEvent_EventUpdated(t *testing.T) {
 	agg := NewCalendarAggregate()
 
@@ -125,13 +150,14 @@ func TestCalendarAggregate_GetFull3DState(t *testing.T) {
 		Title:     "Test Event",
 		StartTime: "2023-12-31T10:00:00Z",
 	}
+	agg.location = time.UTC
 	agg.ApplyEvent(createEvent)
 
 	actions := agg.GetFull3DState()
 
-	// Should have 1 hub + 2 for event (box and label)
-	if len(actions) != 3 {
-		t.Errorf("Expected 3 actions, got %d", len(actions))
+	// Should have 1 hub + the label of the day's lane + 2 for event (box and label)
+	if len(actions) != 4 {
+		t.Errorf("Expected 4 actions, got %d", len(actions))
 	}
 
 	// Check hub
@@ -140,14 +166,20 @@ func TestCalendarAggregate_GetFull3DState(t *testing.T) {
 		t.Errorf("Expected NodeID 'calendar_hub', got '%s'", hubAction.NodeID)
 	}
 
+	// Check the day's lane
+	laneAction := actions[1]
+	if laneAction.NodeID != "calendar_day_2023-12-31" {
+		t.Errorf("Expected NodeID 'calendar_day_2023-12-31', got '%s'", laneAction.NodeID)
+	}
+
 	// Check event box
-	boxAction := actions[1]
+	boxAction := actions[2]
 	if boxAction.NodeID != "calendar_event_event1" {
 		t.Errorf("Expected NodeID 'calendar_event_event1', got '%s'", boxAction.NodeID)
 	}
 
 	// Check event label
-	labelAction := actions[2]
+	labelAction := actions[3]
 	if labelAction.NodeID != "calendar_event_event1_label" {
 		t.Errorf("Expected NodeID 'calendar_event_event1_label', got '%s'", labelAction.NodeID)
 	}
@@ -168,17 +200,17 @@ func TestCalendarAggregate_Broadcast3DDelta_EventCreated(t *testing.T) {
 
 	actions := agg.Broadcast3DDelta(event)
 
-	// Should have 2 actions: box and label
-	if len(actions) != 2 {
-		t.Errorf("Expected 2 actions, got %d", len(actions))
+	// Should have 3 actions: the label of the day's lane, box and label
+	if len(actions) != 3 {
+		t.Fatalf("Expected 3 actions, got %d", len(actions))
 	}
 
-	boxAction := actions[0]
+	boxAction := actions[1]
 	if boxAction.NodeID != "calendar_event_event1" {
 		t.Errorf("Expected NodeID 'calendar_event_event1', got '%s'", boxAction.NodeID)
 	}
 
-	labelAction := actions[1]
+	labelAction := actions[2]
 	if labelAction.NodeID != "calendar_event_event1_label" {
 		t.Errorf("Expected NodeID 'calendar_event_event1_label', got '%s'", labelAction.NodeID)
 	}
@@ -207,3 +239,641 @@ func TestCalendarAggregate_Broadcast3DDelta_EventDeleted(t *testing.T) {
 		t.Errorf("Expected delete action for 'calendar_event_event1_label', got %v", actions[1])
 	}
 }
+
+// fakeRemote is an in-memory remote calendar
+type fakeRemote struct {
+	events map[string]RemoteEvent // By UID
+	etags  int
+}
+
+func newFakeRemote(events ...RemoteEvent) *fakeRemote {
+	f := &fakeRemote{events: make(map[string]RemoteEvent)}
+	for _, e := range events {
+		f.store(e)
+	}
+	return f
+}
+
+func (f *fakeRemote) store(e RemoteEvent) RemoteEvent {
+	f.etags++
+	e.Href = "https://dav.example.com/cal/" + e.UID + ".ics"
+	e.ETag = fmt.Sprintf(`"%d"`, f.etags)
+	f.events[e.UID] = e
+	return e
+}
+
+func (f *fakeRemote) List(ctx context.Context) ([]RemoteEvent, error) {
+	var events []RemoteEvent
+	for _, e := range f.events {
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (f *fakeRemote) Put(ctx context.Context, e RemoteEvent) (RemoteEvent, error) {
+	if current, exists := f.events[e.UID]; exists && current.ETag != e.ETag {
+		return e, errPreconditionFailed
+	}
+	return f.store(e), nil
+}
+
+func (f *fakeRemote) Delete(ctx context.Context, href, etag string) error {
+	for uid, e := range f.events {
+		if e.Href == href {
+			delete(f.events, uid)
+		}
+	}
+	return nil
+}
+
+func (f *fakeRemote) byTitle(title string) (RemoteEvent, bool) {
+	for _, e := range f.events {
+		if e.Title == title {
+			return e, true
+		}
+	}
+	return RemoteEvent{}, false
+}
+
+// run executes a command and applies its events like the event processor does
+func run(t *testing.T, p *CalendarPlugin, command string, input interface{}) []eventsourcing.Event {
+	t.Helper()
+	var events []eventsourcing.Event
+	var err error
+	switch command {
+	case "CreateEvent":
+		events, err = p.createEventHandler(input.(*CreateEventInput))
+	case "UpdateEvent":
+		events, err = p.updateEventHandler(input.(*UpdateEventInput))
+	case "DeleteEvent":
+		events, err = p.deleteEventHandler(input.(*DeleteEventInput))
+	case "SyncCalendar":
+		events, err = p.syncCalendarHandler(&SyncCalendarInput{})
+	case "ImportICS":
+		events, err = p.importICSHandler(input.(*ImportICSInput))
+	case "ExportICS":
+		events, err = p.exportICSHandler(input.(*ExportICSInput))
+	}
+	if err != nil {
+		t.Fatalf("%s failed: %v", command, err)
+	}
+	for _, event := range events {
+		if err := p.aggregate.ApplyEvent(event); err != nil {
+			t.Fatalf("ApplyEvent %s failed: %v", event.Type(), err)
+		}
+	}
+	return events
+}
+
+func syncSummary(t *testing.T, p *CalendarPlugin) *CalendarSyncedEvent {
+	t.Helper()
+	events := run(t, p, "SyncCalendar", nil)
+	summary := events[len(events)-1].(*CalendarSyncedEvent)
+	if summary.Error != "" {
+		t.Fatalf("Sync failed: %s", summary.Error)
+	}
+	return summary
+}
+
+func eventByTitle(p *CalendarPlugin, title string) *CalendarEvent {
+	for _, e := range p.aggregate.Events {
+		if e.Title == title {
+			return e
+		}
+	}
+	return nil
+}
+
+func TestSync_TwoWay(t *testing.T) {
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	remote := newFakeRemote(RemoteEvent{UID: "standup@example.com", Title: "Standup", Status: StatusConfirmed, Start: start, LastModified: start})
+	p := NewPlugin().(*CalendarPlugin)
+	p.remote = remote
+	run(t, p, "CreateEvent", &CreateEventInput{Title: "Dentist", StartTime: "2024-03-02T09:00:00Z"})
+
+	if s := syncSummary(t, p); s.Pulled != 1 || s.Pushed != 1 {
+		t.Fatalf("Expected the remote event pulled and the local one pushed, got %+v", s)
+	}
+	if standup := eventByTitle(p, "Standup"); standup == nil || !standup.StartTime.Equal(start) {
+		t.Fatalf("Expected the remote event locally, got %+v", standup)
+	}
+	if _, pushed := remote.byTitle("Dentist"); !pushed || len(p.aggregate.Links) != 2 {
+		t.Fatalf("Expected the local event remotely and both events linked, got %v", remote.events)
+	}
+	if s := syncSummary(t, p); s.Pulled+s.Pushed+s.Deleted != 0 {
+		t.Errorf("Expected nothing to sync, got %+v", s)
+	}
+
+	// Local changes are pushed
+	dentist := eventByTitle(p, "Dentist")
+	run(t, p, "UpdateEvent", &UpdateEventInput{EventID: dentist.EventID, Location: "Main Street 1"})
+	if s := syncSummary(t, p); s.Pushed != 1 {
+		t.Errorf("Expected the update pushed, got %+v", s)
+	}
+	if e, _ := remote.byTitle("Dentist"); e.Location != "Main Street 1" {
+		t.Errorf("Expected the remote location updated, got %q", e.Location)
+	}
+
+	// Remote changes are pulled
+	standup, _ := remote.byTitle("Standup")
+	standup.Title = "Daily standup"
+	remote.store(standup)
+	if s := syncSummary(t, p); s.Pulled != 1 || eventByTitle(p, "Daily standup") == nil {
+		t.Errorf("Expected the remote change pulled, got %+v", s)
+	}
+
+	// Deletions go both ways
+	delete(remote.events, standup.UID)
+	run(t, p, "DeleteEvent", &DeleteEventInput{EventID: dentist.EventID})
+	if s := syncSummary(t, p); s.Deleted != 2 {
+		t.Errorf("Expected both deletions synced, got %+v", s)
+	}
+	if len(p.aggregate.Events) != 0 || len(remote.events) != 0 || len(p.aggregate.Links) != 0 || len(p.aggregate.PendingDeletes) != 0 {
+		t.Errorf("Expected both calendars empty, got %v and %v", p.aggregate.Events, remote.events)
+	}
+}
+
+func TestSync_ConflictLastModifiedWins(t *testing.T) {
+	remote := newFakeRemote(RemoteEvent{UID: "review@example.com", Title: "Review", Start: time.Now().Add(time.Hour), LastModified: time.Now().Add(-time.Hour)})
+	p := NewPlugin().(*CalendarPlugin)
+	p.remote = remote
+	syncSummary(t, p)
+	local := eventByTitle(p, "Review")
+
+	// The remote change is newer than the local one
+	run(t, p, "UpdateEvent", &UpdateEventInput{EventID: local.EventID, Title: "Local review"})
+	changed := remote.events["review@example.com"]
+	changed.Title, changed.LastModified = "Remote review", time.Now().Add(time.Minute)
+	remote.store(changed)
+	if s := syncSummary(t, p); s.Conflicts != 1 || s.Pulled != 1 || local.Title != "Remote review" {
+		t.Errorf("Expected the remote change to win, got %+v and %q", s, local.Title)
+	}
+
+	// The local change is newer than the remote one
+	changed = remote.events["review@example.com"]
+	changed.Title, changed.LastModified = "Remote again", time.Now().Add(-time.Minute)
+	remote.store(changed)
+	run(t, p, "UpdateEvent", &UpdateEventInput{EventID: local.EventID, Title: "Local again"})
+	if s := syncSummary(t, p); s.Conflicts != 1 || s.Pushed != 1 || remote.events["review@example.com"].Title != "Local again" {
+		t.Errorf("Expected the local change to win, got %+v and %q", s, remote.events["review@example.com"].Title)
+	}
+	if p.aggregate.Links[local.EventID].Dirty {
+		t.Error("Expected the event to be synced")
+	}
+
+	// A locally changed event deleted remotely is recreated
+	run(t, p, "UpdateEvent", &UpdateEventInput{EventID: local.EventID, Location: "Room 2"})
+	delete(remote.events, "review@example.com")
+	if s := syncSummary(t, p); s.Conflicts != 1 || s.Pushed != 1 || len(remote.events) != 1 {
+		t.Errorf("Expected the event recreated remotely, got %+v", s)
+	}
+}
+
+func TestSync_NotConfigured(t *testing.T) {
+	p := NewPlugin().(*CalendarPlugin)
+	if _, err := p.syncCalendarHandler(&SyncCalendarInput{}); err == nil {
+		t.Error("Expected an error without caldav_url")
+	}
+	if err := p.Configure(map[string]interface{}{"caldav_url": "dav.example.com"}); err == nil {
+		t.Error("Expected an error for a URL without scheme")
+	}
+	if err := p.Configure(map[string]interface{}{"caldav_url": "https://dav.example.com/cal/", "sync_interval": "soon"}); err == nil {
+		t.Error("Expected an error for an invalid interval")
+	}
+	if err := p.Configure(map[string]interface{}{"caldav_url": "https://dav.example.com/cal/", "sync_interval": "0"}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	events, err := p.syncStatusHandler(&CalendarSyncStatusInput{})
+	if err != nil {
+		t.Fatalf("CalendarSyncStatus failed: %v", err)
+	}
+	if status := events[0].(*SyncStatusReportedEvent); !status.Configured || status.URL != "https://dav.example.com/cal/" {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+}
+
+func TestCalendarAggregate_SnapshotKeepsLinks(t *testing.T) {
+	agg := NewCalendarAggregate()
+	agg.ApplyEvent(&EventCreatedEvent{EventType: "calendar_EventCreated", EventID: "event1", Title: "Standup", StartTime: "2024-03-01T10:00:00Z"})
+	agg.ApplyEvent(&EventLinkedEvent{EventType: "calendar_EventLinked", EventID: "event1", UID: "standup@example.com", ETag: `"1"`})
+	data, err := agg.SaveSnapshot()
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	restored := NewCalendarAggregate()
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if len(restored.Events) != 1 || restored.Links["event1"].UID != "standup@example.com" {
+		t.Errorf("Expected the event and its link restored, got %v %v", restored.Events, restored.Links)
+	}
+
+	// Snapshots taken before sync support hold just the events
+	if err := restored.LoadSnapshot([]byte(`{"event1":{"event_id":"event1","title":"Standup"}}`)); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if restored.Events["event1"] == nil || restored.Links == nil {
+		t.Errorf("Expected the old snapshot format to load, got %v", restored.Events)
+	}
+}
+
+func TestCalendarPlugin_HandleInteraction(t *testing.T) {
+	p := NewPlugin().(*CalendarPlugin)
+	p.aggregate.ApplyEvent(&EventCreatedEvent{EventType: "calendar_EventCreated", EventID: "event1", Title: "Standup", StartTime: "2024-03-01T10:00:00Z", EndTime: "2024-03-01T10:15:00Z"})
+
+	command, input := p.HandleInteraction(eventsourcing.Interaction{Kind: eventsourcing.ObjectMoved, NodeID: "calendar_event_event1", From: []float64{4, 2, -8}, Position: []float64{8.2, 2, -8}})
+	update, ok := input.(*UpdateEventInput)
+	if command != "UpdateEvent" || !ok || update.StartTime != "2024-03-03T10:00:00Z" || update.EndTime != "2024-03-03T10:15:00Z" {
+		t.Errorf("Expected the event moved two days, got %s %+v", command, input)
+	}
+	if command, _ := p.HandleInteraction(eventsourcing.Interaction{Kind: eventsourcing.ObjectMoved, NodeID: "calendar_event_event1", From: []float64{4, 2, -8}, Position: []float64{4.5, 2, -3}}); command != "" {
+		t.Errorf("Expected a move of less than a day to be ignored, got %s", command)
+	}
+	command, input = p.HandleInteraction(eventsourcing.Interaction{Kind: eventsourcing.ObjectDeleted, NodeID: "calendar_event_event1"})
+	if deletion, ok := input.(*DeleteEventInput); command != "DeleteEvent" || !ok || deletion.EventID != "event1" {
+		t.Errorf("Expected the event deleted, got %s %+v", command, input)
+	}
+	if command, _ := p.HandleInteraction(eventsourcing.Interaction{Kind: eventsourcing.ObjectDeleted, NodeID: "task_1"}); command != "" {
+		t.Errorf("Expected objects of other plugins to be ignored, got %s", command)
+	}
+}
+
+func TestParseICalendar(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:abc@example.com\r\n" +
+		"DTSTART;TZID=Europe/Amsterdam:20240301T100000\r\n" +
+		"DTEND;TZID=Europe/Amsterdam:20240301T110000\r\n" +
+		"SUMMARY:Planning\\, quarterly\r\n" +
+		"DESCRIPTION:First line\\nsecond line that is long enough to be folded by\r\n" +
+		"  the server\r\n" +
+		"STATUS:TENTATIVE\r\n" +
+		"LAST-MODIFIED:20240220T080000Z\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:abc@example.com\r\n" +
+		"RECURRENCE-ID:20240308T100000Z\r\n" +
+		"DTSTART:20240308T120000Z\r\n" +
+		"SUMMARY:Moved occurrence\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:holiday@example.com\r\n" +
+		"DTSTART;VALUE=DATE:20240401\r\n" +
+		"SUMMARY:Holiday\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	events, err := parseICalendar(data)
+	if err != nil {
+		t.Fatalf("parseICalendar failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events without the moved occurrence, got %+v", events)
+	}
+	planning := events[0]
+	if planning.Title != "Planning, quarterly" || planning.Description != "First line\nsecond line that is long enough to be folded by the server" {
+		t.Errorf("Unexpected text: %q %q", planning.Title, planning.Description)
+	}
+	if !planning.Start.Equal(time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)) || planning.Status != StatusTentative {
+		t.Errorf("Unexpected start or status: %v %s", planning.Start, planning.Status)
+	}
+	if events[1].Start.Day() != 1 || events[1].Start.Month() != time.April {
+		t.Errorf("Expected an all day event on April 1st, got %v", events[1].Start)
+	}
+
+	planning.Description = strings.Repeat("long; text, ", 20)
+	roundTrip, err := parseICalendar(formatICalendar(planning))
+	if err != nil {
+		t.Fatalf("parseICalendar failed: %v", err)
+	}
+	if len(roundTrip) != 1 || roundTrip[0].Description != planning.Description || !roundTrip[0].End.Equal(planning.End) {
+		t.Errorf("Expected the event to survive a round trip, got %+v", roundTrip)
+	}
+	for _, line := range strings.Split(formatICalendar(planning), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Expected lines folded at 75 octets, got %q", line)
+		}
+	}
+}
+
+func TestCalDAVClient(t *testing.T) {
+	var uploaded string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case "REPORT":
+			w.WriteHeader(http.StatusMultiStatus)
+			io.WriteString(w, `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:" xmlns:cal="urn:ietf:params:xml:ns:caldav">
+  <d:response>
+    <d:href>/cal/standup.ics</d:href>
+    <d:propstat>
+      <d:prop>
+        <d:getetag>"42"</d:getetag>
+        <cal:calendar-data>BEGIN:VCALENDAR
+BEGIN:VEVENT
+UID:standup@example.com
+DTSTART:20240301T100000Z
+SUMMARY:Standup
+END:VEVENT
+END:VCALENDAR
+</cal:calendar-data>
+      </d:prop>
+      <d:status>HTTP/1.1 200 OK</d:status>
+    </d:propstat>
+  </d:response>
+</d:multistatus>`)
+		case http.MethodPut:
+			if r.Header.Get("If-None-Match") != "*" {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			uploaded = r.URL.Path + "\n" + string(body)
+			w.Header().Set("ETag", `"43"`)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &CalDAVClient{URL: server.URL + "/cal/", Token: "secret"}
+	events, err := client.List(context.Background())
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(events) != 1 || events[0].Title != "Standup" || events[0].ETag != `"42"` || events[0].Href != server.URL+"/cal/standup.ics" {
+		t.Fatalf("Unexpected events: %+v", events)
+	}
+
+	created, err := client.Put(context.Background(), RemoteEvent{UID: "dentist@mindpalace", Title: "Dentist", Status: StatusConfirmed, Start: time.Now()})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if created.ETag != `"43"` || !strings.HasPrefix(uploaded, "/cal/dentist@mindpalace.ics\n") || !strings.Contains(uploaded, "SUMMARY:Dentist") {
+		t.Errorf("Unexpected upload %+v: %s", created, uploaded)
+	}
+	if _, err := client.Put(context.Background(), created); err != errPreconditionFailed {
+		t.Errorf("Expected a precondition failure for a changed event, got %v", err)
+	}
+	if err := client.Delete(context.Background(), created.Href, created.ETag); err != nil {
+		t.Errorf("Expected deleting a missing event to succeed, got %v", err)
+	}
+}
+
+func TestCalendarPlugin_CreateEventAsSaid(t *testing.T) {
+	p := NewPlugin().(*CalendarPlugin)
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("No time zone data: %v", err)
+	}
+	p.SetLocation(newYork)
+
+	events, err := p.createEventHandler(&CreateEventInput{Title: "Dentist", StartTime: "tomorrow at 3pm", EndTime: "tomorrow at 4pm"})
+	if err != nil {
+		t.Fatalf("createEventHandler failed: %v", err)
+	}
+	created := events[0].(*EventCreatedEvent)
+	start, _ := time.Parse(time.RFC3339, created.StartTime)
+	tomorrow := time.Now().In(newYork).AddDate(0, 0, 1)
+	if start.Location().String() == "UTC" || start.Hour() != 15 || start.Day() != tomorrow.Day() {
+		t.Errorf("Expected tomorrow 3pm in New York, got %s", created.StartTime)
+	}
+	if _, err := p.createEventHandler(&CreateEventInput{Title: "Dentist", StartTime: "tomorrow at 3"}); err == nil || !strings.Contains(err.Error(), "3pm") {
+		t.Errorf("Expected an error suggesting 3am or 3pm, got %v", err)
+	}
+}
+
+func TestCalendarPlugin_ICSImportExport(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "other.ics")
+	other := formatICalendar(
+		RemoteEvent{UID: "standup@example.com", Title: "Standup", Status: StatusConfirmed,
+			Start: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), End: time.Date(2024, 3, 1, 10, 15, 0, 0, time.UTC)},
+		RemoteEvent{UID: "dentist@example.com", Title: "Dentist", Location: "Main Street 1", Status: StatusTentative,
+			Start: time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC)},
+	)
+	if err := os.WriteFile(file, []byte(other), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := NewPlugin().(*CalendarPlugin)
+	imported := func() *ICSImportedEvent {
+		t.Helper()
+		events := run(t, p, "ImportICS", &ImportICSInput{Path: file})
+		return events[len(events)-1].(*ICSImportedEvent)
+	}
+
+	if s := imported(); s.Created != 2 || len(p.aggregate.Events) != 2 {
+		t.Fatalf("Expected both events created, got %+v", s)
+	}
+	if dentist := eventByTitle(p, "Dentist"); dentist == nil || dentist.UID != "dentist@example.com" || dentist.Location != "Main Street 1" {
+		t.Fatalf("Expected the dentist imported with its UID, got %+v", dentist)
+	}
+
+	// Importing the file again changes nothing, an event changed since is updated
+	if s := imported(); s.Created+s.Updated != 0 || s.Unchanged != 2 {
+		t.Errorf("Expected nothing imported again, got %+v", s)
+	}
+	other = strings.Replace(other, "SUMMARY:Standup", "SUMMARY:Daily standup", 1)
+	if err := os.WriteFile(file, []byte(other), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if s := imported(); s.Updated != 1 || len(p.aggregate.Events) != 2 || eventByTitle(p, "Daily standup") == nil {
+		t.Errorf("Expected the standup updated, got %+v", s)
+	}
+
+	// Exported events keep their UIDs, those created here get one
+	run(t, p, "CreateEvent", &CreateEventInput{Title: "Lunch", StartTime: "2024-03-03T12:00:00Z"})
+	exported := filepath.Join(dir, "mindpalace.ics")
+	events := run(t, p, "ExportICS", &ExportICSInput{Path: exported, From: "2024-03-02T00:00:00Z"})
+	if e := events[0].(*ICSExportedEvent); e.Events != 2 {
+		t.Errorf("Expected the events from March 2 exported, got %d", e.Events)
+	}
+	data, err := os.ReadFile(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parseICalendar(string(data))
+	if err != nil || len(parsed) != 2 {
+		t.Fatalf("Expected 2 events in the exported file, got %v (%v)", parsed, err)
+	}
+	if parsed[0].UID != "dentist@example.com" || !strings.HasSuffix(parsed[1].UID, "@mindpalace") || parsed[1].Title != "Lunch" {
+		t.Errorf("Expected the dentist and lunch exported with UIDs, got %+v", parsed)
+	}
+
+	if _, err := p.importICSHandler(&ImportICSInput{Path: filepath.Join(dir, "other.txt")}); err == nil {
+		t.Error("Expected an error importing a file that is not .ics")
+	}
+}
+
+func TestLayoutDay(t *testing.T) {
+	at := func(clock string) time.Time {
+		t, _ := time.Parse(time.RFC3339, "2024-03-04T"+clock+":00Z")
+		return t
+	}
+	events := []*CalendarEvent{
+		{EventID: "lunch", StartTime: at("12:00"), EndTime: at("13:00")},
+		{EventID: "standup", StartTime: at("09:00"), EndTime: at("09:15")},
+		{EventID: "review", StartTime: at("09:00"), EndTime: at("10:00")},
+		{EventID: "call", StartTime: at("09:30")}, // Lasts an hour without an end
+		{EventID: "focus", StartTime: at("10:00"), EndTime: at("11:00")},
+	}
+
+	groups := layoutDay(events)
+	var got [][]string
+	for _, group := range groups {
+		var placed []string
+		for _, p := range group {
+			placed = append(placed, fmt.Sprintf("%s:%d", p.event.EventID, p.column))
+		}
+		got = append(got, placed)
+	}
+	want := [][]string{{"standup:0", "review:1", "call:0", "focus:1"}, {"lunch:0"}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected groups %v, got %v", want, got)
+	}
+	if columns := groupColumns(groups[0]); columns != 2 {
+		t.Errorf("Expected the overlapping events in 2 columns, got %d", columns)
+	}
+}
+
+func TestCalendarAggregate_Lanes(t *testing.T) {
+	agg := NewCalendarAggregate()
+	agg.location = time.UTC
+	today := startOfDay(time.Now(), time.UTC)
+	tomorrow := today.AddDate(0, 0, 1)
+	for _, e := range []*EventCreatedEvent{
+		{EventID: "a", Title: "Morning", StartTime: tomorrow.Add(6 * time.Hour).Format(time.RFC3339)},
+		{EventID: "b", Title: "Overlap", StartTime: tomorrow.Add(6*time.Hour + 30*time.Minute).Format(time.RFC3339)},
+		{EventID: "c", Title: "Today", StartTime: today.Add(18 * time.Hour).Format(time.RFC3339)},
+	} {
+		e.EventType = "calendar_EventCreated"
+		agg.ApplyEvent(e)
+	}
+
+	positions := make(map[string][]float64)
+	for _, action := range agg.GetFull3DState() {
+		if action.Type == "create" {
+			positions[action.NodeID], _ = action.Properties["position"].([]float64)
+		}
+	}
+	if pos := positions["calendar_event_c"]; pos == nil || pos[0] != 0 {
+		t.Errorf("Expected today's event in the lane at 0, got %v", pos)
+	}
+	a, b := positions["calendar_event_a"], positions["calendar_event_b"]
+	if a == nil || b == nil || a[0] != dayWidth || b[0] != dayWidth {
+		t.Fatalf("Expected tomorrow's events in the next lane, got %v and %v", a, b)
+	}
+	if a[1] <= positions["calendar_event_c"][1] {
+		t.Errorf("Expected the morning event above the evening one, got %v and %v", a, positions["calendar_event_c"])
+	}
+	if b[2] >= a[2] {
+		t.Errorf("Expected the overlapping event behind the first, got %v and %v", a, b)
+	}
+	if positions[laneNodeID(tomorrow)] == nil || positions[laneNodeID(today)] == nil {
+		t.Errorf("Expected the lanes of both days labeled, got %v", positions)
+	}
+
+	// Moving an event a lane over moves it a day, as dragging its card does
+	p := &CalendarPlugin{aggregate: agg}
+	command, input := p.HandleInteraction(eventsourcing.Interaction{Kind: eventsourcing.ObjectMoved, NodeID: "calendar_event_c", From: positions["calendar_event_c"], Position: a})
+	if update, ok := input.(*UpdateEventInput); command != "UpdateEvent" || !ok || update.StartTime != tomorrow.Add(18*time.Hour).Format(time.RFC3339) {
+		t.Errorf("Expected the event moved to tomorrow, got %s %+v", command, input)
+	}
+}
+
+// fixedLinks links every event to the same items
+type fixedLinks []eventsourcing.Item
+
+func (l fixedLinks) LinkedItems(aggregate, id string) []eventsourcing.Item { return l }
+
+func TestCalendarPlugin_LinkedItems(t *testing.T) {
+	p := NewPlugin().(*CalendarPlugin)
+	p.aggregate.ApplyEvent(&EventCreatedEvent{EventType: "calendar_EventCreated", EventID: "e1", Title: "Friday meeting",
+		StartTime: time.Now().Format(time.RFC3339)})
+
+	item, exists := p.aggregate.Item("e1")
+	if !exists || item.Title != "Friday meeting" || item.Aggregate != "calendar" || item.NodeID != "calendar_event_e1" {
+		t.Errorf("Expected the event as an item, got %+v", item)
+	}
+	if _, exists := p.aggregate.Item("e9"); exists {
+		t.Error("Expected no item for a missing event")
+	}
+
+	var aware eventsourcing.LinkAware = p
+	aware.SetLinkSource(fixedLinks{{Aggregate: "taskmanager", ID: "t1", Title: "Prepare slides"}})
+	var label interface{}
+	for _, action := range p.aggregate.GetFull3DState() {
+		if action.NodeID == "calendar_event_e1_label" {
+			label = action.Properties["text"]
+		}
+	}
+	if label != "Friday meeting  ↔1" {
+		t.Errorf("Expected the card's label to count the linked item, got %v", label)
+	}
+}
+
+func TestCalendarView(t *testing.T) {
+	day := time.Date(2024, time.February, 14, 0, 0, 0, 0, time.UTC) // A Wednesday
+	month := calendarView{Mode: viewMonth, Day: day}
+	days := month.days()
+	if len(days) != 35 || days[0].Format("2006-01-02") != "2024-01-29" || days[34].Format("2006-01-02") != "2024-03-03" {
+		t.Errorf("Expected the weeks of February from Monday, got %d days from %s to %s", len(days), days[0], days[len(days)-1])
+	}
+	if next := month.move(1); next.Day.Format("2006-01-02") != "2024-03-01" {
+		t.Errorf("Expected the next month, got %s", next.Day)
+	}
+	week := calendarView{Mode: viewWeek, Day: day}
+	days = week.days()
+	if len(days) != 7 || days[0].Weekday() != time.Monday || days[0].Day() != 12 {
+		t.Errorf("Expected the week from Monday the 12th, got %v", days)
+	}
+	if title := week.move(-1).title(); title != "Week of 5 February 2024" {
+		t.Errorf("Expected the week before, got %s", title)
+	}
+	if shown := (calendarView{}).shown(day); shown.Mode != viewMonth || !shown.Day.Equal(day) {
+		t.Errorf("Expected the month of today by default, got %+v", shown)
+	}
+}
+
+func TestCalendarPlugin_Examples(t *testing.T) {
+	p := NewPlugin().(*CalendarPlugin)
+	for _, example := range p.Examples() {
+		schema, exists := p.Schemas()[example.Command]
+		if !exists {
+			t.Errorf("Example %q calls unknown command %s", example.Request, example.Command)
+			continue
+		}
+		data, _ := json.Marshal(example.Arguments)
+		decoder := json.NewDecoder(strings.NewReader(string(data)))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(schema.New()); err != nil {
+			t.Errorf("Example %q has arguments %s doesn't take: %v", example.Request, example.Command, err)
+		}
+	}
+}
+
+// fuzzSkipped are the commands reaching files or the CalDAV server
+var fuzzSkipped = []string{"SyncCalendar", "ImportICS", "ExportICS"}
+
+func TestCommands_Fuzz(t *testing.T) {
+	fuzzer := eventsourcing.NewCommandFuzzer(NewPlugin(), 1)
+	fuzzer.Skip = fuzzSkipped
+	for _, err := range fuzzer.Run(200) {
+		t.Error(err)
+	}
+}
+
+func FuzzCommands(f *testing.F) {
+	f.Add(int64(1))
+	f.Fuzz(func(t *testing.T, seed int64) {
+		fuzzer := eventsourcing.NewCommandFuzzer(NewPlugin(), seed)
+		fuzzer.Skip = fuzzSkipped
+		for _, err := range fuzzer.Run(10) {
+			t.Error(err)
+		}
+	})
+}
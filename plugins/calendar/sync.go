@@ -0,0 +1,508 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+const (
+	// defaultSyncInterval is how often the calendar syncs when sync_interval is not configured
+	defaultSyncInterval = 15 * time.Minute
+	// syncTimeout bounds a single sync with the remote calendar
+	syncTimeout = 2 * time.Minute
+)
+
+// SyncLink ties a local event to its copy in the remote calendar
+type SyncLink struct {
+	UID   string `json:"uid"`
+	Href  string `json:"href,omitempty"`
+	ETag  string `json:"etag,omitempty"`
+	Dirty bool   `json:"dirty,omitempty"` // Changed locally since the last sync
+}
+
+// EventLinkedEvent is emitted when a local event was synced with the remote calendar
+type EventLinkedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	EventID   string `json:"event_id"`
+	UID       string `json:"uid"`
+	Href      string `json:"href"`
+	ETag      string `json:"etag"`
+}
+
+func (e *EventLinkedEvent) Type() string { return "calendar_EventLinked" }
+func (e *EventLinkedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *EventLinkedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// EventUnlinkedEvent is emitted when a local event no longer has a remote copy
+type EventUnlinkedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	EventID   string `json:"event_id"`
+}
+
+func (e *EventUnlinkedEvent) Type() string { return "calendar_EventUnlinked" }
+func (e *EventUnlinkedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *EventUnlinkedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// CalendarSyncedEvent summarizes a sync with the remote calendar
+type CalendarSyncedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Pulled    int    `json:"pulled"`    // Remote changes applied locally
+	Pushed    int    `json:"pushed"`    // Local changes uploaded
+	Deleted   int    `json:"deleted"`   // Events deleted on either side
+	Conflicts int    `json:"conflicts"` // Events changed on both sides, the last modified side won
+	Error     string `json:"error,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *CalendarSyncedEvent) Type() string { return "calendar_CalendarSynced" }
+func (e *CalendarSyncedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *CalendarSyncedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// SyncStatusReportedEvent reports the state of the calendar sync
+type SyncStatusReportedEvent struct {
+	eventsourcing.EventMetadata
+	EventType      string               `json:"event_type"`
+	Configured     bool                 `json:"configured"`
+	URL            string               `json:"url,omitempty"`
+	Interval       string               `json:"interval,omitempty"`
+	LastSync       *CalendarSyncedEvent `json:"last_sync,omitempty"`
+	Linked         int                  `json:"linked"`          // Events with a remote copy
+	PendingChanges int                  `json:"pending_changes"` // Local changes the next sync pushes
+}
+
+func (e *SyncStatusReportedEvent) Type() string { return "calendar_SyncStatusReported" }
+func (e *SyncStatusReportedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *SyncStatusReportedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+func (i *SyncCalendarInput) New() any {
+	return &SyncCalendarInput{}
+}
+
+// SyncCalendarInput defines the input for syncing with the remote calendar
+type SyncCalendarInput struct{}
+
+func (s *SyncCalendarInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Syncs the calendar with the configured CalDAV or Google calendar in both directions",
+		"parameters": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+	}
+}
+
+func (i *CalendarSyncStatusInput) New() any {
+	return &CalendarSyncStatusInput{}
+}
+
+// CalendarSyncStatusInput defines the input for reporting the sync status
+type CalendarSyncStatusInput struct{}
+
+func (s *CalendarSyncStatusInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Reports when the calendar last synced with the remote calendar and what is pending",
+		"parameters": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+	}
+}
+
+// applySyncEvent updates the sync state of the aggregate, the caller holds the lock
+func (a *CalendarAggregate) applySyncEvent(eventType string, data []byte) error {
+	switch eventType {
+	case "calendar_EventLinked":
+		var e EventLinkedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal EventLinked: %v", err)
+		}
+		a.Links[e.EventID] = &SyncLink{UID: e.UID, Href: e.Href, ETag: e.ETag}
+		delete(a.PendingDeletes, e.EventID)
+	case "calendar_EventUnlinked":
+		var e EventUnlinkedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal EventUnlinked: %v", err)
+		}
+		delete(a.Links, e.EventID)
+		delete(a.PendingDeletes, e.EventID)
+	case "calendar_CalendarSynced":
+		var e CalendarSyncedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal CalendarSynced: %v", err)
+		}
+		a.LastSync = &e
+	}
+	return nil
+}
+
+// pendingChanges counts the local changes the next sync pushes
+func (a *CalendarAggregate) pendingChanges() int {
+	pending := len(a.PendingDeletes)
+	for id := range a.Events {
+		if link, linked := a.Links[id]; !linked || link.Dirty {
+			pending++
+		}
+	}
+	return pending
+}
+
+// syncer holds the state of a single sync
+type syncer struct {
+	ctx     context.Context
+	remote  RemoteCalendar
+	events  []eventsourcing.Event
+	summary CalendarSyncedEvent
+	errors  []string
+}
+
+// syncCalendar syncs the local events, their links and the deleted linked events with the remote
+// calendar. It returns the events applying the remote changes and recording the pushed ones,
+// followed by a CalendarSyncedEvent.
+func syncCalendar(ctx context.Context, remote RemoteCalendar, events map[string]CalendarEvent, links, deletes map[string]SyncLink) []eventsourcing.Event {
+	s := &syncer{ctx: ctx, remote: remote}
+	remoteEvents, err := remote.List(ctx)
+	if err != nil {
+		s.fail(err)
+		return s.finish()
+	}
+	sort.Slice(remoteEvents, func(i, j int) bool { return remoteEvents[i].UID < remoteEvents[j].UID })
+
+	linkedByUID := make(map[string]string, len(links))
+	for id, link := range links {
+		linkedByUID[link.UID] = id
+	}
+	deletedUIDs := make(map[string]bool, len(deletes))
+	for _, link := range deletes {
+		deletedUIDs[link.UID] = true
+	}
+
+	// Apply remote changes, resolving events changed on both sides by their last modification
+	onRemote := make(map[string]bool, len(remoteEvents))
+	for _, r := range remoteEvents {
+		onRemote[r.UID] = true
+		if deletedUIDs[r.UID] {
+			continue
+		}
+		id, linked := linkedByUID[r.UID]
+		local, exists := events[id]
+		if !linked || !exists {
+			s.pullNew(r)
+			continue
+		}
+		link := links[id]
+		remoteChanged := r.ETag != link.ETag
+		switch {
+		case remoteChanged && link.Dirty:
+			s.summary.Conflicts++
+			if r.LastModified.After(local.UpdatedAt) {
+				s.pull(id, r)
+			} else {
+				link.Href, link.ETag = r.Href, r.ETag
+				s.push(local, link)
+			}
+		case remoteChanged:
+			s.pull(id, r)
+		case link.Dirty:
+			s.push(local, link)
+		}
+	}
+
+	// Events deleted remotely are deleted locally, unless they changed locally since
+	for _, id := range sortedKeys(links) {
+		link := links[id]
+		local, exists := events[id]
+		if onRemote[link.UID] || !exists {
+			continue
+		}
+		if link.Dirty {
+			s.summary.Conflicts++
+			s.push(local, SyncLink{UID: link.UID})
+			continue
+		}
+		s.events = append(s.events,
+			&EventUnlinkedEvent{EventType: "calendar_EventUnlinked", EventID: id},
+			&EventDeletedEvent{EventType: "calendar_EventDeleted", EventID: id},
+		)
+		s.summary.Deleted++
+	}
+
+	// Events deleted locally are deleted remotely, unless they changed remotely since
+	for _, id := range sortedKeys(deletes) {
+		link := deletes[id]
+		if onRemote[link.UID] {
+			err := remote.Delete(ctx, link.Href, link.ETag)
+			if errors.Is(err, errPreconditionFailed) {
+				// The remote event is pulled again by the next sync
+				s.summary.Conflicts++
+			} else if err != nil {
+				s.fail(err)
+				continue
+			} else {
+				s.summary.Deleted++
+			}
+		}
+		s.events = append(s.events, &EventUnlinkedEvent{EventType: "calendar_EventUnlinked", EventID: id})
+	}
+
+	// Events created locally are created remotely
+	for _, id := range sortedKeys(events) {
+		if _, linked := links[id]; !linked {
+			s.push(events[id], SyncLink{UID: newUID(id)})
+		}
+	}
+	return s.finish()
+}
+
+// pullNew creates a local event for an event created remotely
+func (s *syncer) pullNew(r RemoteEvent) {
+	id := generateEventID()
+	created := &EventCreatedEvent{
+		EventType:   "calendar_EventCreated",
+		EventID:     id,
+		Title:       r.Title,
+		Description: r.Description,
+		Status:      r.Status,
+		Importance:  ImportanceMedium,
+		StartTime:   r.Start.Format(time.RFC3339),
+		Location:    r.Location,
+		Timestamp:   modifiedAt(r),
+	}
+	if !r.End.IsZero() {
+		created.EndTime = r.End.Format(time.RFC3339)
+	}
+	s.events = append(s.events, created, linkedEvent(id, r))
+	s.summary.Pulled++
+}
+
+// pull applies a remote change to the local event
+func (s *syncer) pull(id string, r RemoteEvent) {
+	updated := &EventUpdatedEvent{
+		EventType:   "calendar_EventUpdated",
+		EventID:     id,
+		Title:       r.Title,
+		Description: r.Description,
+		Status:      r.Status,
+		StartTime:   r.Start.Format(time.RFC3339),
+		Location:    r.Location,
+		Timestamp:   modifiedAt(r),
+	}
+	if !r.End.IsZero() {
+		updated.EndTime = r.End.Format(time.RFC3339)
+	}
+	s.events = append(s.events, updated, linkedEvent(id, r))
+	s.summary.Pulled++
+}
+
+// push uploads the local event, replacing the remote copy the link refers to
+func (s *syncer) push(local CalendarEvent, link SyncLink) {
+	r, err := s.remote.Put(s.ctx, RemoteEvent{
+		UID:          link.UID,
+		Href:         link.Href,
+		ETag:         link.ETag,
+		Title:        local.Title,
+		Description:  local.Description,
+		Location:     local.Location,
+		Status:       local.Status,
+		Start:        local.StartTime,
+		End:          local.EndTime,
+		LastModified: local.UpdatedAt,
+	})
+	if errors.Is(err, errPreconditionFailed) {
+		// Changed remotely during the sync, the next sync resolves the conflict
+		s.summary.Conflicts++
+		return
+	}
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	s.events = append(s.events, linkedEvent(local.EventID, r))
+	s.summary.Pushed++
+}
+
+func (s *syncer) fail(err error) {
+	logging.Error("CALENDAR: Sync failed: %v", err)
+	s.errors = append(s.errors, err.Error())
+}
+
+func (s *syncer) finish() []eventsourcing.Event {
+	s.summary.EventType = "calendar_CalendarSynced"
+	s.summary.Error = strings.Join(s.errors, "; ")
+	s.summary.Timestamp = eventsourcing.ISOTimestamp()
+	logging.Info("CALENDAR: Synced, pulled %d, pushed %d, deleted %d, %d conflicts",
+		s.summary.Pulled, s.summary.Pushed, s.summary.Deleted, s.summary.Conflicts)
+	summary := s.summary
+	return append(s.events, &summary)
+}
+
+func linkedEvent(id string, r RemoteEvent) *EventLinkedEvent {
+	return &EventLinkedEvent{EventType: "calendar_EventLinked", EventID: id, UID: r.UID, Href: r.Href, ETag: r.ETag}
+}
+
+// modifiedAt returns when the remote event was last modified, now if the server doesn't say
+func modifiedAt(r RemoteEvent) string {
+	if r.LastModified.IsZero() {
+		return eventsourcing.ISOTimestamp()
+	}
+	return r.LastModified.UTC().Format(time.RFC3339)
+}
+
+// newUID returns the iCalendar UID of a local event synced for the first time
+func newUID(eventID string) string {
+	return fmt.Sprintf("%s-%d@mindpalace", eventID, time.Now().UnixNano())
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// syncState copies the state a sync works on, so the remote calendar is accessed without the lock
+func (a *CalendarAggregate) syncState() (map[string]CalendarEvent, map[string]SyncLink, map[string]SyncLink) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	events := make(map[string]CalendarEvent, len(a.Events))
+	for id, event := range a.Events {
+		events[id] = *event
+	}
+	links := make(map[string]SyncLink, len(a.Links))
+	for id, link := range a.Links {
+		links[id] = *link
+	}
+	deletes := make(map[string]SyncLink, len(a.PendingDeletes))
+	for id, link := range a.PendingDeletes {
+		deletes[id] = *link
+	}
+	return events, links, deletes
+}
+
+// Configure applies the [plugin.calendar] settings of the configuration file: caldav_url, username
+// and password or token, and sync_interval ("0" syncs on request only)
+func (p *CalendarPlugin) Configure(settings map[string]interface{}) error {
+	rawURL, _ := settings["caldav_url"].(string)
+	interval := defaultSyncInterval
+	if value, ok := settings["sync_interval"].(string); ok && value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("sync_interval %s cannot be parsed", value)
+		}
+		interval = parsed
+	}
+
+	var remote *CalDAVClient
+	if rawURL != "" {
+		parsed, err := url.Parse(rawURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("caldav_url %s must be an http or https URL", rawURL)
+		}
+		remote = &CalDAVClient{URL: rawURL}
+		remote.Username, _ = settings["username"].(string)
+		remote.Password, _ = settings["password"].(string)
+		remote.Token, _ = settings["token"].(string)
+	}
+
+	p.syncConfigMu.Lock()
+	defer p.syncConfigMu.Unlock()
+	if p.stopSync != nil {
+		close(p.stopSync)
+		p.stopSync = nil
+	}
+	p.remote, p.remoteURL, p.syncInterval = nil, rawURL, interval
+	if remote == nil {
+		return nil
+	}
+	p.remote = remote
+	if interval > 0 {
+		p.stopSync = make(chan struct{})
+		go p.syncLoop(remote, interval, p.stopSync)
+	}
+	return nil
+}
+
+// syncLoop syncs periodically until stop is closed
+func (p *CalendarPlugin) syncLoop(remote RemoteCalendar, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			eventBus := eventsourcing.GetGlobalEventBus()
+			if eventBus == nil || !p.syncMu.TryLock() {
+				continue
+			}
+			for _, event := range p.sync(remote) {
+				eventBus.Publish(event)
+			}
+			p.syncMu.Unlock()
+		}
+	}
+}
+
+func (p *CalendarPlugin) sync(remote RemoteCalendar) []eventsourcing.Event {
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+	events, links, deletes := p.aggregate.syncState()
+	return syncCalendar(ctx, remote, events, links, deletes)
+}
+
+func (p *CalendarPlugin) syncCalendarHandler(input *SyncCalendarInput) ([]eventsourcing.Event, error) {
+	p.syncConfigMu.Lock()
+	remote := p.remote
+	p.syncConfigMu.Unlock()
+	if remote == nil {
+		return nil, fmt.Errorf("calendar sync is not configured, set caldav_url in [plugin.calendar]")
+	}
+	p.syncMu.Lock()
+	defer p.syncMu.Unlock()
+	return p.sync(remote), nil
+}
+
+func (p *CalendarPlugin) syncStatusHandler(input *CalendarSyncStatusInput) ([]eventsourcing.Event, error) {
+	p.syncConfigMu.Lock()
+	status := &SyncStatusReportedEvent{
+		EventType:  "calendar_SyncStatusReported",
+		Configured: p.remote != nil,
+		URL:        p.remoteURL,
+	}
+	if p.remote != nil {
+		status.Interval = p.syncInterval.String()
+	}
+	p.syncConfigMu.Unlock()
+
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	status.LastSync = p.aggregate.LastSync
+	status.Linked = len(p.aggregate.Links)
+	status.PendingChanges = p.aggregate.pendingChanges()
+	return []eventsourcing.Event{status}, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/ui3d"
+)
+
+// placedEvent is an event of a day with the column it takes among the events it overlaps
+type placedEvent struct {
+	event  *CalendarEvent
+	column int
+}
+
+// layoutDay places the events of a day side by side where they overlap. Each event takes the first
+// column free when it starts; events overlapping each other, directly or through others, form a group
+// sharing its columns. The groups are returned in order of time.
+func layoutDay(events []*CalendarEvent) [][]placedEvent {
+	sorted := append([]*CalendarEvent(nil), events...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].StartTime.Before(sorted[j].StartTime) })
+	var groups [][]placedEvent
+	var columnEnds []time.Time // End of the last event in each column of the group
+	var groupEnd time.Time
+	for _, event := range sorted {
+		start, end := event.StartTime, eventEnd(event)
+		if len(groups) == 0 || !start.Before(groupEnd) {
+			groups = append(groups, nil)
+			columnEnds = columnEnds[:0]
+		}
+		column := 0
+		for column < len(columnEnds) && start.Before(columnEnds[column]) {
+			column++
+		}
+		if column == len(columnEnds) {
+			columnEnds = append(columnEnds, end)
+		} else {
+			columnEnds[column] = end
+		}
+		if end.After(groupEnd) {
+			groupEnd = end
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], placedEvent{event: event, column: column})
+	}
+	return groups
+}
+
+// groupColumns returns the number of columns a group of overlapping events takes
+func groupColumns(group []placedEvent) int {
+	columns := 0
+	for _, placed := range group {
+		if placed.column >= columns {
+			columns = placed.column + 1
+		}
+	}
+	return columns
+}
+
+// eventEnd returns when an event ends, an hour after it starts if it has no end
+func eventEnd(event *CalendarEvent) time.Time {
+	if event.EndTime.After(event.StartTime) {
+		return event.EndTime
+	}
+	return event.StartTime.Add(time.Hour)
+}
+
+// startOfDay returns midnight of the day of t in the time zone
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.In(loc).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// daysBetween returns how many days the second day is after the first, both at midnight
+func daysBetween(from, to time.Time) int {
+	fromYear, fromMonth, fromDay := from.Date()
+	toYear, toMonth, toDay := to.Date()
+	fromUTC := time.Date(fromYear, fromMonth, fromDay, 0, 0, 0, 0, time.UTC)
+	toUTC := time.Date(toYear, toMonth, toDay, 0, 0, 0, 0, time.UTC)
+	return int(toUTC.Sub(fromUTC).Hours() / 24)
+}
+
+// eventsOn returns the events starting on the day, in the time zone
+func eventsOn(events []*CalendarEvent, day time.Time, loc *time.Location) []*CalendarEvent {
+	var onDay []*CalendarEvent
+	for _, event := range events {
+		if startOfDay(event.StartTime, loc).Equal(day) {
+			onDay = append(onDay, event)
+		}
+	}
+	return onDay
+}
+
+// Layout of the timeline in the 3D world: a lane per day along the x axis, a card width apart so
+// dragging a card a lane over moves its event a day, today at 0. Within a lane the cards go down as
+// the day goes on, and events overlapping others stand behind them.
+const (
+	laneTop      = 3.5  // Height of a card starting at midnight
+	laneHeight   = 3.0  // Height a card goes down over the day
+	laneZ        = -8.0 // Depth of the first column of a lane
+	laneColumnZ  = 1.5  // Depth between the columns of overlapping events
+	laneLabelTop = 5.0  // Height of the label naming the day
+)
+
+// lanePosition returns where the card of an event goes in its lane
+func lanePosition(event *CalendarEvent, column int, today time.Time, loc *time.Location) []float64 {
+	day := startOfDay(event.StartTime, loc)
+	dayFraction := event.StartTime.In(loc).Sub(day).Hours() / 24
+	return []float64{
+		float64(daysBetween(today, day)) * dayWidth,
+		laneTop - dayFraction*laneHeight,
+		laneZ - float64(column)*laneColumnZ,
+	}
+}
+
+// laneNodeID is the node of the label naming a day above its lane
+func laneNodeID(day time.Time) string {
+	return "calendar_day_" + day.Format("2006-01-02")
+}
+
+// laneActions lays out the lane of a day: the label naming it and the cards of its events, replacing
+// the cards shown before. The event gets the event type given, the others are shown as they were.
+func (a *CalendarAggregate) laneActions(day time.Time, eventID, eventType string) []eventsourcing.DeltaAction {
+	theme := ui3d.CurrentTheme()
+	loc := a.timeZone()
+	today := startOfDay(time.Now(), loc)
+	events := make([]*CalendarEvent, 0, len(a.Events))
+	for _, event := range a.Events {
+		events = append(events, event)
+	}
+	label := ui3d.CreateLabel(laneNodeID(day), day.Format("Mon 2 Jan"),
+		[]float64{float64(daysBetween(today, day)) * dayWidth, laneLabelTop, laneZ}, theme)
+	label.Properties["arrangement"] = "timeline"
+	actions := []eventsourcing.DeltaAction{label}
+	for _, group := range layoutDay(eventsOn(events, day, loc)) {
+		for _, placed := range group {
+			nodeID := fmt.Sprintf("calendar_event_%s", placed.event.EventID)
+			// Cards shown before are replaced, a created event has none yet
+			if eventType != "calendar_event" && !(eventType == "calendar_event_created" && placed.event.EventID == eventID) {
+				actions = append(actions,
+					eventsourcing.DeltaAction{Type: "delete", NodeID: nodeID},
+					eventsourcing.DeltaAction{Type: "delete", NodeID: nodeID + "_label"},
+				)
+			}
+			cardType := "calendar_event"
+			if placed.event.EventID == eventID {
+				cardType = eventType
+			}
+			title := ui3d.LinkBadge(placed.event.Title, len(a.linkedItems(placed.event.EventID)))
+			cards := ui3d.CreateCard(nodeID, title, lanePosition(placed.event, placed.column, today, loc), theme)
+			for j := range cards {
+				cards[j].Properties["event_type"] = cardType
+				cards[j].Properties["arrangement"] = "timeline"
+			}
+			actions = append(actions, cards...)
+		}
+	}
+	return actions
+}
+
+// laneDays returns the days with events, in order
+func (a *CalendarAggregate) laneDays() []time.Time {
+	loc := a.timeZone()
+	seen := make(map[time.Time]bool)
+	var days []time.Time
+	for _, event := range a.Events {
+		if day := startOfDay(event.StartTime, loc); !seen[day] {
+			seen[day] = true
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+// timeZone returns the time zone of the user, the local one until provided (caller holds the lock)
+func (a *CalendarAggregate) timeZone() *time.Location {
+	if a.location != nil {
+		return a.location
+	}
+	return time.Local
+}
@@ -0,0 +1,1101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/ui3d"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// maxRequests is how many of the latest user requests are kept to find mentions of contacts in
+const maxRequests = 500
+
+// maxMentions is how many of the latest mentions a contact history reports
+const maxMentions = 5
+
+// ImportantDate is a yearly date to remember for a contact, like a birthday
+type ImportantDate struct {
+	Label string `json:"label"`
+	Date  string `json:"date"` // YYYY-MM-DD, or MM-DD when the year is unknown
+}
+
+// Contact represents a person the user knows
+type Contact struct {
+	ContactID      string          `json:"contact_id"`
+	Name           string          `json:"name"`
+	Email          string          `json:"email,omitempty"`
+	Aliases        []string        `json:"aliases,omitempty"`
+	Relationship   string          `json:"relationship,omitempty"`
+	Notes          string          `json:"notes,omitempty"`
+	ImportantDates []ImportantDate `json:"important_dates,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at,omitempty"`
+}
+
+// Meeting is a calendar event, kept to link its attendees to contacts
+type Meeting struct {
+	EventID   string    `json:"event_id"`
+	Title     string    `json:"title"`
+	StartTime time.Time `json:"start_time"`
+	Attendees []string  `json:"attendees,omitempty"`
+}
+
+// Mention is a user request naming a contact
+type Mention struct {
+	RequestID string    `json:"request_id"`
+	Text      string    `json:"text"`
+	Time      time.Time `json:"time"`
+}
+
+// ContactsAggregate manages the contacts along with the calendar events and requests they appear in
+type ContactsAggregate struct {
+	Contacts map[string]*Contact
+	Meetings map[string]*Meeting // Calendar events, by event ID
+	Requests []Mention           // Latest user requests, oldest first
+	commands map[string]eventsourcing.CommandHandler
+	Mu       sync.RWMutex
+}
+
+// NewContactsAggregate creates a new thread-safe ContactsAggregate
+func NewContactsAggregate() *ContactsAggregate {
+	return &ContactsAggregate{
+		Contacts: make(map[string]*Contact),
+		Meetings: make(map[string]*Meeting),
+		commands: make(map[string]eventsourcing.CommandHandler),
+	}
+}
+
+// ID returns the aggregate's identifier
+func (a *ContactsAggregate) ID() string {
+	return "contacts"
+}
+
+// contactsSnapshot is the state saved in a snapshot
+type contactsSnapshot struct {
+	Contacts map[string]*Contact `json:"contacts"`
+	Meetings map[string]*Meeting `json:"meetings,omitempty"`
+	Requests []Mention           `json:"requests,omitempty"`
+}
+
+// SaveSnapshot serializes the current state so it can be restored without a full replay
+func (a *ContactsAggregate) SaveSnapshot() ([]byte, error) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return json.Marshal(contactsSnapshot{Contacts: a.Contacts, Meetings: a.Meetings, Requests: a.Requests})
+}
+
+// LoadSnapshot replaces the current state with that from a snapshot
+func (a *ContactsAggregate) LoadSnapshot(data []byte) error {
+	var snapshot contactsSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to unmarshal snapshot: %v", err)
+	}
+	if snapshot.Contacts == nil {
+		snapshot.Contacts = make(map[string]*Contact)
+	}
+	if snapshot.Meetings == nil {
+		snapshot.Meetings = make(map[string]*Meeting)
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	a.Contacts = snapshot.Contacts
+	a.Meetings = snapshot.Meetings
+	a.Requests = snapshot.Requests
+	return nil
+}
+
+// Deadlines returns the next occurrence of the important dates of all contacts
+func (a *ContactsAggregate) Deadlines() []eventsourcing.Deadline {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	now := time.Now()
+	var deadlines []eventsourcing.Deadline
+	for _, contact := range a.Contacts {
+		for i, date := range contact.ImportantDates {
+			due, ok := nextOccurrence(date.Date, now)
+			if !ok {
+				continue
+			}
+			deadlines = append(deadlines, eventsourcing.Deadline{
+				ID:     fmt.Sprintf("%s_date_%d", contact.ContactID, i),
+				Title:  fmt.Sprintf("%s: %s", contact.Name, date.Label),
+				Due:    due,
+				NodeID: fmt.Sprintf("contact_%s", contact.ContactID),
+			})
+		}
+	}
+	return deadlines
+}
+
+// ApplyEvent updates the contacts, and records the calendar events and user requests they may appear in
+func (a *ContactsAggregate) ApplyEvent(event eventsourcing.Event) error {
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event %s: %v", event.Type(), err)
+	}
+
+	switch event.Type() {
+	case "contacts_ContactCreated":
+		var e ContactCreatedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal ContactCreated: %v", err)
+		}
+		a.Contacts[e.ContactID] = &Contact{
+			ContactID:      e.ContactID,
+			Name:           e.Name,
+			Email:          e.Email,
+			Aliases:        e.Aliases,
+			Relationship:   e.Relationship,
+			Notes:          e.Notes,
+			ImportantDates: e.ImportantDates,
+			CreatedAt:      parseTime(e.Timestamp),
+			UpdatedAt:      parseTime(e.Timestamp),
+		}
+
+	case "contacts_ContactUpdated":
+		var e ContactUpdatedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal ContactUpdated: %v", err)
+		}
+		if contact, exists := a.Contacts[e.ContactID]; exists {
+			if e.Name != "" {
+				contact.Name = e.Name
+			}
+			if e.Email != "" {
+				contact.Email = e.Email
+			}
+			if e.Aliases != nil {
+				contact.Aliases = e.Aliases
+			}
+			if e.Relationship != "" {
+				contact.Relationship = e.Relationship
+			}
+			if e.Notes != "" {
+				contact.Notes = e.Notes
+			}
+			if e.ImportantDates != nil {
+				contact.ImportantDates = e.ImportantDates
+			}
+			if e.Timestamp != "" {
+				contact.UpdatedAt = parseTime(e.Timestamp)
+			}
+		}
+
+	case "contacts_ContactDeleted":
+		var e ContactDeletedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal ContactDeleted: %v", err)
+		}
+		delete(a.Contacts, e.ContactID)
+
+	case "calendar_EventCreated", "calendar_EventUpdated":
+		var e calendarEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal %s: %v", event.Type(), err)
+		}
+		meeting, exists := a.Meetings[e.EventID]
+		if !exists {
+			if event.Type() == "calendar_EventUpdated" {
+				return nil
+			}
+			meeting = &Meeting{EventID: e.EventID}
+			a.Meetings[e.EventID] = meeting
+		}
+		if e.Title != "" {
+			meeting.Title = e.Title
+		}
+		if e.StartTime != "" {
+			meeting.StartTime = parseTime(e.StartTime)
+		}
+		if e.Attendees != nil {
+			meeting.Attendees = e.Attendees
+		}
+
+	case "calendar_EventDeleted":
+		var e calendarEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal EventDeleted: %v", err)
+		}
+		delete(a.Meetings, e.EventID)
+
+	case "orchestration_UserRequestReceived":
+		var e userRequest
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal UserRequestReceived: %v", err)
+		}
+		a.Requests = append(a.Requests, Mention{RequestID: e.RequestID, Text: e.RequestText, Time: parseTime(e.Timestamp)})
+		if len(a.Requests) > maxRequests {
+			a.Requests = a.Requests[len(a.Requests)-maxRequests:]
+		}
+	}
+	return nil
+}
+
+// calendarEvent holds the fields of the calendar plugin's events that link them to contacts
+type calendarEvent struct {
+	EventID   string   `json:"event_id"`
+	Title     string   `json:"title,omitempty"`
+	StartTime string   `json:"start_time,omitempty"`
+	Attendees []string `json:"attendees,omitempty"`
+}
+
+// userRequest holds the fields of the orchestrator's UserRequestReceived event that mention contacts
+type userRequest struct {
+	RequestID   string `json:"request_id"`
+	RequestText string `json:"request_text"`
+	Timestamp   string `json:"timestamp"`
+}
+
+// ContactsPlugin implements the plugin interface
+type ContactsPlugin struct {
+	aggregate *ContactsAggregate
+}
+
+func NewPlugin() eventsourcing.Plugin {
+	agg := NewContactsAggregate()
+	p := &ContactsPlugin{aggregate: agg}
+	agg.commands = map[string]eventsourcing.CommandHandler{
+		"CreateContact": eventsourcing.NewCommand(func(input *CreateContactInput) ([]eventsourcing.Event, error) {
+			return p.createContactHandler(input)
+		}),
+		"UpdateContact": eventsourcing.NewCommand(func(input *UpdateContactInput) ([]eventsourcing.Event, error) {
+			return p.updateContactHandler(input)
+		}),
+		"DeleteContact": eventsourcing.NewCommand(func(input *DeleteContactInput) ([]eventsourcing.Event, error) {
+			return p.deleteContactHandler(input)
+		}),
+		"ListContacts": eventsourcing.NewCommand(func(input *ListContactsInput) ([]eventsourcing.Event, error) {
+			return p.listContactsHandler(input)
+		}),
+		"ContactHistory": eventsourcing.NewCommand(func(input *ContactHistoryInput) ([]eventsourcing.Event, error) {
+			return p.contactHistoryHandler(input)
+		}),
+	}
+	eventsourcing.RegisterEvent("contacts_ContactCreated", func() eventsourcing.Event { return &ContactCreatedEvent{} })
+	eventsourcing.RegisterEvent("contacts_ContactUpdated", func() eventsourcing.Event { return &ContactUpdatedEvent{} })
+	eventsourcing.RegisterEvent("contacts_ContactDeleted", func() eventsourcing.Event { return &ContactDeletedEvent{} })
+	eventsourcing.RegisterEvent("contacts_ContactsListed", func() eventsourcing.Event { return &ContactsListedEvent{} })
+	eventsourcing.RegisterTransientEvent("contacts_ContactsListed")
+	eventsourcing.RegisterEvent("contacts_ContactHistoryReported", func() eventsourcing.Event { return &ContactHistoryReportedEvent{} })
+	eventsourcing.RegisterTransientEvent("contacts_ContactHistoryReported")
+	return p
+}
+
+// Commands returns the command handlers
+func (p *ContactsPlugin) Commands() map[string]eventsourcing.CommandHandler {
+	return p.aggregate.commands
+}
+
+// Name returns the plugin name
+func (p *ContactsPlugin) Name() string {
+	return "contacts"
+}
+
+// Schemas defines the command schemas
+func (p *ContactsPlugin) Schemas() map[string]eventsourcing.CommandInput {
+	return map[string]eventsourcing.CommandInput{
+		"CreateContact":  &CreateContactInput{},
+		"UpdateContact":  &UpdateContactInput{},
+		"DeleteContact":  &DeleteContactInput{},
+		"ListContacts":   &ListContactsInput{},
+		"ContactHistory": &ContactHistoryInput{},
+	}
+}
+
+// Command Input Structs with Schema Generation
+
+// importantDatesSchema describes the ImportantDates parameter shared by CreateContact and UpdateContact
+var importantDatesSchema = map[string]interface{}{
+	"type":        "array",
+	"description": "Yearly dates to remember, like birthdays and anniversaries",
+	"items": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"Label": map[string]interface{}{"type": "string", "description": "What the date is, e.g. Birthday"},
+			"Date":  map[string]interface{}{"type": "string", "description": "The date as YYYY-MM-DD, or MM-DD when the year is unknown"},
+		},
+		"required": []string{"Label", "Date"},
+	},
+}
+
+func (i *CreateContactInput) New() any {
+	return &CreateContactInput{}
+}
+
+// CreateContactInput defines the input for creating a contact
+type CreateContactInput struct {
+	Name           string               `json:"Name"`
+	Email          string               `json:"Email,omitempty"`
+	Aliases        []string             `json:"Aliases,omitempty"`
+	Relationship   string               `json:"Relationship,omitempty"`
+	Notes          string               `json:"Notes,omitempty"`
+	ImportantDates []ImportantDateInput `json:"ImportantDates,omitempty"`
+}
+
+// ImportantDateInput is an important date as given to a command
+type ImportantDateInput struct {
+	Label string `json:"Label"`
+	Date  string `json:"Date"`
+}
+
+func (c *CreateContactInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Creates a new contact for a person the user knows",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Name": map[string]interface{}{
+					"type":        "string",
+					"description": "Full name of the person",
+				},
+				"Email": map[string]interface{}{
+					"type":        "string",
+					"description": "Email address, used to recognize the person among calendar attendees",
+				},
+				"Aliases": map[string]interface{}{
+					"type":        "array",
+					"description": "Nicknames or other names the person goes by",
+					"items":       map[string]interface{}{"type": "string"},
+				},
+				"Relationship": map[string]interface{}{
+					"type":        "string",
+					"description": "How the user knows the person, e.g. friend, colleague, sister",
+				},
+				"Notes": map[string]interface{}{
+					"type":        "string",
+					"description": "Free-form notes about the person",
+				},
+				"ImportantDates": importantDatesSchema,
+			},
+			"required": []string{"Name"},
+		},
+	}
+}
+
+func (i *UpdateContactInput) New() any {
+	return &UpdateContactInput{}
+}
+
+// UpdateContactInput defines the input for updating a contact
+type UpdateContactInput struct {
+	ContactID      string               `json:"ContactID"`
+	Name           string               `json:"Name,omitempty"`
+	Email          string               `json:"Email,omitempty"`
+	Aliases        []string             `json:"Aliases,omitempty"`
+	Relationship   string               `json:"Relationship,omitempty"`
+	Notes          string               `json:"Notes,omitempty"`
+	ImportantDates []ImportantDateInput `json:"ImportantDates,omitempty"`
+}
+
+func (u *UpdateContactInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Updates an existing contact",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"ContactID": map[string]interface{}{
+					"type":        "string",
+					"description": "ID of the contact to update",
+				},
+				"Name": map[string]interface{}{
+					"type":        "string",
+					"description": "Full name of the person",
+				},
+				"Email": map[string]interface{}{
+					"type":        "string",
+					"description": "Email address",
+				},
+				"Aliases": map[string]interface{}{
+					"type":        "array",
+					"description": "Nicknames or other names the person goes by, replacing the current ones",
+					"items":       map[string]interface{}{"type": "string"},
+				},
+				"Relationship": map[string]interface{}{
+					"type":        "string",
+					"description": "How the user knows the person",
+				},
+				"Notes": map[string]interface{}{
+					"type":        "string",
+					"description": "Free-form notes about the person, replacing the current ones",
+				},
+				"ImportantDates": importantDatesSchema,
+			},
+			"required": []string{"ContactID"},
+		},
+	}
+}
+
+func (i *DeleteContactInput) New() any {
+	return &DeleteContactInput{}
+}
+
+// DeleteContactInput defines the input for deleting a contact
+type DeleteContactInput struct {
+	ContactID string `json:"ContactID"`
+}
+
+func (d *DeleteContactInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Deletes a contact",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"ContactID": map[string]interface{}{
+					"type":        "string",
+					"description": "ID of the contact to delete",
+				},
+			},
+			"required": []string{"ContactID"},
+		},
+	}
+}
+
+func (i *ListContactsInput) New() any {
+	return &ListContactsInput{}
+}
+
+// ListContactsInput defines the input for listing contacts
+type ListContactsInput struct {
+	Relationship string `json:"Relationship,omitempty"`
+}
+
+func (l *ListContactsInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Lists contacts with optional filtering",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Relationship": map[string]interface{}{
+					"type":        "string",
+					"description": "Filter by relationship",
+				},
+			},
+		},
+	}
+}
+
+func (i *ContactHistoryInput) New() any {
+	return &ContactHistoryInput{}
+}
+
+// ContactHistoryInput defines the input for looking up the history with a person
+type ContactHistoryInput struct {
+	Name string `json:"Name"`
+}
+
+func (h *ContactHistoryInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Looks up the calendar events a person attended or was named in and the requests mentioning them, to answer questions like when the user last met them",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Name": map[string]interface{}{
+					"type":        "string",
+					"description": "Name, nickname, email or contact ID of the person",
+				},
+			},
+			"required": []string{"Name"},
+		},
+	}
+}
+
+// Event Types
+type ContactCreatedEvent struct {
+	eventsourcing.EventMetadata
+	EventType      string          `json:"event_type"`
+	ContactID      string          `json:"contact_id"`
+	Name           string          `json:"name"`
+	Email          string          `json:"email,omitempty"`
+	Aliases        []string        `json:"aliases,omitempty"`
+	Relationship   string          `json:"relationship,omitempty"`
+	Notes          string          `json:"notes,omitempty"`
+	ImportantDates []ImportantDate `json:"important_dates,omitempty"`
+	Timestamp      string          `json:"timestamp,omitempty"`
+}
+
+func (e *ContactCreatedEvent) Type() string { return "contacts_ContactCreated" }
+func (e *ContactCreatedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ContactCreatedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type ContactUpdatedEvent struct {
+	eventsourcing.EventMetadata
+	EventType      string          `json:"event_type"`
+	ContactID      string          `json:"contact_id"`
+	Name           string          `json:"name,omitempty"`
+	Email          string          `json:"email,omitempty"`
+	Aliases        []string        `json:"aliases,omitempty"`
+	Relationship   string          `json:"relationship,omitempty"`
+	Notes          string          `json:"notes,omitempty"`
+	ImportantDates []ImportantDate `json:"important_dates,omitempty"`
+	Timestamp      string          `json:"timestamp,omitempty"`
+}
+
+func (e *ContactUpdatedEvent) Type() string { return "contacts_ContactUpdated" }
+func (e *ContactUpdatedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ContactUpdatedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type ContactDeletedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	ContactID string `json:"contact_id"`
+}
+
+func (e *ContactDeletedEvent) Type() string { return "contacts_ContactDeleted" }
+func (e *ContactDeletedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ContactDeletedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type ContactsListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string     `json:"event_type"`
+	Contacts  []*Contact `json:"listed_contacts"`
+}
+
+func (e *ContactsListedEvent) Type() string { return "contacts_ContactsListed" }
+func (e *ContactsListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ContactsListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ContactHistoryReportedEvent reports the calendar events and requests a person appeared in
+type ContactHistoryReportedEvent struct {
+	eventsourcing.EventMetadata
+	EventType        string     `json:"event_type"`
+	Name             string     `json:"name"`
+	ContactID        string     `json:"contact_id,omitempty"` // Empty when the person is not a contact
+	LastMeeting      *Meeting   `json:"last_meeting,omitempty"`
+	NextMeeting      *Meeting   `json:"next_meeting,omitempty"`
+	PastMeetings     []*Meeting `json:"past_meetings,omitempty"` // Most recent first
+	UpcomingMeetings []*Meeting `json:"upcoming_meetings,omitempty"`
+	Mentions         []Mention  `json:"mentions,omitempty"` // Most recent first
+}
+
+func (e *ContactHistoryReportedEvent) Type() string { return "contacts_ContactHistoryReported" }
+func (e *ContactHistoryReportedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ContactHistoryReportedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// Utility functions
+func generateContactID() string {
+	return fmt.Sprintf("contact_%d", eventsourcing.GenerateUniqueID())
+}
+
+func parseTime(timeStr string) time.Time {
+	if timeStr == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, timeStr)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// parseImportantDate returns the month and day of an important date
+func parseImportantDate(date string) (time.Month, int, bool) {
+	for _, layout := range []string{"2006-01-02", "01-02"} {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t.Month(), t.Day(), true
+		}
+	}
+	return 0, 0, false
+}
+
+// nextOccurrence returns the first time the yearly date comes around after now, in now's location
+func nextOccurrence(date string, now time.Time) (time.Time, bool) {
+	month, day, ok := parseImportantDate(date)
+	if !ok {
+		return time.Time{}, false
+	}
+	next := time.Date(now.Year(), month, day, 0, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = time.Date(now.Year()+1, month, day, 0, 0, 0, 0, now.Location())
+	}
+	return next, true
+}
+
+// importantDates converts and validates the important dates given to a command
+func importantDates(inputs []ImportantDateInput) ([]ImportantDate, error) {
+	if inputs == nil {
+		return nil, nil
+	}
+	dates := make([]ImportantDate, 0, len(inputs))
+	for _, input := range inputs {
+		if _, _, ok := parseImportantDate(input.Date); !ok {
+			return nil, fmt.Errorf("invalid date for %q: '%s' is not YYYY-MM-DD or MM-DD", input.Label, input.Date)
+		}
+		dates = append(dates, ImportantDate{Label: input.Label, Date: input.Date})
+	}
+	return dates, nil
+}
+
+// names returns the lowercase names a contact can be referred to by: the full name, the first name and the aliases
+func (c *Contact) names() []string {
+	names := []string{strings.ToLower(strings.TrimSpace(c.Name))}
+	if first, _, found := strings.Cut(names[0], " "); found {
+		names = append(names, first)
+	}
+	for _, alias := range c.Aliases {
+		names = append(names, strings.ToLower(strings.TrimSpace(alias)))
+	}
+	return names
+}
+
+// isAttendee reports whether a calendar attendee, a name, an email address or both like
+// "Sarah Lee <sarah@example.com>", is the contact
+func (c *Contact) isAttendee(attendee string) bool {
+	attendee = strings.ToLower(strings.TrimSpace(attendee))
+	name, email := attendee, ""
+	if open := strings.Index(attendee, "<"); open >= 0 && strings.HasSuffix(attendee, ">") {
+		name = strings.TrimSpace(attendee[:open])
+		email = attendee[open+1 : len(attendee)-1]
+	} else if strings.Contains(attendee, "@") {
+		name, email = "", attendee
+	}
+	if email != "" && strings.EqualFold(email, c.Email) {
+		return true
+	}
+	for _, n := range c.names() {
+		if n != "" && n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isMentionedIn reports whether a text names the contact as a whole word
+func (c *Contact) isMentionedIn(text string) bool {
+	text = strings.ToLower(text)
+	for _, name := range c.names() {
+		if name != "" && containsWord(text, name) {
+			return true
+		}
+	}
+	return c.Email != "" && strings.Contains(text, strings.ToLower(c.Email))
+}
+
+// containsWord reports whether the phrase occurs in the text without letters or digits around it
+func containsWord(text, phrase string) bool {
+	for start := 0; ; {
+		i := strings.Index(text[start:], phrase)
+		if i < 0 {
+			return false
+		}
+		i += start
+		end := i + len(phrase)
+		if (i == 0 || !isWordChar(text[i-1])) && (end == len(text) || !isWordChar(text[end])) {
+			return true
+		}
+		start = i + 1
+	}
+}
+
+func isWordChar(b byte) bool {
+	return b >= 0x80 || unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b))
+}
+
+// findContact returns the contact with the ID, or the only contact going by the name, email or alias
+func (a *ContactsAggregate) findContact(name string) (*Contact, error) {
+	if contact, exists := a.Contacts[name]; exists {
+		return contact, nil
+	}
+	var matches []*Contact
+	for _, contact := range a.Contacts {
+		if contact.isAttendee(name) {
+			matches = append(matches, contact)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		return matches[0], nil
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Name < matches[j].Name })
+	names := make([]string, len(matches))
+	for i, contact := range matches {
+		names[i] = fmt.Sprintf("%s (%s)", contact.Name, contact.ContactID)
+	}
+	return nil, fmt.Errorf("%q matches several contacts: %s", name, strings.Join(names, ", "))
+}
+
+// meetingsWith returns the calendar events the contact attends or is named in, by start time
+func (a *ContactsAggregate) meetingsWith(contact *Contact) []*Meeting {
+	var meetings []*Meeting
+	for _, meeting := range a.Meetings {
+		if meeting.StartTime.IsZero() {
+			continue
+		}
+		attends := contact.isMentionedIn(meeting.Title)
+		for _, attendee := range meeting.Attendees {
+			attends = attends || contact.isAttendee(attendee)
+		}
+		if attends {
+			meetings = append(meetings, meeting)
+		}
+	}
+	sort.Slice(meetings, func(i, j int) bool {
+		return meetings[i].StartTime.Before(meetings[j].StartTime)
+	})
+	return meetings
+}
+
+// lastMeeting returns the latest calendar event with the contact that started before now
+func (a *ContactsAggregate) lastMeeting(contact *Contact, now time.Time) *Meeting {
+	var last *Meeting
+	for _, meeting := range a.meetingsWith(contact) {
+		if meeting.StartTime.After(now) {
+			break
+		}
+		last = meeting
+	}
+	return last
+}
+
+// Command Handlers
+func (p *ContactsPlugin) createContactHandler(input *CreateContactInput) ([]eventsourcing.Event, error) {
+	if strings.TrimSpace(input.Name) == "" {
+		return nil, fmt.Errorf("name is required and must be a non-empty string")
+	}
+	dates, err := importantDates(input.ImportantDates)
+	if err != nil {
+		return nil, err
+	}
+	event := &ContactCreatedEvent{
+		EventType:      "contacts_ContactCreated",
+		ContactID:      generateContactID(),
+		Name:           strings.TrimSpace(input.Name),
+		Email:          input.Email,
+		Aliases:        input.Aliases,
+		Relationship:   input.Relationship,
+		Notes:          input.Notes,
+		ImportantDates: dates,
+		Timestamp:      eventsourcing.ISOTimestamp(),
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *ContactsPlugin) updateContactHandler(input *UpdateContactInput) ([]eventsourcing.Event, error) {
+	if input.ContactID == "" {
+		return nil, fmt.Errorf("contactID is required and must be a non-empty string")
+	}
+
+	p.aggregate.Mu.RLock()
+	_, exists := p.aggregate.Contacts[input.ContactID]
+	p.aggregate.Mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("contact %s not found", input.ContactID)
+	}
+
+	dates, err := importantDates(input.ImportantDates)
+	if err != nil {
+		return nil, err
+	}
+	event := &ContactUpdatedEvent{
+		EventType:      "contacts_ContactUpdated",
+		ContactID:      input.ContactID,
+		Name:           strings.TrimSpace(input.Name),
+		Email:          input.Email,
+		Aliases:        input.Aliases,
+		Relationship:   input.Relationship,
+		Notes:          input.Notes,
+		ImportantDates: dates,
+		Timestamp:      eventsourcing.ISOTimestamp(),
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *ContactsPlugin) deleteContactHandler(input *DeleteContactInput) ([]eventsourcing.Event, error) {
+	if input.ContactID == "" {
+		return nil, fmt.Errorf("contactID is required and must be a non-empty string")
+	}
+
+	p.aggregate.Mu.RLock()
+	_, exists := p.aggregate.Contacts[input.ContactID]
+	p.aggregate.Mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("contact %s not found", input.ContactID)
+	}
+
+	event := &ContactDeletedEvent{EventType: "contacts_ContactDeleted", ContactID: input.ContactID}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *ContactsPlugin) listContactsHandler(input *ListContactsInput) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+
+	contacts := make([]*Contact, 0, len(p.aggregate.Contacts))
+	for _, contact := range p.aggregate.Contacts {
+		if input.Relationship != "" && !strings.EqualFold(contact.Relationship, input.Relationship) {
+			continue
+		}
+		contacts = append(contacts, contact)
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		return contacts[i].Name < contacts[j].Name
+	})
+
+	event := &ContactsListedEvent{EventType: "contacts_ContactsListed", Contacts: contacts}
+	return []eventsourcing.Event{event}, nil
+}
+
+// contactHistoryHandler reports the meetings with and mentions of a person. People without a contact
+// record are looked up by the given name, so the history of anyone in the calendar can be answered.
+func (p *ContactsPlugin) contactHistoryHandler(input *ContactHistoryInput) ([]eventsourcing.Event, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, fmt.Errorf("name is required and must be a non-empty string")
+	}
+
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	contact, err := p.aggregate.findContact(name)
+	if err != nil {
+		return nil, err
+	}
+	event := &ContactHistoryReportedEvent{EventType: "contacts_ContactHistoryReported", Name: name}
+	if contact != nil {
+		event.Name = contact.Name
+		event.ContactID = contact.ContactID
+	} else {
+		contact = &Contact{Name: name}
+	}
+
+	now := time.Now()
+	for _, meeting := range p.aggregate.meetingsWith(contact) {
+		if meeting.StartTime.After(now) {
+			event.UpcomingMeetings = append(event.UpcomingMeetings, meeting)
+		} else {
+			event.PastMeetings = append([]*Meeting{meeting}, event.PastMeetings...)
+		}
+	}
+	if len(event.PastMeetings) > 0 {
+		event.LastMeeting = event.PastMeetings[0]
+	}
+	if len(event.UpcomingMeetings) > 0 {
+		event.NextMeeting = event.UpcomingMeetings[0]
+	}
+	for i := len(p.aggregate.Requests) - 1; i >= 0 && len(event.Mentions) < maxMentions; i-- {
+		if request := p.aggregate.Requests[i]; contact.isMentionedIn(request.Text) {
+			event.Mentions = append(event.Mentions, request)
+		}
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+// GetCustomUI returns a list view of the contacts
+func (a *ContactsAggregate) GetCustomUI() fyne.CanvasObject {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+
+	if len(a.Contacts) == 0 {
+		return container.NewCenter(widget.NewLabel("No contacts yet. Add someone to get started!"))
+	}
+
+	now := time.Now()
+	content := container.NewVBox()
+	for _, id := range a.getSortedContactIDs() {
+		contact := a.Contacts[id]
+		title := widget.NewLabel(contact.Name)
+		title.TextStyle = fyne.TextStyle{Bold: true}
+
+		var detailLines []string
+		if contact.Relationship != "" {
+			detailLines = append(detailLines, contact.Relationship)
+		}
+		if contact.Email != "" {
+			detailLines = append(detailLines, contact.Email)
+		}
+		for _, date := range contact.ImportantDates {
+			detailLines = append(detailLines, fmt.Sprintf("%s: %s", date.Label, date.Date))
+		}
+		if last := a.lastMeeting(contact, now); last != nil {
+			detailLines = append(detailLines, fmt.Sprintf("Last met: %s (%s)", last.StartTime.Format("2006-01-02"), last.Title))
+		}
+		if contact.Notes != "" {
+			detailLines = append(detailLines, contact.Notes)
+		}
+		details := widget.NewLabel(strings.Join(detailLines, "\n"))
+		details.Wrapping = fyne.TextWrapWord
+
+		content.Add(container.NewPadded(container.NewVBox(title, widget.NewSeparator(), details)))
+		content.Add(widget.NewSeparator())
+	}
+	return container.NewVScroll(content)
+}
+
+// Additional Plugin Methods
+func (p *ContactsPlugin) Aggregate() eventsourcing.Aggregate {
+	return p.aggregate
+}
+
+func (p *ContactsPlugin) Type() eventsourcing.PluginType {
+	return eventsourcing.LLMPlugin
+}
+
+func (p *ContactsPlugin) SystemPrompt() string {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+
+	var contactList strings.Builder
+	if len(p.aggregate.Contacts) == 0 {
+		contactList.WriteString("There are currently no contacts.\n")
+	} else {
+		contactList.WriteString("Current contacts:\n")
+		now := time.Now()
+		for _, id := range p.aggregate.getSortedContactIDs() {
+			contact := p.aggregate.Contacts[id]
+			contactList.WriteString(fmt.Sprintf("- Contact ID: %s, Name: \"%s\"", contact.ContactID, contact.Name))
+			if contact.Relationship != "" {
+				contactList.WriteString(fmt.Sprintf(", Relationship: %s", contact.Relationship))
+			}
+			if last := p.aggregate.lastMeeting(contact, now); last != nil {
+				contactList.WriteString(fmt.Sprintf(", Last met: %s", last.StartTime.Format("2006-01-02")))
+			}
+			contactList.WriteString("\n")
+		}
+	}
+
+	return `You are PeopleKeeper, a specialized AI for managing the user's contacts in MindPalace.
+
+The user input will be a JSON object containing the arguments for the command to execute. Parse the JSON and call the appropriate command with the parsed values.
+
+Your job is to interpret user requests about the people they know and execute the right commands (CreateContact, UpdateContact, DeleteContact, ListContacts, ContactHistory) based on the current contacts.
+
+` + contactList.String() + `
+Calendar events are linked to contacts through their attendees and titles, and the user's requests through the names they mention.
+
+When interpreting user requests, pay close attention to the intent:
+- If the user asks to "add" or "remember" a person, use the CreateContact command.
+- If the user tells you something new about a known person, like a birthday, use the UpdateContact command.
+- If the user asks to "remove" or "forget" a person, use the DeleteContact command.
+- If the user asks to "list" or "show" contacts, use the ListContacts command.
+- If the user asks when they last or next meet someone, or what they talked about with someone, use the ContactHistory command.
+
+Important dates are yearly, as YYYY-MM-DD or MM-DD when the year is unknown.
+
+Format your responses in a structured way and confirm actions performed.`
+}
+
+// RequiresConfirmation asks the user before contacts are deleted
+func (p *ContactsPlugin) RequiresConfirmation(command string) bool {
+	return command == "DeleteContact"
+}
+
+// AgentModel specifies the LLM model to use for this plugin's agent
+func (p *ContactsPlugin) AgentModel() string {
+	return "gpt-oss:20b"
+}
+
+func (p *ContactsPlugin) EventHandlers() map[string]eventsourcing.EventHandler {
+	return nil
+}
+
+// contactPosition returns where the card of the i-th contact is placed, in a row behind the hub
+func contactPosition(i int) []float64 {
+	return []float64{float64(i) * 2.0, 2.0, 10.0}
+}
+
+func (a *ContactsAggregate) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	switch event.(type) {
+	case *ContactCreatedEvent, *ContactUpdatedEvent, *ContactDeletedEvent:
+		// Cards are sorted by name, so a change can move every card after it
+		changed := contactIDOf(event)
+		actions := contactCardDeletes(changed)
+		for _, id := range a.getSortedContactIDs() {
+			if id != changed {
+				actions = append(actions, contactCardDeletes(id)...)
+			}
+		}
+		return append(actions, a.contactCards()...)
+	}
+	return nil
+}
+
+// contactIDOf returns the ID of the contact a contact event changes
+func contactIDOf(event eventsourcing.Event) string {
+	switch e := event.(type) {
+	case *ContactCreatedEvent:
+		return e.ContactID
+	case *ContactUpdatedEvent:
+		return e.ContactID
+	case *ContactDeletedEvent:
+		return e.ContactID
+	}
+	return ""
+}
+
+func (a *ContactsAggregate) GetFull3DState() []eventsourcing.DeltaAction {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	theme := ui3d.CurrentTheme()
+	actions := []eventsourcing.DeltaAction{ui3d.CreateSphere("contacts_hub", []float64{0.0, 0.0, 12.0}, theme)}
+	return append(actions, a.contactCards()...)
+}
+
+// contactCardDeletes removes the card of a contact
+func contactCardDeletes(contactID string) []eventsourcing.DeltaAction {
+	return []eventsourcing.DeltaAction{
+		{Type: "delete", NodeID: fmt.Sprintf("contact_%s", contactID)},
+		{Type: "delete", NodeID: fmt.Sprintf("contact_%s_label", contactID)},
+	}
+}
+
+// contactCards creates a card for every contact, sorted by name
+func (a *ContactsAggregate) contactCards() []eventsourcing.DeltaAction {
+	theme := ui3d.CurrentTheme()
+	var actions []eventsourcing.DeltaAction
+	for i, id := range a.getSortedContactIDs() {
+		cards := ui3d.CreateCard(fmt.Sprintf("contact_%s", id), a.Contacts[id].Name, contactPosition(i), theme)
+		for j := range cards {
+			if cards[j].Properties == nil {
+				cards[j].Properties = make(map[string]interface{})
+			}
+			cards[j].Properties["event_type"] = "contact"
+		}
+		actions = append(actions, cards...)
+	}
+	return actions
+}
+
+// getSortedContactIDs returns contact IDs sorted by name for consistent ordering
+func (a *ContactsAggregate) getSortedContactIDs() []string {
+	ids := make([]string, 0, len(a.Contacts))
+	for id := range a.Contacts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if a.Contacts[ids[i]].Name != a.Contacts[ids[j]].Name {
+			return a.Contacts[ids[i]].Name < a.Contacts[ids[j]].Name
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// calendarCreated mirrors the calendar plugin's EventCreated event, which the contacts aggregate
+// only sees through its JSON
+type calendarCreated struct {
+	eventsourcing.EventMetadata
+	EventType string   `json:"event_type"`
+	EventID   string   `json:"event_id"`
+	Title     string   `json:"title"`
+	StartTime string   `json:"start_time"`
+	Attendees []string `json:"attendees,omitempty"`
+}
+
+func (e *calendarCreated) Type() string                { return "calendar_EventCreated" }
+func (e *calendarCreated) Marshal() ([]byte, error)    { return nil, nil }
+func (e *calendarCreated) Unmarshal(data []byte) error { return nil }
+
+// userRequestReceived mirrors the orchestrator's UserRequestReceived event
+type userRequestReceived struct {
+	eventsourcing.EventMetadata
+	RequestID   string `json:"request_id"`
+	RequestText string `json:"request_text"`
+	Timestamp   string `json:"timestamp"`
+}
+
+func (e *userRequestReceived) Type() string                { return "orchestration_UserRequestReceived" }
+func (e *userRequestReceived) Marshal() ([]byte, error)    { return nil, nil }
+func (e *userRequestReceived) Unmarshal(data []byte) error { return nil }
+
+func newContactsPlugin(t *testing.T) *ContactsPlugin {
+	t.Helper()
+	return NewPlugin().(*ContactsPlugin)
+}
+
+func createContact(t *testing.T, p *ContactsPlugin, input *CreateContactInput) string {
+	t.Helper()
+	events, err := p.createContactHandler(input)
+	if err != nil {
+		t.Fatalf("createContactHandler failed: %v", err)
+	}
+	if err := p.aggregate.ApplyEvent(events[0]); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+	return events[0].(*ContactCreatedEvent).ContactID
+}
+
+func TestContactsAggregate_ApplyEvent(t *testing.T) {
+	p := newContactsPlugin(t)
+	id := createContact(t, p, &CreateContactInput{Name: "Sarah Lee", Relationship: "friend"})
+
+	if err := p.aggregate.ApplyEvent(&ContactUpdatedEvent{EventType: "contacts_ContactUpdated", ContactID: id, Notes: "Likes climbing"}); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+	contact := p.aggregate.Contacts[id]
+	if contact.Name != "Sarah Lee" || contact.Relationship != "friend" || contact.Notes != "Likes climbing" {
+		t.Errorf("Unexpected contact after update: %+v", contact)
+	}
+
+	if err := p.aggregate.ApplyEvent(&ContactDeletedEvent{EventType: "contacts_ContactDeleted", ContactID: id}); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+	if len(p.aggregate.Contacts) != 0 {
+		t.Errorf("Expected no contacts after delete, got %d", len(p.aggregate.Contacts))
+	}
+}
+
+func TestContactsPlugin_CreateContactValidatesDates(t *testing.T) {
+	p := newContactsPlugin(t)
+	if _, err := p.createContactHandler(&CreateContactInput{Name: "Sarah", ImportantDates: []ImportantDateInput{{Label: "Birthday", Date: "next tuesday"}}}); err == nil {
+		t.Error("Expected an error for an invalid important date")
+	}
+	if _, err := p.createContactHandler(&CreateContactInput{Name: "Sarah", ImportantDates: []ImportantDateInput{{Label: "Birthday", Date: "03-14"}}}); err != nil {
+		t.Errorf("Expected a date without a year to be accepted, got %v", err)
+	}
+}
+
+func TestContact_IsAttendee(t *testing.T) {
+	contact := &Contact{Name: "Sarah Lee", Email: "sarah@example.com", Aliases: []string{"Sally"}}
+	tests := map[string]bool{
+		"Sarah Lee":                     true,
+		"sarah":                         true,
+		"Sally":                         true,
+		"SARAH@example.com":             true,
+		"S. Lee <sarah@example.com>":    true,
+		"Sarah Lee <other@example.com>": true,
+		"Sarah Connor":                  false,
+		"bob@example.com":               false,
+	}
+	for attendee, want := range tests {
+		if got := contact.isAttendee(attendee); got != want {
+			t.Errorf("isAttendee(%q) = %v, want %v", attendee, got, want)
+		}
+	}
+}
+
+func TestContact_IsMentionedIn(t *testing.T) {
+	contact := &Contact{Name: "Sarah Lee", Aliases: []string{"Sally"}}
+	tests := map[string]bool{
+		"Lunch with Sarah":            true,
+		"when did I last meet sarah?": true,
+		"Call Sally tomorrow":         true,
+		"Sarahs birthday":             false,
+		"Visit Sarahville":            false,
+	}
+	for text, want := range tests {
+		if got := contact.isMentionedIn(text); got != want {
+			t.Errorf("isMentionedIn(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestContactsPlugin_ContactHistory(t *testing.T) {
+	p := newContactsPlugin(t)
+	id := createContact(t, p, &CreateContactInput{Name: "Sarah Lee", Email: "sarah@example.com"})
+	past := time.Now().AddDate(0, -1, 0).UTC()
+	events := []eventsourcing.Event{
+		&calendarCreated{EventID: "e1", Title: "Project kickoff", StartTime: past.AddDate(0, -2, 0).Format(time.RFC3339), Attendees: []string{"sarah@example.com"}},
+		&calendarCreated{EventID: "e2", Title: "Coffee with Sarah", StartTime: past.Format(time.RFC3339)},
+		&calendarCreated{EventID: "e3", Title: "Dinner", StartTime: time.Now().AddDate(0, 1, 0).UTC().Format(time.RFC3339), Attendees: []string{"Sarah Lee"}},
+		&calendarCreated{EventID: "e4", Title: "Lunch with Tom", StartTime: past.Format(time.RFC3339)},
+		&userRequestReceived{RequestID: "r1", RequestText: "remind me to ask Sarah about the trip", Timestamp: past.Format(time.RFC3339)},
+		&userRequestReceived{RequestID: "r2", RequestText: "what's the weather", Timestamp: past.Format(time.RFC3339)},
+	}
+	for _, event := range events {
+		if err := p.aggregate.ApplyEvent(event); err != nil {
+			t.Fatalf("ApplyEvent failed: %v", err)
+		}
+	}
+
+	reported, err := p.contactHistoryHandler(&ContactHistoryInput{Name: "sarah"})
+	if err != nil {
+		t.Fatalf("contactHistoryHandler failed: %v", err)
+	}
+	history := reported[0].(*ContactHistoryReportedEvent)
+	if history.ContactID != id {
+		t.Errorf("Expected contact %s, got %q", id, history.ContactID)
+	}
+	if history.LastMeeting == nil || history.LastMeeting.EventID != "e2" {
+		t.Errorf("Expected the coffee to be the last meeting, got %+v", history.LastMeeting)
+	}
+	if len(history.PastMeetings) != 2 || history.PastMeetings[1].EventID != "e1" {
+		t.Errorf("Expected two past meetings, most recent first, got %+v", history.PastMeetings)
+	}
+	if history.NextMeeting == nil || history.NextMeeting.EventID != "e3" {
+		t.Errorf("Expected the dinner to be the next meeting, got %+v", history.NextMeeting)
+	}
+	if len(history.Mentions) != 1 || history.Mentions[0].RequestID != "r1" {
+		t.Errorf("Expected one mention, got %+v", history.Mentions)
+	}
+
+	// People without a contact record are looked up by name
+	reported, err = p.contactHistoryHandler(&ContactHistoryInput{Name: "Tom"})
+	if err != nil {
+		t.Fatalf("contactHistoryHandler failed: %v", err)
+	}
+	if history := reported[0].(*ContactHistoryReportedEvent); history.ContactID != "" || history.LastMeeting == nil || history.LastMeeting.EventID != "e4" {
+		t.Errorf("Expected the lunch with a person who is not a contact, got %+v", history)
+	}
+}
+
+func TestContactsPlugin_ContactHistoryAmbiguous(t *testing.T) {
+	p := newContactsPlugin(t)
+	createContact(t, p, &CreateContactInput{Name: "Sarah Lee"})
+	createContact(t, p, &CreateContactInput{Name: "Sarah Connor"})
+
+	_, err := p.contactHistoryHandler(&ContactHistoryInput{Name: "Sarah"})
+	if err == nil || !strings.Contains(err.Error(), "several contacts") {
+		t.Errorf("Expected an ambiguity error, got %v", err)
+	}
+	if _, err := p.contactHistoryHandler(&ContactHistoryInput{Name: "Sarah Connor"}); err != nil {
+		t.Errorf("Expected the full name to be unambiguous, got %v", err)
+	}
+}
+
+func TestContactsAggregate_Deadlines(t *testing.T) {
+	p := newContactsPlugin(t)
+	createContact(t, p, &CreateContactInput{Name: "Sarah Lee", ImportantDates: []ImportantDateInput{{Label: "Birthday", Date: "1990-03-14"}}})
+
+	deadlines := p.aggregate.Deadlines()
+	if len(deadlines) != 1 {
+		t.Fatalf("Expected 1 deadline, got %d", len(deadlines))
+	}
+	due := deadlines[0].Due
+	if due.Month() != time.March || due.Day() != 14 || !due.After(time.Now()) || due.After(time.Now().AddDate(1, 0, 0)) {
+		t.Errorf("Expected the next March 14th, got %v", due)
+	}
+	if deadlines[0].Title != "Sarah Lee: Birthday" {
+		t.Errorf("Unexpected title %q", deadlines[0].Title)
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	if next, _ := nextOccurrence("03-14", now); !next.Equal(time.Date(2025, time.March, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected next year for a passed date, got %v", next)
+	}
+	if next, _ := nextOccurrence("1985-12-25", now); !next.Equal(time.Date(2024, time.December, 25, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected this year for an upcoming date, got %v", next)
+	}
+	if _, ok := nextOccurrence("someday", now); ok {
+		t.Error("Expected an invalid date to have no occurrence")
+	}
+}
+
+func TestContactsAggregate_SnapshotRoundTrip(t *testing.T) {
+	p := newContactsPlugin(t)
+	id := createContact(t, p, &CreateContactInput{Name: "Sarah Lee"})
+	p.aggregate.ApplyEvent(&calendarCreated{EventID: "e1", Title: "Coffee", StartTime: "2024-01-01T10:00:00Z", Attendees: []string{"Sarah Lee"}})
+
+	data, err := p.aggregate.SaveSnapshot()
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	restored := NewContactsAggregate()
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if restored.Contacts[id] == nil || restored.Meetings["e1"] == nil {
+		t.Errorf("Expected the contact and meeting to be restored, got %+v and %+v", restored.Contacts, restored.Meetings)
+	}
+}
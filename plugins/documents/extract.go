@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxFileSize is the largest file that can be imported, in bytes
+const maxFileSize = 50 << 20
+
+// Formats of the files that can be imported
+const (
+	FormatPDF      = "pdf"
+	FormatMarkdown = "markdown"
+	FormatText     = "text"
+)
+
+// formats maps file extensions to the format they are read as
+var formats = map[string]string{
+	".pdf":      FormatPDF,
+	".md":       FormatMarkdown,
+	".markdown": FormatMarkdown,
+	".txt":      FormatText,
+	".text":     FormatText,
+}
+
+// section is a part of a document that is chunked on its own: a page of a PDF or a section under a
+// heading of a markdown file
+type section struct {
+	text    string
+	page    int
+	heading string
+}
+
+// expandPath resolves a leading ~ to the home directory and makes the path absolute
+func expandPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find the home directory: %v", err)
+		}
+		path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	return filepath.Abs(path)
+}
+
+// formatOf returns the format a file is read as, from its extension
+func formatOf(path string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	format, ok := formats[ext]
+	if !ok {
+		return "", fmt.Errorf("unsupported file type %q, import a PDF, markdown or text file", ext)
+	}
+	return format, nil
+}
+
+// readSections reads a file and splits it into the sections its format has
+func readSections(path, format string) ([]section, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory, import its files one by one", path)
+	}
+	if info.Size() > maxFileSize {
+		return nil, fmt.Errorf("%s is %d MB, larger than the %d MB that can be imported", path, info.Size()>>20, maxFileSize>>20)
+	}
+
+	if format == FormatPDF {
+		text, err := pdfText(path)
+		if err != nil {
+			return nil, err
+		}
+		return pdfSections(text), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("%s is not a UTF-8 text file", path)
+	}
+	if format == FormatMarkdown {
+		return markdownSections(string(data)), nil
+	}
+	return []section{{text: string(data)}}, nil
+}
+
+// pdfText extracts the text of a PDF with pdftotext from poppler, which separates pages with form feeds
+func pdfText(path string) (string, error) {
+	if _, err := exec.LookPath("pdftotext"); err != nil {
+		return "", fmt.Errorf("importing PDFs needs pdftotext, install poppler-utils")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("pdftotext", "-enc", "UTF-8", path, "-")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to extract the text of %s: %v: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// pdfSections splits the text of a PDF into its pages, numbered from 1
+func pdfSections(text string) []section {
+	var sections []section
+	for i, page := range strings.Split(text, "\f") {
+		if strings.TrimSpace(page) != "" {
+			sections = append(sections, section{text: page, page: i + 1})
+		}
+	}
+	return sections
+}
+
+// headingPattern matches a markdown heading, capturing its text
+var headingPattern = regexp.MustCompile(`^#{1,6}\s+(.+)$`)
+
+// markdownSections splits markdown at its headings, so passages can be cited by the heading above them
+func markdownSections(text string) []section {
+	var sections []section
+	current := section{}
+	var body strings.Builder
+	flush := func() {
+		current.text = body.String()
+		if strings.TrimSpace(current.text) != "" {
+			sections = append(sections, current)
+		}
+		body.Reset()
+	}
+	inCode := false
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inCode = !inCode
+		}
+		if match := headingPattern.FindStringSubmatch(trimmed); !inCode && match != nil {
+			flush()
+			current = section{heading: strings.TrimSpace(match[1])}
+			continue
+		}
+		body.WriteString(line + "\n")
+	}
+	flush()
+	return sections
+}
+
+// chunkSections splits the sections into chunks of at most size words. Consecutive chunks of a section
+// share overlap words, so a passage cut in two is still found whole in one of them.
+func chunkSections(sections []section, size, overlap int) []Chunk {
+	var chunks []Chunk
+	step := max(size-overlap, 1)
+	for _, s := range sections {
+		words := strings.Fields(s.text)
+		for start := 0; start < len(words); start += step {
+			end := min(start+size, len(words))
+			chunks = append(chunks, Chunk{
+				Index:   len(chunks),
+				Text:    strings.Join(words[start:end], " "),
+				Page:    s.page,
+				Section: s.heading,
+			})
+			if end == len(words) {
+				break
+			}
+		}
+	}
+	return chunks
+}
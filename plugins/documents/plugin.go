@@ -0,0 +1,754 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mindpalace/internal/memory"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Chunking defaults: chunks of about a long paragraph, overlapping by a sentence or two
+const (
+	DefaultChunkWords = 200
+	chunkOverlapWords = 40
+)
+
+// DefaultSearchResults is how many passages a search returns when no limit is given
+const DefaultSearchResults = 5
+
+// citationInstructions tells the LLM answering the request how to use the passages found
+const citationInstructions = "Answer using only these passages. Cite the passages you use inline by their number, like [1], and end with the list of their citations. If the passages do not answer the question, say so instead of guessing."
+
+// Chunk is a passage of a document, embedded and searched on its own
+type Chunk struct {
+	Index   int    `json:"index"`
+	Text    string `json:"text"`
+	Page    int    `json:"page,omitempty"`    // Page of a PDF, from 1
+	Section string `json:"section,omitempty"` // Heading of a markdown file the passage is under
+}
+
+// Document is an imported file
+type Document struct {
+	DocumentID string    `json:"document_id"`
+	Title      string    `json:"title"`
+	Path       string    `json:"path"`
+	Format     string    `json:"format"`
+	Chunks     []Chunk   `json:"chunks"`
+	ImportedAt time.Time `json:"imported_at"`
+}
+
+// Words returns the number of words of the document, counting overlapping words once per chunk
+func (d *Document) Words() int {
+	words := 0
+	for _, chunk := range d.Chunks {
+		words += len(strings.Fields(chunk.Text))
+	}
+	return words
+}
+
+// DocumentsAggregate manages the imported documents and the index their passages are searched in
+type DocumentsAggregate struct {
+	Documents map[string]*Document
+	index     *memory.Store
+	commands  map[string]eventsourcing.CommandHandler
+	Mu        sync.RWMutex
+}
+
+// NewDocumentsAggregate creates a new thread-safe DocumentsAggregate searching with the given embedder
+func NewDocumentsAggregate(embedder memory.Embedder) *DocumentsAggregate {
+	return &DocumentsAggregate{
+		Documents: make(map[string]*Document),
+		index:     memory.NewStore(embedder),
+		commands:  make(map[string]eventsourcing.CommandHandler),
+	}
+}
+
+// ID returns the aggregate's identifier
+func (a *DocumentsAggregate) ID() string {
+	return "documents"
+}
+
+// chunkID is the ID of a passage in the index
+func chunkID(documentID string, index int) string {
+	return fmt.Sprintf("%s#%d", documentID, index)
+}
+
+// indexDocument adds the passages of a document to the index; they are embedded when first searched
+func (a *DocumentsAggregate) indexDocument(doc *Document) {
+	for _, chunk := range doc.Chunks {
+		a.index.Index(chunkID(doc.DocumentID, chunk.Index), chunk.Text, map[string]string{
+			"document_id": doc.DocumentID,
+			"chunk":       strconv.Itoa(chunk.Index),
+		})
+	}
+}
+
+// unindexDocument removes the passages of a document from the index
+func (a *DocumentsAggregate) unindexDocument(doc *Document) {
+	for _, chunk := range doc.Chunks {
+		a.index.Remove(chunkID(doc.DocumentID, chunk.Index))
+	}
+}
+
+// SaveSnapshot serializes the documents so they can be restored without a full replay
+func (a *DocumentsAggregate) SaveSnapshot() ([]byte, error) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return json.Marshal(a.Documents)
+}
+
+// LoadSnapshot replaces the documents with those from a snapshot and indexes their passages again
+func (a *DocumentsAggregate) LoadSnapshot(data []byte) error {
+	documents := make(map[string]*Document)
+	if err := json.Unmarshal(data, &documents); err != nil {
+		return fmt.Errorf("failed to unmarshal snapshot: %v", err)
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	for _, doc := range a.Documents {
+		a.unindexDocument(doc)
+	}
+	a.Documents = documents
+	for _, doc := range a.Documents {
+		a.indexDocument(doc)
+	}
+	return nil
+}
+
+// ApplyEvent updates the documents and their index
+func (a *DocumentsAggregate) ApplyEvent(event eventsourcing.Event) error {
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event %s: %v", event.Type(), err)
+	}
+
+	switch event.Type() {
+	case "documents_DocumentImported":
+		var e DocumentImportedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal DocumentImported: %v", err)
+		}
+		// Importing a file again replaces its passages
+		if existing, exists := a.Documents[e.DocumentID]; exists {
+			a.unindexDocument(existing)
+		}
+		doc := &Document{
+			DocumentID: e.DocumentID,
+			Title:      e.Title,
+			Path:       e.Path,
+			Format:     e.Format,
+			Chunks:     e.Chunks,
+			ImportedAt: parseTime(e.ImportedAt),
+		}
+		a.Documents[e.DocumentID] = doc
+		a.indexDocument(doc)
+
+	case "documents_DocumentRemoved":
+		var e DocumentRemovedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal DocumentRemoved: %v", err)
+		}
+		if doc, exists := a.Documents[e.DocumentID]; exists {
+			a.unindexDocument(doc)
+			delete(a.Documents, e.DocumentID)
+		}
+
+	case "documents_DocumentsListed", "documents_DocumentsSearched":
+		// Read-only events, no state change needed
+	}
+	return nil
+}
+
+// documentByPath returns the document imported from a path, nil if there is none
+func (a *DocumentsAggregate) documentByPath(path string) *Document {
+	for _, doc := range a.Documents {
+		if doc.Path == path {
+			return doc
+		}
+	}
+	return nil
+}
+
+// sortedDocuments returns the documents, most recently imported first
+func (a *DocumentsAggregate) sortedDocuments() []*Document {
+	documents := make([]*Document, 0, len(a.Documents))
+	for _, doc := range a.Documents {
+		documents = append(documents, doc)
+	}
+	sort.Slice(documents, func(i, j int) bool {
+		if !documents[i].ImportedAt.Equal(documents[j].ImportedAt) {
+			return documents[i].ImportedAt.After(documents[j].ImportedAt)
+		}
+		return documents[i].DocumentID < documents[j].DocumentID
+	})
+	return documents
+}
+
+// embedder computes embeddings with the function the plugin manager provides, once it has
+type embedder struct {
+	mu    sync.RWMutex
+	embed eventsourcing.EmbedFunc
+}
+
+func (e *embedder) Embed(texts []string) ([][]float32, error) {
+	e.mu.RLock()
+	embed := e.embed
+	e.mu.RUnlock()
+	if embed == nil {
+		return nil, fmt.Errorf("no embedding model is available to search documents")
+	}
+	return embed(texts)
+}
+
+// DocumentsPlugin implements the plugin interface
+type DocumentsPlugin struct {
+	aggregate *DocumentsAggregate
+	embedder  *embedder
+
+	configMu   sync.Mutex // Guards chunkWords
+	chunkWords int
+}
+
+func NewPlugin() eventsourcing.Plugin {
+	emb := &embedder{}
+	agg := NewDocumentsAggregate(emb)
+	p := &DocumentsPlugin{aggregate: agg, embedder: emb, chunkWords: DefaultChunkWords}
+	agg.commands = map[string]eventsourcing.CommandHandler{
+		"ImportDocument": eventsourcing.NewCommand(func(input *ImportDocumentInput) ([]eventsourcing.Event, error) {
+			return p.importDocumentHandler(input)
+		}),
+		"ListDocuments": eventsourcing.NewCommand(func(input *ListDocumentsInput) ([]eventsourcing.Event, error) {
+			return p.listDocumentsHandler(input)
+		}),
+		"RemoveDocument": eventsourcing.NewCommand(func(input *RemoveDocumentInput) ([]eventsourcing.Event, error) {
+			return p.removeDocumentHandler(input)
+		}),
+		"SearchDocuments": eventsourcing.NewCommand(func(input *SearchDocumentsInput) ([]eventsourcing.Event, error) {
+			return p.searchDocumentsHandler(input)
+		}),
+	}
+	eventsourcing.RegisterEvent("documents_DocumentImported", func() eventsourcing.Event { return &DocumentImportedEvent{} })
+	eventsourcing.RegisterEvent("documents_DocumentRemoved", func() eventsourcing.Event { return &DocumentRemovedEvent{} })
+	eventsourcing.RegisterEvent("documents_DocumentsListed", func() eventsourcing.Event { return &DocumentsListedEvent{} })
+	eventsourcing.RegisterTransientEvent("documents_DocumentsListed")
+	eventsourcing.RegisterEvent("documents_DocumentsSearched", func() eventsourcing.Event { return &DocumentsSearchedEvent{} })
+	eventsourcing.RegisterTransientEvent("documents_DocumentsSearched")
+	return p
+}
+
+// Commands returns the command handlers
+func (p *DocumentsPlugin) Commands() map[string]eventsourcing.CommandHandler {
+	return p.aggregate.commands
+}
+
+// Name returns the plugin name
+func (p *DocumentsPlugin) Name() string {
+	return "documents"
+}
+
+// Manifest declares that the plugin reads the documents it indexes from disk
+func (p *DocumentsPlugin) Manifest() eventsourcing.Manifest {
+	return eventsourcing.Manifest{
+		Version:      "1.0.0",
+		Capabilities: []string{eventsourcing.CapabilityFiles},
+	}
+}
+
+// Schemas defines the command schemas
+func (p *DocumentsPlugin) Schemas() map[string]eventsourcing.CommandInput {
+	return map[string]eventsourcing.CommandInput{
+		"ImportDocument":  &ImportDocumentInput{},
+		"ListDocuments":   &ListDocumentsInput{},
+		"RemoveDocument":  &RemoveDocumentInput{},
+		"SearchDocuments": &SearchDocumentsInput{},
+	}
+}
+
+// RequiresConfirmation asks the user before documents are removed
+func (p *DocumentsPlugin) RequiresConfirmation(command string) bool {
+	return command == "RemoveDocument"
+}
+
+// SetEmbedFunc gives the plugin the embedding model to search passages with
+func (p *DocumentsPlugin) SetEmbedFunc(embed eventsourcing.EmbedFunc) {
+	p.embedder.mu.Lock()
+	defer p.embedder.mu.Unlock()
+	p.embedder.embed = embed
+}
+
+// Configure applies the [plugin.documents] settings of the configuration file: chunk_words, the number
+// of words of the passages files are split into. It also embeds the passages of imported documents.
+func (p *DocumentsPlugin) Configure(settings map[string]interface{}) error {
+	words := DefaultChunkWords
+	if value, ok := settings["chunk_words"].(int64); ok {
+		if value <= chunkOverlapWords || value > 2000 {
+			return fmt.Errorf("chunk_words must be between %d and 2000, got %d", chunkOverlapWords+1, value)
+		}
+		words = int(value)
+	}
+	p.configMu.Lock()
+	p.chunkWords = words
+	p.configMu.Unlock()
+
+	// Embed the passages of documents imported before now, so the first search is quick
+	go func() {
+		if err := p.aggregate.index.EmbedPending(); err != nil {
+			logging.Error("DOCUMENTS: Failed to embed passages: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Command Input Structs with Schema Generation
+
+func (i *ImportDocumentInput) New() any {
+	return &ImportDocumentInput{}
+}
+
+// ImportDocumentInput defines the input for importing a file
+type ImportDocumentInput struct {
+	Path  string `json:"Path"`
+	Title string `json:"Title,omitempty"`
+}
+
+func (s *ImportDocumentInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Imports a PDF, markdown or text file so questions can be answered from it",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Path": map[string]interface{}{
+					"type":        "string",
+					"description": "Path of the file, ~ for the home directory",
+				},
+				"Title": map[string]interface{}{
+					"type":        "string",
+					"description": "Title to cite the document by, the file name if omitted",
+				},
+			},
+			"required": []string{"Path"},
+		},
+	}
+}
+
+func (i *ListDocumentsInput) New() any {
+	return &ListDocumentsInput{}
+}
+
+// ListDocumentsInput defines the input for listing the imported documents
+type ListDocumentsInput struct{}
+
+func (s *ListDocumentsInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Lists the imported documents",
+		"parameters": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+	}
+}
+
+func (i *RemoveDocumentInput) New() any {
+	return &RemoveDocumentInput{}
+}
+
+// RemoveDocumentInput defines the input for removing an imported document
+type RemoveDocumentInput struct {
+	DocumentID string `json:"DocumentID"`
+}
+
+func (s *RemoveDocumentInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Removes an imported document so it is no longer searched; the file itself is kept",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"DocumentID": map[string]interface{}{
+					"type":        "string",
+					"description": "ID of the document to remove",
+				},
+			},
+			"required": []string{"DocumentID"},
+		},
+	}
+}
+
+func (i *SearchDocumentsInput) New() any {
+	return &SearchDocumentsInput{}
+}
+
+// SearchDocumentsInput defines the input for searching the imported documents
+type SearchDocumentsInput struct {
+	Query      string `json:"Query"`
+	Limit      int    `json:"Limit,omitempty"`
+	DocumentID string `json:"DocumentID,omitempty"`
+}
+
+func (s *SearchDocumentsInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Finds the passages of the user's imported documents that answer a question, with citations",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Query": map[string]interface{}{
+					"type":        "string",
+					"description": "The question or topic to find passages about",
+				},
+				"Limit": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Maximum number of passages, %d if omitted", DefaultSearchResults),
+					"minimum":     1,
+					"maximum":     20,
+				},
+				"DocumentID": map[string]interface{}{
+					"type":        "string",
+					"description": "Only search this document",
+				},
+			},
+			"required": []string{"Query"},
+		},
+	}
+}
+
+// Event Types
+type DocumentImportedEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string  `json:"event_type"`
+	DocumentID string  `json:"document_id"`
+	Title      string  `json:"title"`
+	Path       string  `json:"path"`
+	Format     string  `json:"format"`
+	Chunks     []Chunk `json:"chunks"`
+	ImportedAt string  `json:"imported_at"`
+}
+
+func (e *DocumentImportedEvent) Type() string { return "documents_DocumentImported" }
+func (e *DocumentImportedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *DocumentImportedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type DocumentRemovedEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string `json:"event_type"`
+	DocumentID string `json:"document_id"`
+	Title      string `json:"title,omitempty"`
+}
+
+func (e *DocumentRemovedEvent) Type() string { return "documents_DocumentRemoved" }
+func (e *DocumentRemovedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *DocumentRemovedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// DocumentSummary describes an imported document without its passages
+type DocumentSummary struct {
+	DocumentID string `json:"document_id"`
+	Title      string `json:"title"`
+	Path       string `json:"path"`
+	Format     string `json:"format"`
+	Chunks     int    `json:"chunks"`
+	ImportedAt string `json:"imported_at"`
+}
+
+type DocumentsListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string            `json:"event_type"`
+	Documents []DocumentSummary `json:"documents"`
+}
+
+func (e *DocumentsListedEvent) Type() string { return "documents_DocumentsListed" }
+func (e *DocumentsListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *DocumentsListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// Passage is a passage found by a search, numbered in the order it is cited
+type Passage struct {
+	Number     int     `json:"number"`
+	Citation   string  `json:"citation"`
+	DocumentID string  `json:"document_id"`
+	Text       string  `json:"text"`
+	Score      float64 `json:"score"`
+}
+
+type DocumentsSearchedEvent struct {
+	eventsourcing.EventMetadata
+	EventType    string    `json:"event_type"`
+	Query        string    `json:"query"`
+	Passages     []Passage `json:"passages"`
+	Instructions string    `json:"instructions"` // How the answer cites the passages
+}
+
+func (e *DocumentsSearchedEvent) Type() string { return "documents_DocumentsSearched" }
+func (e *DocumentsSearchedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *DocumentsSearchedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// Utility functions
+func generateDocumentID() string {
+	return fmt.Sprintf("doc_%d", time.Now().UnixNano())
+}
+
+func parseTime(timeStr string) time.Time {
+	if timeStr == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, timeStr)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// citation names a passage by its document and where it is in it
+func citation(number int, doc *Document, chunk Chunk) string {
+	switch {
+	case chunk.Page > 0:
+		return fmt.Sprintf("[%d] %s, p. %d", number, doc.Title, chunk.Page)
+	case chunk.Section != "":
+		return fmt.Sprintf("[%d] %s, \"%s\"", number, doc.Title, chunk.Section)
+	default:
+		return fmt.Sprintf("[%d] %s, passage %d", number, doc.Title, chunk.Index+1)
+	}
+}
+
+// Command Handlers
+func (p *DocumentsPlugin) importDocumentHandler(input *ImportDocumentInput) ([]eventsourcing.Event, error) {
+	if input.Path == "" {
+		return nil, fmt.Errorf("path is required and must be a non-empty string")
+	}
+	path, err := expandPath(input.Path)
+	if err != nil {
+		return nil, err
+	}
+	format, err := formatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	sections, err := readSections(path, format)
+	if err != nil {
+		return nil, err
+	}
+	p.configMu.Lock()
+	chunkWords := p.chunkWords
+	p.configMu.Unlock()
+	chunks := chunkSections(sections, chunkWords, chunkOverlapWords)
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("%s has no text to import", path)
+	}
+
+	title := input.Title
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	documentID := generateDocumentID()
+	p.aggregate.Mu.RLock()
+	if existing := p.aggregate.documentByPath(path); existing != nil {
+		documentID = existing.DocumentID
+	}
+	p.aggregate.Mu.RUnlock()
+
+	event := &DocumentImportedEvent{
+		EventType:  "documents_DocumentImported",
+		DocumentID: documentID,
+		Title:      title,
+		Path:       path,
+		Format:     format,
+		Chunks:     chunks,
+		ImportedAt: eventsourcing.ISOTimestamp(),
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *DocumentsPlugin) listDocumentsHandler(input *ListDocumentsInput) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+
+	documents := make([]DocumentSummary, 0, len(p.aggregate.Documents))
+	for _, doc := range p.aggregate.sortedDocuments() {
+		documents = append(documents, DocumentSummary{
+			DocumentID: doc.DocumentID,
+			Title:      doc.Title,
+			Path:       doc.Path,
+			Format:     doc.Format,
+			Chunks:     len(doc.Chunks),
+			ImportedAt: doc.ImportedAt.Format(time.RFC3339),
+		})
+	}
+	return []eventsourcing.Event{&DocumentsListedEvent{EventType: "documents_DocumentsListed", Documents: documents}}, nil
+}
+
+func (p *DocumentsPlugin) removeDocumentHandler(input *RemoveDocumentInput) ([]eventsourcing.Event, error) {
+	if input.DocumentID == "" {
+		return nil, fmt.Errorf("documentID is required and must be a non-empty string")
+	}
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	doc, exists := p.aggregate.Documents[input.DocumentID]
+	if !exists {
+		return nil, fmt.Errorf("document %s not found", input.DocumentID)
+	}
+	event := &DocumentRemovedEvent{
+		EventType:  "documents_DocumentRemoved",
+		DocumentID: doc.DocumentID,
+		Title:      doc.Title,
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *DocumentsPlugin) searchDocumentsHandler(input *SearchDocumentsInput) ([]eventsourcing.Event, error) {
+	if strings.TrimSpace(input.Query) == "" {
+		return nil, fmt.Errorf("query is required and must be a non-empty string")
+	}
+	limit := input.Limit
+	if limit <= 0 {
+		limit = DefaultSearchResults
+	}
+
+	p.aggregate.Mu.RLock()
+	if len(p.aggregate.Documents) == 0 {
+		p.aggregate.Mu.RUnlock()
+		return nil, fmt.Errorf("no documents have been imported yet")
+	}
+	if _, exists := p.aggregate.Documents[input.DocumentID]; input.DocumentID != "" && !exists {
+		p.aggregate.Mu.RUnlock()
+		return nil, fmt.Errorf("document %s not found", input.DocumentID)
+	}
+	candidates := limit
+	if input.DocumentID != "" {
+		// Passages of other documents are filtered out below, so look at all of them
+		candidates = p.aggregate.index.Len()
+	}
+	p.aggregate.Mu.RUnlock()
+
+	// Passages imported since the last search are embedded first, which must not block the events being applied
+	if err := p.aggregate.index.EmbedPending(); err != nil {
+		return nil, fmt.Errorf("failed to embed passages: %v", err)
+	}
+	results, err := p.aggregate.index.Search(input.Query, candidates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search documents: %v", err)
+	}
+
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	event := &DocumentsSearchedEvent{
+		EventType:    "documents_DocumentsSearched",
+		Query:        input.Query,
+		Passages:     []Passage{},
+		Instructions: citationInstructions,
+	}
+	for _, result := range results {
+		if len(event.Passages) == limit {
+			break
+		}
+		documentID := result.Metadata["document_id"]
+		if input.DocumentID != "" && documentID != input.DocumentID {
+			continue
+		}
+		doc, exists := p.aggregate.Documents[documentID]
+		index, err := strconv.Atoi(result.Metadata["chunk"])
+		if !exists || err != nil || index >= len(doc.Chunks) || result.Score <= 0 {
+			continue
+		}
+		chunk := doc.Chunks[index]
+		number := len(event.Passages) + 1
+		event.Passages = append(event.Passages, Passage{
+			Number:     number,
+			Citation:   citation(number, doc, chunk),
+			DocumentID: documentID,
+			Text:       chunk.Text,
+			Score:      result.Score,
+		})
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+// GetCustomUI lists the imported documents, most recent first
+func (a *DocumentsAggregate) GetCustomUI() fyne.CanvasObject {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+
+	content := container.NewVBox()
+	if len(a.Documents) == 0 {
+		content.Add(widget.NewLabel("No documents yet. Ask MindPalace to import a PDF, markdown or text file to get started!"))
+		return container.NewVScroll(content)
+	}
+	for _, doc := range a.sortedDocuments() {
+		title := widget.NewLabel(doc.Title)
+		title.TextStyle = fyne.TextStyle{Bold: true}
+		details := widget.NewLabel(fmt.Sprintf("%s · %d passages · %d words · imported %s\n%s",
+			doc.Format, len(doc.Chunks), doc.Words(), doc.ImportedAt.Local().Format("2006-01-02 15:04"), doc.Path))
+		details.Wrapping = fyne.TextWrapWord
+		content.Add(container.NewPadded(container.NewVBox(title, details)))
+		content.Add(widget.NewSeparator())
+	}
+	return container.NewVScroll(content)
+}
+
+// Additional Plugin Methods
+func (p *DocumentsPlugin) Aggregate() eventsourcing.Aggregate {
+	return p.aggregate
+}
+
+func (p *DocumentsPlugin) Type() eventsourcing.PluginType {
+	return eventsourcing.LLMPlugin
+}
+
+func (p *DocumentsPlugin) SystemPrompt() string {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+
+	documents := "Imported documents:\n"
+	if len(p.aggregate.Documents) == 0 {
+		documents += "- None yet\n"
+	}
+	for _, doc := range p.aggregate.sortedDocuments() {
+		documents += fmt.Sprintf("- Document ID: %s, Title: \"%s\", Path: %s\n", doc.DocumentID, doc.Title, doc.Path)
+	}
+
+	return `You are Librarian, a specialized AI for answering questions from the user's own files in MindPalace.
+
+The user input will be a JSON object containing the arguments for the command to execute. Parse the JSON and call the appropriate command with the parsed values.
+
+Your job is to interpret user requests about documents and execute the right commands (ImportDocument, ListDocuments, RemoveDocument, SearchDocuments).
+
+` + documents + `
+When interpreting user requests, pay close attention to the intent:
+- If the user wants to add, import or read in a file, use the ImportDocument command with its path.
+- If the user asks a question their documents may answer ("what does my lease say about pets?"), use the SearchDocuments command with the question. Pass DocumentID if they name a document.
+- If the user asks which documents they have, use the ListDocuments command.
+- If the user wants a document forgotten or removed, use the RemoveDocument command.
+
+Answers from documents always cite the passages they use, like [1], followed by the citations.`
+}
+
+// AgentModel specifies the LLM model to use for this plugin's agent
+func (p *DocumentsPlugin) AgentModel() string {
+	return "gpt-oss:20b"
+}
+
+func (p *DocumentsPlugin) EventHandlers() map[string]eventsourcing.EventHandler {
+	return nil
+}
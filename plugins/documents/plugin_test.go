@@ -0,0 +1,202 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// wordEmbed embeds texts as bag-of-words vectors over a fixed vocabulary
+func wordEmbed(vocab ...string) func(texts []string) ([][]float32, error) {
+	return func(texts []string) ([][]float32, error) {
+		vectors := make([][]float32, len(texts))
+		for i, text := range texts {
+			vectors[i] = make([]float32, len(vocab))
+			for j, word := range vocab {
+				vectors[i][j] = float32(strings.Count(strings.ToLower(text), word))
+			}
+		}
+		return vectors, nil
+	}
+}
+
+func newDocumentsPlugin(t *testing.T) *DocumentsPlugin {
+	t.Helper()
+	p := NewPlugin().(*DocumentsPlugin)
+	p.SetEmbedFunc(wordEmbed("pet", "rent", "deposit", "garden"))
+	return p
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func importDocument(t *testing.T, p *DocumentsPlugin, input *ImportDocumentInput) *DocumentImportedEvent {
+	t.Helper()
+	events, err := p.importDocumentHandler(input)
+	if err != nil {
+		t.Fatalf("importDocumentHandler failed: %v", err)
+	}
+	if err := p.aggregate.ApplyEvent(events[0]); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+	return events[0].(*DocumentImportedEvent)
+}
+
+const lease = `# Lease
+
+The tenant rents the apartment from the landlord.
+
+## Rent
+
+The rent is due on the first of every month. The deposit is two months of rent.
+
+## Pets
+
+One pet is allowed. Any pet damage is paid from the deposit.
+`
+
+func TestChunkSections(t *testing.T) {
+	words := make([]string, 25)
+	for i := range words {
+		words[i] = "w"
+	}
+	chunks := chunkSections([]section{{text: strings.Join(words, " "), page: 3}, {text: "short"}}, 10, 2)
+	if len(chunks) != 4 {
+		t.Fatalf("Expected 4 chunks, got %d: %+v", len(chunks), chunks)
+	}
+	for i, chunk := range chunks[:3] {
+		if chunk.Index != i || chunk.Page != 3 {
+			t.Errorf("Unexpected chunk %d: %+v", i, chunk)
+		}
+	}
+	if n := len(strings.Fields(chunks[2].Text)); n != 9 {
+		t.Errorf("Expected the last chunk of the page to have the 9 words left, got %d", n)
+	}
+	if chunks[3].Text != "short" || chunks[3].Page != 0 {
+		t.Errorf("Expected the second section in its own chunk, got %+v", chunks[3])
+	}
+}
+
+func TestMarkdownSections(t *testing.T) {
+	sections := markdownSections("Intro\n# Title\nText\n```\n# not a heading\n```\n#hashtag\n## Empty\n## Next\nMore")
+	if len(sections) != 3 {
+		t.Fatalf("Expected 3 sections, got %+v", sections)
+	}
+	if sections[0].heading != "" || sections[1].heading != "Title" || sections[2].heading != "Next" {
+		t.Errorf("Unexpected headings %+v", sections)
+	}
+	if !strings.Contains(sections[1].text, "# not a heading") || !strings.Contains(sections[1].text, "#hashtag") {
+		t.Errorf("Expected code and hashtags to stay in the text, got %q", sections[1].text)
+	}
+}
+
+func TestPDFSections(t *testing.T) {
+	sections := pdfSections("First page\f\fThird page\f")
+	if len(sections) != 2 || sections[0].page != 1 || sections[1].page != 3 {
+		t.Errorf("Expected pages 1 and 3, got %+v", sections)
+	}
+}
+
+func TestDocumentsPlugin_ImportDocument(t *testing.T) {
+	p := newDocumentsPlugin(t)
+	if _, err := p.importDocumentHandler(&ImportDocumentInput{Path: writeFile(t, "photo.png", "x")}); err == nil {
+		t.Error("Expected an error for an unsupported file type")
+	}
+	if _, err := p.importDocumentHandler(&ImportDocumentInput{Path: filepath.Join(t.TempDir(), "missing.txt")}); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+
+	path := writeFile(t, "lease.md", lease)
+	imported := importDocument(t, p, &ImportDocumentInput{Path: path})
+	if imported.Title != "lease" || imported.Format != FormatMarkdown || len(imported.Chunks) != 3 {
+		t.Fatalf("Unexpected import %+v", imported)
+	}
+	if imported.Chunks[2].Section != "Pets" {
+		t.Errorf("Expected the last passage under Pets, got %q", imported.Chunks[2].Section)
+	}
+
+	// Importing the same file again replaces it
+	again := importDocument(t, p, &ImportDocumentInput{Path: path, Title: "Lease 2024"})
+	if again.DocumentID != imported.DocumentID || len(p.aggregate.Documents) != 1 {
+		t.Errorf("Expected the document to be replaced, got %d documents", len(p.aggregate.Documents))
+	}
+	if p.aggregate.index.Len() != 3 {
+		t.Errorf("Expected 3 indexed passages, got %d", p.aggregate.index.Len())
+	}
+}
+
+func TestDocumentsPlugin_SearchDocuments(t *testing.T) {
+	p := newDocumentsPlugin(t)
+	if _, err := p.searchDocumentsHandler(&SearchDocumentsInput{Query: "pets"}); err == nil {
+		t.Error("Expected an error without documents")
+	}
+	leaseDoc := importDocument(t, p, &ImportDocumentInput{Path: writeFile(t, "lease.md", lease), Title: "Lease"})
+	notes := importDocument(t, p, &ImportDocumentInput{Path: writeFile(t, "notes.txt", "Plant tomatoes in the garden. The garden needs a pet fence.")})
+
+	events, err := p.searchDocumentsHandler(&SearchDocumentsInput{Query: "Can I keep a pet?", Limit: 2})
+	if err != nil {
+		t.Fatalf("searchDocumentsHandler failed: %v", err)
+	}
+	searched := events[0].(*DocumentsSearchedEvent)
+	if len(searched.Passages) != 2 || searched.Instructions == "" {
+		t.Fatalf("Expected 2 passages with instructions, got %+v", searched)
+	}
+	if first := searched.Passages[0]; first.DocumentID != leaseDoc.DocumentID || first.Citation != `[1] Lease, "Pets"` {
+		t.Errorf("Expected the pets section of the lease first, got %+v", first)
+	}
+
+	events, err = p.searchDocumentsHandler(&SearchDocumentsInput{Query: "pet", DocumentID: notes.DocumentID})
+	if err != nil {
+		t.Fatalf("searchDocumentsHandler failed: %v", err)
+	}
+	passages := events[0].(*DocumentsSearchedEvent).Passages
+	if len(passages) != 1 || passages[0].Citation != "[1] notes, passage 1" {
+		t.Errorf("Expected only the notes, got %+v", passages)
+	}
+}
+
+func TestDocumentsPlugin_RemoveDocument(t *testing.T) {
+	p := newDocumentsPlugin(t)
+	imported := importDocument(t, p, &ImportDocumentInput{Path: writeFile(t, "lease.md", lease)})
+
+	if _, err := p.removeDocumentHandler(&RemoveDocumentInput{DocumentID: "missing"}); err == nil {
+		t.Error("Expected an error for an unknown document")
+	}
+	events, err := p.removeDocumentHandler(&RemoveDocumentInput{DocumentID: imported.DocumentID})
+	if err != nil {
+		t.Fatalf("removeDocumentHandler failed: %v", err)
+	}
+	if err := p.aggregate.ApplyEvent(events[0]); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+	if len(p.aggregate.Documents) != 0 || p.aggregate.index.Len() != 0 {
+		t.Errorf("Expected the document and its passages to be gone, got %d documents and %d passages", len(p.aggregate.Documents), p.aggregate.index.Len())
+	}
+	if !p.RequiresConfirmation("RemoveDocument") {
+		t.Error("Expected removing a document to require confirmation")
+	}
+}
+
+func TestDocumentsAggregate_SnapshotRoundTrip(t *testing.T) {
+	p := newDocumentsPlugin(t)
+	imported := importDocument(t, p, &ImportDocumentInput{Path: writeFile(t, "lease.md", lease)})
+
+	data, err := p.aggregate.SaveSnapshot()
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	restored := NewDocumentsAggregate(p.embedder)
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if restored.Documents[imported.DocumentID] == nil || restored.index.Len() != 3 {
+		t.Errorf("Expected the document and its passages to be restored, got %+v and %d passages", restored.Documents, restored.index.Len())
+	}
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxMessageBytes is how much of each message is downloaded, enough for its headers and the start of its text
+const maxMessageBytes = 64 << 10
+
+// maxFetch is the most messages fetched in one check, the newest ones, so the first check of a full
+// inbox does not download all of it
+const maxFetch = 50
+
+// Mailbox is an email inbox the email plugin triages
+type Mailbox interface {
+	// Check returns the messages with a UID above sinceUID and the UIDs of all unread messages
+	Check(ctx context.Context, sinceUID uint32) (*InboxState, error)
+	// SetFlagged flags or unflags a message
+	SetFlagged(ctx context.Context, uid uint32, flagged bool) error
+	// Archive moves a message out of the inbox to the archive mailbox
+	Archive(ctx context.Context, uid uint32) error
+}
+
+// InboxState is what a check of the inbox found
+type InboxState struct {
+	Messages []Message
+	Unseen   []uint32
+}
+
+// Message is a message of the inbox as the mail server has it
+type Message struct {
+	UID     uint32
+	Raw     []byte // Start of the message as sent, at most maxMessageBytes
+	Seen    bool
+	Flagged bool
+}
+
+// IMAPClient reads an inbox over IMAP with TLS, like Gmail (imap.gmail.com:993 with an app password),
+// Fastmail or most self-hosted servers
+type IMAPClient struct {
+	Addr           string // Host and port of the server
+	Username       string
+	Password       string
+	Mailbox        string // Mailbox triaged, usually INBOX
+	ArchiveMailbox string // Mailbox archived messages are moved to
+	Insecure       bool   // Connect without TLS, for servers on localhost only
+}
+
+// Check fetches the newest messages above sinceUID and searches the unread ones
+func (c *IMAPClient) Check(ctx context.Context, sinceUID uint32) (*InboxState, error) {
+	state := &InboxState{}
+	err := c.session(ctx, func(conn *imapConn) error {
+		uids, err := conn.search(fmt.Sprintf("UID %d:*", sinceUID+1))
+		if err != nil {
+			return err
+		}
+		// The range n:* always matches the last message, even when its UID is below n
+		var fresh []uint32
+		for _, uid := range uids {
+			if uid > sinceUID {
+				fresh = append(fresh, uid)
+			}
+		}
+		if len(fresh) > maxFetch {
+			fresh = fresh[len(fresh)-maxFetch:]
+		}
+		if state.Messages, err = conn.fetch(fresh); err != nil {
+			return err
+		}
+		state.Unseen, err = conn.search("UNSEEN")
+		return err
+	})
+	return state, err
+}
+
+// SetFlagged adds or removes the \Flagged flag of a message
+func (c *IMAPClient) SetFlagged(ctx context.Context, uid uint32, flagged bool) error {
+	return c.session(ctx, func(conn *imapConn) error {
+		change := "+FLAGS.SILENT"
+		if !flagged {
+			change = "-FLAGS.SILENT"
+		}
+		_, err := conn.command(fmt.Sprintf("UID STORE %d %s (\\Flagged)", uid, change))
+		return err
+	})
+}
+
+// Archive moves a message to the archive mailbox, copying and expunging it on servers without MOVE
+func (c *IMAPClient) Archive(ctx context.Context, uid uint32) error {
+	archive := c.ArchiveMailbox
+	if archive == "" {
+		archive = "Archive"
+	}
+	return c.session(ctx, func(conn *imapConn) error {
+		if conn.caps["MOVE"] {
+			_, err := conn.command(fmt.Sprintf("UID MOVE %d %s", uid, quote(archive)))
+			return err
+		}
+		if _, err := conn.command(fmt.Sprintf("UID COPY %d %s", uid, quote(archive))); err != nil {
+			return err
+		}
+		if _, err := conn.command(fmt.Sprintf("UID STORE %d +FLAGS.SILENT (\\Deleted)", uid)); err != nil {
+			return err
+		}
+		if conn.caps["UIDPLUS"] {
+			_, err := conn.command(fmt.Sprintf("UID EXPUNGE %d", uid))
+			return err
+		}
+		_, err := conn.command("EXPUNGE")
+		return err
+	})
+}
+
+// session connects, logs in and selects the mailbox, runs fn and logs out
+func (c *IMAPClient) session(ctx context.Context, fn func(conn *imapConn) error) error {
+	conn, err := dialIMAP(ctx, c.Addr, c.Insecure)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+	if _, err := conn.command(fmt.Sprintf("LOGIN %s %s", quote(c.Username), quote(c.Password))); err != nil {
+		return fmt.Errorf("failed to log in to %s: %v", c.Addr, err)
+	}
+	responses, err := conn.command("CAPABILITY")
+	if err != nil {
+		return err
+	}
+	for _, response := range responses {
+		if len(response) > 1 && strings.EqualFold(atom(response[1]), "CAPABILITY") {
+			for _, capability := range response[2:] {
+				conn.caps[strings.ToUpper(atom(capability))] = true
+			}
+		}
+	}
+	mailbox := c.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	if _, err := conn.command("SELECT " + quote(mailbox)); err != nil {
+		return fmt.Errorf("failed to open mailbox %s: %v", mailbox, err)
+	}
+	if err := fn(conn); err != nil {
+		return err
+	}
+	conn.command("LOGOUT")
+	return nil
+}
+
+// imapConn is a connection to an IMAP server, sending one command at a time
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+	caps map[string]bool
+}
+
+// dialIMAP connects to the server and reads its greeting; the connection fails once ctx is done
+func dialIMAP(ctx context.Context, addr string, insecure bool) (*imapConn, error) {
+	var dialer net.Dialer
+	var conn net.Conn
+	var err error
+	if insecure {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		host, _, _ := net.SplitHostPort(addr)
+		tlsDialer := tls.Dialer{NetDialer: &dialer, Config: &tls.Config{ServerName: host}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn), caps: make(map[string]bool)}
+	greeting, err := c.readResponse()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read the greeting of %s: %v", addr, err)
+	}
+	if len(greeting) < 2 || (atom(greeting[1]) != "OK" && atom(greeting[1]) != "PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("%s refused the connection", addr)
+	}
+	return c, nil
+}
+
+func (c *imapConn) close() error {
+	return c.conn.Close()
+}
+
+// command sends a command and returns the untagged responses to it, or an error if it did not succeed
+func (c *imapConn) command(cmd string) ([][]any, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, cmd); err != nil {
+		return nil, fmt.Errorf("failed to send %s: %v", commandName(cmd), err)
+	}
+	var untagged [][]any
+	for {
+		response, err := c.readResponse()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the response to %s: %v", commandName(cmd), err)
+		}
+		if len(response) == 0 || atom(response[0]) != tag {
+			untagged = append(untagged, response)
+			continue
+		}
+		if len(response) < 2 || !strings.EqualFold(atom(response[1]), "OK") {
+			return nil, fmt.Errorf("%s failed: %s", commandName(cmd), responseText(response[1:]))
+		}
+		return untagged, nil
+	}
+}
+
+// commandName returns the name of a command, which unlike its arguments is safe to log
+func commandName(cmd string) string {
+	fields := strings.Fields(cmd)
+	if len(fields) > 1 && fields[0] == "UID" {
+		return "UID " + fields[1]
+	}
+	if len(fields) > 0 {
+		return fields[0]
+	}
+	return cmd
+}
+
+// search returns the UIDs matching the criteria, in ascending order
+func (c *imapConn) search(criteria string) ([]uint32, error) {
+	responses, err := c.command("UID SEARCH " + criteria)
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for _, response := range responses {
+		if len(response) < 2 || !strings.EqualFold(atom(response[1]), "SEARCH") {
+			continue
+		}
+		for _, value := range response[2:] {
+			if uid, err := strconv.ParseUint(atom(value), 10, 32); err == nil {
+				uids = append(uids, uint32(uid))
+			}
+		}
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	return uids, nil
+}
+
+// fetch downloads the start of the messages with the UIDs, without marking them read
+func (c *imapConn) fetch(uids []uint32) ([]Message, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	set := make([]string, len(uids))
+	for i, uid := range uids {
+		set[i] = strconv.FormatUint(uint64(uid), 10)
+	}
+	responses, err := c.command(fmt.Sprintf("UID FETCH %s (UID FLAGS BODY.PEEK[]<0.%d>)", strings.Join(set, ","), maxMessageBytes))
+	if err != nil {
+		return nil, err
+	}
+	var messages []Message
+	for _, response := range responses {
+		if len(response) < 4 || !strings.EqualFold(atom(response[2]), "FETCH") {
+			continue
+		}
+		items, ok := response[3].([]any)
+		if !ok {
+			continue
+		}
+		var message Message
+		for i := 0; i+1 < len(items); i += 2 {
+			key := strings.ToUpper(atom(items[i]))
+			switch {
+			case key == "UID":
+				uid, _ := strconv.ParseUint(atom(items[i+1]), 10, 32)
+				message.UID = uint32(uid)
+			case key == "FLAGS":
+				flags, _ := items[i+1].([]any)
+				for _, flag := range flags {
+					switch strings.ToLower(atom(flag)) {
+					case `\seen`:
+						message.Seen = true
+					case `\flagged`:
+						message.Flagged = true
+					}
+				}
+			case strings.HasPrefix(key, "BODY["):
+				message.Raw = []byte(atom(items[i+1]))
+			}
+		}
+		if message.UID != 0 {
+			messages = append(messages, message)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].UID < messages[j].UID })
+	return messages, nil
+}
+
+// readResponse reads one response, with the literals it contains, and parses it into its values:
+// strings for atoms, quoted strings and literals, []any for lists and nil for NIL
+func (c *imapConn) readResponse() ([]any, error) {
+	var raw strings.Builder
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		raw.WriteString(line)
+		size, ok := literalSize(line)
+		if !ok {
+			break
+		}
+		if _, err := io.CopyN(&raw, c.r, size); err != nil {
+			return nil, err
+		}
+	}
+	values, err := parseResponse(raw.String())
+	if err != nil {
+		// Human-readable text after a status, like "NO Login failed (bad password", need not parse
+		values = nil
+		for _, field := range strings.Fields(raw.String()) {
+			values = append(values, field)
+		}
+	}
+	return values, nil
+}
+
+// literalSize returns the size of the literal a line ends with, like {42}
+func literalSize(line string) (int64, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasSuffix(line, "}") {
+		return 0, false
+	}
+	start := strings.LastIndex(line, "{")
+	if start < 0 {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(strings.TrimSuffix(line[start+1:len(line)-1], "+"), 10, 64)
+	return size, err == nil && size >= 0
+}
+
+// responseParser parses a response read by readResponse
+type responseParser struct {
+	s   string
+	pos int
+}
+
+func parseResponse(raw string) ([]any, error) {
+	p := &responseParser{s: raw}
+	var values []any
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.s) || p.s[p.pos] == '\r' || p.s[p.pos] == '\n' {
+			return values, nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+}
+
+func (p *responseParser) skipSpaces() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *responseParser) value() (any, error) {
+	switch p.s[p.pos] {
+	case '(':
+		p.pos++
+		var list []any
+		for {
+			p.skipSpaces()
+			if p.pos >= len(p.s) {
+				return nil, fmt.Errorf("unterminated list")
+			}
+			if p.s[p.pos] == ')' {
+				p.pos++
+				return list, nil
+			}
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+	case '"':
+		p.pos++
+		var b strings.Builder
+		for p.pos < len(p.s) {
+			ch := p.s[p.pos]
+			p.pos++
+			switch {
+			case ch == '\\' && p.pos < len(p.s):
+				b.WriteByte(p.s[p.pos])
+				p.pos++
+			case ch == '"':
+				return b.String(), nil
+			default:
+				b.WriteByte(ch)
+			}
+		}
+		return nil, fmt.Errorf("unterminated quoted string")
+	case '{':
+		end := strings.IndexByte(p.s[p.pos:], '\n')
+		if end < 0 {
+			return nil, fmt.Errorf("malformed literal")
+		}
+		size, ok := literalSize(p.s[p.pos : p.pos+end+1])
+		start := p.pos + end + 1
+		if !ok || start+int(size) > len(p.s) {
+			return nil, fmt.Errorf("malformed literal")
+		}
+		p.pos = start + int(size)
+		return p.s[start:p.pos], nil
+	}
+	// An atom, which may contain a section in brackets with spaces, like BODY[HEADER.FIELDS (FROM)]
+	start := p.pos
+	depth := 0
+	for p.pos < len(p.s) {
+		ch := p.s[p.pos]
+		if ch == '[' {
+			depth++
+		} else if ch == ']' && depth > 0 {
+			depth--
+		} else if depth == 0 && (ch == ' ' || ch == '(' || ch == ')' || ch == '\r' || ch == '\n') {
+			break
+		}
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, fmt.Errorf("unexpected %q", p.s[p.pos])
+	}
+	if value := p.s[start:p.pos]; !strings.EqualFold(value, "NIL") {
+		return value, nil
+	}
+	return nil, nil
+}
+
+// atom returns a parsed value as a string, empty for lists and NIL
+func atom(value any) string {
+	s, _ := value.(string)
+	return s
+}
+
+// responseText joins the values of a response into the text the server gave
+func responseText(values []any) string {
+	var parts []string
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// quote makes a string an IMAP quoted string
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
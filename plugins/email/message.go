@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxSnippet is the most characters of a message's text kept, enough to triage and summarize it
+const maxSnippet = 2000
+
+// parsedMessage holds the parts of a message the plugin keeps
+type parsedMessage struct {
+	MessageID string
+	From      string
+	To        string
+	Subject   string
+	Date      time.Time
+	Snippet   string
+}
+
+var headerDecoder = &mime.WordDecoder{}
+
+// parseMessage reads the headers and the start of the text of a message, which may be cut off
+func parseMessage(raw []byte) parsedMessage {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return parsedMessage{Snippet: snippet(string(raw))}
+	}
+	parsed := parsedMessage{
+		MessageID: strings.Trim(msg.Header.Get("Message-Id"), "<> "),
+		From:      decodeAddresses(msg.Header.Get("From")),
+		To:        decodeAddresses(msg.Header.Get("To")),
+		Subject:   decodeHeader(msg.Header.Get("Subject")),
+	}
+	if date, err := msg.Header.Date(); err == nil {
+		parsed.Date = date
+	}
+	text, _ := bodyText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body, 0)
+	parsed.Snippet = snippet(text)
+	return parsed
+}
+
+// decodeHeader decodes the encoded words of a header, like =?UTF-8?Q?Caf=C3=A9?=
+func decodeHeader(value string) string {
+	decoded, err := headerDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// decodeAddresses formats addresses as "Name <address>", or as given when they do not parse
+func decodeAddresses(value string) string {
+	addresses, err := mail.ParseAddressList(value)
+	if err != nil {
+		return decodeHeader(value)
+	}
+	formatted := make([]string, len(addresses))
+	for i, address := range addresses {
+		if address.Name == "" {
+			formatted[i] = address.Address
+		} else {
+			formatted[i] = address.Name + " <" + address.Address + ">"
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// bodyText returns the text of a body, preferring a plain text part to an HTML one. It reports
+// whether the text is plain.
+func bodyText(contentType, encoding string, body io.Reader, depth int) (string, bool) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") && depth < 5 {
+		reader := multipart.NewReader(body, params["boundary"])
+		var html string
+		for {
+			// Parts cut off by the download limit end the message early
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			text, plain := bodyText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part, depth+1)
+			if plain && strings.TrimSpace(text) != "" {
+				return text, true
+			}
+			if html == "" {
+				html = text
+			}
+		}
+		return html, false
+	}
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return "", false
+	}
+	data, _ := io.ReadAll(decodeTransfer(encoding, body))
+	text := strings.ToValidUTF8(string(data), "")
+	if mediaType == "text/html" {
+		return htmlText(text), false
+	}
+	return text, true
+}
+
+// decodeTransfer undoes the content transfer encoding of a part
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	}
+	return body
+}
+
+var (
+	htmlHidden = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	htmlTag    = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// htmlText strips the tags of an HTML body, keeping its visible text
+func htmlText(html string) string {
+	text := htmlHidden.ReplaceAllString(html, " ")
+	text = htmlTag.ReplaceAllString(text, " ")
+	return strings.NewReplacer("&nbsp;", " ", "&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&#39;", "'").Replace(text)
+}
+
+// snippet collapses the whitespace of a text and cuts it to maxSnippet characters
+func snippet(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= maxSnippet {
+		return text
+	}
+	return string([]rune(text)[:maxSnippet]) + "…"
+}
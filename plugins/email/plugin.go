@@ -0,0 +1,1027 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+	"mindpalace/pkg/ui3d"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// defaultCheckInterval is how often the inbox is checked when no interval is configured
+const defaultCheckInterval = 5 * time.Minute
+
+// checkTimeout bounds a check of the inbox or a change of a message
+const checkTimeout = time.Minute
+
+// maxSummarized is the most emails summarized at once
+const maxSummarized = 20
+
+// maxStackCards is the most cards in the 3D stack of unread emails
+const maxStackCards = 10
+
+// stackPosition is where the stack of unread emails stands, next to the calendar hub
+var stackPosition = []float64{-4.0, 0.0, -10.0}
+
+const summaryPromptTemplate = `Summarize these emails for the user, who wants to know what needs their attention. For each email give the sender, what it is about and whether it asks anything of the user, in a sentence or two. Start with the ones that need a reply or action. Do not invent details.
+
+%s`
+
+// Email is a message in the inbox
+type Email struct {
+	EmailID   string    `json:"email_id"`
+	UID       uint32    `json:"uid"`
+	MessageID string    `json:"message_id,omitempty"`
+	From      string    `json:"from"`
+	To        string    `json:"to,omitempty"`
+	Subject   string    `json:"subject"`
+	Date      time.Time `json:"date"`
+	Snippet   string    `json:"snippet,omitempty"`
+	Unread    bool      `json:"unread"`
+	Flagged   bool      `json:"flagged"`
+}
+
+// EmailAggregate manages the state of the inbox
+type EmailAggregate struct {
+	Emails   map[string]*Email // Emails in the inbox, by ID
+	LastUID  uint32            // Highest UID seen, later messages are new
+	commands map[string]eventsourcing.CommandHandler
+	Mu       sync.RWMutex
+}
+
+// NewEmailAggregate creates a new thread-safe EmailAggregate
+func NewEmailAggregate() *EmailAggregate {
+	return &EmailAggregate{
+		Emails:   make(map[string]*Email),
+		commands: make(map[string]eventsourcing.CommandHandler),
+	}
+}
+
+// ID returns the aggregate's identifier
+func (a *EmailAggregate) ID() string {
+	return "email"
+}
+
+// emailSnapshot is the state saved in a snapshot
+type emailSnapshot struct {
+	Emails  map[string]*Email `json:"emails"`
+	LastUID uint32            `json:"last_uid"`
+}
+
+// SaveSnapshot serializes the inbox so it can be restored without a full replay
+func (a *EmailAggregate) SaveSnapshot() ([]byte, error) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return json.Marshal(emailSnapshot{Emails: a.Emails, LastUID: a.LastUID})
+}
+
+// LoadSnapshot replaces the inbox with the one from a snapshot
+func (a *EmailAggregate) LoadSnapshot(data []byte) error {
+	var snapshot emailSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to unmarshal snapshot: %v", err)
+	}
+	if snapshot.Emails == nil {
+		snapshot.Emails = make(map[string]*Email)
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	a.Emails = snapshot.Emails
+	a.LastUID = snapshot.LastUID
+	return nil
+}
+
+// ApplyEvent updates the inbox
+func (a *EmailAggregate) ApplyEvent(event eventsourcing.Event) error {
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event %s: %v", event.Type(), err)
+	}
+
+	switch event.Type() {
+	case "email_EmailReceived":
+		var e EmailReceivedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal EmailReceived: %v", err)
+		}
+		a.Emails[e.EmailID] = &Email{
+			EmailID:   e.EmailID,
+			UID:       e.UID,
+			MessageID: e.MessageID,
+			From:      e.From,
+			To:        e.To,
+			Subject:   e.Subject,
+			Date:      parseTime(e.Date),
+			Snippet:   e.Snippet,
+			Unread:    e.Unread,
+			Flagged:   e.Flagged,
+		}
+		if e.UID > a.LastUID {
+			a.LastUID = e.UID
+		}
+
+	case "email_ReadStatusChanged":
+		var e ReadStatusChangedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal ReadStatusChanged: %v", err)
+		}
+		for _, id := range e.Read {
+			if email, exists := a.Emails[id]; exists {
+				email.Unread = false
+			}
+		}
+		for _, id := range e.Unread {
+			if email, exists := a.Emails[id]; exists {
+				email.Unread = true
+			}
+		}
+
+	case "email_EmailFlagged":
+		var e EmailFlaggedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal EmailFlagged: %v", err)
+		}
+		if email, exists := a.Emails[e.EmailID]; exists {
+			email.Flagged = e.Flagged
+		}
+
+	case "email_EmailArchived":
+		var e EmailArchivedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal EmailArchived: %v", err)
+		}
+		delete(a.Emails, e.EmailID)
+
+	case "email_InboxChecked", "email_EmailsListed", "email_EmailsSummarized":
+		// Read-only events, no state change needed
+	}
+	return nil
+}
+
+// sortedEmails returns the emails in the inbox, newest first
+func (a *EmailAggregate) sortedEmails() []*Email {
+	emails := make([]*Email, 0, len(a.Emails))
+	for _, email := range a.Emails {
+		emails = append(emails, email)
+	}
+	sort.Slice(emails, func(i, j int) bool {
+		return emails[i].UID > emails[j].UID
+	})
+	return emails
+}
+
+// unreadEmails returns the unread emails in the inbox, newest first
+func (a *EmailAggregate) unreadEmails() []*Email {
+	var unread []*Email
+	for _, email := range a.sortedEmails() {
+		if email.Unread {
+			unread = append(unread, email)
+		}
+	}
+	return unread
+}
+
+// maxBriefingEmails is the most unread emails in the morning briefing, the newest
+const maxBriefingEmails = 10
+
+// BriefingItems returns the newest unread emails, flagged ones first
+func (a *EmailAggregate) BriefingItems(day time.Time) []eventsourcing.BriefingItem {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	unread := a.unreadEmails()
+	if len(unread) > maxBriefingEmails {
+		unread = unread[:maxBriefingEmails]
+	}
+	sort.SliceStable(unread, func(i, j int) bool { return unread[i].Flagged && !unread[j].Flagged })
+	items := make([]eventsourcing.BriefingItem, 0, len(unread))
+	for _, email := range unread {
+		text := fmt.Sprintf("From %s: %s", email.From, email.Subject)
+		if email.Flagged {
+			text += " (flagged)"
+		}
+		items = append(items, eventsourcing.BriefingItem{Section: "Email", Text: text, Time: email.Date})
+	}
+	return items
+}
+
+// EmailPlugin implements the plugin interface
+type EmailPlugin struct {
+	aggregate *EmailAggregate
+
+	configMu  sync.Mutex // Guards the fields below
+	mailbox   Mailbox
+	server    string
+	stopCheck chan struct{}
+	generate  eventsourcing.GenerateFunc
+
+	checkMu sync.Mutex // Held while the inbox is checked, so new emails are received once
+}
+
+func NewPlugin() eventsourcing.Plugin {
+	agg := NewEmailAggregate()
+	p := &EmailPlugin{aggregate: agg}
+	agg.commands = map[string]eventsourcing.CommandHandler{
+		"CheckEmail": eventsourcing.NewCommand(func(input *CheckEmailInput) ([]eventsourcing.Event, error) {
+			return p.checkEmailHandler(input)
+		}),
+		"ListEmails": eventsourcing.NewCommand(func(input *ListEmailsInput) ([]eventsourcing.Event, error) {
+			return p.listEmailsHandler(input)
+		}),
+		"SummarizeEmails": eventsourcing.NewCommand(func(input *SummarizeEmailsInput) ([]eventsourcing.Event, error) {
+			return p.summarizeEmailsHandler(input)
+		}),
+		"FlagEmail": eventsourcing.NewCommand(func(input *FlagEmailInput) ([]eventsourcing.Event, error) {
+			return p.flagEmailHandler(input)
+		}),
+		"ArchiveEmail": eventsourcing.NewCommand(func(input *ArchiveEmailInput) ([]eventsourcing.Event, error) {
+			return p.archiveEmailHandler(input)
+		}),
+	}
+	eventsourcing.RegisterEvent("email_EmailReceived", func() eventsourcing.Event { return &EmailReceivedEvent{} })
+	eventsourcing.RegisterEvent("email_ReadStatusChanged", func() eventsourcing.Event { return &ReadStatusChangedEvent{} })
+	eventsourcing.RegisterEvent("email_EmailFlagged", func() eventsourcing.Event { return &EmailFlaggedEvent{} })
+	eventsourcing.RegisterEvent("email_EmailArchived", func() eventsourcing.Event { return &EmailArchivedEvent{} })
+	eventsourcing.RegisterEvent("email_InboxChecked", func() eventsourcing.Event { return &InboxCheckedEvent{} })
+	eventsourcing.RegisterEvent("email_EmailsListed", func() eventsourcing.Event { return &EmailsListedEvent{} })
+	eventsourcing.RegisterTransientEvent("email_EmailsListed")
+	eventsourcing.RegisterEvent("email_EmailsSummarized", func() eventsourcing.Event { return &EmailsSummarizedEvent{} })
+	return p
+}
+
+// Commands returns the command handlers
+func (p *EmailPlugin) Commands() map[string]eventsourcing.CommandHandler {
+	return p.aggregate.commands
+}
+
+// Name returns the plugin name
+func (p *EmailPlugin) Name() string {
+	return "email"
+}
+
+// Manifest declares that the plugin checks mail over IMAP
+func (p *EmailPlugin) Manifest() eventsourcing.Manifest {
+	return eventsourcing.Manifest{
+		Version:      "1.0.0",
+		Capabilities: []string{eventsourcing.CapabilityNetwork},
+	}
+}
+
+// Schemas defines the command schemas
+func (p *EmailPlugin) Schemas() map[string]eventsourcing.CommandInput {
+	return map[string]eventsourcing.CommandInput{
+		"CheckEmail":      &CheckEmailInput{},
+		"ListEmails":      &ListEmailsInput{},
+		"SummarizeEmails": &SummarizeEmailsInput{},
+		"FlagEmail":       &FlagEmailInput{},
+		"ArchiveEmail":    &ArchiveEmailInput{},
+	}
+}
+
+// SetGenerateFunc gives the plugin the LLM to summarize emails with
+func (p *EmailPlugin) SetGenerateFunc(generate eventsourcing.GenerateFunc) {
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+	p.generate = generate
+}
+
+// Configure applies the [plugin.email] settings of the configuration file: imap_server ("host:port"),
+// username, password, mailbox, archive_mailbox and check_interval ("0" checks on request only)
+func (p *EmailPlugin) Configure(settings map[string]interface{}) error {
+	server, _ := settings["imap_server"].(string)
+	interval := defaultCheckInterval
+	if value, ok := settings["check_interval"].(string); ok && value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("check_interval %s cannot be parsed", value)
+		}
+		interval = parsed
+	}
+
+	var mailbox *IMAPClient
+	if server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			return fmt.Errorf("imap_server %s must be a host and port, like imap.example.com:993", server)
+		}
+		mailbox = &IMAPClient{Addr: server}
+		mailbox.Username, _ = settings["username"].(string)
+		mailbox.Password, _ = settings["password"].(string)
+		mailbox.Mailbox, _ = settings["mailbox"].(string)
+		mailbox.ArchiveMailbox, _ = settings["archive_mailbox"].(string)
+	}
+
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+	if p.stopCheck != nil {
+		close(p.stopCheck)
+		p.stopCheck = nil
+	}
+	p.mailbox, p.server = nil, server
+	if mailbox == nil {
+		return nil
+	}
+	p.mailbox = mailbox
+	if interval > 0 {
+		p.stopCheck = make(chan struct{})
+		go p.checkLoop(mailbox, interval, p.stopCheck)
+	}
+	return nil
+}
+
+// checkLoop checks the inbox right away and then periodically, until stop is closed
+func (p *EmailPlugin) checkLoop(mailbox Mailbox, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		eventBus := eventsourcing.GetGlobalEventBus()
+		if eventBus != nil && p.checkMu.TryLock() {
+			events, err := p.check(mailbox)
+			p.checkMu.Unlock()
+			if err != nil {
+				logging.Error("EMAIL: Checking the inbox failed: %v", err)
+			}
+			for _, event := range events {
+				eventBus.Publish(event)
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check fetches the new messages of the inbox and the unread ones, and returns the events changing the
+// inbox to match
+func (p *EmailPlugin) check(mailbox Mailbox) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	since := p.aggregate.LastUID
+	p.aggregate.Mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	state, err := mailbox.Check(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	unseen := make(map[uint32]bool, len(state.Unseen))
+	for _, uid := range state.Unseen {
+		unseen[uid] = true
+	}
+	var events []eventsourcing.Event
+	for _, message := range state.Messages {
+		parsed := parseMessage(message.Raw)
+		events = append(events, &EmailReceivedEvent{
+			EventType: "email_EmailReceived",
+			EmailID:   emailID(message.UID),
+			UID:       message.UID,
+			MessageID: parsed.MessageID,
+			From:      parsed.From,
+			To:        parsed.To,
+			Subject:   parsed.Subject,
+			Date:      formatTime(parsed.Date),
+			Snippet:   parsed.Snippet,
+			Unread:    !message.Seen,
+			Flagged:   message.Flagged,
+		})
+	}
+
+	// Emails read or marked unread in another mail client
+	changed := &ReadStatusChangedEvent{EventType: "email_ReadStatusChanged"}
+	p.aggregate.Mu.RLock()
+	for _, email := range p.aggregate.sortedEmails() {
+		if email.Unread && !unseen[email.UID] {
+			changed.Read = append(changed.Read, email.EmailID)
+		} else if !email.Unread && unseen[email.UID] {
+			changed.Unread = append(changed.Unread, email.EmailID)
+		}
+	}
+	p.aggregate.Mu.RUnlock()
+	if len(changed.Read) > 0 || len(changed.Unread) > 0 {
+		events = append(events, changed)
+	}
+	return events, nil
+}
+
+// configuredMailbox returns the mailbox, or an error telling how to configure one
+func (p *EmailPlugin) configuredMailbox() (Mailbox, error) {
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+	if p.mailbox == nil {
+		return nil, fmt.Errorf("email is not configured, set imap_server, username and password in [plugin.email]")
+	}
+	return p.mailbox, nil
+}
+
+// Command Input Structs with Schema Generation
+
+func (i *CheckEmailInput) New() any {
+	return &CheckEmailInput{}
+}
+
+// CheckEmailInput defines the input for checking the inbox for new emails
+type CheckEmailInput struct{}
+
+func (s *CheckEmailInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Checks the inbox for new emails right away",
+		"parameters": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+	}
+}
+
+func (i *ListEmailsInput) New() any {
+	return &ListEmailsInput{}
+}
+
+// ListEmailsInput defines the input for listing the emails in the inbox
+type ListEmailsInput struct {
+	UnreadOnly  bool   `json:"UnreadOnly,omitempty"`
+	FlaggedOnly bool   `json:"FlaggedOnly,omitempty"`
+	From        string `json:"From,omitempty"`
+}
+
+func (s *ListEmailsInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Lists the emails in the inbox, newest first",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"UnreadOnly": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Only list unread emails",
+				},
+				"FlaggedOnly": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Only list flagged emails",
+				},
+				"From": map[string]interface{}{
+					"type":        "string",
+					"description": "Only list emails whose sender contains this name or address",
+				},
+			},
+		},
+	}
+}
+
+func (i *SummarizeEmailsInput) New() any {
+	return &SummarizeEmailsInput{}
+}
+
+// SummarizeEmailsInput defines the input for summarizing emails
+type SummarizeEmailsInput struct {
+	EmailIDs []string `json:"EmailIDs,omitempty"`
+}
+
+func (s *SummarizeEmailsInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Summarizes emails and what they ask of the user",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"EmailIDs": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": fmt.Sprintf("IDs of the emails to summarize, the newest %d unread ones if omitted", maxSummarized),
+				},
+			},
+		},
+	}
+}
+
+func (i *FlagEmailInput) New() any {
+	return &FlagEmailInput{}
+}
+
+// FlagEmailInput defines the input for flagging an email
+type FlagEmailInput struct {
+	EmailID string `json:"EmailID"`
+	Flagged *bool  `json:"Flagged,omitempty"`
+}
+
+func (s *FlagEmailInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Flags an email for follow-up, or removes its flag",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"EmailID": map[string]interface{}{
+					"type":        "string",
+					"description": "ID of the email",
+				},
+				"Flagged": map[string]interface{}{
+					"type":        "boolean",
+					"description": "False to remove the flag, true if omitted",
+				},
+			},
+			"required": []string{"EmailID"},
+		},
+	}
+}
+
+func (i *ArchiveEmailInput) New() any {
+	return &ArchiveEmailInput{}
+}
+
+// ArchiveEmailInput defines the input for archiving an email
+type ArchiveEmailInput struct {
+	EmailID string `json:"EmailID"`
+}
+
+func (s *ArchiveEmailInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Moves an email out of the inbox to the archive",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"EmailID": map[string]interface{}{
+					"type":        "string",
+					"description": "ID of the email",
+				},
+			},
+			"required": []string{"EmailID"},
+		},
+	}
+}
+
+// Event Types
+type EmailReceivedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	EmailID   string `json:"email_id"`
+	UID       uint32 `json:"uid"`
+	MessageID string `json:"message_id,omitempty"`
+	From      string `json:"from"`
+	To        string `json:"to,omitempty"`
+	Subject   string `json:"subject"`
+	Date      string `json:"date,omitempty"`
+	Snippet   string `json:"snippet,omitempty"`
+	Unread    bool   `json:"unread"`
+	Flagged   bool   `json:"flagged"`
+}
+
+func (e *EmailReceivedEvent) Type() string { return "email_EmailReceived" }
+func (e *EmailReceivedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *EmailReceivedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ReadStatusChangedEvent records emails read or marked unread outside of MindPalace
+type ReadStatusChangedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string   `json:"event_type"`
+	Read      []string `json:"read,omitempty"`
+	Unread    []string `json:"unread,omitempty"`
+}
+
+func (e *ReadStatusChangedEvent) Type() string { return "email_ReadStatusChanged" }
+func (e *ReadStatusChangedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ReadStatusChangedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type EmailFlaggedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	EmailID   string `json:"email_id"`
+	Subject   string `json:"subject,omitempty"`
+	Flagged   bool   `json:"flagged"`
+}
+
+func (e *EmailFlaggedEvent) Type() string { return "email_EmailFlagged" }
+func (e *EmailFlaggedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *EmailFlaggedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type EmailArchivedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	EmailID   string `json:"email_id"`
+	Subject   string `json:"subject,omitempty"`
+}
+
+func (e *EmailArchivedEvent) Type() string { return "email_EmailArchived" }
+func (e *EmailArchivedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *EmailArchivedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// InboxCheckedEvent reports a check of the inbox asked for by the user
+type InboxCheckedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	NewEmails int    `json:"new_emails"`
+	Unread    int    `json:"unread"`
+}
+
+func (e *InboxCheckedEvent) Type() string { return "email_InboxChecked" }
+func (e *InboxCheckedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *InboxCheckedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// EmailSummary describes an email without its text
+type EmailSummary struct {
+	EmailID string `json:"email_id"`
+	From    string `json:"from"`
+	Subject string `json:"subject"`
+	Date    string `json:"date,omitempty"`
+	Unread  bool   `json:"unread"`
+	Flagged bool   `json:"flagged"`
+}
+
+type EmailsListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string         `json:"event_type"`
+	Emails    []EmailSummary `json:"emails"`
+	Unread    int            `json:"unread"`
+}
+
+func (e *EmailsListedEvent) Type() string { return "email_EmailsListed" }
+func (e *EmailsListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *EmailsListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type EmailsSummarizedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string   `json:"event_type"`
+	EmailIDs  []string `json:"email_ids"`
+	Summary   string   `json:"summary"`
+}
+
+func (e *EmailsSummarizedEvent) Type() string { return "email_EmailsSummarized" }
+func (e *EmailsSummarizedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *EmailsSummarizedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// Utility functions
+func emailID(uid uint32) string {
+	return fmt.Sprintf("email_%d", uid)
+}
+
+func parseTime(timeStr string) time.Time {
+	if timeStr == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, timeStr)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func summarize(email *Email) EmailSummary {
+	return EmailSummary{
+		EmailID: email.EmailID,
+		From:    email.From,
+		Subject: email.Subject,
+		Date:    formatTime(email.Date),
+		Unread:  email.Unread,
+		Flagged: email.Flagged,
+	}
+}
+
+// Command Handlers
+func (p *EmailPlugin) checkEmailHandler(input *CheckEmailInput) ([]eventsourcing.Event, error) {
+	mailbox, err := p.configuredMailbox()
+	if err != nil {
+		return nil, err
+	}
+	p.checkMu.Lock()
+	defer p.checkMu.Unlock()
+	events, err := p.check(mailbox)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check the inbox: %v", err)
+	}
+
+	checked := &InboxCheckedEvent{EventType: "email_InboxChecked"}
+	unread := make(map[string]bool)
+	p.aggregate.Mu.RLock()
+	for _, email := range p.aggregate.unreadEmails() {
+		unread[email.EmailID] = true
+	}
+	p.aggregate.Mu.RUnlock()
+	for _, event := range events {
+		switch e := event.(type) {
+		case *EmailReceivedEvent:
+			checked.NewEmails++
+			if e.Unread {
+				unread[e.EmailID] = true
+			}
+		case *ReadStatusChangedEvent:
+			for _, id := range e.Read {
+				delete(unread, id)
+			}
+			for _, id := range e.Unread {
+				unread[id] = true
+			}
+		}
+	}
+	checked.Unread = len(unread)
+	return append(events, checked), nil
+}
+
+func (p *EmailPlugin) listEmailsHandler(input *ListEmailsInput) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+
+	event := &EmailsListedEvent{EventType: "email_EmailsListed", Emails: []EmailSummary{}}
+	from := strings.ToLower(input.From)
+	for _, email := range p.aggregate.sortedEmails() {
+		if email.Unread {
+			event.Unread++
+		}
+		if (input.UnreadOnly && !email.Unread) || (input.FlaggedOnly && !email.Flagged) {
+			continue
+		}
+		if from != "" && !strings.Contains(strings.ToLower(email.From), from) {
+			continue
+		}
+		event.Emails = append(event.Emails, summarize(email))
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *EmailPlugin) summarizeEmailsHandler(input *SummarizeEmailsInput) ([]eventsourcing.Event, error) {
+	p.configMu.Lock()
+	generate := p.generate
+	p.configMu.Unlock()
+	if generate == nil {
+		return nil, fmt.Errorf("no LLM is available to summarize emails")
+	}
+
+	p.aggregate.Mu.RLock()
+	var emails []*Email
+	if len(input.EmailIDs) == 0 {
+		emails = p.aggregate.unreadEmails()
+		if len(emails) > maxSummarized {
+			emails = emails[:maxSummarized]
+		}
+	}
+	for _, id := range input.EmailIDs {
+		email, exists := p.aggregate.Emails[id]
+		if !exists {
+			p.aggregate.Mu.RUnlock()
+			return nil, fmt.Errorf("email %s not found", id)
+		}
+		emails = append(emails, email)
+	}
+	var transcript strings.Builder
+	ids := make([]string, len(emails))
+	for i, email := range emails {
+		ids[i] = email.EmailID
+		transcript.WriteString(fmt.Sprintf("From: %s\nSubject: %s\nDate: %s\n\n%s\n\n---\n\n", email.From, email.Subject, email.Date.Local().Format("2006-01-02 15:04"), email.Snippet))
+	}
+	p.aggregate.Mu.RUnlock()
+	if len(emails) == 0 {
+		return nil, fmt.Errorf("there are no unread emails to summarize")
+	}
+
+	summary, err := generate(fmt.Sprintf(summaryPromptTemplate, transcript.String()))
+	if err != nil {
+		return nil, err
+	}
+	event := &EmailsSummarizedEvent{
+		EventType: "email_EmailsSummarized",
+		EmailIDs:  ids,
+		Summary:   summary,
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *EmailPlugin) flagEmailHandler(input *FlagEmailInput) ([]eventsourcing.Event, error) {
+	if input.EmailID == "" {
+		return nil, fmt.Errorf("emailID is required and must be a non-empty string")
+	}
+	flagged := input.Flagged == nil || *input.Flagged
+	email, err := p.email(input.EmailID)
+	if err != nil {
+		return nil, err
+	}
+	mailbox, err := p.configuredMailbox()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	if err := mailbox.SetFlagged(ctx, email.UID, flagged); err != nil {
+		return nil, fmt.Errorf("failed to flag email %s: %v", input.EmailID, err)
+	}
+	event := &EmailFlaggedEvent{
+		EventType: "email_EmailFlagged",
+		EmailID:   email.EmailID,
+		Subject:   email.Subject,
+		Flagged:   flagged,
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *EmailPlugin) archiveEmailHandler(input *ArchiveEmailInput) ([]eventsourcing.Event, error) {
+	if input.EmailID == "" {
+		return nil, fmt.Errorf("emailID is required and must be a non-empty string")
+	}
+	email, err := p.email(input.EmailID)
+	if err != nil {
+		return nil, err
+	}
+	mailbox, err := p.configuredMailbox()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	if err := mailbox.Archive(ctx, email.UID); err != nil {
+		return nil, fmt.Errorf("failed to archive email %s: %v", input.EmailID, err)
+	}
+	event := &EmailArchivedEvent{
+		EventType: "email_EmailArchived",
+		EmailID:   email.EmailID,
+		Subject:   email.Subject,
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+// email returns a copy of an email in the inbox
+func (p *EmailPlugin) email(id string) (Email, error) {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	email, exists := p.aggregate.Emails[id]
+	if !exists {
+		return Email{}, fmt.Errorf("email %s not found", id)
+	}
+	return *email, nil
+}
+
+// GetCustomUI lists the emails in the inbox, newest first, unread ones in bold
+func (a *EmailAggregate) GetCustomUI() fyne.CanvasObject {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+
+	content := container.NewVBox()
+	unread := len(a.unreadEmails())
+	content.Add(widget.NewLabel(fmt.Sprintf("%d emails, %d unread", len(a.Emails), unread)))
+	content.Add(widget.NewSeparator())
+	if len(a.Emails) == 0 {
+		content.Add(widget.NewLabel("No emails yet. Configure [plugin.email] and ask MindPalace to check your email."))
+		return container.NewVScroll(content)
+	}
+	for _, email := range a.sortedEmails() {
+		subject := email.Subject
+		if email.Flagged {
+			subject = "⚑ " + subject
+		}
+		title := widget.NewLabel(subject)
+		title.TextStyle = fyne.TextStyle{Bold: email.Unread}
+		details := widget.NewLabel(fmt.Sprintf("%s · %s", email.From, email.Date.Local().Format("2006-01-02 15:04")))
+		details.Wrapping = fyne.TextWrapWord
+		content.Add(container.NewVBox(title, details))
+		content.Add(widget.NewSeparator())
+	}
+	return container.NewVScroll(content)
+}
+
+// Additional Plugin Methods
+func (p *EmailPlugin) Aggregate() eventsourcing.Aggregate {
+	return p.aggregate
+}
+
+func (p *EmailPlugin) Type() eventsourcing.PluginType {
+	return eventsourcing.LLMPlugin
+}
+
+func (p *EmailPlugin) SystemPrompt() string {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+
+	emails := "Emails in the inbox, newest first:\n"
+	sorted := p.aggregate.sortedEmails()
+	if len(sorted) > 30 {
+		sorted = sorted[:30]
+	}
+	for _, email := range sorted {
+		status := ""
+		if email.Unread {
+			status += " (unread)"
+		}
+		if email.Flagged {
+			status += " (flagged)"
+		}
+		emails += fmt.Sprintf("- Email ID: %s, From: %s, Subject: \"%s\"%s\n", email.EmailID, email.From, email.Subject, status)
+	}
+
+	return `You are InboxTriage, a specialized AI for managing the user's email inbox in MindPalace.
+
+The user input will be a JSON object containing the arguments for the command to execute. Parse the JSON and call the appropriate command with the parsed values.
+
+Your job is to interpret user requests about email and execute the right commands (CheckEmail, ListEmails, SummarizeEmails, FlagEmail, ArchiveEmail).
+
+` + emails + `
+When interpreting user requests, pay close attention to the intent:
+- If the user asks whether they have new mail, use the CheckEmail command.
+- If the user wants to see their emails, or those from someone, use the ListEmails command.
+- If the user asks what their emails are about or what needs their attention, use the SummarizeEmails command.
+- If the user wants to remember to follow up on an email, use the FlagEmail command; to remove the flag, set Flagged to false.
+- If the user is done with an email or wants it out of the inbox, use the ArchiveEmail command.
+
+Use the exact Email ID from the list above.`
+}
+
+// AgentModel specifies the LLM model to use for this plugin's agent
+func (p *EmailPlugin) AgentModel() string {
+	return "gpt-oss:20b"
+}
+
+func (p *EmailPlugin) EventHandlers() map[string]eventsourcing.EventHandler {
+	return nil
+}
+
+// Broadcast3DDelta rebuilds the stack of unread emails when the inbox changes
+func (a *EmailAggregate) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
+	switch event.(type) {
+	case *EmailReceivedEvent, *ReadStatusChangedEvent, *EmailArchivedEvent:
+		a.Mu.RLock()
+		defer a.Mu.RUnlock()
+		var actions []eventsourcing.DeltaAction
+		for i := 0; i < maxStackCards; i++ {
+			actions = append(actions,
+				eventsourcing.DeltaAction{Type: "delete", NodeID: stackCardID(i)},
+				eventsourcing.DeltaAction{Type: "delete", NodeID: stackCardID(i) + "_label"},
+			)
+		}
+		return append(actions, a.unreadStack()...)
+	}
+	return nil
+}
+
+func (a *EmailAggregate) GetFull3DState() []eventsourcing.DeltaAction {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return a.unreadStack()
+}
+
+func stackCardID(i int) string {
+	return fmt.Sprintf("email_stack_%d", i)
+}
+
+// unreadStack piles a flat card per unread email, up to maxStackCards, with the unread count on top
+func (a *EmailAggregate) unreadStack() []eventsourcing.DeltaAction {
+	unread := a.unreadEmails()
+	cards := min(len(unread), maxStackCards)
+	theme := ui3d.CurrentTheme()
+	var actions []eventsourcing.DeltaAction
+	for i := 0; i < cards; i++ {
+		// The newest email is on top
+		email := unread[cards-1-i]
+		object := ui3d.StandardObject{
+			ID:       stackCardID(i),
+			MeshType: "box",
+			Position: []float64{stackPosition[0], stackPosition[1] + float64(i)*0.25, stackPosition[2]},
+			Theme:    theme,
+			Extra:    map[string]interface{}{"scale": []float64{1.2, 0.15, 0.8}, "event_type": "email_unread"},
+			DisplayInfo: &ui3d.DisplayInfo{
+				Title:       email.Subject,
+				Description: email.From,
+				Details:     map[string]interface{}{"email_id": email.EmailID, "date": formatTime(email.Date)},
+			},
+		}
+		if i == cards-1 {
+			object.Label = &ui3d.LabelConfig{Text: fmt.Sprintf("%d unread", len(unread))}
+		}
+		actions = append(actions, ui3d.CreateStandardObject(object)...)
+	}
+	return actions
+}
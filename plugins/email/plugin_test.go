@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// fakeMailbox is an inbox kept in memory
+type fakeMailbox struct {
+	messages map[uint32]Message
+	flagged  map[uint32]bool
+	archived []uint32
+}
+
+func newFakeMailbox(messages ...Message) *fakeMailbox {
+	m := &fakeMailbox{messages: make(map[uint32]Message), flagged: make(map[uint32]bool)}
+	for _, message := range messages {
+		m.messages[message.UID] = message
+	}
+	return m
+}
+
+func (m *fakeMailbox) Check(ctx context.Context, sinceUID uint32) (*InboxState, error) {
+	state := &InboxState{}
+	for uid := uint32(1); uid <= 100; uid++ {
+		message, exists := m.messages[uid]
+		if !exists {
+			continue
+		}
+		if uid > sinceUID {
+			state.Messages = append(state.Messages, message)
+		}
+		if !message.Seen {
+			state.Unseen = append(state.Unseen, uid)
+		}
+	}
+	return state, nil
+}
+
+func (m *fakeMailbox) SetFlagged(ctx context.Context, uid uint32, flagged bool) error {
+	m.flagged[uid] = flagged
+	return nil
+}
+
+func (m *fakeMailbox) Archive(ctx context.Context, uid uint32) error {
+	m.archived = append(m.archived, uid)
+	delete(m.messages, uid)
+	return nil
+}
+
+func rawMessage(from, subject, body string) []byte {
+	return []byte(fmt.Sprintf("From: %s\r\nTo: me@example.com\r\nSubject: %s\r\nDate: Mon, 02 Jun 2025 09:30:00 +0200\r\nMessage-ID: <%s@example.com>\r\n\r\n%s\r\n", from, subject, strings.ReplaceAll(subject, " ", ""), body))
+}
+
+func newEmailPlugin(t *testing.T, mailbox Mailbox) *EmailPlugin {
+	t.Helper()
+	p := NewPlugin().(*EmailPlugin)
+	p.mailbox = mailbox
+	return p
+}
+
+func apply(t *testing.T, p *EmailPlugin, events []eventsourcing.Event) {
+	t.Helper()
+	for _, event := range events {
+		if err := p.aggregate.ApplyEvent(event); err != nil {
+			t.Fatalf("ApplyEvent failed: %v", err)
+		}
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	raw := "From: =?UTF-8?Q?Ren=C3=A9e?= <renee@example.com>\r\n" +
+		"Subject: =?UTF-8?Q?Caf=C3=A9_tomorrow?=\r\n" +
+		"Date: Mon, 02 Jun 2025 09:30:00 +0200\r\n" +
+		"Message-ID: <abc@example.com>\r\n" +
+		"Content-Type: multipart/alternative; boundary=XYZ\r\n\r\n" +
+		"--XYZ\r\nContent-Type: text/html\r\n\r\n<p>Shall we <b>meet</b>?</p>\r\n" +
+		"--XYZ\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nShall we meet at the caf=C3=A9?\r\n" +
+		"--XYZ--\r\n"
+	parsed := parseMessage([]byte(raw))
+	if parsed.From != "Renée <renee@example.com>" || parsed.Subject != "Café tomorrow" || parsed.MessageID != "abc@example.com" {
+		t.Errorf("Unexpected headers %+v", parsed)
+	}
+	if parsed.Snippet != "Shall we meet at the café?" {
+		t.Errorf("Expected the plain text part, got %q", parsed.Snippet)
+	}
+	if parsed.Date.IsZero() {
+		t.Error("Expected the date to be parsed")
+	}
+
+	html := parseMessage([]byte("Subject: News\r\nContent-Type: text/html\r\n\r\n<style>p{}</style><p>Big&nbsp;sale</p>"))
+	if html.Snippet != "Big sale" {
+		t.Errorf("Expected the text of the HTML, got %q", html.Snippet)
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	values, err := parseResponse("* 3 FETCH (UID 42 FLAGS (\\Seen \\Flagged) BODY[HEADER.FIELDS (FROM)]<0> {11}\r\nFrom: a\r\n\r\n SUBJECT \"say \\\"hi\\\"\" X NIL)\r\n")
+	if err != nil {
+		t.Fatalf("parseResponse failed: %v", err)
+	}
+	items := values[3].([]any)
+	if atom(items[1]) != "42" || len(items[3].([]any)) != 2 {
+		t.Errorf("Unexpected items %#v", items)
+	}
+	if atom(items[4]) != "BODY[HEADER.FIELDS (FROM)]<0>" || atom(items[5]) != "From: a\r\n\r\n" {
+		t.Errorf("Expected the section and its literal, got %q and %q", items[4], items[5])
+	}
+	if atom(items[7]) != `say "hi"` || items[9] != nil {
+		t.Errorf("Expected the quoted string and NIL, got %#v", items[6:])
+	}
+}
+
+// serveIMAP answers the commands of one connection with the lines scripted for them
+func serveIMAP(t *testing.T, script map[string][]string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "* OK IMAP ready\r\n")
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			tag, cmd, _ := strings.Cut(strings.TrimSpace(line), " ")
+			for prefix, lines := range script {
+				if strings.HasPrefix(cmd, prefix) {
+					for _, l := range lines {
+						fmt.Fprint(conn, l+"\r\n")
+					}
+				}
+			}
+			fmt.Fprintf(conn, "%s OK done\r\n", tag)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestIMAPClient_Check(t *testing.T) {
+	message := string(rawMessage("bob@example.com", "Invoice", "Please pay"))
+	addr := serveIMAP(t, map[string][]string{
+		"CAPABILITY":        {"* CAPABILITY IMAP4rev1 MOVE"},
+		"UID SEARCH UID":    {"* SEARCH 7 8"},
+		"UID SEARCH UNSEEN": {"* SEARCH 8"},
+		"UID FETCH 8": {
+			fmt.Sprintf("* 2 FETCH (UID 8 FLAGS (\\Flagged) BODY[]<0> {%d}", len(message)),
+			message + ")",
+		},
+	})
+	client := &IMAPClient{Addr: addr, Username: "me", Password: `p"w`, Insecure: true}
+	state, err := client.Check(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if len(state.Messages) != 1 || state.Messages[0].UID != 8 || !state.Messages[0].Flagged || state.Messages[0].Seen {
+		t.Fatalf("Expected message 8, flagged and unread, got %+v", state.Messages)
+	}
+	if parsed := parseMessage(state.Messages[0].Raw); parsed.Subject != "Invoice" {
+		t.Errorf("Expected the message to be fetched whole, got %+v", parsed)
+	}
+	if len(state.Unseen) != 1 || state.Unseen[0] != 8 {
+		t.Errorf("Expected message 8 to be unread, got %v", state.Unseen)
+	}
+}
+
+func TestEmailPlugin_CheckEmail(t *testing.T) {
+	mailbox := newFakeMailbox(
+		Message{UID: 1, Raw: rawMessage("Alice <alice@example.com>", "Lunch", "Lunch on Friday?"), Seen: true},
+		Message{UID: 2, Raw: rawMessage("bob@example.com", "Invoice", "Please pay")},
+	)
+	p := newEmailPlugin(t, mailbox)
+
+	events, err := p.checkEmailHandler(&CheckEmailInput{})
+	if err != nil {
+		t.Fatalf("checkEmailHandler failed: %v", err)
+	}
+	checked := events[len(events)-1].(*InboxCheckedEvent)
+	if checked.NewEmails != 2 || checked.Unread != 1 {
+		t.Errorf("Expected 2 new emails, 1 unread, got %+v", checked)
+	}
+	apply(t, p, events)
+	if email := p.aggregate.Emails["email_1"]; email == nil || email.From != "Alice <alice@example.com>" || email.Unread {
+		t.Errorf("Unexpected email %+v", email)
+	}
+	if p.aggregate.LastUID != 2 {
+		t.Errorf("Expected the last UID to be 2, got %d", p.aggregate.LastUID)
+	}
+
+	// Reading an email elsewhere is picked up by the next check
+	message := mailbox.messages[2]
+	message.Seen = true
+	mailbox.messages[2] = message
+	events, err = p.check(mailbox)
+	if err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected only a read status change, got %+v", events)
+	}
+	if changed := events[0].(*ReadStatusChangedEvent); len(changed.Read) != 1 || changed.Read[0] != "email_2" {
+		t.Errorf("Expected email_2 to be read, got %+v", changed)
+	}
+	apply(t, p, events)
+	if len(p.aggregate.unreadEmails()) != 0 {
+		t.Error("Expected no unread emails")
+	}
+}
+
+func TestEmailPlugin_FlagAndArchive(t *testing.T) {
+	mailbox := newFakeMailbox(Message{UID: 5, Raw: rawMessage("bob@example.com", "Invoice", "Please pay")})
+	p := newEmailPlugin(t, mailbox)
+	events, _ := p.check(mailbox)
+	apply(t, p, events)
+
+	events, err := p.flagEmailHandler(&FlagEmailInput{EmailID: "email_5"})
+	if err != nil {
+		t.Fatalf("flagEmailHandler failed: %v", err)
+	}
+	apply(t, p, events)
+	if !mailbox.flagged[5] || !p.aggregate.Emails["email_5"].Flagged {
+		t.Error("Expected the email to be flagged on the server and in the inbox")
+	}
+
+	if _, err := p.archiveEmailHandler(&ArchiveEmailInput{EmailID: "email_9"}); err == nil {
+		t.Error("Expected an error for an unknown email")
+	}
+	events, err = p.archiveEmailHandler(&ArchiveEmailInput{EmailID: "email_5"})
+	if err != nil {
+		t.Fatalf("archiveEmailHandler failed: %v", err)
+	}
+	apply(t, p, events)
+	if len(mailbox.archived) != 1 || len(p.aggregate.Emails) != 0 {
+		t.Errorf("Expected the email to be archived, got %v archived and %d in the inbox", mailbox.archived, len(p.aggregate.Emails))
+	}
+}
+
+func TestEmailPlugin_NotConfigured(t *testing.T) {
+	p := NewPlugin().(*EmailPlugin)
+	if _, err := p.checkEmailHandler(&CheckEmailInput{}); err == nil || !strings.Contains(err.Error(), "imap_server") {
+		t.Errorf("Expected an error telling how to configure email, got %v", err)
+	}
+	if err := p.Configure(map[string]interface{}{"imap_server": "imap.example.com"}); err == nil {
+		t.Error("Expected an error for a server without a port")
+	}
+}
+
+func TestEmailPlugin_SummarizeEmails(t *testing.T) {
+	mailbox := newFakeMailbox(
+		Message{UID: 1, Raw: rawMessage("alice@example.com", "Lunch", "Lunch on Friday?"), Seen: true},
+		Message{UID: 2, Raw: rawMessage("bob@example.com", "Invoice", "Please pay")},
+	)
+	p := newEmailPlugin(t, mailbox)
+	events, _ := p.check(mailbox)
+	apply(t, p, events)
+
+	if _, err := p.summarizeEmailsHandler(&SummarizeEmailsInput{}); err == nil {
+		t.Error("Expected an error without an LLM")
+	}
+	var prompt string
+	p.SetGenerateFunc(func(p string) (string, error) {
+		prompt = p
+		return "Bob wants you to pay an invoice.", nil
+	})
+	events, err := p.summarizeEmailsHandler(&SummarizeEmailsInput{})
+	if err != nil {
+		t.Fatalf("summarizeEmailsHandler failed: %v", err)
+	}
+	summarized := events[0].(*EmailsSummarizedEvent)
+	if len(summarized.EmailIDs) != 1 || summarized.EmailIDs[0] != "email_2" || summarized.Summary == "" {
+		t.Errorf("Expected the unread email to be summarized, got %+v", summarized)
+	}
+	if !strings.Contains(prompt, "Please pay") || strings.Contains(prompt, "Lunch on Friday") {
+		t.Errorf("Expected only the unread email in the prompt, got %q", prompt)
+	}
+}
+
+func TestEmailAggregate_UnreadStack(t *testing.T) {
+	mailbox := newFakeMailbox()
+	for uid := uint32(1); uid <= 12; uid++ {
+		mailbox.messages[uid] = Message{UID: uid, Raw: rawMessage("bob@example.com", fmt.Sprintf("Mail %d", uid), "Hi")}
+	}
+	p := newEmailPlugin(t, mailbox)
+	events, _ := p.check(mailbox)
+	apply(t, p, events)
+
+	actions := p.aggregate.GetFull3DState()
+	var cards, labels int
+	for _, action := range actions {
+		if strings.HasSuffix(action.NodeID, "_label") {
+			labels++
+			if action.Properties["text"] != "12 unread" {
+				t.Errorf("Expected the unread count on top, got %v", action.Properties["text"])
+			}
+		} else {
+			cards++
+		}
+	}
+	if cards != maxStackCards || labels != 1 {
+		t.Errorf("Expected %d cards and 1 label, got %d and %d", maxStackCards, cards, labels)
+	}
+	top := actions[len(actions)-2].Properties["display_info"].(map[string]interface{})
+	if top["title"] != "Mail 12" {
+		t.Errorf("Expected the newest email on top, got %v", top["title"])
+	}
+
+	deltas := p.aggregate.Broadcast3DDelta(events[0])
+	if deltas[0].Type != "delete" || len(deltas) != 2*maxStackCards+len(actions) {
+		t.Errorf("Expected the stack to be rebuilt, got %d actions", len(deltas))
+	}
+}
+
+func TestEmailAggregate_BriefingItems(t *testing.T) {
+	mailbox := newFakeMailbox()
+	for uid := uint32(1); uid <= 12; uid++ {
+		mailbox.messages[uid] = Message{UID: uid, Raw: rawMessage("bob@example.com", fmt.Sprintf("Mail %d", uid), "Hi")}
+	}
+	p := newEmailPlugin(t, mailbox)
+	events, _ := p.check(mailbox)
+	apply(t, p, events)
+	for _, email := range p.aggregate.Emails {
+		if email.Subject == "Mail 3" {
+			email.Flagged = true
+		}
+	}
+
+	items := p.aggregate.BriefingItems(time.Now())
+	if len(items) != maxBriefingEmails {
+		t.Fatalf("Expected the %d newest unread emails, got %d", maxBriefingEmails, len(items))
+	}
+	if items[0].Text != "From bob@example.com: Mail 3 (flagged)" || items[1].Text != "From bob@example.com: Mail 12" {
+		t.Errorf("Expected the flagged email first, then the newest, got %q and %q", items[0].Text, items[1].Text)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxImportRows is the most transactions one CSV file can hold
+const maxImportRows = 10000
+
+// Header names the columns of bank exports are recognized by, lowercase
+var (
+	dateColumns        = []string{"date", "booking date", "transaction date", "datum", "value date"}
+	amountColumns      = []string{"amount", "value", "bedrag", "amount (eur)", "amount (usd)"}
+	debitColumns       = []string{"debit", "withdrawal", "out", "paid out"}
+	creditColumns      = []string{"credit", "deposit", "in", "paid in"}
+	descriptionColumns = []string{"description", "payee", "name", "merchant", "memo", "details", "omschrijving", "counterparty"}
+	categoryColumns    = []string{"category", "categorie"}
+)
+
+// defaultDateLayouts are tried in order when no date format is given; days come before months, as in
+// most bank exports outside the US
+var defaultDateLayouts = []string{"2006-01-02", "02/01/2006", "02-01-2006", "02.01.2006", "20060102", "2006/01/02"}
+
+// csvRow is a transaction read from a CSV file
+type csvRow struct {
+	Date        time.Time
+	AmountCents int64
+	Description string
+	Category    string
+}
+
+// csvColumns holds the indexes of the columns of a CSV file, -1 if it has none
+type csvColumns struct {
+	date, amount, debit, credit, description, category int
+}
+
+// findColumn returns the index of the first header with one of the names, -1 if there is none
+func findColumn(header []string, names []string) int {
+	for _, name := range names {
+		for i, column := range header {
+			if strings.EqualFold(strings.TrimSpace(column), name) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// dateLayout turns a format like DD/MM/YYYY into a Go time layout
+func dateLayout(format string) string {
+	return strings.NewReplacer("YYYY", "2006", "YY", "06", "MM", "01", "DD", "02").Replace(strings.ToUpper(format))
+}
+
+// readCSV reads the transactions of a bank export. The delimiter is detected, and the columns are found by
+// their header: a date, an amount or separate debit and credit columns, and optionally a description and
+// a category. Negative amounts and debits are expenses.
+func readCSV(path, dateFormat string) ([]csvRow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = detectDelimiter(text)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header of %s: %v", path, err)
+	}
+	columns := csvColumns{
+		date:        findColumn(header, dateColumns),
+		amount:      findColumn(header, amountColumns),
+		debit:       findColumn(header, debitColumns),
+		credit:      findColumn(header, creditColumns),
+		description: findColumn(header, descriptionColumns),
+		category:    findColumn(header, categoryColumns),
+	}
+	if columns.date < 0 {
+		return nil, fmt.Errorf("%s has no date column, expected one of: %s", path, strings.Join(dateColumns, ", "))
+	}
+	if columns.amount < 0 && columns.debit < 0 && columns.credit < 0 {
+		return nil, fmt.Errorf("%s has no amount column, expected one of: %s, or debit and credit columns", path, strings.Join(amountColumns, ", "))
+	}
+	layouts := defaultDateLayouts
+	if dateFormat != "" {
+		layouts = []string{dateLayout(dateFormat)}
+	}
+
+	var rows []csvRow
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d of %s: %v", line, path, err)
+		}
+		if isBlank(record) {
+			continue
+		}
+		row, err := parseRow(record, columns, layouts)
+		if err != nil {
+			return nil, fmt.Errorf("line %d of %s: %v", line, path, err)
+		}
+		if row.AmountCents == 0 {
+			continue
+		}
+		rows = append(rows, row)
+		if len(rows) > maxImportRows {
+			return nil, fmt.Errorf("%s has more than %d transactions, split it", path, maxImportRows)
+		}
+	}
+	return rows, nil
+}
+
+// detectDelimiter returns the most common of comma, semicolon and tab in the first line
+func detectDelimiter(text string) rune {
+	first, _, _ := strings.Cut(text, "\n")
+	delimiter, most := ',', strings.Count(first, ",")
+	for _, candidate := range []rune{';', '\t'} {
+		if n := strings.Count(first, string(candidate)); n > most {
+			delimiter, most = candidate, n
+		}
+	}
+	return delimiter
+}
+
+func isBlank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// field returns the trimmed value of a column, empty if the record has no such column
+func field(record []string, column int) string {
+	if column < 0 || column >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[column])
+}
+
+func parseRow(record []string, columns csvColumns, layouts []string) (csvRow, error) {
+	var row csvRow
+	date := field(record, columns.date)
+	var err error
+	for _, layout := range layouts {
+		if row.Date, err = time.Parse(layout, date); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return row, fmt.Errorf("date %q does not match the date format", date)
+	}
+
+	if value := field(record, columns.amount); value != "" {
+		if row.AmountCents, err = parseCents(value); err != nil {
+			return row, err
+		}
+	} else {
+		debit, credit := field(record, columns.debit), field(record, columns.credit)
+		if debit != "" {
+			cents, err := parseCents(debit)
+			if err != nil {
+				return row, err
+			}
+			row.AmountCents -= abs(cents)
+		}
+		if credit != "" {
+			cents, err := parseCents(credit)
+			if err != nil {
+				return row, err
+			}
+			row.AmountCents += abs(cents)
+		}
+	}
+	row.Description = field(record, columns.description)
+	row.Category = field(record, columns.category)
+	return row, nil
+}
+
+// parseCents parses an amount like -12.50, 1,234.56, 1.234,56, € 12,50 or (12.50) into cents
+func parseCents(value string) (int64, error) {
+	s := strings.TrimSpace(value)
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+	s = strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || r == '.' || r == ',' || r == '-' || r == '+' {
+			return r
+		}
+		return -1
+	}, s)
+	if strings.HasPrefix(s, "-") {
+		negative = !negative
+	}
+	s = strings.TrimLeft(s, "+-")
+
+	// The last separator is the decimal one when two digits or fewer follow it
+	lastDot, lastComma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	decimal := max(lastDot, lastComma)
+	if decimal >= 0 && len(s)-decimal-1 <= 2 {
+		s = strings.NewReplacer(".", "", ",", "").Replace(s[:decimal]) + "." + s[decimal+1:]
+	} else {
+		s = strings.NewReplacer(".", "", ",", "").Replace(s)
+	}
+	amount, err := strconv.ParseFloat(s, 64)
+	if err != nil || s == "" {
+		return 0, fmt.Errorf("amount %q is not a number", value)
+	}
+	cents := int64(math.Round(amount * 100))
+	if negative {
+		cents = -cents
+	}
+	return cents, nil
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
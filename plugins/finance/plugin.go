@@ -0,0 +1,1216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/ui3d"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// defaultCurrency is the currency amounts are shown in when none is configured
+const defaultCurrency = "EUR"
+
+// uncategorized is the category of transactions logged or imported without one
+const uncategorized = "uncategorized"
+
+// maxListed is the most transactions listed at once
+const maxListed = 100
+
+// Layout of the 3D bar chart of this month's spending, which stands next to the task area
+var chartOrigin = []float64{8.0, 0.0, 0.0}
+
+const (
+	barSpacing   = 1.5
+	maxBarHeight = 5.0
+)
+
+// Transaction is an expense or an income; expenses have a negative amount
+type Transaction struct {
+	TransactionID string    `json:"transaction_id"`
+	Date          time.Time `json:"date"`
+	AmountCents   int64     `json:"amount_cents"`
+	Category      string    `json:"category"`
+	Description   string    `json:"description,omitempty"`
+	Source        string    `json:"source,omitempty"` // File the transaction was imported from
+}
+
+// FinanceAggregate manages transactions and the balance of each category
+type FinanceAggregate struct {
+	Transactions map[string]*Transaction // Transactions by ID
+	Balances     map[string]int64        // Sum of the amounts of each category, in cents
+	currency     string
+	charted      map[string]bool // Nodes of the 3D chart, deleted before it is redrawn
+	commands     map[string]eventsourcing.CommandHandler
+	Mu           sync.RWMutex
+}
+
+// NewFinanceAggregate creates a new thread-safe FinanceAggregate
+func NewFinanceAggregate() *FinanceAggregate {
+	return &FinanceAggregate{
+		Transactions: make(map[string]*Transaction),
+		Balances:     make(map[string]int64),
+		currency:     defaultCurrency,
+		charted:      make(map[string]bool),
+		commands:     make(map[string]eventsourcing.CommandHandler),
+	}
+}
+
+// ID returns the aggregate's identifier
+func (a *FinanceAggregate) ID() string {
+	return "finance"
+}
+
+// financeSnapshot is the state saved in a snapshot; balances are recomputed from the transactions
+type financeSnapshot struct {
+	Transactions map[string]*Transaction `json:"transactions"`
+}
+
+// SaveSnapshot serializes the transactions so they can be restored without a full replay
+func (a *FinanceAggregate) SaveSnapshot() ([]byte, error) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return json.Marshal(financeSnapshot{Transactions: a.Transactions})
+}
+
+// LoadSnapshot replaces the transactions with the ones from a snapshot
+func (a *FinanceAggregate) LoadSnapshot(data []byte) error {
+	var snapshot financeSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to unmarshal snapshot: %v", err)
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	a.Transactions = make(map[string]*Transaction)
+	a.Balances = make(map[string]int64)
+	for _, transaction := range snapshot.Transactions {
+		a.add(transaction)
+	}
+	return nil
+}
+
+// add records a transaction and adds it to the balance of its category
+func (a *FinanceAggregate) add(transaction *Transaction) {
+	if old, exists := a.Transactions[transaction.TransactionID]; exists {
+		a.remove(old.TransactionID)
+	}
+	a.Transactions[transaction.TransactionID] = transaction
+	a.Balances[transaction.Category] += transaction.AmountCents
+}
+
+// remove forgets a transaction and takes it off the balance of its category, dropping categories
+// without transactions
+func (a *FinanceAggregate) remove(id string) {
+	transaction, exists := a.Transactions[id]
+	if !exists {
+		return
+	}
+	delete(a.Transactions, id)
+	a.Balances[transaction.Category] -= transaction.AmountCents
+	for _, other := range a.Transactions {
+		if other.Category == transaction.Category {
+			return
+		}
+	}
+	delete(a.Balances, transaction.Category)
+}
+
+// ApplyEvent updates the transactions and balances
+func (a *FinanceAggregate) ApplyEvent(event eventsourcing.Event) error {
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event %s: %v", event.Type(), err)
+	}
+
+	switch event.Type() {
+	case "finance_TransactionLogged":
+		var e TransactionLoggedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal TransactionLogged: %v", err)
+		}
+		a.add(e.Transaction.transaction())
+
+	case "finance_TransactionsImported":
+		var e TransactionsImportedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal TransactionsImported: %v", err)
+		}
+		for _, record := range e.Transactions {
+			transaction := record.transaction()
+			transaction.Source = e.File
+			a.add(transaction)
+		}
+
+	case "finance_TransactionsCategorized":
+		var e TransactionsCategorizedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal TransactionsCategorized: %v", err)
+		}
+		for _, id := range e.TransactionIDs {
+			if transaction, exists := a.Transactions[id]; exists {
+				recategorized := *transaction
+				recategorized.Category = e.Category
+				a.add(&recategorized)
+			}
+		}
+
+	case "finance_TransactionDeleted":
+		var e TransactionDeletedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal TransactionDeleted: %v", err)
+		}
+		a.remove(e.TransactionID)
+
+	case "finance_TransactionsListed", "finance_BalancesReported", "finance_MonthlySummaryReported":
+		// Read-only events, no state change needed
+	}
+	return nil
+}
+
+// sortedTransactions returns the transactions, newest first
+func (a *FinanceAggregate) sortedTransactions() []*Transaction {
+	transactions := make([]*Transaction, 0, len(a.Transactions))
+	for _, transaction := range a.Transactions {
+		transactions = append(transactions, transaction)
+	}
+	sort.Slice(transactions, func(i, j int) bool {
+		if !transactions[i].Date.Equal(transactions[j].Date) {
+			return transactions[i].Date.After(transactions[j].Date)
+		}
+		return transactions[i].TransactionID > transactions[j].TransactionID
+	})
+	return transactions
+}
+
+// monthTotals holds the income and spending of a month, in cents; spending is positive
+type monthTotals struct {
+	Income   int64
+	Expenses int64
+	Spending map[string]int64 // Spending by category
+	Largest  []*Transaction   // Expenses, largest first
+	Count    int
+}
+
+// totals adds up the transactions of a month
+func (a *FinanceAggregate) totals(month time.Time) monthTotals {
+	totals := monthTotals{Spending: make(map[string]int64)}
+	for _, transaction := range a.Transactions {
+		if !sameMonth(transaction.Date, month) {
+			continue
+		}
+		totals.Count++
+		if transaction.AmountCents >= 0 {
+			totals.Income += transaction.AmountCents
+			continue
+		}
+		totals.Expenses -= transaction.AmountCents
+		totals.Spending[transaction.Category] -= transaction.AmountCents
+		totals.Largest = append(totals.Largest, transaction)
+	}
+	sort.Slice(totals.Largest, func(i, j int) bool {
+		return totals.Largest[i].AmountCents < totals.Largest[j].AmountCents
+	})
+	return totals
+}
+
+// FinancePlugin implements the plugin interface
+type FinancePlugin struct {
+	aggregate *FinanceAggregate
+}
+
+func NewPlugin() eventsourcing.Plugin {
+	agg := NewFinanceAggregate()
+	p := &FinancePlugin{aggregate: agg}
+	agg.commands = map[string]eventsourcing.CommandHandler{
+		"LogTransaction": eventsourcing.NewCommand(func(input *LogTransactionInput) ([]eventsourcing.Event, error) {
+			return p.logTransactionHandler(input)
+		}),
+		"ImportTransactions": eventsourcing.NewCommand(func(input *ImportTransactionsInput) ([]eventsourcing.Event, error) {
+			return p.importTransactionsHandler(input)
+		}),
+		"ListTransactions": eventsourcing.NewCommand(func(input *ListTransactionsInput) ([]eventsourcing.Event, error) {
+			return p.listTransactionsHandler(input)
+		}),
+		"CategorizeTransactions": eventsourcing.NewCommand(func(input *CategorizeTransactionsInput) ([]eventsourcing.Event, error) {
+			return p.categorizeTransactionsHandler(input)
+		}),
+		"DeleteTransaction": eventsourcing.NewCommand(func(input *DeleteTransactionInput) ([]eventsourcing.Event, error) {
+			return p.deleteTransactionHandler(input)
+		}),
+		"GetBalances": eventsourcing.NewCommand(func(input *GetBalancesInput) ([]eventsourcing.Event, error) {
+			return p.getBalancesHandler(input)
+		}),
+		"MonthlySummary": eventsourcing.NewCommand(func(input *MonthlySummaryInput) ([]eventsourcing.Event, error) {
+			return p.monthlySummaryHandler(input)
+		}),
+	}
+	eventsourcing.RegisterEvent("finance_TransactionLogged", func() eventsourcing.Event { return &TransactionLoggedEvent{} })
+	eventsourcing.RegisterEvent("finance_TransactionsImported", func() eventsourcing.Event { return &TransactionsImportedEvent{} })
+	eventsourcing.RegisterEvent("finance_TransactionsListed", func() eventsourcing.Event { return &TransactionsListedEvent{} })
+	eventsourcing.RegisterTransientEvent("finance_TransactionsListed")
+	eventsourcing.RegisterEvent("finance_TransactionsCategorized", func() eventsourcing.Event { return &TransactionsCategorizedEvent{} })
+	eventsourcing.RegisterEvent("finance_TransactionDeleted", func() eventsourcing.Event { return &TransactionDeletedEvent{} })
+	eventsourcing.RegisterEvent("finance_BalancesReported", func() eventsourcing.Event { return &BalancesReportedEvent{} })
+	eventsourcing.RegisterTransientEvent("finance_BalancesReported")
+	eventsourcing.RegisterEvent("finance_MonthlySummaryReported", func() eventsourcing.Event { return &MonthlySummaryReportedEvent{} })
+	eventsourcing.RegisterTransientEvent("finance_MonthlySummaryReported")
+	return p
+}
+
+// Commands returns the command handlers
+func (p *FinancePlugin) Commands() map[string]eventsourcing.CommandHandler {
+	return p.aggregate.commands
+}
+
+// Name returns the plugin name
+func (p *FinancePlugin) Name() string {
+	return "finance"
+}
+
+// Manifest declares that the plugin imports bank statements from CSV files
+func (p *FinancePlugin) Manifest() eventsourcing.Manifest {
+	return eventsourcing.Manifest{
+		Version:      "1.0.0",
+		Capabilities: []string{eventsourcing.CapabilityFiles},
+	}
+}
+
+// Schemas defines the command schemas
+func (p *FinancePlugin) Schemas() map[string]eventsourcing.CommandInput {
+	return map[string]eventsourcing.CommandInput{
+		"LogTransaction":         &LogTransactionInput{},
+		"ImportTransactions":     &ImportTransactionsInput{},
+		"ListTransactions":       &ListTransactionsInput{},
+		"CategorizeTransactions": &CategorizeTransactionsInput{},
+		"DeleteTransaction":      &DeleteTransactionInput{},
+		"GetBalances":            &GetBalancesInput{},
+		"MonthlySummary":         &MonthlySummaryInput{},
+	}
+}
+
+// Configure applies the [plugin.finance] settings of the configuration file: currency, the code amounts
+// are shown in
+func (p *FinancePlugin) Configure(settings map[string]interface{}) error {
+	currency := defaultCurrency
+	if value, ok := settings["currency"].(string); ok && strings.TrimSpace(value) != "" {
+		currency = strings.ToUpper(strings.TrimSpace(value))
+	}
+	p.aggregate.Mu.Lock()
+	defer p.aggregate.Mu.Unlock()
+	p.aggregate.currency = currency
+	return nil
+}
+
+// RequiresConfirmation asks the user before transactions are deleted
+func (p *FinancePlugin) RequiresConfirmation(commandName string) bool {
+	return commandName == "DeleteTransaction"
+}
+
+// Command Input Structs with Schema Generation
+
+func (i *LogTransactionInput) New() any {
+	return &LogTransactionInput{}
+}
+
+// LogTransactionInput defines the input for logging an expense or an income
+type LogTransactionInput struct {
+	Amount      float64 `json:"Amount"`
+	Type        string  `json:"Type,omitempty"`
+	Category    string  `json:"Category,omitempty"`
+	Description string  `json:"Description,omitempty"`
+	Date        string  `json:"Date,omitempty"`
+}
+
+func (s *LogTransactionInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Logs money spent or received",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Amount": map[string]interface{}{
+					"type":        "number",
+					"description": "Amount of money, like 12.50",
+				},
+				"Type": map[string]interface{}{
+					"type":        "string",
+					"enum":        []string{"expense", "income"},
+					"description": "Whether the money was spent or received, expense if omitted",
+				},
+				"Category": map[string]interface{}{
+					"type":        "string",
+					"description": "Category, like groceries, rent, transport or salary; prefer an existing category",
+				},
+				"Description": map[string]interface{}{
+					"type":        "string",
+					"description": "What the money was for, or who paid it",
+				},
+				"Date": map[string]interface{}{
+					"type":        "string",
+					"description": "Date in YYYY-MM-DD format, today if omitted",
+				},
+			},
+			"required": []string{"Amount"},
+		},
+	}
+}
+
+func (i *ImportTransactionsInput) New() any {
+	return &ImportTransactionsInput{}
+}
+
+// ImportTransactionsInput defines the input for importing a bank export
+type ImportTransactionsInput struct {
+	Path       string `json:"Path"`
+	DateFormat string `json:"DateFormat,omitempty"`
+	Category   string `json:"Category,omitempty"`
+}
+
+func (s *ImportTransactionsInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Imports the transactions of a CSV file exported from a bank, skipping ones already logged",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Path": map[string]interface{}{
+					"type":        "string",
+					"description": "Path of the CSV file",
+				},
+				"DateFormat": map[string]interface{}{
+					"type":        "string",
+					"description": "Format of the dates in the file, like DD/MM/YYYY or MM/DD/YYYY; detected if omitted",
+				},
+				"Category": map[string]interface{}{
+					"type":        "string",
+					"description": "Category of transactions the file gives none for, uncategorized if omitted",
+				},
+			},
+			"required": []string{"Path"},
+		},
+	}
+}
+
+func (i *ListTransactionsInput) New() any {
+	return &ListTransactionsInput{}
+}
+
+// ListTransactionsInput defines the input for listing transactions
+type ListTransactionsInput struct {
+	Month    string `json:"Month,omitempty"`
+	Category string `json:"Category,omitempty"`
+	Search   string `json:"Search,omitempty"`
+}
+
+func (s *ListTransactionsInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": fmt.Sprintf("Lists transactions, newest first, at most %d", maxListed),
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Month": map[string]interface{}{
+					"type":        "string",
+					"description": "Only list transactions of this month, in YYYY-MM format",
+				},
+				"Category": map[string]interface{}{
+					"type":        "string",
+					"description": "Only list transactions of this category",
+				},
+				"Search": map[string]interface{}{
+					"type":        "string",
+					"description": "Only list transactions whose description contains this text",
+				},
+			},
+		},
+	}
+}
+
+func (i *CategorizeTransactionsInput) New() any {
+	return &CategorizeTransactionsInput{}
+}
+
+// CategorizeTransactionsInput defines the input for moving transactions to a category
+type CategorizeTransactionsInput struct {
+	Category       string   `json:"Category"`
+	TransactionIDs []string `json:"TransactionIDs,omitempty"`
+	Description    string   `json:"Description,omitempty"`
+}
+
+func (s *CategorizeTransactionsInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Moves transactions to a category, by ID or by a text their description contains",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Category": map[string]interface{}{
+					"type":        "string",
+					"description": "Category to move the transactions to",
+				},
+				"TransactionIDs": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "IDs of the transactions",
+				},
+				"Description": map[string]interface{}{
+					"type":        "string",
+					"description": "Move all transactions whose description contains this text, like a shop's name",
+				},
+			},
+			"required": []string{"Category"},
+		},
+	}
+}
+
+func (i *DeleteTransactionInput) New() any {
+	return &DeleteTransactionInput{}
+}
+
+// DeleteTransactionInput defines the input for deleting a transaction
+type DeleteTransactionInput struct {
+	TransactionID string `json:"TransactionID"`
+}
+
+func (s *DeleteTransactionInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Deletes a transaction logged by mistake",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"TransactionID": map[string]interface{}{
+					"type":        "string",
+					"description": "ID of the transaction",
+				},
+			},
+			"required": []string{"TransactionID"},
+		},
+	}
+}
+
+func (i *GetBalancesInput) New() any {
+	return &GetBalancesInput{}
+}
+
+// GetBalancesInput defines the input for reporting the balance of each category
+type GetBalancesInput struct{}
+
+func (s *GetBalancesInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Reports the balance of each category over all transactions; spending categories are negative",
+		"parameters": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+	}
+}
+
+func (i *MonthlySummaryInput) New() any {
+	return &MonthlySummaryInput{}
+}
+
+// MonthlySummaryInput defines the input for summarizing a month
+type MonthlySummaryInput struct {
+	Month string `json:"Month,omitempty"`
+}
+
+func (s *MonthlySummaryInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Summarizes the income and spending of a month, by category and compared to the month before",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Month": map[string]interface{}{
+					"type":        "string",
+					"description": "Month in YYYY-MM format, the current month if omitted",
+				},
+			},
+		},
+	}
+}
+
+// TransactionRecord is a transaction as recorded in events
+type TransactionRecord struct {
+	TransactionID string `json:"transaction_id"`
+	Date          string `json:"date"`
+	AmountCents   int64  `json:"amount_cents"`
+	Category      string `json:"category"`
+	Description   string `json:"description,omitempty"`
+}
+
+func (r TransactionRecord) transaction() *Transaction {
+	return &Transaction{
+		TransactionID: r.TransactionID,
+		Date:          parseDate(r.Date),
+		AmountCents:   r.AmountCents,
+		Category:      r.Category,
+		Description:   r.Description,
+	}
+}
+
+func record(transaction *Transaction) TransactionRecord {
+	return TransactionRecord{
+		TransactionID: transaction.TransactionID,
+		Date:          formatDate(transaction.Date),
+		AmountCents:   transaction.AmountCents,
+		Category:      transaction.Category,
+		Description:   transaction.Description,
+	}
+}
+
+// Event Types
+type TransactionLoggedEvent struct {
+	eventsourcing.EventMetadata
+	EventType   string            `json:"event_type"`
+	Transaction TransactionRecord `json:"transaction"`
+}
+
+func (e *TransactionLoggedEvent) Type() string { return "finance_TransactionLogged" }
+func (e *TransactionLoggedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *TransactionLoggedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// TransactionsImportedEvent records the transactions of a CSV file, without the ones logged before
+type TransactionsImportedEvent struct {
+	eventsourcing.EventMetadata
+	EventType    string              `json:"event_type"`
+	File         string              `json:"file"`
+	Transactions []TransactionRecord `json:"transactions"`
+	Duplicates   int                 `json:"duplicates"`
+}
+
+func (e *TransactionsImportedEvent) Type() string { return "finance_TransactionsImported" }
+func (e *TransactionsImportedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *TransactionsImportedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// TransactionSummary describes a transaction with its amount in currency units, for the agent to read
+type TransactionSummary struct {
+	TransactionID string  `json:"transaction_id"`
+	Date          string  `json:"date"`
+	Amount        float64 `json:"amount"`
+	Category      string  `json:"category"`
+	Description   string  `json:"description,omitempty"`
+}
+
+type TransactionsListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType    string               `json:"event_type"`
+	Currency     string               `json:"currency"`
+	Transactions []TransactionSummary `json:"transactions"`
+	Total        float64              `json:"total"`
+	Matching     int                  `json:"matching"`
+}
+
+func (e *TransactionsListedEvent) Type() string { return "finance_TransactionsListed" }
+func (e *TransactionsListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *TransactionsListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type TransactionsCategorizedEvent struct {
+	eventsourcing.EventMetadata
+	EventType      string   `json:"event_type"`
+	TransactionIDs []string `json:"transaction_ids"`
+	Category       string   `json:"category"`
+}
+
+func (e *TransactionsCategorizedEvent) Type() string { return "finance_TransactionsCategorized" }
+func (e *TransactionsCategorizedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *TransactionsCategorizedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type TransactionDeletedEvent struct {
+	eventsourcing.EventMetadata
+	EventType     string `json:"event_type"`
+	TransactionID string `json:"transaction_id"`
+	Description   string `json:"description,omitempty"`
+}
+
+func (e *TransactionDeletedEvent) Type() string { return "finance_TransactionDeleted" }
+func (e *TransactionDeletedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *TransactionDeletedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// CategoryBalance is the balance of a category in currency units
+type CategoryBalance struct {
+	Category string  `json:"category"`
+	Balance  float64 `json:"balance"`
+}
+
+type BalancesReportedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string            `json:"event_type"`
+	Currency  string            `json:"currency"`
+	Balances  []CategoryBalance `json:"balances"`
+	Net       float64           `json:"net"`
+}
+
+func (e *BalancesReportedEvent) Type() string { return "finance_BalancesReported" }
+func (e *BalancesReportedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *BalancesReportedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// CategorySpending is the spending of a category in a month and the month before, in currency units
+type CategorySpending struct {
+	Category      string  `json:"category"`
+	Spent         float64 `json:"spent"`
+	PreviousMonth float64 `json:"previous_month"`
+	Share         int     `json:"share_percent"`
+}
+
+// MonthlySummaryReportedEvent gives the agent what it needs to tell the user how a month went
+type MonthlySummaryReportedEvent struct {
+	eventsourcing.EventMetadata
+	EventType        string               `json:"event_type"`
+	Month            string               `json:"month"`
+	Currency         string               `json:"currency"`
+	Income           float64              `json:"income"`
+	Expenses         float64              `json:"expenses"`
+	Net              float64              `json:"net"`
+	PreviousExpenses float64              `json:"previous_month_expenses"`
+	Categories       []CategorySpending   `json:"categories"`
+	LargestExpenses  []TransactionSummary `json:"largest_expenses"`
+	Transactions     int                  `json:"transactions"`
+}
+
+func (e *MonthlySummaryReportedEvent) Type() string { return "finance_MonthlySummaryReported" }
+func (e *MonthlySummaryReportedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *MonthlySummaryReportedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// Utility functions
+func parseDate(dateStr string) time.Time {
+	t, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func formatDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+func sameMonth(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.Month() == b.Month()
+}
+
+// parseMonth parses a month in YYYY-MM format, the current month if empty
+func parseMonth(month string) (time.Time, error) {
+	if month == "" {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	t, err := time.Parse("2006-01", month)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("month %s must be in YYYY-MM format", month)
+	}
+	return t, nil
+}
+
+// normalizeCategory lowercases a category, uncategorized if empty
+func normalizeCategory(category string) string {
+	category = strings.ToLower(strings.Join(strings.Fields(category), " "))
+	if category == "" {
+		return uncategorized
+	}
+	return category
+}
+
+// units converts cents to currency units
+func units(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+// formatAmount formats cents like 1234.50 EUR
+func formatAmount(cents int64, currency string) string {
+	return fmt.Sprintf("%.2f %s", units(cents), currency)
+}
+
+func summarize(transaction *Transaction) TransactionSummary {
+	return TransactionSummary{
+		TransactionID: transaction.TransactionID,
+		Date:          formatDate(transaction.Date),
+		Amount:        units(transaction.AmountCents),
+		Category:      transaction.Category,
+		Description:   transaction.Description,
+	}
+}
+
+// duplicateKey identifies a transaction across imports of overlapping bank exports
+func duplicateKey(date time.Time, cents int64, description string) string {
+	return fmt.Sprintf("%s|%d|%s", formatDate(date), cents, strings.ToLower(strings.Join(strings.Fields(description), " ")))
+}
+
+// Command Handlers
+func (p *FinancePlugin) logTransactionHandler(input *LogTransactionInput) ([]eventsourcing.Event, error) {
+	if input.Amount == 0 || math.IsNaN(input.Amount) || math.IsInf(input.Amount, 0) {
+		return nil, fmt.Errorf("amount is required and must be a non-zero number")
+	}
+	cents := abs(int64(math.Round(input.Amount * 100)))
+	switch strings.ToLower(input.Type) {
+	case "", "expense":
+		cents = -cents
+	case "income":
+		if input.Amount < 0 {
+			cents = -cents
+		}
+	default:
+		return nil, fmt.Errorf("type must be expense or income, got %s", input.Type)
+	}
+
+	date := time.Now()
+	if input.Date != "" {
+		parsed, err := time.Parse("2006-01-02", input.Date)
+		if err != nil {
+			return nil, fmt.Errorf("date %s must be in YYYY-MM-DD format", input.Date)
+		}
+		date = parsed
+	}
+
+	event := &TransactionLoggedEvent{
+		EventType: "finance_TransactionLogged",
+		Transaction: TransactionRecord{
+			TransactionID: fmt.Sprintf("txn_%d", time.Now().UnixNano()),
+			Date:          formatDate(date),
+			AmountCents:   cents,
+			Category:      normalizeCategory(input.Category),
+			Description:   strings.TrimSpace(input.Description),
+		},
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *FinancePlugin) importTransactionsHandler(input *ImportTransactionsInput) ([]eventsourcing.Event, error) {
+	if input.Path == "" {
+		return nil, fmt.Errorf("path is required and must be a non-empty string")
+	}
+	path := input.Path
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	if !strings.EqualFold(filepath.Ext(path), ".csv") {
+		return nil, fmt.Errorf("%s is not a CSV file", input.Path)
+	}
+	rows, err := readCSV(path, input.DateFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	// Transactions logged before, as often as they were logged, so overlapping exports are not counted twice
+	p.aggregate.Mu.RLock()
+	existing := make(map[string]int)
+	for _, transaction := range p.aggregate.Transactions {
+		existing[duplicateKey(transaction.Date, transaction.AmountCents, transaction.Description)]++
+	}
+	p.aggregate.Mu.RUnlock()
+
+	event := &TransactionsImportedEvent{
+		EventType:    "finance_TransactionsImported",
+		File:         filepath.Base(path),
+		Transactions: []TransactionRecord{},
+	}
+	base := time.Now().UnixNano()
+	for i, row := range rows {
+		key := duplicateKey(row.Date, row.AmountCents, row.Description)
+		if existing[key] > 0 {
+			existing[key]--
+			event.Duplicates++
+			continue
+		}
+		category := row.Category
+		if category == "" {
+			category = input.Category
+		}
+		event.Transactions = append(event.Transactions, TransactionRecord{
+			TransactionID: fmt.Sprintf("txn_%d", base+int64(i)),
+			Date:          formatDate(row.Date),
+			AmountCents:   row.AmountCents,
+			Category:      normalizeCategory(category),
+			Description:   row.Description,
+		})
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *FinancePlugin) listTransactionsHandler(input *ListTransactionsInput) ([]eventsourcing.Event, error) {
+	var month time.Time
+	if input.Month != "" {
+		parsed, err := parseMonth(input.Month)
+		if err != nil {
+			return nil, err
+		}
+		month = parsed
+	}
+	category := ""
+	if input.Category != "" {
+		category = normalizeCategory(input.Category)
+	}
+	search := strings.ToLower(input.Search)
+
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	event := &TransactionsListedEvent{
+		EventType:    "finance_TransactionsListed",
+		Currency:     p.aggregate.currency,
+		Transactions: []TransactionSummary{},
+	}
+	var total int64
+	for _, transaction := range p.aggregate.sortedTransactions() {
+		if !month.IsZero() && !sameMonth(transaction.Date, month) {
+			continue
+		}
+		if category != "" && transaction.Category != category {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(transaction.Description), search) {
+			continue
+		}
+		event.Matching++
+		total += transaction.AmountCents
+		if len(event.Transactions) < maxListed {
+			event.Transactions = append(event.Transactions, summarize(transaction))
+		}
+	}
+	event.Total = units(total)
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *FinancePlugin) categorizeTransactionsHandler(input *CategorizeTransactionsInput) ([]eventsourcing.Event, error) {
+	if strings.TrimSpace(input.Category) == "" {
+		return nil, fmt.Errorf("category is required and must be a non-empty string")
+	}
+	if len(input.TransactionIDs) == 0 && strings.TrimSpace(input.Description) == "" {
+		return nil, fmt.Errorf("give the IDs of the transactions or a text their description contains")
+	}
+
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	event := &TransactionsCategorizedEvent{
+		EventType: "finance_TransactionsCategorized",
+		Category:  normalizeCategory(input.Category),
+	}
+	moved := make(map[string]bool)
+	for _, id := range input.TransactionIDs {
+		if _, exists := p.aggregate.Transactions[id]; !exists {
+			return nil, fmt.Errorf("transaction %s not found", id)
+		}
+		if !moved[id] {
+			moved[id] = true
+			event.TransactionIDs = append(event.TransactionIDs, id)
+		}
+	}
+	if description := strings.ToLower(strings.TrimSpace(input.Description)); description != "" {
+		for _, transaction := range p.aggregate.sortedTransactions() {
+			if !moved[transaction.TransactionID] && strings.Contains(strings.ToLower(transaction.Description), description) {
+				moved[transaction.TransactionID] = true
+				event.TransactionIDs = append(event.TransactionIDs, transaction.TransactionID)
+			}
+		}
+		if len(event.TransactionIDs) == 0 {
+			return nil, fmt.Errorf("no transaction's description contains %q", input.Description)
+		}
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *FinancePlugin) deleteTransactionHandler(input *DeleteTransactionInput) ([]eventsourcing.Event, error) {
+	if input.TransactionID == "" {
+		return nil, fmt.Errorf("transactionID is required and must be a non-empty string")
+	}
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	transaction, exists := p.aggregate.Transactions[input.TransactionID]
+	if !exists {
+		return nil, fmt.Errorf("transaction %s not found", input.TransactionID)
+	}
+	event := &TransactionDeletedEvent{
+		EventType:     "finance_TransactionDeleted",
+		TransactionID: transaction.TransactionID,
+		Description:   transaction.Description,
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *FinancePlugin) getBalancesHandler(input *GetBalancesInput) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	event := &BalancesReportedEvent{
+		EventType: "finance_BalancesReported",
+		Currency:  p.aggregate.currency,
+		Balances:  []CategoryBalance{},
+	}
+	var net int64
+	for category, balance := range p.aggregate.Balances {
+		event.Balances = append(event.Balances, CategoryBalance{Category: category, Balance: units(balance)})
+		net += balance
+	}
+	// Largest spending first, income last
+	sort.Slice(event.Balances, func(i, j int) bool {
+		if event.Balances[i].Balance != event.Balances[j].Balance {
+			return event.Balances[i].Balance < event.Balances[j].Balance
+		}
+		return event.Balances[i].Category < event.Balances[j].Category
+	})
+	event.Net = units(net)
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *FinancePlugin) monthlySummaryHandler(input *MonthlySummaryInput) ([]eventsourcing.Event, error) {
+	month, err := parseMonth(input.Month)
+	if err != nil {
+		return nil, err
+	}
+
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	totals := p.aggregate.totals(month)
+	previous := p.aggregate.totals(month.AddDate(0, -1, 0))
+	event := &MonthlySummaryReportedEvent{
+		EventType:        "finance_MonthlySummaryReported",
+		Month:            month.Format("2006-01"),
+		Currency:         p.aggregate.currency,
+		Income:           units(totals.Income),
+		Expenses:         units(totals.Expenses),
+		Net:              units(totals.Income - totals.Expenses),
+		PreviousExpenses: units(previous.Expenses),
+		Categories:       []CategorySpending{},
+		LargestExpenses:  []TransactionSummary{},
+		Transactions:     totals.Count,
+	}
+	for _, category := range spendingOrder(totals.Spending) {
+		spending := CategorySpending{
+			Category:      category,
+			Spent:         units(totals.Spending[category]),
+			PreviousMonth: units(previous.Spending[category]),
+		}
+		if totals.Expenses > 0 {
+			spending.Share = int(math.Round(float64(totals.Spending[category]) * 100 / float64(totals.Expenses)))
+		}
+		event.Categories = append(event.Categories, spending)
+	}
+	for _, transaction := range totals.Largest[:min(3, len(totals.Largest))] {
+		event.LargestExpenses = append(event.LargestExpenses, summarize(transaction))
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+// spendingOrder returns the categories of a spending map, largest spending first
+func spendingOrder(spending map[string]int64) []string {
+	categories := make([]string, 0, len(spending))
+	for category := range spending {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if spending[categories[i]] != spending[categories[j]] {
+			return spending[categories[i]] > spending[categories[j]]
+		}
+		return categories[i] < categories[j]
+	})
+	return categories
+}
+
+// GetCustomUI shows this month's income and spending by category, and the latest transactions
+func (a *FinanceAggregate) GetCustomUI() fyne.CanvasObject {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+
+	content := container.NewVBox()
+	now := time.Now()
+	totals := a.totals(now)
+	title := widget.NewLabel(now.Format("January 2006"))
+	title.TextStyle = fyne.TextStyle{Bold: true}
+	content.Add(title)
+	content.Add(widget.NewLabel(fmt.Sprintf("Income %s · Spent %s · Net %s",
+		formatAmount(totals.Income, a.currency), formatAmount(totals.Expenses, a.currency), formatAmount(totals.Income-totals.Expenses, a.currency))))
+	for _, category := range spendingOrder(totals.Spending) {
+		bar := widget.NewProgressBar()
+		bar.Max = float64(totals.Expenses)
+		bar.Value = float64(totals.Spending[category])
+		bar.TextFormatter = func() string { return "" }
+		content.Add(container.NewBorder(nil, nil, widget.NewLabel(category), widget.NewLabel(formatAmount(totals.Spending[category], a.currency)), bar))
+	}
+	content.Add(widget.NewSeparator())
+
+	if len(a.Transactions) == 0 {
+		content.Add(widget.NewLabel("No transactions yet. Tell MindPalace what you spent, or import a CSV export from your bank."))
+		return container.NewVScroll(content)
+	}
+	transactions := a.sortedTransactions()
+	for _, transaction := range transactions[:min(50, len(transactions))] {
+		description := transaction.Description
+		if description == "" {
+			description = transaction.Category
+		}
+		line := widget.NewLabel(fmt.Sprintf("%s  %s  %s (%s)", formatDate(transaction.Date), formatAmount(transaction.AmountCents, a.currency), description, transaction.Category))
+		line.Wrapping = fyne.TextWrapWord
+		content.Add(line)
+	}
+	return container.NewVScroll(content)
+}
+
+// Additional Plugin Methods
+func (p *FinancePlugin) Aggregate() eventsourcing.Aggregate {
+	return p.aggregate
+}
+
+func (p *FinancePlugin) Type() eventsourcing.PluginType {
+	return eventsourcing.LLMPlugin
+}
+
+func (p *FinancePlugin) SystemPrompt() string {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+
+	categories := make([]string, 0, len(p.aggregate.Balances))
+	for category := range p.aggregate.Balances {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	recent := "Latest transactions:\n"
+	transactions := p.aggregate.sortedTransactions()
+	for _, transaction := range transactions[:min(20, len(transactions))] {
+		recent += fmt.Sprintf("- Transaction ID: %s, Date: %s, Amount: %s, Category: %s, Description: \"%s\"\n",
+			transaction.TransactionID, formatDate(transaction.Date), formatAmount(transaction.AmountCents, p.aggregate.currency), transaction.Category, transaction.Description)
+	}
+
+	return fmt.Sprintf(`You are Bookkeeper, a specialized AI for tracking the user's personal finances in MindPalace.
+
+The user input will be a JSON object containing the arguments for the command to execute. Parse the JSON and call the appropriate command with the parsed values.
+
+Your job is to interpret user requests about money and execute the right commands (LogTransaction, ImportTransactions, ListTransactions, CategorizeTransactions, DeleteTransaction, GetBalances, MonthlySummary).
+
+Amounts are in %s. Today is %s.
+Existing categories: %s
+
+%s
+When interpreting user requests, pay close attention to the intent:
+- If the user spent or received money, use the LogTransaction command. Reuse an existing category when one fits.
+- If the user wants to import a bank statement or CSV file, use the ImportTransactions command.
+- If the user asks what they spent on something, use the ListTransactions command.
+- If the user wants transactions filed under another category, like all purchases at a shop, use the CategorizeTransactions command.
+- If a transaction was logged by mistake, use the DeleteTransaction command.
+- If the user asks how much they have spent or earned per category overall, use the GetBalances command.
+- If the user asks how a month went, use the MonthlySummary command, and tell them in a few sentences: what came in and went out, the biggest categories and how they compare to the month before.
+
+Use the exact Transaction ID from the list above.`,
+		p.aggregate.currency, time.Now().Format("2006-01-02"), strings.Join(categories, ", "), recent)
+}
+
+// AgentModel specifies the LLM model to use for this plugin's agent
+func (p *FinancePlugin) AgentModel() string {
+	return "gpt-oss:20b"
+}
+
+func (p *FinancePlugin) EventHandlers() map[string]eventsourcing.EventHandler {
+	return nil
+}
+
+// Broadcast3DDelta redraws the bar chart when transactions change
+func (a *FinanceAggregate) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
+	switch event.(type) {
+	case *TransactionLoggedEvent, *TransactionsImportedEvent, *TransactionsCategorizedEvent, *TransactionDeletedEvent:
+		a.Mu.Lock()
+		defer a.Mu.Unlock()
+		var actions []eventsourcing.DeltaAction
+		for _, nodeID := range sortedKeys(a.charted) {
+			actions = append(actions, eventsourcing.DeltaAction{Type: "delete", NodeID: nodeID})
+		}
+		return append(actions, a.chart(time.Now())...)
+	}
+	return nil
+}
+
+func (a *FinanceAggregate) GetFull3DState() []eventsourcing.DeltaAction {
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	return a.chart(time.Now())
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+func barID(category string) string {
+	return "finance_bar_" + strings.Trim(nonAlphanumeric.ReplaceAllString(category, "_"), "_")
+}
+
+// chart draws a bar per category of the month's spending, the largest as tall as maxBarHeight, and
+// remembers the nodes it drew
+func (a *FinanceAggregate) chart(month time.Time) []eventsourcing.DeltaAction {
+	totals := a.totals(month)
+	theme := ui3d.CurrentTheme()
+	a.charted = map[string]bool{"finance_chart_title": true}
+
+	title := fmt.Sprintf("Spending in %s: %s", month.Format("January 2006"), formatAmount(totals.Expenses, a.currency))
+	if totals.Expenses == 0 {
+		title = fmt.Sprintf("No spending in %s yet", month.Format("January 2006"))
+	}
+	actions := []eventsourcing.DeltaAction{
+		ui3d.CreateLabel("finance_chart_title", title, []float64{chartOrigin[0], chartOrigin[1] + maxBarHeight + 1.5, chartOrigin[2]}, theme),
+	}
+
+	categories := spendingOrder(totals.Spending)
+	if len(categories) == 0 {
+		return actions
+	}
+	largest := float64(totals.Spending[categories[0]])
+	for i, category := range categories {
+		height := math.Max(0.1, maxBarHeight*float64(totals.Spending[category])/largest)
+		x := chartOrigin[0] + float64(i)*barSpacing
+		id := barID(category)
+		// The label is not parented to the bar, so it is not stretched with it
+		actions = append(actions, ui3d.CreateStandardObject(ui3d.StandardObject{
+			ID:       id,
+			MeshType: "box",
+			Position: []float64{x, chartOrigin[1] + height/2, chartOrigin[2]},
+			Theme:    theme,
+			Extra:    map[string]interface{}{"scale": []float64{0.8, height, 0.8}, "event_type": "finance_spending"},
+			DisplayInfo: &ui3d.DisplayInfo{
+				Title:       category,
+				Description: fmt.Sprintf("%s spent in %s", formatAmount(totals.Spending[category], a.currency), month.Format("January 2006")),
+				Details:     map[string]interface{}{"month": month.Format("2006-01"), "spent": units(totals.Spending[category])},
+			},
+		})...)
+		actions = append(actions, ui3d.CreateLabel(id+"_label", fmt.Sprintf("%s\n%s", category, formatAmount(totals.Spending[category], a.currency)),
+			[]float64{x, chartOrigin[1] + height + 0.5, chartOrigin[2]}, theme))
+		a.charted[id] = true
+		a.charted[id+"_label"] = true
+	}
+	return actions
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+func newTestPlugin() *FinancePlugin {
+	return NewPlugin().(*FinancePlugin)
+}
+
+// apply returns a function applying the events a command returns, so it can wrap the handler call
+func apply(t *testing.T, p *FinancePlugin) func([]eventsourcing.Event, error) []eventsourcing.Event {
+	return func(events []eventsourcing.Event, err error) []eventsourcing.Event {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("command failed: %v", err)
+		}
+		for _, event := range events {
+			if err := p.aggregate.ApplyEvent(event); err != nil {
+				t.Fatalf("ApplyEvent(%s) failed: %v", event.Type(), err)
+			}
+		}
+		return events
+	}
+}
+
+func writeCSV(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "statement.csv")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseCents(t *testing.T) {
+	tests := map[string]int64{
+		"12.50":    1250,
+		"-12.50":   -1250,
+		"1,234.56": 123456,
+		"1.234,56": 123456,
+		"€ 12,50":  1250,
+		"(12.50)":  -1250,
+		"-€3":      -300,
+		"1,000":    100000,
+		"+42.1":    4210,
+		"USD 7.99": 799,
+	}
+	for value, want := range tests {
+		got, err := parseCents(value)
+		if err != nil {
+			t.Errorf("parseCents(%q) failed: %v", value, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("parseCents(%q) = %d, want %d", value, got, want)
+		}
+	}
+	if _, err := parseCents("n/a"); err == nil {
+		t.Error("parseCents accepted a value without digits")
+	}
+}
+
+func TestReadCSV_Formats(t *testing.T) {
+	semicolons := writeCSV(t, "\ufeffDatum;Omschrijving;Bedrag\n03-06-2025;Albert Heijn;-23,45\n04-06-2025;Salaris;2.500,00\n")
+	rows, err := readCSV(semicolons, "")
+	if err != nil {
+		t.Fatalf("readCSV failed: %v", err)
+	}
+	if len(rows) != 2 || rows[0].AmountCents != -2345 || rows[1].AmountCents != 250000 {
+		t.Fatalf("rows = %+v", rows)
+	}
+	if got := formatDate(rows[0].Date); got != "2025-06-03" || rows[0].Description != "Albert Heijn" {
+		t.Errorf("first row = %s %q", got, rows[0].Description)
+	}
+
+	debitCredit := writeCSV(t, "Date,Payee,Debit,Credit,Category\n06/03/2025,Coffee,3.20,,Eating Out\n06/04/2025,Refund,,10.00,\n")
+	rows, err = readCSV(debitCredit, "MM/DD/YYYY")
+	if err != nil {
+		t.Fatalf("readCSV failed: %v", err)
+	}
+	if len(rows) != 2 || rows[0].AmountCents != -320 || rows[1].AmountCents != 1000 {
+		t.Fatalf("rows = %+v", rows)
+	}
+	if got := formatDate(rows[0].Date); got != "2025-06-03" || rows[0].Category != "Eating Out" {
+		t.Errorf("first row = %s %q", got, rows[0].Category)
+	}
+
+	if _, err := readCSV(writeCSV(t, "When,What\n2025-06-03,x\n"), ""); err == nil || !strings.Contains(err.Error(), "no date column") {
+		t.Errorf("expected a missing date column error, got %v", err)
+	}
+	if _, err := readCSV(writeCSV(t, "Date,Amount\nyesterday,3\n"), ""); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error on line 2, got %v", err)
+	}
+}
+
+func TestFinance_LogAndBalances(t *testing.T) {
+	p := newTestPlugin()
+	apply(t, p)(p.logTransactionHandler(&LogTransactionInput{Amount: 12.5, Category: "Groceries", Description: "market", Date: "2025-06-03"}))
+	apply(t, p)(p.logTransactionHandler(&LogTransactionInput{Amount: 7.25, Category: " groceries ", Date: "2025-06-04"}))
+	apply(t, p)(p.logTransactionHandler(&LogTransactionInput{Amount: 2500, Type: "income", Category: "Salary", Date: "2025-06-25"}))
+
+	if _, err := p.logTransactionHandler(&LogTransactionInput{Amount: 0}); err == nil {
+		t.Error("expected an error for a zero amount")
+	}
+	if _, err := p.logTransactionHandler(&LogTransactionInput{Amount: 3, Type: "gift"}); err == nil {
+		t.Error("expected an error for an unknown type")
+	}
+
+	events, err := p.getBalancesHandler(&GetBalancesInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := events[0].(*BalancesReportedEvent)
+	if len(report.Balances) != 2 || report.Balances[0] != (CategoryBalance{Category: "groceries", Balance: -19.75}) {
+		t.Fatalf("balances = %+v", report.Balances)
+	}
+	if report.Net != 2480.25 || report.Currency != "EUR" {
+		t.Errorf("net = %v %s, want 2480.25 EUR", report.Net, report.Currency)
+	}
+
+	// Deleting the only salary drops the category
+	var salaryID string
+	for id, transaction := range p.aggregate.Transactions {
+		if transaction.Category == "salary" {
+			salaryID = id
+		}
+	}
+	apply(t, p)(p.deleteTransactionHandler(&DeleteTransactionInput{TransactionID: salaryID}))
+	if _, exists := p.aggregate.Balances["salary"]; exists || len(p.aggregate.Transactions) != 2 {
+		t.Errorf("balances after delete = %v", p.aggregate.Balances)
+	}
+	if !p.RequiresConfirmation("DeleteTransaction") || p.RequiresConfirmation("LogTransaction") {
+		t.Error("only DeleteTransaction should require confirmation")
+	}
+}
+
+func TestFinance_ImportSkipsDuplicates(t *testing.T) {
+	p := newTestPlugin()
+	first := writeCSV(t, "Date,Description,Amount\n2025-06-03,Coffee,-3.20\n2025-06-03,Coffee,-3.20\n2025-06-05,Rent,-900\n")
+	events := apply(t, p)(p.importTransactionsHandler(&ImportTransactionsInput{Path: first, Category: "Household"}))
+	imported := events[0].(*TransactionsImportedEvent)
+	if len(imported.Transactions) != 3 || imported.Duplicates != 0 || imported.File != "statement.csv" {
+		t.Fatalf("first import = %d transactions, %d duplicates", len(imported.Transactions), imported.Duplicates)
+	}
+	if imported.Transactions[2].Category != "household" {
+		t.Errorf("category = %s, want household", imported.Transactions[2].Category)
+	}
+
+	// The overlapping export repeats both coffees and adds a third one
+	second := writeCSV(t, "Date,Description,Amount\n2025-06-03,Coffee,-3.20\n2025-06-03,coffee,-3.20\n2025-06-03,Coffee,-3.20\n2025-06-06,Salary,2500\n")
+	events = apply(t, p)(p.importTransactionsHandler(&ImportTransactionsInput{Path: second}))
+	imported = events[0].(*TransactionsImportedEvent)
+	if len(imported.Transactions) != 2 || imported.Duplicates != 2 {
+		t.Fatalf("second import = %d transactions, %d duplicates, want 2 and 2", len(imported.Transactions), imported.Duplicates)
+	}
+	if len(p.aggregate.Transactions) != 5 || p.aggregate.Balances["uncategorized"] != 250000-320 {
+		t.Errorf("transactions = %d, uncategorized = %d", len(p.aggregate.Transactions), p.aggregate.Balances["uncategorized"])
+	}
+
+	if _, err := p.importTransactionsHandler(&ImportTransactionsInput{Path: "statement.pdf"}); err == nil {
+		t.Error("expected an error for a file that is not a CSV file")
+	}
+}
+
+func TestFinance_CategorizeByDescription(t *testing.T) {
+	p := newTestPlugin()
+	path := writeCSV(t, "Date,Description,Amount\n2025-06-03,ALBERT HEIJN 1234,-20\n2025-06-04,Albert Heijn 99,-5\n2025-06-04,NS Reizigers,-4\n")
+	apply(t, p)(p.importTransactionsHandler(&ImportTransactionsInput{Path: path}))
+
+	events := apply(t, p)(p.categorizeTransactionsHandler(&CategorizeTransactionsInput{Category: "Groceries", Description: "albert heijn"}))
+	if got := len(events[0].(*TransactionsCategorizedEvent).TransactionIDs); got != 2 {
+		t.Fatalf("categorized %d transactions, want 2", got)
+	}
+	if p.aggregate.Balances["groceries"] != -2500 || p.aggregate.Balances["uncategorized"] != -400 {
+		t.Errorf("balances = %v", p.aggregate.Balances)
+	}
+	if _, err := p.categorizeTransactionsHandler(&CategorizeTransactionsInput{Category: "x", Description: "bakery"}); err == nil {
+		t.Error("expected an error when no description matches")
+	}
+}
+
+func TestFinance_MonthlySummary(t *testing.T) {
+	p := newTestPlugin()
+	apply(t, p)(p.logTransactionHandler(&LogTransactionInput{Amount: 100, Category: "groceries", Date: "2025-05-10"}))
+	apply(t, p)(p.logTransactionHandler(&LogTransactionInput{Amount: 150, Category: "groceries", Date: "2025-06-10"}))
+	apply(t, p)(p.logTransactionHandler(&LogTransactionInput{Amount: 50, Category: "transport", Description: "train", Date: "2025-06-12"}))
+	apply(t, p)(p.logTransactionHandler(&LogTransactionInput{Amount: 1000, Type: "income", Category: "salary", Date: "2025-06-25"}))
+
+	events, err := p.monthlySummaryHandler(&MonthlySummaryInput{Month: "2025-06"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := events[0].(*MonthlySummaryReportedEvent)
+	if summary.Income != 1000 || summary.Expenses != 200 || summary.Net != 800 || summary.PreviousExpenses != 100 {
+		t.Errorf("summary = %+v", summary)
+	}
+	want := []CategorySpending{
+		{Category: "groceries", Spent: 150, PreviousMonth: 100, Share: 75},
+		{Category: "transport", Spent: 50, PreviousMonth: 0, Share: 25},
+	}
+	if len(summary.Categories) != 2 || summary.Categories[0] != want[0] || summary.Categories[1] != want[1] {
+		t.Errorf("categories = %+v", summary.Categories)
+	}
+	if len(summary.LargestExpenses) != 2 || summary.LargestExpenses[0].Amount != -150 || summary.Transactions != 3 {
+		t.Errorf("largest = %+v, transactions = %d", summary.LargestExpenses, summary.Transactions)
+	}
+	if _, err := p.monthlySummaryHandler(&MonthlySummaryInput{Month: "June"}); err == nil {
+		t.Error("expected an error for a month not in YYYY-MM format")
+	}
+}
+
+func TestFinance_BarChart(t *testing.T) {
+	p := newTestPlugin()
+	today := time.Now().Format("2006-01-02")
+	apply(t, p)(p.logTransactionHandler(&LogTransactionInput{Amount: 40, Category: "Eating out", Date: today}))
+	events := apply(t, p)(p.logTransactionHandler(&LogTransactionInput{Amount: 10, Category: "transport", Date: today}))
+
+	heights := make(map[string]float64)
+	for _, action := range p.aggregate.Broadcast3DDelta(events[0]) {
+		if action.Type != "create" || action.NodeType != "MeshInstance3D" {
+			continue
+		}
+		heights[action.NodeID] = action.Properties["scale"].([]float64)[1]
+	}
+	if heights["finance_bar_eating_out"] != maxBarHeight || heights["finance_bar_transport"] != maxBarHeight/4 {
+		t.Errorf("bar heights = %v", heights)
+	}
+
+	// Deleting a category's only transaction removes its bar
+	var transportID string
+	for id, transaction := range p.aggregate.Transactions {
+		if transaction.Category == "transport" {
+			transportID = id
+		}
+	}
+	events = apply(t, p)(p.deleteTransactionHandler(&DeleteTransactionInput{TransactionID: transportID}))
+	deleted, created := make(map[string]bool), make(map[string]bool)
+	for _, action := range p.aggregate.Broadcast3DDelta(events[0]) {
+		if action.Type == "delete" {
+			deleted[action.NodeID] = true
+		} else {
+			created[action.NodeID] = true
+		}
+	}
+	if !deleted["finance_bar_transport"] || !deleted["finance_bar_transport_label"] || created["finance_bar_transport"] {
+		t.Errorf("deleted = %v, created = %v", deleted, created)
+	}
+	if !created["finance_bar_eating_out"] || !created["finance_chart_title"] {
+		t.Errorf("created = %v", created)
+	}
+}
+
+func TestFinance_Snapshot(t *testing.T) {
+	p := newTestPlugin()
+	apply(t, p)(p.logTransactionHandler(&LogTransactionInput{Amount: 12, Category: "books", Date: "2025-06-03"}))
+	data, err := p.aggregate.SaveSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewFinanceAggregate()
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.Transactions) != 1 || restored.Balances["books"] != -1200 {
+		t.Errorf("restored = %v, balances = %v", restored.Transactions, restored.Balances)
+	}
+}
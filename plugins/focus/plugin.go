@@ -0,0 +1,701 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// DefaultMinutes is the length of a focus session when none is given, a pomodoro
+const DefaultMinutes = 25
+
+// MaxMinutes is the longest focus session that can be started
+const MaxMinutes = 240
+
+// checkInterval is how often the plugin checks whether the running session is over
+const checkInterval = time.Second
+
+// Session is a timed focus session on a task
+type Session struct {
+	SessionID      string    `json:"session_id"`
+	TaskID         string    `json:"task_id"`
+	TaskTitle      string    `json:"task_title,omitempty"`
+	Minutes        int       `json:"minutes"`
+	StartedAt      time.Time `json:"started_at"`
+	EndedAt        time.Time `json:"ended_at,omitempty"`
+	Completed      bool      `json:"completed,omitempty"` // Ran for its full length rather than being stopped
+	FocusedSeconds int       `json:"focused_seconds,omitempty"`
+}
+
+// EndsAt returns when the session is over if it is not stopped
+func (s *Session) EndsAt() time.Time {
+	return s.StartedAt.Add(time.Duration(s.Minutes) * time.Minute)
+}
+
+// focusedSeconds returns how long the session ran until the given time, at most its full length
+func (s *Session) focusedSeconds(until time.Time) int {
+	if until.After(s.EndsAt()) {
+		until = s.EndsAt()
+	}
+	if until.Before(s.StartedAt) {
+		return 0
+	}
+	return int(until.Sub(s.StartedAt).Seconds())
+}
+
+// FocusAggregate manages the focus sessions and the titles of the tasks they are on
+type FocusAggregate struct {
+	Active   *Session          // Running session, nil if there is none
+	Sessions []*Session        // Ended sessions, oldest first
+	Tasks    map[string]string // Titles of the tasks of the task manager, by task ID
+	commands map[string]eventsourcing.CommandHandler
+	uiRound  atomic.Int64 // Increased whenever the UI is rebuilt, stopping the countdown of the previous one
+	Mu       sync.RWMutex
+}
+
+// NewFocusAggregate creates a new thread-safe FocusAggregate
+func NewFocusAggregate() *FocusAggregate {
+	return &FocusAggregate{
+		Tasks:    make(map[string]string),
+		commands: make(map[string]eventsourcing.CommandHandler),
+	}
+}
+
+// ID returns the aggregate's identifier
+func (a *FocusAggregate) ID() string {
+	return "focus"
+}
+
+// focusSnapshot is the state saved in a snapshot
+type focusSnapshot struct {
+	Active   *Session          `json:"active,omitempty"`
+	Sessions []*Session        `json:"sessions,omitempty"`
+	Tasks    map[string]string `json:"tasks"`
+}
+
+// SaveSnapshot serializes the sessions so they can be restored without a full replay
+func (a *FocusAggregate) SaveSnapshot() ([]byte, error) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return json.Marshal(focusSnapshot{Active: a.Active, Sessions: a.Sessions, Tasks: a.Tasks})
+}
+
+// LoadSnapshot replaces the sessions with those from a snapshot
+func (a *FocusAggregate) LoadSnapshot(data []byte) error {
+	var snapshot focusSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to unmarshal snapshot: %v", err)
+	}
+	if snapshot.Tasks == nil {
+		snapshot.Tasks = make(map[string]string)
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	a.Active = snapshot.Active
+	a.Sessions = snapshot.Sessions
+	a.Tasks = snapshot.Tasks
+	return nil
+}
+
+// ApplyEvent updates the sessions, and the titles of tasks as the task manager changes them
+func (a *FocusAggregate) ApplyEvent(event eventsourcing.Event) error {
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event %s: %v", event.Type(), err)
+	}
+
+	switch event.Type() {
+	case "focus_SessionStarted":
+		var e SessionStartedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal SessionStarted: %v", err)
+		}
+		a.Active = &Session{
+			SessionID: e.SessionID,
+			TaskID:    e.TaskID,
+			TaskTitle: e.TaskTitle,
+			Minutes:   e.Minutes,
+			StartedAt: parseTime(e.StartedAt),
+		}
+
+	case "focus_SessionEnded":
+		var e SessionEndedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal SessionEnded: %v", err)
+		}
+		if a.Active == nil || a.Active.SessionID != e.SessionID {
+			return nil
+		}
+		session := a.Active
+		session.EndedAt = parseTime(e.EndedAt)
+		session.Completed = e.Completed
+		session.FocusedSeconds = e.FocusedSeconds
+		a.Sessions = append(a.Sessions, session)
+		a.Active = nil
+
+	case "taskmanager_TaskCreated", "taskmanager_TaskUpdated":
+		var e taskEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal %s: %v", event.Type(), err)
+		}
+		if _, exists := a.Tasks[e.TaskID]; e.Title != "" && (exists || event.Type() == "taskmanager_TaskCreated") {
+			a.Tasks[e.TaskID] = e.Title
+		}
+
+	case "taskmanager_TaskDeleted":
+		var e taskEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal TaskDeleted: %v", err)
+		}
+		delete(a.Tasks, e.TaskID)
+
+	case "taskmanager_TasksBulkChanged":
+		var e struct {
+			Deletions []taskEvent `json:"deletions"`
+		}
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal TasksBulkChanged: %v", err)
+		}
+		for _, deleted := range e.Deletions {
+			delete(a.Tasks, deleted.TaskID)
+		}
+	}
+	return nil
+}
+
+// taskEvent holds the fields of the task manager's events naming a task
+type taskEvent struct {
+	TaskID string `json:"task_id"`
+	Title  string `json:"title,omitempty"`
+}
+
+// FocusPlugin implements the plugin interface
+type FocusPlugin struct {
+	aggregate *FocusAggregate
+
+	configMu       sync.Mutex // Guards the fields below
+	defaultMinutes int
+	stopWatch      chan struct{}
+	ending         string // Session being ended by the watcher, so it is ended once
+}
+
+func NewPlugin() eventsourcing.Plugin {
+	agg := NewFocusAggregate()
+	p := &FocusPlugin{aggregate: agg, defaultMinutes: DefaultMinutes}
+	agg.commands = map[string]eventsourcing.CommandHandler{
+		"StartFocusSession": eventsourcing.NewCommand(func(input *StartFocusSessionInput) ([]eventsourcing.Event, error) {
+			return p.startSessionHandler(input)
+		}),
+		"StopFocusSession": eventsourcing.NewCommand(func(input *StopFocusSessionInput) ([]eventsourcing.Event, error) {
+			return p.stopSessionHandler(input)
+		}),
+		"FocusStatus": eventsourcing.NewCommand(func(input *FocusStatusInput) ([]eventsourcing.Event, error) {
+			return p.focusStatusHandler(input)
+		}),
+	}
+	eventsourcing.RegisterEvent("focus_SessionStarted", func() eventsourcing.Event { return &SessionStartedEvent{} })
+	eventsourcing.RegisterEvent("focus_SessionEnded", func() eventsourcing.Event { return &SessionEndedEvent{} })
+	eventsourcing.RegisterEvent("focus_StatusReported", func() eventsourcing.Event { return &StatusReportedEvent{} })
+	eventsourcing.RegisterTransientEvent("focus_StatusReported")
+	return p
+}
+
+// Commands returns the command handlers
+func (p *FocusPlugin) Commands() map[string]eventsourcing.CommandHandler {
+	return p.aggregate.commands
+}
+
+// Name returns the plugin name
+func (p *FocusPlugin) Name() string {
+	return "focus"
+}
+
+// Manifest declares that the plugin follows the tasks of the taskmanager worked on in a session
+func (p *FocusPlugin) Manifest() eventsourcing.Manifest {
+	return eventsourcing.Manifest{
+		Version:  "1.0.0",
+		Requires: []eventsourcing.Dependency{{Plugin: "taskmanager"}},
+	}
+}
+
+// Schemas defines the command schemas
+func (p *FocusPlugin) Schemas() map[string]eventsourcing.CommandInput {
+	return map[string]eventsourcing.CommandInput{
+		"StartFocusSession": &StartFocusSessionInput{},
+		"StopFocusSession":  &StopFocusSessionInput{},
+		"FocusStatus":       &FocusStatusInput{},
+	}
+}
+
+// Command Input Structs with Schema Generation
+
+func (i *StartFocusSessionInput) New() any {
+	return &StartFocusSessionInput{}
+}
+
+// StartFocusSessionInput defines the input for starting a focus session
+type StartFocusSessionInput struct {
+	TaskID  string `json:"TaskID"`
+	Minutes int    `json:"Minutes,omitempty"`
+}
+
+func (s *StartFocusSessionInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Starts a timed focus session on a task",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"TaskID": map[string]interface{}{
+					"type":        "string",
+					"description": "ID of the task to focus on",
+				},
+				"Minutes": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Length of the session in minutes, %d if omitted", DefaultMinutes),
+					"minimum":     1,
+					"maximum":     MaxMinutes,
+				},
+			},
+			"required": []string{"TaskID"},
+		},
+	}
+}
+
+func (i *StopFocusSessionInput) New() any {
+	return &StopFocusSessionInput{}
+}
+
+// StopFocusSessionInput defines the input for stopping the running focus session
+type StopFocusSessionInput struct{}
+
+func (s *StopFocusSessionInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Stops the running focus session before its time is up",
+		"parameters": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+	}
+}
+
+func (i *FocusStatusInput) New() any {
+	return &FocusStatusInput{}
+}
+
+// FocusStatusInput defines the input for reporting on focus sessions
+type FocusStatusInput struct {
+	TaskID string `json:"TaskID,omitempty"`
+}
+
+func (s *FocusStatusInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Reports the running focus session and the time focused per task",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"TaskID": map[string]interface{}{
+					"type":        "string",
+					"description": "Only report the time focused on this task",
+				},
+			},
+		},
+	}
+}
+
+// Event Types
+type SessionStartedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	SessionID string `json:"session_id"`
+	TaskID    string `json:"task_id"`
+	TaskTitle string `json:"task_title,omitempty"`
+	Minutes   int    `json:"minutes"`
+	StartedAt string `json:"started_at"`
+}
+
+func (e *SessionStartedEvent) Type() string { return "focus_SessionStarted" }
+func (e *SessionStartedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *SessionStartedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// SessionEndedEvent ends a focus session, adding the time focused to its task
+type SessionEndedEvent struct {
+	eventsourcing.EventMetadata
+	EventType      string `json:"event_type"`
+	SessionID      string `json:"session_id"`
+	TaskID         string `json:"task_id"`
+	Completed      bool   `json:"completed"`
+	FocusedSeconds int    `json:"focused_seconds"`
+	EndedAt        string `json:"ended_at"`
+}
+
+func (e *SessionEndedEvent) Type() string { return "focus_SessionEnded" }
+func (e *SessionEndedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *SessionEndedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// TaskFocus is the time focused on a task
+type TaskFocus struct {
+	TaskID         string `json:"task_id"`
+	TaskTitle      string `json:"task_title,omitempty"`
+	Sessions       int    `json:"sessions"`
+	FocusedMinutes int    `json:"focused_minutes"`
+}
+
+type StatusReportedEvent struct {
+	eventsourcing.EventMetadata
+	EventType        string       `json:"event_type"`
+	Active           *Session     `json:"active,omitempty"`
+	RemainingMinutes int          `json:"remaining_minutes,omitempty"`
+	Tasks            []*TaskFocus `json:"tasks,omitempty"`
+}
+
+func (e *StatusReportedEvent) Type() string { return "focus_StatusReported" }
+func (e *StatusReportedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *StatusReportedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// Utility functions
+func generateSessionID() string {
+	return fmt.Sprintf("focus_%d", eventsourcing.GenerateUniqueID())
+}
+
+func parseTime(timeStr string) time.Time {
+	if timeStr == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, timeStr)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// endEvent returns the event ending a session at the given time
+func endEvent(session *Session, now time.Time) *SessionEndedEvent {
+	return &SessionEndedEvent{
+		EventType:      "focus_SessionEnded",
+		SessionID:      session.SessionID,
+		TaskID:         session.TaskID,
+		Completed:      !now.Before(session.EndsAt()),
+		FocusedSeconds: session.focusedSeconds(now),
+		EndedAt:        now.UTC().Format(time.RFC3339),
+	}
+}
+
+// Command Handlers
+func (p *FocusPlugin) startSessionHandler(input *StartFocusSessionInput) ([]eventsourcing.Event, error) {
+	if input.TaskID == "" {
+		return nil, fmt.Errorf("taskID is required and must be a non-empty string")
+	}
+	minutes := input.Minutes
+	if minutes == 0 {
+		p.configMu.Lock()
+		minutes = p.defaultMinutes
+		p.configMu.Unlock()
+	}
+	if minutes < 1 || minutes > MaxMinutes {
+		return nil, fmt.Errorf("minutes must be between 1 and %d, got %d", MaxMinutes, minutes)
+	}
+
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	title, exists := p.aggregate.Tasks[input.TaskID]
+	if !exists {
+		return nil, fmt.Errorf("task %s not found", input.TaskID)
+	}
+	if active := p.aggregate.Active; active != nil {
+		return nil, fmt.Errorf("a focus session on %q is already running until %s, stop it first", active.TaskTitle, active.EndsAt().Local().Format("15:04"))
+	}
+
+	event := &SessionStartedEvent{
+		EventType: "focus_SessionStarted",
+		SessionID: generateSessionID(),
+		TaskID:    input.TaskID,
+		TaskTitle: title,
+		Minutes:   minutes,
+		StartedAt: eventsourcing.ISOTimestamp(),
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *FocusPlugin) stopSessionHandler(input *StopFocusSessionInput) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	if p.aggregate.Active == nil {
+		return nil, fmt.Errorf("no focus session is running")
+	}
+	return []eventsourcing.Event{endEvent(p.aggregate.Active, time.Now())}, nil
+}
+
+func (p *FocusPlugin) focusStatusHandler(input *FocusStatusInput) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+
+	event := &StatusReportedEvent{EventType: "focus_StatusReported"}
+	if active := p.aggregate.Active; active != nil {
+		event.Active = active
+		event.RemainingMinutes = int(time.Until(active.EndsAt()).Round(time.Minute).Minutes())
+	}
+	event.Tasks = p.aggregate.taskFocus(input.TaskID)
+	return []eventsourcing.Event{event}, nil
+}
+
+// taskFocus sums the ended sessions per task, most focused first; only the task given if it is not empty
+func (a *FocusAggregate) taskFocus(taskID string) []*TaskFocus {
+	byTask := make(map[string]*TaskFocus)
+	var seconds = make(map[string]int)
+	for _, session := range a.Sessions {
+		if taskID != "" && session.TaskID != taskID {
+			continue
+		}
+		focus, exists := byTask[session.TaskID]
+		if !exists {
+			focus = &TaskFocus{TaskID: session.TaskID, TaskTitle: session.TaskTitle}
+			if title, known := a.Tasks[session.TaskID]; known {
+				focus.TaskTitle = title
+			}
+			byTask[session.TaskID] = focus
+		}
+		focus.Sessions++
+		seconds[session.TaskID] += session.FocusedSeconds
+	}
+	tasks := make([]*TaskFocus, 0, len(byTask))
+	for id, focus := range byTask {
+		focus.FocusedMinutes = seconds[id] / 60
+		tasks = append(tasks, focus)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if seconds[tasks[i].TaskID] != seconds[tasks[j].TaskID] {
+			return seconds[tasks[i].TaskID] > seconds[tasks[j].TaskID]
+		}
+		return tasks[i].TaskID < tasks[j].TaskID
+	})
+	return tasks
+}
+
+// Configure applies the [plugin.focus] settings of the configuration file: default_minutes, the length
+// of sessions started without one. It also starts ending sessions once their time is up.
+func (p *FocusPlugin) Configure(settings map[string]interface{}) error {
+	minutes := DefaultMinutes
+	if value, ok := settings["default_minutes"].(int64); ok {
+		if value < 1 || value > MaxMinutes {
+			return fmt.Errorf("default_minutes must be between 1 and %d, got %d", MaxMinutes, value)
+		}
+		minutes = int(value)
+	}
+
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+	p.defaultMinutes = minutes
+	if p.stopWatch == nil {
+		p.stopWatch = make(chan struct{})
+		go p.watchLoop(p.stopWatch)
+	}
+	return nil
+}
+
+// watchLoop ends the running session once its time is up, until stop is closed
+func (p *FocusPlugin) watchLoop(stop chan struct{}) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			eventBus := eventsourcing.GetGlobalEventBus()
+			if eventBus == nil {
+				continue
+			}
+			if event := p.endIfOver(time.Now()); event != nil {
+				eventBus.Publish(event)
+			}
+		}
+	}
+}
+
+// endIfOver returns the event ending the running session if its time is up, once per session
+func (p *FocusPlugin) endIfOver(now time.Time) eventsourcing.Event {
+	p.aggregate.Mu.RLock()
+	active := p.aggregate.Active
+	p.aggregate.Mu.RUnlock()
+	if active == nil || now.Before(active.EndsAt()) {
+		return nil
+	}
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+	if p.ending == active.SessionID {
+		return nil
+	}
+	p.ending = active.SessionID
+	logging.Info("FOCUS: Session on %q is over after %d minutes", active.TaskTitle, active.Minutes)
+	return endEvent(active, now)
+}
+
+// GetCustomUI shows a countdown of the running session and the time focused per task
+func (a *FocusAggregate) GetCustomUI() fyne.CanvasObject {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	round := a.uiRound.Add(1)
+
+	content := container.NewVBox()
+	if active := a.Active; active != nil {
+		title := widget.NewLabel(fmt.Sprintf("Focusing on: %s", active.TaskTitle))
+		title.TextStyle = fyne.TextStyle{Bold: true}
+		countdown := widget.NewLabel(remaining(active, time.Now()))
+		countdown.TextStyle = fyne.TextStyle{Monospace: true}
+		progress := widget.NewProgressBar()
+		progress.SetValue(elapsedFraction(active, time.Now()))
+		content.Add(title)
+		content.Add(countdown)
+		content.Add(progress)
+		go a.countDown(round, active, countdown, progress)
+	} else {
+		content.Add(widget.NewLabel("No focus session running. Ask to focus on a task to start one."))
+	}
+	content.Add(widget.NewSeparator())
+
+	for _, focus := range a.taskFocus("") {
+		content.Add(widget.NewLabel(fmt.Sprintf("%s: %d min in %d sessions", focus.TaskTitle, focus.FocusedMinutes, focus.Sessions)))
+	}
+	return container.NewVScroll(content)
+}
+
+// countDown updates the countdown every second until the session is over or the UI was rebuilt
+func (a *FocusAggregate) countDown(round int64, session *Session, countdown *widget.Label, progress *widget.ProgressBar) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if a.uiRound.Load() != round {
+			return
+		}
+		fyne.Do(func() {
+			countdown.SetText(remaining(session, now))
+			progress.SetValue(elapsedFraction(session, now))
+		})
+		if !now.Before(session.EndsAt()) {
+			return
+		}
+	}
+}
+
+// remaining formats the time left in a session as minutes and seconds
+func remaining(session *Session, now time.Time) string {
+	left := session.EndsAt().Sub(now)
+	if left < 0 {
+		left = 0
+	}
+	left = left.Round(time.Second)
+	return fmt.Sprintf("%02d:%02d left", int(left.Minutes()), int(left.Seconds())%60)
+}
+
+// elapsedFraction returns how much of the session has passed, from 0 to 1
+func elapsedFraction(session *Session, now time.Time) float64 {
+	total := session.EndsAt().Sub(session.StartedAt)
+	if total <= 0 {
+		return 1
+	}
+	return float64(session.focusedSeconds(now)) / total.Seconds()
+}
+
+// Additional Plugin Methods
+func (p *FocusPlugin) Aggregate() eventsourcing.Aggregate {
+	return p.aggregate
+}
+
+func (p *FocusPlugin) Type() eventsourcing.PluginType {
+	return eventsourcing.LLMPlugin
+}
+
+func (p *FocusPlugin) SystemPrompt() string {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+
+	var state string
+	if active := p.aggregate.Active; active != nil {
+		state = fmt.Sprintf("A %d minute focus session on task %s (\"%s\") is running until %s.\n", active.Minutes, active.TaskID, active.TaskTitle, active.EndsAt().Local().Format("15:04"))
+	} else {
+		state = "No focus session is running.\n"
+	}
+	ids := make([]string, 0, len(p.aggregate.Tasks))
+	for id := range p.aggregate.Tasks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	tasks := "Tasks that can be focused on:\n"
+	for _, id := range ids {
+		tasks += fmt.Sprintf("- Task ID: %s, Title: \"%s\"\n", id, p.aggregate.Tasks[id])
+	}
+
+	return `You are FocusCoach, a specialized AI for running timed focus sessions, pomodoros, on the user's tasks in MindPalace.
+
+The user input will be a JSON object containing the arguments for the command to execute. Parse the JSON and call the appropriate command with the parsed values.
+
+Your job is to interpret user requests about focusing and execute the right commands (StartFocusSession, StopFocusSession, FocusStatus).
+
+` + state + tasks + `
+When interpreting user requests, pay close attention to the intent:
+- If the user wants to focus on or work on a task for a while, use the StartFocusSession command with the ID of the task.
+- If the user wants to stop, quit or take a break early, use the StopFocusSession command.
+- If the user asks how long is left or how much time they spent on a task, use the FocusStatus command.
+
+Sessions end by themselves when their time is up, and the time focused is added to the task.`
+}
+
+// AgentModel specifies the LLM model to use for this plugin's agent
+func (p *FocusPlugin) AgentModel() string {
+	return "gpt-oss:20b"
+}
+
+func (p *FocusPlugin) EventHandlers() map[string]eventsourcing.EventHandler {
+	return nil
+}
+
+// Broadcast3DDelta pulses the node of the task while a session on it runs
+func (a *FocusAggregate) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
+	switch e := event.(type) {
+	case *SessionStartedEvent:
+		return []eventsourcing.DeltaAction{pulseAction(e.TaskID, true)}
+	case *SessionEndedEvent:
+		return []eventsourcing.DeltaAction{pulseAction(e.TaskID, false)}
+	}
+	return nil
+}
+
+func (a *FocusAggregate) GetFull3DState() []eventsourcing.DeltaAction {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	if a.Active == nil {
+		return nil
+	}
+	return []eventsourcing.DeltaAction{pulseAction(a.Active.TaskID, true)}
+}
+
+// pulseAction starts or stops pulsing the node of a task, which the task manager names after the task ID
+func pulseAction(taskID string, pulse bool) eventsourcing.DeltaAction {
+	return eventsourcing.DeltaAction{
+		Type:       "update",
+		NodeID:     taskID,
+		Properties: map[string]interface{}{"pulse": pulse},
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// taskCreated mirrors the task manager's TaskCreated event, which the focus aggregate only sees through its JSON
+type taskCreated struct {
+	eventsourcing.EventMetadata
+	TaskID string `json:"task_id"`
+	Title  string `json:"title"`
+}
+
+func (e *taskCreated) Type() string                { return "taskmanager_TaskCreated" }
+func (e *taskCreated) Marshal() ([]byte, error)    { return nil, nil }
+func (e *taskCreated) Unmarshal(data []byte) error { return nil }
+
+func newFocusPlugin(t *testing.T) *FocusPlugin {
+	t.Helper()
+	p := NewPlugin().(*FocusPlugin)
+	if err := p.aggregate.ApplyEvent(&taskCreated{TaskID: "task1", Title: "Write report"}); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+	return p
+}
+
+func startSession(t *testing.T, p *FocusPlugin, input *StartFocusSessionInput) *SessionStartedEvent {
+	t.Helper()
+	events, err := p.startSessionHandler(input)
+	if err != nil {
+		t.Fatalf("startSessionHandler failed: %v", err)
+	}
+	if err := p.aggregate.ApplyEvent(events[0]); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+	return events[0].(*SessionStartedEvent)
+}
+
+func TestFocusPlugin_StartSession(t *testing.T) {
+	p := newFocusPlugin(t)
+	if _, err := p.startSessionHandler(&StartFocusSessionInput{TaskID: "missing"}); err == nil {
+		t.Error("Expected an error for an unknown task")
+	}
+	if _, err := p.startSessionHandler(&StartFocusSessionInput{TaskID: "task1", Minutes: MaxMinutes + 1}); err == nil {
+		t.Error("Expected an error for a session that is too long")
+	}
+
+	started := startSession(t, p, &StartFocusSessionInput{TaskID: "task1"})
+	if started.Minutes != DefaultMinutes || started.TaskTitle != "Write report" {
+		t.Errorf("Unexpected session %+v", started)
+	}
+	if active := p.aggregate.Active; active == nil || active.SessionID != started.SessionID {
+		t.Fatalf("Expected the session to be running, got %+v", active)
+	}
+
+	_, err := p.startSessionHandler(&StartFocusSessionInput{TaskID: "task1"})
+	if err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("Expected an error while a session runs, got %v", err)
+	}
+}
+
+func TestFocusPlugin_StopSession(t *testing.T) {
+	p := newFocusPlugin(t)
+	if _, err := p.stopSessionHandler(&StopFocusSessionInput{}); err == nil {
+		t.Error("Expected an error when no session runs")
+	}
+	startSession(t, p, &StartFocusSessionInput{TaskID: "task1", Minutes: 30})
+	p.aggregate.Active.StartedAt = time.Now().Add(-10 * time.Minute)
+
+	events, err := p.stopSessionHandler(&StopFocusSessionInput{})
+	if err != nil {
+		t.Fatalf("stopSessionHandler failed: %v", err)
+	}
+	ended := events[0].(*SessionEndedEvent)
+	if ended.Completed || ended.FocusedSeconds < 599 || ended.FocusedSeconds > 601 {
+		t.Errorf("Expected an incomplete session of 10 minutes, got %+v", ended)
+	}
+	if err := p.aggregate.ApplyEvent(ended); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+	if p.aggregate.Active != nil || len(p.aggregate.Sessions) != 1 {
+		t.Errorf("Expected the session to have ended, got active %+v and %d sessions", p.aggregate.Active, len(p.aggregate.Sessions))
+	}
+}
+
+func TestFocusPlugin_EndIfOver(t *testing.T) {
+	p := newFocusPlugin(t)
+	startSession(t, p, &StartFocusSessionInput{TaskID: "task1", Minutes: 25})
+	started := p.aggregate.Active.StartedAt
+
+	if event := p.endIfOver(started.Add(10 * time.Minute)); event != nil {
+		t.Errorf("Expected no event before the session is over, got %+v", event)
+	}
+	event := p.endIfOver(started.Add(26 * time.Minute))
+	ended, ok := event.(*SessionEndedEvent)
+	if !ok || !ended.Completed || ended.FocusedSeconds != 25*60 {
+		t.Fatalf("Expected a completed session of 25 minutes, got %+v", event)
+	}
+	if event := p.endIfOver(started.Add(27 * time.Minute)); event != nil {
+		t.Errorf("Expected the session to be ended once, got %+v", event)
+	}
+}
+
+func TestFocusPlugin_FocusStatus(t *testing.T) {
+	p := newFocusPlugin(t)
+	p.aggregate.ApplyEvent(&taskCreated{TaskID: "task2", Title: "Read paper"})
+	sessions := []struct {
+		taskID  string
+		seconds int
+	}{{"task1", 1500}, {"task2", 600}, {"task1", 300}}
+	for _, session := range sessions {
+		started := startSession(t, p, &StartFocusSessionInput{TaskID: session.taskID})
+		p.aggregate.ApplyEvent(&SessionEndedEvent{EventType: "focus_SessionEnded", SessionID: started.SessionID, TaskID: session.taskID, FocusedSeconds: session.seconds})
+	}
+
+	events, err := p.focusStatusHandler(&FocusStatusInput{})
+	if err != nil {
+		t.Fatalf("focusStatusHandler failed: %v", err)
+	}
+	status := events[0].(*StatusReportedEvent)
+	if status.Active != nil || len(status.Tasks) != 2 {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+	if first := status.Tasks[0]; first.TaskID != "task1" || first.Sessions != 2 || first.FocusedMinutes != 30 {
+		t.Errorf("Expected 30 minutes in 2 sessions on task1 first, got %+v", first)
+	}
+
+	events, _ = p.focusStatusHandler(&FocusStatusInput{TaskID: "task2"})
+	if tasks := events[0].(*StatusReportedEvent).Tasks; len(tasks) != 1 || tasks[0].FocusedMinutes != 10 {
+		t.Errorf("Expected only task2, got %+v", tasks)
+	}
+}
+
+func TestFocusAggregate_Broadcast3DDelta(t *testing.T) {
+	p := newFocusPlugin(t)
+	started := startSession(t, p, &StartFocusSessionInput{TaskID: "task1"})
+
+	actions := p.aggregate.Broadcast3DDelta(started)
+	if len(actions) != 1 || actions[0].NodeID != "task1" || actions[0].Properties["pulse"] != true {
+		t.Errorf("Expected the task to pulse, got %+v", actions)
+	}
+	if state := p.aggregate.GetFull3DState(); len(state) != 1 || state[0].Properties["pulse"] != true {
+		t.Errorf("Expected the full state to pulse the task, got %+v", state)
+	}
+
+	actions = p.aggregate.Broadcast3DDelta(&SessionEndedEvent{SessionID: started.SessionID, TaskID: "task1"})
+	if len(actions) != 1 || actions[0].Properties["pulse"] != false {
+		t.Errorf("Expected the task to stop pulsing, got %+v", actions)
+	}
+}
+
+func TestFocusAggregate_SnapshotRoundTrip(t *testing.T) {
+	p := newFocusPlugin(t)
+	started := startSession(t, p, &StartFocusSessionInput{TaskID: "task1"})
+
+	data, err := p.aggregate.SaveSnapshot()
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	restored := NewFocusAggregate()
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if restored.Active == nil || restored.Active.SessionID != started.SessionID || restored.Tasks["task1"] != "Write report" {
+		t.Errorf("Expected the session and task to be restored, got %+v and %+v", restored.Active, restored.Tasks)
+	}
+}
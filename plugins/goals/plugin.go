@@ -0,0 +1,1116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Statuses of a goal
+const (
+	StatusActive   = "Active"
+	StatusAchieved = "Achieved"
+	StatusDropped  = "Dropped"
+)
+
+// dateLayout is how the target date of a goal and the day of a review are written
+const dateLayout = "2006-01-02"
+
+// Goal is a mid-term goal of the user, worked towards with tasks
+type Goal struct {
+	GoalID      string    `json:"goal_id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	TargetDate  string    `json:"target_date,omitempty"` // YYYY-MM-DD
+	Status      string    `json:"status"`
+	Progress    int       `json:"progress"` // Percent, as the user estimates it
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at,omitempty"`
+}
+
+// Task is a task of the task manager, as far as the goals need to know it
+type Task struct {
+	TaskID      string    `json:"task_id"`
+	Title       string    `json:"title"`
+	CompletedAt time.Time `json:"completed_at,omitempty"` // Zero while the task is open
+}
+
+// GoalNote is where a goal stood at a weekly review
+type GoalNote struct {
+	GoalID   string `json:"goal_id"`
+	Title    string `json:"title"`
+	Previous int    `json:"previous"` // Progress before the review
+	Progress int    `json:"progress"` // Progress after it
+	Note     string `json:"note,omitempty"`
+}
+
+// Review is a weekly review of the goals
+type Review struct {
+	ReviewID       string     `json:"review_id"`
+	Since          time.Time  `json:"since"` // Start of the period reviewed, the previous review
+	Summary        string     `json:"summary"`
+	Reflection     string     `json:"reflection,omitempty"` // The user's own look back, in their words
+	Notes          []GoalNote `json:"notes"`
+	CompletedTasks int        `json:"completed_tasks"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// GoalsAggregate manages the goals, their reviews, and the tasks of the task manager they are linked to
+type GoalsAggregate struct {
+	Goals    map[string]*Goal
+	Tasks    map[string]*Task // Tasks of the task manager, by task ID
+	Reviews  []*Review        // Oldest first
+	links    eventsourcing.LinkSource
+	location *time.Location // Time zone of the user
+	commands map[string]eventsourcing.CommandHandler
+	Mu       sync.RWMutex
+}
+
+// NewGoalsAggregate creates a new thread-safe GoalsAggregate
+func NewGoalsAggregate() *GoalsAggregate {
+	return &GoalsAggregate{
+		Goals:    make(map[string]*Goal),
+		Tasks:    make(map[string]*Task),
+		location: time.Local,
+		commands: make(map[string]eventsourcing.CommandHandler),
+	}
+}
+
+// ID returns the aggregate's identifier
+func (a *GoalsAggregate) ID() string {
+	return "goals"
+}
+
+// goalsSnapshot is the state saved in a snapshot
+type goalsSnapshot struct {
+	Goals   map[string]*Goal `json:"goals"`
+	Tasks   map[string]*Task `json:"tasks"`
+	Reviews []*Review        `json:"reviews,omitempty"`
+}
+
+// SaveSnapshot serializes the goals and reviews so they can be restored without a full replay
+func (a *GoalsAggregate) SaveSnapshot() ([]byte, error) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return json.Marshal(goalsSnapshot{Goals: a.Goals, Tasks: a.Tasks, Reviews: a.Reviews})
+}
+
+// LoadSnapshot replaces the goals and reviews with those from a snapshot
+func (a *GoalsAggregate) LoadSnapshot(data []byte) error {
+	var snapshot goalsSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to unmarshal snapshot: %v", err)
+	}
+	if snapshot.Goals == nil {
+		snapshot.Goals = make(map[string]*Goal)
+	}
+	if snapshot.Tasks == nil {
+		snapshot.Tasks = make(map[string]*Task)
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	a.Goals = snapshot.Goals
+	a.Tasks = snapshot.Tasks
+	a.Reviews = snapshot.Reviews
+	return nil
+}
+
+// ApplyEvent updates the goals, and the tasks as the task manager changes them
+func (a *GoalsAggregate) ApplyEvent(event eventsourcing.Event) error {
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event %s: %v", event.Type(), err)
+	}
+
+	switch event.Type() {
+	case "goals_GoalCreated":
+		var e GoalCreatedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal GoalCreated: %v", err)
+		}
+		a.Goals[e.GoalID] = &Goal{
+			GoalID:      e.GoalID,
+			Title:       e.Title,
+			Description: e.Description,
+			TargetDate:  e.TargetDate,
+			Status:      StatusActive,
+			CreatedAt:   parseTime(e.CreatedAt),
+		}
+
+	case "goals_GoalUpdated":
+		var e GoalUpdatedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal GoalUpdated: %v", err)
+		}
+		goal, exists := a.Goals[e.GoalID]
+		if !exists {
+			return nil
+		}
+		if e.Title != "" {
+			goal.Title = e.Title
+		}
+		if e.Description != "" {
+			goal.Description = e.Description
+		}
+		if e.TargetDate != "" {
+			goal.TargetDate = e.TargetDate
+		}
+		if e.Progress != nil {
+			goal.Progress = *e.Progress
+		}
+		if e.Status != "" {
+			goal.Status = e.Status
+			if e.Status == StatusAchieved {
+				goal.Progress = 100
+			}
+		}
+		goal.UpdatedAt = parseTime(e.UpdatedAt)
+
+	case "goals_GoalDeleted":
+		var e GoalDeletedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal GoalDeleted: %v", err)
+		}
+		delete(a.Goals, e.GoalID)
+
+	case "goals_WeeklyReviewRecorded":
+		var e WeeklyReviewRecordedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal WeeklyReviewRecorded: %v", err)
+		}
+		review := &Review{
+			ReviewID:       e.ReviewID,
+			Since:          parseTime(e.Since),
+			Summary:        e.Summary,
+			Reflection:     e.Reflection,
+			Notes:          e.Notes,
+			CompletedTasks: e.CompletedTasks,
+			CreatedAt:      parseTime(e.Timestamp),
+		}
+		a.Reviews = append(a.Reviews, review)
+		for _, note := range e.Notes {
+			if goal, exists := a.Goals[note.GoalID]; exists {
+				goal.Progress = note.Progress
+				goal.UpdatedAt = review.CreatedAt
+			}
+		}
+
+	case "taskmanager_TaskCreated", "taskmanager_TaskUpdated":
+		var e taskEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal %s: %v", event.Type(), err)
+		}
+		a.updateTask(e, event.Type() == "taskmanager_TaskCreated")
+
+	case "taskmanager_TaskCompleted":
+		var e taskEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal TaskCompleted: %v", err)
+		}
+		if task, exists := a.Tasks[e.TaskID]; exists {
+			task.CompletedAt = parseTime(e.CompletedAt)
+		}
+
+	case "taskmanager_TaskDeleted":
+		var e taskEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal TaskDeleted: %v", err)
+		}
+		delete(a.Tasks, e.TaskID)
+
+	case "taskmanager_TasksBulkChanged":
+		var e struct {
+			Updates     []taskEvent `json:"updates"`
+			Completions []taskEvent `json:"completions"`
+			Deletions   []taskEvent `json:"deletions"`
+		}
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal TasksBulkChanged: %v", err)
+		}
+		for _, updated := range e.Updates {
+			a.updateTask(updated, false)
+		}
+		for _, completed := range e.Completions {
+			if task, exists := a.Tasks[completed.TaskID]; exists {
+				task.CompletedAt = parseTime(completed.CompletedAt)
+			}
+		}
+		for _, deleted := range e.Deletions {
+			delete(a.Tasks, deleted.TaskID)
+		}
+	}
+	return nil
+}
+
+// taskEvent holds the fields of the task manager's events the goals need
+type taskEvent struct {
+	TaskID      string `json:"task_id"`
+	Title       string `json:"title,omitempty"`
+	Status      string `json:"status,omitempty"`
+	CompletedAt string `json:"completed_at,omitempty"`
+}
+
+// updateTask records a task created or updated in the task manager; a task set to another status than
+// Completed is open again (caller holds the lock)
+func (a *GoalsAggregate) updateTask(e taskEvent, created bool) {
+	task, exists := a.Tasks[e.TaskID]
+	if !exists {
+		if !created {
+			return
+		}
+		task = &Task{TaskID: e.TaskID}
+		a.Tasks[e.TaskID] = task
+	}
+	if e.Title != "" {
+		task.Title = e.Title
+	}
+	if e.Status != "" && e.Status != "Completed" {
+		task.CompletedAt = time.Time{}
+	}
+}
+
+// sorted returns the goals, active ones first, then in the order they were set (caller holds the lock)
+func (a *GoalsAggregate) sorted() []*Goal {
+	goals := make([]*Goal, 0, len(a.Goals))
+	for _, goal := range a.Goals {
+		goals = append(goals, goal)
+	}
+	sort.Slice(goals, func(i, j int) bool {
+		if active := goals[i].Status == StatusActive; active != (goals[j].Status == StatusActive) {
+			return active
+		}
+		if !goals[i].CreatedAt.Equal(goals[j].CreatedAt) {
+			return goals[i].CreatedAt.Before(goals[j].CreatedAt)
+		}
+		return goals[i].GoalID < goals[j].GoalID
+	})
+	return goals
+}
+
+// linkedTasks returns the tasks linked to a goal that still exist (caller holds the lock)
+func (a *GoalsAggregate) linkedTasks(goalID string) []*Task {
+	if a.links == nil {
+		return nil
+	}
+	var tasks []*Task
+	for _, item := range a.links.LinkedItems(a.ID(), goalID) {
+		if task, exists := a.Tasks[item.ID]; exists && item.Aggregate == "taskmanager" {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// servesGoal reports whether a task is linked to any goal (caller holds the lock)
+func (a *GoalsAggregate) servesGoal(taskID string) bool {
+	if a.links == nil {
+		return false
+	}
+	for _, item := range a.links.LinkedItems("taskmanager", taskID) {
+		if _, exists := a.Goals[item.ID]; exists && item.Aggregate == a.ID() {
+			return true
+		}
+	}
+	return false
+}
+
+// lastReview returns the latest review, nil if there was none (caller holds the lock)
+func (a *GoalsAggregate) lastReview() *Review {
+	if len(a.Reviews) == 0 {
+		return nil
+	}
+	return a.Reviews[len(a.Reviews)-1]
+}
+
+// Item returns a goal as an item other plugins' items can be linked to, such as the tasks working towards it
+func (a *GoalsAggregate) Item(id string) (eventsourcing.Item, bool) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	goal, exists := a.Goals[id]
+	if !exists {
+		return eventsourcing.Item{}, false
+	}
+	return eventsourcing.Item{Aggregate: a.ID(), ID: goal.GoalID, Title: goal.Title}, true
+}
+
+// QueryState returns copies of the goals, active ones first, for questions about goals together with
+// other plugins' state
+func (a *GoalsAggregate) QueryState() any {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	goals := []Goal{}
+	for _, goal := range a.sorted() {
+		goals = append(goals, *goal)
+	}
+	return goals
+}
+
+// GoalsPlugin implements the plugin interface
+type GoalsPlugin struct {
+	aggregate *GoalsAggregate
+
+	reviewing sync.Mutex // Held while a review is summarized
+	configMu  sync.Mutex // Guards the fields below
+	execute   eventsourcing.CommandFunc
+	generate  eventsourcing.GenerateFunc
+}
+
+func NewPlugin() eventsourcing.Plugin {
+	agg := NewGoalsAggregate()
+	p := &GoalsPlugin{aggregate: agg}
+	agg.commands = map[string]eventsourcing.CommandHandler{
+		"CreateGoal": eventsourcing.NewCommand(func(input *CreateGoalInput) ([]eventsourcing.Event, error) {
+			return p.createGoalHandler(input, time.Now())
+		}),
+		"UpdateGoal": eventsourcing.NewCommand(func(input *UpdateGoalInput) ([]eventsourcing.Event, error) {
+			return p.updateGoalHandler(input, time.Now())
+		}),
+		"DeleteGoal": eventsourcing.NewCommand(func(input *DeleteGoalInput) ([]eventsourcing.Event, error) {
+			return p.deleteGoalHandler(input)
+		}),
+		"ListGoals": eventsourcing.NewCommand(func(input *ListGoalsInput) ([]eventsourcing.Event, error) {
+			return p.listGoalsHandler(input)
+		}),
+		"LinkTaskToGoal": eventsourcing.NewCommand(func(input *LinkTaskToGoalInput) ([]eventsourcing.Event, error) {
+			return p.linkTaskToGoalHandler(input)
+		}),
+		"StartWeeklyReview": eventsourcing.NewCommand(func(input *StartWeeklyReviewInput) ([]eventsourcing.Event, error) {
+			return p.startWeeklyReviewHandler(input, time.Now())
+		}),
+		"RecordWeeklyReview": eventsourcing.NewCommand(func(input *RecordWeeklyReviewInput) ([]eventsourcing.Event, error) {
+			return p.recordWeeklyReviewHandler(input, time.Now())
+		}),
+	}
+	eventsourcing.RegisterEvent("goals_GoalCreated", func() eventsourcing.Event { return &GoalCreatedEvent{} })
+	eventsourcing.RegisterEvent("goals_GoalUpdated", func() eventsourcing.Event { return &GoalUpdatedEvent{} })
+	eventsourcing.RegisterEvent("goals_GoalDeleted", func() eventsourcing.Event { return &GoalDeletedEvent{} })
+	eventsourcing.RegisterEvent("goals_GoalsListed", func() eventsourcing.Event { return &GoalsListedEvent{} })
+	eventsourcing.RegisterTransientEvent("goals_GoalsListed")
+	eventsourcing.RegisterEvent("goals_WeeklyReviewStarted", func() eventsourcing.Event { return &WeeklyReviewStartedEvent{} })
+	eventsourcing.RegisterTransientEvent("goals_WeeklyReviewStarted")
+	eventsourcing.RegisterEvent("goals_WeeklyReviewRecorded", func() eventsourcing.Event { return &WeeklyReviewRecordedEvent{} })
+	return p
+}
+
+// Commands returns the command handlers
+func (p *GoalsPlugin) Commands() map[string]eventsourcing.CommandHandler {
+	return p.aggregate.commands
+}
+
+// Name returns the plugin name
+func (p *GoalsPlugin) Name() string {
+	return "goals"
+}
+
+// Manifest declares that the plugin tracks the progress of goals by the tasks of the taskmanager
+func (p *GoalsPlugin) Manifest() eventsourcing.Manifest {
+	return eventsourcing.Manifest{
+		Version:  "1.0.0",
+		Requires: []eventsourcing.Dependency{{Plugin: "taskmanager"}},
+	}
+}
+
+// Schemas defines the command schemas
+func (p *GoalsPlugin) Schemas() map[string]eventsourcing.CommandInput {
+	return map[string]eventsourcing.CommandInput{
+		"CreateGoal":         &CreateGoalInput{},
+		"UpdateGoal":         &UpdateGoalInput{},
+		"DeleteGoal":         &DeleteGoalInput{},
+		"ListGoals":          &ListGoalsInput{},
+		"LinkTaskToGoal":     &LinkTaskToGoalInput{},
+		"StartWeeklyReview":  &StartWeeklyReviewInput{},
+		"RecordWeeklyReview": &RecordWeeklyReviewInput{},
+	}
+}
+
+// Command Input Structs with Schema Generation
+
+func (i *CreateGoalInput) New() any {
+	return &CreateGoalInput{}
+}
+
+// CreateGoalInput defines the input for setting a goal
+type CreateGoalInput struct {
+	Title       string `json:"Title"`
+	Description string `json:"Description,omitempty"`
+	TargetDate  string `json:"TargetDate,omitempty"`
+}
+
+func (c *CreateGoalInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Sets a new goal the user wants to reach in the coming weeks or months",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Title": map[string]interface{}{
+					"type":        "string",
+					"description": "Short statement of the goal, like \"Run a half marathon\"",
+				},
+				"Description": map[string]interface{}{
+					"type":        "string",
+					"description": "Why the goal matters and when it counts as reached",
+				},
+				"TargetDate": map[string]interface{}{
+					"type":        "string",
+					"description": "Day the user wants to reach the goal by (YYYY-MM-DD)",
+				},
+			},
+			"required": []string{"Title"},
+		},
+	}
+}
+
+func (i *UpdateGoalInput) New() any {
+	return &UpdateGoalInput{}
+}
+
+// UpdateGoalInput defines the input for changing a goal; fields left out are kept
+type UpdateGoalInput struct {
+	GoalID      string `json:"GoalID"`
+	Title       string `json:"Title,omitempty"`
+	Description string `json:"Description,omitempty"`
+	TargetDate  string `json:"TargetDate,omitempty"`
+	Progress    *int   `json:"Progress,omitempty"`
+	Status      string `json:"Status,omitempty"`
+}
+
+func (u *UpdateGoalInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Changes a goal: its title, description, target date, progress, or status when it was achieved or dropped",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"GoalID": map[string]interface{}{
+					"type":        "string",
+					"description": "ID of the goal",
+				},
+				"Title": map[string]interface{}{
+					"type":        "string",
+					"description": "New title",
+				},
+				"Description": map[string]interface{}{
+					"type":        "string",
+					"description": "New description",
+				},
+				"TargetDate": map[string]interface{}{
+					"type":        "string",
+					"description": "New target date (YYYY-MM-DD)",
+				},
+				"Progress": map[string]interface{}{
+					"type":        "integer",
+					"description": "How far the user is, in percent",
+					"minimum":     0,
+					"maximum":     100,
+				},
+				"Status": map[string]interface{}{
+					"type":        "string",
+					"description": "New status",
+					"enum":        []string{StatusActive, StatusAchieved, StatusDropped},
+				},
+			},
+			"required": []string{"GoalID"},
+		},
+	}
+}
+
+func (i *DeleteGoalInput) New() any {
+	return &DeleteGoalInput{}
+}
+
+// DeleteGoalInput defines the input for deleting a goal
+type DeleteGoalInput struct {
+	GoalID string `json:"GoalID"`
+}
+
+func (d *DeleteGoalInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Deletes a goal for good, rather than marking it dropped",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"GoalID": map[string]interface{}{
+					"type":        "string",
+					"description": "ID of the goal",
+				},
+			},
+			"required": []string{"GoalID"},
+		},
+	}
+}
+
+func (i *ListGoalsInput) New() any {
+	return &ListGoalsInput{}
+}
+
+// ListGoalsInput defines the input for listing the goals
+type ListGoalsInput struct {
+	Status string `json:"Status,omitempty"`
+}
+
+func (l *ListGoalsInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Lists the goals with their progress and the tasks linked to them",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Status": map[string]interface{}{
+					"type":        "string",
+					"description": "Only list goals with this status",
+					"enum":        []string{StatusActive, StatusAchieved, StatusDropped},
+				},
+			},
+		},
+	}
+}
+
+func (i *LinkTaskToGoalInput) New() any {
+	return &LinkTaskToGoalInput{}
+}
+
+// LinkTaskToGoalInput defines the input for linking a task to the goal it works towards
+type LinkTaskToGoalInput struct {
+	GoalID string `json:"GoalID"`
+	TaskID string `json:"TaskID"`
+}
+
+func (l *LinkTaskToGoalInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Links a task of the task manager to the goal it works towards",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"GoalID": map[string]interface{}{
+					"type":        "string",
+					"description": "ID of the goal",
+				},
+				"TaskID": map[string]interface{}{
+					"type":        "string",
+					"description": "ID of the task",
+				},
+			},
+			"required": []string{"GoalID", "TaskID"},
+		},
+	}
+}
+
+func (i *StartWeeklyReviewInput) New() any {
+	return &StartWeeklyReviewInput{}
+}
+
+// StartWeeklyReviewInput defines the input for starting the weekly review
+type StartWeeklyReviewInput struct{}
+
+func (s *StartWeeklyReviewInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Starts the weekly review: returns the active goals with the tasks completed for them since the last review, and the completed tasks not linked to a goal",
+		"parameters": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+	}
+}
+
+func (i *RecordWeeklyReviewInput) New() any {
+	return &RecordWeeklyReviewInput{}
+}
+
+// RecordWeeklyReviewInput defines the input for recording the weekly review once every goal was discussed
+type RecordWeeklyReviewInput struct {
+	Goals      []ReviewNoteInput `json:"Goals"`
+	Reflection string            `json:"Reflection,omitempty"`
+}
+
+// ReviewNoteInput is where a goal stands according to the user
+type ReviewNoteInput struct {
+	GoalID   string `json:"GoalID"`
+	Progress *int   `json:"Progress,omitempty"`
+	Note     string `json:"Note,omitempty"`
+}
+
+func (r *RecordWeeklyReviewInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Records the weekly review with where each goal stands, and writes its summary",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Goals": map[string]interface{}{
+					"type":        "array",
+					"description": "The goals discussed",
+					"items": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"GoalID": map[string]interface{}{
+								"type":        "string",
+								"description": "ID of the goal",
+							},
+							"Progress": map[string]interface{}{
+								"type":        "integer",
+								"description": "How far the user is now, in percent; the current progress if omitted",
+								"minimum":     0,
+								"maximum":     100,
+							},
+							"Note": map[string]interface{}{
+								"type":        "string",
+								"description": "How the week went for the goal, in the user's words",
+							},
+						},
+						"required": []string{"GoalID"},
+					},
+				},
+				"Reflection": map[string]interface{}{
+					"type":        "string",
+					"description": "What the user says about the week as a whole",
+				},
+			},
+			"required": []string{"Goals"},
+		},
+	}
+}
+
+// Event Types
+type GoalCreatedEvent struct {
+	eventsourcing.EventMetadata
+	EventType   string `json:"event_type"`
+	GoalID      string `json:"goal_id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	TargetDate  string `json:"target_date,omitempty"`
+	CreatedAt   string `json:"created_at"`
+}
+
+func (e *GoalCreatedEvent) Type() string { return "goals_GoalCreated" }
+func (e *GoalCreatedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *GoalCreatedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type GoalUpdatedEvent struct {
+	eventsourcing.EventMetadata
+	EventType   string `json:"event_type"`
+	GoalID      string `json:"goal_id"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	TargetDate  string `json:"target_date,omitempty"`
+	Progress    *int   `json:"progress,omitempty"`
+	Status      string `json:"status,omitempty"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+func (e *GoalUpdatedEvent) Type() string { return "goals_GoalUpdated" }
+func (e *GoalUpdatedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *GoalUpdatedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type GoalDeletedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	GoalID    string `json:"goal_id"`
+	Title     string `json:"title"`
+}
+
+func (e *GoalDeletedEvent) Type() string { return "goals_GoalDeleted" }
+func (e *GoalDeletedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *GoalDeletedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// GoalInfo is a goal as it is listed for the LLM
+type GoalInfo struct {
+	Goal
+	LinkedTasks []*Task `json:"linked_tasks,omitempty"`
+}
+
+type GoalsListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string      `json:"event_type"`
+	Goals     []*GoalInfo `json:"goals"`
+}
+
+func (e *GoalsListedEvent) Type() string { return "goals_GoalsListed" }
+func (e *GoalsListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *GoalsListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// GoalReview is an active goal as it is presented for the weekly review
+type GoalReview struct {
+	GoalID     string   `json:"goal_id"`
+	Title      string   `json:"title"`
+	TargetDate string   `json:"target_date,omitempty"`
+	Progress   int      `json:"progress"`
+	Completed  []string `json:"completed_tasks"` // Linked tasks completed since the last review
+	Open       []string `json:"open_tasks"`      // Linked tasks not completed yet
+}
+
+// WeeklyReviewStartedEvent holds what the weekly review goes through
+type WeeklyReviewStartedEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string        `json:"event_type"`
+	Since      string        `json:"since"`
+	Goals      []*GoalReview `json:"goals"`
+	Unlinked   []*Task       `json:"unlinked_completed_tasks"` // Tasks completed since the last review, linked to no goal
+	LastReview *Review       `json:"last_review,omitempty"`
+}
+
+func (e *WeeklyReviewStartedEvent) Type() string { return "goals_WeeklyReviewStarted" }
+func (e *WeeklyReviewStartedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *WeeklyReviewStartedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// WeeklyReviewRecordedEvent records a weekly review, moving the goals to the progress it noted
+type WeeklyReviewRecordedEvent struct {
+	eventsourcing.EventMetadata
+	EventType      string     `json:"event_type"`
+	ReviewID       string     `json:"review_id"`
+	Since          string     `json:"since"`
+	Summary        string     `json:"summary"`
+	Reflection     string     `json:"reflection,omitempty"`
+	Notes          []GoalNote `json:"notes"`
+	CompletedTasks int        `json:"completed_tasks"`
+	Timestamp      string     `json:"timestamp"`
+}
+
+func (e *WeeklyReviewRecordedEvent) Type() string { return "goals_WeeklyReviewRecorded" }
+func (e *WeeklyReviewRecordedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *WeeklyReviewRecordedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// Utility functions
+func generateGoalID() string {
+	return fmt.Sprintf("goal_%d", eventsourcing.GenerateUniqueID())
+}
+
+func parseTime(timeStr string) time.Time {
+	if timeStr == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, timeStr)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// parseTargetDate checks a target date given to a command
+func parseTargetDate(date string) (string, error) {
+	if date == "" {
+		return "", nil
+	}
+	t, err := time.Parse(dateLayout, date)
+	if err != nil {
+		return "", fmt.Errorf("invalid target date '%s', expected YYYY-MM-DD", date)
+	}
+	return t.Format(dateLayout), nil
+}
+
+// parseStatus returns the status as it is stored, whatever its case
+func parseStatus(status string) (string, error) {
+	for _, s := range []string{StatusActive, StatusAchieved, StatusDropped} {
+		if strings.EqualFold(status, s) {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("invalid status '%s', expected %s, %s or %s", status, StatusActive, StatusAchieved, StatusDropped)
+}
+
+func checkProgress(progress *int) error {
+	if progress != nil && (*progress < 0 || *progress > 100) {
+		return fmt.Errorf("progress must be between 0 and 100, got %d", *progress)
+	}
+	return nil
+}
+
+// Command Handlers
+func (p *GoalsPlugin) createGoalHandler(input *CreateGoalInput, now time.Time) ([]eventsourcing.Event, error) {
+	title := strings.TrimSpace(input.Title)
+	if title == "" {
+		return nil, fmt.Errorf("title is required and must be a non-empty string")
+	}
+	targetDate, err := parseTargetDate(input.TargetDate)
+	if err != nil {
+		return nil, err
+	}
+	event := &GoalCreatedEvent{
+		EventType:   "goals_GoalCreated",
+		GoalID:      generateGoalID(),
+		Title:       title,
+		Description: strings.TrimSpace(input.Description),
+		TargetDate:  targetDate,
+		CreatedAt:   now.UTC().Format(time.RFC3339),
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+// goal returns the goal with the ID; the aggregate must be locked
+func (p *GoalsPlugin) goal(goalID string) (*Goal, error) {
+	if goalID == "" {
+		return nil, fmt.Errorf("goalID is required and must be a non-empty string")
+	}
+	goal, exists := p.aggregate.Goals[goalID]
+	if !exists {
+		return nil, fmt.Errorf("goal %s not found", goalID)
+	}
+	return goal, nil
+}
+
+func (p *GoalsPlugin) updateGoalHandler(input *UpdateGoalInput, now time.Time) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	goal, err := p.goal(input.GoalID)
+	if err != nil {
+		return nil, err
+	}
+	if input.Title == "" && input.Description == "" && input.TargetDate == "" && input.Progress == nil && input.Status == "" {
+		return nil, fmt.Errorf("nothing to change for goal %q", goal.Title)
+	}
+	targetDate, err := parseTargetDate(input.TargetDate)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkProgress(input.Progress); err != nil {
+		return nil, err
+	}
+	status := ""
+	if input.Status != "" {
+		if status, err = parseStatus(input.Status); err != nil {
+			return nil, err
+		}
+	}
+	event := &GoalUpdatedEvent{
+		EventType:   "goals_GoalUpdated",
+		GoalID:      goal.GoalID,
+		Title:       strings.TrimSpace(input.Title),
+		Description: strings.TrimSpace(input.Description),
+		TargetDate:  targetDate,
+		Progress:    input.Progress,
+		Status:      status,
+		UpdatedAt:   now.UTC().Format(time.RFC3339),
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *GoalsPlugin) deleteGoalHandler(input *DeleteGoalInput) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	goal, err := p.goal(input.GoalID)
+	if err != nil {
+		return nil, err
+	}
+	event := &GoalDeletedEvent{EventType: "goals_GoalDeleted", GoalID: goal.GoalID, Title: goal.Title}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *GoalsPlugin) listGoalsHandler(input *ListGoalsInput) ([]eventsourcing.Event, error) {
+	status := ""
+	if input.Status != "" {
+		var err error
+		if status, err = parseStatus(input.Status); err != nil {
+			return nil, err
+		}
+	}
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	event := &GoalsListedEvent{EventType: "goals_GoalsListed", Goals: []*GoalInfo{}}
+	for _, goal := range p.aggregate.sorted() {
+		if status != "" && goal.Status != status {
+			continue
+		}
+		event.Goals = append(event.Goals, &GoalInfo{Goal: *goal, LinkedTasks: p.aggregate.linkedTasks(goal.GoalID)})
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+// linkTaskToGoalHandler links the task to the goal with the LinkItems command, so the link shows on the
+// task too. The links are events of their own, the command has none.
+func (p *GoalsPlugin) linkTaskToGoalHandler(input *LinkTaskToGoalInput) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	goal, err := p.goal(input.GoalID)
+	if err == nil {
+		if _, exists := p.aggregate.Tasks[input.TaskID]; !exists {
+			err = fmt.Errorf("task %s not found", input.TaskID)
+		}
+		for _, task := range p.aggregate.linkedTasks(goal.GoalID) {
+			if task.TaskID == input.TaskID {
+				err = fmt.Errorf("task %q is already linked to goal %q", task.Title, goal.Title)
+			}
+		}
+	}
+	p.aggregate.Mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	p.configMu.Lock()
+	execute := p.execute
+	p.configMu.Unlock()
+	if execute == nil {
+		return nil, fmt.Errorf("tasks can't be linked to goals yet")
+	}
+	// Not holding the lock, linking looks the goal up with Item
+	link := map[string]interface{}{
+		"from_aggregate": p.aggregate.ID(),
+		"from_id":        goal.GoalID,
+		"to_aggregate":   "taskmanager",
+		"to_id":          input.TaskID,
+	}
+	if err := execute("LinkItems", link); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// RequiresConfirmation asks the user before a goal is deleted
+func (p *GoalsPlugin) RequiresConfirmation(command string) bool {
+	return command == "DeleteGoal"
+}
+
+// SetLocation sets the time zone of the user, the review is dated in it
+func (p *GoalsPlugin) SetLocation(loc *time.Location) {
+	p.aggregate.Mu.Lock()
+	defer p.aggregate.Mu.Unlock()
+	p.aggregate.location = loc
+}
+
+// SetLinkSource gives the goals the tasks linked to them
+func (p *GoalsPlugin) SetLinkSource(source eventsourcing.LinkSource) {
+	p.aggregate.Mu.Lock()
+	defer p.aggregate.Mu.Unlock()
+	p.aggregate.links = source
+}
+
+// SetCommandFunc gives the plugin the function linking tasks to goals as its user
+func (p *GoalsPlugin) SetCommandFunc(execute eventsourcing.CommandFunc) {
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+	p.execute = execute
+}
+
+// GetCustomUI shows the active goals with their progress, the others, and the last review
+func (a *GoalsAggregate) GetCustomUI() fyne.CanvasObject {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+
+	if len(a.Goals) == 0 {
+		return widget.NewLabel("No goals yet. Tell MindPalace what you want to reach in the coming months!")
+	}
+	content := container.NewVBox()
+	for _, goal := range a.sorted() {
+		heading := goal.Title
+		if goal.Status != StatusActive {
+			heading += " · " + strings.ToLower(goal.Status)
+		}
+		title := widget.NewLabel(heading)
+		title.TextStyle = fyne.TextStyle{Bold: true}
+		content.Add(title)
+		if goal.Status == StatusActive {
+			progress := widget.NewProgressBar()
+			progress.SetValue(float64(goal.Progress) / 100)
+			content.Add(progress)
+		}
+		details := []string{}
+		if goal.TargetDate != "" {
+			details = append(details, "by "+goal.TargetDate)
+		}
+		if tasks := a.linkedTasks(goal.GoalID); len(tasks) > 0 {
+			done := 0
+			for _, task := range tasks {
+				if !task.CompletedAt.IsZero() {
+					done++
+				}
+			}
+			details = append(details, fmt.Sprintf("%d of %d tasks done", done, len(tasks)))
+		}
+		if len(details) > 0 {
+			content.Add(widget.NewLabel(strings.Join(details, " · ")))
+		}
+		content.Add(widget.NewSeparator())
+	}
+	if review := a.lastReview(); review != nil {
+		title := widget.NewLabel(fmt.Sprintf("Review of %s", review.CreatedAt.In(a.location).Format("Monday January 2")))
+		title.TextStyle = fyne.TextStyle{Bold: true}
+		summary := widget.NewLabel(review.Summary)
+		summary.Wrapping = fyne.TextWrapWord
+		content.Add(title)
+		content.Add(summary)
+	}
+	return container.NewVScroll(content)
+}
+
+// Additional Plugin Methods
+func (p *GoalsPlugin) Aggregate() eventsourcing.Aggregate {
+	return p.aggregate
+}
+
+func (p *GoalsPlugin) Type() eventsourcing.PluginType {
+	return eventsourcing.LLMPlugin
+}
+
+func (p *GoalsPlugin) SystemPrompt() string {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+
+	now := time.Now().In(p.aggregate.location)
+	goals := "Current goals:\n"
+	if len(p.aggregate.Goals) == 0 {
+		goals = "There are no goals yet.\n"
+	}
+	for _, goal := range p.aggregate.sorted() {
+		goals += fmt.Sprintf("- Goal ID: %s, Title: \"%s\", Status: %s, Progress: %d%%", goal.GoalID, goal.Title, goal.Status, goal.Progress)
+		if goal.TargetDate != "" {
+			goals += ", Target date: " + goal.TargetDate
+		}
+		goals += "\n"
+	}
+	lastReview := "There was no weekly review yet."
+	if review := p.aggregate.lastReview(); review != nil {
+		lastReview = "The last weekly review was on " + review.CreatedAt.In(p.aggregate.location).Format("Monday "+dateLayout) + "."
+	}
+
+	return `You are GoalCoach, a specialized AI for keeping track of the user's mid-term goals in MindPalace and reviewing them with the user every week.
+
+The user input will be a JSON object containing the arguments for the command to execute. Parse the JSON and call the appropriate command with the parsed values.
+
+Your job is to interpret user requests about goals and execute the right commands (CreateGoal, UpdateGoal, DeleteGoal, ListGoals, LinkTaskToGoal, StartWeeklyReview, RecordWeeklyReview).
+
+Today is ` + now.Format("Monday "+dateLayout) + `. ` + lastReview + `
+` + goals + `
+When interpreting user requests, pay close attention to the intent:
+- If the user wants to reach something in the coming weeks or months, use the CreateGoal command.
+- If the user says how far they are, changes a goal, reached it or gave up on it, use the UpdateGoal command; reached goals are Achieved, given up ones Dropped.
+- If the user asks about their goals, use the ListGoals command.
+- If the user says a task works towards a goal, use the LinkTaskToGoal command.
+- If the user wants a goal gone for good, use the DeleteGoal command.
+
+The weekly review: when the user asks to review their goals or their week, use the StartWeeklyReview command. Then walk the user through it one goal at a time: say what was completed for the goal since the last review and what is still open, and ask how it went and where the goal stands now. Ask which goal the completed tasks without a goal served, and link them with LinkTaskToGoal once the user says so. When every active goal was discussed, use the RecordWeeklyReview command with the progress and a note per goal in the user's words, and what they said about the week, then share the summary it returns.
+
+Be encouraging but honest, and keep each turn short.`
+}
+
+// AgentModel specifies the LLM model to use for this plugin's agent
+func (p *GoalsPlugin) AgentModel() string {
+	return "gpt-oss:20b"
+}
+
+func (p *GoalsPlugin) EventHandlers() map[string]eventsourcing.EventHandler {
+	return nil
+}
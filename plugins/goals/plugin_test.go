@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// taskEventMock mirrors the task manager's events, which the goals aggregate only sees through their JSON
+type taskEventMock struct {
+	eventsourcing.EventMetadata
+	eventType   string
+	TaskID      string `json:"task_id"`
+	Title       string `json:"title,omitempty"`
+	Status      string `json:"status,omitempty"`
+	CompletedAt string `json:"completed_at,omitempty"`
+}
+
+func (e *taskEventMock) Type() string                { return e.eventType }
+func (e *taskEventMock) Marshal() ([]byte, error)    { return nil, nil }
+func (e *taskEventMock) Unmarshal(data []byte) error { return nil }
+
+// links is a link registry of goals to tasks
+type links map[string][]string
+
+func (l links) LinkedItems(aggregate, id string) []eventsourcing.Item {
+	var items []eventsourcing.Item
+	switch aggregate {
+	case "goals":
+		for _, taskID := range l[id] {
+			items = append(items, eventsourcing.Item{Aggregate: "taskmanager", ID: taskID})
+		}
+	case "taskmanager":
+		for goalID, taskIDs := range l {
+			for _, taskID := range taskIDs {
+				if taskID == id {
+					items = append(items, eventsourcing.Item{Aggregate: "goals", ID: goalID})
+				}
+			}
+		}
+	}
+	return items
+}
+
+func newGoalsPlugin(t *testing.T) *GoalsPlugin {
+	t.Helper()
+	p := NewPlugin().(*GoalsPlugin)
+	p.SetLocation(time.UTC)
+	return p
+}
+
+func apply(t *testing.T, p *GoalsPlugin, events []eventsourcing.Event, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	for _, event := range events {
+		if err := p.aggregate.ApplyEvent(event); err != nil {
+			t.Fatalf("ApplyEvent failed: %v", err)
+		}
+	}
+}
+
+func createGoal(t *testing.T, p *GoalsPlugin, title string, now time.Time) *Goal {
+	t.Helper()
+	events, err := p.createGoalHandler(&CreateGoalInput{Title: title}, now)
+	apply(t, p, events, err)
+	return p.aggregate.Goals[events[0].(*GoalCreatedEvent).GoalID]
+}
+
+func newTaskEvent(eventType, taskID, title string) *taskEventMock {
+	return &taskEventMock{eventType: eventType, TaskID: taskID, Title: title}
+}
+
+func completeTask(t *testing.T, p *GoalsPlugin, taskID string, at time.Time) {
+	t.Helper()
+	event := &taskEventMock{eventType: "taskmanager_TaskCompleted", TaskID: taskID, CompletedAt: at.Format(time.RFC3339)}
+	apply(t, p, []eventsourcing.Event{event}, nil)
+}
+
+func progress(n int) *int { return &n }
+
+func TestGoalsPlugin_CreateUpdateDelete(t *testing.T) {
+	p := newGoalsPlugin(t)
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, input := range []*CreateGoalInput{
+		{Title: " "},
+		{Title: "Run a half marathon", TargetDate: "next autumn"},
+	} {
+		if _, err := p.createGoalHandler(input, now); err == nil {
+			t.Errorf("Expected %+v refused", input)
+		}
+	}
+
+	goal := createGoal(t, p, "Run a half marathon", now)
+	if goal.Status != StatusActive || goal.Progress != 0 {
+		t.Errorf("Expected a new goal active without progress, got %+v", goal)
+	}
+	if _, err := p.updateGoalHandler(&UpdateGoalInput{GoalID: goal.GoalID, Progress: progress(120)}, now); err == nil {
+		t.Error("Expected progress above 100% refused")
+	}
+	events, err := p.updateGoalHandler(&UpdateGoalInput{GoalID: goal.GoalID, Progress: progress(40), TargetDate: "2024-10-13"}, now)
+	apply(t, p, events, err)
+	if goal.Progress != 40 || goal.TargetDate != "2024-10-13" {
+		t.Errorf("Expected the goal updated, got %+v", goal)
+	}
+	events, err = p.updateGoalHandler(&UpdateGoalInput{GoalID: goal.GoalID, Status: "achieved"}, now)
+	apply(t, p, events, err)
+	if goal.Status != StatusAchieved || goal.Progress != 100 {
+		t.Errorf("Expected an achieved goal at 100%%, got %+v", goal)
+	}
+
+	if !p.RequiresConfirmation("DeleteGoal") {
+		t.Error("Expected deleting a goal to require confirmation")
+	}
+	events, err = p.deleteGoalHandler(&DeleteGoalInput{GoalID: goal.GoalID})
+	apply(t, p, events, err)
+	if _, err := p.updateGoalHandler(&UpdateGoalInput{GoalID: goal.GoalID, Progress: progress(50)}, now); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a deleted goal not found, got %v", err)
+	}
+}
+
+func TestGoalsAggregate_Tasks(t *testing.T) {
+	p := newGoalsPlugin(t)
+	apply(t, p, []eventsourcing.Event{
+		newTaskEvent("taskmanager_TaskCreated", "task1", "Buy running shoes"),
+		newTaskEvent("taskmanager_TaskCreated", "task2", "Run 10k"),
+		newTaskEvent("taskmanager_TaskUpdated", "task2", "Run 12k"),
+		newTaskEvent("taskmanager_TaskUpdated", "unknown", "Not created while the goals were tracking"),
+	}, nil)
+	completeTask(t, p, "task1", time.Now())
+	if task := p.aggregate.Tasks["task1"]; task.CompletedAt.IsZero() {
+		t.Error("Expected the task completed")
+	}
+	if task := p.aggregate.Tasks["task2"]; task.Title != "Run 12k" {
+		t.Errorf("Expected the task renamed, got %q", task.Title)
+	}
+	if _, exists := p.aggregate.Tasks["unknown"]; exists {
+		t.Error("Expected an update of an unknown task ignored")
+	}
+
+	// Reopened and deleted tasks
+	reopened := &taskEventMock{eventType: "taskmanager_TaskUpdated", TaskID: "task1", Status: "In Progress"}
+	apply(t, p, []eventsourcing.Event{reopened, newTaskEvent("taskmanager_TaskDeleted", "task2", "")}, nil)
+	if task := p.aggregate.Tasks["task1"]; !task.CompletedAt.IsZero() {
+		t.Error("Expected a reopened task open again")
+	}
+	if _, exists := p.aggregate.Tasks["task2"]; exists {
+		t.Error("Expected the task deleted")
+	}
+}
+
+func TestGoalsPlugin_LinkTaskToGoal(t *testing.T) {
+	p := newGoalsPlugin(t)
+	goal := createGoal(t, p, "Run a half marathon", time.Now())
+	apply(t, p, []eventsourcing.Event{newTaskEvent("taskmanager_TaskCreated", "task1", "Run 10k")}, nil)
+
+	input := &LinkTaskToGoalInput{GoalID: goal.GoalID, TaskID: "task1"}
+	if _, err := p.linkTaskToGoalHandler(input); err == nil {
+		t.Error("Expected linking refused without a command function")
+	}
+	var linked map[string]interface{}
+	p.SetCommandFunc(func(command string, input any) error {
+		if command != "LinkItems" {
+			t.Errorf("Expected LinkItems, got %s", command)
+		}
+		linked = input.(map[string]interface{})
+		return nil
+	})
+	if _, err := p.linkTaskToGoalHandler(&LinkTaskToGoalInput{GoalID: goal.GoalID, TaskID: "missing"}); err == nil {
+		t.Error("Expected an unknown task refused")
+	}
+	events, err := p.linkTaskToGoalHandler(input)
+	if err != nil || len(events) != 0 {
+		t.Fatalf("Expected the task linked without events, got %v, %v", events, err)
+	}
+	if linked["from_aggregate"] != "goals" || linked["from_id"] != goal.GoalID || linked["to_aggregate"] != "taskmanager" || linked["to_id"] != "task1" {
+		t.Errorf("Unexpected link %v", linked)
+	}
+}
+
+func TestGoalsPlugin_WeeklyReview(t *testing.T) {
+	p := newGoalsPlugin(t)
+	now := time.Date(2024, 5, 12, 18, 0, 0, 0, time.UTC)
+	marathon := createGoal(t, p, "Run a half marathon", now.AddDate(0, -1, 0))
+	spanish := createGoal(t, p, "Speak Spanish", now.AddDate(0, -1, 0))
+	apply(t, p, []eventsourcing.Event{
+		newTaskEvent("taskmanager_TaskCreated", "task1", "Run 10k"),
+		newTaskEvent("taskmanager_TaskCreated", "task2", "Run 15k"),
+		newTaskEvent("taskmanager_TaskCreated", "task3", "Old long run"),
+		newTaskEvent("taskmanager_TaskCreated", "task4", "Book a Spanish course"),
+	}, nil)
+	completeTask(t, p, "task1", now.AddDate(0, 0, -2))
+	completeTask(t, p, "task3", now.AddDate(0, 0, -10))
+	completeTask(t, p, "task4", now.AddDate(0, 0, -1))
+	p.SetLinkSource(links{marathon.GoalID: {"task1", "task2", "task3"}})
+
+	events, err := p.startWeeklyReviewHandler(&StartWeeklyReviewInput{}, now)
+	if err != nil {
+		t.Fatalf("startWeeklyReviewHandler failed: %v", err)
+	}
+	started := events[0].(*WeeklyReviewStartedEvent)
+	if len(started.Goals) != 2 {
+		t.Fatalf("Expected both goals reviewed, got %+v", started.Goals)
+	}
+	// Only the week is reviewed, the task completed before it is not
+	if got := started.Goals[0]; got.GoalID != marathon.GoalID || strings.Join(got.Completed, ",") != "Run 10k" || strings.Join(got.Open, ",") != "Run 15k" {
+		t.Errorf("Unexpected review of the marathon %+v", got)
+	}
+	if len(started.Unlinked) != 1 || started.Unlinked[0].TaskID != "task4" {
+		t.Errorf("Expected the Spanish course offered for linking, got %+v", started.Unlinked)
+	}
+
+	var prompt string
+	p.SetGenerateFunc(func(p string) (string, error) {
+		prompt = p
+		return "A good week: the marathon is well on its way.", nil
+	})
+	input := &RecordWeeklyReviewInput{
+		Goals: []ReviewNoteInput{
+			{GoalID: marathon.GoalID, Progress: progress(30), Note: "Felt strong on the 10k"},
+			{GoalID: spanish.GoalID},
+		},
+		Reflection: "Busy at work",
+	}
+	events, err = p.recordWeeklyReviewHandler(input, now)
+	apply(t, p, events, err)
+	recorded := events[0].(*WeeklyReviewRecordedEvent)
+	if recorded.Summary != "A good week: the marathon is well on its way." || recorded.CompletedTasks != 1 {
+		t.Errorf("Unexpected review %+v", recorded)
+	}
+	for _, want := range []string{"0% → 30%", "Run 10k", "Felt strong on the 10k", "Busy at work"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected %q in the prompt, got %q", want, prompt)
+		}
+	}
+	if marathon.Progress != 30 || spanish.Progress != 0 {
+		t.Errorf("Expected the progress of the review applied, got %d and %d", marathon.Progress, spanish.Progress)
+	}
+
+	// The next review covers the time since this one
+	events, err = p.startWeeklyReviewHandler(&StartWeeklyReviewInput{}, now.AddDate(0, 0, 7))
+	if err != nil {
+		t.Fatalf("startWeeklyReviewHandler failed: %v", err)
+	}
+	if next := events[0].(*WeeklyReviewStartedEvent); len(next.Goals[0].Completed) != 0 || next.LastReview == nil {
+		t.Errorf("Expected nothing completed since the last review, got %+v", next.Goals[0])
+	}
+}
+
+func TestGoalsPlugin_WeeklyReviewWithoutLLM(t *testing.T) {
+	p := newGoalsPlugin(t)
+	now := time.Now()
+	goal := createGoal(t, p, "Read twelve books", now)
+	p.SetGenerateFunc(func(string) (string, error) { return "", errors.New("offline") })
+
+	if _, err := p.recordWeeklyReviewHandler(&RecordWeeklyReviewInput{Goals: []ReviewNoteInput{{GoalID: "missing"}}}, now); err == nil {
+		t.Error("Expected an unknown goal refused")
+	}
+	events, err := p.recordWeeklyReviewHandler(&RecordWeeklyReviewInput{Goals: []ReviewNoteInput{{GoalID: goal.GoalID, Progress: progress(25), Note: "three down"}}}, now)
+	apply(t, p, events, err)
+	if summary := events[0].(*WeeklyReviewRecordedEvent).Summary; !strings.Contains(summary, "Read twelve books: 25% (was 0%), three down") {
+		t.Errorf("Expected the goals listed when the LLM fails, got %q", summary)
+	}
+	if len(p.aggregate.Reviews) != 1 {
+		t.Errorf("Expected the review recorded, got %d", len(p.aggregate.Reviews))
+	}
+}
+
+func TestGoalsAggregate_Snapshot(t *testing.T) {
+	p := newGoalsPlugin(t)
+	goal := createGoal(t, p, "Run a half marathon", time.Now())
+	apply(t, p, []eventsourcing.Event{newTaskEvent("taskmanager_TaskCreated", "task1", "Run 10k")}, nil)
+	events, err := p.recordWeeklyReviewHandler(&RecordWeeklyReviewInput{Goals: []ReviewNoteInput{{GoalID: goal.GoalID, Progress: progress(10)}}}, time.Now())
+	apply(t, p, events, err)
+
+	data, err := p.aggregate.SaveSnapshot()
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	restored := newGoalsPlugin(t)
+	if err := restored.aggregate.LoadSnapshot(data); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if got := restored.aggregate.Goals[goal.GoalID]; got == nil || got.Progress != 10 {
+		t.Errorf("Expected the goal restored, got %+v", got)
+	}
+	if len(restored.aggregate.Tasks) != 1 || len(restored.aggregate.Reviews) != 1 {
+		t.Errorf("Expected the tasks and review restored, got %v and %v", restored.aggregate.Tasks, restored.aggregate.Reviews)
+	}
+}
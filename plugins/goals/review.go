@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// reviewPeriod is how far the first review looks back; later ones look back to the review before
+const reviewPeriod = 7 * 24 * time.Hour
+
+const summaryPromptTemplate = `You help the user review their goals every week. This is what the review of the week since %s found:
+
+%s
+Write a short summary of the review addressed to the user: what moved forward and what stalled, what they said about it, and the focus for the coming week. Be encouraging but honest, and do not invent progress. Answer with the summary only.`
+
+// SetGenerateFunc gives the plugin the LLM to summarize reviews with
+func (p *GoalsPlugin) SetGenerateFunc(generate eventsourcing.GenerateFunc) {
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+	p.generate = generate
+}
+
+// since returns the start of the period a review at now covers (caller holds the lock)
+func (a *GoalsAggregate) since(now time.Time) time.Time {
+	if review := a.lastReview(); review != nil {
+		return review.CreatedAt
+	}
+	return now.Add(-reviewPeriod)
+}
+
+// completedSince returns the tasks completed after since, oldest first
+func completedSince(tasks []*Task, since time.Time) []*Task {
+	var completed []*Task
+	for _, task := range tasks {
+		if task.CompletedAt.After(since) {
+			completed = append(completed, task)
+		}
+	}
+	sort.Slice(completed, func(i, j int) bool { return completed[i].CompletedAt.Before(completed[j].CompletedAt) })
+	return completed
+}
+
+func titles(tasks []*Task) []string {
+	titles := []string{}
+	for _, task := range tasks {
+		titles = append(titles, task.Title)
+	}
+	return titles
+}
+
+// startWeeklyReviewHandler gathers what the review goes through: each active goal with the tasks completed
+// for it since the last review and those still open, and the completed tasks that served no goal
+func (p *GoalsPlugin) startWeeklyReviewHandler(_ *StartWeeklyReviewInput, now time.Time) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	since := p.aggregate.since(now)
+	event := &WeeklyReviewStartedEvent{
+		EventType:  "goals_WeeklyReviewStarted",
+		Since:      since.UTC().Format(time.RFC3339),
+		Goals:      []*GoalReview{},
+		Unlinked:   []*Task{},
+		LastReview: p.aggregate.lastReview(),
+	}
+	for _, goal := range p.aggregate.sorted() {
+		if goal.Status != StatusActive {
+			continue
+		}
+		tasks := p.aggregate.linkedTasks(goal.GoalID)
+		var open []*Task
+		for _, task := range tasks {
+			if task.CompletedAt.IsZero() {
+				open = append(open, task)
+			}
+		}
+		event.Goals = append(event.Goals, &GoalReview{
+			GoalID:     goal.GoalID,
+			Title:      goal.Title,
+			TargetDate: goal.TargetDate,
+			Progress:   goal.Progress,
+			Completed:  titles(completedSince(tasks, since)),
+			Open:       titles(open),
+		})
+	}
+	var tasks []*Task
+	for _, task := range p.aggregate.Tasks {
+		if !p.aggregate.servesGoal(task.TaskID) {
+			tasks = append(tasks, task)
+		}
+	}
+	event.Unlinked = append(event.Unlinked, completedSince(tasks, since)...)
+	return []eventsourcing.Event{event}, nil
+}
+
+// recordWeeklyReviewHandler records the review with the progress the user gave each goal, summarized by the
+// LLM. The review is not lost when the LLM fails, its notes are listed instead.
+func (p *GoalsPlugin) recordWeeklyReviewHandler(input *RecordWeeklyReviewInput, now time.Time) ([]eventsourcing.Event, error) {
+	if len(input.Goals) == 0 {
+		return nil, fmt.Errorf("the review needs at least one goal")
+	}
+	if !p.reviewing.TryLock() {
+		return nil, fmt.Errorf("a review is already being recorded")
+	}
+	defer p.reviewing.Unlock()
+
+	p.aggregate.Mu.RLock()
+	since := p.aggregate.since(now)
+	var notes []GoalNote
+	var overview strings.Builder
+	completed := 0
+	var err error
+	for _, given := range input.Goals {
+		var goal *Goal
+		if goal, err = p.goal(given.GoalID); err != nil {
+			break
+		}
+		if err = checkProgress(given.Progress); err != nil {
+			break
+		}
+		note := GoalNote{GoalID: goal.GoalID, Title: goal.Title, Previous: goal.Progress, Progress: goal.Progress, Note: strings.TrimSpace(given.Note)}
+		if given.Progress != nil {
+			note.Progress = *given.Progress
+		}
+		notes = append(notes, note)
+		done := titles(completedSince(p.aggregate.linkedTasks(goal.GoalID), since))
+		completed += len(done)
+		fmt.Fprintf(&overview, "Goal %q: %d%% → %d%%", goal.Title, note.Previous, note.Progress)
+		if goal.TargetDate != "" {
+			fmt.Fprintf(&overview, ", due %s", goal.TargetDate)
+		}
+		overview.WriteString("\n")
+		if len(done) > 0 {
+			fmt.Fprintf(&overview, "Completed: %s\n", strings.Join(done, "; "))
+		}
+		if note.Note != "" {
+			fmt.Fprintf(&overview, "The user says: %s\n", note.Note)
+		}
+		overview.WriteString("\n")
+	}
+	p.aggregate.Mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	reflection := strings.TrimSpace(input.Reflection)
+	if reflection != "" {
+		fmt.Fprintf(&overview, "About the week as a whole the user says: %s\n", reflection)
+	}
+
+	event := &WeeklyReviewRecordedEvent{
+		EventType:      "goals_WeeklyReviewRecorded",
+		ReviewID:       fmt.Sprintf("review_%d", eventsourcing.GenerateUniqueID()),
+		Since:          since.UTC().Format(time.RFC3339),
+		Summary:        p.summarize(since, notes, overview.String()),
+		Reflection:     reflection,
+		Notes:          notes,
+		CompletedTasks: completed,
+		Timestamp:      now.UTC().Format(time.RFC3339),
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+// summarize has the LLM summarize the review, listing the progress of the goals when it can't
+func (p *GoalsPlugin) summarize(since time.Time, notes []GoalNote, overview string) string {
+	p.configMu.Lock()
+	generate := p.generate
+	p.configMu.Unlock()
+	if generate != nil {
+		summary, err := generate(fmt.Sprintf(summaryPromptTemplate, since.Format("Monday "+dateLayout), overview))
+		if err == nil && strings.TrimSpace(summary) != "" {
+			return strings.TrimSpace(summary)
+		}
+		logging.Error("GOALS: Summarizing the weekly review failed, listing the goals instead: %v", err)
+	}
+	var sb strings.Builder
+	sb.WriteString("Weekly review:")
+	for _, note := range notes {
+		fmt.Fprintf(&sb, "\n- %s: %d%%", note.Title, note.Progress)
+		if note.Progress != note.Previous {
+			fmt.Fprintf(&sb, " (was %d%%)", note.Previous)
+		}
+		if note.Note != "" {
+			fmt.Fprintf(&sb, ", %s", note.Note)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,760 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/ui3d"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Mood scores range from MoodMin (awful) to MoodMax (great); 0 means no mood was given
+const (
+	MoodMin = 1
+	MoodMax = 10
+)
+
+// dateLayout is how the day of an entry and the week of a reflection are written
+const dateLayout = "2006-01-02"
+
+// dailyPrompts are the questions the user is asked to write about, one per day in turn
+var dailyPrompts = []string{
+	"What made you smile today?",
+	"What drained your energy today, and what gave it back?",
+	"What did you learn today?",
+	"Who did you enjoy spending time with today?",
+	"What are you grateful for today?",
+	"What would you do differently if you could redo today?",
+	"What is on your mind that you haven't said out loud?",
+	"What small win are you proud of today?",
+	"What are you looking forward to tomorrow?",
+	"How did you take care of yourself today?",
+}
+
+// Entry is the journal entry of a day
+type Entry struct {
+	Date      string    `json:"date"` // YYYY-MM-DD
+	Text      string    `json:"text"`
+	Mood      int       `json:"mood,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// Reflection is the LLM's look back on the entries of a week
+type Reflection struct {
+	Week        string    `json:"week"` // Monday of the week, YYYY-MM-DD
+	Text        string    `json:"text"`
+	EntryCount  int       `json:"entry_count"`
+	AverageMood float64   `json:"average_mood,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// JournalAggregate manages the journal entries and weekly reflections with thread safety
+type JournalAggregate struct {
+	Entries     map[string]*Entry      // By date
+	Reflections map[string]*Reflection // By week
+	promptTime  time.Duration          // Time of day the daily prompt is due
+	commands    map[string]eventsourcing.CommandHandler
+	Mu          sync.RWMutex
+}
+
+// NewJournalAggregate creates a new thread-safe JournalAggregate
+func NewJournalAggregate() *JournalAggregate {
+	return &JournalAggregate{
+		Entries:     make(map[string]*Entry),
+		Reflections: make(map[string]*Reflection),
+		promptTime:  defaultPromptTime,
+		commands:    make(map[string]eventsourcing.CommandHandler),
+	}
+}
+
+// ID returns the aggregate's identifier
+func (a *JournalAggregate) ID() string {
+	return "journal"
+}
+
+// journalSnapshot is the state saved in a snapshot
+type journalSnapshot struct {
+	Entries     map[string]*Entry      `json:"entries"`
+	Reflections map[string]*Reflection `json:"reflections,omitempty"`
+}
+
+// SaveSnapshot serializes the entries and reflections so they can be restored without a full replay
+func (a *JournalAggregate) SaveSnapshot() ([]byte, error) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return json.Marshal(journalSnapshot{Entries: a.Entries, Reflections: a.Reflections})
+}
+
+// LoadSnapshot replaces the entries and reflections with those from a snapshot
+func (a *JournalAggregate) LoadSnapshot(data []byte) error {
+	var snapshot journalSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to unmarshal snapshot: %v", err)
+	}
+	if snapshot.Entries == nil {
+		snapshot.Entries = make(map[string]*Entry)
+	}
+	if snapshot.Reflections == nil {
+		snapshot.Reflections = make(map[string]*Reflection)
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	a.Entries = snapshot.Entries
+	a.Reflections = snapshot.Reflections
+	return nil
+}
+
+// ApplyEvent updates the aggregate state based on journal events
+func (a *JournalAggregate) ApplyEvent(event eventsourcing.Event) error {
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event %s: %v", event.Type(), err)
+	}
+
+	switch event.Type() {
+	case "journal_EntryAppended":
+		var e EntryAppendedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal EntryAppended: %v", err)
+		}
+		entry, exists := a.Entries[e.Date]
+		if !exists {
+			entry = &Entry{Date: e.Date, CreatedAt: parseTime(e.Timestamp)}
+			a.Entries[e.Date] = entry
+		}
+		if e.Text != "" {
+			if entry.Text != "" {
+				entry.Text += "\n\n"
+			}
+			entry.Text += e.Text
+		}
+		if e.Mood != 0 {
+			entry.Mood = e.Mood
+		}
+		for _, tag := range e.Tags {
+			if !contains(entry.Tags, tag) {
+				entry.Tags = append(entry.Tags, tag)
+			}
+		}
+		entry.UpdatedAt = parseTime(e.Timestamp)
+
+	case "journal_EntryDeleted":
+		var e EntryDeletedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal EntryDeleted: %v", err)
+		}
+		delete(a.Entries, e.Date)
+
+	case "journal_ReflectionWritten":
+		var e ReflectionWrittenEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal ReflectionWritten: %v", err)
+		}
+		a.Reflections[e.Week] = &Reflection{
+			Week:        e.Week,
+			Text:        e.Reflection,
+			EntryCount:  e.EntryCount,
+			AverageMood: e.AverageMood,
+			CreatedAt:   parseTime(e.Timestamp),
+		}
+	}
+	return nil
+}
+
+// JournalPlugin implements the plugin interface
+type JournalPlugin struct {
+	aggregate *JournalAggregate
+
+	reflecting  sync.Mutex // Held while a reflection is written
+	configMu    sync.Mutex // Guards the fields below
+	generate    eventsourcing.GenerateFunc
+	stopReflect chan struct{}
+}
+
+func NewPlugin() eventsourcing.Plugin {
+	agg := NewJournalAggregate()
+	p := &JournalPlugin{aggregate: agg}
+	agg.commands = map[string]eventsourcing.CommandHandler{
+		"AppendEntry": eventsourcing.NewCommand(func(input *AppendEntryInput) ([]eventsourcing.Event, error) {
+			return p.appendEntryHandler(input)
+		}),
+		"ListEntries": eventsourcing.NewCommand(func(input *ListEntriesInput) ([]eventsourcing.Event, error) {
+			return p.listEntriesHandler(input)
+		}),
+		"DeleteEntry": eventsourcing.NewCommand(func(input *DeleteEntryInput) ([]eventsourcing.Event, error) {
+			return p.deleteEntryHandler(input)
+		}),
+		"ReflectOnWeek": eventsourcing.NewCommand(func(input *ReflectOnWeekInput) ([]eventsourcing.Event, error) {
+			return p.reflectOnWeekHandler(input)
+		}),
+	}
+	eventsourcing.RegisterEvent("journal_EntryAppended", func() eventsourcing.Event { return &EntryAppendedEvent{} })
+	eventsourcing.RegisterEvent("journal_EntryDeleted", func() eventsourcing.Event { return &EntryDeletedEvent{} })
+	eventsourcing.RegisterEvent("journal_EntriesListed", func() eventsourcing.Event { return &EntriesListedEvent{} })
+	eventsourcing.RegisterTransientEvent("journal_EntriesListed")
+	eventsourcing.RegisterEvent("journal_ReflectionWritten", func() eventsourcing.Event { return &ReflectionWrittenEvent{} })
+	return p
+}
+
+// Commands returns the command handlers
+func (p *JournalPlugin) Commands() map[string]eventsourcing.CommandHandler {
+	return p.aggregate.commands
+}
+
+// Name returns the plugin name
+func (p *JournalPlugin) Name() string {
+	return "journal"
+}
+
+// Schemas defines the command schemas
+func (p *JournalPlugin) Schemas() map[string]eventsourcing.CommandInput {
+	return map[string]eventsourcing.CommandInput{
+		"AppendEntry":   &AppendEntryInput{},
+		"ListEntries":   &ListEntriesInput{},
+		"DeleteEntry":   &DeleteEntryInput{},
+		"ReflectOnWeek": &ReflectOnWeekInput{},
+	}
+}
+
+// Command Input Structs with Schema Generation
+
+func (i *AppendEntryInput) New() any {
+	return &AppendEntryInput{}
+}
+
+// AppendEntryInput defines the input for adding to the entry of a day
+type AppendEntryInput struct {
+	Text string   `json:"Text"`
+	Mood int      `json:"Mood,omitempty"`
+	Tags []string `json:"Tags,omitempty"`
+	Date string   `json:"Date,omitempty"`
+}
+
+func (c *AppendEntryInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Adds text, a mood score or tags to the journal entry of a day, today unless another date is given. Use the user's own words.",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Text": map[string]interface{}{
+					"type":        "string",
+					"description": "What the user wants to write down, in their own words",
+				},
+				"Mood": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("How the user feels, from %d (awful) to %d (great)", MoodMin, MoodMax),
+					"minimum":     MoodMin,
+					"maximum":     MoodMax,
+				},
+				"Tags": map[string]interface{}{
+					"type":        "array",
+					"description": "Tags for the entry, like work, family or sleep",
+					"items":       map[string]interface{}{"type": "string"},
+				},
+				"Date": map[string]interface{}{
+					"type":        "string",
+					"description": "Day of the entry (YYYY-MM-DD), today if omitted",
+				},
+			},
+			"required": []string{"Text"},
+		},
+	}
+}
+
+func (i *ListEntriesInput) New() any {
+	return &ListEntriesInput{}
+}
+
+// ListEntriesInput defines the input for listing entries
+type ListEntriesInput struct {
+	From string `json:"From,omitempty"`
+	To   string `json:"To,omitempty"`
+	Tag  string `json:"Tag,omitempty"`
+}
+
+func (l *ListEntriesInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Lists journal entries with optional filtering",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"From": map[string]interface{}{
+					"type":        "string",
+					"description": "First day to list (YYYY-MM-DD)",
+				},
+				"To": map[string]interface{}{
+					"type":        "string",
+					"description": "Last day to list (YYYY-MM-DD)",
+				},
+				"Tag": map[string]interface{}{
+					"type":        "string",
+					"description": "Filter by tag",
+				},
+			},
+		},
+	}
+}
+
+func (i *DeleteEntryInput) New() any {
+	return &DeleteEntryInput{}
+}
+
+// DeleteEntryInput defines the input for deleting the entry of a day
+type DeleteEntryInput struct {
+	Date string `json:"Date"`
+}
+
+func (d *DeleteEntryInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Deletes the journal entry of a day",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Date": map[string]interface{}{
+					"type":        "string",
+					"description": "Day of the entry to delete (YYYY-MM-DD)",
+				},
+			},
+			"required": []string{"Date"},
+		},
+	}
+}
+
+func (i *ReflectOnWeekInput) New() any {
+	return &ReflectOnWeekInput{}
+}
+
+// ReflectOnWeekInput defines the input for writing the reflection on a week
+type ReflectOnWeekInput struct {
+	Date string `json:"Date,omitempty"`
+}
+
+func (r *ReflectOnWeekInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Writes a reflection on the journal entries of a week: recurring themes, how the mood changed and what stood out",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Date": map[string]interface{}{
+					"type":        "string",
+					"description": "Any day in the week (YYYY-MM-DD), the current week if omitted",
+				},
+			},
+		},
+	}
+}
+
+// Event Types
+type EntryAppendedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string   `json:"event_type"`
+	Date      string   `json:"date"`
+	Text      string   `json:"text,omitempty"`
+	Mood      int      `json:"mood,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Timestamp string   `json:"timestamp,omitempty"`
+}
+
+func (e *EntryAppendedEvent) Type() string { return "journal_EntryAppended" }
+func (e *EntryAppendedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *EntryAppendedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type EntryDeletedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Date      string `json:"date"`
+}
+
+func (e *EntryDeletedEvent) Type() string { return "journal_EntryDeleted" }
+func (e *EntryDeletedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *EntryDeletedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type EntriesListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string   `json:"event_type"`
+	Entries   []*Entry `json:"listed_entries"`
+}
+
+func (e *EntriesListedEvent) Type() string { return "journal_EntriesListed" }
+func (e *EntriesListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *EntriesListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ReflectionWrittenEvent records the reflection on the entries of a week
+type ReflectionWrittenEvent struct {
+	eventsourcing.EventMetadata
+	EventType   string  `json:"event_type"`
+	Week        string  `json:"week"`
+	Reflection  string  `json:"reflection"`
+	EntryCount  int     `json:"entry_count"`
+	AverageMood float64 `json:"average_mood,omitempty"`
+	Timestamp   string  `json:"timestamp,omitempty"`
+}
+
+func (e *ReflectionWrittenEvent) Type() string { return "journal_ReflectionWritten" }
+func (e *ReflectionWrittenEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ReflectionWrittenEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// Utility functions
+func parseTime(timeStr string) time.Time {
+	if timeStr == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, timeStr)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// parseDate parses a day given to a command, today in local time if it is empty
+func parseDate(date string, now time.Time) (time.Time, error) {
+	if date == "" {
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()), nil
+	}
+	t, err := time.ParseInLocation(dateLayout, date, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date '%s', expected YYYY-MM-DD", date)
+	}
+	return t, nil
+}
+
+// weekOf returns the Monday of the week the day is in
+func weekOf(day time.Time) time.Time {
+	offset := (int(day.Weekday()) + 6) % 7
+	return time.Date(day.Year(), day.Month(), day.Day()-offset, 0, 0, 0, 0, day.Location())
+}
+
+// dailyPrompt returns the prompt of a day; every day of a cycle gets another one
+func dailyPrompt(day time.Time) string {
+	days := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+	return dailyPrompts[days%int64(len(dailyPrompts))]
+}
+
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
+// weekEntries returns the entries of the week starting on the Monday, oldest first
+func (a *JournalAggregate) weekEntries(monday time.Time) []*Entry {
+	var entries []*Entry
+	for i := 0; i < 7; i++ {
+		if entry, exists := a.Entries[monday.AddDate(0, 0, i).Format(dateLayout)]; exists {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// averageMood returns the average mood of the entries that have one
+func averageMood(entries []*Entry) float64 {
+	total, count := 0, 0
+	for _, entry := range entries {
+		if entry.Mood != 0 {
+			total += entry.Mood
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return float64(total) / float64(count)
+}
+
+// getSortedDates returns the dates of the entries, oldest first
+func (a *JournalAggregate) getSortedDates() []string {
+	dates := make([]string, 0, len(a.Entries))
+	for date := range a.Entries {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	return dates
+}
+
+// Command Handlers
+func (p *JournalPlugin) appendEntryHandler(input *AppendEntryInput) ([]eventsourcing.Event, error) {
+	if strings.TrimSpace(input.Text) == "" && input.Mood == 0 && len(input.Tags) == 0 {
+		return nil, fmt.Errorf("text is required and must be a non-empty string")
+	}
+	if input.Mood != 0 && (input.Mood < MoodMin || input.Mood > MoodMax) {
+		return nil, fmt.Errorf("mood must be between %d and %d, got %d", MoodMin, MoodMax, input.Mood)
+	}
+	day, err := parseDate(input.Date, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	event := &EntryAppendedEvent{
+		EventType: "journal_EntryAppended",
+		Date:      day.Format(dateLayout),
+		Text:      strings.TrimSpace(input.Text),
+		Mood:      input.Mood,
+		Tags:      input.Tags,
+		Timestamp: eventsourcing.ISOTimestamp(),
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *JournalPlugin) listEntriesHandler(input *ListEntriesInput) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+
+	entries := make([]*Entry, 0, len(p.aggregate.Entries))
+	for _, date := range p.aggregate.getSortedDates() {
+		entry := p.aggregate.Entries[date]
+		if (input.From != "" && date < input.From) ||
+			(input.To != "" && date > input.To) ||
+			(input.Tag != "" && !contains(entry.Tags, input.Tag)) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	event := &EntriesListedEvent{EventType: "journal_EntriesListed", Entries: entries}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *JournalPlugin) deleteEntryHandler(input *DeleteEntryInput) ([]eventsourcing.Event, error) {
+	if input.Date == "" {
+		return nil, fmt.Errorf("date is required and must be a non-empty string")
+	}
+
+	p.aggregate.Mu.RLock()
+	_, exists := p.aggregate.Entries[input.Date]
+	p.aggregate.Mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("no entry on %s", input.Date)
+	}
+
+	event := &EntryDeletedEvent{EventType: "journal_EntryDeleted", Date: input.Date}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *JournalPlugin) reflectOnWeekHandler(input *ReflectOnWeekInput) ([]eventsourcing.Event, error) {
+	day, err := parseDate(input.Date, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return p.reflect(weekOf(day))
+}
+
+// GetCustomUI shows today's prompt, the latest reflection and the entries, newest first
+func (a *JournalAggregate) GetCustomUI() fyne.CanvasObject {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+
+	content := container.NewVBox()
+	prompt := widget.NewLabel(fmt.Sprintf("Today's prompt: %s", dailyPrompt(time.Now())))
+	prompt.TextStyle = fyne.TextStyle{Italic: true}
+	prompt.Wrapping = fyne.TextWrapWord
+	content.Add(prompt)
+	content.Add(widget.NewSeparator())
+
+	if reflection := a.latestReflection(); reflection != nil {
+		title := widget.NewLabel(fmt.Sprintf("Week of %s", reflection.Week))
+		title.TextStyle = fyne.TextStyle{Bold: true}
+		text := widget.NewLabel(reflection.Text)
+		text.Wrapping = fyne.TextWrapWord
+		content.Add(title)
+		content.Add(text)
+		content.Add(widget.NewSeparator())
+	}
+
+	if len(a.Entries) == 0 {
+		content.Add(widget.NewLabel("No entries yet. Tell MindPalace about your day to get started!"))
+		return container.NewVScroll(content)
+	}
+	dates := a.getSortedDates()
+	for i := len(dates) - 1; i >= 0; i-- {
+		entry := a.Entries[dates[i]]
+		heading := entry.Date
+		if entry.Mood != 0 {
+			heading += fmt.Sprintf(" · mood %d/%d", entry.Mood, MoodMax)
+		}
+		if len(entry.Tags) > 0 {
+			heading += " · " + strings.Join(entry.Tags, ", ")
+		}
+		title := widget.NewLabel(heading)
+		title.TextStyle = fyne.TextStyle{Bold: true}
+		text := widget.NewLabel(entry.Text)
+		text.Wrapping = fyne.TextWrapWord
+		content.Add(container.NewPadded(container.NewVBox(title, text)))
+		content.Add(widget.NewSeparator())
+	}
+	return container.NewVScroll(content)
+}
+
+// latestReflection returns the reflection on the most recent week, nil if there is none
+func (a *JournalAggregate) latestReflection() *Reflection {
+	var latest *Reflection
+	for _, reflection := range a.Reflections {
+		if latest == nil || reflection.Week > latest.Week {
+			latest = reflection
+		}
+	}
+	return latest
+}
+
+// Additional Plugin Methods
+func (p *JournalPlugin) Aggregate() eventsourcing.Aggregate {
+	return p.aggregate
+}
+
+func (p *JournalPlugin) Type() eventsourcing.PluginType {
+	return eventsourcing.LLMPlugin
+}
+
+func (p *JournalPlugin) SystemPrompt() string {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+
+	now := time.Now()
+	var recent strings.Builder
+	dates := p.aggregate.getSortedDates()
+	if len(dates) == 0 {
+		recent.WriteString("There are no entries yet.\n")
+	} else {
+		recent.WriteString("Most recent entries:\n")
+		for _, date := range dates[max(0, len(dates)-7):] {
+			entry := p.aggregate.Entries[date]
+			recent.WriteString(fmt.Sprintf("- %s, Mood: %d, Tags: %s\n", entry.Date, entry.Mood, strings.Join(entry.Tags, ", ")))
+		}
+	}
+
+	return `You are JournalKeeper, a specialized AI for keeping the user's journal in MindPalace.
+
+The user input will be a JSON object containing the arguments for the command to execute. Parse the JSON and call the appropriate command with the parsed values.
+
+Your job is to interpret what the user tells you about their day and execute the right commands (AppendEntry, ListEntries, DeleteEntry, ReflectOnWeek).
+
+Today is ` + now.Format("Monday "+dateLayout) + `. Today's prompt is: "` + dailyPrompt(now) + `"
+
+` + recent.String() + `
+When interpreting user requests, pay close attention to the intent:
+- If the user tells you about their day or asks to write something down, use the AppendEntry command with their own words. Often they speak it, so leave out filler words but keep their voice.
+- If the user says how they feel, add a mood score from 1 (awful) to 10 (great) to AppendEntry.
+- If the user asks to "show" or "read" entries, use the ListEntries command.
+- If the user asks to "remove" or "delete" an entry, use the DeleteEntry command.
+- If the user asks how their week went or for a reflection, use the ReflectOnWeek command.
+
+Format your responses in a warm, concise way and confirm what was written down.`
+}
+
+// RequiresConfirmation asks the user before entries are deleted
+func (p *JournalPlugin) RequiresConfirmation(command string) bool {
+	return command == "DeleteEntry"
+}
+
+// AgentModel specifies the LLM model to use for this plugin's agent
+func (p *JournalPlugin) AgentModel() string {
+	return "gpt-oss:20b"
+}
+
+func (p *JournalPlugin) EventHandlers() map[string]eventsourcing.EventHandler {
+	return nil
+}
+
+// entrySpacing is the distance between consecutive entries on the timeline
+const entrySpacing = 1.5
+
+// moodColor returns the color of an entry node, from red for a bad mood to green for a good one
+func moodColor(mood int) []float64 {
+	if mood == 0 {
+		return []float64{0.5, 0.5, 0.5, 1.0}
+	}
+	t := float64(mood-MoodMin) / float64(MoodMax-MoodMin)
+	return []float64{1.0 - t, t, 0.2, 1.0}
+}
+
+func (a *JournalAggregate) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	switch e := event.(type) {
+	case *EntryAppendedEvent:
+		// An entry for an earlier day shifts the entries after it along the timeline
+		actions := deleteEntryActions(e.Date)
+		for _, date := range a.getSortedDates() {
+			if date != e.Date {
+				actions = append(actions, deleteEntryActions(date)...)
+			}
+		}
+		return append(actions, a.timelineActions("journal_entry_appended")...)
+	case *EntryDeletedEvent:
+		actions := deleteEntryActions(e.Date)
+		for _, date := range a.getSortedDates() {
+			actions = append(actions, deleteEntryActions(date)...)
+		}
+		return append(actions, a.timelineActions("journal_entry")...)
+	}
+	return nil
+}
+
+func (a *JournalAggregate) GetFull3DState() []eventsourcing.DeltaAction {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return a.timelineActions("journal_entry")
+}
+
+// timelineActions places the entries chronologically along the x axis, colored by mood
+func (a *JournalAggregate) timelineActions(eventType string) []eventsourcing.DeltaAction {
+	var actions []eventsourcing.DeltaAction
+	for i, date := range a.getSortedDates() {
+		entry := a.Entries[date]
+		objects := ui3d.CreateStandardObject(ui3d.StandardObject{
+			ID:       fmt.Sprintf("journal_entry_%s", date),
+			MeshType: "sphere",
+			Position: []float64{float64(i) * entrySpacing, 1.0, -16.0},
+			Label:    &ui3d.LabelConfig{Text: date},
+			Theme:    ui3d.CurrentTheme(),
+			Extra: map[string]interface{}{
+				"event_type": eventType,
+				"material_override": map[string]interface{}{
+					"albedo_color": moodColor(entry.Mood),
+				},
+			},
+			DisplayInfo: &ui3d.DisplayInfo{
+				Title:       date,
+				Description: entry.Text,
+				Details:     map[string]interface{}{"mood": entry.Mood, "tags": entry.Tags},
+			},
+		})
+		actions = append(actions, objects...)
+	}
+	return actions
+}
+
+// deleteEntryActions removes the node of an entry from the timeline
+func deleteEntryActions(date string) []eventsourcing.DeltaAction {
+	return []eventsourcing.DeltaAction{
+		{Type: "delete", NodeID: fmt.Sprintf("journal_entry_%s", date)},
+		{Type: "delete", NodeID: fmt.Sprintf("journal_entry_%s_label", date)},
+	}
+}
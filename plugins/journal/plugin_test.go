@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+func newJournalPlugin(t *testing.T) *JournalPlugin {
+	t.Helper()
+	return NewPlugin().(*JournalPlugin)
+}
+
+func appendEntry(t *testing.T, p *JournalPlugin, input *AppendEntryInput) {
+	t.Helper()
+	events, err := p.appendEntryHandler(input)
+	if err != nil {
+		t.Fatalf("appendEntryHandler failed: %v", err)
+	}
+	if err := p.aggregate.ApplyEvent(events[0]); err != nil {
+		t.Fatalf("ApplyEvent failed: %v", err)
+	}
+}
+
+func TestJournalAggregate_AppendEntry(t *testing.T) {
+	p := newJournalPlugin(t)
+	appendEntry(t, p, &AppendEntryInput{Text: "Went for a run", Mood: 6, Tags: []string{"health"}, Date: "2024-03-04"})
+	appendEntry(t, p, &AppendEntryInput{Text: "Dinner with friends", Mood: 8, Tags: []string{"friends", "health"}, Date: "2024-03-04"})
+
+	entry, exists := p.aggregate.Entries["2024-03-04"]
+	if !exists {
+		t.Fatal("Entry not found")
+	}
+	if entry.Text != "Went for a run\n\nDinner with friends" {
+		t.Errorf("Expected the texts appended, got %q", entry.Text)
+	}
+	if entry.Mood != 8 {
+		t.Errorf("Expected the latest mood, got %d", entry.Mood)
+	}
+	if strings.Join(entry.Tags, ",") != "health,friends" {
+		t.Errorf("Expected the tags merged, got %v", entry.Tags)
+	}
+}
+
+func TestJournalPlugin_AppendEntryValidates(t *testing.T) {
+	p := newJournalPlugin(t)
+	if _, err := p.appendEntryHandler(&AppendEntryInput{Text: "  "}); err == nil {
+		t.Error("Expected an error for an empty entry")
+	}
+	if _, err := p.appendEntryHandler(&AppendEntryInput{Text: "Great day", Mood: 11}); err == nil {
+		t.Error("Expected an error for a mood out of range")
+	}
+	if _, err := p.appendEntryHandler(&AppendEntryInput{Text: "Great day", Date: "yesterday"}); err == nil {
+		t.Error("Expected an error for an invalid date")
+	}
+	events, err := p.appendEntryHandler(&AppendEntryInput{Text: "Great day"})
+	if err != nil {
+		t.Fatalf("appendEntryHandler failed: %v", err)
+	}
+	if date := events[0].(*EntryAppendedEvent).Date; date != time.Now().Format(dateLayout) {
+		t.Errorf("Expected today's entry, got %s", date)
+	}
+}
+
+func TestJournalPlugin_ReflectOnWeek(t *testing.T) {
+	p := newJournalPlugin(t)
+	if _, err := p.reflectOnWeekHandler(&ReflectOnWeekInput{Date: "2024-03-06"}); err == nil {
+		t.Error("Expected an error without an LLM")
+	}
+
+	var prompt string
+	p.SetGenerateFunc(func(text string) (string, error) {
+		prompt = text
+		return "A busy but happy week.", nil
+	})
+	if _, err := p.reflectOnWeekHandler(&ReflectOnWeekInput{Date: "2024-03-06"}); err == nil {
+		t.Error("Expected an error for a week without entries")
+	}
+
+	appendEntry(t, p, &AppendEntryInput{Text: "Long day at work", Mood: 4, Date: "2024-03-04"})
+	appendEntry(t, p, &AppendEntryInput{Text: "Hiking in the hills", Mood: 9, Date: "2024-03-10"})
+	appendEntry(t, p, &AppendEntryInput{Text: "Next week already", Mood: 1, Date: "2024-03-11"})
+
+	events, err := p.reflectOnWeekHandler(&ReflectOnWeekInput{Date: "2024-03-06"})
+	if err != nil {
+		t.Fatalf("reflectOnWeekHandler failed: %v", err)
+	}
+	written := events[0].(*ReflectionWrittenEvent)
+	if written.Week != "2024-03-04" || written.EntryCount != 2 || written.AverageMood != 6.5 {
+		t.Errorf("Unexpected reflection %+v", written)
+	}
+	if !strings.Contains(prompt, "Monday 2024-03-04 (mood 4)") || !strings.Contains(prompt, "Hiking in the hills") || strings.Contains(prompt, "Next week already") {
+		t.Errorf("Expected the week's entries in the prompt, got %q", prompt)
+	}
+
+	p.aggregate.ApplyEvent(written)
+	if reflection := p.aggregate.Reflections["2024-03-04"]; reflection == nil || reflection.Text != "A busy but happy week." {
+		t.Errorf("Expected the reflection stored, got %+v", reflection)
+	}
+}
+
+func TestJournalPlugin_ReflectOnLastWeek(t *testing.T) {
+	p := newJournalPlugin(t)
+	calls := 0
+	p.SetGenerateFunc(func(text string) (string, error) {
+		calls++
+		return "Reflection", nil
+	})
+	now := time.Date(2024, time.March, 13, 9, 0, 0, 0, time.Local)
+	if events := p.reflectOnLastWeek(now); events != nil {
+		t.Errorf("Expected no reflection on a week without entries, got %v", events)
+	}
+
+	appendEntry(t, p, &AppendEntryInput{Text: "Quiet Sunday", Date: "2024-03-10"})
+	events := p.reflectOnLastWeek(now)
+	if len(events) != 1 || events[0].(*ReflectionWrittenEvent).Week != "2024-03-04" {
+		t.Fatalf("Expected a reflection on last week, got %v", events)
+	}
+	p.aggregate.ApplyEvent(events[0])
+	if events := p.reflectOnLastWeek(now); events != nil || calls != 1 {
+		t.Errorf("Expected a week to be reflected on once, got %v after %d calls", events, calls)
+	}
+
+	p.SetGenerateFunc(func(text string) (string, error) { return "", fmt.Errorf("offline") })
+	appendEntry(t, p, &AppendEntryInput{Text: "Monday again", Date: "2024-03-11"})
+	if events := p.reflectOnLastWeek(now.AddDate(0, 0, 7)); events != nil {
+		t.Errorf("Expected no reflection when the LLM fails, got %v", events)
+	}
+}
+
+func TestJournalAggregate_Deadlines(t *testing.T) {
+	p := newJournalPlugin(t)
+	if err := p.Configure(map[string]interface{}{"prompt_time": "21:30", "weekly_reflection": false}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	deadlines := p.aggregate.Deadlines()
+	if len(deadlines) != 1 {
+		t.Fatalf("Expected today's prompt, got %v", deadlines)
+	}
+	now := time.Now()
+	if due := deadlines[0].Due; due.Hour() != 21 || due.Minute() != 30 || due.Day() != now.Day() {
+		t.Errorf("Expected the prompt due today at 21:30, got %v", due)
+	}
+	if !strings.HasPrefix(deadlines[0].Title, "Journal: ") {
+		t.Errorf("Expected the prompt in the title, got %q", deadlines[0].Title)
+	}
+
+	appendEntry(t, p, &AppendEntryInput{Text: "Wrote today"})
+	if deadlines := p.aggregate.Deadlines(); len(deadlines) != 0 {
+		t.Errorf("Expected no prompt once today has an entry, got %v", deadlines)
+	}
+
+	if err := p.Configure(map[string]interface{}{"prompt_time": "late"}); err == nil {
+		t.Error("Expected an error for an invalid prompt_time")
+	}
+}
+
+func TestWeekOf(t *testing.T) {
+	for date, want := range map[string]string{"2024-03-04": "2024-03-04", "2024-03-07": "2024-03-04", "2024-03-10": "2024-03-04", "2024-03-11": "2024-03-11"} {
+		day, _ := time.Parse(dateLayout, date)
+		if got := weekOf(day).Format(dateLayout); got != want {
+			t.Errorf("weekOf(%s) = %s, want %s", date, got, want)
+		}
+	}
+}
+
+func TestJournalAggregate_GetFull3DState(t *testing.T) {
+	p := newJournalPlugin(t)
+	appendEntry(t, p, &AppendEntryInput{Text: "Later", Mood: 9, Date: "2024-03-05"})
+	appendEntry(t, p, &AppendEntryInput{Text: "Earlier", Mood: 2, Date: "2024-03-01"})
+
+	actions := p.aggregate.GetFull3DState()
+	var nodes []eventsourcing.DeltaAction
+	for _, action := range actions {
+		if action.NodeType == "MeshInstance3D" {
+			nodes = append(nodes, action)
+		}
+	}
+	if len(nodes) != 2 || nodes[0].NodeID != "journal_entry_2024-03-01" || nodes[1].NodeID != "journal_entry_2024-03-05" {
+		t.Fatalf("Expected the entries in chronological order, got %+v", nodes)
+	}
+	first, second := nodes[0].Properties["position"].([]float64), nodes[1].Properties["position"].([]float64)
+	if second[0] <= first[0] || second[1] != first[1] || second[2] != first[2] {
+		t.Errorf("Expected the entries along the x axis, got %v and %v", first, second)
+	}
+
+	delta := p.aggregate.Broadcast3DDelta(&EntryAppendedEvent{Date: "2024-03-05"})
+	if len(delta) == 0 || delta[0].Type != "delete" {
+		t.Errorf("Expected the timeline rebuilt, got %+v", delta)
+	}
+}
+
+func TestJournalAggregate_SnapshotRoundTrip(t *testing.T) {
+	p := newJournalPlugin(t)
+	appendEntry(t, p, &AppendEntryInput{Text: "Snapshot me", Mood: 5, Date: "2024-03-01"})
+	p.aggregate.ApplyEvent(&ReflectionWrittenEvent{Week: "2024-02-26", Reflection: "Fine", EntryCount: 1})
+
+	data, err := p.aggregate.SaveSnapshot()
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	restored := NewJournalAggregate()
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if restored.Entries["2024-03-01"] == nil || restored.Reflections["2024-02-26"] == nil {
+		t.Errorf("Expected the entry and reflection restored, got %+v and %+v", restored.Entries, restored.Reflections)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// defaultPromptTime is the time of day the daily prompt is due when none is configured
+const defaultPromptTime = 20 * time.Hour
+
+// reflectInterval is how often the plugin checks whether last week needs a reflection
+const reflectInterval = time.Hour
+
+const reflectionPromptTemplate = `You help the user look back on their week through their journal. These are their entries of the week starting %s, with their mood from %d (awful) to %d (great) where they gave one:
+
+%s
+Write a short reflection addressed to the user: the themes that came back, how their mood changed and what may have caused it, and one or two things worth keeping or changing next week. Be warm and specific, quote them where it helps, and do not invent events. Answer with the reflection only.`
+
+// SetGenerateFunc gives the plugin the LLM to write reflections with
+func (p *JournalPlugin) SetGenerateFunc(generate eventsourcing.GenerateFunc) {
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+	p.generate = generate
+}
+
+// Configure applies the [plugin.journal] settings of the configuration file: prompt_time, the time of day
+// ("20:00") the daily prompt is due, and weekly_reflection, whether last week is reflected on automatically
+func (p *JournalPlugin) Configure(settings map[string]interface{}) error {
+	promptTime := defaultPromptTime
+	if value, ok := settings["prompt_time"].(string); ok && value != "" {
+		parsed, err := time.Parse("15:04", value)
+		if err != nil {
+			return fmt.Errorf("prompt_time %s must be a time of day like 20:00", value)
+		}
+		promptTime = time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute
+	}
+	weekly := true
+	if value, ok := settings["weekly_reflection"].(bool); ok {
+		weekly = value
+	}
+
+	p.aggregate.Mu.Lock()
+	p.aggregate.promptTime = promptTime
+	p.aggregate.Mu.Unlock()
+
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+	if p.stopReflect != nil {
+		close(p.stopReflect)
+		p.stopReflect = nil
+	}
+	if weekly {
+		p.stopReflect = make(chan struct{})
+		go p.reflectLoop(p.stopReflect)
+	}
+	return nil
+}
+
+// reflectLoop reflects on last week once it is over, checking until stop is closed
+func (p *JournalPlugin) reflectLoop(stop chan struct{}) {
+	ticker := time.NewTicker(reflectInterval)
+	defer ticker.Stop()
+	for {
+		eventBus := eventsourcing.GetGlobalEventBus()
+		if eventBus != nil {
+			for _, event := range p.reflectOnLastWeek(time.Now()) {
+				eventBus.Publish(event)
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reflectOnLastWeek writes the reflection on the week before now, unless it has one or no entries
+func (p *JournalPlugin) reflectOnLastWeek(now time.Time) []eventsourcing.Event {
+	monday := weekOf(now).AddDate(0, 0, -7)
+	p.aggregate.Mu.RLock()
+	_, reflected := p.aggregate.Reflections[monday.Format(dateLayout)]
+	empty := len(p.aggregate.weekEntries(monday)) == 0
+	p.aggregate.Mu.RUnlock()
+	if reflected || empty {
+		return nil
+	}
+	events, err := p.reflect(monday)
+	if err != nil {
+		logging.Error("JOURNAL: Reflecting on the week of %s failed: %v", monday.Format(dateLayout), err)
+		return nil
+	}
+	logging.Info("JOURNAL: Reflected on the week of %s", monday.Format(dateLayout))
+	return events
+}
+
+// reflect has the LLM write a reflection on the entries of the week starting on the Monday
+func (p *JournalPlugin) reflect(monday time.Time) ([]eventsourcing.Event, error) {
+	p.configMu.Lock()
+	generate := p.generate
+	p.configMu.Unlock()
+	if generate == nil {
+		return nil, fmt.Errorf("no LLM is available to write reflections")
+	}
+	if !p.reflecting.TryLock() {
+		return nil, fmt.Errorf("a reflection is already being written")
+	}
+	defer p.reflecting.Unlock()
+
+	week := monday.Format(dateLayout)
+	p.aggregate.Mu.RLock()
+	entries := p.aggregate.weekEntries(monday)
+	var transcript strings.Builder
+	for _, entry := range entries {
+		transcript.WriteString(entryDay(entry.Date).Format("Monday " + dateLayout))
+		if entry.Mood != 0 {
+			transcript.WriteString(fmt.Sprintf(" (mood %d)", entry.Mood))
+		}
+		if len(entry.Tags) > 0 {
+			transcript.WriteString(fmt.Sprintf(" [%s]", strings.Join(entry.Tags, ", ")))
+		}
+		transcript.WriteString(":\n" + entry.Text + "\n\n")
+	}
+	average := averageMood(entries)
+	p.aggregate.Mu.RUnlock()
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("there are no entries in the week of %s", week)
+	}
+
+	reflection, err := generate(fmt.Sprintf(reflectionPromptTemplate, week, MoodMin, MoodMax, transcript.String()))
+	if err != nil {
+		return nil, err
+	}
+	if reflection == "" {
+		return nil, fmt.Errorf("the LLM wrote an empty reflection on the week of %s", week)
+	}
+	event := &ReflectionWrittenEvent{
+		EventType:   "journal_ReflectionWritten",
+		Week:        week,
+		Reflection:  reflection,
+		EntryCount:  len(entries),
+		AverageMood: average,
+		Timestamp:   eventsourcing.ISOTimestamp(),
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+// entryDay parses the date of an entry, the zero time if it is malformed
+func entryDay(date string) time.Time {
+	t, _ := time.Parse(dateLayout, date)
+	return t
+}
+
+// Deadlines returns the daily prompt, due at the configured time, while today has no entry
+func (a *JournalAggregate) Deadlines() []eventsourcing.Deadline {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if _, written := a.Entries[today.Format(dateLayout)]; written {
+		return nil
+	}
+	return []eventsourcing.Deadline{{
+		ID:    fmt.Sprintf("prompt_%s", today.Format(dateLayout)),
+		Title: fmt.Sprintf("Journal: %s", dailyPrompt(today)),
+		Due:   today.Add(a.promptTime),
+	}}
+}
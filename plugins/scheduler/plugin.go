@@ -0,0 +1,801 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mindpalace/pkg/cron"
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// MinInterval is the shortest time allowed between the runs of a schedule, so a schedule can't keep
+// the LLM busy
+const MinInterval = 15 * time.Minute
+
+// checkInterval is how often the plugin checks for schedules that are due
+const checkInterval = 30 * time.Second
+
+// Schedule is a request made to the assistant at the times of a cron expression
+type Schedule struct {
+	ScheduleID string    `json:"schedule_id"`
+	Name       string    `json:"name"`
+	Cron       string    `json:"cron"`
+	Prompt     string    `json:"prompt"` // Request made to the assistant, as if the user said it
+	Paused     bool      `json:"paused,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ResumedAt  time.Time `json:"resumed_at,omitempty"`
+	LastRun    time.Time `json:"last_run,omitempty"`
+	Runs       int       `json:"runs,omitempty"`
+	schedule   *cron.Schedule
+}
+
+// since returns the time the next run is counted from: the last run, or else when the schedule was
+// created or last resumed, so runs missed while paused are not made up for
+func (s *Schedule) since() time.Time {
+	since := s.CreatedAt
+	for _, t := range []time.Time{s.ResumedAt, s.LastRun} {
+		if t.After(since) {
+			since = t
+		}
+	}
+	return since
+}
+
+// Next returns the time of the next run on the clock of loc, the zero time if there is none. A run
+// missed while MindPalace was not running is due right away, once.
+func (s *Schedule) Next(loc *time.Location) time.Time {
+	if s.Paused || s.schedule == nil {
+		return time.Time{}
+	}
+	return s.schedule.Next(s.since().In(loc))
+}
+
+// SchedulerAggregate manages the schedules of the user
+type SchedulerAggregate struct {
+	Schedules map[string]*Schedule
+	commands  map[string]eventsourcing.CommandHandler
+	location  *time.Location // Time zone the schedules run in
+	Mu        sync.RWMutex
+}
+
+// NewSchedulerAggregate creates a new thread-safe SchedulerAggregate
+func NewSchedulerAggregate() *SchedulerAggregate {
+	return &SchedulerAggregate{
+		Schedules: make(map[string]*Schedule),
+		commands:  make(map[string]eventsourcing.CommandHandler),
+		location:  time.Local,
+	}
+}
+
+// ID returns the aggregate's identifier
+func (a *SchedulerAggregate) ID() string {
+	return "scheduler"
+}
+
+// SaveSnapshot serializes the schedules so they can be restored without a full replay
+func (a *SchedulerAggregate) SaveSnapshot() ([]byte, error) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return json.Marshal(a.Schedules)
+}
+
+// LoadSnapshot replaces the schedules with those from a snapshot
+func (a *SchedulerAggregate) LoadSnapshot(data []byte) error {
+	schedules := make(map[string]*Schedule)
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return fmt.Errorf("failed to unmarshal snapshot: %v", err)
+	}
+	for _, s := range schedules {
+		parsed, err := cron.Parse(s.Cron)
+		if err != nil {
+			return fmt.Errorf("invalid schedule %s in snapshot: %v", s.ScheduleID, err)
+		}
+		s.schedule = parsed
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	a.Schedules = schedules
+	return nil
+}
+
+// ApplyEvent updates the schedules
+func (a *SchedulerAggregate) ApplyEvent(event eventsourcing.Event) error {
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event %s: %v", event.Type(), err)
+	}
+
+	switch event.Type() {
+	case "scheduler_ScheduleCreated":
+		var e ScheduleCreatedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal ScheduleCreated: %v", err)
+		}
+		parsed, err := cron.Parse(e.Cron)
+		if err != nil {
+			return fmt.Errorf("invalid schedule %s: %v", e.ScheduleID, err)
+		}
+		a.Schedules[e.ScheduleID] = &Schedule{
+			ScheduleID: e.ScheduleID,
+			Name:       e.Name,
+			Cron:       e.Cron,
+			Prompt:     e.Prompt,
+			CreatedAt:  parseTime(e.CreatedAt),
+			schedule:   parsed,
+		}
+
+	case "scheduler_ScheduleRan":
+		var e ScheduleRanEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal ScheduleRan: %v", err)
+		}
+		if s, exists := a.Schedules[e.ScheduleID]; exists {
+			s.LastRun = parseTime(e.RanAt)
+			s.Runs++
+		}
+
+	case "scheduler_SchedulePaused":
+		var e SchedulePausedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal SchedulePaused: %v", err)
+		}
+		if s, exists := a.Schedules[e.ScheduleID]; exists {
+			s.Paused = true
+		}
+
+	case "scheduler_ScheduleResumed":
+		var e ScheduleResumedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal ScheduleResumed: %v", err)
+		}
+		if s, exists := a.Schedules[e.ScheduleID]; exists {
+			s.Paused = false
+			s.ResumedAt = parseTime(e.ResumedAt)
+		}
+
+	case "scheduler_ScheduleDeleted":
+		var e ScheduleDeletedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal ScheduleDeleted: %v", err)
+		}
+		delete(a.Schedules, e.ScheduleID)
+	}
+	return nil
+}
+
+// sorted returns the schedules by name
+func (a *SchedulerAggregate) sorted() []*Schedule {
+	schedules := make([]*Schedule, 0, len(a.Schedules))
+	for _, s := range a.Schedules {
+		schedules = append(schedules, s)
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		if schedules[i].Name != schedules[j].Name {
+			return schedules[i].Name < schedules[j].Name
+		}
+		return schedules[i].ScheduleID < schedules[j].ScheduleID
+	})
+	return schedules
+}
+
+// due returns the schedules whose next run has come
+func (a *SchedulerAggregate) due(now time.Time) []*Schedule {
+	var due []*Schedule
+	for _, s := range a.sorted() {
+		if next := s.Next(a.location); !next.IsZero() && !next.After(now) {
+			due = append(due, s)
+		}
+	}
+	return due
+}
+
+// SchedulerPlugin implements the plugin interface
+type SchedulerPlugin struct {
+	aggregate *SchedulerAggregate
+
+	runMu   sync.Mutex // Guards the fields below
+	execute eventsourcing.CommandFunc
+	stopRun chan struct{}
+}
+
+func NewPlugin() eventsourcing.Plugin {
+	agg := NewSchedulerAggregate()
+	p := &SchedulerPlugin{aggregate: agg}
+	agg.commands = map[string]eventsourcing.CommandHandler{
+		"CreateSchedule": eventsourcing.NewCommand(func(input *CreateScheduleInput) ([]eventsourcing.Event, error) {
+			return p.createScheduleHandler(input, time.Now())
+		}),
+		"ListSchedules": eventsourcing.NewCommand(func(input *ListSchedulesInput) ([]eventsourcing.Event, error) {
+			return p.listSchedulesHandler(input)
+		}),
+		"PauseSchedule": eventsourcing.NewCommand(func(input *PauseScheduleInput) ([]eventsourcing.Event, error) {
+			return p.pauseScheduleHandler(input)
+		}),
+		"ResumeSchedule": eventsourcing.NewCommand(func(input *ResumeScheduleInput) ([]eventsourcing.Event, error) {
+			return p.resumeScheduleHandler(input)
+		}),
+		"DeleteSchedule": eventsourcing.NewCommand(func(input *DeleteScheduleInput) ([]eventsourcing.Event, error) {
+			return p.deleteScheduleHandler(input)
+		}),
+		// Executed by the plugin itself when a schedule is due, not offered to the LLM
+		"RunSchedule": eventsourcing.NewCommand(func(input *RunScheduleInput) ([]eventsourcing.Event, error) {
+			return p.runScheduleHandler(input, time.Now())
+		}),
+	}
+	eventsourcing.RegisterEvent("scheduler_ScheduleCreated", func() eventsourcing.Event { return &ScheduleCreatedEvent{} })
+	eventsourcing.RegisterEvent("scheduler_ScheduleRan", func() eventsourcing.Event { return &ScheduleRanEvent{} })
+	eventsourcing.RegisterEvent("scheduler_SchedulePaused", func() eventsourcing.Event { return &SchedulePausedEvent{} })
+	eventsourcing.RegisterEvent("scheduler_ScheduleResumed", func() eventsourcing.Event { return &ScheduleResumedEvent{} })
+	eventsourcing.RegisterEvent("scheduler_ScheduleDeleted", func() eventsourcing.Event { return &ScheduleDeletedEvent{} })
+	eventsourcing.RegisterEvent("scheduler_SchedulesListed", func() eventsourcing.Event { return &SchedulesListedEvent{} })
+	eventsourcing.RegisterTransientEvent("scheduler_SchedulesListed")
+	return p
+}
+
+// Commands returns the command handlers
+func (p *SchedulerPlugin) Commands() map[string]eventsourcing.CommandHandler {
+	return p.aggregate.commands
+}
+
+// Name returns the plugin name
+func (p *SchedulerPlugin) Name() string {
+	return "scheduler"
+}
+
+// Schemas defines the command schemas
+func (p *SchedulerPlugin) Schemas() map[string]eventsourcing.CommandInput {
+	return map[string]eventsourcing.CommandInput{
+		"CreateSchedule": &CreateScheduleInput{},
+		"ListSchedules":  &ListSchedulesInput{},
+		"PauseSchedule":  &PauseScheduleInput{},
+		"ResumeSchedule": &ResumeScheduleInput{},
+		"DeleteSchedule": &DeleteScheduleInput{},
+	}
+}
+
+// Command Input Structs with Schema Generation
+
+func (i *CreateScheduleInput) New() any {
+	return &CreateScheduleInput{}
+}
+
+// CreateScheduleInput defines the input for creating a schedule
+type CreateScheduleInput struct {
+	Name   string `json:"Name,omitempty"`
+	Cron   string `json:"Cron"`
+	Prompt string `json:"Prompt"`
+}
+
+func (s *CreateScheduleInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Schedules a request to the assistant, made at the times of a cron expression in the user's time zone",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Name": map[string]interface{}{
+					"type":        "string",
+					"description": "Short name of the schedule, like \"Evening review\"",
+				},
+				"Cron": map[string]interface{}{
+					"type":        "string",
+					"description": "When to make the request: minute hour day-of-month month day-of-week, like \"0 18 * * *\" for every day at 18:00 or \"30 7 * * mon-fri\" for weekdays at 7:30",
+				},
+				"Prompt": map[string]interface{}{
+					"type":        "string",
+					"description": "The request to make, written as the user would ask it, like \"List my tasks due tomorrow and summarize them\"",
+				},
+			},
+			"required": []string{"Cron", "Prompt"},
+		},
+	}
+}
+
+func (i *ListSchedulesInput) New() any {
+	return &ListSchedulesInput{}
+}
+
+// ListSchedulesInput defines the input for listing the schedules
+type ListSchedulesInput struct{}
+
+func (s *ListSchedulesInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Lists the schedules with their next run",
+		"parameters": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+	}
+}
+
+// scheduleIDSchema returns the schema of an input naming a schedule
+func scheduleIDSchema(description string) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"ScheduleID": map[string]interface{}{
+					"type":        "string",
+					"description": "ID of the schedule",
+				},
+			},
+			"required": []string{"ScheduleID"},
+		},
+	}
+}
+
+func (i *PauseScheduleInput) New() any {
+	return &PauseScheduleInput{}
+}
+
+// PauseScheduleInput defines the input for pausing a schedule
+type PauseScheduleInput struct {
+	ScheduleID string `json:"ScheduleID"`
+}
+
+func (s *PauseScheduleInput) Schema() map[string]interface{} {
+	return scheduleIDSchema("Pauses a schedule until it is resumed")
+}
+
+func (i *ResumeScheduleInput) New() any {
+	return &ResumeScheduleInput{}
+}
+
+// ResumeScheduleInput defines the input for resuming a paused schedule
+type ResumeScheduleInput struct {
+	ScheduleID string `json:"ScheduleID"`
+}
+
+func (s *ResumeScheduleInput) Schema() map[string]interface{} {
+	return scheduleIDSchema("Resumes a paused schedule, from its next time on")
+}
+
+func (i *DeleteScheduleInput) New() any {
+	return &DeleteScheduleInput{}
+}
+
+// DeleteScheduleInput defines the input for deleting a schedule
+type DeleteScheduleInput struct {
+	ScheduleID string `json:"ScheduleID"`
+}
+
+func (s *DeleteScheduleInput) Schema() map[string]interface{} {
+	return scheduleIDSchema("Deletes a schedule for good")
+}
+
+func (i *RunScheduleInput) New() any {
+	return &RunScheduleInput{}
+}
+
+// RunScheduleInput defines the input for recording the run of a due schedule
+type RunScheduleInput struct {
+	ScheduleID string `json:"ScheduleID"`
+}
+
+func (s *RunScheduleInput) Schema() map[string]interface{} {
+	return scheduleIDSchema("Records the run of a schedule that is due")
+}
+
+// Event Types
+type ScheduleCreatedEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string `json:"event_type"`
+	ScheduleID string `json:"schedule_id"`
+	Name       string `json:"name"`
+	Cron       string `json:"cron"`
+	Prompt     string `json:"prompt"`
+	CreatedAt  string `json:"created_at"`
+}
+
+func (e *ScheduleCreatedEvent) Type() string { return "scheduler_ScheduleCreated" }
+func (e *ScheduleCreatedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ScheduleCreatedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ScheduleRanEvent records that the request of a schedule was made, so it isn't made again after a restart
+type ScheduleRanEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string `json:"event_type"`
+	ScheduleID string `json:"schedule_id"`
+	RanAt      string `json:"ran_at"`
+}
+
+func (e *ScheduleRanEvent) Type() string { return "scheduler_ScheduleRan" }
+func (e *ScheduleRanEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ScheduleRanEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type SchedulePausedEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string `json:"event_type"`
+	ScheduleID string `json:"schedule_id"`
+	PausedAt   string `json:"paused_at"`
+}
+
+func (e *SchedulePausedEvent) Type() string { return "scheduler_SchedulePaused" }
+func (e *SchedulePausedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *SchedulePausedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type ScheduleResumedEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string `json:"event_type"`
+	ScheduleID string `json:"schedule_id"`
+	ResumedAt  string `json:"resumed_at"`
+}
+
+func (e *ScheduleResumedEvent) Type() string { return "scheduler_ScheduleResumed" }
+func (e *ScheduleResumedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ScheduleResumedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+type ScheduleDeletedEvent struct {
+	eventsourcing.EventMetadata
+	EventType  string `json:"event_type"`
+	ScheduleID string `json:"schedule_id"`
+	Name       string `json:"name"`
+}
+
+func (e *ScheduleDeletedEvent) Type() string { return "scheduler_ScheduleDeleted" }
+func (e *ScheduleDeletedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *ScheduleDeletedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// ScheduleInfo is a schedule as it is listed for the LLM
+type ScheduleInfo struct {
+	ScheduleID string `json:"schedule_id"`
+	Name       string `json:"name"`
+	Cron       string `json:"cron"`
+	Prompt     string `json:"prompt"`
+	Paused     bool   `json:"paused,omitempty"`
+	NextRun    string `json:"next_run,omitempty"`
+	LastRun    string `json:"last_run,omitempty"`
+}
+
+type SchedulesListedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string          `json:"event_type"`
+	Schedules []*ScheduleInfo `json:"schedules"`
+}
+
+func (e *SchedulesListedEvent) Type() string { return "scheduler_SchedulesListed" }
+func (e *SchedulesListedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *SchedulesListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// Utility functions
+func generateScheduleID() string {
+	return fmt.Sprintf("schedule_%d", eventsourcing.GenerateUniqueID())
+}
+
+func parseTime(timeStr string) time.Time {
+	if timeStr == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, timeStr)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// checkFrequency refuses schedules running more often than MinInterval, judged by their next runs
+func checkFrequency(schedule *cron.Schedule, from time.Time) error {
+	previous := schedule.Next(from)
+	if previous.IsZero() {
+		return fmt.Errorf("%s never runs", schedule)
+	}
+	for i := 0; i < 24; i++ {
+		next := schedule.Next(previous)
+		if next.IsZero() {
+			break
+		}
+		if next.Sub(previous) < MinInterval {
+			return fmt.Errorf("%s runs more often than every %d minutes", schedule, int(MinInterval.Minutes()))
+		}
+		previous = next
+	}
+	return nil
+}
+
+// Command Handlers
+func (p *SchedulerPlugin) createScheduleHandler(input *CreateScheduleInput, now time.Time) ([]eventsourcing.Event, error) {
+	prompt := strings.TrimSpace(input.Prompt)
+	if prompt == "" {
+		return nil, fmt.Errorf("prompt is required and must be a non-empty string")
+	}
+	parsed, err := cron.Parse(input.Cron)
+	if err != nil {
+		return nil, err
+	}
+	p.aggregate.Mu.RLock()
+	loc := p.aggregate.location
+	p.aggregate.Mu.RUnlock()
+	if err := checkFrequency(parsed, now.In(loc)); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		name = prompt
+	}
+	event := &ScheduleCreatedEvent{
+		EventType:  "scheduler_ScheduleCreated",
+		ScheduleID: generateScheduleID(),
+		Name:       name,
+		Cron:       parsed.String(),
+		Prompt:     prompt,
+		CreatedAt:  now.UTC().Format(time.RFC3339),
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *SchedulerPlugin) listSchedulesHandler(input *ListSchedulesInput) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	event := &SchedulesListedEvent{EventType: "scheduler_SchedulesListed", Schedules: []*ScheduleInfo{}}
+	for _, s := range p.aggregate.sorted() {
+		info := &ScheduleInfo{ScheduleID: s.ScheduleID, Name: s.Name, Cron: s.Cron, Prompt: s.Prompt, Paused: s.Paused}
+		if next := s.Next(p.aggregate.location); !next.IsZero() {
+			info.NextRun = next.Format(time.RFC3339)
+		}
+		if !s.LastRun.IsZero() {
+			info.LastRun = s.LastRun.In(p.aggregate.location).Format(time.RFC3339)
+		}
+		event.Schedules = append(event.Schedules, info)
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+// schedule returns the schedule with the ID; the aggregate must be locked
+func (p *SchedulerPlugin) schedule(scheduleID string) (*Schedule, error) {
+	if scheduleID == "" {
+		return nil, fmt.Errorf("scheduleID is required and must be a non-empty string")
+	}
+	s, exists := p.aggregate.Schedules[scheduleID]
+	if !exists {
+		return nil, fmt.Errorf("schedule %s not found", scheduleID)
+	}
+	return s, nil
+}
+
+func (p *SchedulerPlugin) pauseScheduleHandler(input *PauseScheduleInput) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	s, err := p.schedule(input.ScheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if s.Paused {
+		return nil, fmt.Errorf("schedule %q is paused already", s.Name)
+	}
+	event := &SchedulePausedEvent{
+		EventType:  "scheduler_SchedulePaused",
+		ScheduleID: s.ScheduleID,
+		PausedAt:   eventsourcing.ISOTimestamp(),
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *SchedulerPlugin) resumeScheduleHandler(input *ResumeScheduleInput) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	s, err := p.schedule(input.ScheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Paused {
+		return nil, fmt.Errorf("schedule %q is not paused", s.Name)
+	}
+	event := &ScheduleResumedEvent{
+		EventType:  "scheduler_ScheduleResumed",
+		ScheduleID: s.ScheduleID,
+		ResumedAt:  eventsourcing.ISOTimestamp(),
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *SchedulerPlugin) deleteScheduleHandler(input *DeleteScheduleInput) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	s, err := p.schedule(input.ScheduleID)
+	if err != nil {
+		return nil, err
+	}
+	event := &ScheduleDeletedEvent{
+		EventType:  "scheduler_ScheduleDeleted",
+		ScheduleID: s.ScheduleID,
+		Name:       s.Name,
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+// runScheduleHandler records the run of a schedule if it is due, refusing it otherwise so a run is
+// made once even if the check overlaps with another
+func (p *SchedulerPlugin) runScheduleHandler(input *RunScheduleInput, now time.Time) ([]eventsourcing.Event, error) {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	s, err := p.schedule(input.ScheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if next := s.Next(p.aggregate.location); next.IsZero() || next.After(now) {
+		return nil, fmt.Errorf("schedule %q is not due", s.Name)
+	}
+	event := &ScheduleRanEvent{
+		EventType:  "scheduler_ScheduleRan",
+		ScheduleID: s.ScheduleID,
+		RanAt:      now.UTC().Format(time.RFC3339),
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+// RequiresConfirmation asks the user before a schedule is deleted
+func (p *SchedulerPlugin) RequiresConfirmation(command string) bool {
+	return command == "DeleteSchedule"
+}
+
+// SetLocation sets the time zone the schedules run in
+func (p *SchedulerPlugin) SetLocation(loc *time.Location) {
+	p.aggregate.Mu.Lock()
+	defer p.aggregate.Mu.Unlock()
+	p.aggregate.location = loc
+}
+
+// SetCommandFunc gives the plugin the function making the requests of the schedules as its user, and
+// starts checking for schedules that are due
+func (p *SchedulerPlugin) SetCommandFunc(execute eventsourcing.CommandFunc) {
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+	p.execute = execute
+	if p.stopRun == nil {
+		p.stopRun = make(chan struct{})
+		go p.runLoop(p.stopRun)
+	}
+}
+
+// runLoop runs the schedules that are due, checking until stop is closed
+func (p *SchedulerPlugin) runLoop(stop chan struct{}) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			p.runDue(now)
+		}
+	}
+}
+
+// runDue makes the requests of the schedules that are due, returning how many were made. The run is
+// recorded first, so a request that fails is not made again every check.
+func (p *SchedulerPlugin) runDue(now time.Time) int {
+	p.runMu.Lock()
+	execute := p.execute
+	p.runMu.Unlock()
+	if execute == nil {
+		return 0
+	}
+	p.aggregate.Mu.RLock()
+	due := p.aggregate.due(now)
+	p.aggregate.Mu.RUnlock()
+
+	ran := 0
+	for _, s := range due {
+		if err := execute("RunSchedule", &RunScheduleInput{ScheduleID: s.ScheduleID}); err != nil {
+			logging.Error("SCHEDULER: Recording the run of %q failed: %v", s.Name, err)
+			continue
+		}
+		logging.Info("SCHEDULER: Running %q", s.Name)
+		if err := execute("ProcessUserRequest", map[string]interface{}{"requestText": s.Prompt}); err != nil {
+			logging.Error("SCHEDULER: The request of %q failed: %v", s.Name, err)
+			continue
+		}
+		ran++
+	}
+	return ran
+}
+
+// GetCustomUI lists the schedules with their next run
+func (a *SchedulerAggregate) GetCustomUI() fyne.CanvasObject {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+
+	schedules := a.sorted()
+	if len(schedules) == 0 {
+		return widget.NewLabel("No schedules yet. Ask MindPalace to do something every day, like reviewing tomorrow's tasks at 18:00.")
+	}
+	content := container.NewVBox()
+	for _, s := range schedules {
+		title := widget.NewLabel(s.Name)
+		title.TextStyle = fyne.TextStyle{Bold: true}
+		status := "paused"
+		if next := s.Next(a.location); !next.IsZero() {
+			status = "next " + next.Format("Mon Jan 2 15:04")
+		}
+		details := widget.NewLabel(fmt.Sprintf("%s · %s · ran %d times", s.Cron, status, s.Runs))
+		prompt := widget.NewLabel(s.Prompt)
+		prompt.Wrapping = fyne.TextWrapWord
+		content.Add(title)
+		content.Add(details)
+		content.Add(prompt)
+		content.Add(widget.NewSeparator())
+	}
+	return container.NewVScroll(content)
+}
+
+// Additional Plugin Methods
+func (p *SchedulerPlugin) Aggregate() eventsourcing.Aggregate {
+	return p.aggregate
+}
+
+func (p *SchedulerPlugin) Type() eventsourcing.PluginType {
+	return eventsourcing.LLMPlugin
+}
+
+func (p *SchedulerPlugin) SystemPrompt() string {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+
+	now := time.Now().In(p.aggregate.location)
+	schedules := "Current schedules:\n"
+	if len(p.aggregate.Schedules) == 0 {
+		schedules = "There are no schedules yet.\n"
+	}
+	for _, s := range p.aggregate.sorted() {
+		state := "paused"
+		if next := s.Next(p.aggregate.location); !next.IsZero() {
+			state = "next run " + next.Format("Mon Jan 2 15:04")
+		}
+		schedules += fmt.Sprintf("- Schedule ID: %s, Name: \"%s\", Cron: \"%s\", %s, Prompt: \"%s\"\n", s.ScheduleID, s.Name, s.Cron, state, s.Prompt)
+	}
+
+	return `You are Scheduler, a specialized AI for making requests to MindPalace at set times on the user's behalf, like reviewing tomorrow's tasks every evening.
+
+The user input will be a JSON object containing the arguments for the command to execute. Parse the JSON and call the appropriate command with the parsed values.
+
+Your job is to interpret user requests about recurring requests and execute the right commands (CreateSchedule, ListSchedules, PauseSchedule, ResumeSchedule, DeleteSchedule).
+
+It is now ` + now.Format("Monday January 2 2006 15:04 MST") + `, schedules run on this clock.
+` + schedules + `
+When interpreting user requests, pay close attention to the intent:
+- If the user wants something done regularly or at set times, use the CreateSchedule command. Write the Cron expression as minute hour day-of-month month day-of-week: "0 18 * * *" is every day at 18:00, "30 7 * * mon-fri" weekdays at 7:30, "0 9 * * sun" Sundays at 9:00 and "0 8 1 * *" the first of every month at 8:00. Write the Prompt as the user would ask it when the time comes, like "List my tasks due tomorrow and summarize them".
+- If the user asks what is scheduled, use the ListSchedules command.
+- If the user wants a schedule to stop for a while, use the PauseSchedule command, and ResumeSchedule to start it again.
+- If the user wants a schedule gone for good, use the DeleteSchedule command.
+
+Schedules can't run more often than every ` + fmt.Sprintf("%d", int(MinInterval.Minutes())) + ` minutes. The answers to their requests appear in the chat.`
+}
+
+// AgentModel specifies the LLM model to use for this plugin's agent
+func (p *SchedulerPlugin) AgentModel() string {
+	return "gpt-oss:20b"
+}
+
+func (p *SchedulerPlugin) EventHandlers() map[string]eventsourcing.EventHandler {
+	return nil
+}
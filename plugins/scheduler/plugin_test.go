@@ -0,0 +1,146 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+func newSchedulerPlugin(t *testing.T) *SchedulerPlugin {
+	t.Helper()
+	p := NewPlugin().(*SchedulerPlugin)
+	p.SetLocation(time.UTC)
+	return p
+}
+
+func apply(t *testing.T, p *SchedulerPlugin, events []eventsourcing.Event, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	for _, event := range events {
+		if err := p.aggregate.ApplyEvent(event); err != nil {
+			t.Fatalf("ApplyEvent failed: %v", err)
+		}
+	}
+}
+
+func createSchedule(t *testing.T, p *SchedulerPlugin, input *CreateScheduleInput, now time.Time) *Schedule {
+	t.Helper()
+	events, err := p.createScheduleHandler(input, now)
+	apply(t, p, events, err)
+	return p.aggregate.Schedules[events[0].(*ScheduleCreatedEvent).ScheduleID]
+}
+
+func TestSchedulerPlugin_CreateSchedule(t *testing.T) {
+	p := newSchedulerPlugin(t)
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, input := range []*CreateScheduleInput{
+		{Cron: "0 18 * * *", Prompt: " "},
+		{Cron: "every evening", Prompt: "Summarize my tasks"},
+		{Cron: "*/5 * * * *", Prompt: "Summarize my tasks"},
+		{Cron: "0 0 30 2 *", Prompt: "Summarize my tasks"},
+	} {
+		if _, err := p.createScheduleHandler(input, now); err == nil {
+			t.Errorf("Expected %+v refused", input)
+		}
+	}
+
+	s := createSchedule(t, p, &CreateScheduleInput{Cron: "0 18 * * *", Prompt: "List my tasks due tomorrow and summarize them"}, now)
+	if s.Name != s.Prompt {
+		t.Errorf("Expected the prompt as name of an unnamed schedule, got %q", s.Name)
+	}
+	if next := s.Next(time.UTC); !next.Equal(time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the first run this evening, got %v", next)
+	}
+}
+
+func TestSchedulerPlugin_PauseResumeDelete(t *testing.T) {
+	p := newSchedulerPlugin(t)
+	s := createSchedule(t, p, &CreateScheduleInput{Name: "Evening review", Cron: "0 18 * * *", Prompt: "Review my day"}, time.Now().Add(-48*time.Hour))
+
+	events, err := p.pauseScheduleHandler(&PauseScheduleInput{ScheduleID: s.ScheduleID})
+	apply(t, p, events, err)
+	if !s.Next(time.UTC).IsZero() || len(p.aggregate.due(time.Now())) != 0 {
+		t.Error("Expected a paused schedule not to run")
+	}
+	if _, err := p.pauseScheduleHandler(&PauseScheduleInput{ScheduleID: s.ScheduleID}); err == nil {
+		t.Error("Expected pausing twice refused")
+	}
+
+	// The runs missed while paused are not made up for
+	events, err = p.resumeScheduleHandler(&ResumeScheduleInput{ScheduleID: s.ScheduleID})
+	apply(t, p, events, err)
+	if next := s.Next(time.UTC); !next.After(time.Now()) {
+		t.Errorf("Expected the next run after resuming, got %v", next)
+	}
+
+	if !p.RequiresConfirmation("DeleteSchedule") {
+		t.Error("Expected deleting a schedule to require confirmation")
+	}
+	events, err = p.deleteScheduleHandler(&DeleteScheduleInput{ScheduleID: s.ScheduleID})
+	apply(t, p, events, err)
+	if len(p.aggregate.Schedules) != 0 {
+		t.Errorf("Expected the schedule deleted, got %v", p.aggregate.Schedules)
+	}
+	if _, err := p.deleteScheduleHandler(&DeleteScheduleInput{ScheduleID: s.ScheduleID}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected an unknown schedule refused, got %v", err)
+	}
+}
+
+func TestSchedulerPlugin_RunDue(t *testing.T) {
+	p := newSchedulerPlugin(t)
+	created := time.Now().Add(-72 * time.Hour)
+	due := createSchedule(t, p, &CreateScheduleInput{Name: "Daily", Cron: "0 18 * * *", Prompt: "Summarize my tasks"}, created)
+	createSchedule(t, p, &CreateScheduleInput{Name: "Later", Cron: "0 0 1 1 *", Prompt: "Happy new year"}, time.Now())
+
+	var requests []string
+	p.execute = func(command string, input any) error {
+		switch command {
+		case "RunSchedule":
+			events, err := p.runScheduleHandler(input.(*RunScheduleInput), time.Now())
+			if err != nil {
+				return err
+			}
+			apply(t, p, events, nil)
+		case "ProcessUserRequest":
+			requests = append(requests, input.(map[string]interface{})["requestText"].(string))
+		}
+		return nil
+	}
+
+	// Three days of missed runs are made up for once
+	if ran := p.runDue(time.Now()); ran != 1 {
+		t.Fatalf("Expected one run, got %d", ran)
+	}
+	if len(requests) != 1 || requests[0] != "Summarize my tasks" {
+		t.Errorf("Expected the schedule's request made, got %v", requests)
+	}
+	if due.Runs != 1 || !due.Next(time.UTC).After(time.Now()) {
+		t.Errorf("Expected the run recorded and the next one ahead, got %d runs and %v", due.Runs, due.Next(time.UTC))
+	}
+	if ran := p.runDue(time.Now()); ran != 0 {
+		t.Errorf("Expected nothing due right after running, got %d", ran)
+	}
+	if _, err := p.runScheduleHandler(&RunScheduleInput{ScheduleID: due.ScheduleID}, time.Now()); err == nil {
+		t.Error("Expected a schedule that is not due refused")
+	}
+}
+
+func TestSchedulerAggregate_Snapshot(t *testing.T) {
+	p := newSchedulerPlugin(t)
+	s := createSchedule(t, p, &CreateScheduleInput{Name: "Weekly", Cron: "0 9 * * mon", Prompt: "Plan my week"}, time.Now())
+	data, err := p.aggregate.SaveSnapshot()
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	restored := newSchedulerPlugin(t)
+	if err := restored.aggregate.LoadSnapshot(data); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if got := restored.aggregate.Schedules[s.ScheduleID]; got == nil || !got.Next(time.UTC).Equal(s.Next(time.UTC)) {
+		t.Errorf("Expected the schedule restored with its next run, got %+v", got)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"image/color"
+	"strings"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// boardStatuses are the columns of the Kanban board, in order
+var boardStatuses = []string{StatusPending, StatusInProgress, StatusBlocked, StatusCompleted}
+
+// board is the Kanban board of the custom UI. Cards are dragged between its columns, edited in place
+// and added per column; every change is made with a command, so it is stored as an event like any other.
+// Without a command function the board is read-only.
+type board struct {
+	execute eventsourcing.CommandFunc
+	columns []*boardColumn
+}
+
+// boardColumn is the column of the board showing the tasks of a status
+type boardColumn struct {
+	status     string
+	background *canvas.Rectangle // Highlighted while a card is dragged over the column
+	cards      *fyne.Container
+	object     fyne.CanvasObject
+}
+
+// newBoard creates an empty board, add the cards to the cards of its columns
+func newBoard(execute eventsourcing.CommandFunc) *board {
+	b := &board{execute: execute}
+	for _, status := range boardStatuses {
+		b.columns = append(b.columns, b.newColumn(status))
+	}
+	return b
+}
+
+// newColumn creates the column of a status, with a row adding tasks to it at the bottom
+func (b *board) newColumn(status string) *boardColumn {
+	header := widget.NewLabel(status)
+	header.TextStyle = fyne.TextStyle{Bold: true}
+	header.Alignment = fyne.TextAlignCenter
+	cards := container.NewVBox()
+	scroll := container.NewVScroll(cards)
+	scroll.SetMinSize(fyne.NewSize(250, 400))
+	var add fyne.CanvasObject
+	if b.execute != nil {
+		entry := widget.NewEntry()
+		entry.SetPlaceHolder("Add a task")
+		entry.OnSubmitted = func(text string) {
+			if title := strings.TrimSpace(text); title != "" {
+				b.issue("CreateTask", &CreateTaskInput{Title: title, Status: status})
+				entry.SetText("")
+			}
+		}
+		add = entry
+	}
+	column := &boardColumn{status: status, background: canvas.NewRectangle(color.Transparent), cards: cards}
+	column.object = container.NewStack(column.background,
+		container.NewBorder(container.NewPadded(header), add, nil, nil, scroll))
+	return column
+}
+
+// column returns the column of a status, nil if the board has none
+func (b *board) column(status string) *boardColumn {
+	for _, column := range b.columns {
+		if column.status == status {
+			return column
+		}
+	}
+	return nil
+}
+
+// columnAt returns the status of the column at an absolute position, empty if there is none
+func (b *board) columnAt(position fyne.Position) string {
+	driver := fyne.CurrentApp().Driver()
+	for _, column := range b.columns {
+		topLeft := driver.AbsolutePositionForObject(column.object)
+		size := column.object.Size()
+		if position.X >= topLeft.X && position.X < topLeft.X+size.Width &&
+			position.Y >= topLeft.Y && position.Y < topLeft.Y+size.Height {
+			return column.status
+		}
+	}
+	return ""
+}
+
+// highlight shows which column a card is dropped in, none if the status is empty
+func (b *board) highlight(status string) {
+	for _, column := range b.columns {
+		var fill color.Color = color.Transparent
+		if column.status == status {
+			fill = theme.Color(theme.ColorNameHover)
+		}
+		if column.background.FillColor != fill {
+			column.background.FillColor = fill
+			column.background.Refresh()
+		}
+	}
+}
+
+// issue executes a command off the UI's goroutine; the board is rendered again once its events are applied
+func (b *board) issue(command string, input any) {
+	if b.execute == nil {
+		return
+	}
+	eventsourcing.SafeGo(command, nil, func() {
+		if err := b.execute(command, input); err != nil {
+			logging.Error("Failed to %s from the task board: %v", command, err)
+		}
+	})
+}
+
+// moveCommand returns the command moving a task to the column of a status, completing it when moved to
+// Completed as clicking it in the 3D world does; empty if the task is in that column already
+func moveCommand(task Task, status string) (string, any) {
+	switch {
+	case status == "" || status == task.Status:
+		return "", nil
+	case status == StatusCompleted:
+		return "CompleteTask", &CompleteTaskInput{TaskID: task.TaskID}
+	default:
+		return "UpdateTask", &UpdateTaskInput{TaskID: task.TaskID, Status: status}
+	}
+}
+
+// editInput returns the update of a task edited on its card, nil if nothing changed. Texts can be changed
+// but not cleared, as UpdateTask leaves out empty fields.
+func editInput(task Task, title, description, priority string) *UpdateTaskInput {
+	input := &UpdateTaskInput{TaskID: task.TaskID}
+	changed := false
+	if title = strings.TrimSpace(title); title != "" && title != task.Title {
+		input.Title, changed = title, true
+	}
+	if description = strings.TrimSpace(description); description != "" && description != task.Description {
+		input.Description, changed = description, true
+	}
+	if priority != "" && priority != task.Priority {
+		input.Priority, changed = priority, true
+	}
+	if !changed {
+		return nil
+	}
+	return input
+}
+
+// taskCard is a task on the board, dragged to another column to change its status and double-clicked
+// to edit its title, description and priority
+type taskCard struct {
+	widget.BaseWidget
+	board   *board
+	task    Task // Copy of the task, the card outlives the aggregate's lock
+	view    fyne.CanvasObject
+	content *fyne.Container // Shows the view, or the form while editing
+	target  string          // Status of the column the card is dragged over
+}
+
+// newTaskCard creates the card of a task showing the view
+func newTaskCard(b *board, task Task, view fyne.CanvasObject) *taskCard {
+	card := &taskCard{board: b, task: task, view: view, content: container.NewStack(view)}
+	card.ExtendBaseWidget(card)
+	return card
+}
+
+func (c *taskCard) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(c.content)
+}
+
+// Dragged highlights the column the card would be dropped in
+func (c *taskCard) Dragged(event *fyne.DragEvent) {
+	if c.board.execute == nil {
+		return
+	}
+	c.target = c.board.columnAt(event.AbsolutePosition)
+	c.board.highlight(c.target)
+}
+
+// DragEnd moves the task to the column the card was dropped in
+func (c *taskCard) DragEnd() {
+	target := c.target
+	c.target = ""
+	c.board.highlight("")
+	if command, input := moveCommand(c.task, target); command != "" {
+		c.board.issue(command, input)
+	}
+}
+
+// DoubleTapped edits the task on the card
+func (c *taskCard) DoubleTapped(*fyne.PointEvent) {
+	if c.board.execute != nil {
+		c.edit()
+	}
+}
+
+// edit replaces the view with a form updating the task when saved
+func (c *taskCard) edit() {
+	title := widget.NewEntry()
+	title.SetText(c.task.Title)
+	description := widget.NewMultiLineEntry()
+	description.SetText(c.task.Description)
+	description.SetPlaceHolder("Description")
+	description.Wrapping = fyne.TextWrapWord
+	priority := widget.NewSelect([]string{PriorityLow, PriorityMedium, PriorityHigh, PriorityCritical}, nil)
+	priority.SetSelected(c.task.Priority)
+	done := func() {
+		c.content.Objects = []fyne.CanvasObject{c.view}
+		c.content.Refresh()
+	}
+	save := func() {
+		if input := editInput(c.task, title.Text, description.Text, priority.Selected); input != nil {
+			c.board.issue("UpdateTask", input)
+		}
+		done()
+	}
+	title.OnSubmitted = func(string) { save() }
+	saveButton := widget.NewButtonWithIcon("Save", theme.ConfirmIcon(), save)
+	saveButton.Importance = widget.HighImportance
+	form := container.NewVBox(title, description, priority,
+		container.NewHBox(saveButton, widget.NewButtonWithIcon("Cancel", theme.CancelIcon(), done)))
+	c.content.Objects = []fyne.CanvasObject{form}
+	c.content.Refresh()
+	if shown := fyne.CurrentApp().Driver().CanvasForObject(c); shown != nil {
+		shown.Focus(title)
+	}
+}
+
+// SetCommandFunc lets the task board change tasks with the plugin's commands
+func (p *TaskPlugin) SetCommandFunc(execute eventsourcing.CommandFunc) {
+	p.aggregate.Mu.Lock()
+	p.aggregate.execute = execute
+	p.aggregate.Mu.Unlock()
+}
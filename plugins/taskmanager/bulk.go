@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// TasksBulkChangedEvent holds the changes of a bulk command, one event for all tasks it changed. The
+// changes are the events the single task commands record, so they are applied, undone and shown alike.
+type TasksBulkChangedEvent struct {
+	eventsourcing.EventMetadata
+	EventType   string                `json:"event_type"`
+	Command     string                `json:"command"` // Bulk command that made the changes
+	Filter      string                `json:"filter"`  // Filters the tasks were selected with, as the user reads them
+	Updates     []*TaskUpdatedEvent   `json:"updates,omitempty"`
+	Completions []*TaskCompletedEvent `json:"completions,omitempty"`
+	Deletions   []*TaskDeletedEvent   `json:"deletions,omitempty"`
+}
+
+func (e *TasksBulkChangedEvent) Type() string { return "taskmanager_TasksBulkChanged" }
+func (e *TasksBulkChangedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *TasksBulkChangedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// changes returns the single task events of the bulk change, in the order they are applied
+func (e *TasksBulkChangedEvent) changes() []eventsourcing.Event {
+	var changes []eventsourcing.Event
+	for _, update := range e.Updates {
+		changes = append(changes, update)
+	}
+	for _, completion := range e.Completions {
+		changes = append(changes, completion)
+	}
+	for _, deletion := range e.Deletions {
+		changes = append(changes, deletion)
+	}
+	return changes
+}
+
+// TaskFilter selects the tasks a bulk command changes: those matching every filter given
+type TaskFilter struct {
+	FilterStatus string `json:"FilterStatus,omitempty"`
+	FilterTag    string `json:"FilterTag,omitempty"`
+	DueFrom      string `json:"DueFrom,omitempty"`
+	DueUntil     string `json:"DueUntil,omitempty"`
+}
+
+// filterProperties are the schema properties of the filters of a bulk command
+func filterProperties() map[string]interface{} {
+	return map[string]interface{}{
+		"FilterStatus": map[string]interface{}{
+			"type":        "string",
+			"description": "Only tasks with this status",
+			"enum":        []string{StatusPending, StatusInProgress, StatusCompleted, StatusBlocked},
+		},
+		"FilterTag": map[string]interface{}{
+			"type":        "string",
+			"description": "Only tasks with this tag",
+		},
+		"DueFrom": map[string]interface{}{
+			"type":        "string",
+			"description": "Only tasks with a deadline from then, ISO 8601 or as the user said it, e.g. \"monday\"",
+		},
+		"DueUntil": map[string]interface{}{
+			"type":        "string",
+			"description": "Only tasks with a deadline until then, ISO 8601 or as the user said it; \"now\" for overdue tasks",
+		},
+	}
+}
+
+func (i *BulkUpdateTasksInput) New() any {
+	return &BulkUpdateTasksInput{}
+}
+
+// BulkUpdateTasksInput defines the input for updating all tasks matching filters
+type BulkUpdateTasksInput struct {
+	TaskFilter
+	Status   string `json:"Status,omitempty"`
+	Priority string `json:"Priority,omitempty"`
+	Deadline string `json:"Deadline,omitempty"`
+}
+
+func (b *BulkUpdateTasksInput) Schema() map[string]interface{} {
+	properties := filterProperties()
+	properties["Status"] = map[string]interface{}{
+		"type":        "string",
+		"description": "New status of the tasks",
+		"enum":        []string{StatusPending, StatusInProgress, StatusCompleted, StatusBlocked},
+	}
+	properties["Priority"] = map[string]interface{}{
+		"type":        "string",
+		"description": "New priority of the tasks",
+		"enum":        []string{PriorityLow, PriorityMedium, PriorityHigh, PriorityCritical},
+	}
+	properties["Deadline"] = map[string]interface{}{
+		"type":        "string",
+		"description": "New deadline of the tasks, ISO 8601 or as the user said it, e.g. \"friday at 5pm\"",
+	}
+	return map[string]interface{}{
+		"description": "Updates the status, priority or deadline of all tasks matching the filters at once; give at least one filter",
+		"parameters": map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+		},
+	}
+}
+
+func (i *BulkCompleteTasksInput) New() any {
+	return &BulkCompleteTasksInput{}
+}
+
+// BulkCompleteTasksInput defines the input for completing all open tasks matching filters
+type BulkCompleteTasksInput struct {
+	TaskFilter
+	CompletionNotes string `json:"CompletionNotes,omitempty"`
+}
+
+func (b *BulkCompleteTasksInput) Schema() map[string]interface{} {
+	properties := filterProperties()
+	properties["CompletionNotes"] = map[string]interface{}{
+		"type":        "string",
+		"description": "Notes about completion, for every task",
+	}
+	return map[string]interface{}{
+		"description": "Marks all open tasks matching the filters as completed at once; give at least one filter",
+		"parameters": map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+		},
+	}
+}
+
+func (i *BulkDeleteTasksInput) New() any {
+	return &BulkDeleteTasksInput{}
+}
+
+// BulkDeleteTasksInput defines the input for deleting all tasks matching filters
+type BulkDeleteTasksInput struct {
+	TaskFilter
+}
+
+func (b *BulkDeleteTasksInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Deletes all tasks matching the filters at once; give at least one filter",
+		"parameters": map[string]interface{}{
+			"type":       "object",
+			"properties": filterProperties(),
+		},
+	}
+}
+
+// matchingTasks returns copies of the tasks matching the filter in the order they were created, with the
+// filter as the user reads it. A filter is required and has to match a task, so a bulk command never
+// changes every task by mistake or records an empty change.
+func (p *TaskPlugin) matchingTasks(filter TaskFilter) ([]Task, string, error) {
+	var from, until time.Time
+	var described []string
+	if filter.FilterStatus != "" {
+		if !validateStatus(filter.FilterStatus) {
+			return nil, "", fmt.Errorf("invalid status: %s", filter.FilterStatus)
+		}
+		described = append(described, "status "+filter.FilterStatus)
+	}
+	tag := filter.FilterTag
+	if tag != "" {
+		tags, err := p.normalizeTags([]string{tag})
+		if err != nil {
+			return nil, "", err
+		}
+		if len(tags) > 0 {
+			tag = tags[0]
+		}
+		described = append(described, "tag "+tag)
+	}
+	if filter.DueFrom != "" {
+		parsed, err := p.parseDeadline(filter.DueFrom)
+		if err != nil {
+			return nil, "", err
+		}
+		from = parseTime(parsed)
+		described = append(described, "due from "+parsed)
+	}
+	if filter.DueUntil != "" {
+		parsed, err := p.parseDeadline(filter.DueUntil)
+		if err != nil {
+			return nil, "", err
+		}
+		until = parseTime(parsed)
+		described = append(described, "due until "+parsed)
+	}
+	if len(described) == 0 {
+		return nil, "", fmt.Errorf("at least one filter is required: FilterStatus, FilterTag, DueFrom or DueUntil")
+	}
+
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	var tasks []Task
+	for _, id := range p.aggregate.getSortedTaskIDs() {
+		task := p.aggregate.Tasks[id]
+		if (filter.FilterStatus != "" && task.Status != filter.FilterStatus) ||
+			(tag != "" && !contains(task.Tags, tag)) ||
+			((!from.IsZero() || !until.IsZero()) && task.Deadline.IsZero()) ||
+			(!from.IsZero() && task.Deadline.Before(from)) ||
+			(!until.IsZero() && task.Deadline.After(until)) {
+			continue
+		}
+		tasks = append(tasks, *task)
+	}
+	description := strings.Join(described, ", ")
+	if len(tasks) == 0 {
+		return nil, "", fmt.Errorf("no tasks match %s", description)
+	}
+	return tasks, description, nil
+}
+
+func (p *TaskPlugin) bulkUpdateTasksHandler(input *BulkUpdateTasksInput) ([]eventsourcing.Event, error) {
+	if input.Status == "" && input.Priority == "" && input.Deadline == "" {
+		return nil, fmt.Errorf("nothing to update: give a Status, Priority or Deadline")
+	}
+	if input.Status != "" && !validateStatus(input.Status) {
+		return nil, fmt.Errorf("invalid status: %s", input.Status)
+	}
+	if input.Priority != "" && !validatePriority(input.Priority) {
+		return nil, fmt.Errorf("invalid priority: %s", input.Priority)
+	}
+	deadline := input.Deadline
+	if deadline != "" {
+		parsed, err := p.parseDeadline(deadline)
+		if err != nil {
+			return nil, err
+		}
+		deadline = parsed
+	}
+	tasks, filter, err := p.matchingTasks(input.TaskFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &TasksBulkChangedEvent{EventType: "taskmanager_TasksBulkChanged", Command: "BulkUpdateTasks", Filter: filter}
+	for i := range tasks {
+		event.Updates = append(event.Updates, &TaskUpdatedEvent{
+			EventType: "taskmanager_TaskUpdated",
+			TaskID:    tasks[i].TaskID,
+			Status:    input.Status,
+			Priority:  input.Priority,
+			Deadline:  deadline,
+			Previous:  &tasks[i],
+		})
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *TaskPlugin) bulkCompleteTasksHandler(input *BulkCompleteTasksInput) ([]eventsourcing.Event, error) {
+	tasks, filter, err := p.matchingTasks(input.TaskFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	completed := make(map[string]bool, len(tasks))
+	var open []Task
+	for _, task := range tasks {
+		if task.Status != StatusCompleted {
+			open = append(open, task)
+			completed[task.TaskID] = true
+		}
+	}
+	if len(open) == 0 {
+		return nil, fmt.Errorf("the tasks matching %s are already completed", filter)
+	}
+	event := &TasksBulkChangedEvent{EventType: "taskmanager_TasksBulkChanged", Command: "BulkCompleteTasks", Filter: filter}
+	for _, task := range open {
+		event.Completions = append(event.Completions, &TaskCompletedEvent{
+			EventType:       "taskmanager_TaskCompleted",
+			TaskID:          task.TaskID,
+			CompletedAt:     now.Format(time.RFC3339),
+			CompletionNotes: input.CompletionNotes,
+			PreviousStatus:  task.Status,
+		})
+	}
+	for _, task := range open {
+		for _, rolledUp := range p.rollUpCompletion(task.TaskID, now, completed) {
+			event.Completions = append(event.Completions, rolledUp.(*TaskCompletedEvent))
+		}
+	}
+	return []eventsourcing.Event{event}, nil
+}
+
+func (p *TaskPlugin) bulkDeleteTasksHandler(input *BulkDeleteTasksInput) ([]eventsourcing.Event, error) {
+	tasks, filter, err := p.matchingTasks(input.TaskFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	event := &TasksBulkChangedEvent{EventType: "taskmanager_TasksBulkChanged", Command: "BulkDeleteTasks", Filter: filter}
+	for i := range tasks {
+		event.Deletions = append(event.Deletions, &TaskDeletedEvent{
+			EventType:  "taskmanager_TaskDeleted",
+			TaskID:     tasks[i].TaskID,
+			Task:       &tasks[i],
+			SubtaskIDs: p.aggregate.subtaskIDs(tasks[i].TaskID),
+		})
+	}
+	return []eventsourcing.Event{event}, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// githubPageSize is the number of issues fetched per request, the most GitHub allows
+const githubPageSize = 100
+
+// GitHubTracker syncs tasks with the issues of a GitHub repository. Priorities are kept as
+// "priority: high" labels and the In Progress and Blocked statuses as "in progress" and "blocked" labels.
+type GitHubTracker struct {
+	Repo    string // owner/repo
+	Token   string
+	BaseURL string // Defaults to https://api.github.com
+	HTTP    *http.Client
+}
+
+type githubIssue struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	State   string `json:"state"`
+	Labels  []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	PullRequest json.RawMessage `json:"pull_request,omitempty"`
+}
+
+// Name returns "github"
+func (g *GitHubTracker) Name() string {
+	return "github"
+}
+
+// List returns the open and closed issues of the repository, leaving out pull requests
+func (g *GitHubTracker) List(ctx context.Context) ([]ExternalTask, error) {
+	var tasks []ExternalTask
+	for page := 1; ; page++ {
+		var issues []githubIssue
+		path := fmt.Sprintf("/repos/%s/issues?state=all&per_page=%d&page=%d", g.Repo, githubPageSize, page)
+		if err := g.do(ctx, http.MethodGet, path, nil, &issues); err != nil {
+			return nil, err
+		}
+		for _, issue := range issues {
+			if len(issue.PullRequest) == 0 {
+				tasks = append(tasks, issue.task())
+			}
+		}
+		if len(issues) < githubPageSize {
+			return tasks, nil
+		}
+	}
+}
+
+// Create opens an issue for the task
+func (g *GitHubTracker) Create(ctx context.Context, task ExternalTask) (ExternalTask, error) {
+	var issue githubIssue
+	if err := g.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/issues", g.Repo), githubRequest(task), &issue); err != nil {
+		return task, err
+	}
+	return issue.task(), nil
+}
+
+// Update edits the issue, closing it when the task is completed
+func (g *GitHubTracker) Update(ctx context.Context, task ExternalTask) (ExternalTask, error) {
+	request := githubRequest(task)
+	request["state"] = "open"
+	if task.Status == StatusCompleted {
+		request["state"] = "closed"
+	}
+	var issue githubIssue
+	if err := g.do(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/issues/%s", g.Repo, task.ID), request, &issue); err != nil {
+		return task, err
+	}
+	return issue.task(), nil
+}
+
+// task maps the issue to a task
+func (i githubIssue) task() ExternalTask {
+	labels := make([]string, 0, len(i.Labels))
+	priority := PriorityMedium
+	for _, label := range i.Labels {
+		if name, isPriority := strings.CutPrefix(strings.ToLower(label.Name), "priority: "); isPriority && matchPriority(name) != "" {
+			priority = matchPriority(name)
+			continue
+		}
+		labels = append(labels, label.Name)
+	}
+	status, tags := statusFromLabels(labels)
+	if i.State == "closed" {
+		status = StatusCompleted
+	}
+	return ExternalTask{
+		ID:          strconv.Itoa(i.Number),
+		URL:         i.HTMLURL,
+		Title:       i.Title,
+		Description: i.Body,
+		Status:      status,
+		Priority:    priority,
+		Tags:        tags,
+	}
+}
+
+// githubRequest returns the fields of an issue for the task
+func githubRequest(task ExternalTask) map[string]interface{} {
+	labels := statusLabels(task)
+	if task.Priority != "" {
+		labels = append(labels, "priority: "+strings.ToLower(task.Priority))
+	}
+	return map[string]interface{}{
+		"title":  task.Title,
+		"body":   task.Description,
+		"labels": labels,
+	}
+}
+
+func (g *GitHubTracker) do(ctx context.Context, method, path string, request, response interface{}) error {
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %v", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	baseURL := g.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.github.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(baseURL, "/")+path, body)
+	if err != nil {
+		return fmt.Errorf("invalid GitHub request: %v", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+	resp, err := trackerClient(g.HTTP).Do(req)
+	if err != nil {
+		return fmt.Errorf("GitHub request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("GitHub %s %s failed: %s %s", method, path, resp.Status, strings.TrimSpace(string(message)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode GitHub response: %v", err)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"sort"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/nltime"
 	"mindpalace/pkg/ui3d"
 
 	"fyne.io/fyne/v2"
@@ -44,12 +46,17 @@ type Task struct {
 	CompletedAt     time.Time `json:"completed_at,omitempty"`
 	CompletionNotes string    `json:"completion_notes,omitempty"`
 	CreatedAt       time.Time `json:"created_at"`
+	ParentTaskID    string    `json:"parent_task_id,omitempty"`
+	FocusSeconds    int       `json:"focus_seconds,omitempty"` // Time spent in focus sessions on the task
 }
 
 // TaskAggregate manages the state of tasks with thread safety
 type TaskAggregate struct {
 	Tasks    map[string]*Task
+	Links    map[string]*TrackerLink // Copies of tasks in issue trackers, by task ID
 	commands map[string]eventsourcing.CommandHandler
+	execute  eventsourcing.CommandFunc // Changes tasks from the board, nil until provided
+	links    eventsourcing.LinkSource  // Items of other plugins linked to tasks, nil until provided
 	Mu       sync.RWMutex
 }
 
@@ -57,6 +64,7 @@ type TaskAggregate struct {
 func NewTaskAggregate() *TaskAggregate {
 	return &TaskAggregate{
 		Tasks:    make(map[string]*Task),
+		Links:    make(map[string]*TrackerLink),
 		commands: make(map[string]eventsourcing.CommandHandler),
 	}
 }
@@ -66,11 +74,281 @@ func (a *TaskAggregate) ID() string {
 	return "taskmanager"
 }
 
+// taskSnapshot is the state saved in a snapshot
+type taskSnapshot struct {
+	Tasks map[string]*Task        `json:"tasks"`
+	Links map[string]*TrackerLink `json:"links,omitempty"`
+}
+
+// SaveSnapshot serializes the current tasks so they can be restored without a full replay
+func (a *TaskAggregate) SaveSnapshot() ([]byte, error) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	return json.Marshal(taskSnapshot{Tasks: a.Tasks, Links: a.Links})
+}
+
+// LoadSnapshot replaces the current tasks with those from a snapshot
+func (a *TaskAggregate) LoadSnapshot(data []byte) error {
+	var snapshot taskSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to unmarshal snapshot: %v", err)
+	}
+	if snapshot.Tasks == nil {
+		// Snapshots taken before issue tracker support hold just the tasks
+		if err := json.Unmarshal(data, &snapshot.Tasks); err != nil {
+			return fmt.Errorf("failed to unmarshal snapshot: %v", err)
+		}
+	}
+	if snapshot.Links == nil {
+		snapshot.Links = make(map[string]*TrackerLink)
+	}
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	a.Tasks = snapshot.Tasks
+	a.Links = snapshot.Links
+	return nil
+}
+
+// Deadlines returns the deadlines of all tasks that are not completed yet
+func (a *TaskAggregate) Deadlines() []eventsourcing.Deadline {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	var deadlines []eventsourcing.Deadline
+	for _, task := range a.Tasks {
+		if task.Deadline.IsZero() || task.Status == StatusCompleted {
+			continue
+		}
+		deadlines = append(deadlines, eventsourcing.Deadline{
+			ID:     task.TaskID,
+			Title:  task.Title,
+			Due:    task.Deadline,
+			NodeID: task.TaskID,
+		})
+	}
+	return deadlines
+}
+
+// BriefingItems returns the tasks that are not completed and due by the end of the day, overdue ones
+// first, and the tasks in progress
+func (a *TaskAggregate) BriefingItems(day time.Time) []eventsourcing.BriefingItem {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	end := day.AddDate(0, 0, 1)
+	var due, inProgress []eventsourcing.BriefingItem
+	for _, id := range a.getSortedTaskIDs() {
+		task := a.Tasks[id]
+		if task.Status == StatusCompleted {
+			continue
+		}
+		title := task.Title
+		if task.Priority != "" {
+			title += fmt.Sprintf(", %s priority", strings.ToLower(task.Priority))
+		}
+		switch {
+		case !task.Deadline.IsZero() && task.Deadline.Before(day):
+			due = append(due, eventsourcing.BriefingItem{Section: "Tasks", Time: task.Deadline,
+				Text: fmt.Sprintf("%s, overdue since %s", title, task.Deadline.In(day.Location()).Format("Mon Jan 2"))})
+		case !task.Deadline.IsZero() && task.Deadline.Before(end):
+			due = append(due, eventsourcing.BriefingItem{Section: "Tasks", Time: task.Deadline,
+				Text: fmt.Sprintf("%s, due at %s", title, task.Deadline.In(day.Location()).Format("15:04"))})
+		case task.Status == StatusInProgress:
+			inProgress = append(inProgress, eventsourcing.BriefingItem{Section: "Tasks", Text: title + ", in progress"})
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].Time.Before(due[j].Time) })
+	return append(due, inProgress...)
+}
+
+// QueryState returns copies of all tasks in the order they were created, for questions about tasks
+// together with other plugins' state
+func (a *TaskAggregate) QueryState() any {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	tasks := []Task{}
+	for _, id := range a.getSortedTaskIDs() {
+		tasks = append(tasks, *a.Tasks[id])
+	}
+	return tasks
+}
+
+// TaggedItems returns the tasks with tags, for listing everything with a tag
+func (a *TaskAggregate) TaggedItems() []eventsourcing.TaggedItem {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	var items []eventsourcing.TaggedItem
+	for _, id := range a.getSortedTaskIDs() {
+		task := a.Tasks[id]
+		if len(task.Tags) == 0 {
+			continue
+		}
+		items = append(items, eventsourcing.TaggedItem{
+			Aggregate: a.ID(),
+			ID:        task.TaskID,
+			Title:     task.Title,
+			Due:       task.Deadline,
+			Tags:      append([]string(nil), task.Tags...),
+		})
+	}
+	return items
+}
+
+// Item returns a task, for linking it to the items of other plugins
+func (a *TaskAggregate) Item(id string) (eventsourcing.Item, bool) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	task, exists := a.Tasks[id]
+	if !exists {
+		return eventsourcing.Item{}, false
+	}
+	return eventsourcing.Item{Aggregate: a.ID(), ID: task.TaskID, Title: task.Title, NodeID: task.TaskID}, true
+}
+
+// linkedItems returns the items of other plugins linked to a task (caller holds the lock)
+func (a *TaskAggregate) linkedItems(taskID string) []eventsourcing.Item {
+	if a.links == nil {
+		return nil
+	}
+	return a.links.LinkedItems(a.ID(), taskID)
+}
+
+// Compensate returns the events undoing a task event, using the task data recorded on the event
+func (a *TaskAggregate) Compensate(event eventsourcing.Event) ([]eventsourcing.Event, error) {
+	switch e := event.(type) {
+	case *TaskCreatedEvent:
+		return []eventsourcing.Event{&TaskDeletedEvent{EventType: "taskmanager_TaskDeleted", TaskID: e.TaskID}}, nil
+	case *TaskDeletedEvent:
+		if e.Task == nil {
+			return nil, fmt.Errorf("deletion of task %s did not record the task and cannot be undone", e.TaskID)
+		}
+		events := []eventsourcing.Event{&TaskCreatedEvent{
+			EventType:    "taskmanager_TaskCreated",
+			TaskID:       e.Task.TaskID,
+			Title:        e.Task.Title,
+			Description:  e.Task.Description,
+			Status:       e.Task.Status,
+			Priority:     e.Task.Priority,
+			Deadline:     formatTime(e.Task.Deadline),
+			Dependencies: e.Task.Dependencies,
+			Tags:         e.Task.Tags,
+			ParentTaskID: e.Task.ParentTaskID,
+		}}
+		if e.Task.Status == StatusCompleted {
+			events = append(events, &TaskCompletedEvent{
+				EventType:       "taskmanager_TaskCompleted",
+				TaskID:          e.Task.TaskID,
+				CompletedAt:     formatTime(e.Task.CompletedAt),
+				CompletionNotes: e.Task.CompletionNotes,
+			})
+		}
+		// Move the subtasks back under the restored task
+		for _, subtaskID := range e.SubtaskIDs {
+			events = append(events, &TaskMovedEvent{
+				EventType:            "taskmanager_TaskMoved",
+				TaskID:               subtaskID,
+				ParentTaskID:         e.TaskID,
+				PreviousParentTaskID: e.Task.ParentTaskID,
+			})
+		}
+		return events, nil
+	case *TaskUpdatedEvent:
+		if e.Previous == nil {
+			return nil, fmt.Errorf("update of task %s did not record the previous task and cannot be undone", e.TaskID)
+		}
+		return []eventsourcing.Event{&TaskUpdatedEvent{
+			EventType:    "taskmanager_TaskUpdated",
+			TaskID:       e.TaskID,
+			Title:        e.Previous.Title,
+			Description:  e.Previous.Description,
+			Status:       e.Previous.Status,
+			Priority:     e.Previous.Priority,
+			Deadline:     formatTime(e.Previous.Deadline),
+			Dependencies: e.Previous.Dependencies,
+			Tags:         e.Previous.Tags,
+		}}, nil
+	case *TaskCompletedEvent:
+		status := e.PreviousStatus
+		if status == "" {
+			status = StatusPending
+		}
+		return []eventsourcing.Event{&TaskUpdatedEvent{EventType: "taskmanager_TaskUpdated", TaskID: e.TaskID, Status: status}}, nil
+	case *TaskMovedEvent:
+		return []eventsourcing.Event{&TaskMovedEvent{
+			EventType:            "taskmanager_TaskMoved",
+			TaskID:               e.TaskID,
+			ParentTaskID:         e.PreviousParentTaskID,
+			PreviousParentTaskID: e.ParentTaskID,
+		}}, nil
+	case *TasksBulkChangedEvent:
+		// Undone in reverse, so deleted subtasks are restored before they are moved back under their parent
+		changes := e.changes()
+		var events []eventsourcing.Event
+		for i := len(changes) - 1; i >= 0; i-- {
+			compensations, err := a.Compensate(changes[i])
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, compensations...)
+		}
+		return events, nil
+	}
+	return nil, nil
+}
+
+// Conflicts reports whether the events change a task that was changed concurrently. Changes of
+// different tasks are merged.
+func (a *TaskAggregate) Conflicts(events, concurrent []eventsourcing.Event) bool {
+	changed := make(map[string]bool)
+	for _, event := range concurrent {
+		for _, taskID := range changedTasks(event) {
+			changed[taskID] = taskID != ""
+		}
+	}
+	for _, event := range events {
+		for _, taskID := range changedTasks(event) {
+			if changed[taskID] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// changedTasks returns the IDs of the tasks an event changes, including the parents it moves tasks under
+func changedTasks(event eventsourcing.Event) []string {
+	switch e := event.(type) {
+	case *TaskCreatedEvent:
+		return []string{e.TaskID, e.ParentTaskID}
+	case *TaskUpdatedEvent:
+		return []string{e.TaskID}
+	case *TaskCompletedEvent:
+		return []string{e.TaskID}
+	case *TaskDeletedEvent:
+		return append([]string{e.TaskID}, e.SubtaskIDs...)
+	case *TaskMovedEvent:
+		return []string{e.TaskID, e.ParentTaskID}
+	case *TaskLinkedEvent:
+		return []string{e.TaskID}
+	case *TaskUnlinkedEvent:
+		return []string{e.TaskID}
+	case *TasksBulkChangedEvent:
+		var taskIDs []string
+		for _, change := range e.changes() {
+			taskIDs = append(taskIDs, changedTasks(change)...)
+		}
+		return taskIDs
+	}
+	return nil
+}
+
 // ApplyEvent updates the aggregate state based on task-related events
 func (a *TaskAggregate) ApplyEvent(event eventsourcing.Event) error {
 	a.Mu.Lock()
 	defer a.Mu.Unlock()
+	return a.apply(event)
+}
 
+// apply updates the state with an event, the caller holds the lock
+func (a *TaskAggregate) apply(event eventsourcing.Event) error {
 	data, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event %s: %v", event.Type(), err)
@@ -92,6 +370,7 @@ func (a *TaskAggregate) ApplyEvent(event eventsourcing.Event) error {
 			Dependencies: e.Dependencies,
 			Tags:         e.Tags,
 			CreatedAt:    time.Now().UTC(),
+			ParentTaskID: e.ParentTaskID,
 		}
 
 	case "taskmanager_TaskUpdated":
@@ -121,6 +400,7 @@ func (a *TaskAggregate) ApplyEvent(event eventsourcing.Event) error {
 			if e.Tags != nil {
 				task.Tags = e.Tags
 			}
+			a.markDirty(e.TaskID)
 		}
 
 	case "taskmanager_TaskCompleted":
@@ -132,6 +412,7 @@ func (a *TaskAggregate) ApplyEvent(event eventsourcing.Event) error {
 			task.Status = StatusCompleted
 			task.CompletedAt = parseTime(e.CompletedAt)
 			task.CompletionNotes = e.CompletionNotes
+			a.markDirty(e.TaskID)
 		}
 
 	case "taskmanager_TaskDeleted":
@@ -139,7 +420,48 @@ func (a *TaskAggregate) ApplyEvent(event eventsourcing.Event) error {
 		if err := json.Unmarshal(data, &e); err != nil {
 			return fmt.Errorf("failed to unmarshal TaskDeleted: %v", err)
 		}
+		// Subtasks of a deleted task move up to its parent
+		if task, exists := a.Tasks[e.TaskID]; exists {
+			for _, child := range a.Tasks {
+				if child.ParentTaskID == e.TaskID {
+					child.ParentTaskID = task.ParentTaskID
+				}
+			}
+		}
 		delete(a.Tasks, e.TaskID)
+		delete(a.Links, e.TaskID)
+
+	case "taskmanager_TaskMoved":
+		var e TaskMovedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal TaskMoved: %v", err)
+		}
+		if task, exists := a.Tasks[e.TaskID]; exists {
+			task.ParentTaskID = e.ParentTaskID
+		}
+
+	case "taskmanager_TaskLinked", "taskmanager_TaskUnlinked":
+		return a.applyTrackerEvent(event.Type(), data)
+
+	case "taskmanager_TasksBulkChanged":
+		var e TasksBulkChangedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal TasksBulkChanged: %v", err)
+		}
+		for _, change := range e.changes() {
+			if err := a.apply(change); err != nil {
+				return err
+			}
+		}
+
+	case "focus_SessionEnded":
+		var e focusSessionEnded
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal SessionEnded: %v", err)
+		}
+		if task, exists := a.Tasks[e.TaskID]; exists {
+			task.FocusSeconds += e.FocusedSeconds
+		}
 
 	default:
 		return nil
@@ -147,9 +469,23 @@ func (a *TaskAggregate) ApplyEvent(event eventsourcing.Event) error {
 	return nil
 }
 
+// focusSessionEnded holds the fields of the focus plugin's SessionEnded event that add to a task's focus time
+type focusSessionEnded struct {
+	TaskID         string `json:"task_id"`
+	FocusedSeconds int    `json:"focused_seconds"`
+}
+
 // TaskPlugin implements the plugin interface
 type TaskPlugin struct {
-	aggregate *TaskAggregate
+	aggregate       *TaskAggregate
+	mu              sync.RWMutex
+	defaultPriority string                      // Priority of new tasks that don't name one, set from the configuration
+	trackers        map[string]Tracker          // Issue trackers to sync with, set from the configuration
+	syncMu          sync.Mutex                  // Held during a sync
+	readModels      *sql.DB                     // Database of the read models, nil until provided
+	userID          string                      // User whose rows of the read models the plugin reads
+	location        *time.Location              // Time zone of the user, deadlines without one are in it
+	tagNormalizer   eventsourcing.TagNormalizer // Canonicalizes the user's tags, nil until provided
 }
 
 // Aggregate returns the underlying TaskAggregate.
@@ -174,12 +510,39 @@ func NewPlugin() eventsourcing.Plugin {
 		"ListTasks": eventsourcing.NewCommand(func(input *ListTasksInput) ([]eventsourcing.Event, error) {
 			return p.listTasksHandler(input)
 		}),
+		"ListDueTasks": eventsourcing.NewCommand(func(input *ListDueTasksInput) ([]eventsourcing.Event, error) {
+			return p.listDueTasksHandler(input)
+		}),
+		"CreateSubtask": eventsourcing.NewCommand(func(input *CreateSubtaskInput) ([]eventsourcing.Event, error) {
+			return p.createSubtaskHandler(input)
+		}),
+		"MoveTask": eventsourcing.NewCommand(func(input *MoveTaskInput) ([]eventsourcing.Event, error) {
+			return p.moveTaskHandler(input)
+		}),
+		"SyncTasks": eventsourcing.NewCommand(func(input *SyncTasksInput) ([]eventsourcing.Event, error) {
+			return p.syncTasksHandler(input)
+		}),
+		"BulkUpdateTasks": eventsourcing.NewCommand(func(input *BulkUpdateTasksInput) ([]eventsourcing.Event, error) {
+			return p.bulkUpdateTasksHandler(input)
+		}),
+		"BulkCompleteTasks": eventsourcing.NewCommand(func(input *BulkCompleteTasksInput) ([]eventsourcing.Event, error) {
+			return p.bulkCompleteTasksHandler(input)
+		}),
+		"BulkDeleteTasks": eventsourcing.NewCommand(func(input *BulkDeleteTasksInput) ([]eventsourcing.Event, error) {
+			return p.bulkDeleteTasksHandler(input)
+		}),
 	}
 	eventsourcing.RegisterEvent("taskmanager_TaskCreated", func() eventsourcing.Event { return &TaskCreatedEvent{} })
 	eventsourcing.RegisterEvent("taskmanager_TaskUpdated", func() eventsourcing.Event { return &TaskUpdatedEvent{} })
 	eventsourcing.RegisterEvent("taskmanager_TaskCompleted", func() eventsourcing.Event { return &TaskCompletedEvent{} })
 	eventsourcing.RegisterEvent("taskmanager_TasksListed", func() eventsourcing.Event { return &TasksListedEvent{} })
+	eventsourcing.RegisterTransientEvent("taskmanager_TasksListed")
 	eventsourcing.RegisterEvent("taskmanager_TaskDeleted", func() eventsourcing.Event { return &TaskDeletedEvent{} })
+	eventsourcing.RegisterEvent("taskmanager_TaskMoved", func() eventsourcing.Event { return &TaskMovedEvent{} })
+	eventsourcing.RegisterEvent("taskmanager_TaskLinked", func() eventsourcing.Event { return &TaskLinkedEvent{} })
+	eventsourcing.RegisterEvent("taskmanager_TaskUnlinked", func() eventsourcing.Event { return &TaskUnlinkedEvent{} })
+	eventsourcing.RegisterEvent("taskmanager_TasksSynced", func() eventsourcing.Event { return &TasksSyncedEvent{} })
+	eventsourcing.RegisterEvent("taskmanager_TasksBulkChanged", func() eventsourcing.Event { return &TasksBulkChangedEvent{} })
 	return p
 }
 
@@ -193,14 +556,29 @@ func (p *TaskPlugin) Name() string {
 	return "taskmanager"
 }
 
+// Manifest declares that the plugin syncs tasks with GitHub and Todoist
+func (p *TaskPlugin) Manifest() eventsourcing.Manifest {
+	return eventsourcing.Manifest{
+		Version:      "1.0.0",
+		Capabilities: []string{eventsourcing.CapabilityNetwork},
+	}
+}
+
 // Schemas defines the command schemas
 func (p *TaskPlugin) Schemas() map[string]eventsourcing.CommandInput {
 	return map[string]eventsourcing.CommandInput{
-		"CreateTask":   &CreateTaskInput{},
-		"UpdateTask":   &UpdateTaskInput{},
-		"DeleteTask":   &DeleteTaskInput{},
-		"CompleteTask": &CompleteTaskInput{},
-		"ListTasks":    &ListTasksInput{},
+		"CreateTask":        &CreateTaskInput{},
+		"UpdateTask":        &UpdateTaskInput{},
+		"DeleteTask":        &DeleteTaskInput{},
+		"CompleteTask":      &CompleteTaskInput{},
+		"ListTasks":         &ListTasksInput{},
+		"ListDueTasks":      &ListDueTasksInput{},
+		"CreateSubtask":     &CreateSubtaskInput{},
+		"MoveTask":          &MoveTaskInput{},
+		"SyncTasks":         &SyncTasksInput{},
+		"BulkUpdateTasks":   &BulkUpdateTasksInput{},
+		"BulkCompleteTasks": &BulkCompleteTasksInput{},
+		"BulkDeleteTasks":   &BulkDeleteTasksInput{},
 	}
 }
 
@@ -219,6 +597,7 @@ type CreateTaskInput struct {
 	Deadline     string   `json:"Deadline,omitempty"`
 	Dependencies []string `json:"Dependencies,omitempty"`
 	Tags         []string `json:"Tags,omitempty"`
+	ParentTaskID string   `json:"ParentTaskID,omitempty"` // Set through CreateSubtask
 }
 
 func (c *CreateTaskInput) Schema() map[string]interface{} {
@@ -247,7 +626,7 @@ func (c *CreateTaskInput) Schema() map[string]interface{} {
 				},
 				"Deadline": map[string]interface{}{
 					"type":        "string",
-					"description": "Deadline for task completion (ISO 8601)",
+					"description": "Deadline for task completion, ISO 8601 or as the user said it, e.g. \"friday at 5pm\"",
 				},
 				"Dependencies": map[string]interface{}{
 					"type":        "array",
@@ -311,7 +690,7 @@ func (u *UpdateTaskInput) Schema() map[string]interface{} {
 				},
 				"Deadline": map[string]interface{}{
 					"type":        "string",
-					"description": "Deadline for task completion (ISO 8601)",
+					"description": "Deadline for task completion, ISO 8601 or as the user said it, e.g. \"friday at 5pm\"",
 				},
 				"Dependencies": map[string]interface{}{
 					"type":        "array",
@@ -420,8 +799,91 @@ func (l *ListTasksInput) Schema() map[string]interface{} {
 	}
 }
 
+func (i *CreateSubtaskInput) New() any {
+	return &CreateSubtaskInput{}
+}
+
+// CreateSubtaskInput defines the input for creating a subtask of an existing task
+type CreateSubtaskInput struct {
+	ParentTaskID string   `json:"ParentTaskID"`
+	Title        string   `json:"Title"`
+	Description  string   `json:"Description,omitempty"`
+	Priority     string   `json:"Priority,omitempty"`
+	Deadline     string   `json:"Deadline,omitempty"`
+	Tags         []string `json:"Tags,omitempty"`
+}
+
+func (c *CreateSubtaskInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Creates a subtask under an existing task",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"ParentTaskID": map[string]interface{}{
+					"type":        "string",
+					"description": "ID of the task the subtask belongs to",
+				},
+				"Title": map[string]interface{}{
+					"type":        "string",
+					"description": "The title of the subtask",
+				},
+				"Description": map[string]interface{}{
+					"type":        "string",
+					"description": "Detailed description of the subtask",
+				},
+				"Priority": map[string]interface{}{
+					"type":        "string",
+					"description": "Priority level of the subtask",
+					"enum":        []string{PriorityLow, PriorityMedium, PriorityHigh, PriorityCritical},
+				},
+				"Deadline": map[string]interface{}{
+					"type":        "string",
+					"description": "Deadline for subtask completion, ISO 8601 or as the user said it, e.g. \"friday at 5pm\"",
+				},
+				"Tags": map[string]interface{}{
+					"type":        "array",
+					"description": "Tags for categorizing the subtask",
+					"items":       map[string]interface{}{"type": "string"},
+				},
+			},
+			"required": []string{"ParentTaskID", "Title"},
+		},
+	}
+}
+
+func (i *MoveTaskInput) New() any {
+	return &MoveTaskInput{}
+}
+
+// MoveTaskInput defines the input for moving a task under another task
+type MoveTaskInput struct {
+	TaskID       string `json:"TaskID"`
+	ParentTaskID string `json:"ParentTaskID,omitempty"`
+}
+
+func (m *MoveTaskInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Moves a task under another task, or to the top level when no parent is given",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"TaskID": map[string]interface{}{
+					"type":        "string",
+					"description": "ID of the task to move",
+				},
+				"ParentTaskID": map[string]interface{}{
+					"type":        "string",
+					"description": "ID of the new parent task; empty to make it a top-level task",
+				},
+			},
+			"required": []string{"TaskID"},
+		},
+	}
+}
+
 // Event Types
 type TasksListedEvent struct {
+	eventsourcing.EventMetadata
 	EventType string  `json:"event_type"`
 	Tasks     []*Task `json:"listed_tasks"`
 }
@@ -434,6 +896,7 @@ func (e *TasksListedEvent) Marshal() ([]byte, error) {
 func (e *TasksListedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
 
 type TaskCreatedEvent struct {
+	eventsourcing.EventMetadata
 	EventType    string   `json:"event_type"`
 	TaskID       string   `json:"task_id"`
 	Title        string   `json:"title"`
@@ -443,6 +906,7 @@ type TaskCreatedEvent struct {
 	Deadline     string   `json:"deadline,omitempty"`
 	Dependencies []string `json:"dependencies,omitempty"`
 	Tags         []string `json:"tags,omitempty"`
+	ParentTaskID string   `json:"parent_task_id,omitempty"`
 }
 
 func (e *TaskCreatedEvent) Type() string { return "taskmanager_TaskCreated" }
@@ -453,6 +917,7 @@ func (e *TaskCreatedEvent) Marshal() ([]byte, error) {
 func (e *TaskCreatedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
 
 type TaskUpdatedEvent struct {
+	eventsourcing.EventMetadata
 	EventType    string   `json:"event_type"`
 	TaskID       string   `json:"task_id"`
 	Title        string   `json:"title,omitempty"`
@@ -462,6 +927,7 @@ type TaskUpdatedEvent struct {
 	Deadline     string   `json:"deadline,omitempty"`
 	Dependencies []string `json:"dependencies,omitempty"`
 	Tags         []string `json:"tags,omitempty"`
+	Previous     *Task    `json:"previous,omitempty"` // The task before the update, so it can be undone
 }
 
 func (e *TaskUpdatedEvent) Type() string { return "taskmanager_TaskUpdated" }
@@ -472,10 +938,12 @@ func (e *TaskUpdatedEvent) Marshal() ([]byte, error) {
 func (e *TaskUpdatedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
 
 type TaskCompletedEvent struct {
+	eventsourcing.EventMetadata
 	EventType       string `json:"event_type"`
 	TaskID          string `json:"task_id"`
 	CompletedAt     string `json:"completed_at"`
 	CompletionNotes string `json:"completion_notes,omitempty"`
+	PreviousStatus  string `json:"previous_status,omitempty"`
 }
 
 func (e *TaskCompletedEvent) Type() string { return "taskmanager_TaskCompleted" }
@@ -486,8 +954,11 @@ func (e *TaskCompletedEvent) Marshal() ([]byte, error) {
 func (e *TaskCompletedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
 
 type TaskDeletedEvent struct {
-	EventType string `json:"event_type"`
-	TaskID    string `json:"task_id"`
+	eventsourcing.EventMetadata
+	EventType  string   `json:"event_type"`
+	TaskID     string   `json:"task_id"`
+	Task       *Task    `json:"task,omitempty"`        // The deleted task, so the deletion can be undone
+	SubtaskIDs []string `json:"subtask_ids,omitempty"` // Subtasks moved up to the parent of the deleted task
 }
 
 func (e *TaskDeletedEvent) Type() string { return "taskmanager_TaskDeleted" }
@@ -497,6 +968,21 @@ func (e *TaskDeletedEvent) Marshal() ([]byte, error) {
 }
 func (e *TaskDeletedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
 
+type TaskMovedEvent struct {
+	eventsourcing.EventMetadata
+	EventType            string `json:"event_type"`
+	TaskID               string `json:"task_id"`
+	ParentTaskID         string `json:"parent_task_id,omitempty"`
+	PreviousParentTaskID string `json:"previous_parent_task_id,omitempty"`
+}
+
+func (e *TaskMovedEvent) Type() string { return "taskmanager_TaskMoved" }
+func (e *TaskMovedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *TaskMovedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
 // Utility functions
 func generateTaskID() string {
 	return fmt.Sprintf("task_%d", time.Now().UnixNano())
@@ -512,6 +998,48 @@ func parseTime(timeStr string) time.Time {
 	return t
 }
 
+// parseDeadline reads a deadline as the user said it, e.g. "friday at 5pm", in the user's time zone
+func (p *TaskPlugin) parseDeadline(text string) (string, error) {
+	p.mu.RLock()
+	loc := p.location
+	p.mu.RUnlock()
+	if loc == nil {
+		loc = time.Local
+	}
+	deadline, err := nltime.Parse(text, time.Now().In(loc))
+	if err != nil {
+		return "", fmt.Errorf("invalid deadline: %v", err)
+	}
+	return deadline.Format(time.RFC3339), nil
+}
+
+// normalizeTags puts tags in their canonical form, once the plugin has been given a normalizer.
+// Nil tags stay nil, as they leave a task's tags unchanged.
+func (p *TaskPlugin) normalizeTags(tags []string) ([]string, error) {
+	p.mu.RLock()
+	normalizer := p.tagNormalizer
+	p.mu.RUnlock()
+	if normalizer == nil || tags == nil {
+		return tags, nil
+	}
+	normalized, err := normalizer.NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	if normalized == nil {
+		normalized = []string{}
+	}
+	return normalized, nil
+}
+
+// formatTime formats a time for an event, leaving zero times empty
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
 func validateStatus(status string) bool {
 	return status == StatusPending || status == StatusInProgress || status == StatusCompleted || status == StatusBlocked
 }
@@ -528,18 +1056,33 @@ func (p *TaskPlugin) createTaskHandler(input *CreateTaskInput) ([]eventsourcing.
 
 	// Default values for a new task. The priority default was previously set
 	// incorrectly to Medium; the tests expect the default to be Low.
+	p.mu.RLock()
+	defaultPriority := p.defaultPriority
+	p.mu.RUnlock()
+	if defaultPriority == "" {
+		defaultPriority = PriorityLow
+	}
 	event := &TaskCreatedEvent{
 		EventType:    "taskmanager_TaskCreated",
 		TaskID:       generateTaskID(),
 		Title:        input.Title,
 		Description:  input.Description,
 		Status:       StatusPending, // Default
-		Priority:     PriorityLow,   // Corrected default
+		Priority:     defaultPriority,
 		Deadline:     input.Deadline,
 		Dependencies: input.Dependencies,
 		Tags:         input.Tags,
+		ParentTaskID: input.ParentTaskID,
 	}
 
+	if input.ParentTaskID != "" {
+		p.aggregate.Mu.RLock()
+		_, exists := p.aggregate.Tasks[input.ParentTaskID]
+		p.aggregate.Mu.RUnlock()
+		if !exists {
+			return nil, fmt.Errorf("parent task %s not found", input.ParentTaskID)
+		}
+	}
 	if input.Status != "" && validateStatus(input.Status) {
 		event.Status = input.Status
 	}
@@ -553,34 +1096,17 @@ func (p *TaskPlugin) createTaskHandler(input *CreateTaskInput) ([]eventsourcing.
 		event.Priority = input.Priority
 	}
 	if input.Deadline != "" {
-		// List of supported formats
-		formats := []string{
-			time.RFC3339,           // "2006-01-02T15:04:05Z07:00"
-			"2006-01-02",           // "2023-11-25"
-			"2006-01-02 15:04:05",  // "2023-11-25 14:30:00"
-			"2006-01-02T15:04:05Z", // "2023-11-25T14:30:00Z"
-		}
-
-		var parsedTime time.Time
-		var err error
-
-		// Try each format until one succeeds
-		for _, format := range formats {
-			parsedTime, err = time.Parse(format, input.Deadline)
-			if err == nil {
-				break
-			}
-		}
-
+		deadline, err := p.parseDeadline(input.Deadline)
 		if err != nil {
-			return nil, fmt.Errorf("invalid deadline format: '%s' doesn't match any supported formats (e.g., '2006-01-02', '2006-01-02T15:04:05Z')", input.Deadline)
-		}
-
-		// Optional: Validate the parsed time is reasonable
-		if parsedTime.Year() < 0 || parsedTime.Year() > 9999 {
-			return nil, fmt.Errorf("deadline year %d is out of valid range (1-9999)", parsedTime.Year())
+			return nil, err
 		}
+		event.Deadline = deadline
 	}
+	tags, err := p.normalizeTags(input.Tags)
+	if err != nil {
+		return nil, err
+	}
+	event.Tags = tags
 	return []eventsourcing.Event{event}, nil
 }
 
@@ -590,7 +1116,11 @@ func (p *TaskPlugin) updateTaskHandler(input *UpdateTaskInput) ([]eventsourcing.
 	}
 
 	p.aggregate.Mu.RLock()
-	_, exists := p.aggregate.Tasks[input.TaskID]
+	task, exists := p.aggregate.Tasks[input.TaskID]
+	var previous Task
+	if exists {
+		previous = *task
+	}
 	p.aggregate.Mu.RUnlock()
 	if !exists {
 		return nil, fmt.Errorf("task %s not found", input.TaskID)
@@ -606,6 +1136,7 @@ func (p *TaskPlugin) updateTaskHandler(input *UpdateTaskInput) ([]eventsourcing.
 		Deadline:     input.Deadline,
 		Dependencies: input.Dependencies,
 		Tags:         input.Tags,
+		Previous:     &previous,
 	}
 
 	if input.Status != "" && !validateStatus(input.Status) {
@@ -615,10 +1146,17 @@ func (p *TaskPlugin) updateTaskHandler(input *UpdateTaskInput) ([]eventsourcing.
 		return nil, fmt.Errorf("invalid priority: %s", input.Priority)
 	}
 	if input.Deadline != "" {
-		if _, err := time.Parse(time.RFC3339, input.Deadline); err != nil {
-			return nil, fmt.Errorf("invalid deadline format: %v", err)
+		deadline, err := p.parseDeadline(input.Deadline)
+		if err != nil {
+			return nil, err
 		}
+		event.Deadline = deadline
+	}
+	tags, err := p.normalizeTags(input.Tags)
+	if err != nil {
+		return nil, err
 	}
+	event.Tags = tags
 
 	return []eventsourcing.Event{event}, nil
 }
@@ -629,13 +1167,19 @@ func (p *TaskPlugin) deleteTaskHandler(input *DeleteTaskInput) ([]eventsourcing.
 	}
 
 	p.aggregate.Mu.RLock()
-	_, exists := p.aggregate.Tasks[input.TaskID]
-	p.aggregate.Mu.RUnlock()
+	defer p.aggregate.Mu.RUnlock()
+	task, exists := p.aggregate.Tasks[input.TaskID]
 	if !exists {
 		return nil, fmt.Errorf("task %s not found", input.TaskID)
 	}
 
-	event := &TaskDeletedEvent{EventType: "taskmanager_TaskDeleted", TaskID: input.TaskID}
+	deleted := *task
+	event := &TaskDeletedEvent{
+		EventType:  "taskmanager_TaskDeleted",
+		TaskID:     input.TaskID,
+		Task:       &deleted,
+		SubtaskIDs: p.aggregate.subtaskIDs(input.TaskID),
+	}
 	return []eventsourcing.Event{event}, nil
 }
 
@@ -660,6 +1204,85 @@ func (p *TaskPlugin) completeTaskHandler(input *CompleteTaskInput) ([]eventsourc
 		TaskID:          input.TaskID,
 		CompletedAt:     now.Format(time.RFC3339),
 		CompletionNotes: input.CompletionNotes,
+		PreviousStatus:  task.Status,
+	}
+	events := []eventsourcing.Event{event}
+	return append(events, p.rollUpCompletion(input.TaskID, now, map[string]bool{input.TaskID: true})...), nil
+}
+
+// rollUpCompletion completes the ancestors of a just completed task whose subtasks are now all completed.
+// Completed holds the tasks the command completes, the ancestors completed are added to it.
+func (p *TaskPlugin) rollUpCompletion(taskID string, now time.Time, completed map[string]bool) []eventsourcing.Event {
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+
+	var events []eventsourcing.Event
+	parentID := p.aggregate.Tasks[taskID].ParentTaskID
+	for parentID != "" {
+		parent, exists := p.aggregate.Tasks[parentID]
+		if !exists || parent.Status == StatusCompleted || completed[parentID] {
+			break
+		}
+		for _, child := range p.aggregate.subtasks(parentID) {
+			if child.Status != StatusCompleted && !completed[child.TaskID] {
+				return events
+			}
+		}
+		events = append(events, &TaskCompletedEvent{
+			EventType:       "taskmanager_TaskCompleted",
+			TaskID:          parentID,
+			CompletedAt:     now.Format(time.RFC3339),
+			CompletionNotes: "All subtasks completed",
+			PreviousStatus:  parent.Status,
+		})
+		completed[parentID] = true
+		parentID = parent.ParentTaskID
+	}
+	return events
+}
+
+func (p *TaskPlugin) createSubtaskHandler(input *CreateSubtaskInput) ([]eventsourcing.Event, error) {
+	if input.ParentTaskID == "" {
+		return nil, fmt.Errorf("parentTaskID is required and must be a non-empty string")
+	}
+	return p.createTaskHandler(&CreateTaskInput{
+		Title:        input.Title,
+		Description:  input.Description,
+		Priority:     input.Priority,
+		Deadline:     input.Deadline,
+		Tags:         input.Tags,
+		ParentTaskID: input.ParentTaskID,
+	})
+}
+
+func (p *TaskPlugin) moveTaskHandler(input *MoveTaskInput) ([]eventsourcing.Event, error) {
+	if input.TaskID == "" {
+		return nil, fmt.Errorf("taskID is required and must be a non-empty string")
+	}
+
+	p.aggregate.Mu.RLock()
+	defer p.aggregate.Mu.RUnlock()
+	task, exists := p.aggregate.Tasks[input.TaskID]
+	if !exists {
+		return nil, fmt.Errorf("task %s not found", input.TaskID)
+	}
+	// Walk up from the new parent to make sure the task does not become its own ancestor
+	for ancestorID := input.ParentTaskID; ancestorID != ""; {
+		if ancestorID == input.TaskID {
+			return nil, fmt.Errorf("cannot move task %s under itself or one of its subtasks", input.TaskID)
+		}
+		ancestor, exists := p.aggregate.Tasks[ancestorID]
+		if !exists {
+			return nil, fmt.Errorf("parent task %s not found", ancestorID)
+		}
+		ancestorID = ancestor.ParentTaskID
+	}
+
+	event := &TaskMovedEvent{
+		EventType:            "taskmanager_TaskMoved",
+		TaskID:               input.TaskID,
+		ParentTaskID:         input.ParentTaskID,
+		PreviousParentTaskID: task.ParentTaskID,
 	}
 	return []eventsourcing.Event{event}, nil
 }
@@ -716,31 +1339,6 @@ func (ta *TaskAggregate) GetCustomUI() fyne.CanvasObject {
 		tasks = append(tasks, task)
 	}
 
-	if len(tasks) == 0 {
-		return container.NewCenter(widget.NewLabel("No tasks available. Create one to get started!"))
-	}
-
-	// Define Kanban columns based on task statuses
-	statuses := []string{StatusPending, StatusInProgress, StatusBlocked, StatusCompleted}
-	columns := make(map[string]*fyne.Container)
-	scrolls := make(map[string]*container.Scroll) // Store scroll containers separately
-
-	// Initialize each column
-	for _, status := range statuses {
-		header := widget.NewLabel(status)
-		header.TextStyle = fyne.TextStyle{Bold: true}
-		header.Alignment = fyne.TextAlignCenter
-		content := container.NewVBox()
-		scroll := container.NewVScroll(content)   // Create scroll container
-		scroll.SetMinSize(fyne.NewSize(250, 400)) // Set size directly on scroll
-		columns[status] = container.NewBorder(
-			container.NewPadded(header),
-			nil, nil, nil,
-			scroll, // Pass the scroll container directly
-		)
-		scrolls[status] = scroll // Store the scroll reference
-	}
-
 	// Sort tasks by priority and deadline within each column
 	sort.Slice(tasks, func(i, j int) bool {
 		pi, pj := priorityValue(tasks[i].Priority), priorityValue(tasks[j].Priority)
@@ -753,112 +1351,102 @@ func (ta *TaskAggregate) GetCustomUI() fyne.CanvasObject {
 		return tasks[i].CreatedAt.Before(tasks[j].CreatedAt)
 	})
 
-	// Populate columns with tasks
+	// Populate the Kanban columns with tasks, cards are dragged between them
+	kanban := newBoard(ta.execute)
 	for _, task := range tasks {
-		card := createTaskCard(task)
-		// Use the stored scroll reference instead of type-asserting Objects[1]
-		columnContent := scrolls[task.Status].Content.(*fyne.Container)
-		columnContent.Add(card)
-		columnContent.Add(widget.NewSeparator()) // Always add separator after each card
+		column := kanban.column(task.Status)
+		if column == nil {
+			continue
+		}
+		var parentTitle string
+		if ta.hasParent(task) {
+			parentTitle = ta.Tasks[task.ParentTaskID].Title
+		}
+		completed, total := ta.subtaskProgress(task.TaskID)
+		card := newTaskCard(kanban, *task, createTaskCard(task, parentTitle, completed, total, ta.linkedItems(task.TaskID)))
+		column.cards.Add(card)
+		column.cards.Add(widget.NewSeparator()) // Always add separator after each card
 	}
 
 	// Assemble the Kanban board
 	board := container.NewHBox()
-	for _, status := range statuses {
-		board.Add(columns[status])
+	for _, column := range kanban.columns {
+		board.Add(column.object)
+	}
+	if len(tasks) == 0 && ta.execute == nil {
+		return container.NewCenter(widget.NewLabel("No tasks available. Create one to get started!"))
 	}
 
-	// Wrap in a scrollable container for wide boards
-	return container.NewHScroll(board)
+	// Wrap in a scrollable container for wide boards, next to the subtask hierarchy
+	return container.NewAppTabs(
+		container.NewTabItem("Board", container.NewHScroll(board)),
+		container.NewTabItem("Tree", ta.taskTree()),
+	)
+}
+
+// taskTree shows tasks with their subtasks as a collapsible tree (caller holds the read lock)
+func (ta *TaskAggregate) taskTree() fyne.CanvasObject {
+	// Snapshot the hierarchy so the tree callbacks don't need the aggregate lock
+	children := map[string][]string{"": ta.rootTaskIDs()}
+	labels := make(map[string]string, len(ta.Tasks))
+	for id, task := range ta.Tasks {
+		children[id] = ta.subtaskIDs(id)
+		label := task.Title
+		if completed, total := ta.subtaskProgress(id); total > 0 {
+			label = fmt.Sprintf("%s (%d/%d)", label, completed, total)
+		}
+		if task.Status == StatusCompleted {
+			label = "✓ " + label
+		}
+		labels[id] = label
+	}
+
+	tree := widget.NewTree(
+		func(uid widget.TreeNodeID) []widget.TreeNodeID { return children[uid] },
+		func(uid widget.TreeNodeID) bool { return len(children[uid]) > 0 || uid == "" },
+		func(branch bool) fyne.CanvasObject { return widget.NewLabel("") },
+		func(uid widget.TreeNodeID, branch bool, obj fyne.CanvasObject) {
+			obj.(*widget.Label).SetText(labels[uid])
+		},
+	)
+	tree.OpenAllBranches()
+	return tree
 }
 
 func (a *TaskAggregate) Broadcast3DDelta(event eventsourcing.Event) []eventsourcing.DeltaAction {
 	a.Mu.RLock()
 	defer a.Mu.RUnlock()
-	theme := ui3d.DefaultTheme()
+	return a.deltaActions(event)
+}
+
+// deltaActions returns the changes of the 3D world for an event, the caller holds the lock
+func (a *TaskAggregate) deltaActions(event eventsourcing.Event) []eventsourcing.DeltaAction {
 	switch e := event.(type) {
 	case *TaskCreatedEvent:
-		// Find the index of this task in the sorted list
-		sortedIDs := a.getSortedTaskIDs()
-		i := 0
-		for _, id := range sortedIDs {
-			if id == e.TaskID {
-				break
-			}
-			i++
-		}
-		pos := ui3d.PositionInCircle(i, 6.0+float64(i)*0.5, 2.0)
-		color := priorityColor(e.Priority)
-		actions := ui3d.CreateStandardObject(ui3d.StandardObject{
-			ID:       e.TaskID,
-			MeshType: "box",
-			Position: pos,
-			Label:    &ui3d.LabelConfig{Text: e.Title},
-			Theme:    theme,
-			Extra: map[string]interface{}{
-				"event_type": "task_created",
-				"material_override": map[string]interface{}{
-					"albedo_color": color,
-				},
-			},
-		})
-		if len(actions) > 0 {
-			actions[0].Metadata = map[string]interface{}{
-				"title":  e.Title,
-				"status": e.Status,
-			}
-		}
-		if len(actions) > 1 {
-			actions[1].Properties["event_type"] = "task_created"
+		if _, exists := a.Tasks[e.TaskID]; !exists {
+			return nil
 		}
-		return actions
+		return a.taskActions(e.TaskID, "task_created")
 	case *TaskUpdatedEvent:
-		// For updates, recreate the task at the correct position
-		sortedIDs := a.getSortedTaskIDs()
-		i := 0
-		for _, id := range sortedIDs {
-			if id == e.TaskID {
-				break
-			}
-			i++
+		if _, exists := a.Tasks[e.TaskID]; !exists {
+			return nil
 		}
-		pos := ui3d.PositionInCircle(i, 6.0+float64(i)*0.5, 2.0)
-		color := priorityColor(a.Tasks[e.TaskID].Priority)
-		// Delete old
-		oldActions := []eventsourcing.DeltaAction{{
-			Type:   "delete",
-			NodeID: e.TaskID,
-		}, {
-			Type:   "delete",
-			NodeID: e.TaskID + "_label",
-		}}
-		// Create new
-		newActions := ui3d.CreateStandardObject(ui3d.StandardObject{
-			ID:       e.TaskID,
-			MeshType: "box",
-			Position: pos,
-			Label:    &ui3d.LabelConfig{Text: a.Tasks[e.TaskID].Title},
-			Theme:    theme,
-			Extra: map[string]interface{}{
-				"event_type": "task_updated",
-				"material_override": map[string]interface{}{
-					"albedo_color": color,
-				},
-			},
-		})
-		if len(newActions) > 1 {
-			newActions[1].Properties["event_type"] = "task_updated"
+		// For updates, recreate the task and its subtasks at the correct position
+		return append(deleteTaskActions(e.TaskID), a.taskActions(e.TaskID, "task_updated")...)
+	case *TaskMovedEvent:
+		if _, exists := a.Tasks[e.TaskID]; !exists {
+			return nil
 		}
-		return append(oldActions, newActions...)
+		return append(deleteTaskActions(e.TaskID), a.taskActions(e.TaskID, "task_updated")...)
 	case *TaskCompletedEvent:
-		return []eventsourcing.DeltaAction{{
-			Type:   "delete",
-			NodeID: e.TaskID,
-		}, {
-			Type:   "delete",
-			NodeID: e.TaskID + "_label",
-		}}
+		return deleteTaskActions(e.TaskID)
 		// ... similar for Update/Delete
+	case *TasksBulkChangedEvent:
+		var actions []eventsourcing.DeltaAction
+		for _, change := range e.changes() {
+			actions = append(actions, a.deltaActions(change)...)
+		}
+		return actions
 	}
 	return nil
 }
@@ -866,49 +1454,67 @@ func (a *TaskAggregate) Broadcast3DDelta(event eventsourcing.Event) []eventsourc
 func (a *TaskAggregate) GetFull3DState() []eventsourcing.DeltaAction {
 	a.Mu.RLock()
 	defer a.Mu.RUnlock()
-	theme := ui3d.DefaultTheme()
 	actions := make([]eventsourcing.DeltaAction, 0)
+	for _, id := range a.rootTaskIDs() {
+		actions = append(actions, a.taskActions(id, "task")...)
+	}
+	return actions
+}
 
-	// Sort tasks by creation time for consistent positioning
-	type taskWithID struct {
-		id   string
-		task *Task
+// taskActions creates the 3D objects for a task and its subtasks. Top-level tasks are placed in a
+// circle, subtasks are parented to their task and placed in a smaller circle above it.
+func (a *TaskAggregate) taskActions(taskID, eventType string) []eventsourcing.DeltaAction {
+	task := a.Tasks[taskID]
+	extra := map[string]interface{}{
+		"event_type": eventType,
+		"material_override": map[string]interface{}{
+			"albedo_color": priorityColor(task.Priority),
+		},
 	}
-	var sortedTasks []taskWithID
-	for id, task := range a.Tasks {
-		sortedTasks = append(sortedTasks, taskWithID{id: id, task: task})
+	var pos []float64
+	if a.hasParent(task) {
+		pos = ui3d.PositionInCircle(indexOf(a.subtaskIDs(task.ParentTaskID), taskID), 1.5, 1.5)
+		extra["parent_id"] = task.ParentTaskID
+		extra["scale"] = []float64{0.6, 0.6, 0.6}
+	} else {
+		i := indexOf(a.rootTaskIDs(), taskID)
+		pos = ui3d.PositionInCircle(i, 6.0+float64(i)*0.5, 2.0)
 	}
-	sort.Slice(sortedTasks, func(i, j int) bool {
-		return sortedTasks[i].task.CreatedAt.Before(sortedTasks[j].task.CreatedAt)
+	actions := ui3d.CreateStandardObject(ui3d.StandardObject{
+		ID:       taskID,
+		MeshType: "box",
+		Position: pos,
+		Label:    &ui3d.LabelConfig{Text: ui3d.LinkBadge(task.Title, len(a.linkedItems(taskID)))},
+		Theme:    ui3d.CurrentTheme(),
+		Extra:    extra,
 	})
-
-	lm := ui3d.LayoutManager{Type: "circle", Spacing: 6.0, Counter: 0}
-	for _, taskItem := range sortedTasks {
-		pos := lm.NextPosition()
-		pos[1] = 2.0 // Fixed height
-		color := priorityColor(taskItem.task.Priority)
-		// Use StandardObject
-		taskActions := ui3d.CreateStandardObject(ui3d.StandardObject{
-			ID:       taskItem.id,
-			MeshType: "box",
-			Position: pos,
-			Label:    &ui3d.LabelConfig{Text: taskItem.task.Title},
-			Theme:    theme,
-			Extra: map[string]interface{}{
-				"event_type": "task",
-				"material_override": map[string]interface{}{
-					"albedo_color": color,
-				},
-			},
-		})
-		if len(taskActions) > 1 {
-			taskActions[1].Properties["event_type"] = "task"
+	if len(actions) > 0 {
+		actions[0].Metadata = map[string]interface{}{
+			"title":          task.Title,
+			"status":         task.Status,
+			"parent_task_id": task.ParentTaskID,
 		}
-		actions = append(actions, taskActions...)
+	}
+	if len(actions) > 1 {
+		actions[1].Properties["event_type"] = eventType
+	}
+	for _, childID := range a.subtaskIDs(taskID) {
+		actions = append(actions, a.taskActions(childID, eventType)...)
 	}
 	return actions
 }
 
+// deleteTaskActions removes a task from the 3D world; Godot removes its subtasks along with it
+func deleteTaskActions(taskID string) []eventsourcing.DeltaAction {
+	return []eventsourcing.DeltaAction{{
+		Type:   "delete",
+		NodeID: taskID,
+	}, {
+		Type:   "delete",
+		NodeID: taskID + "_label",
+	}}
+}
+
 // getSortedTaskIDs returns task IDs sorted by creation time for consistent positioning
 func (a *TaskAggregate) getSortedTaskIDs() []string {
 	ids := make([]string, 0, len(a.Tasks))
@@ -923,6 +1529,57 @@ func (a *TaskAggregate) getSortedTaskIDs() []string {
 	return ids
 }
 
+// rootTaskIDs returns the IDs of top-level tasks sorted by creation time
+func (a *TaskAggregate) rootTaskIDs() []string {
+	var ids []string
+	for _, id := range a.getSortedTaskIDs() {
+		if !a.hasParent(a.Tasks[id]) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// subtaskIDs returns the IDs of the direct subtasks of a task sorted by creation time
+func (a *TaskAggregate) subtaskIDs(parentID string) []string {
+	var ids []string
+	for _, id := range a.getSortedTaskIDs() {
+		if a.Tasks[id].ParentTaskID == parentID {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// subtasks returns the direct subtasks of a task sorted by creation time
+func (a *TaskAggregate) subtasks(parentID string) []*Task {
+	var tasks []*Task
+	for _, id := range a.subtaskIDs(parentID) {
+		tasks = append(tasks, a.Tasks[id])
+	}
+	return tasks
+}
+
+// subtaskProgress returns how many of the direct subtasks of a task are completed
+func (a *TaskAggregate) subtaskProgress(taskID string) (completed, total int) {
+	for _, task := range a.subtasks(taskID) {
+		total++
+		if task.Status == StatusCompleted {
+			completed++
+		}
+	}
+	return completed, total
+}
+
+// hasParent reports whether a task is a subtask of an existing task
+func (a *TaskAggregate) hasParent(task *Task) bool {
+	if task.ParentTaskID == "" {
+		return false
+	}
+	_, exists := a.Tasks[task.ParentTaskID]
+	return exists
+}
+
 // Helpers: priorityColor() returns [r,g,b,a]; randomPos() in [ -10..10 ]
 func priorityColor(priority string) []float64 {
 	switch priority {
@@ -944,8 +1601,8 @@ func randomPos() []float64 {
 	return []float64{0, 0, 0} // placeholder
 }
 
-// createTaskCard creates a compact card UI for a single task
-func createTaskCard(task *Task) fyne.CanvasObject {
+// createTaskCard creates a compact card UI for a single task, with the items of other plugins linked to it
+func createTaskCard(task *Task, parentTitle string, completedSubtasks, totalSubtasks int, linked []eventsourcing.Item) fyne.CanvasObject {
 	// Title with priority icon
 	title := widget.NewLabel(task.Title)
 	title.TextStyle = fyne.TextStyle{Bold: true}
@@ -973,6 +1630,22 @@ func createTaskCard(task *Task) fyne.CanvasObject {
 	if len(task.Tags) > 0 {
 		detailLines = append(detailLines, fmt.Sprintf("Tags: %s", strings.Join(task.Tags, ", ")))
 	}
+	if parentTitle != "" {
+		detailLines = append(detailLines, fmt.Sprintf("Part of: %s", parentTitle))
+	}
+	if totalSubtasks > 0 {
+		detailLines = append(detailLines, fmt.Sprintf("Subtasks: %d/%d done", completedSubtasks, totalSubtasks))
+	}
+	if task.FocusSeconds > 0 {
+		detailLines = append(detailLines, fmt.Sprintf("Focused: %s", time.Duration(task.FocusSeconds)*time.Second))
+	}
+	if len(linked) > 0 {
+		titles := make([]string, len(linked))
+		for i, item := range linked {
+			titles[i] = item.Title
+		}
+		detailLines = append(detailLines, fmt.Sprintf("↔ Linked: %s", strings.Join(titles, ", ")))
+	}
 	details := widget.NewLabel(strings.Join(detailLines, "\n"))
 	details.Wrapping = fyne.TextWrapWord
 
@@ -1054,7 +1727,11 @@ func (p *TaskPlugin) SystemPrompt() string {
 	} else {
 		taskList.WriteString("Current tasks:\n")
 		for _, task := range tasks {
-			taskList.WriteString(fmt.Sprintf("- Task ID: %s, Title: \"%s\"\n", task.TaskID, task.Title))
+			if task.ParentTaskID != "" {
+				taskList.WriteString(fmt.Sprintf("- Task ID: %s, Title: \"%s\", Subtask of: %s\n", task.TaskID, task.Title, task.ParentTaskID))
+			} else {
+				taskList.WriteString(fmt.Sprintf("- Task ID: %s, Title: \"%s\"\n", task.TaskID, task.Title))
+			}
 		}
 	}
 
@@ -1063,7 +1740,7 @@ func (p *TaskPlugin) SystemPrompt() string {
 
 The user input will be a JSON object containing the arguments for the command to execute. Parse the JSON and call the appropriate command with the parsed values.
 
-Your job is to interpret user requests about tasks and execute the right commands (CreateTask, UpdateTask, CompleteTask, DeleteTask, ListTasks) based on the current task state.
+Your job is to interpret user requests about tasks and execute the right commands (CreateTask, CreateSubtask, MoveTask, UpdateTask, CompleteTask, DeleteTask, ListTasks, ListDueTasks, SyncTasks, BulkUpdateTasks, BulkCompleteTasks, BulkDeleteTasks) based on the current task state.
 
 ` + taskList.String() + `
 
@@ -1074,6 +1751,7 @@ Be concise, accurate, and always use the tools provided to manage tasks. Focus o
 3. Completing tasks with helpful completion notes
 4. Deleting tasks when requested to remove or delete
 5. Listing and filtering tasks as requested
+6. Breaking tasks down into subtasks; a task is completed automatically once all its subtasks are
 
 When interpreting user requests, pay close attention to the intent:
 - If the user asks to "remove," "delete," or "get rid of" a task, use the DeleteTask command.
@@ -1081,12 +1759,17 @@ When interpreting user requests, pay close attention to the intent:
 - If the user asks to "create" or "add" a task, use the CreateTask command.
 - If the user asks to "update" or "modify" a task, use the UpdateTask command.
 - If the user asks to "list" or "show" tasks, use the ListTasks command.
+- If the user asks what is due, overdue or coming up, e.g. this week, use the ListDueTasks command.
+- If the user asks to "break down" a task or add a step to it, use the CreateSubtask command with the parent's task ID.
+- If the user asks to move a task under another task or make it top-level again, use the MoveTask command.
+- If the user asks to sync, import or export tasks with GitHub or Todoist, use the SyncTasks command.
+- If the user asks to change, complete or delete all tasks with a status, a tag or a deadline in a range, e.g. "mark everything tagged errands as done", use BulkUpdateTasks, BulkCompleteTasks or BulkDeleteTasks with those filters instead of a command per task.
 
 When creating or updating tasks, extract key information from user requests including:
 - Task title and description
 - Priority level (Low, Medium, High, Critical)
 - Status (Pending, In Progress, Completed, Blocked)
-- Deadlines (in ISO format)
+- Deadlines (in ISO format, or as the user said them, like "friday at 5pm")
 - Tags for organization
 
 Format your responses in a structured way and confirm actions performed.`
@@ -1094,6 +1777,82 @@ Format your responses in a structured way and confirm actions performed.`
 	return prompt
 }
 
+// Configure applies the [plugin.taskmanager] settings of the configuration file
+func (p *TaskPlugin) Configure(settings map[string]interface{}) error {
+	priority, _ := settings["default_priority"].(string)
+	if priority != "" && !validatePriority(priority) {
+		return fmt.Errorf("default_priority %s cannot be parsed", priority)
+	}
+	trackers, err := configureTrackers(settings)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.defaultPriority = priority
+	p.trackers = trackers
+	return nil
+}
+
+// SetLocation sets the time zone deadlines are read in
+func (p *TaskPlugin) SetLocation(loc *time.Location) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.location = loc
+}
+
+// SetTagNormalizer sets how the tags of new and updated tasks are canonicalized
+func (p *TaskPlugin) SetTagNormalizer(normalizer eventsourcing.TagNormalizer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tagNormalizer = normalizer
+}
+
+// SetLinkSource sets where the items of other plugins linked to tasks are found
+func (p *TaskPlugin) SetLinkSource(source eventsourcing.LinkSource) {
+	p.aggregate.Mu.Lock()
+	defer p.aggregate.Mu.Unlock()
+	p.aggregate.links = source
+}
+
+// RequiresConfirmation asks the user before tasks are deleted
+func (p *TaskPlugin) RequiresConfirmation(command string) bool {
+	return command == "DeleteTask" || command == "BulkDeleteTasks"
+}
+
+// Examples shows the agent how common requests map to commands, the deadline left as the user said it
+func (p *TaskPlugin) Examples() []eventsourcing.Example {
+	return []eventsourcing.Example{
+		{Request: "remind me to call mom tomorrow", Command: "CreateTask", Arguments: map[string]interface{}{"Title": "Call mom", "Deadline": "tomorrow"}},
+		{Request: "I need to file my taxes by friday, it's urgent", Command: "CreateTask", Arguments: map[string]interface{}{"Title": "File taxes", "Deadline": "friday", "Priority": PriorityHigh}},
+		{Request: "what's still open?", Command: "ListTasks", Arguments: map[string]interface{}{"Status": StatusPending}},
+		{Request: "what am I working on?", Command: "ListTasks", Arguments: map[string]interface{}{"Status": StatusInProgress}},
+	}
+}
+
+// HandleInteraction completes a clicked task, reopens a clicked completed task, and deletes a task
+// deleted in the 3D world
+func (p *TaskPlugin) HandleInteraction(interaction eventsourcing.Interaction) (string, any) {
+	taskID := interaction.NodeID
+	p.aggregate.Mu.RLock()
+	task, exists := p.aggregate.Tasks[taskID]
+	completed := exists && task.Status == StatusCompleted
+	p.aggregate.Mu.RUnlock()
+	if !exists {
+		return "", nil
+	}
+	switch interaction.Kind {
+	case eventsourcing.ObjectClicked:
+		if completed {
+			return "UpdateTask", &UpdateTaskInput{TaskID: taskID, Status: StatusPending}
+		}
+		return "CompleteTask", &CompleteTaskInput{TaskID: taskID}
+	case eventsourcing.ObjectDeleted:
+		return "DeleteTask", &DeleteTaskInput{TaskID: taskID}
+	}
+	return "", nil
+}
+
 // AgentModel specifies the LLM model to use for this plugin's agent
 func (p *TaskPlugin) AgentModel() string {
 	return "gpt-oss:20b" // Using the general-purpose model for task management
@@ -1104,6 +1863,15 @@ func (p *TaskPlugin) EventHandlers() map[string]eventsourcing.EventHandler {
 }
 
 // Helper functions
+func indexOf(slice []string, item string) int {
+	for i, s := range slice {
+		if s == item {
+			return i
+		}
+	}
+	return -1
+}
+
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
 		if s == item {
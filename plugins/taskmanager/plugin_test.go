@@ -1,8 +1,20 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"mindpalace/pkg/eventsourcing"
 )
 
 func TestTaskAggregate_ApplyEvent_TaskCreated(t *testing.T) {
@@ -236,3 +248,938 @@ func TestTaskAggregate_Broadcast3DDelta_TaskCompleted(t *testing.T) {
 		t.Errorf("Expected delete action for 'task1_label', got %v", actions[1])
 	}
 }
+
+func TestTaskAggregate_SnapshotRoundTrip(t *testing.T) {
+	agg := NewTaskAggregate()
+	agg.ApplyEvent(&TaskCreatedEvent{
+		EventType: "taskmanager_TaskCreated",
+		TaskID:    "task1",
+		Title:     "Snapshot me",
+		Status:    StatusPending,
+		Priority:  PriorityHigh,
+	})
+
+	data, err := agg.SaveSnapshot()
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	restored := NewTaskAggregate()
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	task, exists := restored.Tasks["task1"]
+	if !exists {
+		t.Fatal("Task not restored from snapshot")
+	}
+	if task.Title != "Snapshot me" || task.Priority != PriorityHigh {
+		t.Errorf("Unexpected restored task: %+v", task)
+	}
+}
+
+func TestTaskAggregate_Deadlines(t *testing.T) {
+	agg := NewTaskAggregate()
+	agg.ApplyEvent(&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "task1", Title: "Due", Status: StatusPending, Deadline: "2024-05-01T12:00:00Z"})
+	agg.ApplyEvent(&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "task2", Title: "No deadline", Status: StatusPending})
+	agg.ApplyEvent(&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "task3", Title: "Done", Status: StatusPending, Deadline: "2024-05-01T12:00:00Z"})
+	agg.ApplyEvent(&TaskCompletedEvent{EventType: "taskmanager_TaskCompleted", TaskID: "task3", CompletedAt: "2024-04-30T12:00:00Z"})
+
+	deadlines := agg.Deadlines()
+	if len(deadlines) != 1 || deadlines[0].ID != "task1" || deadlines[0].NodeID != "task1" {
+		t.Fatalf("Expected only the deadline of task1, got %+v", deadlines)
+	}
+	if !deadlines[0].Due.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected due time: %v", deadlines[0].Due)
+	}
+}
+
+func TestTaskAggregate_BriefingItems(t *testing.T) {
+	agg := NewTaskAggregate()
+	agg.ApplyEvent(&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "task1", Title: "Today", Status: StatusPending, Priority: PriorityHigh, Deadline: "2024-05-01T15:00:00Z"})
+	agg.ApplyEvent(&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "task2", Title: "Late", Status: StatusPending, Priority: PriorityHigh, Deadline: "2024-04-29T12:00:00Z"})
+	agg.ApplyEvent(&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "task3", Title: "Next week", Status: StatusPending, Deadline: "2024-05-08T12:00:00Z"})
+	agg.ApplyEvent(&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "task4", Title: "Busy", Status: StatusInProgress, Priority: PriorityHigh})
+
+	items := agg.BriefingItems(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	var texts []string
+	for _, item := range items {
+		texts = append(texts, item.Text)
+	}
+	want := []string{
+		"Late, high priority, overdue since Mon Apr 29",
+		"Today, high priority, due at 15:00",
+		"Busy, high priority, in progress",
+	}
+	if strings.Join(texts, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected the overdue, due and running tasks, got %q", texts)
+	}
+}
+
+func TestTaskAggregate_QueryState(t *testing.T) {
+	agg := NewTaskAggregate()
+	agg.ApplyEvent(&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "task1", Title: "Report", Status: StatusPending})
+	agg.ApplyEvent(&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "task2", Title: "Slides", Status: StatusPending})
+
+	tasks, ok := agg.QueryState().([]Task)
+	if !ok || len(tasks) != 2 {
+		t.Fatalf("Expected both tasks, got %+v", agg.QueryState())
+	}
+	tasks[0].Title = "Changed"
+	if agg.Tasks["task1"].Title != "Report" || agg.Tasks["task2"].Title != "Slides" {
+		t.Error("Expected the queried state to be a copy")
+	}
+}
+
+func TestTaskPlugin_DeadlineAsSaid(t *testing.T) {
+	p := NewPlugin().(*TaskPlugin)
+	amsterdam := time.FixedZone("CEST", 2*60*60)
+	p.SetLocation(amsterdam)
+
+	events, err := p.createTaskHandler(&CreateTaskInput{Title: "Report", Deadline: "next friday at 5pm"})
+	if err != nil {
+		t.Fatalf("createTaskHandler failed: %v", err)
+	}
+	deadline, err := time.Parse(time.RFC3339, events[0].(*TaskCreatedEvent).Deadline)
+	if err != nil || deadline.Weekday() != time.Friday || deadline.Hour() != 17 || deadline.Format("-07:00") != "+02:00" {
+		t.Errorf("Expected friday 17:00 in the user's time zone, got %v (%v)", deadline, err)
+	}
+	if _, err := p.createTaskHandler(&CreateTaskInput{Title: "Report", Deadline: "03/04"}); err == nil || !strings.Contains(err.Error(), "could mean") {
+		t.Errorf("Expected an error on an ambiguous date, got %v", err)
+	}
+}
+
+// spellingNormalizer lower-cases tags and rejects "helth"
+type spellingNormalizer struct{}
+
+func (spellingNormalizer) NormalizeTags(tags []string) ([]string, error) {
+	var normalized []string
+	for _, tag := range tags {
+		if tag == "helth" {
+			return nil, fmt.Errorf(`unknown tag "helth", did you mean "health"?`)
+		}
+		normalized = append(normalized, strings.ToLower(tag))
+	}
+	return normalized, nil
+}
+
+func TestTaskPlugin_TagsNormalized(t *testing.T) {
+	p := NewPlugin().(*TaskPlugin)
+	p.SetTagNormalizer(spellingNormalizer{})
+
+	events, err := p.createTaskHandler(&CreateTaskInput{Title: "Book physio", Tags: []string{"Health"}})
+	if err != nil {
+		t.Fatalf("createTaskHandler failed: %v", err)
+	}
+	created := events[0].(*TaskCreatedEvent)
+	if strings.Join(created.Tags, ",") != "health" {
+		t.Errorf("Expected the canonical tag stored, got %v", created.Tags)
+	}
+	if _, err := p.createTaskHandler(&CreateTaskInput{Title: "Run", Tags: []string{"helth"}}); err == nil || !strings.Contains(err.Error(), "did you mean") {
+		t.Errorf("Expected the misspelled tag rejected with a suggestion, got %v", err)
+	}
+
+	p.aggregate.ApplyEvent(created)
+	items := p.aggregate.TaggedItems()
+	if len(items) != 1 || items[0].Title != "Book physio" || items[0].Aggregate != "taskmanager" {
+		t.Errorf("Expected the tagged task indexed, got %v", items)
+	}
+	events, err = p.updateTaskHandler(&UpdateTaskInput{TaskID: created.TaskID, Title: "Book the physio"})
+	if err != nil {
+		t.Fatalf("updateTaskHandler failed: %v", err)
+	}
+	if tags := events[0].(*TaskUpdatedEvent).Tags; tags != nil {
+		t.Errorf("Expected an update without tags to leave them alone, got %v", tags)
+	}
+}
+
+func newSubtaskPlugin(t *testing.T) *TaskPlugin {
+	p := NewPlugin().(*TaskPlugin)
+	for _, e := range []*TaskCreatedEvent{
+		{EventType: "taskmanager_TaskCreated", TaskID: "parent", Title: "Plan trip", Status: StatusPending},
+		{EventType: "taskmanager_TaskCreated", TaskID: "child1", Title: "Book flight", Status: StatusPending, ParentTaskID: "parent"},
+		{EventType: "taskmanager_TaskCreated", TaskID: "child2", Title: "Book hotel", Status: StatusPending, ParentTaskID: "parent"},
+	} {
+		if err := p.aggregate.ApplyEvent(e); err != nil {
+			t.Fatalf("ApplyEvent failed: %v", err)
+		}
+	}
+	return p
+}
+
+func TestTaskPlugin_CreateSubtask(t *testing.T) {
+	p := newSubtaskPlugin(t)
+
+	if _, err := p.createSubtaskHandler(&CreateSubtaskInput{ParentTaskID: "missing", Title: "Orphan"}); err == nil {
+		t.Error("Expected an error for a missing parent task")
+	}
+
+	events, err := p.createSubtaskHandler(&CreateSubtaskInput{ParentTaskID: "child1", Title: "Compare prices"})
+	if err != nil {
+		t.Fatalf("createSubtaskHandler failed: %v", err)
+	}
+	created, ok := events[0].(*TaskCreatedEvent)
+	if !ok || created.ParentTaskID != "child1" {
+		t.Fatalf("Expected a TaskCreated event under child1, got %+v", events[0])
+	}
+	p.aggregate.ApplyEvent(created)
+	if done, total := p.aggregate.subtaskProgress("child1"); done != 0 || total != 1 {
+		t.Errorf("Expected 0/1 subtasks done, got %d/%d", done, total)
+	}
+}
+
+func TestTaskPlugin_MoveTask(t *testing.T) {
+	p := newSubtaskPlugin(t)
+
+	if _, err := p.moveTaskHandler(&MoveTaskInput{TaskID: "parent", ParentTaskID: "child1"}); err == nil {
+		t.Error("Expected an error when moving a task under its own subtask")
+	}
+	if _, err := p.moveTaskHandler(&MoveTaskInput{TaskID: "parent", ParentTaskID: "parent"}); err == nil {
+		t.Error("Expected an error when moving a task under itself")
+	}
+
+	events, err := p.moveTaskHandler(&MoveTaskInput{TaskID: "child2"})
+	if err != nil {
+		t.Fatalf("moveTaskHandler failed: %v", err)
+	}
+	moved := events[0].(*TaskMovedEvent)
+	if moved.PreviousParentTaskID != "parent" || moved.ParentTaskID != "" {
+		t.Errorf("Unexpected move event: %+v", moved)
+	}
+	p.aggregate.ApplyEvent(moved)
+	if p.aggregate.Tasks["child2"].ParentTaskID != "" {
+		t.Error("Expected child2 to be a top-level task after the move")
+	}
+}
+
+func TestTaskPlugin_CompleteRollsUpToParent(t *testing.T) {
+	p := newSubtaskPlugin(t)
+
+	events, err := p.completeTaskHandler(&CompleteTaskInput{TaskID: "child1"})
+	if err != nil {
+		t.Fatalf("completeTaskHandler failed: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected only child1 to be completed while child2 is open, got %d events", len(events))
+	}
+	p.aggregate.ApplyEvent(events[0])
+
+	events, err = p.completeTaskHandler(&CompleteTaskInput{TaskID: "child2"})
+	if err != nil {
+		t.Fatalf("completeTaskHandler failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected child2 and its parent to be completed, got %d events", len(events))
+	}
+	if completed := events[1].(*TaskCompletedEvent); completed.TaskID != "parent" {
+		t.Errorf("Expected the parent to be completed, got %s", completed.TaskID)
+	}
+}
+
+func TestTaskPlugin_HandleInteraction(t *testing.T) {
+	p := newSubtaskPlugin(t)
+
+	command, input := p.HandleInteraction(eventsourcing.Interaction{Kind: eventsourcing.ObjectClicked, NodeID: "child1"})
+	if complete, ok := input.(*CompleteTaskInput); command != "CompleteTask" || !ok || complete.TaskID != "child1" {
+		t.Errorf("Expected a click to complete the task, got %s %+v", command, input)
+	}
+	p.aggregate.ApplyEvent(&TaskCompletedEvent{EventType: "taskmanager_TaskCompleted", TaskID: "child1"})
+	command, input = p.HandleInteraction(eventsourcing.Interaction{Kind: eventsourcing.ObjectClicked, NodeID: "child1"})
+	if update, ok := input.(*UpdateTaskInput); command != "UpdateTask" || !ok || update.Status != StatusPending {
+		t.Errorf("Expected a click to reopen the completed task, got %s %+v", command, input)
+	}
+	command, input = p.HandleInteraction(eventsourcing.Interaction{Kind: eventsourcing.ObjectDeleted, NodeID: "parent"})
+	if deletion, ok := input.(*DeleteTaskInput); command != "DeleteTask" || !ok || deletion.TaskID != "parent" {
+		t.Errorf("Expected the task deleted, got %s %+v", command, input)
+	}
+	for _, interaction := range []eventsourcing.Interaction{
+		{Kind: eventsourcing.ObjectMoved, NodeID: "parent", Position: []float64{1, 2, 3}},
+		{Kind: eventsourcing.ObjectClicked, NodeID: "calendar_event_event1"},
+	} {
+		if command, _ := p.HandleInteraction(interaction); command != "" {
+			t.Errorf("Expected %s of %s to be ignored, got %s", interaction.Kind, interaction.NodeID, command)
+		}
+	}
+}
+
+func TestTaskAggregate_DeleteReparentsSubtasks(t *testing.T) {
+	p := newSubtaskPlugin(t)
+	p.aggregate.ApplyEvent(&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "grandchild", Title: "Pick seat", Status: StatusPending, ParentTaskID: "child1"})
+
+	p.aggregate.ApplyEvent(&TaskDeletedEvent{EventType: "taskmanager_TaskDeleted", TaskID: "child1"})
+	if parentID := p.aggregate.Tasks["grandchild"].ParentTaskID; parentID != "parent" {
+		t.Errorf("Expected grandchild to move up to parent, got %q", parentID)
+	}
+}
+
+// focusEnded mirrors the focus plugin's SessionEnded event, which the task aggregate only sees through its JSON
+type focusEnded struct {
+	eventsourcing.EventMetadata
+	TaskID         string `json:"task_id"`
+	FocusedSeconds int    `json:"focused_seconds"`
+}
+
+func (e *focusEnded) Type() string                { return "focus_SessionEnded" }
+func (e *focusEnded) Marshal() ([]byte, error)    { return nil, nil }
+func (e *focusEnded) Unmarshal(data []byte) error { return nil }
+
+func TestTaskAggregate_FocusSessionsAddUp(t *testing.T) {
+	agg := NewTaskAggregate()
+	agg.ApplyEvent(&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "task1", Title: "Write report", Status: StatusPending})
+
+	for _, event := range []eventsourcing.Event{
+		&focusEnded{TaskID: "task1", FocusedSeconds: 1500},
+		&focusEnded{TaskID: "task1", FocusedSeconds: 600},
+		&focusEnded{TaskID: "unknown", FocusedSeconds: 900},
+	} {
+		if err := agg.ApplyEvent(event); err != nil {
+			t.Fatalf("ApplyEvent failed: %v", err)
+		}
+	}
+	if focused := agg.Tasks["task1"].FocusSeconds; focused != 2100 {
+		t.Errorf("Expected 2100 seconds of focus, got %d", focused)
+	}
+}
+
+func TestTaskAggregate_GetFull3DState_Subtasks(t *testing.T) {
+	agg := NewTaskAggregate()
+	agg.ApplyEvent(&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "parent", Title: "Plan trip", Status: StatusPending})
+	agg.ApplyEvent(&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "child", Title: "Book flight", Status: StatusPending, ParentTaskID: "parent"})
+
+	actions := agg.GetFull3DState()
+	if len(actions) != 4 {
+		t.Fatalf("Expected 4 actions (2 tasks with labels), got %d", len(actions))
+	}
+	if actions[0].NodeID != "parent" || actions[0].Properties["parent_id"] != nil {
+		t.Errorf("Expected the top-level task first without a parent, got %+v", actions[0])
+	}
+	child := actions[2]
+	if child.NodeID != "child" || child.Properties["parent_id"] != "parent" {
+		t.Errorf("Expected the subtask to be parented to its task, got %+v", child)
+	}
+	if _, ok := child.Properties["scale"]; !ok {
+		t.Error("Expected the subtask to be scaled down")
+	}
+}
+
+func TestTaskAggregate_Compensate(t *testing.T) {
+	p := newSubtaskPlugin(t)
+	agg := p.aggregate
+
+	// Deleting a task and undoing it restores the task and its subtasks
+	events, err := p.deleteTaskHandler(&DeleteTaskInput{TaskID: "parent"})
+	if err != nil {
+		t.Fatalf("deleteTaskHandler failed: %v", err)
+	}
+	agg.ApplyEvent(events[0])
+	compensations, err := agg.Compensate(events[0])
+	if err != nil {
+		t.Fatalf("Compensate failed: %v", err)
+	}
+	for _, event := range compensations {
+		agg.ApplyEvent(event)
+	}
+	if task, exists := agg.Tasks["parent"]; !exists || task.Title != "Plan trip" {
+		t.Fatalf("Expected the deleted task to be restored, got %+v", task)
+	}
+	if _, total := agg.subtaskProgress("parent"); total != 2 {
+		t.Errorf("Expected the subtasks to be moved back, got %d", total)
+	}
+
+	// Completing a task is undone by restoring its previous status
+	agg.ApplyEvent(&TaskUpdatedEvent{EventType: "taskmanager_TaskUpdated", TaskID: "child1", Status: StatusInProgress})
+	events, err = p.completeTaskHandler(&CompleteTaskInput{TaskID: "child1"})
+	if err != nil {
+		t.Fatalf("completeTaskHandler failed: %v", err)
+	}
+	agg.ApplyEvent(events[0])
+	compensations, _ = agg.Compensate(events[0])
+	agg.ApplyEvent(compensations[0])
+	if status := agg.Tasks["child1"].Status; status != StatusInProgress {
+		t.Errorf("Expected status %q after undo, got %q", StatusInProgress, status)
+	}
+
+	// Creating a task is undone by deleting it
+	compensations, _ = agg.Compensate(&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "child2"})
+	if deleted, ok := compensations[0].(*TaskDeletedEvent); !ok || deleted.TaskID != "child2" {
+		t.Errorf("Expected child2 to be deleted, got %+v", compensations)
+	}
+
+	// Events that don't change tasks have nothing to undo
+	if compensations, err := agg.Compensate(&TasksListedEvent{}); err != nil || compensations != nil {
+		t.Errorf("Expected nothing to undo for a listing, got %v, %v", compensations, err)
+	}
+}
+
+func TestTaskAggregate_Conflicts(t *testing.T) {
+	agg := NewTaskAggregate()
+	concurrent := []eventsourcing.Event{
+		&TaskUpdatedEvent{EventType: "taskmanager_TaskUpdated", TaskID: "a", Title: "Renamed"},
+		&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "c"},
+	}
+
+	cases := []struct {
+		name     string
+		event    eventsourcing.Event
+		conflict bool
+	}{
+		{"update of the same task", &TaskUpdatedEvent{EventType: "taskmanager_TaskUpdated", TaskID: "a", Priority: PriorityHigh}, true},
+		{"deletion of the same task", &TaskDeletedEvent{EventType: "taskmanager_TaskDeleted", TaskID: "a"}, true},
+		{"subtask of the changed task", &TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "b", ParentTaskID: "a"}, true},
+		{"update of another task", &TaskUpdatedEvent{EventType: "taskmanager_TaskUpdated", TaskID: "b"}, false},
+		{"new top-level task", &TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "d"}, false},
+	}
+	for _, c := range cases {
+		if got := agg.Conflicts([]eventsourcing.Event{c.event}, concurrent); got != c.conflict {
+			t.Errorf("%s: expected conflict %v, got %v", c.name, c.conflict, got)
+		}
+	}
+}
+
+func TestTaskPlugin_Configure(t *testing.T) {
+	p := NewPlugin().(*TaskPlugin)
+	if err := p.Configure(map[string]interface{}{"default_priority": "Urgent"}); err == nil {
+		t.Error("Expected an error for an unknown priority")
+	}
+	if err := p.Configure(map[string]interface{}{"default_priority": PriorityHigh}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	events, err := p.createTaskHandler(&CreateTaskInput{Title: "Call the bank"})
+	if err != nil {
+		t.Fatalf("createTaskHandler failed: %v", err)
+	}
+	if priority := events[0].(*TaskCreatedEvent).Priority; priority != PriorityHigh {
+		t.Errorf("Expected the configured priority %q, got %q", PriorityHigh, priority)
+	}
+
+	// Without settings new tasks are low priority again
+	p.Configure(map[string]interface{}{})
+	events, _ = p.createTaskHandler(&CreateTaskInput{Title: "Call the bank"})
+	if priority := events[0].(*TaskCreatedEvent).Priority; priority != PriorityLow {
+		t.Errorf("Expected priority %q, got %q", PriorityLow, priority)
+	}
+}
+
+// fakeTracker is an in-memory issue tracker that, like Todoist, forgets completed tasks
+type fakeTracker struct {
+	tasks  map[string]ExternalTask
+	nextID int
+}
+
+func (f *fakeTracker) Name() string { return "todoist" }
+
+func (f *fakeTracker) List(ctx context.Context) ([]ExternalTask, error) {
+	var tasks []ExternalTask
+	for _, task := range f.tasks {
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+func (f *fakeTracker) Create(ctx context.Context, task ExternalTask) (ExternalTask, error) {
+	f.nextID++
+	task.ID = fmt.Sprint(f.nextID)
+	f.tasks[task.ID] = task
+	return task, nil
+}
+
+func (f *fakeTracker) Update(ctx context.Context, task ExternalTask) (ExternalTask, error) {
+	if task.Status == StatusCompleted {
+		delete(f.tasks, task.ID)
+	} else {
+		f.tasks[task.ID] = task
+	}
+	return task, nil
+}
+
+func (f *fakeTracker) byTitle(title string) (ExternalTask, bool) {
+	for _, task := range f.tasks {
+		if task.Title == title {
+			return task, true
+		}
+	}
+	return ExternalTask{}, false
+}
+
+func applyAll(t *testing.T, agg *TaskAggregate, events []eventsourcing.Event) {
+	t.Helper()
+	for _, event := range events {
+		if err := agg.ApplyEvent(event); err != nil {
+			t.Fatalf("ApplyEvent %s failed: %v", event.Type(), err)
+		}
+	}
+}
+
+func syncWith(t *testing.T, p *TaskPlugin, direction string) *TasksSyncedEvent {
+	t.Helper()
+	events, err := p.syncTasksHandler(&SyncTasksInput{Direction: direction})
+	if err != nil {
+		t.Fatalf("SyncTasks failed: %v", err)
+	}
+	applyAll(t, p.aggregate, events)
+	summary := events[len(events)-1].(*TasksSyncedEvent)
+	if summary.Error != "" {
+		t.Fatalf("Sync failed: %s", summary.Error)
+	}
+	return summary
+}
+
+func taskByTitle(agg *TaskAggregate, title string) *Task {
+	for _, task := range agg.Tasks {
+		if task.Title == title {
+			return task
+		}
+	}
+	return nil
+}
+
+func TestTaskPlugin_SyncTasks(t *testing.T) {
+	tracker := &fakeTracker{tasks: map[string]ExternalTask{
+		"100": {ID: "100", Title: "Renew passport", Status: StatusPending, Priority: PriorityHigh, Tags: []string{"admin"}},
+	}, nextID: 100}
+	p := NewPlugin().(*TaskPlugin)
+	p.trackers = map[string]Tracker{"todoist": tracker}
+	events, _ := p.createTaskHandler(&CreateTaskInput{Title: "Water the plants", Priority: PriorityMedium})
+	applyAll(t, p.aggregate, events)
+
+	// Import only leaves the local task alone
+	if s := syncWith(t, p, SyncImport); s.Imported != 1 || s.Exported != 0 {
+		t.Fatalf("Expected one import, got %+v", s)
+	}
+	passport := taskByTitle(p.aggregate, "Renew passport")
+	if passport == nil || passport.Priority != PriorityHigh || len(passport.Tags) != 1 {
+		t.Fatalf("Expected the tracker's task imported, got %+v", passport)
+	}
+	if s := syncWith(t, p, ""); s.Exported != 1 || s.Imported != 0 || len(tracker.tasks) != 2 {
+		t.Fatalf("Expected the local task exported, got %+v", s)
+	}
+
+	// Local changes are pushed, tracker changes pulled
+	events, _ = p.updateTaskHandler(&UpdateTaskInput{TaskID: passport.TaskID, Status: StatusInProgress})
+	applyAll(t, p.aggregate, events)
+	plants, _ := tracker.byTitle("Water the plants")
+	plants.Priority = PriorityCritical
+	tracker.tasks[plants.ID] = plants
+	if s := syncWith(t, p, SyncBoth); s.Pushed != 1 || s.Pulled != 1 || s.Conflicts != 0 {
+		t.Errorf("Expected one push and one pull, got %+v", s)
+	}
+	if remote, _ := tracker.byTitle("Renew passport"); remote.Status != StatusInProgress {
+		t.Errorf("Expected the status pushed, got %q", remote.Status)
+	}
+	if taskByTitle(p.aggregate, "Water the plants").Priority != PriorityCritical {
+		t.Error("Expected the priority pulled")
+	}
+	if s := syncWith(t, p, SyncBoth); s.Pushed+s.Pulled+s.Imported+s.Exported != 0 {
+		t.Errorf("Expected nothing to sync, got %+v", s)
+	}
+
+	// Changes on both sides: the tracker wins
+	plants, _ = tracker.byTitle("Water the plants")
+	plants.Title = "Water the garden"
+	tracker.tasks[plants.ID] = plants
+	local := taskByTitle(p.aggregate, "Water the plants")
+	events, _ = p.updateTaskHandler(&UpdateTaskInput{TaskID: local.TaskID, Title: "Water the balcony"})
+	applyAll(t, p.aggregate, events)
+	if s := syncWith(t, p, SyncBoth); s.Conflicts != 1 || local.Title != "Water the garden" {
+		t.Errorf("Expected the tracker's change to win, got %+v and %q", s, local.Title)
+	}
+
+	// Completing pushes a close, closing in the tracker completes locally
+	events, _ = p.completeTaskHandler(&CompleteTaskInput{TaskID: passport.TaskID})
+	applyAll(t, p.aggregate, events)
+	delete(tracker.tasks, plants.ID)
+	if s := syncWith(t, p, SyncBoth); s.Pushed != 1 || s.Closed != 1 {
+		t.Errorf("Expected a push and a close, got %+v", s)
+	}
+	if len(tracker.tasks) != 0 || local.Status != StatusCompleted {
+		t.Errorf("Expected both tasks completed on both sides, got %v and %q", tracker.tasks, local.Status)
+	}
+	syncWith(t, p, SyncBoth)
+	if len(p.aggregate.Links) != 0 {
+		t.Errorf("Expected the completed tasks unlinked, got %v", p.aggregate.Links)
+	}
+}
+
+func TestTaskPlugin_SyncTasksProgress(t *testing.T) {
+	tracker := &fakeTracker{tasks: map[string]ExternalTask{}}
+	p := NewPlugin().(*TaskPlugin)
+	p.trackers = map[string]Tracker{"todoist": tracker}
+	for _, title := range []string{"Water the plants", "Renew passport"} {
+		events, _ := p.createTaskHandler(&CreateTaskInput{Title: title})
+		applyAll(t, p.aggregate, events)
+	}
+
+	input := &SyncTasksInput{}
+	var reports []string
+	input.SetProgressFunc(func(percent int, message string) {
+		reports = append(reports, fmt.Sprintf("%d %s", percent, message))
+	})
+	if _, err := p.syncTasksHandler(input); err != nil {
+		t.Fatalf("SyncTasks failed: %v", err)
+	}
+	want := []string{
+		"0 Listing the tasks in todoist",
+		"20 Comparing 0 tasks of todoist",
+		`50 Exporting "Water the plants" to todoist`,
+		`75 Exporting "Renew passport" to todoist`,
+		"100 Synced with todoist",
+	}
+	if strings.Join(reports, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected the progress of each export, got %q", reports)
+	}
+}
+
+func TestTaskPlugin_SyncTasksConfiguration(t *testing.T) {
+	p := NewPlugin().(*TaskPlugin)
+	if _, err := p.syncTasksHandler(&SyncTasksInput{}); err == nil || !strings.Contains(err.Error(), "no issue tracker") {
+		t.Errorf("Expected an error without trackers, got %v", err)
+	}
+	if err := p.Configure(map[string]interface{}{"github_repo": "mindpalace"}); err == nil {
+		t.Error("Expected an error for a repository without owner")
+	}
+	if err := p.Configure(map[string]interface{}{"github_repo": "me/mindpalace", "todoist_token": "secret"}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	if _, err := p.syncTasksHandler(&SyncTasksInput{}); err == nil || !strings.Contains(err.Error(), "name the tracker") {
+		t.Errorf("Expected an error for an ambiguous tracker, got %v", err)
+	}
+	if _, err := p.syncTasksHandler(&SyncTasksInput{Tracker: "github", Direction: "sideways"}); err == nil {
+		t.Error("Expected an error for an invalid direction")
+	}
+}
+
+func TestGitHubTracker(t *testing.T) {
+	var patched map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/me/mindpalace/issues":
+			fmt.Fprint(w, `[
+				{"number": 1, "title": "Fix login", "body": "It fails", "state": "open",
+				 "labels": [{"name": "Priority: High"}, {"name": "in progress"}, {"name": "bug"}]},
+				{"number": 2, "title": "Add tests", "state": "open", "labels": [], "pull_request": {"url": "x"}},
+				{"number": 3, "title": "Old issue", "state": "closed", "labels": []}
+			]`)
+		case r.Method == http.MethodPatch && r.URL.Path == "/repos/me/mindpalace/issues/1":
+			json.NewDecoder(r.Body).Decode(&patched)
+			fmt.Fprint(w, `{"number": 1, "title": "Fix login", "state": "closed", "labels": [{"name": "priority: high"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tracker := &GitHubTracker{Repo: "me/mindpalace", Token: "secret", BaseURL: server.URL}
+	tasks, err := tracker.List(context.Background())
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("Expected the issues without the pull request, got %+v", tasks)
+	}
+	fix := tasks[0]
+	if fix.ID != "1" || fix.Priority != PriorityHigh || fix.Status != StatusInProgress || len(fix.Tags) != 1 || fix.Tags[0] != "bug" {
+		t.Errorf("Unexpected mapping of the issue: %+v", fix)
+	}
+	if tasks[1].Status != StatusCompleted {
+		t.Errorf("Expected the closed issue completed, got %q", tasks[1].Status)
+	}
+
+	fix.Status = StatusCompleted
+	closed, err := tracker.Update(context.Background(), fix)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if patched["state"] != "closed" || closed.Status != StatusCompleted {
+		t.Errorf("Expected the issue closed, sent %v", patched)
+	}
+	if labels := fmt.Sprint(patched["labels"]); labels != "[bug priority: high]" {
+		t.Errorf("Unexpected labels %s", labels)
+	}
+}
+
+func TestTodoistTracker(t *testing.T) {
+	var created map[string]interface{}
+	closed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/tasks":
+			fmt.Fprint(w, `[{"id": "7", "content": "Buy milk", "priority": 4, "labels": ["blocked", "shopping"],
+				"due": {"date": "2024-03-01", "datetime": "2024-03-01T09:00:00Z"}}]`)
+		case r.Method == http.MethodPost && r.URL.Path == "/tasks":
+			json.NewDecoder(r.Body).Decode(&created)
+			fmt.Fprint(w, `{"id": "8", "content": "Call mom", "priority": 2, "labels": []}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/tasks/7":
+			fmt.Fprint(w, `{"id": "7", "content": "Buy milk", "priority": 4, "labels": ["shopping"]}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/tasks/7/close":
+			closed = true
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tracker := &TodoistTracker{Token: "secret", BaseURL: server.URL}
+	tasks, err := tracker.List(context.Background())
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	milk := tasks[0]
+	if milk.Priority != PriorityCritical || milk.Status != StatusBlocked || !milk.Deadline.Equal(time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected mapping of the task: %+v", milk)
+	}
+
+	call, err := tracker.Create(context.Background(), ExternalTask{Title: "Call mom", Status: StatusPending, Priority: PriorityMedium})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if call.ID != "8" || created["priority"] != float64(2) || created["due_string"] != nil {
+		t.Errorf("Unexpected creation %+v from %v", call, created)
+	}
+
+	milk.Status = StatusCompleted
+	if _, err := tracker.Update(context.Background(), milk); err != nil || !closed {
+		t.Errorf("Expected the task closed, got %v", err)
+	}
+}
+
+func TestTaskPlugin_ListDueTasks(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "readmodels.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+	projection := NewPlugin().(*TaskPlugin).Projections()[0]
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if err := projection.Setup(tx); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	now := time.Now().UTC()
+	due := func(days int) string { return now.AddDate(0, 0, days).Format(time.RFC3339) }
+	alicesTask := &TaskCreatedEvent{TaskID: "task1", Title: "Alice's task", Status: StatusPending, Priority: PriorityLow, Deadline: due(1)}
+	alicesTask.Metadata().UserID = "alice"
+	for _, event := range []eventsourcing.Event{
+		&TaskCreatedEvent{TaskID: "task1", Title: "Report", Status: StatusPending, Priority: PriorityHigh, Deadline: due(3)},
+		&TaskCreatedEvent{TaskID: "task2", Title: "Taxes", Status: StatusPending, Priority: PriorityMedium, Deadline: due(30)},
+		&TaskCreatedEvent{TaskID: "task3", Title: "Groceries", Status: StatusPending, Priority: PriorityLow},
+		&TaskCreatedEvent{TaskID: "task4", Title: "Call", Status: StatusPending, Priority: PriorityLow, Deadline: due(2)},
+		&TaskUpdatedEvent{TaskID: "task2", Deadline: due(-1)}, // Overdue
+		&TaskUpdatedEvent{TaskID: "task1", Title: "Quarterly report"},
+		&TaskCompletedEvent{TaskID: "task4"},
+		alicesTask,
+	} {
+		if err := projection.Project(tx, event); err != nil {
+			t.Fatalf("Project(%s) failed: %v", event.Type(), err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	p := NewPlugin().(*TaskPlugin)
+	if _, err := p.listDueTasksHandler(&ListDueTasksInput{}); err == nil {
+		t.Error("Expected an error without read models")
+	}
+	p.SetReadModels(db, "")
+	events, err := p.listDueTasksHandler(&ListDueTasksInput{})
+	if err != nil {
+		t.Fatalf("ListDueTasks failed: %v", err)
+	}
+	tasks := events[0].(*TasksListedEvent).Tasks
+	if len(tasks) != 2 || tasks[0].TaskID != "task2" || tasks[1].Title != "Quarterly report" || tasks[1].Priority != PriorityHigh {
+		t.Errorf("Expected the overdue taxes and the report, got %+v", tasks)
+	}
+	if tasks[1].Deadline.Format(time.RFC3339) != due(3) {
+		t.Errorf("Expected the report's deadline %s, got %s", due(3), tasks[1].Deadline)
+	}
+
+	p.SetReadModels(db, "alice")
+	events, _ = p.listDueTasksHandler(&ListDueTasksInput{Days: 2})
+	if tasks := events[0].(*TasksListedEvent).Tasks; len(tasks) != 1 || tasks[0].Title != "Alice's task" {
+		t.Errorf("Expected alice's own task only, got %+v", tasks)
+	}
+}
+
+func TestTaskBoardCommands(t *testing.T) {
+	task := Task{TaskID: "task1", Title: "Write report", Description: "Quarterly", Status: StatusPending, Priority: PriorityLow}
+
+	if command, _ := moveCommand(task, StatusPending); command != "" {
+		t.Errorf("Expected no command dropping a card in its own column, got %s", command)
+	}
+	if command, _ := moveCommand(task, ""); command != "" {
+		t.Errorf("Expected no command dropping a card outside the columns, got %s", command)
+	}
+	command, input := moveCommand(task, StatusBlocked)
+	if update, ok := input.(*UpdateTaskInput); command != "UpdateTask" || !ok || update.TaskID != "task1" || update.Status != StatusBlocked {
+		t.Errorf("Expected the task updated to Blocked, got %s %+v", command, input)
+	}
+	command, input = moveCommand(task, StatusCompleted)
+	if complete, ok := input.(*CompleteTaskInput); command != "CompleteTask" || !ok || complete.TaskID != "task1" {
+		t.Errorf("Expected the task completed, got %s %+v", command, input)
+	}
+
+	if input := editInput(task, " Write report ", "", PriorityLow); input != nil {
+		t.Errorf("Expected no update when nothing changed, got %+v", input)
+	}
+	update := editInput(task, "Write the report", "Quarterly", PriorityHigh)
+	if update == nil || update.Title != "Write the report" || update.Description != "" || update.Priority != PriorityHigh || update.Status != "" {
+		t.Errorf("Expected the title and priority updated, got %+v", update)
+	}
+}
+
+func TestTaskPlugin_SetCommandFunc(t *testing.T) {
+	p := NewPlugin().(*TaskPlugin)
+	var issuer eventsourcing.CommandIssuer = p
+	issuer.SetCommandFunc(func(command string, input any) error { return nil })
+	if p.aggregate.execute == nil {
+		t.Error("Expected the board to issue commands")
+	}
+}
+
+func TestTaskPlugin_BulkCommands(t *testing.T) {
+	p := newSubtaskPlugin(t)
+	agg := p.aggregate
+	applyAll(t, agg, []eventsourcing.Event{
+		&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "milk", Title: "Buy milk", Status: StatusPending, Tags: []string{"errands"}, Deadline: "2024-03-01T09:00:00Z"},
+		&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "post", Title: "Post letter", Status: StatusInProgress, Tags: []string{"errands"}, Deadline: "2024-03-05T09:00:00Z"},
+		&TaskUpdatedEvent{EventType: "taskmanager_TaskUpdated", TaskID: "child1", Tags: []string{"trip"}},
+		&TaskUpdatedEvent{EventType: "taskmanager_TaskUpdated", TaskID: "child2", Tags: []string{"trip"}},
+	})
+
+	if _, err := p.bulkCompleteTasksHandler(&BulkCompleteTasksInput{}); err == nil {
+		t.Error("Expected an error without filters")
+	}
+	if _, err := p.bulkDeleteTasksHandler(&BulkDeleteTasksInput{TaskFilter{FilterTag: "work"}}); err == nil {
+		t.Error("Expected an error when no task matches")
+	}
+
+	// Completing everything tagged errands is one event, undone as one
+	events, err := p.bulkCompleteTasksHandler(&BulkCompleteTasksInput{TaskFilter: TaskFilter{FilterTag: "errands"}})
+	if err != nil {
+		t.Fatalf("bulkCompleteTasksHandler failed: %v", err)
+	}
+	bulk := events[0].(*TasksBulkChangedEvent)
+	if len(events) != 1 || len(bulk.Completions) != 2 {
+		t.Fatalf("Expected one event completing both errands, got %+v", events)
+	}
+	applyAll(t, agg, events)
+	if agg.Tasks["milk"].Status != StatusCompleted || agg.Tasks["post"].Status != StatusCompleted || agg.Tasks["parent"].Status == StatusCompleted {
+		t.Errorf("Expected the errands completed only, got %+v", agg.Tasks)
+	}
+	compensations, err := agg.Compensate(bulk)
+	if err != nil {
+		t.Fatalf("Compensate failed: %v", err)
+	}
+	applyAll(t, agg, compensations)
+	if agg.Tasks["milk"].Status != StatusPending || agg.Tasks["post"].Status != StatusInProgress {
+		t.Errorf("Expected the errands reopened after undo, got %q and %q", agg.Tasks["milk"].Status, agg.Tasks["post"].Status)
+	}
+
+	// Completing all subtasks of a task completes it once
+	events, _ = p.bulkCompleteTasksHandler(&BulkCompleteTasksInput{TaskFilter: TaskFilter{FilterTag: "trip"}})
+	if completions := events[0].(*TasksBulkChangedEvent).Completions; len(completions) != 3 || completions[2].TaskID != "parent" {
+		t.Errorf("Expected both subtasks and their parent completed, got %+v", completions)
+	}
+
+	// Updating the tasks due in a range
+	events, err = p.bulkUpdateTasksHandler(&BulkUpdateTasksInput{
+		TaskFilter: TaskFilter{DueFrom: "2024-03-01T00:00:00Z", DueUntil: "2024-03-02T00:00:00Z"},
+		Priority:   PriorityHigh,
+	})
+	if err != nil {
+		t.Fatalf("bulkUpdateTasksHandler failed: %v", err)
+	}
+	applyAll(t, agg, events)
+	if agg.Tasks["milk"].Priority != PriorityHigh || agg.Tasks["post"].Priority == PriorityHigh {
+		t.Errorf("Expected only the milk due on March 1 updated, got %q and %q", agg.Tasks["milk"].Priority, agg.Tasks["post"].Priority)
+	}
+	if _, err := p.bulkUpdateTasksHandler(&BulkUpdateTasksInput{TaskFilter: TaskFilter{FilterTag: "errands"}}); err == nil {
+		t.Error("Expected an error with nothing to update")
+	}
+
+	// Deleting them needs confirmation and conflicts with concurrent changes of any of them
+	if !p.RequiresConfirmation("BulkDeleteTasks") {
+		t.Error("Expected bulk deletes to be confirmed")
+	}
+	events, _ = p.bulkDeleteTasksHandler(&BulkDeleteTasksInput{TaskFilter{FilterStatus: StatusInProgress}})
+	concurrent := []eventsourcing.Event{&TaskUpdatedEvent{EventType: "taskmanager_TaskUpdated", TaskID: "post", Title: "Post letters"}}
+	if !agg.Conflicts(events, concurrent) {
+		t.Error("Expected a conflict with a concurrent change of a deleted task")
+	}
+	applyAll(t, agg, events)
+	if _, exists := agg.Tasks["post"]; exists || len(agg.Tasks) != 4 {
+		t.Errorf("Expected the task in progress deleted, got %v", agg.Tasks)
+	}
+}
+
+// fixedLinks links every task to the same items
+type fixedLinks []eventsourcing.Item
+
+func (l fixedLinks) LinkedItems(aggregate, id string) []eventsourcing.Item { return l }
+
+func TestTaskPlugin_LinkedItems(t *testing.T) {
+	p := NewPlugin().(*TaskPlugin)
+	p.aggregate.ApplyEvent(&TaskCreatedEvent{EventType: "taskmanager_TaskCreated", TaskID: "task1", Title: "Prepare slides"})
+
+	item, exists := p.aggregate.Item("task1")
+	if !exists || item.Title != "Prepare slides" || item.Aggregate != "taskmanager" || item.NodeID != "task1" {
+		t.Errorf("Expected the task as an item, got %+v", item)
+	}
+	if _, exists := p.aggregate.Item("task9"); exists {
+		t.Error("Expected no item for a missing task")
+	}
+
+	if text := p.aggregate.GetFull3DState()[1].Properties["text"]; text != "Prepare slides" {
+		t.Errorf("Expected no badge without links, got %v", text)
+	}
+	var aware eventsourcing.LinkAware = p
+	aware.SetLinkSource(fixedLinks{{Aggregate: "calendar", ID: "e1", Title: "Friday meeting"}})
+	if text := p.aggregate.GetFull3DState()[1].Properties["text"]; text != "Prepare slides  ↔1" {
+		t.Errorf("Expected the label to count the linked item, got %v", text)
+	}
+}
+
+func TestTaskPlugin_Examples(t *testing.T) {
+	p := NewPlugin().(*TaskPlugin)
+	for _, example := range p.Examples() {
+		schema, exists := p.Schemas()[example.Command]
+		if !exists {
+			t.Errorf("Example %q calls unknown command %s", example.Request, example.Command)
+			continue
+		}
+		data, _ := json.Marshal(example.Arguments)
+		decoder := json.NewDecoder(strings.NewReader(string(data)))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(schema.New()); err != nil {
+			t.Errorf("Example %q has arguments %s doesn't take: %v", example.Request, example.Command, err)
+		}
+	}
+}
+
+// fuzzSkipped are the commands reaching the issue trackers
+var fuzzSkipped = []string{"SyncTasks"}
+
+func TestCommands_Fuzz(t *testing.T) {
+	fuzzer := eventsourcing.NewCommandFuzzer(NewPlugin(), 1)
+	fuzzer.Skip = fuzzSkipped
+	for _, err := range fuzzer.Run(200) {
+		t.Error(err)
+	}
+}
+
+func FuzzCommands(f *testing.F) {
+	f.Add(int64(1))
+	f.Fuzz(func(t *testing.T, seed int64) {
+		fuzzer := eventsourcing.NewCommandFuzzer(NewPlugin(), seed)
+		fuzzer.Skip = fuzzSkipped
+		for _, err := range fuzzer.Run(10) {
+			t.Error(err)
+		}
+	})
+}
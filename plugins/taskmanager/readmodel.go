@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+)
+
+// dueProjection keeps the open tasks of every user with their deadlines in the taskmanager_due table,
+// so the tasks due soon are found without going through all tasks
+type dueProjection struct{}
+
+func (dueProjection) Name() string { return "taskmanager_due" }
+func (dueProjection) Version() int { return 1 }
+
+func (dueProjection) Setup(tx *sql.Tx) error {
+	for _, stmt := range []string{
+		"DROP TABLE IF EXISTS taskmanager_due",
+		`CREATE TABLE taskmanager_due (
+			user_id TEXT NOT NULL,
+			task_id TEXT NOT NULL,
+			title TEXT NOT NULL,
+			status TEXT NOT NULL,
+			priority TEXT NOT NULL,
+			deadline INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (user_id, task_id)
+		)`,
+		"CREATE INDEX taskmanager_due_deadline ON taskmanager_due (user_id, deadline)",
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d dueProjection) Project(tx *sql.Tx, event eventsourcing.Event) error {
+	return d.project(tx, event.Metadata().UserID, event)
+}
+
+// project updates the rows of the user for an event, the changes of a bulk event one by one
+func (d dueProjection) project(tx *sql.Tx, userID string, event eventsourcing.Event) error {
+	var err error
+	switch e := event.(type) {
+	case *TaskCreatedEvent:
+		_, err = tx.Exec("INSERT OR REPLACE INTO taskmanager_due (user_id, task_id, title, status, priority, deadline) VALUES (?, ?, ?, ?, ?, ?)",
+			userID, e.TaskID, e.Title, e.Status, e.Priority, unixTime(e.Deadline))
+	case *TaskUpdatedEvent:
+		// Fields left empty keep their value
+		_, err = tx.Exec(`UPDATE taskmanager_due SET
+			title = COALESCE(NULLIF(?, ''), title),
+			status = COALESCE(NULLIF(?, ''), status),
+			priority = COALESCE(NULLIF(?, ''), priority),
+			deadline = COALESCE(NULLIF(?, 0), deadline)
+			WHERE user_id = ? AND task_id = ?`,
+			e.Title, e.Status, e.Priority, unixTime(e.Deadline), userID, e.TaskID)
+	case *TaskCompletedEvent:
+		_, err = tx.Exec("UPDATE taskmanager_due SET status = ? WHERE user_id = ? AND task_id = ?", StatusCompleted, userID, e.TaskID)
+	case *TaskDeletedEvent:
+		_, err = tx.Exec("DELETE FROM taskmanager_due WHERE user_id = ? AND task_id = ?", userID, e.TaskID)
+	case *TasksBulkChangedEvent:
+		for _, change := range e.changes() {
+			if err = d.project(tx, userID, change); err != nil {
+				break
+			}
+		}
+	}
+	return err
+}
+
+// unixTime returns the seconds of an RFC 3339 time, 0 if there is none
+func unixTime(value string) int64 {
+	t := parseTime(value)
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// Projections returns the read models of the task manager
+func (p *TaskPlugin) Projections() []eventsourcing.Projection {
+	return []eventsourcing.Projection{dueProjection{}}
+}
+
+// SetReadModels gives the plugin the read models, of which it reads the rows of the user
+func (p *TaskPlugin) SetReadModels(db *sql.DB, userID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readModels = db
+	p.userID = userID
+}
+
+func (i *ListDueTasksInput) New() any {
+	return &ListDueTasksInput{}
+}
+
+// ListDueTasksInput defines the input for listing the open tasks due soon
+type ListDueTasksInput struct {
+	Days int `json:"Days,omitempty"`
+}
+
+func (l *ListDueTasksInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Lists the open tasks with a deadline in the coming days, including overdue ones, soonest first",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Days": map[string]interface{}{
+					"type":        "integer",
+					"description": "Number of days ahead to look, 7 if not given",
+				},
+			},
+		},
+	}
+}
+
+// listDueTasksHandler answers from the taskmanager_due read model
+func (p *TaskPlugin) listDueTasksHandler(input *ListDueTasksInput) ([]eventsourcing.Event, error) {
+	p.mu.RLock()
+	db, userID := p.readModels, p.userID
+	p.mu.RUnlock()
+	if db == nil {
+		return nil, fmt.Errorf("the read models are not available")
+	}
+	days := input.Days
+	if days <= 0 {
+		days = 7
+	}
+	until := time.Now().AddDate(0, 0, days)
+	rows, err := db.Query(`SELECT task_id, title, status, priority, deadline FROM taskmanager_due
+		WHERE user_id = ? AND deadline > 0 AND deadline <= ? AND status != ?
+		ORDER BY deadline, task_id`, userID, until.Unix(), StatusCompleted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the tasks due: %v", err)
+	}
+	defer rows.Close()
+	tasks := []*Task{}
+	for rows.Next() {
+		task := &Task{}
+		var deadline int64
+		if err := rows.Scan(&task.TaskID, &task.Title, &task.Status, &task.Priority, &deadline); err != nil {
+			return nil, err
+		}
+		task.Deadline = time.Unix(deadline, 0).UTC()
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return []eventsourcing.Event{&TasksListedEvent{EventType: "taskmanager_TasksListed", Tasks: tasks}}, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// todoistPriorities maps Todoist priorities, 1 (normal) to 4 (urgent), to task priorities
+var todoistPriorities = []string{PriorityLow, PriorityMedium, PriorityHigh, PriorityCritical}
+
+// TodoistTracker syncs tasks with Todoist. The In Progress and Blocked statuses are kept as
+// "in progress" and "blocked" labels.
+type TodoistTracker struct {
+	Token   string
+	BaseURL string // Defaults to https://api.todoist.com/rest/v2
+	HTTP    *http.Client
+}
+
+type todoistTask struct {
+	ID          string   `json:"id"`
+	URL         string   `json:"url"`
+	Content     string   `json:"content"`
+	Description string   `json:"description"`
+	Priority    int      `json:"priority"`
+	Labels      []string `json:"labels"`
+	Due         *struct {
+		Date     string `json:"date"`
+		Datetime string `json:"datetime,omitempty"`
+	} `json:"due"`
+}
+
+// Name returns "todoist"
+func (t *TodoistTracker) Name() string {
+	return "todoist"
+}
+
+// List returns the active tasks, Todoist doesn't list completed ones
+func (t *TodoistTracker) List(ctx context.Context) ([]ExternalTask, error) {
+	var tasks []todoistTask
+	if err := t.do(ctx, http.MethodGet, "/tasks", nil, &tasks); err != nil {
+		return nil, err
+	}
+	external := make([]ExternalTask, 0, len(tasks))
+	for _, task := range tasks {
+		external = append(external, task.task())
+	}
+	return external, nil
+}
+
+// Create adds the task
+func (t *TodoistTracker) Create(ctx context.Context, task ExternalTask) (ExternalTask, error) {
+	var created todoistTask
+	if err := t.do(ctx, http.MethodPost, "/tasks", todoistRequest(task, false), &created); err != nil {
+		return task, err
+	}
+	return created.task(), nil
+}
+
+// Update edits the task, closing it when it is completed
+func (t *TodoistTracker) Update(ctx context.Context, task ExternalTask) (ExternalTask, error) {
+	var updated todoistTask
+	if err := t.do(ctx, http.MethodPost, "/tasks/"+task.ID, todoistRequest(task, true), &updated); err != nil {
+		return task, err
+	}
+	result := updated.task()
+	if task.Status == StatusCompleted {
+		if err := t.do(ctx, http.MethodPost, "/tasks/"+task.ID+"/close", nil, nil); err != nil {
+			return task, err
+		}
+		result.Status = StatusCompleted
+	}
+	return result, nil
+}
+
+// task maps the Todoist task to a task
+func (t todoistTask) task() ExternalTask {
+	status, tags := statusFromLabels(t.Labels)
+	task := ExternalTask{
+		ID:          t.ID,
+		URL:         t.URL,
+		Title:       t.Content,
+		Description: t.Description,
+		Status:      status,
+		Priority:    PriorityLow,
+		Tags:        tags,
+	}
+	if t.Priority >= 1 && t.Priority <= len(todoistPriorities) {
+		task.Priority = todoistPriorities[t.Priority-1]
+	}
+	if t.Due != nil {
+		task.Deadline = parseTodoistDue(t.Due.Datetime, t.Due.Date)
+	}
+	return task
+}
+
+// parseTodoistDue parses a due time, which is UTC or floating, or else a due date
+func parseTodoistDue(datetime, date string) time.Time {
+	if due, err := time.Parse(time.RFC3339, datetime); err == nil {
+		return due
+	}
+	if due, err := time.ParseInLocation("2006-01-02T15:04:05", datetime, time.Local); err == nil {
+		return due
+	}
+	due, _ := time.ParseInLocation("2006-01-02", date, time.Local)
+	return due
+}
+
+// todoistRequest returns the fields of a Todoist task for the task. Updates clear a removed deadline.
+func todoistRequest(task ExternalTask, update bool) map[string]interface{} {
+	request := map[string]interface{}{
+		"content":     task.Title,
+		"description": task.Description,
+		"labels":      statusLabels(task),
+		"priority":    1,
+	}
+	for i, priority := range todoistPriorities {
+		if priority == task.Priority {
+			request["priority"] = i + 1
+		}
+	}
+	if !task.Deadline.IsZero() {
+		request["due_datetime"] = task.Deadline.UTC().Format(time.RFC3339)
+	} else if update {
+		request["due_string"] = "no date"
+	}
+	return request
+}
+
+func (t *TodoistTracker) do(ctx context.Context, method, path string, request, response interface{}) error {
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %v", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	baseURL := t.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.todoist.com/rest/v2"
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(baseURL, "/")+path, body)
+	if err != nil {
+		return fmt.Errorf("invalid Todoist request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+t.Token)
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := trackerClient(t.HTTP).Do(req)
+	if err != nil {
+		return fmt.Errorf("Todoist request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Todoist %s %s failed: %s %s", method, path, resp.Status, strings.TrimSpace(string(message)))
+	}
+	if response == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode Todoist response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"mindpalace/pkg/eventsourcing"
+	"mindpalace/pkg/logging"
+)
+
+// syncTimeout bounds a single sync with an issue tracker
+const syncTimeout = 2 * time.Minute
+
+// Labels marking the status of open tasks in trackers without statuses of their own
+const (
+	labelInProgress = "in progress"
+	labelBlocked    = "blocked"
+)
+
+// ExternalTask is a task as stored in an issue tracker, with statuses and priorities mapped to the task manager's
+type ExternalTask struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url,omitempty"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	Status      string    `json:"status"`
+	Priority    string    `json:"priority"`
+	Tags        []string  `json:"tags,omitempty"`
+	Deadline    time.Time `json:"deadline,omitempty"`
+}
+
+// fingerprint identifies the content of the task, to notice changes made in the tracker
+func (t ExternalTask) fingerprint() string {
+	t.ID, t.URL = "", ""
+	t.Tags = append([]string(nil), t.Tags...)
+	sort.Strings(t.Tags)
+	t.Deadline = t.Deadline.UTC()
+	data, _ := json.Marshal(t)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Tracker is an issue tracker tasks are imported from and exported to
+type Tracker interface {
+	// Name is the name the SyncTasks command refers to the tracker by
+	Name() string
+	// List returns the open tasks, and for trackers that keep them the closed ones
+	List(ctx context.Context) ([]ExternalTask, error)
+	// Create adds the task and returns it with its ID
+	Create(ctx context.Context, task ExternalTask) (ExternalTask, error)
+	// Update replaces the task with the same ID, closing or reopening it as needed
+	Update(ctx context.Context, task ExternalTask) (ExternalTask, error)
+}
+
+// TrackerLink ties a task to its copy in an issue tracker
+type TrackerLink struct {
+	Tracker     string `json:"tracker"`
+	ExternalID  string `json:"external_id"`
+	URL         string `json:"url,omitempty"`
+	Fingerprint string `json:"fingerprint"`     // Of the tracker's copy at the last sync
+	Dirty       bool   `json:"dirty,omitempty"` // Changed locally since the last sync
+}
+
+// statusFromLabels maps the labels of a task to its status and tags
+func statusFromLabels(labels []string) (string, []string) {
+	status := StatusPending
+	var tags []string
+	for _, label := range labels {
+		switch strings.ToLower(label) {
+		case labelInProgress:
+			status = StatusInProgress
+		case labelBlocked:
+			status = StatusBlocked
+		default:
+			tags = append(tags, label)
+		}
+	}
+	return status, tags
+}
+
+// matchPriority returns the priority named case-insensitively, or "" for an unknown name
+func matchPriority(name string) string {
+	for _, priority := range []string{PriorityLow, PriorityMedium, PriorityHigh, PriorityCritical} {
+		if strings.EqualFold(name, priority) {
+			return priority
+		}
+	}
+	return ""
+}
+
+// statusLabels returns the tags of a task with the label of its status
+func statusLabels(task ExternalTask) []string {
+	labels := append([]string(nil), task.Tags...)
+	switch task.Status {
+	case StatusInProgress:
+		labels = append(labels, labelInProgress)
+	case StatusBlocked:
+		labels = append(labels, labelBlocked)
+	}
+	return labels
+}
+
+// TaskLinkedEvent is emitted when a task was synced with an issue tracker
+type TaskLinkedEvent struct {
+	eventsourcing.EventMetadata
+	EventType   string `json:"event_type"`
+	TaskID      string `json:"task_id"`
+	Tracker     string `json:"tracker"`
+	ExternalID  string `json:"external_id"`
+	URL         string `json:"url,omitempty"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+func (e *TaskLinkedEvent) Type() string { return "taskmanager_TaskLinked" }
+func (e *TaskLinkedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *TaskLinkedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// TaskUnlinkedEvent is emitted when a task is no longer in the issue tracker it was synced with
+type TaskUnlinkedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	TaskID    string `json:"task_id"`
+}
+
+func (e *TaskUnlinkedEvent) Type() string { return "taskmanager_TaskUnlinked" }
+func (e *TaskUnlinkedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *TaskUnlinkedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// TasksSyncedEvent summarizes a sync with an issue tracker
+type TasksSyncedEvent struct {
+	eventsourcing.EventMetadata
+	EventType string `json:"event_type"`
+	Tracker   string `json:"tracker"`
+	Direction string `json:"direction"`
+	Imported  int    `json:"imported"`  // Tasks created from the tracker
+	Exported  int    `json:"exported"`  // Tasks created in the tracker
+	Pulled    int    `json:"pulled"`    // Tracker changes applied to tasks
+	Pushed    int    `json:"pushed"`    // Task changes applied in the tracker
+	Closed    int    `json:"closed"`    // Tasks completed because they left the tracker
+	Conflicts int    `json:"conflicts"` // Tasks changed on both sides, the tracker's change won
+	Error     string `json:"error,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (e *TasksSyncedEvent) Type() string { return "taskmanager_TasksSynced" }
+func (e *TasksSyncedEvent) Marshal() ([]byte, error) {
+	e.EventType = e.Type()
+	return json.Marshal(e)
+}
+func (e *TasksSyncedEvent) Unmarshal(data []byte) error { return json.Unmarshal(data, e) }
+
+// Sync directions
+const (
+	SyncBoth   = "both"
+	SyncImport = "import"
+	SyncExport = "export"
+)
+
+func (i *SyncTasksInput) New() any {
+	return &SyncTasksInput{}
+}
+
+// SyncTasksInput defines the input for syncing tasks with an issue tracker
+type SyncTasksInput struct {
+	eventsourcing.Progress
+	Tracker   string `json:"Tracker,omitempty"`
+	Direction string `json:"Direction,omitempty"`
+}
+
+func (s *SyncTasksInput) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Syncs tasks with GitHub Issues or Todoist: imports their tasks, exports local tasks and applies changes both ways",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Tracker": map[string]interface{}{
+					"type":        "string",
+					"description": "The issue tracker to sync with, optional when only one is configured",
+					"enum":        []string{"github", "todoist"},
+				},
+				"Direction": map[string]interface{}{
+					"type":        "string",
+					"description": "Whether to import tracker tasks, export local tasks, or both (default)",
+					"enum":        []string{SyncBoth, SyncImport, SyncExport},
+				},
+			},
+		},
+	}
+}
+
+// applyTrackerEvent updates the tracker links of the aggregate, the caller holds the lock
+func (a *TaskAggregate) applyTrackerEvent(eventType string, data []byte) error {
+	switch eventType {
+	case "taskmanager_TaskLinked":
+		var e TaskLinkedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal TaskLinked: %v", err)
+		}
+		a.Links[e.TaskID] = &TrackerLink{Tracker: e.Tracker, ExternalID: e.ExternalID, URL: e.URL, Fingerprint: e.Fingerprint}
+	case "taskmanager_TaskUnlinked":
+		var e TaskUnlinkedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to unmarshal TaskUnlinked: %v", err)
+		}
+		delete(a.Links, e.TaskID)
+	}
+	return nil
+}
+
+// markDirty records a local change of a linked task, the caller holds the lock
+func (a *TaskAggregate) markDirty(taskID string) {
+	if link, linked := a.Links[taskID]; linked {
+		link.Dirty = true
+	}
+}
+
+// taskSyncer holds the state of a single sync
+type taskSyncer struct {
+	ctx     context.Context
+	tracker Tracker
+	events  []eventsourcing.Event
+	summary TasksSyncedEvent
+	errors  []string
+}
+
+// syncTasks syncs the tasks and their links with the tracker. It returns the events applying the
+// tracker's changes and recording the exported ones, followed by a TasksSyncedEvent.
+func syncTasks(ctx context.Context, tracker Tracker, direction string, tasks map[string]Task, links map[string]TrackerLink, progress *eventsourcing.Progress) []eventsourcing.Event {
+	s := &taskSyncer{ctx: ctx, tracker: tracker}
+	s.summary.Tracker, s.summary.Direction = tracker.Name(), direction
+	pull := direction != SyncExport
+	push := direction != SyncImport
+
+	progress.Report(0, "Listing the tasks in "+tracker.Name())
+	external, err := tracker.List(ctx)
+	if err != nil {
+		s.fail(err)
+		return s.finish()
+	}
+	progress.Report(20, fmt.Sprintf("Comparing %d tasks of %s", len(external), tracker.Name()))
+	linkedByID := make(map[string]string)
+	for taskID, link := range links {
+		if link.Tracker == tracker.Name() {
+			linkedByID[link.ExternalID] = taskID
+		}
+	}
+
+	inTracker := make(map[string]bool, len(external))
+	for _, ext := range external {
+		inTracker[ext.ID] = true
+		taskID, linked := linkedByID[ext.ID]
+		task, exists := tasks[taskID]
+		if !linked || !exists {
+			// Closed issues are history, only open ones are imported
+			if pull && ext.Status != StatusCompleted {
+				s.importTask(ext)
+			}
+			continue
+		}
+		link := links[taskID]
+		changed := ext.fingerprint() != link.Fingerprint
+		switch {
+		case changed && pull:
+			if link.Dirty && push {
+				s.summary.Conflicts++
+			}
+			s.pullTask(task, ext)
+		case link.Dirty && push:
+			s.pushTask(task, link)
+		}
+	}
+
+	for _, taskID := range sortedKeys(links) {
+		link := links[taskID]
+		if link.Tracker != tracker.Name() || inTracker[link.ExternalID] {
+			continue
+		}
+		// Completed or deleted in the tracker
+		if task, exists := tasks[taskID]; exists && pull && task.Status != StatusCompleted {
+			s.events = append(s.events, &TaskCompletedEvent{
+				EventType:       "taskmanager_TaskCompleted",
+				TaskID:          taskID,
+				CompletedAt:     time.Now().UTC().Format(time.RFC3339),
+				CompletionNotes: "Closed in " + tracker.Name(),
+				PreviousStatus:  task.Status,
+			})
+			s.summary.Closed++
+		}
+		s.events = append(s.events, &TaskUnlinkedEvent{EventType: "taskmanager_TaskUnlinked", TaskID: taskID})
+	}
+
+	if push {
+		var unlinked []Task
+		for _, taskID := range sortedKeys(tasks) {
+			task := tasks[taskID]
+			if _, linked := links[taskID]; !linked && task.Status != StatusCompleted {
+				unlinked = append(unlinked, task)
+			}
+		}
+		// Exporting takes a request per task, the bulk of a first sync
+		for i, task := range unlinked {
+			progress.Report(50+50*i/len(unlinked), fmt.Sprintf("Exporting %q to %s", task.Title, tracker.Name()))
+			s.exportTask(task)
+		}
+	}
+	progress.Report(100, "Synced with "+tracker.Name())
+	return s.finish()
+}
+
+// importTask creates a task for a task of the tracker
+func (s *taskSyncer) importTask(ext ExternalTask) {
+	taskID := generateTaskID()
+	s.events = append(s.events, &TaskCreatedEvent{
+		EventType:   "taskmanager_TaskCreated",
+		TaskID:      taskID,
+		Title:       ext.Title,
+		Description: ext.Description,
+		Status:      ext.Status,
+		Priority:    ext.Priority,
+		Deadline:    formatTime(ext.Deadline),
+		Tags:        ext.Tags,
+	}, s.linked(taskID, ext))
+	s.summary.Imported++
+}
+
+// pullTask applies the tracker's copy to the task
+func (s *taskSyncer) pullTask(task Task, ext ExternalTask) {
+	tags := ext.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	previous := task
+	update := &TaskUpdatedEvent{
+		EventType:   "taskmanager_TaskUpdated",
+		TaskID:      task.TaskID,
+		Title:       ext.Title,
+		Description: ext.Description,
+		Priority:    ext.Priority,
+		Deadline:    formatTime(ext.Deadline),
+		Tags:        tags,
+		Previous:    &previous,
+	}
+	if ext.Status == StatusCompleted && task.Status != StatusCompleted {
+		s.events = append(s.events, update, &TaskCompletedEvent{
+			EventType:       "taskmanager_TaskCompleted",
+			TaskID:          task.TaskID,
+			CompletedAt:     time.Now().UTC().Format(time.RFC3339),
+			CompletionNotes: "Closed in " + s.tracker.Name(),
+			PreviousStatus:  task.Status,
+		})
+	} else {
+		update.Status = ext.Status
+		s.events = append(s.events, update)
+	}
+	s.events = append(s.events, s.linked(task.TaskID, ext))
+	s.summary.Pulled++
+}
+
+// pushTask applies the task to the tracker's copy
+func (s *taskSyncer) pushTask(task Task, link TrackerLink) {
+	ext := externalTask(task)
+	ext.ID = link.ExternalID
+	updated, err := s.tracker.Update(s.ctx, ext)
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	s.events = append(s.events, s.linked(task.TaskID, updated))
+	s.summary.Pushed++
+}
+
+// exportTask creates the task in the tracker
+func (s *taskSyncer) exportTask(task Task) {
+	created, err := s.tracker.Create(s.ctx, externalTask(task))
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	s.events = append(s.events, s.linked(task.TaskID, created))
+	s.summary.Exported++
+}
+
+func (s *taskSyncer) linked(taskID string, ext ExternalTask) *TaskLinkedEvent {
+	return &TaskLinkedEvent{
+		EventType:   "taskmanager_TaskLinked",
+		TaskID:      taskID,
+		Tracker:     s.tracker.Name(),
+		ExternalID:  ext.ID,
+		URL:         ext.URL,
+		Fingerprint: ext.fingerprint(),
+	}
+}
+
+func (s *taskSyncer) fail(err error) {
+	logging.Error("TASKMANAGER: Sync with %s failed: %v", s.tracker.Name(), err)
+	s.errors = append(s.errors, err.Error())
+}
+
+func (s *taskSyncer) finish() []eventsourcing.Event {
+	s.summary.EventType = "taskmanager_TasksSynced"
+	s.summary.Error = strings.Join(s.errors, "; ")
+	s.summary.Timestamp = eventsourcing.ISOTimestamp()
+	logging.Info("TASKMANAGER: Synced with %s, imported %d, exported %d, pulled %d, pushed %d",
+		s.summary.Tracker, s.summary.Imported, s.summary.Exported, s.summary.Pulled, s.summary.Pushed)
+	summary := s.summary
+	return append(s.events, &summary)
+}
+
+// externalTask maps a task to the tracker's fields
+func externalTask(task Task) ExternalTask {
+	return ExternalTask{
+		Title:       task.Title,
+		Description: task.Description,
+		Status:      task.Status,
+		Priority:    task.Priority,
+		Tags:        task.Tags,
+		Deadline:    task.Deadline,
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// syncState copies the tasks and links, so the tracker is accessed without the lock
+func (a *TaskAggregate) syncState() (map[string]Task, map[string]TrackerLink) {
+	a.Mu.RLock()
+	defer a.Mu.RUnlock()
+	tasks := make(map[string]Task, len(a.Tasks))
+	for id, task := range a.Tasks {
+		tasks[id] = *task
+	}
+	links := make(map[string]TrackerLink, len(a.Links))
+	for id, link := range a.Links {
+		links[id] = *link
+	}
+	return tasks, links
+}
+
+// configureTrackers creates the trackers named in the settings: github_repo with github_token, and todoist_token
+func configureTrackers(settings map[string]interface{}) (map[string]Tracker, error) {
+	trackers := make(map[string]Tracker)
+	if repo, _ := settings["github_repo"].(string); repo != "" {
+		if owner, name, found := strings.Cut(repo, "/"); !found || owner == "" || name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("github_repo %s must look like owner/repo", repo)
+		}
+		token, _ := settings["github_token"].(string)
+		trackers["github"] = &GitHubTracker{Repo: repo, Token: token}
+	}
+	if token, _ := settings["todoist_token"].(string); token != "" {
+		trackers["todoist"] = &TodoistTracker{Token: token}
+	}
+	return trackers, nil
+}
+
+func (p *TaskPlugin) syncTasksHandler(input *SyncTasksInput) ([]eventsourcing.Event, error) {
+	direction := input.Direction
+	if direction == "" {
+		direction = SyncBoth
+	}
+	if direction != SyncBoth && direction != SyncImport && direction != SyncExport {
+		return nil, fmt.Errorf("invalid direction: %s", input.Direction)
+	}
+
+	p.mu.RLock()
+	tracker, err := p.tracker(strings.ToLower(input.Tracker))
+	p.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	p.syncMu.Lock()
+	defer p.syncMu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+	tasks, links := p.aggregate.syncState()
+	return syncTasks(ctx, tracker, direction, tasks, links, &input.Progress), nil
+}
+
+// tracker returns the named tracker, or the only configured one when no name is given. The caller holds p.mu.
+func (p *TaskPlugin) tracker(name string) (Tracker, error) {
+	if name != "" {
+		tracker, ok := p.trackers[name]
+		if !ok {
+			return nil, fmt.Errorf("%s is not configured, set it up in [plugin.taskmanager]", name)
+		}
+		return tracker, nil
+	}
+	switch len(p.trackers) {
+	case 0:
+		return nil, fmt.Errorf("no issue tracker is configured, set github_repo or todoist_token in [plugin.taskmanager]")
+	case 1:
+		for _, tracker := range p.trackers {
+			return tracker, nil
+		}
+	}
+	return nil, fmt.Errorf("both github and todoist are configured, name the tracker to sync with")
+}
+
+// trackerClient returns the HTTP client trackers use by default
+func trackerClient(client *http.Client) *http.Client {
+	if client != nil {
+		return client
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
@@ -5,6 +5,13 @@ extends Node3D
 
 var websocket = WebSocketPeer.new()
 const WS_URL = "ws://localhost:8081/godot"
+
+# MindPalace passes the owner's token when it is shared with a household
+func ws_url() -> String:
+  var token = OS.get_environment("MINDPALACE_TOKEN")
+  if token == "":
+    return WS_URL
+  return WS_URL + "?token=" + token
 var connected = false
 var sent_start_signal = false
 
@@ -39,19 +46,45 @@ const EVENT_COLORS = {
   "calendar_event_updated": Color.HOT_PINK,
   "calendar_event_deleted": Color.DEEP_PINK,
   "calendar_event": Color.PINK,  # For full state calendar events
+  "email_unread": Color.LIGHT_SKY_BLUE,
+  "finance_spending": Color.CORAL,
   "plugin_generated": Color.PURPLE,
   "request_completed": Color.TEAL,
   "agent_call_decided": Color.MAGENTA,
   "agent_execution_failed": Color.DARK_RED,
   "tool_call_failed": Color.DARK_ORANGE,
   "tool_call_started": Color.ORANGE,
+  "tool_call_progress": Color.ORANGE,
   "tool_call_completed": Color.CYAN,
+  "tool_call_awaiting_confirmation": Color.GOLDENROD,
+  "tool_call_approved": Color.CYAN,
+  "tool_call_declined": Color.GRAY,
+  "request_cancelled": Color.GRAY,
+  "request_timed_out": Color.ORANGE,
+  "reminder_due": Color.RED,
   "orchestrator_ai": Color.GOLD,
 }
 
+# How the orchestrator's sphere shows its status: glow color, seconds per pulse (0 for none) and growth
+const PRESENCE_STYLES = {
+  "listening": {"color": Color.DEEP_SKY_BLUE, "period": 2.0, "grow": 1.1},
+  "thinking": {"color": Color.MEDIUM_PURPLE, "period": 1.2, "grow": 1.2},
+  "speaking": {"color": Color.GOLD, "period": 0.4, "grow": 1.15},
+  "error": {"color": Color.RED, "period": 0.0, "grow": 1.0},
+}
+
 # Store cubes by event ID for updates/deletes
 var event_cubes = {}
 
+# Open confirmation dialogs by tool call ID
+var confirmation_dialogs = {}
+
+# Sequence of the last event applied per aggregate, deltas at or below it are already shown
+var applied_sequences = {}
+
+# Aggregate that created each node, the camera shows the zone of an aggregate as the area of its nodes
+var node_aggregates = {}
+
 # UI for info panel
 var info_panel: Panel
 var info_label: Label
@@ -64,11 +97,23 @@ var targeting_reticle: ColorRect
 
 # Audio capture removed - backend handles it
 
+# Speech output streamed by the backend as 16-bit mono PCM
+var speech_player: AudioStreamPlayer
+var speech_playback: AudioStreamGeneratorPlayback
+var speech_muted: bool = false
+var mic_sample_rate: int = 16000  # Rate the server accepted for microphone audio
+var xr_enabled: bool = false  # Whether the server accepted XR and sends the XR hints of the objects
+var mute_voice_button: Button
+
 # Microphone settings menu (simplified - no audio level since backend captures)
 var settings_panel: Panel
 var settings_label: Label
 
 var settings_visible: bool = false
+var mic_device_option: OptionButton
+var noise_suppression_check: CheckBox
+var gain_normalization_check: CheckBox
+var mic_devices: Array = []  # Device names in the order of mic_device_option, "" for the configured ones
 
 # User request input
 var user_request_input: LineEdit
@@ -79,6 +124,9 @@ var game_log_panel: Panel
 var game_log_label: Label
 var game_log_text: String = ""
 
+# Palette the world is drawn in, sent by MindPalace
+var theme_name: String = ""
+
 # Environment reference for dynamic updates
 var world_env = null
 var env = null
@@ -181,13 +229,26 @@ func _ready():
     transcription_label.outline_size = 4
     add_child(transcription_label)
 
+    # Add streaming LLM response display
+    var llm_stream_label = Label3D.new()
+    llm_stream_label.name = "llm_stream_display"
+    llm_stream_label.text = ""
+    llm_stream_label.position = Vector3(0, 1, -3)
+    llm_stream_label.font_size = 48
+    llm_stream_label.width = 1200
+    llm_stream_label.autowrap_mode = TextServer.AUTOWRAP_WORD_SMART
+    llm_stream_label.modulate = Color(0.6, 1, 1)  # Cyan text
+    llm_stream_label.outline_modulate = Color(0, 0, 0)  # Black outline
+    llm_stream_label.outline_size = 4
+    add_child(llm_stream_label)
+
     # Create settings menu
     create_settings_menu()
 
     # No local audio level monitoring
 
     # Set up WebSocket connection
-    var err = websocket.connect_to_url(WS_URL)
+    var err = websocket.connect_to_url(ws_url())
     if err != OK:
         push_error("Failed to connect to WebSocket: ", err)
     else:
@@ -247,14 +308,16 @@ func _process(delta):
     # Process all available messages
     while websocket.get_available_packet_count() > 0:
       var packet = websocket.get_packet()
-      var message = packet.get_string_from_utf8()
-      _on_websocket_message(message)
+      if websocket.was_string_packet():
+        _on_websocket_message(packet.get_string_from_utf8())
+      else:
+        _on_websocket_binary(packet)
 
   elif state == WebSocketPeer.STATE_CLOSED:
     if connected:
       connected = false
     
-      var err = websocket.connect_to_url(WS_URL)
+      var err = websocket.connect_to_url(ws_url())
   
 
   # Update targeting HUD
@@ -269,12 +332,18 @@ var dragged_node_id = ""
 var is_dragging = false
 var drag_plane_normal = Vector3(0, 1, 0)  # Drag along XZ plane
 var drag_offset = Vector3()
+var drag_start_position = Vector3()
 
 func _input(event):
   if not settings_visible:
     if event is InputEventMouseButton:
       if event.button_index == MOUSE_BUTTON_LEFT:
-        if event.pressed:
+        if event.pressed and event.double_click:
+          # Double click - act on the object, e.g. complete a task
+          var clicked_id = get_node_id_at(event.position)
+          if clicked_id != "":
+            send_object_message("object_clicked", clicked_id)
+        elif event.pressed:
           # Mouse button pressed - start drag immediately
           start_drag(event.position)
         else:
@@ -312,6 +381,13 @@ func _input(event):
   if event is InputEventKey and event.keycode == KEY_TAB and event.pressed:
     toggle_settings_menu()
 
+  # Delete the targeted object after the user confirms
+  if event is InputEventKey and event.keycode == KEY_DELETE and event.pressed and not settings_visible:
+    if targeted_object:
+      var target_id = get_event_id_from_object(targeted_object)
+      if target_id != "":
+        confirm_delete(target_id)
+
 func _on_websocket_message(message: String):
   var json = JSON.new()
   var error = json.parse(message)
@@ -320,9 +396,71 @@ func _on_websocket_message(message: String):
     if data.has("type"):
       if data["type"] == "keypresses":
         process_keypresses(data)
+      elif data["type"] == "tts_audio":
+        play_speech_frame(data.get("final", false), float(data.get("sample_rate", 22050)), Marshalls.base64_to_raw(data.get("data", "")))
+      elif data["type"] == "audio_format":
+        mic_sample_rate = int(data.get("sample_rate", 16000))
+      elif data["type"] == "capabilities":
+        xr_enabled = "xr" in data.get("capabilities", [])
+      elif data["type"] == "audio_devices":
+        show_audio_devices(data)
+      elif data["type"] == "theme":
+        apply_theme(data)
+      elif data["type"] == "llm_status":
+        # The LLM went offline, failed over to its fallback or is back online
+        log_message(data.get("message", "LLM " + data.get("status", "")))
+      elif data["type"] == "shutdown":
+        # MindPalace stops, quit instead of reconnecting
+        get_tree().quit()
+      elif data["type"] == "camera":
+        direct_camera(data)
+      elif data["type"] == "world_query":
+        answer_world_query(data)
+      elif data["type"] == "deltas":
+        # Deltas of several events, batched by the server
+        for delta in data.get("deltas", []):
+          process_event_message(delta)
       else:
         process_event_message(data)
 
+# palette_color converts a color of a palette, [r, g, b, a] from 0 to 1
+func palette_color(rgba, fallback: Color) -> Color:
+  if typeof(rgba) != TYPE_ARRAY or rgba.size() < 3:
+    return fallback
+  var alpha = rgba[3] if rgba.size() > 3 else 1.0
+  return Color(rgba[0], rgba[1], rgba[2], alpha)
+
+# apply_theme draws the sky, the HUD and the objects in the palette the user picked
+func apply_theme(data: Dictionary):
+  var palette = data.get("palette", {})
+  var background = palette_color(palette.get("background"), Color(0.1, 0.1, 0.1))
+  var text = palette_color(palette.get("text"), Color.WHITE)
+  var accent = palette_color(palette.get("accent"), Color.WHITE)
+  var environment = $WorldEnvironment.environment
+  if environment and environment.sky and environment.sky.sky_material is ProceduralSkyMaterial:
+    var sky = environment.sky.sky_material
+    sky.sky_top_color = background
+    sky.sky_horizon_color = background.lerp(palette_color(palette.get("secondary"), Color.GRAY), 0.3)
+    sky.ground_bottom_color = background.darkened(0.5)
+    sky.ground_horizon_color = background
+  if environment:
+    environment.fog_light_color = background
+  var hud_style = StyleBoxFlat.new()
+  hud_style.bg_color = Color(background, 0.95)
+  targeting_hud_panel.add_theme_stylebox_override("panel", hud_style)
+  targeting_hud_label.add_theme_color_override("font_color", text)
+  game_log_label.add_theme_color_override("font_color", text)
+  targeting_reticle.color = accent
+
+  # Objects were created in the previous palette, they are created again in this one
+  var name = data.get("name", "")
+  if theme_name != "" and theme_name != name:
+    for node_id in event_cubes.keys():
+      delete_node(node_id)
+    send_ready_signal()
+  theme_name = name
+  log_message("Theme: " + name)
+
 func send_ready_signal():
   if websocket.get_ready_state() == WebSocketPeer.STATE_OPEN:
     var ready_msg = {
@@ -331,10 +469,22 @@ func send_ready_signal():
       "client_info": {
         "version": "1.0",
         "platform": "godot"
-      }
+      },
+      # Audio goes in binary frames, microphone audio at the rate Godot mixes at
+      "audio": {
+        "binary": true,
+        "sample_rates": [int(AudioServer.get_mix_rate())]
+      },
+      # XR when running in a headset, the objects then come with hints to grab and read them there
+      "capabilities": ["xr"] if xr_running() else []
     }
     var json_string = JSON.stringify(ready_msg)
     var err = websocket.send_text(json_string)
+
+# xr_running tells whether Godot renders to a VR or AR headset
+func xr_running() -> bool:
+  var xr_interface = XRServer.primary_interface
+  return xr_interface != null and xr_interface.is_initialized()
   
 
 func process_event_message(data: Dictionary):
@@ -351,8 +501,20 @@ func process_event_message(data: Dictionary):
     # Reset drag state when full state is reloaded
     end_drag()
 
+  # Skip deltas of events the last full state already included
+  var aggregate = data.get("aggregate", "")
+  var sequence = int(data.get("sequence", 0))
+  if is_full_state:
+    applied_sequences[aggregate] = sequence
+  elif sequence > 0:
+    if sequence <= applied_sequences.get(aggregate, 0):
+      return
+    applied_sequences[aggregate] = sequence
+
   # Handle DeltaEnvelope
   for action in data["actions"]:
+    if typeof(action) == TYPE_DICTIONARY and action.get("type", "") == "create":
+      node_aggregates[action.get("node_id", "")] = aggregate
     handle_action(action)
 
 func process_keypresses(data: Dictionary):
@@ -424,21 +586,45 @@ func handle_menu_keypresses(key_string: String):
       # Close menu
       toggle_settings_menu()
 
-func send_position_update(node_id: String, position: Vector3):
+# Tells the backend the user clicked, moved or deleted an object, the plugin owning it decides what that does
+func send_object_message(kind: String, node_id: String, extra: Dictionary = {}):
   if websocket.get_ready_state() != WebSocketPeer.STATE_OPEN:
     return
-  var update_msg = {
-    "type": "delta",
-    "actions": [{
-      "type": "update",
-      "node_id": node_id,
-      "properties": {
-        "position": [position.x, position.y, position.z]
-      }
-    }]
+  var msg = {
+    "type": kind,
+    "node_id": node_id
   }
-  var json_string = JSON.stringify(update_msg)
-  var err = websocket.send_text(json_string)
+  msg.merge(extra)
+  var err = websocket.send_text(JSON.stringify(msg))
+  if err != OK:
+    push_error("Failed to send ", kind, ": ", err)
+
+# Returns the node_id of the object under the mouse, empty if there is none
+func get_node_id_at(mouse_pos: Vector2) -> String:
+  var ray_origin = camera.project_ray_origin(mouse_pos)
+  var ray_dir = camera.project_ray_normal(mouse_pos)
+  var ray_length = 1000.0
+
+  var space_state = get_world_3d().direct_space_state
+  var query = PhysicsRayQueryParameters3D.create(ray_origin, ray_origin + ray_dir * ray_length)
+  var result = space_state.intersect_ray(query)
+  if result:
+    return get_event_id_from_object(result.collider)
+  return ""
+
+# Asks before deleting the object, deleting tasks and events from the 3D world is hard to take back
+func confirm_delete(node_id: String):
+  var dialog = ConfirmationDialog.new()
+  dialog.title = "Delete"
+  dialog.dialog_text = "Delete " + node_id + "?"
+  dialog.ok_button_text = "Delete"
+  dialog.confirmed.connect(func():
+    send_object_message("object_deleted", node_id)
+    dialog.queue_free())
+  dialog.canceled.connect(func(): dialog.queue_free())
+  add_child(dialog)
+  Input.mouse_mode = Input.MOUSE_MODE_VISIBLE
+  dialog.popup_centered()
 
 func send_state_update():
   if websocket.get_ready_state() != WebSocketPeer.STATE_OPEN:
@@ -477,6 +663,37 @@ func send_keypress_ack(keys: String, correlation_id: String, result: Dictionary)
   if err != OK:
     push_error("Failed to send keypress ACK: ", err)
 
+# Lists the nodes of the world and where they are, the agents find, focus and group nodes with them
+func answer_world_query(data: Dictionary):
+  if websocket.get_ready_state() != WebSocketPeer.STATE_OPEN:
+    return
+  var nodes = []
+  for node_id in event_cubes:
+    var node = event_cubes[node_id]
+    if not is_instance_valid(node) or not node is Node3D or node is Label3D:
+      continue
+    var entry = {
+      "node_id": node_id,
+      "position": [node.position.x, node.position.y, node.position.z],
+      "world_position": [node.global_position.x, node.global_position.y, node.global_position.z],
+    }
+    var display_info = node.get_meta("display_info", {})
+    if display_info is Dictionary:
+      if display_info.has("title"):
+        entry["title"] = str(display_info["title"])
+      if display_info.has("description"):
+        entry["description"] = str(display_info["description"])
+      if display_info.get("details") is Dictionary:
+        entry["details"] = display_info["details"]
+    nodes.append(entry)
+  var err = websocket.send_text(JSON.stringify({
+    "type": "world_nodes",
+    "query_id": data.get("query_id", ""),
+    "nodes": nodes
+  }))
+  if err != OK:
+    push_error("Failed to answer world query: ", err)
+
 func handle_click(mouse_pos: Vector2):
   # Handle click (not drag) - show info panel
   var ray_origin = camera.project_ray_origin(mouse_pos)
@@ -505,18 +722,12 @@ func start_drag(mouse_pos: Vector2):
   var result = space_state.intersect_ray(query)
 
   if result:
-    var clicked_node = result.collider
+    var node_id = get_event_id_from_object(result.collider)
 
-    while clicked_node and not (clicked_node in event_cubes.values()):
-      clicked_node = clicked_node.get_parent()
-
-    if clicked_node:
-      dragged_object = clicked_node
-      # Find the node_id
-      for id in event_cubes:
-        if event_cubes[id]["node"] == clicked_node:
-          dragged_node_id = id
-          break
+    if node_id != "":
+      dragged_object = event_cubes[node_id]["node"]
+      dragged_node_id = node_id
+      drag_start_position = dragged_object.position
       is_dragging = true
       log_message("Started dragging " + dragged_node_id)
 
@@ -558,10 +769,14 @@ func update_drag_position(mouse_pos: Vector2):
 
 func end_drag():
   if dragged_object and is_dragging:
-    # Send position update to backend
-    if dragged_node_id != "":
-      send_position_update(dragged_node_id, dragged_object.position)
-      log_message("Ended dragging " + dragged_node_id + " at " + str(dragged_object.position))
+    # Tell the backend where the object was dropped, a press without moving is no move
+    var pos = dragged_object.position
+    if dragged_node_id != "" and pos.distance_to(drag_start_position) > 0.1:
+      send_object_message("object_moved", dragged_node_id, {
+        "position": [pos.x, pos.y, pos.z],
+        "from": [drag_start_position.x, drag_start_position.y, drag_start_position.z]
+      })
+      log_message("Ended dragging " + dragged_node_id + " at " + str(pos))
 
     # Restore visual appearance
     if dragged_object is MeshInstance3D:
@@ -594,11 +809,19 @@ func handle_action(action: Dictionary):
       if node_type == "":
         return
       create_node(node_id, node_type, properties)
+      # Kept for the XR rig: the volume to touch the object in, whether to grab it and the text scale
+      if action.has("xr") and event_cubes.has(node_id):
+        event_cubes[node_id].set_meta("xr", action["xr"])
       # Add delay for debugging
       await get_tree().create_timer(0.5).timeout
     "update":
       update_node(node_id, properties)
-      log_message("Updated node " + node_id)
+      if node_id != "llm_stream_display":
+        log_message("Updated node " + node_id)
+      if properties.has("confirm_tool_call_id"):
+        show_confirmation(properties["confirm_tool_call_id"], properties.get("confirm_prompt", ""))
+      elif properties.has("confirmation_answered"):
+        close_confirmation(properties["confirmation_answered"])
     "delete":
       delete_node(node_id)
       log_message("Deleted node " + node_id)
@@ -666,7 +889,13 @@ func create_node(node_id: String, node_type: String, properties: Dictionary):
       
         # Override position with plugin-based zoning for better layout separation
         # Skip grid positioning for child nodes (they use local position)
-        if not properties.has("parent_id"):
+        if not properties.has("parent_id") and properties.get("arrangement", "") == "timeline" and properties.get("position") is Array and properties["position"].size() >= 3:
+          # Timelines place their objects themselves, e.g. the calendar's lane per day
+          var plugin_type = get_plugin_type(node_id, properties)
+          var zone = PLUGIN_ZONES.get(plugin_type, Vector3.ZERO)
+          var pos = properties["position"]
+          node.position = zone + Vector3(float(pos[0]), float(pos[1]), float(pos[2]))
+        elif not properties.has("parent_id"):
           var plugin_type = get_plugin_type(node_id, properties)
           if not plugin_counters.has(plugin_type):
             plugin_counters[plugin_type] = 0
@@ -686,6 +915,9 @@ func create_node(node_id: String, node_type: String, properties: Dictionary):
     if properties.has("position") and properties["position"] is Array and properties["position"].size() >= 3:
       var backend_pos = properties["position"]
       node.position.y = clamp(float(backend_pos[1]), -1000.0, 1000.0)
+    # Objects the user moved go back where they were left
+    if properties.has("layout_position"):
+      apply_layout_position(node, properties["layout_position"])
     if properties.has("scale"):
       var scl = properties["scale"]
       if scl is Array and scl.size() >= 3:
@@ -816,13 +1048,18 @@ func create_node(node_id: String, node_type: String, properties: Dictionary):
               offset_y = 1.0
           node.position = Vector3(0, offset_y, 0)
           log_message("Parented label " + node_id + " to " + parent_id + " at local pos " + str(node.position))
+        elif properties.has("position") and properties["position"] is Array and properties["position"].size() >= 3:
+          # Child meshes (e.g. subtasks) use the backend position as offset from their parent
+          var local_pos = properties["position"]
+          node.position = Vector3(float(local_pos[0]), float(local_pos[1]), float(local_pos[2]))
+          log_message("Parented node " + node_id + " to " + parent_id + " at local pos " + str(node.position))
       else:
         push_warning("Parent node " + parent_id + " not found for " + node_id)
     else:
       log_message("Created node " + node_id + " at " + str(node.position) + " (plugin: " + get_plugin_type(node_id, properties) + ")")
 
 func update_node(node_id: String, properties: Dictionary):
-    var node = event_cubes.get(node_id, {}).get("node", null)
+    var node = event_cubes.get(node_id, null)
     if node_id == "transcription_display":
         # Special handling for transcription display
         var transcription_node = get_node_or_null("transcription_display")
@@ -835,7 +1072,24 @@ func update_node(node_id: String, properties: Dictionary):
             transcription_node.outline_modulate = Color.BLACK
 
         return
+    if node_id == "llm_stream_display":
+        # Partial LLM output replaces the text as tokens stream in
+        var stream_node = get_node_or_null("llm_stream_display")
+        if stream_node and properties.has("text"):
+            stream_node.text = properties["text"]
+            if properties.get("is_final", false):
+                log_message("Response complete for " + str(properties.get("request_id", "")))
+        return
     if node:
+        if properties.has("display_info"):
+            # Ended tool calls bring their inspection, shown in the details panel
+            node.set_meta("display_info", properties["display_info"])
+        if properties.has("highlight"):
+            # The agent points out nodes the user asked about, e.g. the overdue tasks
+            set_highlight(node, bool(properties["highlight"]))
+        if properties.has("presence"):
+            # The orchestrator shows whether it listens, thinks, speaks or failed
+            set_presence(node, str(properties["presence"]))
         var plugin_type = get_plugin_type(node_id, properties)
         var zone = PLUGIN_ZONES.get(plugin_type, Vector3.ZERO)
         if node is Label3D:
@@ -843,7 +1097,12 @@ func update_node(node_id: String, properties: Dictionary):
                 node.text = properties["text"]
             if properties.has("event_type") and EVENT_COLORS.has(properties["event_type"]):
                 node.modulate = EVENT_COLORS[properties["event_type"]]
+            if properties.has("pulse"):
+                # Labels of running tool calls pulse while they report progress
+                set_pulse(node, bool(properties["pulse"]))
             return  # Skip position/scale/material for labels
+        if properties.has("layout_position"):
+            apply_layout_position(node, properties["layout_position"])
         # Skip position updates for now
         # if properties.has("position"):
         #     var pos = properties["position"]
@@ -870,6 +1129,8 @@ func update_node(node_id: String, properties: Dictionary):
                 var ry = float(rot[1])
                 var rz = float(rot[2])
                 node.rotation = Vector3(rx, ry, rz)
+        if properties.has("pulse"):
+            set_pulse(node, bool(properties["pulse"]))
         if node is MeshInstance3D and properties.has("color"):
             var c = properties["color"]
             if c is Array and c.size() >= 3:
@@ -884,6 +1145,148 @@ func update_node(node_id: String, properties: Dictionary):
                 node.material_override = material
 
 
+# Places a node where the user dragged it, the position is relative to its parent
+func apply_layout_position(node: Node3D, pos):
+    if pos is Array and pos.size() >= 3:
+        node.position = Vector3(
+            clamp(float(pos[0]), -1000.0, 1000.0),
+            clamp(float(pos[1]), -1000.0, 1000.0),
+            clamp(float(pos[2]), -1000.0, 1000.0))
+
+# Grows and shrinks a node in a loop while enabled, as a focus session on a task or a running tool call does
+func set_pulse(node: Node3D, enabled: bool):
+    if node.has_meta("pulse_tween"):
+        node.get_meta("pulse_tween").kill()
+        node.scale = node.get_meta("pulse_scale")
+        node.remove_meta("pulse_tween")
+        node.remove_meta("pulse_scale")
+    if not enabled:
+        return
+    var base_scale = node.scale
+    var tween = node.create_tween().set_loops()
+    tween.tween_property(node, "scale", base_scale * 1.25, 0.6).set_trans(Tween.TRANS_SINE)
+    tween.tween_property(node, "scale", base_scale, 0.6).set_trans(Tween.TRANS_SINE)
+    node.set_meta("pulse_tween", tween)
+    node.set_meta("pulse_scale", base_scale)
+
+# Makes a node glow over its own material while highlighted
+func set_highlight(node: Node3D, enabled: bool):
+    if not node is GeometryInstance3D:
+        return
+    if not enabled:
+        node.material_overlay = null
+        return
+    var glow = StandardMaterial3D.new()
+    glow.shading_mode = BaseMaterial3D.SHADING_MODE_UNSHADED
+    glow.transparency = BaseMaterial3D.TRANSPARENCY_ALPHA
+    glow.albedo_color = Color(1, 0.9, 0.2, 0.35)
+    glow.emission_enabled = true
+    glow.emission = Color(1, 0.9, 0.2)
+    node.material_overlay = glow
+
+# Animates the orchestrator's sphere with its status: a glow in the status's color, breathing slowly
+# while listening, pulsing while thinking and quickly while speaking; idle shows the sphere as created
+func set_presence(node: Node3D, status: String):
+    node.set_meta("presence", status)
+    if node.has_meta("presence_tween"):
+        node.get_meta("presence_tween").kill()
+        node.scale = node.get_meta("presence_scale")
+        node.remove_meta("presence_tween")
+        node.remove_meta("presence_scale")
+    if node is GeometryInstance3D:
+        node.material_overlay = null
+    if not PRESENCE_STYLES.has(status) or not node is GeometryInstance3D:
+        return
+    var style = PRESENCE_STYLES[status]
+    var glow = StandardMaterial3D.new()
+    glow.shading_mode = BaseMaterial3D.SHADING_MODE_UNSHADED
+    glow.transparency = BaseMaterial3D.TRANSPARENCY_ALPHA
+    glow.albedo_color = Color(style["color"], 0.4)
+    glow.emission_enabled = true
+    glow.emission = style["color"]
+    node.material_overlay = glow
+    if style["period"] <= 0:
+        return
+    var base_scale = node.scale
+    var tween = node.create_tween().set_loops()
+    tween.tween_property(node, "scale", base_scale * style["grow"], style["period"] / 2).set_trans(Tween.TRANS_SINE)
+    tween.tween_property(node, "scale", base_scale, style["period"] / 2).set_trans(Tween.TRANS_SINE)
+    node.set_meta("presence_tween", tween)
+    node.set_meta("presence_scale", base_scale)
+
+# Moves the camera as MindPalace directs: to a node, around a node or zone, or back until a zone is in view
+func direct_camera(data: Dictionary):
+    var action = data.get("action", "")
+    var distance = float(data.get("distance", 0))
+    var duration = float(data.get("duration", 0))
+    var target = Vector3.ZERO
+    var node_id = data.get("node_id", "")
+    var zone = data.get("zone", "")
+    if node_id != "":
+        var node = event_cubes.get(node_id, null)
+        if not is_instance_valid(node):
+            log_message("Nothing to show called " + node_id)
+            return
+        target = node.global_position
+        if distance <= 0:
+            distance = 6.0
+    elif zone != "":
+        var bounds = zone_bounds(zone)
+        target = bounds.get_center()
+        if distance <= 0:
+            # Far enough back to have the whole zone in view
+            distance = max(bounds.size.length() * 0.9, 8.0)
+    else:
+        return
+    match action:
+        "orbit":
+            orbit_camera(target, distance, duration if duration > 0 else 8.0)
+        "focus", "zoom_zone":
+            fly_camera_to(target, distance, duration if duration > 0 else 0.8)
+        _:
+            log_message("Unknown camera action " + str(action))
+            return
+    log_message("Showing " + (node_id if node_id != "" else zone))
+
+# Returns the area of the nodes an aggregate created, its plugin zone if it has none
+func zone_bounds(zone: String) -> AABB:
+    var bounds = null
+    for node_id in node_aggregates:
+        var node = event_cubes.get(node_id, null)
+        if node_aggregates[node_id] != zone or not is_instance_valid(node) or node is Label3D:
+            continue
+        if bounds == null:
+            bounds = AABB(node.global_position, Vector3.ZERO)
+        else:
+            bounds = bounds.expand(node.global_position)
+    if bounds != null:
+        return bounds
+    for plugin_type in PLUGIN_ZONES:
+        if zone.begins_with(plugin_type):
+            return AABB(PLUGIN_ZONES[plugin_type], Vector3.ZERO)
+    return AABB(PLUGIN_ZONES["default"], Vector3.ZERO)
+
+# Places the player the distance in front of and above the target, the camera looking at it
+func place_camera(target: Vector3, offset: Vector3):
+    var player = $Player
+    player.global_position = target + offset
+    if Vector2(offset.x, offset.z).length() < 0.01:
+        return  # Right above the target, there is no way to face it
+    player.look_at(Vector3(target.x, player.global_position.y, target.z), Vector3.UP)
+    camera.look_at(target, Vector3.UP)
+
+# Flies the player in front of the target
+func fly_camera_to(target: Vector3, distance: float, duration: float):
+    var start = $Player.global_position - target
+    var end = Vector3(0, distance * 0.5, distance)
+    var tween = create_tween()
+    tween.tween_method(func(weight: float): place_camera(target, start.lerp(end, weight)), 0.0, 1.0, duration).set_trans(Tween.TRANS_SINE)
+
+# Circles the player once around the target, looking at it
+func orbit_camera(target: Vector3, distance: float, duration: float):
+    var tween = create_tween()
+    tween.tween_method(func(angle: float): place_camera(target, Vector3(sin(angle) * distance, distance * 0.5, cos(angle) * distance)), 0.0, TAU, duration)
+
 func delete_node(node_id: String):
   var node = event_cubes.get(node_id, {}).get("node", null)
   if node:
@@ -1038,7 +1441,7 @@ func get_object_details(event_id: String, obj: Node) -> String:
         details += "Status: Scheduled\n"
     elif event_id == "orchestrator_ai":
         details += "🤖 Category: AI Orchestrator\n"
-        details += "Status: Active\n"
+        details += "Status: %s\n" % (node.get_meta("presence", "idle") if node else "idle").capitalize()
     else:
         details += "📦 Category: Event Object\n"
 
@@ -1185,6 +1588,30 @@ func create_settings_menu():
   light_hbox.add_child(light_slider)
   container.add_child(light_hbox)
 
+  # Microphone Section
+  var mic_label = Label.new()
+  mic_label.text = "🎙️ Microphone"
+  mic_label.add_theme_font_size_override("font_size", 18)
+  container.add_child(mic_label)
+
+  var mic_hbox = HBoxContainer.new()
+  mic_hbox.add_theme_constant_override("separation", 10)
+  mic_device_option = OptionButton.new()
+  mic_device_option.custom_minimum_size = Vector2(400, 30)
+  mic_device_option.add_item("Configured devices")
+  mic_devices = [""]
+  mic_device_option.connect("item_selected", Callable(self, "_on_mic_device_selected"))
+  mic_hbox.add_child(mic_device_option)
+  noise_suppression_check = CheckBox.new()
+  noise_suppression_check.text = "Noise suppression"
+  noise_suppression_check.connect("toggled", Callable(self, "_on_audio_processing_toggled").bind("noise_suppression"))
+  mic_hbox.add_child(noise_suppression_check)
+  gain_normalization_check = CheckBox.new()
+  gain_normalization_check.text = "Gain normalization"
+  gain_normalization_check.connect("toggled", Callable(self, "_on_audio_processing_toggled").bind("gain_normalization"))
+  mic_hbox.add_child(gain_normalization_check)
+  container.add_child(mic_hbox)
+
   # Actions Section
   var actions_label = Label.new()
   actions_label.text = "⚡ Quick Actions"
@@ -1204,6 +1631,11 @@ func create_settings_menu():
   create_task_button.size = Vector2(150, 40)
   create_task_button.connect("pressed", Callable(self, "_on_create_task"))
   buttons_hbox1.add_child(create_task_button)
+  mute_voice_button = Button.new()
+  mute_voice_button.text = "🔇 Mute Voice"
+  mute_voice_button.size = Vector2(150, 40)
+  mute_voice_button.connect("pressed", Callable(self, "_on_toggle_voice"))
+  buttons_hbox1.add_child(mute_voice_button)
   container.add_child(buttons_hbox1)
 
   var buttons_hbox2 = HBoxContainer.new()
@@ -1325,6 +1757,7 @@ func toggle_settings_menu():
 
   if settings_visible:
     Input.mouse_mode = Input.MOUSE_MODE_VISIBLE  # Release mouse for GUI interaction
+    send_audio_settings({})  # Refresh the microphones
   else:
     Input.mouse_mode = Input.MOUSE_MODE_CAPTURED  # Capture mouse for camera control
 
@@ -1345,6 +1778,48 @@ func _on_toggle_particles():
   if ambient_particles:
     ambient_particles.visible = !ambient_particles.visible
 
+func _on_toggle_voice():
+  speech_muted = !speech_muted
+  mute_voice_button.text = "🔊 Unmute Voice" if speech_muted else "🔇 Mute Voice"
+  if speech_muted and speech_player:
+    speech_player.stop()
+  if websocket.get_ready_state() == WebSocketPeer.STATE_OPEN:
+    websocket.send_text(JSON.stringify({"type": "tts_mute", "muted": speech_muted}))
+
+# Shows the microphones the server can capture from and its audio settings
+func show_audio_devices(data: Dictionary):
+  mic_device_option.clear()
+  mic_device_option.add_item("Configured devices")
+  mic_devices = [""]
+  var selected = data.get("selected", "")
+  var devices = data.get("devices", [])
+  if devices == null:
+    devices = []
+  for device in devices:
+    var label = device.get("description", "")
+    if label == "":
+      label = device["name"]
+    mic_device_option.add_item(label)
+    mic_devices.append(device["name"])
+  if selected != "" and not mic_devices.has(selected):
+    mic_device_option.add_item(selected)
+    mic_devices.append(selected)
+  mic_device_option.select(mic_devices.find(selected))
+  noise_suppression_check.set_pressed_no_signal(data.get("noise_suppression", false))
+  gain_normalization_check.set_pressed_no_signal(data.get("gain_normalization", false))
+
+func send_audio_settings(settings: Dictionary):
+  if websocket.get_ready_state() != WebSocketPeer.STATE_OPEN:
+    return
+  settings["type"] = "audio_settings"
+  websocket.send_text(JSON.stringify(settings))
+
+func _on_mic_device_selected(index: int):
+  send_audio_settings({"device": mic_devices[index]})
+
+func _on_audio_processing_toggled(pressed: bool, setting: String):
+  send_audio_settings({setting: pressed})
+
 func _on_create_task():
   send_request("Create a new task titled 'New Task from Control Panel'")
 
@@ -1360,6 +1835,82 @@ func _on_send_request():
     send_request(text)
     user_request_input.text = ""
 
+func setup_speech_player(sample_rate: float):
+  if speech_player == null:
+    speech_player = AudioStreamPlayer.new()
+    add_child(speech_player)
+  var generator = AudioStreamGenerator.new()
+  generator.mix_rate = sample_rate
+  generator.buffer_length = 30.0  # The backend synthesizes faster than real time
+  speech_player.stream = generator
+
+# Binary frames start with their opcode, numbers in them are little-endian
+const OP_MIC_AUDIO = 0x01
+const OP_SPEECH_AUDIO = 0x02
+
+func _on_websocket_binary(packet: PackedByteArray):
+  if packet.size() < 1:
+    return
+  if packet[0] == OP_SPEECH_AUDIO and packet.size() >= 12:
+    # Flags, seq, sample rate, request ID length and request ID before the PCM
+    var final = (packet[1] & 1) != 0
+    var sample_rate = float(packet.decode_u32(6))
+    var id_length = packet.decode_u16(10)
+    play_speech_frame(final, sample_rate, packet.slice(12 + id_length))
+
+# send_audio_chunk sends PCM16 mono microphone audio, at the rate the server accepted
+func send_audio_chunk(pcm: PackedByteArray):
+  if websocket.get_ready_state() != WebSocketPeer.STATE_OPEN:
+    return
+  var frame = PackedByteArray([OP_MIC_AUDIO])
+  frame.append_array(pcm)
+  websocket.send(frame, WebSocketPeer.WRITE_MODE_BINARY)
+
+func play_speech_frame(final: bool, sample_rate: float, pcm: PackedByteArray):
+  # The final frame carries no audio, the buffered speech plays out on its own
+  if speech_muted or final:
+    return
+  if speech_player == null or speech_player.stream.mix_rate != sample_rate:
+    setup_speech_player(sample_rate)
+  if not speech_player.playing:
+    speech_player.play()
+    speech_playback = speech_player.get_stream_playback()
+  var i = 0
+  while i + 1 < pcm.size():
+    var sample = pcm.decode_s16(i) / 32768.0
+    speech_playback.push_frame(Vector2(sample, sample))
+    i += 2
+
+# Asks the user to approve a destructive tool call the backend is holding back
+func show_confirmation(tool_call_id: String, prompt: String):
+  if confirmation_dialogs.has(tool_call_id):
+    return
+  var dialog = ConfirmationDialog.new()
+  dialog.title = "Confirm"
+  dialog.dialog_text = prompt
+  dialog.ok_button_text = "Yes"
+  dialog.cancel_button_text = "No"
+  dialog.confirmed.connect(func(): answer_confirmation(tool_call_id, true))
+  dialog.canceled.connect(func(): answer_confirmation(tool_call_id, false))
+  confirmation_dialogs[tool_call_id] = dialog
+  add_child(dialog)
+  Input.mouse_mode = Input.MOUSE_MODE_VISIBLE
+  dialog.popup_centered()
+
+func answer_confirmation(tool_call_id: String, approved: bool):
+  if not confirmation_dialogs.has(tool_call_id):
+    return
+  close_confirmation(tool_call_id)
+  if websocket.get_ready_state() == WebSocketPeer.STATE_OPEN:
+    websocket.send_text(JSON.stringify({"type": "confirm", "tool_call_id": tool_call_id, "approved": approved}))
+
+# Closes the dialog of a tool call, e.g. when it was answered in the chat
+func close_confirmation(tool_call_id: String):
+  if confirmation_dialogs.has(tool_call_id):
+    var dialog = confirmation_dialogs[tool_call_id]
+    confirmation_dialogs.erase(tool_call_id)
+    dialog.queue_free()
+
 func send_request(text: String):
   if websocket.get_ready_state() != WebSocketPeer.STATE_OPEN:
     return
@@ -1378,4 +1929,3 @@ func send_request(text: String):
 
 # Removed create_wav_header - no local audio processing
 
-# Removed _send_audio_chunk - backend handles capture